@@ -148,7 +148,6 @@ require (
 	github.com/go-openapi/swag v0.22.3 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
-	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/google/gnostic v0.6.9 // indirect
 	github.com/google/gofuzz v1.2.0 // indirect
 	github.com/googleapis/enterprise-certificate-proxy v0.2.3 // indirect
@@ -220,6 +219,8 @@ require (
 
 require (
 	github.com/brianvoe/gofakeit/v6 v6.25.0
+	github.com/golang/protobuf v1.5.3
 	github.com/pingcap/failpoint v0.0.0-20220801062533-2eaa32854a6c
+	github.com/tetratelabs/wazero v1.8.2
 	gopkg.in/ini.v1 v1.67.0
 )
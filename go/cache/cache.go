@@ -64,9 +64,13 @@ func NewDefaultCacheImpl(cfg *Config) Cache {
 		if cfg.MaxEntries == 0 {
 			return &nullCache{}
 		}
-		return NewLRUCache(cfg.MaxEntries, func(_ any) int64 {
+		cost := func(_ any) int64 {
 			return 1
-		})
+		}
+		if cfg.Sharded {
+			return NewShardedLRUCache(cfg.MaxEntries, cost)
+		}
+		return NewLRUCache(cfg.MaxEntries, cost)
 	}
 }
 
@@ -78,6 +82,9 @@ type Config struct {
 	MaxMemoryUsage int64
 	// LFU toggles whether to use a new cache implementation with a TinyLFU admission policy
 	LFU bool
+	// Sharded splits the LRU cache in shards with a lock each, for caches read by many
+	// goroutines at once. The LFU cache is always sharded.
+	Sharded bool
 }
 
 // DefaultConfig is the default configuration for a cache instance in Vitess
@@ -25,6 +25,11 @@ func TestNewDefaultCacheImpl(t *testing.T) {
 		require.True(t, ok)
 	}
 
+	assertShardedLRUCache := func(t *testing.T, cache Cache) {
+		_, ok := cache.(*ShardedLRUCache)
+		require.True(t, ok)
+	}
+
 	tests := []struct {
 		cfg    *Config
 		verify func(t *testing.T, cache Cache)
@@ -37,9 +42,12 @@ func TestNewDefaultCacheImpl(t *testing.T) {
 		{&Config{MaxEntries: 100, MaxMemoryUsage: 0, LFU: true}, assertNullCache},
 		{&Config{MaxEntries: 100, MaxMemoryUsage: 1000, LFU: true}, assertLFUCache},
 		{&Config{MaxEntries: 0, MaxMemoryUsage: 1000, LFU: true}, assertNullCache},
+		{&Config{MaxEntries: 100, MaxMemoryUsage: 0, LFU: false, Sharded: true}, assertShardedLRUCache},
+		{&Config{MaxEntries: 0, MaxMemoryUsage: 0, LFU: false, Sharded: true}, assertNullCache},
+		{&Config{MaxEntries: 100, MaxMemoryUsage: 1000, LFU: true, Sharded: true}, assertLFUCache},
 	}
 	for _, tt := range tests {
-		t.Run(fmt.Sprintf("%d.%d.%v", tt.cfg.MaxEntries, tt.cfg.MaxMemoryUsage, tt.cfg.LFU), func(t *testing.T) {
+		t.Run(fmt.Sprintf("%d.%d.%v.%v", tt.cfg.MaxEntries, tt.cfg.MaxMemoryUsage, tt.cfg.LFU, tt.cfg.Sharded), func(t *testing.T) {
 			cache := NewDefaultCacheImpl(tt.cfg)
 			tt.verify(t, cache)
 		})
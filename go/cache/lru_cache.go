@@ -216,6 +216,19 @@ func (lru *LRUCache) Items() []Item {
 	return items
 }
 
+// entries returns a copy of the entries of the cache.
+func (lru *LRUCache) entries() []*entry {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	entries := make([]*entry, 0, lru.list.Len())
+	for e := lru.list.Front(); e != nil; e = e.Next() {
+		v := *e.Value.(*entry)
+		entries = append(entries, &v)
+	}
+	return entries
+}
+
 func (lru *LRUCache) updateInplace(element *list.Element, value any) {
 	valueSize := lru.cost(value)
 	sizeDiff := valueSize - element.Value.(*entry).size
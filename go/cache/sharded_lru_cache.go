@@ -0,0 +1,228 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cache
+
+import (
+	"hash/maphash"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var _ Cache = &ShardedLRUCache{}
+
+const (
+	// maxLRUShards is the most shards a ShardedLRUCache is split in.
+	maxLRUShards = 16
+	// minLRUShardCapacity is the least capacity a shard is given, a cache
+	// too small for two shards of this capacity is not split at all.
+	minLRUShardCapacity = 64
+)
+
+// ShardedLRUCache is an LRU cache split in shards by the hash of the key, each
+// one an LRUCache with its own lock, so the lookups of different keys don't
+// serialize on a single mutex. Each shard evicts its own least recently used
+// entries, the order of the evictions across the whole cache is approximate.
+type ShardedLRUCache struct {
+	// mu serializes the changes of the shard layout in SetCapacity and Clear,
+	// the lookups load the shards without taking it.
+	mu       sync.Mutex
+	shards   atomic.Pointer[[]*LRUCache]
+	seed     maphash.Seed
+	cost     func(any) int64
+	capacity atomic.Int64
+
+	// the counters of the shards dropped by a change of the layout.
+	evictions atomic.Int64
+	hits      atomic.Int64
+	misses    atomic.Int64
+}
+
+// NewShardedLRUCache creates a new empty sharded cache with the given capacity.
+func NewShardedLRUCache(capacity int64, cost func(any) int64) *ShardedLRUCache {
+	c := &ShardedLRUCache{
+		seed: maphash.MakeSeed(),
+		cost: cost,
+	}
+	c.capacity.Store(capacity)
+	shards := newLRUShards(capacity, cost)
+	c.shards.Store(&shards)
+	return c
+}
+
+// lruShardCount returns in how many shards a cache of the given capacity is split.
+func lruShardCount(capacity int64) int {
+	n := capacity / minLRUShardCapacity
+	switch {
+	case n < 1:
+		return 1
+	case n > maxLRUShards:
+		return maxLRUShards
+	}
+	return int(n)
+}
+
+// lruShardCapacity returns the capacity of the i-th of n shards, the remainder
+// of the division goes to the first shards so the capacities add up.
+func lruShardCapacity(capacity int64, n, i int) int64 {
+	shardCapacity := capacity / int64(n)
+	if int64(i) < capacity%int64(n) {
+		shardCapacity++
+	}
+	return shardCapacity
+}
+
+func newLRUShards(capacity int64, cost func(any) int64) []*LRUCache {
+	n := lruShardCount(capacity)
+	shards := make([]*LRUCache, n)
+	for i := range shards {
+		shards[i] = NewLRUCache(lruShardCapacity(capacity, n, i), cost)
+	}
+	return shards
+}
+
+func (c *ShardedLRUCache) loadShards() []*LRUCache {
+	return *c.shards.Load()
+}
+
+func (c *ShardedLRUCache) shard(key string) *LRUCache {
+	shards := c.loadShards()
+	if len(shards) == 1 {
+		return shards[0]
+	}
+	return shards[maphash.String(c.seed, key)%uint64(len(shards))]
+}
+
+// Get returns a value from the cache, and marks the entry as most
+// recently used in its shard.
+func (c *ShardedLRUCache) Get(key string) (any, bool) {
+	return c.shard(key).Get(key)
+}
+
+// Set sets a value in the cache.
+func (c *ShardedLRUCache) Set(key string, value any) bool {
+	return c.shard(key).Set(key, value)
+}
+
+// Delete removes an entry from the cache.
+func (c *ShardedLRUCache) Delete(key string) {
+	c.shard(key).Delete(key)
+}
+
+// Clear will clear the entire cache.
+func (c *ShardedLRUCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, shard := range c.loadShards() {
+		shard.Clear()
+	}
+}
+
+// Len returns the size of the cache (in entries)
+func (c *ShardedLRUCache) Len() int {
+	var n int
+	for _, shard := range c.loadShards() {
+		n += shard.Len()
+	}
+	return n
+}
+
+// SetCapacity will set the capacity of the cache. When the new capacity
+// splits in a different number of shards, the entries are moved to the new
+// shards in the order they were last used, and the least recently used ones
+// past the capacity are evicted.
+func (c *ShardedLRUCache) SetCapacity(capacity int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity.Store(capacity)
+	old := c.loadShards()
+	n := lruShardCount(capacity)
+	if n == len(old) {
+		for i, shard := range old {
+			shard.SetCapacity(lruShardCapacity(capacity, n, i))
+		}
+		return
+	}
+
+	var entries []*entry
+	for _, shard := range old {
+		entries = append(entries, shard.entries()...)
+		c.evictions.Add(shard.Evictions())
+		c.hits.Add(shard.Hits())
+		c.misses.Add(shard.Misses())
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].timeAccessed.Before(entries[j].timeAccessed)
+	})
+
+	shards := newLRUShards(capacity, c.cost)
+	resharded := &ShardedLRUCache{seed: c.seed}
+	resharded.shards.Store(&shards)
+	for _, e := range entries {
+		resharded.Set(e.key, e.value)
+	}
+	c.shards.Store(&shards)
+}
+
+// Wait is a no-op in the LRU cache
+func (c *ShardedLRUCache) Wait() {}
+
+// UsedCapacity returns the size of the cache (in bytes)
+func (c *ShardedLRUCache) UsedCapacity() int64 {
+	var size int64
+	for _, shard := range c.loadShards() {
+		size += shard.UsedCapacity()
+	}
+	return size
+}
+
+// MaxCapacity returns the cache maximum capacity.
+func (c *ShardedLRUCache) MaxCapacity() int64 {
+	return c.capacity.Load()
+}
+
+// Evictions returns the number of evictions
+func (c *ShardedLRUCache) Evictions() int64 {
+	evictions := c.evictions.Load()
+	for _, shard := range c.loadShards() {
+		evictions += shard.Evictions()
+	}
+	return evictions
+}
+
+// Hits returns number of cache hits since creation
+func (c *ShardedLRUCache) Hits() int64 {
+	hits := c.hits.Load()
+	for _, shard := range c.loadShards() {
+		hits += shard.Hits()
+	}
+	return hits
+}
+
+// Misses returns number of cache misses since creation
+func (c *ShardedLRUCache) Misses() int64 {
+	misses := c.misses.Load()
+	for _, shard := range c.loadShards() {
+		misses += shard.Misses()
+	}
+	return misses
+}
+
+// ForEach yields all the values for the cache, shard by shard, each shard
+// ordered from most recently used to least recently used.
+func (c *ShardedLRUCache) ForEach(callback func(value any) bool) {
+	for _, shard := range c.loadShards() {
+		more := true
+		shard.ForEach(func(value any) bool {
+			more = callback(value)
+			return more
+		})
+		if !more {
+			return
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func entryCost(_ any) int64 {
+	return 1
+}
+
+func TestShardedLRUCacheShards(t *testing.T) {
+	assert.Len(t, NewShardedLRUCache(1, entryCost).loadShards(), 1)
+	assert.Len(t, NewShardedLRUCache(minLRUShardCapacity*2-1, entryCost).loadShards(), 1)
+	assert.Len(t, NewShardedLRUCache(minLRUShardCapacity*2, entryCost).loadShards(), 2)
+	assert.Len(t, NewShardedLRUCache(5000, entryCost).loadShards(), maxLRUShards)
+
+	cache := NewShardedLRUCache(5003, entryCost)
+	var capacity int64
+	for _, shard := range cache.loadShards() {
+		capacity += shard.MaxCapacity()
+	}
+	assert.EqualValues(t, 5003, capacity)
+	assert.EqualValues(t, 5003, cache.MaxCapacity())
+}
+
+func TestShardedLRUCacheGetSetDelete(t *testing.T) {
+	cache := NewShardedLRUCache(5000, entryCost)
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), i)
+	}
+	assert.Equal(t, 1000, cache.Len())
+	assert.EqualValues(t, 1000, cache.UsedCapacity())
+
+	for i := 0; i < 1000; i++ {
+		v, ok := cache.Get(fmt.Sprintf("key%d", i))
+		require.True(t, ok)
+		assert.Equal(t, i, v)
+	}
+	_, ok := cache.Get("missing")
+	assert.False(t, ok)
+	assert.EqualValues(t, 1000, cache.Hits())
+	assert.EqualValues(t, 1, cache.Misses())
+
+	cache.Delete("key0")
+	_, ok = cache.Get("key0")
+	assert.False(t, ok)
+	assert.Equal(t, 999, cache.Len())
+
+	var seen int
+	cache.ForEach(func(_ any) bool {
+		seen++
+		return seen < 10
+	})
+	assert.Equal(t, 10, seen)
+
+	cache.Clear()
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestShardedLRUCacheEviction(t *testing.T) {
+	cache := NewShardedLRUCache(minLRUShardCapacity*4, entryCost)
+	for i := 0; i < minLRUShardCapacity*8; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), i)
+	}
+	// each shard holds at most its share of the capacity, and the entries
+	// it dropped are its least recently used ones.
+	assert.LessOrEqual(t, cache.Len(), minLRUShardCapacity*4)
+	assert.EqualValues(t, minLRUShardCapacity*8-cache.Len(), cache.Evictions())
+	for _, shard := range cache.loadShards() {
+		assert.Equal(t, shard.MaxCapacity(), int64(shard.Len()))
+	}
+}
+
+func TestShardedLRUCacheSetCapacity(t *testing.T) {
+	cache := NewShardedLRUCache(5000, entryCost)
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), i)
+	}
+	cache.Get("key0")
+
+	// shrinking to a single shard keeps the most recently used entries
+	cache.SetCapacity(1)
+	assert.Len(t, cache.loadShards(), 1)
+	assert.Equal(t, 1, cache.Len())
+	assert.EqualValues(t, 99, cache.Evictions())
+	assert.EqualValues(t, 1, cache.Hits())
+	v, ok := cache.Get("key0")
+	require.True(t, ok)
+	assert.Equal(t, 0, v)
+
+	cache.SetCapacity(5000)
+	assert.Len(t, cache.loadShards(), maxLRUShards)
+	assert.EqualValues(t, 5000, cache.MaxCapacity())
+	v, ok = cache.Get("key0")
+	require.True(t, ok)
+	assert.Equal(t, 0, v)
+}
+
+func TestShardedLRUCacheConcurrent(t *testing.T) {
+	cache := NewShardedLRUCache(1000, entryCost)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key%d", i%200)
+				cache.Set(key, i)
+				cache.Get(key)
+				if g == 0 && i%250 == 0 {
+					cache.SetCapacity(int64(500 + i))
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, cache.Len(), 200)
+}
+
+func BenchmarkLRUCacheContention(b *testing.B) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("select * from t where id = %d", i)
+	}
+	for _, tc := range []struct {
+		name  string
+		cache Cache
+	}{
+		{"LRU", NewLRUCache(5000, entryCost)},
+		{"ShardedLRU", NewShardedLRUCache(5000, entryCost)},
+	} {
+		for _, key := range keys {
+			tc.cache.Set(key, key)
+		}
+		b.Run(tc.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					tc.cache.Get(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/cmd/rulesctl/common"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules/upstream"
+)
+
+func ExportVitess() *cobra.Command {
+	var exportOptOutput string
+	var exportOptDatabase string
+
+	exportCmd := &cobra.Command{
+		Use:   "export-vitess",
+		Short: "Writes the rules of the config file as query rules of upstream Vitess",
+		Long: "Writes the rules of the config file as a query rules file of upstream Vitess,\n" +
+			"in the order of their priority. Upstream rules match the tables of the database\n" +
+			"served by the tablet, so only the rules on the tables of any database or of\n" +
+			"--database are written; the rules that can't be written are reported.",
+		Args: cobra.NoArgs,
+	}
+
+	exportCmd.Flags().StringVarP(
+		&exportOptOutput,
+		"output", "o",
+		"",
+		"The file to write the upstream rules to, instead of stdout")
+	exportCmd.Flags().StringVar(
+		&exportOptDatabase,
+		"database",
+		"",
+		"The database served by the upstream tablets")
+
+	exportCmd.Run = func(cmd *cobra.Command, args []string) {
+		rules := common.GetRules(configFile)
+		data, issues, err := upstream.Export(rules, exportOptDatabase)
+		if err != nil {
+			log.Fatalf("Unable to convert rules: %v", err)
+		}
+		for _, issue := range issues {
+			fmt.Fprintln(os.Stderr, issue)
+		}
+
+		if exportOptOutput == "" {
+			fmt.Printf("%s\n", data)
+			return
+		}
+		if err := os.WriteFile(exportOptOutput, data, 0644); err != nil {
+			log.Fatalf("Unable to write upstream rules: %v", err)
+		}
+	}
+
+	return exportCmd
+}
@@ -0,0 +1,81 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/cmd/rulesctl/common"
+	vtrules "vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules/proxysql"
+)
+
+func ImportProxySQL() *cobra.Command {
+	var importOptInput string
+	var importOptDryRun bool
+
+	importCmd := &cobra.Command{
+		Use:   "import-proxysql",
+		Short: "Converts the query rules of ProxySQL and adds them to the config file",
+		Long: "Converts the query rules of ProxySQL exported with\n" +
+			"  mysql --batch -e 'SELECT * FROM mysql_query_rules' > rules.tsv\n" +
+			"and adds them to the config file, replacing the ones imported before.\n" +
+			"Only the rules returning an error are converted; the columns that have no\n" +
+			"equivalent are reported.",
+		Args: cobra.NoArgs,
+	}
+
+	importCmd.Flags().StringVarP(
+		&importOptInput,
+		"input", "i",
+		"",
+		"The file with the exported ProxySQL rules (required)")
+	importCmd.Flags().BoolVarP(
+		&importOptDryRun,
+		"dry-run", "d",
+		false,
+		"Instead of writing the config file back print the result to stdout")
+	importCmd.MarkFlagRequired("input")
+
+	importCmd.Run = func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(importOptInput)
+		if err != nil {
+			log.Fatalf("Unable to open ProxySQL rules: %v", err)
+		}
+		defer f.Close()
+		proxyRules, err := proxysql.ParseTSV(f)
+		if err != nil {
+			log.Fatalf("Unable to parse ProxySQL rules: %v", err)
+		}
+		imported, issues := proxysql.Convert(proxyRules)
+		for _, issue := range issues {
+			fmt.Fprintln(os.Stderr, issue)
+		}
+
+		var rules *vtrules.Rules
+		if _, err := os.Stat(configFile); os.IsNotExist(err) {
+			rules = vtrules.New()
+		} else {
+			rules = common.GetRules(configFile)
+		}
+		for _, rule := range imported.CopyUnderlying() {
+			rules.Delete(rule.Name)
+			rules.Add(rule)
+		}
+
+		if importOptDryRun {
+			common.MustPrintJSON(rules)
+		} else {
+			common.MustWriteJSON(rules, configFile)
+		}
+	}
+
+	return importCmd
+}
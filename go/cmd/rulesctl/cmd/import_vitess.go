@@ -0,0 +1,77 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/cmd/rulesctl/common"
+	vtrules "vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules/upstream"
+)
+
+func ImportVitess() *cobra.Command {
+	var importOptInput string
+	var importOptDryRun bool
+
+	importCmd := &cobra.Command{
+		Use:   "import-vitess",
+		Short: "Adds the query rules of upstream Vitess to the config file",
+		Long: "Reads a query rules file of upstream Vitess and adds its rules to the config\n" +
+			"file, replacing the ones with the same name. The table names of the rules are\n" +
+			"matched in every database; the rules that can't be read are reported.",
+		Args: cobra.NoArgs,
+	}
+
+	importCmd.Flags().StringVarP(
+		&importOptInput,
+		"input", "i",
+		"",
+		"The upstream query rules file (required)")
+	importCmd.Flags().BoolVarP(
+		&importOptDryRun,
+		"dry-run", "d",
+		false,
+		"Instead of writing the config file back print the result to stdout")
+	importCmd.MarkFlagRequired("input")
+
+	importCmd.Run = func(cmd *cobra.Command, args []string) {
+		data, err := os.ReadFile(importOptInput)
+		if err != nil {
+			log.Fatalf("Unable to read upstream rules: %v", err)
+		}
+		imported, issues, err := upstream.Import(data)
+		if err != nil {
+			log.Fatalf("Unable to parse upstream rules: %v", err)
+		}
+		for _, issue := range issues {
+			fmt.Fprintln(os.Stderr, issue)
+		}
+
+		var rules *vtrules.Rules
+		if _, err := os.Stat(configFile); os.IsNotExist(err) {
+			rules = vtrules.New()
+		} else {
+			rules = common.GetRules(configFile)
+		}
+		for _, rule := range imported.CopyUnderlying() {
+			rules.Delete(rule.Name)
+			rules.Add(rule)
+		}
+
+		if importOptDryRun {
+			common.MustPrintJSON(rules)
+		} else {
+			common.MustWriteJSON(rules, configFile)
+		}
+	}
+
+	return importCmd
+}
@@ -29,6 +29,9 @@ func Main() *cobra.Command {
 	rootCmd.AddCommand(Remove())
 	rootCmd.AddCommand(Add())
 	rootCmd.AddCommand(Explain())
+	rootCmd.AddCommand(ImportProxySQL())
+	rootCmd.AddCommand(ImportVitess())
+	rootCmd.AddCommand(ExportVitess())
 
 	return rootCmd
 }
@@ -44,6 +44,7 @@ import (
 	"vitess.io/vitess/go/vt/tableacl/simpleacl"
 	"vitess.io/vitess/go/vt/topo"
 	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vttablet/binlogserver"
 	"vitess.io/vitess/go/vt/vttablet/tabletmanager"
 	"vitess.io/vitess/go/vt/vttablet/tabletmanager/vdiff"
 	"vitess.io/vitess/go/vt/vttablet/tabletmanager/vreplication"
@@ -117,6 +118,7 @@ func main() {
 	ts := topo.Open()
 	qsc := createTabletServer(config, ts, tabletAlias)
 	viperutil.RegisterReloadHandlersForVtTablet(vtTabletViperConfig, qsc)
+	binlogserver.Init(config.DB)
 
 	mysqld := mysqlctl.NewMysqld(config.DB)
 	servenv.OnClose(mysqld.Close)
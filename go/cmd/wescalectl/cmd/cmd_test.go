@@ -0,0 +1,491 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/vt/vtgate/workload"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm/wasmtest"
+)
+
+var testFilters = []adminapi.Filter{
+	{Name: "no_deletes", Priority: 10, Status: "ACTIVE", Plans: []string{"Delete"}, FullyQualifiedTableNames: []string{"db.t"}, Action: "FAIL"},
+	{Name: "etl_concurrency", Priority: 5, Status: "ACTIVE", WorkloadClassRegex: "etl", Action: "CONCURRENCY_CONTROL", ActionArgs: "max_concurrency=2"},
+	{Name: "big_ids", Priority: 20, Status: "ACTIVE", BindVarConds: []map[string]any{{"Name": "id", "OnAbsent": false, "OnMismatch": false, "Operator": ">", "Value": json.Number("100")}}, Action: "FAIL"},
+	{Name: "disabled", Priority: 1, Status: "INACTIVE", Action: "FAIL"},
+	{Name: "analytics_selects", Priority: 30, Status: "ACTIVE", Plans: []string{"Select"}, UserGroups: []string{"analytics"}, Action: "CONCURRENCY_CONTROL"},
+}
+
+// run runs wescalectl against a fake admin API serving the given responses
+// by method and path, and returns its output. A response can be a func of the
+// request.
+func run(t *testing.T, responses map[string]any, args ...string) (string, error) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, ok := responses[r.Method+" "+strings.TrimPrefix(r.URL.Path, adminapi.PathPrefix)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": {"code": 1105, "sql_state": "HY000", "message": "not found"}}`))
+			return
+		}
+		if f, ok := resp.(func(*http.Request) any); ok {
+			resp = f(r)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer apiServer.Close()
+	defer func(s, o, k string) { server, output, keyspace = s, o, k }(server, output, keyspace)
+
+	var out bytes.Buffer
+	rootCmd := Main()
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&bytes.Buffer{})
+	rootCmd.SetArgs(append([]string{"--server", apiServer.URL}, args...))
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+func TestFilterList(t *testing.T) {
+	list := adminapi.FilterList{Filters: testFilters[:2]}
+	out, err := run(t, map[string]any{"GET filters": list}, "filter", "list")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"NAME", "PRIORITY", "STATUS", "PLANS", "TABLES", "CONDITIONS", "ACTION"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"no_deletes", "10", "ACTIVE", "Delete", "db.t", "-", "FAIL"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"etl_concurrency", "5", "ACTIVE", "-", "-", "workload_class=etl", "CONCURRENCY_CONTROL", "max_concurrency=2"}, strings.Fields(lines[2]))
+
+	out, err = run(t, map[string]any{"GET filters": list}, "filter", "list", "-o", "json")
+	require.NoError(t, err)
+	var got adminapi.FilterList
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+	assert.Equal(t, list, got)
+
+	_, err = run(t, nil, "filter", "list", "-o", "yaml")
+	assert.EqualError(t, err, `invalid --output "yaml", must be table or json`)
+	_, err = run(t, nil, "filter", "get", "nope")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestSimulate(t *testing.T) {
+	for _, tcase := range []struct {
+		query   string
+		session simulatedSession
+		plan    string
+		matches []string
+	}{{
+		query:   "delete from t where id = 1",
+		session: simulatedSession{database: "db"},
+		plan:    "Delete",
+		matches: []string{"no_deletes"},
+	}, {
+		query:   "delete from t where id = :id",
+		session: simulatedSession{database: "other", bindVars: simulatedBindVars(map[string]string{"id": "1000"})},
+		plan:    "Delete",
+		matches: []string{"big_ids"},
+	}, {
+		query:   "/* leading */ select * from t",
+		session: simulatedSession{database: "db", workloadClass: "etl", bindVars: simulatedBindVars(map[string]string{"id": "10"})},
+		plan:    "Select",
+		matches: []string{"etl_concurrency"},
+	}, {
+		query:   "delete from t where id = :id",
+		session: simulatedSession{database: "db", workloadClass: "etl", bindVars: simulatedBindVars(map[string]string{"id": "1000"})},
+		plan:    "Delete",
+		matches: []string{"etl_concurrency", "no_deletes", "big_ids"},
+	}, {
+		query:   "select * from t",
+		session: simulatedSession{database: "db", user: "etl1", userGroups: map[string][]string{"analytics": {"etl1"}}},
+		plan:    "Select",
+		matches: []string{"analytics_selects"},
+	}, {
+		query:   "select * from t",
+		session: simulatedSession{database: "db", user: "etl1"},
+		plan:    "Select",
+	}, {
+		// The literals are bound like vtgate does.
+		query:   "delete from t where id = 1000",
+		session: simulatedSession{database: "db"},
+		plan:    "Delete",
+		matches: []string{"no_deletes", "big_ids"},
+	}} {
+		sim, err := simulate(testFilters, tcase.query, &tcase.session)
+		require.NoError(t, err, tcase.query)
+		assert.Equal(t, tcase.plan, sim.Plan, tcase.query)
+		var matches []string
+		for _, m := range sim.Matches {
+			matches = append(matches, m.Name)
+		}
+		assert.Equal(t, tcase.matches, matches, tcase.query)
+	}
+
+	digestFilters := []adminapi.Filter{{Name: "one_select", Priority: 10, Status: "ACTIVE", QueryDigest: "e94bc0ce", Action: "FAIL"}}
+	sim, err := simulate(digestFilters, "/* app */ select * from t where id = 42", &simulatedSession{database: "db"})
+	require.NoError(t, err)
+	assert.Equal(t, "e94bc0ce", sim.Digest)
+	assert.Len(t, sim.Matches, 1)
+
+	inTransaction := true
+	txFilters := []adminapi.Filter{{Name: "tx_selects", Priority: 10, Status: "ACTIVE", InTransaction: &inTransaction, Action: "FAIL"}}
+	sim, err = simulate(txFilters, "select * from t", &simulatedSession{database: "db", inTransaction: true})
+	require.NoError(t, err)
+	assert.Len(t, sim.Matches, 1)
+	sim, err = simulate(txFilters, "select * from t", &simulatedSession{database: "db"})
+	require.NoError(t, err)
+	assert.Empty(t, sim.Matches)
+
+	conflictFilters := []adminapi.Filter{
+		{Name: "allow_admin", Priority: 10, Status: "ACTIVE", UserRegex: "admin", Action: "CONTINUE"},
+		{Name: "no_selects", Priority: 20, Status: "ACTIVE", Action: "FAIL"},
+	}
+	for policy, want := range map[rules.ConflictPolicy][]string{
+		rules.ConflictPipeline:      {"no_selects"},
+		rules.ConflictFirstMatch:    {"allow_admin"},
+		rules.ConflictStrictestWins: {"no_selects"},
+	} {
+		sim, err = simulate(conflictFilters, "select * from t", &simulatedSession{database: "db", user: "admin", conflictPolicy: policy})
+		require.NoError(t, err)
+		var matches []string
+		for _, m := range sim.Matches {
+			matches = append(matches, m.Name)
+		}
+		assert.Equal(t, want, matches, policy)
+	}
+	_, err = run(t, map[string]any{"GET filters": adminapi.FilterList{}}, "filter", "simulate", "select 1", "--conflict-policy", "nope")
+	assert.ErrorContains(t, err, "invalid conflict policy")
+
+	// The members of the user groups are fetched for the filters which match
+	// user groups.
+	out, err := run(t, map[string]any{
+		"GET filters":     adminapi.FilterList{Filters: testFilters},
+		"GET user_groups": adminapi.UserGroupList{UserGroups: []adminapi.UserGroup{{Name: "analytics", Users: []string{"etl1"}}}},
+	}, "filter", "simulate", "select * from t", "--client-user", "etl1")
+	require.NoError(t, err)
+	assert.Contains(t, out, "analytics_selects")
+
+	_, err = simulate([]adminapi.Filter{{Name: "bad", Status: "ACTIVE", Plans: []string{"Nope"}, Action: "FAIL"}}, "select 1", &simulatedSession{})
+	assert.ErrorContains(t, err, "invalid filter bad")
+}
+
+func TestHealth(t *testing.T) {
+	health := adminapi.Health{Tablets: []adminapi.TabletHealth{
+		{Alias: "zone1-0000000100", Hostname: "h1", Keyspace: "ks", Shard: "0", TabletType: "primary", Serving: true, QPS: 12.5},
+		{Alias: "zone1-0000000101", Hostname: "h2", Keyspace: "ks", Shard: "0", TabletType: "replica", ReplicationLagSeconds: 3, Serving: true},
+	}}
+	out, err := run(t, map[string]any{"GET health": health}, "health")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"zone1-0000000101", "h2", "ks", "0", "replica", "true", "3s", "0.0", "-"}, strings.Fields(lines[2]))
+
+	// The health check fails if a tablet isn't serving.
+	health.Tablets[1].Serving = false
+	health.Tablets[1].Error = "no connection"
+	_, err = run(t, map[string]any{"GET health": health}, "health")
+	assert.EqualError(t, err, "1 of 2 tablets are not serving")
+}
+
+func TestLoad(t *testing.T) {
+	load := adminapi.Load{
+		VTGate: adminapi.VTGateLoad{QPS: 250, MaxQPS: 1000, QPSHeadroom: 0.75, BusyConnections: 3},
+		Shards: []adminapi.ShardLoad{
+			{Keyspace: "ks", Shard: "0", TabletType: "replica", Tablets: 2, QPS: 120, PoolSaturation: 0.625, ReplicationLagSeconds: 3, ReplicationLag: 0.1},
+		},
+	}
+	out, err := run(t, map[string]any{"GET load": load}, "load")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "vtgate: 250.0 QPS, 75% QPS headroom, 3 busy connections", lines[0])
+	assert.Equal(t, []string{"ks", "0", "replica", "2", "120.0", "62%", "10%", "(3s)"}, strings.Fields(lines[3]))
+}
+
+func TestPluginUpload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "mask.wasm")
+	binary := []byte("\x00asm\x01\x00\x00\x00")
+	require.NoError(t, os.WriteFile(file, binary, 0600))
+
+	var upload adminapi.PluginUpload
+	out, err := run(t, map[string]any{"POST plugins/mask/versions": func(r *http.Request) any {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&upload))
+		return adminapi.Plugin{Name: upload.Name, Version: upload.Version, Checksum: upload.Checksum, Size: int64(len(upload.Binary)), Current: true}
+	}}, "plugin", "upgrade", "mask", "--version", "1.1", "-f", file, "--metadata", "abi=1")
+	require.NoError(t, err)
+	sum := sha256.Sum256(binary)
+	assert.Equal(t, adminapi.PluginUpload{
+		Name:     "mask",
+		Version:  "1.1",
+		Metadata: map[string]string{"abi": "1"},
+		Binary:   binary,
+		Checksum: hex.EncodeToString(sum[:]),
+	}, upload)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"mask", "1.1", "*", "8", hex.EncodeToString(sum[:])[:12], "-", "-"}, strings.Fields(lines[1]))
+
+	_, err = run(t, nil, "plugin", "get", "mask@")
+	assert.EqualError(t, err, `invalid plugin version "": must be letters, digits, _, -, + and .`)
+}
+
+func TestPluginTest(t *testing.T) {
+	// The plugin rewrites the query, rejects the results and masks the rows.
+	plugin := wasmtest.New()
+	i32, i64 := wasmtest.I32, wasmtest.I64
+	getQuery := plugin.Import(wasm.HostModule, "get_query", nil, []wasmtest.ValType{i64})
+	setQuery := plugin.Import(wasm.HostModule, "set_query", []wasmtest.ValType{i32, i32}, []wasmtest.ValType{i32})
+	plugin.Plugin()
+	rewrite := "select id from t where id = :id limit 1"
+	continues := `{"action": "continue"}`
+	plugin.Hook(string(wasm.HookBeforeExecution),
+		wasmtest.Call(getQuery), wasmtest.Drop,
+		wasmtest.I32Const(int32(plugin.Data([]byte(rewrite)))), wasmtest.I32Const(int32(len(rewrite))), wasmtest.Call(setQuery), wasmtest.Drop,
+		wasmtest.Packed(plugin.Data([]byte(continues)), uint32(len(continues))))
+	plugin.Respond(string(wasm.HookAfterExecution), `{"action": "reject", "error": {"code": "PERMISSION_DENIED", "message": "no tenant"}}`)
+	plugin.Respond(string(wasm.HookOnError), continues)
+	plugin.Respond(string(wasm.HookResultRows), string(wasm.EncodeRows([]sqltypes.Row{{sqltypes.NewVarChar("***")}})))
+	dir := t.TempDir()
+	file := filepath.Join(dir, "mask.wasm")
+	require.NoError(t, os.WriteFile(file, plugin.Build(), 0600))
+	resultFile := filepath.Join(dir, "result.json")
+	require.NoError(t, os.WriteFile(resultFile, []byte(`{"fields": [{"name": "id", "type": "INT64"}], "rows": [["1"], ["2"]]}`), 0600))
+
+	query := "select id from t where id = :id"
+	out, err := run(t, nil, "plugin", "test", query, "-f", file, "--bind-var", "id=1", "--result", resultFile)
+	require.NoError(t, err)
+	assert.Contains(t, out, "before_execution (")
+	assert.Contains(t, out, "): continue\n  query: "+rewrite+"\n  get_query() = \"select id from t where id = :id\"\n  set_query(\""+rewrite+"\") = 0\n")
+	assert.Contains(t, out, "): reject: PERMISSION_DENIED: no tenant (plugin mask)\n")
+	assert.Contains(t, out, `): replace`+"\n"+`  result: {"fields":[{"name":"id","type":"INT64"}],"rows":[["***"]]}`)
+	assert.NotContains(t, out, "on_error")
+
+	out, err = run(t, nil, "plugin", "test", query, "-f", file, "--error", "table t is missing", "-o", "json")
+	require.NoError(t, err)
+	var got pluginTest
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+	assert.Equal(t, "mask", got.Plugin)
+	require.Len(t, got.Calls, 2)
+	assert.Equal(t, wasm.HookBeforeExecution, got.Calls[0].Hook)
+	assert.Equal(t, rewrite, got.Calls[0].Query)
+	assert.Equal(t, []wasm.HostCall{{Func: "get_query", Result: query}, {Func: "set_query", Args: []any{rewrite}, Result: float64(0)}}, got.Calls[0].HostCalls)
+	assert.Equal(t, wasm.HookOnError, got.Calls[1].Hook)
+	assert.Equal(t, wasm.DecisionContinue, got.Calls[1].Decision)
+
+	// A call which hits a limit fails.
+	out, err = run(t, nil, "plugin", "test", query, "-f", file, "--hook", "before_execution", "--fuel", "1")
+	require.NoError(t, err)
+	assert.Contains(t, out, "failed: wasm plugin mask exceeded its fuel limit in before_execution")
+
+	_, err = run(t, nil, "plugin", "test", query, "-f", file, "--hook", "on_parse")
+	assert.ErrorContains(t, err, "invalid --hook on_parse, must be one of the tablet hooks")
+	_, err = run(t, nil, "plugin", "test", query, "-f", file, "--hook", "result_end")
+	assert.EqualError(t, err, "plugin mask doesn't export wescale_result_end")
+}
+
+func TestUserGroupSet(t *testing.T) {
+	var group adminapi.UserGroup
+	out, err := run(t, map[string]any{"PUT user_groups/analytics": func(r *http.Request) any {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&group))
+		return group
+	}}, "usergroup", "set", "analytics", "etl1", "etl2")
+	require.NoError(t, err)
+	assert.Equal(t, adminapi.UserGroup{Name: "analytics", Users: []string{"etl1", "etl2"}}, group)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"analytics", "etl1,etl2"}, strings.Fields(lines[1]))
+
+	_, err = run(t, nil, "usergroup", "set", "a b", "etl1")
+	assert.EqualError(t, err, `invalid user group name "a b": must be letters, digits, _ and -`)
+}
+
+func TestWorkloadCapture(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "workload.jsonl")
+	var duration string
+	out, err := run(t, map[string]any{"GET workload/capture": func(r *http.Request) any {
+		duration = r.URL.Query().Get("duration")
+		return workload.Query{Session: "s1", StmtType: "SELECT", SQL: "select 1 from dual", RowsReturned: 1}
+	}}, "workload", "capture", "--duration", "10m", "-f", file)
+	require.NoError(t, err)
+	assert.Equal(t, "10m0s", duration)
+	assert.Equal(t, "Captured 1 queries to "+file+".\n", out)
+	queries, err := workload.ReadFiles([]string{file})
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+	assert.Equal(t, "select 1 from dual", queries[0].SQL)
+}
+
+func TestPrintReport(t *testing.T) {
+	report := &workload.Report{
+		Queries:         3,
+		Sessions:        1,
+		Replayed:        3,
+		ErrorMismatches: 1,
+		Duration:        1500 * time.Millisecond,
+		CapturedLatency: workload.LatencySummary{P50: time.Millisecond, P90: 2 * time.Millisecond, P99: 2 * time.Millisecond, Max: 2 * time.Millisecond},
+		Mismatches:      []workload.Mismatch{{Session: "s1", SQL: "select * from t", ReplayedError: "table not found", CapturedRowsReturned: 2}},
+	}
+	var out bytes.Buffer
+	require.NoError(t, printReport(&out, report))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 10)
+	assert.Equal(t, "Replayed 3 of 3 queries of 1 sessions in 1.5s, skipped 0.", lines[0])
+	assert.Equal(t, "Error mismatches: 1", lines[1])
+	assert.Equal(t, []string{"captured", "1ms", "2ms", "2ms", "2ms"}, strings.Fields(lines[5]))
+	assert.Equal(t, "s1       select * from t  0 affected, 2 returned  error: table not found", lines[9])
+}
+
+func TestFilterResize(t *testing.T) {
+	filter := adminapi.Filter{Name: "etl_concurrency", Status: "ACTIVE", Action: "CONCURRENCY_CONTROL", ActionArgs: `{"max_queue_size": 10, "max_concurrency": 2, "fair_by": "user"}`}
+	var update adminapi.Filter
+	responses := map[string]any{
+		"GET filters/etl_concurrency": filter,
+		"PUT filters/etl_concurrency": func(r *http.Request) any {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+			return update
+		},
+	}
+	out, err := run(t, responses, "filter", "resize", "etl_concurrency", "--max-concurrency", "4")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"max_queue_size": 10, "max_concurrency": 4, "fair_by": "user"}`, update.ActionArgs)
+	assert.Contains(t, out, `"max_concurrency":4`)
+
+	_, err = run(t, responses, "filter", "resize", "etl_concurrency")
+	assert.EqualError(t, err, "no limit to change, expected --max-concurrency or --max-queue-size")
+	responses["GET filters/etl_concurrency"] = testFilters[0]
+	_, err = run(t, responses, "filter", "resize", "etl_concurrency", "--max-queue-size", "4")
+	assert.EqualError(t, err, "filter no_deletes is a FAIL filter, not a CONCURRENCY_CONTROL one")
+}
+
+func TestFilterTTL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "filter.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"name": "emergency", "fully_qualified_table_names": ["db.t"], "action": "FAIL"}`), 0o644))
+	var created adminapi.Filter
+	responses := map[string]any{
+		"POST filters": func(r *http.Request) any {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			return created
+		},
+	}
+	before := time.Now()
+	_, err := run(t, responses, "filter", "create", "--file", file, "--ttl", "30m")
+	require.NoError(t, err)
+	require.NotNil(t, created.ExpiresAt)
+	assert.WithinDuration(t, before.Add(30*time.Minute), *created.ExpiresAt, time.Minute)
+
+	expiresAt := time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC)
+	filter := adminapi.Filter{Name: "emergency", Priority: 95, Status: "ACTIVE", Action: "FAIL", ExpiresAt: &expiresAt}
+	scans := adminapi.Filter{Name: "scans", Priority: 96, Status: "ACTIVE", Action: "FAIL", AccessConds: `{"full_scan":true}`}
+	out, err := run(t, map[string]any{"GET filters": adminapi.FilterList{Filters: []adminapi.Filter{filter, scans}}}, "filter", "list")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"emergency", "95", "ACTIVE", "-", "-", "expires_at=2026-10-14T12:30:00Z", "FAIL"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"scans", "96", "ACTIVE", "-", "-", `access={"full_scan":true}`, "FAIL"}, strings.Fields(lines[2]))
+}
+
+func TestFilterHistory(t *testing.T) {
+	versions := []adminapi.FilterVersion{
+		{Version: 1, Operation: "create", ChangedBy: "alice", ChangedAt: "2026-10-14", Filter: &adminapi.Filter{Name: "no_deletes", Priority: 10, Status: "ACTIVE", Action: "FAIL"}},
+		{Version: 2, Operation: "delete", ChangedBy: "bob", ChangedAt: "2026-10-15"},
+	}
+	out, err := run(t, map[string]any{"GET filters/no_deletes/versions": adminapi.FilterVersionList{Versions: versions}}, "filter", "history", "no_deletes")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"1", "create", "alice", "2026-10-14", "10", "ACTIVE", "FAIL"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"2", "delete", "bob", "2026-10-15", "-", "-", "-"}, strings.Fields(lines[2]))
+
+	var rollback adminapi.FilterRollback
+	out, err = run(t, map[string]any{"POST filters/no_deletes/rollback": func(r *http.Request) any {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&rollback))
+		return adminapi.FilterVersion{Version: 3, Operation: "rollback", ChangedBy: "alice", RollbackTo: 1, Filter: versions[0].Filter}
+	}}, "filter", "rollback", "no_deletes", "--to", "1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rollback.Version)
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"3", "rollback:1", "alice", "-", "10", "ACTIVE", "FAIL"}, strings.Fields(lines[1]))
+}
+
+func TestFilterExportImport(t *testing.T) {
+	doc := adminapi.FilterDocument{Database: "db", Filters: []adminapi.Filter{{Name: "db.no_deletes", Priority: 10, Status: "ACTIVE", Action: "FAIL"}}}
+	var query string
+	out, err := run(t, map[string]any{"GET filter_document": func(r *http.Request) any {
+		query = r.URL.RawQuery
+		return doc
+	}}, "filter", "export", "--database", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "database=db", query)
+	assert.Equal(t, "database: db\nfilters:\n- action: FAIL\n  name: db.no_deletes\n  priority: 10\n  status: ACTIVE\n", out)
+
+	// The document is sent as is, for the admin API to give the fields it
+	// doesn't set their defaults.
+	file := filepath.Join(t.TempDir(), "filters.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("filters:\n- name: db.no_deletes\n  action: FAIL\n"), 0o644))
+	var body []byte
+	out, err = run(t, map[string]any{"POST filter_document": func(r *http.Request) any {
+		query = r.URL.RawQuery
+		body, _ = io.ReadAll(r.Body)
+		return adminapi.FilterImportResult{Created: []string{"db.no_deletes"}, Deleted: []string{"db.old"}, Unchanged: []string{"db.t"}, DryRun: true}
+	}}, "filter", "import", "-f", file, "--prune", "--dry-run")
+	require.NoError(t, err)
+	assert.Equal(t, "dry_run=true&prune=true", query)
+	assert.Equal(t, "filters:\n- name: db.no_deletes\n  action: FAIL\n", string(body))
+	assert.Equal(t, "NAME           CHANGE\n"+
+		"db.no_deletes  created\n"+
+		"db.old         deleted\n"+
+		"db.t           unchanged\n", out)
+}
+
+func TestFilterActions(t *testing.T) {
+	sample := adminapi.Action{Action: "SAMPLE", Description: "Samples the queries.", Params: []adminapi.ActionParam{
+		{Name: "percentage", Type: "number", Required: true, Range: "in (0, 100]", Description: "The share of the sampled queries."},
+		{Name: "columns", Type: "list", Description: "The columns.", Items: &adminapi.ActionParam{Type: "object", Params: []adminapi.ActionParam{
+			{Name: "mode", Type: "string", Enum: []string{"redact", "hash"}, Default: "redact", Description: "The mode."},
+		}}},
+		{Name: "file", Type: "string", Description: "The file."},
+		{Name: "url", Type: "string", Description: "The URL."},
+	}, Constraints: []string{"exactly one of file and url is expected"}}
+	responses := map[string]any{
+		"GET actions":        adminapi.ActionList{Actions: []adminapi.Action{{Action: "STOP", Description: "Stops the rules."}, sample}},
+		"GET actions/SAMPLE": sample,
+	}
+	out, err := run(t, responses, "filter", "actions")
+	require.NoError(t, err)
+	assert.Equal(t, "ACTION  PARAMS                       DESCRIPTION\n"+
+		"STOP    -                            Stops the rules.\n"+
+		"SAMPLE  percentage,columns,file,url  Samples the queries.\n", out)
+
+	out, err = run(t, responses, "filter", "actions", "sample")
+	require.NoError(t, err)
+	assert.Equal(t, "PARAM           TYPE            REQUIRED  DEFAULT  VALUES       DESCRIPTION\n"+
+		"percentage      number          true      -        in (0, 100]  The share of the sampled queries.\n"+
+		"columns[]       list of object  false     -        -            The columns.\n"+
+		"columns[].mode  string          false     redact   redact,hash  The mode.\n"+
+		"file            string          false     -        -            The file.\n"+
+		"url             string          false     -        -            The URL.\n"+
+		"-               constraint      -         -        -            exactly one of file and url is expected\n", out)
+
+	_, err = run(t, responses, "filter", "actions", "explode")
+	assert.ErrorContains(t, err, "not found")
+}
@@ -0,0 +1,92 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+)
+
+func DDL() *cobra.Command {
+	ddlCmd := &cobra.Command{
+		Use:   "ddl",
+		Short: "Manages the online DDL migrations",
+		Args:  cobra.NoArgs,
+	}
+	ddlCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the migrations of the shards of the keyspace",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			migrations, err := client().ListMigrations(requestContext(cmd), keyspace)
+			if err != nil {
+				return err
+			}
+			return migrationTable(migrations).print(cmd.OutOrStdout())
+		},
+	})
+	ddlCmd.AddCommand(&cobra.Command{
+		Use:   "show <uuid>",
+		Short: "Shows a migration, on each shard",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			migrations, err := client().GetMigration(requestContext(cmd), keyspace, args[0])
+			if err != nil {
+				return err
+			}
+			return migrationTable(migrations).print(cmd.OutOrStdout())
+		},
+	})
+
+	var strategy string
+	submitCmd := &cobra.Command{
+		Use:   "submit <sql>",
+		Short: "Submits a DDL statement as a migration",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			uuids, err := client().SubmitMigration(requestContext(cmd), &adminapi.MigrationRequest{SQL: args[0], Strategy: strategy, Keyspace: keyspace})
+			if err != nil {
+				return err
+			}
+			t := &table{header: []string{"UUID"}, obj: adminapi.MigrationResponse{UUIDs: uuids}}
+			for _, uuid := range uuids {
+				t.add(uuid)
+			}
+			return t.print(cmd.OutOrStdout())
+		},
+	}
+	submitCmd.Flags().StringVar(&strategy, "strategy", "", `The DDL strategy, like "online --postpone-completion". The default is --ddl_strategy of vtgate`)
+	ddlCmd.AddCommand(submitCmd)
+
+	for _, action := range adminapi.MigrationActions {
+		action := action
+		ddlCmd.AddCommand(&cobra.Command{
+			Use:   action + " <uuid>",
+			Short: fmt.Sprintf("Runs ALTER VITESS_MIGRATION '<uuid>' %s", strings.ToUpper(action)),
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := client().AlterMigration(requestContext(cmd), keyspace, args[0], action); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Ran %s on migration %s\n", action, args[0])
+				return nil
+			},
+		})
+	}
+	return ddlCmd
+}
+
+func migrationTable(migrations []adminapi.Migration) *table {
+	t := &table{header: []string{"UUID", "SHARD", "TABLE", "STRATEGY", "STATUS", "PROGRESS", "ADDED", "MESSAGE"}, obj: adminapi.MigrationList{Migrations: migrations}}
+	for _, m := range migrations {
+		t.add(m.UUID, m.Keyspace+"/"+m.Shard, m.Table, m.Strategy, m.Status, fmt.Sprintf("%.0f%%", m.Progress), orNone(m.AddedAt), orNone(m.Message))
+	}
+	return t
+}
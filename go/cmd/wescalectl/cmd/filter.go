@@ -0,0 +1,455 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/yaml2"
+)
+
+func Filter() *cobra.Command {
+	filterCmd := &cobra.Command{
+		Use:   "filter",
+		Short: "Manages the filters, the query rules the tablets load from mysql.wescale_plugin",
+		Args:  cobra.NoArgs,
+	}
+	filterCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the filters, by priority",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filters, err := client().ListFilters(requestContext(cmd), keyspace)
+			if err != nil {
+				return err
+			}
+			return filterTable(filters, adminapi.FilterList{Filters: filters}).print(cmd.OutOrStdout())
+		},
+	})
+	filterCmd.AddCommand(&cobra.Command{
+		Use:   "get <name>",
+		Short: "Shows a filter",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := client().GetFilter(requestContext(cmd), keyspace, args[0])
+			if err != nil {
+				return err
+			}
+			return filterTable([]adminapi.Filter{*filter}, filter).print(cmd.OutOrStdout())
+		},
+	})
+
+	var file string
+	var ttl time.Duration
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Creates a filter",
+		Long: "Creates the filter of a JSON file, in the format of the Filter of the admin API:\n" +
+			`{"name": "no_deletes", "plans": ["Delete"], "action": "FAIL"}` + "\n" +
+			"With --ttl, the filter expires after it, like the ones blocking the queries of an incident.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := readFilter(cmd, file)
+			if err != nil {
+				return err
+			}
+			setFilterTTL(filter, ttl)
+			created, err := client().CreateFilter(requestContext(cmd), keyspace, filter)
+			if err != nil {
+				return err
+			}
+			return filterTable([]adminapi.Filter{*created}, created).print(cmd.OutOrStdout())
+		},
+	}
+	updateCmd := &cobra.Command{
+		Use:   "update <name>",
+		Short: "Replaces a filter",
+		Long:  "Replaces a filter with the one of a JSON file, which is named like it if it has no name.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := readFilter(cmd, file)
+			if err != nil {
+				return err
+			}
+			setFilterTTL(filter, ttl)
+			if filter.Name == "" {
+				filter.Name = args[0]
+			}
+			if filter.Name != args[0] {
+				return fmt.Errorf("the file has filter %s, not %s", filter.Name, args[0])
+			}
+			updated, err := client().UpdateFilter(requestContext(cmd), keyspace, filter)
+			if err != nil {
+				return err
+			}
+			return filterTable([]adminapi.Filter{*updated}, updated).print(cmd.OutOrStdout())
+		},
+	}
+	for _, c := range []*cobra.Command{createCmd, updateCmd} {
+		c.Flags().StringVarP(&file, "file", "f", "", "The JSON file of the filter, or - for stdin (required)")
+		c.MarkFlagRequired("file")
+		c.Flags().DurationVar(&ttl, "ttl", 0, "If set, the filter expires after this duration, overriding the expires_at of the file")
+		filterCmd.AddCommand(c)
+	}
+
+	filterCmd.AddCommand(&cobra.Command{
+		Use:   "delete <name>",
+		Short: "Deletes a filter",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client().DeleteFilter(requestContext(cmd), keyspace, args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted filter %s\n", args[0])
+			return nil
+		},
+	})
+
+	filterCmd.AddCommand(&cobra.Command{
+		Use:   "history <name>",
+		Short: "Lists the versions of a filter, which each change of it adds",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			versions, err := client().ListFilterVersions(requestContext(cmd), keyspace, args[0])
+			if err != nil {
+				return err
+			}
+			return filterVersionTable(versions, adminapi.FilterVersionList{Versions: versions}).print(cmd.OutOrStdout())
+		},
+	})
+	var to int64
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback <name>",
+		Short: "Restores a previous version of a filter, by default the one before its latest version",
+		Long: "Restores a previous version of a filter atomically, as a new version of it. Rolling back to a version\n" +
+			"which deleted the filter deletes it again.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := client().RollbackFilter(requestContext(cmd), keyspace, args[0], to)
+			if err != nil {
+				return err
+			}
+			return filterVersionTable([]adminapi.FilterVersion{*version}, version).print(cmd.OutOrStdout())
+		},
+	}
+	rollbackCmd.Flags().Int64Var(&to, "to", 0, "The version to roll back to")
+	filterCmd.AddCommand(rollbackCmd)
+
+	var database, format, documentFile string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Exports the filters to a JSON or YAML document",
+		Long: "Exports the filters of a database, the ones its name qualifies like db.no_deletes, or all the filters, to\n" +
+			"a document which filter import imports, in this cluster or in another one.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := client().ExportFilters(requestContext(cmd), keyspace, database)
+			if err != nil {
+				return err
+			}
+			var data []byte
+			switch format {
+			case "json":
+				if data, err = json.MarshalIndent(doc, "", "  "); err == nil {
+					data = append(data, '\n')
+				}
+			case "yaml":
+				data, err = yaml2.Marshal(doc)
+			default:
+				return fmt.Errorf("invalid --format %q, must be json or yaml", format)
+			}
+			if err != nil {
+				return err
+			}
+			if documentFile == "" || documentFile == "-" {
+				_, err = cmd.OutOrStdout().Write(data)
+				return err
+			}
+			return os.WriteFile(documentFile, data, 0o644)
+		},
+	}
+	exportCmd.Flags().StringVar(&database, "database", "", "If set, exports the filters of this database only")
+	exportCmd.Flags().StringVar(&format, "format", "yaml", "The format of the document, json or yaml")
+	exportCmd.Flags().StringVarP(&documentFile, "file", "f", "", "The file to write the document to, by default stdout")
+	filterCmd.AddCommand(exportCmd)
+
+	var opts adminapi.FilterImportOptions
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Imports the filters of a JSON or YAML document in one transaction",
+		Long: "Creates and updates the filters of a document, like the ones filter export writes, in one transaction once\n" +
+			"all of them are checked. With --prune, the filters the document doesn't have are deleted too, only the ones\n" +
+			"of its database if it has one. With --dry-run, the changes are shown but not made.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := readInput(cmd, documentFile)
+			if err != nil {
+				return err
+			}
+			result, err := client().ImportFilters(requestContext(cmd), keyspace, data, opts)
+			if err != nil {
+				return err
+			}
+			return filterImportTable(result).print(cmd.OutOrStdout())
+		},
+	}
+	importCmd.Flags().StringVarP(&documentFile, "file", "f", "", "The JSON or YAML file of the document, or - for stdin (required)")
+	importCmd.MarkFlagRequired("file")
+	importCmd.Flags().StringVar(&opts.Database, "database", "", "The database of the filters of the document, by default the one of the document")
+	importCmd.Flags().BoolVar(&opts.Prune, "prune", false, "Deletes the filters the document doesn't have")
+	importCmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "Shows the changes without making them")
+	filterCmd.AddCommand(importCmd)
+
+	var maxConcurrency, maxQueueSize int
+	resizeCmd := &cobra.Command{
+		Use:   "resize <name>",
+		Short: "Changes the limits of a CONCURRENCY_CONTROL filter",
+		Long: "Changes the max_concurrency or the max_queue_size of a CONCURRENCY_CONTROL filter. The tablets resize\n" +
+			"the queues of the filter in place as soon as they load it: the queries waiting in them keep their place.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			limits := map[string]int{}
+			if cmd.Flags().Changed("max-concurrency") {
+				limits["max_concurrency"] = maxConcurrency
+			}
+			if cmd.Flags().Changed("max-queue-size") {
+				limits["max_queue_size"] = maxQueueSize
+			}
+			if len(limits) == 0 {
+				return fmt.Errorf("no limit to change, expected --max-concurrency or --max-queue-size")
+			}
+			filter, err := client().GetFilter(requestContext(cmd), keyspace, args[0])
+			if err != nil {
+				return err
+			}
+			if filter.ActionArgs, err = resizeActionArgs(filter, limits); err != nil {
+				return err
+			}
+			updated, err := client().UpdateFilter(requestContext(cmd), keyspace, filter)
+			if err != nil {
+				return err
+			}
+			return filterTable([]adminapi.Filter{*updated}, updated).print(cmd.OutOrStdout())
+		},
+	}
+	resizeCmd.Flags().IntVar(&maxConcurrency, "max-concurrency", 0, "The max_concurrency of the filter")
+	resizeCmd.Flags().IntVar(&maxQueueSize, "max-queue-size", 0, "The max_queue_size of the filter")
+	filterCmd.AddCommand(resizeCmd)
+	filterCmd.AddCommand(&cobra.Command{
+		Use:   "actions [action]",
+		Short: "Lists the actions of the filters, or describes the params of the action args of one",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				actions, err := client().ListActions(requestContext(cmd))
+				if err != nil {
+					return err
+				}
+				t := &table{header: []string{"ACTION", "PARAMS", "DESCRIPTION"}, obj: adminapi.ActionList{Actions: actions}}
+				for _, act := range actions {
+					var params []string
+					for _, p := range act.Params {
+						params = append(params, p.Name)
+					}
+					t.add(act.Action, orNone(strings.Join(params, ",")), act.Description)
+				}
+				return t.print(cmd.OutOrStdout())
+			}
+			act, err := client().GetAction(requestContext(cmd), strings.ToUpper(args[0]))
+			if err != nil {
+				return err
+			}
+			return actionTable(act).print(cmd.OutOrStdout())
+		},
+	})
+	filterCmd.AddCommand(Simulate())
+	return filterCmd
+}
+
+// actionTable describes the params of an action, the ones of its object
+// params named after them, like adaptive.window, followed by the constraints
+// between them.
+func actionTable(act *adminapi.Action) *table {
+	t := &table{header: []string{"PARAM", "TYPE", "REQUIRED", "DEFAULT", "VALUES", "DESCRIPTION"}, obj: act}
+	var constraints []string
+	var add func(prefix string, params []adminapi.ActionParam, cs []string)
+	add = func(prefix string, params []adminapi.ActionParam, cs []string) {
+		for _, c := range cs {
+			constraints = append(constraints, prefix+c)
+		}
+		for _, p := range params {
+			name, typ, values := prefix+p.Name, p.Type, p.Range
+			if len(p.Enum) > 0 {
+				values = strings.Join(p.Enum, ",")
+			}
+			if len(p.Keys) > 0 {
+				values = "keys " + strings.Join(p.Keys, ",")
+			}
+			nested := p.Params
+			if p.Items != nil {
+				typ += " of " + p.Items.Type
+				if len(p.Items.Enum) > 0 {
+					values = strings.Join(p.Items.Enum, ",")
+				}
+				nested, cs = p.Items.Params, p.Items.Constraints
+				name += "[]"
+			} else {
+				cs = p.Constraints
+			}
+			t.add(name, typ, p.Required, orNone(p.Default), orNone(values), p.Description)
+			add(name+".", nested, cs)
+		}
+	}
+	add("", act.Params, act.Constraints)
+	for _, c := range constraints {
+		t.add("-", "constraint", "-", "-", "-", c)
+	}
+	return t
+}
+
+// readInput returns the content of a file, or of stdin if file is -.
+func readInput(cmd *cobra.Command, file string) ([]byte, error) {
+	if file == "-" {
+		return io.ReadAll(cmd.InOrStdin())
+	}
+	return os.ReadFile(file)
+}
+
+func readFilter(cmd *cobra.Command, file string) (*adminapi.Filter, error) {
+	data, err := readInput(cmd, file)
+	if err != nil {
+		return nil, err
+	}
+	var filter adminapi.Filter
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	if err := dec.Decode(&filter); err != nil {
+		return nil, fmt.Errorf("invalid filter in %s: %v", file, err)
+	}
+	return &filter, nil
+}
+
+// setFilterTTL makes a filter expire after ttl, if it is set.
+func setFilterTTL(f *adminapi.Filter, ttl time.Duration) {
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+		f.ExpiresAt = &expiresAt
+	}
+}
+
+// resizeActionArgs returns the action args of a CONCURRENCY_CONTROL filter
+// with the given limits, keeping its other params.
+func resizeActionArgs(f *adminapi.Filter, limits map[string]int) (string, error) {
+	if f.Action != rules.QRConcurrencyControl.ToString() {
+		return "", fmt.Errorf("filter %s is a %s filter, not a CONCURRENCY_CONTROL one", f.Name, f.Action)
+	}
+	params := map[string]any{}
+	if f.ActionArgs != "" {
+		dec := json.NewDecoder(strings.NewReader(f.ActionArgs))
+		dec.UseNumber()
+		if err := dec.Decode(&params); err != nil {
+			return "", fmt.Errorf("invalid action args of filter %s: %v", f.Name, err)
+		}
+	}
+	for name, limit := range limits {
+		params[name] = limit
+	}
+	args, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return string(args), nil
+}
+
+func filterTable(filters []adminapi.Filter, obj any) *table {
+	t := &table{header: []string{"NAME", "PRIORITY", "STATUS", "PLANS", "TABLES", "CONDITIONS", "ACTION"}, obj: obj}
+	for _, f := range filters {
+		action := f.Action
+		if f.ActionArgs != "" {
+			action += " " + f.ActionArgs
+		}
+		t.add(f.Name, f.Priority, f.Status, orNone(strings.Join(f.Plans, ",")), orNone(strings.Join(f.FullyQualifiedTableNames, ",")), orNone(filterConditions(&f)), action)
+	}
+	return t
+}
+
+// filterImportTable lists the changes of an import, by filter.
+func filterImportTable(result *adminapi.FilterImportResult) *table {
+	t := &table{header: []string{"NAME", "CHANGE"}, obj: result}
+	for _, changes := range []struct {
+		change string
+		names  []string
+	}{{"created", result.Created}, {"updated", result.Updated}, {"deleted", result.Deleted}, {"unchanged", result.Unchanged}} {
+		for _, name := range changes.names {
+			t.add(name, changes.change)
+		}
+	}
+	return t
+}
+
+func filterVersionTable(versions []adminapi.FilterVersion, obj any) *table {
+	t := &table{header: []string{"VERSION", "OPERATION", "CHANGED_BY", "CHANGED_AT", "PRIORITY", "STATUS", "ACTION"}, obj: obj}
+	for _, v := range versions {
+		operation := v.Operation
+		if v.RollbackTo != 0 {
+			operation = fmt.Sprintf("%s:%d", operation, v.RollbackTo)
+		}
+		priority, status, action := "-", "-", "-"
+		if f := v.Filter; f != nil {
+			priority, status, action = fmt.Sprint(f.Priority), f.Status, f.Action
+			if f.ActionArgs != "" {
+				action += " " + f.ActionArgs
+			}
+		}
+		t.add(v.Version, operation, orNone(v.ChangedBy), orNone(v.ChangedAt), priority, status, action)
+	}
+	return t
+}
+
+// filterConditions describes the execution conditions of a filter.
+func filterConditions(f *adminapi.Filter) string {
+	var conds []string
+	for _, cond := range []struct{ name, value string }{
+		{"query", f.QueryRegex},
+		{"template", f.QueryTemplate},
+		{"digest", f.QueryDigest},
+		{"ip", f.RequestIPRegex},
+		{"cidr", strings.Join(f.RequestCIDRs, ",")},
+		{"user", f.UserRegex},
+		{"user_groups", strings.Join(f.UserGroups, ",")},
+		{"workload_class", f.WorkloadClassRegex},
+		{"leading_comment", f.LeadingCommentRegex},
+		{"trailing_comment", f.TrailingCommentRegex},
+		{"schedule", f.Schedule},
+		{"outcome", f.OutcomeConds},
+		{"access", f.AccessConds},
+	} {
+		if cond.value != "" {
+			conds = append(conds, fmt.Sprintf("%s=%s", cond.name, cond.value))
+		}
+	}
+	if f.InTransaction != nil {
+		conds = append(conds, fmt.Sprintf("in_transaction=%t", *f.InTransaction))
+	}
+	if f.ExpiresAt != nil {
+		conds = append(conds, "expires_at="+f.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	for _, bvc := range f.BindVarConds {
+		conds = append(conds, fmt.Sprintf("bind_var=%v", bvc["Name"]))
+	}
+	return strings.Join(conds, " ")
+}
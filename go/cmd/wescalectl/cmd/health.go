@@ -0,0 +1,55 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+)
+
+func Health() *cobra.Command {
+	var all bool
+	healthCmd := &cobra.Command{
+		Use:   "health",
+		Short: "Reports the health of the tablets, as the health checks of vtgate see it",
+		Long: "Reports the health of the tablets of the keyspace, or of all the keyspaces with\n" +
+			"--all. It fails if a tablet isn't serving, so it can be used as a check.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ks := keyspace
+			if all {
+				ks = ""
+			}
+			tablets, err := client().GetHealth(requestContext(cmd), ks)
+			if err != nil {
+				return err
+			}
+			t := &table{
+				header: []string{"ALIAS", "HOSTNAME", "KEYSPACE", "SHARD", "TYPE", "SERVING", "LAG", "QPS", "ERROR"},
+				obj:    adminapi.Health{Tablets: tablets},
+			}
+			unhealthy := 0
+			for _, th := range tablets {
+				if !th.Serving {
+					unhealthy++
+				}
+				t.add(th.Alias, th.Hostname, th.Keyspace, th.Shard, th.TabletType, th.Serving, fmt.Sprintf("%ds", th.ReplicationLagSeconds), fmt.Sprintf("%.1f", th.QPS), orNone(th.Error))
+			}
+			if err := t.print(cmd.OutOrStdout()); err != nil {
+				return err
+			}
+			if unhealthy > 0 {
+				return fmt.Errorf("%d of %d tablets are not serving", unhealthy, len(tablets))
+			}
+			return nil
+		},
+	}
+	healthCmd.Flags().BoolVar(&all, "all", false, "Report the tablets of all the keyspaces")
+	return healthCmd
+}
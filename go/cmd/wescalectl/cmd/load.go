@@ -0,0 +1,52 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func Load() *cobra.Command {
+	var all bool
+	loadCmd := &cobra.Command{
+		Use:   "load",
+		Short: "Reports the load signals of vtgate and of the tablets, to drive autoscalers",
+		Long: "Reports the load of vtgate, and of the serving tablets of each type of each\n" +
+			"shard of the keyspace, or of all the keyspaces with --all. The signals are\n" +
+			"normalized in percents, 0% idle and 100% saturated.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ks := keyspace
+			if all {
+				ks = ""
+			}
+			load, err := client().GetLoad(requestContext(cmd), ks)
+			if err != nil {
+				return err
+			}
+			if output == outputTable {
+				headroom := "-"
+				if load.VTGate.MaxQPS > 0 {
+					headroom = fmt.Sprintf("%.0f%%", load.VTGate.QPSHeadroom*100)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "vtgate: %.1f QPS, %s QPS headroom, %d busy connections\n\n", load.VTGate.QPS, headroom, load.VTGate.BusyConnections)
+			}
+			t := &table{
+				header: []string{"KEYSPACE", "SHARD", "TYPE", "TABLETS", "QPS", "POOL", "LAG"},
+				obj:    load,
+			}
+			for _, shard := range load.Shards {
+				t.add(shard.Keyspace, shard.Shard, shard.TabletType, shard.Tablets, fmt.Sprintf("%.1f", shard.QPS),
+					fmt.Sprintf("%.0f%%", shard.PoolSaturation*100), fmt.Sprintf("%.0f%% (%ds)", shard.ReplicationLag*100, shard.ReplicationLagSeconds))
+			}
+			return t.print(cmd.OutOrStdout())
+		},
+	}
+	loadCmd.Flags().BoolVar(&all, "all", false, "Report the tablets of all the keyspaces")
+	return loadCmd
+}
@@ -0,0 +1,84 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	_flag "vitess.io/vitess/go/internal/flag"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+)
+
+var (
+	server   = "http://localhost:15001"
+	user     string
+	password string
+	keyspace string
+	output   = outputTable
+	timeout  = 30 * time.Second
+)
+
+func Main() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "wescalectl",
+		Short: "Administers a WeScale cluster through the admin API of vtgate",
+		Long: "Administers the filters, the online DDL migrations, the WASM plugins and the\n" +
+			"routing of a WeScale cluster, reports the health and the load of its tablets,\n" +
+			"and captures and replays its workload, through the admin API of a vtgate\n" +
+			"running with --enable_admin_api.",
+		Args: cobra.NoArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			_flag.TrickGlog()
+			return checkOutput()
+		},
+		Run:          func(cmd *cobra.Command, _ []string) { cmd.Help() },
+		SilenceUsage: true,
+	}
+
+	rootCmd.PersistentFlags().StringVar(&server, "server", server, "The URL of the web port of vtgate")
+	rootCmd.PersistentFlags().StringVarP(&user, "user", "u", user, "The user to authenticate as, with the --mysql_auth_server_impl of vtgate")
+	rootCmd.PersistentFlags().StringVarP(&password, "password", "p", password, "The password of the user. If empty, it is read from the WESCALE_PASSWORD environment variable")
+	rootCmd.PersistentFlags().StringVarP(&keyspace, "keyspace", "k", keyspace, "The keyspace, by default the default keyspace of vtgate")
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", output, "The output format: table or json")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", timeout, "The timeout of the requests to vtgate")
+
+	rootCmd.AddCommand(Filter())
+	rootCmd.AddCommand(UserGroup())
+	rootCmd.AddCommand(Routing())
+	rootCmd.AddCommand(DDL())
+	rootCmd.AddCommand(Plugin())
+	rootCmd.AddCommand(Health())
+	rootCmd.AddCommand(Load())
+	rootCmd.AddCommand(Workload())
+
+	return rootCmd
+}
+
+// client returns a client of the admin API of --server.
+func client() *adminapi.Client {
+	c := adminapi.NewClient(server).WithHTTPClient(&http.Client{Timeout: timeout})
+	if user != "" {
+		pw := password
+		if pw == "" {
+			pw = os.Getenv("WESCALE_PASSWORD")
+		}
+		c.WithBasicAuth(user, pw)
+	}
+	return c
+}
+
+// requestContext returns the context of the requests of a command.
+func requestContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
@@ -0,0 +1,66 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+func checkOutput() error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("invalid --output %q, must be %s or %s", output, outputTable, outputJSON)
+	}
+	return nil
+}
+
+// table is the output of a command: its rows, or obj in JSON.
+type table struct {
+	header []string
+	rows   [][]string
+	obj    any
+}
+
+func (t *table) add(values ...any) {
+	row := make([]string, len(values))
+	for i, v := range values {
+		row[i] = fmt.Sprint(v)
+	}
+	t.rows = append(t.rows, row)
+}
+
+func (t *table) print(w io.Writer) error {
+	if output == outputJSON {
+		enc, err := json.MarshalIndent(t.obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", enc)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// orNone returns "-" for the empty cells of a table.
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
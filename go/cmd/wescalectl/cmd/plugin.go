@@ -0,0 +1,127 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+)
+
+func Plugin() *cobra.Command {
+	pluginCmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "Manages the versions of the WASM plugins of the registry",
+		Long: "Manages the WASM plugins of the mysql.wescale_wasm_plugin registry, which keeps\n" +
+			"every installed version of a plugin. The rules reference a plugin as name@version,\n" +
+			"or as name for its current version, which upgrade and rollback change. test runs\n" +
+			"a plugin binary on a sample query, without a cluster.",
+		Args: cobra.NoArgs,
+	}
+	pluginCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the versions of the plugins",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plugins, err := client().ListPlugins(requestContext(cmd), keyspace)
+			if err != nil {
+				return err
+			}
+			return pluginTable(plugins, adminapi.PluginList{Plugins: plugins}).print(cmd.OutOrStdout())
+		},
+	})
+	pluginCmd.AddCommand(&cobra.Command{
+		Use:   "get <name>[@<version>]",
+		Short: "Shows a version of a plugin, by default its current version",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, _, err := adminapi.ParsePluginReference(args[0]); err != nil {
+				return err
+			}
+			plugin, err := client().GetPlugin(requestContext(cmd), keyspace, args[0])
+			if err != nil {
+				return err
+			}
+			return pluginTable([]adminapi.Plugin{*plugin}, plugin).print(cmd.OutOrStdout())
+		},
+	})
+
+	pluginCmd.AddCommand(pluginUploadCommand("install <name>", "Installs the first version of a plugin", (*adminapi.Client).InstallPlugin))
+	pluginCmd.AddCommand(pluginUploadCommand("upgrade <name>", "Upgrades a plugin to a new version, which becomes its current version", (*adminapi.Client).UpgradePlugin))
+
+	var to string
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback <name>",
+		Short: "Makes another version of a plugin current, by default the one installed before the current version",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plugin, err := client().RollbackPlugin(requestContext(cmd), keyspace, args[0], to)
+			if err != nil {
+				return err
+			}
+			return pluginTable([]adminapi.Plugin{*plugin}, plugin).print(cmd.OutOrStdout())
+		},
+	}
+	rollbackCmd.Flags().StringVar(&to, "to", "", "The version to roll back to")
+	pluginCmd.AddCommand(rollbackCmd)
+	pluginCmd.AddCommand(pluginTestCommand())
+	return pluginCmd
+}
+
+// pluginUploadCommand returns a command uploading a version of a plugin with
+// upload.
+func pluginUploadCommand(use, short string, upload func(*adminapi.Client, context.Context, string, *adminapi.PluginUpload) (*adminapi.Plugin, error)) *cobra.Command {
+	var version adminapi.PluginUpload
+	var file string
+	uploadCmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			binary, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			version.Name, version.Binary = args[0], binary
+			// The registry checks that it got the binary that was read.
+			sum := sha256.Sum256(binary)
+			version.Checksum = hex.EncodeToString(sum[:])
+			plugin, err := upload(client(), requestContext(cmd), keyspace, &version)
+			if err != nil {
+				return err
+			}
+			return pluginTable([]adminapi.Plugin{*plugin}, plugin).print(cmd.OutOrStdout())
+		},
+	}
+	uploadCmd.Flags().StringVar(&version.Version, "version", "", "The version (required)")
+	uploadCmd.Flags().StringVarP(&file, "file", "f", "", "The WASM module of the version (required)")
+	uploadCmd.Flags().StringVar(&version.Description, "description", "", "The description of the version")
+	uploadCmd.Flags().StringToStringVar(&version.Metadata, "metadata", nil, "The metadata of the version, as key=value")
+	uploadCmd.MarkFlagRequired("version")
+	uploadCmd.MarkFlagRequired("file")
+	return uploadCmd
+}
+
+func pluginTable(plugins []adminapi.Plugin, obj any) *table {
+	t := &table{header: []string{"NAME", "VERSION", "CURRENT", "SIZE", "CHECKSUM", "CREATED", "DESCRIPTION"}, obj: obj}
+	for _, p := range plugins {
+		current := ""
+		if p.Current {
+			current = "*"
+		}
+		checksum := p.Checksum
+		if len(checksum) > 12 {
+			checksum = checksum[:12]
+		}
+		t.add(p.Name, p.Version, orNone(current), p.Size, checksum, orNone(p.CreatedAt), orNone(p.Description))
+	}
+	return t
+}
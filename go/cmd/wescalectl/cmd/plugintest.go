@@ -0,0 +1,334 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// pluginTest is the run of the hooks of a plugin on a sample query.
+type pluginTest struct {
+	Plugin string     `json:"plugin"`
+	Calls  []hookCall `json:"calls"`
+}
+
+// hookCall is the call of a hook in a plugin test.
+type hookCall struct {
+	Hook     wasm.Hook     `json:"hook"`
+	Decision wasm.Decision `json:"decision,omitempty"`
+	// Error is the error the plugin rejected the query with, or replaced
+	// its error with.
+	Error *wasm.Error `json:"error,omitempty"`
+	// Result is the result the plugin replaced: the result of the query,
+	// the fields for result_fields, the rows for result_rows, or the rows to
+	// append for result_end.
+	Result *wasm.Result `json:"result,omitempty"`
+	// Query and BindVars are set if the plugin changed them.
+	Query    string                  `json:"query,omitempty"`
+	BindVars map[string]wasm.BindVar `json:"bind_vars,omitempty"`
+	// Failure is the error the call failed with, like a trap or a limit, and
+	// the queries would fail with.
+	Failure   string          `json:"failure,omitempty"`
+	HostCalls []wasm.HostCall `json:"host_calls"`
+	Time      string          `json:"time"`
+}
+
+// pluginTestQuery is the sample query a plugin test runs the hooks on.
+type pluginTestQuery struct {
+	session simulatedSession
+	// shard and tabletType are the target of the query, in the keyspace of
+	// its database.
+	shard, tabletType string
+	// result is the result of the query, and err its error.
+	result *sqltypes.Result
+	err    error
+}
+
+func pluginTestCommand() *cobra.Command {
+	var file, resultFile, queryErr string
+	var hooks []string
+	var bindVars map[string]string
+	var query pluginTestQuery
+	defaults := tabletenv.NewDefaultConfig().WasmPlugins
+	config := wasm.Config{
+		Limits:     wasm.Limits{Fuel: defaults.Fuel, MemoryPages: uint32(defaults.MaxMemoryPages), Timeout: defaults.TimeoutSeconds.Get()},
+		MaxMetrics: defaults.MaxMetrics,
+	}
+	testCmd := &cobra.Command{
+		Use:   "test <query>",
+		Short: "Runs the hooks of a plugin binary on a sample query, without a cluster",
+		Long: "Runs the tablet hooks of a plugin binary on a sample query, with the runtime and\n" +
+			"the limits of the tablets, and shows the decision of each hook, the changes it made\n" +
+			"to the query and the calls of the host functions it made. The query is passed to\n" +
+			"the plugin as is, like the tablets get it from vtgate. The hooks are called in the\n" +
+			"order of the lifecycle of the query, each one whatever the decisions of the ones\n" +
+			"before it, and get the query as before_execution changed it. The query succeeds\n" +
+			"with the result of --result, or fails with --error. The metrics of the plugin are\n" +
+			"shown by the calls of the host functions, and not published.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			binary, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			for _, hook := range hooks {
+				if !slices.Contains(wasm.TabletHooks, wasm.Hook(hook)) {
+					return fmt.Errorf("invalid --hook %s, must be one of the tablet hooks %v", hook, wasm.TabletHooks)
+				}
+			}
+			if query.session.database == "" {
+				query.session.database = keyspace
+			}
+			tabletType, err := topoproto.ParseTabletType(query.tabletType)
+			if err != nil {
+				return err
+			}
+			query.tabletType = topoproto.TabletTypeLString(tabletType)
+			query.session.bindVars = simulatedBindVars(bindVars)
+			if query.result, err = pluginTestResult(resultFile); err != nil {
+				return err
+			}
+			if queryErr != "" {
+				query.err = errors.New(queryErr)
+			}
+			run, err := runPluginTest(requestContext(cmd), strings.TrimSuffix(filepath.Base(file), ".wasm"), binary, config, args[0], &query, hooks)
+			if err != nil {
+				return err
+			}
+			return run.print(cmd.OutOrStdout())
+		},
+	}
+	testCmd.Flags().StringVarP(&file, "file", "f", "", "The WASM module of the plugin (required)")
+	testCmd.Flags().StringSliceVar(&hooks, "hook", nil, "The hooks to call, by default the tablet hooks the plugin exports")
+	testCmd.Flags().StringVar(&query.session.database, "database", "", "The database the query runs in, by default --keyspace")
+	testCmd.Flags().StringVar(&query.session.ip, "client-ip", "", "The IP address of the client sending the query")
+	testCmd.Flags().StringVar(&query.session.user, "client-user", "", "The user sending the query")
+	testCmd.Flags().StringVar(&query.session.workloadClass, "workload-class", "", "The workload class of the session sending the query")
+	testCmd.Flags().StringToStringVar(&bindVars, "bind-var", nil, "The bind variables of the query, as name=value. The values that are integers are bound as integers")
+	testCmd.Flags().StringVar(&query.shard, "shard", "0", "The shard of the tablet running the query")
+	testCmd.Flags().StringVar(&query.tabletType, "tablet-type", "primary", "The type of the tablet running the query")
+	testCmd.Flags().StringVar(&resultFile, "result", "", "A JSON file of the result of the query, as the plugins see it, like {\"fields\": [{\"name\": \"id\", \"type\": \"INT64\"}], \"rows\": [[\"1\"]]}")
+	testCmd.Flags().StringVar(&queryErr, "error", "", "The error the query fails with")
+	testCmd.Flags().Int64Var(&config.Limits.Fuel, "fuel", config.Limits.Fuel, "The fuel of a call, like --wasm_plugin_fuel of the tablets")
+	testCmd.Flags().Uint32Var(&config.Limits.MemoryPages, "max-memory-pages", config.Limits.MemoryPages, "The number of 64 KiB pages the memory of the plugin grows to at most, like --wasm_plugin_max_memory_pages of the tablets")
+	testCmd.Flags().DurationVar(&config.Limits.Timeout, "call-timeout", config.Limits.Timeout, "The wall-clock time a call takes at most, like --wasm_plugin_timeout of the tablets")
+	testCmd.MarkFlagRequired("file")
+	return testCmd
+}
+
+// pluginTestResult reads the result of a plugin test from a file, or returns
+// an empty result.
+func pluginTestResult(file string) (*sqltypes.Result, error) {
+	if file == "" {
+		return &sqltypes.Result{}, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var result wasm.Result
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid --result %s: %v", file, err)
+	}
+	sqlResult, err := result.SQLResult()
+	if err != nil {
+		return nil, fmt.Errorf("invalid --result %s: %v", file, err)
+	}
+	if sqlResult.RowsAffected == 0 {
+		sqlResult.RowsAffected = uint64(len(sqlResult.Rows))
+	}
+	return sqlResult, nil
+}
+
+// runPluginTest compiles a plugin and calls its hooks on a query like a
+// tablet would.
+func runPluginTest(ctx context.Context, name string, binary []byte, config wasm.Config, sql string, query *pluginTestQuery, hooks []string) (*pluginTest, error) {
+	explanation, err := rules.New().Explain(sql, &rules.ExplainSession{Database: query.session.database, BindVars: query.session.bindVars})
+	if err != nil {
+		return nil, err
+	}
+	rt := wasm.NewRuntime(config, servenv.NewExporter("PluginTest", "Tablet"))
+	defer rt.Close(ctx)
+	m, err := rt.Compile(ctx, name, binary)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &pluginTest{Plugin: name, Calls: []hookCall{}}
+	// The result hooks run in one instance of the plugin.
+	stream := &wasm.Stream{}
+	defer stream.Close()
+	fields := query.result.Fields
+	for _, hook := range wasm.TabletHooks {
+		switch {
+		case len(hooks) > 0 && !slices.Contains(hooks, string(hook)):
+			continue
+		case !m.Implements(hook):
+			if len(hooks) > 0 {
+				return nil, fmt.Errorf("plugin %s doesn't export %s", name, hook.Export())
+			}
+			continue
+		case query.err != nil && (hook == wasm.HookAfterExecution || hook == wasm.HookResultFields || hook == wasm.HookResultRows),
+			query.err == nil && hook == wasm.HookOnError,
+			hook == wasm.HookResultFields && query.result.Fields == nil,
+			hook == wasm.HookResultRows && len(query.result.Rows) == 0:
+			// The tablets don't call the hook for the query.
+			continue
+		}
+
+		call := &wasm.Call{
+			Hook:          hook,
+			Query:         sql,
+			BindVars:      make(map[string]*querypb.BindVariable, len(query.session.bindVars)),
+			User:          query.session.user,
+			IP:            query.session.ip,
+			WorkloadClass: query.session.workloadClass,
+			Plan:          explanation.Plan.String(),
+			Tables:        explanation.Tables,
+			Keyspace:      query.session.database,
+			Shard:         query.shard,
+			TabletType:    query.tabletType,
+		}
+		for bvName, bv := range query.session.bindVars {
+			call.BindVars[bvName] = bv
+		}
+		hc := hookCall{Hook: hook, HostCalls: []wasm.HostCall{}}
+		call.Trace = func(c wasm.HostCall) { hc.HostCalls = append(hc.HostCalls, c) }
+		switch hook {
+		case wasm.HookAfterExecution:
+			call.Result = query.result
+		case wasm.HookOnError:
+			call.Err = query.err
+		case wasm.HookResultFields:
+			call.Fields, call.Stream = query.result.Fields, stream
+		case wasm.HookResultRows:
+			call.Rows, call.Stream = query.result.Rows, stream
+		case wasm.HookResultEnd:
+			call.Result = &sqltypes.Result{RowsAffected: query.result.RowsAffected, InsertID: query.result.InsertID}
+			call.Err, call.Stream = query.err, stream
+		}
+
+		start := time.Now()
+		resp, err := m.Call(ctx, call)
+		hc.Time = time.Since(start).String()
+		if err != nil {
+			hc.Failure = err.Error()
+			run.Calls = append(run.Calls, hc)
+			continue
+		}
+		hc.Decision, hc.Error = resp.Decision, resp.Error
+		if resp.Decision == wasm.DecisionReplace {
+			hc.Result = resp.Result
+			// The results are checked like the tablets do.
+			switch hook {
+			case wasm.HookBeforeExecution, wasm.HookAfterExecution:
+				_, err = resp.Result.SQLResult()
+			case wasm.HookResultFields:
+				fields, err = wasm.QueryFields(resp.Result.Fields)
+			case wasm.HookResultRows:
+				err = wasm.TypeRows(resp.Rows, fields)
+				hc.Result = &wasm.Result{Fields: wasm.NewFields(fields), Rows: pluginRows(resp.Rows)}
+			case wasm.HookResultEnd:
+				_, err = resp.Result.SQLRows(fields)
+			}
+			if err != nil {
+				hc.Failure = fmt.Sprintf("plugin %s returned an invalid result: %v", name, err)
+			}
+		}
+		if hook == wasm.HookBeforeExecution && resp.Decision == wasm.DecisionContinue {
+			// The next hooks get the query as the plugin changed it.
+			if call.Query != sql {
+				hc.Query, sql = call.Query, call.Query
+			}
+			if before := wasm.NewBindVars(query.session.bindVars); !reflect.DeepEqual(before, wasm.NewBindVars(call.BindVars)) {
+				hc.BindVars, query.session.bindVars = wasm.NewBindVars(call.BindVars), call.BindVars
+			}
+		}
+		run.Calls = append(run.Calls, hc)
+	}
+	return run, nil
+}
+
+// pluginRows returns rows as the plugins see them.
+func pluginRows(rows []sqltypes.Row) [][]*string {
+	values := make([][]*string, len(rows))
+	for i, row := range rows {
+		values[i] = make([]*string, len(row))
+		for j, v := range row {
+			if !v.IsNull() {
+				s := v.ToString()
+				values[i][j] = &s
+			}
+		}
+	}
+	return values
+}
+
+func (run *pluginTest) print(w io.Writer) error {
+	if output == outputJSON {
+		return (&table{obj: run}).print(w)
+	}
+	if len(run.Calls) == 0 {
+		_, err := fmt.Fprintf(w, "Plugin %s implements none of the hooks the query calls.\n", run.Plugin)
+		return err
+	}
+	for i, c := range run.Calls {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		decision := string(c.Decision)
+		if c.Failure != "" {
+			decision = "failed: " + c.Failure
+		} else if c.Error != nil {
+			err := c.Error.Err(run.Plugin)
+			decision += fmt.Sprintf(": %v: %s", vterrors.Code(err), err.Error())
+		}
+		fmt.Fprintf(w, "%s (%s): %s\n", c.Hook, c.Time, decision)
+		if c.Result != nil {
+			result, err := json.Marshal(c.Result)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "  result: %s\n", result)
+		}
+		if c.Query != "" {
+			fmt.Fprintf(w, "  query: %s\n", c.Query)
+		}
+		if c.BindVars != nil {
+			bindVars, err := json.Marshal(c.BindVars)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "  bind vars: %s\n", bindVars)
+		}
+		for _, hostCall := range c.HostCalls {
+			fmt.Fprintf(w, "  %s\n", hostCall)
+		}
+	}
+	return nil
+}
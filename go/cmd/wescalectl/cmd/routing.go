@@ -0,0 +1,83 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+)
+
+func Routing() *cobra.Command {
+	routingCmd := &cobra.Command{
+		Use:   "routing",
+		Short: "Shows and changes the default read/write splitting of the sessions",
+		Args:  cobra.NoArgs,
+	}
+	routingCmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Shows the default read/write splitting of the sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			routing, err := client().GetRouting(requestContext(cmd))
+			if err != nil {
+				return err
+			}
+			return routingTable(routing).print(cmd.OutOrStdout())
+		},
+	})
+
+	var update adminapi.RoutingUpdate
+	var policy, consistency string
+	var ratio int
+	var raw float64
+	setCmd := &cobra.Command{
+		Use:   "set",
+		Short: "Changes the default read/write splitting of the sessions, as with SET GLOBAL",
+		Long:  "Changes the default read/write splitting of the sessions. Only the given flags change.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			if flags.Changed("policy") {
+				update.ReadWriteSplittingPolicy = &policy
+			}
+			if flags.Changed("ratio") {
+				update.ReadWriteSplittingRatio = &ratio
+			}
+			if flags.Changed("consistency") {
+				update.ReadAfterWriteConsistency = &consistency
+			}
+			if flags.Changed("read-after-write-timeout") {
+				update.ReadAfterWriteTimeout = &raw
+			}
+			if update == (adminapi.RoutingUpdate{}) {
+				return fmt.Errorf("nothing to change")
+			}
+			routing, err := client().UpdateRouting(requestContext(cmd), &update)
+			if err != nil {
+				return err
+			}
+			return routingTable(routing).print(cmd.OutOrStdout())
+		},
+	}
+	setCmd.Flags().StringVar(&policy, "policy", "", "The read/write splitting policy: disable, random or a least_* load balancing policy")
+	setCmd.Flags().IntVar(&ratio, "ratio", 0, "The percentage of the reads sent to the replicas, from 0 to 100")
+	setCmd.Flags().StringVar(&consistency, "consistency", "", "The read after write consistency: EVENTUAL, SESSION, INSTANCE or GLOBAL")
+	setCmd.Flags().Float64Var(&raw, "read-after-write-timeout", 0, "The read after write timeout, in seconds")
+	routingCmd.AddCommand(setCmd)
+	return routingCmd
+}
+
+func routingTable(routing *adminapi.Routing) *table {
+	t := &table{header: []string{"SETTING", "VALUE"}, obj: routing}
+	t.add("read_write_splitting_policy", routing.ReadWriteSplittingPolicy)
+	t.add("read_write_splitting_ratio", routing.ReadWriteSplittingRatio)
+	t.add("read_after_write_consistency", routing.ReadAfterWriteConsistency)
+	t.add("read_after_write_timeout", routing.ReadAfterWriteTimeout)
+	return t
+}
@@ -0,0 +1,196 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// simulation is the result of the simulation of a query against the filters.
+type simulation struct {
+	Plan   string   `json:"plan"`
+	Tables []string `json:"tables"`
+	// Digest is the digest of the query, which the query_digest of the
+	// filters match.
+	Digest string `json:"digest"`
+	// Matches are the filters the query matches, in the order the tablets
+	// apply them, resolved by the conflict policy of the tablets.
+	Matches []simulatedMatch `json:"matches"`
+}
+
+type simulatedMatch struct {
+	Name       string `json:"name"`
+	Priority   int    `json:"priority"`
+	Action     string `json:"action"`
+	ActionArgs string `json:"action_args,omitempty"`
+	// DryRun is set for the filters which only record what their action
+	// would do.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// simulatedSession is the session a simulated query is sent by.
+type simulatedSession struct {
+	database      string
+	ip            string
+	user          string
+	workloadClass string
+	inTransaction bool
+	bindVars      map[string]*querypb.BindVariable
+	// userGroups are the members of the user groups, by group.
+	userGroups map[string][]string
+	// conflictPolicy is the rule conflict policy of the tablets.
+	conflictPolicy rules.ConflictPolicy
+}
+
+func Simulate() *cobra.Command {
+	var session simulatedSession
+	var bindVars map[string]string
+	var conflictPolicy string
+	simulateCmd := &cobra.Command{
+		Use:   "simulate <query>",
+		Short: "Shows the filters a query would match",
+		Long: "Matches a query against the active filters the way the tablets do, and shows the\n" +
+			"filters it matches in the order their actions apply. The query is normalized\n" +
+			"like vtgate does with the default --normalize_queries, its literals bound as bind\n" +
+			"variables, and the digest of the normalized query is shown. The plan of the query is\n" +
+			"built without the schema of the tables, so the plans which depend on it, like\n" +
+			"the ones of the selects of sequences, may differ. The filters are resolved by\n" +
+			"the --queryserver-config-rule-conflict-policy of the tablets, which\n" +
+			"--conflict-policy sets.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if session.database == "" {
+				session.database = keyspace
+			}
+			session.bindVars = simulatedBindVars(bindVars)
+			policy, err := rules.ParseConflictPolicy(conflictPolicy)
+			if err != nil {
+				return err
+			}
+			session.conflictPolicy = policy
+			filters, err := client().ListFilters(requestContext(cmd), keyspace)
+			if err != nil {
+				return err
+			}
+			if session.userGroups, err = simulatedUserGroups(cmd, filters); err != nil {
+				return err
+			}
+			sim, err := simulate(filters, args[0], &session)
+			if err != nil {
+				return err
+			}
+			t := &table{header: []string{"PRIORITY", "NAME", "ACTION"}, obj: sim}
+			for _, m := range sim.Matches {
+				action := m.Action
+				if m.ActionArgs != "" {
+					action += " " + m.ActionArgs
+				}
+				if m.DryRun {
+					action += " (dry run)"
+				}
+				t.add(m.Priority, m.Name, action)
+			}
+			if output == outputTable {
+				fmt.Fprintf(cmd.OutOrStdout(), "Plan: %s\nTables: %s\nDigest: %s\n\n", sim.Plan, orNone(strings.Join(sim.Tables, ", ")), sim.Digest)
+				if len(sim.Matches) == 0 {
+					fmt.Fprintln(cmd.OutOrStdout(), "No filter matches the query.")
+					return nil
+				}
+			}
+			return t.print(cmd.OutOrStdout())
+		},
+	}
+	simulateCmd.Flags().StringVar(&session.database, "database", "", "The database the query runs in, by default --keyspace")
+	simulateCmd.Flags().StringVar(&session.ip, "client-ip", "", "The IP address of the client sending the query")
+	simulateCmd.Flags().StringVar(&session.user, "client-user", "", "The user sending the query")
+	simulateCmd.Flags().StringVar(&session.workloadClass, "workload-class", "", "The workload class of the session sending the query")
+	simulateCmd.Flags().BoolVar(&session.inTransaction, "in-transaction", false, "Whether the query runs in an explicit transaction")
+	simulateCmd.Flags().StringVar(&conflictPolicy, "conflict-policy", string(rules.ConflictPipeline), "The rule conflict policy of the tablets: pipeline, first_match or strictest_wins")
+	simulateCmd.Flags().StringToStringVar(&bindVars, "bind-var", nil, "The bind variables of the query, as name=value. The values that are integers are bound as integers")
+	return simulateCmd
+}
+
+// simulatedBindVars returns bind variables of the --bind-var values.
+func simulatedBindVars(values map[string]string) map[string]*querypb.BindVariable {
+	bindVars := make(map[string]*querypb.BindVariable, len(values))
+	for name, value := range values {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			bindVars[name] = sqltypes.Int64BindVariable(i)
+		} else {
+			bindVars[name] = sqltypes.StringBindVariable(value)
+		}
+	}
+	return bindVars
+}
+
+// simulatedUserGroups returns the members of the user groups, if one of the
+// filters matches user groups.
+func simulatedUserGroups(cmd *cobra.Command, filters []adminapi.Filter) (map[string][]string, error) {
+	for i := range filters {
+		if len(filters[i].UserGroups) > 0 {
+			groups, err := client().ListUserGroups(requestContext(cmd), keyspace)
+			if err != nil {
+				return nil, err
+			}
+			members := make(map[string][]string, len(groups))
+			for _, g := range groups {
+				members[g.Name] = g.Users
+			}
+			return members, nil
+		}
+	}
+	return nil, nil
+}
+
+// simulate matches a query against the filters like a tablet would.
+func simulate(filters []adminapi.Filter, sql string, session *simulatedSession) (*simulation, error) {
+	qrs := rules.New()
+	for i := range filters {
+		if filters[i].Status == rules.InActive {
+			continue
+		}
+		rule, err := rules.BuildQueryRule(filters[i].RuleInfo())
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %s: %v", filters[i].Name, err)
+		}
+		qrs.Add(rule)
+	}
+	qrs.SetUserGroups(session.userGroups)
+	qrs.SetConflictPolicy(session.conflictPolicy)
+
+	explanation, err := qrs.Explain(sql, &rules.ExplainSession{
+		Database:      session.database,
+		IP:            session.ip,
+		User:          session.user,
+		WorkloadClass: session.workloadClass,
+		InTransaction: session.inTransaction,
+		BindVars:      session.bindVars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sim := &simulation{Plan: explanation.Plan.String(), Tables: explanation.Tables, Digest: explanation.Digest, Matches: []simulatedMatch{}}
+	for _, qr := range explanation.Rules {
+		sim.Matches = append(sim.Matches, simulatedMatch{
+			Name:       qr.Name,
+			Priority:   qr.Priority,
+			Action:     qr.GetActionType(),
+			ActionArgs: qr.GetActionArgs(),
+			DryRun:     qr.Status == rules.DryRun,
+		})
+	}
+	return sim, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+)
+
+func UserGroup() *cobra.Command {
+	userGroupCmd := &cobra.Command{
+		Use:   "usergroup",
+		Short: "Manages the user groups the filters match",
+		Long: "Manages the user groups of mysql.wescale_user_group. A filter with user_groups matches the\n" +
+			"users of one of its groups, so that one filter covers many service accounts.",
+		Args: cobra.NoArgs,
+	}
+	userGroupCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the user groups",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			groups, err := client().ListUserGroups(requestContext(cmd), keyspace)
+			if err != nil {
+				return err
+			}
+			return userGroupTable(groups, adminapi.UserGroupList{UserGroups: groups}).print(cmd.OutOrStdout())
+		},
+	})
+	userGroupCmd.AddCommand(&cobra.Command{
+		Use:   "get <name>",
+		Short: "Shows a user group",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			group, err := client().GetUserGroup(requestContext(cmd), keyspace, args[0])
+			if err != nil {
+				return err
+			}
+			return userGroupTable([]adminapi.UserGroup{*group}, group).print(cmd.OutOrStdout())
+		},
+	})
+	userGroupCmd.AddCommand(&cobra.Command{
+		Use:   "set <name> <user>...",
+		Short: "Creates a user group, or replaces its users",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := adminapi.CheckUserGroupName(args[0]); err != nil {
+				return err
+			}
+			group, err := client().SetUserGroup(requestContext(cmd), keyspace, &adminapi.UserGroup{Name: args[0], Users: args[1:]})
+			if err != nil {
+				return err
+			}
+			return userGroupTable([]adminapi.UserGroup{*group}, group).print(cmd.OutOrStdout())
+		},
+	})
+	userGroupCmd.AddCommand(&cobra.Command{
+		Use:   "delete <name>",
+		Short: "Deletes a user group",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client().DeleteUserGroup(requestContext(cmd), keyspace, args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted user group %s\n", args[0])
+			return nil
+		},
+	})
+	return userGroupCmd
+}
+
+func userGroupTable(groups []adminapi.UserGroup, obj any) *table {
+	t := &table{header: []string{"NAME", "USERS"}, obj: obj}
+	for _, g := range groups {
+		t.add(g.Name, strings.Join(g.Users, ","))
+	}
+	return t
+}
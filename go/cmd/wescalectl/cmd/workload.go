@@ -0,0 +1,164 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/vtgate/workload"
+)
+
+func Workload() *cobra.Command {
+	workloadCmd := &cobra.Command{
+		Use:   "workload",
+		Short: "Captures the queries vtgate serves, and replays them against another cluster",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, _ []string) { cmd.Help() },
+	}
+	workloadCmd.AddCommand(WorkloadCapture())
+	workloadCmd.AddCommand(WorkloadReplay())
+	return workloadCmd
+}
+
+func WorkloadCapture() *cobra.Command {
+	var duration time.Duration
+	var file string
+	captureCmd := &cobra.Command{
+		Use:   "capture",
+		Short: "Captures the queries vtgate serves for a duration to a file",
+		Long: "Captures the queries the vtgate of --server serves for --duration, with their\n" +
+			"bind variables, their latency and their session, to --file. To capture the\n" +
+			"workload of a cluster, capture the queries of each of its vtgates at the same\n" +
+			"time. vtgate must run with --admin_api_workload_capture.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Create(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			// The request lasts the whole capture, so it isn't bound by --timeout.
+			c := client().WithHTTPClient(&http.Client{})
+			counter := &lineCounter{w: f}
+			if _, err := c.CaptureWorkload(requestContext(cmd), duration, counter); err != nil {
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Captured %d queries to %s.\n", counter.lines, file)
+			return nil
+		},
+	}
+	captureCmd.Flags().DurationVar(&duration, "duration", time.Minute, "How long to capture the queries")
+	captureCmd.Flags().StringVarP(&file, "file", "f", "workload.jsonl", "The file to write the queries to")
+	return captureCmd
+}
+
+// lineCounter counts the lines written to w.
+type lineCounter struct {
+	w     io.Writer
+	lines int
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.lines += bytes.Count(p, []byte{'\n'})
+	return c.w.Write(p)
+}
+
+func WorkloadReplay() *cobra.Command {
+	var target, targetUser, targetPassword string
+	replayer := &workload.Replayer{Speed: 1, MaxRows: 100000}
+	replayCmd := &cobra.Command{
+		Use:   "replay <file>...",
+		Short: "Replays captured queries against another cluster, and compares how they are served",
+		Long: "Replays the queries of the capture files against the vtgate of --target, through\n" +
+			"the MySQL protocol, and reports the queries which failed or affected or returned\n" +
+			"a different number of rows than when captured, and the latencies of both. The\n" +
+			"queries of each session are replayed in order on a connection of their own, at\n" +
+			"--speed times the pace they were captured at. The writes are replayed too,\n" +
+			"unless --read-only is set, so replay them against a copy of the data only.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if replayer.Speed < 0 {
+				return fmt.Errorf("invalid --speed %v, must not be negative", replayer.Speed)
+			}
+			host, portStr, err := net.SplitHostPort(target)
+			if err != nil {
+				return fmt.Errorf("invalid --target %q: %v", target, err)
+			}
+			port, err := strconv.Atoi(portStr)
+			if err != nil {
+				return fmt.Errorf("invalid --target %q: %v", target, err)
+			}
+			if targetPassword == "" {
+				targetPassword = os.Getenv("WESCALE_TARGET_PASSWORD")
+			}
+			queries, err := workload.ReadFiles(args)
+			if err != nil {
+				return err
+			}
+			replayer.Connect = func(ctx context.Context, database string) (workload.Conn, error) {
+				return mysql.Connect(ctx, &mysql.ConnParams{Host: host, Port: port, Uname: targetUser, Pass: targetPassword, DbName: database})
+			}
+			report := replayer.Replay(requestContext(cmd), queries)
+			return printReport(cmd.OutOrStdout(), report)
+		},
+	}
+	replayCmd.Flags().StringVar(&target, "target", "localhost:15306", "The host:port of the MySQL port of the vtgate to replay the queries against")
+	replayCmd.Flags().StringVar(&targetUser, "target-user", "root", "The user to replay the queries as")
+	replayCmd.Flags().StringVar(&targetPassword, "target-password", "", "The password of --target-user. If empty, it is read from the WESCALE_TARGET_PASSWORD environment variable")
+	replayCmd.Flags().Float64Var(&replayer.Speed, "speed", replayer.Speed, "How many times faster than captured to replay the queries. 0 replays the queries of each session one after the other")
+	replayCmd.Flags().BoolVar(&replayer.ReadOnly, "read-only", false, "Replay only the reads, and the statements which keep the state of the sessions")
+	replayCmd.Flags().IntVar(&replayer.MaxRows, "max-rows", replayer.MaxRows, "The maximum number of rows a query may return")
+	return replayCmd
+}
+
+// printReport prints the comparison of a replay.
+func printReport(w io.Writer, report *workload.Report) error {
+	t := &table{header: []string{"SESSION", "SQL", "CAPTURED", "REPLAYED"}, obj: report}
+	for _, m := range report.Mismatches {
+		t.add(m.Session, m.SQL, servedAs(m.CapturedError, m.CapturedRowsAffected, m.CapturedRowsReturned), servedAs(m.ReplayedError, m.ReplayedRowsAffected, m.ReplayedRowsReturned))
+	}
+	if output == outputTable {
+		fmt.Fprintf(w, "Replayed %d of %d queries of %d sessions in %v, skipped %d.\n", report.Replayed, report.Queries, report.Sessions, report.Duration.Round(time.Millisecond), report.Skipped)
+		fmt.Fprintf(w, "Error mismatches: %d\nRow mismatches: %d\n\n", report.ErrorMismatches, report.RowMismatches)
+		latencies := &table{header: []string{"LATENCY", "P50", "P90", "P99", "MAX"}}
+		for _, l := range []struct {
+			name    string
+			summary workload.LatencySummary
+		}{{"captured", report.CapturedLatency}, {"replayed", report.ReplayedLatency}} {
+			latencies.add(l.name, l.summary.P50, l.summary.P90, l.summary.P99, l.summary.Max)
+		}
+		if err := latencies.print(w); err != nil {
+			return err
+		}
+		if len(report.Mismatches) == 0 {
+			return nil
+		}
+		fmt.Fprintln(w)
+	}
+	return t.print(w)
+}
+
+// servedAs describes how a query was served in a report.
+func servedAs(err string, rowsAffected, rowsReturned uint64) string {
+	if err != "" {
+		return "error: " + err
+	}
+	return fmt.Sprintf("%d affected, %d returned", rowsAffected, rowsReturned)
+}
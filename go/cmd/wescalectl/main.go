@@ -0,0 +1,27 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// wescalectl administers a WeScale cluster through the admin API of vtgate:
+// its filters, its online DDL migrations, its WASM plugins, its routing, the
+// health and the load of its tablets and the capture of its workload. vtgate
+// must run with --enable_admin_api.
+package main
+
+import (
+	"os"
+
+	"vitess.io/vitess/go/cmd/wescalectl/cmd"
+	vtlog "vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/logutil"
+)
+
+func main() {
+	rootCmd := cmd.Main()
+	vtlog.RegisterFlags(rootCmd.PersistentFlags())
+	logutil.RegisterFlags(rootCmd.PersistentFlags())
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package cron parses the cron expressions, for the recurring DML jobs and the
+// schedules of the filters.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression with the standard five fields:
+// minute, hour, day of month, month and day of week.
+// Each field is a bitset of the values it matches.
+type Schedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// In cron, if both days are restricted, a day matches if either of them matches.
+	dayOfMonthStar, dayOfWeekStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	cronMinute     = cronField{name: "minute", min: 0, max: 59}
+	cronHour       = cronField{name: "hour", min: 0, max: 23}
+	cronDayOfMonth = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth      = cronField{name: "month", min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	// 7 is Sunday too
+	cronDayOfWeek = cronField{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// SearchYears is the number of years Next looks for the next time of a schedule
+// in, e.g. for Feb 29.
+const SearchYears = 5
+
+// Parse parses a cron expression. The fields can be separated by spaces or by '_',
+// since the comment directives of a DML job can't have spaces.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.ToLower(strings.TrimSpace(expr))
+	if descriptor, ok := cronDescriptors[spec]; ok {
+		spec = descriptor
+	}
+	fields := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '_'
+	})
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %s must have 5 fields: minute, hour, day of month, month and day of week", expr)
+	}
+	schedule := &Schedule{}
+	var err error
+	if schedule.minute, err = cronMinute.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = cronHour.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfMonth, err = cronDayOfMonth.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = cronMonth.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfWeek, err = cronDayOfWeek.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfWeek&(1<<7) != 0 {
+		schedule.dayOfWeek |= 1
+	}
+	schedule.dayOfMonthStar = fields[2] == "*" || fields[2] == "?"
+	schedule.dayOfWeekStar = fields[4] == "*" || fields[4] == "?"
+	return schedule, nil
+}
+
+// parse parses a field, which is a list of '*', values or ranges, each with an optional step.
+func (f cronField) parse(field string) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %s of %s field %s", stepPart, f.name, field)
+			}
+		}
+		begin, end := f.min, f.max
+		if rangePart != "*" && rangePart != "?" {
+			beginPart, endPart, isRange := strings.Cut(rangePart, "-")
+			if begin, err = f.value(beginPart); err != nil {
+				return 0, err
+			}
+			end = begin
+			if isRange {
+				if end, err = f.value(endPart); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// like 5/15, from 5 to the max
+				end = f.max
+			}
+			if begin > end {
+				return 0, fmt.Errorf("invalid range %s of %s field %s", rangePart, f.name, field)
+			}
+		}
+		for i := begin; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && s == name {
+			return i, nil
+		}
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < f.min || i > f.max {
+		return 0, fmt.Errorf("invalid %s %s, it must be between %d and %d", f.name, s, f.min, f.max)
+	}
+	return i, nil
+}
+
+// Next returns the first time after t which matches the schedule, in the location of t.
+// It returns the zero time if no time matches in the next years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	yearLimit := t.Year() + SearchYears
+	for t.Year() <= yearLimit {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Matches returns whether the minute of t, in the location of t, matches the
+// schedule.
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.month&(1<<uint(t.Month())) != 0 && s.dayMatches(t) &&
+		s.hour&(1<<uint(t.Hour())) != 0 && s.minute&(1<<uint(t.Minute())) != 0
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.dayOfMonthStar || s.dayOfWeekStar {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
@@ -0,0 +1,72 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	testCases := map[string]string{
+		"* * * *":       "cron expression * * * * must have 5 fields: minute, hour, day of month, month and day of week",
+		"60 * * * *":    "invalid minute 60, it must be between 0 and 59",
+		"* 24 * * *":    "invalid hour 24, it must be between 0 and 23",
+		"* * 0 * *":     "invalid day of month 0, it must be between 1 and 31",
+		"* * * foo *":   "invalid month foo, it must be between 1 and 12",
+		"* * * * 8":     "invalid day of week 8, it must be between 0 and 7",
+		"*/0 * * * *":   "invalid step 0 of minute field */0",
+		"30-10 * * * *": "invalid range 30-10 of minute field 30-10",
+	}
+	for expr, expected := range testCases {
+		_, err := Parse(expr)
+		assert.EqualError(t, err, expected, expr)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-10 is a Wednesday
+	now := time.Date(2024, 1, 10, 10, 30, 15, 0, time.UTC)
+	testCases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{expr: "* * * * *", expected: time.Date(2024, 1, 10, 10, 31, 0, 0, time.UTC)},
+		{expr: "0_3_*_*_*", expected: time.Date(2024, 1, 11, 3, 0, 0, 0, time.UTC)},
+		{expr: "*/20 * * * *", expected: time.Date(2024, 1, 10, 10, 40, 0, 0, time.UTC)},
+		{expr: "5/20 9-17 * * *", expected: time.Date(2024, 1, 10, 10, 45, 0, 0, time.UTC)},
+		{expr: "0 0 * * sat,sun", expected: time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", expected: time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 1 mar *", expected: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// either the day of month or the day of week matches
+		{expr: "0 0 15 * fri", expected: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", expected: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", expected: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "@hourly", expected: time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range testCases {
+		schedule, err := Parse(tc.expr)
+		require.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.expected, schedule.Next(now), tc.expr)
+	}
+
+	schedule, err := Parse("0 0 31 2 *")
+	require.NoError(t, err)
+	assert.True(t, schedule.Next(now).IsZero())
+}
+
+func TestCronMatches(t *testing.T) {
+	schedule, err := Parse("* 9-17 * * mon-fri")
+	require.NoError(t, err)
+	// 2024-01-10 is a Wednesday
+	assert.True(t, schedule.Matches(time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)))
+	assert.True(t, schedule.Matches(time.Date(2024, 1, 10, 17, 59, 59, 0, time.UTC)))
+	assert.False(t, schedule.Matches(time.Date(2024, 1, 10, 18, 0, 0, 0, time.UTC)))
+	assert.False(t, schedule.Matches(time.Date(2024, 1, 13, 10, 0, 0, 0, time.UTC)))
+}
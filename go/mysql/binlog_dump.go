@@ -74,18 +74,30 @@ func (c *Conn) parseComBinlogDumpGTID(data []byte) (logFile string, logPos uint6
 	if flags2&BinlogDumpNonBlock != 0 {
 		return logFile, logPos, position, io.EOF
 	}
-	if flags2&BinlogThroughGTID != 0 {
+	// MySQL replicas send the GTID set without BinlogThroughGTID, so it is
+	// read whenever it is there.
+	if flags2&BinlogThroughGTID != 0 || len(data) > pos {
 		dataSize, pos, ok := readUint32(data, pos)
-		if !ok {
+		if !ok || len(data) < pos+int(dataSize) {
 			return logFile, logPos, position, readPacketErr
 		}
-		if gtid := string(data[pos : pos+int(dataSize)]); gtid != "" {
-			position, err = DecodePosition(gtid)
-			if err != nil {
-				return logFile, logPos, position, err
-			}
+		position, err = decodeBinlogDumpGTIDSet(data[pos : pos+int(dataSize)])
+		if err != nil {
+			return logFile, logPos, position, err
 		}
 	}
 
 	return logFile, logPos, position, nil
 }
+
+// decodeBinlogDumpGTIDSet decodes the GTID set of a COM_BINLOG_DUMP_GTID. It is
+// the SID block MySQL sends, or the encoded position older Vitess clients send.
+func decodeBinlogDumpGTIDSet(data []byte) (Position, error) {
+	if len(data) == 0 {
+		return Position{}, nil
+	}
+	if set, err := NewMysql56GTIDSetFromSIDBlock(data); err == nil {
+		return Position{GTIDSet: set}, nil
+	}
+	return DecodePosition(string(data))
+}
@@ -90,6 +90,9 @@ type Conn struct {
 	// fields, this is set to an empty array (but not nil).
 	fields []*querypb.Field
 
+	// recordRowBuffers is set by RecordRowBuffers.
+	recordRowBuffers bool
+
 	// salt is sent by the server during initial handshake to be used for authentication
 	salt []byte
 
@@ -109,6 +112,10 @@ type Conn struct {
 	// avoid maps indexed by ConnectionID for instance.
 	ClientData any
 
+	// Attributes are the connection attributes sent by the client during
+	// the handshake, such as program_name. Only set on the server side.
+	Attributes map[string]string
+
 	// conn is the underlying network connection.
 	// Calling Close() on the Conn will close this connection.
 	// If there are any ongoing reads or writes, they may get interrupted.
@@ -246,6 +253,12 @@ func newConn(conn net.Conn) *Conn {
 	}
 }
 
+// NewTestConn returns a connection over a network connection, for the tests
+// of the handlers only.
+func NewTestConn(conn net.Conn) *Conn {
+	return newConn(conn)
+}
+
 // newServerConn should be used to create server connections.
 //
 // It stashes a reference to the listener to be able to determine if
@@ -718,6 +731,35 @@ func (c *Conn) Close() {
 	}
 }
 
+// CloseWithError sends an error packet to an idle connection and closes it,
+// the way MySQL tells a client it disconnected it. It can be called from a
+// different go routine: the packet is written straight to the socket, with
+// the sequence number of the result of the next command of the client, so it
+// reads the error as this result.
+func (c *Conn) CloseWithError(err *SQLError, writeTimeout time.Duration) error {
+	length := 1 + 2 + 1 + 5 + len(err.Message)
+	data := make([]byte, packetHeaderSize+length)
+	data[0] = byte(length)
+	data[1] = byte(length >> 8)
+	data[2] = byte(length >> 16)
+	data[3] = 1
+	pos := writeByte(data, packetHeaderSize, ErrPacket)
+	pos = writeUint16(data, pos, uint16(err.Num))
+	pos = writeByte(data, pos, '#')
+	pos = writeEOFString(data, pos, err.SQLState())
+	_ = writeEOFString(data, pos, err.Message)
+
+	var werr error
+	if !c.IsClosed() {
+		if writeTimeout > 0 {
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		}
+		_, werr = c.conn.Write(data)
+	}
+	c.Close()
+	return werr
+}
+
 // IsClosed returns true if this connection was ever closed by the
 // Close() method.  Note if the other side closes the connection, but
 // Close() wasn't called, this will return false.
@@ -995,6 +1037,7 @@ func (c *Conn) handleComBinlogDump(handler Handler, data []byte) (kontinue bool)
 	}
 	if err := handler.ComBinlogDump(c, logfile, binlogPos); err != nil {
 		log.Error(err.Error())
+		c.writeErrorPacketFromError(err)
 		return false
 	}
 	return kontinue
@@ -1019,6 +1062,7 @@ func (c *Conn) handleComBinlogDumpGTID(handler Handler, data []byte) (kontinue b
 	}
 	if err := handler.ComBinlogDumpGTID(c, logFile, logPos, position.GTIDSet); err != nil {
 		log.Error(err.Error())
+		c.writeErrorPacketFromError(err)
 		return false
 	}
 	return kontinue
@@ -1143,7 +1187,7 @@ func (c *Conn) handleComStmtExecute(handler Handler, data []byte) (kontinue bool
 					affectedRows:     qr.RowsAffected,
 					lastInsertID:     qr.InsertID,
 					statusFlags:      c.StatusFlags,
-					warnings:         0,
+					warnings:         handler.WarningCount(c),
 					info:             qr.Info,
 					sessionStateData: qr.SessionStateChanges,
 				}
@@ -1345,21 +1389,65 @@ func (c *Conn) handleComQuery(handler Handler, data []byte) (kontinue bool) {
 		return c.writeErrorPacketFromErrorAndLog(errEmptyStatement)
 	}
 
-	for index, sql := range queries {
+	pipeliner, _ := handler.(PipelineHandler)
+	for index := 0; index < len(queries); {
+		if pipeliner != nil && index != len(queries)-1 {
+			executed, res := c.execPipeline(queries[index:], handler, pipeliner)
+			if res != execSuccess {
+				return res != connErr
+			}
+			if executed > 0 {
+				index += executed
+				continue
+			}
+		}
 		more := false
 		if index != len(queries)-1 {
 			more = true
 		}
-		res := c.execQuery(sql, handler, more)
+		res := c.execQuery(queries[index], handler, more)
 		if res != execSuccess {
 			return res != connErr
 		}
+		index++
 	}
 
 	timings.Record(queryTimingKey, queryStart)
 	return true
 }
 
+// execPipeline executes a prefix of the remaining statements of a
+// multi-statement query with ComQueryPipeline, and returns how many of
+// them were executed.
+func (c *Conn) execPipeline(queries []string, handler Handler, pipeliner PipelineHandler) (int, execResult) {
+	results, err := pipeliner.ComQueryPipeline(c, queries)
+	for i, qr := range results {
+		flag := c.StatusFlags
+		if i != len(queries)-1 {
+			flag |= ServerMoreResultsExists
+		}
+		ok := PacketOK{
+			affectedRows:     qr.RowsAffected,
+			lastInsertID:     qr.InsertID,
+			statusFlags:      flag,
+			warnings:         handler.WarningCount(c),
+			info:             qr.Info,
+			sessionStateData: qr.SessionStateChanges,
+		}
+		if err := c.writeOKPacket(&ok); err != nil {
+			log.Errorf("Error writing result to %s: %v", c, err)
+			return 0, connErr
+		}
+	}
+	if err != nil {
+		if !c.writeErrorPacketFromErrorAndLog(err) {
+			return 0, connErr
+		}
+		return 0, execErr
+	}
+	return len(results), execSuccess
+}
+
 func (c *Conn) execQuery(query string, handler Handler, more bool) execResult {
 	callbackCalled := false
 	// sendFinished is set if the response should just be an OK packet.
@@ -805,6 +805,31 @@ func TestIsEOFPacket(t *testing.T) {
 	}
 }
 
+func TestCloseWithError(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		cConn.Close()
+	}()
+
+	// The client reads the error as the result of its next command.
+	require.NoError(t, sConn.CloseWithError(NewSQLError(ERClientInteractionTimeout, SSUnknownSQLState, "idle"), time.Second))
+	assert.True(t, sConn.IsClosed())
+	cConn.sequence = 1
+	data, err := cConn.ReadPacket()
+	require.NoError(t, err)
+	err = ParseErrorPacket(data)
+	sqlErr, ok := err.(*SQLError)
+	require.True(t, ok, "%v", err)
+	assert.Equal(t, ERClientInteractionTimeout, sqlErr.Number())
+	assert.Equal(t, "idle", sqlErr.Message)
+
+	// The connection is closed after the packet.
+	_, err = cConn.ReadPacket()
+	assert.Error(t, err)
+	assert.NoError(t, sConn.CloseWithError(NewSQLError(ERClientInteractionTimeout, SSUnknownSQLState, "idle"), time.Second))
+}
+
 func TestMultiStatementStopsOnError(t *testing.T) {
 	listener, sConn, cConn := createSocketPair(t)
 	sConn.Capabilities |= CapabilityClientMultiStatements
@@ -879,6 +904,73 @@ func TestMultiStatement(t *testing.T) {
 	require.Nil(t, data)
 }
 
+// pipelineTestRun pipelines the consecutive queries that start with "insert".
+type pipelineTestRun struct {
+	testRun
+	pipelined []string
+}
+
+func (t *pipelineTestRun) ComQueryPipeline(_ *Conn, queries []string) ([]*sqltypes.Result, error) {
+	var results []*sqltypes.Result
+	for _, query := range queries {
+		if !strings.HasPrefix(query, "insert") {
+			break
+		}
+		t.pipelined = append(t.pipelined, query)
+		if strings.Contains(query, "error") {
+			return results, t.err
+		}
+		results = append(results, &sqltypes.Result{RowsAffected: uint64(len(results) + 1)})
+	}
+	return results, nil
+}
+
+func TestMultiStatementPipeline(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	sConn.Capabilities |= CapabilityClientMultiStatements
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+
+	err := cConn.WriteComQuery("insert 1;insert 2;select 1;insert 3")
+	require.NoError(t, err)
+
+	handler := &pipelineTestRun{testRun: testRun{t: t, err: NewSQLError(ERDupEntry, SSConstraintViolation, "duplicate entry")}}
+	require.True(t, sConn.handleNextCommand(handler))
+	// the last statement is alone, it is executed with ComQuery.
+	require.Equal(t, []string{"insert 1", "insert 2"}, handler.pipelined)
+
+	for _, rowsAffected := range []uint64{1, 2} {
+		data, more, _, err := cConn.ReadQueryResult(100, true)
+		require.NoError(t, err)
+		require.True(t, more)
+		require.EqualValues(t, rowsAffected, data.RowsAffected)
+	}
+	for _, wantMore := range []bool{true, false} {
+		data, more, _, err := cConn.ReadQueryResult(100, true)
+		require.NoError(t, err)
+		require.Equal(t, wantMore, more)
+		require.True(t, data.Equal(selectRowsResult))
+	}
+
+	// a pipelined statement that fails stops the execution.
+	handler.pipelined = nil
+	err = cConn.WriteComQuery("insert 1;insert error;insert 3")
+	require.NoError(t, err)
+	require.True(t, sConn.handleNextCommand(handler))
+	require.Equal(t, []string{"insert 1", "insert error"}, handler.pipelined)
+
+	data, more, _, err := cConn.ReadQueryResult(100, true)
+	require.NoError(t, err)
+	require.True(t, more)
+	require.EqualValues(t, 1, data.RowsAffected)
+	_, more, _, err = cConn.ReadQueryResult(100, true)
+	require.EqualError(t, err, "duplicate entry (errno 1062) (sqlstate 23000)")
+	require.False(t, more)
+}
+
 func TestMultiStatementOnSplitError(t *testing.T) {
 	listener, sConn, cConn := createSocketPair(t)
 	// Set the splitStatementFunction to return an error.
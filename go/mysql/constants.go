@@ -569,8 +569,14 @@ const (
 	// server not available
 	ERServerIsntAvailable = 3168
 
+	// the server disconnected an idle client
+	ERClientInteractionTimeout = 4031
+
 	ERConsensusLeaderChanged         = 7500
 	ERConsensusFollowerNotAllowWrite = 7504
+
+	// a WASM plugin failed
+	ERWasmPluginFailed = 7600
 )
 
 // Sql states for errors.
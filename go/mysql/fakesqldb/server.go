@@ -30,6 +30,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -74,6 +75,11 @@ type DB struct {
 	// orderMatters is set when the query order matters.
 	orderMatters bool
 
+	// warningCount is the warning count returned after each query. It isn't
+	// protected by mu, which is held while the results are written.
+	// Use SetWarningCount() to change.
+	warningCount atomic.Uint32
+
 	// Fields set at runtime.
 
 	// mu protects all the following fields.
@@ -355,7 +361,12 @@ func (db *DB) ComQuery(c *mysql.Conn, query string, callback func(*sqltypes.Resu
 
 // WarningCount is part of the mysql.Handler interface.
 func (db *DB) WarningCount(c *mysql.Conn) uint16 {
-	return 0
+	return uint16(db.warningCount.Load())
+}
+
+// SetWarningCount sets the warning count returned after each query.
+func (db *DB) SetWarningCount(count uint16) {
+	db.warningCount.Store(uint32(count))
 }
 
 // HandleQuery is the default implementation of the QueryHandler interface
@@ -0,0 +1,87 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysql
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	proxyproto "github.com/pires/go-proxyproto"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// NewProxyProtocolListener wraps a listener so that its connections may
+// start with a PROXY protocol header, version 1 or 2. The RemoteAddr of
+// such a connection is the address of the client the header carries,
+// which the auth servers, the query rules and the logs then see instead of
+// the address of the load balancer.
+//
+// If trustedCIDRs is empty, any peer may send a header. Otherwise only
+// the peers in these networks may, and the connections of the other peers
+// which send one are closed: they would otherwise choose the address they
+// are seen with. A trusted CIDR may also be a single IP address.
+//
+// headerTimeout bounds the time spent waiting for the header before the
+// handshake, zero uses the default of the proxyproto package.
+func NewProxyProtocolListener(l net.Listener, trustedCIDRs []string, headerTimeout time.Duration) (net.Listener, error) {
+	policy, err := proxyProtocolPolicy(trustedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyproto.Listener{
+		Listener:          l,
+		Policy:            policy,
+		ReadHeaderTimeout: headerTimeout,
+	}, nil
+}
+
+func proxyProtocolPolicy(trustedCIDRs []string) (proxyproto.PolicyFunc, error) {
+	var trusted []*net.IPNet
+	for _, cidr := range trustedCIDRs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid PROXY protocol trusted address %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid PROXY protocol trusted network %q: %v", cidr, err)
+		}
+		trusted = append(trusted, network)
+	}
+	if len(trusted) == 0 {
+		return nil, nil
+	}
+	// The policy never fails: an error would stop the accept loop of the
+	// Listener, not only refuse the connection.
+	return func(upstream net.Addr) (proxyproto.Policy, error) {
+		tcpAddr, ok := upstream.(*net.TCPAddr)
+		if !ok {
+			return proxyproto.REJECT, nil
+		}
+		for _, network := range trusted {
+			if network.Contains(tcpAddr.IP) {
+				return proxyproto.USE, nil
+			}
+		}
+		return proxyproto.REJECT, nil
+	}, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysql
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	proxyproto "github.com/pires/go-proxyproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// proxyProtocolConn dials l, sends header if not nil followed by a byte, and
+// returns the server side of the connection, once that byte was read.
+func proxyProtocolConn(t *testing.T, l net.Listener, header []byte) (net.Conn, error) {
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	_, err = client.Write(append(header, 'x'))
+	require.NoError(t, err)
+
+	server, err := l.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	buf := make([]byte, 1)
+	if _, err := server.Read(buf); err != nil {
+		return server, err
+	}
+	assert.Equal(t, "x", string(buf))
+	return server, nil
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer listener.Close()
+	l, err := NewProxyProtocolListener(listener, []string{"127.0.0.1", "10.0.0.0/8"}, time.Second)
+	require.NoError(t, err)
+
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.1.2"), Port: 4321}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 3306}
+	for _, version := range []byte{1, 2} {
+		header, err := proxyproto.HeaderProxyFromAddrs(version, src, dst).Format()
+		require.NoError(t, err)
+		conn, err := proxyProtocolConn(t, l, header)
+		require.NoError(t, err)
+		assert.Equal(t, src.String(), conn.RemoteAddr().String(), "version %d", version)
+	}
+
+	// Connections without a header keep their address.
+	conn, err := proxyProtocolConn(t, l, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+}
+
+func TestProxyProtocolListenerUntrusted(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer listener.Close()
+	l, err := NewProxyProtocolListener(listener, []string{"10.0.0.0/8"}, time.Second)
+	require.NoError(t, err)
+
+	header, err := proxyproto.HeaderProxyFromAddrs(2, &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1}, &net.TCPAddr{IP: net.ParseIP("10.1.1.2"), Port: 2}).Format()
+	require.NoError(t, err)
+	_, err = proxyProtocolConn(t, l, header)
+	assert.ErrorIs(t, err, proxyproto.ErrSuperfluousProxyHeader)
+
+	conn, err := proxyProtocolConn(t, l, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+}
+
+func TestProxyProtocolListenerInvalidCIDR(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/33", "not-an-ip"} {
+		_, err := NewProxyProtocolListener(nil, []string{cidr}, 0)
+		assert.Error(t, err, cidr)
+	}
+}
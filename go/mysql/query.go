@@ -256,29 +256,45 @@ func (c *Conn) readColumnDefinitionType(field *querypb.Field, index int) error {
 	return nil
 }
 
-// parseRow parses an individual row.
+// parseRow parses a row packet. The values of the columns are copied back to
+// back at the start of dst, which must be at least len(data) long and can be
+// data itself when the caller owns the packet: the values are then compacted
+// in place, since a value is never moved past the bytes it was read from.
+// Each value is capped to its own bytes, so appending to one of them never
+// overwrites the next one. The part of dst holding the values is returned
+// with the row, see sqltypes.Result.AppendRow, which lets
+// sqltypes.ResultToProto3 reuse the values as the row payload instead of
+// copying every column again.
 // Returns a SQLError.
-func (c *Conn) parseRow(data []byte, fields []*querypb.Field, reader func([]byte, int) ([]byte, int, bool), result []sqltypes.Value) ([]sqltypes.Value, error) {
+func (c *Conn) parseRow(data, dst []byte, fields []*querypb.Field, result []sqltypes.Value) ([]sqltypes.Value, []byte, error) {
 	colNumber := len(fields)
 	if result == nil {
 		result = make([]sqltypes.Value, 0, colNumber)
 	}
-	pos := 0
+	pos, w := 0, 0
 	for i := 0; i < colNumber; i++ {
 		if data[pos] == NullValue {
 			result = append(result, sqltypes.Value{})
 			pos++
 			continue
 		}
-		var s []byte
-		var ok bool
-		s, pos, ok = reader(data, pos)
+		s, next, ok := readLenEncStringAsBytes(data, pos)
 		if !ok {
-			return nil, NewSQLError(CRMalformedPacket, SSUnknownSQLState, "decoding string failed")
+			return nil, nil, NewSQLError(CRMalformedPacket, SSUnknownSQLState, "decoding string failed")
 		}
-		result = append(result, sqltypes.MakeTrusted(fields[i].Type, s))
+		n := copy(dst[w:], s)
+		result = append(result, sqltypes.MakeTrusted(fields[i].Type, dst[w:w+n:w+n]))
+		pos = next
+		w += n
 	}
-	return result, nil
+	return result, dst[:w], nil
+}
+
+// RecordRowBuffers sets whether the results read from now on record the
+// buffers of their rows, see sqltypes.Result.AppendRow. It only pays off for
+// the results that are converted to proto3, see sqltypes.WithRowBuffers.
+func (c *Conn) RecordRowBuffers(record bool) {
+	c.recordRowBuffers = record
 }
 
 // ExecuteFetch executes a query and returns the result.
@@ -471,12 +487,17 @@ func (c *Conn) ReadQueryResult(maxrows int, wantfields bool) (*sqltypes.Result,
 		}
 
 		// Regular row.
-		row, err := c.parseRow(data, result.Fields, readLenEncStringAsBytesCopy, nil)
+		// data is recycled right after, so copy the values out of it.
+		row, buf, err := c.parseRow(data, make([]byte, len(data)), result.Fields, nil)
 		if err != nil {
 			c.recycleReadPacket()
 			return nil, false, 0, err
 		}
-		result.Rows = append(result.Rows, row)
+		if c.recordRowBuffers {
+			result.AppendRow(row, buf)
+		} else {
+			result.Rows = append(result.Rows, row)
+		}
 		c.recycleReadPacket()
 	}
 }
@@ -789,3 +789,45 @@ func RowString(row []sqltypes.Value) string {
 	}
 	return result
 }
+
+func TestParseRowContiguous(t *testing.T) {
+	c := &Conn{}
+	fields := []*querypb.Field{
+		{Type: querypb.Type_INT64},
+		{Type: querypb.Type_VARCHAR},
+		{Type: querypb.Type_VARCHAR},
+		{Type: querypb.Type_VARCHAR},
+	}
+	data := []byte{1, '1', NullValue, 0, 3, 'a', 'b', 'c'}
+	want := []sqltypes.Value{
+		sqltypes.NewInt64(1),
+		sqltypes.NULL,
+		sqltypes.NewVarChar(""),
+		sqltypes.NewVarChar("abc"),
+	}
+
+	// copied out of the packet.
+	packet := append([]byte(nil), data...)
+	row, buf, err := c.parseRow(packet, make([]byte, len(packet)), fields, nil)
+	require.NoError(t, err)
+	assert.Equal(t, want, row)
+	assert.Equal(t, "1abc", string(buf))
+	assert.True(t, proto.Equal(&querypb.Row{Lengths: []int64{1, -1, 0, 3}, Values: []byte("1abc")}, sqltypes.RowToProto3(row)))
+
+	// compacted in the packet.
+	row, buf, err = c.parseRow(data, data, fields, nil)
+	require.NoError(t, err)
+	assert.Equal(t, want, row)
+	assert.Equal(t, "1abc", string(data[:4]))
+	assert.Same(t, &data[0], &buf[0])
+	qr := &sqltypes.Result{Fields: fields}
+	qr.AppendRow(row, buf)
+	assert.Same(t, &data[0], &sqltypes.ResultToProto3(qr).Rows[0].Values[0])
+
+	// appending to a value doesn't overwrite the next one.
+	appended := append(row[0].Raw(), 'x')
+	assert.Equal(t, "1x", string(appended))
+	assert.Equal(t, "abc", row[3].ToString())
+	assert.Equal(t, "1abc", string(data[:4]))
+	assert.True(t, proto.Equal(&querypb.Row{Lengths: []int64{1, -1, 0, 3}, Values: []byte("1abc")}, sqltypes.ResultToProto3(qr).Rows[0]))
+}
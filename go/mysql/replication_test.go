@@ -160,6 +160,54 @@ func TestComBinlogDumpGTID(t *testing.T) {
 	})
 }
 
+func TestParseComBinlogDumpGTID(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+
+	gtidSet, err := ParseMysql56GTIDSet("16b1039f-22b6-11ed-b765-0a43f95f28a3:1-243")
+	require.NoError(t, err)
+	tests := []struct {
+		name  string
+		flags uint16
+		data  []byte
+		want  GTIDSet
+	}{{
+		// MySQL replicas send the SID block without BinlogThroughGTID.
+		name: "SID block",
+		data: gtidSet.SIDBlock(),
+		want: gtidSet,
+	}, {
+		name:  "encoded position",
+		flags: BinlogThroughGTID,
+		data:  []byte(EncodePosition(Position{GTIDSet: gtidSet})),
+		want:  gtidSet,
+	}, {
+		name:  "empty",
+		flags: BinlogThroughGTID,
+	}}
+	for _, tcase := range tests {
+		t.Run(tcase.name, func(t *testing.T) {
+			sConn.sequence = 0
+			require.NoError(t, cConn.WriteComBinlogDumpGTID(1, "binlog.000001", 4, tcase.flags, tcase.data))
+			data, err := sConn.ReadPacket()
+			require.NoError(t, err)
+			logFile, logPos, position, err := sConn.parseComBinlogDumpGTID(data)
+			require.NoError(t, err)
+			assert.Equal(t, "binlog.000001", logFile)
+			assert.EqualValues(t, 4, logPos)
+			if tcase.want == nil {
+				assert.True(t, position.IsZero())
+				return
+			}
+			assert.True(t, tcase.want.Equal(position.GTIDSet), position.GTIDSet)
+		})
+	}
+}
+
 func TestSendSemiSyncAck(t *testing.T) {
 	listener, sConn, cConn := createSocketPair(t)
 	defer func() {
@@ -112,6 +112,22 @@ from mysql.schemacopy
 where table_schema = database()
 order by table_name, ordinal_position`
 
+	// fetchIndexColumns are the index columns we fetch
+	fetchIndexColumns = "table_name, index_name, non_unique, seq_in_index, column_name"
+
+	// FetchUpdatedIndexes queries fetches the columns of the indexes of updated tables
+	FetchUpdatedIndexes = `select ` + fetchIndexColumns + `
+from information_schema.statistics
+where table_schema = database() and
+	table_name in ::tableNames
+order by table_name, index_name, seq_in_index`
+
+	// FetchIndexes queries fetches the columns of all indexes
+	FetchIndexes = `select ` + fetchIndexColumns + `
+from information_schema.statistics
+where table_schema = database()
+order by table_name, index_name, seq_in_index`
+
 	// GetColumnNamesQueryPatternForTable is used for mocking queries in unit tests
 	GetColumnNamesQueryPatternForTable = `SELECT COLUMN_NAME.*TABLE_NAME.*%s.*`
 
@@ -30,8 +30,6 @@ import (
 
 	"vitess.io/vitess/go/sqlescape"
 
-	proxyproto "github.com/pires/go-proxyproto"
-
 	"vitess.io/vitess/go/netutil"
 	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/stats"
@@ -135,6 +133,19 @@ type Handler interface {
 	ComResetConnection(c *Conn)
 }
 
+// A PipelineHandler is a Handler that can execute several statements of a
+// multi-statement query at once.
+type PipelineHandler interface {
+	// ComQueryPipeline is called with the statements of a multi-statement
+	// query that are left to execute. It executes the longest prefix of
+	// queries that it can pipeline, and returns the results of the
+	// statements that succeeded, and the error of the one that failed, if
+	// any. Pipelined statements must not return rows. If the first
+	// statement cannot be pipelined, it returns no result and no error,
+	// and the statement is executed with ComQuery.
+	ComQueryPipeline(c *Conn, queries []string) ([]*sqltypes.Result, error)
+}
+
 // UnimplementedHandler implemnts all of the optional callbacks so as to satisy
 // the Handler interface. Intended to be embedded into your custom Handler
 // implementation without needing to define every callback and to help be forwards
@@ -247,7 +258,10 @@ func NewListener(
 		return nil, err
 	}
 	if proxyProtocol {
-		proxyListener := &proxyproto.Listener{Listener: listener}
+		proxyListener, err := NewProxyProtocolListener(listener, nil, 0)
+		if err != nil {
+			return nil, err
+		}
 		return NewFromListener(proxyListener, authServer, handler, connReadTimeout, connWriteTimeout, connBufferPooling)
 	}
 
@@ -785,9 +799,11 @@ func (l *Listener) parseClientHandshakePacket(c *Conn, firstTime bool, data []by
 
 	// Decode connection attributes send by the client
 	if clientFlags&CapabilityClientConnAttr != 0 {
-		if _, _, err := parseConnAttrs(data, pos); err != nil {
+		attrs, _, err := parseConnAttrs(data, pos)
+		if err != nil {
 			log.Warningf("Decode connection attributes send by the client: %v", err)
 		}
+		c.Attributes = attrs
 	}
 
 	return username, AuthMethodDescription(authMethod), authResponse, nil
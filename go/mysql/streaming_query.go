@@ -113,32 +113,45 @@ func (c *Conn) Fields() ([]*querypb.Field, error) {
 // FetchNext returns the next result for an ongoing streaming query.
 // It returns (nil, nil) if there is nothing more to read.
 func (c *Conn) FetchNext(in []sqltypes.Value) ([]sqltypes.Value, error) {
+	row, _, err := c.FetchNextRow(in)
+	return row, err
+}
+
+// FetchNextRow is like FetchNext, but it also returns the buffer the values
+// of the row were copied to, to be recorded with sqltypes.Result.AppendRow.
+// The buffer is nil unless the connection records them, see RecordRowBuffers.
+func (c *Conn) FetchNextRow(in []sqltypes.Value) ([]sqltypes.Value, []byte, error) {
 	if c.fields == nil {
 		// We are already done, and the result was closed.
-		return nil, NewSQLError(CRCommandsOutOfSync, SSUnknownSQLState, "no streaming query in progress")
+		return nil, nil, NewSQLError(CRCommandsOutOfSync, SSUnknownSQLState, "no streaming query in progress")
 	}
 
 	if len(c.fields) == 0 {
 		// We received no fields, so there is no data.
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	data, err := c.ReadPacket()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if c.isEOFPacket(data) {
 		// Warnings and status flags are ignored.
 		c.fields = nil
-		return nil, nil
+		return nil, nil, nil
 	} else if isErrorPacket(data) {
 		// Error packet.
-		return nil, ParseErrorPacket(data)
+		return nil, nil, ParseErrorPacket(data)
 	}
 
 	// Regular row.
-	return c.parseRow(data, c.fields, readLenEncStringAsBytes, in)
+	// ReadPacket returns a packet that we own, the values can stay in it.
+	row, buf, err := c.parseRow(data, data, c.fields, in)
+	if !c.recordRowBuffers {
+		buf = nil
+	}
+	return row, buf, err
 }
 
 // CloseResult can be used to terminate a streaming query
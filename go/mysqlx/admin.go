@@ -0,0 +1,126 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlx
+
+import (
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqlescape"
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// adminArgs are the arguments of an admin command, given either as an
+// object or, by the older clients, positionally.
+type adminArgs map[string]string
+
+// parseAdminArgs returns the arguments of an admin command, keys naming
+// the positional ones.
+func parseAdminArgs(args []any, keys ...string) (adminArgs, error) {
+	a := make(adminArgs, len(keys))
+	if len(args) == 1 {
+		if obj, ok := args[0].(map[string]any); ok {
+			for key, v := range obj {
+				if s, ok := v.(string); ok {
+					a[key] = s
+				}
+			}
+			return a, nil
+		}
+	}
+	for i, arg := range args {
+		if i >= len(keys) {
+			return nil, mysql.NewSQLError(erXBadMessage, mysql.SSUnknownSQLState, "Too many arguments")
+		}
+		switch arg := arg.(type) {
+		case string:
+			a[keys[i]] = arg
+		case octets:
+			a[keys[i]] = string(arg.value)
+		default:
+			return nil, mysql.NewSQLError(erXBadMessage, mysql.SSUnknownSQLState, "Invalid type of argument %d, expected a string", i+1)
+		}
+	}
+	return a, nil
+}
+
+// schema returns the schema of an admin command, the current one by
+// default.
+func (a adminArgs) schema(c *Conn) string {
+	if schema := a["schema"]; schema != "" {
+		return schema
+	}
+	return c.SchemaName
+}
+
+// collectionName returns the name of the collection of an admin command.
+func (a adminArgs) collectionName(c *Conn) (string, error) {
+	if a["name"] == "" {
+		return "", mysql.NewSQLError(erXBadMessage, mysql.SSUnknownSQLState, "Invalid collection name")
+	}
+	schema := a.schema(c)
+	if schema == "" {
+		return "", mysql.NewSQLError(mysql.ERNoDb, mysql.SSNoDB, "No database selected")
+	}
+	return sqlescape.EscapeID(schema) + "." + sqlescape.EscapeID(a["name"]), nil
+}
+
+// collectionDefinition is the table of a collection: its documents, and
+// their _id as the primary key.
+const collectionDefinition = " (doc JSON, _id VARBINARY(32) GENERATED ALWAYS AS (JSON_UNQUOTE(JSON_EXTRACT(doc, '$._id'))) STORED PRIMARY KEY) CHARSET utf8mb4"
+
+// adminCommand runs an admin command of the mysqlx namespace.
+func (l *Listener) adminCommand(c *Conn, cmd string, args []any) (*sqltypes.Result, error) {
+	switch cmd {
+	case "ping":
+		return &sqltypes.Result{}, nil
+	case "enable_notices", "disable_notices", "list_notices":
+		// The notices are always sent.
+		return &sqltypes.Result{}, nil
+	case "create_collection", "ensure_collection", "drop_collection":
+		a, err := parseAdminArgs(args, "schema", "name")
+		if err != nil {
+			return nil, err
+		}
+		name, err := a.collectionName(c)
+		if err != nil {
+			return nil, err
+		}
+		var query string
+		switch cmd {
+		case "create_collection":
+			query = "CREATE TABLE " + name + collectionDefinition
+		case "ensure_collection":
+			query = "CREATE TABLE IF NOT EXISTS " + name + collectionDefinition
+		default:
+			query = "DROP TABLE " + name
+		}
+		if _, err := l.handler.Execute(c, query, nil); err != nil {
+			return nil, err
+		}
+		return &sqltypes.Result{}, nil
+	case "list_objects":
+		a, err := parseAdminArgs(args, "schema", "pattern")
+		if err != nil {
+			return nil, err
+		}
+		pattern := a["pattern"]
+		if pattern == "" {
+			pattern = "%"
+		}
+		// A collection is a table with only the doc and _id columns.
+		query := "SELECT t.table_name AS name, IF(t.table_type = 'VIEW', 'VIEW', " +
+			"IF((SELECT COUNT(*) FROM information_schema.columns c WHERE c.table_schema = t.table_schema AND c.table_name = t.table_name) = 2 " +
+			"AND (SELECT COUNT(*) FROM information_schema.columns c WHERE c.table_schema = t.table_schema AND c.table_name = t.table_name AND c.column_name IN ('doc', '_id')) = 2, " +
+			"'COLLECTION', 'TABLE')) AS type FROM information_schema.tables t " +
+			"WHERE t.table_schema = :schema AND t.table_name LIKE :pattern ORDER BY t.table_name"
+		return l.handler.Execute(c, query, map[string]*querypb.BindVariable{
+			"schema":  sqltypes.StringBindVariable(a.schema(c)),
+			"pattern": sqltypes.StringBindVariable(pattern),
+		})
+	}
+	return nil, mysql.NewSQLError(erXInvalidAdminCommand, mysql.SSUnknownSQLState, "Invalid mysqlx command %s", cmd)
+}
@@ -0,0 +1,206 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package mysqlx is an experimental server side implementation of the
+// MySQL X Protocol, the protocol of the MySQL Shell and of the connectors'
+// DevAPI. It supports SQL statements, the CRUD messages of the document
+// store, which it turns into SQL statements, and the admin commands
+// managing collections. All of them are then handed over to a Handler.
+package mysqlx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// maxMessageSize is the largest message accepted from a client, the
+// default of mysqlx_max_allowed_packet.
+const maxMessageSize = 64 * 1024 * 1024
+
+// Client message types.
+const (
+	msgConCapabilitiesGet    = 1
+	msgConCapabilitiesSet    = 2
+	msgConClose              = 3
+	msgSessAuthenticateStart = 4
+	msgSessAuthenticateCont  = 5
+	msgSessReset             = 6
+	msgSessClose             = 7
+	msgSQLStmtExecute        = 12
+	msgCrudFind              = 17
+	msgCrudInsert            = 18
+	msgCrudUpdate            = 19
+	msgCrudDelete            = 20
+	msgExpectOpen            = 24
+	msgExpectClose           = 25
+)
+
+// Server message types.
+const (
+	msgOk               = 0
+	msgError            = 1
+	msgConnCapabilities = 2
+	msgSessAuthCont     = 3
+	msgSessAuthOk       = 4
+	msgNotice           = 11
+	msgColumnMetaData   = 12
+	msgRow              = 13
+	msgFetchDone        = 14
+	msgSQLStmtExecuteOk = 17
+)
+
+// Mysqlx.Error severities.
+const (
+	severityError = 0
+	severityFatal = 1
+)
+
+// Notice types and SessionStateChanged parameters.
+const (
+	noticeSessionStateChanged = 3
+	noticeScopeLocal          = 2
+	stateGeneratedInsertID    = 3
+	stateRowsAffected         = 4
+	stateProducedMessage      = 10
+	stateGeneratedDocumentIDs = 12
+)
+
+// X Plugin error codes, and the MySQL ones the mysql package doesn't
+// have.
+const (
+	erNotSupportedAuthMode = 1251
+	erXBadMessage          = 5000
+	erXCapabilitiesPrepare = 5001
+	erXCapabilityNotFound  = 5002
+	erXInvalidAdminCommand = 5157
+)
+
+// Conn is a client connection of a Listener.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+
+	// ConnectionID identifies the connection in the logs.
+	ConnectionID uint32
+
+	// User and SchemaName are set by the authentication.
+	User       string
+	SchemaName string
+	// UserData is what the AuthServer returned for the user.
+	UserData mysql.Getter
+
+	// ConnectAttrs are the session_connect_attrs capability of the client.
+	ConnectAttrs map[string]string
+
+	// ClientData is for the Handler to keep the state of the connection.
+	ClientData any
+
+	rbuf []byte
+	wbuf []byte
+}
+
+func newConn(conn net.Conn, connectionID uint32) *Conn {
+	return &Conn{
+		conn:         conn,
+		r:            bufio.NewReader(conn),
+		w:            bufio.NewWriter(conn),
+		ConnectionID: connectionID,
+	}
+}
+
+// RemoteAddr returns the address of the client.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes the connection.
+func (c *Conn) Close() {
+	c.conn.Close()
+}
+
+// readMessage reads a message. The payload is only valid until the next
+// read.
+func (c *Conn) readMessage() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[:4])
+	if length < 1 || length > maxMessageSize {
+		return 0, nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid message length %d", length)
+	}
+	n := int(length - 1)
+	if cap(c.rbuf) < n {
+		c.rbuf = make([]byte, n)
+	}
+	payload := c.rbuf[:n]
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[4], payload, nil
+}
+
+// writeMessage buffers a message until the next flush.
+func (c *Conn) writeMessage(typ byte, payload []byte) error {
+	c.wbuf = binary.LittleEndian.AppendUint32(c.wbuf[:0], uint32(len(payload)+1))
+	c.wbuf = append(c.wbuf, typ)
+	if _, err := c.w.Write(c.wbuf); err != nil {
+		return err
+	}
+	_, err := c.w.Write(payload)
+	return err
+}
+
+func (c *Conn) flush() error {
+	return c.w.Flush()
+}
+
+func (c *Conn) writeOk() error {
+	return c.writeMessage(msgOk, nil)
+}
+
+func (c *Conn) writeError(severity uint64, code int, sqlState, message string) error {
+	var b []byte
+	if severity != severityError {
+		b = appendUintField(b, 1, severity)
+	}
+	b = appendUintField(b, 2, uint64(code))
+	b = appendStringField(b, 3, message)
+	b = appendStringField(b, 4, sqlState)
+	return c.writeMessage(msgError, b)
+}
+
+// writeErrorFrom sends an error, with the MySQL error code and SQLSTATE
+// of the error if it has them.
+func (c *Conn) writeErrorFrom(err error) error {
+	if sqlErr, ok := mysql.NewSQLErrorFromError(err).(*mysql.SQLError); ok {
+		return c.writeError(severityError, sqlErr.Number(), sqlErr.SQLState(), sqlErr.Message)
+	}
+	return c.writeError(severityError, mysql.ERUnknownError, mysql.SSUnknownSQLState, err.Error())
+}
+
+// writeStateChanged sends a SessionStateChanged notice.
+func (c *Conn) writeStateChanged(param uint64, values ...any) error {
+	state := appendUintField(nil, 1, param)
+	for _, v := range values {
+		state = appendBytesField(state, 2, appendScalar(nil, v))
+	}
+	return c.writeNotice(noticeSessionStateChanged, state)
+}
+
+func (c *Conn) writeNotice(typ uint64, payload []byte) error {
+	b := appendUintField(nil, 1, typ)
+	b = appendUintField(b, 2, noticeScopeLocal)
+	b = appendBytesField(b, 3, payload)
+	return c.writeMessage(msgNotice, b)
+}
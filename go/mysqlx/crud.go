@@ -0,0 +1,1192 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqlescape"
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// Mysqlx.Crud.DataModel values.
+const (
+	dataModelDocument = 1
+	dataModelTable    = 2
+)
+
+// Mysqlx.Expr.Expr types.
+const (
+	exprIdent       = 1
+	exprLiteral     = 2
+	exprVariable    = 3
+	exprFuncCall    = 4
+	exprOperator    = 5
+	exprPlaceholder = 6
+	exprObject      = 7
+	exprArray       = 8
+)
+
+// Mysqlx.Expr.DocumentPathItem types.
+const (
+	pathMember             = 1
+	pathMemberAsterisk     = 2
+	pathArrayIndex         = 3
+	pathArrayIndexAsterisk = 4
+	pathDoubleAsterisk     = 5
+)
+
+// Mysqlx.Crud.UpdateOperation types.
+const (
+	updateSet         = 1
+	updateItemRemove  = 2
+	updateItemSet     = 3
+	updateItemReplace = 4
+	updateItemMerge   = 5
+	updateArrayInsert = 6
+	updateArrayAppend = 7
+	updateMergePatch  = 8
+)
+
+// placeholder returns the name of the bind variable of the i-th value.
+func placeholder(i int) string {
+	return fmt.Sprintf("v%d", i+1)
+}
+
+// bindVariable returns the bind variable of a decoded scalar.
+func bindVariable(v any) (*querypb.BindVariable, error) {
+	switch v := v.(type) {
+	case nil:
+		return sqltypes.NullBindVariable, nil
+	case int64:
+		return sqltypes.Int64BindVariable(v), nil
+	case uint64:
+		return sqltypes.Uint64BindVariable(v), nil
+	case float64:
+		return sqltypes.Float64BindVariable(v), nil
+	case bool:
+		return sqltypes.BoolBindVariable(v), nil
+	case string:
+		return sqltypes.StringBindVariable(v), nil
+	case octets:
+		return sqltypes.BytesBindVariable(v.value), nil
+	}
+	return nil, badValue("unsupported argument of type %T", v)
+}
+
+func badValue(format string, args ...any) error {
+	return mysql.NewSQLError(erXBadMessage, mysql.SSUnknownSQLState, format, args...)
+}
+
+// crudBuilder builds the SQL statement of a CRUD message. The values of
+// the message become bind variables: the placeholders first, then the
+// literals.
+type crudBuilder struct {
+	dataModel uint64
+	args      []any
+	bindVars  map[string]*querypb.BindVariable
+	sql       strings.Builder
+}
+
+func newCrudBuilder(m pbMessage, dataModelField, argsField protowire.Number) (*crudBuilder, error) {
+	cb := &crudBuilder{
+		dataModel: m.uint(dataModelField),
+		bindVars:  make(map[string]*querypb.BindVariable),
+	}
+	if cb.dataModel == 0 {
+		cb.dataModel = dataModelDocument
+	}
+	scalars, err := m.messages(argsField)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range scalars {
+		arg, err := decodeScalar(s)
+		if err != nil {
+			return nil, err
+		}
+		cb.args = append(cb.args, arg)
+	}
+	for i, arg := range cb.args {
+		bv, err := bindVariable(arg)
+		if err != nil {
+			return nil, err
+		}
+		cb.bindVars[placeholder(i)] = bv
+	}
+	return cb, nil
+}
+
+func (cb *crudBuilder) write(s ...string) {
+	for _, s := range s {
+		cb.sql.WriteString(s)
+	}
+}
+
+// value writes a bind variable of a value.
+func (cb *crudBuilder) value(v any) error {
+	bv, err := bindVariable(v)
+	if err != nil {
+		return err
+	}
+	name := placeholder(len(cb.bindVars))
+	cb.bindVars[name] = bv
+	cb.write(":", name)
+	return nil
+}
+
+func (cb *crudBuilder) collection(m pbMessage) error {
+	if m == nil || m.string(1) == "" {
+		return badValue("Invalid name of table/collection")
+	}
+	if schema := m.string(2); schema != "" {
+		cb.write(sqlescape.EscapeID(schema), ".")
+	}
+	cb.write(sqlescape.EscapeID(m.string(1)))
+	return nil
+}
+
+// expr writes an expression.
+func (cb *crudBuilder) expr(m pbMessage) error {
+	switch m.uint(1) {
+	case exprIdent:
+		id, err := m.message(2)
+		if err != nil {
+			return err
+		}
+		return cb.identifier(id)
+	case exprLiteral:
+		s, err := m.message(4)
+		if err != nil {
+			return err
+		}
+		v, err := decodeScalar(s)
+		if err != nil {
+			return err
+		}
+		return cb.literal(v)
+	case exprPlaceholder:
+		pos := int(m.uint(7))
+		if pos >= len(cb.args) {
+			return badValue("Invalid value of placeholder")
+		}
+		if o, ok := cb.args[pos].(octets); ok && o.contentType == contentTypeJSON {
+			cb.write("CAST(:", placeholder(pos), " AS JSON)")
+			return nil
+		}
+		cb.write(":", placeholder(pos))
+		return nil
+	case exprFuncCall:
+		fc, err := m.message(5)
+		if err != nil {
+			return err
+		}
+		return cb.functionCall(fc)
+	case exprOperator:
+		op, err := m.message(6)
+		if err != nil {
+			return err
+		}
+		return cb.operator(op)
+	case exprObject:
+		obj, err := m.message(8)
+		if err != nil {
+			return err
+		}
+		return cb.object(obj, nil)
+	case exprArray:
+		arr, err := m.message(9)
+		if err != nil {
+			return err
+		}
+		values, err := arr.messages(1)
+		if err != nil {
+			return err
+		}
+		cb.write("JSON_ARRAY(")
+		if err := cb.exprList(values); err != nil {
+			return err
+		}
+		cb.write(")")
+		return nil
+	case exprVariable:
+		return mysql.NewSQLError(mysql.ERNotSupportedYet, mysql.SSUnknownSQLState, "Mysqlx.Expr variables are not supported")
+	}
+	return badValue("Invalid value for Mysqlx::Expr::Expr_Type %d", m.uint(1))
+}
+
+func (cb *crudBuilder) exprList(exprs []pbMessage) error {
+	for i, e := range exprs {
+		if i > 0 {
+			cb.write(", ")
+		}
+		if err := cb.expr(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cb *crudBuilder) literal(v any) error {
+	switch v := v.(type) {
+	case nil:
+		cb.write("NULL")
+		return nil
+	case bool:
+		if v {
+			cb.write("TRUE")
+		} else {
+			cb.write("FALSE")
+		}
+		return nil
+	case octets:
+		if v.contentType == contentTypeJSON {
+			cb.write("CAST(")
+			if err := cb.value(v); err != nil {
+				return err
+			}
+			cb.write(" AS JSON)")
+			return nil
+		}
+	}
+	return cb.value(v)
+}
+
+// identifier writes a column, or a member of the document, when it has a
+// document path.
+func (cb *crudBuilder) identifier(m pbMessage) error {
+	column := "doc"
+	if name := m.string(2); name != "" {
+		column = sqlescape.EscapeID(name)
+		if table := m.string(3); table != "" {
+			column = sqlescape.EscapeID(table) + "." + column
+			if schema := m.string(4); schema != "" {
+				column = sqlescape.EscapeID(schema) + "." + column
+			}
+		}
+	} else if cb.dataModel == dataModelTable {
+		return badValue("Column name is required if data model is TABLE")
+	}
+	items, err := m.messages(1)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		cb.write(column)
+		return nil
+	}
+	path, err := documentPath(items)
+	if err != nil {
+		return err
+	}
+	cb.write("JSON_EXTRACT(", column, ", ", sqltypes.EncodeStringSQL(path), ")")
+	return nil
+}
+
+// documentPath returns the JSON path of a document path.
+func documentPath(items []pbMessage) (string, error) {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, item := range items {
+		switch item.uint(1) {
+		case pathMember:
+			b.WriteString(".")
+			member := item.string(2)
+			if isPathIdentifier(member) {
+				b.WriteString(member)
+			} else {
+				b.WriteString(strconv.Quote(member))
+			}
+		case pathMemberAsterisk:
+			b.WriteString(".*")
+		case pathArrayIndex:
+			b.WriteString("[" + strconv.FormatUint(item.uint(3), 10) + "]")
+		case pathArrayIndexAsterisk:
+			b.WriteString("[*]")
+		case pathDoubleAsterisk:
+			b.WriteString("**")
+		default:
+			return "", badValue("Invalid document path item type %d", item.uint(1))
+		}
+	}
+	return b.String(), nil
+}
+
+func isPathIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, ch := range s {
+		if !(ch == '_' || ch == '$' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || i > 0 && ch >= '0' && ch <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isFunctionIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if !(ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func (cb *crudBuilder) functionCall(m pbMessage) error {
+	id, err := m.message(1)
+	if err != nil {
+		return err
+	}
+	name := id.string(1)
+	if !isFunctionIdentifier(name) {
+		return badValue("Invalid function name %q", name)
+	}
+	if schema := id.string(2); schema != "" {
+		cb.write(sqlescape.EscapeID(schema), ".")
+	}
+	params, err := m.messages(2)
+	if err != nil {
+		return err
+	}
+	cb.write(name, "(")
+	if err := cb.exprList(params); err != nil {
+		return err
+	}
+	cb.write(")")
+	return nil
+}
+
+// binaryOperators are the operators with two parameters written between
+// them.
+var binaryOperators = map[string]string{
+	"==": "=", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+	"&&": "AND", "||": "OR", "xor": "XOR",
+	"+": "+", "-": "-", "*": "*", "/": "/", "div": "DIV", "%": "%",
+	"&": "&", "|": "|", "^": "^", "<<": "<<", ">>": ">>",
+	"is": "IS", "is_not": "IS NOT",
+	"like": "LIKE", "not_like": "NOT LIKE",
+	"regexp": "REGEXP", "not_regexp": "NOT REGEXP",
+}
+
+// unaryOperators are the operators with a parameter written after them.
+var unaryOperators = map[string]string{
+	"!": "NOT ", "not": "NOT ", "sign_minus": "-", "sign_plus": "+", "~": "~",
+}
+
+func (cb *crudBuilder) operator(m pbMessage) error {
+	name := strings.ToLower(m.string(1))
+	params, err := m.messages(2)
+	if err != nil {
+		return err
+	}
+	if sqlOp, ok := binaryOperators[name]; ok && len(params) == 2 {
+		cb.write("(")
+		if err := cb.expr(params[0]); err != nil {
+			return err
+		}
+		cb.write(" ", sqlOp, " ")
+		if err := cb.expr(params[1]); err != nil {
+			return err
+		}
+		cb.write(")")
+		return nil
+	}
+	if sqlOp, ok := unaryOperators[name]; ok && len(params) == 1 {
+		cb.write("(", sqlOp)
+		if err := cb.expr(params[0]); err != nil {
+			return err
+		}
+		cb.write(")")
+		return nil
+	}
+	switch {
+	case name == "*" && len(params) == 0:
+		cb.write("*")
+		return nil
+	case (name == "in" || name == "not_in") && len(params) >= 2:
+		cb.write("(")
+		if err := cb.expr(params[0]); err != nil {
+			return err
+		}
+		if name == "not_in" {
+			cb.write(" NOT")
+		}
+		cb.write(" IN (")
+		if err := cb.exprList(params[1:]); err != nil {
+			return err
+		}
+		cb.write("))")
+		return nil
+	case (name == "between" || name == "not_between") && len(params) == 3:
+		cb.write("(")
+		if err := cb.expr(params[0]); err != nil {
+			return err
+		}
+		if name == "not_between" {
+			cb.write(" NOT")
+		}
+		cb.write(" BETWEEN ")
+		if err := cb.expr(params[1]); err != nil {
+			return err
+		}
+		cb.write(" AND ")
+		if err := cb.expr(params[2]); err != nil {
+			return err
+		}
+		cb.write(")")
+		return nil
+	case (name == "cont_in" || name == "not_cont_in") && len(params) == 2:
+		// a IN b, b being an array or an object of the document.
+		if name == "not_cont_in" {
+			cb.write("NOT ")
+		}
+		cb.write("JSON_CONTAINS(")
+		if err := cb.jsonExpr(params[1]); err != nil {
+			return err
+		}
+		cb.write(", ")
+		if err := cb.jsonExpr(params[0]); err != nil {
+			return err
+		}
+		cb.write(")")
+		return nil
+	case (name == "overlaps" || name == "not_overlaps") && len(params) == 2:
+		if name == "not_overlaps" {
+			cb.write("NOT ")
+		}
+		cb.write("JSON_OVERLAPS(")
+		if err := cb.jsonExpr(params[0]); err != nil {
+			return err
+		}
+		cb.write(", ")
+		if err := cb.jsonExpr(params[1]); err != nil {
+			return err
+		}
+		cb.write(")")
+		return nil
+	case name == "cast" && len(params) == 2:
+		typ, err := castType(params[1])
+		if err != nil {
+			return err
+		}
+		cb.write("CAST(")
+		if err := cb.expr(params[0]); err != nil {
+			return err
+		}
+		cb.write(" AS ", typ, ")")
+		return nil
+	case (name == "date_add" || name == "date_sub") && len(params) == 3:
+		unit, err := castType(params[2])
+		if err != nil {
+			return err
+		}
+		cb.write(strings.ToUpper(name), "(")
+		if err := cb.expr(params[0]); err != nil {
+			return err
+		}
+		cb.write(", INTERVAL ")
+		if err := cb.expr(params[1]); err != nil {
+			return err
+		}
+		cb.write(" ", unit, ")")
+		return nil
+	}
+	return badValue("Invalid operator %s", name)
+}
+
+// jsonExpr writes an expression as a JSON value: strings are quoted, the
+// members of the document and the JSON literals are already.
+func (cb *crudBuilder) jsonExpr(m pbMessage) error {
+	switch m.uint(1) {
+	case exprIdent, exprObject, exprArray:
+		return cb.expr(m)
+	case exprLiteral:
+		s, err := m.message(4)
+		if err != nil {
+			return err
+		}
+		v, err := decodeScalar(s)
+		if err != nil {
+			return err
+		}
+		switch v := v.(type) {
+		case string:
+			cb.write("JSON_QUOTE(")
+			if err := cb.value(v); err != nil {
+				return err
+			}
+			cb.write(")")
+			return nil
+		case octets:
+			if v.contentType == contentTypeJSON {
+				return cb.literal(v)
+			}
+		}
+	}
+	cb.write("CAST(")
+	if err := cb.expr(m); err != nil {
+		return err
+	}
+	cb.write(" AS JSON)")
+	return nil
+}
+
+// castType returns the type of a cast, or the unit of an interval, which
+// are literals written as is, once checked.
+func castType(m pbMessage) (string, error) {
+	if m.uint(1) != exprLiteral {
+		return "", badValue("Invalid cast type")
+	}
+	s, err := m.message(4)
+	if err != nil {
+		return "", err
+	}
+	v, err := decodeScalar(s)
+	if err != nil {
+		return "", err
+	}
+	var typ string
+	switch v := v.(type) {
+	case string:
+		typ = v
+	case octets:
+		typ = string(v.value)
+	default:
+		return "", badValue("Invalid cast type")
+	}
+	for _, ch := range typ {
+		if !(ch == '_' || ch == ' ' || ch == '(' || ch == ')' || ch == ',' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9') {
+			return "", badValue("Invalid cast type %q", typ)
+		}
+	}
+	return strings.ToUpper(typ), nil
+}
+
+// object writes a JSON object. extra are fields to add, like a generated
+// _id.
+func (cb *crudBuilder) object(m pbMessage, extra []objectField) error {
+	fields, err := m.messages(1)
+	if err != nil {
+		return err
+	}
+	cb.write("JSON_OBJECT(")
+	for i, field := range fields {
+		if i > 0 {
+			cb.write(", ")
+		}
+		cb.write(sqltypes.EncodeStringSQL(field.string(1)), ", ")
+		value, err := field.message(2)
+		if err != nil {
+			return err
+		}
+		if err := cb.expr(value); err != nil {
+			return err
+		}
+	}
+	for i, field := range extra {
+		if i+len(fields) > 0 {
+			cb.write(", ")
+		}
+		cb.write(sqltypes.EncodeStringSQL(field.key), ", ")
+		if err := cb.value(field.value); err != nil {
+			return err
+		}
+	}
+	cb.write(")")
+	return nil
+}
+
+func (cb *crudBuilder) where(m pbMessage, field protowire.Number) error {
+	criteria, err := m.message(field)
+	if err != nil || criteria == nil {
+		return err
+	}
+	cb.write(" WHERE ")
+	return cb.expr(criteria)
+}
+
+func (cb *crudBuilder) orderBy(m pbMessage, field protowire.Number) error {
+	orders, err := m.messages(field)
+	if err != nil || len(orders) == 0 {
+		return err
+	}
+	cb.write(" ORDER BY ")
+	for i, order := range orders {
+		if i > 0 {
+			cb.write(", ")
+		}
+		e, err := order.message(1)
+		if err != nil {
+			return err
+		}
+		if err := cb.expr(e); err != nil {
+			return err
+		}
+		if order.uint(2) == 2 {
+			cb.write(" DESC")
+		}
+	}
+	return nil
+}
+
+// limit writes the limit of a Limit or a LimitExpr field. Updates and
+// deletes have no offset.
+func (cb *crudBuilder) limit(m pbMessage, limitField, limitExprField protowire.Number, offsetAllowed bool) error {
+	limit, err := m.message(limitField)
+	if err != nil {
+		return err
+	}
+	if limit != nil {
+		if limit.uint(2) != 0 && !offsetAllowed {
+			return badValue("Invalid parameter: non-zero offset value not allowed for this operation")
+		}
+		cb.write(" LIMIT ")
+		if limit.uint(2) != 0 {
+			cb.write(strconv.FormatUint(limit.uint(2), 10), ", ")
+		}
+		cb.write(strconv.FormatUint(limit.uint(1), 10))
+		return nil
+	}
+	limitExpr, err := m.message(limitExprField)
+	if err != nil || limitExpr == nil {
+		return err
+	}
+	rowCount, err := limitExpr.message(1)
+	if err != nil {
+		return err
+	}
+	offset, err := limitExpr.message(2)
+	if err != nil {
+		return err
+	}
+	if offset != nil && !offsetAllowed {
+		return badValue("Invalid parameter: non-zero offset value not allowed for this operation")
+	}
+	cb.write(" LIMIT ")
+	if offset != nil {
+		if err := cb.expr(offset); err != nil {
+			return err
+		}
+		cb.write(", ")
+	}
+	return cb.expr(rowCount)
+}
+
+// translateCrud returns the SQL statement of a CRUD message, and the IDs
+// of the documents it generated for an insert.
+func translateCrud(typ byte, m pbMessage) (string, map[string]*querypb.BindVariable, []string, error) {
+	var cb *crudBuilder
+	var ids []string
+	var err error
+	switch typ {
+	case msgCrudFind:
+		if cb, err = newCrudBuilder(m, 3, 11); err == nil {
+			err = cb.find(m)
+		}
+	case msgCrudInsert:
+		if cb, err = newCrudBuilder(m, 2, 5); err == nil {
+			ids, err = cb.insert(m)
+		}
+	case msgCrudUpdate:
+		if cb, err = newCrudBuilder(m, 3, 8); err == nil {
+			err = cb.update(m)
+		}
+	case msgCrudDelete:
+		if cb, err = newCrudBuilder(m, 2, 6); err == nil {
+			err = cb.delete(m)
+		}
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return cb.sql.String(), cb.bindVars, ids, nil
+}
+
+func (cb *crudBuilder) find(m pbMessage) error {
+	projections, err := m.messages(4)
+	if err != nil {
+		return err
+	}
+	cb.write("SELECT ")
+	switch {
+	case len(projections) == 0 && cb.dataModel == dataModelDocument:
+		cb.write("doc")
+	case len(projections) == 0:
+		cb.write("*")
+	case cb.dataModel == dataModelDocument:
+		cb.write("JSON_OBJECT(")
+		for i, p := range projections {
+			if i > 0 {
+				cb.write(", ")
+			}
+			alias := p.string(2)
+			if alias == "" {
+				return badValue("Invalid projection target name")
+			}
+			cb.write(sqltypes.EncodeStringSQL(alias), ", ")
+			source, err := p.message(1)
+			if err != nil {
+				return err
+			}
+			if err := cb.expr(source); err != nil {
+				return err
+			}
+		}
+		cb.write(") AS doc")
+	default:
+		for i, p := range projections {
+			if i > 0 {
+				cb.write(", ")
+			}
+			source, err := p.message(1)
+			if err != nil {
+				return err
+			}
+			if err := cb.expr(source); err != nil {
+				return err
+			}
+			if alias := p.string(2); alias != "" {
+				cb.write(" AS ", sqlescape.EscapeID(alias))
+			}
+		}
+	}
+	cb.write(" FROM ")
+	collection, err := m.message(2)
+	if err != nil {
+		return err
+	}
+	if err := cb.collection(collection); err != nil {
+		return err
+	}
+	if err := cb.where(m, 5); err != nil {
+		return err
+	}
+	grouping, err := m.messages(8)
+	if err != nil {
+		return err
+	}
+	if len(grouping) > 0 {
+		cb.write(" GROUP BY ")
+		if err := cb.exprList(grouping); err != nil {
+			return err
+		}
+		having, err := m.message(9)
+		if err != nil {
+			return err
+		}
+		if having != nil {
+			cb.write(" HAVING ")
+			if err := cb.expr(having); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cb.orderBy(m, 7); err != nil {
+		return err
+	}
+	if err := cb.limit(m, 6, 14, true); err != nil {
+		return err
+	}
+	switch m.uint(12) {
+	case 1:
+		cb.write(" LOCK IN SHARE MODE")
+	case 2:
+		cb.write(" FOR UPDATE")
+	}
+	return nil
+}
+
+func (cb *crudBuilder) insert(m pbMessage) ([]string, error) {
+	collection, err := m.message(1)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := m.messages(4)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, badValue("Missing row data for Insert")
+	}
+	cb.write("INSERT INTO ")
+	if err := cb.collection(collection); err != nil {
+		return nil, err
+	}
+	if cb.dataModel == dataModelDocument {
+		return cb.insertDocuments(rows, m.bool(6))
+	}
+	if m.bool(6) {
+		return nil, badValue("Invalid parameter: upsert is only valid for collections")
+	}
+	columns, err := m.messages(3)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) > 0 {
+		cb.write(" (")
+		for i, column := range columns {
+			if i > 0 {
+				cb.write(", ")
+			}
+			cb.write(sqlescape.EscapeID(column.string(1)))
+		}
+		cb.write(")")
+	}
+	cb.write(" VALUES ")
+	for i, row := range rows {
+		if i > 0 {
+			cb.write(", ")
+		}
+		fields, err := row.messages(1)
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) > 0 && len(fields) != len(columns) {
+			return nil, badValue("Wrong number of fields in row being inserted")
+		}
+		cb.write("(")
+		if err := cb.exprList(fields); err != nil {
+			return nil, err
+		}
+		cb.write(")")
+	}
+	return nil, nil
+}
+
+// insertDocuments writes the documents of an insert, generating the _id
+// of the ones which don't have one.
+func (cb *crudBuilder) insertDocuments(rows []pbMessage, upsert bool) ([]string, error) {
+	var ids []string
+	cb.write(" (doc) VALUES ")
+	for i, row := range rows {
+		if i > 0 {
+			cb.write(", ")
+		}
+		fields, err := row.messages(1)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != 1 {
+			return nil, badValue("Wrong number of fields in row being inserted")
+		}
+		doc := fields[0]
+		hasID, known, err := cb.documentHasID(doc)
+		if err != nil {
+			return nil, err
+		}
+		cb.write("(")
+		switch {
+		case known && hasID:
+			err = cb.expr(doc)
+		case doc.uint(1) == exprObject:
+			id := newDocumentID()
+			ids = append(ids, id)
+			var obj pbMessage
+			if obj, err = doc.message(8); err == nil {
+				err = cb.object(obj, []objectField{{"_id", id}})
+			}
+		default:
+			// The _id is only set if the document doesn't have one.
+			id := newDocumentID()
+			if known {
+				ids = append(ids, id)
+			}
+			cb.write("JSON_INSERT(")
+			if err = cb.jsonExpr(doc); err == nil {
+				cb.write(", '$._id', ")
+				err = cb.value(id)
+				cb.write(")")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		cb.write(")")
+	}
+	if upsert {
+		cb.write(" ON DUPLICATE KEY UPDATE doc = VALUES(doc)")
+	}
+	return ids, nil
+}
+
+// documentHasID tells whether a document to insert has an _id, if it is
+// known before executing the insert.
+func (cb *crudBuilder) documentHasID(doc pbMessage) (hasID bool, known bool, err error) {
+	var v any
+	switch doc.uint(1) {
+	case exprObject:
+		obj, err := doc.message(8)
+		if err != nil {
+			return false, false, err
+		}
+		fields, err := obj.messages(1)
+		if err != nil {
+			return false, false, err
+		}
+		for _, field := range fields {
+			if field.string(1) == "_id" {
+				return true, true, nil
+			}
+		}
+		return false, true, nil
+	case exprLiteral:
+		s, err := doc.message(4)
+		if err != nil {
+			return false, false, err
+		}
+		if v, err = decodeScalar(s); err != nil {
+			return false, false, err
+		}
+	case exprPlaceholder:
+		pos := int(doc.uint(7))
+		if pos >= len(cb.args) {
+			return false, false, badValue("Invalid value of placeholder")
+		}
+		v = cb.args[pos]
+	default:
+		return false, false, nil
+	}
+	var raw []byte
+	switch v := v.(type) {
+	case string:
+		raw = []byte(v)
+	case octets:
+		raw = v.value
+	default:
+		return false, false, badValue("Invalid document")
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return false, false, badValue("Invalid document: %v", err)
+	}
+	_, hasID = fields["_id"]
+	return hasID, true, nil
+}
+
+var (
+	documentIDPrefix  = newDocumentIDPrefix()
+	documentIDStart   = uint64(time.Now().Unix())
+	documentIDCounter atomic.Uint64
+)
+
+func newDocumentIDPrefix() string {
+	var prefix [2]byte
+	_, _ = rand.Read(prefix[:])
+	return hex.EncodeToString(prefix[:])
+}
+
+// newDocumentID returns a new document ID, made like the ones of MySQL:
+// a prefix of the server, its start time, and a sequence number, in
+// hexadecimal.
+func newDocumentID() string {
+	return fmt.Sprintf("%s%08x%016x", documentIDPrefix, documentIDStart&0xffffffff, documentIDCounter.Add(1))
+}
+
+func (cb *crudBuilder) update(m pbMessage) error {
+	collection, err := m.message(2)
+	if err != nil {
+		return err
+	}
+	operations, err := m.messages(7)
+	if err != nil {
+		return err
+	}
+	if len(operations) == 0 {
+		return badValue("Invalid update expression list")
+	}
+	cb.write("UPDATE ")
+	if err := cb.collection(collection); err != nil {
+		return err
+	}
+	cb.write(" SET ")
+	if cb.dataModel == dataModelDocument {
+		if err := cb.documentUpdate(operations); err != nil {
+			return err
+		}
+	} else if err := cb.tableUpdate(operations); err != nil {
+		return err
+	}
+	if err := cb.where(m, 4); err != nil {
+		return err
+	}
+	if err := cb.orderBy(m, 6); err != nil {
+		return err
+	}
+	return cb.limit(m, 5, 9, false)
+}
+
+// documentUpdate writes doc = f(...f(doc, ...)), with a JSON function f
+// per operation.
+func (cb *crudBuilder) documentUpdate(operations []pbMessage) error {
+	cb.write("doc = ")
+	for i := len(operations) - 1; i >= 0; i-- {
+		if err := cb.updateFunction(operations[i].uint(2)); err != nil {
+			return err
+		}
+	}
+	cb.write("doc")
+	for _, op := range operations {
+		source, err := op.message(1)
+		if err != nil {
+			return err
+		}
+		if source.string(2) != "" {
+			return badValue("Invalid column name to update")
+		}
+		items, err := source.messages(1)
+		if err != nil {
+			return err
+		}
+		if len(items) > 0 && items[0].uint(1) == pathMember && items[0].string(2) == "_id" {
+			return badValue("Forbidden update operation on '$._id' member")
+		}
+		if err := cb.updateArguments(op, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateFunction writes the start of the JSON function of an update
+// operation.
+func (cb *crudBuilder) updateFunction(operation uint64) error {
+	switch operation {
+	case updateItemRemove:
+		cb.write("JSON_REMOVE(")
+	case updateItemSet:
+		cb.write("JSON_SET(")
+	case updateItemReplace:
+		cb.write("JSON_REPLACE(")
+	case updateItemMerge:
+		cb.write("JSON_MERGE_PRESERVE(")
+	case updateArrayInsert:
+		cb.write("JSON_ARRAY_INSERT(")
+	case updateArrayAppend:
+		cb.write("JSON_ARRAY_APPEND(")
+	case updateMergePatch:
+		cb.write("JSON_MERGE_PATCH(")
+	default:
+		return badValue("Invalid type of update operation for document")
+	}
+	return nil
+}
+
+// updateArguments writes the arguments of the JSON function of an update
+// operation, after the document it updates.
+func (cb *crudBuilder) updateArguments(op pbMessage, items []pbMessage) error {
+	operation := op.uint(2)
+	if operation != updateItemMerge && operation != updateMergePatch {
+		if len(items) == 0 {
+			return badValue("Invalid document member location")
+		}
+		path, err := documentPath(items)
+		if err != nil {
+			return err
+		}
+		cb.write(", ", sqltypes.EncodeStringSQL(path))
+	}
+	if operation != updateItemRemove {
+		value, err := op.message(3)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return badValue("Invalid update value")
+		}
+		cb.write(", ")
+		if operation == updateItemMerge || operation == updateMergePatch {
+			err = cb.jsonExpr(value)
+		} else {
+			err = cb.expr(value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	cb.write(")")
+	return nil
+}
+
+// tableUpdate writes the assignments of the columns of a table.
+func (cb *crudBuilder) tableUpdate(operations []pbMessage) error {
+	for i, op := range operations {
+		if i > 0 {
+			cb.write(", ")
+		}
+		source, err := op.message(1)
+		if err != nil {
+			return err
+		}
+		name := source.string(2)
+		if name == "" {
+			return badValue("Invalid column name to update")
+		}
+		column := sqlescape.EscapeID(name)
+		items, err := source.messages(1)
+		if err != nil {
+			return err
+		}
+		cb.write(column, " = ")
+		if op.uint(2) == updateSet {
+			if len(items) > 0 {
+				return badValue("Invalid column name to update")
+			}
+			value, err := op.message(3)
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				return badValue("Invalid update value")
+			}
+			if err := cb.expr(value); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := cb.updateFunction(op.uint(2)); err != nil {
+			return err
+		}
+		cb.write(column)
+		if err := cb.updateArguments(op, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cb *crudBuilder) delete(m pbMessage) error {
+	collection, err := m.message(1)
+	if err != nil {
+		return err
+	}
+	cb.write("DELETE FROM ")
+	if err := cb.collection(collection); err != nil {
+		return err
+	}
+	if err := cb.where(m, 3); err != nil {
+		return err
+	}
+	if err := cb.orderBy(m, 5); err != nil {
+		return err
+	}
+	return cb.limit(m, 4, 7, false)
+}
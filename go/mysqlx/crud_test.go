@@ -0,0 +1,269 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// The helpers below encode the messages of the clients.
+
+// path is the ColumnIdentifier of a member of the document.
+func path(names ...string) []byte {
+	var id []byte
+	for _, name := range names {
+		item := appendUintField(nil, 1, pathMember)
+		item = appendStringField(item, 2, name)
+		id = appendBytesField(id, 1, item)
+	}
+	return id
+}
+
+func member(names ...string) []byte {
+	return appendBytesField(appendUintField(nil, 1, exprIdent), 2, path(names...))
+}
+
+func column(name string) []byte {
+	return appendBytesField(appendUintField(nil, 1, exprIdent), 2, appendStringField(nil, 2, name))
+}
+
+func literal(v any) []byte {
+	return appendBytesField(appendUintField(nil, 1, exprLiteral), 4, appendScalar(nil, v))
+}
+
+func position(pos uint64) []byte {
+	return appendUintField(appendUintField(nil, 1, exprPlaceholder), 7, pos)
+}
+
+func operator(name string, params ...[]byte) []byte {
+	op := appendStringField(nil, 1, name)
+	for _, p := range params {
+		op = appendBytesField(op, 2, p)
+	}
+	return appendBytesField(appendUintField(nil, 1, exprOperator), 6, op)
+}
+
+func function(name string, params ...[]byte) []byte {
+	fc := appendBytesField(nil, 1, appendStringField(nil, 1, name))
+	for _, p := range params {
+		fc = appendBytesField(fc, 2, p)
+	}
+	return appendBytesField(appendUintField(nil, 1, exprFuncCall), 5, fc)
+}
+
+func object(fields ...objectField) []byte {
+	var obj []byte
+	for _, f := range fields {
+		field := appendStringField(nil, 1, f.key)
+		field = appendBytesField(field, 2, f.value.([]byte))
+		obj = appendBytesField(obj, 1, field)
+	}
+	return appendBytesField(appendUintField(nil, 1, exprObject), 8, obj)
+}
+
+func collection(name string) []byte {
+	return appendStringField(appendStringField(nil, 1, name), 2, "test")
+}
+
+func TestTranslateCrud(t *testing.T) {
+	testcases := []struct {
+		name     string
+		typ      byte
+		msg      []byte
+		query    string
+		bindVars map[string]*querypb.BindVariable
+		ids      int
+		err      string
+	}{{
+		name:  "find documents",
+		typ:   msgCrudFind,
+		msg:   appendBytesField(nil, 2, collection("c")),
+		query: "SELECT doc FROM `test`.`c`",
+	}, {
+		name: "find with criteria, order and limit",
+		typ:  msgCrudFind,
+		msg: func() []byte {
+			b := appendBytesField(nil, 2, collection("c"))
+			b = appendBytesField(b, 5, operator("&&",
+				operator("==", member("name"), position(0)),
+				operator(">", member("address", "zip"), literal(int64(1000)))))
+			b = appendBytesField(b, 7, appendUintField(appendBytesField(nil, 1, member("age")), 2, 2))
+			b = appendBytesField(b, 6, appendUintField(appendUintField(nil, 1, 10), 2, 20))
+			b = appendBytesField(b, 11, appendScalar(nil, "bob"))
+			return appendUintField(b, 12, 2)
+		}(),
+		query: "SELECT doc FROM `test`.`c` WHERE ((JSON_EXTRACT(doc, '$.name') = :v1) AND (JSON_EXTRACT(doc, '$.address.zip') > :v2)) ORDER BY JSON_EXTRACT(doc, '$.age') DESC LIMIT 20, 10 FOR UPDATE",
+		bindVars: map[string]*querypb.BindVariable{
+			"v1": sqltypes.StringBindVariable("bob"),
+			"v2": sqltypes.Int64BindVariable(1000),
+		},
+	}, {
+		name: "find with projection",
+		typ:  msgCrudFind,
+		msg: func() []byte {
+			b := appendBytesField(nil, 2, collection("c"))
+			b = appendBytesField(b, 4, appendStringField(appendBytesField(nil, 1, member("name")), 2, "n"))
+			return appendBytesField(b, 5, operator("in", member("name"), literal("a"), literal("b")))
+		}(),
+		query: "SELECT JSON_OBJECT('n', JSON_EXTRACT(doc, '$.name')) AS doc FROM `test`.`c` WHERE (JSON_EXTRACT(doc, '$.name') IN (:v1, :v2))",
+		bindVars: map[string]*querypb.BindVariable{
+			"v1": sqltypes.StringBindVariable("a"),
+			"v2": sqltypes.StringBindVariable("b"),
+		},
+	}, {
+		name: "find rows of a table",
+		typ:  msgCrudFind,
+		msg: func() []byte {
+			b := appendBytesField(nil, 2, collection("t"))
+			b = appendUintField(b, 3, dataModelTable)
+			b = appendBytesField(b, 4, appendBytesField(nil, 1, column("id")))
+			b = appendBytesField(b, 4, appendStringField(appendBytesField(nil, 1, function("upper", column("name"))), 2, "n"))
+			b = appendBytesField(b, 5, operator("like", column("name"), literal("a%")))
+			return appendUintField(b, 12, 1)
+		}(),
+		query: "SELECT `id`, upper(`name`) AS `n` FROM `test`.`t` WHERE (`name` LIKE :v1) LOCK IN SHARE MODE",
+		bindVars: map[string]*querypb.BindVariable{
+			"v1": sqltypes.StringBindVariable("a%"),
+		},
+	}, {
+		name: "function names are checked",
+		typ:  msgCrudFind,
+		msg: func() []byte {
+			b := appendBytesField(nil, 2, collection("c"))
+			return appendBytesField(b, 5, function("sleep(1); drop", member("a")))
+		}(),
+		err: "Invalid function name",
+	}, {
+		name: "insert documents",
+		typ:  msgCrudInsert,
+		msg: func() []byte {
+			b := appendBytesField(nil, 1, collection("c"))
+			b = appendBytesField(b, 4, appendBytesField(nil, 1, object(objectField{"_id", literal("1")}, objectField{"a", literal(int64(1))})))
+			b = appendBytesField(b, 4, appendBytesField(nil, 1, literal(octets{value: []byte(`{"_id": "2"}`), contentType: contentTypeJSON})))
+			return appendBoolField(b, 6, true)
+		}(),
+		query: "INSERT INTO `test`.`c` (doc) VALUES (JSON_OBJECT('_id', :v1, 'a', :v2)), (CAST(:v3 AS JSON)) ON DUPLICATE KEY UPDATE doc = VALUES(doc)",
+		bindVars: map[string]*querypb.BindVariable{
+			"v1": sqltypes.StringBindVariable("1"),
+			"v2": sqltypes.Int64BindVariable(1),
+			"v3": sqltypes.BytesBindVariable([]byte(`{"_id": "2"}`)),
+		},
+	}, {
+		name: "insert documents without _id",
+		typ:  msgCrudInsert,
+		msg: func() []byte {
+			b := appendBytesField(nil, 1, collection("c"))
+			b = appendBytesField(b, 4, appendBytesField(nil, 1, object(objectField{"a", literal(int64(1))})))
+			b = appendBytesField(b, 4, appendBytesField(nil, 1, position(0)))
+			return appendBytesField(b, 5, appendScalar(nil, `{"b": 2}`))
+		}(),
+		query: "INSERT INTO `test`.`c` (doc) VALUES (JSON_OBJECT('a', :v2, '_id', :v3)), (JSON_INSERT(CAST(:v1 AS JSON), '$._id', :v4))",
+		ids:   2,
+	}, {
+		name: "insert rows",
+		typ:  msgCrudInsert,
+		msg: func() []byte {
+			b := appendBytesField(nil, 1, collection("t"))
+			b = appendUintField(b, 2, dataModelTable)
+			b = appendBytesField(b, 3, appendStringField(nil, 1, "id"))
+			b = appendBytesField(b, 3, appendStringField(nil, 1, "name"))
+			return appendBytesField(b, 4, appendBytesField(appendBytesField(nil, 1, literal(int64(1))), 1, literal(nil)))
+		}(),
+		query: "INSERT INTO `test`.`t` (`id`, `name`) VALUES (:v1, NULL)",
+		bindVars: map[string]*querypb.BindVariable{
+			"v1": sqltypes.Int64BindVariable(1),
+		},
+	}, {
+		name: "update documents",
+		typ:  msgCrudUpdate,
+		msg: func() []byte {
+			b := appendBytesField(nil, 2, collection("c"))
+			b = appendBytesField(b, 4, operator("==", member("_id"), literal("1")))
+			b = appendBytesField(b, 7, appendBytesField(appendUintField(appendBytesField(nil, 1, path("a")), 2, updateItemSet), 3, literal(int64(2))))
+			b = appendBytesField(b, 7, appendUintField(appendBytesField(nil, 1, path("b")), 2, updateItemRemove))
+			return appendBytesField(b, 5, appendUintField(nil, 1, 1))
+		}(),
+		query: "UPDATE `test`.`c` SET doc = JSON_REMOVE(JSON_SET(doc, '$.a', :v1), '$.b') WHERE (JSON_EXTRACT(doc, '$._id') = :v2) LIMIT 1",
+		bindVars: map[string]*querypb.BindVariable{
+			"v1": sqltypes.Int64BindVariable(2),
+			"v2": sqltypes.StringBindVariable("1"),
+		},
+	}, {
+		name: "update of the _id",
+		typ:  msgCrudUpdate,
+		msg: func() []byte {
+			b := appendBytesField(nil, 2, collection("c"))
+			return appendBytesField(b, 7, appendBytesField(appendUintField(appendBytesField(nil, 1, path("_id")), 2, updateItemSet), 3, literal("2")))
+		}(),
+		err: "Forbidden update operation on '$._id' member",
+	}, {
+		name: "update rows",
+		typ:  msgCrudUpdate,
+		msg: func() []byte {
+			b := appendBytesField(nil, 2, collection("t"))
+			b = appendUintField(b, 3, dataModelTable)
+			b = appendBytesField(b, 7, appendBytesField(appendUintField(appendBytesField(nil, 1, appendStringField(nil, 2, "n")), 2, updateSet), 3, operator("+", column("n"), literal(int64(1)))))
+			return appendBytesField(b, 4, operator("between", column("id"), literal(int64(1)), literal(int64(5))))
+		}(),
+		query: "UPDATE `test`.`t` SET `n` = (`n` + :v1) WHERE (`id` BETWEEN :v2 AND :v3)",
+		bindVars: map[string]*querypb.BindVariable{
+			"v1": sqltypes.Int64BindVariable(1),
+			"v2": sqltypes.Int64BindVariable(1),
+			"v3": sqltypes.Int64BindVariable(5),
+		},
+	}, {
+		name: "delete documents",
+		typ:  msgCrudDelete,
+		msg: func() []byte {
+			b := appendBytesField(nil, 1, collection("c"))
+			b = appendBytesField(b, 3, operator("cont_in", literal("x"), member("tags")))
+			return appendBytesField(b, 5, appendBytesField(nil, 1, member("a")))
+		}(),
+		query: "DELETE FROM `test`.`c` WHERE JSON_CONTAINS(JSON_EXTRACT(doc, '$.tags'), JSON_QUOTE(:v1)) ORDER BY JSON_EXTRACT(doc, '$.a')",
+		bindVars: map[string]*querypb.BindVariable{
+			"v1": sqltypes.StringBindVariable("x"),
+		},
+	}, {
+		name: "delete with an offset",
+		typ:  msgCrudDelete,
+		msg: func() []byte {
+			b := appendBytesField(nil, 1, collection("c"))
+			return appendBytesField(b, 4, appendUintField(appendUintField(nil, 1, 1), 2, 1))
+		}(),
+		err: "non-zero offset value not allowed",
+	}}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := parseMessage(tc.msg)
+			require.NoError(t, err)
+			query, bindVars, ids, err := translateCrud(tc.typ, m)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.query, query)
+			if tc.bindVars != nil {
+				assert.Equal(t, tc.bindVars, bindVars)
+			}
+			assert.Len(t, ids, tc.ids)
+		})
+	}
+}
+
+func TestNewDocumentID(t *testing.T) {
+	id1, id2 := newDocumentID(), newDocumentID()
+	assert.Len(t, id1, 28)
+	assert.NotEqual(t, id1, id2)
+	assert.Equal(t, id1[:12], id2[:12])
+}
@@ -0,0 +1,346 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlx
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// The X Protocol messages are protobuf messages. The few this package
+// needs are decoded and encoded field by field, rather than with code
+// generated from the mysqlx .proto files.
+
+// pbField is a decoded field of a message.
+type pbField struct {
+	num protowire.Number
+	// v is the value of the varint and fixed size fields, b the one of the
+	// length delimited fields.
+	v uint64
+	b []byte
+}
+
+// pbMessage is a decoded message, whose fields are in wire order.
+type pbMessage []pbField
+
+func errMalformed() error {
+	return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "malformed protobuf message")
+}
+
+func parseMessage(b []byte) (pbMessage, error) {
+	var m pbMessage
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, errMalformed()
+		}
+		b = b[n:]
+		f := pbField{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.v = uint64(v)
+		case protowire.Fixed64Type:
+			f.v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.b, n = protowire.ConsumeBytes(b)
+		default:
+			return nil, errMalformed()
+		}
+		if n < 0 {
+			return nil, errMalformed()
+		}
+		b = b[n:]
+		m = append(m, f)
+	}
+	return m, nil
+}
+
+// field returns the last occurrence of a field, as protobuf decoders do.
+func (m pbMessage) field(num protowire.Number) (pbField, bool) {
+	for i := len(m) - 1; i >= 0; i-- {
+		if m[i].num == num {
+			return m[i], true
+		}
+	}
+	return pbField{}, false
+}
+
+func (m pbMessage) has(num protowire.Number) bool {
+	_, ok := m.field(num)
+	return ok
+}
+
+func (m pbMessage) uint(num protowire.Number) uint64 {
+	f, _ := m.field(num)
+	return f.v
+}
+
+func (m pbMessage) sint(num protowire.Number) int64 {
+	return protowire.DecodeZigZag(m.uint(num))
+}
+
+func (m pbMessage) bool(num protowire.Number) bool {
+	return m.uint(num) != 0
+}
+
+func (m pbMessage) double(num protowire.Number) float64 {
+	return math.Float64frombits(m.uint(num))
+}
+
+func (m pbMessage) float(num protowire.Number) float32 {
+	return math.Float32frombits(uint32(m.uint(num)))
+}
+
+func (m pbMessage) bytes(num protowire.Number) []byte {
+	f, _ := m.field(num)
+	return f.b
+}
+
+func (m pbMessage) string(num protowire.Number) string {
+	return string(m.bytes(num))
+}
+
+// message returns an embedded message, nil if it is not set.
+func (m pbMessage) message(num protowire.Number) (pbMessage, error) {
+	f, ok := m.field(num)
+	if !ok {
+		return nil, nil
+	}
+	return parseMessage(f.b)
+}
+
+// messages returns the embedded messages of a repeated field.
+func (m pbMessage) messages(num protowire.Number) ([]pbMessage, error) {
+	var msgs []pbMessage
+	for _, f := range m {
+		if f.num != num {
+			continue
+		}
+		msg, err := parseMessage(f.b)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func appendBytesField(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendStringField(b []byte, num protowire.Number, v string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendUintField(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendSintField(b []byte, num protowire.Number, v int64) []byte {
+	return appendUintField(b, num, protowire.EncodeZigZag(v))
+}
+
+func appendBoolField(b []byte, num protowire.Number, v bool) []byte {
+	return appendUintField(b, num, protowire.EncodeBool(v))
+}
+
+func appendDoubleField(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+// Mysqlx.Datatypes.Scalar types.
+const (
+	scalarSint   = 1
+	scalarUint   = 2
+	scalarNull   = 3
+	scalarOctets = 4
+	scalarDouble = 5
+	scalarFloat  = 6
+	scalarBool   = 7
+	scalarString = 8
+)
+
+// Mysqlx.Datatypes.Any types.
+const (
+	anyScalar = 1
+	anyObject = 2
+	anyArray  = 3
+)
+
+// Content types of octets.
+const (
+	contentTypeGeometry = 1
+	contentTypeJSON     = 2
+	contentTypeXML      = 3
+)
+
+// octets is a scalar of octets, which may be a JSON document.
+type octets struct {
+	value       []byte
+	contentType uint32
+}
+
+// decodeScalar decodes a Mysqlx.Datatypes.Scalar into nil, int64, uint64,
+// float64, bool, string or octets.
+func decodeScalar(m pbMessage) (any, error) {
+	switch m.uint(1) {
+	case scalarSint:
+		return m.sint(2), nil
+	case scalarUint:
+		return m.uint(3), nil
+	case scalarNull:
+		return nil, nil
+	case scalarOctets:
+		o, err := m.message(5)
+		if err != nil {
+			return nil, err
+		}
+		return octets{value: o.bytes(1), contentType: uint32(o.uint(2))}, nil
+	case scalarDouble:
+		return m.double(6), nil
+	case scalarFloat:
+		return float64(m.float(7)), nil
+	case scalarBool:
+		return m.bool(8), nil
+	case scalarString:
+		s, err := m.message(9)
+		if err != nil {
+			return nil, err
+		}
+		return s.string(1), nil
+	}
+	return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid scalar type %d", m.uint(1))
+}
+
+// decodeAny decodes a Mysqlx.Datatypes.Any into a scalar, a map[string]any
+// or a []any.
+func decodeAny(m pbMessage) (any, error) {
+	switch m.uint(1) {
+	case anyScalar:
+		s, err := m.message(2)
+		if err != nil {
+			return nil, err
+		}
+		return decodeScalar(s)
+	case anyObject:
+		obj, err := m.message(3)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := obj.messages(1)
+		if err != nil {
+			return nil, err
+		}
+		v := make(map[string]any, len(fields))
+		for _, field := range fields {
+			value, err := field.message(2)
+			if err != nil {
+				return nil, err
+			}
+			if v[field.string(1)], err = decodeAny(value); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case anyArray:
+		arr, err := m.message(4)
+		if err != nil {
+			return nil, err
+		}
+		values, err := arr.messages(1)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]any, 0, len(values))
+		for _, value := range values {
+			elem, err := decodeAny(value)
+			if err != nil {
+				return nil, err
+			}
+			v = append(v, elem)
+		}
+		return v, nil
+	}
+	return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid any type %d", m.uint(1))
+}
+
+// appendScalar encodes a Mysqlx.Datatypes.Scalar.
+func appendScalar(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return appendUintField(b, 1, scalarNull)
+	case int64:
+		b = appendUintField(b, 1, scalarSint)
+		return appendSintField(b, 2, v)
+	case uint64:
+		b = appendUintField(b, 1, scalarUint)
+		return appendUintField(b, 3, v)
+	case float64:
+		b = appendUintField(b, 1, scalarDouble)
+		return appendDoubleField(b, 6, v)
+	case bool:
+		b = appendUintField(b, 1, scalarBool)
+		return appendBoolField(b, 8, v)
+	case string:
+		b = appendUintField(b, 1, scalarString)
+		return appendBytesField(b, 9, appendStringField(nil, 1, v))
+	case octets:
+		b = appendUintField(b, 1, scalarOctets)
+		o := appendBytesField(nil, 1, v.value)
+		if v.contentType != 0 {
+			o = appendUintField(o, 2, uint64(v.contentType))
+		}
+		return appendBytesField(b, 5, o)
+	}
+	return appendScalar(b, fmt.Sprint(v))
+}
+
+// appendAny encodes a Mysqlx.Datatypes.Any, of a scalar, a []any or a
+// []objectField.
+func appendAny(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case []any:
+		b = appendUintField(b, 1, anyArray)
+		var arr []byte
+		for _, elem := range v {
+			arr = appendBytesField(arr, 1, appendAny(nil, elem))
+		}
+		return appendBytesField(b, 4, arr)
+	case []objectField:
+		b = appendUintField(b, 1, anyObject)
+		var obj []byte
+		for _, field := range v {
+			f := appendStringField(nil, 1, field.key)
+			f = appendBytesField(f, 2, appendAny(nil, field.value))
+			obj = appendBytesField(obj, 1, f)
+		}
+		return appendBytesField(b, 3, obj)
+	}
+	b = appendUintField(b, 1, anyScalar)
+	return appendBytesField(b, 2, appendScalar(nil, v))
+}
+
+// objectField is a field of an object to encode, whose fields keep their
+// order.
+type objectField struct {
+	key   string
+	value any
+}
@@ -0,0 +1,325 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlx
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// Mysqlx.Resultset.ColumnMetaData field types.
+const (
+	fieldSint     = 1
+	fieldUint     = 2
+	fieldDouble   = 5
+	fieldFloat    = 6
+	fieldBytes    = 7
+	fieldTime     = 10
+	fieldDatetime = 12
+	fieldEnum     = 16
+	fieldBit      = 17
+	fieldDecimal  = 18
+)
+
+// Mysqlx.Resultset.ColumnMetaData flags.
+const (
+	flagUnsigned      = 0x0001
+	flagTimestamp     = 0x0001
+	flagZerofill      = 0x0001
+	flagNotNull       = 0x0010
+	flagPrimaryKey    = 0x0020
+	flagUniqueKey     = 0x0040
+	flagMultipleKey   = 0x0080
+	flagAutoIncrement = 0x0100
+)
+
+// fieldType returns the X Protocol type of a column, and the flags that
+// depend on the type.
+func fieldType(field *querypb.Field) (uint64, uint64) {
+	var flags uint64
+	switch typ := field.Type; {
+	case sqltypes.IsSigned(typ):
+		return fieldSint, 0
+	case typ == sqltypes.Year || sqltypes.IsUnsigned(typ):
+		if field.Flags&uint32(querypb.MySqlFlag_ZEROFILL_FLAG) != 0 {
+			flags |= flagZerofill
+		}
+		return fieldUint, flags
+	case typ == sqltypes.Float32, typ == sqltypes.Float64, typ == sqltypes.Decimal:
+		if field.Flags&uint32(querypb.MySqlFlag_UNSIGNED_FLAG) != 0 {
+			flags |= flagUnsigned
+		}
+		switch typ {
+		case sqltypes.Float32:
+			return fieldFloat, flags
+		case sqltypes.Float64:
+			return fieldDouble, flags
+		}
+		return fieldDecimal, flags
+	case typ == sqltypes.Timestamp:
+		return fieldDatetime, flagTimestamp
+	case typ == sqltypes.Datetime, typ == sqltypes.Date:
+		return fieldDatetime, 0
+	case typ == sqltypes.Time:
+		return fieldTime, 0
+	case typ == sqltypes.Bit:
+		return fieldBit, 0
+	case typ == sqltypes.Enum:
+		return fieldEnum, 0
+	}
+	return fieldBytes, 0
+}
+
+func appendColumnMetaData(b []byte, field *querypb.Field) []byte {
+	typ, flags := fieldType(field)
+	for _, f := range []struct {
+		mysql uint32
+		x     uint64
+	}{
+		{uint32(querypb.MySqlFlag_NOT_NULL_FLAG), flagNotNull},
+		{uint32(querypb.MySqlFlag_PRI_KEY_FLAG), flagPrimaryKey},
+		{uint32(querypb.MySqlFlag_UNIQUE_KEY_FLAG), flagUniqueKey},
+		{uint32(querypb.MySqlFlag_MULTIPLE_KEY_FLAG), flagMultipleKey},
+		{uint32(querypb.MySqlFlag_AUTO_INCREMENT_FLAG), flagAutoIncrement},
+	} {
+		if field.Flags&f.mysql != 0 {
+			flags |= f.x
+		}
+	}
+	b = appendUintField(b, 1, typ)
+	b = appendStringField(b, 2, field.Name)
+	b = appendStringField(b, 3, field.OrgName)
+	b = appendStringField(b, 4, field.Table)
+	b = appendStringField(b, 5, field.OrgTable)
+	b = appendStringField(b, 6, field.Database)
+	b = appendStringField(b, 7, "def")
+	if field.Charset != 0 && (typ == fieldBytes || typ == fieldEnum) {
+		b = appendUintField(b, 8, uint64(field.Charset))
+	}
+	if field.Decimals != 0 && typ != fieldBytes {
+		b = appendUintField(b, 9, uint64(field.Decimals))
+	}
+	b = appendUintField(b, 10, uint64(field.ColumnLength))
+	if flags != 0 {
+		b = appendUintField(b, 11, flags)
+	}
+	switch field.Type {
+	case sqltypes.TypeJSON:
+		b = appendUintField(b, 12, contentTypeJSON)
+	case sqltypes.Geometry:
+		b = appendUintField(b, 12, contentTypeGeometry)
+	}
+	return b
+}
+
+// appendValue appends the encoding of a value of a column of the given
+// type. NULL is the empty value.
+func appendValue(b []byte, typ uint64, v sqltypes.Value) ([]byte, error) {
+	if v.IsNull() {
+		return b, nil
+	}
+	raw := v.Raw()
+	switch typ {
+	case fieldSint:
+		n, err := strconv.ParseInt(string(raw), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendVarint(b, protowire.EncodeZigZag(n)), nil
+	case fieldUint:
+		n, err := strconv.ParseUint(string(raw), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendVarint(b, n), nil
+	case fieldFloat:
+		f, err := strconv.ParseFloat(string(raw), 32)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(f))), nil
+	case fieldDouble:
+		f, err := strconv.ParseFloat(string(raw), 64)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(f)), nil
+	case fieldDecimal:
+		return appendDecimal(b, string(raw))
+	case fieldDatetime:
+		return appendDatetime(b, string(raw))
+	case fieldTime:
+		return appendTime(b, string(raw))
+	case fieldBit:
+		var n uint64
+		for _, c := range raw {
+			n = n<<8 | uint64(c)
+		}
+		return protowire.AppendVarint(b, n), nil
+	}
+	// The bytes are followed by a padding byte, telling an empty string
+	// from NULL.
+	b = append(b, raw...)
+	return append(b, 0), nil
+}
+
+// appendDecimal encodes a decimal as its scale, followed by its digits in
+// BCD and the sign nibble.
+func appendDecimal(b []byte, s string) ([]byte, error) {
+	sign := byte(0xc)
+	if strings.HasPrefix(s, "-") {
+		sign, s = 0xd, s[1:]
+	}
+	intPart, frac, _ := strings.Cut(s, ".")
+	digits := intPart + frac
+	if digits == "" || len(frac) > 255 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid decimal %q", s)
+	}
+	b = append(b, byte(len(frac)))
+	nibbles := make([]byte, 0, len(digits)+2)
+	for _, d := range []byte(digits) {
+		if d < '0' || d > '9' {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid decimal %q", s)
+		}
+		nibbles = append(nibbles, d-'0')
+	}
+	nibbles = append(nibbles, sign)
+	if len(nibbles)%2 != 0 {
+		nibbles = append(nibbles, 0)
+	}
+	for i := 0; i < len(nibbles); i += 2 {
+		b = append(b, nibbles[i]<<4|nibbles[i+1])
+	}
+	return b, nil
+}
+
+// appendDatetime encodes a date or a datetime as the varints of its parts,
+// the microseconds only if they are not zero.
+func appendDatetime(b []byte, s string) ([]byte, error) {
+	date, clock, hasClock := strings.Cut(s, " ")
+	parts := strings.Split(date, "-")
+	if len(parts) != 3 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid datetime %q", s)
+	}
+	for _, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid datetime %q", s)
+		}
+		b = protowire.AppendVarint(b, n)
+	}
+	if !hasClock {
+		return b, nil
+	}
+	return appendClock(b, clock)
+}
+
+// appendTime encodes a time as its sign, followed by the varints of its
+// parts.
+func appendTime(b []byte, s string) ([]byte, error) {
+	if strings.HasPrefix(s, "-") {
+		b = append(b, 1)
+		s = s[1:]
+	} else {
+		b = append(b, 0)
+	}
+	return appendClock(b, s)
+}
+
+func appendClock(b []byte, s string) ([]byte, error) {
+	clock, micros, _ := strings.Cut(s, ".")
+	parts := strings.Split(clock, ":")
+	if len(parts) != 3 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid time %q", s)
+	}
+	for _, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid time %q", s)
+		}
+		b = protowire.AppendVarint(b, n)
+	}
+	if micros != "" {
+		// The fractional part has up to 6 digits.
+		micros = (micros + "000000")[:6]
+		n, err := strconv.ParseUint(micros, 10, 64)
+		if err != nil {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid time %q", s)
+		}
+		if n != 0 {
+			b = protowire.AppendVarint(b, n)
+		}
+	}
+	return b, nil
+}
+
+// writeResult sends a result: its result set if it has fields, the state
+// changes, and the final StmtExecuteOk.
+func (c *Conn) writeResult(result *sqltypes.Result, documentIDs []string) error {
+	if len(result.Fields) > 0 {
+		types := make([]uint64, len(result.Fields))
+		for i, field := range result.Fields {
+			types[i], _ = fieldType(field)
+			if err := c.writeMessage(msgColumnMetaData, appendColumnMetaData(nil, field)); err != nil {
+				return err
+			}
+		}
+		var row, value []byte
+		for _, r := range result.Rows {
+			row = row[:0]
+			for i, v := range r {
+				typ := uint64(fieldBytes)
+				if i < len(types) {
+					typ = types[i]
+				}
+				var err error
+				if value, err = appendValue(value[:0], typ, v); err != nil {
+					return err
+				}
+				row = appendBytesField(row, 1, value)
+			}
+			if err := c.writeMessage(msgRow, row); err != nil {
+				return err
+			}
+		}
+		if err := c.writeMessage(msgFetchDone, nil); err != nil {
+			return err
+		}
+	}
+	if err := c.writeStateChanged(stateRowsAffected, result.RowsAffected); err != nil {
+		return err
+	}
+	if result.InsertID != 0 {
+		if err := c.writeStateChanged(stateGeneratedInsertID, result.InsertID); err != nil {
+			return err
+		}
+	}
+	if len(documentIDs) > 0 {
+		ids := make([]any, 0, len(documentIDs))
+		for _, id := range documentIDs {
+			ids = append(ids, octets{value: []byte(id)})
+		}
+		if err := c.writeStateChanged(stateGeneratedDocumentIDs, ids...); err != nil {
+			return err
+		}
+	}
+	if result.Info != "" {
+		if err := c.writeStateChanged(stateProducedMessage, result.Info); err != nil {
+			return err
+		}
+	}
+	return c.writeMessage(msgSQLStmtExecuteOk, nil)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestAppendValue(t *testing.T) {
+	testcases := []struct {
+		typ   querypb.Type
+		value string
+		want  []byte
+	}{
+		{sqltypes.Int64, "-2", []byte{0x03}},
+		{sqltypes.Uint64, "300", []byte{0xac, 0x02}},
+		{sqltypes.VarChar, "ab", []byte{'a', 'b', 0}},
+		{sqltypes.VarChar, "", []byte{0}},
+		{sqltypes.Float64, "1", []byte{0, 0, 0, 0, 0, 0, 0xf0, 0x3f}},
+		{sqltypes.Decimal, "-12.345", []byte{0x03, 0x12, 0x34, 0x5d}},
+		{sqltypes.Decimal, "1.5", []byte{0x01, 0x15, 0xc0}},
+		{sqltypes.Date, "2023-01-31", []byte{0xe7, 0x0f, 0x01, 0x1f}},
+		{sqltypes.Datetime, "2023-01-31 12:30:05", []byte{0xe7, 0x0f, 0x01, 0x1f, 0x0c, 0x1e, 0x05}},
+		{sqltypes.Datetime, "2023-01-31 12:30:05.5", []byte{0xe7, 0x0f, 0x01, 0x1f, 0x0c, 0x1e, 0x05, 0xa0, 0xc2, 0x1e}},
+		{sqltypes.Time, "-01:02:03", []byte{0x01, 0x01, 0x02, 0x03}},
+		{sqltypes.Bit, "\x01\x02", []byte{0x82, 0x02}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.typ.String()+" "+tc.value, func(t *testing.T) {
+			typ, _ := fieldType(&querypb.Field{Type: tc.typ})
+			got, err := appendValue(nil, typ, sqltypes.MakeTrusted(tc.typ, []byte(tc.value)))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	got, err := appendValue(nil, fieldBytes, sqltypes.NULL)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = appendValue(nil, fieldDecimal, sqltypes.MakeTrusted(sqltypes.Decimal, []byte("1e5")))
+	assert.Error(t, err)
+}
+
+func TestScalarRoundTrip(t *testing.T) {
+	for _, v := range []any{nil, int64(-5), uint64(7), 1.5, true, "abc", octets{value: []byte(`{}`), contentType: contentTypeJSON}} {
+		m, err := parseMessage(appendScalar(nil, v))
+		require.NoError(t, err)
+		got, err := decodeScalar(m)
+		require.NoError(t, err)
+		assert.Equal(t, v, got)
+	}
+
+	m, err := parseMessage(appendAny(nil, []objectField{{"a", []any{int64(1), "b"}}}))
+	require.NoError(t, err)
+	got, err := decodeAny(m)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"a": []any{int64(1), "b"}}, got)
+}
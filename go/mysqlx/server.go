@@ -0,0 +1,485 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/tb"
+	"vitess.io/vitess/go/vt/log"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+var (
+	connCount  = stats.NewGauge("XConnCount", "Active X Protocol connections")
+	connAccept = stats.NewCounter("XConnAccepted", "X Protocol connections accepted")
+	queries    = stats.NewCountersWithSingleLabel("XQueries", "X Protocol statements executed, by kind", "kind")
+)
+
+// Handler is the interface a server implements to execute the statements
+// of the clients.
+type Handler interface {
+	// NewConnection is called once the client is authenticated, and its
+	// session starts.
+	NewConnection(c *Conn)
+
+	// ConnectionClosed is called when the session of a connection that
+	// was passed to NewConnection ends.
+	ConnectionClosed(c *Conn)
+
+	// Execute runs a SQL statement.
+	Execute(c *Conn, query string, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error)
+}
+
+// Listener accepts X Protocol connections.
+type Listener struct {
+	listener     net.Listener
+	authServer   mysql.AuthServer
+	handler      Handler
+	connectionID atomic.Uint32
+
+	// AllowClearTextWithoutTLS allows the PLAIN mechanism, which sends the
+	// password in clear text. The connections are never encrypted.
+	AllowClearTextWithoutTLS bool
+}
+
+// NewListener listens to the given address. Accept must be called to start
+// accepting connections. The users are authenticated by authServer.
+func NewListener(protocol, address string, authServer mysql.AuthServer, handler Handler) (*Listener, error) {
+	listener, err := net.Listen(protocol, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromListener(listener, authServer, handler), nil
+}
+
+// NewFromListener creates a Listener from an existing net.Listener.
+func NewFromListener(listener net.Listener, authServer mysql.AuthServer, handler Handler) *Listener {
+	return &Listener{
+		listener:   listener,
+		authServer: authServer,
+		handler:    handler,
+	}
+}
+
+// Addr returns the address the Listener listens to.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Accept accepts connections until the Listener is closed.
+func (l *Listener) Accept() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			// Close() was probably called.
+			return
+		}
+		connAccept.Add(1)
+		go l.handle(conn, l.connectionID.Add(1))
+	}
+}
+
+// Close stops accepting connections.
+func (l *Listener) Close() {
+	l.listener.Close()
+}
+
+// errConnectionClosed tells that the client closed the connection.
+var errConnectionClosed = errors.New("connection closed by the client")
+
+// handle is called in a go routine for each client connection. A
+// connection has a session at a time, which starts with the authentication
+// and ends with a Session.Close or a Session.Reset.
+func (l *Listener) handle(conn net.Conn, connectionID uint32) {
+	c := newConn(conn, connectionID)
+
+	connCount.Add(1)
+	defer func() {
+		if x := recover(); x != nil {
+			log.Errorf("mysqlx_server caught panic:\n%v\n%s", x, tb.Stack(4))
+		}
+		conn.Close()
+		connCount.Add(-1)
+	}()
+
+	for {
+		if err := l.authenticate(c); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, errConnectionClosed) {
+				log.Infof("mysqlx_server: authentication of connection %d from %s failed: %v", connectionID, conn.RemoteAddr(), err)
+			}
+			return
+		}
+		l.handler.NewConnection(c)
+		reauthenticate, err := l.serve(c)
+		l.handler.ConnectionClosed(c)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, errConnectionClosed) {
+				log.Infof("mysqlx_server: connection %d failed: %v", connectionID, err)
+			}
+			return
+		}
+		if !reauthenticate {
+			return
+		}
+	}
+}
+
+// authenticate runs the messages until the client is authenticated.
+func (l *Listener) authenticate(c *Conn) error {
+	for {
+		typ, payload, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case msgConCapabilitiesGet:
+			err = l.capabilitiesGet(c)
+		case msgConCapabilitiesSet:
+			err = l.capabilitiesSet(c, payload)
+		case msgConClose:
+			if err := c.writeOk(); err != nil {
+				return err
+			}
+			_ = c.flush()
+			return errConnectionClosed
+		case msgSessAuthenticateStart:
+			var done bool
+			done, err = l.authenticateStart(c, payload)
+			if err == nil && done {
+				return c.flush()
+			}
+		default:
+			err = c.writeError(severityFatal, erXBadMessage, mysql.SSUnknownSQLState, "Invalid message")
+			if err == nil {
+				err = errors.New("unexpected message before authentication")
+			}
+			_ = c.flush()
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// mechanisms returns the authentication mechanisms of the connections.
+func (l *Listener) mechanisms() []any {
+	mechanisms := []any{mechanismMysql41}
+	if l.AllowClearTextWithoutTLS {
+		mechanisms = append(mechanisms, mechanismPlain)
+	}
+	return mechanisms
+}
+
+// Authentication mechanisms.
+const (
+	mechanismMysql41 = "MYSQL41"
+	mechanismPlain   = "PLAIN"
+)
+
+func (l *Listener) capabilitiesGet(c *Conn) error {
+	capabilities := []objectField{
+		{"authentication.mechanisms", l.mechanisms()},
+		{"doc.formats", "text"},
+		{"node_type", "mysql"},
+		{"client.pwd_expire_ok", false},
+	}
+	var b []byte
+	for _, capability := range capabilities {
+		cb := appendStringField(nil, 1, capability.key)
+		cb = appendBytesField(cb, 2, appendAny(nil, capability.value))
+		b = appendBytesField(b, 1, cb)
+	}
+	return c.writeMessage(msgConnCapabilities, b)
+}
+
+func (l *Listener) capabilitiesSet(c *Conn, payload []byte) error {
+	m, err := parseMessage(payload)
+	if err == nil {
+		m, err = m.message(1)
+	}
+	var capabilities []pbMessage
+	if err == nil {
+		capabilities, err = m.messages(1)
+	}
+	if err != nil {
+		return c.writeError(severityError, erXBadMessage, mysql.SSUnknownSQLState, err.Error())
+	}
+	for _, capability := range capabilities {
+		name := capability.string(1)
+		value, err := capability.message(2)
+		var v any
+		if err == nil {
+			v, err = decodeAny(value)
+		}
+		if err != nil {
+			return c.writeError(severityError, erXBadMessage, mysql.SSUnknownSQLState, err.Error())
+		}
+		switch name {
+		case "tls":
+			return c.writeError(severityError, erXCapabilitiesPrepare, mysql.SSUnknownSQLState, "Capability prepare failed for 'tls'")
+		case "client.pwd_expire_ok", "client.interactive":
+		case "session_connect_attrs":
+			attrs, ok := v.(map[string]any)
+			if !ok {
+				return c.writeError(severityError, erXCapabilitiesPrepare, mysql.SSUnknownSQLState, "Capability prepare failed for 'session_connect_attrs'")
+			}
+			c.ConnectAttrs = make(map[string]string, len(attrs))
+			for k, v := range attrs {
+				if s, ok := v.(string); ok {
+					c.ConnectAttrs[k] = s
+				}
+			}
+		default:
+			return c.writeError(severityError, erXCapabilityNotFound, mysql.SSUnknownSQLState, "Capability '"+name+"' doesn't exist")
+		}
+	}
+	return c.writeOk()
+}
+
+// authenticateStart runs a Session.AuthenticateStart, and returns true
+// once the client is authenticated.
+func (l *Listener) authenticateStart(c *Conn, payload []byte) (bool, error) {
+	m, err := parseMessage(payload)
+	if err != nil {
+		return false, c.writeError(severityError, erXBadMessage, mysql.SSUnknownSQLState, err.Error())
+	}
+	switch mechanism := m.string(1); {
+	case mechanism == mechanismPlain && l.AllowClearTextWithoutTLS:
+		parts := bytes.SplitN(m.bytes(3), []byte{0}, 3)
+		if len(parts) != 3 {
+			return false, l.accessDenied(c)
+		}
+		storage, ok := l.authServer.(mysql.PlainTextStorage)
+		if !ok {
+			return false, l.accessDenied(c)
+		}
+		userData, err := storage.UserEntryWithPassword(nil, string(parts[1]), string(parts[2]), c.RemoteAddr())
+		if err != nil {
+			return false, l.accessDenied(c)
+		}
+		return true, l.authenticated(c, string(parts[1]), string(parts[0]), userData)
+	case mechanism == mechanismMysql41:
+		return l.authenticateMysql41(c)
+	default:
+		return false, c.writeError(severityError, erNotSupportedAuthMode, "08004", "Invalid authentication method "+mechanism)
+	}
+}
+
+// authenticateMysql41 runs the MYSQL41 challenge, which is the one of
+// mysql_native_password with the scramble in hexadecimal.
+func (l *Listener) authenticateMysql41(c *Conn) (bool, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return false, err
+	}
+	if err := c.writeMessage(msgSessAuthCont, appendBytesField(nil, 1, salt)); err != nil {
+		return false, err
+	}
+	if err := c.flush(); err != nil {
+		return false, err
+	}
+	typ, payload, err := c.readMessage()
+	if err != nil {
+		return false, err
+	}
+	if typ != msgSessAuthenticateCont {
+		return false, c.writeError(severityFatal, erXBadMessage, mysql.SSUnknownSQLState, "Invalid message")
+	}
+	m, err := parseMessage(payload)
+	if err != nil {
+		return false, c.writeError(severityError, erXBadMessage, mysql.SSUnknownSQLState, err.Error())
+	}
+	// The response is the schema, the user and the scramble, separated by
+	// zeros. The scramble is empty for an empty password.
+	parts := bytes.SplitN(m.bytes(1), []byte{0}, 3)
+	if len(parts) != 3 {
+		return false, l.accessDenied(c)
+	}
+	user := string(parts[1])
+	var scramble []byte
+	if len(parts[2]) > 0 {
+		if parts[2][0] != '*' {
+			return false, l.accessDenied(c)
+		}
+		if scramble, err = hex.DecodeString(string(parts[2][1:])); err != nil {
+			return false, l.accessDenied(c)
+		}
+	}
+	var userData mysql.Getter
+	switch authServer := l.authServer.(type) {
+	case *mysql.AuthServerNone:
+		userData = &mysql.NoneGetter{}
+	case mysql.HashStorage:
+		if userData, err = authServer.UserEntryWithHash(nil, salt, user, scramble, c.RemoteAddr()); err != nil {
+			return false, l.accessDenied(c)
+		}
+	default:
+		return false, l.accessDenied(c)
+	}
+	return true, l.authenticated(c, user, string(parts[0]), userData)
+}
+
+func (l *Listener) accessDenied(c *Conn) error {
+	return c.writeError(severityError, mysql.ERAccessDeniedError, mysql.SSAccessDeniedError, "Invalid user or password")
+}
+
+func (l *Listener) authenticated(c *Conn, user, schema string, userData mysql.Getter) error {
+	c.User = user
+	c.SchemaName = schema
+	c.UserData = userData
+	return c.writeMessage(msgSessAuthOk, nil)
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, 20)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	// The salt must be a legal UTF8 string, without zeros.
+	for i := range salt {
+		salt[i] &= 0x7f
+		if salt[i] == 0 || salt[i] == '$' {
+			salt[i]++
+		}
+	}
+	return salt, nil
+}
+
+// serve runs the messages of a session. It returns true if the client
+// has to authenticate again, for a new session.
+func (l *Listener) serve(c *Conn) (bool, error) {
+	for {
+		typ, payload, err := c.readMessage()
+		if err != nil {
+			return false, err
+		}
+		switch typ {
+		case msgConClose:
+			if err := c.writeOk(); err != nil {
+				return false, err
+			}
+			_ = c.flush()
+			return false, errConnectionClosed
+		case msgSessClose:
+			if err := c.writeOk(); err != nil {
+				return false, err
+			}
+			return true, c.flush()
+		case msgSessReset:
+			// Keep the connection authenticated if asked to, still with a
+			// new session.
+			keepOpen := false
+			if m, err := parseMessage(payload); err == nil {
+				keepOpen = m.bool(1)
+			}
+			if err := c.writeOk(); err != nil {
+				return false, err
+			}
+			if !keepOpen {
+				return true, c.flush()
+			}
+			l.handler.ConnectionClosed(c)
+			c.ClientData = nil
+			l.handler.NewConnection(c)
+		default:
+			if err := l.dispatch(c, typ, payload); err != nil {
+				return false, err
+			}
+		}
+		if err := c.flush(); err != nil {
+			return false, err
+		}
+	}
+}
+
+// dispatch handles a message of a session. It only returns the errors
+// that end the connection, the others are sent to the client.
+func (l *Listener) dispatch(c *Conn, typ byte, payload []byte) error {
+	switch typ {
+	case msgConCapabilitiesGet:
+		return l.capabilitiesGet(c)
+	case msgExpectOpen, msgExpectClose:
+		return c.writeOk()
+	}
+	m, err := parseMessage(payload)
+	if err != nil {
+		return c.writeError(severityError, erXBadMessage, mysql.SSUnknownSQLState, err.Error())
+	}
+	var result *sqltypes.Result
+	var documentIDs []string
+	switch typ {
+	case msgSQLStmtExecute:
+		result, err = l.stmtExecute(c, m)
+	case msgCrudFind, msgCrudInsert, msgCrudUpdate, msgCrudDelete:
+		queries.Add("crud", 1)
+		var query string
+		var bindVars map[string]*querypb.BindVariable
+		query, bindVars, documentIDs, err = translateCrud(typ, m)
+		if err == nil {
+			result, err = l.handler.Execute(c, query, bindVars)
+		}
+	default:
+		return c.writeError(severityError, erXBadMessage, mysql.SSUnknownSQLState, "Unexpected message received")
+	}
+	if err != nil {
+		return c.writeErrorFrom(err)
+	}
+	return c.writeResult(result, documentIDs)
+}
+
+// stmtExecute runs a Sql.StmtExecute, a SQL statement or an admin command.
+func (l *Listener) stmtExecute(c *Conn, m pbMessage) (*sqltypes.Result, error) {
+	var args []any
+	anys, err := m.messages(2)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range anys {
+		arg, err := decodeAny(a)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	namespace := "sql"
+	if m.has(3) {
+		namespace = m.string(3)
+	}
+	switch namespace {
+	case "sql":
+		queries.Add("sql", 1)
+		// The ? placeholders are the :vN bind variables of the parser.
+		bindVars := make(map[string]*querypb.BindVariable, len(args))
+		for i, arg := range args {
+			bv, err := bindVariable(arg)
+			if err != nil {
+				return nil, err
+			}
+			bindVars[placeholder(i)] = bv
+		}
+		return l.handler.Execute(c, m.string(1), bindVars)
+	case "mysqlx", "xplugin":
+		queries.Add("admin", 1)
+		return l.adminCommand(c, strings.ToLower(m.string(1)), args)
+	}
+	return nil, mysql.NewSQLError(erXInvalidAdminCommand, mysql.SSUnknownSQLState, "Unknown namespace %s", namespace)
+}
@@ -0,0 +1,232 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+type testHandler struct {
+	mu       sync.Mutex
+	queries  []string
+	bindVars []map[string]*querypb.BindVariable
+	sessions int
+}
+
+func (th *testHandler) NewConnection(c *Conn) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.sessions++
+}
+
+func (th *testHandler) ConnectionClosed(c *Conn) {}
+
+func (th *testHandler) Execute(c *Conn, query string, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.queries = append(th.queries, query)
+	th.bindVars = append(th.bindVars, bindVars)
+	switch query {
+	case "bad":
+		return nil, mysql.NewSQLError(mysql.ERNoSuchTable, "42S02", "table not found")
+	case "select id, name from t where id > ?":
+		return sqltypes.MakeTestResult(sqltypes.MakeTestFields("id|name", "int64|varchar"), "1|a", "2|null"), nil
+	}
+	return &sqltypes.Result{RowsAffected: 1}, nil
+}
+
+func (th *testHandler) lastQuery() (string, map[string]*querypb.BindVariable) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	return th.queries[len(th.queries)-1], th.bindVars[len(th.bindVars)-1]
+}
+
+func (th *testHandler) sessionCount() int {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	return th.sessions
+}
+
+// testClient speaks the client side of the protocol.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+type message struct {
+	typ  byte
+	body pbMessage
+}
+
+func newTestClient(t *testing.T, authServer mysql.AuthServer, handler Handler) *testClient {
+	server, client := net.Pipe()
+	l := NewFromListener(nil, authServer, handler)
+	go l.handle(server, 1)
+	t.Cleanup(func() { client.Close() })
+	return &testClient{t: t, conn: client, r: bufio.NewReader(client)}
+}
+
+func (tc *testClient) send(typ byte, body []byte) {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(body)+1))
+	buf = append(buf, typ)
+	_, err := tc.conn.Write(append(buf, body...))
+	require.NoError(tc.t, err)
+}
+
+func (tc *testClient) read() message {
+	var header [5]byte
+	_, err := io.ReadFull(tc.r, header[:])
+	require.NoError(tc.t, err)
+	body := make([]byte, binary.LittleEndian.Uint32(header[:4])-1)
+	_, err = io.ReadFull(tc.r, body)
+	require.NoError(tc.t, err)
+	m, err := parseMessage(body)
+	require.NoError(tc.t, err)
+	return message{typ: header[4], body: m}
+}
+
+// readUntil returns the messages until one of the given type, included.
+func (tc *testClient) readUntil(typ byte) []message {
+	var msgs []message
+	for {
+		msg := tc.read()
+		msgs = append(msgs, msg)
+		if msg.typ == typ || msg.typ == msgError {
+			return msgs
+		}
+	}
+}
+
+// authenticate runs the MYSQL41 authentication.
+func (tc *testClient) authenticate(user, password string) message {
+	tc.send(msgSessAuthenticateStart, appendStringField(nil, 1, mechanismMysql41))
+	msg := tc.read()
+	require.EqualValues(tc.t, msgSessAuthCont, msg.typ)
+	response := "test\x00" + user + "\x00"
+	if password != "" {
+		response += "*" + hex.EncodeToString(mysql.ScrambleMysqlNativePassword(msg.body.bytes(1), []byte(password)))
+	}
+	tc.send(msgSessAuthenticateCont, appendStringField(nil, 1, response))
+	return tc.read()
+}
+
+func stmtExecute(namespace, stmt string, args ...[]byte) []byte {
+	b := appendStringField(nil, 1, stmt)
+	for _, arg := range args {
+		b = appendBytesField(b, 2, arg)
+	}
+	return appendStringField(b, 3, namespace)
+}
+
+func testAuthServer() mysql.AuthServer {
+	return mysql.NewAuthServerStatic("", `{"user": [{"Password": "secret"}]}`, 0)
+}
+
+func TestAuthentication(t *testing.T) {
+	th := &testHandler{}
+	tc := newTestClient(t, testAuthServer(), th)
+
+	tc.send(msgConCapabilitiesGet, nil)
+	msg := tc.read()
+	require.EqualValues(t, msgConnCapabilities, msg.typ)
+	capabilities, err := msg.body.messages(1)
+	require.NoError(t, err)
+	names := make([]string, 0, len(capabilities))
+	for _, capability := range capabilities {
+		names = append(names, capability.string(1))
+	}
+	assert.Contains(t, names, "authentication.mechanisms")
+
+	tc.send(msgConCapabilitiesSet, appendBytesField(nil, 1, appendBytesField(nil, 1,
+		appendBytesField(appendStringField(nil, 1, "tls"), 2, appendAny(nil, true)))))
+	msg = tc.read()
+	require.EqualValues(t, msgError, msg.typ)
+	assert.EqualValues(t, erXCapabilitiesPrepare, msg.body.uint(2))
+
+	msg = tc.authenticate("user", "wrong")
+	require.EqualValues(t, msgError, msg.typ)
+	assert.EqualValues(t, mysql.ERAccessDeniedError, msg.body.uint(2))
+
+	tc.send(msgSessAuthenticateStart, appendStringField(nil, 1, mechanismPlain))
+	msg = tc.read()
+	require.EqualValues(t, msgError, msg.typ)
+	assert.EqualValues(t, erNotSupportedAuthMode, msg.body.uint(2))
+
+	msg = tc.authenticate("user", "secret")
+	require.EqualValues(t, msgSessAuthOk, msg.typ)
+
+	tc.send(msgConClose, nil)
+	assert.EqualValues(t, msgOk, tc.read().typ)
+	assert.Equal(t, 1, th.sessionCount())
+}
+
+func TestStmtExecute(t *testing.T) {
+	th := &testHandler{}
+	tc := newTestClient(t, mysql.NewAuthServerNone(), th)
+	require.EqualValues(t, msgSessAuthOk, tc.authenticate("user", "").typ)
+
+	tc.send(msgSQLStmtExecute, stmtExecute("sql", "select id, name from t where id > ?", appendAny(nil, int64(0))))
+	msgs := tc.readUntil(msgSQLStmtExecuteOk)
+	var types []byte
+	for _, msg := range msgs {
+		types = append(types, msg.typ)
+	}
+	assert.Equal(t, []byte{msgColumnMetaData, msgColumnMetaData, msgRow, msgRow, msgFetchDone, msgNotice, msgSQLStmtExecuteOk}, types)
+	assert.EqualValues(t, fieldSint, msgs[0].body.uint(1))
+	assert.Equal(t, "name", msgs[1].body.string(2))
+	require.Len(t, msgs[3].body, 2)
+	assert.Equal(t, []byte{0x04}, msgs[3].body[0].b)
+	assert.Empty(t, msgs[3].body[1].b)
+	_, bindVars := th.lastQuery()
+	assert.Equal(t, map[string]*querypb.BindVariable{"v1": sqltypes.Int64BindVariable(0)}, bindVars)
+
+	tc.send(msgSQLStmtExecute, stmtExecute("sql", "bad"))
+	msg := tc.read()
+	require.EqualValues(t, msgError, msg.typ)
+	assert.EqualValues(t, mysql.ERNoSuchTable, msg.body.uint(2))
+	assert.Equal(t, "42S02", msg.body.string(4))
+
+	tc.send(msgSQLStmtExecute, stmtExecute("mysqlx", "create_collection",
+		appendAny(nil, []objectField{{"schema", "test"}, {"name", "c"}})))
+	require.EqualValues(t, msgSQLStmtExecuteOk, tc.readUntil(msgSQLStmtExecuteOk)[1].typ)
+	query, _ := th.lastQuery()
+	assert.Equal(t, "CREATE TABLE `test`.`c`"+collectionDefinition, query)
+
+	tc.send(msgSQLStmtExecute, stmtExecute("mysqlx", "nope"))
+	msg = tc.read()
+	require.EqualValues(t, msgError, msg.typ)
+	assert.EqualValues(t, erXInvalidAdminCommand, msg.body.uint(2))
+
+	find := appendBytesField(nil, 2, collection("c"))
+	find = appendBytesField(find, 5, operator("==", member("_id"), literal("1")))
+	tc.send(msgCrudFind, find)
+	tc.readUntil(msgSQLStmtExecuteOk)
+	query, _ = th.lastQuery()
+	assert.Equal(t, "SELECT doc FROM `test`.`c` WHERE (JSON_EXTRACT(doc, '$._id') = :v1)", query)
+
+	// A reset without keep_open needs a new authentication.
+	tc.send(msgSessReset, nil)
+	assert.EqualValues(t, msgOk, tc.read().typ)
+	require.EqualValues(t, msgSessAuthOk, tc.authenticate("user", "").typ)
+	tc.send(msgSQLStmtExecute, stmtExecute("mysqlx", "ping"))
+	assert.EqualValues(t, msgSQLStmtExecuteOk, tc.readUntil(msgSQLStmtExecuteOk)[1].typ)
+	assert.Equal(t, 2, th.sessionCount())
+}
@@ -0,0 +1,276 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package pgwire is an experimental server side implementation of the
+// PostgreSQL frontend/backend protocol, version 3. It supports the simple
+// and the extended query protocols, and translates the most common
+// PostgreSQL statements to the MySQL dialect before handing them over to a
+// Handler.
+package pgwire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// maxMessageSize is the largest message accepted from a client.
+const maxMessageSize = 64 * 1024 * 1024
+
+// Frontend message types.
+const (
+	msgBind        = 'B'
+	msgClose       = 'C'
+	msgDescribe    = 'D'
+	msgExecute     = 'E'
+	msgFlush       = 'H'
+	msgParse       = 'P'
+	msgPassword    = 'p'
+	msgQuery       = 'Q'
+	msgSync        = 'S'
+	msgTerminate   = 'X'
+	describeTarget = 'S'
+	describePortal = 'P'
+)
+
+// Backend message types.
+const (
+	msgAuthentication       = 'R'
+	msgBackendKeyData       = 'K'
+	msgBindComplete         = '2'
+	msgCloseComplete        = '3'
+	msgCommandComplete      = 'C'
+	msgDataRow              = 'D'
+	msgEmptyQueryResponse   = 'I'
+	msgErrorResponse        = 'E'
+	msgNoData               = 'n'
+	msgParameterDescription = 't'
+	msgParameterStatus      = 'S'
+	msgParseComplete        = '1'
+	msgPortalSuspended      = 's'
+	msgReadyForQuery        = 'Z'
+	msgRowDescription       = 'T'
+)
+
+// Startup codes, sent instead of a protocol version in the first message.
+const (
+	protocolVersion3  = 3 << 16
+	cancelRequestCode = 80877102
+	sslRequestCode    = 80877103
+	gssRequestCode    = 80877104
+)
+
+// Authentication request codes.
+const (
+	authOK                = 0
+	authCleartextPassword = 3
+)
+
+// Transaction status indicators of ReadyForQuery.
+const (
+	txIdle          = 'I'
+	txInTransaction = 'T'
+)
+
+// Conn is a client connection of a Listener.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+
+	// ConnectionID is the process ID reported to the client.
+	ConnectionID uint32
+	secretKey    uint32
+
+	// User is the user of the startup message.
+	User string
+	// Params are the run-time parameters of the startup message, like
+	// database or application_name, and the ones changed with SET since.
+	Params map[string]string
+
+	// ClientData is for the Handler to keep the state of the connection.
+	ClientData any
+
+	// tls is set once the connection is encrypted.
+	tls bool
+
+	statements map[string]*statement
+	portals    map[string]*portal
+	// failed is set after an error in the extended query protocol: the
+	// messages are ignored until the next Sync.
+	failed bool
+
+	rbuf []byte
+	wbuf []byte
+}
+
+func newConn(conn net.Conn, connectionID, secretKey uint32) *Conn {
+	return &Conn{
+		conn:         conn,
+		r:            bufio.NewReader(conn),
+		w:            bufio.NewWriter(conn),
+		ConnectionID: connectionID,
+		secretKey:    secretKey,
+		Params:       make(map[string]string),
+		statements:   make(map[string]*statement),
+		portals:      make(map[string]*portal),
+	}
+}
+
+// RemoteAddr returns the address of the client.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// TLSEnabled returns true if the connection is encrypted.
+func (c *Conn) TLSEnabled() bool {
+	return c.tls
+}
+
+// Close closes the connection.
+func (c *Conn) Close() {
+	c.conn.Close()
+}
+
+func (c *Conn) readBody(length uint32) ([]byte, error) {
+	if length < 4 || length > maxMessageSize {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid message length %d", length)
+	}
+	n := int(length - 4)
+	if cap(c.rbuf) < n {
+		c.rbuf = make([]byte, n)
+	}
+	body := c.rbuf[:n]
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// readStartupMessage reads a message without a type, which only the first
+// messages of a connection are.
+func (c *Conn) readStartupMessage() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+	return c.readBody(binary.BigEndian.Uint32(header[:]))
+}
+
+// readMessage reads a typed message. The body is only valid until the next
+// read.
+func (c *Conn) readMessage() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	body, err := c.readBody(binary.BigEndian.Uint32(header[1:]))
+	return header[0], body, err
+}
+
+// startMessage starts buffering a message of the given type, until
+// endMessage is called.
+func (c *Conn) startMessage(typ byte) {
+	c.wbuf = append(c.wbuf[:0], typ, 0, 0, 0, 0)
+}
+
+func (c *Conn) writeByte(b byte) {
+	c.wbuf = append(c.wbuf, b)
+}
+
+func (c *Conn) writeInt16(n int16) {
+	c.wbuf = binary.BigEndian.AppendUint16(c.wbuf, uint16(n))
+}
+
+func (c *Conn) writeInt32(n int32) {
+	c.wbuf = binary.BigEndian.AppendUint32(c.wbuf, uint32(n))
+}
+
+func (c *Conn) writeString(s string) {
+	c.wbuf = append(c.wbuf, s...)
+	c.wbuf = append(c.wbuf, 0)
+}
+
+func (c *Conn) endMessage() error {
+	binary.BigEndian.PutUint32(c.wbuf[1:5], uint32(len(c.wbuf)-1))
+	_, err := c.w.Write(c.wbuf)
+	return err
+}
+
+func (c *Conn) flush() error {
+	return c.w.Flush()
+}
+
+// messageReader decodes the fields of a message body.
+type messageReader struct {
+	buf []byte
+	err error
+}
+
+func (mr *messageReader) fail() {
+	if mr.err == nil {
+		mr.err = vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "malformed message")
+	}
+	mr.buf = nil
+}
+
+func (mr *messageReader) byte() byte {
+	if len(mr.buf) < 1 {
+		mr.fail()
+		return 0
+	}
+	b := mr.buf[0]
+	mr.buf = mr.buf[1:]
+	return b
+}
+
+func (mr *messageReader) int16() int16 {
+	if len(mr.buf) < 2 {
+		mr.fail()
+		return 0
+	}
+	n := int16(binary.BigEndian.Uint16(mr.buf))
+	mr.buf = mr.buf[2:]
+	return n
+}
+
+func (mr *messageReader) int32() int32 {
+	if len(mr.buf) < 4 {
+		mr.fail()
+		return 0
+	}
+	n := int32(binary.BigEndian.Uint32(mr.buf))
+	mr.buf = mr.buf[4:]
+	return n
+}
+
+func (mr *messageReader) string() string {
+	for i, b := range mr.buf {
+		if b == 0 {
+			s := string(mr.buf[:i])
+			mr.buf = mr.buf[i+1:]
+			return s
+		}
+	}
+	mr.fail()
+	return ""
+}
+
+// bytes returns the next n bytes, copied so that they outlive the message.
+func (mr *messageReader) bytes(n int) []byte {
+	if n < 0 || len(mr.buf) < n {
+		mr.fail()
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, mr.buf)
+	mr.buf = mr.buf[n:]
+	return b
+}
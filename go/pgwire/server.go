@@ -0,0 +1,868 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package pgwire
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/sync2"
+	"vitess.io/vitess/go/tb"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+var (
+	connCount  = stats.NewGauge("PgConnCount", "Active PostgreSQL protocol connections")
+	connAccept = stats.NewCounter("PgConnAccepted", "PostgreSQL protocol connections accepted")
+	queries    = stats.NewCountersWithSingleLabel("PgQueries", "PostgreSQL protocol statements executed, by protocol", "protocol")
+)
+
+// DefaultServerVersion is the server_version reported to clients when the
+// Listener doesn't set one. Clients mostly use it to pick the features they
+// rely on.
+const DefaultServerVersion = "14.0"
+
+// Handler is the interface a server implements to execute the statements
+// of the clients.
+type Handler interface {
+	// Authenticate validates the cleartext password of c.User. It is
+	// called before NewConnection.
+	Authenticate(c *Conn, password string) error
+
+	// NewConnection is called once the client is authenticated.
+	NewConnection(c *Conn)
+
+	// ConnectionClosed is called when a connection that was passed to
+	// NewConnection is closed.
+	ConnectionClosed(c *Conn)
+
+	// Execute runs a statement, translated to the MySQL dialect.
+	Execute(c *Conn, query string, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error)
+
+	// Prepare returns the fields of the rows a statement returns, none if
+	// it returns no rows.
+	Prepare(c *Conn, query string, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error)
+
+	// InTransaction returns true if the connection has an open transaction.
+	InTransaction(c *Conn) bool
+}
+
+// Listener accepts PostgreSQL protocol connections.
+type Listener struct {
+	listener     net.Listener
+	handler      Handler
+	connectionID atomic.Uint32
+
+	// ServerVersion is the server_version reported to clients.
+	ServerVersion string
+
+	// TLSConfig is the server TLS config, a *tls.Config. If set, the
+	// clients asking for SSL are answered yes and the connection is
+	// encrypted.
+	TLSConfig atomic.Value
+
+	// AllowClearTextWithoutTLS needs to be set for the clients to send
+	// their cleartext passwords over non-SSL connections. Otherwise they
+	// are refused before being asked their password.
+	AllowClearTextWithoutTLS sync2.AtomicBool
+}
+
+// NewListener listens to the given address. Accept must be called to start
+// accepting connections.
+func NewListener(protocol, address string, handler Handler) (*Listener, error) {
+	listener, err := net.Listen(protocol, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromListener(listener, handler), nil
+}
+
+// NewFromListener creates a Listener from an existing net.Listener.
+func NewFromListener(listener net.Listener, handler Handler) *Listener {
+	return &Listener{
+		listener:      listener,
+		handler:       handler,
+		ServerVersion: DefaultServerVersion,
+	}
+}
+
+// Addr returns the address the Listener listens to.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Accept accepts connections until the Listener is closed.
+func (l *Listener) Accept() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			// Close() was probably called.
+			return
+		}
+		connAccept.Add(1)
+		go l.handle(conn, l.connectionID.Add(1))
+	}
+}
+
+// Close stops accepting connections.
+func (l *Listener) Close() {
+	l.listener.Close()
+}
+
+// handle is called in a go routine for each client connection.
+func (l *Listener) handle(conn net.Conn, connectionID uint32) {
+	var key [4]byte
+	_, _ = rand.Read(key[:])
+	c := newConn(conn, connectionID, binary.BigEndian.Uint32(key[:]))
+
+	connCount.Add(1)
+	defer func() {
+		if x := recover(); x != nil {
+			log.Errorf("pg_server caught panic:\n%v\n%s", x, tb.Stack(4))
+		}
+		c.Close()
+		connCount.Add(-1)
+	}()
+
+	if err := l.startup(c); err != nil {
+		if !errors.Is(err, io.EOF) {
+			log.Infof("pg_server: startup of connection %d from %s failed: %v", connectionID, conn.RemoteAddr(), err)
+		}
+		return
+	}
+	l.handler.NewConnection(c)
+	defer l.handler.ConnectionClosed(c)
+
+	for {
+		typ, body, err := c.readMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Infof("pg_server: reading from connection %d failed: %v", connectionID, err)
+			}
+			return
+		}
+		if typ == msgTerminate {
+			return
+		}
+		if err := l.dispatch(c, typ, body); err != nil {
+			log.Infof("pg_server: writing to connection %d failed: %v", connectionID, err)
+			return
+		}
+	}
+}
+
+// startup negotiates the protocol, and authenticates the client.
+func (l *Listener) startup(c *Conn) error {
+	for {
+		body, err := c.readStartupMessage()
+		if err != nil {
+			return err
+		}
+		mr := &messageReader{buf: body}
+		code := mr.int32()
+		switch code {
+		case sslRequestCode, gssRequestCode:
+			if config, ok := l.TLSConfig.Load().(*tls.Config); ok && code == sslRequestCode && !c.tls {
+				if err := l.startTLS(c, config); err != nil {
+					return err
+				}
+				continue
+			}
+			// GSSAPI encryption is not supported, nor SSL without a TLS
+			// config: the client may go on unencrypted.
+			if _, err := c.w.Write([]byte{'N'}); err != nil {
+				return err
+			}
+			if err := c.flush(); err != nil {
+				return err
+			}
+			continue
+		case cancelRequestCode:
+			return vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "cancel requests are not supported")
+		case protocolVersion3:
+		default:
+			return l.fatal(c, "0A000", fmt.Sprintf("unsupported frontend protocol %d.%d", code>>16, code&0xffff))
+		}
+		for {
+			name := mr.string()
+			if name == "" || mr.err != nil {
+				break
+			}
+			c.Params[name] = mr.string()
+		}
+		if mr.err != nil {
+			return l.fatal(c, "08P01", "invalid startup packet layout")
+		}
+		break
+	}
+
+	c.User = c.Params["user"]
+	if c.User == "" {
+		return l.fatal(c, "28000", "no PostgreSQL user name specified in startup packet")
+	}
+	if !c.tls && !l.AllowClearTextWithoutTLS.Get() {
+		return l.fatal(c, "28000", "cleartext password authentication requires SSL")
+	}
+	c.startMessage(msgAuthentication)
+	c.writeInt32(authCleartextPassword)
+	if err := c.endMessage(); err != nil {
+		return err
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+	typ, body, err := c.readMessage()
+	if err != nil {
+		return err
+	}
+	if typ != msgPassword {
+		return l.fatal(c, "08P01", fmt.Sprintf("expected password response, got message type %q", typ))
+	}
+	mr := &messageReader{buf: body}
+	password := mr.string()
+	if err := l.handler.Authenticate(c, password); err != nil {
+		return l.fatal(c, "28P01", fmt.Sprintf("password authentication failed for user %q", c.User))
+	}
+
+	c.startMessage(msgAuthentication)
+	c.writeInt32(authOK)
+	if err := c.endMessage(); err != nil {
+		return err
+	}
+	status := []struct{ name, value string }{
+		{"server_version", l.ServerVersion},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"IntervalStyle", "postgres"},
+		{"TimeZone", "UTC"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+		{"is_superuser", "off"},
+		{"session_authorization", c.User},
+		{"application_name", c.Params["application_name"]},
+	}
+	for _, s := range status {
+		if err := c.writeParameterStatus(s.name, s.value); err != nil {
+			return err
+		}
+	}
+	c.startMessage(msgBackendKeyData)
+	c.writeInt32(int32(c.ConnectionID))
+	c.writeInt32(int32(c.secretKey))
+	if err := c.endMessage(); err != nil {
+		return err
+	}
+	return l.readyForQuery(c)
+}
+
+// startTLS accepts the SSL request of the client, and encrypts the rest of the
+// connection.
+func (l *Listener) startTLS(c *Conn, config *tls.Config) error {
+	// The client waits for the answer before the TLS handshake: anything
+	// it sent along with the request would have been sent in cleartext.
+	if c.r.Buffered() > 0 {
+		return l.fatal(c, "08P01", "received unencrypted data after SSL request")
+	}
+	if _, err := c.w.Write([]byte{'S'}); err != nil {
+		return err
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+	conn := tls.Server(c.conn, config)
+	if err := conn.Handshake(); err != nil {
+		return vterrors.Wrap(err, "TLS handshake failed")
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+	c.w = bufio.NewWriter(conn)
+	c.tls = true
+	return nil
+}
+
+// fatal sends a FATAL error to the client, which ends the connection.
+func (l *Listener) fatal(c *Conn, code, message string) error {
+	c.writeError("FATAL", code, message)
+	_ = c.flush()
+	return errors.New(message)
+}
+
+func (l *Listener) readyForQuery(c *Conn) error {
+	c.startMessage(msgReadyForQuery)
+	if l.handler.InTransaction(c) {
+		c.writeByte(txInTransaction)
+	} else {
+		c.writeByte(txIdle)
+	}
+	if err := c.endMessage(); err != nil {
+		return err
+	}
+	return c.flush()
+}
+
+// dispatch handles a message. It only returns the errors that end the
+// connection, the others are sent to the client.
+func (l *Listener) dispatch(c *Conn, typ byte, body []byte) error {
+	if typ == msgQuery {
+		mr := &messageReader{buf: body}
+		query := mr.string()
+		if mr.err != nil {
+			return mr.err
+		}
+		l.simpleQuery(c, query)
+		return l.readyForQuery(c)
+	}
+	if typ == msgSync {
+		c.failed = false
+		return l.readyForQuery(c)
+	}
+	if typ == msgFlush {
+		return c.flush()
+	}
+	if c.failed {
+		return nil
+	}
+	var err error
+	switch typ {
+	case msgParse:
+		err = l.parse(c, body)
+	case msgBind:
+		err = l.bind(c, body)
+	case msgDescribe:
+		err = l.describe(c, body)
+	case msgExecute:
+		err = l.execute(c, body)
+	case msgClose:
+		err = l.close(c, body)
+	default:
+		err = vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unsupported message type %q", typ)
+	}
+	if err != nil {
+		c.failed = true
+		c.writeErrorFrom(err)
+	}
+	return nil
+}
+
+// simpleQuery runs the statements of a Query message, until one fails.
+func (l *Listener) simpleQuery(c *Conn, query string) {
+	stmts, _, err := Translate(query)
+	if err != nil {
+		c.writeErrorFrom(err)
+		return
+	}
+	if len(stmts) == 0 {
+		c.startMessage(msgEmptyQueryResponse)
+		_ = c.endMessage()
+		return
+	}
+	for _, stmt := range stmts {
+		queries.Add("simple", 1)
+		result, err := l.run(c, stmt, nil)
+		if err == nil && len(result.Fields) > 0 {
+			err = c.writeRowDescription(result.Fields, nil)
+		}
+		if err == nil {
+			_, err = c.writeRows(result, nil, 0)
+		}
+		if err != nil {
+			c.writeErrorFrom(err)
+			return
+		}
+		c.writeCommandComplete(stmt, result)
+	}
+}
+
+// run executes a statement, unless it is one about the PostgreSQL session
+// that is answered locally.
+func (l *Listener) run(c *Conn, stmt string, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	if result, ok := l.local(c, stmt); ok {
+		return result, nil
+	}
+	return l.handler.Execute(c, stmt, bindVars)
+}
+
+// sessionParams are the PostgreSQL run-time parameters which are set and
+// shown locally: MySQL doesn't know them, or knows them by other names.
+var sessionParams = map[string]bool{
+	"application_name":                    true,
+	"bytea_output":                        true,
+	"client_encoding":                     true,
+	"client_min_messages":                 true,
+	"datestyle":                           true,
+	"extra_float_digits":                  true,
+	"idle_in_transaction_session_timeout": true,
+	"intervalstyle":                       true,
+	"lock_timeout":                        true,
+	"search_path":                         true,
+	"standard_conforming_strings":         true,
+	"statement_timeout":                   true,
+	"timezone":                            true,
+}
+
+// local answers the SET and SHOW statements of PostgreSQL run-time
+// parameters.
+func (l *Listener) local(c *Conn, stmt string) (*sqltypes.Result, bool) {
+	fields := strings.Fields(stmt)
+	if len(fields) < 2 {
+		return nil, false
+	}
+	switch strings.ToLower(fields[0]) {
+	case "set":
+		rest := fields[1:]
+		if len(rest) > 1 && (strings.EqualFold(rest[0], "session") || strings.EqualFold(rest[0], "local")) {
+			rest = rest[1:]
+		}
+		name, value, ok := splitSet(strings.Join(rest, " "))
+		if !ok || !sessionParams[strings.ToLower(name)] {
+			return nil, false
+		}
+		c.Params[strings.ToLower(name)] = value
+		if strings.EqualFold(name, "application_name") {
+			_ = c.writeParameterStatus("application_name", value)
+		}
+		return &sqltypes.Result{}, true
+	case "show":
+		name := strings.ToLower(strings.TrimSpace(strings.Join(fields[1:], " ")))
+		if name == "server_version" {
+			return showResult(name, l.ServerVersion), true
+		}
+		if !sessionParams[name] {
+			return nil, false
+		}
+		value, ok := c.Params[name]
+		if !ok {
+			value = defaultParams[name]
+		}
+		return showResult(name, value), true
+	}
+	return nil, false
+}
+
+var defaultParams = map[string]string{
+	"client_encoding":             "UTF8",
+	"datestyle":                   "ISO, MDY",
+	"intervalstyle":               "postgres",
+	"search_path":                 `"$user", public`,
+	"standard_conforming_strings": "on",
+	"timezone":                    "UTC",
+}
+
+// splitSet splits "name = value" or "name TO value", and unquotes the value.
+func splitSet(s string) (string, string, bool) {
+	var name, value string
+	if i := strings.IndexByte(s, '='); i > 0 {
+		name, value = s[:i], s[i+1:]
+	} else if fields := strings.Fields(s); len(fields) > 2 && strings.EqualFold(fields[1], "to") {
+		name, value = fields[0], strings.Join(fields[2:], " ")
+	} else {
+		return "", "", false
+	}
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return strings.TrimSpace(name), value, true
+}
+
+func showResult(name, value string) *sqltypes.Result {
+	return &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: name, Type: sqltypes.VarChar}},
+		Rows:   [][]sqltypes.Value{{sqltypes.NewVarChar(value)}},
+	}
+}
+
+// statement is a prepared statement of the extended query protocol.
+type statement struct {
+	query     string
+	paramOIDs []uint32
+}
+
+// portal is a statement bound to its parameters.
+type portal struct {
+	stmt          *statement
+	bindVars      map[string]*querypb.BindVariable
+	resultFormats []int16
+	// result and sent are set once the portal executed, which may take
+	// several Execute messages when they limit the number of rows.
+	result *sqltypes.Result
+	sent   int
+}
+
+func (l *Listener) parse(c *Conn, body []byte) error {
+	mr := &messageReader{buf: body}
+	name := mr.string()
+	query := mr.string()
+	n := int(mr.int16())
+	oids := make([]uint32, 0, n)
+	for i := 0; i < n; i++ {
+		oids = append(oids, uint32(mr.int32()))
+	}
+	if mr.err != nil {
+		return mr.err
+	}
+	if _, ok := c.statements[name]; ok && name != "" {
+		return sqlStateErrorf("42P05", "prepared statement %q already exists", name)
+	}
+	stmts, params, err := Translate(query)
+	if err != nil {
+		return err
+	}
+	if len(stmts) > 1 {
+		return sqlStateErrorf("42601", "cannot insert multiple commands into a prepared statement")
+	}
+	stmt := &statement{paramOIDs: oids}
+	if len(stmts) == 1 {
+		stmt.query = stmts[0]
+	}
+	for len(stmt.paramOIDs) < params {
+		stmt.paramOIDs = append(stmt.paramOIDs, oidUnspecified)
+	}
+	c.statements[name] = stmt
+	c.startMessage(msgParseComplete)
+	return c.endMessage()
+}
+
+func (l *Listener) bind(c *Conn, body []byte) error {
+	mr := &messageReader{buf: body}
+	portalName := mr.string()
+	stmtName := mr.string()
+	formats := make([]int16, mr.int16())
+	for i := range formats {
+		formats[i] = mr.int16()
+	}
+	values := make([][]byte, mr.int16())
+	for i := range values {
+		if length := mr.int32(); length >= 0 {
+			values[i] = mr.bytes(int(length))
+		}
+	}
+	resultFormats := make([]int16, mr.int16())
+	for i := range resultFormats {
+		resultFormats[i] = mr.int16()
+	}
+	if mr.err != nil {
+		return mr.err
+	}
+	stmt, ok := c.statements[stmtName]
+	if !ok {
+		return sqlStateErrorf("26000", "prepared statement %q does not exist", stmtName)
+	}
+	if len(values) != len(stmt.paramOIDs) {
+		return sqlStateErrorf("08P01", "bind message supplies %d parameters, but prepared statement %q requires %d", len(values), stmtName, len(stmt.paramOIDs))
+	}
+	bindVars := make(map[string]*querypb.BindVariable, len(values))
+	for i, value := range values {
+		bv, err := decodeParam(stmt.paramOIDs[i], formatCode(formats, i), value)
+		if err != nil {
+			return err
+		}
+		bindVars[fmt.Sprintf("v%d", i+1)] = bv
+	}
+	c.portals[portalName] = &portal{stmt: stmt, bindVars: bindVars, resultFormats: resultFormats}
+	c.startMessage(msgBindComplete)
+	return c.endMessage()
+}
+
+func (l *Listener) describe(c *Conn, body []byte) error {
+	mr := &messageReader{buf: body}
+	target := mr.byte()
+	name := mr.string()
+	if mr.err != nil {
+		return mr.err
+	}
+	var stmt *statement
+	var bindVars map[string]*querypb.BindVariable
+	var resultFormats []int16
+	switch target {
+	case describeTarget:
+		var ok bool
+		if stmt, ok = c.statements[name]; !ok {
+			return sqlStateErrorf("26000", "prepared statement %q does not exist", name)
+		}
+		c.startMessage(msgParameterDescription)
+		c.writeInt16(int16(len(stmt.paramOIDs)))
+		for _, oid := range stmt.paramOIDs {
+			if oid == oidUnspecified {
+				oid = oidText
+			}
+			c.writeInt32(int32(oid))
+		}
+		if err := c.endMessage(); err != nil {
+			return err
+		}
+	case describePortal:
+		p, ok := c.portals[name]
+		if !ok {
+			return sqlStateErrorf("34000", "portal %q does not exist", name)
+		}
+		stmt, bindVars, resultFormats = p.stmt, p.bindVars, p.resultFormats
+	default:
+		return sqlStateErrorf("08P01", "invalid describe message target %q", target)
+	}
+
+	fields, err := l.fields(c, stmt, bindVars)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		c.startMessage(msgNoData)
+		return c.endMessage()
+	}
+	return c.writeRowDescription(fields, resultFormats)
+}
+
+// fields returns the fields of the rows a statement returns.
+func (l *Listener) fields(c *Conn, stmt *statement, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error) {
+	if stmt.query == "" {
+		return nil, nil
+	}
+	if result, ok := l.local(c, stmt.query); ok {
+		return result.Fields, nil
+	}
+	if bindVars == nil {
+		// Statements are described before they are bound, planning them
+		// only needs the bind variables to exist.
+		bindVars = make(map[string]*querypb.BindVariable, len(stmt.paramOIDs))
+		for i := range stmt.paramOIDs {
+			bindVars[fmt.Sprintf("v%d", i+1)] = sqltypes.NullBindVariable
+		}
+	}
+	return l.handler.Prepare(c, stmt.query, bindVars)
+}
+
+func (l *Listener) execute(c *Conn, body []byte) error {
+	mr := &messageReader{buf: body}
+	name := mr.string()
+	maxRows := int(mr.int32())
+	if mr.err != nil {
+		return mr.err
+	}
+	p, ok := c.portals[name]
+	if !ok {
+		return sqlStateErrorf("34000", "portal %q does not exist", name)
+	}
+	if p.stmt.query == "" {
+		c.startMessage(msgEmptyQueryResponse)
+		return c.endMessage()
+	}
+	if p.result == nil {
+		queries.Add("extended", 1)
+		result, err := l.run(c, p.stmt.query, p.bindVars)
+		if err != nil {
+			return err
+		}
+		p.result = result
+	}
+	sent, err := c.writeRows(&sqltypes.Result{Fields: p.result.Fields, Rows: p.result.Rows[p.sent:]}, p.resultFormats, maxRows)
+	if err != nil {
+		return err
+	}
+	p.sent += sent
+	if p.sent < len(p.result.Rows) {
+		c.startMessage(msgPortalSuspended)
+		return c.endMessage()
+	}
+	c.writeCommandComplete(p.stmt.query, p.result)
+	return nil
+}
+
+func (l *Listener) close(c *Conn, body []byte) error {
+	mr := &messageReader{buf: body}
+	target := mr.byte()
+	name := mr.string()
+	if mr.err != nil {
+		return mr.err
+	}
+	switch target {
+	case describeTarget:
+		delete(c.statements, name)
+	case describePortal:
+		delete(c.portals, name)
+	default:
+		return sqlStateErrorf("08P01", "invalid close message target %q", target)
+	}
+	c.startMessage(msgCloseComplete)
+	return c.endMessage()
+}
+
+func formatCode(formats []int16, i int) int16 {
+	switch len(formats) {
+	case 0:
+		return formatText
+	case 1:
+		return formats[0]
+	}
+	if i < len(formats) {
+		return formats[i]
+	}
+	return formatText
+}
+
+func (c *Conn) writeParameterStatus(name, value string) error {
+	c.startMessage(msgParameterStatus)
+	c.writeString(name)
+	c.writeString(value)
+	return c.endMessage()
+}
+
+func (c *Conn) writeRowDescription(fields []*querypb.Field, formats []int16) error {
+	c.startMessage(msgRowDescription)
+	c.writeInt16(int16(len(fields)))
+	for i, field := range fields {
+		oid := typeOID(field.Type)
+		format := formatCode(formats, i)
+		if format == formatBinary && !supportsBinary(oid) {
+			return vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "binary format is not supported for column %q", field.Name)
+		}
+		c.writeString(field.Name)
+		// The table OID and the column attribute number are unknown.
+		c.writeInt32(0)
+		c.writeInt16(0)
+		c.writeInt32(int32(oid))
+		c.writeInt16(typeSize(oid))
+		// The type modifier.
+		c.writeInt32(-1)
+		c.writeInt16(format)
+	}
+	return c.endMessage()
+}
+
+// writeRows sends the rows of a result, at most maxRows of them if it is
+// positive, and returns the number of rows sent.
+func (c *Conn) writeRows(result *sqltypes.Result, formats []int16, maxRows int) (int, error) {
+	oids := make([]uint32, len(result.Fields))
+	for i, field := range result.Fields {
+		oids[i] = typeOID(field.Type)
+	}
+	rows := result.Rows
+	if maxRows > 0 && len(rows) > maxRows {
+		rows = rows[:maxRows]
+	}
+	var value []byte
+	for _, row := range rows {
+		c.startMessage(msgDataRow)
+		c.writeInt16(int16(len(row)))
+		for i, v := range row {
+			if v.IsNull() {
+				c.writeInt32(-1)
+				continue
+			}
+			oid := uint32(oidText)
+			if i < len(oids) {
+				oid = oids[i]
+			}
+			var err error
+			value, err = appendValue(value[:0], v, oid, formatCode(formats, i))
+			if err != nil {
+				return 0, err
+			}
+			c.writeInt32(int32(len(value)))
+			c.wbuf = append(c.wbuf, value...)
+		}
+		if err := c.endMessage(); err != nil {
+			return 0, err
+		}
+	}
+	return len(rows), nil
+}
+
+// writeCommandComplete sends the tag of a statement that completed.
+func (c *Conn) writeCommandComplete(stmt string, result *sqltypes.Result) {
+	c.startMessage(msgCommandComplete)
+	c.writeString(commandTag(stmt, result))
+	_ = c.endMessage()
+}
+
+func commandTag(stmt string, result *sqltypes.Result) string {
+	switch sqlparser.Preview(stmt) {
+	case sqlparser.StmtSelect:
+		return fmt.Sprintf("SELECT %d", len(result.Rows))
+	case sqlparser.StmtInsert, sqlparser.StmtReplace:
+		return fmt.Sprintf("INSERT 0 %d", result.RowsAffected)
+	case sqlparser.StmtUpdate:
+		return fmt.Sprintf("UPDATE %d", result.RowsAffected)
+	case sqlparser.StmtDelete:
+		return fmt.Sprintf("DELETE %d", result.RowsAffected)
+	case sqlparser.StmtBegin:
+		return "BEGIN"
+	case sqlparser.StmtCommit:
+		return "COMMIT"
+	case sqlparser.StmtRollback:
+		return "ROLLBACK"
+	case sqlparser.StmtSet, sqlparser.StmtUse:
+		return "SET"
+	}
+	words := strings.Fields(strings.ToUpper(stmt))
+	switch {
+	case len(words) == 0:
+		return ""
+	case len(words) > 1 && (words[0] == "CREATE" || words[0] == "DROP" || words[0] == "ALTER"):
+		return words[0] + " " + words[1]
+	default:
+		return words[0]
+	}
+}
+
+// sqlStateError is an error with a PostgreSQL error code.
+type sqlStateError struct {
+	code    string
+	message string
+}
+
+func sqlStateErrorf(code, format string, args ...any) error {
+	return &sqlStateError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func (e *sqlStateError) Error() string {
+	return e.message
+}
+
+// SQLState returns the error code.
+func (e *sqlStateError) SQLState() string {
+	return e.code
+}
+
+func (c *Conn) writeError(severity, code, message string) {
+	c.startMessage(msgErrorResponse)
+	c.writeByte('S')
+	c.writeString(severity)
+	c.writeByte('V')
+	c.writeString(severity)
+	c.writeByte('C')
+	c.writeString(code)
+	c.writeByte('M')
+	c.writeString(message)
+	c.writeByte(0)
+	_ = c.endMessage()
+}
+
+// writeErrorFrom sends an error. Errors that know their SQLSTATE, like the
+// MySQL errors, keep it: clients mostly only tell its class apart.
+func (c *Conn) writeErrorFrom(err error) {
+	code := "XX000"
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) && len(stateErr.SQLState()) == 5 {
+		code = stateErr.SQLState()
+	}
+	c.writeError("ERROR", code, err.Error())
+}
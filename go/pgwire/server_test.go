@@ -0,0 +1,380 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package pgwire
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/tlstest"
+	"vitess.io/vitess/go/vt/vttls"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+type testHandler struct {
+	mu       sync.Mutex
+	queries  []string
+	bindVars []map[string]*querypb.BindVariable
+	inTx     bool
+
+	onNewConnection func(c *Conn)
+}
+
+func (th *testHandler) Authenticate(c *Conn, password string) error {
+	if password != "secret" {
+		return mysql.NewSQLError(mysql.ERAccessDeniedError, mysql.SSAccessDeniedError, "access denied")
+	}
+	return nil
+}
+
+func (th *testHandler) NewConnection(c *Conn) {
+	if th.onNewConnection != nil {
+		th.onNewConnection(c)
+	}
+}
+
+func (th *testHandler) ConnectionClosed(c *Conn) {}
+
+func (th *testHandler) Execute(c *Conn, query string, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.queries = append(th.queries, query)
+	th.bindVars = append(th.bindVars, bindVars)
+	switch query {
+	case "begin":
+		th.inTx = true
+		return &sqltypes.Result{}, nil
+	case "bad":
+		return nil, mysql.NewSQLError(mysql.ERNoSuchTable, "42S02", "table not found")
+	case "insert into t values (:v1)":
+		return &sqltypes.Result{RowsAffected: 1}, nil
+	}
+	return sqltypes.MakeTestResult(sqltypes.MakeTestFields("id|name", "int64|varchar"), "1|a", "2|null", "3|c"), nil
+}
+
+func (th *testHandler) Prepare(c *Conn, query string, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error) {
+	if query == "insert into t values (:v1)" {
+		return nil, nil
+	}
+	return sqltypes.MakeTestFields("id|name", "int64|varchar"), nil
+}
+
+func (th *testHandler) InTransaction(c *Conn) bool {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	return th.inTx
+}
+
+// testClient speaks the frontend side of the protocol.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+type message struct {
+	typ  byte
+	body []byte
+}
+
+func newTestClient(t *testing.T, handler Handler) *testClient {
+	l := &Listener{handler: handler, ServerVersion: DefaultServerVersion}
+	l.AllowClearTextWithoutTLS.Set(true)
+	return connectTestClient(t, l)
+}
+
+func connectTestClient(t *testing.T, l *Listener) *testClient {
+	server, client := net.Pipe()
+	go l.handle(server, 1)
+	t.Cleanup(func() { client.Close() })
+	return &testClient{t: t, conn: client, r: bufio.NewReader(client)}
+}
+
+func (tc *testClient) send(typ byte, body []byte) {
+	buf := []byte{typ, 0, 0, 0, 0}
+	if typ == 0 {
+		buf = buf[1:]
+	}
+	buf = append(buf, body...)
+	binary.BigEndian.PutUint32(buf[len(buf)-len(body)-4:], uint32(len(body)+4))
+	_, err := tc.conn.Write(buf)
+	require.NoError(tc.t, err)
+}
+
+func (tc *testClient) read() message {
+	var header [5]byte
+	_, err := io.ReadFull(tc.r, header[:])
+	require.NoError(tc.t, err)
+	body := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+	_, err = io.ReadFull(tc.r, body)
+	require.NoError(tc.t, err)
+	return message{typ: header[0], body: body}
+}
+
+// readUntilReady returns the messages until ReadyForQuery, included.
+func (tc *testClient) readUntilReady() []message {
+	var msgs []message
+	for {
+		msg := tc.read()
+		msgs = append(msgs, msg)
+		if msg.typ == msgReadyForQuery {
+			return msgs
+		}
+	}
+}
+
+func cstrings(s ...string) []byte {
+	var b []byte
+	for _, s := range s {
+		b = append(b, s...)
+		b = append(b, 0)
+	}
+	return b
+}
+
+func int16s(n ...int16) []byte {
+	var b []byte
+	for _, n := range n {
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	}
+	return b
+}
+
+func (tc *testClient) startup(password string) []message {
+	// Clients first ask for SSL, which is declined.
+	require.EqualValues(tc.t, 'N', tc.requestSSL())
+	return tc.login(password)
+}
+
+// requestSSL asks for SSL, and returns the answer of the server.
+func (tc *testClient) requestSSL() byte {
+	tc.send(0, binary.BigEndian.AppendUint32(nil, sslRequestCode))
+	b, err := tc.r.ReadByte()
+	require.NoError(tc.t, err)
+	return b
+}
+
+// login sends the startup message and the password, and returns the
+// messages until ReadyForQuery, or the error.
+func (tc *testClient) login(password string) []message {
+	body := binary.BigEndian.AppendUint32(nil, protocolVersion3)
+	body = append(body, cstrings("user", "alice", "database", "ks", "")...)
+	tc.send(0, body)
+	msg := tc.read()
+	require.EqualValues(tc.t, msgAuthentication, msg.typ)
+	require.EqualValues(tc.t, authCleartextPassword, binary.BigEndian.Uint32(msg.body))
+	tc.send(msgPassword, cstrings(password))
+	msg = tc.read()
+	if msg.typ == msgErrorResponse {
+		return []message{msg}
+	}
+	require.EqualValues(tc.t, msgAuthentication, msg.typ)
+	require.EqualValues(tc.t, authOK, binary.BigEndian.Uint32(msg.body))
+	return tc.readUntilReady()
+}
+
+func types(msgs []message) string {
+	var s []byte
+	for _, msg := range msgs {
+		s = append(s, msg.typ)
+	}
+	return string(s)
+}
+
+// errorFields returns the fields of an ErrorResponse.
+func errorFields(msg message) map[byte]string {
+	fields := make(map[byte]string)
+	mr := &messageReader{buf: msg.body}
+	for {
+		typ := mr.byte()
+		if typ == 0 || mr.err != nil {
+			return fields
+		}
+		fields[typ] = mr.string()
+	}
+}
+
+func TestStartup(t *testing.T) {
+	tc := newTestClient(t, &testHandler{})
+	msgs := tc.startup("secret")
+	last := msgs[len(msgs)-1]
+	assert.Equal(t, []byte{txIdle}, last.body)
+	assert.Equal(t, "SSSSSSSSSSSKZ", types(msgs))
+
+	tc = newTestClient(t, &testHandler{})
+	msgs = tc.startup("wrong")
+	require.Len(t, msgs, 1)
+	fields := errorFields(msgs[0])
+	assert.Equal(t, "FATAL", fields['S'])
+	assert.Equal(t, "28P01", fields['C'])
+}
+
+func TestStartupWithoutTLS(t *testing.T) {
+	// The cleartext passwords are refused over non-SSL connections.
+	l := &Listener{handler: &testHandler{}, ServerVersion: DefaultServerVersion}
+	tc := connectTestClient(t, l)
+	require.EqualValues(t, 'N', tc.requestSSL())
+	body := binary.BigEndian.AppendUint32(nil, protocolVersion3)
+	body = append(body, cstrings("user", "alice", "")...)
+	tc.send(0, body)
+	msg := tc.read()
+	require.EqualValues(t, msgErrorResponse, msg.typ)
+	fields := errorFields(msg)
+	assert.Equal(t, "FATAL", fields['S'])
+	assert.Equal(t, "28000", fields['C'])
+	_, err := tc.r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestStartupTLS(t *testing.T) {
+	root := t.TempDir()
+	tlstest.CreateCA(root)
+	tlstest.CreateSignedCert(root, tlstest.CA, "01", "server", "server.example.com")
+	serverConfig, err := vttls.ServerConfig(path.Join(root, "server-cert.pem"), path.Join(root, "server-key.pem"), "", "", "", tls.VersionTLS12)
+	require.NoError(t, err)
+	clientConfig, err := vttls.ClientConfig(vttls.VerifyIdentity, "", "", path.Join(root, "ca-cert.pem"), "", "server.example.com", tls.VersionTLS12)
+	require.NoError(t, err)
+
+	var tlsEnabled atomic.Bool
+	th := &testHandler{onNewConnection: func(c *Conn) { tlsEnabled.Store(c.TLSEnabled()) }}
+	l := &Listener{handler: th, ServerVersion: DefaultServerVersion}
+	l.TLSConfig.Store(serverConfig)
+	tc := connectTestClient(t, l)
+	require.EqualValues(t, 'S', tc.requestSSL())
+	conn := tls.Client(tc.conn, clientConfig)
+	require.NoError(t, conn.Handshake())
+	tc.conn, tc.r = conn, bufio.NewReader(conn)
+	// The password is sent encrypted.
+	msgs := tc.login("secret")
+	assert.Equal(t, "SSSSSSSSSSSKZ", types(msgs))
+
+	tc.send(msgQuery, cstrings("select 1"))
+	assert.Equal(t, "TDDDCZ", types(tc.readUntilReady()))
+	assert.True(t, tlsEnabled.Load())
+}
+
+func TestSimpleQuery(t *testing.T) {
+	th := &testHandler{}
+	tc := newTestClient(t, th)
+	tc.startup("secret")
+
+	tc.send(msgQuery, cstrings(`select "id", name from t where name ilike 'a%'; begin`))
+	msgs := tc.readUntilReady()
+	require.Equal(t, "TDDDCCZ", types(msgs))
+	assert.Equal(t, []string{"select `id`, name from t where name like 'a%'", "begin"}, th.queries)
+
+	mr := &messageReader{buf: msgs[0].body}
+	assert.EqualValues(t, 2, mr.int16())
+	assert.Equal(t, "id", mr.string())
+	mr.int32()
+	mr.int16()
+	assert.EqualValues(t, oidInt8, mr.int32())
+
+	// The second row has a NULL.
+	mr = &messageReader{buf: msgs[2].body}
+	assert.EqualValues(t, 2, mr.int16())
+	assert.EqualValues(t, 1, mr.int32())
+	assert.Equal(t, "2", string(mr.bytes(1)))
+	assert.EqualValues(t, -1, mr.int32())
+
+	assert.Equal(t, "SELECT 3", (&messageReader{buf: msgs[4].body}).string())
+	assert.Equal(t, "BEGIN", (&messageReader{buf: msgs[5].body}).string())
+	assert.Equal(t, []byte{txInTransaction}, msgs[6].body)
+
+	// An error stops the statements of the query.
+	tc.send(msgQuery, cstrings("bad; select 1"))
+	msgs = tc.readUntilReady()
+	require.Equal(t, "EZ", types(msgs))
+	assert.Equal(t, "42S02", errorFields(msgs[0])['C'])
+
+	tc.send(msgQuery, cstrings(""))
+	assert.Equal(t, "IZ", types(tc.readUntilReady()))
+}
+
+func TestLocalParameters(t *testing.T) {
+	th := &testHandler{}
+	tc := newTestClient(t, th)
+	tc.startup("secret")
+
+	tc.send(msgQuery, cstrings("SET extra_float_digits = 3; set application_name to 'psql'; show application_name; show server_version"))
+	msgs := tc.readUntilReady()
+	require.Equal(t, "CSCTDCTDCZ", types(msgs))
+	mr := &messageReader{buf: msgs[4].body}
+	mr.int16()
+	assert.Equal(t, "psql", string(mr.bytes(int(mr.int32()))))
+	assert.Empty(t, th.queries)
+}
+
+func TestExtendedQuery(t *testing.T) {
+	th := &testHandler{}
+	tc := newTestClient(t, th)
+	tc.startup("secret")
+
+	// Parse, describe, bind and execute in one go, limiting rows.
+	tc.send(msgParse, append(cstrings("s1", "select id, name from t where id > $1"), int16s(1, 0, oidInt4)...))
+	tc.send(msgDescribe, append([]byte{describeTarget}, cstrings("s1")...))
+	bind := append(cstrings("p1", "s1"), int16s(1, formatBinary, 1)...)
+	bind = append(bind, 0, 0, 0, 4, 0, 0, 0, 7)
+	bind = append(bind, int16s(2, formatText, formatBinary)...)
+	tc.send(msgBind, bind)
+	tc.send(msgExecute, append(cstrings("p1"), 0, 0, 0, 2))
+	tc.send(msgExecute, append(cstrings("p1"), 0, 0, 0, 0))
+	tc.send(msgSync, nil)
+	msgs := tc.readUntilReady()
+	require.Equal(t, "1tT2DDsDCZ", types(msgs))
+
+	require.Len(t, th.bindVars, 1)
+	assert.Equal(t, sqltypes.Int64BindVariable(7), th.bindVars[0]["v1"])
+	assert.Equal(t, []string{"select id, name from t where id > :v1"}, th.queries)
+	assert.Equal(t, "SELECT 3", (&messageReader{buf: msgs[8].body}).string())
+
+	// An error skips the messages until Sync.
+	tc.send(msgBind, append(cstrings("", "missing"), int16s(0, 0, 0)...))
+	tc.send(msgExecute, append(cstrings(""), 0, 0, 0, 0))
+	tc.send(msgSync, nil)
+	msgs = tc.readUntilReady()
+	require.Equal(t, "EZ", types(msgs))
+	assert.Equal(t, "26000", errorFields(msgs[0])['C'])
+
+	// An unnamed statement which returns no rows.
+	tc.send(msgParse, append(cstrings("", "insert into t values ($1)"), int16s(0)...))
+	tc.send(msgBind, append(append(cstrings("", ""), int16s(0, 1)...), append([]byte{0, 0, 0, 1, 'x'}, int16s(0)...)...))
+	tc.send(msgDescribe, append([]byte{describePortal}, cstrings("")...))
+	tc.send(msgExecute, append(cstrings(""), 0, 0, 0, 0))
+	tc.send(msgClose, append([]byte{describeTarget}, cstrings("s1")...))
+	tc.send(msgSync, nil)
+	msgs = tc.readUntilReady()
+	require.Equal(t, "12nC3Z", types(msgs))
+	assert.Equal(t, "INSERT 0 1", (&messageReader{buf: msgs[3].body}).string())
+	assert.Equal(t, sqltypes.StringBindVariable("x"), th.bindVars[1]["v1"])
+}
+
+func TestCommandTag(t *testing.T) {
+	result := &sqltypes.Result{RowsAffected: 2, Rows: [][]sqltypes.Value{{}}}
+	for stmt, tag := range map[string]string{
+		"select 1":               "SELECT 1",
+		"update t set a = 1":     "UPDATE 2",
+		"delete from t":          "DELETE 2",
+		"commit":                 "COMMIT",
+		"create table t (a int)": "CREATE TABLE",
+		"truncate t":             "TRUNCATE",
+	} {
+		assert.Equal(t, tag, commandTag(stmt, result), stmt)
+	}
+}
@@ -0,0 +1,351 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package pgwire
+
+import (
+	"strconv"
+	"strings"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// Translate splits a PostgreSQL query into its statements, and translates
+// them to the MySQL dialect. It also returns the number of parameters of the
+// query, which is the highest $n placeholder.
+//
+// The translation is lexical, and covers what PostgreSQL clients and tools
+// commonly send:
+//   - the $n parameter placeholders become the :vn bind variables;
+//   - "quoted" identifiers become `quoted` identifiers;
+//   - backslashes of standard strings are escaped, E” strings and
+//     dollar-quoted strings become MySQL strings;
+//   - ::type casts are dropped, MySQL converting values implicitly;
+//   - ILIKE becomes LIKE, which is case insensitive with the default
+//     collations, and current_database() and current_schema become
+//     database().
+//
+// Anything else is passed as is, and may fail to parse at vtgate.
+func Translate(sql string) ([]string, int, error) {
+	t := &translator{sql: sql}
+	if err := t.run(); err != nil {
+		return nil, 0, err
+	}
+	return t.stmts, t.params, nil
+}
+
+type translator struct {
+	sql    string
+	pos    int
+	out    strings.Builder
+	stmts  []string
+	params int
+}
+
+func (t *translator) run() error {
+	for t.pos < len(t.sql) {
+		ch := t.sql[t.pos]
+		switch {
+		case ch == '\'':
+			if err := t.standardString(); err != nil {
+				return err
+			}
+		case (ch == 'E' || ch == 'e') && t.peek(1) == '\'' && !t.afterIdentifier():
+			t.pos++
+			if err := t.escapeString(); err != nil {
+				return err
+			}
+		case ch == '"':
+			if err := t.quotedIdentifier(); err != nil {
+				return err
+			}
+		case ch == '$' && isDigit(t.peek(1)) && !t.afterIdentifier():
+			t.parameter()
+		case ch == '$' && !t.afterIdentifier():
+			ok, err := t.dollarString()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				t.out.WriteByte(ch)
+				t.pos++
+			}
+		case ch == '-' && t.peek(1) == '-':
+			end := strings.IndexByte(t.sql[t.pos:], '\n')
+			if end < 0 {
+				end = len(t.sql) - t.pos
+			}
+			// MySQL only reads -- as a comment when a space follows it, and
+			// PostgreSQL does not need one: --1 would become minus minus 1.
+			t.out.WriteString("--")
+			if c := t.peek(2); c != ' ' && c != '\t' && c != '\r' && c != '\n' && c != 0 {
+				t.out.WriteByte(' ')
+			}
+			t.out.WriteString(t.sql[t.pos+2 : t.pos+end])
+			t.pos += end
+		case ch == '/' && t.peek(1) == '*':
+			end := strings.Index(t.sql[t.pos+2:], "*/")
+			if end < 0 {
+				return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unterminated comment")
+			}
+			t.out.WriteString(t.sql[t.pos : t.pos+end+4])
+			t.pos += end + 4
+		case ch == ':' && t.peek(1) == ':':
+			t.pos += 2
+			t.skipCast()
+		case ch == ';':
+			t.endStatement()
+			t.pos++
+		case isIdentifierStart(ch):
+			t.word()
+		default:
+			t.out.WriteByte(ch)
+			t.pos++
+		}
+	}
+	t.endStatement()
+	return nil
+}
+
+func (t *translator) peek(n int) byte {
+	if t.pos+n < len(t.sql) {
+		return t.sql[t.pos+n]
+	}
+	return 0
+}
+
+// afterIdentifier returns true if the current character is part of a word.
+func (t *translator) afterIdentifier() bool {
+	return t.pos > 0 && isIdentifierChar(t.sql[t.pos-1])
+}
+
+func (t *translator) endStatement() {
+	if stmt := strings.TrimSpace(t.out.String()); stmt != "" {
+		t.stmts = append(t.stmts, stmt)
+	}
+	t.out.Reset()
+}
+
+// standardString copies a string in which backslashes have no special
+// meaning, escaping them for MySQL.
+func (t *translator) standardString() error {
+	t.out.WriteByte('\'')
+	for t.pos++; t.pos < len(t.sql); t.pos++ {
+		switch ch := t.sql[t.pos]; ch {
+		case '\\':
+			t.out.WriteString(`\\`)
+		case '\'':
+			if t.peek(1) == '\'' {
+				t.out.WriteString("''")
+				t.pos++
+				continue
+			}
+			t.out.WriteByte('\'')
+			t.pos++
+			return nil
+		default:
+			t.out.WriteByte(ch)
+		}
+	}
+	return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unterminated quoted string")
+}
+
+// escapeString copies an E” string, whose backslash escapes are the ones
+// of MySQL.
+func (t *translator) escapeString() error {
+	t.out.WriteByte('\'')
+	for t.pos++; t.pos < len(t.sql); t.pos++ {
+		switch ch := t.sql[t.pos]; ch {
+		case '\\':
+			t.out.WriteByte(ch)
+			if t.pos+1 < len(t.sql) {
+				t.pos++
+				t.out.WriteByte(t.sql[t.pos])
+			}
+		case '\'':
+			if t.peek(1) == '\'' {
+				t.out.WriteString("''")
+				t.pos++
+				continue
+			}
+			t.out.WriteByte('\'')
+			t.pos++
+			return nil
+		default:
+			t.out.WriteByte(ch)
+		}
+	}
+	return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unterminated quoted string")
+}
+
+func (t *translator) quotedIdentifier() error {
+	t.out.WriteByte('`')
+	for t.pos++; t.pos < len(t.sql); t.pos++ {
+		switch ch := t.sql[t.pos]; ch {
+		case '`':
+			t.out.WriteString("``")
+		case '"':
+			if t.peek(1) == '"' {
+				t.out.WriteByte('"')
+				t.pos++
+				continue
+			}
+			t.out.WriteByte('`')
+			t.pos++
+			return nil
+		default:
+			t.out.WriteByte(ch)
+		}
+	}
+	return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unterminated quoted identifier")
+}
+
+func (t *translator) parameter() {
+	start := t.pos + 1
+	end := start
+	for end < len(t.sql) && isDigit(t.sql[end]) {
+		end++
+	}
+	n, _ := strconv.Atoi(t.sql[start:end])
+	t.params = max(t.params, n)
+	t.out.WriteString(":v")
+	t.out.WriteString(t.sql[start:end])
+	t.pos = end
+}
+
+// dollarString copies a $tag$...$tag$ string as a MySQL string. It returns
+// false if the $ doesn't start such a string.
+func (t *translator) dollarString() (bool, error) {
+	end := t.pos + 1
+	for end < len(t.sql) && isIdentifierChar(t.sql[end]) && t.sql[end] != '$' {
+		end++
+	}
+	if end >= len(t.sql) || t.sql[end] != '$' || (end > t.pos+1 && isDigit(t.sql[t.pos+1])) {
+		return false, nil
+	}
+	tag := t.sql[t.pos : end+1]
+	body := t.sql[end+1:]
+	closing := strings.Index(body, tag)
+	if closing < 0 {
+		return false, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unterminated dollar-quoted string")
+	}
+	t.out.WriteByte('\'')
+	for _, ch := range []byte(body[:closing]) {
+		switch ch {
+		case '\\':
+			t.out.WriteString(`\\`)
+		case '\'':
+			t.out.WriteString("''")
+		default:
+			t.out.WriteByte(ch)
+		}
+	}
+	t.out.WriteByte('\'')
+	t.pos = end + 1 + closing + len(tag)
+	return true, nil
+}
+
+// skipCast skips the type of a ::type cast, including the multi-word type
+// names, modifiers and array brackets.
+func (t *translator) skipCast() {
+	t.skipSpaces()
+	name := t.skipWord()
+	switch name {
+	case "double":
+		t.skipWordIf("precision")
+	case "character", "bit":
+		t.skipWordIf("varying")
+	}
+	t.skipParens()
+	if name == "timestamp" || name == "time" {
+		if t.skipWordIf("with") || t.skipWordIf("without") {
+			t.skipWordIf("time")
+			t.skipWordIf("zone")
+		}
+	}
+	for t.peek(0) == '[' && t.peek(1) == ']' {
+		t.pos += 2
+	}
+}
+
+func (t *translator) skipSpaces() {
+	for t.pos < len(t.sql) && isSpace(t.sql[t.pos]) {
+		t.pos++
+	}
+}
+
+// skipWord skips a possibly qualified name, and returns it lower cased.
+func (t *translator) skipWord() string {
+	start := t.pos
+	for t.pos < len(t.sql) && (isIdentifierChar(t.sql[t.pos]) || t.sql[t.pos] == '.') {
+		t.pos++
+	}
+	return strings.ToLower(t.sql[start:t.pos])
+}
+
+// skipWordIf skips the next word if it is the given one.
+func (t *translator) skipWordIf(word string) bool {
+	start := t.pos
+	t.skipSpaces()
+	if t.skipWord() == word {
+		return true
+	}
+	t.pos = start
+	return false
+}
+
+func (t *translator) skipParens() {
+	start := t.pos
+	t.skipSpaces()
+	if t.peek(0) != '(' {
+		t.pos = start
+		return
+	}
+	if end := strings.IndexByte(t.sql[t.pos:], ')'); end >= 0 {
+		t.pos += end + 1
+		return
+	}
+	t.pos = start
+}
+
+func (t *translator) word() {
+	start := t.pos
+	for t.pos < len(t.sql) && isIdentifierChar(t.sql[t.pos]) {
+		t.pos++
+	}
+	word := t.sql[start:t.pos]
+	switch strings.ToLower(word) {
+	case "ilike":
+		t.out.WriteString("like")
+	case "current_database", "current_schema":
+		t.out.WriteString("database")
+		rest := t.pos
+		t.skipSpaces()
+		if t.peek(0) != '(' {
+			t.out.WriteString("()")
+		}
+		t.pos = rest
+	default:
+		t.out.WriteString(word)
+	}
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentifierStart(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch >= 0x80
+}
+
+func isIdentifierChar(ch byte) bool {
+	return isIdentifierStart(ch) || isDigit(ch) || ch == '$'
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f'
+}
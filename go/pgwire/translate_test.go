@@ -0,0 +1,87 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package pgwire
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslate(t *testing.T) {
+	testcases := []struct {
+		in     string
+		out    []string
+		params int
+	}{{
+		in:  "select 1",
+		out: []string{"select 1"},
+	}, {
+		in:  "select 1; select 2;",
+		out: []string{"select 1", "select 2"},
+	}, {
+		in:  " ; ",
+		out: nil,
+	}, {
+		in:     "select * from t where a = $1 and b = $12",
+		out:    []string{"select * from t where a = :v1 and b = :v12"},
+		params: 12,
+	}, {
+		in:  `select "Col" from "my""table"`,
+		out: []string{"select `Col` from `my\"table`"},
+	}, {
+		in:  `select 'a\b', 'it''s', 'x;y'`,
+		out: []string{`select 'a\\b', 'it''s', 'x;y'`},
+	}, {
+		in:  `select E'a\nb', e'\''`,
+		out: []string{`select 'a\nb', '\''`},
+	}, {
+		in:  `select $$it's \ $$, $tag$a$$b$tag$`,
+		out: []string{`select 'it''s \\ ', 'a$$b'`},
+	}, {
+		in:  "select a::int, b::character varying(10), c :: double precision, d::text[], e::timestamp with time zone from t",
+		out: []string{"select a, b, c , d, e from t"},
+	}, {
+		in:  "select * from t where name ILIKE 'a%'",
+		out: []string{"select * from t where name like 'a%'"},
+	}, {
+		in:  "select current_database(), current_schema",
+		out: []string{"select database(), database()"},
+	}, {
+		in:  "select 1 -- a; comment\n; /* b; */ select 2",
+		out: []string{"select 1 -- a; comment", "/* b; */ select 2"},
+	}, {
+		in:  "select 1 --1",
+		out: []string{"select 1 -- 1"},
+	}, {
+		in:  "select * from t where a=1 --x\n or b=2 --",
+		out: []string{"select * from t where a=1 -- x\n or b=2 --"},
+	}, {
+		in:  "select a$1, e'x' from t",
+		out: []string{"select a$1, 'x' from t"},
+	}}
+	for _, tc := range testcases {
+		t.Run(tc.in, func(t *testing.T) {
+			out, params, err := Translate(tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, out)
+			assert.Equal(t, tc.params, params)
+		})
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	for _, in := range []string{
+		"select 'a",
+		`select "a`,
+		"select /* a",
+		"select $x$a",
+	} {
+		_, _, err := Translate(in)
+		assert.Error(t, err, in)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package pgwire
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// PostgreSQL type OIDs.
+const (
+	oidUnspecified = 0
+	oidBool        = 16
+	oidBytea       = 17
+	oidName        = 19
+	oidInt8        = 20
+	oidInt2        = 21
+	oidInt4        = 23
+	oidText        = 25
+	oidJSON        = 114
+	oidFloat4      = 700
+	oidFloat8      = 701
+	oidBpchar      = 1042
+	oidVarchar     = 1043
+	oidDate        = 1082
+	oidTime        = 1083
+	oidTimestamp   = 1114
+	oidNumeric     = 1700
+)
+
+// Format codes of parameters and result columns.
+const (
+	formatText   = 0
+	formatBinary = 1
+)
+
+// typeOID returns the PostgreSQL type that is the closest to a MySQL type.
+func typeOID(typ querypb.Type) uint32 {
+	switch typ {
+	case sqltypes.Int8, sqltypes.Uint8, sqltypes.Int16, sqltypes.Year:
+		return oidInt2
+	case sqltypes.Uint16, sqltypes.Int24, sqltypes.Uint24, sqltypes.Int32:
+		return oidInt4
+	case sqltypes.Uint32, sqltypes.Int64:
+		return oidInt8
+	case sqltypes.Uint64, sqltypes.Decimal:
+		return oidNumeric
+	case sqltypes.Float32:
+		return oidFloat4
+	case sqltypes.Float64:
+		return oidFloat8
+	case sqltypes.Timestamp, sqltypes.Datetime:
+		return oidTimestamp
+	case sqltypes.Date:
+		return oidDate
+	case sqltypes.Time:
+		return oidTime
+	case sqltypes.VarChar:
+		return oidVarchar
+	case sqltypes.Char:
+		return oidBpchar
+	case sqltypes.Blob, sqltypes.VarBinary, sqltypes.Binary, sqltypes.Bit, sqltypes.Geometry:
+		return oidBytea
+	case sqltypes.TypeJSON:
+		return oidJSON
+	default:
+		return oidText
+	}
+}
+
+// typeSize returns the size of a type, -1 for types of variable size.
+func typeSize(oid uint32) int16 {
+	switch oid {
+	case oidBool:
+		return 1
+	case oidInt2:
+		return 2
+	case oidInt4, oidFloat4, oidDate:
+		return 4
+	case oidInt8, oidFloat8, oidTime, oidTimestamp:
+		return 8
+	default:
+		return -1
+	}
+}
+
+// supportsBinary returns true if values of the type can be sent in the
+// binary format.
+func supportsBinary(oid uint32) bool {
+	switch oid {
+	case oidInt2, oidInt4, oidInt8, oidFloat4, oidFloat8, oidText, oidVarchar, oidBpchar, oidBytea, oidJSON:
+		return true
+	default:
+		return false
+	}
+}
+
+// appendValue appends a value of a column of the given type in the given
+// format.
+func appendValue(buf []byte, v sqltypes.Value, oid uint32, format int16) ([]byte, error) {
+	raw := v.Raw()
+	if format == formatText {
+		if oid == oidBytea {
+			n := len(buf) + 2
+			buf = append(buf, `\x`...)
+			buf = append(buf, make([]byte, hex.EncodedLen(len(raw)))...)
+			hex.Encode(buf[n:], raw)
+			return buf, nil
+		}
+		return append(buf, raw...), nil
+	}
+	switch oid {
+	case oidInt2, oidInt4, oidInt8:
+		n, err := strconv.ParseInt(string(raw), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch oid {
+		case oidInt2:
+			return binary.BigEndian.AppendUint16(buf, uint16(n)), nil
+		case oidInt4:
+			return binary.BigEndian.AppendUint32(buf, uint32(n)), nil
+		default:
+			return binary.BigEndian.AppendUint64(buf, uint64(n)), nil
+		}
+	case oidFloat4:
+		f, err := strconv.ParseFloat(string(raw), 32)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+	case oidFloat8:
+		f, err := strconv.ParseFloat(string(raw), 64)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case oidText, oidVarchar, oidBpchar, oidBytea, oidJSON:
+		return append(buf, raw...), nil
+	}
+	return nil, vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "binary format is not supported for type %d", oid)
+}
+
+// decodeParam returns the bind variable of a parameter of the given type
+// sent in the given format.
+func decodeParam(oid uint32, format int16, data []byte) (*querypb.BindVariable, error) {
+	if data == nil {
+		return sqltypes.NullBindVariable, nil
+	}
+	if format == formatText {
+		s := string(data)
+		switch oid {
+		case oidInt2, oidInt4, oidInt8:
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid integer parameter %q", s)
+			}
+			return sqltypes.Int64BindVariable(n), nil
+		case oidFloat4, oidFloat8:
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid float parameter %q", s)
+			}
+			return sqltypes.Float64BindVariable(f), nil
+		case oidBool:
+			return boolBindVariable(s)
+		case oidBytea:
+			if strings.HasPrefix(s, `\x`) {
+				b, err := hex.DecodeString(s[2:])
+				if err != nil {
+					return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid bytea parameter")
+				}
+				return sqltypes.BytesBindVariable(b), nil
+			}
+			return sqltypes.BytesBindVariable(data), nil
+		default:
+			return sqltypes.StringBindVariable(s), nil
+		}
+	}
+	switch oid {
+	case oidInt2:
+		if len(data) == 2 {
+			return sqltypes.Int64BindVariable(int64(int16(binary.BigEndian.Uint16(data)))), nil
+		}
+	case oidInt4:
+		if len(data) == 4 {
+			return sqltypes.Int64BindVariable(int64(int32(binary.BigEndian.Uint32(data)))), nil
+		}
+	case oidInt8:
+		if len(data) == 8 {
+			return sqltypes.Int64BindVariable(int64(binary.BigEndian.Uint64(data))), nil
+		}
+	case oidFloat4:
+		if len(data) == 4 {
+			return sqltypes.Float64BindVariable(float64(math.Float32frombits(binary.BigEndian.Uint32(data)))), nil
+		}
+	case oidFloat8:
+		if len(data) == 8 {
+			return sqltypes.Float64BindVariable(math.Float64frombits(binary.BigEndian.Uint64(data))), nil
+		}
+	case oidBool:
+		if len(data) == 1 {
+			return sqltypes.Int64BindVariable(int64(data[0])), nil
+		}
+	case oidBytea:
+		return sqltypes.BytesBindVariable(data), nil
+	case oidUnspecified, oidText, oidVarchar, oidBpchar, oidName, oidJSON:
+		return sqltypes.StringBindVariable(string(data)), nil
+	default:
+		return nil, vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "binary format is not supported for parameters of type %d", oid)
+	}
+	return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid binary parameter of type %d", oid)
+}
+
+func boolBindVariable(s string) (*querypb.BindVariable, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "t", "true", "y", "yes", "on", "1":
+		return sqltypes.Int64BindVariable(1), nil
+	case "f", "false", "n", "no", "off", "0":
+		return sqltypes.Int64BindVariable(0), nil
+	}
+	return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid boolean parameter %q", s)
+}
@@ -25,7 +25,7 @@ func (cached *Result) CachedSize(alloc bool) int64 {
 	}
 	size := int64(0)
 	if alloc {
-		size += int64(112)
+		size += int64(160)
 	}
 	// field Fields []*vitess.io/vitess/go/vt/proto/query.Field
 	{
@@ -50,6 +50,22 @@ func (cached *Result) CachedSize(alloc bool) int64 {
 	size += hack.RuntimeAllocSize(int64(len(cached.SessionStateChanges)))
 	// field Info string
 	size += hack.RuntimeAllocSize(int64(len(cached.Info)))
+	// field Warnings []*vitess.io/vitess/go/vt/proto/query.QueryWarning
+	{
+		size += hack.RuntimeAllocSize(int64(cap(cached.Warnings)) * int64(8))
+		for _, elem := range cached.Warnings {
+			size += elem.CachedSize(true)
+		}
+	}
+	// field rowBuffers [][]byte
+	{
+		size += hack.RuntimeAllocSize(int64(cap(cached.rowBuffers)) * int64(24))
+		for _, elem := range cached.rowBuffers {
+			{
+				size += hack.RuntimeAllocSize(int64(cap(elem)))
+			}
+		}
+	}
 	return size
 }
 func (cached *Value) CachedSize(alloc bool) int64 {
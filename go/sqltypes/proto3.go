@@ -17,6 +17,9 @@ limitations under the License.
 package sqltypes
 
 import (
+	"context"
+	"unsafe"
+
 	"google.golang.org/protobuf/proto"
 
 	"vitess.io/vitess/go/vt/vterrors"
@@ -27,13 +30,80 @@ import (
 // This file contains the proto3 conversion functions for the structures
 // defined here.
 
+type rowBuffersKey struct{}
+
+// WithRowBuffers returns a context telling the MySQL connections that the
+// results of the queries run with it are converted to proto3, so they record
+// the buffers of their rows, see Result.AppendRow.
+func WithRowBuffers(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rowBuffersKey{}, true)
+}
+
+// WantRowBuffers returns true if ctx was returned by WithRowBuffers.
+func WantRowBuffers(ctx context.Context) bool {
+	want, _ := ctx.Value(rowBuffersKey{}).(bool)
+	return want
+}
+
 // RowToProto3 converts []Value to proto3.
 func RowToProto3(row []Value) *querypb.Row {
+	return rowToProto3(row, nil)
+}
+
+// rowToProto3 converts row to proto3, reusing the values as the payload of
+// the row when they are laid out back to back in buf, see Result.AppendRow.
+func rowToProto3(row []Value, buf []byte) *querypb.Row {
 	result := &querypb.Row{}
+	if payload, ok := rowPayload(row, buf); ok {
+		result.Lengths = make([]int64, 0, len(row))
+		for _, c := range row {
+			if c.IsNull() {
+				result.Lengths = append(result.Lengths, -1)
+				continue
+			}
+			result.Lengths = append(result.Lengths, int64(c.Len()))
+		}
+		result.Values = payload
+		return result
+	}
 	_ = RowToProto3Inplace(row, result)
 	return result
 }
 
+// rowPayload returns the values of row concatenated without copying them,
+// which is possible when they are laid out back to back in buf, as the rows
+// read from MySQL are. The returned slice shares its memory with the values
+// and must not be modified.
+func rowPayload(row []Value, buf []byte) ([]byte, bool) {
+	if len(buf) == 0 {
+		return nil, false
+	}
+	// The values are checked to be within buf, so the payload is a slice of
+	// buf rather than of whatever memory happens to follow a value.
+	base := uintptr(unsafe.Pointer(&buf[0]))
+	start, end := -1, 0
+	for _, c := range row {
+		if len(c.val) == 0 {
+			continue
+		}
+		off := uintptr(unsafe.Pointer(&c.val[0])) - base
+		if off > uintptr(len(buf)) || uintptr(len(c.val)) > uintptr(len(buf))-off {
+			return nil, false
+		}
+		if start < 0 {
+			start, end = int(off), int(off)
+		}
+		if int(off) != end {
+			return nil, false
+		}
+		end += len(c.val)
+	}
+	if start < 0 {
+		return nil, false
+	}
+	return buf[start:end:end], true
+}
+
 // RowToProto3Inplace converts []Value to proto3 and stores the conversion in the provided Row
 func RowToProto3Inplace(row []Value, result *querypb.Row) int {
 	if result.Lengths == nil {
@@ -78,6 +148,20 @@ func RowsToProto3(rows [][]Value) []*querypb.Row {
 	return result
 }
 
+// resultRowsToProto3 converts the rows of qr to proto3, like RowsToProto3,
+// using the buffers recorded by Result.AppendRow.
+func resultRowsToProto3(qr *Result) []*querypb.Row {
+	if len(qr.Rows) == 0 {
+		return nil
+	}
+
+	result := make([]*querypb.Row, len(qr.Rows))
+	for i, r := range qr.Rows {
+		result[i] = rowToProto3(r, qr.rowBuffer(i))
+	}
+	return result
+}
+
 // proto3ToRows converts a proto3 rows to [][]Value. The function is private
 // because it uses the trusted API.
 func proto3ToRows(fields []*querypb.Field, rows []*querypb.Row) [][]Value {
@@ -103,9 +187,10 @@ func ResultToProto3(qr *Result) *querypb.QueryResult {
 		Fields:              qr.Fields,
 		RowsAffected:        qr.RowsAffected,
 		InsertId:            qr.InsertID,
-		Rows:                RowsToProto3(qr.Rows),
+		Rows:                resultRowsToProto3(qr),
 		Info:                qr.Info,
 		SessionStateChanges: qr.SessionStateChanges,
+		Warnings:            qr.Warnings,
 	}
 }
 
@@ -122,6 +207,7 @@ func Proto3ToResult(qr *querypb.QueryResult) *Result {
 		Rows:                proto3ToRows(qr.Fields, qr.Rows),
 		Info:                qr.Info,
 		SessionStateChanges: qr.SessionStateChanges,
+		Warnings:            qr.Warnings,
 	}
 }
 
@@ -139,6 +225,7 @@ func CustomProto3ToResult(fields []*querypb.Field, qr *querypb.QueryResult) *Res
 		Rows:                proto3ToRows(fields, qr.Rows),
 		Info:                qr.Info,
 		SessionStateChanges: qr.SessionStateChanges,
+		Warnings:            qr.Warnings,
 	}
 }
 
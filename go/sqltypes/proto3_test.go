@@ -51,6 +51,7 @@ func TestResult(t *testing.T) {
 			NULL,
 			NULL,
 		}},
+		Warnings: []*querypb.QueryWarning{{Level: "Note", Code: 1051, Message: "Unknown table 'test.t'"}},
 	}
 	p3Result := &querypb.QueryResult{
 		Fields:       fields,
@@ -63,6 +64,7 @@ func TestResult(t *testing.T) {
 			Lengths: []int64{2, -1, -1},
 			Values:  []byte("bb"),
 		}},
+		Warnings: []*querypb.QueryWarning{{Level: "Note", Code: 1051, Message: "Unknown table 'test.t'"}},
 	}
 	p3converted := ResultToProto3(sqlResult)
 	if !proto.Equal(p3converted, p3Result) {
@@ -320,3 +322,69 @@ func TestProto3ValuesEqual(t *testing.T) {
 		require.Equal(t, tc.expected, Proto3ValuesEqual(tc.v1, tc.v2))
 	}
 }
+
+func TestResultToProto3RowBuffers(t *testing.T) {
+	buf := []byte("1abcxyz")
+	row := []Value{
+		MakeTrusted(Int64, buf[0:1:1]),
+		NULL,
+		MakeTrusted(VarChar, buf[1:4:4]),
+		MakeTrusted(VarChar, buf[4:4:4]),
+		MakeTrusted(VarChar, buf[4:7:7]),
+	}
+	want := &querypb.Row{
+		Lengths: []int64{1, -1, 3, 0, 3},
+		Values:  []byte("1abcxyz"),
+	}
+	// values back to back but with no buffer recorded are copied.
+	got := RowToProto3(row)
+	require.True(t, proto.Equal(want, got))
+	require.NotSame(t, &buf[0], &got.Values[0])
+	qr := &Result{Rows: []Row{row}}
+	got = ResultToProto3(qr).Rows[0]
+	require.True(t, proto.Equal(want, got))
+	require.NotSame(t, &buf[0], &got.Values[0])
+
+	qr = &Result{}
+	qr.AppendRow(row, buf)
+	got = ResultToProto3(qr).Rows[0]
+	require.True(t, proto.Equal(want, got))
+	// the values are not copied.
+	require.Same(t, &buf[0], &got.Values[0])
+	require.Equal(t, len(got.Values), cap(got.Values))
+	// nor are the ones of a part of the row.
+	got = rowToProto3(row[2:], buf)
+	require.True(t, proto.Equal(&querypb.Row{Lengths: []int64{3, 0, 3}, Values: []byte("abcxyz")}, got))
+	require.Same(t, &buf[1], &got.Values[0])
+
+	// the buffers stay with their rows.
+	other := []byte("2")
+	qr = &Result{Rows: []Row{{MakeTrusted(Int64, other)}}}
+	qr.AppendRow(row, buf)
+	qr.AppendRow(Row{MakeTrusted(Int64, other)}, other)
+	rows := ResultToProto3(qr).Rows
+	require.NotSame(t, &other[0], &rows[0].Values[0])
+	require.Same(t, &buf[0], &rows[1].Values[0])
+	require.Same(t, &other[0], &rows[2].Values[0])
+	qr.Rows = qr.Rows[:0]
+	qr.AppendRow(row, buf)
+	rows = ResultToProto3(qr).Rows
+	require.Len(t, rows, 1)
+	require.Same(t, &buf[0], &rows[0].Values[0])
+
+	// values that are not back to back in the buffer are copied.
+	row[4] = MakeTrusted(VarChar, []byte("xyz"))
+	got = rowToProto3(row, buf)
+	require.True(t, proto.Equal(want, got))
+	require.NotSame(t, &buf[0], &got.Values[0])
+	row[4] = MakeTrusted(VarChar, buf[5:7:7])
+	got = rowToProto3(row, buf)
+	require.True(t, proto.Equal(&querypb.Row{Lengths: []int64{1, -1, 3, 0, 2}, Values: []byte("1abcyz")}, got))
+	require.NotSame(t, &buf[0], &got.Values[0])
+
+	// nor are the values past the buffer.
+	row[4] = MakeTrusted(VarChar, buf[4:7:7])
+	got = rowToProto3(row, buf[:6])
+	require.True(t, proto.Equal(want, got))
+	require.NotSame(t, &buf[0], &got.Values[0])
+}
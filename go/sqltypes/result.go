@@ -33,13 +33,21 @@ import (
 
 // Result represents a query result.
 type Result struct {
-	Fields              []*querypb.Field `json:"fields"`
-	RowsAffected        uint64           `json:"rows_affected"`
-	InsertID            uint64           `json:"insert_id"`
-	Rows                []Row            `json:"rows"`
-	SessionStateChanges string           `json:"session_state_changes"`
-	StatusFlags         uint16           `json:"status_flags"`
-	Info                string           `json:"info"`
+	Fields              []*querypb.Field        `json:"fields"`
+	RowsAffected        uint64                  `json:"rows_affected"`
+	InsertID            uint64                  `json:"insert_id"`
+	Rows                []Row                   `json:"rows"`
+	SessionStateChanges string                  `json:"session_state_changes"`
+	StatusFlags         uint16                  `json:"status_flags"`
+	Info                string                  `json:"info"`
+	Warnings            []*querypb.QueryWarning `json:"warnings"`
+
+	// rowBuffers holds, for the rows added by AppendRow, the buffer the
+	// values of the row were copied to. It is indexed like Rows, and a nil
+	// buffer stands for a row added directly to Rows. A buffer is only reused
+	// while the values of its row are still laid out in it, so the rows that
+	// are changed or moved afterwards are copied as usual.
+	rowBuffers [][]byte
 }
 
 //goland:noinspection GoUnusedConst
@@ -101,6 +109,12 @@ func (result *Result) Copy() *Result {
 		StatusFlags:         result.StatusFlags,
 		Info:                result.Info,
 	}
+	if result.Warnings != nil {
+		out.Warnings = make([]*querypb.QueryWarning, len(result.Warnings))
+		for i, w := range result.Warnings {
+			out.Warnings[i] = proto.Clone(w).(*querypb.QueryWarning)
+		}
+	}
 	if result.Fields != nil {
 		out.Fields = make([]*querypb.Field, len(result.Fields))
 		for i, f := range result.Fields {
@@ -125,6 +139,7 @@ func (result *Result) ShallowCopy() *Result {
 		Info:                result.Info,
 		SessionStateChanges: result.SessionStateChanges,
 		Rows:                result.Rows,
+		Warnings:            result.Warnings,
 	}
 }
 
@@ -341,6 +356,30 @@ func (result *Result) AppendResult(src *Result) {
 	// Since sharding is not supported, the only mysqld accepting writes is the leader.
 	// We can just append the session state changes.
 	result.SessionStateChanges = src.SessionStateChanges
+	result.Warnings = append(result.Warnings, src.Warnings...)
+}
+
+// AppendRow appends row to the rows of result and records buf as the buffer
+// the values of row were copied to back to back, which lets ResultToProto3
+// reuse it as the payload of the row instead of copying the values again.
+func (result *Result) AppendRow(row Row, buf []byte) {
+	if n := len(result.Rows); len(result.rowBuffers) > n {
+		result.rowBuffers = result.rowBuffers[:n]
+	} else {
+		for len(result.rowBuffers) < n {
+			result.rowBuffers = append(result.rowBuffers, nil)
+		}
+	}
+	result.Rows = append(result.Rows, row)
+	result.rowBuffers = append(result.rowBuffers, buf)
+}
+
+// rowBuffer returns the buffer recorded by AppendRow for the i-th row, if any.
+func (result *Result) rowBuffer(i int) []byte {
+	if i < len(result.rowBuffers) {
+		return result.rowBuffers[i]
+	}
+	return nil
 }
 
 // Named returns a NamedResult based on this struct
@@ -62,6 +62,7 @@ func TestCopy(t *testing.T) {
 			{TestValue(Int64, "2"), MakeTrusted(VarChar, nil)},
 			{TestValue(Int64, "3"), TestValue(VarChar, "")},
 		},
+		Warnings: []*querypb.QueryWarning{{Level: "Warning", Code: 1265, Message: "Data truncated"}},
 	}
 	out := in.Copy()
 	utils.MustMatch(t, in, out)
@@ -0,0 +1,154 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package sync2
+
+import (
+	"context"
+	"sync"
+)
+
+// ByteBudget is a weighted semaphore measured in bytes. It is used to bound
+// the amount of memory held by in-flight stream results: producers Acquire
+// the size of a result before handing it to a (possibly slow) consumer and
+// Release it once the consumer is done, so a slow reader blocks the producer
+// instead of letting buffers pile up.
+//
+// A capacity <= 0 disables the budget: Acquire never blocks and only the
+// in-use accounting is kept.
+type ByteBudget struct {
+	mu       sync.Mutex
+	capacity int64
+	inUse    int64
+	waiters  int64
+	// changed is closed and replaced every time bytes are released,
+	// waking up every blocked Acquire so it can re-check the budget.
+	changed chan struct{}
+}
+
+// NewByteBudget creates a ByteBudget with the given capacity in bytes.
+func NewByteBudget(capacity int64) *ByteBudget {
+	return &ByteBudget{
+		capacity: capacity,
+		changed:  make(chan struct{}),
+	}
+}
+
+// Acquire reserves n bytes, blocking until enough bytes are available or
+// ctx is done. A single request that is larger than the whole capacity is
+// admitted once nothing else is in use, so oversized results still make
+// progress instead of dead-locking.
+// It returns waited=true if the caller had to block.
+func (bb *ByteBudget) Acquire(ctx context.Context, n int64) (waited bool, err error) {
+	bb.mu.Lock()
+	for {
+		if bb.capacity <= 0 || bb.inUse == 0 || bb.inUse+n <= bb.capacity {
+			bb.inUse += n
+			bb.mu.Unlock()
+			return waited, nil
+		}
+		waited = true
+		changed := bb.changed
+		bb.waiters++
+		bb.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			bb.mu.Lock()
+			bb.waiters--
+			bb.mu.Unlock()
+			return waited, ctx.Err()
+		}
+
+		bb.mu.Lock()
+		bb.waiters--
+	}
+}
+
+// TryAcquire reserves n bytes if they are available, following the rules of
+// Acquire, and returns false instead of blocking if they are not.
+func (bb *ByteBudget) TryAcquire(n int64) bool {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	if bb.capacity <= 0 || bb.inUse == 0 || bb.inUse+n <= bb.capacity {
+		bb.inUse += n
+		return true
+	}
+	return false
+}
+
+// acquireAlways reserves n bytes whatever the capacity.
+func (bb *ByteBudget) acquireAlways(n int64) {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	bb.inUse += n
+}
+
+// acquireOrWait reserves n bytes if they are available, following the rules
+// of Acquire. If they are not, it returns a channel which is closed once bytes
+// are released, or the capacity changed: the caller is one of the waiters
+// until it calls stopWaiting.
+func (bb *ByteBudget) acquireOrWait(n int64) (bool, chan struct{}) {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	if bb.capacity <= 0 || bb.inUse == 0 || bb.inUse+n <= bb.capacity {
+		bb.inUse += n
+		return true, nil
+	}
+	bb.waiters++
+	return false, bb.changed
+}
+
+// stopWaiting stops waiting after acquireOrWait.
+func (bb *ByteBudget) stopWaiting() {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	bb.waiters--
+}
+
+// Release returns n bytes to the budget and wakes up blocked callers.
+func (bb *ByteBudget) Release(n int64) {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	bb.inUse -= n
+	if bb.inUse < 0 {
+		bb.inUse = 0
+	}
+	if bb.waiters > 0 {
+		close(bb.changed)
+		bb.changed = make(chan struct{})
+	}
+}
+
+// SetCapacity changes the capacity. Blocked callers re-evaluate the new limit.
+func (bb *ByteBudget) SetCapacity(capacity int64) {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	bb.capacity = capacity
+	close(bb.changed)
+	bb.changed = make(chan struct{})
+}
+
+// Capacity returns the configured capacity in bytes.
+func (bb *ByteBudget) Capacity() int64 {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	return bb.capacity
+}
+
+// InUse returns the number of bytes currently acquired.
+func (bb *ByteBudget) InUse() int64 {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	return bb.inUse
+}
+
+// Waiters returns the number of callers currently blocked in Acquire.
+func (bb *ByteBudget) Waiters() int64 {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	return bb.waiters
+}
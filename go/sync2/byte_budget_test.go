@@ -0,0 +1,106 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package sync2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByteBudgetUnlimited(t *testing.T) {
+	bb := NewByteBudget(0)
+	waited, err := bb.Acquire(context.Background(), 1<<30)
+	assert.NoError(t, err)
+	assert.False(t, waited)
+	assert.EqualValues(t, 1<<30, bb.InUse())
+	bb.Release(1 << 30)
+	assert.EqualValues(t, 0, bb.InUse())
+}
+
+func TestByteBudgetBlocksUntilRelease(t *testing.T) {
+	bb := NewByteBudget(100)
+	_, err := bb.Acquire(context.Background(), 80)
+	assert.NoError(t, err)
+
+	acquired := make(chan bool)
+	go func() {
+		waited, err := bb.Acquire(context.Background(), 40)
+		assert.NoError(t, err)
+		acquired <- waited
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire should block while the budget is exhausted")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.EqualValues(t, 1, bb.Waiters())
+
+	bb.Release(80)
+	assert.True(t, <-acquired)
+	assert.EqualValues(t, 40, bb.InUse())
+	assert.EqualValues(t, 0, bb.Waiters())
+}
+
+func TestByteBudgetOversizedRequest(t *testing.T) {
+	bb := NewByteBudget(10)
+	// nothing in use: an oversized request must still be admitted.
+	waited, err := bb.Acquire(context.Background(), 50)
+	assert.NoError(t, err)
+	assert.False(t, waited)
+	bb.Release(50)
+}
+
+func TestByteBudgetContextDone(t *testing.T) {
+	bb := NewByteBudget(10)
+	_, err := bb.Acquire(context.Background(), 10)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	waited, err := bb.Acquire(ctx, 1)
+	assert.True(t, waited)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.EqualValues(t, 10, bb.InUse())
+	assert.EqualValues(t, 0, bb.Waiters())
+}
+
+func TestByteBudgetSetCapacity(t *testing.T) {
+	bb := NewByteBudget(10)
+	_, err := bb.Acquire(context.Background(), 10)
+	assert.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		_, err := bb.Acquire(context.Background(), 10)
+		assert.NoError(t, err)
+		close(acquired)
+	}()
+	for bb.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	bb.SetCapacity(20)
+	<-acquired
+	assert.EqualValues(t, 20, bb.Capacity())
+	assert.EqualValues(t, 20, bb.InUse())
+}
+
+func TestByteBudgetTryAcquire(t *testing.T) {
+	bb := NewByteBudget(100)
+	// An oversized request is admitted when nothing is in use.
+	assert.True(t, bb.TryAcquire(150))
+	assert.False(t, bb.TryAcquire(1))
+	bb.Release(150)
+
+	assert.True(t, bb.TryAcquire(60))
+	assert.True(t, bb.TryAcquire(40))
+	assert.False(t, bb.TryAcquire(1))
+	assert.EqualValues(t, 100, bb.InUse())
+	assert.EqualValues(t, 0, bb.Waiters())
+}
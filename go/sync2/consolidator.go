@@ -17,27 +17,47 @@ limitations under the License.
 package sync2
 
 import (
+	"hash/maphash"
 	"sync"
 	"sync/atomic"
 
 	"vitess.io/vitess/go/cache"
 )
 
+// consolidatorShards is the number of shards of the executing queries of a
+// Consolidator. Every query goes through the consolidator, so a single
+// mutex becomes contended at high rates of queries.
+const consolidatorShards = 64
+
 // Consolidator consolidates duplicate queries from executing simulaneously
 // and shares results between them.
 type Consolidator struct {
 	*ConsolidatorCache
 
+	seed   maphash.Seed
+	shards [consolidatorShards]consolidatorShard
+}
+
+// consolidatorShard holds the executing queries of a shard.
+type consolidatorShard struct {
 	mu      sync.Mutex
 	queries map[string]*Result
 }
 
 // NewConsolidator creates a new Consolidator
 func NewConsolidator() *Consolidator {
-	return &Consolidator{
-		queries:           make(map[string]*Result),
+	co := &Consolidator{
 		ConsolidatorCache: NewConsolidatorCache(1000),
+		seed:              maphash.MakeSeed(),
 	}
+	for i := range co.shards {
+		co.shards[i].queries = make(map[string]*Result)
+	}
+	return co
+}
+
+func (co *Consolidator) shard(query string) *consolidatorShard {
+	return &co.shards[maphash.String(co.seed, query)%consolidatorShards]
 }
 
 // Result is a wrapper for result of a query.
@@ -47,6 +67,7 @@ type Result struct {
 	// on acquiring a read lock (see Wait() below.)
 	executing    sync.RWMutex
 	consolidator *Consolidator
+	shard        *consolidatorShard
 	query        string
 	Result       any
 	Err          error
@@ -56,14 +77,15 @@ type Result struct {
 // lock on its Result if it is not already present. If the query is
 // a duplicate, Create returns false.
 func (co *Consolidator) Create(query string) (r *Result, created bool) {
-	co.mu.Lock()
-	defer co.mu.Unlock()
-	if r, ok := co.queries[query]; ok {
+	shard := co.shard(query)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if r, ok := shard.queries[query]; ok {
 		return r, false
 	}
-	r = &Result{consolidator: co, query: query}
+	r = &Result{consolidator: co, shard: shard, query: query}
 	r.executing.Lock()
-	co.queries[query] = r
+	shard.queries[query] = r
 	return r, true
 }
 
@@ -71,9 +93,9 @@ func (co *Consolidator) Create(query string) (r *Result, created bool) {
 // lock on its Result. Broadcast should be invoked when original
 // query completes execution.
 func (rs *Result) Broadcast() {
-	rs.consolidator.mu.Lock()
-	defer rs.consolidator.mu.Unlock()
-	delete(rs.consolidator.queries, rs.query)
+	rs.shard.mu.Lock()
+	defer rs.shard.mu.Unlock()
+	delete(rs.shard.queries, rs.query)
 	rs.executing.Unlock()
 }
 
@@ -17,7 +17,9 @@ limitations under the License.
 package sync2
 
 import (
+	"fmt"
 	"reflect"
+	"sync/atomic"
 	"testing"
 )
 
@@ -82,3 +84,16 @@ func TestConsolidator(t *testing.T) {
 	}
 
 }
+
+func BenchmarkConsolidatorParallel(b *testing.B) {
+	con := NewConsolidator()
+	var id atomic.Int64
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		sql := fmt.Sprintf("select * from SomeTable where id = %d", id.Add(1))
+		for pb.Next() {
+			r, _ := con.Create(sql)
+			r.Broadcast()
+		}
+	})
+}
@@ -0,0 +1,227 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package sync2
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var errStreamClosed = errors.New("the stream is closed")
+
+// StreamBuffer decouples the producer of a stream, like the reader of a MySQL
+// result, from its consumer, like a client reading the result: the producer
+// Sends the items of the stream and goes on producing while a goroutine of the
+// buffer hands them to the consumer, in order, until the buffered items reach
+// the capacity of the stream. A slow consumer then only blocks the producer of
+// its own stream.
+//
+// The bytes buffered by the streams are also charged against a budget shared
+// by all the streams, which caps their total: a stream that would exceed it
+// waits for the other streams to drain. A stream that buffers nothing is
+// admitted whatever the budget, so the streams always make progress and a slow
+// consumer never blocks the streams of the other consumers for more than what
+// their own stream buffers.
+//
+// A capacity <= 0 disables the buffering: Send hands the item to the consumer
+// itself, and returns once it is consumed.
+type StreamBuffer[T any] struct {
+	capacity int64
+	shared   *ByteBudget
+	send     func(item T, size int64) error
+
+	mu       sync.Mutex
+	queue    []streamItem[T]
+	buffered int64
+	err      error
+	closed   bool
+	running  bool
+	// changed is closed and replaced every time the buffered items change,
+	// waking up the producer and the sender.
+	changed chan struct{}
+	done    chan struct{}
+}
+
+type streamItem[T any] struct {
+	item T
+	size int64
+}
+
+// NewStreamBuffer creates the buffer of a stream of the given capacity in
+// bytes, which hands the items to send along with their size. shared, if
+// not nil, is the budget of all the streams.
+func NewStreamBuffer[T any](capacity int64, shared *ByteBudget, send func(item T, size int64) error) *StreamBuffer[T] {
+	return &StreamBuffer[T]{
+		capacity: capacity,
+		shared:   shared,
+		send:     send,
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Send buffers item, of size bytes, blocking while the stream or the shared
+// budget are full, until ctx is done. It returns waited=true if it had to
+// block, and the error of the consumer once one of the items failed to be
+// sent, the later items being dropped.
+func (sb *StreamBuffer[T]) Send(ctx context.Context, item T, size int64) (waited bool, err error) {
+	if sb.capacity <= 0 {
+		return sb.sendNow(item, size)
+	}
+	sb.mu.Lock()
+	for {
+		if sb.err != nil || sb.closed {
+			err := sb.err
+			sb.mu.Unlock()
+			if err == nil {
+				err = errStreamClosed
+			}
+			return waited, err
+		}
+		if sb.buffered == 0 {
+			if sb.shared != nil {
+				sb.shared.acquireAlways(size)
+			}
+			break
+		}
+		var shared chan struct{}
+		if sb.buffered+size <= sb.capacity {
+			if sb.shared == nil {
+				break
+			}
+			var ok bool
+			if ok, shared = sb.shared.acquireOrWait(size); ok {
+				break
+			}
+		}
+		waited = true
+		changed := sb.changed
+		sb.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-shared:
+		case <-ctx.Done():
+			if shared != nil {
+				sb.shared.stopWaiting()
+			}
+			return waited, ctx.Err()
+		}
+		if shared != nil {
+			sb.shared.stopWaiting()
+		}
+		sb.mu.Lock()
+	}
+	sb.queue = append(sb.queue, streamItem[T]{item: item, size: size})
+	sb.buffered += size
+	if !sb.running {
+		sb.running = true
+		go sb.run()
+	}
+	sb.notifyLocked()
+	sb.mu.Unlock()
+	return waited, nil
+}
+
+// sendNow sends item in the goroutine of the producer, the stream buffering
+// nothing else.
+func (sb *StreamBuffer[T]) sendNow(item T, size int64) (bool, error) {
+	sb.mu.Lock()
+	if sb.err != nil {
+		err := sb.err
+		sb.mu.Unlock()
+		return false, err
+	}
+	sb.buffered += size
+	sb.mu.Unlock()
+	if sb.shared != nil {
+		sb.shared.acquireAlways(size)
+		defer sb.shared.Release(size)
+	}
+	err := sb.send(item, size)
+	sb.mu.Lock()
+	sb.buffered -= size
+	if err != nil {
+		sb.err = err
+	}
+	sb.mu.Unlock()
+	return false, err
+}
+
+// run hands the buffered items to the consumer until the buffer is closed
+// and drained.
+func (sb *StreamBuffer[T]) run() {
+	defer close(sb.done)
+	sb.mu.Lock()
+	for {
+		if len(sb.queue) == 0 {
+			if sb.closed {
+				sb.mu.Unlock()
+				return
+			}
+			changed := sb.changed
+			sb.mu.Unlock()
+			<-changed
+			sb.mu.Lock()
+			continue
+		}
+		next := sb.queue[0]
+		sb.queue[0] = streamItem[T]{}
+		sb.queue = sb.queue[1:]
+		failed := sb.err != nil
+		sb.mu.Unlock()
+
+		var err error
+		if !failed {
+			err = sb.send(next.item, next.size)
+		}
+		if sb.shared != nil {
+			sb.shared.Release(next.size)
+		}
+
+		sb.mu.Lock()
+		sb.buffered -= next.size
+		if err != nil && sb.err == nil {
+			sb.err = err
+		}
+		sb.notifyLocked()
+	}
+}
+
+func (sb *StreamBuffer[T]) notifyLocked() {
+	close(sb.changed)
+	sb.changed = make(chan struct{})
+}
+
+// Close waits for the buffered items to be sent, and returns the error of the
+// consumer if one of them failed. The stream can't be sent to anymore.
+func (sb *StreamBuffer[T]) Close() error {
+	sb.mu.Lock()
+	sb.closed = true
+	running := sb.running
+	sb.notifyLocked()
+	sb.mu.Unlock()
+	if running {
+		<-sb.done
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.err
+}
+
+// Buffered returns the bytes of the items buffered and not consumed yet,
+// including the one the consumer is being handed.
+func (sb *StreamBuffer[T]) Buffered() int64 {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buffered
+}
+
+// Capacity returns the capacity of the stream in bytes.
+func (sb *StreamBuffer[T]) Capacity() int64 {
+	return sb.capacity
+}
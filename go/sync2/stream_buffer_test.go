@@ -0,0 +1,134 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package sync2
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamBufferSendsInOrder(t *testing.T) {
+	var got []int
+	sb := NewStreamBuffer[int](100, nil, func(item int, size int64) error {
+		got = append(got, item)
+		return nil
+	})
+	for i := 0; i < 10; i++ {
+		_, err := sb.Send(context.Background(), i, 30)
+		require.NoError(t, err)
+	}
+	require.NoError(t, sb.Close())
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, got)
+	assert.EqualValues(t, 0, sb.Buffered())
+}
+
+func TestStreamBufferBlocksOnItsCapacity(t *testing.T) {
+	consume := make(chan struct{})
+	sb := NewStreamBuffer[int](100, nil, func(item int, size int64) error {
+		<-consume
+		return nil
+	})
+	// The first item is handed to the consumer, the second one is buffered.
+	_, err := sb.Send(context.Background(), 1, 60)
+	require.NoError(t, err)
+	_, err = sb.Send(context.Background(), 2, 40)
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, sb.Buffered())
+
+	sent := make(chan bool)
+	go func() {
+		waited, err := sb.Send(context.Background(), 3, 10)
+		assert.NoError(t, err)
+		sent <- waited
+	}()
+	select {
+	case <-sent:
+		t.Fatal("Send should block while the stream is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	consume <- struct{}{}
+	assert.True(t, <-sent)
+	close(consume)
+	require.NoError(t, sb.Close())
+}
+
+func TestStreamBufferSharedBudget(t *testing.T) {
+	shared := NewByteBudget(100)
+	slow := make(chan struct{})
+	slowStream := NewStreamBuffer[int](1000, shared, func(item int, size int64) error {
+		<-slow
+		return nil
+	})
+	_, err := slowStream.Send(context.Background(), 1, 80)
+	require.NoError(t, err)
+	// The shared budget is full: the slow stream can't buffer more.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	waited, err := slowStream.Send(ctx, 2, 80)
+	assert.True(t, waited)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualValues(t, 0, shared.Waiters())
+
+	// A stream that buffers nothing isn't blocked by the slow one.
+	var fastGot []int
+	fastStream := NewStreamBuffer[int](1000, shared, func(item int, size int64) error {
+		fastGot = append(fastGot, item)
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		_, err := fastStream.Send(context.Background(), i, 50)
+		require.NoError(t, err)
+	}
+	require.NoError(t, fastStream.Close())
+	assert.Equal(t, []int{0, 1, 2}, fastGot)
+
+	close(slow)
+	require.NoError(t, slowStream.Close())
+	assert.EqualValues(t, 0, shared.InUse())
+}
+
+func TestStreamBufferConsumerError(t *testing.T) {
+	errClient := errors.New("client gone")
+	var got []int
+	sb := NewStreamBuffer[int](100, nil, func(item int, size int64) error {
+		got = append(got, item)
+		return errClient
+	})
+	_, err := sb.Send(context.Background(), 1, 10)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := sb.Send(context.Background(), 2, 10)
+		return errors.Is(err, errClient)
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(t, sb.Close(), errClient)
+	assert.Equal(t, []int{1}, got)
+
+	_, err = sb.Send(context.Background(), 3, 10)
+	assert.ErrorIs(t, err, errClient)
+}
+
+func TestStreamBufferUnbuffered(t *testing.T) {
+	shared := NewByteBudget(10)
+	var buffered int64
+	var sb *StreamBuffer[int]
+	sb = NewStreamBuffer[int](0, shared, func(item int, size int64) error {
+		buffered = sb.Buffered()
+		return nil
+	})
+	// The items are sent by Send itself, whatever the shared budget.
+	waited, err := sb.Send(context.Background(), 1, 50)
+	require.NoError(t, err)
+	assert.False(t, waited)
+	assert.EqualValues(t, 50, buffered)
+	assert.EqualValues(t, 0, sb.Buffered())
+	assert.EqualValues(t, 0, shared.InUse())
+	require.NoError(t, sb.Close())
+}
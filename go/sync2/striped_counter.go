@@ -0,0 +1,53 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package sync2
+
+import (
+	"math/bits"
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+)
+
+// StripedCounter is an int64 counter spread over one cache line per CPU, so
+// that goroutines updating it at the same time rarely write to the same
+// cache line. Go doesn't tell which CPU a goroutine runs on, so every Add
+// picks a random stripe. Get sums all the stripes: the value it returns is
+// exact when no Add runs concurrently, and a close approximation otherwise.
+type StripedCounter struct {
+	stripes []counterStripe
+	mask    uint32
+}
+
+type counterStripe struct {
+	n atomic.Int64
+	// padding keeps every stripe on its own cache line.
+	_ [56]byte
+}
+
+// NewStripedCounter returns a StripedCounter with a stripe per CPU, rounded
+// up to a power of two.
+func NewStripedCounter() *StripedCounter {
+	n := 1 << bits.Len(uint(runtime.GOMAXPROCS(0)-1))
+	return &StripedCounter{
+		stripes: make([]counterStripe, n),
+		mask:    uint32(n - 1),
+	}
+}
+
+// Add adds delta to the counter.
+func (sc *StripedCounter) Add(delta int64) {
+	sc.stripes[rand.Uint32()&sc.mask].n.Add(delta)
+}
+
+// Get returns the sum of all the stripes.
+func (sc *StripedCounter) Get() int64 {
+	var sum int64
+	for i := range sc.stripes {
+		sum += sc.stripes[i].n.Load()
+	}
+	return sum
+}
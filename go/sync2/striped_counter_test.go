@@ -0,0 +1,51 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package sync2
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripedCounter(t *testing.T) {
+	sc := NewStripedCounter()
+	assert.Zero(t, sc.Get())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				sc.Add(2)
+				sc.Add(-1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 8000, sc.Get())
+}
+
+func BenchmarkStripedCounterParallel(b *testing.B) {
+	sc := NewStripedCounter()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sc.Add(1)
+		}
+	})
+}
+
+func BenchmarkAtomicCounterParallel(b *testing.B) {
+	var n atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n.Add(1)
+		}
+	})
+}
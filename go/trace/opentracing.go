@@ -20,9 +20,11 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"strconv"
 
 	otgrpc "github.com/opentracing-contrib/go-grpc"
 	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
 	"google.golang.org/grpc"
 
 	"vitess.io/vitess/go/vt/vterrors"
@@ -124,6 +126,25 @@ func (jf openTracingService) FromContext(ctx context.Context) (Span, bool) {
 	return openTracingSpan{otSpan: innerSpan}, true
 }
 
+// TraceID returns the ID of the trace of the span of a context, or "" if it
+// has none, or its tracer doesn't tell.
+func TraceID(ctx context.Context) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	switch sc := span.Context().(type) {
+	case jaeger.SpanContext:
+		if sc.TraceID().IsValid() {
+			return sc.TraceID().String()
+		}
+	case interface{ TraceID() uint64 }:
+		// The span contexts of datadog.
+		return strconv.FormatUint(sc.TraceID(), 10)
+	}
+	return ""
+}
+
 // NewContext is part of an interface implementation
 func (jf openTracingService) NewContext(parent context.Context, s Span) context.Context {
 	span, ok := s.(openTracingSpan)
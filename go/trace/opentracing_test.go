@@ -17,12 +17,14 @@ limitations under the License.
 package trace
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"testing"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
 )
 
 func TestExtractMapFromString(t *testing.T) {
@@ -47,3 +49,15 @@ func TestErrorConditions(t *testing.T) {
 	_, err = extractMapFromString("this is not base64") // malformed base64
 	assert.Error(t, err)
 }
+
+func TestTraceID(t *testing.T) {
+	assert.Empty(t, TraceID(context.Background()))
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+	span := tracer.StartSpan("test")
+	defer span.Finish()
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+	assert.Equal(t, span.Context().(jaeger.SpanContext).TraceID().String(), TraceID(ctx))
+	assert.NotEmpty(t, TraceID(ctx))
+}
@@ -24,6 +24,7 @@ package dbconnpool
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"vitess.io/vitess/go/mysql"
 	"vitess.io/vitess/go/sqltypes"
@@ -63,6 +64,17 @@ func (dbc *DBConnection) ExecuteFetch(query string, maxrows int, wantfields bool
 
 // ExecuteStreamFetch overwrites mysql.Conn.ExecuteStreamFetch.
 func (dbc *DBConnection) ExecuteStreamFetch(query string, callback func(*sqltypes.Result) error, alloc func() *sqltypes.Result, streamBufferSize int) error {
+	return dbc.executeStreamFetch(query, callback, alloc, newStreamChunker(streamBufferSize, false))
+}
+
+// ExecuteStreamFetchAdaptive is like ExecuteStreamFetch, but the number of
+// bytes sent for each stream call moves around streamBufferSize, depending
+// on how fast the client consumes the stream.
+func (dbc *DBConnection) ExecuteStreamFetchAdaptive(query string, callback func(*sqltypes.Result) error, alloc func() *sqltypes.Result, streamBufferSize int) error {
+	return dbc.executeStreamFetch(query, callback, alloc, newStreamChunker(streamBufferSize, true))
+}
+
+func (dbc *DBConnection) executeStreamFetch(query string, callback func(*sqltypes.Result) error, alloc func() *sqltypes.Result, chunker *streamChunker) error {
 
 	err := dbc.Conn.ExecuteStreamFetch(query)
 	if err != nil {
@@ -85,8 +97,9 @@ func (dbc *DBConnection) ExecuteStreamFetch(query string, callback func(*sqltype
 	// start with a pre-allocated array of 256 rows capacity
 	qr := alloc()
 	byteCount := 0
+	fetchStart := time.Now()
 	for {
-		row, err := dbc.FetchNext(nil)
+		row, buf, err := dbc.FetchNextRow(nil)
 		if err != nil {
 			dbc.handleError(err)
 			return err
@@ -94,16 +107,24 @@ func (dbc *DBConnection) ExecuteStreamFetch(query string, callback func(*sqltype
 		if row == nil {
 			break
 		}
-		qr.Rows = append(qr.Rows, row)
+		if buf != nil {
+			qr.AppendRow(row, buf)
+		} else {
+			qr.Rows = append(qr.Rows, row)
+		}
 		for _, s := range row {
 			byteCount += s.Len()
 		}
 
-		if byteCount >= streamBufferSize {
+		if chunker.full(byteCount) {
+			sendStart := time.Now()
 			err = callback(qr)
 			if err != nil {
 				return err
 			}
+			sendEnd := time.Now()
+			chunker.adapt(sendStart.Sub(fetchStart), sendEnd.Sub(sendStart))
+			fetchStart = sendEnd
 
 			qr = alloc()
 			byteCount = 0
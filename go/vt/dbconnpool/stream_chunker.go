@@ -0,0 +1,50 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package dbconnpool
+
+import "time"
+
+// streamChunkRange is how far an adaptive chunk size may move away from the
+// configured stream buffer size, in both directions.
+const streamChunkRange = 4
+
+// streamChunker decides how many bytes of rows ExecuteStreamFetch buffers
+// before sending them to the client. The budget is in bytes, so wide rows
+// are sent in chunks of few rows and narrow rows in chunks of many.
+//
+// An adaptive chunker also follows the pace of the client: as long as the
+// client consumes chunks faster than MySQL produces them, bigger chunks mean
+// fewer packets for the same rows. When the client is the one lagging
+// behind, buffering more rows only holds more memory, so chunks get smaller.
+type streamChunker struct {
+	size     int
+	min, max int
+}
+
+func newStreamChunker(size int, adaptive bool) *streamChunker {
+	sc := &streamChunker{size: size, min: size, max: size}
+	if adaptive {
+		sc.min = max(size/streamChunkRange, 1)
+		sc.max = size * streamChunkRange
+	}
+	return sc
+}
+
+// full returns true if the buffered rows must be sent.
+func (sc *streamChunker) full(byteCount int) bool {
+	return byteCount >= sc.size
+}
+
+// adapt adjusts the size of the next chunks after the last one took fetch
+// to be read from MySQL and send to be consumed by the client.
+func (sc *streamChunker) adapt(fetch, send time.Duration) {
+	switch {
+	case send > 2*fetch:
+		sc.size = max(sc.size/2, sc.min)
+	case 2*send < fetch:
+		sc.size = min(sc.size*2, sc.max)
+	}
+}
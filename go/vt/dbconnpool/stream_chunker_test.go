@@ -0,0 +1,41 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package dbconnpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamChunker(t *testing.T) {
+	fixed := newStreamChunker(1000, false)
+	fixed.adapt(time.Second, time.Millisecond)
+	assert.Equal(t, 1000, fixed.size)
+	fixed.adapt(time.Millisecond, time.Second)
+	assert.Equal(t, 1000, fixed.size)
+	assert.False(t, fixed.full(999))
+	assert.True(t, fixed.full(1000))
+
+	sc := newStreamChunker(1000, true)
+	// the client keeps up: chunks grow up to four times the buffer size.
+	for i := 0; i < 5; i++ {
+		sc.adapt(time.Second, time.Millisecond)
+	}
+	assert.Equal(t, 4000, sc.size)
+	// comparable paces don't change the size.
+	sc.adapt(time.Second, time.Second)
+	assert.Equal(t, 4000, sc.size)
+	// the client lags behind: chunks shrink down to a quarter of the buffer size.
+	sc.adapt(time.Millisecond, time.Second)
+	assert.Equal(t, 2000, sc.size)
+	for i := 0; i < 5; i++ {
+		sc.adapt(time.Millisecond, time.Second)
+	}
+	assert.Equal(t, 250, sc.size)
+	assert.True(t, sc.full(250))
+}
@@ -128,7 +128,7 @@ func init() {
 }
 
 func registerBackupEngineFlags(fs *pflag.FlagSet) {
-	fs.StringVar(&backupEngineImplementation, "backup_engine_implementation", backupEngineImplementation, "Specifies which implementation to use for creating new backups (builtin or xtrabackup). Restores will always be done with whichever engine created a given backup.")
+	fs.StringVar(&backupEngineImplementation, "backup_engine_implementation", backupEngineImplementation, "Specifies which implementation to use for creating new backups (builtin, xtrabackup or mysqldump). Restores will always be done with whichever engine created a given backup.")
 }
 
 // GetBackupEngine returns the BackupEngine implementation that should be used
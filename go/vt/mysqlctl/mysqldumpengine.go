@@ -0,0 +1,456 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqlescape"
+	vtenv "vitess.io/vitess/go/vt/env"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// MysqldumpEngine takes logical backups with mysqldump, and restores them by
+// replaying the dump with the mysql client. Unlike the builtin and xtrabackup
+// engines, the backup is portable across MySQL versions and the restore
+// doesn't replace the data directory, but loading a large dump is slow.
+//
+// The dump is a consistent snapshot (--single-transaction) taken while the
+// tablet is serving, with the GTID set of the snapshot (--set-gtid-purged),
+// which becomes the replication position of the backup.
+//
+// Incremental backups and restores are delegated to the builtin engine, which
+// takes them by copying binary logs.
+type MysqldumpEngine struct {
+}
+
+var (
+	// path where the mysqldump and mysql programs are located, VT_MYSQL_ROOT/bin by default
+	mysqldumpEnginePath string
+	// flags to pass through to mysqldump
+	mysqldumpBackupFlags string
+	mysqldumpUser        string
+)
+
+const (
+	mysqldumpEngineName = "mysqldump"
+	mysqldumpBinaryName = "mysqldump"
+	mysqlBinaryName     = "mysql"
+
+	// the GTID_PURGED statement is in the header of the dump
+	mysqldumpHeaderSize = 1024 * 1024
+)
+
+// systemDatabases are not dropped before a restore
+var systemDatabases = map[string]bool{
+	"information_schema": true,
+	"mysql":              true,
+	"performance_schema": true,
+	"sys":                true,
+}
+
+// mysqldumpBackupManifest represents a mysqldump backup.
+type mysqldumpBackupManifest struct {
+	// BackupManifest is an anonymous embedding of the base manifest struct.
+	BackupManifest
+	// CompressionEngine stores which compression engine was used to compress the dump,
+	// 'external' if it's compressed by the external compressor.
+	CompressionEngine string `json:",omitempty"`
+	// Name of the dump file
+	FileName string
+	// Params are the extra parameters that mysqldump was run with
+	Params string `json:"ExtraCommandLineParams"`
+	// SkipCompress is true if the dump was NOT compressed.
+	SkipCompress bool
+}
+
+func init() {
+	for _, cmd := range []string{"vtcombo", "vttablet", "vtbackup", "vttestserver", "vtctldclient"} {
+		servenv.OnParseFor(cmd, registerMysqldumpEngineFlags)
+	}
+}
+
+func registerMysqldumpEngineFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&mysqldumpEnginePath, "mysqldump_root_path", mysqldumpEnginePath, "Directory location of the mysqldump and mysql executables, e.g., /usr/bin. VT_MYSQL_ROOT/bin is used by default")
+	fs.StringVar(&mysqldumpBackupFlags, "mysqldump_backup_flags", mysqldumpBackupFlags, "Flags to pass to mysqldump. These should be space separated and will be added to the end of the command")
+	fs.StringVar(&mysqldumpUser, "mysqldump_user", mysqldumpUser, "User that mysqldump and mysql will use to connect to the database server through the socket. This user must have all necessary privileges to dump and load all databases.")
+}
+
+func (be *MysqldumpEngine) backupFileName() string {
+	fileName := "backup.sql"
+	if backupStorageCompress {
+		if ExternalCompressorCmd != "" {
+			fileName += ExternalCompressorExt
+		} else if ext, err := getExtensionFromEngine(CompressionEngineName); err != nil {
+			fileName += ".unknown"
+		} else {
+			fileName += ext
+		}
+	}
+	return fileName
+}
+
+// binaryPath returns the path of mysqldump or mysql.
+func (be *MysqldumpEngine) binaryPath(binary string) (string, error) {
+	if mysqldumpEnginePath != "" {
+		return path.Join(mysqldumpEnginePath, binary), nil
+	}
+	dir, err := vtenv.VtMysqlRoot()
+	if err != nil {
+		return "", err
+	}
+	return binaryPath(dir, binary)
+}
+
+// connectionFlags are the flags for mysqldump and mysql to connect to the local mysqld.
+func (be *MysqldumpEngine) connectionFlags(cnf *Mycnf) []string {
+	return []string{"--defaults-file=" + cnf.Path, "--socket=" + cnf.SocketFile, "--user=" + mysqldumpUser}
+}
+
+// ExecuteBackup returns a boolean that indicates if the backup is usable,
+// and an overall error.
+func (be *MysqldumpEngine) ExecuteBackup(ctx context.Context, params BackupParams, bh backupstorage.BackupHandle) (complete bool, finalErr error) {
+	if params.IncrementalFromPos != "" {
+		return BackupRestoreEngineMap[builtinBackupEngineName].ExecuteBackup(ctx, params, bh)
+	}
+	if mysqldumpUser == "" {
+		return false, vterrors.New(vtrpc.Code_INVALID_ARGUMENT, "mysqldumpUser must be specified.")
+	}
+	// an extension is required when using an external compressor
+	if backupStorageCompress && ExternalCompressorCmd != "" && ExternalCompressorExt == "" {
+		return false, vterrors.New(vtrpc.Code_INVALID_ARGUMENT,
+			"flag --external-compressor-extension not provided when using an external compressor")
+	}
+
+	// use a mysql connection to detect flavor at runtime
+	conn, err := params.Mysqld.GetDbaConnection(ctx)
+	if conn != nil && err == nil {
+		defer conn.Close()
+	}
+	if err != nil {
+		return false, vterrors.Wrap(err, "unable to obtain a connection to the database")
+	}
+	pos, err := conn.PrimaryPosition()
+	if err != nil {
+		return false, vterrors.Wrap(err, "unable to obtain primary position")
+	}
+	serverUUID, err := conn.GetServerUUID()
+	if err != nil {
+		return false, vterrors.Wrap(err, "can't get server uuid")
+	}
+	flavor := pos.GTIDSet.Flavor()
+
+	backupFileName := be.backupFileName()
+	params.Logger.Infof("backup file name: %s", backupFileName)
+
+	// As in the xtrabackup engine, dump in a separate function so the file is
+	// closed before we write the MANIFEST.
+	replicationPosition, err := be.backupFile(ctx, params, bh, backupFileName, flavor)
+	if err != nil {
+		return false, err
+	}
+
+	params.Logger.Infof("Writing backup MANIFEST")
+	mwc, err := bh.AddFile(ctx, backupManifestFileName, backupstorage.FileSizeUnknown)
+	if err != nil {
+		return false, vterrors.Wrapf(err, "cannot add %v to backup", backupManifestFileName)
+	}
+	defer closeFile(mwc, backupManifestFileName, params.Logger, &finalErr)
+
+	bm := &mysqldumpBackupManifest{
+		BackupManifest: BackupManifest{
+			BackupMethod: mysqldumpEngineName,
+			Position:     replicationPosition,
+			ServerUUID:   serverUUID,
+			TabletAlias:  params.TabletAlias,
+			Keyspace:     params.Keyspace,
+			Shard:        params.Shard,
+			BackupTime:   params.BackupTime.UTC().Format(time.RFC3339),
+			FinishedTime: time.Now().UTC().Format(time.RFC3339),
+		},
+		FileName:          backupFileName,
+		Params:            mysqldumpBackupFlags,
+		SkipCompress:      !backupStorageCompress,
+		CompressionEngine: CompressionEngineName,
+	}
+	data, err := json.MarshalIndent(bm, "", "  ")
+	if err != nil {
+		return false, vterrors.Wrapf(err, "cannot JSON encode %v", backupManifestFileName)
+	}
+	if _, err := mwc.Write(data); err != nil {
+		return false, vterrors.Wrapf(err, "cannot write %v", backupManifestFileName)
+	}
+
+	params.Logger.Infof("Backup completed")
+	return true, nil
+}
+
+func (be *MysqldumpEngine) backupFile(ctx context.Context, params BackupParams, bh backupstorage.BackupHandle, backupFileName, flavor string) (replicationPosition mysql.Position, finalErr error) {
+	backupProgram, err := be.binaryPath(mysqldumpBinaryName)
+	if err != nil {
+		return replicationPosition, err
+	}
+	flagsToExec := append(be.connectionFlags(params.Cnf),
+		"--all-databases",
+		"--single-transaction",
+		"--set-gtid-purged=ON",
+		"--routines",
+		"--events",
+		"--triggers",
+		"--hex-blob",
+		"--flush-privileges",
+	)
+	if mysqldumpBackupFlags != "" {
+		flagsToExec = append(flagsToExec, strings.Fields(mysqldumpBackupFlags)...)
+	}
+
+	file, err := bh.AddFile(ctx, backupFileName, backupstorage.FileSizeUnknown)
+	if err != nil {
+		return replicationPosition, vterrors.Wrapf(err, "cannot create backup file %v", backupFileName)
+	}
+	defer closeFile(file, backupFileName, params.Logger, &finalErr)
+
+	buffer := bufio.NewWriterSize(file, writerBufferSize)
+	writer := io.Writer(buffer)
+	var compressor io.WriteCloser
+	if backupStorageCompress {
+		if ExternalCompressorCmd != "" {
+			compressor, err = newExternalCompressor(ctx, ExternalCompressorCmd, writer, params.Logger)
+		} else {
+			compressor, err = newBuiltinCompressor(CompressionEngineName, writer, params.Logger)
+		}
+		if err != nil {
+			return replicationPosition, vterrors.Wrap(err, "can't create compressor")
+		}
+		writer = compressor
+	}
+
+	backupCmd := exec.CommandContext(ctx, backupProgram, flagsToExec...)
+	backupOut, err := backupCmd.StdoutPipe()
+	if err != nil {
+		return replicationPosition, vterrors.Wrap(err, "cannot create stdout pipe")
+	}
+	backupErr, err := backupCmd.StderrPipe()
+	if err != nil {
+		return replicationPosition, vterrors.Wrap(err, "cannot create stderr pipe")
+	}
+	if err := backupCmd.Start(); err != nil {
+		return replicationPosition, vterrors.Wrap(err, "unable to start mysqldump")
+	}
+	stderrWg := &sync.WaitGroup{}
+	stderrWg.Add(1)
+	go scanLinesToLogger("mysqldump stderr", backupErr, params.Logger, stderrWg.Done)
+
+	header := &headWriter{limit: mysqldumpHeaderSize}
+	if _, err := io.Copy(io.MultiWriter(writer, header), backupOut); err != nil {
+		return replicationPosition, vterrors.Wrap(err, "cannot copy output from mysqldump command")
+	}
+	stderrWg.Wait()
+	if err := backupCmd.Wait(); err != nil {
+		return replicationPosition, vterrors.Wrap(err, "mysqldump failed")
+	}
+
+	// Close compressor to flush it. After that all data is sent to the buffer.
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return replicationPosition, vterrors.Wrap(err, "cannot close compressor")
+		}
+	}
+	if err := buffer.Flush(); err != nil {
+		return replicationPosition, vterrors.Wrapf(err, "cannot flush destination: %v", backupFileName)
+	}
+
+	return findMysqldumpPosition(header.String(), flavor, params.Logger)
+}
+
+// ExecuteRestore restores from a backup. Any error is returned.
+// mysqld must be running, and it is shut down once the dump is loaded,
+// as the other engines leave it.
+func (be *MysqldumpEngine) ExecuteRestore(ctx context.Context, params RestoreParams, bh backupstorage.BackupHandle) (*BackupManifest, error) {
+	var bm mysqldumpBackupManifest
+	if err := getBackupManifestInto(ctx, bh, &bm); err != nil {
+		return nil, err
+	}
+	if bm.BackupMethod != mysqldumpEngineName {
+		// an incremental backup taken by the builtin engine
+		return BackupRestoreEngineMap[builtinBackupEngineName].ExecuteRestore(ctx, params, bh)
+	}
+	if mysqldumpUser == "" {
+		return nil, vterrors.New(vtrpc.Code_INVALID_ARGUMENT, "mysqldumpUser must be specified.")
+	}
+
+	// mark restore as in progress
+	if err := createStateFile(params.Cnf); err != nil {
+		return nil, err
+	}
+	if err := params.Mysqld.Wait(ctx, params.Cnf); err != nil {
+		return nil, err
+	}
+	if err := be.prepareToRestore(ctx, params); err != nil {
+		return nil, err
+	}
+
+	params.Logger.Infof("Restore: loading %v", bm.FileName)
+	if err := be.loadDump(ctx, params, bh, bm); err != nil {
+		// don't delete the state file here because that is how we detect an interrupted restore
+		return nil, err
+	}
+
+	params.Logger.Infof("Restore: shutdown mysqld")
+	if err := params.Mysqld.Shutdown(ctx, params.Cnf, true); err != nil {
+		return nil, err
+	}
+	params.Logger.Infof("Restore: returning replication position %v", bm.Position)
+	return &bm.BackupManifest, nil
+}
+
+// prepareToRestore resets replication, which clears the GTID set so the GTID_PURGED
+// of the dump can be set, and drops the existing databases if requested.
+func (be *MysqldumpEngine) prepareToRestore(ctx context.Context, params RestoreParams) error {
+	if err := params.Mysqld.SetSuperReadOnly(false); err != nil {
+		params.Logger.Warningf("Restore: unexpected error while trying to set super_read_only: %v", err)
+	}
+	if err := params.Mysqld.ResetReplication(ctx); err != nil {
+		return err
+	}
+	if params.DeleteBeforeRestore {
+		var queries []string
+		qr, err := params.Mysqld.FetchSuperQuery(ctx, "SHOW DATABASES")
+		if err != nil {
+			return err
+		}
+		for _, row := range qr.Rows {
+			if dbName := row[0].ToString(); !systemDatabases[dbName] {
+				params.Logger.Infof("Restore: dropping database %v", dbName)
+				queries = append(queries, "DROP DATABASE "+sqlescape.EscapeID(dbName))
+			}
+		}
+		return params.Mysqld.ExecuteSuperQueryList(ctx, queries)
+	}
+	return nil
+}
+
+func (be *MysqldumpEngine) loadDump(ctx context.Context, params RestoreParams, bh backupstorage.BackupHandle, bm mysqldumpBackupManifest) error {
+	restoreProgram, err := be.binaryPath(mysqlBinaryName)
+	if err != nil {
+		return err
+	}
+	file, err := bh.ReadFile(ctx, bm.FileName)
+	if err != nil {
+		return vterrors.Wrapf(err, "cannot open backup file %v", bm.FileName)
+	}
+	defer file.Close()
+
+	reader := io.Reader(file)
+	if !bm.SkipCompress {
+		var decompressor io.ReadCloser
+		switch {
+		case bm.CompressionEngine == ExternalCompressor && ExternalDecompressorCmd == "":
+			return fmt.Errorf("%w %q", errUnsupportedCompressionEngine, ExternalCompressor)
+		case bm.CompressionEngine == ExternalCompressor:
+			decompressor, err = newExternalDecompressor(ctx, ExternalDecompressorCmd, reader, params.Logger)
+		case bm.CompressionEngine == PargzipCompressor:
+			// pargzip doesn't support decompression
+			decompressor, err = newBuiltinDecompressor(PgzipCompressor, reader, params.Logger)
+		default:
+			decompressor, err = newBuiltinDecompressor(bm.CompressionEngine, reader, params.Logger)
+		}
+		if err != nil {
+			return vterrors.Wrap(err, "can't create decompressor")
+		}
+		defer func() {
+			if cerr := decompressor.Close(); cerr != nil {
+				params.Logger.Errorf("failed to close decompressor: %v", cerr)
+			}
+		}()
+		reader = decompressor
+	}
+
+	restoreCmd := exec.CommandContext(ctx, restoreProgram, be.connectionFlags(params.Cnf)...)
+	restoreCmd.Stdin = reader
+	restoreOut, err := restoreCmd.StdoutPipe()
+	if err != nil {
+		return vterrors.Wrap(err, "cannot create stdout pipe")
+	}
+	restoreErr, err := restoreCmd.StderrPipe()
+	if err != nil {
+		return vterrors.Wrap(err, "cannot create stderr pipe")
+	}
+	if err := restoreCmd.Start(); err != nil {
+		return vterrors.Wrap(err, "can't start mysql")
+	}
+	restoreWg := &sync.WaitGroup{}
+	restoreWg.Add(2)
+	go scanLinesToLogger("mysql stdout", restoreOut, params.Logger, restoreWg.Done)
+	go scanLinesToLogger("mysql stderr", restoreErr, params.Logger, restoreWg.Done)
+	restoreWg.Wait()
+	if err := restoreCmd.Wait(); err != nil {
+		return vterrors.Wrap(err, "loading the dump failed")
+	}
+	return nil
+}
+
+// headWriter keeps the first bytes written to it.
+type headWriter struct {
+	strings.Builder
+	limit int
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if remaining := w.limit - w.Len(); remaining > 0 {
+		if len(p) > remaining {
+			w.Builder.Write(p[:remaining])
+		} else {
+			w.Builder.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// e.g. SET @@GLOBAL.GTID_PURGED=/*!80000 '+'*/ 'uuid:1-5,\nuuid2:1-3';
+var mysqldumpReplicationPositionRegexp = regexp.MustCompile(`SET @@GLOBAL\.GTID_PURGED=(?:/\*!80000 '\+'\*/ )?'([^']*)'`)
+
+func findMysqldumpPosition(header, flavor string, logger logutil.Logger) (mysql.Position, error) {
+	match := mysqldumpReplicationPositionRegexp.FindStringSubmatch(header)
+	if match == nil {
+		return mysql.Position{}, vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "couldn't find GTID_PURGED in the mysqldump output")
+	}
+	position := strings.Join(strings.Fields(match[1]), "")
+	logger.Infof("Found position: %v", position)
+
+	replicationPosition, err := mysql.ParsePosition(flavor, position)
+	if err != nil {
+		return mysql.Position{}, vterrors.Wrapf(err, "can't parse replication position from mysqldump: %v", position)
+	}
+	return replicationPosition, nil
+}
+
+// ShouldDrainForBackup satisfies the BackupEngine interface
+// mysqldump dumps a consistent snapshot while the tablet is serving, hence false
+func (be *MysqldumpEngine) ShouldDrainForBackup() bool {
+	return false
+}
+
+func init() {
+	BackupRestoreEngineMap[mysqldumpEngineName] = &MysqldumpEngine{}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package mysqlctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/logutil"
+)
+
+func TestFindMysqldumpPosition(t *testing.T) {
+	header := `-- MySQL dump 10.13  Distrib 8.0.32, for Linux (x86_64)
+SET @MYSQLDUMP_TEMP_LOG_BIN = @@SESSION.SQL_LOG_BIN;
+SET @@SESSION.SQL_LOG_BIN= 0;
+
+--
+-- GTID state at the beginning of the backup
+--
+
+SET @@GLOBAL.GTID_PURGED=/*!80000 '+'*/ '145e508e-ae54-11e9-8ce6-46824dd1815e:1-3,
+1e51f8be-ae54-11e9-a7c6-4280a041109b:1-152981';
+
+--
+-- Current Database: ` + "`mysql`" + `
+--`
+	pos, err := findMysqldumpPosition(header, "MySQL56", logutil.NewConsoleLogger())
+	require.NoError(t, err)
+	assert.Equal(t, "145e508e-ae54-11e9-8ce6-46824dd1815e:1-3,1e51f8be-ae54-11e9-a7c6-4280a041109b:1-152981", pos.String())
+
+	// MySQL 5.7
+	pos, err = findMysqldumpPosition(`SET @@GLOBAL.GTID_PURGED='145e508e-ae54-11e9-8ce6-46824dd1815e:1-3';`, "MySQL56", logutil.NewConsoleLogger())
+	require.NoError(t, err)
+	assert.Equal(t, "145e508e-ae54-11e9-8ce6-46824dd1815e:1-3", pos.String())
+
+	_, err = findMysqldumpPosition("-- MySQL dump 10.13", "MySQL56", logutil.NewConsoleLogger())
+	assert.EqualError(t, err, "couldn't find GTID_PURGED in the mysqldump output")
+}
+
+func TestHeadWriter(t *testing.T) {
+	w := &headWriter{limit: 5}
+	n, err := w.Write([]byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = w.Write([]byte("defg"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	_, _ = w.Write([]byte("h"))
+	assert.Equal(t, "abcde", w.String())
+}
@@ -76,7 +76,7 @@ func (cached *QueryWarning) CachedSize(alloc bool) int64 {
 	}
 	size := int64(0)
 	if alloc {
-		size += int64(64)
+		size += int64(80)
 	}
 	// field unknownFields []byte
 	{
@@ -84,6 +84,8 @@ func (cached *QueryWarning) CachedSize(alloc bool) int64 {
 	}
 	// field Message string
 	size += hack.RuntimeAllocSize(int64(len(cached.Message)))
+	// field Level string
+	size += hack.RuntimeAllocSize(int64(len(cached.Level)))
 	return size
 }
 func (cached *Target) CachedSize(alloc bool) int64 {
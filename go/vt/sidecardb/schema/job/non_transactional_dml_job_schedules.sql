@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS mysql.non_transactional_dml_job_schedules
+(
+    `id`                              bigint unsigned  NOT NULL AUTO_INCREMENT,
+    `schedule_uuid`                   varchar(64)      NOT NULL UNIQUE,
+    `create_timestamp`                timestamp        NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `cron_expression`                 varchar(256)     NOT NULL,
+    `cron_time_zone`                  varchar(16)      NOT NULL,
+    `status`                          varchar(128)     NOT NULL,
+    `message`                         varchar(2048)    NULL     DEFAULT NULL,
+    `dml_sql`                         text             NOT NULL,
+    `table_schema`                    varchar(256)     NOT NULL,
+    `table_name`                      varchar(256)     NOT NULL,
+    `batch_interval_in_ms`            bigint           NOT NULL,
+    `batch_size`                      bigint           NOT NULL,
+    `fail_policy`                     varchar(64)      NOT NULL,
+    `throttle_duration`               varchar(256)     NULL     DEFAULT NULL,
+    `throttle_ratio`                  varchar(256)     NULL     DEFAULT NULL,
+    `running_time_period_start`       varchar(64)      NULL     DEFAULT NULL,
+    `running_time_period_end`         varchar(64)      NULL     DEFAULT NULL,
+    `running_time_period_time_zone`   varchar(16)      NULL     DEFAULT NULL,
+    `next_run_time`                   datetime         NULL     DEFAULT NULL,
+    `last_run_time`                   datetime         NULL     DEFAULT NULL,
+    `last_job_uuid`                   varchar(64)      NULL     DEFAULT NULL,
+    `run_count`                       bigint unsigned  NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY `status_idx` (`status`)
+) ENGINE = InnoDB;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS mysql.wescale_filter_version
+(
+    `id`               bigint unsigned NOT NULL AUTO_INCREMENT,
+    `create_timestamp` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `name`             varchar(256) NOT NULL,
+    `version`          bigint unsigned NOT NULL,
+    `operation`        varchar(32) NOT NULL COMMENT 'create, update, delete or rollback',
+    `changed_by`       varchar(256) NOT NULL DEFAULT '',
+    `definition`       text COMMENT 'JSON of the filter, NULL when it was deleted',
+    `rollback_to`      bigint unsigned DEFAULT NULL COMMENT 'the version a rollback restored',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY (`name`, `version`)
+) ENGINE = InnoDB;
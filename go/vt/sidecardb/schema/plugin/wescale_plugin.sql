@@ -13,11 +13,20 @@ CREATE TABLE IF NOT EXISTS mysql.wescale_plugin
     `query_template`                  text,
     `request_ip_regex`                varchar(64),
     `user_regex`                      varchar(64),
+    `workload_class_regex`            varchar(64),
     `leading_comment_regex`           text,
     `trailing_comment_regex`          text,
     `bind_var_conds`                  text,
     `action`                          varchar(64) NOT NULL COMMENT 'CONTINUE, FAIL',
     `action_args`                     text,
+    `schedule`                        text COMMENT 'JSON activation schedule, with a cron expression or daily windows and a time zone',
+    `outcome_conds`                   text COMMENT 'JSON post execution conditions, with a min_latency, min_rows or error_codes',
+    `request_cidrs`                   text COMMENT 'JSON list of the CIDR ranges the client IP is matched against, the ones starting with ! excluded',
+    `user_groups`                     text COMMENT 'JSON list of the groups of mysql.wescale_user_group the user is matched against',
+    `in_transaction`                  tinyint COMMENT '1 to match the queries in an explicit transaction, 0 the other ones, like the autocommit ones, NULL both',
+    `query_digest`                    varchar(64) COMMENT 'The digest of the normalized queries to match, like the ${digest} of the FAIL messages',
+    `expires_at`                      datetime COMMENT 'The UTC time the filter expires at, when it stops matching and the primary tablets delete it, NULL never',
+    `access_conds`                    text COMMENT 'JSON conditions on the EXPLAIN of the queries, with a full_scan, no_index or min_estimated_rows',
     PRIMARY KEY (`id`),
     UNIQUE KEY (`name`)
 ) ENGINE = InnoDB;
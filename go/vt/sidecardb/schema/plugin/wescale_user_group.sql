@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS mysql.wescale_user_group
+(
+    `group_name`       varchar(256) NOT NULL,
+    `user`             varchar(256) NOT NULL,
+    `create_timestamp` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`group_name`, `user`)
+) ENGINE = InnoDB;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS mysql.wescale_wasm_plugin
+(
+    `id`               bigint unsigned NOT NULL AUTO_INCREMENT,
+    `create_timestamp` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `update_timestamp` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    `name`             varchar(256) NOT NULL,
+    `version`          varchar(64) NOT NULL,
+    `description`      text,
+    `metadata`         text COMMENT 'JSON object of strings',
+    `checksum`         varchar(64) NOT NULL COMMENT 'SHA-256 of wasm_binary, in hex',
+    `size`             bigint unsigned NOT NULL,
+    `is_current`       tinyint NOT NULL DEFAULT 0 COMMENT 'the version the references without a version use',
+    `wasm_binary`      longblob NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY (`name`, `version`)
+) ENGINE = InnoDB;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS mysql.wescale_sequences
+(
+    `name`             varchar(256) NOT NULL COMMENT 'The name of the sequence, qualified by its database',
+    `next_id`          bigint NOT NULL DEFAULT 1 COMMENT 'The first value that was not allocated to a tablet yet',
+    `cache`            bigint NOT NULL DEFAULT 1000 COMMENT 'The number of values the tablets allocate at once',
+    `create_timestamp` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `update_timestamp` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (`name`)
+) ENGINE = InnoDB;
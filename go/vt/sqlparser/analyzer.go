@@ -79,7 +79,7 @@ func ASTToStatementType(stmt Statement) StatementType {
 		return StmtDelete
 	case *Set:
 		return StmtSet
-	case *Show:
+	case *Show, *ExportFilters:
 		return StmtShow
 	case DDLStatement, DBDDLStatement, *AlterVschema:
 		return StmtDDL
@@ -89,9 +89,9 @@ func ASTToStatementType(stmt Statement) StatementType {
 		return StmtShowMigrationLogs
 	case *Use:
 		return StmtUse
-	case *OtherRead, *OtherAdmin, *Load:
+	case *OtherRead, *OtherAdmin, *Load, *ImportFilters:
 		return StmtOther
-	case Explain, *VExplainStmt:
+	case Explain, *VExplainStmt, *ExplainFilter:
 		return StmtExplain
 	case *Begin:
 		return StmtBegin
@@ -33,6 +33,17 @@ func ContainsLockStatement(stmt Statement) bool {
 	return false
 }
 
+// IsNextvalStatement returns true if the query is a select next value
+// statement, which allocates the values of a sequence.
+func IsNextvalStatement(stmt Statement) bool {
+	sel, ok := stmt.(*Select)
+	if !ok || len(sel.SelectExprs) == 0 {
+		return false
+	}
+	_, ok = sel.SelectExprs[0].(*Nextval)
+	return ok
+}
+
 // isLockStatement returns true if the query is a Get Lock statement.
 func isLockStatement(stmt Statement) bool {
 	s, ok := stmt.(*Select)
@@ -161,3 +161,25 @@ func TestContainsLockStatement(t *testing.T) {
 		}
 	}
 }
+
+func TestIsNextvalStatement(t *testing.T) {
+	testcases := []struct {
+		sql  string
+		want bool
+	}{
+		{"select next value from seq", true},
+		{"select next 10 values from db.seq", true},
+		{"select next_id from seq", false},
+		{"update seq set next_id = 1", false},
+	}
+	for _, tcase := range testcases {
+		tree, err := Parse(tcase.sql)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := IsNextvalStatement(tree); got != tcase.want {
+			t.Errorf("IsNextvalStatement(%s): %v, want %v", tcase.sql, got, tcase.want)
+		}
+	}
+}
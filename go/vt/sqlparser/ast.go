@@ -724,6 +724,32 @@ type (
 		Type ReloadType
 	}
 
+	// ExportFilters represents an EXPORT FILTERS statement, which returns
+	// the document of the filters of Database, or of all the filters.
+	ExportFilters struct {
+		Database       IdentifierCS
+		DocumentFormat string
+	}
+
+	// ImportFilters represents an IMPORT FILTERS statement, which makes the
+	// filters of Database the ones of Document. Prune deletes the filters
+	// which aren't in Document.
+	ImportFilters struct {
+		Database IdentifierCS
+		Document string
+		Prune    bool
+	}
+
+	// ExplainFilter represents an EXPLAIN FILTER statement, which returns the
+	// filters Query would match in Database, sent by User from IP, without
+	// executing it.
+	ExplainFilter struct {
+		Query    string
+		Database IdentifierCS
+		User     string
+		IP       string
+	}
+
 	// OtherAdmin represents a misc statement that relies on ADMIN privileges,
 	// such as REPAIR, OPTIMIZE, or TRUNCATE statement.
 	// It should be used only as an indicator. It does not contain
@@ -769,6 +795,9 @@ func (*LockTables) iStatement()          {}
 func (*CheckTable) iStatement()          {}
 func (*Kill) iStatement()                {}
 func (*Reload) iStatement()              {}
+func (*ExportFilters) iStatement()       {}
+func (*ImportFilters) iStatement()       {}
+func (*ExplainFilter) iStatement()       {}
 func (*UnlockTables) iStatement()        {}
 func (*AlterTable) iStatement()          {}
 func (*AlterVschema) iStatement()        {}
@@ -155,10 +155,14 @@ func CloneSQLNode(in SQLNode) SQLNode {
 		return CloneRefOfExecuteStmt(in)
 	case *ExistsExpr:
 		return CloneRefOfExistsExpr(in)
+	case *ExplainFilter:
+		return CloneRefOfExplainFilter(in)
 	case *ExplainStmt:
 		return CloneRefOfExplainStmt(in)
 	case *ExplainTab:
 		return CloneRefOfExplainTab(in)
+	case *ExportFilters:
+		return CloneRefOfExportFilters(in)
 	case Exprs:
 		return CloneExprs(in)
 	case *ExtractFuncExpr:
@@ -193,6 +197,8 @@ func CloneSQLNode(in SQLNode) SQLNode {
 		return CloneIdentifierCI(in)
 	case IdentifierCS:
 		return CloneIdentifierCS(in)
+	case *ImportFilters:
+		return CloneRefOfImportFilters(in)
 	case *IndexDefinition:
 		return CloneRefOfIndexDefinition(in)
 	case *IndexHint:
@@ -1218,6 +1224,16 @@ func CloneRefOfExistsExpr(n *ExistsExpr) *ExistsExpr {
 	return &out
 }
 
+// CloneRefOfExplainFilter creates a deep clone of the input.
+func CloneRefOfExplainFilter(n *ExplainFilter) *ExplainFilter {
+	if n == nil {
+		return nil
+	}
+	out := *n
+	out.Database = CloneIdentifierCS(n.Database)
+	return &out
+}
+
 // CloneRefOfExplainStmt creates a deep clone of the input.
 func CloneRefOfExplainStmt(n *ExplainStmt) *ExplainStmt {
 	if n == nil {
@@ -1239,6 +1255,16 @@ func CloneRefOfExplainTab(n *ExplainTab) *ExplainTab {
 	return &out
 }
 
+// CloneRefOfExportFilters creates a deep clone of the input.
+func CloneRefOfExportFilters(n *ExportFilters) *ExportFilters {
+	if n == nil {
+		return nil
+	}
+	out := *n
+	out.Database = CloneIdentifierCS(n.Database)
+	return &out
+}
+
 // CloneExprs creates a deep clone of the input.
 func CloneExprs(n Exprs) Exprs {
 	if n == nil {
@@ -1418,6 +1444,16 @@ func CloneIdentifierCS(n IdentifierCS) IdentifierCS {
 	return *CloneRefOfIdentifierCS(&n)
 }
 
+// CloneRefOfImportFilters creates a deep clone of the input.
+func CloneRefOfImportFilters(n *ImportFilters) *ImportFilters {
+	if n == nil {
+		return nil
+	}
+	out := *n
+	out.Database = CloneIdentifierCS(n.Database)
+	return &out
+}
+
 // CloneRefOfIndexDefinition creates a deep clone of the input.
 func CloneRefOfIndexDefinition(n *IndexDefinition) *IndexDefinition {
 	if n == nil {
@@ -3841,12 +3877,18 @@ func CloneStatement(in Statement) Statement {
 		return CloneRefOfDropView(in)
 	case *ExecuteStmt:
 		return CloneRefOfExecuteStmt(in)
+	case *ExplainFilter:
+		return CloneRefOfExplainFilter(in)
 	case *ExplainStmt:
 		return CloneRefOfExplainStmt(in)
 	case *ExplainTab:
 		return CloneRefOfExplainTab(in)
+	case *ExportFilters:
+		return CloneRefOfExportFilters(in)
 	case *Flush:
 		return CloneRefOfFlush(in)
+	case *ImportFilters:
+		return CloneRefOfImportFilters(in)
 	case *Insert:
 		return CloneRefOfInsert(in)
 	case *Kill:
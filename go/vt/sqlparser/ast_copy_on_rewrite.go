@@ -154,10 +154,14 @@ func (c *cow) copyOnRewriteSQLNode(n SQLNode, parent SQLNode) (out SQLNode, chan
 		return c.copyOnRewriteRefOfExecuteStmt(n, parent)
 	case *ExistsExpr:
 		return c.copyOnRewriteRefOfExistsExpr(n, parent)
+	case *ExplainFilter:
+		return c.copyOnRewriteRefOfExplainFilter(n, parent)
 	case *ExplainStmt:
 		return c.copyOnRewriteRefOfExplainStmt(n, parent)
 	case *ExplainTab:
 		return c.copyOnRewriteRefOfExplainTab(n, parent)
+	case *ExportFilters:
+		return c.copyOnRewriteRefOfExportFilters(n, parent)
 	case Exprs:
 		return c.copyOnRewriteExprs(n, parent)
 	case *ExtractFuncExpr:
@@ -192,6 +196,8 @@ func (c *cow) copyOnRewriteSQLNode(n SQLNode, parent SQLNode) (out SQLNode, chan
 		return c.copyOnRewriteIdentifierCI(n, parent)
 	case IdentifierCS:
 		return c.copyOnRewriteIdentifierCS(n, parent)
+	case *ImportFilters:
+		return c.copyOnRewriteRefOfImportFilters(n, parent)
 	case *IndexDefinition:
 		return c.copyOnRewriteRefOfIndexDefinition(n, parent)
 	case *IndexHint:
@@ -2006,6 +2012,28 @@ func (c *cow) copyOnRewriteRefOfExistsExpr(n *ExistsExpr, parent SQLNode) (out S
 	}
 	return
 }
+func (c *cow) copyOnRewriteRefOfExplainFilter(n *ExplainFilter, parent SQLNode) (out SQLNode, changed bool) {
+	if n == nil || c.cursor.stop {
+		return n, false
+	}
+	out = n
+	if c.pre == nil || c.pre(n, parent) {
+		_Database, changedDatabase := c.copyOnRewriteIdentifierCS(n.Database, n)
+		if changedDatabase {
+			res := *n
+			res.Database, _ = _Database.(IdentifierCS)
+			out = &res
+			if c.cloned != nil {
+				c.cloned(n, out)
+			}
+			changed = true
+		}
+	}
+	if c.post != nil {
+		out, changed = c.postVisit(out, parent, changed)
+	}
+	return
+}
 func (c *cow) copyOnRewriteRefOfExplainStmt(n *ExplainStmt, parent SQLNode) (out SQLNode, changed bool) {
 	if n == nil || c.cursor.stop {
 		return n, false
@@ -2052,6 +2080,28 @@ func (c *cow) copyOnRewriteRefOfExplainTab(n *ExplainTab, parent SQLNode) (out S
 	}
 	return
 }
+func (c *cow) copyOnRewriteRefOfExportFilters(n *ExportFilters, parent SQLNode) (out SQLNode, changed bool) {
+	if n == nil || c.cursor.stop {
+		return n, false
+	}
+	out = n
+	if c.pre == nil || c.pre(n, parent) {
+		_Database, changedDatabase := c.copyOnRewriteIdentifierCS(n.Database, n)
+		if changedDatabase {
+			res := *n
+			res.Database, _ = _Database.(IdentifierCS)
+			out = &res
+			if c.cloned != nil {
+				c.cloned(n, out)
+			}
+			changed = true
+		}
+	}
+	if c.post != nil {
+		out, changed = c.postVisit(out, parent, changed)
+	}
+	return
+}
 func (c *cow) copyOnRewriteExprs(n Exprs, parent SQLNode) (out SQLNode, changed bool) {
 	if n == nil || c.cursor.stop {
 		return n, false
@@ -2414,6 +2464,28 @@ func (c *cow) copyOnRewriteIdentifierCS(n IdentifierCS, parent SQLNode) (out SQL
 	}
 	return
 }
+func (c *cow) copyOnRewriteRefOfImportFilters(n *ImportFilters, parent SQLNode) (out SQLNode, changed bool) {
+	if n == nil || c.cursor.stop {
+		return n, false
+	}
+	out = n
+	if c.pre == nil || c.pre(n, parent) {
+		_Database, changedDatabase := c.copyOnRewriteIdentifierCS(n.Database, n)
+		if changedDatabase {
+			res := *n
+			res.Database, _ = _Database.(IdentifierCS)
+			out = &res
+			if c.cloned != nil {
+				c.cloned(n, out)
+			}
+			changed = true
+		}
+	}
+	if c.post != nil {
+		out, changed = c.postVisit(out, parent, changed)
+	}
+	return
+}
 func (c *cow) copyOnRewriteRefOfIndexDefinition(n *IndexDefinition, parent SQLNode) (out SQLNode, changed bool) {
 	if n == nil || c.cursor.stop {
 		return n, false
@@ -6779,12 +6851,18 @@ func (c *cow) copyOnRewriteStatement(n Statement, parent SQLNode) (out SQLNode,
 		return c.copyOnRewriteRefOfDropView(n, parent)
 	case *ExecuteStmt:
 		return c.copyOnRewriteRefOfExecuteStmt(n, parent)
+	case *ExplainFilter:
+		return c.copyOnRewriteRefOfExplainFilter(n, parent)
 	case *ExplainStmt:
 		return c.copyOnRewriteRefOfExplainStmt(n, parent)
 	case *ExplainTab:
 		return c.copyOnRewriteRefOfExplainTab(n, parent)
+	case *ExportFilters:
+		return c.copyOnRewriteRefOfExportFilters(n, parent)
 	case *Flush:
 		return c.copyOnRewriteRefOfFlush(n, parent)
+	case *ImportFilters:
+		return c.copyOnRewriteRefOfImportFilters(n, parent)
 	case *Insert:
 		return c.copyOnRewriteRefOfInsert(n, parent)
 	case *Kill:
@@ -422,6 +422,12 @@ func (cmp *Comparator) SQLNode(inA, inB SQLNode) bool {
 			return false
 		}
 		return cmp.RefOfExistsExpr(a, b)
+	case *ExplainFilter:
+		b, ok := inB.(*ExplainFilter)
+		if !ok {
+			return false
+		}
+		return cmp.RefOfExplainFilter(a, b)
 	case *ExplainStmt:
 		b, ok := inB.(*ExplainStmt)
 		if !ok {
@@ -434,6 +440,12 @@ func (cmp *Comparator) SQLNode(inA, inB SQLNode) bool {
 			return false
 		}
 		return cmp.RefOfExplainTab(a, b)
+	case *ExportFilters:
+		b, ok := inB.(*ExportFilters)
+		if !ok {
+			return false
+		}
+		return cmp.RefOfExportFilters(a, b)
 	case Exprs:
 		b, ok := inB.(Exprs)
 		if !ok {
@@ -536,6 +548,12 @@ func (cmp *Comparator) SQLNode(inA, inB SQLNode) bool {
 			return false
 		}
 		return cmp.IdentifierCS(a, b)
+	case *ImportFilters:
+		b, ok := inB.(*ImportFilters)
+		if !ok {
+			return false
+		}
+		return cmp.RefOfImportFilters(a, b)
 	case *IndexDefinition:
 		b, ok := inB.(*IndexDefinition)
 		if !ok {
@@ -2350,6 +2368,20 @@ func (cmp *Comparator) RefOfExistsExpr(a, b *ExistsExpr) bool {
 	return cmp.RefOfSubquery(a.Subquery, b.Subquery)
 }
 
+// RefOfExplainFilter does deep equals between the two objects.
+func (cmp *Comparator) RefOfExplainFilter(a, b *ExplainFilter) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	return a.Query == b.Query &&
+		a.User == b.User &&
+		a.IP == b.IP &&
+		cmp.IdentifierCS(a.Database, b.Database)
+}
+
 // RefOfExplainStmt does deep equals between the two objects.
 func (cmp *Comparator) RefOfExplainStmt(a, b *ExplainStmt) bool {
 	if a == b {
@@ -2375,6 +2407,18 @@ func (cmp *Comparator) RefOfExplainTab(a, b *ExplainTab) bool {
 		cmp.TableName(a.Table, b.Table)
 }
 
+// RefOfExportFilters does deep equals between the two objects.
+func (cmp *Comparator) RefOfExportFilters(a, b *ExportFilters) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	return a.DocumentFormat == b.DocumentFormat &&
+		cmp.IdentifierCS(a.Database, b.Database)
+}
+
 // Exprs does deep equals between the two objects.
 func (cmp *Comparator) Exprs(a, b Exprs) bool {
 	if len(a) != len(b) {
@@ -2586,6 +2630,19 @@ func (cmp *Comparator) IdentifierCS(a, b IdentifierCS) bool {
 	return a.v == b.v
 }
 
+// RefOfImportFilters does deep equals between the two objects.
+func (cmp *Comparator) RefOfImportFilters(a, b *ImportFilters) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	return a.Document == b.Document &&
+		a.Prune == b.Prune &&
+		cmp.IdentifierCS(a.Database, b.Database)
+}
+
 // RefOfIndexDefinition does deep equals between the two objects.
 func (cmp *Comparator) RefOfIndexDefinition(a, b *IndexDefinition) bool {
 	if a == b {
@@ -6280,6 +6337,12 @@ func (cmp *Comparator) Statement(inA, inB Statement) bool {
 			return false
 		}
 		return cmp.RefOfExecuteStmt(a, b)
+	case *ExplainFilter:
+		b, ok := inB.(*ExplainFilter)
+		if !ok {
+			return false
+		}
+		return cmp.RefOfExplainFilter(a, b)
 	case *ExplainStmt:
 		b, ok := inB.(*ExplainStmt)
 		if !ok {
@@ -6292,12 +6355,24 @@ func (cmp *Comparator) Statement(inA, inB Statement) bool {
 			return false
 		}
 		return cmp.RefOfExplainTab(a, b)
+	case *ExportFilters:
+		b, ok := inB.(*ExportFilters)
+		if !ok {
+			return false
+		}
+		return cmp.RefOfExportFilters(a, b)
 	case *Flush:
 		b, ok := inB.(*Flush)
 		if !ok {
 			return false
 		}
 		return cmp.RefOfFlush(a, b)
+	case *ImportFilters:
+		b, ok := inB.(*ImportFilters)
+		if !ok {
+			return false
+		}
+		return cmp.RefOfImportFilters(a, b)
 	case *Insert:
 		b, ok := inB.(*Insert)
 		if !ok {
@@ -2175,6 +2175,43 @@ func (node *Reload) Format(buf *TrackedBuffer) {
 	buf.astPrintf(node, "reload %s", node.Type.ToString())
 }
 
+// Format formats the node.
+func (node *ExportFilters) Format(buf *TrackedBuffer) {
+	buf.literal("export filters")
+	if !node.Database.IsEmpty() {
+		buf.astPrintf(node, " from %v", node.Database)
+	}
+	if node.DocumentFormat != "" {
+		buf.astPrintf(node, " format = %s", node.DocumentFormat)
+	}
+}
+
+// Format formats the node.
+func (node *ImportFilters) Format(buf *TrackedBuffer) {
+	buf.literal("import filters")
+	if !node.Database.IsEmpty() {
+		buf.astPrintf(node, " into %v", node.Database)
+	}
+	buf.astPrintf(node, " from %s", encodeSQLString(node.Document))
+	if node.Prune {
+		buf.literal(" prune")
+	}
+}
+
+// Format formats the node.
+func (node *ExplainFilter) Format(buf *TrackedBuffer) {
+	buf.astPrintf(node, "explain filter for %s", encodeSQLString(node.Query))
+	if !node.Database.IsEmpty() {
+		buf.astPrintf(node, " from %v", node.Database)
+	}
+	if node.User != "" {
+		buf.astPrintf(node, " user %s", encodeSQLString(node.User))
+	}
+	if node.IP != "" {
+		buf.astPrintf(node, " ip %s", encodeSQLString(node.IP))
+	}
+}
+
 // Format formats the UnlockTables node.
 func (node *UnlockTables) Format(buf *TrackedBuffer) {
 	buf.literal("unlock tables")
@@ -2856,6 +2856,51 @@ func (node *Reload) formatFast(buf *TrackedBuffer) {
 	buf.WriteString(node.Type.ToString())
 }
 
+// formatFast formats the node.
+func (node *ExportFilters) formatFast(buf *TrackedBuffer) {
+	buf.WriteString("export filters")
+	if !node.Database.IsEmpty() {
+		buf.WriteString(" from ")
+		node.Database.formatFast(buf)
+	}
+	if node.DocumentFormat != "" {
+		buf.WriteString(" format = ")
+		buf.WriteString(node.DocumentFormat)
+	}
+}
+
+// formatFast formats the node.
+func (node *ImportFilters) formatFast(buf *TrackedBuffer) {
+	buf.WriteString("import filters")
+	if !node.Database.IsEmpty() {
+		buf.WriteString(" into ")
+		node.Database.formatFast(buf)
+	}
+	buf.WriteString(" from ")
+	buf.WriteString(encodeSQLString(node.Document))
+	if node.Prune {
+		buf.WriteString(" prune")
+	}
+}
+
+// formatFast formats the node.
+func (node *ExplainFilter) formatFast(buf *TrackedBuffer) {
+	buf.WriteString("explain filter for ")
+	buf.WriteString(encodeSQLString(node.Query))
+	if !node.Database.IsEmpty() {
+		buf.WriteString(" from ")
+		node.Database.formatFast(buf)
+	}
+	if node.User != "" {
+		buf.WriteString(" user ")
+		buf.WriteString(encodeSQLString(node.User))
+	}
+	if node.IP != "" {
+		buf.WriteString(" ip ")
+		buf.WriteString(encodeSQLString(node.IP))
+	}
+}
+
 // formatFast formats the UnlockTables node.
 func (node *UnlockTables) formatFast(buf *TrackedBuffer) {
 	buf.WriteString("unlock tables")
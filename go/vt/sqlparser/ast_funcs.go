@@ -1925,6 +1925,8 @@ func (ty ShowCommandType) ToString() string {
 		return WorkloadStr
 	case LastSeenGTID:
 		return LastSeenGTIDStr
+	case FilterStats:
+		return FilterStatsStr
 	default:
 		return "" +
 			"Unknown ShowCommandType"
@@ -154,10 +154,14 @@ func (a *application) rewriteSQLNode(parent SQLNode, node SQLNode, replacer repl
 		return a.rewriteRefOfExecuteStmt(parent, node, replacer)
 	case *ExistsExpr:
 		return a.rewriteRefOfExistsExpr(parent, node, replacer)
+	case *ExplainFilter:
+		return a.rewriteRefOfExplainFilter(parent, node, replacer)
 	case *ExplainStmt:
 		return a.rewriteRefOfExplainStmt(parent, node, replacer)
 	case *ExplainTab:
 		return a.rewriteRefOfExplainTab(parent, node, replacer)
+	case *ExportFilters:
+		return a.rewriteRefOfExportFilters(parent, node, replacer)
 	case Exprs:
 		return a.rewriteExprs(parent, node, replacer)
 	case *ExtractFuncExpr:
@@ -192,6 +196,8 @@ func (a *application) rewriteSQLNode(parent SQLNode, node SQLNode, replacer repl
 		return a.rewriteIdentifierCI(parent, node, replacer)
 	case IdentifierCS:
 		return a.rewriteIdentifierCS(parent, node, replacer)
+	case *ImportFilters:
+		return a.rewriteRefOfImportFilters(parent, node, replacer)
 	case *IndexDefinition:
 		return a.rewriteRefOfIndexDefinition(parent, node, replacer)
 	case *IndexHint:
@@ -2545,6 +2551,33 @@ func (a *application) rewriteRefOfExistsExpr(parent SQLNode, node *ExistsExpr, r
 	}
 	return true
 }
+func (a *application) rewriteRefOfExplainFilter(parent SQLNode, node *ExplainFilter, replacer replacerFunc) bool {
+	if node == nil {
+		return true
+	}
+	if a.pre != nil {
+		a.cur.replacer = replacer
+		a.cur.parent = parent
+		a.cur.node = node
+		if !a.pre(&a.cur) {
+			return true
+		}
+	}
+	if !a.rewriteIdentifierCS(node, node.Database, func(newNode, parent SQLNode) {
+		parent.(*ExplainFilter).Database = newNode.(IdentifierCS)
+	}) {
+		return false
+	}
+	if a.post != nil {
+		a.cur.replacer = replacer
+		a.cur.parent = parent
+		a.cur.node = node
+		if !a.post(&a.cur) {
+			return false
+		}
+	}
+	return true
+}
 func (a *application) rewriteRefOfExplainStmt(parent SQLNode, node *ExplainStmt, replacer replacerFunc) bool {
 	if node == nil {
 		return true
@@ -2604,6 +2637,33 @@ func (a *application) rewriteRefOfExplainTab(parent SQLNode, node *ExplainTab, r
 	}
 	return true
 }
+func (a *application) rewriteRefOfExportFilters(parent SQLNode, node *ExportFilters, replacer replacerFunc) bool {
+	if node == nil {
+		return true
+	}
+	if a.pre != nil {
+		a.cur.replacer = replacer
+		a.cur.parent = parent
+		a.cur.node = node
+		if !a.pre(&a.cur) {
+			return true
+		}
+	}
+	if !a.rewriteIdentifierCS(node, node.Database, func(newNode, parent SQLNode) {
+		parent.(*ExportFilters).Database = newNode.(IdentifierCS)
+	}) {
+		return false
+	}
+	if a.post != nil {
+		a.cur.replacer = replacer
+		a.cur.parent = parent
+		a.cur.node = node
+		if !a.post(&a.cur) {
+			return false
+		}
+	}
+	return true
+}
 func (a *application) rewriteExprs(parent SQLNode, node Exprs, replacer replacerFunc) bool {
 	if node == nil {
 		return true
@@ -3145,6 +3205,33 @@ func (a *application) rewriteIdentifierCS(parent SQLNode, node IdentifierCS, rep
 	}
 	return true
 }
+func (a *application) rewriteRefOfImportFilters(parent SQLNode, node *ImportFilters, replacer replacerFunc) bool {
+	if node == nil {
+		return true
+	}
+	if a.pre != nil {
+		a.cur.replacer = replacer
+		a.cur.parent = parent
+		a.cur.node = node
+		if !a.pre(&a.cur) {
+			return true
+		}
+	}
+	if !a.rewriteIdentifierCS(node, node.Database, func(newNode, parent SQLNode) {
+		parent.(*ImportFilters).Database = newNode.(IdentifierCS)
+	}) {
+		return false
+	}
+	if a.post != nil {
+		a.cur.replacer = replacer
+		a.cur.parent = parent
+		a.cur.node = node
+		if !a.post(&a.cur) {
+			return false
+		}
+	}
+	return true
+}
 func (a *application) rewriteRefOfIndexDefinition(parent SQLNode, node *IndexDefinition, replacer replacerFunc) bool {
 	if node == nil {
 		return true
@@ -9003,12 +9090,18 @@ func (a *application) rewriteStatement(parent SQLNode, node Statement, replacer
 		return a.rewriteRefOfDropView(parent, node, replacer)
 	case *ExecuteStmt:
 		return a.rewriteRefOfExecuteStmt(parent, node, replacer)
+	case *ExplainFilter:
+		return a.rewriteRefOfExplainFilter(parent, node, replacer)
 	case *ExplainStmt:
 		return a.rewriteRefOfExplainStmt(parent, node, replacer)
 	case *ExplainTab:
 		return a.rewriteRefOfExplainTab(parent, node, replacer)
+	case *ExportFilters:
+		return a.rewriteRefOfExportFilters(parent, node, replacer)
 	case *Flush:
 		return a.rewriteRefOfFlush(parent, node, replacer)
+	case *ImportFilters:
+		return a.rewriteRefOfImportFilters(parent, node, replacer)
 	case *Insert:
 		return a.rewriteRefOfInsert(parent, node, replacer)
 	case *Kill:
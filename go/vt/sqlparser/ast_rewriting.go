@@ -546,12 +546,14 @@ func (er *astRewriter) sysVarRewrite(cursor *Cursor, node *Variable) {
 		sysvars.ReadAfterWriteTimeOut.Name,
 		sysvars.SessionEnableSystemSettings.Name,
 		sysvars.SessionTrackGTIDs.Name,
+		sysvars.SnapshotReadGTID.Name,
 		sysvars.SessionUUID.Name,
 		sysvars.SkipQueryPlanCache.Name,
 		sysvars.Socket.Name,
 		sysvars.SQLSelectLimit.Name,
 		sysvars.Version.Name,
 		sysvars.VersionComment.Name,
+		sysvars.WarningCount.Name,
 		sysvars.QueryTimeout.Name,
 		sysvars.Workload.Name,
 		sysvars.ReadWriteSplittingPolicy.Name,
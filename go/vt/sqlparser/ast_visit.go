@@ -154,10 +154,14 @@ func VisitSQLNode(in SQLNode, f Visit) error {
 		return VisitRefOfExecuteStmt(in, f)
 	case *ExistsExpr:
 		return VisitRefOfExistsExpr(in, f)
+	case *ExplainFilter:
+		return VisitRefOfExplainFilter(in, f)
 	case *ExplainStmt:
 		return VisitRefOfExplainStmt(in, f)
 	case *ExplainTab:
 		return VisitRefOfExplainTab(in, f)
+	case *ExportFilters:
+		return VisitRefOfExportFilters(in, f)
 	case Exprs:
 		return VisitExprs(in, f)
 	case *ExtractFuncExpr:
@@ -192,6 +196,8 @@ func VisitSQLNode(in SQLNode, f Visit) error {
 		return VisitIdentifierCI(in, f)
 	case IdentifierCS:
 		return VisitIdentifierCS(in, f)
+	case *ImportFilters:
+		return VisitRefOfImportFilters(in, f)
 	case *IndexDefinition:
 		return VisitRefOfIndexDefinition(in, f)
 	case *IndexHint:
@@ -1458,6 +1464,18 @@ func VisitRefOfExistsExpr(in *ExistsExpr, f Visit) error {
 	}
 	return nil
 }
+func VisitRefOfExplainFilter(in *ExplainFilter, f Visit) error {
+	if in == nil {
+		return nil
+	}
+	if cont, err := f(in); err != nil || !cont {
+		return err
+	}
+	if err := VisitIdentifierCS(in.Database, f); err != nil {
+		return err
+	}
+	return nil
+}
 func VisitRefOfExplainStmt(in *ExplainStmt, f Visit) error {
 	if in == nil {
 		return nil
@@ -1485,6 +1503,18 @@ func VisitRefOfExplainTab(in *ExplainTab, f Visit) error {
 	}
 	return nil
 }
+func VisitRefOfExportFilters(in *ExportFilters, f Visit) error {
+	if in == nil {
+		return nil
+	}
+	if cont, err := f(in); err != nil || !cont {
+		return err
+	}
+	if err := VisitIdentifierCS(in.Database, f); err != nil {
+		return err
+	}
+	return nil
+}
 func VisitExprs(in Exprs, f Visit) error {
 	if in == nil {
 		return nil
@@ -1723,6 +1753,18 @@ func VisitIdentifierCS(in IdentifierCS, f Visit) error {
 	}
 	return nil
 }
+func VisitRefOfImportFilters(in *ImportFilters, f Visit) error {
+	if in == nil {
+		return nil
+	}
+	if cont, err := f(in); err != nil || !cont {
+		return err
+	}
+	if err := VisitIdentifierCS(in.Database, f); err != nil {
+		return err
+	}
+	return nil
+}
 func VisitRefOfIndexDefinition(in *IndexDefinition, f Visit) error {
 	if in == nil {
 		return nil
@@ -4709,12 +4751,18 @@ func VisitStatement(in Statement, f Visit) error {
 		return VisitRefOfDropView(in, f)
 	case *ExecuteStmt:
 		return VisitRefOfExecuteStmt(in, f)
+	case *ExplainFilter:
+		return VisitRefOfExplainFilter(in, f)
 	case *ExplainStmt:
 		return VisitRefOfExplainStmt(in, f)
 	case *ExplainTab:
 		return VisitRefOfExplainTab(in, f)
+	case *ExportFilters:
+		return VisitRefOfExportFilters(in, f)
 	case *Flush:
 		return VisitRefOfFlush(in, f)
+	case *ImportFilters:
+		return VisitRefOfImportFilters(in, f)
 	case *Insert:
 		return VisitRefOfInsert(in, f)
 	case *Kill:
@@ -1250,6 +1250,24 @@ func (cached *ExistsExpr) CachedSize(alloc bool) int64 {
 	size += cached.Subquery.CachedSize(true)
 	return size
 }
+func (cached *ExplainFilter) CachedSize(alloc bool) int64 {
+	if cached == nil {
+		return int64(0)
+	}
+	size := int64(0)
+	if alloc {
+		size += int64(64)
+	}
+	// field Query string
+	size += hack.RuntimeAllocSize(int64(len(cached.Query)))
+	// field Database vitess.io/vitess/go/vt/sqlparser.IdentifierCS
+	size += cached.Database.CachedSize(false)
+	// field User string
+	size += hack.RuntimeAllocSize(int64(len(cached.User)))
+	// field IP string
+	size += hack.RuntimeAllocSize(int64(len(cached.IP)))
+	return size
+}
 func (cached *ExplainStmt) CachedSize(alloc bool) int64 {
 	if cached == nil {
 		return int64(0)
@@ -1280,6 +1298,20 @@ func (cached *ExplainTab) CachedSize(alloc bool) int64 {
 	size += hack.RuntimeAllocSize(int64(len(cached.Wild)))
 	return size
 }
+func (cached *ExportFilters) CachedSize(alloc bool) int64 {
+	if cached == nil {
+		return int64(0)
+	}
+	size := int64(0)
+	if alloc {
+		size += int64(32)
+	}
+	// field Database vitess.io/vitess/go/vt/sqlparser.IdentifierCS
+	size += cached.Database.CachedSize(false)
+	// field DocumentFormat string
+	size += hack.RuntimeAllocSize(int64(len(cached.DocumentFormat)))
+	return size
+}
 func (cached *ExtractFuncExpr) CachedSize(alloc bool) int64 {
 	if cached == nil {
 		return int64(0)
@@ -1538,6 +1570,20 @@ func (cached *IdentifierCS) CachedSize(alloc bool) int64 {
 	size += hack.RuntimeAllocSize(int64(len(cached.v)))
 	return size
 }
+func (cached *ImportFilters) CachedSize(alloc bool) int64 {
+	if cached == nil {
+		return int64(0)
+	}
+	size := int64(0)
+	if alloc {
+		size += int64(48)
+	}
+	// field Database vitess.io/vitess/go/vt/sqlparser.IdentifierCS
+	size += cached.Database.CachedSize(false)
+	// field Document string
+	size += hack.RuntimeAllocSize(int64(len(cached.Document)))
+	return size
+}
 func (cached *IndexColumn) CachedSize(alloc bool) int64 {
 	if cached == nil {
 		return int64(0)
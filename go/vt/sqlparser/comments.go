@@ -68,6 +68,8 @@ const (
 	DirectiveDMLTimePeriodTimeZone = "DML_TIME_PERIOD_TIME_ZONE"
 	DirectiveDMLThrottleDuration   = "DML_THROTTLE_DURATION"
 	DirectiveDMLThrottleRatio      = "DML_THROTTLE_RATIO"
+	DirectiveDMLCron               = "DML_CRON"
+	DirectiveDMLCronTimeZone       = "DML_CRON_TIME_ZONE"
 )
 
 func isNonSpace(r rune) bool {
@@ -554,3 +556,22 @@ func GetDMLJobArgs(stmt Statement) (timeGapInMs int64, batchSize int64, postpone
 
 	return timeGapInMs, batchSize, postponeLaunch, failPolicy, timePeriodStart, timePeriodEnd, timePeriodTimeZone, throttleDuration, throttleRatio
 }
+
+// GetDMLJobCron returns the cron expression and its time zone of a DML job which is submitted to run on a schedule.
+// Since the directives can't have spaces, the fields of the cron expression are separated by '_', e.g. dml_cron='0_3_*_*_*'.
+func GetDMLJobCron(stmt Statement) (cronExpr, cronTimeZone string) {
+	var comments *ParsedComments
+	switch stmt := stmt.(type) {
+	case *Update:
+		comments = stmt.Comments
+	case *Delete:
+		comments = stmt.Comments
+	}
+	if comments == nil {
+		return "", ""
+	}
+	directives := comments.Directives()
+	cronExpr, _ = directives.GetString(DirectiveDMLCron, "")
+	cronTimeZone, _ = directives.GetString(DirectiveDMLCronTimeZone, "")
+	return cronExpr, cronTimeZone
+}
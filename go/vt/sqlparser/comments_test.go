@@ -574,3 +574,20 @@ func TestGetNodeType(t *testing.T) {
 		})
 	}
 }
+
+func TestGetDMLJobCron(t *testing.T) {
+	stmt, err := Parse("delete /*vt+ dml_split=true dml_cron='0_3_*_*_*' dml_cron_time_zone='UTC+08:00:00' */ from t where created < now() - interval 7 day")
+	require.NoError(t, err)
+	cronExpr, cronTimeZone := GetDMLJobCron(stmt)
+	assert.Equal(t, "'0_3_*_*_*'", cronExpr)
+	assert.Equal(t, "'UTC+08:00:00'", cronTimeZone)
+
+	stmt, err = Parse("delete /*vt+ dml_split=true */ from t where id > 1")
+	require.NoError(t, err)
+	cronExpr, _ = GetDMLJobCron(stmt)
+	assert.Empty(t, cronExpr)
+
+	stmt, err = Parse("show dml_job schedules")
+	require.NoError(t, err)
+	assert.Equal(t, &Show{&ShowDMLJob{UUID: ShowDMLJobSchedules}}, stmt)
+}
@@ -260,6 +260,9 @@ const (
 	AllVExplainStr = "all"
 	PlanStr        = "plan"
 
+	// Filter document formats
+	YAMLStr = "yaml"
+
 	// Lock Types
 	ReadStr             = "read"
 	ReadLocalStr        = "read local"
@@ -325,6 +328,7 @@ const (
 	WorkloadStr                = " workload"
 	LastSeenGTIDStr            = " lastseengtid"
 	FailPointStr               = "failpointutil"
+	FilterStatsStr             = " filter_stats"
 
 	// DropKeyType strings
 	PrimaryKeyTypeStr = "primary key"
@@ -857,6 +861,7 @@ const (
 	FailPoints
 	SchemaMigration
 	DMLJobs
+	FilterStats
 )
 
 // DropKeyType constants
@@ -912,6 +917,9 @@ const (
 	SetRunningTimePeriodType
 )
 
+// ShowDMLJobSchedules is the UUID of SHOW DML_JOB SCHEDULES, which shows the schedules of the DML jobs
+const ShowDMLJobSchedules = "schedules"
+
 // ColumnStorage constants
 const (
 	VirtualStorage ColumnStorage = iota
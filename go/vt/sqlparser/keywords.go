@@ -279,6 +279,7 @@ var keywords = []keyword{
 	{"false", FALSE},
 	{"fetch", UNUSED},
 	{"fields", FIELDS},
+	{"filter", FILTER},
 	{"first", FIRST},
 	{"first_value", FIRST_VALUE},
 	{"fixed", FIXED},
@@ -347,6 +348,7 @@ var keywords = []keyword{
 	{"interval", INTERVAL},
 	{"into", INTO},
 	{"io_after_gtids", UNUSED},
+	{"ip", IP},
 	{"is", IS},
 	{"is_free_lock", IS_FREE_LOCK},
 	{"is_used_lock", IS_USED_LOCK},
@@ -509,6 +511,7 @@ var keywords = []keyword{
 	{"privileges", PRIVILEGES},
 	{"processlist", PROCESSLIST},
 	{"procedure", PROCEDURE},
+	{"prune", PRUNE},
 	{"ps_current_thread_id", PS_CURRENT_THREAD_ID},
 	{"ps_thread_id", PS_THREAD_ID},
 	{"queries", QUERIES},
@@ -683,10 +686,13 @@ var keywords = []keyword{
 	{"dml_jobs", DML_JOBS},
 	{"details", DETAILS},
 	{"time_period", TIME_PERIOD},
+	{"schedules", SCHEDULES},
 	{"vitess_replication_status", VITESS_REPLICATION_STATUS},
 	{"vitess_shards", VITESS_SHARDS},
 	{"vitess_tablets", VITESS_TABLETS},
 	{"tablets_plans", TABLETS_PLANS},
+	{"filter_stats", FILTER_STATS},
+	{"filters", FILTERS},
 	{"workload", WORKLOAD},
 	{"vitess_target", VITESS_TARGET},
 	{"vitess_throttled_apps", VITESS_THROTTLED_APPS},
@@ -708,6 +714,7 @@ var keywords = []keyword{
 	{"write", WRITE},
 	{"visible", VISIBLE},
 	{"xor", XOR},
+	{"yaml", YAML},
 	{"year", YEAR},
 	{"year_month", YEAR_MONTH},
 	{"zerofill", ZEROFILL},
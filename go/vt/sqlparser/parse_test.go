@@ -1836,6 +1836,33 @@ var (
 	}, {
 		input:  "reload privileges",
 		output: "reload privileges",
+	}, {
+		input: "export filters",
+	}, {
+		input:  "EXPORT FILTERS FROM db FORMAT = YAML",
+		output: "export filters from db format = yaml",
+	}, {
+		input:  "export filters in db format = json",
+		output: "export filters from db format = json",
+	}, {
+		input:  "import filters from '{\"filters\": []}'",
+		output: "import filters from '{\\\"filters\\\": []}'",
+	}, {
+		input:  "import filters into db from 'filters:\n- name: db.a\n  action: FAIL\n' prune",
+		output: "import filters into db from 'filters:\\n- name: db.a\\n  action: FAIL\\n' prune",
+	}, {
+		input: "explain filter for 'delete from t where id = 1'",
+	}, {
+		input:  "EXPLAIN FILTER FOR 'select * from t' IN db USER 'etl' IP '10.0.0.1'",
+		output: "explain filter for 'select * from t' from db user 'etl' ip '10.0.0.1'",
+	}, {
+		input: "explain filter for 'select * from t' ip '10.0.0.1'",
+	}, {
+		input:  "explain filter",
+		output: "explain `filter`",
+	}, {
+		input:  "select filter, ip from t",
+		output: "select `filter`, `ip` from t",
 	},
 		{
 			input: "flush tables",
@@ -2076,6 +2103,10 @@ var (
 			input: "show vitess_tablets like '%'",
 		}, {
 			input: "show vitess_tablets where hostname = 'some-tablet'",
+		}, {
+			input: "show filter_stats",
+		}, {
+			input: "show filter_stats like 'emergency%'",
 		}, {
 			input: "show vitess_targets",
 		}, {
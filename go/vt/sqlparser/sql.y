@@ -326,7 +326,7 @@ func bindVariable(yylex yyLexer, bvar string) {
 // Throttler tokens
 %token <str> VITESS_THROTTLER
 // DML JOB tokens
-%token <str> DML_JOB DETAILS TIME_PERIOD
+%token <str> DML_JOB DETAILS TIME_PERIOD SCHEDULES
 
 // Transaction Tokens
 %token <str> BEGIN START TRANSACTION COMMIT ROLLBACK SAVEPOINT RELEASE WORK
@@ -348,9 +348,12 @@ func bindVariable(yylex yyLexer, bvar string) {
 // SHOW tokens
 %token <str> CODE COLLATION COLUMNS DATABASES ENGINES EVENT EXTENDED FIELDS FULL FUNCTION GTID_EXECUTED
 %token <str> KEYSPACES OPEN PLUGINS PRIVILEGES PROCESSLIST SCHEMAS TABLES TRIGGERS USER
-%token <str> VGTID_EXECUTED VITESS_KEYSPACES VITESS_METADATA VITESS_MIGRATIONS VITESS_REPLICATION_STATUS VITESS_SHARDS VITESS_TABLETS VITESS_TARGET VSCHEMA VITESS_THROTTLED_APPS WORKLOAD LASTSEENGTID FAILPOINTS TABLETS_PLANS
+%token <str> VGTID_EXECUTED VITESS_KEYSPACES VITESS_METADATA VITESS_MIGRATIONS VITESS_REPLICATION_STATUS VITESS_SHARDS VITESS_TABLETS VITESS_TARGET VSCHEMA VITESS_THROTTLED_APPS WORKLOAD LASTSEENGTID FAILPOINTS TABLETS_PLANS FILTER_STATS
 %token <str> DML_JOBS
 
+// Filter document tokens
+%token <str> FILTERS YAML PRUNE FILTER IP
+
 // SET tokens
 %token <str> NAMES GLOBAL SESSION ISOLATION LEVEL READ WRITE ONLY REPEATABLE COMMITTED UNCOMMITTED SERIALIZABLE
 
@@ -450,6 +453,10 @@ func bindVariable(yylex yyLexer, bvar string) {
 %type <statement> begin_statement commit_statement rollback_statement savepoint_statement release_statement load_statement
 %type <statement> lock_statement unlock_statement call_statement
 %type <statement> revert_statement
+%type <statement> export_statement import_statement
+%type <str> filter_document_format_opt
+%type <boolean> prune_opt
+%type <str> explain_filter_user_opt explain_filter_ip_opt
 %type <strs> comment_opt comment_list
 %type <str> wild_opt check_option_opt cascade_or_local_opt restrict_or_cascade_opt
 %type <explainType> explain_format_opt
@@ -681,6 +688,8 @@ command:
 | prepare_statement
 | execute_statement
 | deallocate_statement
+| export_statement
+| import_statement
 | /*empty*/
 {
   setParseTree(yylex, nil)
@@ -4278,6 +4287,44 @@ kill_statement:
     $$ = &Kill{Type: KillConnection, ConnID: NewIntLiteral($3)}
   }
 
+export_statement:
+  EXPORT FILTERS from_database_opt filter_document_format_opt
+  {
+    $$ = &ExportFilters{Database: $3, DocumentFormat: $4}
+  }
+
+filter_document_format_opt:
+  {
+    $$ = ""
+  }
+| FORMAT '=' JSON
+  {
+    $$ = JSONStr
+  }
+| FORMAT '=' YAML
+  {
+    $$ = YAMLStr
+  }
+
+import_statement:
+  IMPORT FILTERS FROM STRING prune_opt
+  {
+    $$ = &ImportFilters{Document: $4, Prune: $5}
+  }
+| IMPORT FILTERS INTO table_id FROM STRING prune_opt
+  {
+    $$ = &ImportFilters{Database: $4, Document: $6, Prune: $7}
+  }
+
+prune_opt:
+  {
+    $$ = false
+  }
+| PRUNE
+  {
+    $$ = true
+  }
+
 reload_statement:
   RELOAD USERS
   {
@@ -4433,6 +4480,10 @@ show_statement:
   {
     $$ = &Show{&ShowDMLJob{UUID: "*", Detail:false}}
   }
+| SHOW DML_JOB SCHEDULES
+  {
+    $$ = &Show{&ShowDMLJob{UUID: ShowDMLJobSchedules, Detail:false}}
+  }
 | SHOW DML_JOB STRING
   {
     $$ = &Show{&ShowDMLJob{UUID:$3, Detail:false}}
@@ -4489,6 +4540,10 @@ show_statement:
   {
     $$ = &Show{&ShowBasic{Command: TabletsPlans, Filter: $3}}
   }
+| SHOW FILTER_STATS like_or_where_opt
+  {
+    $$ = &Show{&ShowBasic{Command: FilterStats, Filter: $3}}
+  }
 | SHOW VITESS_TARGET
   {
     $$ = &Show{&ShowBasic{Command: VitessTarget}}
@@ -4845,6 +4900,28 @@ explain_statement:
   {
     $$ = &ExplainStmt{Type: $3, Statement: $4, Comments: Comments($2).Parsed()}
   }
+| explain_synonyms comment_opt FILTER FOR STRING from_database_opt explain_filter_user_opt explain_filter_ip_opt
+  {
+    $$ = &ExplainFilter{Query: $5, Database: $6, User: $7, IP: $8}
+  }
+
+explain_filter_user_opt:
+  {
+    $$ = ""
+  }
+| USER STRING
+  {
+    $$ = $2
+  }
+
+explain_filter_ip_opt:
+  {
+    $$ = ""
+  }
+| IP STRING
+  {
+    $$ = $2
+  }
 
 vexplain_statement:
   VEXPLAIN comment_opt vexplain_type_opt explainable_statement
@@ -8067,6 +8144,7 @@ non_reserved_keyword:
 | ExtractValue %prec FUNCTION_CALL_NON_KEYWORD
 | FLOAT_TYPE
 | FIELDS
+| FILTER
 | FIRST
 | FIXED
 | FLUSH
@@ -8102,6 +8180,7 @@ non_reserved_keyword:
 | INVISIBLE
 | INVOKER
 | INDEXES
+| IP
 | IS_FREE_LOCK %prec FUNCTION_CALL_NON_KEYWORD
 | IS_USED_LOCK %prec FUNCTION_CALL_NON_KEYWORD
 | ISOLATION
@@ -8222,6 +8301,7 @@ non_reserved_keyword:
 | POSITION %prec FUNCTION_CALL_NON_KEYWORD
 | PROCEDURE
 | PROCESSLIST
+| PRUNE
 | QUERIES
 | QUERY
 | RANDOM
@@ -8348,10 +8428,13 @@ non_reserved_keyword:
 | DML_JOBS
 | DETAILS
 | TIME_PERIOD
+| SCHEDULES
 | VITESS_REPLICATION_STATUS
 | VITESS_SHARDS
 | VITESS_TABLETS
 | TABLETS_PLANS
+| FILTER_STATS
+| FILTERS
 | VITESS_TARGET
 | WORKLOAD
 | LASTSEENGTID
@@ -8365,6 +8448,7 @@ non_reserved_keyword:
 | WARNINGS
 | WITHOUT
 | WORK
+| YAML
 | YEAR
 | ZEROFILL
 | DAY
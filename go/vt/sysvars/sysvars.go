@@ -81,12 +81,16 @@ var (
 	DDLStrategy    = SystemVariable{Name: "ddl_strategy", IdentifierAsString: true}
 	Version        = SystemVariable{Name: "version"}
 	VersionComment = SystemVariable{Name: "version_comment"}
+	// WarningCount is the number of warnings of the last statement, like SHOW COUNT(*) WARNINGS
+	WarningCount = SystemVariable{Name: "warning_count"}
 
 	// Read After Write settings
 	ReadAfterWriteGTID        = SystemVariable{Name: "read_after_write_gtid"}
 	ReadAfterWriteConsistency = SystemVariable{Name: "read_after_write_consistency"}
 	ReadAfterWriteTimeOut     = SystemVariable{Name: "read_after_write_timeout"}
 	SessionTrackGTIDs         = SystemVariable{Name: "session_track_gtids", IdentifierAsString: true}
+	// SnapshotReadGTID pins the reads of the session to the replicas which executed a GTID set
+	SnapshotReadGTID = SystemVariable{Name: "snapshot_read_gtid"}
 
 	// Read Write Splitting
 	ReadWriteSplittingPolicy = SystemVariable{Name: "read_write_splitting_policy", IdentifierAsString: true}
@@ -121,6 +125,7 @@ var (
 		ReadAfterWriteConsistency,
 		ReadAfterWriteTimeOut,
 		SessionTrackGTIDs,
+		SnapshotReadGTID,
 		QueryTimeout,
 		ReadWriteSplittingPolicy,
 		ReadWriteSplittingRatio,
@@ -134,6 +139,7 @@ var (
 		Socket,
 		Version,
 		VersionComment,
+		WarningCount,
 	}
 
 	IgnoreThese = []SystemVariable{
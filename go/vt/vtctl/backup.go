@@ -24,6 +24,7 @@ import (
 	"github.com/spf13/pflag"
 	"google.golang.org/grpc"
 
+	"vitess.io/vitess/go/mysql"
 	"vitess.io/vitess/go/protoutil"
 	"vitess.io/vitess/go/vt/logutil"
 	"vitess.io/vitess/go/vt/mysqlctl"
@@ -32,6 +33,7 @@ import (
 	"vitess.io/vitess/go/vt/vterrors"
 	"vitess.io/vitess/go/vt/wrangler"
 
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
 	vtctldatapb "vitess.io/vitess/go/vt/proto/vtctldata"
 	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
 )
@@ -67,6 +69,12 @@ func init() {
 		params: "[--backup_timestamp=yyyy-MM-dd.HHmmss] [--restore_to_pos=<pos>] [--dry_run] <tablet alias>",
 		help:   "Stops mysqld and restores the data from the latest backup or if a timestamp is specified then the most recent backup at or before that time. If '--restore_to_pos' is given, then a point in time restore based on one full backup followed by zero or more incremental backups. dry-run only validates restore steps without actually restoring data",
 	})
+	addCommand("Tablets", command{
+		name:   "PointInTimeRecovery",
+		method: commandPointInTimeRecovery,
+		params: "{--restore_to_timestamp=<RFC3339 time> | --restore_to_pos=<pos>} [--dry_run] <recovery tablet alias>",
+		help:   "Recovers the non-primary tablet to the state of its shard at the given time or position, with one full backup followed by zero or more incremental backups. With '--restore_to_timestamp', the position is resolved by streaming the binary logs of the primary from the latest full backup at or before that time, and contains all the transactions committed before it. The tablet stays DRAINED without replication after the recovery, and the recovered position is reported.",
+	})
 }
 
 func commandBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *pflag.FlagSet, args []string) error {
@@ -239,3 +247,70 @@ func commandRestoreFromBackup(ctx context.Context, wr *wrangler.Wrangler, subFla
 
 	return wr.VtctldServer().RestoreFromBackup(req, &backupRestoreEventStreamLogger{logger: wr.Logger(), ctx: ctx})
 }
+
+func commandPointInTimeRecovery(ctx context.Context, wr *wrangler.Wrangler, subFlags *pflag.FlagSet, args []string) error {
+	restoreToTimestampStr := subFlags.String("restore_to_timestamp", "", "Recover all the transactions committed before this time, in RFC3339 format, e.g. 2024-01-10T13:30:00Z")
+	restoreToPos := subFlags.String("restore_to_pos", "", "Recover all the transactions up to and including this position")
+	dryRun := subFlags.Bool("dry_run", false, "Only resolve the position and validate the restore steps, do not actually restore data")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("the PointInTimeRecovery command requires the <recovery tablet alias> argument")
+	}
+	if (*restoreToTimestampStr == "") == (*restoreToPos == "") {
+		return vterrors.New(vtrpcpb.Code_INVALID_ARGUMENT, "exactly one of --restore_to_timestamp and --restore_to_pos must be specified")
+	}
+
+	tabletAlias, err := topoproto.ParseTabletAlias(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	ti, err := wr.TopoServer().GetTablet(ctx, tabletAlias)
+	if err != nil {
+		return err
+	}
+	if ti.Type == topodatapb.TabletType_PRIMARY {
+		return vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "cannot recover the primary tablet %v, use a replica or spare tablet of shard %v/%v", subFlags.Arg(0), ti.Keyspace, ti.Shard)
+	}
+
+	var targetPos mysql.Position
+	if *restoreToTimestampStr != "" {
+		restoreTime, err := time.Parse(time.RFC3339, *restoreToTimestampStr)
+		if err != nil {
+			return vterrors.New(vtrpcpb.Code_INVALID_ARGUMENT, fmt.Sprintf("unable to parse the restore timestamp value provided of '%s'", *restoreToTimestampStr))
+		}
+		if targetPos, err = wr.FindPositionAtTime(ctx, ti.Keyspace, ti.Shard, restoreTime); err != nil {
+			return err
+		}
+		wr.Logger().Printf("Shard %v/%v was at position %v at %v\n", ti.Keyspace, ti.Shard, mysql.EncodePosition(targetPos), *restoreToTimestampStr)
+	} else if targetPos, err = mysql.DecodePosition(*restoreToPos); err != nil {
+		return vterrors.New(vtrpcpb.Code_INVALID_ARGUMENT, fmt.Sprintf("unable to parse the restore position value provided of '%s'", *restoreToPos))
+	}
+
+	req := &vtctldatapb.RestoreFromBackupRequest{
+		TabletAlias:  tabletAlias,
+		RestoreToPos: mysql.EncodePosition(targetPos),
+		DryRun:       *dryRun,
+	}
+	if err := wr.VtctldServer().RestoreFromBackup(req, &backupRestoreEventStreamLogger{logger: wr.Logger(), ctx: ctx}); err != nil {
+		return err
+	}
+	if *dryRun {
+		return nil
+	}
+
+	recovered, err := wr.TabletManagerClient().PrimaryPosition(ctx, ti.Tablet)
+	if err != nil {
+		return err
+	}
+	recoveredPos, err := mysql.DecodePosition(recovered)
+	if err != nil {
+		return err
+	}
+	if !recoveredPos.AtLeast(targetPos) {
+		return vterrors.Errorf(vtrpcpb.Code_INTERNAL, "tablet %v recovered to position %v, which doesn't contain the target position %v", subFlags.Arg(0), recovered, mysql.EncodePosition(targetPos))
+	}
+	wr.Logger().Printf("Tablet %v recovered to position %v\n", subFlags.Arg(0), recovered)
+	return nil
+}
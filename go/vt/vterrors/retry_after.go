@@ -0,0 +1,43 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vterrors
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// The errors can suggest how long the clients should wait before they retry
+// the query, with a "(retry after <duration>)" in their message, which
+// survives the wrapping of the error as it goes from the tablet to vtgate and
+// to the clients.
+
+// retryAfterRegexp finds the suggested delay in the message of an error.
+var retryAfterRegexp = regexp.MustCompile(`\(retry after ([0-9.a-zµ]+)\)`)
+
+// RetryAfterSuffix returns the suffix of the message of an error which
+// suggests to retry after a delay.
+func RetryAfterSuffix(d time.Duration) string {
+	return fmt.Sprintf(" (retry after %v)", d)
+}
+
+// RetryAfter returns the delay an error suggests to retry after, false if
+// it suggests none.
+func RetryAfter(err error) (time.Duration, bool) {
+	if err == nil {
+		return 0, false
+	}
+	match := retryAfterRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, false
+	}
+	d, parseErr := time.ParseDuration(match[1])
+	if parseErr != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,34 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vterrors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func TestRetryAfter(t *testing.T) {
+	err := Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "disallowed due to rule: busy%s", RetryAfterSuffix(1500*time.Millisecond))
+	assert.EqualError(t, err, "disallowed due to rule: busy (retry after 1.5s)")
+	d, ok := RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, d)
+
+	// The delay survives the wrapping of the error.
+	d, ok = RetryAfter(fmt.Errorf("target: ks.0.primary: vttablet: rpc error: code = ResourceExhausted desc = %w", err))
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, d)
+
+	_, ok = RetryAfter(Errorf(vtrpcpb.Code_UNAVAILABLE, "disallowed due to rule: busy"))
+	assert.False(t, ok)
+	_, ok = RetryAfter(nil)
+	assert.False(t, ok)
+}
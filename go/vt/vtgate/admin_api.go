@@ -0,0 +1,734 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/schema"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// The admin API serves the operations described by adminapi.Spec under
+// /api/v1/. The filters, the user groups, the migrations and the plugins are
+// administered with the SQL statements a MySQL client would run, executed
+// through VTGate.Execute by the authenticated user, so the API needs no
+// privileges of its own. The actions of the filters are described by the
+// schemas of their params, which the filters are checked against before they
+// are written, their changes are kept as versions they can be rolled back
+// to, and they are exported and imported as documents. The routing is
+// changed like with SET GLOBAL, the health and the load of the tablets are
+// the ones the health checks of vtgate see, and the workload is captured
+// from the query logger.
+
+var (
+	enableAdminAPI bool
+
+	adminAPIRequests = stats.NewCountersWithMultiLabels("AdminAPIRequests", "Admin API requests, by operation and HTTP status code", []string{"Operation", "Code"})
+)
+
+// adminAPIFilterTable is the table the tablets load the filters from, with
+// the default --database_custom_rule_db_name and
+// --database_custom_rule_table_name.
+const adminAPIFilterTable = "mysql.wescale_plugin"
+
+// adminAPIFilterPriority is the default priority of the filters.
+const adminAPIFilterPriority = 1000
+
+const adminAPIFilterColumns = "name, description, priority, status, plans, fully_qualified_table_names, query_regex, query_template, request_ip_regex, user_regex, workload_class_regex, leading_comment_regex, trailing_comment_regex, bind_var_conds, action, action_args, schedule, outcome_conds, request_cidrs, user_groups, in_transaction, query_digest, expires_at, access_conds"
+
+func registerAdminAPIFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&enableAdminAPI, "enable_admin_api", enableAdminAPI, "(Experimental) If set, serve the admin API of the filters, the online DDL migrations and the routing under /api/v1/, described by /api/v1/openapi.json. The users are authenticated like with --enable_query_api.")
+	fs.BoolVar(&enableWorkloadCapture, "admin_api_workload_capture", enableWorkloadCapture, "If set, the admin API can capture the queries vtgate serves, with their bind variables, to replay them against another cluster.")
+}
+
+// adminAPIHandler serves the admin API.
+type adminAPIHandler struct {
+	vtg        *VTGate
+	authServer mysql.AuthServer
+}
+
+// adminAPIRequest is a request being served.
+type adminAPIRequest struct {
+	*http.Request
+	ctx      context.Context
+	keyspace string
+	// segments are the segments of the path after the prefix of the API.
+	segments []string
+}
+
+// adminAPIOperation serves an operation, and returns the status code and the
+// body of the response.
+type adminAPIOperation func(req *adminAPIRequest) (int, any, error)
+
+func (ah *adminAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, adminapi.PathPrefix), "/"), "/")
+	name, operation, allowed := ah.route(r.Method, segments)
+	if operation == nil {
+		status, err := http.StatusNotFound, vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "no operation at %s", r.URL.Path)
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			status, err = http.StatusMethodNotAllowed, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%s doesn't accept %s requests", r.URL.Path, r.Method)
+		}
+		ah.sendError(w, "unknown", status, err)
+		return
+	}
+	if name == "getSpec" {
+		adminAPIRequests.Add([]string{name, strconv.Itoa(http.StatusOK)}, 1)
+		w.Header().Set("Content-Type", jsonContentType)
+		_, _ = w.Write(adminapi.Spec)
+		return
+	}
+
+	user, userData, err := authenticateHTTP(ah.authServer, r)
+	if err != nil {
+		if vterrors.Code(err) == vtrpcpb.Code_UNAUTHENTICATED {
+			w.Header().Set("WWW-Authenticate", `Basic realm="vtgate"`)
+		}
+		ah.sendError(w, name, httpStatus(err), err)
+		return
+	}
+	if name == "captureWorkload" {
+		ah.captureWorkload(w, r)
+		return
+	}
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if mysqlQueryTimeout != 0 {
+		ctx, cancel = context.WithTimeout(ctx, mysqlQueryTimeout)
+	}
+	defer cancel()
+	ef := callerid.NewEffectiveCallerID(
+		user,         /* principal: who */
+		r.RemoteAddr, /* component: running client process */
+		"VTGate Admin API" /* subcomponent: part of the client */)
+	ctx = callerid.NewContext(ctx, ef, userData.Get())
+
+	status, resp, err := operation(&adminAPIRequest{
+		Request:  r,
+		ctx:      ctx,
+		keyspace: r.URL.Query().Get("keyspace"),
+		segments: segments,
+	})
+	if err != nil {
+		ah.sendError(w, name, status, err)
+		return
+	}
+	adminAPIRequests.Add([]string{name, strconv.Itoa(status)}, 1)
+	if resp == nil {
+		w.WriteHeader(status)
+		return
+	}
+	if doc, ok := resp.(adminAPIDocument); ok {
+		w.Header().Set("Content-Type", doc.contentType)
+		w.WriteHeader(status)
+		_, _ = w.Write(doc.body)
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// route returns the operation of a request, named like in the spec, or the
+// methods allowed on its path if there is none for its method.
+func (ah *adminAPIHandler) route(method string, segments []string) (string, adminAPIOperation, []string) {
+	type route struct {
+		name      string
+		operation adminAPIOperation
+	}
+	var routes map[string]route
+	switch {
+	case len(segments) == 1 && segments[0] == "openapi.json":
+		routes = map[string]route{http.MethodGet: {"getSpec", func(*adminAPIRequest) (int, any, error) { return 0, nil, nil }}}
+	case len(segments) == 1 && segments[0] == "filters":
+		routes = map[string]route{http.MethodGet: {"listFilters", ah.listFilters}, http.MethodPost: {"createFilter", ah.createFilter}}
+	case len(segments) == 2 && segments[0] == "filters":
+		routes = map[string]route{http.MethodGet: {"getFilter", ah.getFilter}, http.MethodPut: {"updateFilter", ah.updateFilter}, http.MethodDelete: {"deleteFilter", ah.deleteFilter}}
+	case len(segments) == 3 && segments[0] == "filters" && segments[2] == "versions":
+		routes = map[string]route{http.MethodGet: {"listFilterVersions", ah.listFilterVersions}}
+	case len(segments) == 3 && segments[0] == "filters" && segments[2] == "rollback":
+		routes = map[string]route{http.MethodPost: {"rollbackFilter", ah.rollbackFilter}}
+	case len(segments) == 1 && segments[0] == "filter_document":
+		routes = map[string]route{http.MethodGet: {"exportFilters", ah.exportFilters}, http.MethodPost: {"importFilters", ah.importFilters}}
+	case len(segments) == 1 && segments[0] == "actions":
+		routes = map[string]route{http.MethodGet: {"listActions", ah.listActions}}
+	case len(segments) == 2 && segments[0] == "actions":
+		routes = map[string]route{http.MethodGet: {"getAction", ah.getAction}}
+	case len(segments) == 1 && segments[0] == "user_groups":
+		routes = map[string]route{http.MethodGet: {"listUserGroups", ah.listUserGroups}}
+	case len(segments) == 2 && segments[0] == "user_groups":
+		routes = map[string]route{http.MethodGet: {"getUserGroup", ah.getUserGroup}, http.MethodPut: {"setUserGroup", ah.setUserGroup}, http.MethodDelete: {"deleteUserGroup", ah.deleteUserGroup}}
+	case len(segments) == 1 && segments[0] == "migrations":
+		routes = map[string]route{http.MethodGet: {"listMigrations", ah.listMigrations}, http.MethodPost: {"submitMigration", ah.submitMigration}}
+	case len(segments) == 2 && segments[0] == "migrations":
+		routes = map[string]route{http.MethodGet: {"getMigration", ah.getMigration}}
+	case len(segments) == 3 && segments[0] == "migrations":
+		routes = map[string]route{http.MethodPost: {"alterMigration", ah.alterMigration}}
+	case len(segments) == 1 && segments[0] == "routing":
+		routes = map[string]route{http.MethodGet: {"getRouting", ah.getRouting}, http.MethodPatch: {"updateRouting", ah.updateRouting}}
+	case len(segments) == 1 && segments[0] == "plugins":
+		routes = map[string]route{http.MethodGet: {"listPlugins", ah.listPlugins}, http.MethodPost: {"installPlugin", ah.installPlugin}}
+	case len(segments) == 2 && segments[0] == "plugins":
+		routes = map[string]route{http.MethodGet: {"getPlugin", ah.getPlugin}}
+	case len(segments) == 3 && segments[0] == "plugins" && segments[2] == "versions":
+		routes = map[string]route{http.MethodPost: {"upgradePlugin", ah.upgradePlugin}}
+	case len(segments) == 3 && segments[0] == "plugins" && segments[2] == "rollback":
+		routes = map[string]route{http.MethodPost: {"rollbackPlugin", ah.rollbackPlugin}}
+	case len(segments) == 1 && segments[0] == "health":
+		routes = map[string]route{http.MethodGet: {"getHealth", ah.getHealth}}
+	case len(segments) == 1 && segments[0] == "load":
+		routes = map[string]route{http.MethodGet: {"getLoad", ah.getLoad}}
+	case len(segments) == 2 && segments[0] == "workload" && segments[1] == "capture":
+		routes = map[string]route{http.MethodGet: {"captureWorkload", func(*adminAPIRequest) (int, any, error) { return 0, nil, nil }}}
+	}
+	if route, ok := routes[method]; ok {
+		return route.name, route.operation, nil
+	}
+	var allowed []string
+	for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if _, ok := routes[m]; ok {
+			allowed = append(allowed, m)
+		}
+	}
+	return "", nil, allowed
+}
+
+func (ah *adminAPIHandler) sendError(w http.ResponseWriter, name string, status int, err error) {
+	adminAPIRequests.Add([]string{name, strconv.Itoa(status)}, 1)
+	code, sqlState, message := sqlErrorFields(err)
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(adminapi.ErrorResponse{Error: adminapi.Error{Code: code, SQLState: sqlState, Message: message}})
+}
+
+// execute runs a statement in its own session, targeting the primary tablets
+// of the keyspace of the request.
+func (ah *adminAPIHandler) execute(req *adminAPIRequest, session *vtgatepb.Session, sql string, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	if session == nil {
+		session = newSession()
+	}
+	session.TargetString = req.keyspace + "@primary"
+	atomic.AddInt32(&busyConnections, 1)
+	defer atomic.AddInt32(&busyConnections, -1)
+	session, result, err := ah.vtg.Execute(req.ctx, session, sql, bindVars)
+	_ = ah.vtg.CloseSession(req.ctx, session)
+	return result, err
+}
+
+// decodeBody decodes the JSON body of a request into v.
+func decodeBody(req *adminAPIRequest, v any) error {
+	decoder := json.NewDecoder(io.LimitReader(req.Body, maxQueryAPIRequestSize))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: %v", err)
+	}
+	return nil
+}
+
+// fail returns the response to a failed operation.
+func fail(err error) (int, any, error) {
+	return httpStatus(err), nil, err
+}
+
+func (ah *adminAPIHandler) listFilters(req *adminAPIRequest) (int, any, error) {
+	filters, err := ah.selectFilters(req, "", nil)
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, adminapi.FilterList{Filters: filters}, nil
+}
+
+func (ah *adminAPIHandler) getFilter(req *adminAPIRequest) (int, any, error) {
+	filter, err := ah.selectFilter(req, req.segments[1])
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, filter, nil
+}
+
+func (ah *adminAPIHandler) createFilter(req *adminAPIRequest) (int, any, error) {
+	filter, bindVars, err := filterBindVars(req, "")
+	if err != nil {
+		return fail(err)
+	}
+	err = ah.executeInTransaction(req, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		if _, err := execute(insertFilterQuery, bindVars); err != nil {
+			return err
+		}
+		return addFilterVersion(req.ctx, execute, filter.Name, adminapi.FilterCreated, filter, 0)
+	})
+	if err != nil {
+		return fail(err)
+	}
+	created, err := ah.selectFilter(req, filter.Name)
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusCreated, created, nil
+}
+
+// insertFilterQuery inserts the filter of the column values :name,
+// :description, ..., which filterBindVars returns.
+const insertFilterQuery = "insert into " + adminAPIFilterTable + " (" + adminAPIFilterColumns + ") values (:name, :description, :priority, :status, :plans, :fully_qualified_table_names, :query_regex, :query_template, :request_ip_regex, :user_regex, :workload_class_regex, :leading_comment_regex, :trailing_comment_regex, :bind_var_conds, :action, :action_args, :schedule, :outcome_conds, :request_cidrs, :user_groups, :in_transaction, :query_digest, :expires_at, :access_conds)"
+
+func (ah *adminAPIHandler) updateFilter(req *adminAPIRequest) (int, any, error) {
+	name := req.segments[1]
+	filter, bindVars, err := filterBindVars(req, name)
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := ah.selectFilter(req, name); err != nil {
+		return fail(err)
+	}
+	err = ah.executeInTransaction(req, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		if _, err := execute(updateFilterQuery, bindVars); err != nil {
+			return err
+		}
+		return addFilterVersion(req.ctx, execute, name, adminapi.FilterUpdated, filter, 0)
+	})
+	if err != nil {
+		return fail(err)
+	}
+	updated, err := ah.selectFilter(req, name)
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, updated, nil
+}
+
+// updateFilterQuery replaces filter :name with the one of the column values
+// which filterBindVars returns.
+const updateFilterQuery = "update " + adminAPIFilterTable + " set description = :description, priority = :priority, status = :status, plans = :plans, fully_qualified_table_names = :fully_qualified_table_names, query_regex = :query_regex, query_template = :query_template, request_ip_regex = :request_ip_regex, user_regex = :user_regex, workload_class_regex = :workload_class_regex, leading_comment_regex = :leading_comment_regex, trailing_comment_regex = :trailing_comment_regex, bind_var_conds = :bind_var_conds, action = :action, action_args = :action_args, schedule = :schedule, outcome_conds = :outcome_conds, request_cidrs = :request_cidrs, user_groups = :user_groups, in_transaction = :in_transaction, query_digest = :query_digest, expires_at = :expires_at, access_conds = :access_conds where name = :name"
+
+func (ah *adminAPIHandler) deleteFilter(req *adminAPIRequest) (int, any, error) {
+	name := req.segments[1]
+	err := ah.executeInTransaction(req, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		result, err := execute("delete from "+adminAPIFilterTable+" where name = :name", map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name)})
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "filter %s not found", name)
+		}
+		return addFilterVersion(req.ctx, execute, name, adminapi.FilterDeleted, nil, 0)
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (ah *adminAPIHandler) selectFilter(req *adminAPIRequest, name string) (*adminapi.Filter, error) {
+	filters, err := ah.selectFilters(req, " where name = :name", map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name)})
+	if err != nil {
+		return nil, err
+	}
+	if len(filters) == 0 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "filter %s not found", name)
+	}
+	return &filters[0], nil
+}
+
+func (ah *adminAPIHandler) selectFilters(req *adminAPIRequest, where string, bindVars map[string]*querypb.BindVariable) ([]adminapi.Filter, error) {
+	result, err := ah.execute(req, nil, "select "+adminAPIFilterColumns+" from "+adminAPIFilterTable+where+" order by priority, name", bindVars)
+	if err != nil {
+		return nil, err
+	}
+	return filtersFromResult(result)
+}
+
+// filtersFromResult returns the filters of the rows of a select of
+// adminAPIFilterColumns.
+func filtersFromResult(result *sqltypes.Result) ([]adminapi.Filter, error) {
+	filters := make([]adminapi.Filter, 0, len(result.Rows))
+	for _, row := range result.Named().Rows {
+		filter := adminapi.Filter{
+			Name:                 row.AsString("name", ""),
+			Description:          row.AsString("description", ""),
+			Priority:             int(row.AsInt64("priority", 0)),
+			Status:               row.AsString("status", ""),
+			QueryRegex:           row.AsString("query_regex", ""),
+			QueryTemplate:        row.AsString("query_template", ""),
+			QueryDigest:          row.AsString("query_digest", ""),
+			RequestIPRegex:       row.AsString("request_ip_regex", ""),
+			UserRegex:            row.AsString("user_regex", ""),
+			WorkloadClassRegex:   row.AsString("workload_class_regex", ""),
+			LeadingCommentRegex:  row.AsString("leading_comment_regex", ""),
+			TrailingCommentRegex: row.AsString("trailing_comment_regex", ""),
+			Action:               row.AsString("action", ""),
+			ActionArgs:           row.AsString("action_args", ""),
+			Schedule:             row.AsString("schedule", ""),
+			OutcomeConds:         row.AsString("outcome_conds", ""),
+			AccessConds:          row.AsString("access_conds", ""),
+		}
+		if !row["in_transaction"].IsNull() {
+			inTransaction := row.AsInt64("in_transaction", 0) != 0
+			filter.InTransaction = &inTransaction
+		}
+		if data := row.AsString("expires_at", ""); data != "" {
+			expiresAt, err := time.ParseInLocation(rules.ExpiresAtLayout, data, time.UTC)
+			if err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "invalid expires_at of filter %s: %v", filter.Name, err)
+			}
+			filter.ExpiresAt = &expiresAt
+		}
+		for column, v := range map[string]any{
+			"plans":                       &filter.Plans,
+			"fully_qualified_table_names": &filter.FullyQualifiedTableNames,
+			"bind_var_conds":              &filter.BindVarConds,
+			"request_cidrs":               &filter.RequestCIDRs,
+			"user_groups":                 &filter.UserGroups,
+		} {
+			if data := row.AsString(column, ""); data != "" {
+				if err := json.Unmarshal([]byte(data), v); err != nil {
+					return nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "invalid %s of filter %s: %v", column, filter.Name, err)
+				}
+			}
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// filterBindVars returns the filter in the body of a request and its column
+// values, checking that the tablets can load it. If name is set, the filter
+// must have that name.
+func filterBindVars(req *adminAPIRequest, name string) (*adminapi.Filter, map[string]*querypb.BindVariable, error) {
+	// The defaults are the ones of the table.
+	filter := adminapi.Filter{Name: name, Priority: adminAPIFilterPriority, Status: rules.Active}
+	if err := decodeBody(req, &filter); err != nil {
+		return nil, nil, err
+	}
+	if filter.Name == "" {
+		return nil, nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: no name")
+	}
+	if name != "" && filter.Name != name {
+		return nil, nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: the name of filter %s can't change to %s", name, filter.Name)
+	}
+	if filter.Action == "" {
+		return nil, nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: no action")
+	}
+	bindVars, err := ruleBindVars(&filter)
+	if err != nil {
+		return nil, nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid filter: %v", err)
+	}
+	return &filter, bindVars, nil
+}
+
+// ruleBindVars returns the column values of a filter, checking that the
+// tablets can load it.
+func ruleBindVars(filter *adminapi.Filter) (map[string]*querypb.BindVariable, error) {
+	rule, err := rules.BuildQueryRule(filter.RuleInfo())
+	if err != nil {
+		return nil, err
+	}
+	if err := rule.ValidateActionArgs(); err != nil {
+		return nil, err
+	}
+	return rule.ToBindVariable()
+}
+
+func (ah *adminAPIHandler) listActions(*adminAPIRequest) (int, any, error) {
+	list := adminapi.ActionList{Actions: []adminapi.Action{}}
+	for _, schema := range rules.ActionSchemas() {
+		list.Actions = append(list.Actions, adminAction(schema))
+	}
+	return http.StatusOK, list, nil
+}
+
+func (ah *adminAPIHandler) getAction(req *adminAPIRequest) (int, any, error) {
+	act, err := rules.ParseStringToAction(req.segments[1])
+	if err != nil {
+		return fail(vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "action %s not found", req.segments[1]))
+	}
+	schema, ok := act.Schema()
+	if !ok {
+		return fail(vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "action %s has no described params", req.segments[1]))
+	}
+	return http.StatusOK, adminAction(schema), nil
+}
+
+// adminAction returns the description of an action in the API.
+func adminAction(schema *rules.ActionSchema) adminapi.Action {
+	return adminapi.Action{
+		Action:      schema.Action.ToString(),
+		Description: schema.Description,
+		Params:      adminActionParams(schema.Params),
+		Constraints: adminActionConstraints(schema.Constraints),
+	}
+}
+
+func adminActionParams(params []rules.ActionParam) []adminapi.ActionParam {
+	var ps []adminapi.ActionParam
+	for i := range params {
+		ps = append(ps, adminActionParam(&params[i]))
+	}
+	return ps
+}
+
+func adminActionParam(p *rules.ActionParam) adminapi.ActionParam {
+	param := adminapi.ActionParam{
+		Name:        p.Name,
+		Type:        string(p.Type),
+		Description: p.Description,
+		Required:    p.Required,
+		Default:     p.Default,
+		Range:       p.Range(),
+		Enum:        p.Enum,
+		Keys:        p.Keys,
+		Params:      adminActionParams(p.Params),
+		Constraints: adminActionConstraints(p.Constraints),
+		Captures:    p.Captures,
+	}
+	if p.Items != nil {
+		items := adminActionParam(p.Items)
+		param.Items = &items
+	}
+	return param
+}
+
+func adminActionConstraints(constraints []rules.ActionParamsConstraint) []string {
+	var cs []string
+	for _, c := range constraints {
+		cs = append(cs, c.Description)
+	}
+	return cs
+}
+
+func (ah *adminAPIHandler) listMigrations(req *adminAPIRequest) (int, any, error) {
+	migrations, err := ah.showMigrations(req, "show vitess_migrations")
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, adminapi.MigrationList{Migrations: migrations}, nil
+}
+
+func (ah *adminAPIHandler) getMigration(req *adminAPIRequest) (int, any, error) {
+	uuid := req.segments[1]
+	if !schema.IsOnlineDDLUUID(uuid) {
+		return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid migration UUID %s", uuid))
+	}
+	migrations, err := ah.showMigrations(req, fmt.Sprintf("show vitess_migrations like '%s'", uuid))
+	if err != nil {
+		return fail(err)
+	}
+	if len(migrations) == 0 {
+		return fail(vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "migration %s not found", uuid))
+	}
+	return http.StatusOK, adminapi.MigrationList{Migrations: migrations}, nil
+}
+
+func (ah *adminAPIHandler) showMigrations(req *adminAPIRequest, sql string) ([]adminapi.Migration, error) {
+	result, err := ah.execute(req, nil, sql, nil)
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]adminapi.Migration, 0, len(result.Rows))
+	for _, row := range result.Named().Rows {
+		migrations = append(migrations, adminapi.Migration{
+			UUID:        row.AsString("migration_uuid", ""),
+			Keyspace:    row.AsString("keyspace", ""),
+			Shard:       row.AsString("shard", ""),
+			Table:       row.AsString("mysql_table", ""),
+			Statement:   row.AsString("migration_statement", ""),
+			Strategy:    row.AsString("strategy", ""),
+			Options:     row.AsString("options", ""),
+			Status:      row.AsString("migration_status", ""),
+			Message:     row.AsString("message", ""),
+			Progress:    row.AsFloat64("progress", 0),
+			AddedAt:     row.AsString("added_timestamp", ""),
+			StartedAt:   row.AsString("started_timestamp", ""),
+			CompletedAt: row.AsString("completed_timestamp", ""),
+		})
+	}
+	return migrations, nil
+}
+
+func (ah *adminAPIHandler) submitMigration(req *adminAPIRequest) (int, any, error) {
+	var migration adminapi.MigrationRequest
+	if err := decodeBody(req, &migration); err != nil {
+		return fail(err)
+	}
+	if migration.SQL == "" {
+		return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: no sql"))
+	}
+	session := newSession()
+	if migration.Strategy != "" {
+		if _, err := schema.ParseDDLStrategy(migration.Strategy); err != nil {
+			return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid DDL strategy %s: %v", migration.Strategy, err))
+		}
+		session.DDLStrategy = migration.Strategy
+	}
+	req.keyspace = migration.Keyspace
+	result, err := ah.execute(req, session, migration.SQL, nil)
+	if err != nil {
+		return fail(err)
+	}
+	resp := adminapi.MigrationResponse{UUIDs: []string{}}
+	for _, row := range result.Named().Rows {
+		resp.UUIDs = append(resp.UUIDs, row.AsString("uuid", ""))
+	}
+	return http.StatusCreated, resp, nil
+}
+
+func (ah *adminAPIHandler) alterMigration(req *adminAPIRequest) (int, any, error) {
+	uuid, action := req.segments[1], req.segments[2]
+	if !schema.IsOnlineDDLUUID(uuid) {
+		return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid migration UUID %s", uuid))
+	}
+	known := false
+	for _, a := range adminapi.MigrationActions {
+		known = known || a == action
+	}
+	if !known {
+		return fail(vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "unknown migration action %s", action))
+	}
+	if _, err := ah.execute(req, nil, fmt.Sprintf("alter vitess_migration '%s' %s", uuid, action), nil); err != nil {
+		return fail(err)
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (ah *adminAPIHandler) getRouting(*adminAPIRequest) (int, any, error) {
+	return http.StatusOK, currentRouting(), nil
+}
+
+func (ah *adminAPIHandler) updateRouting(req *adminAPIRequest) (int, any, error) {
+	var update adminapi.RoutingUpdate
+	if err := decodeBody(req, &update); err != nil {
+		return fail(err)
+	}
+	// All the fields are checked before any is changed.
+	var setters []func() error
+	if update.ReadWriteSplittingPolicy != nil {
+		policy := *update.ReadWriteSplittingPolicy
+		if _, err := schema.ParseReadWriteSplittingPolicySetting(policy); err != nil || policy == "" {
+			return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid read_write_splitting_policy %s", policy))
+		}
+		setters = append(setters, func() error { return SetDefaultReadWriteSplittingPolicy(policy) })
+	}
+	if update.ReadWriteSplittingRatio != nil {
+		ratio := *update.ReadWriteSplittingRatio
+		if err := schema.CheckReadWriteSplittingRateRange(int32(ratio)); err != nil {
+			return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid read_write_splitting_ratio %d: %v", ratio, err))
+		}
+		setters = append(setters, func() error { return SetDefaultReadWriteSplittingRatio(strconv.Itoa(ratio)) })
+	}
+	if update.ReadAfterWriteConsistency != nil {
+		consistency := *update.ReadAfterWriteConsistency
+		if err := ValidateReadAfterWriteConsistency(consistency); err != nil {
+			return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid read_after_write_consistency %s: %v", consistency, err))
+		}
+		setters = append(setters, func() error { return SetDefaultReadAfterWriteConsistency(consistency) })
+	}
+	if update.ReadAfterWriteTimeout != nil {
+		timeout := *update.ReadAfterWriteTimeout
+		if timeout < 0 {
+			return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid read_after_write_timeout %v", timeout))
+		}
+		setters = append(setters, func() error {
+			return SetDefaultReadAfterWriteTimeout(strconv.FormatFloat(timeout, 'f', -1, 64))
+		})
+	}
+	for _, set := range setters {
+		if err := set(); err != nil {
+			return fail(err)
+		}
+	}
+	return http.StatusOK, currentRouting(), nil
+}
+
+func currentRouting() adminapi.Routing {
+	return adminapi.Routing{
+		ReadWriteSplittingPolicy:  defaultReadWriteSplittingPolicy,
+		ReadWriteSplittingRatio:   defaultReadWriteSplittingRatio,
+		ReadAfterWriteConsistency: defaultReadAfterWriteConsistencyName,
+		ReadAfterWriteTimeout:     defaultReadAfterWriteTimeout,
+	}
+}
+
+// getHealth reports the health of the tablets of a keyspace, or of all the
+// tablets if the request has no keyspace.
+func (ah *adminAPIHandler) getHealth(req *adminAPIRequest) (int, any, error) {
+	health := adminapi.Health{Tablets: []adminapi.TabletHealth{}}
+	for _, status := range ah.vtg.Gateway().TabletsCacheStatus() {
+		if req.keyspace != "" && status.Target.Keyspace != req.keyspace {
+			continue
+		}
+		for _, th := range status.TabletsStats {
+			tablet := adminapi.TabletHealth{
+				Alias:      topoproto.TabletAliasString(th.Tablet.Alias),
+				Hostname:   th.Tablet.Hostname,
+				Keyspace:   th.Target.Keyspace,
+				Shard:      th.Target.Shard,
+				TabletType: strings.ToLower(th.Target.TabletType.String()),
+				Serving:    th.Serving,
+			}
+			if th.Stats != nil {
+				tablet.ReplicationLagSeconds = th.Stats.ReplicationLagSeconds
+				tablet.QPS = th.Stats.Qps
+				tablet.Error = th.Stats.HealthError
+			}
+			if th.LastError != nil {
+				tablet.Error = th.LastError.Error()
+			}
+			health.Tablets = append(health.Tablets, tablet)
+		}
+	}
+	sort.Slice(health.Tablets, func(i, j int) bool { return health.Tablets[i].Alias < health.Tablets[j].Alias })
+	return http.StatusOK, health, nil
+}
+
+// getLoad reports the load signals of the tablets of a keyspace, or of all
+// the tablets if the request has no keyspace, and of this vtgate.
+func (ah *adminAPIHandler) getLoad(req *adminAPIRequest) (int, any, error) {
+	return http.StatusOK, adminapi.Load{
+		VTGate: vtgateLoad(),
+		Shards: shardLoads(ah.vtg.Gateway().TabletsCacheStatus(), req.keyspace),
+	}, nil
+}
+
+// initAdminAPI registers the admin API handler, if it is enabled.
+func initAdminAPI() {
+	if !enableAdminAPI || rpcVTGate == nil {
+		return
+	}
+	initPluginsWithoutMySQLProtocol()
+	http.Handle(adminapi.PathPrefix, &adminAPIHandler{
+		vtg:        rpcVTGate,
+		authServer: mysql.GetAuthServer(mysqlAuthServerImpl),
+	})
+}
+
+func init() {
+	servenv.OnParseFor("vtgate", registerAdminAPIFlags)
+	servenv.OnParseFor("vtcombo", registerAdminAPIFlags)
+
+	servenv.OnRun(initAdminAPI)
+}
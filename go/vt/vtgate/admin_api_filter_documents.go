@@ -0,0 +1,240 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/yaml2"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// The filters are exported to and imported from documents, in JSON or YAML,
+// by the admin API and by the EXPORT FILTERS and IMPORT FILTERS statements,
+// to manage them in version control. A document has the filters of a
+// database, the ones whose names it qualifies, or all the filters. An import
+// checks all the filters of the document before it changes any, then
+// creates, updates and, if it prunes, deletes the filters in one
+// transaction, each change adding a version to the filter.
+
+// adminAPIDocument is a response sent as is, like a YAML document.
+type adminAPIDocument struct {
+	contentType string
+	body        []byte
+}
+
+func (ah *adminAPIHandler) exportFilters(req *adminAPIRequest) (int, any, error) {
+	query := req.URL.Query()
+	filters, err := ah.selectFilters(req, "", nil)
+	if err != nil {
+		return fail(err)
+	}
+	format := query.Get("format")
+	data, err := encodeFilterDocument(filterDocument(filters, query.Get("database")), format)
+	if err != nil {
+		return fail(err)
+	}
+	contentType := jsonContentType
+	if format == "yaml" {
+		contentType = "application/yaml"
+	}
+	return http.StatusOK, adminAPIDocument{contentType: contentType, body: data}, nil
+}
+
+func (ah *adminAPIHandler) importFilters(req *adminAPIRequest) (int, any, error) {
+	query := req.URL.Query()
+	opts := adminapi.FilterImportOptions{Database: query.Get("database")}
+	for param, v := range map[string]*bool{"prune": &opts.Prune, "dry_run": &opts.DryRun} {
+		if value := query.Get(param); value != "" {
+			var err error
+			if *v, err = strconv.ParseBool(value); err != nil {
+				return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid %s %q", param, value))
+			}
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(req.Body, maxQueryAPIRequestSize))
+	if err != nil {
+		return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: %v", err))
+	}
+	doc, err := parseFilterDocument(data, opts.Database)
+	if err != nil {
+		return fail(err)
+	}
+	var result *adminapi.FilterImportResult
+	err = ah.executeInTransaction(req, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		result, err = importFilterDocument(req.ctx, execute, doc, opts)
+		return err
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, result, nil
+}
+
+// filterDocument returns the document of the filters of a database, or of all
+// the filters if database is empty.
+func filterDocument(filters []adminapi.Filter, database string) *adminapi.FilterDocument {
+	doc := &adminapi.FilterDocument{Database: database, Filters: []adminapi.Filter{}}
+	for _, filter := range filters {
+		if database == "" || filterDatabase(filter.Name) == database {
+			doc.Filters = append(doc.Filters, filter)
+		}
+	}
+	return doc
+}
+
+// filterDatabase returns the database which qualifies the name of a filter,
+// see rules.Rule.Namespace.
+func filterDatabase(name string) string {
+	return (&rules.Rule{Name: name}).Namespace()
+}
+
+// encodeFilterDocument encodes a document in a format, json by default or
+// yaml.
+func encodeFilterDocument(doc *adminapi.FilterDocument, format string) ([]byte, error) {
+	switch format {
+	case "", "json":
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case "yaml":
+		return yaml2.Marshal(doc)
+	default:
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unknown format %s, expected json or yaml", format)
+	}
+}
+
+// parseFilterDocument parses a JSON or YAML document, whose filters have the
+// defaults of the table, and checks that its filters are in database if set.
+func parseFilterDocument(data []byte, database string) (*adminapi.FilterDocument, error) {
+	// The YAML documents are converted to JSON, so the filters are decoded
+	// like the ones of the other operations.
+	var raw struct {
+		Database string            `json:"database"`
+		Filters  []json.RawMessage `json:"filters"`
+	}
+	if err := yaml2.Unmarshal(data, &raw); err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid document: %v", err)
+	}
+	if database != "" && raw.Database != "" && raw.Database != database {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid document: it has the filters of database %s, not %s", raw.Database, database)
+	}
+	if database == "" {
+		database = raw.Database
+	}
+	doc := &adminapi.FilterDocument{Database: database}
+	names := map[string]bool{}
+	for i, data := range raw.Filters {
+		filter := adminapi.Filter{Priority: adminAPIFilterPriority, Status: rules.Active}
+		if err := json.Unmarshal(data, &filter); err != nil {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid document: filter %d: %v", i+1, err)
+		}
+		switch {
+		case filter.Name == "":
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid document: filter %d has no name", i+1)
+		case names[filter.Name]:
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid document: filter %s is twice in it", filter.Name)
+		case filter.Action == "":
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid document: filter %s has no action", filter.Name)
+		case database != "" && filterDatabase(filter.Name) != database:
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid document: filter %s is not in database %s, its name must start with %s.", filter.Name, database, database)
+		}
+		names[filter.Name] = true
+		doc.Filters = append(doc.Filters, filter)
+	}
+	return doc, nil
+}
+
+// importFilterDocument makes the filters the ones of a document, with the
+// statements of a transaction. The filters are read with the transaction, so
+// the changes are made to the filters they were planned with.
+func importFilterDocument(ctx context.Context, execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error), doc *adminapi.FilterDocument, opts adminapi.FilterImportOptions) (*adminapi.FilterImportResult, error) {
+	qr, err := execute("select "+adminAPIFilterColumns+" from "+adminAPIFilterTable+" order by priority, name for update", nil)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := filtersFromResult(qr)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]*adminapi.Filter, len(existing))
+	for i := range existing {
+		current[existing[i].Name] = &existing[i]
+	}
+
+	// All the filters are checked before any is changed.
+	result := &adminapi.FilterImportResult{Created: []string{}, Updated: []string{}, Deleted: []string{}, Unchanged: []string{}, DryRun: opts.DryRun}
+	bindVars := make(map[string]map[string]*querypb.BindVariable, len(doc.Filters))
+	imported := make(map[string]*adminapi.Filter, len(doc.Filters))
+	for i := range doc.Filters {
+		filter := &doc.Filters[i]
+		bvs, err := ruleBindVars(filter)
+		if err != nil {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid filter %s: %v", filter.Name, err)
+		}
+		bindVars[filter.Name], imported[filter.Name] = bvs, filter
+		old, ok := current[filter.Name]
+		if !ok {
+			result.Created = append(result.Created, filter.Name)
+			continue
+		}
+		// The filters are compared by their column values, which the
+		// defaults and the formats of the values don't change.
+		if oldBindVars, err := ruleBindVars(old); err == nil && sqltypes.BindVariablesEqual(oldBindVars, bvs) {
+			result.Unchanged = append(result.Unchanged, filter.Name)
+		} else {
+			result.Updated = append(result.Updated, filter.Name)
+		}
+	}
+	if opts.Prune {
+		for _, filter := range existing {
+			if imported[filter.Name] == nil && (doc.Database == "" || filterDatabase(filter.Name) == doc.Database) {
+				result.Deleted = append(result.Deleted, filter.Name)
+			}
+		}
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	for _, name := range result.Created {
+		if _, err := execute(insertFilterQuery, bindVars[name]); err != nil {
+			return nil, err
+		}
+		if err := addFilterVersion(ctx, execute, name, adminapi.FilterCreated, imported[name], 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range result.Updated {
+		if _, err := execute(updateFilterQuery, bindVars[name]); err != nil {
+			return nil, err
+		}
+		if err := addFilterVersion(ctx, execute, name, adminapi.FilterUpdated, imported[name], 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range result.Deleted {
+		if _, err := execute("delete from "+adminAPIFilterTable+" where name = :name", map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name)}); err != nil {
+			return nil, err
+		}
+		if err := addFilterVersion(ctx, execute, name, adminapi.FilterDeleted, nil, 0); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/yaml2"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestAdminAPIFilterDocuments(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	sbc := hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	// A document has the filters of a database, the ones its name qualifies.
+	sbc.SetResults([]*sqltypes.Result{filterResult("global", "db.a", "other.b", "db.c")})
+	var doc adminapi.FilterDocument
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "filter_document?database=db", "", &doc))
+	assert.Equal(t, "db", doc.Database)
+	require.Len(t, doc.Filters, 2)
+	assert.Equal(t, "db.a", doc.Filters[0].Name)
+	assert.Equal(t, "db.c", doc.Filters[1].Name)
+
+	sbc.SetResults([]*sqltypes.Result{filterResult("db.a")})
+	r := httptest.NewRequest(http.MethodGet, adminapi.PathPrefix+"filter_document?format=yaml", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "- action: FAIL\n")
+	var yamlDoc adminapi.FilterDocument
+	require.NoError(t, yaml2.Unmarshal(w.Body.Bytes(), &yamlDoc))
+	assert.Equal(t, doc.Filters[:1], yamlDoc.Filters)
+
+	var errResp adminapi.ErrorResponse
+	sbc.SetResults([]*sqltypes.Result{filterResult()})
+	assert.Equal(t, http.StatusBadRequest, adminAPIRequestFor(t, handler, http.MethodGet, "filter_document?format=xml", "", &errResp))
+	assert.Contains(t, errResp.Error.Message, "unknown format xml, expected json or yaml")
+
+	// The import of the exported filters, with db.c changed and db.d added,
+	// prunes db.e and keeps the filters of the other databases.
+	doc.Filters[1].Priority = 20
+	doc.Filters = append(doc.Filters, adminapi.Filter{Name: "db.d", Priority: 30, Status: "ACTIVE", Action: "FAIL"})
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{
+		filterResult("global", "db.a", "other.b", "db.c", "db.e"),
+		{RowsAffected: 1}, {RowsAffected: 1}, {RowsAffected: 1}, {RowsAffected: 1}, {RowsAffected: 1}, {RowsAffected: 1},
+	})
+	var result adminapi.FilterImportResult
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodPost, "filter_document?prune=true", string(data), &result))
+	assert.Equal(t, adminapi.FilterImportResult{
+		Created:   []string{"db.d"},
+		Updated:   []string{"db.c"},
+		Deleted:   []string{"db.e"},
+		Unchanged: []string{"db.a"},
+	}, result)
+	require.Len(t, sbc.Queries, 7)
+	assert.Contains(t, sbc.Queries[0].Sql, "for update")
+	assert.Contains(t, sbc.Queries[1].Sql, "insert into mysql.wescale_plugin")
+	assert.Equal(t, "db.d", string(sbc.Queries[1].BindVariables["name"].Value))
+	assert.Contains(t, sbc.Queries[3].Sql, "update mysql.wescale_plugin")
+	assert.Equal(t, "20", string(sbc.Queries[3].BindVariables["priority"].Value))
+	assert.Contains(t, sbc.Queries[5].Sql, "delete from mysql.wescale_plugin")
+	assert.Equal(t, sqltypes.StringBindVariable("delete"), sbc.Queries[6].BindVariables["operation"])
+	assert.EqualValues(t, 1, sbc.CommitCount.Get())
+
+	// A dry run changes nothing.
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{filterResult("db.a")})
+	result = adminapi.FilterImportResult{}
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodPost, "filter_document?dry_run=true", "database: db\nfilters:\n- name: db.b\n  action: FAIL\n", &result))
+	assert.Equal(t, []string{"db.b"}, result.Created)
+	assert.Equal(t, []string{}, result.Deleted)
+	assert.True(t, result.DryRun)
+	assert.Len(t, sbc.Queries, 1)
+
+	// A document is checked before any filter is changed.
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{filterResult()})
+	code := adminAPIRequestFor(t, handler, http.MethodPost, "filter_document", `{"filters": [{"name": "a", "action": "FAIL"}, {"name": "b", "action": "FAIL", "plans": ["NoSuchPlan"]}]}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errResp.Error.Message, "invalid filter b")
+	assert.Contains(t, errResp.Error.Message, "invalid plan name: NoSuchPlan")
+	assert.Len(t, sbc.Queries, 1)
+	assert.EqualValues(t, 2, sbc.CommitCount.Get())
+
+	for _, tc := range []struct {
+		path, body, err string
+	}{
+		{"filter_document", `{"filters": [{"action": "FAIL"}]}`, "filter 1 has no name"},
+		{"filter_document", `{"filters": [{"name": "a"}]}`, "filter a has no action"},
+		{"filter_document", `{"filters": [{"name": "a", "action": "FAIL"}, {"name": "a", "action": "FAIL"}]}`, "filter a is twice in it"},
+		{"filter_document?database=db", `{"filters": [{"name": "a", "action": "FAIL"}]}`, "filter a is not in database db"},
+		{"filter_document?database=db", `{"database": "other", "filters": []}`, "it has the filters of database other, not db"},
+		{"filter_document?prune=maybe", `{"filters": []}`, `invalid prune "maybe"`},
+	} {
+		code := adminAPIRequestFor(t, handler, http.MethodPost, tc.path, tc.body, &errResp)
+		assert.Equal(t, http.StatusBadRequest, code, tc.body)
+		assert.Contains(t, errResp.Error.Message, tc.err)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// The history of the filters is kept in the mysql.wescale_filter_version
+// table. Creating, updating, deleting and rolling back a filter add a version
+// of its definition in the transaction which changes it, numbered from 1 and
+// with the user who made the change. A rollback restores the definition of a
+// previous version, or deletes the filter if it was deleted then, as a new
+// version: the history only grows. The filters the primary tablets delete
+// when they expire have no version of their deletion.
+
+// adminAPIFilterVersionTable is the history of the filters.
+const adminAPIFilterVersionTable = "mysql.wescale_filter_version"
+
+const adminAPIFilterVersionColumns = "name, version, operation, changed_by, definition, rollback_to, create_timestamp"
+
+// addFilterVersionQuery adds the next version of filter :name, in one
+// statement.
+const addFilterVersionQuery = "insert into " + adminAPIFilterVersionTable + " (name, version, operation, changed_by, definition, rollback_to) select :name, ifnull(max(version), 0) + 1, :operation, :changed_by, :definition, :rollback_to from " + adminAPIFilterVersionTable + " where name = :name"
+
+func (ah *adminAPIHandler) listFilterVersions(req *adminAPIRequest) (int, any, error) {
+	versions, err := ah.selectFilterVersions(req, req.segments[1])
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, adminapi.FilterVersionList{Versions: versions}, nil
+}
+
+// rollbackFilter restores a previous version of a filter, and returns the
+// version the rollback added.
+func (ah *adminAPIHandler) rollbackFilter(req *adminAPIRequest) (int, any, error) {
+	name := req.segments[1]
+	var rollback adminapi.FilterRollback
+	if err := decodeBody(req, &rollback); err != nil {
+		return fail(err)
+	}
+	versions, err := ah.selectFilterVersions(req, name)
+	if err != nil {
+		return fail(err)
+	}
+	var target *adminapi.FilterVersion
+	if rollback.Version == 0 {
+		if len(versions) == 1 {
+			return fail(vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "version 1 of filter %s is its first version, there is no version to roll back to", name))
+		}
+		target = &versions[len(versions)-2]
+	} else {
+		for i := range versions {
+			if versions[i].Version == rollback.Version {
+				target = &versions[i]
+			}
+		}
+		if target == nil {
+			return fail(vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "version %d of filter %s not found", rollback.Version, name))
+		}
+	}
+
+	// The actions may have changed since the version was written, so it is
+	// checked again.
+	var bindVars map[string]*querypb.BindVariable
+	if target.Filter != nil {
+		if bindVars, err = ruleBindVars(target.Filter); err != nil {
+			return fail(vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "version %d of filter %s can't be restored: %v", target.Version, name, err))
+		}
+	}
+	err = ah.executeInTransaction(req, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		if _, err := execute("delete from "+adminAPIFilterTable+" where name = :name", map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name)}); err != nil {
+			return err
+		}
+		if bindVars != nil {
+			if _, err := execute(insertFilterQuery, bindVars); err != nil {
+				return err
+			}
+		}
+		return addFilterVersion(req.ctx, execute, name, adminapi.FilterRolledBack, target.Filter, target.Version)
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if versions, err = ah.selectFilterVersions(req, name); err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, versions[len(versions)-1], nil
+}
+
+// addFilterVersion adds the next version of a filter, changed by the user of
+// ctx. filter is nil if it was deleted.
+func addFilterVersion(ctx context.Context, execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error), name, operation string, filter *adminapi.Filter, rollbackTo int64) error {
+	bindVars := map[string]*querypb.BindVariable{
+		"name":        sqltypes.StringBindVariable(name),
+		"operation":   sqltypes.StringBindVariable(operation),
+		"changed_by":  sqltypes.StringBindVariable(callerid.GetPrincipal(callerid.EffectiveCallerIDFromContext(ctx))),
+		"definition":  sqltypes.NullBindVariable,
+		"rollback_to": sqltypes.NullBindVariable,
+	}
+	if filter != nil {
+		data, err := json.Marshal(filter)
+		if err != nil {
+			return err
+		}
+		bindVars["definition"] = sqltypes.StringBindVariable(string(data))
+	}
+	if rollbackTo != 0 {
+		bindVars["rollback_to"] = sqltypes.Int64BindVariable(rollbackTo)
+	}
+	_, err := execute(addFilterVersionQuery, bindVars)
+	return err
+}
+
+// selectFilterVersions returns the versions of a filter, from the first one.
+func (ah *adminAPIHandler) selectFilterVersions(req *adminAPIRequest, name string) ([]adminapi.FilterVersion, error) {
+	result, err := ah.execute(req, nil, "select "+adminAPIFilterVersionColumns+" from "+adminAPIFilterVersionTable+" where name = :name order by version", map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name)})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Rows) == 0 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "filter %s has no versions", name)
+	}
+	versions := make([]adminapi.FilterVersion, 0, len(result.Rows))
+	for _, row := range result.Named().Rows {
+		version := adminapi.FilterVersion{
+			Version:    row.AsInt64("version", 0),
+			Operation:  row.AsString("operation", ""),
+			ChangedBy:  row.AsString("changed_by", ""),
+			ChangedAt:  row.AsString("create_timestamp", ""),
+			RollbackTo: row.AsInt64("rollback_to", 0),
+		}
+		if data := row.AsString("definition", ""); data != "" {
+			version.Filter = &adminapi.Filter{}
+			if err := json.Unmarshal([]byte(data), version.Filter); err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "invalid definition of version %d of filter %s: %v", version.Version, name, err)
+			}
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
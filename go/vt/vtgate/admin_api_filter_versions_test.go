@@ -0,0 +1,127 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// filterVersionResult returns the rows of the versions of filter f, one by
+// operation, the FAIL filter of priority N after each "create:N" or
+// "update:N", none after a "delete" and the definition of version N after a
+// "rollback:N".
+func filterVersionResult(operations ...string) *sqltypes.Result {
+	var rows []string
+	definitions := map[string]string{}
+	for i, operation := range operations {
+		op, n, _ := strings.Cut(operation, ":")
+		definition, rollbackTo := "null", "null"
+		switch op {
+		case "create", "update":
+			definition = fmt.Sprintf(`{"name":"f","priority":%s,"status":"ACTIVE","action":"FAIL"}`, n)
+		case "rollback":
+			definition, rollbackTo = definitions[n], n
+		}
+		definitions[fmt.Sprint(i+1)] = definition
+		rows = append(rows, fmt.Sprintf("f|%d|%s|alice|%s|%s|2026-10-14 10:00:00", i+1, op, definition, rollbackTo))
+	}
+	return sqltypes.MakeTestResult(filterVersionFields, rows...)
+}
+
+var filterVersionFields = sqltypes.MakeTestFields(
+	"name|version|operation|changed_by|definition|rollback_to|create_timestamp",
+	"varchar|uint64|varchar|varchar|text|uint64|timestamp")
+
+func TestAdminAPIFilterVersions(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	sbc := hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	sbc.SetResults([]*sqltypes.Result{filterVersionResult("create:10", "update:20", "delete")})
+	var list adminapi.FilterVersionList
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "filters/f/versions", "", &list))
+	require.Len(t, list.Versions, 3)
+	assert.Equal(t, adminapi.FilterVersion{
+		Version:   2,
+		Operation: "update",
+		ChangedBy: "alice",
+		ChangedAt: "2026-10-14 10:00:00",
+		Filter:    &adminapi.Filter{Name: "f", Priority: 20, Status: "ACTIVE", Action: "FAIL"},
+	}, list.Versions[1])
+	assert.Nil(t, list.Versions[2].Filter)
+
+	var errResp adminapi.ErrorResponse
+	sbc.SetResults([]*sqltypes.Result{filterVersionResult()})
+	assert.Equal(t, http.StatusNotFound, adminAPIRequestFor(t, handler, http.MethodGet, "filters/nope/versions", "", &errResp))
+	assert.Equal(t, "filter nope has no versions", errResp.Error.Message)
+
+	// A rollback is to the version before the latest one by default, which
+	// restores a deleted filter, in a transaction.
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{
+		filterVersionResult("create:10", "update:20", "delete"),
+		{RowsAffected: 0}, {RowsAffected: 1}, {RowsAffected: 1},
+		filterVersionResult("create:10", "update:20", "delete", "rollback:2"),
+	})
+	var version adminapi.FilterVersion
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodPost, "filters/f/rollback", "{}", &version))
+	assert.Equal(t, int64(4), version.Version)
+	assert.Equal(t, int64(2), version.RollbackTo)
+	assert.Equal(t, 20, version.Filter.Priority)
+	require.Len(t, sbc.Queries, 5)
+	assert.Contains(t, sbc.Queries[1].Sql, "delete from mysql.wescale_plugin")
+	assert.Contains(t, sbc.Queries[2].Sql, "insert into mysql.wescale_plugin")
+	assert.Equal(t, sqltypes.Int64BindVariable(20), sbc.Queries[2].BindVariables["priority"])
+	assert.Contains(t, sbc.Queries[3].Sql, "insert into mysql.wescale_filter_version")
+	assert.Equal(t, sqltypes.StringBindVariable("rollback"), sbc.Queries[3].BindVariables["operation"])
+	assert.Equal(t, sqltypes.Int64BindVariable(2), sbc.Queries[3].BindVariables["rollback_to"])
+	assert.EqualValues(t, 1, sbc.CommitCount.Get())
+
+	// Rolling back to a deleted version deletes the filter.
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{
+		filterVersionResult("create:10", "delete", "create:30"),
+		{RowsAffected: 1}, {RowsAffected: 1},
+		filterVersionResult("create:10", "delete", "create:30", "rollback:2"),
+	})
+	version = adminapi.FilterVersion{}
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodPost, "filters/f/rollback", `{"version": 2}`, &version))
+	assert.Nil(t, version.Filter)
+	require.Len(t, sbc.Queries, 4)
+	assert.Contains(t, sbc.Queries[1].Sql, "delete from mysql.wescale_plugin")
+	assert.Equal(t, sqltypes.NullBindVariable, sbc.Queries[2].BindVariables["definition"])
+
+	sbc.SetResults([]*sqltypes.Result{filterVersionResult("create:10")})
+	assert.Equal(t, http.StatusBadRequest, adminAPIRequestFor(t, handler, http.MethodPost, "filters/f/rollback", "{}", &errResp))
+	assert.Contains(t, errResp.Error.Message, "there is no version to roll back to")
+	sbc.SetResults([]*sqltypes.Result{filterVersionResult("create:10", "update:20")})
+	assert.Equal(t, http.StatusNotFound, adminAPIRequestFor(t, handler, http.MethodPost, "filters/f/rollback", `{"version": 5}`, &errResp))
+	assert.Equal(t, "version 5 of filter f not found", errResp.Error.Message)
+
+	// The version is checked again before it is restored.
+	sbc.Queries = nil
+	invalid := sqltypes.MakeTestResult(filterVersionFields,
+		`f|1|create|alice|{"name":"f","priority":10,"status":"ACTIVE","action":"CONCURRENCY_CONTROL","action_args":"{\"max_concurency\": 2}"}|null|2026-10-14 10:00:00`,
+		`f|2|delete|alice|null|null|2026-10-14 10:00:00`)
+	sbc.SetResults([]*sqltypes.Result{invalid})
+	assert.Equal(t, http.StatusBadRequest, adminAPIRequestFor(t, handler, http.MethodPost, "filters/f/rollback", "{}", &errResp))
+	assert.Contains(t, errResp.Error.Message, "version 1 of filter f can't be restored")
+	assert.Contains(t, errResp.Error.Message, "unknown param max_concurency")
+	assert.Len(t, sbc.Queries, 1)
+}
@@ -0,0 +1,283 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// The plugins are versioned in the registry of the mysql.wescale_wasm_plugin
+// table, which keeps every version that was installed. Installing a plugin and
+// upgrading it add a version, which becomes current, and rolling it back makes
+// another version current, so the rules which reference the plugin without a
+// version follow the upgrades and the rollbacks, and the ones which reference
+// name@version don't.
+
+// adminAPIPluginTable is the registry of the plugins.
+const adminAPIPluginTable = "mysql.wescale_wasm_plugin"
+
+const adminAPIPluginColumns = "name, version, description, metadata, checksum, size, is_current, create_timestamp"
+
+// wasmMagic starts the WASM modules: the magic number and version 1 of the
+// binary format.
+var wasmMagic = []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+
+func (ah *adminAPIHandler) listPlugins(req *adminAPIRequest) (int, any, error) {
+	plugins, err := ah.selectPlugins(req, "", nil)
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, adminapi.PluginList{Plugins: plugins}, nil
+}
+
+// getPlugin returns the version of a plugin a reference is to.
+func (ah *adminAPIHandler) getPlugin(req *adminAPIRequest) (int, any, error) {
+	name, version, err := adminapi.ParsePluginReference(req.segments[1])
+	if err != nil {
+		return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%v", err))
+	}
+	plugin, err := ah.selectPlugin(req, name, version)
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, plugin, nil
+}
+
+// installPlugin installs the first version of a plugin.
+func (ah *adminAPIHandler) installPlugin(req *adminAPIRequest) (int, any, error) {
+	return ah.addPluginVersion(req, "")
+}
+
+// upgradePlugin adds a version to an installed plugin.
+func (ah *adminAPIHandler) upgradePlugin(req *adminAPIRequest) (int, any, error) {
+	return ah.addPluginVersion(req, req.segments[1])
+}
+
+// addPluginVersion adds the version of a plugin in the body of a request and
+// makes it current. If name is set, the plugin must be installed and have
+// that name, else it must not be installed.
+func (ah *adminAPIHandler) addPluginVersion(req *adminAPIRequest, name string) (int, any, error) {
+	var upload adminapi.PluginUpload
+	if err := decodeBody(req, &upload); err != nil {
+		return fail(err)
+	}
+	if upload.Name == "" {
+		upload.Name = name
+	}
+	bindVars, err := pluginBindVars(&upload)
+	if err != nil {
+		return fail(err)
+	}
+	if name != "" && upload.Name != name {
+		return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: the upload of plugin %s is for plugin %s", name, upload.Name))
+	}
+
+	installed, err := ah.selectPlugins(req, " where name = :name", map[string]*querypb.BindVariable{"name": bindVars["name"]})
+	if err != nil {
+		return fail(err)
+	}
+	switch {
+	case name == "" && len(installed) > 0:
+		return fail(vterrors.Errorf(vtrpcpb.Code_ALREADY_EXISTS, "plugin %s is already installed, upgrade it instead", upload.Name))
+	case name != "" && len(installed) == 0:
+		return fail(vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "plugin %s not found", name))
+	}
+	for _, plugin := range installed {
+		if plugin.Version == upload.Version {
+			return fail(vterrors.Errorf(vtrpcpb.Code_ALREADY_EXISTS, "version %s of plugin %s is already installed", upload.Version, upload.Name))
+		}
+	}
+
+	err = ah.executeInTransaction(req, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		if _, err := execute("insert into "+adminAPIPluginTable+" (name, version, description, metadata, checksum, size, is_current, wasm_binary) values (:name, :version, :description, :metadata, :checksum, :size, 0, :wasm_binary)", bindVars); err != nil {
+			return err
+		}
+		_, err := execute(setCurrentPluginVersionQuery, bindVars)
+		return err
+	})
+	if err != nil {
+		return fail(err)
+	}
+	plugin, err := ah.selectPlugin(req, upload.Name, upload.Version)
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusCreated, plugin, nil
+}
+
+// setCurrentPluginVersionQuery makes :version the current version of plugin
+// :name, in one statement.
+const setCurrentPluginVersionQuery = "update " + adminAPIPluginTable + " set is_current = if(version = :version, 1, 0) where name = :name"
+
+// rollbackPlugin makes another version of a plugin current.
+func (ah *adminAPIHandler) rollbackPlugin(req *adminAPIRequest) (int, any, error) {
+	name := req.segments[1]
+	var rollback adminapi.PluginRollback
+	if err := decodeBody(req, &rollback); err != nil {
+		return fail(err)
+	}
+	// The versions are in the order they were installed.
+	versions, err := ah.selectPlugins(req, " where name = :name", map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name)})
+	if err != nil {
+		return fail(err)
+	}
+	if len(versions) == 0 {
+		return fail(vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "plugin %s not found", name))
+	}
+	version := rollback.Version
+	if version == "" {
+		for i, plugin := range versions {
+			if plugin.Current {
+				if i == 0 {
+					return fail(vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "version %s of plugin %s is its first version, there is no version to roll back to", plugin.Version, name))
+				}
+				version = versions[i-1].Version
+			}
+		}
+		if version == "" {
+			return fail(vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "plugin %s has no current version, roll back to a given version", name))
+		}
+	} else {
+		found := false
+		for _, plugin := range versions {
+			found = found || plugin.Version == version
+		}
+		if !found {
+			return fail(vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "version %s of plugin %s not found", version, name))
+		}
+	}
+
+	bindVars := map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name), "version": sqltypes.StringBindVariable(version)}
+	if _, err := ah.execute(req, nil, setCurrentPluginVersionQuery, bindVars); err != nil {
+		return fail(err)
+	}
+	plugin, err := ah.selectPlugin(req, name, version)
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, plugin, nil
+}
+
+// selectPlugin returns a version of a plugin, or its current version if
+// version is empty.
+func (ah *adminAPIHandler) selectPlugin(req *adminAPIRequest, name, version string) (*adminapi.Plugin, error) {
+	bindVars := map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name)}
+	where := " where name = :name and is_current = 1"
+	if version != "" {
+		where = " where name = :name and version = :version"
+		bindVars["version"] = sqltypes.StringBindVariable(version)
+	}
+	plugins, err := ah.selectPlugins(req, where, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	if len(plugins) == 0 {
+		if version == "" {
+			return nil, vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "plugin %s not found", name)
+		}
+		return nil, vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "version %s of plugin %s not found", version, name)
+	}
+	return &plugins[0], nil
+}
+
+func (ah *adminAPIHandler) selectPlugins(req *adminAPIRequest, where string, bindVars map[string]*querypb.BindVariable) ([]adminapi.Plugin, error) {
+	result, err := ah.execute(req, nil, "select "+adminAPIPluginColumns+" from "+adminAPIPluginTable+where+" order by name, id", bindVars)
+	if err != nil {
+		return nil, err
+	}
+	plugins := make([]adminapi.Plugin, 0, len(result.Rows))
+	for _, row := range result.Named().Rows {
+		plugin := adminapi.Plugin{
+			Name:        row.AsString("name", ""),
+			Version:     row.AsString("version", ""),
+			Description: row.AsString("description", ""),
+			Checksum:    row.AsString("checksum", ""),
+			Size:        row.AsInt64("size", 0),
+			Current:     row.AsInt64("is_current", 0) == 1,
+			CreatedAt:   row.AsString("create_timestamp", ""),
+		}
+		if data := row.AsString("metadata", ""); data != "" {
+			if err := json.Unmarshal([]byte(data), &plugin.Metadata); err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "invalid metadata of version %s of plugin %s: %v", plugin.Version, plugin.Name, err)
+			}
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+// pluginBindVars checks an upload and returns the column values of its
+// version.
+func pluginBindVars(upload *adminapi.PluginUpload) (map[string]*querypb.BindVariable, error) {
+	if err := adminapi.CheckPluginName(upload.Name); err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: %v", err)
+	}
+	if err := adminapi.CheckPluginVersion(upload.Version); err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: %v", err)
+	}
+	if !bytes.HasPrefix(upload.Binary, wasmMagic) {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: the binary is not a WASM module")
+	}
+	sum := sha256.Sum256(upload.Binary)
+	checksum := hex.EncodeToString(sum[:])
+	if upload.Checksum != "" && !strings.EqualFold(upload.Checksum, checksum) {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: the checksum of the binary is %s, not %s", checksum, upload.Checksum)
+	}
+	metadata := ""
+	if len(upload.Metadata) > 0 {
+		data, err := json.Marshal(upload.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		metadata = string(data)
+	}
+	return map[string]*querypb.BindVariable{
+		"name":        sqltypes.StringBindVariable(upload.Name),
+		"version":     sqltypes.StringBindVariable(upload.Version),
+		"description": sqltypes.StringBindVariable(upload.Description),
+		"metadata":    sqltypes.StringBindVariable(metadata),
+		"checksum":    sqltypes.StringBindVariable(checksum),
+		"size":        sqltypes.Int64BindVariable(int64(len(upload.Binary))),
+		"wasm_binary": sqltypes.BytesBindVariable(upload.Binary),
+	}, nil
+}
+
+// executeInTransaction runs statements in one transaction on the primary
+// tablets of the keyspace of the request. The transaction is rolled back if
+// statements fails.
+func (ah *adminAPIHandler) executeInTransaction(req *adminAPIRequest, statements func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error) error {
+	session := newSession()
+	session.TargetString = req.keyspace + "@primary"
+	atomic.AddInt32(&busyConnections, 1)
+	defer atomic.AddInt32(&busyConnections, -1)
+	execute := func(sql string, bindVars map[string]*querypb.BindVariable) (result *sqltypes.Result, err error) {
+		session, result, err = ah.vtg.Execute(req.ctx, session, sql, bindVars)
+		return result, err
+	}
+	// Closing the session rolls back its transaction, if it is still open.
+	defer func() { _ = ah.vtg.CloseSession(req.ctx, session) }()
+	if _, err := execute("begin", nil); err != nil {
+		return err
+	}
+	if err := statements(execute); err != nil {
+		return err
+	}
+	_, err := execute("commit", nil)
+	return err
+}
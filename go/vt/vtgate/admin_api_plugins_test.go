@@ -0,0 +1,134 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// pluginResult returns the rows of the versions of plugin p, "version" or
+// "version*" for the current one.
+func pluginResult(versions ...string) *sqltypes.Result {
+	var rows []string
+	for _, version := range versions {
+		current := "0"
+		if strings.HasSuffix(version, "*") {
+			version, current = strings.TrimSuffix(version, "*"), "1"
+		}
+		rows = append(rows, fmt.Sprintf("p|%s|desc|{\"abi\":\"1\"}|abc|8|%s|2026-10-14 10:00:00", version, current))
+	}
+	return sqltypes.MakeTestResult(sqltypes.MakeTestFields(
+		"name|version|description|metadata|checksum|size|is_current|create_timestamp",
+		"varchar|varchar|text|text|varchar|uint64|int8|timestamp"), rows...)
+}
+
+func TestAdminAPIPlugins(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	sbc := hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	binary := append([]byte{}, wasmMagic...)
+	sum := sha256.Sum256(binary)
+	upload := func(name, version, checksum string) string {
+		return fmt.Sprintf(`{"name": %q, "version": %q, "binary": %q, "checksum": %q, "metadata": {"abi": "1"}}`, name, version, base64.StdEncoding.EncodeToString(binary), checksum)
+	}
+
+	// The uploads are checked before anything is written.
+	var errResp adminapi.ErrorResponse
+	for body, message := range map[string]string{
+		upload("p", "1.0", "0000"):                                  "the checksum of the binary is " + hex.EncodeToString(sum[:]),
+		upload("p q", "1.0", ""):                                    `invalid plugin name "p q"`,
+		upload("p", "1@0", ""):                                      `invalid plugin version "1@0"`,
+		`{"name": "p", "version": "1.0", "binary": "bm90IHdhc20="}`: "the binary is not a WASM module",
+	} {
+		code := adminAPIRequestFor(t, handler, http.MethodPost, "plugins", body, &errResp)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+		assert.Contains(t, errResp.Error.Message, message, body)
+	}
+	assert.Empty(t, sbc.Queries)
+
+	// Installing adds the first version, in a transaction.
+	sbc.SetResults([]*sqltypes.Result{pluginResult(), {RowsAffected: 1}, {RowsAffected: 1}, pluginResult("1.0*")})
+	var plugin adminapi.Plugin
+	code := adminAPIRequestFor(t, handler, http.MethodPost, "plugins", upload("p", "1.0", hex.EncodeToString(sum[:])), &plugin)
+	require.Equal(t, http.StatusCreated, code, errResp)
+	assert.Equal(t, adminapi.Plugin{Name: "p", Version: "1.0", Description: "desc", Metadata: map[string]string{"abi": "1"}, Checksum: "abc", Size: 8, Current: true, CreatedAt: "2026-10-14 10:00:00"}, plugin)
+	require.Len(t, sbc.Queries, 4)
+	insert := sbc.Queries[1]
+	assert.Contains(t, insert.Sql, "insert into mysql.wescale_wasm_plugin")
+	assert.Equal(t, sqltypes.StringBindVariable(hex.EncodeToString(sum[:])), insert.BindVariables["checksum"])
+	assert.Equal(t, sqltypes.BytesBindVariable(binary), insert.BindVariables["wasm_binary"])
+	assert.Equal(t, sqltypes.StringBindVariable(`{"abi":"1"}`), insert.BindVariables["metadata"])
+	assert.Contains(t, sbc.Queries[2].Sql, "set is_current = if(version = :version")
+	assert.EqualValues(t, 1, sbc.CommitCount.Get())
+
+	// A plugin is installed once, then upgraded, and a version is added once.
+	sbc.SetResults([]*sqltypes.Result{pluginResult("1.0*")})
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "plugins", upload("p", "1.1", ""), &errResp)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Contains(t, errResp.Error.Message, "upgrade it instead")
+	sbc.SetResults([]*sqltypes.Result{pluginResult("1.0*")})
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "plugins/p/versions", upload("p", "1.0", ""), &errResp)
+	assert.Equal(t, http.StatusConflict, code)
+	sbc.SetResults([]*sqltypes.Result{pluginResult()})
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "plugins/q/versions", upload("q", "1.0", ""), &errResp)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{pluginResult("1.0*"), {RowsAffected: 1}, {RowsAffected: 2}, pluginResult("1.1*")})
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "plugins/p/versions", upload("", "1.1", ""), &plugin)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "1.1", plugin.Version)
+	assert.Equal(t, sqltypes.StringBindVariable("p"), sbc.Queries[1].BindVariables["name"])
+
+	// A rollback is to the version installed before the current one by
+	// default.
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{pluginResult("1.0", "1.1*"), {RowsAffected: 2}, pluginResult("1.0*")})
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "plugins/p/rollback", "{}", &plugin)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "1.0", plugin.Version)
+	assert.Equal(t, sqltypes.StringBindVariable("1.0"), sbc.Queries[1].BindVariables["version"])
+	sbc.SetResults([]*sqltypes.Result{pluginResult("1.0*", "1.1")})
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "plugins/p/rollback", "{}", &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errResp.Error.Message, "no version to roll back to")
+	sbc.SetResults([]*sqltypes.Result{pluginResult("1.0*", "1.1")})
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "plugins/p/rollback", `{"version": "2.0"}`, &errResp)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// A reference without a version is to the current version.
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{pluginResult("1.0*"), pluginResult("1.1")})
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "plugins/p", "", &plugin))
+	assert.True(t, plugin.Current)
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "plugins/p@1.1", "", &plugin))
+	assert.Equal(t, "1.1", plugin.Version)
+	require.Len(t, sbc.Queries, 2)
+	assert.Contains(t, sbc.Queries[0].Sql, "is_current = :is_current")
+	assert.Equal(t, sqltypes.StringBindVariable("1.1"), sbc.Queries[1].BindVariables["version"])
+
+	sbc.SetResults([]*sqltypes.Result{pluginResult()})
+	code = adminAPIRequestFor(t, handler, http.MethodGet, "plugins/p@9", "", &errResp)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "version 9 of plugin p not found", errResp.Error.Message)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func adminAPIRequestFor(t *testing.T, handler http.Handler, method, path, body string, resp any) int {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, adminapi.PathPrefix+path, nil)
+	} else {
+		r = httptest.NewRequest(method, adminapi.PathPrefix+path, strings.NewReader(body))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if resp != nil && w.Body.Len() > 0 {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp), w.Body.String())
+	}
+	return w.Code
+}
+
+func filterResult(names ...string) *sqltypes.Result {
+	var rows []string
+	for _, name := range names {
+		rows = append(rows, name+"|desc|10|ACTIVE|[\"Delete\"]|[\"db.t\"]||||||||[{\"Name\":\"id\",\"OnAbsent\":true,\"Operator\":\"\"}]|FAIL||||||null||null|")
+	}
+	return sqltypes.MakeTestResult(sqltypes.MakeTestFields(
+		"name|description|priority|status|plans|fully_qualified_table_names|query_regex|query_template|request_ip_regex|user_regex|workload_class_regex|leading_comment_regex|trailing_comment_regex|bind_var_conds|action|action_args|schedule|outcome_conds|request_cidrs|user_groups|in_transaction|query_digest|expires_at|access_conds",
+		"varchar|text|int32|varchar|text|text|text|text|varchar|varchar|varchar|text|text|text|varchar|text|text|text|text|text|int8|varchar|datetime|text"), rows...)
+}
+
+func TestAdminAPIFilters(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	sbc := hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	sbc.SetResults([]*sqltypes.Result{filterResult("f1", "f2")})
+	var list adminapi.FilterList
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "filters", "", &list))
+	require.Len(t, list.Filters, 2)
+	assert.Equal(t, adminapi.Filter{
+		Name:                     "f1",
+		Description:              "desc",
+		Priority:                 10,
+		Status:                   "ACTIVE",
+		Plans:                    []string{"Delete"},
+		FullyQualifiedTableNames: []string{"db.t"},
+		BindVarConds:             []map[string]any{{"Name": "id", "OnAbsent": true, "Operator": ""}},
+		Action:                   "FAIL",
+	}, list.Filters[0])
+	require.Len(t, sbc.Queries, 1)
+	assert.Contains(t, sbc.Queries[0].Sql, "from mysql.wescale_plugin")
+
+	// The filters are checked before they are written.
+	var errResp adminapi.ErrorResponse
+	code := adminAPIRequestFor(t, handler, http.MethodPost, "filters", `{"name": "f3", "action": "FAIL", "plans": ["NoSuchPlan"]}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errResp.Error.Message, "invalid plan name: NoSuchPlan")
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "filters", `{"name": "f3"}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errResp.Error.Message, "no action")
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "filters", `{"name": "f3", "action": "FAIL", "schedule": "{\"cron\": \"* 25 * * *\"}"}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errResp.Error.Message, "invalid hour 25")
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "filters", `{"name": "f3", "action": "CONCURRENCY_CONTROL", "action_args": "{\"max_queue_size\": 10, \"max_concurency\": 2}"}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errResp.Error.Message, "unknown param max_concurency, expected max_queue_size, max_concurrency")
+
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "filters", `{"name": "f3", "action": "FAIL", "query_digest": "select"}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errResp.Error.Message, `invalid query digest "select"`)
+
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "filters", `{"name": "f3", "action": "FAIL", "request_cidrs": ["10.0.0.0/33"]}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errResp.Error.Message, `invalid CIDR "10.0.0.0/33"`)
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "filters", `{"name": "f3", "action": "FAIL", "access_conds": "{\"full_scan\": 1}"}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errResp.Error.Message, `invalid access conditions {"full_scan": 1}`)
+
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{{RowsAffected: 1}, {RowsAffected: 1}, filterResult("f3")})
+	var filter adminapi.Filter
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "filters", `{"name": "f3", "action": "FAIL", "plans": ["Delete"], "request_cidrs": ["10.0.0.0/8", "!10.1.0.0/16"], "user_groups": ["analytics"], "in_transaction": false, "expires_at": "2026-10-14T20:30:00+08:00", "access_conds": "{\"no_index\": true}", "bind_var_conds": [{"Name": "id", "OnAbsent": true, "OnMismatch": false, "Operator": "==", "Value": 1}]}`, &filter)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "f3", filter.Name)
+	require.Len(t, sbc.Queries, 3)
+	insert := sbc.Queries[0]
+	assert.Contains(t, insert.Sql, "insert into mysql.wescale_plugin")
+	assert.Equal(t, sqltypes.Int64BindVariable(1000), insert.BindVariables["priority"])
+	assert.Equal(t, sqltypes.StringBindVariable("ACTIVE"), insert.BindVariables["status"])
+	assert.Equal(t, sqltypes.StringBindVariable(`["Delete"]`), insert.BindVariables["plans"])
+	assert.Equal(t, sqltypes.StringBindVariable(`[{"Name":"id","OnAbsent":true,"OnMismatch":false,"Operator":"==","Value":1}]`), insert.BindVariables["bind_var_conds"])
+	assert.Equal(t, sqltypes.StringBindVariable(""), insert.BindVariables["schedule"])
+	assert.Equal(t, sqltypes.StringBindVariable(`["10.0.0.0/8","!10.1.0.0/16"]`), insert.BindVariables["request_cidrs"])
+	assert.Equal(t, sqltypes.StringBindVariable(`["analytics"]`), insert.BindVariables["user_groups"])
+	assert.Equal(t, sqltypes.BoolBindVariable(false), insert.BindVariables["in_transaction"])
+	assert.Equal(t, sqltypes.StringBindVariable("2026-10-14 12:30:00"), insert.BindVariables["expires_at"])
+	assert.Equal(t, sqltypes.StringBindVariable(`{"no_index": true}`), insert.BindVariables["access_conds"])
+	// The filter is written with its first version, in a transaction.
+	version := sbc.Queries[1]
+	assert.Contains(t, version.Sql, "insert into mysql.wescale_filter_version")
+	assert.Equal(t, sqltypes.StringBindVariable("create"), version.BindVariables["operation"])
+	assert.Contains(t, string(version.BindVariables["definition"].Value), `"name":"f3"`)
+	assert.EqualValues(t, 1, sbc.CommitCount.Get())
+
+	// The expiring filters are read back in UTC.
+	sbc.SetResults([]*sqltypes.Result{sqltypes.MakeTestResult(sqltypes.MakeTestFields("name|priority|status|action|expires_at", "varchar|int32|varchar|varchar|datetime"), "emergency|10|ACTIVE|FAIL|2026-10-14 12:30:00")})
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "filters/emergency", "", &filter))
+	require.NotNil(t, filter.ExpiresAt)
+	assert.Equal(t, time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC), *filter.ExpiresAt)
+
+	// The name of a filter can't change.
+	sbc.SetResults([]*sqltypes.Result{filterResult("f3")})
+	code = adminAPIRequestFor(t, handler, http.MethodPut, "filters/f3", `{"name": "f4", "action": "FAIL"}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{filterResult(), filterResult()})
+	code = adminAPIRequestFor(t, handler, http.MethodGet, "filters/nope", "", &errResp)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = adminAPIRequestFor(t, handler, http.MethodPut, "filters/nope", `{"action": "FAIL"}`, &errResp)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	sbc.SetResults([]*sqltypes.Result{{RowsAffected: 0}})
+	code = adminAPIRequestFor(t, handler, http.MethodDelete, "filters/nope", "", &errResp)
+	assert.Equal(t, http.StatusNotFound, code)
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{{RowsAffected: 1}, {RowsAffected: 1}})
+	code = adminAPIRequestFor(t, handler, http.MethodDelete, "filters/f3", "", nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	require.Len(t, sbc.Queries, 2)
+	assert.Equal(t, sqltypes.StringBindVariable("delete"), sbc.Queries[1].BindVariables["operation"])
+	assert.Equal(t, sqltypes.NullBindVariable, sbc.Queries[1].BindVariables["definition"])
+}
+
+func TestAdminAPIActions(t *testing.T) {
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	var list adminapi.ActionList
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "actions", "", &list))
+	require.NotEmpty(t, list.Actions)
+	assert.Equal(t, "CONTINUE", list.Actions[0].Action)
+
+	var act adminapi.Action
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "actions/SAMPLE", "", &act))
+	assert.Equal(t, "SAMPLE", act.Action)
+	require.NotEmpty(t, act.Params)
+	assert.Equal(t, "percentage", act.Params[0].Name)
+	assert.Equal(t, "number", act.Params[0].Type)
+	assert.Equal(t, "in (0, 100]", act.Params[0].Range)
+
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "actions/CONCURRENCY_CONTROL", "", &act))
+	assert.Contains(t, act.Constraints, "max_concurrency must be in [1, max_queue_size] when max_queue_size is set")
+
+	var errResp adminapi.ErrorResponse
+	assert.Equal(t, http.StatusNotFound, adminAPIRequestFor(t, handler, http.MethodGet, "actions/EXPLODE", "", &errResp))
+	assert.Equal(t, "action EXPLODE not found", errResp.Error.Message)
+	assert.Equal(t, http.StatusNotFound, adminAPIRequestFor(t, handler, http.MethodGet, "actions/BUFFER", "", &errResp))
+}
+
+func TestAdminAPIRoutingAndMigrations(t *testing.T) {
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	var spec map[string]any
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "openapi.json", "", &spec))
+	assert.Equal(t, "3.0.3", spec["openapi"])
+
+	defer func(policy string, ratio int) {
+		defaultReadWriteSplittingPolicy, defaultReadWriteSplittingRatio = policy, ratio
+	}(defaultReadWriteSplittingPolicy, defaultReadWriteSplittingRatio)
+	var routing adminapi.Routing
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodPatch, "routing", `{"read_write_splitting_policy": "random", "read_write_splitting_ratio": 50}`, &routing))
+	assert.Equal(t, "random", routing.ReadWriteSplittingPolicy)
+	assert.Equal(t, 50, routing.ReadWriteSplittingRatio)
+
+	// Nothing changes if a field is invalid.
+	var errResp adminapi.ErrorResponse
+	code := adminAPIRequestFor(t, handler, http.MethodPatch, "routing", `{"read_write_splitting_policy": "disable", "read_write_splitting_ratio": 500}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "routing", "", &routing))
+	assert.Equal(t, "random", routing.ReadWriteSplittingPolicy)
+
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "migrations/not-a-uuid/cancel", "", &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "migrations/aa9b1a5e_1f1e_11ee_b0d7_0a43f95f28a3/explode", "", &errResp)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = adminAPIRequestFor(t, handler, http.MethodPost, "migrations", `{"sql": "alter table t add column c int", "strategy": "nope"}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code = adminAPIRequestFor(t, handler, http.MethodDelete, "routing", "", &errResp)
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	code = adminAPIRequestFor(t, handler, http.MethodGet, "nothing", "", &errResp)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestAdminAPIAuthentication(t *testing.T) {
+	handler := &adminAPIHandler{
+		vtg:        rpcVTGate,
+		authServer: mysql.NewAuthServerStatic("", `{"user": [{"Password": "secret"}]}`, 0),
+	}
+	defer func(allow bool) { mysqlAllowClearTextWithoutTLS = allow }(mysqlAllowClearTextWithoutTLS)
+	mysqlAllowClearTextWithoutTLS = true
+
+	// The spec is public.
+	assert.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "openapi.json", "", nil))
+	var errResp adminapi.ErrorResponse
+	assert.Equal(t, http.StatusUnauthorized, adminAPIRequestFor(t, handler, http.MethodGet, "routing", "", &errResp))
+
+	r := httptest.NewRequest(http.MethodGet, adminapi.PathPrefix+"routing", nil)
+	r.SetBasicAuth("user", "secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAdminAPIHealth(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	hcVTGateTest.AddTestTablet("aa", "1.1.1.2", 1002, KsTestDefaultShard, "0", topodatapb.TabletType_REPLICA, false, 0, errors.New("no connection"))
+	hcVTGateTest.AddTestTablet("aa", "1.1.1.3", 1003, "other", "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	defer hcVTGateTest.Reset()
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	var health adminapi.Health
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "health", "", &health))
+	assert.Len(t, health.Tablets, 3)
+
+	health = adminapi.Health{}
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "health?keyspace="+KsTestDefaultShard, "", &health))
+	require.Len(t, health.Tablets, 2)
+	primary, replica := health.Tablets[0], health.Tablets[1]
+	if primary.TabletType != "primary" {
+		primary, replica = replica, primary
+	}
+	assert.Equal(t, "1.1.1.1", primary.Hostname)
+	assert.Equal(t, KsTestDefaultShard, primary.Keyspace)
+	assert.True(t, primary.Serving)
+	assert.Empty(t, primary.Error)
+	assert.Equal(t, "replica", replica.TabletType)
+	assert.False(t, replica.Serving)
+	assert.Equal(t, "no connection", replica.Error)
+}
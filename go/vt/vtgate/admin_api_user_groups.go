@@ -0,0 +1,128 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"net/http"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// The user groups are rows of the mysql.wescale_user_group table, one per
+// member, which the tablets load with the filters to match their user groups.
+// A group exists while it has members.
+
+// adminAPIUserGroupTable is the table of the members of the user groups, with
+// the default --database_custom_rule_db_name and
+// --database_custom_rule_user_group_table_name.
+const adminAPIUserGroupTable = "mysql.wescale_user_group"
+
+func (ah *adminAPIHandler) listUserGroups(req *adminAPIRequest) (int, any, error) {
+	groups, err := ah.selectUserGroups(req, "", nil)
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, adminapi.UserGroupList{UserGroups: groups}, nil
+}
+
+func (ah *adminAPIHandler) getUserGroup(req *adminAPIRequest) (int, any, error) {
+	group, err := ah.selectUserGroup(req, req.segments[1])
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, group, nil
+}
+
+// setUserGroup replaces the members of a user group, in a transaction.
+func (ah *adminAPIHandler) setUserGroup(req *adminAPIRequest) (int, any, error) {
+	name := req.segments[1]
+	group := adminapi.UserGroup{Name: name}
+	if err := decodeBody(req, &group); err != nil {
+		return fail(err)
+	}
+	if group.Name != name {
+		return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: the name of user group %s can't change to %s", name, group.Name))
+	}
+	if err := adminapi.CheckUserGroupName(name); err != nil {
+		return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: %v", err))
+	}
+	if len(group.Users) == 0 {
+		return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: no users, delete the user group instead"))
+	}
+	users := &querypb.BindVariable{Type: querypb.Type_TUPLE}
+	for _, user := range group.Users {
+		if user == "" {
+			return fail(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: empty user"))
+		}
+		users.Values = append(users.Values, sqltypes.ValueToProto(sqltypes.NewVarChar(user)))
+	}
+
+	bindVars := map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name), "users": users}
+	err := ah.executeInTransaction(req, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		if _, err := execute("delete from "+adminAPIUserGroupTable+" where group_name = :name and user not in ::users", bindVars); err != nil {
+			return err
+		}
+		for _, user := range group.Users {
+			if _, err := execute("insert ignore into "+adminAPIUserGroupTable+" (group_name, user) values (:name, :user)", map[string]*querypb.BindVariable{"name": bindVars["name"], "user": sqltypes.StringBindVariable(user)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+	set, err := ah.selectUserGroup(req, name)
+	if err != nil {
+		return fail(err)
+	}
+	return http.StatusOK, set, nil
+}
+
+func (ah *adminAPIHandler) deleteUserGroup(req *adminAPIRequest) (int, any, error) {
+	name := req.segments[1]
+	result, err := ah.execute(req, nil, "delete from "+adminAPIUserGroupTable+" where group_name = :name", map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name)})
+	if err != nil {
+		return fail(err)
+	}
+	if result.RowsAffected == 0 {
+		return fail(vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "user group %s not found", name))
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (ah *adminAPIHandler) selectUserGroup(req *adminAPIRequest, name string) (*adminapi.UserGroup, error) {
+	groups, err := ah.selectUserGroups(req, " where group_name = :name", map[string]*querypb.BindVariable{"name": sqltypes.StringBindVariable(name)})
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "user group %s not found", name)
+	}
+	return &groups[0], nil
+}
+
+func (ah *adminAPIHandler) selectUserGroups(req *adminAPIRequest, where string, bindVars map[string]*querypb.BindVariable) ([]adminapi.UserGroup, error) {
+	result, err := ah.execute(req, nil, "select group_name, user from "+adminAPIUserGroupTable+where+" order by group_name, user", bindVars)
+	if err != nil {
+		return nil, err
+	}
+	groups := []adminapi.UserGroup{}
+	for _, row := range result.Named().Rows {
+		name := row.AsString("group_name", "")
+		if len(groups) == 0 || groups[len(groups)-1].Name != name {
+			groups = append(groups, adminapi.UserGroup{Name: name})
+		}
+		last := &groups[len(groups)-1]
+		last.Users = append(last.Users, row.AsString("user", ""))
+	}
+	return groups, nil
+}
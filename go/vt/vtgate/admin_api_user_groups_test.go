@@ -0,0 +1,71 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// userGroupResult returns the rows of the members of the user groups, as
+// "group|user".
+func userGroupResult(members ...string) *sqltypes.Result {
+	return sqltypes.MakeTestResult(sqltypes.MakeTestFields("group_name|user", "varchar|varchar"), members...)
+}
+
+func TestAdminAPIUserGroups(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	sbc := hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	// The members are grouped by group.
+	sbc.SetResults([]*sqltypes.Result{userGroupResult("admins|root", "analytics|etl1", "analytics|etl2")})
+	var list adminapi.UserGroupList
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "user_groups", "", &list))
+	assert.Equal(t, []adminapi.UserGroup{{Name: "admins", Users: []string{"root"}}, {Name: "analytics", Users: []string{"etl1", "etl2"}}}, list.UserGroups)
+
+	var errResp adminapi.ErrorResponse
+	sbc.SetResults([]*sqltypes.Result{userGroupResult()})
+	assert.Equal(t, http.StatusNotFound, adminAPIRequestFor(t, handler, http.MethodGet, "user_groups/bi", "", &errResp))
+	assert.Equal(t, "user group bi not found", errResp.Error.Message)
+
+	// The groups are checked before anything is written.
+	sbc.Queries = nil
+	for path, body := range map[string]string{
+		"user_groups/analytics": `{"name": "bi", "users": ["etl1"]}`,
+		"user_groups/a%20b":     `{"users": ["etl1"]}`,
+		"user_groups/bi":        `{"users": []}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, adminAPIRequestFor(t, handler, http.MethodPut, path, body, &errResp), path)
+	}
+	assert.Empty(t, sbc.Queries)
+
+	// Setting a group replaces its members, in a transaction.
+	sbc.SetResults([]*sqltypes.Result{{RowsAffected: 1}, {RowsAffected: 1}, {}, userGroupResult("analytics|etl2", "analytics|etl3")})
+	var group adminapi.UserGroup
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodPut, "user_groups/analytics", `{"users": ["etl3", "etl2"]}`, &group))
+	assert.Equal(t, adminapi.UserGroup{Name: "analytics", Users: []string{"etl2", "etl3"}}, group)
+	require.Len(t, sbc.Queries, 4)
+	assert.Contains(t, sbc.Queries[0].Sql, "delete from mysql.wescale_user_group")
+	assert.Len(t, sbc.Queries[0].BindVariables["users"].Values, 2)
+	assert.Contains(t, sbc.Queries[1].Sql, "insert ignore into mysql.wescale_user_group")
+	assert.EqualValues(t, 1, sbc.CommitCount.Get())
+
+	sbc.SetResults([]*sqltypes.Result{{RowsAffected: 2}})
+	assert.Equal(t, http.StatusNoContent, adminAPIRequestFor(t, handler, http.MethodDelete, "user_groups/analytics", "", nil))
+	sbc.SetResults([]*sqltypes.Result{{}})
+	assert.Equal(t, http.StatusNotFound, adminAPIRequestFor(t, handler, http.MethodDelete, "user_groups/analytics", "", &errResp))
+}
@@ -0,0 +1,79 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"vitess.io/vitess/go/streamlog"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/workload"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// A workload capture streams the queries the query logger of vtgate logs, with
+// their bind variables, so it is disabled unless --admin_api_workload_capture
+// is set. The records the logger drops when a capture doesn't keep up are
+// counted by the StreamlogDeliveryDroppedMessages stat.
+
+var enableWorkloadCapture bool
+
+// defaultWorkloadCaptureDuration is the duration of the captures which don't
+// set one.
+const defaultWorkloadCaptureDuration = time.Minute
+
+// captureWorkload streams the queries vtgate serves for the duration of the
+// request. Unlike the other operations, it writes its response itself, since
+// it outlasts --mysql_server_query_timeout.
+func (ah *adminAPIHandler) captureWorkload(w http.ResponseWriter, r *http.Request) {
+	const name = "captureWorkload"
+	if !enableWorkloadCapture {
+		ah.sendError(w, name, http.StatusForbidden, vterrors.Errorf(vtrpcpb.Code_PERMISSION_DENIED, "workload capture is disabled, run vtgate with --admin_api_workload_capture"))
+		return
+	}
+	if streamlog.GetRedactDebugUIQueries() {
+		ah.sendError(w, name, http.StatusBadRequest, vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "cannot capture the workload with --redact-debug-ui-queries"))
+		return
+	}
+	duration := defaultWorkloadCaptureDuration
+	if value := r.URL.Query().Get("duration"); value != "" {
+		var err error
+		if duration, err = time.ParseDuration(value); err != nil || duration <= 0 {
+			ah.sendError(w, name, http.StatusBadRequest, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid duration %q", value))
+			return
+		}
+	}
+	logger := QueryLogger
+	if logger == nil {
+		ah.sendError(w, name, http.StatusServiceUnavailable, vterrors.Errorf(vtrpcpb.Code_UNAVAILABLE, "the query logger is not running"))
+		return
+	}
+
+	ch := logger.Subscribe("WorkloadCapture")
+	defer logger.Unsubscribe(ch)
+	ctx, cancel := context.WithTimeout(r.Context(), duration)
+	defer cancel()
+
+	adminAPIRequests.Add([]string{name, strconv.Itoa(http.StatusOK)}, 1)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flush := func() {}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+		flush = flusher.Flush
+	}
+	captured, err := workload.Capture(ctx, ch, w, flush)
+	if err != nil {
+		log.Warningf("Workload capture for %v stopped after %d queries: %v", r.RemoteAddr, captured, err)
+		return
+	}
+	log.Infof("Captured %d queries for %v in %v", captured, r.RemoteAddr, duration)
+}
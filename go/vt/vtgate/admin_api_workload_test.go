@@ -0,0 +1,69 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/streamlog"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/vt/vtgate/logstats"
+	"vitess.io/vitess/go/vt/vtgate/workload"
+)
+
+func TestAdminAPIWorkloadCapture(t *testing.T) {
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	var errResp adminapi.ErrorResponse
+	assert.Equal(t, http.StatusForbidden, adminAPIRequestFor(t, handler, http.MethodGet, "workload/capture", "", &errResp))
+	assert.Contains(t, errResp.Error.Message, "--admin_api_workload_capture")
+
+	defer func(enable bool) { enableWorkloadCapture = enable }(enableWorkloadCapture)
+	enableWorkloadCapture = true
+	defer SetQueryLogger(QueryLogger)
+	logger := streamlog.New("VTGate", 10)
+	SetQueryLogger(logger)
+
+	assert.Equal(t, http.StatusBadRequest, adminAPIRequestFor(t, handler, http.MethodGet, "workload/capture?duration=-1s", "", &errResp))
+
+	// Queries are logged until the capture ends.
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				stats := logstats.NewLogStats(context.Background(), "Execute", "select 1 from dual", "s1", nil)
+				stats.StmtType = "SELECT"
+				stats.SaveEndTime()
+				logger.Send(stats)
+			}
+		}
+	}()
+	r := httptest.NewRequest(http.MethodGet, adminapi.PathPrefix+"workload/capture?duration=200ms", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	close(done)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	queries, err := workload.ReadQueries(w.Body)
+	require.NoError(t, err)
+	require.NotEmpty(t, queries)
+	assert.Equal(t, "select 1 from dual", queries[0].SQL)
+	assert.Equal(t, "s1", queries[0].Session)
+}
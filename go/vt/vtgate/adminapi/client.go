@@ -0,0 +1,400 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package adminapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client is a client of the admin API. Its methods follow the operations of
+// Spec, and return an *Error when the request fails.
+type Client struct {
+	baseURL    string
+	user       string
+	password   string
+	httpClient *http.Client
+}
+
+// NewClient returns a client of the admin API of the vtgate serving HTTP at
+// baseURL, like http://vtgate:15001.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+}
+
+// WithBasicAuth makes the client authenticate as the given user.
+func (c *Client) WithBasicAuth(user, password string) *Client {
+	c.user, c.password = user, password
+	return c
+}
+
+// WithHTTPClient makes the client send its requests with the given HTTP client.
+func (c *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	c.httpClient = httpClient
+	return c
+}
+
+// ListFilters lists the filters of a keyspace, by priority. An empty keyspace
+// is the default keyspace of vtgate.
+func (c *Client) ListFilters(ctx context.Context, keyspace string) ([]Filter, error) {
+	var list FilterList
+	err := c.do(ctx, http.MethodGet, "filters", keyspace, nil, &list)
+	return list.Filters, err
+}
+
+// GetFilter returns a filter.
+func (c *Client) GetFilter(ctx context.Context, keyspace, name string) (*Filter, error) {
+	var filter Filter
+	if err := c.do(ctx, http.MethodGet, "filters/"+url.PathEscape(name), keyspace, nil, &filter); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// CreateFilter creates a filter.
+func (c *Client) CreateFilter(ctx context.Context, keyspace string, filter *Filter) (*Filter, error) {
+	var created Filter
+	if err := c.do(ctx, http.MethodPost, "filters", keyspace, filter, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateFilter replaces the filter with the name of the given one.
+func (c *Client) UpdateFilter(ctx context.Context, keyspace string, filter *Filter) (*Filter, error) {
+	var updated Filter
+	if err := c.do(ctx, http.MethodPut, "filters/"+url.PathEscape(filter.Name), keyspace, filter, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteFilter deletes a filter.
+func (c *Client) DeleteFilter(ctx context.Context, keyspace, name string) error {
+	return c.do(ctx, http.MethodDelete, "filters/"+url.PathEscape(name), keyspace, nil, nil)
+}
+
+// ListFilterVersions returns the versions of a filter, from the first one.
+func (c *Client) ListFilterVersions(ctx context.Context, keyspace, name string) ([]FilterVersion, error) {
+	var list FilterVersionList
+	err := c.do(ctx, http.MethodGet, "filters/"+url.PathEscape(name)+"/versions", keyspace, nil, &list)
+	return list.Versions, err
+}
+
+// RollbackFilter restores a previous version of a filter: the given one, or
+// the one before the latest version if version is 0. It returns the version
+// the rollback added.
+func (c *Client) RollbackFilter(ctx context.Context, keyspace, name string, version int64) (*FilterVersion, error) {
+	var added FilterVersion
+	if err := c.do(ctx, http.MethodPost, "filters/"+url.PathEscape(name)+"/rollback", keyspace, &FilterRollback{Version: version}, &added); err != nil {
+		return nil, err
+	}
+	return &added, nil
+}
+
+// ExportFilters returns the document of the filters of a database, or of all
+// the filters if database is empty.
+func (c *Client) ExportFilters(ctx context.Context, keyspace, database string) (*FilterDocument, error) {
+	query := url.Values{}
+	if database != "" {
+		query.Set("database", database)
+	}
+	var doc FilterDocument
+	if err := c.doWithQuery(ctx, http.MethodGet, "filter_document", keyspace, query, nil, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ImportFilters creates and updates the filters of a document in one
+// transaction, once all of them are checked. The document is a JSON or YAML
+// FilterDocument, sent as is, so its filters have the defaults of the fields
+// they don't set.
+func (c *Client) ImportFilters(ctx context.Context, keyspace string, document []byte, opts FilterImportOptions) (*FilterImportResult, error) {
+	query := url.Values{}
+	if opts.Database != "" {
+		query.Set("database", opts.Database)
+	}
+	if opts.Prune {
+		query.Set("prune", "true")
+	}
+	if opts.DryRun {
+		query.Set("dry_run", "true")
+	}
+	var result FilterImportResult
+	if err := c.doWithQuery(ctx, http.MethodPost, "filter_document", keyspace, query, document, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListActions returns the actions of the filters, with the params of their
+// action args.
+func (c *Client) ListActions(ctx context.Context) ([]Action, error) {
+	var list ActionList
+	err := c.do(ctx, http.MethodGet, "actions", "", nil, &list)
+	return list.Actions, err
+}
+
+// GetAction describes an action of the filters, like CONCURRENCY_CONTROL.
+func (c *Client) GetAction(ctx context.Context, action string) (*Action, error) {
+	var act Action
+	if err := c.do(ctx, http.MethodGet, "actions/"+url.PathEscape(action), "", nil, &act); err != nil {
+		return nil, err
+	}
+	return &act, nil
+}
+
+// ListUserGroups lists the user groups, by name.
+func (c *Client) ListUserGroups(ctx context.Context, keyspace string) ([]UserGroup, error) {
+	var list UserGroupList
+	err := c.do(ctx, http.MethodGet, "user_groups", keyspace, nil, &list)
+	return list.UserGroups, err
+}
+
+// GetUserGroup returns a user group.
+func (c *Client) GetUserGroup(ctx context.Context, keyspace, name string) (*UserGroup, error) {
+	var group UserGroup
+	if err := c.do(ctx, http.MethodGet, "user_groups/"+url.PathEscape(name), keyspace, nil, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// SetUserGroup creates a user group, or replaces its users.
+func (c *Client) SetUserGroup(ctx context.Context, keyspace string, group *UserGroup) (*UserGroup, error) {
+	var set UserGroup
+	if err := c.do(ctx, http.MethodPut, "user_groups/"+url.PathEscape(group.Name), keyspace, group, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// DeleteUserGroup deletes a user group.
+func (c *Client) DeleteUserGroup(ctx context.Context, keyspace, name string) error {
+	return c.do(ctx, http.MethodDelete, "user_groups/"+url.PathEscape(name), keyspace, nil, nil)
+}
+
+// ListMigrations lists the online DDL migrations of the shards of a keyspace.
+func (c *Client) ListMigrations(ctx context.Context, keyspace string) ([]Migration, error) {
+	var list MigrationList
+	err := c.do(ctx, http.MethodGet, "migrations", keyspace, nil, &list)
+	return list.Migrations, err
+}
+
+// GetMigration returns a migration, one per shard.
+func (c *Client) GetMigration(ctx context.Context, keyspace, uuid string) ([]Migration, error) {
+	var list MigrationList
+	err := c.do(ctx, http.MethodGet, "migrations/"+url.PathEscape(uuid), keyspace, nil, &list)
+	return list.Migrations, err
+}
+
+// SubmitMigration runs a DDL statement with a DDL strategy, and returns the
+// UUIDs of the migrations.
+func (c *Client) SubmitMigration(ctx context.Context, req *MigrationRequest) ([]string, error) {
+	var resp MigrationResponse
+	err := c.do(ctx, http.MethodPost, "migrations", "", req, &resp)
+	return resp.UUIDs, err
+}
+
+// AlterMigration runs one of MigrationActions on a migration.
+func (c *Client) AlterMigration(ctx context.Context, keyspace, uuid, action string) error {
+	return c.do(ctx, http.MethodPost, "migrations/"+url.PathEscape(uuid)+"/"+url.PathEscape(action), keyspace, nil, nil)
+}
+
+// GetRouting returns the default read/write splitting of the sessions.
+func (c *Client) GetRouting(ctx context.Context) (*Routing, error) {
+	var routing Routing
+	if err := c.do(ctx, http.MethodGet, "routing", "", nil, &routing); err != nil {
+		return nil, err
+	}
+	return &routing, nil
+}
+
+// UpdateRouting changes the default read/write splitting of the sessions.
+func (c *Client) UpdateRouting(ctx context.Context, update *RoutingUpdate) (*Routing, error) {
+	var routing Routing
+	if err := c.do(ctx, http.MethodPatch, "routing", "", update, &routing); err != nil {
+		return nil, err
+	}
+	return &routing, nil
+}
+
+// ListPlugins lists the versions of the plugins of the registry.
+func (c *Client) ListPlugins(ctx context.Context, keyspace string) ([]Plugin, error) {
+	var list PluginList
+	err := c.do(ctx, http.MethodGet, "plugins", keyspace, nil, &list)
+	return list.Plugins, err
+}
+
+// GetPlugin returns the version of a plugin a reference is to, as
+// ParsePluginReference reads it.
+func (c *Client) GetPlugin(ctx context.Context, keyspace, ref string) (*Plugin, error) {
+	var plugin Plugin
+	if err := c.do(ctx, http.MethodGet, "plugins/"+url.PathEscape(ref), keyspace, nil, &plugin); err != nil {
+		return nil, err
+	}
+	return &plugin, nil
+}
+
+// InstallPlugin installs the first version of a plugin.
+func (c *Client) InstallPlugin(ctx context.Context, keyspace string, upload *PluginUpload) (*Plugin, error) {
+	var plugin Plugin
+	if err := c.do(ctx, http.MethodPost, "plugins", keyspace, upload, &plugin); err != nil {
+		return nil, err
+	}
+	return &plugin, nil
+}
+
+// UpgradePlugin upgrades a plugin to a new version.
+func (c *Client) UpgradePlugin(ctx context.Context, keyspace string, upload *PluginUpload) (*Plugin, error) {
+	var plugin Plugin
+	if err := c.do(ctx, http.MethodPost, "plugins/"+url.PathEscape(upload.Name)+"/versions", keyspace, upload, &plugin); err != nil {
+		return nil, err
+	}
+	return &plugin, nil
+}
+
+// RollbackPlugin makes another version of a plugin current: the given one, or
+// the one installed before the current version if version is empty.
+func (c *Client) RollbackPlugin(ctx context.Context, keyspace, name, version string) (*Plugin, error) {
+	var plugin Plugin
+	if err := c.do(ctx, http.MethodPost, "plugins/"+url.PathEscape(name)+"/rollback", keyspace, &PluginRollback{Version: version}, &plugin); err != nil {
+		return nil, err
+	}
+	return &plugin, nil
+}
+
+// GetHealth returns the health of the tablets of a keyspace. An empty keyspace
+// is all the keyspaces.
+func (c *Client) GetHealth(ctx context.Context, keyspace string) ([]TabletHealth, error) {
+	var health Health
+	err := c.do(ctx, http.MethodGet, "health", keyspace, nil, &health)
+	return health.Tablets, err
+}
+
+// GetLoad returns the load signals of the tablets of a keyspace, and of the
+// vtgate. An empty keyspace is all the keyspaces.
+func (c *Client) GetLoad(ctx context.Context, keyspace string) (*Load, error) {
+	var load Load
+	if err := c.do(ctx, http.MethodGet, "load", keyspace, nil, &load); err != nil {
+		return nil, err
+	}
+	return &load, nil
+}
+
+// CaptureWorkload streams the queries vtgate serves for a duration to w, in
+// the format workload.ReadQueries reads. The request lasts the whole duration,
+// so the HTTP client must not time out sooner.
+func (c *Client) CaptureWorkload(ctx context.Context, duration time.Duration, w io.Writer) (int64, error) {
+	u := c.baseURL + PathPrefix + "workload/capture?" + url.Values{"duration": {duration.String()}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return 0, err
+		}
+		return 0, responseError(resp.StatusCode, data)
+	}
+	return io.Copy(w, resp.Body)
+}
+
+func (c *Client) do(ctx context.Context, method, path, keyspace string, in, out any) error {
+	return c.doWithQuery(ctx, method, path, keyspace, nil, in, out)
+}
+
+// doWithQuery is do with the parameters of query, besides the keyspace.
+func (c *Client) doWithQuery(ctx context.Context, method, path, keyspace string, query url.Values, in, out any) error {
+	u := c.baseURL + PathPrefix + path
+	if keyspace != "" {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("keyspace", keyspace)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	// The documents are sent as is, the other bodies in JSON.
+	var body io.Reader
+	contentType := "application/json"
+	switch in := in.(type) {
+	case nil:
+	case []byte:
+		body, contentType = bytes.NewReader(in), "application/yaml"
+	default:
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return responseError(resp.StatusCode, data)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	// The numbers of the bind variable conditions are kept as json.Number, as
+	// rules.BuildQueryRule reads them.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("invalid response to %s %s: %v", method, path, err)
+	}
+	return nil
+}
+
+// responseError returns the *Error of the body of a failed request.
+func responseError(status int, data []byte) error {
+	var errResp ErrorResponse
+	if err := json.Unmarshal(data, &errResp); err != nil || errResp.Error.Message == "" {
+		errResp.Error.Message = strings.TrimSpace(string(data))
+	}
+	errResp.Error.Status = status
+	return &errResp.Error
+}
@@ -0,0 +1,173 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package adminapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// specOperation returns the id of the operation of the spec matching the
+// method and the path of a request.
+func specOperation(t *testing.T, method, path string) string {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(Spec, &spec))
+	segments := strings.Split(strings.TrimPrefix(path, PathPrefix), "/")
+	for template, operations := range spec.Paths {
+		templateSegments := strings.Split(strings.TrimPrefix(template, "/"), "/")
+		if len(templateSegments) != len(segments) {
+			continue
+		}
+		matches := true
+		for i, segment := range templateSegments {
+			if !strings.HasPrefix(segment, "{") && segment != segments[i] {
+				matches = false
+			}
+		}
+		if !matches {
+			continue
+		}
+		var operation struct {
+			OperationID string `json:"operationId"`
+		}
+		if data, ok := operations[strings.ToLower(method)]; ok {
+			require.NoError(t, json.Unmarshal(data, &operation))
+			return operation.OperationID
+		}
+	}
+	return ""
+}
+
+// TestClientFollowsSpec checks that every method of the client sends a
+// request the spec describes.
+func TestClientFollowsSpec(t *testing.T) {
+	var operations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := specOperation(t, r.Method, r.URL.Path)
+		assert.NotEmpty(t, operation, "%s %s is not in the spec", r.Method, r.URL.Path)
+		operations = append(operations, operation)
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "admin", user)
+		assert.Equal(t, "secret", password)
+		if r.Method == http.MethodDelete || strings.Count(r.URL.Path, "/") == 5 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := NewClient(server.URL+"/").WithBasicAuth("admin", "secret")
+	filter := &Filter{Name: "no deletes", Action: "FAIL"}
+	_, err := c.ListFilters(ctx, "ks")
+	require.NoError(t, err)
+	_, err = c.GetFilter(ctx, "", filter.Name)
+	require.NoError(t, err)
+	_, err = c.CreateFilter(ctx, "", filter)
+	require.NoError(t, err)
+	_, err = c.UpdateFilter(ctx, "", filter)
+	require.NoError(t, err)
+	require.NoError(t, c.DeleteFilter(ctx, "", filter.Name))
+	_, err = c.ListFilterVersions(ctx, "", filter.Name)
+	require.NoError(t, err)
+	_, err = c.RollbackFilter(ctx, "", filter.Name, 1)
+	require.NoError(t, err)
+	_, err = c.ExportFilters(ctx, "", "db")
+	require.NoError(t, err)
+	_, err = c.ImportFilters(ctx, "", []byte("filters:\n- name: f\n  action: FAIL\n"), FilterImportOptions{Prune: true})
+	require.NoError(t, err)
+	_, err = c.ListActions(ctx)
+	require.NoError(t, err)
+	_, err = c.GetAction(ctx, "FAIL")
+	require.NoError(t, err)
+	_, err = c.ListUserGroups(ctx, "")
+	require.NoError(t, err)
+	_, err = c.GetUserGroup(ctx, "", "analytics")
+	require.NoError(t, err)
+	_, err = c.SetUserGroup(ctx, "", &UserGroup{Name: "analytics", Users: []string{"etl"}})
+	require.NoError(t, err)
+	require.NoError(t, c.DeleteUserGroup(ctx, "", "analytics"))
+	_, err = c.ListMigrations(ctx, "ks")
+	require.NoError(t, err)
+	_, err = c.GetMigration(ctx, "", "aa_bb")
+	require.NoError(t, err)
+	_, err = c.SubmitMigration(ctx, &MigrationRequest{SQL: "alter table t add column c int"})
+	require.NoError(t, err)
+	require.NoError(t, c.AlterMigration(ctx, "", "aa_bb", "cancel"))
+	_, err = c.GetRouting(ctx)
+	require.NoError(t, err)
+	_, err = c.UpdateRouting(ctx, &RoutingUpdate{})
+	require.NoError(t, err)
+	_, err = c.ListPlugins(ctx, "")
+	require.NoError(t, err)
+	_, err = c.GetPlugin(ctx, "", "mask@1.0")
+	require.NoError(t, err)
+	_, err = c.InstallPlugin(ctx, "", &PluginUpload{Name: "mask", Version: "1.0"})
+	require.NoError(t, err)
+	_, err = c.UpgradePlugin(ctx, "", &PluginUpload{Name: "mask", Version: "1.1"})
+	require.NoError(t, err)
+	_, err = c.RollbackPlugin(ctx, "", "mask", "")
+	require.NoError(t, err)
+	_, err = c.GetHealth(ctx, "")
+	require.NoError(t, err)
+	_, err = c.GetLoad(ctx, "")
+	require.NoError(t, err)
+	var captured strings.Builder
+	_, err = c.CaptureWorkload(ctx, time.Minute, &captured)
+	require.NoError(t, err)
+	assert.Equal(t, "{}", captured.String())
+
+	assert.Equal(t, []string{
+		"listFilters", "getFilter", "createFilter", "updateFilter", "deleteFilter", "listFilterVersions", "rollbackFilter",
+		"exportFilters", "importFilters",
+		"listActions", "getAction",
+		"listUserGroups", "getUserGroup", "setUserGroup", "deleteUserGroup",
+		"listMigrations", "getMigration", "submitMigration", "alterMigration",
+		"getRouting", "updateRouting",
+		"listPlugins", "getPlugin", "installPlugin", "upgradePlugin", "rollbackPlugin",
+		"getHealth", "getLoad", "captureWorkload",
+	}, operations)
+}
+
+func TestParsePluginReference(t *testing.T) {
+	name, version, err := ParsePluginReference("mask@1.2.0-rc+1")
+	require.NoError(t, err)
+	assert.Equal(t, "mask", name)
+	assert.Equal(t, "1.2.0-rc+1", version)
+	name, version, err = ParsePluginReference("mask")
+	require.NoError(t, err)
+	assert.Equal(t, "mask", name)
+	assert.Empty(t, version)
+
+	for _, ref := range []string{"", "@1.0", "mask@", "ma sk", "mask@1@2"} {
+		_, _, err := ParsePluginReference(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": {"code": 1105, "sql_state": "HY000", "message": "filter x not found"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL).GetFilter(context.Background(), "", "x")
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, &Error{Status: http.StatusNotFound, Code: 1105, SQLState: "HY000", Message: "filter x not found"}, apiErr)
+}
@@ -0,0 +1,16 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package adminapi
+
+import (
+	_ "embed"
+)
+
+// Spec is the OpenAPI 3 description of the API, served at
+// /api/v1/openapi.json.
+//
+//go:embed openapi.json
+var Spec []byte
@@ -0,0 +1,475 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package adminapi has the types, the OpenAPI description and a Go client of
+// the admin API of vtgate, served under /api/v1/ when vtgate runs with
+// --enable_admin_api.
+//
+// The API administers the filters, the online DDL migrations, the registry of
+// WASM plugins and the read/write splitting of the cluster, reports the
+// health and the load of its tablets, and captures the queries vtgate serves.
+// The filters, the migrations and the plugins are administered with the same
+// SQL statements a MySQL client would run, so the API is only a stable surface
+// over them: its version, in the path, changes if a change of its types or
+// paths would break the clients.
+package adminapi
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Version is the version of the API, which prefixes its paths.
+const Version = "v1"
+
+// PathPrefix is the prefix of the paths of the API.
+const PathPrefix = "/api/" + Version + "/"
+
+// Filter is a query rule of the mysql.wescale_plugin table, which the
+// tablets load as their DATABASE_CUSTOM_RULE rules. Its table names starting
+// with ! and its regexps of the form (?!re) are negated, like !db.audit or
+// (?!batch_svc), see rules.Rule.AddTableCond and rules.Rule.SetUserCond.
+type Filter struct {
+	Name                     string   `json:"name"`
+	Description              string   `json:"description,omitempty"`
+	Priority                 int      `json:"priority"`
+	Status                   string   `json:"status"`
+	Plans                    []string `json:"plans,omitempty"`
+	FullyQualifiedTableNames []string `json:"fully_qualified_table_names,omitempty"`
+	QueryRegex               string   `json:"query_regex,omitempty"`
+	QueryTemplate            string   `json:"query_template,omitempty"`
+	RequestIPRegex           string   `json:"request_ip_regex,omitempty"`
+	UserRegex                string   `json:"user_regex,omitempty"`
+	WorkloadClassRegex       string   `json:"workload_class_regex,omitempty"`
+	LeadingCommentRegex      string   `json:"leading_comment_regex,omitempty"`
+	TrailingCommentRegex     string   `json:"trailing_comment_regex,omitempty"`
+	// BindVarConds are in the format of the BindVarConds of the rules files,
+	// with the Name, OnAbsent, OnMismatch, Operator and Value keys.
+	BindVarConds []map[string]any `json:"bind_var_conds,omitempty"`
+	Action       string           `json:"action"`
+	ActionArgs   string           `json:"action_args,omitempty"`
+	// Schedule is the JSON activation schedule of the filter, see
+	// rules.Schedule.
+	Schedule string `json:"schedule,omitempty"`
+	// OutcomeConds are the JSON post execution conditions of the filter, see
+	// rules.OutcomeConds.
+	OutcomeConds string `json:"outcome_conds,omitempty"`
+	// AccessConds are the JSON conditions of the filter on how MySQL
+	// accesses the tables of the queries, see rules.AccessConds.
+	AccessConds string `json:"access_conds,omitempty"`
+	// RequestCIDRs are the CIDR ranges the client IP of the queries is
+	// matched against, the ones starting with ! excluded.
+	RequestCIDRs []string `json:"request_cidrs,omitempty"`
+	// UserGroups are the user groups the user of the queries is matched
+	// against, the ones starting with ! excluded, see UserGroup.
+	UserGroups []string `json:"user_groups,omitempty"`
+	// InTransaction, if set, matches the queries in an explicit transaction
+	// when true and the other ones, like the autocommit ones, when false.
+	InTransaction *bool `json:"in_transaction,omitempty"`
+	// QueryDigest is the digest of the normalized queries the filter
+	// matches, like the ${digest} of the messages of FAIL.
+	QueryDigest string `json:"query_digest,omitempty"`
+	// ExpiresAt, if set, is the time the filter expires at, when it stops
+	// matching and the primary tablets delete it.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// RuleInfo returns the filter in the format of the rules files, which
+// rules.BuildQueryRule reads.
+func (f *Filter) RuleInfo() map[string]any {
+	ruleInfo := map[string]any{
+		"Name":     f.Name,
+		"Priority": f.Priority,
+		"Status":   f.Status,
+		"Action":   f.Action,
+	}
+	for key, value := range map[string]string{
+		"Description":     f.Description,
+		"Query":           f.QueryRegex,
+		"QueryTemplate":   f.QueryTemplate,
+		"QueryDigest":     f.QueryDigest,
+		"RequestIP":       f.RequestIPRegex,
+		"User":            f.UserRegex,
+		"WorkloadClass":   f.WorkloadClassRegex,
+		"LeadingComment":  f.LeadingCommentRegex,
+		"TrailingComment": f.TrailingCommentRegex,
+		"ActionArgs":      f.ActionArgs,
+		"Schedule":        f.Schedule,
+		"OutcomeConds":    f.OutcomeConds,
+		"AccessConds":     f.AccessConds,
+	} {
+		if value != "" {
+			ruleInfo[key] = value
+		}
+	}
+	for key, values := range map[string][]string{"Plans": f.Plans, "FullyQualifiedTableNames": f.FullyQualifiedTableNames, "RequestCIDRs": f.RequestCIDRs, "UserGroups": f.UserGroups} {
+		if values != nil {
+			list := make([]any, len(values))
+			for i, v := range values {
+				list[i] = v
+			}
+			ruleInfo[key] = list
+		}
+	}
+	if f.BindVarConds != nil {
+		list := make([]any, len(f.BindVarConds))
+		for i, v := range f.BindVarConds {
+			list[i] = v
+		}
+		ruleInfo["BindVarConds"] = list
+	}
+	if f.InTransaction != nil {
+		ruleInfo["InTransaction"] = *f.InTransaction
+	}
+	if f.ExpiresAt != nil {
+		ruleInfo["ExpiresAt"] = f.ExpiresAt.Format(time.RFC3339)
+	}
+	return ruleInfo
+}
+
+// FilterList is the response to a list of the filters.
+type FilterList struct {
+	Filters []Filter `json:"filters"`
+}
+
+// FilterDocument is a document of filters, which the filters of a cluster
+// are exported to and imported from, in JSON or YAML, to manage them in
+// version control.
+type FilterDocument struct {
+	// Database, if set, qualifies the names of all the filters of the
+	// document, like db in db.no_deletes: the document has the filters of
+	// that database.
+	Database string   `json:"database,omitempty"`
+	Filters  []Filter `json:"filters"`
+}
+
+// FilterImportOptions are the options of an import of a FilterDocument.
+type FilterImportOptions struct {
+	// Database is the database of the filters of the document, by default
+	// its own Database.
+	Database string
+	// Prune deletes the filters which the document doesn't have, the ones of
+	// Database if set.
+	Prune bool
+	// DryRun checks the document and reports the changes without making
+	// them.
+	DryRun bool
+}
+
+// FilterImportResult reports the changes of an import, by filter name.
+type FilterImportResult struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Deleted   []string `json:"deleted"`
+	Unchanged []string `json:"unchanged"`
+	DryRun    bool     `json:"dry_run,omitempty"`
+}
+
+// The operations which change the filters, and add a version to their
+// history.
+const (
+	FilterCreated    = "create"
+	FilterUpdated    = "update"
+	FilterDeleted    = "delete"
+	FilterRolledBack = "rollback"
+)
+
+// FilterVersion is a version of a filter of the mysql.wescale_filter_version
+// table, which keeps the history of the changes the admin API made to it.
+type FilterVersion struct {
+	// Version numbers the versions of a filter, from 1.
+	Version   int64  `json:"version"`
+	Operation string `json:"operation"`
+	// ChangedBy is the user who made the change.
+	ChangedBy string `json:"changed_by,omitempty"`
+	ChangedAt string `json:"changed_at,omitempty"`
+	// RollbackTo is the version a rollback restored.
+	RollbackTo int64 `json:"rollback_to,omitempty"`
+	// Filter is the definition of the filter, nil if it was deleted.
+	Filter *Filter `json:"filter,omitempty"`
+}
+
+// FilterVersionList is the response to a list of the versions of a filter.
+type FilterVersionList struct {
+	Versions []FilterVersion `json:"versions"`
+}
+
+// FilterRollback restores a previous version of a filter.
+type FilterRollback struct {
+	// Version is the version to roll back to, by default the one before the
+	// latest version.
+	Version int64 `json:"version,omitempty"`
+}
+
+// Action describes an action of the filters. The action args of a filter are
+// a JSON object of its params, which are checked when the filter is written.
+type Action struct {
+	Action      string        `json:"action"`
+	Description string        `json:"description"`
+	Params      []ActionParam `json:"params,omitempty"`
+	Constraints []string      `json:"constraints,omitempty"`
+}
+
+// ActionParam describes a param of an action, or the items of a list param.
+type ActionParam struct {
+	Name        string `json:"name,omitempty"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Default     string `json:"default,omitempty"`
+	// Range is the range of a number or a duration, like >= 0 or in (0, 100].
+	Range       string        `json:"range,omitempty"`
+	Enum        []string      `json:"enum,omitempty"`
+	Keys        []string      `json:"keys,omitempty"`
+	Items       *ActionParam  `json:"items,omitempty"`
+	Params      []ActionParam `json:"params,omitempty"`
+	Constraints []string      `json:"constraints,omitempty"`
+	// Captures is set for the strings in which ${name} stands for a capture
+	// of the named groups of the regexps of the filter.
+	Captures bool `json:"captures,omitempty"`
+}
+
+// ActionList is the response to a list of the actions.
+type ActionList struct {
+	Actions []Action `json:"actions"`
+}
+
+// Migration is an online DDL migration of a shard.
+type Migration struct {
+	UUID        string  `json:"uuid"`
+	Keyspace    string  `json:"keyspace"`
+	Shard       string  `json:"shard"`
+	Table       string  `json:"table"`
+	Statement   string  `json:"statement"`
+	Strategy    string  `json:"strategy"`
+	Options     string  `json:"options,omitempty"`
+	Status      string  `json:"status"`
+	Message     string  `json:"message,omitempty"`
+	Progress    float64 `json:"progress"`
+	AddedAt     string  `json:"added_at,omitempty"`
+	StartedAt   string  `json:"started_at,omitempty"`
+	CompletedAt string  `json:"completed_at,omitempty"`
+}
+
+// MigrationList is the response to a list of the migrations.
+type MigrationList struct {
+	Migrations []Migration `json:"migrations"`
+}
+
+// MigrationRequest submits a DDL statement as a migration.
+type MigrationRequest struct {
+	SQL string `json:"sql"`
+	// Strategy is a DDL strategy, like "online --postpone-completion". The
+	// default is --ddl_strategy of vtgate.
+	Strategy string `json:"strategy,omitempty"`
+	Keyspace string `json:"keyspace,omitempty"`
+}
+
+// MigrationResponse has the UUIDs of the submitted migrations. It is empty if
+// the DDL strategy is direct, since the statement then ran right away.
+type MigrationResponse struct {
+	UUIDs []string `json:"uuids"`
+}
+
+// MigrationActions are the actions on a migration, as in
+// ALTER VITESS_MIGRATION '<uuid>' <action>.
+var MigrationActions = []string{"cancel", "retry", "complete", "cleanup", "launch", "pause", "resume", "throttle", "unthrottle"}
+
+// Routing is the read/write splitting vtgate applies to the sessions which
+// don't set their own, as with SET GLOBAL.
+type Routing struct {
+	ReadWriteSplittingPolicy  string  `json:"read_write_splitting_policy"`
+	ReadWriteSplittingRatio   int     `json:"read_write_splitting_ratio"`
+	ReadAfterWriteConsistency string  `json:"read_after_write_consistency"`
+	ReadAfterWriteTimeout     float64 `json:"read_after_write_timeout"`
+}
+
+// RoutingUpdate changes the fields of the routing that are set.
+type RoutingUpdate struct {
+	ReadWriteSplittingPolicy  *string  `json:"read_write_splitting_policy,omitempty"`
+	ReadWriteSplittingRatio   *int     `json:"read_write_splitting_ratio,omitempty"`
+	ReadAfterWriteConsistency *string  `json:"read_after_write_consistency,omitempty"`
+	ReadAfterWriteTimeout     *float64 `json:"read_after_write_timeout,omitempty"`
+}
+
+// UserGroup is a named group of users of the mysql.wescale_user_group table,
+// which the filters match with their user groups instead of one filter per
+// user.
+type UserGroup struct {
+	Name  string   `json:"name"`
+	Users []string `json:"users"`
+}
+
+// UserGroupList is the response to a list of the user groups.
+type UserGroupList struct {
+	UserGroups []UserGroup `json:"user_groups"`
+}
+
+// Plugin is a version of a WASM plugin of the mysql.wescale_wasm_plugin
+// table. The registry keeps every version of a plugin; one of them is its
+// current version.
+type Plugin struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	Description string            `json:"description,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	// Checksum is the SHA-256 of the binary of the plugin, in hex.
+	Checksum  string `json:"checksum"`
+	Size      int64  `json:"size"`
+	Current   bool   `json:"current"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// PluginList is the response to a list of the plugins.
+type PluginList struct {
+	Plugins []Plugin `json:"plugins"`
+}
+
+// PluginUpload installs a plugin, or upgrades it to a new version.
+type PluginUpload struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	Description string            `json:"description,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	// Binary is the WASM module, base64 encoded in JSON.
+	Binary []byte `json:"binary"`
+	// Checksum, if set, is the SHA-256 of Binary in hex, which the upload is
+	// checked against.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// PluginRollback makes another version of a plugin current.
+type PluginRollback struct {
+	// Version is the version to roll back to, by default the one installed
+	// before the current version.
+	Version string `json:"version,omitempty"`
+}
+
+var (
+	pluginNameRegexp    = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+	pluginVersionRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.+\-]+$`)
+)
+
+// ParsePluginReference parses a reference to a plugin, as the rules make:
+// name@version is that version of the plugin, and name alone is its current
+// version, so the rules only follow the upgrades they don't pin.
+func ParsePluginReference(ref string) (name, version string, err error) {
+	name, version, pinned := strings.Cut(ref, "@")
+	if err := CheckPluginName(name); err != nil {
+		return "", "", err
+	}
+	if pinned {
+		if err := CheckPluginVersion(version); err != nil {
+			return "", "", err
+		}
+	}
+	return name, version, nil
+}
+
+// CheckPluginName checks the name of a plugin.
+func CheckPluginName(name string) error {
+	if !pluginNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid plugin name %q: must be letters, digits, _ and -", name)
+	}
+	return nil
+}
+
+// CheckUserGroupName checks the name of a user group.
+func CheckUserGroupName(name string) error {
+	if !pluginNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid user group name %q: must be letters, digits, _ and -", name)
+	}
+	return nil
+}
+
+// CheckPluginVersion checks the version of a plugin.
+func CheckPluginVersion(version string) error {
+	if !pluginVersionRegexp.MatchString(version) {
+		return fmt.Errorf("invalid plugin version %q: must be letters, digits, _, -, + and .", version)
+	}
+	return nil
+}
+
+// Health is the health of the tablets vtgate routes the queries to, as its
+// health checks see it.
+type Health struct {
+	Tablets []TabletHealth `json:"tablets"`
+}
+
+// TabletHealth is the health of a tablet.
+type TabletHealth struct {
+	Alias      string `json:"alias"`
+	Hostname   string `json:"hostname"`
+	Keyspace   string `json:"keyspace"`
+	Shard      string `json:"shard"`
+	TabletType string `json:"tablet_type"`
+	Serving    bool   `json:"serving"`
+	// ReplicationLagSeconds is 0 on the primary tablets.
+	ReplicationLagSeconds uint32  `json:"replication_lag_seconds"`
+	QPS                   float64 `json:"qps"`
+	// Error is the last error of the health check of the tablet, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Load is the load of the cluster as a vtgate sees it, to drive the
+// autoscalers which add or remove vtgates and replicas. Its signals are ratios
+// between 0, idle, and 1, saturated, which an autoscaler can target, like 0.7.
+type Load struct {
+	VTGate VTGateLoad  `json:"vtgate"`
+	Shards []ShardLoad `json:"shards"`
+}
+
+// VTGateLoad is the load of the vtgate which served the request. The load of
+// the cluster is spread over its vtgates, so it scales them.
+type VTGateLoad struct {
+	QPS float64 `json:"qps"`
+	// MaxQPS is the QPS a vtgate is sized for, its --load_signal_max_qps.
+	MaxQPS float64 `json:"max_qps"`
+	// QPSHeadroom is 1 - QPS/MaxQPS, and at least 0. It is 1 if MaxQPS is 0.
+	QPSHeadroom     float64 `json:"qps_headroom"`
+	BusyConnections int64   `json:"busy_connections"`
+}
+
+// ShardLoad is the load of the serving tablets of a type of a shard, which
+// scales its replicas.
+type ShardLoad struct {
+	Keyspace   string `json:"keyspace"`
+	Shard      string `json:"shard"`
+	TabletType string `json:"tablet_type"`
+	// Tablets is the number of serving tablets.
+	Tablets int     `json:"tablets"`
+	QPS     float64 `json:"qps"`
+	// PoolSaturation is the average ratio of the connections of the tablets
+	// in use, to the --load_signal_tablet_pool_size of vtgate. It is 1 if no
+	// tablet is serving.
+	PoolSaturation float64 `json:"pool_saturation"`
+	// ReplicationLagSeconds is the highest replication lag of the tablets.
+	ReplicationLagSeconds uint32 `json:"replication_lag_seconds"`
+	// ReplicationLag is ReplicationLagSeconds over the
+	// --discovery_low_replication_lag of vtgate, and at most 1.
+	ReplicationLag float64 `json:"replication_lag"`
+}
+
+// Error is the error of a failed request, with the MySQL error code and SQL
+// state of the statement that failed, if any.
+type Error struct {
+	// Status is the HTTP status code of the response. It isn't part of the
+	// response body.
+	Status   int    `json:"-"`
+	Code     int    `json:"code"`
+	SQLState string `json:"sql_state"`
+	Message  string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("admin API error %d: %s (errno %d) (sqlstate %s)", e.Status, e.Message, e.Code, e.SQLState)
+}
+
+// ErrorResponse is the body of the response to a failed request.
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
@@ -127,6 +127,10 @@ func debugEnvHandler(_ *VTGate, w http.ResponseWriter, r *http.Request) {
 			setDurationVal(discovery.SetHighReplicationLagMinServing)
 		case "min_num_tablets":
 			setIntVal(discovery.SetMinNumTablets)
+		case "scatter_max_parallelism_per_query":
+			setIntVal(SetScatterMaxParallelismPerQuery)
+		case "scatter_max_parallelism_per_tablet":
+			setIntVal(SetScatterMaxParallelismPerTablet)
 		}
 	}
 
@@ -146,6 +150,8 @@ func debugEnvHandler(_ *VTGate, w http.ResponseWriter, r *http.Request) {
 	addDurationVar("discovery_low_replication_lag", discovery.GetLowReplicationLag)
 	addDurationVar("discovery_high_replication_lag_minimum_serving", discovery.GetHighReplicationLagMinServing)
 	addIntVar("min_num_tablets", discovery.GetMinNumTablets)
+	addIntVar("scatter_max_parallelism_per_query", GetScatterMaxParallelismPerQuery)
+	addIntVar("scatter_max_parallelism_per_tablet", GetScatterMaxParallelismPerTablet)
 
 	format := r.FormValue("format")
 	if format == "json" {
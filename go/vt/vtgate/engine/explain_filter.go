@@ -0,0 +1,83 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package engine
+
+import (
+	"context"
+
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+var _ Primitive = (*ExplainFilter)(nil)
+
+// ExplainFilterFields are the fields of EXPLAIN FILTER, one row by filter the
+// query matches, in the order the tablets apply their actions.
+var ExplainFilterFields = sqltypes.MakeTestFields("order|name|priority|action|action_args|status", "int64|varchar|int64|varchar|text|varchar")
+
+// ExplainFilter is the primitive of EXPLAIN FILTER, which returns the filters
+// Query would match, without executing it. The empty Database, User and IP
+// are the ones of the session.
+type ExplainFilter struct {
+	Query    string
+	Database string
+	User     string
+	IP       string
+
+	noInputs
+	noTxNeeded
+}
+
+// RouteType implements the Primitive interface.
+func (e *ExplainFilter) RouteType() string {
+	return "ExplainFilter"
+}
+
+// GetKeyspaceName implements the Primitive interface.
+func (e *ExplainFilter) GetKeyspaceName() string {
+	return ""
+}
+
+// GetTableName implements the Primitive interface.
+func (e *ExplainFilter) GetTableName() string {
+	return ""
+}
+
+// GetFields implements the Primitive interface.
+func (e *ExplainFilter) GetFields(context.Context, VCursor, map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	return &sqltypes.Result{Fields: ExplainFilterFields}, nil
+}
+
+// TryExecute implements the Primitive interface.
+func (e *ExplainFilter) TryExecute(ctx context.Context, vcursor VCursor, _ map[string]*querypb.BindVariable, _ bool) (*sqltypes.Result, error) {
+	return vcursor.ExplainFilter(ctx, e.Query, e.Database, e.User, e.IP)
+}
+
+// TryStreamExecute implements the Primitive interface.
+func (e *ExplainFilter) TryStreamExecute(ctx context.Context, vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
+	qr, err := e.TryExecute(ctx, vcursor, bindVars, wantfields)
+	if err != nil {
+		return err
+	}
+	return callback(qr)
+}
+
+func (e *ExplainFilter) description() PrimitiveDescription {
+	other := map[string]any{"Query": e.Query}
+	if e.Database != "" {
+		other["Database"] = e.Database
+	}
+	if e.User != "" {
+		other["User"] = e.User
+	}
+	if e.IP != "" {
+		other["IP"] = e.IP
+	}
+	return PrimitiveDescription{
+		OperatorType: "ExplainFilter",
+		Other:        other,
+	}
+}
@@ -46,6 +46,7 @@ import (
 )
 
 var testMaxMemoryRows = 100
+var testSortSpiller *SortSpiller
 var testIgnoreMaxMemoryRows = false
 
 var _ VCursor = (*noopVCursor)(nil)
@@ -128,6 +129,22 @@ func (t *noopVCursor) ShowExec(_ context.Context, _ sqlparser.ShowCommandType, _
 	panic("implement me")
 }
 
+func (t *noopVCursor) VirtualTableExec(_ context.Context, _, _ string) (*sqltypes.Result, error) {
+	panic("implement me")
+}
+
+func (t *noopVCursor) ExportFilters(_ context.Context, _, _ string) (*sqltypes.Result, error) {
+	panic("implement me")
+}
+
+func (t *noopVCursor) ImportFilters(_ context.Context, _, _ string, _ bool) (*sqltypes.Result, error) {
+	panic("implement me")
+}
+
+func (t *noopVCursor) ExplainFilter(_ context.Context, _, _, _, _ string) (*sqltypes.Result, error) {
+	panic("implement me")
+}
+
 // SetContextWithValue implements VCursor interface.
 func (t *noopVCursor) SetContextWithValue(_, _ interface{}) func() {
 	return func() {}
@@ -234,6 +251,10 @@ func (t *noopVCursor) SetSessionTrackGTIDs(_ bool) {
 	panic("implement me")
 }
 
+func (t *noopVCursor) SetSnapshotReadGTID(_ string) error {
+	panic("implement me")
+}
+
 func (t *noopVCursor) SetReadAfterWriteConsistency(_ vtgatepb.ReadAfterWriteConsistency) {
 	panic("implement me")
 }
@@ -340,6 +361,10 @@ func (t *noopVCursor) ExceedsMaxMemoryRows(numRows int) bool {
 	return !testIgnoreMaxMemoryRows && numRows > testMaxMemoryRows
 }
 
+func (t *noopVCursor) SortSpiller() *SortSpiller {
+	return testSortSpiller
+}
+
 func (t *noopVCursor) GetKeyspace() string {
 	return ""
 }
@@ -0,0 +1,139 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package engine
+
+import (
+	"context"
+
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+var _ Primitive = (*ExportFilters)(nil)
+var _ Primitive = (*ImportFilters)(nil)
+
+// ExportFiltersFields are the fields of EXPORT FILTERS, one row with the
+// document.
+var ExportFiltersFields = sqltypes.MakeTestFields("document", "text")
+
+// ImportFiltersFields are the fields of IMPORT FILTERS, one row by filter of
+// the document or pruned, with its change: created, updated, deleted or
+// unchanged.
+var ImportFiltersFields = sqltypes.MakeTestFields("name|change", "varchar|varchar")
+
+// ExportFilters is the primitive of EXPORT FILTERS, which returns the
+// document of the filters of Database, or of all the filters.
+type ExportFilters struct {
+	Database string
+	Format   string
+
+	noInputs
+	noTxNeeded
+}
+
+// RouteType implements the Primitive interface.
+func (e *ExportFilters) RouteType() string {
+	return "ExportFilters"
+}
+
+// GetKeyspaceName implements the Primitive interface.
+func (e *ExportFilters) GetKeyspaceName() string {
+	return ""
+}
+
+// GetTableName implements the Primitive interface.
+func (e *ExportFilters) GetTableName() string {
+	return ""
+}
+
+// GetFields implements the Primitive interface.
+func (e *ExportFilters) GetFields(context.Context, VCursor, map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	return &sqltypes.Result{Fields: ExportFiltersFields}, nil
+}
+
+// TryExecute implements the Primitive interface.
+func (e *ExportFilters) TryExecute(ctx context.Context, vcursor VCursor, _ map[string]*querypb.BindVariable, _ bool) (*sqltypes.Result, error) {
+	return vcursor.ExportFilters(ctx, e.Database, e.Format)
+}
+
+// TryStreamExecute implements the Primitive interface.
+func (e *ExportFilters) TryStreamExecute(ctx context.Context, vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
+	qr, err := e.TryExecute(ctx, vcursor, bindVars, wantfields)
+	if err != nil {
+		return err
+	}
+	return callback(qr)
+}
+
+func (e *ExportFilters) description() PrimitiveDescription {
+	other := map[string]any{}
+	if e.Database != "" {
+		other["Database"] = e.Database
+	}
+	if e.Format != "" {
+		other["Format"] = e.Format
+	}
+	return PrimitiveDescription{
+		OperatorType: "ExportFilters",
+		Other:        other,
+	}
+}
+
+// ImportFilters is the primitive of IMPORT FILTERS, which makes the filters
+// of Database the ones of Document in one transaction.
+type ImportFilters struct {
+	Database string
+	Document string
+	Prune    bool
+
+	noInputs
+	noTxNeeded
+}
+
+// RouteType implements the Primitive interface.
+func (i *ImportFilters) RouteType() string {
+	return "ImportFilters"
+}
+
+// GetKeyspaceName implements the Primitive interface.
+func (i *ImportFilters) GetKeyspaceName() string {
+	return ""
+}
+
+// GetTableName implements the Primitive interface.
+func (i *ImportFilters) GetTableName() string {
+	return ""
+}
+
+// GetFields implements the Primitive interface.
+func (i *ImportFilters) GetFields(context.Context, VCursor, map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	return &sqltypes.Result{Fields: ImportFiltersFields}, nil
+}
+
+// TryExecute implements the Primitive interface.
+func (i *ImportFilters) TryExecute(ctx context.Context, vcursor VCursor, _ map[string]*querypb.BindVariable, _ bool) (*sqltypes.Result, error) {
+	return vcursor.ImportFilters(ctx, i.Database, i.Document, i.Prune)
+}
+
+// TryStreamExecute implements the Primitive interface.
+func (i *ImportFilters) TryStreamExecute(ctx context.Context, vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
+	qr, err := i.TryExecute(ctx, vcursor, bindVars, wantfields)
+	if err != nil {
+		return err
+	}
+	return callback(qr)
+}
+
+func (i *ImportFilters) description() PrimitiveDescription {
+	other := map[string]any{"Prune": i.Prune}
+	if i.Database != "" {
+		other["Database"] = i.Database
+	}
+	return PrimitiveDescription{
+		OperatorType: "ImportFilters",
+		Other:        other,
+	}
+}
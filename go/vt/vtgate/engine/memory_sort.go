@@ -67,6 +67,20 @@ func (ms *MemorySort) SetTruncateColumnCount(count int) {
 
 // TryExecute satisfies the Primitive interface.
 func (ms *MemorySort) TryExecute(ctx context.Context, vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool) (*sqltypes.Result, error) {
+	if vcursor.SortSpiller() != nil {
+		// Streaming the input lets the sort spill it to disk, instead of
+		// holding all of it in memory.
+		result := &sqltypes.Result{}
+		err := ms.TryStreamExecute(ctx, vcursor, bindVars, wantfields, func(qr *sqltypes.Result) error {
+			result.AppendResult(qr)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
 	count, err := ms.fetchCount(vcursor, bindVars)
 	if err != nil {
 		return nil, err
@@ -108,6 +122,14 @@ func (ms *MemorySort) TryStreamExecute(ctx context.Context, vcursor VCursor, bin
 		comparers: extractSlices(ms.OrderBy),
 		reverse:   true,
 	}
+	// runs holds the rows spilled to disk when the heap grows past the max
+	// memory rows. They are merged with the last rows of the heap at the end.
+	var runs []*spillRun
+	defer func() {
+		for _, run := range runs {
+			run.close()
+		}
+	}()
 	err = vcursor.StreamExecutePrimitive(ctx, ms.Input, bindVars, wantfields, func(qr *sqltypes.Result) error {
 		if len(qr.Fields) != 0 {
 			if err := cb(&sqltypes.Result{Fields: qr.Fields}); err != nil {
@@ -123,7 +145,23 @@ func (ms *MemorySort) TryStreamExecute(ctx context.Context, vcursor VCursor, bin
 			}
 		}
 		if vcursor.ExceedsMaxMemoryRows(len(sh.rows)) {
-			return fmt.Errorf("in-memory row count exceeded allowed limit of %d", vcursor.MaxMemoryRows())
+			spiller := vcursor.SortSpiller()
+			if spiller == nil {
+				return fmt.Errorf("in-memory row count exceeded allowed limit of %d", vcursor.MaxMemoryRows())
+			}
+			if sh.err != nil {
+				return sh.err
+			}
+			run, err := spiller.spill(sh, count)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			if runs, err = compactRuns(runs, sh.comparers, count); err != nil {
+				return err
+			}
+			clear(sh.rows)
+			sh.rows = sh.rows[:0]
 		}
 		return nil
 	})
@@ -140,6 +178,9 @@ func (ms *MemorySort) TryStreamExecute(ctx context.Context, vcursor VCursor, bin
 		// Unreachable.
 		return sh.err
 	}
+	if len(runs) > 0 {
+		return mergeSpilledRuns(runs, sh.rows, sh.comparers, count, cb)
+	}
 	return cb(&sqltypes.Result{Rows: sh.rows})
 }
 
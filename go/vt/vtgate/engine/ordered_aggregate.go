@@ -236,36 +236,56 @@ func (oa *OrderedAggregate) TryExecute(ctx context.Context, vcursor VCursor, bin
 }
 
 func (oa *OrderedAggregate) execute(ctx context.Context, vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool) (*sqltypes.Result, error) {
-	result, err := vcursor.ExecutePrimitive(ctx, oa.Input, bindVars, wantfields)
-	if err != nil {
-		return nil, err
-	}
-	out := &sqltypes.Result{
-		Fields: convertFields(result.Fields, oa.PreProcess, oa.Aggregates, oa.AggrOnEngine),
-		Rows:   make([][]sqltypes.Value, 0, len(result.Rows)),
-	}
+	out := &sqltypes.Result{}
 	// This code is similar to the one in StreamExecute.
 	var current []sqltypes.Value
 	var curDistincts []sqltypes.Value
-	for _, row := range result.Rows {
-		if current == nil {
+	aggregate := func(rows [][]sqltypes.Value) error {
+		for _, row := range rows {
+			if current == nil {
+				current, curDistincts = convertRow(row, oa.PreProcess, oa.Aggregates, oa.AggrOnEngine)
+				continue
+			}
+			equal, err := oa.keysEqual(current, row, oa.Collations)
+			if err != nil {
+				return err
+			}
+
+			if equal {
+				current, curDistincts, err = merge(out.Fields, current, row, curDistincts, oa.Collations, oa.Aggregates)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			out.Rows = append(out.Rows, current)
 			current, curDistincts = convertRow(row, oa.PreProcess, oa.Aggregates, oa.AggrOnEngine)
-			continue
 		}
-		equal, err := oa.keysEqual(current, row, oa.Collations)
+		return nil
+	}
+
+	if vcursor.SortSpiller() != nil {
+		// Streaming the input lets the sorts under the aggregation spill it
+		// to disk, instead of holding all of it in memory.
+		err := vcursor.StreamExecutePrimitive(ctx, oa.Input, bindVars, wantfields, func(qr *sqltypes.Result) error {
+			if len(qr.Fields) != 0 {
+				out.Fields = convertFields(qr.Fields, oa.PreProcess, oa.Aggregates, oa.AggrOnEngine)
+			}
+			return aggregate(qr.Rows)
+		})
 		if err != nil {
 			return nil, err
 		}
-
-		if equal {
-			current, curDistincts, err = merge(result.Fields, current, row, curDistincts, oa.Collations, oa.Aggregates)
-			if err != nil {
-				return nil, err
-			}
-			continue
+	} else {
+		result, err := vcursor.ExecutePrimitive(ctx, oa.Input, bindVars, wantfields)
+		if err != nil {
+			return nil, err
+		}
+		out.Fields = convertFields(result.Fields, oa.PreProcess, oa.Aggregates, oa.AggrOnEngine)
+		out.Rows = make([][]sqltypes.Value, 0, len(result.Rows))
+		if err := aggregate(result.Rows); err != nil {
+			return nil, err
 		}
-		out.Rows = append(out.Rows, current)
-		current, curDistincts = convertRow(row, oa.PreProcess, oa.Aggregates, oa.AggrOnEngine)
 	}
 
 	if current != nil {
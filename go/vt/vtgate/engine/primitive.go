@@ -58,6 +58,10 @@ type (
 		// if the max memory rows override directive is set to true
 		ExceedsMaxMemoryRows(numRows int) bool
 
+		// SortSpiller returns the spiller that in-memory sorts use when
+		// they exceed the max memory rows, or nil if they must fail.
+		SortSpiller() *SortSpiller
+
 		// V3 functions.
 		Execute(ctx context.Context, method string, query string, bindVars map[string]*querypb.BindVariable, rollbackOnError bool, co vtgatepb.CommitOrder) (*sqltypes.Result, error)
 		AutocommitApproval() bool
@@ -114,6 +118,17 @@ type (
 
 		// ShowExec takes in show command and use executor to execute the query, they are used when topo access is involved.
 		ShowExec(ctx context.Context, command sqlparser.ShowCommandType, filter *sqlparser.ShowFilter) (*sqltypes.Result, error)
+		// VirtualTableExec returns the rows of a table answered by vtgate, see VirtualTable.
+		VirtualTableExec(ctx context.Context, keyspace, name string) (*sqltypes.Result, error)
+		// ExportFilters returns the document of the filters of database, or
+		// of all the filters if it is empty, see ExportFilters.
+		ExportFilters(ctx context.Context, database, format string) (*sqltypes.Result, error)
+		// ImportFilters makes the filters of database the ones of document,
+		// see ImportFilters.
+		ImportFilters(ctx context.Context, database, document string, prune bool) (*sqltypes.Result, error)
+		// ExplainFilter returns the filters query would match, see
+		// ExplainFilter.
+		ExplainFilter(ctx context.Context, query, database, user, ip string) (*sqltypes.Result, error)
 		// SetExec takes in k,v pair and use executor to set them in topo metadata.
 		SetExec(ctx context.Context, name string, value string) error
 
@@ -191,6 +206,8 @@ type (
 		SetReadAfterWriteTimeout(float64)
 		SetSessionTrackGTIDs(bool)
 		SetReadAfterWriteConsistency(vtgatepb.ReadAfterWriteConsistency)
+		// SetSnapshotReadGTID pins the reads of the session to the replicas which executed a GTID set, or unpins them if it is empty
+		SetSnapshotReadGTID(string) error
 
 		// HasCreatedTempTable will mark the session as having created temp tables
 		HasCreatedTempTable()
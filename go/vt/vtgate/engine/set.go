@@ -599,6 +599,19 @@ func (svss *SysVarSetAware) Execute(ctx context.Context, vcursor VCursor, env *e
 			return err
 		}
 		vcursor.Session().SetReadAfterWriteTimeout(val)
+	case sysvars.SnapshotReadGTID.Name:
+		str, err := svss.evalAsString(env)
+		if err != nil {
+			return err
+		}
+		// 'current' pins the reads to the GTID set the primary executed.
+		if strings.EqualFold(str, "current") {
+			str, err = queryExecutedGTIDSet(ctx, vcursor)
+			if err != nil {
+				return err
+			}
+		}
+		err = vcursor.Session().SetSnapshotReadGTID(str)
 	case sysvars.RewriteTableNameWithDbNamePrefix.Name:
 		err = svss.setBoolSysVar(ctx, env, vcursor.Session().SetRewriteTableNameWithDbNamePrefix)
 	case sysvars.SessionTrackGTIDs.Name:
@@ -692,6 +705,25 @@ func (v *VitessMetadata) VariableName() string {
 	return v.Name
 }
 
+// queryExecutedGTIDSet returns the GTID set the primary executed.
+func queryExecutedGTIDSet(ctx context.Context, vcursor VCursor) (string, error) {
+	rss, _, err := vcursor.ResolveDestinations(ctx, global.DefaultKeyspace, nil, []key.Destination{key.DestinationAllShards{}})
+	if err != nil {
+		return "", err
+	}
+	if len(rss) == 0 {
+		return "", fmt.Errorf("no shards found for keyspace %s", global.DefaultKeyspace)
+	}
+	result, err := execShard(ctx, nil, vcursor, "select @@global.gtid_executed from dual", make(map[string]*querypb.BindVariable), rss[0], false, false)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Rows) != 1 || len(result.Rows[0]) != 1 {
+		return "", vterrors.Errorf(vtrpcpb.Code_INTERNAL, "unexpected result of the executed GTID set")
+	}
+	return result.Rows[0][0].ToString(), nil
+}
+
 func checkVariableValue(vcursor VCursor, name string, value string) (bool, error) {
 	checkSysVarQuery := fmt.Sprintf("select 1 from dual where @@%s = '%s'", name, value)
 	rss, _, err := vcursor.ResolveDestinations(context.Background(), global.DefaultKeyspace, nil, []key.Destination{key.DestinationAllShards{}})
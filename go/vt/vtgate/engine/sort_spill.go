@@ -0,0 +1,381 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package engine
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+const (
+	// spillMergeBatchRows is the number of rows sent at a time to the client
+	// while merging spilled runs.
+	spillMergeBatchRows = 1000
+	// spillMergeFanIn is the most spilled runs read at once by a merge. A sort
+	// that spills more runs merges them into a single run every time it has
+	// this many, so it never holds more files open.
+	spillMergeFanIn = 16
+)
+
+var (
+	sortSpillRuns         = stats.NewCounter("SortSpillRuns", "Number of sorted runs spilled to disk by in-memory sorts")
+	sortSpilledRows       = stats.NewCounter("SortSpilledRows", "Number of rows spilled to disk by in-memory sorts")
+	sortSpilledBytes      = stats.NewCounter("SortSpilledBytes", "Number of bytes spilled to disk by in-memory sorts")
+	sortSpillDiskUsage    = stats.NewGauge("SortSpillDiskUsageBytes", "Bytes currently held on disk by spilled sorts")
+	sortSpillDiskCapFails = stats.NewCounter("SortSpillDiskCapExceeded", "Number of sorts that failed because spilling would exceed the disk cap")
+	sortSpillMergePasses  = stats.NewCounter("SortSpillMergePasses", "Number of intermediate merges of spilled runs into a single run")
+)
+
+// SortSpiller lets in-memory sorts that exceed the max memory rows write
+// sorted runs of their rows to temporary files, and merge them back at the
+// end, instead of failing. The disk used by all the spilled sorts is capped:
+// a sort that would exceed the cap fails.
+type SortSpiller struct {
+	dir      string
+	maxBytes int64
+	used     atomic.Int64
+}
+
+// NewSortSpiller returns a SortSpiller that writes its files to dir, and
+// holds at most maxBytes on disk. It returns nil if dir is empty, which
+// disables spilling.
+func NewSortSpiller(dir string, maxBytes int64) *SortSpiller {
+	if dir == "" {
+		return nil
+	}
+	return &SortSpiller{dir: dir, maxBytes: maxBytes}
+}
+
+// DiskUsage returns the number of bytes currently spilled to disk.
+func (s *SortSpiller) DiskUsage() int64 {
+	return s.used.Load()
+}
+
+func (s *SortSpiller) reserve(n int64) error {
+	if s.used.Add(n) > s.maxBytes {
+		s.used.Add(-n)
+		sortSpillDiskCapFails.Add(1)
+		return vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "sort spill disk usage exceeded allowed limit of %d bytes", s.maxBytes)
+	}
+	sortSpillDiskUsage.Add(n)
+	return nil
+}
+
+func (s *SortSpiller) release(n int64) {
+	s.used.Add(-n)
+	sortSpillDiskUsage.Add(-n)
+}
+
+// spill sorts the rows of sh and writes them to a new run. Only the first
+// limit rows are written, the others can't be part of the result.
+func (s *SortSpiller) spill(sh *sortHeap, limit int) (*spillRun, error) {
+	sorted := &sortHeap{rows: sh.rows, comparers: sh.comparers}
+	sort.Sort(sorted)
+	if sorted.err != nil {
+		return nil, sorted.err
+	}
+	rows := sorted.rows
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	run, err := s.newRun()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if err := run.write(row); err != nil {
+			run.close()
+			return nil, err
+		}
+	}
+	if err := run.finish(); err != nil {
+		run.close()
+		return nil, err
+	}
+	sortSpillRuns.Add(1)
+	sortSpilledRows.Add(int64(len(rows)))
+	return run, nil
+}
+
+func (s *SortSpiller) newRun() (*spillRun, error) {
+	file, err := os.CreateTemp(s.dir, "vtgate-sort-*.spill")
+	if err != nil {
+		return nil, vterrors.Wrapf(err, "cannot create sort spill file")
+	}
+	// The file stays usable through its descriptor. Removing it right away
+	// means that nothing is left behind if vtgate crashes.
+	_ = os.Remove(file.Name())
+	return &spillRun{spiller: s, file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// spillRun is a sorted run of rows in a temporary file. A row is written as
+// its number of values, followed by the type, the length and the bytes of
+// each value, all numbers being uvarints.
+type spillRun struct {
+	spiller *SortSpiller
+	file    *os.File
+	w       *bufio.Writer
+	r       *bufio.Reader
+	size    int64
+	buf     []byte
+}
+
+func (run *spillRun) write(row []sqltypes.Value) error {
+	buf := binary.AppendUvarint(run.buf[:0], uint64(len(row)))
+	for _, v := range row {
+		raw := v.Raw()
+		buf = binary.AppendUvarint(buf, uint64(v.Type()))
+		buf = binary.AppendUvarint(buf, uint64(len(raw)))
+		buf = append(buf, raw...)
+	}
+	run.buf = buf
+	if err := run.spiller.reserve(int64(len(buf))); err != nil {
+		return err
+	}
+	run.size += int64(len(buf))
+	sortSpilledBytes.Add(int64(len(buf)))
+	if _, err := run.w.Write(buf); err != nil {
+		return vterrors.Wrapf(err, "cannot write sort spill file")
+	}
+	return nil
+}
+
+// finish flushes the run, and rewinds it for reading.
+func (run *spillRun) finish() error {
+	if err := run.w.Flush(); err != nil {
+		return vterrors.Wrapf(err, "cannot write sort spill file")
+	}
+	if _, err := run.file.Seek(0, io.SeekStart); err != nil {
+		return vterrors.Wrapf(err, "cannot read sort spill file")
+	}
+	run.w = nil
+	run.r = bufio.NewReader(run.file)
+	return nil
+}
+
+// next returns the next row of the run, or io.EOF after the last one.
+func (run *spillRun) next() ([]sqltypes.Value, error) {
+	n, err := binary.ReadUvarint(run.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, vterrors.Wrapf(err, "cannot read sort spill file")
+	}
+	row := make([]sqltypes.Value, n)
+	for i := range row {
+		typ, err := binary.ReadUvarint(run.r)
+		if err != nil {
+			return nil, vterrors.Wrapf(err, "cannot read sort spill file")
+		}
+		length, err := binary.ReadUvarint(run.r)
+		if err != nil {
+			return nil, vterrors.Wrapf(err, "cannot read sort spill file")
+		}
+		raw := make([]byte, length)
+		if _, err := io.ReadFull(run.r, raw); err != nil {
+			return nil, vterrors.Wrapf(err, "cannot read sort spill file")
+		}
+		row[i] = sqltypes.MakeTrusted(querypb.Type(typ), raw)
+	}
+	return row, nil
+}
+
+func (run *spillRun) close() {
+	run.file.Close()
+	run.spiller.release(run.size)
+	run.size = 0
+}
+
+// spillSource is a sorted source of rows of a merge: either a spilled run,
+// or the rows that were still in memory at the end of the sort.
+type spillSource struct {
+	run  *spillRun
+	rows [][]sqltypes.Value
+	row  []sqltypes.Value
+}
+
+func (src *spillSource) advance() (bool, error) {
+	if src.run == nil {
+		if len(src.rows) == 0 {
+			return false, nil
+		}
+		src.row, src.rows = src.rows[0], src.rows[1:]
+		return true, nil
+	}
+	row, err := src.run.next()
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	src.row = row
+	return true, nil
+}
+
+// spillMergeHeap orders the sources of a merge by their current row.
+type spillMergeHeap struct {
+	sources   []*spillSource
+	comparers []*comparer
+	err       error
+}
+
+func (mh *spillMergeHeap) Len() int {
+	return len(mh.sources)
+}
+
+func (mh *spillMergeHeap) Less(i, j int) bool {
+	for _, c := range mh.comparers {
+		if mh.err != nil {
+			return true
+		}
+		cmp, err := c.compare(mh.sources[i].row, mh.sources[j].row)
+		if err != nil {
+			mh.err = err
+			return true
+		}
+		if cmp == 0 {
+			continue
+		}
+		return cmp < 0
+	}
+	return true
+}
+
+func (mh *spillMergeHeap) Swap(i, j int) {
+	mh.sources[i], mh.sources[j] = mh.sources[j], mh.sources[i]
+}
+
+func (mh *spillMergeHeap) Push(x any) {
+	mh.sources = append(mh.sources, x.(*spillSource))
+}
+
+func (mh *spillMergeHeap) Pop() any {
+	n := len(mh.sources)
+	x := mh.sources[n-1]
+	mh.sources = mh.sources[:n-1]
+	return x
+}
+
+// compactRuns merges the runs into a single one, spillMergeFanIn runs at a
+// time, as long as there are at least spillMergeFanIn of them. Only the first
+// limit rows of each merge are kept. The merged runs are closed, and the
+// returned runs replace them, even on error.
+func compactRuns(runs []*spillRun, comparers []*comparer, limit int) ([]*spillRun, error) {
+	for len(runs) >= spillMergeFanIn {
+		merged, err := mergeRuns(runs[:spillMergeFanIn], comparers, limit)
+		if err != nil {
+			return runs, err
+		}
+		for _, run := range runs[:spillMergeFanIn] {
+			run.close()
+		}
+		runs = append([]*spillRun{merged}, runs[spillMergeFanIn:]...)
+		sortSpillMergePasses.Add(1)
+	}
+	return runs, nil
+}
+
+// mergeRuns merges the runs into a new run holding their first limit rows.
+func mergeRuns(runs []*spillRun, comparers []*comparer, limit int) (*spillRun, error) {
+	merged, err := runs[0].spiller.newRun()
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]*spillSource, 0, len(runs))
+	for _, run := range runs {
+		sources = append(sources, &spillSource{run: run})
+	}
+	if err := mergeSources(sources, comparers, limit, merged.write); err != nil {
+		merged.close()
+		return nil, err
+	}
+	if err := merged.finish(); err != nil {
+		merged.close()
+		return nil, err
+	}
+	return merged, nil
+}
+
+// mergeSpilledRuns merges the sorted runs and the sorted in-memory rows, and
+// sends the first count rows of the result to callback in batches. There are
+// fewer runs than spillMergeFanIn, the sort compacts them as it spills.
+func mergeSpilledRuns(runs []*spillRun, rows [][]sqltypes.Value, comparers []*comparer, count int, callback func(*sqltypes.Result) error) error {
+	sources := make([]*spillSource, 0, len(runs)+1)
+	for _, run := range runs {
+		sources = append(sources, &spillSource{run: run})
+	}
+	sources = append(sources, &spillSource{rows: rows})
+
+	batch := make([][]sqltypes.Value, 0, spillMergeBatchRows)
+	err := mergeSources(sources, comparers, count, func(row []sqltypes.Value) error {
+		batch = append(batch, row)
+		if len(batch) < spillMergeBatchRows {
+			return nil
+		}
+		if err := callback(&sqltypes.Result{Rows: batch}); err != nil {
+			return err
+		}
+		batch = make([][]sqltypes.Value, 0, spillMergeBatchRows)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return callback(&sqltypes.Result{Rows: batch})
+}
+
+// mergeSources merges the sorted sources, and yields the first count rows of
+// the result to emit.
+func mergeSources(sources []*spillSource, comparers []*comparer, count int, emit func([]sqltypes.Value) error) error {
+	mh := &spillMergeHeap{comparers: comparers}
+	for _, src := range sources {
+		ok, err := src.advance()
+		if err != nil {
+			return err
+		}
+		if ok {
+			mh.sources = append(mh.sources, src)
+		}
+	}
+	heap.Init(mh)
+
+	for sent := 0; mh.Len() > 0 && sent < count; sent++ {
+		if mh.err != nil {
+			return mh.err
+		}
+		src := mh.sources[0]
+		if err := emit(src.row); err != nil {
+			return err
+		}
+		ok, err := src.advance()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(mh, 0)
+		} else {
+			heap.Pop(mh)
+		}
+	}
+	return mh.err
+}
@@ -0,0 +1,336 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package engine
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql/collations"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/test/utils"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestMemorySortSpill(t *testing.T) {
+	saveMax := testMaxMemoryRows
+	saveSpiller := testSortSpiller
+	testMaxMemoryRows = 2
+	testSortSpiller = NewSortSpiller(t.TempDir(), 1<<20)
+	defer func() {
+		testMaxMemoryRows = saveMax
+		testSortSpiller = saveSpiller
+	}()
+
+	fields := sqltypes.MakeTestFields(
+		"c1|c2",
+		"varchar|int64",
+	)
+	fp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			"a|5",
+			"b|2",
+			"c|9",
+			"d|1",
+			"e|null",
+			"f|7",
+			"g|3",
+		)},
+	}
+	ms := &MemorySort{
+		OrderBy: []OrderByParams{{
+			WeightStringCol: -1,
+			Col:             1,
+		}},
+		Input: fp,
+	}
+
+	runs := sortSpillRuns.Get()
+	var results []*sqltypes.Result
+	err := ms.TryStreamExecute(context.Background(), &noopVCursor{}, nil, true, func(qr *sqltypes.Result) error {
+		results = append(results, qr)
+		return nil
+	})
+	require.NoError(t, err)
+	wantResults := sqltypes.MakeTestStreamingResults(
+		fields,
+		"e|null",
+		"d|1",
+		"b|2",
+		"g|3",
+		"a|5",
+		"f|7",
+		"c|9",
+	)
+	utils.MustMatch(t, wantResults, results)
+	assert.EqualValues(t, 2, sortSpillRuns.Get()-runs)
+	assert.Zero(t, testSortSpiller.DiskUsage())
+
+	fp.rewind()
+	ms.UpperLimit = evalengine.NewBindVar("__upper_limit", collations.TypedCollation{})
+	bv := map[string]*querypb.BindVariable{"__upper_limit": sqltypes.Int64BindVariable(4)}
+	results = nil
+	err = ms.TryStreamExecute(context.Background(), &noopVCursor{}, bv, true, func(qr *sqltypes.Result) error {
+		results = append(results, qr)
+		return nil
+	})
+	require.NoError(t, err)
+	wantResults = sqltypes.MakeTestStreamingResults(
+		fields,
+		"e|null",
+		"d|1",
+		"b|2",
+		"g|3",
+	)
+	utils.MustMatch(t, wantResults, results)
+	assert.Zero(t, testSortSpiller.DiskUsage())
+}
+
+func TestMemorySortSpillDiskCap(t *testing.T) {
+	saveMax := testMaxMemoryRows
+	saveSpiller := testSortSpiller
+	testMaxMemoryRows = 2
+	testSortSpiller = NewSortSpiller(t.TempDir(), 16)
+	defer func() {
+		testMaxMemoryRows = saveMax
+		testSortSpiller = saveSpiller
+	}()
+
+	fields := sqltypes.MakeTestFields(
+		"c1|c2",
+		"varchar|int64",
+	)
+	fp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			"aaaa|5",
+			"bbbb|2",
+			"cccc|9",
+			"dddd|1",
+			"eeee|4",
+			"ffff|7",
+		)},
+	}
+	ms := &MemorySort{
+		OrderBy: []OrderByParams{{
+			WeightStringCol: -1,
+			Col:             1,
+		}},
+		Input: fp,
+	}
+
+	err := ms.TryStreamExecute(context.Background(), &noopVCursor{}, nil, false, func(qr *sqltypes.Result) error {
+		return nil
+	})
+	require.EqualError(t, err, "sort spill disk usage exceeded allowed limit of 16 bytes")
+	assert.Zero(t, testSortSpiller.DiskUsage())
+}
+
+func TestMemorySortSpillManyRuns(t *testing.T) {
+	saveMax := testMaxMemoryRows
+	saveSpiller := testSortSpiller
+	testMaxMemoryRows = 2
+	testSortSpiller = NewSortSpiller(t.TempDir(), 1<<20)
+	defer func() {
+		testMaxMemoryRows = saveMax
+		testSortSpiller = saveSpiller
+	}()
+
+	fields := sqltypes.MakeTestFields(
+		"c1",
+		"int64",
+	)
+	// the rows are spilled in runs of a few rows, which makes several times
+	// more runs than a merge reads at once.
+	const rowCount = 3 * 4 * spillMergeFanIn
+	var rows, wantRows []string
+	for i := 0; i < rowCount; i++ {
+		rows = append(rows, strconv.Itoa((i*7919)%rowCount))
+		wantRows = append(wantRows, strconv.Itoa(i))
+	}
+	fp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(fields, rows...)},
+	}
+	ms := &MemorySort{
+		OrderBy: []OrderByParams{{
+			WeightStringCol: -1,
+			Col:             0,
+		}},
+		Input: fp,
+	}
+
+	runs := sortSpillRuns.Get()
+	passes := sortSpillMergePasses.Get()
+	var got []string
+	err := ms.TryStreamExecute(context.Background(), &noopVCursor{}, nil, false, func(qr *sqltypes.Result) error {
+		for _, row := range qr.Rows {
+			got = append(got, row[0].ToString())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, wantRows, got)
+	spilled := sortSpillRuns.Get() - runs
+	require.Greater(t, spilled, int64(2*spillMergeFanIn))
+	// every pass merges spillMergeFanIn runs into one as soon as there are
+	// that many.
+	assert.Equal(t, (spilled-1)/(spillMergeFanIn-1), sortSpillMergePasses.Get()-passes)
+	assert.Zero(t, testSortSpiller.DiskUsage())
+}
+
+func TestCompactRuns(t *testing.T) {
+	spiller := NewSortSpiller(t.TempDir(), 1<<20)
+	comparers := extractSlices([]OrderByParams{{WeightStringCol: -1, Col: 0}})
+
+	// 2*spillMergeFanIn+3 runs of 2 rows each: run i holds i and i+runCount.
+	const runCount = 2*spillMergeFanIn + 3
+	var runs []*spillRun
+	defer func() {
+		for _, run := range runs {
+			run.close()
+		}
+	}()
+	for i := 0; i < runCount; i++ {
+		sh := &sortHeap{
+			rows:      [][]sqltypes.Value{{sqltypes.NewInt64(int64(i + runCount))}, {sqltypes.NewInt64(int64(i))}},
+			comparers: comparers,
+		}
+		run, err := spiller.spill(sh, 2)
+		require.NoError(t, err)
+		runs = append(runs, run)
+	}
+
+	var err error
+	runs, err = compactRuns(runs, comparers, 2*runCount)
+	require.NoError(t, err)
+	// each of the two passes replaces spillMergeFanIn runs with a merged one.
+	require.Len(t, runs, runCount-2*(spillMergeFanIn-1))
+	require.Less(t, len(runs), spillMergeFanIn)
+
+	var got []int64
+	err = mergeSpilledRuns(runs, nil, comparers, 2*runCount, func(qr *sqltypes.Result) error {
+		for _, row := range qr.Rows {
+			v, err := row[0].ToInt64()
+			require.NoError(t, err)
+			got = append(got, v)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 2*runCount)
+	for i, v := range got {
+		assert.EqualValues(t, i, v)
+	}
+}
+
+func TestMemorySortSpillExecute(t *testing.T) {
+	saveMax := testMaxMemoryRows
+	saveSpiller := testSortSpiller
+	testMaxMemoryRows = 2
+	testSortSpiller = NewSortSpiller(t.TempDir(), 1<<20)
+	defer func() {
+		testMaxMemoryRows = saveMax
+		testSortSpiller = saveSpiller
+	}()
+
+	fields := sqltypes.MakeTestFields(
+		"c1|c2",
+		"varchar|int64",
+	)
+	fp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			"a|5",
+			"b|2",
+			"c|9",
+			"d|1",
+			"e|4",
+		)},
+	}
+	ms := &MemorySort{
+		UpperLimit: evalengine.NewBindVar("__upper_limit", collations.TypedCollation{}),
+		OrderBy: []OrderByParams{{
+			WeightStringCol: -1,
+			Col:             1,
+		}},
+		Input: fp,
+	}
+
+	runs := sortSpillRuns.Get()
+	bv := map[string]*querypb.BindVariable{"__upper_limit": sqltypes.Int64BindVariable(4)}
+	result, err := ms.TryExecute(context.Background(), &noopVCursor{}, bv, true)
+	require.NoError(t, err)
+	wantResult := sqltypes.MakeTestResult(
+		fields,
+		"d|1",
+		"b|2",
+		"e|4",
+		"a|5",
+	)
+	utils.MustMatch(t, wantResult, result)
+	assert.EqualValues(t, 1, sortSpillRuns.Get()-runs)
+	assert.Zero(t, testSortSpiller.DiskUsage())
+}
+
+func TestOrderedAggregateSpillExecute(t *testing.T) {
+	saveMax := testMaxMemoryRows
+	saveSpiller := testSortSpiller
+	testMaxMemoryRows = 2
+	testSortSpiller = NewSortSpiller(t.TempDir(), 1<<20)
+	defer func() {
+		testMaxMemoryRows = saveMax
+		testSortSpiller = saveSpiller
+	}()
+
+	fields := sqltypes.MakeTestFields(
+		"col|count(*)",
+		"varbinary|decimal",
+	)
+	fp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			"c|3",
+			"a|1",
+			"b|2",
+			"a|1",
+			"c|4",
+		)},
+	}
+	oa := &OrderedAggregate{
+		Aggregates: []*AggregateParams{{
+			Opcode: AggregateSum,
+			Col:    1,
+		}},
+		GroupByKeys: []*GroupByParams{{KeyCol: 0}},
+		Input: &MemorySort{
+			OrderBy: []OrderByParams{{
+				WeightStringCol: -1,
+				Col:             0,
+			}},
+			Input: fp,
+		},
+	}
+
+	runs := sortSpillRuns.Get()
+	result, err := oa.TryExecute(context.Background(), &noopVCursor{}, nil, true)
+	require.NoError(t, err)
+	wantResult := sqltypes.MakeTestResult(
+		fields,
+		"a|2",
+		"b|2",
+		"c|7",
+	)
+	utils.MustMatch(t, wantResult, result)
+	assert.EqualValues(t, 1, sortSpillRuns.Get()-runs)
+	assert.Zero(t, testSortSpiller.DiskUsage())
+}
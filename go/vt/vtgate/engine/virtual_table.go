@@ -0,0 +1,210 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package engine
+
+import (
+	"context"
+	"strings"
+
+	"vitess.io/vitess/go/mysql/collations"
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	"vitess.io/vitess/go/vt/vtgate/vindexes"
+)
+
+// WescaleSchema is the database holding the virtual tables, which show the
+// internal state of vtgate and its tablets.
+const WescaleSchema = "wescale_schema"
+
+// InformationSchema is the MySQL database whose common tables vtgate can
+// answer from the schema tracker.
+const InformationSchema = "information_schema"
+
+type virtualColumn struct {
+	name string
+	typ  querypb.Type
+}
+
+// virtualTables are the tables answered by vtgate, by database.
+var virtualTables = map[string]map[string][]virtualColumn{
+	WescaleSchema:     wescaleSchemaTables,
+	InformationSchema: informationSchemaTables,
+}
+
+var wescaleSchemaTables = map[string][]virtualColumn{
+	"processlist": {
+		{"id", sqltypes.Int64},
+		{"user", sqltypes.VarChar},
+		{"host", sqltypes.VarChar},
+		{"db", sqltypes.VarChar},
+		{"command", sqltypes.VarChar},
+		{"time", sqltypes.Int64},
+		{"state", sqltypes.VarChar},
+		{"info", sqltypes.VarChar},
+	},
+	"statement_summary": {
+		{"digest_text", sqltypes.VarChar},
+		{"statement_type", sqltypes.VarChar},
+		{"tables", sqltypes.VarChar},
+		{"count_star", sqltypes.Int64},
+		{"sum_timer_wait", sqltypes.Int64},
+		{"avg_timer_wait", sqltypes.Int64},
+		{"sum_shard_queries", sqltypes.Int64},
+		{"sum_rows_affected", sqltypes.Int64},
+		{"sum_rows_sent", sqltypes.Int64},
+		{"sum_errors", sqltypes.Int64},
+	},
+	"pool_stats": {
+		{"tablet_alias", sqltypes.VarChar},
+		{"pool", sqltypes.VarChar},
+		{"capacity", sqltypes.Int64},
+		{"available", sqltypes.Int64},
+		{"active", sqltypes.Int64},
+		{"in_use", sqltypes.Int64},
+		{"max_capacity", sqltypes.Int64},
+		{"wait_count", sqltypes.Int64},
+		{"wait_time", sqltypes.Int64},
+		{"idle_closed", sqltypes.Int64},
+		{"exhausted", sqltypes.Int64},
+	},
+	"rule_stats": {
+		{"tablet_alias", sqltypes.VarChar},
+		{"source", sqltypes.VarChar},
+		{"name", sqltypes.VarChar},
+		{"description", sqltypes.VarChar},
+		{"priority", sqltypes.Int64},
+		{"status", sqltypes.VarChar},
+		{"action", sqltypes.VarChar},
+		{"match_count", sqltypes.Int64},
+		{"affected_count", sqltypes.Int64},
+		{"last_match_time", sqltypes.Datetime},
+	},
+}
+
+// informationSchemaTables only have the columns the schema tracker knows.
+var informationSchemaTables = map[string][]virtualColumn{
+	"tables": {
+		{"TABLE_CATALOG", sqltypes.VarChar},
+		{"TABLE_SCHEMA", sqltypes.VarChar},
+		{"TABLE_NAME", sqltypes.VarChar},
+		{"TABLE_TYPE", sqltypes.VarChar},
+	},
+	"columns": {
+		{"TABLE_CATALOG", sqltypes.VarChar},
+		{"TABLE_SCHEMA", sqltypes.VarChar},
+		{"TABLE_NAME", sqltypes.VarChar},
+		{"COLUMN_NAME", sqltypes.VarChar},
+		{"ORDINAL_POSITION", sqltypes.Uint64},
+		{"DATA_TYPE", sqltypes.VarChar},
+		{"CHARACTER_SET_NAME", sqltypes.VarChar},
+		{"COLLATION_NAME", sqltypes.VarChar},
+		{"COLUMN_KEY", sqltypes.VarChar},
+	},
+	"statistics": {
+		{"TABLE_CATALOG", sqltypes.VarChar},
+		{"TABLE_SCHEMA", sqltypes.VarChar},
+		{"TABLE_NAME", sqltypes.VarChar},
+		{"NON_UNIQUE", sqltypes.Int64},
+		{"INDEX_SCHEMA", sqltypes.VarChar},
+		{"INDEX_NAME", sqltypes.VarChar},
+		{"SEQ_IN_INDEX", sqltypes.Uint64},
+		{"COLUMN_NAME", sqltypes.VarChar},
+	},
+	"key_column_usage": {
+		{"CONSTRAINT_CATALOG", sqltypes.VarChar},
+		{"CONSTRAINT_SCHEMA", sqltypes.VarChar},
+		{"CONSTRAINT_NAME", sqltypes.VarChar},
+		{"TABLE_CATALOG", sqltypes.VarChar},
+		{"TABLE_SCHEMA", sqltypes.VarChar},
+		{"TABLE_NAME", sqltypes.VarChar},
+		{"COLUMN_NAME", sqltypes.VarChar},
+		{"ORDINAL_POSITION", sqltypes.Uint64},
+	},
+}
+
+// VirtualTableFields returns the fields of a table of wescale_schema or
+// information_schema, and false if there is no such table. Table names are
+// case-insensitive. The timer columns are in microseconds.
+func VirtualTableFields(keyspace, name string) ([]*querypb.Field, bool) {
+	columns, ok := virtualTables[strings.ToLower(keyspace)][strings.ToLower(name)]
+	if !ok {
+		return nil, false
+	}
+	fields := make([]*querypb.Field, len(columns))
+	for i, column := range columns {
+		fields[i] = &querypb.Field{
+			Name:  column.name,
+			Type:  column.typ,
+			Table: strings.ToLower(name),
+		}
+		if sqltypes.IsText(column.typ) {
+			fields[i].Charset = collations.CollationUtf8ID
+		} else {
+			fields[i].Charset = collations.CollationBinaryID
+			fields[i].Flags = uint32(querypb.MySqlFlag_BINARY_FLAG | querypb.MySqlFlag_NUM_FLAG)
+			if sqltypes.IsUnsigned(column.typ) {
+				fields[i].Flags |= uint32(querypb.MySqlFlag_UNSIGNED_FLAG)
+			}
+		}
+	}
+	return fields, true
+}
+
+var _ Primitive = (*VirtualTable)(nil)
+
+// VirtualTable is a primitive that returns all the rows of a table of
+// wescale_schema or information_schema. The rows are built by the executor
+// via the vcursor.
+type VirtualTable struct {
+	Keyspace string
+	Name     string
+
+	noInputs
+	noTxNeeded
+}
+
+// RouteType implements the Primitive interface.
+func (v *VirtualTable) RouteType() string {
+	return "VirtualTable"
+}
+
+// GetKeyspaceName implements the Primitive interface.
+func (v *VirtualTable) GetKeyspaceName() string {
+	return v.Keyspace
+}
+
+// GetTableName implements the Primitive interface.
+func (v *VirtualTable) GetTableName() string {
+	return v.Name
+}
+
+// GetFields implements the Primitive interface.
+func (v *VirtualTable) GetFields(context.Context, VCursor, map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	fields, _ := VirtualTableFields(v.Keyspace, v.Name)
+	return &sqltypes.Result{Fields: fields}, nil
+}
+
+// TryExecute implements the Primitive interface.
+func (v *VirtualTable) TryExecute(ctx context.Context, vcursor VCursor, _ map[string]*querypb.BindVariable, _ bool) (*sqltypes.Result, error) {
+	return vcursor.VirtualTableExec(ctx, v.Keyspace, v.Name)
+}
+
+// TryStreamExecute implements the Primitive interface.
+func (v *VirtualTable) TryStreamExecute(ctx context.Context, vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
+	qr, err := v.TryExecute(ctx, vcursor, bindVars, wantfields)
+	if err != nil {
+		return err
+	}
+	return callback(qr)
+}
+
+func (v *VirtualTable) description() PrimitiveDescription {
+	return PrimitiveDescription{
+		OperatorType: "VirtualTable",
+		Variant:      v.Name,
+		Keyspace:     &vindexes.Keyspace{Name: v.Keyspace},
+	}
+}
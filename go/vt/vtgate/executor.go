@@ -121,8 +121,14 @@ type Executor struct {
 	mu           sync.Mutex
 	vschema      *vindexes.VSchema
 	streamSize   int
-	plans        cache.Cache
-	vschemaStats *VSchemaStats
+	streamBudget *sync2.ByteBudget
+	// streamBufferCapacity is the capacity in bytes of the buffer of each
+	// stream, and streams the buffers of the streams by session UUID.
+	streamBufferCapacity int64
+	streamsMu            sync.Mutex
+	streams              map[*sync2.StreamBuffer[*sqltypes.Result]]string
+	plans                cache.Cache
+	vschemaStats         *VSchemaStats
 
 	normalize       bool
 	warnShardedOnly bool
@@ -154,18 +160,21 @@ func NewExecutor(
 	pv plancontext.PlannerVersion,
 ) *Executor {
 	e := &Executor{
-		serv:            serv,
-		cell:            cell,
-		resolver:        resolver,
-		scatterConn:     resolver.scatterConn,
-		txConn:          resolver.scatterConn.txConn,
-		plans:           cache.NewDefaultCacheImpl(cacheCfg),
-		normalize:       normalize,
-		warnShardedOnly: warnOnShardedOnly,
-		streamSize:      streamSize,
-		schemaTracker:   schemaTracker,
-		allowScatter:    !noScatter,
-		pv:              pv,
+		serv:                 serv,
+		cell:                 cell,
+		resolver:             resolver,
+		scatterConn:          resolver.scatterConn,
+		txConn:               resolver.scatterConn.txConn,
+		plans:                cache.NewDefaultCacheImpl(cacheCfg),
+		normalize:            normalize,
+		warnShardedOnly:      warnOnShardedOnly,
+		streamSize:           streamSize,
+		streamBudget:         sync2.NewByteBudget(streamMaxBufferedBytes),
+		streamBufferCapacity: streamMaxBufferedBytesPerStream,
+		streams:              make(map[*sync2.StreamBuffer[*sqltypes.Result]]string),
+		schemaTracker:        schemaTracker,
+		allowScatter:         !noScatter,
+		pv:                   pv,
 	}
 
 	vschemaacl.Init()
@@ -197,6 +206,13 @@ func NewExecutor(
 		stats.NewCounterFunc("QueryPlanCacheMisses", "Query plan cache misses", func() int64 {
 			return e.plans.Misses()
 		})
+		stats.NewGaugeFunc("StreamBufferedBytes", "Result bytes currently buffered by streaming queries", func() int64 {
+			return e.streamBudget.InUse()
+		})
+		stats.NewGaugeFunc("StreamBackpressureWaiters", "Number of streams currently blocked on the stream buffer budget", func() int64 {
+			return e.streamBudget.Waiters()
+		})
+		stats.NewGaugesFuncWithMultiLabels("StreamBufferedBytesByStream", "Result bytes currently buffered by each streaming query", []string{"SessionUUID"}, e.streamBufferedBytes)
 		http.Handle(pathQueryPlans, e)
 		http.Handle(pathScatterStats, e)
 		http.Handle(pathVSchema, e)
@@ -206,6 +222,7 @@ func NewExecutor(
 
 // Execute executes a non-streaming query.
 func (e *Executor) Execute(ctx context.Context, method string, safeSession *SafeSession, sql string, bindVars map[string]*querypb.BindVariable) (result *sqltypes.Result, err error) {
+	stripPipelinedStatements(bindVars)
 	span, ctx := trace.NewSpan(ctx, "executor.Execute")
 	span.Annotate("method", method)
 	trace.AnnotateSQL(span, sqlparser.Preview(sql))
@@ -227,6 +244,9 @@ func (e *Executor) Execute(ctx context.Context, method string, safeSession *Safe
 		}
 		log.Warningf("%q exceeds warning threshold of max memory rows: %v", piiSafeSQL, warnMemoryRows)
 	}
+	if shadowTraffic != nil {
+		shadowTraffic.tee(safeSession, stmtType, logStats.ActiveKeyspace, sql, bindVars, result, err)
+	}
 
 	logStats.SaveEndTime()
 	QueryLogger.Send(logStats)
@@ -263,12 +283,16 @@ func (e *Executor) StreamExecute(
 	bindVars map[string]*querypb.BindVariable,
 	callback func(*sqltypes.Result) error,
 ) error {
+	stripPipelinedStatements(bindVars)
 	span, ctx := trace.NewSpan(ctx, "executor.StreamExecute")
 	span.Annotate("method", method)
 	trace.AnnotateSQL(span, sqlparser.Preview(sql))
 	defer span.Finish()
 
 	logStats := logstats.NewLogStats(ctx, method, sql, safeSession.GetSessionUUID(), bindVars)
+	stream := e.newStreamBuffer(safeSession.GetSessionUUID(), callback)
+	defer e.removeStreamBuffer(stream)
+	callback = e.withStreamBackpressure(ctx, stream)
 	srr := &streaminResultReceiver{callback: callback}
 	var err error
 
@@ -348,6 +372,10 @@ func (e *Executor) StreamExecute(
 	}
 
 	err = e.newExecute(ctx, safeSession, sql, bindVars, logStats, resultHandler, srr.storeResultStats)
+	// The results read before an error are still handed to the client.
+	if closeErr := stream.Close(); err == nil {
+		err = closeErr
+	}
 
 	logStats.Error = err
 	saveSessionStats(safeSession, srr.stmtType, srr.rowsAffected, srr.insertID, srr.rowsReturned, err)
@@ -559,6 +587,8 @@ func (e *Executor) addNeededBindVars(ctx context.Context, bindVarNeeds *sqlparse
 				v = raw.ReadAfterWriteTimeout
 			})
 			bindVars[key] = sqltypes.Float64BindVariable(v)
+		case sysvars.SnapshotReadGTID.Name:
+			bindVars[key] = sqltypes.StringBindVariable(session.GetSnapshotReadGTID())
 		case sysvars.SessionTrackGTIDs.Name:
 			v := "off"
 			ifReadAfterWriteExist(session, func(raw *vtgatepb.ReadAfterWrite) {
@@ -573,6 +603,8 @@ func (e *Executor) addNeededBindVars(ctx context.Context, bindVarNeeds *sqlparse
 			bindVars[key] = sqltypes.StringBindVariable(servenv.AppVersion.String())
 		case sysvars.Socket.Name:
 			bindVars[key] = sqltypes.StringBindVariable(mysqlSocketPath())
+		case sysvars.WarningCount.Name:
+			bindVars[key] = sqltypes.Int64BindVariable(int64(len(session.GetWarnings())))
 		default:
 			if value, hasSysVar := session.SystemVariables[sysVar]; hasSysVar {
 				expr, err := sqlparser.ParseExpr(value)
@@ -730,6 +762,8 @@ func (e *Executor) executeSPInAllSessions(ctx context.Context, safeSession *Safe
 // CloseSession releases the current connection, which rollbacks open transactions and closes reserved connections.
 // It is called then the MySQL servers closes the connection to its client.
 func (e *Executor) CloseSession(ctx context.Context, safeSession *SafeSession) error {
+	tempTables.forget(safeSession.GetSessionUUID())
+	snapshotReads.set(safeSession.GetSessionUUID(), "")
 	return e.txConn.ReleaseAll(ctx, safeSession)
 }
 
@@ -1443,6 +1477,7 @@ func isValidPayloadSize(query string) bool {
 
 // Prepare executes a prepare statements.
 func (e *Executor) Prepare(ctx context.Context, method string, safeSession *SafeSession, sql string, bindVars map[string]*querypb.BindVariable) (fld []*querypb.Field, err error) {
+	stripPipelinedStatements(bindVars)
 	logStats := logstats.NewLogStats(ctx, method, sql, safeSession.GetSessionUUID(), bindVars)
 	fld, err = e.prepare(ctx, safeSession, sql, bindVars, logStats)
 	logStats.Error = err
@@ -1544,6 +1579,54 @@ func (e *Executor) ExecuteMultiShard(ctx context.Context, primitive engine.Primi
 	return e.scatterConn.ExecuteMultiShard(ctx, primitive, rss, queries, session, autocommit, ignoreMaxMemoryRows)
 }
 
+// newStreamBuffer creates the buffer of the results a stream of the session
+// sends to callback, so the tablet streams go on while the client consumes the
+// previous results.
+func (e *Executor) newStreamBuffer(sessionUUID string, callback func(*sqltypes.Result) error) *sync2.StreamBuffer[*sqltypes.Result] {
+	stream := sync2.NewStreamBuffer(e.streamBufferCapacity, e.streamBudget, func(qr *sqltypes.Result, _ int64) error {
+		return callback(qr)
+	})
+	e.streamsMu.Lock()
+	defer e.streamsMu.Unlock()
+	e.streams[stream] = sessionUUID
+	return stream
+}
+
+func (e *Executor) removeStreamBuffer(stream *sync2.StreamBuffer[*sqltypes.Result]) {
+	e.streamsMu.Lock()
+	defer e.streamsMu.Unlock()
+	delete(e.streams, stream)
+}
+
+// streamBufferedBytes returns the result bytes buffered by the streams, by
+// session UUID.
+func (e *Executor) streamBufferedBytes() map[string]int64 {
+	e.streamsMu.Lock()
+	defer e.streamsMu.Unlock()
+	buffered := make(map[string]int64, len(e.streams))
+	for stream, sessionUUID := range e.streams {
+		buffered[sessionUUID] += stream.Buffered()
+	}
+	return buffered
+}
+
+// withStreamBackpressure buffers every result sent to the client in stream,
+// charging it against the buffer of the stream and the stream budget until
+// the client has consumed it, so that slow readers block their tablet streams
+// instead of piling up results in vtgate memory, without blocking the other
+// streams once they drained their buffers.
+func (e *Executor) withStreamBackpressure(ctx context.Context, stream *sync2.StreamBuffer[*sqltypes.Result]) func(*sqltypes.Result) error {
+	return func(qr *sqltypes.Result) error {
+		if _, err := stream.Send(ctx, qr, qr.CachedSize(true)); err != nil {
+			if err == ctx.Err() {
+				return vterrors.Wrap(err, "waiting for stream buffer budget")
+			}
+			return err
+		}
+		return nil
+	}
+}
+
 // StreamExecuteMulti implements the IExecutor interface
 func (e *Executor) StreamExecuteMulti(ctx context.Context, primitive engine.Primitive, query string, rss []*srvtopo.ResolvedShard, vars []map[string]*querypb.BindVariable, session *SafeSession, autocommit bool, callback func(reply *sqltypes.Result) error) []error {
 	return e.scatterConn.StreamExecuteMulti(ctx, primitive, query, rss, vars, session, autocommit, callback)
@@ -0,0 +1,94 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// exportFilters returns the row of EXPORT FILTERS, the document of the
+// filters of database, or of all the filters if it is empty.
+func (e *Executor) exportFilters(ctx context.Context, keyspace, database, format string) (*sqltypes.Result, error) {
+	var filters []adminapi.Filter
+	err := e.executeFilterStatements(ctx, keyspace, false, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		qr, err := execute("select "+adminAPIFilterColumns+" from "+adminAPIFilterTable+" order by priority, name", nil)
+		if err != nil {
+			return err
+		}
+		filters, err = filtersFromResult(qr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	data, err := encodeFilterDocument(filterDocument(filters, database), format)
+	if err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{
+		Fields: engine.ExportFiltersFields,
+		Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(sqltypes.Text, data)}},
+	}, nil
+}
+
+// importFilters returns the rows of IMPORT FILTERS, the changes which made
+// the filters of database the ones of document, in one transaction.
+func (e *Executor) importFilters(ctx context.Context, keyspace, database, document string, prune bool) (*sqltypes.Result, error) {
+	doc, err := parseFilterDocument([]byte(document), database)
+	if err != nil {
+		return nil, err
+	}
+	var changes *adminapi.FilterImportResult
+	err = e.executeFilterStatements(ctx, keyspace, true, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		changes, err = importFilterDocument(ctx, execute, doc, adminapi.FilterImportOptions{Database: database, Prune: prune})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &sqltypes.Result{Fields: engine.ImportFiltersFields}
+	for _, names := range []struct {
+		change string
+		names  []string
+	}{{"created", changes.Created}, {"updated", changes.Updated}, {"deleted", changes.Deleted}, {"unchanged", changes.Unchanged}} {
+		for _, name := range names.names {
+			result.Rows = append(result.Rows, sqltypes.Row{sqltypes.NewVarChar(name), sqltypes.NewVarChar(names.change)})
+		}
+	}
+	result.RowsAffected = uint64(len(changes.Created) + len(changes.Updated) + len(changes.Deleted))
+	return result, nil
+}
+
+// executeFilterStatements executes statements on the primary tablets of
+// keyspace, in a session of their own, in a transaction if transactional is
+// true. The statements run as the user of ctx.
+func (e *Executor) executeFilterStatements(ctx context.Context, keyspace string, transactional bool, statements func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error) error {
+	session := newSession()
+	session.TargetString = keyspace + "@primary"
+	safeSession := NewSafeSession(session)
+	execute := func(sql string, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+		return e.Execute(ctx, "FilterDocument", safeSession, sql, bindVars)
+	}
+	// Closing the session rolls back its transaction, if it is still open.
+	defer func() { _ = e.CloseSession(ctx, safeSession) }()
+	if !transactional {
+		return statements(execute)
+	}
+	if _, err := execute("begin", nil); err != nil {
+		return err
+	}
+	if err := statements(execute); err != nil {
+		return err
+	}
+	_, err := execute("commit", nil)
+	return err
+}
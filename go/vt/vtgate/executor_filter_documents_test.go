@@ -0,0 +1,57 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+)
+
+func TestExportImportFilters(t *testing.T) {
+	executor, _, _, sbclookup := createExecutorEnv()
+
+	sbclookup.SetResults([]*sqltypes.Result{filterResult("global", "db.a")})
+	qr, err := executorExec(executor, "export filters from db format = yaml", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "document", qr.Fields[0].Name)
+	require.Len(t, qr.Rows, 1)
+	document := qr.Rows[0][0].ToString()
+	assert.Contains(t, document, "database: db\n")
+	assert.Contains(t, document, "name: db.a\n")
+	assert.NotContains(t, document, "global")
+
+	// The exported document imports what it has unchanged, and the new
+	// filters in one transaction of their own.
+	sbclookup.Queries = nil
+	sbclookup.SetResults([]*sqltypes.Result{filterResult("global", "db.a", "db.b"), {RowsAffected: 1}, {RowsAffected: 1}, {RowsAffected: 1}, {RowsAffected: 1}})
+	commits := sbclookup.CommitCount.Get()
+	document += "- name: db.c\n  action: FAIL\n"
+	autocommit := &vtgatepb.Session{TargetString: "@primary", Autocommit: true}
+	qr, err = executorExecSession(executor, fmt.Sprintf("import filters into db from %s prune", sqltypes.EncodeStringSQL(document)), nil, autocommit)
+	require.NoError(t, err)
+	assert.Equal(t, `[[VARCHAR("db.c") VARCHAR("created")] [VARCHAR("db.b") VARCHAR("deleted")] [VARCHAR("db.a") VARCHAR("unchanged")]]`, fmt.Sprintf("%v", qr.Rows))
+	assert.EqualValues(t, 2, qr.RowsAffected)
+	require.Len(t, sbclookup.Queries, 5)
+	assert.Contains(t, sbclookup.Queries[0].Sql, "for update")
+	assert.Contains(t, sbclookup.Queries[1].Sql, "insert into mysql.wescale_plugin")
+	assert.Contains(t, sbclookup.Queries[3].Sql, "delete from mysql.wescale_plugin")
+	assert.Equal(t, commits+1, sbclookup.CommitCount.Get())
+
+	_, err = executorExecSession(executor, "import filters into db from '{\"filters\": [{\"name\": \"other.a\", \"action\": \"FAIL\"}]}'", nil, autocommit)
+	assert.ErrorContains(t, err, "filter other.a is not in database db")
+
+	session := NewSafeSession(&vtgatepb.Session{TargetString: "@primary", InTransaction: true})
+	_, err = executor.Execute(context.Background(), "TestExecute", session, "import filters from '{\"filters\": []}'", nil)
+	assert.ErrorContains(t, err, "IMPORT FILTERS can't run in a transaction")
+}
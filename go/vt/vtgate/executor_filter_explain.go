@@ -0,0 +1,81 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// explainFilter returns the rows of EXPLAIN FILTER, the filters query would
+// match if session sent it, in the order the tablets apply their actions.
+// The filters are resolved by the default pipeline conflict policy, vtgate
+// doesn't know the --queryserver-config-rule-conflict-policy of the tablets.
+func (e *Executor) explainFilter(ctx context.Context, keyspace, query string, session *rules.ExplainSession) (*sqltypes.Result, error) {
+	qrs := rules.New()
+	err := e.executeFilterStatements(ctx, keyspace, false, func(execute func(string, map[string]*querypb.BindVariable) (*sqltypes.Result, error)) error {
+		qr, err := execute("select "+adminAPIFilterColumns+" from "+adminAPIFilterTable, nil)
+		if err != nil {
+			return err
+		}
+		filters, err := filtersFromResult(qr)
+		if err != nil {
+			return err
+		}
+		userGroups := false
+		for i := range filters {
+			if filters[i].Status == rules.InActive {
+				continue
+			}
+			rule, err := rules.BuildQueryRule(filters[i].RuleInfo())
+			if err != nil {
+				return vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "invalid filter %s: %v", filters[i].Name, err)
+			}
+			qrs.Add(rule)
+			userGroups = userGroups || len(filters[i].UserGroups) > 0
+		}
+		if !userGroups {
+			return nil
+		}
+		qr, err = execute("select group_name, user from "+adminAPIUserGroupTable, nil)
+		if err != nil {
+			return err
+		}
+		members := make(map[string][]string)
+		for _, row := range qr.Named().Rows {
+			name := row.AsString("group_name", "")
+			members[name] = append(members[name], row.AsString("user", ""))
+		}
+		qrs.SetUserGroups(members)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	explanation, err := qrs.Explain(query, session)
+	if err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "can't explain the filters of %s: %v", query, err)
+	}
+	result := &sqltypes.Result{Fields: engine.ExplainFilterFields}
+	for i, qr := range explanation.Rules {
+		result.Rows = append(result.Rows, sqltypes.Row{
+			sqltypes.NewInt64(int64(i + 1)),
+			sqltypes.NewVarChar(qr.Name),
+			sqltypes.NewInt64(int64(qr.Priority)),
+			sqltypes.NewVarChar(qr.GetActionType()),
+			sqltypes.MakeTrusted(sqltypes.Text, []byte(qr.GetActionArgs())),
+			sqltypes.NewVarChar(qr.Status),
+		})
+	}
+	return result, nil
+}
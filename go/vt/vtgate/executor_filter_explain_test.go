@@ -0,0 +1,76 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestExplainFilter(t *testing.T) {
+	executor, _, _, sbclookup := createExecutorEnv()
+
+	sbclookup.SetResults([]*sqltypes.Result{filterResult("db.a", "db.b")})
+	qr, err := executorExec(executor, "explain filter for 'delete from t' from db", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "order", qr.Fields[0].Name)
+	assert.Equal(t, `[[INT64(1) VARCHAR("db.a") INT64(10) VARCHAR("FAIL") TEXT("") VARCHAR("ACTIVE")] [INT64(2) VARCHAR("db.b") INT64(10) VARCHAR("FAIL") TEXT("") VARCHAR("ACTIVE")]]`, fmt.Sprintf("%v", qr.Rows))
+	// The query isn't executed, only the filters are read.
+	require.Len(t, sbclookup.Queries, 1)
+	assert.Contains(t, sbclookup.Queries[0].Sql, "from mysql.wescale_plugin")
+
+	sbclookup.SetResults([]*sqltypes.Result{filterResult("db.a")})
+	qr, err = executorExec(executor, "explain filter for 'select * from t' from db", nil)
+	require.NoError(t, err)
+	assert.Empty(t, qr.Rows)
+
+	// The user and IP conditions match the ones of the statement, and the
+	// members of the user groups are read for the filters which match them.
+	filters := filterResult()
+	for _, filter := range [][]string{
+		{"etl_deletes", "10", "DRY_RUN", "", "etl", "SLEEP", `{"duration": "10ms"}`, ""},
+		{"office_deletes", "20", "ACTIVE", `10\..*`, "", "FAIL", "", ""},
+		{"analytics_deletes", "30", "ACTIVE", "", "", "FAIL", "", `["analytics"]`},
+	} {
+		row := []string{filter[0], "", filter[1], filter[2], `["Delete"]`, "", "", "", filter[3], filter[4], "", "", "", "", filter[5], filter[6], "", "", "", filter[7], "null", "", "null", ""}
+		filters.Rows = append(filters.Rows, sqltypes.MakeTestResult(filters.Fields, strings.Join(row, "|")).Rows...)
+	}
+	groups := sqltypes.MakeTestResult(sqltypes.MakeTestFields("group_name|user", "varchar|varchar"), "analytics|etl")
+	for _, tcase := range []struct {
+		statement string
+		want      []string
+	}{{
+		statement: "explain filter for 'delete from t'",
+	}, {
+		statement: "explain filter for 'delete from t' user 'etl'",
+		want:      []string{"etl_deletes", "analytics_deletes"},
+	}, {
+		statement: "explain filter for 'delete from t' ip '10.0.0.1'",
+		want:      []string{"office_deletes"},
+	}} {
+		sbclookup.SetResults([]*sqltypes.Result{filters, groups})
+		qr, err = executorExec(executor, tcase.statement, nil)
+		require.NoError(t, err, tcase.statement)
+		var names []string
+		for _, row := range qr.Rows {
+			names = append(names, row[1].ToString())
+		}
+		assert.Equal(t, tcase.want, names, tcase.statement)
+		if len(qr.Rows) > 1 {
+			assert.Equal(t, `[INT64(1) VARCHAR("etl_deletes") INT64(10) VARCHAR("SLEEP") TEXT("{\"duration\": \"10ms\"}") VARCHAR("DRY_RUN")]`, fmt.Sprintf("%v", qr.Rows[0]))
+		}
+	}
+
+	sbclookup.SetResults([]*sqltypes.Result{filterResult("db.a")})
+	_, err = executorExec(executor, "explain filter for 'delete frm t'", nil)
+	assert.ErrorContains(t, err, "can't explain the filters of delete frm t")
+}
@@ -0,0 +1,192 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"strings"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/key"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/srvtopo"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/logstats"
+	"vitess.io/vitess/go/vt/vtgate/vindexes"
+	"vitess.io/vitess/go/vt/vttablet/queryservice"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// When --enable_transaction_pipelining is set, consecutive statements of a
+// multi-statement query that run in an open transaction are sent to the
+// tablet in a single pipelined Execute, instead of one round trip per
+// statement. Only DMLs that vtgate would send unchanged to the single shard
+// of the transaction are pipelined: everything else goes through the regular
+// Execute path.
+
+var pipelinedStatements = stats.NewCounter("VtgatePipelinedStatements", "Number of statements sent to vttablet in pipelined Executes")
+
+// stripPipelinedStatements removes the bind variable of the pipelined
+// Executes from the bind variables of a client. Only ExecutePipeline sends it
+// to the tablets: a client forging it would run its statements without going
+// through vtgate one by one.
+func stripPipelinedStatements(bindVars map[string]*querypb.BindVariable) {
+	delete(bindVars, queryservice.PipelinedStatements)
+}
+
+// ExecutePipeline executes the longest prefix of statements that can be
+// pipelined in a single round trip to the tablet. It returns the results of
+// the statements that succeeded, and the error of the one that failed, if
+// any. It returns no result and no error if fewer than two statements can be
+// pipelined.
+func (e *Executor) ExecutePipeline(ctx context.Context, safeSession *SafeSession, statements []string) ([]*sqltypes.Result, error) {
+	rs, queries, stmtTypes := e.pipelinePrefix(ctx, safeSession, statements)
+	if len(queries) < 2 {
+		return nil, nil
+	}
+	pipelinedStatements.Add(int64(len(queries)))
+
+	bound := []*querypb.BoundQuery{{
+		Sql:           strings.Join(queries, "; "),
+		BindVariables: queryservice.PipelinedBindVars(queries),
+	}}
+	qr, errs := e.ExecuteMultiShard(ctx, nil, []*srvtopo.ResolvedShard{rs}, bound, safeSession, false, false)
+	if err := vterrors.Aggregate(errs); err != nil {
+		e.logPipeline(ctx, safeSession, queries, stmtTypes, nil, err)
+		return nil, err
+	}
+	results, err := queryservice.DecodePipelinedResults(qr)
+	e.logPipeline(ctx, safeSession, queries, stmtTypes, results, err)
+	return results, err
+}
+
+// logPipeline updates the session and logs the pipelined statements as if
+// they were executed one by one.
+func (e *Executor) logPipeline(ctx context.Context, safeSession *SafeSession, queries []string, stmtTypes []sqlparser.StatementType, results []*sqltypes.Result, err error) {
+	for i, query := range queries {
+		logStats := logstats.NewLogStats(ctx, "ExecutePipeline", query, safeSession.GetSessionUUID(), nil)
+		logStats.StmtType = stmtTypes[i].String()
+		logStats.ShardQueries = 1
+		if i < len(results) {
+			saveSessionStats(safeSession, stmtTypes[i], results[i].RowsAffected, results[i].InsertID, 0, nil)
+			logStats.RowsAffected = results[i].RowsAffected
+		} else {
+			saveSessionStats(safeSession, stmtTypes[i], 0, 0, 0, err)
+			logStats.Error = err
+		}
+		logStats.SaveEndTime()
+		QueryLogger.Send(logStats)
+		if i >= len(results) {
+			break
+		}
+	}
+}
+
+// pipelinePrefix returns the shard the transaction of safeSession runs on,
+// and the longest prefix of statements that can be pipelined to it.
+func (e *Executor) pipelinePrefix(ctx context.Context, safeSession *SafeSession, statements []string) (*srvtopo.ResolvedShard, []string, []sqlparser.StatementType) {
+	if !enableTransactionPipelining || !safeSession.InTransaction() || safeSession.InReservedConn() ||
+		safeSession.InLockSession() || safeSession.HasSystemVariables() || safeSession.logging != nil {
+		return nil, nil, nil
+	}
+	// Pipelining is only worth it while the transaction runs on a single
+	// shard that was already begun by a previous statement.
+	if len(safeSession.ShardSessions) != 1 || safeSession.ShardSessions[0].TransactionId == 0 {
+		return nil, nil, nil
+	}
+	target := safeSession.ShardSessions[0].Target
+	keyspace, tabletType, dest, err := e.ParseDestinationTarget(safeSession.TargetString)
+	if err != nil || dest != nil || keyspace != target.Keyspace ||
+		tabletType != topodatapb.TabletType_PRIMARY || target.TabletType != topodatapb.TabletType_PRIMARY {
+		return nil, nil, nil
+	}
+	var ks *vindexes.KeyspaceSchema
+	if vschema := e.VSchema(); vschema != nil {
+		ks = vschema.Keyspaces[keyspace]
+		if ks != nil && ks.Keyspace.Sharded {
+			return nil, nil, nil
+		}
+	}
+
+	var queries []string
+	var stmtTypes []sqlparser.StatementType
+	for _, sql := range statements {
+		query, ok := pipelinedQuery(sql, keyspace, ks, safeSession.GetRewriteTableNameWithDbNamePrefix())
+		if !ok {
+			break
+		}
+		queries = append(queries, query)
+		stmtTypes = append(stmtTypes, sqlparser.Preview(sql))
+	}
+	if len(queries) < 2 {
+		return nil, nil, nil
+	}
+	rss, err := e.resolver.resolver.ResolveDestination(ctx, target.Keyspace, target.TabletType, key.DestinationShard(target.Shard))
+	if err != nil || len(rss) != 1 {
+		return nil, nil, nil
+	}
+	return rss[0], queries, stmtTypes
+}
+
+// pipelinedQuery returns the query vtgate would send to the tablet for sql,
+// or false if sql is not a DML, or needs vtgate to be executed.
+func pipelinedQuery(sql, keyspace string, ks *vindexes.KeyspaceSchema, rewriteTableName bool) (string, bool) {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return "", false
+	}
+	switch stmt := stmt.(type) {
+	case *sqlparser.Insert:
+		if ks != nil {
+			if table := ks.Tables[stmt.Table.Name.String()]; table != nil && table.AutoIncrement != nil {
+				// vtgate fetches the next values of the sequence.
+				return "", false
+			}
+		}
+	case *sqlparser.Update, *sqlparser.Delete:
+	default:
+		return "", false
+	}
+	if !sqlparser.IgnoreMaxPayloadSizeDirective(stmt) && !isValidPayloadSize(sql) {
+		return "", false
+	}
+
+	// Tables of other keyspaces, bind variables, and functions or variables
+	// that vtgate evaluates cannot be sent to the tablet as is.
+	pipelinable := true
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case sqlparser.TableName:
+			if !node.Qualifier.IsEmpty() && node.Qualifier.String() != keyspace {
+				pipelinable = false
+			}
+		case sqlparser.Argument, sqlparser.ListArg:
+			pipelinable = false
+		}
+		return pipelinable, nil
+	}, stmt)
+	if !pipelinable {
+		return "", false
+	}
+	result, err := sqlparser.RewriteAST(sqlparser.CloneStatement(stmt), keyspace, sqlparser.SQLSelectLimitUnset, "", nil, nil)
+	if err != nil || result.BindVarNeeds.HasRewrites() {
+		return "", false
+	}
+
+	if rewriteTableName && keyspace != "" {
+		rewritten, skipUse, err := sqlparser.RewriteTableName(stmt, keyspace)
+		if err != nil {
+			return "", false
+		}
+		if skipUse {
+			return sqlparser.String(rewritten), true
+		}
+	}
+	return sql, true
+}
@@ -0,0 +1,135 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/vindexes"
+	"vitess.io/vitess/go/vt/vttablet/queryservice"
+
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func TestPipelinedQuery(t *testing.T) {
+	ks := &vindexes.KeyspaceSchema{
+		Keyspace: &vindexes.Keyspace{Name: KsTestUnsharded},
+		Tables: map[string]*vindexes.Table{
+			"main1": {AutoIncrement: &vindexes.AutoIncrement{}},
+		},
+	}
+
+	testcases := []struct {
+		sql  string
+		want string
+	}{
+		{sql: "insert into simple(id) values (1)", want: "insert into simple(id) values (1)"},
+		{sql: "update simple set a = 1 where id = 1", want: "update simple set a = 1 where id = 1"},
+		{sql: "delete from TestUnsharded.simple where id = 1", want: "delete from TestUnsharded.simple where id = 1"},
+		// main1 has a sequence.
+		{sql: "insert into main1(id) values (1)"},
+		{sql: "update main1 set a = 1 where id = 1", want: "update main1 set a = 1 where id = 1"},
+		{sql: "select * from simple"},
+		{sql: "begin"},
+		{sql: "delete from other.simple where id = 1"},
+		{sql: "insert into simple(id) values (last_insert_id())"},
+		{sql: "update simple set a = @a"},
+		{sql: "update simple set a = :a"},
+		{sql: "update simple set"},
+	}
+	for _, tcase := range testcases {
+		t.Run(tcase.sql, func(t *testing.T) {
+			got, ok := pipelinedQuery(tcase.sql, KsTestUnsharded, ks, false)
+			assert.Equal(t, tcase.want != "", ok)
+			assert.Equal(t, tcase.want, got)
+		})
+	}
+
+	got, ok := pipelinedQuery("update simple set a = 1 where id = 1", KsTestUnsharded, ks, true)
+	assert.True(t, ok)
+	assert.Equal(t, "update TestUnsharded.`simple` set a = 1 where id = 1", got)
+}
+
+func TestExecutePipeline(t *testing.T) {
+	defer func(enabled bool) { enableTransactionPipelining = enabled }(enableTransactionPipelining)
+	enableTransactionPipelining = true
+
+	executor, _, _, sbclookup := createExecutorEnv()
+	session := NewSafeSession(&vtgatepb.Session{TargetString: KsTestUnsharded})
+	statements := []string{
+		"update simple set a = 1 where id = 1",
+		"delete from simple where id = 2",
+		"insert into simple(id) values (3)",
+		"select * from simple",
+	}
+
+	// there is no transaction.
+	results, err := executor.ExecutePipeline(ctx, session, statements)
+	require.NoError(t, err)
+	require.Nil(t, results)
+
+	_, err = executor.Execute(ctx, "TestExecute", session, "begin", nil)
+	require.NoError(t, err)
+	// the transaction is not begun on the shard yet.
+	results, err = executor.ExecutePipeline(ctx, session, statements)
+	require.NoError(t, err)
+	require.Nil(t, results)
+
+	_, err = executor.Execute(ctx, "TestExecute", session, "insert into simple(id) values (0)", nil)
+	require.NoError(t, err)
+	sbclookup.Queries = nil
+	sbclookup.SetResults([]*sqltypes.Result{queryservice.EncodePipelinedResults([]*sqltypes.Result{
+		{RowsAffected: 1},
+		{RowsAffected: 2},
+		{RowsAffected: 1, InsertID: 3},
+	}, nil)})
+
+	results, err = executor.ExecutePipeline(ctx, session, statements)
+	require.NoError(t, err)
+	assert.Equal(t, []*sqltypes.Result{{RowsAffected: 1}, {RowsAffected: 2}, {RowsAffected: 1, InsertID: 3}}, results)
+	// the select is not pipelined.
+	require.Len(t, sbclookup.Queries, 1)
+	got, ok := queryservice.GetPipelinedStatements(sbclookup.Queries[0].BindVariables)
+	require.True(t, ok)
+	assert.Equal(t, statements[:3], got)
+	assert.EqualValues(t, 3, session.LastInsertId)
+	assert.EqualValues(t, 1, session.RowCount)
+
+	// the error of a statement is returned with the results of the previous ones.
+	failure := vterrors.New(vtrpcpb.Code_ALREADY_EXISTS, "Duplicate entry '3' for key 'PRIMARY' (errno 1062) (sqlstate 23000)")
+	sbclookup.SetResults([]*sqltypes.Result{queryservice.EncodePipelinedResults([]*sqltypes.Result{{RowsAffected: 1}}, failure)})
+	results, err = executor.ExecutePipeline(ctx, session, statements)
+	assert.Equal(t, []*sqltypes.Result{{RowsAffected: 1}}, results)
+	assert.Equal(t, vtrpcpb.Code_ALREADY_EXISTS, vterrors.Code(err))
+	assert.True(t, session.InTransaction())
+}
+
+func TestExecuteStripsPipelinedStatements(t *testing.T) {
+	executor, _, _, sbclookup := createExecutorEnv()
+	session := NewSafeSession(&vtgatepb.Session{TargetString: KsTestUnsharded})
+
+	// a client can't pipeline statements by sending the bind variable itself.
+	bindVars := queryservice.PipelinedBindVars([]string{"delete from simple", "delete from simple"})
+	_, err := executor.Execute(ctx, "TestExecute", session, "select * from simple", bindVars)
+	require.NoError(t, err)
+	require.Len(t, sbclookup.Queries, 1)
+	_, ok := queryservice.GetPipelinedStatements(sbclookup.Queries[0].BindVariables)
+	assert.False(t, ok)
+
+	sbclookup.Queries = nil
+	bindVars = queryservice.PipelinedBindVars([]string{"delete from simple", "delete from simple"})
+	err = executor.StreamExecute(ctx, "TestExecute", session, "select * from simple", bindVars, func(*sqltypes.Result) error { return nil })
+	require.NoError(t, err)
+	require.Len(t, sbclookup.Queries, 1)
+	_, ok = queryservice.GetPipelinedStatements(sbclookup.Queries[0].BindVariables)
+	assert.False(t, ok)
+}
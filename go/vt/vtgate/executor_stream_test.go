@@ -33,9 +33,11 @@ import (
 
 	"context"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/sync2"
 	_ "vitess.io/vitess/go/vt/vtgate/vindexes"
 	"vitess.io/vitess/go/vt/vttablet/sandboxconn"
 )
@@ -104,3 +106,43 @@ func executorStreamMessages(executor *Executor, sql string) (qr *sqltypes.Result
 	}
 	return qr, nil
 }
+
+func TestStreamBufferPerStream(t *testing.T) {
+	executor, _, _, sbclookup := createExecutorEnv()
+	result := &sqltypes.Result{Fields: sandboxconn.SingleRowResult.Fields}
+	for i := 0; i < 10; i++ {
+		result.Rows = append(result.Rows, sandboxconn.SingleRowResult.Rows[0])
+	}
+	sbclookup.SetResults([]*sqltypes.Result{result})
+	want, err := executorStream(executor, "select id from main1")
+	require.NoError(t, err)
+	require.Len(t, want.Rows, 10)
+	sbclookup.SetResults([]*sqltypes.Result{result})
+	executor.streamBufferCapacity = 1 << 20
+
+	consume := make(chan struct{})
+	var rows int
+	var firstSize sync2.AtomicInt64
+	done := make(chan error)
+	go func() {
+		done <- executor.StreamExecute(context.Background(), "TestStreamBufferPerStream", NewSafeSession(nil), "select id from main1", nil, func(qr *sqltypes.Result) error {
+			if len(qr.Rows) > 0 {
+				firstSize.CompareAndSwap(0, qr.CachedSize(true))
+				<-consume
+			}
+			rows += len(qr.Rows)
+			return nil
+		})
+	}()
+
+	// The tablet is read while the client is stuck on the first rows.
+	assert.Eventually(t, func() bool {
+		buffered := executor.streamBufferedBytes()[""]
+		return firstSize.Get() > 0 && buffered > firstSize.Get() && buffered == executor.streamBudget.InUse()
+	}, 5*time.Second, time.Millisecond)
+	close(consume)
+	require.NoError(t, <-done)
+	assert.Equal(t, len(want.Rows), rows)
+	assert.EqualValues(t, 0, executor.streamBudget.InUse())
+	assert.Empty(t, executor.streamBufferedBytes())
+}
@@ -1165,6 +1165,35 @@ func TestExecutorClearsWarnings(t *testing.T) {
 	require.Empty(t, session.Warnings)
 }
 
+func TestExecutorShardWarnings(t *testing.T) {
+	executor, _, _, sbclookup := createExecutorEnv()
+	executor.normalize = true
+	session := NewSafeSession(&vtgatepb.Session{})
+	sbclookup.SetResults([]*sqltypes.Result{{
+		RowsAffected: 1,
+		Warnings: []*querypb.QueryWarning{
+			{Level: "Warning", Code: 1265, Message: "Data truncated for column 'name' at row 1"},
+			{Level: "Note", Code: 1051, Message: "Unknown table 'test.t'"},
+		},
+	}})
+	_, err := executor.Execute(context.Background(), "TestExecute", session, "insert into main1(id, name) values (1, 'truncated')", nil)
+	require.NoError(t, err)
+	require.Len(t, session.GetWarnings(), 2)
+
+	// SELECT @@warning_count and SHOW WARNINGS keep the warnings.
+	_, err = executor.Execute(context.Background(), "TestExecute", session, "select @@warning_count", nil)
+	require.NoError(t, err)
+	queries := sbclookup.Queries
+	assert.Equal(t, "2", string(queries[len(queries)-1].BindVariables["__vtwarning_count"].Value))
+	result, err := executor.Execute(context.Background(), "TestExecute", session, "show warnings", nil)
+	require.NoError(t, err)
+	assert.Equal(t, `[[VARCHAR("Warning") UINT32(1265) VARCHAR("Data truncated for column 'name' at row 1")] [VARCHAR("Note") UINT32(1051) VARCHAR("Unknown table 'test.t'")]]`, fmt.Sprintf("%v", result.Rows))
+
+	_, err = executor.Execute(context.Background(), "TestExecute", session, "select 42", nil)
+	require.NoError(t, err)
+	require.Empty(t, session.GetWarnings())
+}
+
 func TestExecutorStartTxnStmt(t *testing.T) {
 	executor, _, _, _ := createExecutorEnv()
 	session := NewAutocommitSession(&vtgatepb.Session{})
@@ -0,0 +1,160 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// vtgate closes the client connections which stay idle, between two
+// commands, longer than their idle timeout, the way MySQL does with
+// wait_timeout: the client reads an ER_CLIENT_INTERACTION_TIMEOUT error as the
+// result of its next command, and the transaction and the reserved
+// connections of the session are released, like when the client disconnects.
+//
+// The idle timeout of a connection is, in this order, none if its user is in
+// --idle_session_exempt_users, the one of its user in
+// --idle_session_user_timeouts, the idle_timeout of its workload class, then
+// --idle_session_timeout. A timeout of 0 never closes the connection.
+
+// idleSessionWriteTimeout bounds the time to send the error to a client which
+// doesn't read.
+const idleSessionWriteTimeout = time.Second
+
+var (
+	idleSessionTimeout       time.Duration
+	idleSessionCheckInterval = 10 * time.Second
+	idleSessionUserTimeouts  map[string]string
+	idleSessionExemptUsers   []string
+
+	idleSessionUserTimeoutsByUser map[string]time.Duration
+	idleSessionExemptUsersByUser  map[string]bool
+
+	// idleSessionsClosed counts the idle sessions closed, by user.
+	idleSessionsClosed = stats.NewCountersWithSingleLabel("IdleSessionsClosed", "Idle client sessions closed by vtgate", "User")
+)
+
+func registerIdleSessionFlags(fs *pflag.FlagSet) {
+	fs.DurationVar(&idleSessionTimeout, "idle_session_timeout", idleSessionTimeout, "Close the client connections idle for longer than this, like the wait_timeout of MySQL. If 0, they are never closed.")
+	fs.DurationVar(&idleSessionCheckInterval, "idle_session_check_interval", idleSessionCheckInterval, "How often to look for the idle client connections to close.")
+	fs.StringToStringVar(&idleSessionUserTimeouts, "idle_session_user_timeouts", idleSessionUserTimeouts, "Comma-separated user=timeout pairs overriding --idle_session_timeout for the connections of some users, e.g. etl=4h,web=10m. A timeout of 0s never closes them.")
+	fs.StringSliceVar(&idleSessionExemptUsers, "idle_session_exempt_users", idleSessionExemptUsers, "Comma-separated users whose idle connections are never closed.")
+}
+
+func init() {
+	servenv.OnParseFor("vtgate", registerIdleSessionFlags)
+	servenv.OnParseFor("vtcombo", registerIdleSessionFlags)
+	servenv.OnInit(initIdleSessionPolicy)
+}
+
+func initIdleSessionPolicy() {
+	userTimeouts, err := parseIdleSessionUserTimeouts(idleSessionUserTimeouts)
+	if err != nil {
+		log.Exitf("Invalid --idle_session_user_timeouts: %v", err)
+	}
+	idleSessionUserTimeoutsByUser = userTimeouts
+	idleSessionExemptUsersByUser = make(map[string]bool, len(idleSessionExemptUsers))
+	for _, user := range idleSessionExemptUsers {
+		idleSessionExemptUsersByUser[user] = true
+	}
+}
+
+// parseIdleSessionUserTimeouts parses the timeouts of
+// --idle_session_user_timeouts.
+func parseIdleSessionUserTimeouts(userTimeouts map[string]string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration, len(userTimeouts))
+	for user, value := range userTimeouts {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid idle timeout %q of user %s", value, user)
+		}
+		timeouts[user] = timeout
+	}
+	return timeouts, nil
+}
+
+// idleSessionReaperEnabled returns whether any idle timeout is set.
+func idleSessionReaperEnabled() bool {
+	if idleSessionTimeout > 0 {
+		return true
+	}
+	for _, timeout := range idleSessionUserTimeoutsByUser {
+		if timeout > 0 {
+			return true
+		}
+	}
+	for _, class := range workloadClasses {
+		if class.idleTimeout > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// idleTimeout returns the idle timeout of a client connection, or 0.
+func idleTimeout(c *mysql.Conn) time.Duration {
+	if idleSessionExemptUsersByUser[c.User] {
+		return 0
+	}
+	if timeout, ok := idleSessionUserTimeoutsByUser[c.User]; ok {
+		return timeout
+	}
+	if class := classifyWorkload(c.Attributes); class != nil && class.IdleTimeout != "" {
+		return class.idleTimeout
+	}
+	return idleSessionTimeout
+}
+
+// runIdleSessionReaper closes the idle connections every
+// --idle_session_check_interval.
+func (vh *vtgateHandler) runIdleSessionReaper() {
+	ticker := time.NewTicker(idleSessionCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		vh.closeIdleSessions(now)
+	}
+}
+
+// closeIdleSessions closes the connections idle for longer than their idle
+// timeout, and returns how many it closed.
+func (vh *vtgateHandler) closeIdleSessions(now time.Time) int {
+	type idleConn struct {
+		c        *mysql.Conn
+		idleTime time.Duration
+	}
+	var idleConns []idleConn
+	vh.mu.Lock()
+	for c, info := range vh.connections {
+		if info.query != "" || c.IsClosed() {
+			continue
+		}
+		timeout := idleTimeout(c)
+		if idleTime := now.Sub(info.since); timeout > 0 && idleTime >= timeout {
+			idleConns = append(idleConns, idleConn{c: c, idleTime: idleTime})
+		}
+	}
+	vh.mu.Unlock()
+
+	for _, idle := range idleConns {
+		log.Infof("Closing the connection %d of user %s, idle for %v", idle.c.ConnectionID, idle.c.User, idle.idleTime.Round(time.Second))
+		err := idle.c.CloseWithError(mysql.NewSQLError(mysql.ERClientInteractionTimeout, mysql.SSUnknownSQLState, "The client was disconnected by the server because of inactivity."), idleSessionWriteTimeout)
+		if err != nil {
+			log.Warningf("Failed to tell the connection %d it was idle: %v", idle.c.ConnectionID, err)
+		}
+		idleSessionsClosed.Add(idle.c.User, 1)
+	}
+	return len(idleConns)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	defer func(timeout time.Duration, userTimeouts map[string]time.Duration, exemptUsers map[string]bool, classes []*workloadClass) {
+		idleSessionTimeout, idleSessionUserTimeoutsByUser, idleSessionExemptUsersByUser, workloadClasses = timeout, userTimeouts, exemptUsers, classes
+	}(idleSessionTimeout, idleSessionUserTimeoutsByUser, idleSessionExemptUsersByUser, workloadClasses)
+
+	idleSessionTimeout = 0
+	idleSessionUserTimeoutsByUser, idleSessionExemptUsersByUser, workloadClasses = nil, nil, nil
+	assert.False(t, idleSessionReaperEnabled())
+
+	var err error
+	idleSessionTimeout = 10 * time.Minute
+	idleSessionUserTimeoutsByUser, err = parseIdleSessionUserTimeouts(map[string]string{"etl": "4h", "batch": "0s"})
+	require.NoError(t, err)
+	idleSessionExemptUsersByUser = map[string]bool{"admin": true, "etl": true}
+	workloadClasses, err = parseWorkloadClasses([]byte(`{"classes": [
+		{"name": "dump", "attributes": {"program_name": "mysqldump"}, "idle_timeout": "1h"},
+		{"name": "web", "attributes": {"app": "web"}}
+	]}`))
+	require.NoError(t, err)
+	assert.True(t, idleSessionReaperEnabled())
+
+	dump := map[string]string{"program_name": "mysqldump"}
+	for _, tcase := range []struct {
+		user       string
+		attributes map[string]string
+		timeout    time.Duration
+	}{
+		{"app", nil, 10 * time.Minute},
+		{"app", map[string]string{"app": "web"}, 10 * time.Minute},
+		{"app", dump, time.Hour},
+		// The timeouts of the users take precedence over the ones of the
+		// classes, and the exempt users over both.
+		{"batch", dump, 0},
+		{"etl", nil, 0},
+		{"admin", dump, 0},
+	} {
+		assert.Equal(t, tcase.timeout, idleTimeout(&mysql.Conn{User: tcase.user, Attributes: tcase.attributes}), tcase.user)
+	}
+
+	_, err = parseIdleSessionUserTimeouts(map[string]string{"etl": "forever"})
+	assert.EqualError(t, err, `invalid idle timeout "forever" of user etl`)
+}
+
+func TestCloseIdleSessions(t *testing.T) {
+	defer func(timeout time.Duration) { idleSessionTimeout = timeout }(idleSessionTimeout)
+	idleSessionTimeout = time.Minute
+
+	vh := newVtgateHandler(nil)
+	newConn := func(user string, idleTime time.Duration, query string) (*mysql.Conn, net.Conn) {
+		server, client := net.Pipe()
+		c := mysql.NewTestConn(server)
+		c.User = user
+		vh.connections[c] = &connectionInfo{since: time.Now().Add(-idleTime), query: query}
+		return c, client
+	}
+	idle, idleClient := newConn("app", 2*time.Minute, "")
+	busy, busyClient := newConn("app", 2*time.Minute, "select sleep(600)")
+	active, activeClient := newConn("app", time.Second, "")
+	defer func() {
+		for _, c := range []net.Conn{idleClient, busyClient, activeClient} {
+			c.Close()
+		}
+		busy.Close()
+		active.Close()
+	}()
+
+	// The client of the idle connection reads the error, then the end of
+	// the connection.
+	packets := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(idleClient)
+		packets <- data
+	}()
+	closed := idleSessionsClosed.Counts()["app"]
+	assert.Equal(t, 1, vh.closeIdleSessions(time.Now()))
+	assert.True(t, idle.IsClosed())
+	assert.False(t, busy.IsClosed())
+	assert.False(t, active.IsClosed())
+	assert.EqualValues(t, closed+1, idleSessionsClosed.Counts()["app"])
+
+	data := <-packets
+	require.Greater(t, len(data), 4)
+	err := mysql.ParseErrorPacket(data[4:])
+	assert.ErrorContains(t, err, "disconnected by the server because of inactivity")
+	assert.Equal(t, mysql.ERClientInteractionTimeout, err.(*mysql.SQLError).Number())
+
+	// A connection is closed once, even before the handler forgets it.
+	assert.Equal(t, 0, vh.closeIdleSessions(time.Now()))
+}
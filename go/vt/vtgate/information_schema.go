@@ -0,0 +1,147 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"sort"
+	"strings"
+
+	"vitess.io/vitess/go/mysql/collations"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+	vtschema "vitess.io/vitess/go/vt/vtgate/schema"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// informationSchemaTable returns the rows of an information_schema table,
+// built from what the schema tracker knows about the keyspaces of the vschema.
+// The rows are sorted like MySQL sorts them.
+func (e *Executor) informationSchemaTable(name string) ([]sqltypes.Row, error) {
+	if e.schemaTracker == nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "%s emulation needs the schema tracker, see --schema_change_signal", engine.InformationSchema)
+	}
+	var keyspaces []string
+	if vschema := e.VSchema(); vschema != nil {
+		for ks := range vschema.Keyspaces {
+			keyspaces = append(keyspaces, ks)
+		}
+	}
+	sort.Strings(keyspaces)
+
+	var rows []sqltypes.Row
+	for _, ks := range keyspaces {
+		tables := e.schemaTracker.TableDetails(ks)
+		names := make([]string, 0, len(tables))
+		for tbl := range tables {
+			names = append(names, tbl)
+		}
+		sort.Strings(names)
+		for _, tbl := range names {
+			rows = append(rows, informationSchemaRows(name, ks, tbl, tables[tbl])...)
+		}
+	}
+	return rows, nil
+}
+
+// informationSchemaRows returns the rows of an information_schema table for
+// a single table.
+func informationSchemaRows(name, ks, tbl string, details vtschema.TableDetails) []sqltypes.Row {
+	def, schema, table := sqltypes.NewVarChar("def"), sqltypes.NewVarChar(ks), sqltypes.NewVarChar(tbl)
+	var rows []sqltypes.Row
+	switch strings.ToLower(name) {
+	case "tables":
+		tableType := "BASE TABLE"
+		if details.View {
+			tableType = "VIEW"
+		}
+		rows = append(rows, sqltypes.Row{def, schema, table, sqltypes.NewVarChar(tableType)})
+	case "columns":
+		keys := columnKeys(details.Indexes)
+		for i, col := range details.Columns {
+			charset, collation := sqltypes.NULL, sqltypes.NULL
+			if col.CollationName != "" {
+				collation = sqltypes.NewVarChar(col.CollationName)
+				if coll := collations.Local().LookupByName(col.CollationName); coll != nil {
+					charset = sqltypes.NewVarChar(coll.Charset().Name())
+				}
+			}
+			rows = append(rows, sqltypes.Row{
+				def, schema, table,
+				sqltypes.NewVarChar(col.Name),
+				sqltypes.NewUint64(uint64(i + 1)),
+				sqltypes.NewVarChar(col.DataType),
+				charset,
+				collation,
+				sqltypes.NewVarChar(keys[strings.ToLower(col.Name)]),
+			})
+		}
+	case "statistics":
+		for _, index := range details.Indexes {
+			nonUnique, column := int64(0), sqltypes.NULL
+			if index.NonUnique {
+				nonUnique = 1
+			}
+			if index.Column != "" {
+				column = sqltypes.NewVarChar(index.Column)
+			}
+			rows = append(rows, sqltypes.Row{
+				def, schema, table,
+				sqltypes.NewInt64(nonUnique),
+				schema,
+				sqltypes.NewVarChar(index.Index),
+				sqltypes.NewUint64(uint64(index.Seq)),
+				column,
+			})
+		}
+	case "key_column_usage":
+		// Only the unique keys are known: the tracker has no foreign keys.
+		for _, index := range details.Indexes {
+			if index.NonUnique || index.Column == "" {
+				continue
+			}
+			rows = append(rows, sqltypes.Row{
+				def, schema,
+				sqltypes.NewVarChar(index.Index),
+				def, schema, table,
+				sqltypes.NewVarChar(index.Column),
+				sqltypes.NewUint64(uint64(index.Seq)),
+			})
+		}
+	}
+	return rows
+}
+
+// columnKeys returns the COLUMN_KEY of the indexed columns, by lowercased
+// column name. As in MySQL, PRI wins over UNI, which wins over MUL, and
+// besides the primary key only the first column of an index has a key; a
+// multi-column unique index gives MUL.
+func columnKeys(indexes []vtschema.IndexColumn) map[string]string {
+	rank := map[string]int{"": 0, "MUL": 1, "UNI": 2, "PRI": 3}
+	width := make(map[string]int)
+	for _, index := range indexes {
+		width[index.Index]++
+	}
+	keys := make(map[string]string)
+	for _, index := range indexes {
+		if index.Column == "" || (index.Seq != 1 && index.Index != "PRIMARY") {
+			continue
+		}
+		key := "MUL"
+		switch {
+		case index.Index == "PRIMARY":
+			key = "PRI"
+		case !index.NonUnique && width[index.Index] == 1:
+			key = "UNI"
+		}
+		col := strings.ToLower(index.Column)
+		if rank[key] > rank[keys[col]] {
+			keys[col] = key
+		}
+	}
+	return keys
+}
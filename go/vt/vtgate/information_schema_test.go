@@ -0,0 +1,74 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtschema "vitess.io/vitess/go/vt/vtgate/schema"
+)
+
+func TestInformationSchemaEmulation(t *testing.T) {
+	executor, sbc1, sbc2, sbclookup := createExecutorEnv()
+	executor.schemaTracker = &fakeSchema{d: map[string]vtschema.TableDetails{
+		"t1": {
+			Columns: []vtschema.ColumnDetails{
+				{Name: "id", DataType: "bigint"},
+				{Name: "name", DataType: "varchar", CollationName: "utf8mb4_0900_ai_ci"},
+				{Name: "a", DataType: "int"},
+				{Name: "b", DataType: "int"},
+			},
+			Indexes: []vtschema.IndexColumn{
+				{Index: "PRIMARY", Seq: 1, Column: "id"},
+				{Index: "a_b", Seq: 1, Column: "a"},
+				{Index: "a_b", Seq: 2, Column: "b"},
+				{Index: "name", Seq: 1, Column: "name"},
+			},
+		},
+		"v1": {
+			Columns: []vtschema.ColumnDetails{{Name: "id", DataType: "bigint"}},
+			View:    true,
+		},
+	}}
+	emulateInformationSchema = true
+	defer func() { emulateInformationSchema = false }()
+	session := &vtgatepb.Session{TargetString: KsTestUnsharded}
+
+	tcases := []struct {
+		query string
+		rows  string
+	}{{
+		query: "select table_name, table_type from information_schema.tables where table_schema = database() order by table_name desc",
+		rows:  `[[VARCHAR("v1") VARCHAR("VIEW")] [VARCHAR("t1") VARCHAR("BASE TABLE")]]`,
+	}, {
+		query: "select COLUMN_NAME, ORDINAL_POSITION, CHARACTER_SET_NAME, COLUMN_KEY from INFORMATION_SCHEMA.COLUMNS where TABLE_SCHEMA = 'TestUnsharded' and TABLE_NAME = 't1'",
+		rows:  `[[VARCHAR("id") UINT64(1) NULL VARCHAR("PRI")] [VARCHAR("name") UINT64(2) VARCHAR("utf8mb4") VARCHAR("UNI")] [VARCHAR("a") UINT64(3) NULL VARCHAR("MUL")] [VARCHAR("b") UINT64(4) NULL VARCHAR("")]]`,
+	}, {
+		query: "select s.index_name, s.seq_in_index, s.column_name from information_schema.statistics s where s.table_schema = database() and s.non_unique = 0",
+		rows:  `[[VARCHAR("PRIMARY") UINT64(1) VARCHAR("id")] [VARCHAR("a_b") UINT64(1) VARCHAR("a")] [VARCHAR("a_b") UINT64(2) VARCHAR("b")] [VARCHAR("name") UINT64(1) VARCHAR("name")]]`,
+	}, {
+		query: "select constraint_name, column_name from information_schema.key_column_usage where table_schema = database() and table_name in ('t1', 'v1') limit 1",
+		rows:  `[[VARCHAR("PRIMARY") VARCHAR("id")]]`,
+	}}
+	for _, tcase := range tcases {
+		t.Run(tcase.query, func(t *testing.T) {
+			qr, err := executorExecSession(executor, tcase.query, nil, session)
+			require.NoError(t, err)
+			assert.Equal(t, tcase.rows, fmt.Sprintf("%v", qr.Rows))
+		})
+	}
+	assert.Zero(t, sbc1.ExecCount.Get()+sbc2.ExecCount.Get()+sbclookup.ExecCount.Get())
+
+	// A column the tracker doesn't know is passed through.
+	_, err := executorExecSession(executor, "select table_name, engine from information_schema.tables where table_schema = database()", nil, session)
+	require.NoError(t, err)
+	assert.NotZero(t, sbc1.ExecCount.Get()+sbc2.ExecCount.Get()+sbclookup.ExecCount.Get())
+}
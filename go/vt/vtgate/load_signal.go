@@ -0,0 +1,147 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+)
+
+// The load signals summarize the load of the cluster, as vtgate sees it, in
+// ratios between 0, idle, and 1, saturated, which an autoscaler can target to
+// add or remove vtgates and replicas. They are served by the admin API, and
+// exported as the LoadSignal* gauges, in percents, for the autoscalers which
+// read the metrics, like the Kubernetes HPA through a Prometheus adapter.
+
+var (
+	// loadSignalMaxQPS is the QPS a vtgate is sized for.
+	loadSignalMaxQPS float64
+	// loadSignalTabletPoolSize is the number of connections a tablet serves
+	// the queries with: the default sizes of its OLTP read pool and of its
+	// transaction pool.
+	loadSignalTabletPoolSize = 80
+
+	// qpsByDbType is the QPS of vtgate, by tablet type. It is set by Init.
+	qpsByDbType *stats.Rates
+)
+
+func registerLoadSignalFlags(fs *pflag.FlagSet) {
+	fs.Float64Var(&loadSignalMaxQPS, "load_signal_max_qps", loadSignalMaxQPS, "The QPS a vtgate is sized for, which the QPS headroom of the load signals is relative to. 0 reports no QPS headroom.")
+	fs.IntVar(&loadSignalTabletPoolSize, "load_signal_tablet_pool_size", loadSignalTabletPoolSize, "The number of connections a tablet serves the queries with, which the pool saturation of the load signals is relative to: the sum of its --queryserver-config-pool-size and --queryserver-config-transaction-cap.")
+}
+
+func init() {
+	servenv.OnParseFor("vtgate", registerLoadSignalFlags)
+}
+
+// initLoadSignals exports the load signals of the tablets of a gateway as
+// gauges.
+func initLoadSignals(gw *TabletGateway) {
+	labels := []string{"Keyspace", "ShardName", "TabletType"}
+	shardGauges := func(signal func(adminapi.ShardLoad) float64) func() map[string]int64 {
+		return func() map[string]int64 {
+			gauges := map[string]int64{}
+			for _, shard := range shardLoads(gw.TabletsCacheStatus(), "") {
+				gauges[strings.Join([]string{shard.Keyspace, shard.Shard, shard.TabletType}, ".")] = percent(signal(shard))
+			}
+			return gauges
+		}
+	}
+	stats.NewGaugeFunc("LoadSignalQPSHeadroom", "The QPS headroom of vtgate, in percent of --load_signal_max_qps", func() int64 {
+		return percent(vtgateLoad().QPSHeadroom)
+	})
+	stats.NewGaugesFuncWithMultiLabels("LoadSignalPoolSaturation", "The average saturation of the connection pools of the serving tablets, in percent", labels,
+		shardGauges(func(shard adminapi.ShardLoad) float64 { return shard.PoolSaturation }))
+	stats.NewGaugesFuncWithMultiLabels("LoadSignalReplicationLag", "The highest replication lag of the serving tablets, in percent of --discovery_low_replication_lag", labels,
+		shardGauges(func(shard adminapi.ShardLoad) float64 { return shard.ReplicationLag }))
+}
+
+// vtgateLoad returns the load of this vtgate.
+func vtgateLoad() adminapi.VTGateLoad {
+	load := adminapi.VTGateLoad{
+		MaxQPS:          loadSignalMaxQPS,
+		QPSHeadroom:     1,
+		BusyConnections: int64(atomic.LoadInt32(&busyConnections)),
+	}
+	if qpsByDbType != nil {
+		load.QPS = qpsByDbType.TotalRate()
+	}
+	if load.MaxQPS > 0 {
+		load.QPSHeadroom = math.Max(0, 1-load.QPS/load.MaxQPS)
+	}
+	return load
+}
+
+// shardLoads returns the load of the tablets of each type of each shard of a
+// keyspace, or of all the keyspaces if it is empty, by keyspace, shard and
+// tablet type. The tablets of all the cells are summed up.
+func shardLoads(statuses discovery.TabletsCacheStatusList, keyspace string) []adminapi.ShardLoad {
+	type shardKey struct {
+		keyspace, shard, tabletType string
+	}
+	loads := map[shardKey]*adminapi.ShardLoad{}
+	for _, status := range statuses {
+		if keyspace != "" && status.Target.Keyspace != keyspace {
+			continue
+		}
+		key := shardKey{status.Target.Keyspace, status.Target.Shard, strings.ToLower(status.Target.TabletType.String())}
+		load, ok := loads[key]
+		if !ok {
+			load = &adminapi.ShardLoad{Keyspace: key.keyspace, Shard: key.shard, TabletType: key.tabletType}
+			loads[key] = load
+		}
+		for _, th := range status.TabletsStats {
+			if !th.Serving || th.Stats == nil || th.LastError != nil {
+				continue
+			}
+			load.Tablets++
+			load.QPS += th.Stats.Qps
+			load.PoolSaturation += float64(th.Stats.TabletThreadsStats)
+			if th.Stats.ReplicationLagSeconds > load.ReplicationLagSeconds {
+				load.ReplicationLagSeconds = th.Stats.ReplicationLagSeconds
+			}
+		}
+	}
+
+	result := make([]adminapi.ShardLoad, 0, len(loads))
+	for _, load := range loads {
+		// A shard with no serving tablet is saturated.
+		inUse := load.PoolSaturation
+		load.PoolSaturation = 1
+		if load.Tablets > 0 && loadSignalTabletPoolSize > 0 {
+			load.PoolSaturation = math.Min(1, inUse/float64(load.Tablets*loadSignalTabletPoolSize))
+		}
+		if lowLag := discovery.GetLowReplicationLag().Seconds(); lowLag > 0 {
+			load.ReplicationLag = math.Min(1, float64(load.ReplicationLagSeconds)/lowLag)
+		}
+		result = append(result, *load)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Keyspace != b.Keyspace {
+			return a.Keyspace < b.Keyspace
+		}
+		if a.Shard != b.Shard {
+			return a.Shard < b.Shard
+		}
+		return a.TabletType < b.TabletType
+	})
+	return result
+}
+
+// percent converts a ratio to a percent.
+func percent(ratio float64) int64 {
+	return int64(math.Round(ratio * 100))
+}
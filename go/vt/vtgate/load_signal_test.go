@@ -0,0 +1,118 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestShardLoads(t *testing.T) {
+	defer func(size int) { loadSignalTabletPoolSize = size }(loadSignalTabletPoolSize)
+	loadSignalTabletPoolSize = 10
+	defer discovery.SetLowReplicationLag(discovery.GetLowReplicationLag())
+	discovery.SetLowReplicationLag(30 * time.Second)
+
+	tablet := func(serving bool, threads int64, lag uint32, qps float64) *discovery.TabletHealth {
+		return &discovery.TabletHealth{
+			Serving: serving,
+			Stats:   &querypb.RealtimeStats{TabletThreadsStats: threads, ReplicationLagSeconds: lag, Qps: qps},
+		}
+	}
+	target := func(keyspace, shard string, tabletType topodatapb.TabletType) *querypb.Target {
+		return &querypb.Target{Keyspace: keyspace, Shard: shard, TabletType: tabletType}
+	}
+	statuses := discovery.TabletsCacheStatusList{
+		{Cell: "aa", Target: target("ks", "0", topodatapb.TabletType_REPLICA), TabletsStats: discovery.TabletStatsList{tablet(true, 2, 1, 10), tablet(true, 6, 45, 20)}},
+		// The tablets of all the cells are summed up, and the ones which don't
+		// serve are ignored.
+		{Cell: "bb", Target: target("ks", "0", topodatapb.TabletType_REPLICA), TabletsStats: discovery.TabletStatsList{tablet(true, 4, 3, 30), tablet(false, 10, 100, 0)}},
+		{Cell: "aa", Target: target("ks", "1", topodatapb.TabletType_REPLICA), TabletsStats: discovery.TabletStatsList{tablet(true, 5, 15, 0)}},
+		{Cell: "aa", Target: target("ks", "0", topodatapb.TabletType_PRIMARY), TabletsStats: discovery.TabletStatsList{tablet(true, 20, 0, 100)}},
+		{Cell: "aa", Target: target("other", "0", topodatapb.TabletType_REPLICA), TabletsStats: discovery.TabletStatsList{tablet(false, 0, 0, 0)}},
+	}
+
+	assert.Equal(t, []adminapi.ShardLoad{{
+		Keyspace:       "ks",
+		Shard:          "0",
+		TabletType:     "primary",
+		Tablets:        1,
+		QPS:            100,
+		PoolSaturation: 1,
+	}, {
+		Keyspace:              "ks",
+		Shard:                 "0",
+		TabletType:            "replica",
+		Tablets:               3,
+		QPS:                   60,
+		PoolSaturation:        0.4,
+		ReplicationLagSeconds: 45,
+		ReplicationLag:        1,
+	}, {
+		Keyspace:              "ks",
+		Shard:                 "1",
+		TabletType:            "replica",
+		Tablets:               1,
+		PoolSaturation:        0.5,
+		ReplicationLagSeconds: 15,
+		ReplicationLag:        0.5,
+	}, {
+		// A shard with no serving tablet is saturated.
+		Keyspace:       "other",
+		Shard:          "0",
+		TabletType:     "replica",
+		PoolSaturation: 1,
+	}}, shardLoads(statuses, ""))
+
+	loads := shardLoads(statuses, "other")
+	require.Len(t, loads, 1)
+	assert.Equal(t, "other", loads[0].Keyspace)
+}
+
+func TestVTGateLoad(t *testing.T) {
+	defer func(maxQPS float64) { loadSignalMaxQPS = maxQPS }(loadSignalMaxQPS)
+	loadSignalMaxQPS = 0
+	assert.Equal(t, 1.0, vtgateLoad().QPSHeadroom)
+	loadSignalMaxQPS = 1000
+	assert.Equal(t, 1000.0, vtgateLoad().MaxQPS)
+	assert.LessOrEqual(t, vtgateLoad().QPSHeadroom, 1.0)
+	assert.Equal(t, int64(35), percent(0.354))
+}
+
+func TestAdminAPILoad(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	hcVTGateTest.AddTestTablet("aa", "1.1.1.2", 1002, KsTestDefaultShard, "0", topodatapb.TabletType_REPLICA, false, 0, errors.New("no connection"))
+	hcVTGateTest.AddTestTablet("aa", "1.1.1.3", 1003, "other", "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	defer hcVTGateTest.Reset()
+	handler := &adminAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	var load adminapi.Load
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "load", "", &load))
+	assert.Len(t, load.Shards, 3)
+
+	load = adminapi.Load{}
+	require.Equal(t, http.StatusOK, adminAPIRequestFor(t, handler, http.MethodGet, "load?keyspace="+KsTestDefaultShard, "", &load))
+	require.Len(t, load.Shards, 2)
+	assert.Equal(t, "primary", load.Shards[0].TabletType)
+	assert.Equal(t, 1, load.Shards[0].Tablets)
+	assert.Equal(t, "replica", load.Shards[1].TabletType)
+	assert.Equal(t, 0, load.Shards[1].Tablets)
+	assert.Equal(t, 1.0, load.Shards[1].PoolSaturation)
+}
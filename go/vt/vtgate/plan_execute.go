@@ -36,6 +36,7 @@ import (
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
 	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/sysvars"
 	"vitess.io/vitess/go/vt/vterrors"
 	"vitess.io/vitess/go/vt/vtgate/engine"
 )
@@ -103,7 +104,9 @@ func (e *Executor) newExecute(
 		return recResult(plan.Type, rst)
 	}
 
-	if plan.Type != sqlparser.StmtShow {
+	// Like SHOW WARNINGS, SELECT @@warning_count is a diagnostic statement
+	// which keeps the warnings of the previous one.
+	if plan.Type != sqlparser.StmtShow && !(plan.BindVarNeeds != nil && plan.BindVarNeeds.NeedsSysVar(sysvars.WarningCount.Name)) {
 		safeSession.ClearWarnings()
 	}
 
@@ -134,7 +137,12 @@ func (e *Executor) newExecute(
 			})
 	}
 
-	return execPlan(ctx, plan, vcursor, bindVars, execStart)
+	inReservedConn := safeSession.InReservedConn()
+	err = execPlan(ctx, plan, vcursor, bindVars, execStart)
+	if err == nil && plan.Type == sqlparser.StmtDDL {
+		e.trackTempTables(ctx, safeSession, vcursor.GetKeyspace(), stmt, inReservedConn)
+	}
+	return err
 }
 
 // handleTransactions deals with transactional queries: begin, commit, rollback and savepoint management
@@ -379,6 +387,9 @@ func GetSuggestedTabletType(safeSession *SafeSession, sql string) (topodatapb.Ta
 	if err != nil {
 		return topodatapb.TabletType_UNKNOWN, err
 	}
+	if safeSession.GetSnapshotReadGTID() != "" {
+		return snapshotReadTabletType(safeSession, sql, isReadOnlyTx, suggestedTabletType)
+	}
 
 	return suggestedTabletType, nil
 }
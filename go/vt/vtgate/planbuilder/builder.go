@@ -66,6 +66,8 @@ type (
 	planResult struct {
 		primitive engine.Primitive
 		tables    []string
+		// bindVarNeeds are the needs of rewrites made by the planner.
+		bindVarNeeds *sqlparser.BindVarNeeds
 	}
 
 	stmtPlanner func(sqlparser.Statement, *sqlparser.ReservedVars, plancontext.VSchema) (*planResult, error)
@@ -125,6 +127,12 @@ func BuildFromStmt(query string, stmt sqlparser.Statement, reservedVars *sqlpars
 	if planResult != nil {
 		primitive = planResult.primitive
 		tablesUsed = planResult.tables
+		if planResult.bindVarNeeds != nil {
+			if bindVarNeeds == nil {
+				bindVarNeeds = &sqlparser.BindVarNeeds{}
+			}
+			bindVarNeeds.MergeWith(planResult.bindVarNeeds)
+		}
 	}
 	plan := &engine.Plan{
 		Type:         sqlparser.ASTToStatementType(stmt),
@@ -200,6 +208,12 @@ func createInstructionFor(query string, stmt sqlparser.Statement, reservedVars *
 		return buildVStreamPlan(stmt, vschema)
 	case *sqlparser.Reload:
 		return buildReloadPlan(stmt, vschema)
+	case *sqlparser.ExportFilters:
+		return buildExportFiltersPlan(stmt)
+	case *sqlparser.ImportFilters:
+		return buildImportFiltersPlan(stmt)
+	case *sqlparser.ExplainFilter:
+		return buildExplainFilterPlan(stmt)
 
 	case *sqlparser.CommentOnly:
 		// There is only a comment in the input.
@@ -0,0 +1,35 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package planbuilder
+
+import (
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+)
+
+func buildExportFiltersPlan(stmt *sqlparser.ExportFilters) (*planResult, error) {
+	return newPlanResult(&engine.ExportFilters{
+		Database: stmt.Database.String(),
+		Format:   stmt.DocumentFormat,
+	}), nil
+}
+
+func buildImportFiltersPlan(stmt *sqlparser.ImportFilters) (*planResult, error) {
+	return newPlanResult(&engine.ImportFilters{
+		Database: stmt.Database.String(),
+		Document: stmt.Document,
+		Prune:    stmt.Prune,
+	}), nil
+}
+
+func buildExplainFilterPlan(stmt *sqlparser.ExplainFilter) (*planResult, error) {
+	return newPlanResult(&engine.ExplainFilter{
+		Query:    stmt.Query,
+		Database: stmt.Database.String(),
+		User:     stmt.User,
+		IP:       stmt.IP,
+	}), nil
+}
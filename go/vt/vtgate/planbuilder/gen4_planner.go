@@ -27,6 +27,7 @@ import (
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	"vitess.io/vitess/go/vt/sqlparser"
 	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/engine"
 	"vitess.io/vitess/go/vt/vtgate/planbuilder/operators"
 	"vitess.io/vitess/go/vt/vtgate/planbuilder/plancontext"
 	"vitess.io/vitess/go/vt/vtgate/semantics"
@@ -57,6 +58,18 @@ func gen4SelectStmtPlanner(
 			}
 			return newPlanResult(p, used), nil
 		}
+		// handle the virtual tables of wescale_schema for processing at vtgate.
+		p, err = handleWescaleSchemaSelects(sel, vschema)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return newPlanResult(p, engine.WescaleSchema+"."+p.GetTableName()), nil
+		}
+		// handle information_schema from the schema tracker, if it is emulated.
+		if plan := handleInformationSchemaSelects(sel, vschema); plan != nil {
+			return plan, nil
+		}
 		if sel.SQLCalcFoundRows && sel.Limit != nil {
 			return gen4planSQLCalcFoundRows(vschema, sel, query, reservedVars)
 		}
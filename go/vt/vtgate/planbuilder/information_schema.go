@@ -0,0 +1,52 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package planbuilder
+
+import (
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+	"vitess.io/vitess/go/vt/vtgate/planbuilder/plancontext"
+)
+
+// handleInformationSchemaSelects plans the selects from a single table of
+// information_schema that vtgate answers from the schema tracker, when that is
+// enabled. It returns nil for everything the tracker can't answer, like an
+// unknown column or a subquery, so that the select is passed through to a
+// tablet as before.
+func handleInformationSchemaSelects(sel *sqlparser.Select, vschema plancontext.VSchema) *planResult {
+	if !vschema.IsInformationSchemaEmulated() || sel.With != nil || sel.SQLCalcFoundRows {
+		return nil
+	}
+	if _, _, ok := virtualSchemaTable(sel, engine.InformationSchema); !ok {
+		return nil
+	}
+
+	// The normalizer only rewrites database() for dual, so it is rewritten
+	// here, on a copy of the select that is kept if it is passed through.
+	sel = sqlparser.CloneRefOfSelect(sel)
+	bindVarNeeds := &sqlparser.BindVarNeeds{}
+	sqlparser.SafeRewrite(sel, nil, func(cursor *sqlparser.Cursor) bool {
+		fn, ok := cursor.Node().(*sqlparser.FuncExpr)
+		if ok && len(fn.Exprs) == 0 && (fn.Name.EqualString("database") || fn.Name.EqualString("schema")) {
+			cursor.Replace(sqlparser.NewArgument(sqlparser.DBVarName))
+			bindVarNeeds.AddFuncResult(sqlparser.DBVarName)
+		}
+		return true
+	})
+
+	table, tableName, _ := virtualSchemaTable(sel, engine.InformationSchema)
+	fields, ok := engine.VirtualTableFields(engine.InformationSchema, tableName.Name.String())
+	if !ok {
+		return nil
+	}
+	plan, err := buildVirtualTableSelect(sel, table, tableName, engine.InformationSchema, fields, vschema)
+	if err != nil {
+		return nil
+	}
+	result := newPlanResult(plan, engine.InformationSchema+"."+plan.GetTableName())
+	result.bindVarNeeds = bindVarNeeds
+	return result
+}
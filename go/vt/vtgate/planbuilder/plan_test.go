@@ -665,6 +665,10 @@ func (vw *vschemaWrapper) IsViewsEnabled() bool {
 	return vw.enableViews
 }
 
+func (vw *vschemaWrapper) IsInformationSchemaEmulated() bool {
+	return false
+}
+
 type (
 	planTest struct {
 		Comment  string          `json:"comment,omitempty"`
@@ -68,6 +68,10 @@ type VSchema interface {
 
 	// IsViewsEnabled returns true if Vitess manages the views.
 	IsViewsEnabled() bool
+
+	// IsInformationSchemaEmulated returns true if vtgate answers the common
+	// information_schema tables from the schema tracker.
+	IsInformationSchemaEmulated() bool
 }
 
 // PlannerNameToVersion returns the numerical representation of the planner
@@ -137,7 +137,7 @@ func buildShowBasicPlan(show *sqlparser.ShowBasic, vschema plancontext.VSchema)
 		return buildPluginsPlan()
 	case sqlparser.Engines:
 		return buildEnginesPlan()
-	case sqlparser.VitessReplicationStatus, sqlparser.VitessShards, sqlparser.VitessTablets, sqlparser.VitessVariables, sqlparser.LastSeenGTID, sqlparser.Workload, sqlparser.TabletsPlans:
+	case sqlparser.VitessReplicationStatus, sqlparser.VitessShards, sqlparser.VitessTablets, sqlparser.VitessVariables, sqlparser.LastSeenGTID, sqlparser.Workload, sqlparser.TabletsPlans, sqlparser.FilterStats:
 		return &engine.ShowExec{
 			Command:    show.Command,
 			ShowFilter: show.Filter,
@@ -161,7 +161,7 @@ func buildShowVitessPlan(show *sqlparser.ShowBasic, vschema plancontext.VSchema)
 		return buildShowVMigrationsPlan(show, vschema)
 	case sqlparser.GtidExecGlobal:
 		return buildShowGtidPlan(show, vschema)
-	case sqlparser.VitessReplicationStatus, sqlparser.VitessShards, sqlparser.VitessTablets, sqlparser.VitessVariables, sqlparser.Workload, sqlparser.LastSeenGTID, sqlparser.FailPoints, sqlparser.TabletsPlans:
+	case sqlparser.VitessReplicationStatus, sqlparser.VitessShards, sqlparser.VitessTablets, sqlparser.VitessVariables, sqlparser.Workload, sqlparser.LastSeenGTID, sqlparser.FailPoints, sqlparser.TabletsPlans, sqlparser.FilterStats:
 		return &engine.ShowExec{
 			Command:    show.Command,
 			ShowFilter: show.Filter,
@@ -172,6 +172,10 @@ func buildShowVitessPlan(show *sqlparser.ShowBasic, vschema plancontext.VSchema)
 		return buildVschemaTablesPlan(vschema)
 	case sqlparser.VschemaVindexes:
 		return buildVschemaVindexesPlan(show, vschema)
+	case sqlparser.Warnings:
+		// The warnings are the ones of the session, which the tablets sent
+		// along with the results.
+		return buildWarnings()
 	default:
 		return nil, nil
 	}
@@ -651,8 +655,12 @@ func buildWarnings() (engine.Primitive, error) {
 		rows := make([][]sqltypes.Value, 0, len(warns))
 
 		for _, warn := range warns {
+			level := warn.Level
+			if level == "" {
+				level = "Warning"
+			}
 			rows = append(rows, []sqltypes.Value{
-				sqltypes.NewVarChar("Warning"),
+				sqltypes.NewVarChar(level),
 				sqltypes.NewUint32(warn.Code),
 				sqltypes.NewVarChar(warn.Message),
 			})
@@ -0,0 +1,200 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package planbuilder
+
+import (
+	"fmt"
+	"strings"
+
+	"vitess.io/vitess/go/mysql/collations"
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+	"vitess.io/vitess/go/vt/vtgate/planbuilder/plancontext"
+)
+
+// virtualTableLookup resolves the columns of a table answered by vtgate.
+type virtualTableLookup struct {
+	keyspace  string
+	table     sqlparser.TableName
+	alias     sqlparser.IdentifierCS
+	fields    []*querypb.Field
+	collation collations.ID
+}
+
+var _ evalengine.TranslationLookup = (*virtualTableLookup)(nil)
+
+func (vl *virtualTableLookup) ColumnLookup(col *sqlparser.ColName) (int, error) {
+	if !col.Qualifier.IsEmpty() {
+		matched := strings.EqualFold(col.Qualifier.Name.String(), vl.table.Name.String())
+		if !vl.alias.IsEmpty() {
+			matched = col.Qualifier.Name == vl.alias
+		}
+		if !matched || !(col.Qualifier.Qualifier.IsEmpty() || strings.EqualFold(col.Qualifier.Qualifier.String(), vl.keyspace)) {
+			return 0, vterrors.VT03019(sqlparser.String(col))
+		}
+	}
+	for i, field := range vl.fields {
+		if col.Name.EqualString(field.Name) {
+			return i, nil
+		}
+	}
+	return 0, vterrors.VT03022(col.Name.String(), vl.keyspace+"."+vl.table.Name.String())
+}
+
+func (vl *virtualTableLookup) CollationForExpr(expr sqlparser.Expr) collations.ID {
+	col, ok := expr.(*sqlparser.ColName)
+	if !ok {
+		return collations.Unknown
+	}
+	offset, err := vl.ColumnLookup(col)
+	if err != nil || !sqltypes.IsText(vl.fields[offset].Type) {
+		return collations.Unknown
+	}
+	return vl.collation
+}
+
+func (vl *virtualTableLookup) DefaultCollation() collations.ID {
+	return vl.collation
+}
+
+// virtualSchemaTable returns the table of a select from a single table of
+// the given database, if it is one.
+func virtualSchemaTable(sel *sqlparser.Select, keyspace string) (*sqlparser.AliasedTableExpr, sqlparser.TableName, bool) {
+	if len(sel.From) != 1 {
+		return nil, sqlparser.TableName{}, false
+	}
+	table, ok := sel.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return nil, sqlparser.TableName{}, false
+	}
+	tableName, ok := table.Expr.(sqlparser.TableName)
+	if !ok || !strings.EqualFold(tableName.Qualifier.String(), keyspace) {
+		return nil, sqlparser.TableName{}, false
+	}
+	return table, tableName, true
+}
+
+// handleWescaleSchemaSelects plans the selects from the virtual tables of the
+// wescale_schema database, which are answered by vtgate itself.
+func handleWescaleSchemaSelects(sel *sqlparser.Select, vschema plancontext.VSchema) (engine.Primitive, error) {
+	table, tableName, ok := virtualSchemaTable(sel, engine.WescaleSchema)
+	if !ok {
+		return nil, nil
+	}
+	fields, ok := engine.VirtualTableFields(engine.WescaleSchema, tableName.Name.String())
+	if !ok {
+		return nil, vterrors.VT05005(tableName.Name.String(), engine.WescaleSchema)
+	}
+	return buildVirtualTableSelect(sel, table, tableName, engine.WescaleSchema, fields, vschema)
+}
+
+// buildVirtualTableSelect plans the select of a table answered by vtgate. The
+// rows are filtered, sorted, projected and limited in memory, so only the
+// select of a single table without grouping is supported.
+func buildVirtualTableSelect(sel *sqlparser.Select, table *sqlparser.AliasedTableExpr, tableName sqlparser.TableName, keyspace string, fields []*querypb.Field, vschema plancontext.VSchema) (engine.Primitive, error) {
+	if sel.GroupBy != nil || sel.Having != nil || sel.Distinct || sel.Into != nil || sel.Lock != sqlparser.NoLock {
+		return nil, vterrors.VT12001(fmt.Sprintf("%s on %s tables", sqlparser.String(sel), keyspace))
+	}
+	lookup := &virtualTableLookup{
+		keyspace:  keyspace,
+		table:     tableName,
+		alias:     table.As,
+		fields:    fields,
+		collation: vschema.ConnCollation(),
+	}
+
+	var plan engine.Primitive = &engine.VirtualTable{Keyspace: keyspace, Name: strings.ToLower(tableName.Name.String())}
+	if sel.Where != nil {
+		predicate, err := evalengine.Translate(sel.Where.Expr, lookup)
+		if err != nil {
+			return nil, err
+		}
+		plan = &engine.Filter{Predicate: predicate, ASTPredicate: sel.Where.Expr, Input: plan}
+	}
+
+	projection := &engine.Projection{}
+	aliases := make(map[string]sqlparser.Expr)
+	for _, selectExpr := range sel.SelectExprs {
+		switch selectExpr := selectExpr.(type) {
+		case *sqlparser.StarExpr:
+			for _, field := range fields {
+				expr, err := evalengine.Translate(sqlparser.NewColName(field.Name), lookup)
+				if err != nil {
+					return nil, err
+				}
+				projection.Cols = append(projection.Cols, field.Name)
+				projection.Exprs = append(projection.Exprs, expr)
+			}
+		case *sqlparser.AliasedExpr:
+			expr, err := evalengine.Translate(selectExpr.Expr, lookup)
+			if err != nil {
+				return nil, err
+			}
+			col := selectExpr.As.String()
+			if col == "" {
+				col = sqlparser.String(selectExpr.Expr)
+				if colName, ok := selectExpr.Expr.(*sqlparser.ColName); ok {
+					col = colName.Name.String()
+				}
+			} else {
+				aliases[selectExpr.As.Lowered()] = selectExpr.Expr
+			}
+			projection.Cols = append(projection.Cols, col)
+			projection.Exprs = append(projection.Exprs, expr)
+		default:
+			return nil, vterrors.VT12001(fmt.Sprintf("%s on %s tables", sqlparser.String(selectExpr), keyspace))
+		}
+	}
+
+	if len(sel.OrderBy) > 0 {
+		memorySort := &engine.MemorySort{Input: plan}
+		for _, order := range sel.OrderBy {
+			expr := order.Expr
+			if colName, ok := expr.(*sqlparser.ColName); ok && colName.Qualifier.IsEmpty() {
+				if aliased, ok := aliases[colName.Name.Lowered()]; ok {
+					expr = aliased
+				}
+			}
+			colName, ok := expr.(*sqlparser.ColName)
+			if !ok {
+				return nil, vterrors.VT12001(fmt.Sprintf("ORDER BY %s on %s tables", sqlparser.String(order.Expr), keyspace))
+			}
+			offset, err := lookup.ColumnLookup(colName)
+			if err != nil {
+				return nil, err
+			}
+			memorySort.OrderBy = append(memorySort.OrderBy, engine.OrderByParams{
+				Col:               offset,
+				WeightStringCol:   -1,
+				Desc:              order.Direction == sqlparser.DescOrder,
+				StarColFixedIndex: offset,
+				CollationID:       lookup.CollationForExpr(colName),
+			})
+		}
+		plan = memorySort
+	}
+	projection.Input = plan
+	plan = projection
+
+	if sel.Limit != nil {
+		limit := &engine.Limit{Input: plan}
+		var err error
+		if limit.Count, err = evalengine.Translate(sel.Limit.Rowcount, nil); err != nil {
+			return nil, err
+		}
+		if sel.Limit.Offset != nil {
+			if limit.Offset, err = evalengine.Translate(sel.Limit.Offset, nil); err != nil {
+				return nil, err
+			}
+		}
+		plan = limit
+	}
+	return plan, nil
+}
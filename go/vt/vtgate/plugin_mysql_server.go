@@ -64,6 +64,8 @@ var (
 	mysqlAuthServerImpl               = "static"
 	mysqlAllowClearTextWithoutTLS     bool
 	mysqlProxyProtocol                bool
+	mysqlProxyProtocolTrustedCIDRs    []string
+	mysqlProxyProtocolHeaderTimeout   time.Duration
 	mysqlServerRequireSecureTransport bool
 	mysqlSslCert                      string
 	mysqlSslKey                       string
@@ -90,8 +92,10 @@ func registerPluginFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&mysqlServerSocketPath, "mysql_server_socket_path", mysqlServerSocketPath, "This option specifies the Unix socket file to use when listening for local connections. By default it will be empty and it won't listen to a unix socket")
 	fs.StringVar(&mysqlTCPVersion, "mysql_tcp_version", mysqlTCPVersion, "Select tcp, tcp4, or tcp6 to control the socket type.")
 	fs.StringVar(&mysqlAuthServerImpl, "mysql_auth_server_impl", mysqlAuthServerImpl, "Which auth server implementation to use. Options: none, ldap, clientcert, static, vault.")
-	fs.BoolVar(&mysqlAllowClearTextWithoutTLS, "mysql_allow_clear_text_without_tls", mysqlAllowClearTextWithoutTLS, "If set, the server will allow the use of a clear text password over non-SSL connections.")
+	fs.BoolVar(&mysqlAllowClearTextWithoutTLS, "mysql_allow_clear_text_without_tls", mysqlAllowClearTextWithoutTLS, "If set, the server will allow the use of a clear text password over non-SSL connections, of the MySQL and the PostgreSQL protocols.")
 	fs.BoolVar(&mysqlProxyProtocol, "proxy_protocol", mysqlProxyProtocol, "Enable HAProxy PROXY protocol on MySQL listener socket")
+	fs.StringSliceVar(&mysqlProxyProtocolTrustedCIDRs, "proxy_protocol_trusted_cidrs", mysqlProxyProtocolTrustedCIDRs, "Comma-separated networks or addresses of the load balancers allowed to send PROXY protocol headers. If empty, any peer may send one.")
+	fs.DurationVar(&mysqlProxyProtocolHeaderTimeout, "proxy_protocol_header_timeout", mysqlProxyProtocolHeaderTimeout, "How long to wait for the PROXY protocol header of a connection. If 0, it defaults to 200ms.")
 	fs.BoolVar(&mysqlServerRequireSecureTransport, "mysql_server_require_secure_transport", mysqlServerRequireSecureTransport, "Reject insecure connections but only if mysql_server_ssl_cert and mysql_server_ssl_key are provided")
 	fs.StringVar(&mysqlSslCert, "mysql_server_ssl_cert", mysqlSslCert, "Path to the ssl cert for mysql server plugin SSL")
 	fs.StringVar(&mysqlSslKey, "mysql_server_ssl_key", mysqlSslKey, "Path to ssl key for mysql server plugin SSL")
@@ -114,20 +118,20 @@ type vtgateHandler struct {
 	mu sync.Mutex
 
 	vtg         *VTGate
-	connections map[*mysql.Conn]bool
+	connections map[*mysql.Conn]*connectionInfo
 }
 
 func newVtgateHandler(vtg *VTGate) *vtgateHandler {
 	return &vtgateHandler{
 		vtg:         vtg,
-		connections: make(map[*mysql.Conn]bool),
+		connections: make(map[*mysql.Conn]*connectionInfo),
 	}
 }
 
 func (vh *vtgateHandler) NewConnection(c *mysql.Conn) {
 	vh.mu.Lock()
 	defer vh.mu.Unlock()
-	vh.connections[c] = true
+	vh.connections[c] = &connectionInfo{since: time.Now()}
 }
 
 func (vh *vtgateHandler) numConnections() int {
@@ -230,7 +234,7 @@ func (vh *vtgateHandler) ComQuery(c *mysql.Conn, query string, callback func(*sq
 	ef := callerid.NewEffectiveCallerID(
 		c.User,                  /* principal: who */
 		c.RemoteAddr().String(), /* component: running client process */
-		"VTGate MySQL Connector" /* subcomponent: part of the client */)
+		workloadSubcomponent(c) /* subcomponent: part of the client */)
 	ctx = callerid.NewContext(ctx, ef, im)
 
 	session := vh.session(c)
@@ -242,6 +246,8 @@ func (vh *vtgateHandler) ComQuery(c *mysql.Conn, query string, callback func(*sq
 			atomic.AddInt32(&busyConnections, -1)
 		}
 	}()
+	vh.startCommand(c, query, session)
+	defer func() { vh.endCommand(c, session) }()
 
 	if session.Options.Workload == querypb.ExecuteOptions_OLAP {
 		err := vh.vtg.StreamExecute(ctx, session, query, make(map[string]*querypb.BindVariable), callback)
@@ -256,6 +262,37 @@ func (vh *vtgateHandler) ComQuery(c *mysql.Conn, query string, callback func(*sq
 	return callback(result)
 }
 
+// ComQueryPipeline is part of the mysql.PipelineHandler interface.
+func (vh *vtgateHandler) ComQueryPipeline(c *mysql.Conn, queries []string) ([]*sqltypes.Result, error) {
+	session := vh.session(c)
+	if !enableTransactionPipelining || !session.InTransaction || session.Options.Workload == querypb.ExecuteOptions_OLAP {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	if mysqlQueryTimeout != 0 {
+		ctx, cancel = context.WithTimeout(ctx, mysqlQueryTimeout)
+		defer cancel()
+	}
+	ctx = callinfo.MysqlCallInfo(ctx, c)
+
+	// See ComQuery.
+	im := c.UserData.Get()
+	ef := callerid.NewEffectiveCallerID(
+		c.User,                  /* principal: who */
+		c.RemoteAddr().String(), /* component: running client process */
+		workloadSubcomponent(c) /* subcomponent: part of the client */)
+	ctx = callerid.NewContext(ctx, ef, im)
+
+	vh.startCommand(c, strings.Join(queries, ";"), session)
+	defer func() { vh.endCommand(c, session) }()
+
+	results, err := vh.vtg.ExecutePipeline(ctx, session, queries)
+	fillInTxStatusFlags(c, session)
+	return results, mysql.NewSQLErrorFromError(err)
+}
+
 func fillInTxStatusFlags(c *mysql.Conn, session *vtgatepb.Session) {
 	if session.InTransaction {
 		c.StatusFlags |= mysql.ServerStatusInTrans
@@ -291,7 +328,7 @@ func (vh *vtgateHandler) ComPrepare(c *mysql.Conn, query string, bindVars map[st
 	ef := callerid.NewEffectiveCallerID(
 		c.User,                  /* principal: who */
 		c.RemoteAddr().String(), /* component: running client process */
-		"VTGate MySQL Connector" /* subcomponent: part of the client */)
+		workloadSubcomponent(c) /* subcomponent: part of the client */)
 	ctx = callerid.NewContext(ctx, ef, im)
 
 	session := vh.session(c)
@@ -303,6 +340,8 @@ func (vh *vtgateHandler) ComPrepare(c *mysql.Conn, query string, bindVars map[st
 			atomic.AddInt32(&busyConnections, -1)
 		}
 	}()
+	vh.startCommand(c, query, session)
+	defer func() { vh.endCommand(c, session) }()
 
 	session, fld, err := vh.vtg.Prepare(ctx, session, query, bindVars)
 	err = mysql.NewSQLErrorFromError(err)
@@ -333,7 +372,7 @@ func (vh *vtgateHandler) ComStmtExecute(c *mysql.Conn, prepare *mysql.PrepareDat
 	ef := callerid.NewEffectiveCallerID(
 		c.User,                  /* principal: who */
 		c.RemoteAddr().String(), /* component: running client process */
-		"VTGate MySQL Connector" /* subcomponent: part of the client */)
+		workloadSubcomponent(c) /* subcomponent: part of the client */)
 	ctx = callerid.NewContext(ctx, ef, im)
 
 	session := vh.session(c)
@@ -345,12 +384,15 @@ func (vh *vtgateHandler) ComStmtExecute(c *mysql.Conn, prepare *mysql.PrepareDat
 			atomic.AddInt32(&busyConnections, -1)
 		}
 	}()
+	vh.startCommand(c, prepare.PrepareStmt, session)
+	defer func() { vh.endCommand(c, session) }()
 
+	query, bindVars := preparedQuery(prepare, normalizeQueries)
 	if session.Options.Workload == querypb.ExecuteOptions_OLAP {
-		err := vh.vtg.StreamExecute(ctx, session, prepare.PrepareStmt, prepare.BindVars, callback)
+		err := vh.vtg.StreamExecute(ctx, session, query, bindVars, callback)
 		return mysql.NewSQLErrorFromError(err)
 	}
-	_, qr, err := vh.vtg.Execute(ctx, session, prepare.PrepareStmt, prepare.BindVars)
+	_, qr, err := vh.vtg.Execute(ctx, session, query, bindVars)
 	if err != nil {
 		err = mysql.NewSQLErrorFromError(err)
 		return err
@@ -360,6 +402,28 @@ func (vh *vtgateHandler) ComStmtExecute(c *mysql.Conn, prepare *mysql.PrepareDat
 	return callback(qr)
 }
 
+// preparedQuery returns the query and the bind variables a prepared statement
+// is executed with. If the queries are normalized, the params of the statement
+// are bound into it, so that it is normalized like the same query sent with the
+// text protocol and the filters match it on the same query and the same bind
+// variables. Otherwise, or if the params can't be bound, the statement is
+// executed with its params, named v1 to vN.
+func preparedQuery(prepare *mysql.PrepareData, normalize bool) (string, map[string]*querypb.BindVariable) {
+	if !normalize || len(prepare.BindVars) == 0 {
+		return prepare.PrepareStmt, prepare.BindVars
+	}
+	query, comments := sqlparser.SplitMarginComments(prepare.PrepareStmt)
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return prepare.PrepareStmt, prepare.BindVars
+	}
+	bound, err := sqlparser.NewParsedQuery(stmt).GenerateQuery(prepare.BindVars, nil)
+	if err != nil {
+		return prepare.PrepareStmt, prepare.BindVars
+	}
+	return comments.Leading + bound + comments.Trailing, map[string]*querypb.BindVariable{}
+}
+
 func (vh *vtgateHandler) WarningCount(c *mysql.Conn) uint16 {
 	return uint16(len(vh.session(c).GetWarnings()))
 }
@@ -382,38 +446,48 @@ func (vh *vtgateHandler) ComBinlogDumpGTID(_ *mysql.Conn, _ string, _ uint64, _
 func (vh *vtgateHandler) session(c *mysql.Conn) *vtgatepb.Session {
 	session, _ := c.ClientData.(*vtgatepb.Session)
 	if session == nil {
-		u, _ := uuid.NewUUID()
-		session = &vtgatepb.Session{
-			Options: &querypb.ExecuteOptions{
-				IncludedFields: querypb.ExecuteOptions_ALL,
-				Workload:       querypb.ExecuteOptions_Workload(mysqlDefaultWorkload),
-
-				// The collation field of ExecuteOption is set right before an execution.
-			},
-			Autocommit:               true,
-			DDLStrategy:              defaultDDLStrategy,
-			SessionUUID:              u.String(),
-			EnableSystemSettings:     sysVarSetEnabled,
-			ReadWriteSplittingPolicy: defaultReadWriteSplittingPolicy,
-			ReadWriteSplittingRatio:  int32(defaultReadWriteSplittingRatio),
-			ReadAfterWrite: &vtgatepb.ReadAfterWrite{
-				ReadAfterWriteConsistency: ConvertReadAfterWriteConsistency(defaultReadAfterWriteConsistencyName),
-				ReadAfterWriteTimeout:     defaultReadAfterWriteTimeout,
-			},
-			RewriteTableNameWithDbNamePrefix:      defaultRewriteTableNameWithDbNamePrefix,
-			ReadWriteSplitForReadOnlyTxnUserInput: defaultReadWriteSplitForReadOnlyTxnUserInput,
-			EnableInterceptionForDMLWithoutWhere:  defaultEnableInterceptionForDMLWithoutWhere,
-			EnableDisplaySQLExecutionVTTabletType: defaultEnableDisplaySQLExecutionVTTablet,
-			ResolverOptions:                       &vtgatepb.ResolverOptions{ReadWriteSplittingRatio: int32(defaultReadWriteSplittingRatio), KeyspaceTabletType: topodatapb.TabletType_UNKNOWN, UserHintTabletType: topodatapb.TabletType_UNKNOWN, SuggestedTabletType: topodatapb.TabletType_UNKNOWN},
-		}
+		session = newSession()
 		if c.Capabilities&mysql.CapabilityClientFoundRows != 0 {
 			session.Options.ClientFoundRows = true
 		}
+		if class := classifyWorkload(c.Attributes); class != nil {
+			class.apply(session)
+			workloadClassSessions.Add(class.Name, 1)
+		}
 		c.ClientData = session
 	}
 	return session
 }
 
+// newSession returns a new session of a client connection, with the
+// defaults of the flags.
+func newSession() *vtgatepb.Session {
+	u, _ := uuid.NewUUID()
+	return &vtgatepb.Session{
+		Options: &querypb.ExecuteOptions{
+			IncludedFields: querypb.ExecuteOptions_ALL,
+			Workload:       querypb.ExecuteOptions_Workload(mysqlDefaultWorkload),
+
+			// The collation field of ExecuteOption is set right before an execution.
+		},
+		Autocommit:               true,
+		DDLStrategy:              defaultDDLStrategy,
+		SessionUUID:              u.String(),
+		EnableSystemSettings:     sysVarSetEnabled,
+		ReadWriteSplittingPolicy: defaultReadWriteSplittingPolicy,
+		ReadWriteSplittingRatio:  int32(defaultReadWriteSplittingRatio),
+		ReadAfterWrite: &vtgatepb.ReadAfterWrite{
+			ReadAfterWriteConsistency: ConvertReadAfterWriteConsistency(defaultReadAfterWriteConsistencyName),
+			ReadAfterWriteTimeout:     defaultReadAfterWriteTimeout,
+		},
+		RewriteTableNameWithDbNamePrefix:      defaultRewriteTableNameWithDbNamePrefix,
+		ReadWriteSplitForReadOnlyTxnUserInput: defaultReadWriteSplitForReadOnlyTxnUserInput,
+		EnableInterceptionForDMLWithoutWhere:  defaultEnableInterceptionForDMLWithoutWhere,
+		EnableDisplaySQLExecutionVTTabletType: defaultEnableDisplaySQLExecutionVTTablet,
+		ResolverOptions:                       &vtgatepb.ResolverOptions{ReadWriteSplittingRatio: int32(defaultReadWriteSplittingRatio), KeyspaceTabletType: topodatapb.TabletType_UNKNOWN, UserHintTabletType: topodatapb.TabletType_UNKNOWN, SuggestedTabletType: topodatapb.TabletType_UNKNOWN},
+	}
+}
+
 var mysqlListener *mysql.Listener
 var mysqlUnixListener *mysql.Listener
 var sigChan chan os.Signal
@@ -493,17 +567,11 @@ func initMySQLProtocol() {
 	// Create a Listener.
 	var err error
 	vtgateHandle = newVtgateHandler(rpcVTGate)
+	if idleSessionReaperEnabled() {
+		go vtgateHandle.runIdleSessionReaper()
+	}
 	if mysqlServerPort >= 0 {
-		mysqlListener, err = mysql.NewListener(
-			mysqlTCPVersion,
-			net.JoinHostPort(mysqlServerBindAddress, fmt.Sprintf("%v", mysqlServerPort)),
-			authServer,
-			vtgateHandle,
-			mysqlConnReadTimeout,
-			mysqlConnWriteTimeout,
-			mysqlProxyProtocol,
-			mysqlConnBufferPooling,
-		)
+		mysqlListener, err = newMysqlTCPListener(net.JoinHostPort(mysqlServerBindAddress, fmt.Sprintf("%v", mysqlServerPort)), authServer, vtgateHandle)
 		if err != nil {
 			log.Exitf("mysql.NewListener failed: %v", err)
 		}
@@ -541,6 +609,24 @@ func initMySQLProtocol() {
 	}
 }
 
+// newMysqlTCPListener listens to the MySQL protocol on a TCP address,
+// accepting PROXY protocol headers if it is enabled.
+func newMysqlTCPListener(address string, authServer mysql.AuthServer, handler mysql.Handler) (*mysql.Listener, error) {
+	listener, err := net.Listen(mysqlTCPVersion, address)
+	if err != nil {
+		return nil, err
+	}
+	if mysqlProxyProtocol {
+		proxyListener, err := mysql.NewProxyProtocolListener(listener, mysqlProxyProtocolTrustedCIDRs, mysqlProxyProtocolHeaderTimeout)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		listener = proxyListener
+	}
+	return mysql.NewFromListener(listener, authServer, handler, mysqlConnReadTimeout, mysqlConnWriteTimeout, mysqlConnBufferPooling)
+}
+
 // newMysqlUnixSocket creates a new unix socket mysql listener. If a socket file already exists, attempts
 // to clean it up.
 func newMysqlUnixSocket(address string, authServer mysql.AuthServer, handler mysql.Handler) (*mysql.Listener, error) {
@@ -675,3 +761,23 @@ var pluginInitializers []func()
 func RegisterPluginInitializer(initializer func()) {
 	pluginInitializers = append(pluginInitializers, initializer)
 }
+
+var pluginsWithoutMySQLProtocolOnce sync.Once
+
+// initPluginsWithoutMySQLProtocol does what initMySQLProtocol initializes
+// for the other protocols, when it returned early because the MySQL
+// protocol is disabled.
+func initPluginsWithoutMySQLProtocol() {
+	if mysqlServerPort >= 0 || mysqlServerSocketPath != "" {
+		return
+	}
+	pluginsWithoutMySQLProtocolOnce.Do(func() {
+		for _, initFn := range pluginInitializers {
+			initFn()
+		}
+		var ok bool
+		if mysqlDefaultWorkload, ok = querypb.ExecuteOptions_Workload_value[strings.ToUpper(mysqlDefaultWorkloadName)]; !ok {
+			log.Exitf("-mysql_default_workload must be one of [OLTP, OLAP, DBA, UNSPECIFIED]")
+		}
+	})
+}
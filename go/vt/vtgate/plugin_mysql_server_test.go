@@ -33,11 +33,13 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"vitess.io/vitess/go/trace"
 
 	"vitess.io/vitess/go/mysql"
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/test/utils"
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	"vitess.io/vitess/go/vt/tlstest"
 )
@@ -264,6 +266,46 @@ func TestDefaultWorkloadOLAP(t *testing.T) {
 	}
 }
 
+func TestPreparedQuery(t *testing.T) {
+	prepare := &mysql.PrepareData{
+		PrepareStmt: "/* leading */ select * from t where id = ? and name = ? and created > ? /* trailing */",
+		BindVars: map[string]*querypb.BindVariable{
+			"v1": sqltypes.Int64BindVariable(1),
+			"v2": sqltypes.StringBindVariable("it's"),
+			"v3": sqltypes.ValueBindVariable(sqltypes.MakeTrusted(sqltypes.Datetime, []byte("2024-01-01 00:00:00"))),
+		},
+	}
+	// The params are bound like the literals of the text protocol.
+	query, bindVars := preparedQuery(prepare, true)
+	assert.Equal(t, "/* leading */ select * from t where id = 1 and `name` = 'it\\'s' and created > '2024-01-01 00:00:00' /* trailing */", query)
+	assert.Empty(t, bindVars)
+
+	query, bindVars = preparedQuery(prepare, false)
+	assert.Equal(t, prepare.PrepareStmt, query)
+	assert.Equal(t, prepare.BindVars, bindVars)
+
+	// The tablets get the same query and bind variables as for the text
+	// protocol, which the filters match.
+	executor, _, _, lookup := createExecutorEnv()
+	executor.normalize = true
+	_, err := executorExec(executor, "select id from user where id = 1 and name = 'it''s'", nil)
+	require.NoError(t, err)
+	query, bindVars = preparedQuery(&mysql.PrepareData{
+		PrepareStmt: "select id from user where id = ? and name = ?",
+		BindVars:    map[string]*querypb.BindVariable{"v1": sqltypes.Int64BindVariable(1), "v2": sqltypes.StringBindVariable("it's")},
+	}, true)
+	_, err = executorExec(executor, query, bindVars)
+	require.NoError(t, err)
+	require.Len(t, lookup.Queries, 2)
+	utils.MustMatch(t, lookup.Queries[0], lookup.Queries[1])
+
+	// A param the client didn't send is left to the executor.
+	delete(prepare.BindVars, "v3")
+	query, bindVars = preparedQuery(prepare, true)
+	assert.Equal(t, prepare.PrepareStmt, query)
+	assert.Equal(t, prepare.BindVars, bindVars)
+}
+
 func TestInitTLSConfigWithoutServerCA(t *testing.T) {
 	testInitTLSConfig(t, false)
 }
@@ -0,0 +1,141 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/mysqlx"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/servenv"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+)
+
+var (
+	mysqlxServerPort        = -1
+	mysqlxServerBindAddress string
+)
+
+func registerMysqlxPluginFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&mysqlxServerPort, "mysqlx_server_port", mysqlxServerPort, "(Experimental) If set, also listen for MySQL X Protocol connections on this port.")
+	fs.StringVar(&mysqlxServerBindAddress, "mysqlx_server_bind_address", mysqlxServerBindAddress, "Binds on this address when listening to the MySQL X Protocol.")
+}
+
+// mysqlxHandler implements mysqlx.Handler. The session of a connection is
+// its ClientData.
+type mysqlxHandler struct {
+	vtg *VTGate
+}
+
+func (xh *mysqlxHandler) session(c *mysqlx.Conn) *vtgatepb.Session {
+	session, _ := c.ClientData.(*vtgatepb.Session)
+	if session == nil {
+		session = newSession()
+		if c.SchemaName != "" {
+			session.TargetString = c.SchemaName
+		}
+		c.ClientData = session
+	}
+	return session
+}
+
+// NewConnection is part of the mysqlx.Handler interface.
+func (xh *mysqlxHandler) NewConnection(c *mysqlx.Conn) {
+}
+
+// ConnectionClosed is part of the mysqlx.Handler interface. It rolls back
+// the open transaction, if any.
+func (xh *mysqlxHandler) ConnectionClosed(c *mysqlx.Conn) {
+	ctx, cancel := xh.context(c)
+	defer cancel()
+	session := xh.session(c)
+	if session.InTransaction {
+		defer atomic.AddInt32(&busyConnections, -1)
+	}
+	_ = xh.vtg.CloseSession(ctx, session)
+}
+
+// Execute is part of the mysqlx.Handler interface.
+func (xh *mysqlxHandler) Execute(c *mysqlx.Conn, query string, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	ctx, cancel := xh.context(c)
+	defer cancel()
+
+	session := xh.session(c)
+	if !session.InTransaction {
+		atomic.AddInt32(&busyConnections, 1)
+	}
+	defer func() {
+		if !session.InTransaction {
+			atomic.AddInt32(&busyConnections, -1)
+		}
+	}()
+
+	if bindVars == nil {
+		bindVars = make(map[string]*querypb.BindVariable)
+	}
+	_, result, err := xh.vtg.Execute(ctx, session, query, bindVars)
+	return result, mysql.NewSQLErrorFromError(err)
+}
+
+// context returns the context of a call, with the caller IDs of the
+// connection, see vtgateHandler.ComQuery.
+func (xh *mysqlxHandler) context(c *mysqlx.Conn) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if mysqlQueryTimeout != 0 {
+		ctx, cancel = context.WithTimeout(ctx, mysqlQueryTimeout)
+	}
+	var im *querypb.VTGateCallerID
+	if c.UserData != nil {
+		im = c.UserData.Get()
+	}
+	ef := callerid.NewEffectiveCallerID(
+		c.User,                  /* principal: who */
+		c.RemoteAddr().String(), /* component: running client process */
+		"VTGate X Protocol Connector" /* subcomponent: part of the client */)
+	return callerid.NewContext(ctx, ef, im), cancel
+}
+
+var mysqlxListener *mysqlx.Listener
+
+// initMysqlxProtocol starts the X Protocol listener, if it is enabled.
+func initMysqlxProtocol() {
+	if mysqlxServerPort < 0 || rpcVTGate == nil {
+		return
+	}
+	initPluginsWithoutMySQLProtocol()
+	var err error
+	mysqlxListener, err = mysqlx.NewListener(mysqlTCPVersion, net.JoinHostPort(mysqlxServerBindAddress, strconv.Itoa(mysqlxServerPort)), mysql.GetAuthServer(mysqlAuthServerImpl), &mysqlxHandler{vtg: rpcVTGate})
+	if err != nil {
+		log.Exitf("mysqlx.NewListener failed: %v", err)
+	}
+	mysqlxListener.AllowClearTextWithoutTLS = mysqlAllowClearTextWithoutTLS
+	go mysqlxListener.Accept()
+}
+
+func shutdownMysqlxProtocol() {
+	if mysqlxListener != nil {
+		mysqlxListener.Close()
+		mysqlxListener = nil
+	}
+}
+
+func init() {
+	servenv.OnParseFor("vtgate", registerMysqlxPluginFlags)
+	servenv.OnParseFor("vtcombo", registerMysqlxPluginFlags)
+
+	servenv.OnRun(initMysqlxProtocol)
+	servenv.OnTermSync(shutdownMysqlxProtocol)
+}
@@ -0,0 +1,235 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/pgwire"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttls"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+var (
+	pgServerPort        = -1
+	pgServerBindAddress string
+)
+
+func registerPgPluginFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&pgServerPort, "pg_server_port", pgServerPort, "(Experimental) If set, also listen for PostgreSQL wire protocol connections on this port. The connections are encrypted with the --mysql_server_ssl_* config, and the cleartext passwords of the unencrypted ones are refused unless --mysql_allow_clear_text_without_tls is set or the auth server is none.")
+	fs.StringVar(&pgServerBindAddress, "pg_server_bind_address", pgServerBindAddress, "Binds on this address when listening to the PostgreSQL wire protocol.")
+}
+
+// pgHandler implements pgwire.Handler. It keeps the state of a connection
+// in its ClientData.
+type pgHandler struct {
+	vtg        *VTGate
+	authServer mysql.AuthServer
+}
+
+type pgConnState struct {
+	session  *vtgatepb.Session
+	userData mysql.Getter
+}
+
+func (ph *pgHandler) state(c *pgwire.Conn) *pgConnState {
+	state, _ := c.ClientData.(*pgConnState)
+	if state == nil {
+		state = &pgConnState{session: newSession()}
+		c.ClientData = state
+	}
+	return state
+}
+
+// Authenticate is part of the pgwire.Handler interface. The clients send
+// cleartext passwords, so only the auth servers which check those are
+// supported.
+func (ph *pgHandler) Authenticate(c *pgwire.Conn, password string) error {
+	state := ph.state(c)
+	switch authServer := ph.authServer.(type) {
+	case *mysql.AuthServerNone:
+		state.userData = &mysql.NoneGetter{}
+	case mysql.PlainTextStorage:
+		userData, err := authServer.UserEntryWithPassword(nil, c.User, password, c.RemoteAddr())
+		if err != nil {
+			return err
+		}
+		state.userData = userData
+	default:
+		return vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "auth server %s doesn't support cleartext passwords", mysqlAuthServerImpl)
+	}
+	if database := c.Params["database"]; database != "" {
+		state.session.TargetString = database
+	}
+	return nil
+}
+
+// NewConnection is part of the pgwire.Handler interface.
+func (ph *pgHandler) NewConnection(c *pgwire.Conn) {
+}
+
+// ConnectionClosed is part of the pgwire.Handler interface. It rolls back
+// the open transaction, if any.
+func (ph *pgHandler) ConnectionClosed(c *pgwire.Conn) {
+	ctx, cancel := ph.context(c)
+	defer cancel()
+	session := ph.state(c).session
+	if session.InTransaction {
+		defer atomic.AddInt32(&busyConnections, -1)
+	}
+	_ = ph.vtg.CloseSession(ctx, session)
+}
+
+// Execute is part of the pgwire.Handler interface.
+func (ph *pgHandler) Execute(c *pgwire.Conn, query string, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	ctx, cancel := ph.context(c)
+	defer cancel()
+
+	session := ph.state(c).session
+	if !session.InTransaction {
+		atomic.AddInt32(&busyConnections, 1)
+	}
+	defer func() {
+		if !session.InTransaction {
+			atomic.AddInt32(&busyConnections, -1)
+		}
+	}()
+
+	if bindVars == nil {
+		bindVars = make(map[string]*querypb.BindVariable)
+	}
+	_, result, err := ph.vtg.Execute(ctx, session, query, bindVars)
+	return result, mysql.NewSQLErrorFromError(err)
+}
+
+// Prepare is part of the pgwire.Handler interface.
+func (ph *pgHandler) Prepare(c *pgwire.Conn, query string, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error) {
+	ctx, cancel := ph.context(c)
+	defer cancel()
+
+	session := ph.state(c).session
+	if !session.InTransaction {
+		atomic.AddInt32(&busyConnections, 1)
+	}
+	defer func() {
+		if !session.InTransaction {
+			atomic.AddInt32(&busyConnections, -1)
+		}
+	}()
+
+	_, fields, err := ph.vtg.Prepare(ctx, session, query, bindVars)
+	return fields, mysql.NewSQLErrorFromError(err)
+}
+
+// InTransaction is part of the pgwire.Handler interface.
+func (ph *pgHandler) InTransaction(c *pgwire.Conn) bool {
+	return ph.state(c).session.InTransaction
+}
+
+// context returns the context of a call, with the caller IDs of the
+// connection, see vtgateHandler.ComQuery.
+func (ph *pgHandler) context(c *pgwire.Conn) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if mysqlQueryTimeout != 0 {
+		ctx, cancel = context.WithTimeout(ctx, mysqlQueryTimeout)
+	}
+	var im *querypb.VTGateCallerID
+	if userData := ph.state(c).userData; userData != nil {
+		im = userData.Get()
+	}
+	ef := callerid.NewEffectiveCallerID(
+		c.User,                  /* principal: who */
+		c.RemoteAddr().String(), /* component: running client process */
+		"VTGate PostgreSQL Connector" /* subcomponent: part of the client */)
+	return callerid.NewContext(ctx, ef, im), cancel
+}
+
+var pgListener *pgwire.Listener
+
+// initPgProtocol starts the PostgreSQL protocol listener, if it is enabled.
+func initPgProtocol() {
+	if pgServerPort < 0 || rpcVTGate == nil {
+		return
+	}
+	initPluginsWithoutMySQLProtocol()
+	handler := &pgHandler{
+		vtg:        rpcVTGate,
+		authServer: mysql.GetAuthServer(mysqlAuthServerImpl),
+	}
+	var err error
+	pgListener, err = pgwire.NewListener(mysqlTCPVersion, net.JoinHostPort(pgServerBindAddress, strconv.Itoa(pgServerPort)), handler)
+	if err != nil {
+		log.Exitf("pgwire.NewListener failed: %v", err)
+	}
+	// The clients send cleartext passwords: the listener encrypts the
+	// connections with the TLS config of the MySQL protocol, and refuses
+	// the passwords of the unencrypted ones unless allowed like for MySQL,
+	// or unless they are not checked.
+	if mysqlSslCert != "" && mysqlSslKey != "" {
+		tlsVersion, err := vttls.TLSVersionToNumber(mysqlTLSMinVersion)
+		if err != nil {
+			log.Exitf("pgwire.NewListener failed: %v", err)
+		}
+		if err := reloadPgTLSConfig(pgListener, tlsVersion); err != nil {
+			log.Exitf("grpcutils.TLSServerConfig failed: %v", err)
+		}
+		pgSigChan := make(chan os.Signal, 1)
+		signal.Notify(pgSigChan, syscall.SIGHUP)
+		go func(listener *pgwire.Listener) {
+			for range pgSigChan {
+				if err := reloadPgTLSConfig(listener, tlsVersion); err != nil {
+					log.Errorf("grpcutils.TLSServerConfig failed: %v", err)
+				}
+			}
+		}(pgListener)
+	}
+	_, noPasswords := handler.authServer.(*mysql.AuthServerNone)
+	pgListener.AllowClearTextWithoutTLS.Set(mysqlAllowClearTextWithoutTLS || noPasswords)
+	go pgListener.Accept()
+}
+
+// reloadPgTLSConfig reads the TLS config of the MySQL protocol for the
+// PostgreSQL protocol listener.
+func reloadPgTLSConfig(listener *pgwire.Listener, tlsVersion uint16) error {
+	serverConfig, err := vttls.ServerConfig(mysqlSslCert, mysqlSslKey, mysqlSslCa, mysqlSslCrl, mysqlSslServerCA, tlsVersion)
+	if err != nil {
+		return err
+	}
+	listener.TLSConfig.Store(serverConfig)
+	return nil
+}
+
+func shutdownPgProtocol() {
+	if pgListener != nil {
+		pgListener.Close()
+		pgListener = nil
+	}
+}
+
+func init() {
+	servenv.OnParseFor("vtgate", registerPgPluginFlags)
+	servenv.OnParseFor("vtcombo", registerPgPluginFlags)
+
+	servenv.OnRun(initPgProtocol)
+	servenv.OnTermSync(shutdownPgProtocol)
+}
@@ -0,0 +1,358 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// The query API executes the queries POSTed as JSON to /api/query, for
+// the clients without a MySQL driver. The queries go through VTGate.Execute,
+// like the ones of the MySQL protocol, so the same query rules and actions
+// apply to them. The clients which can use gRPC have the Execute method of
+// the Vitess service.
+//
+// A request is an object with the query, its positional parameters, bound
+// to its ? placeholders, its named bind variables, and the target:
+//
+//	{"sql": "select id, name from t where id > ?", "params": [10], "target": "ks@replica"}
+//
+// The response has the fields and the rows of the result:
+//
+//	{"fields": [{"name": "id", "type": "INT64"}, {"name": "name", "type": "VARCHAR"}], "rows": [[11, "a"]], "rows_affected": 0}
+//
+// The numbers are JSON numbers, the JSON columns JSON values, the binary
+// columns base64 strings and the others strings. Each request has its own
+// session, whose transaction, if any, is rolled back at the end of the
+// request.
+//
+// The errors have the MySQL error code, SQL state and message. The ones which
+// suggest to retry after a delay, like the ones of the FAIL_RETRY rules with a
+// retry_after param, have it in their retry_after field and in the
+// Retry-After header, in seconds.
+
+var (
+	enableQueryAPI bool
+
+	queryAPIRequests = stats.NewCountersWithSingleLabel("QueryAPIRequests", "Query API requests, by HTTP status code", "code")
+)
+
+// maxQueryAPIRequestSize is the largest request body accepted, the
+// default max_allowed_packet of MySQL.
+const maxQueryAPIRequestSize = 64 * 1024 * 1024
+
+func registerQueryAPIFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&enableQueryAPI, "enable_query_api", enableQueryAPI, "(Experimental) If set, execute the queries POSTed as JSON to /api/query. The users are authenticated by --mysql_auth_server_impl with HTTP basic authentication, which requires --mysql_allow_clear_text_without_tls unless the auth server is none.")
+}
+
+type queryAPIRequest struct {
+	SQL      string         `json:"sql"`
+	Params   []any          `json:"params"`
+	BindVars map[string]any `json:"bind_vars"`
+	Target   string         `json:"target"`
+}
+
+type queryAPIField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type queryAPIResponse struct {
+	Fields       []queryAPIField `json:"fields,omitempty"`
+	Rows         [][]any         `json:"rows,omitempty"`
+	RowsAffected uint64          `json:"rows_affected"`
+	InsertID     uint64          `json:"insert_id,omitempty"`
+	Info         string          `json:"info,omitempty"`
+}
+
+type queryAPIError struct {
+	Code     int    `json:"code"`
+	SQLState string `json:"sql_state"`
+	Message  string `json:"message"`
+	// RetryAfter is the delay the error suggests to retry after, like 2s.
+	RetryAfter string `json:"retry_after,omitempty"`
+}
+
+// queryAPIHandler serves the query API.
+type queryAPIHandler struct {
+	vtg        *VTGate
+	authServer mysql.AuthServer
+}
+
+func (qh *queryAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		qh.sendError(w, http.StatusMethodNotAllowed, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "the query API only accepts POST requests"))
+		return
+	}
+	user, userData, err := qh.authenticate(r)
+	if err != nil {
+		if vterrors.Code(err) == vtrpcpb.Code_UNAUTHENTICATED {
+			w.Header().Set("WWW-Authenticate", `Basic realm="vtgate"`)
+		}
+		qh.sendError(w, httpStatus(err), err)
+		return
+	}
+
+	var req queryAPIRequest
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxQueryAPIRequestSize))
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		qh.sendError(w, http.StatusBadRequest, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: %v", err))
+		return
+	}
+	if req.SQL == "" {
+		qh.sendError(w, http.StatusBadRequest, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid request: no sql"))
+		return
+	}
+	bindVars, err := queryAPIBindVars(req.Params, req.BindVars)
+	if err != nil {
+		qh.sendError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if mysqlQueryTimeout != 0 {
+		ctx, cancel = context.WithTimeout(ctx, mysqlQueryTimeout)
+	}
+	defer cancel()
+	ef := callerid.NewEffectiveCallerID(
+		user,         /* principal: who */
+		r.RemoteAddr, /* component: running client process */
+		"VTGate Query API" /* subcomponent: part of the client */)
+	ctx = callerid.NewContext(ctx, ef, userData.Get())
+
+	session := newSession()
+	session.TargetString = req.Target
+	atomic.AddInt32(&busyConnections, 1)
+	session, result, err := qh.vtg.Execute(ctx, session, req.SQL, bindVars)
+	_ = qh.vtg.CloseSession(ctx, session)
+	atomic.AddInt32(&busyConnections, -1)
+	if err != nil {
+		qh.sendError(w, httpStatus(err), err)
+		return
+	}
+
+	resp, err := queryAPIResult(result)
+	if err != nil {
+		qh.sendError(w, http.StatusInternalServerError, err)
+		return
+	}
+	queryAPIRequests.Add(strconv.Itoa(http.StatusOK), 1)
+	w.Header().Set("Content-Type", jsonContentType)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// authenticate checks the HTTP basic authentication of a request. The
+// password is sent in clear text, so only the auth servers which check
+// those are supported.
+func (qh *queryAPIHandler) authenticate(r *http.Request) (string, mysql.Getter, error) {
+	return authenticateHTTP(qh.authServer, r)
+}
+
+// authenticateHTTP checks the HTTP basic authentication of a request of the
+// HTTP APIs with an auth server of the MySQL protocol.
+func authenticateHTTP(authServer mysql.AuthServer, r *http.Request) (string, mysql.Getter, error) {
+	user, password, ok := r.BasicAuth()
+	switch authServer := authServer.(type) {
+	case *mysql.AuthServerNone:
+		return user, &mysql.NoneGetter{}, nil
+	case mysql.PlainTextStorage:
+		if !ok {
+			return "", nil, vterrors.Errorf(vtrpcpb.Code_UNAUTHENTICATED, "HTTP basic authentication is required")
+		}
+		if r.TLS == nil && !mysqlAllowClearTextWithoutTLS {
+			return "", nil, vterrors.Errorf(vtrpcpb.Code_PERMISSION_DENIED, "HTTP basic authentication without TLS requires --mysql_allow_clear_text_without_tls")
+		}
+		var remoteAddr net.Addr
+		if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+			remoteAddr = addr
+		}
+		userData, err := authServer.UserEntryWithPassword(nil, user, password, remoteAddr)
+		if err != nil {
+			return "", nil, vterrors.Errorf(vtrpcpb.Code_UNAUTHENTICATED, "Access denied for user '%v'", user)
+		}
+		return user, userData, nil
+	}
+	return "", nil, vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "auth server %s doesn't support cleartext passwords", mysqlAuthServerImpl)
+}
+
+func (qh *queryAPIHandler) sendError(w http.ResponseWriter, status int, err error) {
+	queryAPIRequests.Add(strconv.Itoa(status), 1)
+	code, sqlState, message := sqlErrorFields(err)
+	apiErr := queryAPIError{Code: code, SQLState: sqlState, Message: message}
+	if retryAfter, ok := vterrors.RetryAfter(err); ok {
+		apiErr.RetryAfter = retryAfter.String()
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]queryAPIError{"error": apiErr})
+}
+
+// sqlErrorFields returns the MySQL error code, SQL state and message of an
+// error, as the MySQL protocol would send them.
+func sqlErrorFields(err error) (int, string, string) {
+	var sqlErr *mysql.SQLError
+	if errors.As(mysql.NewSQLErrorFromError(err), &sqlErr) {
+		return sqlErr.Number(), sqlErr.SQLState(), sqlErr.Message
+	}
+	return mysql.ERUnknownError, mysql.SSUnknownSQLState, err.Error()
+}
+
+// httpStatus returns the HTTP status code of an error.
+func httpStatus(err error) int {
+	switch vterrors.Code(err) {
+	case vtrpcpb.Code_INVALID_ARGUMENT, vtrpcpb.Code_FAILED_PRECONDITION, vtrpcpb.Code_OUT_OF_RANGE:
+		return http.StatusBadRequest
+	case vtrpcpb.Code_UNAUTHENTICATED:
+		return http.StatusUnauthorized
+	case vtrpcpb.Code_PERMISSION_DENIED:
+		return http.StatusForbidden
+	case vtrpcpb.Code_NOT_FOUND:
+		return http.StatusNotFound
+	case vtrpcpb.Code_ALREADY_EXISTS, vtrpcpb.Code_ABORTED:
+		return http.StatusConflict
+	case vtrpcpb.Code_RESOURCE_EXHAUSTED:
+		return http.StatusTooManyRequests
+	case vtrpcpb.Code_UNIMPLEMENTED:
+		return http.StatusNotImplemented
+	case vtrpcpb.Code_UNAVAILABLE:
+		return http.StatusServiceUnavailable
+	case vtrpcpb.Code_DEADLINE_EXCEEDED:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// queryAPIBindVars returns the bind variables of a request. The parser
+// names the ? placeholders :v1, :v2 and so on.
+func queryAPIBindVars(params []any, named map[string]any) (map[string]*querypb.BindVariable, error) {
+	bindVars := make(map[string]*querypb.BindVariable, len(params)+len(named))
+	for i, v := range params {
+		bv, err := sqltypes.BuildBindVariable(jsonBindValue(v))
+		if err != nil {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid parameter %d: %v", i+1, err)
+		}
+		bindVars["v"+strconv.Itoa(i+1)] = bv
+	}
+	for name, v := range named {
+		bv, err := sqltypes.BuildBindVariable(jsonBindValue(v))
+		if err != nil {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid bind variable %s: %v", name, err)
+		}
+		bindVars[name] = bv
+	}
+	return bindVars, nil
+}
+
+// jsonBindValue converts the numbers of a JSON value to the types of
+// BuildBindVariable. The arrays become tuples.
+func jsonBindValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return string(v)
+	case []any:
+		values := make([]any, len(v))
+		for i, elem := range v {
+			values[i] = jsonBindValue(elem)
+		}
+		return values
+	}
+	return v
+}
+
+func queryAPIResult(result *sqltypes.Result) (*queryAPIResponse, error) {
+	resp := &queryAPIResponse{
+		RowsAffected: result.RowsAffected,
+		InsertID:     result.InsertID,
+		Info:         result.Info,
+	}
+	for _, field := range result.Fields {
+		resp.Fields = append(resp.Fields, queryAPIField{Name: field.Name, Type: field.Type.String()})
+	}
+	if len(result.Rows) > 0 {
+		resp.Rows = make([][]any, 0, len(result.Rows))
+	}
+	for _, row := range result.Rows {
+		values := make([]any, len(row))
+		for i, v := range row {
+			value, err := queryAPIValue(v)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		resp.Rows = append(resp.Rows, values)
+	}
+	return resp, nil
+}
+
+func queryAPIValue(v sqltypes.Value) (any, error) {
+	switch typ := v.Type(); {
+	case v.IsNull():
+		return nil, nil
+	case sqltypes.IsIntegral(typ), sqltypes.IsFloat(typ):
+		return json.Number(v.Raw()), nil
+	case typ == sqltypes.TypeJSON:
+		if !json.Valid(v.Raw()) {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "invalid JSON value %q", v.Raw())
+		}
+		return json.RawMessage(v.Raw()), nil
+	case sqltypes.IsBinary(typ), typ == sqltypes.Bit, typ == sqltypes.Geometry:
+		return base64.StdEncoding.EncodeToString(v.Raw()), nil
+	}
+	return v.ToString(), nil
+}
+
+// initQueryAPI registers the query API handler, if it is enabled.
+func initQueryAPI() {
+	if !enableQueryAPI || rpcVTGate == nil {
+		return
+	}
+	initPluginsWithoutMySQLProtocol()
+	http.Handle(apiPrefix+"query", &queryAPIHandler{
+		vtg:        rpcVTGate,
+		authServer: mysql.GetAuthServer(mysqlAuthServerImpl),
+	})
+}
+
+func init() {
+	servenv.OnParseFor("vtgate", registerQueryAPIFlags)
+	servenv.OnParseFor("vtcombo", registerQueryAPIFlags)
+
+	servenv.OnRun(initQueryAPI)
+}
@@ -0,0 +1,153 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func queryAPIRequestFor(t *testing.T, handler http.Handler, body string, user, password string) (int, map[string]any) {
+	r := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(body))
+	if user != "" {
+		r.SetBasicAuth(user, password)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	return w.Code, resp
+}
+
+func TestQueryAPI(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	sbc := hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	handler := &queryAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+
+	code, resp := queryAPIRequestFor(t, handler, `{"sql": "select id, value from t1 where id = ? and name = :name", "params": [1], "bind_vars": {"name": "foo"}, "target": "@primary"}`, "", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []any{map[string]any{"name": "id", "type": "INT32"}, map[string]any{"name": "value", "type": "VARCHAR"}}, resp["fields"])
+	assert.Equal(t, []any{[]any{float64(1), "foo"}}, resp["rows"])
+	require.Len(t, sbc.Queries, 1)
+	assert.Equal(t, sqltypes.Int64BindVariable(1), sbc.Queries[0].BindVariables["v1"])
+	assert.Equal(t, sqltypes.StringBindVariable("foo"), sbc.Queries[0].BindVariables["name"])
+
+	code, resp = queryAPIRequestFor(t, handler, `{"params": [1]}`, "", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, resp["error"].(map[string]any)["message"], "no sql")
+
+	code, _ = queryAPIRequestFor(t, handler, `{"sql": "select 1", "params": [{"a": 1}]}`, "", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/query", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestQueryAPIRetryAfter(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	sbc := hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	handler := &queryAPIHandler{vtg: rpcVTGate, authServer: mysql.NewAuthServerNone()}
+	body := `{"sql": "select id from t1", "target": "@primary"}`
+
+	sbc.EphemeralShardErr = vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "disallowed due to rule: busy%s", vterrors.RetryAfterSuffix(1500*time.Millisecond))
+	r := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	var resp map[string]map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "1.5s", resp["error"]["retry_after"])
+	assert.Contains(t, resp["error"]["message"], "disallowed due to rule: busy (retry after 1.5s)")
+
+	// The errors which suggest no delay have no Retry-After.
+	sbc.EphemeralShardErr = vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "disallowed due to rule: busy")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(body)))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+	assert.NotContains(t, w.Body.String(), "retry_after")
+}
+
+func TestQueryAPIAuthentication(t *testing.T) {
+	createSandbox(KsTestDefaultShard)
+	hcVTGateTest.Reset()
+	hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestDefaultShard, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+	handler := &queryAPIHandler{
+		vtg:        rpcVTGate,
+		authServer: mysql.NewAuthServerStatic("", `{"user": [{"Password": "secret"}]}`, 0),
+	}
+	body := `{"sql": "select id from t1", "target": "@primary"}`
+
+	defer func(allow bool) { mysqlAllowClearTextWithoutTLS = allow }(mysqlAllowClearTextWithoutTLS)
+	mysqlAllowClearTextWithoutTLS = false
+	code, _ := queryAPIRequestFor(t, handler, body, "user", "secret")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	mysqlAllowClearTextWithoutTLS = true
+	code, resp := queryAPIRequestFor(t, handler, body, "", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.EqualValues(t, mysql.ERAccessDeniedError, resp["error"].(map[string]any)["code"])
+
+	code, _ = queryAPIRequestFor(t, handler, body, "user", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = queryAPIRequestFor(t, handler, body, "user", "secret")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestQueryAPIValues(t *testing.T) {
+	resp, err := queryAPIResult(&sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "i", Type: sqltypes.Int64},
+			{Name: "f", Type: sqltypes.Float64},
+			{Name: "d", Type: sqltypes.Decimal},
+			{Name: "j", Type: sqltypes.TypeJSON},
+			{Name: "b", Type: sqltypes.VarBinary},
+			{Name: "n", Type: sqltypes.VarChar},
+		},
+		Rows: [][]sqltypes.Value{{
+			sqltypes.NewInt64(-3),
+			sqltypes.NewFloat64(1.5),
+			sqltypes.NewDecimal("1.10"),
+			sqltypes.MakeTrusted(sqltypes.TypeJSON, []byte(`{"a": [1]}`)),
+			sqltypes.NewVarBinary("\x00\x01"),
+			sqltypes.NULL,
+		}},
+		RowsAffected: 1,
+	})
+	require.NoError(t, err)
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+	assert.Equal(t, `{"fields":[{"name":"i","type":"INT64"},{"name":"f","type":"FLOAT64"},{"name":"d","type":"DECIMAL"},{"name":"j","type":"JSON"},{"name":"b","type":"VARBINARY"},{"name":"n","type":"VARCHAR"}],"rows":[[-3,1.5,"1.10",{"a":[1]},"AAE=",null]],"rows_affected":1}`, string(data))
+
+	bindVars, err := queryAPIBindVars([]any{json.Number("18446744073709551615"), json.Number("2.5"), []any{json.Number("1"), "a"}, true, nil}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, sqltypes.Uint64BindVariable(18446744073709551615), bindVars["v1"])
+	assert.Equal(t, sqltypes.Float64BindVariable(2.5), bindVars["v2"])
+	assert.Equal(t, querypb.Type_TUPLE, bindVars["v3"].Type)
+	assert.Equal(t, sqltypes.Int8BindVariable(1), bindVars["v4"])
+	assert.Equal(t, sqltypes.NullBindVariable, bindVars["v5"])
+}
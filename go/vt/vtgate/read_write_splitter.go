@@ -70,6 +70,10 @@ func isSQLSupportReadWriteSplit(query string) (bool, error) {
 	if sqlparser.ContainsLastInsertIDStatement(s) {
 		return false, nil
 	}
+	// select next value allocates the values of a sequence on the primary
+	if sqlparser.IsNextvalStatement(s) {
+		return false, nil
+	}
 	// GET_LOCK/RELEASE_LOCK/IS_USED_LOCK/RELEASE_ALL_LOCKS is a special case, it's not a read-only query
 	if sqlparser.ContainsLockStatement(s) {
 		return false, nil
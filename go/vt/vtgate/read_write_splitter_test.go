@@ -220,6 +220,19 @@ func Test_suggestTabletType_force_primary(t *testing.T) {
 			wantTabletType: topodata.TabletType_PRIMARY,
 			wantErr:        assert.NoError,
 		},
+		{
+			name: "readWriteSplittingPolicy=enable, inTransaction=false, hasCreatedTempTables=false, hasAdvisoryLock=false",
+			args: args{
+				readWriteSplittingPolicy: "enable",
+				inTransaction:            false,
+				hasCreatedTempTables:     false,
+				hasAdvisoryLock:          false,
+				readWriteSplittingRatio:  100,
+				sql:                      "select next 10 values from seq",
+			},
+			wantTabletType: topodata.TabletType_PRIMARY,
+			wantErr:        assert.NoError,
+		},
 		{
 			name: "readWriteSplittingPolicy=enable, inTransaction=false, hasCreatedTempTables=false, hasAdvisoryLock=false",
 			args: args{
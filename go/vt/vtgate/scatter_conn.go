@@ -215,7 +215,7 @@ func (stc *ScatterConn) ExecuteMultiShard(
 			if session != nil && session.Session != nil && session.Session.Options != nil {
 				opts = session.Session.Options
 				// If the session possesses a GTID, we need to set it in the ExecuteOptions
-				if session.IsNonWeakReadAfterWriteConsistencyEnable() && rs.Target.TabletType != topodatapb.TabletType_PRIMARY {
+				if waitsForGTID(session) && rs.Target.TabletType != topodatapb.TabletType_PRIMARY {
 					err = setReadAfterWriteOpts(ctx, opts, session, stc.gateway, qs, rs.Target)
 					if err != nil {
 						return nil, err
@@ -293,6 +293,11 @@ func (stc *ScatterConn) ExecuteMultiShard(
 			if ignoreMaxMemoryRows || len(qr.Rows) <= maxMemoryRows {
 				qr.AppendResult(innerqr)
 			}
+			// The warnings of the shards are the warnings of the query, which
+			// SHOW WARNINGS returns.
+			for _, warning := range innerqr.Warnings {
+				session.RecordWarning(warning)
+			}
 			if qr.SessionStateChanges != "" {
 				session.SetReadAfterWriteGTID(qr.SessionStateChanges)
 				stc.gateway.AddGtid(qr.SessionStateChanges)
@@ -444,7 +449,7 @@ func (stc *ScatterConn) StreamExecuteMulti(
 			if session != nil && session.Session != nil && session.Session.Options != nil {
 				opts = session.Session.Options
 				// If the session possesses a GTID, we need to set it in the ExecuteOptions
-				if session.IsNonWeakReadAfterWriteConsistencyEnable() && rs.Target.TabletType != topodatapb.TabletType_PRIMARY {
+				if waitsForGTID(session) && rs.Target.TabletType != topodatapb.TabletType_PRIMARY {
 					err = setReadAfterWriteOpts(ctx, opts, session, stc.gateway, qs, rs.Target)
 					if err != nil {
 						return nil, err
@@ -710,15 +715,10 @@ func (stc *ScatterConn) multiGoTransaction(
 			oneShard(rs, i)
 		}
 	} else {
-		var wg sync.WaitGroup
-		for i, rs := range rss {
-			wg.Add(1)
-			go func(rs *srvtopo.ResolvedShard, i int) {
-				defer wg.Done()
-				oneShard(rs, i)
-			}(rs, i)
-		}
-		wg.Wait()
+		runWithParallelismLimits(ctx, numShards,
+			func(i int) *querypb.Target { return rss[i].Target },
+			func(i int) { oneShard(rss[i], i) },
+			func(i int, err error) { allErrors.RecordError(err) })
 	}
 
 	if session.MustRollback() {
@@ -926,7 +926,20 @@ const (
 )
 
 func setReadAfterWriteOpts(ctx context.Context, opts *querypb.ExecuteOptions, session *SafeSession, gateway *TabletGateway, qs queryservice.QueryService, target *querypb.Target) error {
-	if opts == nil || session == nil || session.Session == nil || !session.IsNonWeakReadAfterWriteConsistencyEnable() {
+	if opts == nil || session == nil || session.Session == nil {
+		return nil
+	}
+	// The snapshot the session reads takes precedence over its read after
+	// write consistency.
+	if gtid := session.GetSnapshotReadGTID(); gtid != "" {
+		opts.ReadAfterWriteTimeout = defaultReadAfterWriteTimeout
+		if raw := session.GetReadAfterWrite(); raw != nil && raw.ReadAfterWriteTimeout >= 0 {
+			opts.ReadAfterWriteTimeout = raw.ReadAfterWriteTimeout
+		}
+		opts.ReadAfterWriteGtid = gtid
+		return nil
+	}
+	if !session.IsNonWeakReadAfterWriteConsistencyEnable() {
 		return nil
 	}
 	if session.Session.ReadAfterWrite.ReadAfterWriteTimeout < 0 {
@@ -0,0 +1,205 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// A query that fans out to many shards sends its shard actions in parallel.
+// Two limits, both adjustable at runtime through /debug/env, keep a single
+// expensive query from monopolizing the backends:
+//   - scatter_max_parallelism_per_query bounds the number of shard actions
+//     of one query that run at the same time.
+//   - scatter_max_parallelism_per_tablet bounds the number of scatter shard
+//     actions, of all queries, that run at the same time against one target.
+//
+// 0 means unlimited for both.
+//
+// The limits apply to the shard actions of ExecuteMultiShard and
+// StreamExecuteMulti, so to the chunks of INSERT ... SELECT too, and to the
+// copy phase of the shards of a VStream, see acquireParallelismSlots. The
+// binlog phase of a VStream, which never ends, and the message streams aren't
+// limited: all their shards must be streamed at once. The non-transactional
+// DML jobs run by the tablets are paced by their own throttling.
+var (
+	scatterMaxParallelismPerQuery  atomic.Int64
+	scatterMaxParallelismPerTablet atomic.Int64
+
+	scatterParallelismWaits = stats.NewCountersWithSingleLabel("ScatterParallelismWaits", "Number of shard actions that waited for a scatter parallelism slot", "Limit", "PerQuery", "PerTablet")
+
+	tabletParallelism = newParallelismLimiter()
+)
+
+// GetScatterMaxParallelismPerQuery returns the per query scatter parallelism limit.
+func GetScatterMaxParallelismPerQuery() int {
+	return int(scatterMaxParallelismPerQuery.Load())
+}
+
+// SetScatterMaxParallelismPerQuery sets the per query scatter parallelism limit.
+func SetScatterMaxParallelismPerQuery(limit int) {
+	scatterMaxParallelismPerQuery.Store(int64(limit))
+}
+
+// GetScatterMaxParallelismPerTablet returns the per tablet scatter parallelism limit.
+func GetScatterMaxParallelismPerTablet() int {
+	return int(scatterMaxParallelismPerTablet.Load())
+}
+
+// SetScatterMaxParallelismPerTablet sets the per tablet scatter parallelism limit.
+// Shard actions that are already waiting pick up a higher limit the next time
+// a slot of their target is released.
+func SetScatterMaxParallelismPerTablet(limit int) {
+	scatterMaxParallelismPerTablet.Store(int64(limit))
+}
+
+// parallelismLimiter counts the shard actions in flight per target.
+type parallelismLimiter struct {
+	mu    sync.Mutex
+	inUse map[string]int
+	// released is closed, then replaced, every time a slot of the target is
+	// released, to wake up the shard actions that wait for one.
+	released map[string]chan struct{}
+}
+
+func newParallelismLimiter() *parallelismLimiter {
+	return &parallelismLimiter{
+		inUse:    make(map[string]int),
+		released: make(map[string]chan struct{}),
+	}
+}
+
+// acquire waits until less than limit() shard actions are in flight for key.
+// The limit is read again every time a slot is released, so that it can be
+// changed while shard actions are waiting.
+func (pl *parallelismLimiter) acquire(ctx context.Context, key string, limit func() int) error {
+	waited := false
+	for {
+		pl.mu.Lock()
+		if l := limit(); l <= 0 || pl.inUse[key] < l {
+			pl.inUse[key]++
+			pl.mu.Unlock()
+			return nil
+		}
+		ch, ok := pl.released[key]
+		if !ok {
+			ch = make(chan struct{})
+			pl.released[key] = ch
+		}
+		pl.mu.Unlock()
+
+		if !waited {
+			waited = true
+			scatterParallelismWaits.Add("PerTablet", 1)
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return vterrors.Wrapf(ctx.Err(), "waiting for a scatter parallelism slot on %s", key)
+		}
+	}
+}
+
+func (pl *parallelismLimiter) release(key string) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.inUse[key]--; pl.inUse[key] <= 0 {
+		delete(pl.inUse, key)
+	}
+	if ch, ok := pl.released[key]; ok {
+		close(ch)
+		delete(pl.released, key)
+	}
+}
+
+func parallelismKey(target *querypb.Target) string {
+	return target.Keyspace + "/" + target.Shard + "@" + topoproto.TabletTypeLString(target.TabletType)
+}
+
+// newQuerySlots returns the per query slots of the shard actions of a query
+// on numShards shards, nil if the per query limit doesn't bound them.
+func newQuerySlots(numShards int) chan struct{} {
+	perQuery := GetScatterMaxParallelismPerQuery()
+	if perQuery <= 0 || perQuery >= numShards {
+		return nil
+	}
+	return make(chan struct{}, perQuery)
+}
+
+// acquireParallelismSlots waits for a slot of querySlots, unless it is nil,
+// then for a slot of target, and returns the function that releases both. It
+// is for the shard actions that don't run through runWithParallelismLimits,
+// because they don't all start at once.
+func acquireParallelismSlots(ctx context.Context, querySlots chan struct{}, target *querypb.Target) (func(), error) {
+	if querySlots != nil {
+		select {
+		case querySlots <- struct{}{}:
+		default:
+			scatterParallelismWaits.Add("PerQuery", 1)
+			select {
+			case querySlots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, vterrors.Wrapf(ctx.Err(), "waiting for a scatter parallelism slot of the query")
+			}
+		}
+	}
+	key := parallelismKey(target)
+	if err := tabletParallelism.acquire(ctx, key, GetScatterMaxParallelismPerTablet); err != nil {
+		if querySlots != nil {
+			<-querySlots
+		}
+		return nil, err
+	}
+	return func() {
+		tabletParallelism.release(key)
+		if querySlots != nil {
+			<-querySlots
+		}
+	}, nil
+}
+
+// runWithParallelismLimits calls oneShard for every shard, in parallel up to
+// the scatter parallelism limits, and returns once all calls returned.
+// A shard action that cannot get a slot before ctx is done is not run, and
+// its error is passed to onError.
+func runWithParallelismLimits(ctx context.Context, numShards int, target func(i int) *querypb.Target, oneShard func(i int), onError func(i int, err error)) {
+	querySlots := newQuerySlots(numShards)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numShards; i++ {
+		if querySlots != nil {
+			select {
+			case querySlots <- struct{}{}:
+			default:
+				scatterParallelismWaits.Add("PerQuery", 1)
+				querySlots <- struct{}{}
+			}
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if querySlots != nil {
+				defer func() { <-querySlots }()
+			}
+			key := parallelismKey(target(i))
+			if err := tabletParallelism.acquire(ctx, key, GetScatterMaxParallelismPerTablet); err != nil {
+				onError(i, err)
+				return
+			}
+			defer tabletParallelism.release(key)
+			oneShard(i)
+		}(i)
+	}
+	wg.Wait()
+}
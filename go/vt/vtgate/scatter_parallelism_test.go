@@ -0,0 +1,219 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/discovery"
+
+	binlogdatapb "vitess.io/vitess/go/vt/proto/binlogdata"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+)
+
+func TestRunWithParallelismLimits(t *testing.T) {
+	defer SetScatterMaxParallelismPerQuery(GetScatterMaxParallelismPerQuery())
+	defer SetScatterMaxParallelismPerTablet(GetScatterMaxParallelismPerTablet())
+
+	targets := []*querypb.Target{
+		{Keyspace: "ks", Shard: "-80", TabletType: topodatapb.TabletType_PRIMARY},
+		{Keyspace: "ks", Shard: "80-", TabletType: topodatapb.TabletType_PRIMARY},
+	}
+	testcases := []struct {
+		name      string
+		perQuery  int
+		perTablet int
+		want      int64
+	}{
+		{name: "unlimited", want: 8},
+		{name: "per query", perQuery: 3, want: 3},
+		{name: "per tablet", perTablet: 1, want: 2},
+		{name: "both", perQuery: 1, perTablet: 2, want: 1},
+	}
+	for _, tcase := range testcases {
+		t.Run(tcase.name, func(t *testing.T) {
+			SetScatterMaxParallelismPerQuery(tcase.perQuery)
+			SetScatterMaxParallelismPerTablet(tcase.perTablet)
+
+			var running, maxRunning, calls atomic.Int64
+			runWithParallelismLimits(context.Background(), 8,
+				func(i int) *querypb.Target { return targets[i%2] },
+				func(i int) {
+					n := running.Add(1)
+					for {
+						m := maxRunning.Load()
+						if n <= m || maxRunning.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					time.Sleep(10 * time.Millisecond)
+					running.Add(-1)
+					calls.Add(1)
+				},
+				func(i int, err error) { t.Errorf("unexpected error: %v", err) })
+			assert.EqualValues(t, 8, calls.Load())
+			assert.Equal(t, tcase.want, maxRunning.Load())
+		})
+	}
+}
+
+func TestParallelismLimiter(t *testing.T) {
+	pl := newParallelismLimiter()
+	limit := atomic.Int64{}
+	limit.Store(1)
+	getLimit := func() int { return int(limit.Load()) }
+
+	require.NoError(t, pl.acquire(context.Background(), "t1", getLimit))
+	// other targets are not affected.
+	require.NoError(t, pl.acquire(context.Background(), "t2", getLimit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorContains(t, pl.acquire(ctx, "t1", getLimit), "waiting for a scatter parallelism slot on t1")
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- pl.acquire(context.Background(), "t1", getLimit)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquire should wait for a slot")
+	case <-time.After(10 * time.Millisecond):
+	}
+	pl.release("t1")
+	require.NoError(t, <-acquired)
+
+	pl.release("t1")
+	pl.release("t2")
+	assert.Empty(t, pl.inUse)
+	assert.Empty(t, pl.released)
+}
+
+func TestVStreamCopyParallelismLimits(t *testing.T) {
+	defer SetScatterMaxParallelismPerQuery(GetScatterMaxParallelismPerQuery())
+	defer SetScatterMaxParallelismPerTablet(GetScatterMaxParallelismPerTablet())
+	SetScatterMaxParallelismPerQuery(1)
+	SetScatterMaxParallelismPerTablet(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ks := "TestVStream"
+	cell := "aa"
+	_ = createSandbox(ks)
+	hc := discovery.NewFakeHealthCheck(nil)
+	st := getSandboxTopo(ctx, cell, ks, []string{"-20", "20-40"})
+	vsm := newTestVStreamManager(hc, st, cell)
+	for i, shard := range []string{"-20", "20-40"} {
+		sbc := hc.AddTestTablet(cell, "1.1.1.1", int32(1001+i), ks, shard, topodatapb.TabletType_PRIMARY, true, 1, nil)
+		addTabletToSandboxTopo(t, st, ks, shard, sbc.Tablet())
+		sbc.AddVStreamEvents([]*binlogdatapb.VEvent{
+			{Type: binlogdatapb.VEventType_ROW, RowEvent: &binlogdatapb.RowEvent{TableName: shard}},
+			{Type: binlogdatapb.VEventType_COMMIT},
+		}, nil)
+		sbc.AddVStreamEvents([]*binlogdatapb.VEvent{{Type: binlogdatapb.VEventType_COPY_COMPLETED, Keyspace: ks, Shard: shard}}, nil)
+	}
+
+	// The shards are copied one at a time: the rows of a shard only come
+	// once the other one is copied.
+	var events []string
+	done := make(chan struct{})
+	vgtid := &binlogdatapb.VGtid{ShardGtids: []*binlogdatapb.ShardGtid{
+		{Keyspace: ks, Shard: "-20"},
+		{Keyspace: ks, Shard: "20-40"},
+	}}
+	go func() {
+		defer close(done)
+		_ = vsm.VStream(ctx, topodatapb.TabletType_PRIMARY, vgtid, nil, &vtgatepb.VStreamFlags{}, func(evs []*binlogdatapb.VEvent) error {
+			for _, ev := range evs {
+				switch ev.Type {
+				case binlogdatapb.VEventType_ROW:
+					events = append(events, "row "+ev.RowEvent.TableName)
+				case binlogdatapb.VEventType_COPY_COMPLETED:
+					if ev.Shard == "" {
+						cancel()
+					} else {
+						events = append(events, "copied "+ev.Shard)
+					}
+				}
+			}
+			return nil
+		})
+	}()
+	<-done
+	require.Len(t, events, 4)
+	first, second := "-20", "20-40"
+	if events[0] != "row "+ks+"."+first {
+		first, second = second, first
+	}
+	assert.Equal(t, []string{"row " + ks + "." + first, "copied " + first, "row " + ks + "." + second, "copied " + second}, events)
+	assert.Empty(t, tabletParallelism.inUse)
+}
+
+func TestVStreamBinlogsNotLimited(t *testing.T) {
+	defer SetScatterMaxParallelismPerQuery(GetScatterMaxParallelismPerQuery())
+	defer SetScatterMaxParallelismPerTablet(GetScatterMaxParallelismPerTablet())
+	SetScatterMaxParallelismPerQuery(1)
+	SetScatterMaxParallelismPerTablet(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ks := "TestVStream"
+	cell := "aa"
+	_ = createSandbox(ks)
+	hc := discovery.NewFakeHealthCheck(nil)
+	st := getSandboxTopo(ctx, cell, ks, []string{"-20", "20-40"})
+	vsm := newTestVStreamManager(hc, st, cell)
+	for i, shard := range []string{"-20", "20-40"} {
+		sbc := hc.AddTestTablet(cell, "1.1.1.1", int32(1001+i), ks, shard, topodatapb.TabletType_PRIMARY, true, 1, nil)
+		addTabletToSandboxTopo(t, st, ks, shard, sbc.Tablet())
+		sbc.AddVStreamEvents([]*binlogdatapb.VEvent{
+			{Type: binlogdatapb.VEventType_ROW, RowEvent: &binlogdatapb.RowEvent{TableName: shard}},
+			{Type: binlogdatapb.VEventType_COMMIT},
+		}, nil)
+	}
+
+	// The streams of the binlogs never end, all the shards stream at once
+	// whatever the limits.
+	var mu sync.Mutex
+	shards := make(map[string]bool)
+	done := make(chan struct{})
+	vgtid := &binlogdatapb.VGtid{ShardGtids: []*binlogdatapb.ShardGtid{
+		{Keyspace: ks, Shard: "-20", Gtid: "pos"},
+		{Keyspace: ks, Shard: "20-40", Gtid: "pos"},
+	}}
+	go func() {
+		defer close(done)
+		_ = vsm.VStream(ctx, topodatapb.TabletType_PRIMARY, vgtid, nil, &vtgatepb.VStreamFlags{}, func(evs []*binlogdatapb.VEvent) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, ev := range evs {
+				if ev.Type == binlogdatapb.VEventType_ROW {
+					shards[ev.RowEvent.TableName] = true
+				}
+			}
+			if len(shards) == 2 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the shards were not streamed at once")
+	}
+	assert.Len(t, shards, 2)
+	assert.Empty(t, tabletParallelism.inUse)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package schema
+
+import (
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/log"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	"vitess.io/vitess/go/vt/vttablet/queryservice"
+)
+
+type (
+	// TableDetails is what information_schema shows about a table, beyond the
+	// columns kept for the planner.
+	TableDetails struct {
+		Columns []ColumnDetails
+		Indexes []IndexColumn
+		// View is true if the table is a view. It is only known when the
+		// views are enabled.
+		View bool
+	}
+
+	// ColumnDetails is a column of a table, as in information_schema.COLUMNS.
+	ColumnDetails struct {
+		Name          string
+		DataType      string
+		CollationName string
+	}
+
+	// IndexColumn is a column of an index, as in information_schema.STATISTICS.
+	// Column is empty for the parts of functional indexes.
+	IndexColumn struct {
+		Index     string
+		NonUnique bool
+		Seq       int64
+		Column    string
+	}
+
+	detailMap struct {
+		m map[keyspaceStr]map[tableNameStr]*TableDetails
+	}
+)
+
+// EnableTableDetails makes the tracker keep the data types and the indexes of
+// the tables too, at the cost of one more query per schema load. It must be
+// called before the tracker is started.
+func (t *Tracker) EnableTableDetails() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.details = &detailMap{m: map[keyspaceStr]map[tableNameStr]*TableDetails{}}
+}
+
+// TableDetails returns the details of all known tables in the keyspace, or nil
+// if they are not tracked. The indexes of a table are only reloaded when the
+// tablets signal a change of its columns, so an index change alone is seen
+// with the next change of the table.
+func (t *Tracker) TableDetails(ks string) map[string]TableDetails {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.details == nil {
+		return nil
+	}
+	m := make(map[string]TableDetails, len(t.details.m[ks]))
+	for tbl, details := range t.details.m[ks] {
+		d := *details
+		d.View = t.views != nil && t.views.get(ks, tbl) != nil
+		m[tbl] = d
+	}
+	return m
+}
+
+func (t *Tracker) loadIndexes(conn queryservice.QueryService, target *querypb.Target) {
+	if t.details == nil {
+		return
+	}
+	res, err := conn.ExecuteInternal(t.ctx, target, mysql.FetchIndexes, nil, 0, 0, nil)
+	if err != nil {
+		// The indexes are only used for information_schema, so the keyspace is
+		// still tracked without them.
+		log.Warningf("error fetching the indexes of keyspace %s: %v", target.Keyspace, err)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.updateIndexes(target.Keyspace, res)
+}
+
+func (t *Tracker) updateIndexes(keyspace string, res *sqltypes.Result) {
+	for _, row := range res.Rows {
+		nonUnique, _ := row[2].ToInt64()
+		seq, _ := row[3].ToInt64()
+		details := t.details.get(keyspace, row[0].ToString())
+		details.Indexes = append(details.Indexes, IndexColumn{
+			Index:     row[1].ToString(),
+			NonUnique: nonUnique != 0,
+			Seq:       seq,
+			Column:    row[4].ToString(),
+		})
+	}
+}
+
+// get returns the details of a table, creating them if needed.
+func (dm *detailMap) get(ks, tbl string) *TableDetails {
+	m := dm.m[ks]
+	if m == nil {
+		m = make(map[tableNameStr]*TableDetails)
+		dm.m[ks] = m
+	}
+	details := m[tbl]
+	if details == nil {
+		details = &TableDetails{}
+		m[tbl] = details
+	}
+	return details
+}
+
+func (dm *detailMap) delete(ks, tbl string) {
+	if m := dm.m[ks]; m != nil {
+		delete(m, tbl)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/discovery"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	"vitess.io/vitess/go/vt/vttablet/sandboxconn"
+)
+
+func TestTableDetails(t *testing.T) {
+	target := &querypb.Target{Cell: "aa", Keyspace: "ks", Shard: "0", TabletType: topodatapb.TabletType_PRIMARY}
+	tablet := &topodatapb.Tablet{Keyspace: target.Keyspace, Shard: target.Shard, Type: target.TabletType}
+	columnFields := sqltypes.MakeTestFields("table_name|col_name|col_type|collation_name", "varchar|varchar|varchar|varchar")
+	indexFields := sqltypes.MakeTestFields("table_name|index_name|non_unique|seq_in_index|column_name", "varchar|varchar|int64|int64|varchar")
+
+	tracker := NewTracker(nil, "", nil, "", false)
+	assert.Nil(t, tracker.TableDetails("ks"))
+	tracker.EnableTableDetails()
+	tracker.tracked[target.Keyspace] = tracker.newUpdateController(target.Keyspace)
+
+	sbc := sandboxconn.NewSandboxConn(tablet)
+	sbc.SetResults([]*sqltypes.Result{
+		sqltypes.MakeTestResult(columnFields, "t1|id|int|", "t1|name|longtext|utf8mb4_0900_ai_ci", "t2|id|bigint|"),
+		sqltypes.MakeTestResult(indexFields, "t1|PRIMARY|0|1|id", "t1|name_idx|1|1|name"),
+	})
+	require.NoError(t, tracker.LoadKeyspace(sbc, target))
+	assert.Equal(t, []string{mysql.FetchTables, mysql.FetchIndexes}, sbc.StringQueries())
+	assert.Equal(t, map[string]TableDetails{
+		"t1": {
+			Columns: []ColumnDetails{{Name: "id", DataType: "int"}, {Name: "name", DataType: "longtext", CollationName: "utf8mb4_0900_ai_ci"}},
+			Indexes: []IndexColumn{{Index: "PRIMARY", Seq: 1, Column: "id"}, {Index: "name_idx", NonUnique: true, Seq: 1, Column: "name"}},
+		},
+		"t2": {
+			Columns: []ColumnDetails{{Name: "id", DataType: "bigint"}},
+		},
+	}, tracker.TableDetails("ks"))
+
+	// t1 is altered and t2 dropped.
+	sbc.Queries = nil
+	sbc.SetResults([]*sqltypes.Result{
+		sqltypes.MakeTestResult(columnFields, "t1|id|int|"),
+		sqltypes.MakeTestResult(indexFields, "t1|PRIMARY|0|1|id"),
+	})
+	th := &discovery.TabletHealth{Conn: sbc, Tablet: tablet, Target: target, Stats: &querypb.RealtimeStats{TableSchemaChanged: []string{"t1", "t2"}}}
+	require.True(t, tracker.updatedTableSchema(th, target))
+	assert.Equal(t, []string{mysql.FetchUpdatedTables, mysql.FetchUpdatedIndexes}, sbc.StringQueries())
+	assert.Equal(t, map[string]TableDetails{
+		"t1": {
+			Columns: []ColumnDetails{{Name: "id", DataType: "int"}},
+			Indexes: []IndexColumn{{Index: "PRIMARY", Seq: 1, Column: "id"}},
+		},
+	}, tracker.TableDetails("ks"))
+}
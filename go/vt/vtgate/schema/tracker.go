@@ -61,11 +61,12 @@ type (
 		ch     chan *discovery.TabletHealth
 		cancel context.CancelFunc
 
-		mu     sync.Mutex
-		tables *tableMap
-		views  *viewMap
-		ctx    context.Context
-		signal func() // a function that we'll call whenever we have new schema data
+		mu      sync.Mutex
+		tables  *tableMap
+		views   *viewMap
+		details *detailMap
+		ctx     context.Context
+		signal  func() // a function that we'll call whenever we have new schema data
 
 		// map of keyspace currently tracked
 		tracked      map[keyspaceStr]*updateController
@@ -114,6 +115,7 @@ func (t *Tracker) LoadKeyspace(conn queryservice.QueryService, target *querypb.T
 	if err != nil {
 		return err
 	}
+	t.loadIndexes(conn, target)
 	err = t.loadViews(conn, target)
 	if err != nil {
 		return err
@@ -347,6 +349,11 @@ func (t *Tracker) updatedTableSchema(th *discovery.TabletHealth, target *querypb
 	}
 	bv := map[string]*querypb.BindVariable{"tableNames": tables}
 	res, err := th.Conn.ExecuteInternal(t.ctx, target, mysql.FetchUpdatedTables, bv, 0, 0, nil)
+	var indexRes *sqltypes.Result
+	var indexErr error
+	if err == nil && t.details != nil {
+		indexRes, indexErr = th.Conn.ExecuteInternal(t.ctx, target, mysql.FetchUpdatedIndexes, bv, 0, 0, nil)
+	}
 	if err != nil {
 		t.tracked[target.Keyspace].setLoaded(false)
 		// TODO: optimize for the tables that got errored out.
@@ -365,8 +372,16 @@ func (t *Tracker) updatedTableSchema(th *discovery.TabletHealth, target *querypb
 	// so this is the only chance to delete
 	for _, tbl := range tablesUpdated {
 		t.tables.delete(target.Keyspace, tbl)
+		if t.details != nil {
+			t.details.delete(target.Keyspace, tbl)
+		}
 	}
 	t.updateTables(target.Keyspace, res)
+	if indexErr != nil {
+		log.Warningf("error fetching the indexes of %v: %v", tablesUpdated, indexErr)
+	} else if indexRes != nil {
+		t.updateIndexes(target.Keyspace, indexRes)
+	}
 	return true
 }
 
@@ -382,6 +397,10 @@ func (t *Tracker) updateTables(keyspace string, res *sqltypes.Result) {
 		cols := t.tables.get(keyspace, tbl)
 
 		t.tables.set(keyspace, tbl, append(cols, col))
+		if t.details != nil {
+			details := t.details.get(keyspace, tbl)
+			details.Columns = append(details.Columns, ColumnDetails{Name: colName, DataType: colType, CollationName: collation})
+		}
 	}
 }
 
@@ -473,6 +492,9 @@ func (t *Tracker) clearKeyspaceTables(ks string) {
 	if t.tables != nil && t.tables.m != nil {
 		delete(t.tables.m, ks)
 	}
+	if t.details != nil {
+		delete(t.details.m, ks)
+	}
 }
 
 type viewMap struct {
@@ -0,0 +1,364 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/sqlparser"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// The shadow traffic tees the queries vtgate serves to the vtgate of a staging
+// cluster, through the MySQL protocol, and compares how both serve them. A
+// fraction of the reads are teed, and all the writes if
+// --shadow_traffic_writes is set, so the staging cluster, like a branch of the
+// production databases, keeps the same data. The writes of a transaction are
+// teed together when it commits, and not at all if it rolls back.
+//
+// The queries are teed asynchronously through a bounded queue, so a slow or
+// unavailable staging cluster never slows down the production traffic: the
+// queries which don't fit in the queue are dropped.
+
+var (
+	shadowTrafficTarget      string
+	shadowTrafficUser        string
+	shadowTrafficPassword    string
+	shadowTrafficReadRatio   = 0.1
+	shadowTrafficWrites      bool
+	shadowTrafficConcurrency = 4
+	shadowTrafficQueueSize   = 1000
+	shadowTrafficMaxRows     = 10000
+
+	shadowTrafficQueries = stats.NewCountersWithMultiLabels("ShadowTrafficQueries", "Queries teed to the staging cluster, by statement type and result: match, row_mismatch, error_mismatch, unavailable or dropped", []string{"StmtType", "Result"})
+	shadowTrafficLatency = stats.NewTimings("ShadowTrafficLatency", "Latency of the queries teed to the staging cluster", "StmtType")
+)
+
+const (
+	shadowResultMatch         = "match"
+	shadowResultRowMismatch   = "row_mismatch"
+	shadowResultErrorMismatch = "error_mismatch"
+	shadowResultUnavailable   = "unavailable"
+	shadowResultDropped       = "dropped"
+)
+
+// maxShadowTransactions is how many open transactions the writes are buffered
+// for. The writes of the transactions beyond it are dropped.
+const maxShadowTransactions = 10000
+
+// shadowTraffic tees the queries, if --shadow_traffic_target is set.
+var shadowTraffic *shadowTrafficTee
+
+func registerShadowTrafficFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&shadowTrafficTarget, "shadow_traffic_target", shadowTrafficTarget, "The host:port of the MySQL port of the vtgate of a staging cluster to tee the queries to, and compare how it serves them. Empty disables the shadow traffic.")
+	fs.StringVar(&shadowTrafficUser, "shadow_traffic_user", shadowTrafficUser, "The user to tee the queries to --shadow_traffic_target as.")
+	fs.StringVar(&shadowTrafficPassword, "shadow_traffic_password", shadowTrafficPassword, "The password of --shadow_traffic_user.")
+	fs.Float64Var(&shadowTrafficReadRatio, "shadow_traffic_read_ratio", shadowTrafficReadRatio, "The fraction of the reads to tee, between 0 and 1.")
+	fs.BoolVar(&shadowTrafficWrites, "shadow_traffic_writes", shadowTrafficWrites, "If set, tee all the writes too, when their transactions commit. Only tee the writes to a copy of the data, like a branch.")
+	fs.IntVar(&shadowTrafficConcurrency, "shadow_traffic_concurrency", shadowTrafficConcurrency, "How many connections to the staging cluster tee the queries.")
+	fs.IntVar(&shadowTrafficQueueSize, "shadow_traffic_queue_size", shadowTrafficQueueSize, "How many queries wait to be teed at most. The queries beyond it are dropped.")
+	fs.IntVar(&shadowTrafficMaxRows, "shadow_traffic_max_rows", shadowTrafficMaxRows, "The maximum number of rows the teed reads may return on the staging cluster.")
+}
+
+// shadowConn is a connection to the staging cluster, like a *mysql.Conn.
+type shadowConn interface {
+	ExecuteFetch(query string, maxrows int, wantfields bool) (*sqltypes.Result, error)
+	Close()
+}
+
+// shadowQuery is a teed query, and how the production cluster served it.
+type shadowQuery struct {
+	stmtType     sqlparser.StatementType
+	database     string
+	sql          string
+	bindVars     map[string]*querypb.BindVariable
+	failed       bool
+	rowsAffected uint64
+	rowsReturned int
+	checksum     uint64
+}
+
+type shadowTrafficTee struct {
+	connect   func(ctx context.Context) (shadowConn, error)
+	readRatio float64
+	writes    bool
+	maxRows   int
+	queue     chan []*shadowQuery
+	logger    *logutil.ThrottledLogger
+
+	mu sync.Mutex
+	// pending are the writes of the open transactions, by session.
+	pending map[string][]*shadowQuery
+}
+
+func newShadowTrafficTee(connect func(ctx context.Context) (shadowConn, error), readRatio float64, writes bool, queueSize, maxRows int) *shadowTrafficTee {
+	return &shadowTrafficTee{
+		connect:   connect,
+		readRatio: readRatio,
+		writes:    writes,
+		maxRows:   maxRows,
+		queue:     make(chan []*shadowQuery, queueSize),
+		logger:    logutil.NewThrottledLogger("ShadowTraffic", 10*time.Second),
+		pending:   make(map[string][]*shadowQuery),
+	}
+}
+
+// tee tees a query vtgate served, if it is sampled.
+func (st *shadowTrafficTee) tee(safeSession *SafeSession, stmtType sqlparser.StatementType, database, sql string, bindVars map[string]*querypb.BindVariable, result *sqltypes.Result, err error) {
+	switch stmtType {
+	case sqlparser.StmtSelect:
+		if rand.Float64() >= st.readRatio {
+			return
+		}
+		st.enqueue([]*shadowQuery{newShadowQuery(stmtType, database, sql, bindVars, result, err)})
+	case sqlparser.StmtInsert, sqlparser.StmtReplace, sqlparser.StmtUpdate, sqlparser.StmtDelete:
+		if !st.writes {
+			return
+		}
+		query := newShadowQuery(stmtType, database, sql, bindVars, result, err)
+		if !safeSession.InTransaction() {
+			st.enqueue([]*shadowQuery{query})
+			return
+		}
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		session := safeSession.GetSessionUUID()
+		if _, ok := st.pending[session]; !ok && len(st.pending) >= maxShadowTransactions {
+			shadowTrafficQueries.Add([]string{stmtType.String(), shadowResultDropped}, 1)
+			return
+		}
+		st.pending[session] = append(st.pending[session], query)
+	case sqlparser.StmtCommit, sqlparser.StmtRollback:
+		if !st.writes {
+			return
+		}
+		st.mu.Lock()
+		queries := st.pending[safeSession.GetSessionUUID()]
+		delete(st.pending, safeSession.GetSessionUUID())
+		st.mu.Unlock()
+		if stmtType == sqlparser.StmtCommit && err == nil && len(queries) > 0 {
+			st.enqueue(queries)
+		}
+	}
+}
+
+// enqueue queues queries to be teed together, in a transaction if there are
+// several, or drops them if the queue is full.
+func (st *shadowTrafficTee) enqueue(queries []*shadowQuery) {
+	select {
+	case st.queue <- queries:
+	default:
+		for _, query := range queries {
+			shadowTrafficQueries.Add([]string{query.stmtType.String(), shadowResultDropped}, 1)
+		}
+	}
+}
+
+func newShadowQuery(stmtType sqlparser.StatementType, database, sql string, bindVars map[string]*querypb.BindVariable, result *sqltypes.Result, err error) *shadowQuery {
+	query := &shadowQuery{stmtType: stmtType, database: database, sql: sql, failed: err != nil}
+	if len(bindVars) > 0 {
+		query.bindVars = make(map[string]*querypb.BindVariable, len(bindVars))
+		for name, bv := range bindVars {
+			query.bindVars[name] = bv
+		}
+	}
+	if result != nil {
+		query.rowsAffected = result.RowsAffected
+		query.rowsReturned = len(result.Rows)
+		query.checksum = shadowChecksum(result)
+	}
+	return query
+}
+
+// shadowChecksum is a checksum of the rows of a result which doesn't depend on
+// their order, since the queries without an ORDER BY may return them in any.
+func shadowChecksum(result *sqltypes.Result) uint64 {
+	var sum uint64
+	for _, row := range result.Rows {
+		h := fnv.New64a()
+		for _, value := range row {
+			if value.IsNull() {
+				_, _ = h.Write([]byte{0xff})
+				continue
+			}
+			_, _ = h.Write(strconv.AppendInt(nil, int64(len(value.Raw())), 10))
+			_, _ = h.Write([]byte{':'})
+			_, _ = h.Write(value.Raw())
+		}
+		sum += h.Sum64()
+	}
+	return sum
+}
+
+// run tees the queued queries on a connection of its own until ctx is done.
+func (st *shadowTrafficTee) run(ctx context.Context) {
+	var conn shadowConn
+	database := ""
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for {
+		var queries []*shadowQuery
+		select {
+		case <-ctx.Done():
+			return
+		case queries = <-st.queue:
+		}
+		if conn == nil {
+			var err error
+			if conn, err = st.connect(ctx); err != nil {
+				st.logger.Warningf("cannot connect to the staging cluster %v: %v", shadowTrafficTarget, err)
+				for _, query := range queries {
+					shadowTrafficQueries.Add([]string{query.stmtType.String(), shadowResultUnavailable}, 1)
+				}
+				continue
+			}
+			database = ""
+		}
+		transaction := len(queries) > 1
+		if transaction {
+			if _, err := conn.ExecuteFetch("begin", 0, false); err != nil {
+				conn = st.resetOnConnErr(conn, err)
+				for _, query := range queries {
+					shadowTrafficQueries.Add([]string{query.stmtType.String(), shadowResultUnavailable}, 1)
+				}
+				continue
+			}
+		}
+		for _, query := range queries {
+			if conn == nil {
+				shadowTrafficQueries.Add([]string{query.stmtType.String(), shadowResultUnavailable}, 1)
+				continue
+			}
+			if query.database != "" && query.database != database {
+				if _, err := conn.ExecuteFetch("use "+sqlparser.String(sqlparser.NewIdentifierCS(query.database)), 0, false); err != nil {
+					result := query.compare(nil, err)
+					shadowTrafficQueries.Add([]string{query.stmtType.String(), result}, 1)
+					if result == shadowResultUnavailable {
+						conn = st.resetOnConnErr(conn, err)
+					}
+					continue
+				}
+				database = query.database
+			}
+			var qr *sqltypes.Result
+			start := time.Now()
+			sql, err := query.boundSQL()
+			if err == nil {
+				qr, err = conn.ExecuteFetch(sql, st.maxRows, false)
+				shadowTrafficLatency.Record(query.stmtType.String(), start)
+			}
+			result := query.compare(qr, err)
+			shadowTrafficQueries.Add([]string{query.stmtType.String(), result}, 1)
+			switch result {
+			case shadowResultUnavailable:
+				conn = st.resetOnConnErr(conn, err)
+			case shadowResultRowMismatch, shadowResultErrorMismatch:
+				piiSafeSQL, redactErr := sqlparser.RedactSQLQuery(query.sql)
+				if redactErr != nil {
+					piiSafeSQL = query.stmtType.String()
+				}
+				st.logger.Infof("the staging cluster served %q differently: %s, error: %v", piiSafeSQL, result, err)
+			}
+		}
+		if transaction && conn != nil {
+			if _, err := conn.ExecuteFetch("commit", 0, false); err != nil {
+				conn = st.resetOnConnErr(conn, err)
+			}
+		}
+	}
+}
+
+// resetOnConnErr closes the connection and returns nil if err is a connection
+// error, so the next queries reconnect.
+func (st *shadowTrafficTee) resetOnConnErr(conn shadowConn, err error) shadowConn {
+	if !mysql.IsConnErr(err) {
+		return conn
+	}
+	st.logger.Warningf("lost the connection to the staging cluster %v: %v", shadowTrafficTarget, err)
+	conn.Close()
+	return nil
+}
+
+// boundSQL returns the SQL of the query with its bind variables bound.
+func (query *shadowQuery) boundSQL() (string, error) {
+	if len(query.bindVars) == 0 {
+		return query.sql, nil
+	}
+	stmt, err := sqlparser.Parse(query.sql)
+	if err != nil {
+		return "", err
+	}
+	return sqlparser.NewParsedQuery(stmt).GenerateQuery(query.bindVars, nil)
+}
+
+// compare returns how the staging cluster served the query compared to the
+// production cluster.
+func (query *shadowQuery) compare(qr *sqltypes.Result, err error) string {
+	switch {
+	case err != nil && mysql.IsConnErr(err):
+		return shadowResultUnavailable
+	case query.failed != (err != nil):
+		return shadowResultErrorMismatch
+	case err != nil:
+		return shadowResultMatch
+	case query.rowsAffected != qr.RowsAffected || query.rowsReturned != len(qr.Rows) || query.checksum != shadowChecksum(qr):
+		return shadowResultRowMismatch
+	}
+	return shadowResultMatch
+}
+
+// initShadowTraffic starts teeing the queries, if --shadow_traffic_target is
+// set.
+func initShadowTraffic() {
+	if shadowTrafficTarget == "" {
+		return
+	}
+	host, portStr, err := net.SplitHostPort(shadowTrafficTarget)
+	if err != nil {
+		log.Exitf("invalid --shadow_traffic_target %q: %v", shadowTrafficTarget, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		log.Exitf("invalid --shadow_traffic_target %q: %v", shadowTrafficTarget, err)
+	}
+	if shadowTrafficReadRatio < 0 || shadowTrafficReadRatio > 1 {
+		log.Exitf("invalid --shadow_traffic_read_ratio %v, must be between 0 and 1", shadowTrafficReadRatio)
+	}
+	params := &mysql.ConnParams{Host: host, Port: port, Uname: shadowTrafficUser, Pass: shadowTrafficPassword}
+	connect := func(ctx context.Context) (shadowConn, error) {
+		return mysql.Connect(ctx, params)
+	}
+	shadowTraffic = newShadowTrafficTee(connect, shadowTrafficReadRatio, shadowTrafficWrites, shadowTrafficQueueSize, shadowTrafficMaxRows)
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < shadowTrafficConcurrency; i++ {
+		go shadowTraffic.run(ctx)
+	}
+	servenv.OnTermSync(cancel)
+	log.Infof("Teeing %v of the reads to %v, and the writes: %v", shadowTrafficReadRatio, shadowTrafficTarget, shadowTrafficWrites)
+}
+
+func init() {
+	servenv.OnParseFor("vtgate", registerShadowTrafficFlags)
+	servenv.OnRun(initShadowTraffic)
+}
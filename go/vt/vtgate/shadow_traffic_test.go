@@ -0,0 +1,152 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+)
+
+// fakeShadowConn serves the queries with the results of a map, or fails them.
+type fakeShadowConn struct {
+	mu       sync.Mutex
+	results  map[string]*sqltypes.Result
+	executed []string
+}
+
+func (c *fakeShadowConn) ExecuteFetch(query string, maxrows int, wantfields bool) (*sqltypes.Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.executed = append(c.executed, query)
+	if qr, ok := c.results[query]; ok {
+		return qr, nil
+	}
+	if query == "select lost" {
+		return nil, mysql.NewSQLError(mysql.CRServerLost, mysql.SSUnknownSQLState, "lost connection")
+	}
+	return nil, errors.New("unknown query")
+}
+
+func (c *fakeShadowConn) Close() {}
+
+func (c *fakeShadowConn) getExecuted() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.executed...)
+}
+
+func TestShadowTraffic(t *testing.T) {
+	rows := sqltypes.MakeTestResult(sqltypes.MakeTestFields("id|name", "int64|varchar"), "1|a", "2|b")
+	reversed := sqltypes.MakeTestResult(sqltypes.MakeTestFields("id|name", "int64|varchar"), "2|b", "1|a")
+	conn := &fakeShadowConn{results: map[string]*sqltypes.Result{
+		"use ks":                       {},
+		"select * from t":              reversed,
+		"select * from t where id = 1": {},
+		"begin":                        {},
+		"commit":                       {},
+		"insert into t values (3)":     {RowsAffected: 1},
+		"update t set name = 'c'":      {RowsAffected: 1},
+	}}
+	connects := 0
+	st := newShadowTrafficTee(func(ctx context.Context) (shadowConn, error) {
+		connects++
+		return conn, nil
+	}, 1, true, 10, 100)
+
+	session := NewSafeSession(&vtgatepb.Session{SessionUUID: "s1", Autocommit: true})
+	st.tee(session, sqlparser.StmtSelect, "ks", "select * from t", nil, rows, nil)
+	st.tee(session, sqlparser.StmtSelect, "ks", "select * from t where id = ?", map[string]*querypb.BindVariable{"v1": sqltypes.Int64BindVariable(1)}, rows, nil)
+	st.tee(session, sqlparser.StmtShow, "ks", "show tables", nil, rows, nil)
+
+	// The writes of a transaction are teed when it commits.
+	session.Session.InTransaction = true
+	st.tee(session, sqlparser.StmtInsert, "ks", "insert into t values (3)", nil, &sqltypes.Result{RowsAffected: 1}, nil)
+	st.tee(session, sqlparser.StmtUpdate, "ks", "update t set name = 'c'", nil, &sqltypes.Result{RowsAffected: 2}, nil)
+	assert.Len(t, st.queue, 2)
+	session.Session.InTransaction = false
+	st.tee(session, sqlparser.StmtCommit, "ks", "commit", nil, &sqltypes.Result{}, nil)
+
+	// The writes of a rolled back transaction aren't.
+	session.Session.InTransaction = true
+	st.tee(session, sqlparser.StmtDelete, "ks", "delete from t", nil, &sqltypes.Result{RowsAffected: 1}, nil)
+	session.Session.InTransaction = false
+	st.tee(session, sqlparser.StmtRollback, "ks", "rollback", nil, &sqltypes.Result{}, nil)
+	assert.Len(t, st.queue, 3)
+	assert.Empty(t, st.pending)
+
+	// The lost connection is reopened.
+	st.tee(session, sqlparser.StmtSelect, "", "select lost", nil, rows, nil)
+	st.tee(session, sqlparser.StmtSelect, "ks", "select * from t", nil, rows, nil)
+
+	shadowTrafficQueries.ResetAll()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go st.run(ctx)
+	require.Eventually(t, func() bool { return len(st.queue) == 0 && len(conn.getExecuted()) == 10 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{
+		"use ks",
+		"select * from t",
+		"select * from t where id = 1",
+		"begin",
+		"insert into t values (3)",
+		"update t set name = 'c'",
+		"commit",
+		"select lost",
+		"use ks",
+		"select * from t",
+	}, conn.getExecuted())
+	assert.Equal(t, 2, connects)
+	assert.Equal(t, map[string]int64{
+		"SELECT.match":        2,
+		"SELECT.row_mismatch": 1,
+		"INSERT.match":        1,
+		"UPDATE.row_mismatch": 1,
+		"SELECT.unavailable":  1,
+	}, shadowTrafficQueries.Counts())
+}
+
+func TestShadowTrafficDrops(t *testing.T) {
+	st := newShadowTrafficTee(nil, 0, false, 1, 100)
+	session := NewSafeSession(&vtgatepb.Session{SessionUUID: "s1", Autocommit: true})
+	// Neither the reads nor the writes are sampled.
+	st.tee(session, sqlparser.StmtSelect, "ks", "select * from t", nil, &sqltypes.Result{}, nil)
+	st.tee(session, sqlparser.StmtInsert, "ks", "insert into t values (1)", nil, &sqltypes.Result{}, nil)
+	assert.Empty(t, st.queue)
+
+	shadowTrafficQueries.ResetAll()
+	st.readRatio = 1
+	st.tee(session, sqlparser.StmtSelect, "ks", "select * from t", nil, &sqltypes.Result{}, nil)
+	st.tee(session, sqlparser.StmtSelect, "ks", "select * from t", nil, &sqltypes.Result{}, nil)
+	assert.Len(t, st.queue, 1)
+	assert.Equal(t, map[string]int64{"SELECT.dropped": 1}, shadowTrafficQueries.Counts())
+}
+
+func TestShadowQueryCompare(t *testing.T) {
+	rows := sqltypes.MakeTestResult(sqltypes.MakeTestFields("id|name", "int64|varchar"), "1|a", "2|null")
+	query := newShadowQuery(sqlparser.StmtSelect, "ks", "select * from t", nil, rows, nil)
+	assert.Equal(t, shadowResultMatch, query.compare(sqltypes.MakeTestResult(rows.Fields, "2|null", "1|a"), nil))
+	assert.Equal(t, shadowResultRowMismatch, query.compare(sqltypes.MakeTestResult(rows.Fields, "1|a", "2|"), nil))
+	assert.Equal(t, shadowResultRowMismatch, query.compare(sqltypes.MakeTestResult(rows.Fields, "1|a"), nil))
+	assert.Equal(t, shadowResultErrorMismatch, query.compare(nil, errors.New("table not found")))
+	assert.Equal(t, shadowResultUnavailable, query.compare(nil, mysql.NewSQLError(mysql.CRServerGone, mysql.SSUnknownSQLState, "gone")))
+
+	failed := newShadowQuery(sqlparser.StmtSelect, "ks", "select * from t", nil, nil, errors.New("table not found"))
+	assert.Equal(t, shadowResultMatch, failed.compare(nil, errors.New("table not found")))
+	assert.Equal(t, shadowResultErrorMismatch, failed.compare(rows, nil))
+}
@@ -0,0 +1,102 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"sync"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// A session which sets snapshot_read_gtid reads a snapshot of the data on the
+// replicas: its reads are routed to the replicas, which wait until they
+// executed the GTID set of the snapshot before they serve them, so a report
+// made of several queries reads the data at least as of the same point,
+// without a query on the primary. In a read only transaction, all the queries
+// read the same snapshot of the replica, which contains the GTID set.
+
+// snapshotReads is the GTID sets of the snapshots the sessions read, by the
+// UUID of the session.
+var snapshotReads = &snapshotReadRegistry{gtids: map[string]string{}}
+
+type snapshotReadRegistry struct {
+	mu    sync.Mutex
+	gtids map[string]string
+}
+
+func (r *snapshotReadRegistry) get(sessionUUID string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.gtids[sessionUUID]
+}
+
+func (r *snapshotReadRegistry) set(sessionUUID, gtid string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if gtid == "" {
+		delete(r.gtids, sessionUUID)
+		return
+	}
+	r.gtids[sessionUUID] = gtid
+}
+
+// SetSnapshotReadGTID pins the reads of the session to the snapshot of a GTID
+// set, or unpins them if it is empty.
+func (session *SafeSession) SetSnapshotReadGTID(gtid string) error {
+	sessionUUID := session.GetSessionUUID()
+	if sessionUUID == "" {
+		return vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "snapshot reads need a session UUID")
+	}
+	if gtid != "" {
+		gtidSet, err := mysql.ParseMysql56GTIDSet(gtid)
+		if err != nil {
+			return vterrors.NewErrorf(vtrpcpb.Code_INVALID_ARGUMENT, vterrors.WrongValueForVar, "invalid snapshot_read_gtid: %v", err)
+		}
+		gtid = gtidSet.String()
+	}
+	// The options of the session keep the GTID the last query waited for,
+	// which the next queries set again.
+	options := session.GetOrCreateOptions()
+	session.mu.Lock()
+	options.ReadAfterWriteGtid = ""
+	session.mu.Unlock()
+	snapshotReads.set(sessionUUID, gtid)
+	return nil
+}
+
+// GetSnapshotReadGTID returns the GTID set of the snapshot the session reads,
+// or an empty string.
+func (session *SafeSession) GetSnapshotReadGTID() string {
+	return snapshotReads.get(session.GetSessionUUID())
+}
+
+// waitsForGTID returns whether the queries of a session wait on the replicas
+// until they executed a GTID set: the one of the snapshot the session reads,
+// or the one of its read after write consistency.
+func waitsForGTID(session *SafeSession) bool {
+	return session.IsNonWeakReadAfterWriteConsistencyEnable() || session.GetSnapshotReadGTID() != ""
+}
+
+// snapshotReadTabletType returns the tablet type of a query of a session which
+// reads a snapshot: the replicas for the reads, in or out of a read only
+// transaction, else the type the read write splitting suggested.
+func snapshotReadTabletType(safeSession *SafeSession, sql string, isReadOnlyTx bool, suggested topodatapb.TabletType) (topodatapb.TabletType, error) {
+	if isReadOnlyTx {
+		return topodatapb.TabletType_REPLICA, nil
+	}
+	if safeSession.InTransaction() || safeSession.HasCreatedTempTables() || safeSession.HasAdvisoryLock() {
+		return suggested, nil
+	}
+	support, err := isSQLSupportReadWriteSplit(sql)
+	if err != nil || !support {
+		return suggested, err
+	}
+	return topodatapb.TabletType_REPLICA, nil
+}
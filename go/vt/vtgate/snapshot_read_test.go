@@ -0,0 +1,103 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+)
+
+const snapshotReadTestGTID = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+
+func TestSnapshotReadTabletType(t *testing.T) {
+	session := NewSafeSession(&vtgatepb.Session{SessionUUID: "snapshot-read", ReadWriteSplittingPolicy: "disable"})
+	defer snapshotReads.set("snapshot-read", "")
+
+	assert.ErrorContains(t, session.SetSnapshotReadGTID("not a gtid"), "invalid snapshot_read_gtid")
+	assert.ErrorContains(t, NewSafeSession(&vtgatepb.Session{}).SetSnapshotReadGTID(snapshotReadTestGTID), "snapshot reads need a session UUID")
+	require.NoError(t, session.SetSnapshotReadGTID(" "+snapshotReadTestGTID))
+	assert.Equal(t, snapshotReadTestGTID, session.GetSnapshotReadGTID())
+
+	// The reads go to the replicas, even if the read write splitting is
+	// disabled, but not the writes.
+	tabletType := func(sql string) topodatapb.TabletType {
+		tabletType, err := GetSuggestedTabletType(session, sql)
+		require.NoError(t, err)
+		return tabletType
+	}
+	assert.Equal(t, topodatapb.TabletType_REPLICA, tabletType("select * from t"))
+	assert.Equal(t, topodatapb.TabletType_PRIMARY, tabletType("insert into t values (1)"))
+	assert.Equal(t, topodatapb.TabletType_PRIMARY, tabletType("select last_insert_id()"))
+
+	// So do all the queries of a read only transaction, and none of a read
+	// write one.
+	session.Session.InTransaction = true
+	assert.Equal(t, topodatapb.TabletType_PRIMARY, tabletType("select * from t"))
+	session.Session.TransactionAccessMode = vtgatepb.TransactionAccessMode_READ_ONLY
+	assert.Equal(t, topodatapb.TabletType_REPLICA, tabletType("select last_insert_id()"))
+	session.Session.InTransaction = false
+
+	require.NoError(t, session.SetSnapshotReadGTID(""))
+	assert.Equal(t, topodatapb.TabletType_PRIMARY, tabletType("select * from t"))
+}
+
+func TestSnapshotReadOptions(t *testing.T) {
+	session := NewSafeSession(&vtgatepb.Session{SessionUUID: "snapshot-read-options"})
+	defer snapshotReads.set("snapshot-read-options", "")
+	require.NoError(t, session.SetSnapshotReadGTID(snapshotReadTestGTID))
+	assert.True(t, waitsForGTID(session))
+
+	opts := session.Session.Options
+	target := &querypb.Target{Keyspace: KsTestUnsharded, TabletType: topodatapb.TabletType_REPLICA}
+	require.NoError(t, setReadAfterWriteOpts(context.Background(), opts, session, nil, nil, target))
+	assert.Equal(t, snapshotReadTestGTID, opts.ReadAfterWriteGtid)
+	assert.Equal(t, defaultReadAfterWriteTimeout, opts.ReadAfterWriteTimeout)
+
+	// The snapshot takes precedence over the read after write consistency.
+	session.SetReadAfterWriteConsistency(vtgatepb.ReadAfterWriteConsistency_SESSION)
+	session.SetReadAfterWriteGTID("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-9")
+	session.SetReadAfterWriteTimeout(3)
+	require.NoError(t, setReadAfterWriteOpts(context.Background(), opts, session, nil, nil, target))
+	assert.Equal(t, snapshotReadTestGTID, opts.ReadAfterWriteGtid)
+	assert.Equal(t, 3.0, opts.ReadAfterWriteTimeout)
+}
+
+func TestExecutorSnapshotReadGTID(t *testing.T) {
+	executor, _, _, sbclookup := createExecutorEnv()
+	executor.normalize = true
+	ctx := context.Background()
+	// The tablet type of the target takes precedence over the snapshot.
+	session := NewAutocommitSession(&vtgatepb.Session{TargetString: KsTestUnsharded + "@primary", SessionUUID: "snapshot-read-executor"})
+	exec := func(sql string) *sqltypes.Result {
+		t.Helper()
+		qr, err := executor.Execute(ctx, "TestExecutorSnapshotReadGTID", session, sql, nil)
+		require.NoError(t, err)
+		return qr
+	}
+
+	exec("set @@snapshot_read_gtid = '" + snapshotReadTestGTID + "'")
+	exec("select @@snapshot_read_gtid")
+	queries := sbclookup.Queries
+	assert.Equal(t, snapshotReadTestGTID, string(queries[len(queries)-1].BindVariables["__vtsnapshot_read_gtid"].Value))
+
+	// 'current' pins the reads to the GTID set the primary executed.
+	sbclookup.SetResults([]*sqltypes.Result{sqltypes.MakeTestResult(sqltypes.MakeTestFields("gtid", "varchar"), "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-7")})
+	exec("set @@snapshot_read_gtid = 'current'")
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-7", session.GetSnapshotReadGTID())
+
+	// The snapshot is forgotten with the session.
+	require.NoError(t, executor.CloseSession(ctx, session))
+	assert.Empty(t, session.GetSnapshotReadGTID())
+}
@@ -0,0 +1,164 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"sync"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// A temporary table only lives in the MySQL connection which created it, so a
+// session which creates one is pinned to a reserved connection of the primary
+// until it disconnects, the reserved connection being closed, and not reused,
+// once released. The temporary tables of each session are tracked, so the
+// session is unpinned, and goes back to the pooled connections and to the
+// read write splitting, once it dropped all of them.
+
+// tempTables is the temporary tables of the sessions.
+var tempTables = newTempTableRegistry()
+
+func init() {
+	stats.NewGaugeFunc("TempTables", "The number of temporary tables the sessions created and didn't drop", tempTables.count)
+}
+
+// sessionTempTables is the temporary tables of a session.
+type sessionTempTables struct {
+	// tables is the names of the tables, qualified by their keyspace.
+	tables map[string]bool
+	// reserved is whether the session was on reserved connections before it
+	// created its first temporary table, for another reason, in which case it
+	// stays on them.
+	reserved bool
+}
+
+// tempTableRegistry tracks the temporary tables of the sessions, by the UUID
+// of the session.
+type tempTableRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionTempTables
+}
+
+func newTempTableRegistry() *tempTableRegistry {
+	return &tempTableRegistry{sessions: map[string]*sessionTempTables{}}
+}
+
+// created records that a session created a temporary table.
+func (r *tempTableRegistry) created(sessionUUID, table string, reserved bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[sessionUUID]
+	if !ok {
+		session = &sessionTempTables{tables: map[string]bool{}, reserved: reserved}
+		r.sessions[sessionUUID] = session
+	}
+	session.tables[table] = true
+}
+
+// renamed records that a session renamed a temporary table. The other tables
+// are ignored.
+func (r *tempTableRegistry) renamed(sessionUUID, from, to string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[sessionUUID]
+	if !ok || !session.tables[from] {
+		return
+	}
+	delete(session.tables, from)
+	session.tables[to] = true
+}
+
+// dropped records that a session dropped tables, and returns whether it
+// dropped its last temporary table, and whether it was on reserved
+// connections before it created its first one.
+func (r *tempTableRegistry) dropped(sessionUUID string, tables []string) (last bool, reserved bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[sessionUUID]
+	if !ok {
+		return false, false
+	}
+	for _, table := range tables {
+		delete(session.tables, table)
+	}
+	if len(session.tables) > 0 {
+		return false, session.reserved
+	}
+	delete(r.sessions, sessionUUID)
+	return true, session.reserved
+}
+
+// forget forgets the temporary tables of a session which disconnected, which
+// MySQL dropped with its connection.
+func (r *tempTableRegistry) forget(sessionUUID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, sessionUUID)
+}
+
+func (r *tempTableRegistry) count() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, session := range r.sessions {
+		count += len(session.tables)
+	}
+	return int64(count)
+}
+
+// tempTableName returns the name of a table, qualified by its keyspace, or by
+// the keyspace of the session if it isn't.
+func tempTableName(keyspace string, table sqlparser.TableName) string {
+	if !table.Qualifier.IsEmpty() {
+		keyspace = table.Qualifier.String()
+	}
+	return keyspace + "." + table.Name.String()
+}
+
+// trackTempTables records the temporary tables a DDL statement, which
+// succeeded, created, renamed or dropped, and unpins the session once it
+// dropped the last one. reserved is whether the session was on reserved
+// connections before the statement.
+func (e *Executor) trackTempTables(ctx context.Context, safeSession *SafeSession, keyspace string, stmt sqlparser.Statement, reserved bool) {
+	sessionUUID := safeSession.GetSessionUUID()
+	if sessionUUID == "" {
+		// The session can't be tracked, and stays pinned.
+		return
+	}
+	switch stmt := stmt.(type) {
+	case *sqlparser.CreateTable:
+		if stmt.Temp {
+			tempTables.created(sessionUUID, tempTableName(keyspace, stmt.Table), reserved)
+		}
+	case *sqlparser.RenameTable:
+		for _, pair := range stmt.TablePairs {
+			tempTables.renamed(sessionUUID, tempTableName(keyspace, pair.FromTable), tempTableName(keyspace, pair.ToTable))
+		}
+	case *sqlparser.DropTable:
+		tables := make([]string, 0, len(stmt.FromTables))
+		for _, table := range stmt.FromTables {
+			tables = append(tables, tempTableName(keyspace, table))
+		}
+		last, wasReserved := tempTables.dropped(sessionUUID, tables)
+		if !last {
+			return
+		}
+		safeSession.GetOrCreateOptions().HasCreatedTempTables = false
+		// The reserved connections are kept if the session needs them for
+		// anything else: a transaction, or system variables.
+		if wasReserved || safeSession.InTransaction() || safeSession.HasSystemVariables() {
+			return
+		}
+		if err := e.txConn.Release(ctx, safeSession); err != nil {
+			log.Warningf("failed to release the reserved connections of session %s after it dropped its temporary tables: %v", sessionUUID, err)
+			return
+		}
+		safeSession.SetReservedConn(false)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+)
+
+func TestTempTableRegistry(t *testing.T) {
+	r := newTempTableRegistry()
+	r.created("s1", "ks.t1", false)
+	r.created("s1", "ks.t2", true)
+	r.created("s2", "ks.t1", true)
+	assert.EqualValues(t, 3, r.count())
+
+	r.renamed("s1", "ks.t2", "ks.t3")
+	// The tables which aren't temporary are ignored.
+	r.renamed("s1", "ks.other", "ks.t4")
+	assert.Equal(t, map[string]bool{"ks.t1": true, "ks.t3": true}, r.sessions["s1"].tables)
+
+	last, reserved := r.dropped("s1", []string{"ks.t1", "ks.other"})
+	assert.False(t, last)
+	assert.False(t, reserved)
+	last, reserved = r.dropped("s1", []string{"ks.t3"})
+	assert.True(t, last)
+	assert.False(t, reserved)
+	last, _ = r.dropped("s1", []string{"ks.t3"})
+	assert.False(t, last)
+
+	r.forget("s2")
+	assert.EqualValues(t, 0, r.count())
+}
+
+func TestExecutorTempTables(t *testing.T) {
+	executor, _, _, sbclookup := createExecutorEnv()
+	ctx := context.Background()
+	session := NewAutocommitSession(&vtgatepb.Session{TargetString: KsTestUnsharded, SessionUUID: "temp-tables"})
+	defer tempTables.forget("temp-tables")
+	exec := func(sql string) {
+		t.Helper()
+		_, err := executor.Execute(ctx, "TestExecutorTempTables", session, sql, nil)
+		require.NoError(t, err)
+	}
+
+	exec("create temporary table t1(id bigint)")
+	exec("create temporary table t2(id bigint)")
+	assert.True(t, session.HasCreatedTempTables())
+	assert.True(t, session.InReservedConn())
+	assert.EqualValues(t, 1, sbclookup.ReserveCount.Get())
+
+	exec("rename table t2 to t3")
+	exec("drop temporary table t1")
+	assert.True(t, session.HasCreatedTempTables())
+	assert.True(t, session.InReservedConn())
+
+	// The session is unpinned once it dropped its last temporary table.
+	exec("drop table t3")
+	assert.False(t, session.HasCreatedTempTables())
+	assert.False(t, session.InReservedConn())
+	assert.EqualValues(t, 1, sbclookup.ReleaseCount.Get())
+	assert.Empty(t, tempTables.sessions["temp-tables"])
+}
+
+func TestExecutorTempTablesStayReserved(t *testing.T) {
+	executor, _, _, sbclookup := createExecutorEnv()
+	ctx := context.Background()
+	session := NewAutocommitSession(&vtgatepb.Session{TargetString: KsTestUnsharded, SessionUUID: "temp-tables-reserved"})
+	defer tempTables.forget("temp-tables-reserved")
+
+	// The connections the session reserved for a system variable are kept.
+	session.SetSystemVariable("sql_mode", "''")
+	session.SetReservedConn(true)
+	_, err := executor.Execute(ctx, "TestExecutorTempTablesStayReserved", session, "create temporary table t1(id bigint)", nil)
+	require.NoError(t, err)
+	_, err = executor.Execute(ctx, "TestExecutorTempTablesStayReserved", session, "drop temporary table t1", nil)
+	require.NoError(t, err)
+	assert.False(t, session.HasCreatedTempTables())
+	assert.True(t, session.InReservedConn())
+	assert.EqualValues(t, 0, sbclookup.ReleaseCount.Get())
+
+	// So are the connections of a session which disconnects, which the
+	// release closes.
+	_, err = executor.Execute(ctx, "TestExecutorTempTablesStayReserved", session, "create temporary table t1(id bigint)", nil)
+	require.NoError(t, err)
+	require.NoError(t, executor.CloseSession(ctx, session))
+	assert.Empty(t, tempTables.sessions["temp-tables-reserved"])
+	assert.EqualValues(t, 1, sbclookup.ReleaseCount.Get())
+}
@@ -62,6 +62,7 @@ import (
 	"vitess.io/vitess/go/vt/vtgate/semantics"
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
 	"vitess.io/vitess/go/vt/vtgate/vschemaacl"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
 )
 
 var _ engine.VCursor = (*vcursorImpl)(nil)
@@ -84,11 +85,16 @@ type iExecute interface {
 	showShards(ctx context.Context, filter *sqlparser.ShowFilter, destTabletType topodatapb.TabletType) (*sqltypes.Result, error)
 	showTablets(filter *sqlparser.ShowFilter) (*sqltypes.Result, error)
 	showTabletsPlans(filter *sqlparser.ShowFilter) (*sqltypes.Result, error)
+	showFilterStats(ctx context.Context, filter *sqlparser.ShowFilter) (*sqltypes.Result, error)
 	showVitessMetadata(ctx context.Context, filter *sqlparser.ShowFilter) (*sqltypes.Result, error)
 	setVitessMetadata(ctx context.Context, name, value string) error
 	showWorkload(filter *sqlparser.ShowFilter) (*sqltypes.Result, error)
 	showLastSeenGTID(filter *sqlparser.ShowFilter) (*sqltypes.Result, error)
 	showFailPoint(filter *sqlparser.ShowFilter) (*sqltypes.Result, error)
+	virtualTable(ctx context.Context, keyspace, name string) (*sqltypes.Result, error)
+	exportFilters(ctx context.Context, keyspace, database, format string) (*sqltypes.Result, error)
+	importFilters(ctx context.Context, keyspace, database, document string, prune bool) (*sqltypes.Result, error)
+	explainFilter(ctx context.Context, keyspace, query string, session *rules.ExplainSession) (*sqltypes.Result, error)
 	// TODO: remove when resolver is gone
 	ParseDestinationTarget(targetString string) (string, topodatapb.TabletType, key.Destination, error)
 	reloadExec(ctx context.Context, reloadType *sqlparser.ReloadType) error
@@ -236,6 +242,11 @@ func (vc *vcursorImpl) ExceedsMaxMemoryRows(numRows int) bool {
 	return !vc.ignoreMaxMemoryRows && numRows > maxMemoryRows
 }
 
+// SortSpiller returns the spiller of in-memory sorts, nil if the sort_spill_dir flag isn't set.
+func (vc *vcursorImpl) SortSpiller() *engine.SortSpiller {
+	return sortSpiller
+}
+
 // SetIgnoreMaxMemoryRows sets the ignoreMaxMemoryRows value.
 func (vc *vcursorImpl) SetIgnoreMaxMemoryRows(ignoreMaxMemoryRows bool) {
 	vc.ignoreMaxMemoryRows = ignoreMaxMemoryRows
@@ -1022,6 +1033,11 @@ func (vc *vcursorImpl) SetReadAfterWriteConsistency(vtgtid vtgatepb.ReadAfterWri
 	vc.safeSession.SetReadAfterWriteConsistency(vtgtid)
 }
 
+// SetSnapshotReadGTID implements the SessionActions interface
+func (vc *vcursorImpl) SetSnapshotReadGTID(gtid string) error {
+	return vc.safeSession.SetSnapshotReadGTID(gtid)
+}
+
 // HasCreatedTempTable implements the SessionActions interface
 func (vc *vcursorImpl) HasCreatedTempTable() {
 	vc.safeSession.GetOrCreateOptions().HasCreatedTempTables = true
@@ -1187,11 +1203,50 @@ func (vc *vcursorImpl) ShowExec(ctx context.Context, command sqlparser.ShowComma
 		return vc.executor.showFailPoint(filter)
 	case sqlparser.TabletsPlans:
 		return vc.executor.showTabletsPlans(filter)
+	case sqlparser.FilterStats:
+		return vc.executor.showFilterStats(ctx, filter)
 	default:
 		return nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "bug: unexpected show command: %v", command)
 	}
 }
 
+// VirtualTableExec implements the VCursor interface.
+func (vc *vcursorImpl) VirtualTableExec(ctx context.Context, keyspace, name string) (*sqltypes.Result, error) {
+	return vc.executor.virtualTable(ctx, keyspace, name)
+}
+
+// ExportFilters implements the VCursor interface.
+func (vc *vcursorImpl) ExportFilters(ctx context.Context, database, format string) (*sqltypes.Result, error) {
+	return vc.executor.exportFilters(ctx, vc.keyspace, database, format)
+}
+
+// ImportFilters implements the VCursor interface. The import has its own
+// transaction, so it can't be in the transaction of the session.
+func (vc *vcursorImpl) ImportFilters(ctx context.Context, database, document string, prune bool) (*sqltypes.Result, error) {
+	if vc.InTransaction() {
+		return nil, vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "IMPORT FILTERS can't run in a transaction")
+	}
+	return vc.executor.importFilters(ctx, vc.keyspace, database, document, prune)
+}
+
+// ExplainFilter implements the VCursor interface. The query is explained as
+// sent by the session, or by user from ip if they are set.
+func (vc *vcursorImpl) ExplainFilter(ctx context.Context, query, database, user, ip string) (*sqltypes.Result, error) {
+	if database == "" {
+		database = vc.keyspace
+	}
+	if user == "" {
+		user = callerid.GetUsername(callerid.ImmediateCallerIDFromContext(ctx))
+	}
+	return vc.executor.explainFilter(ctx, vc.keyspace, query, &rules.ExplainSession{
+		Database:      database,
+		IP:            ip,
+		User:          user,
+		WorkloadClass: callerid.GetSubcomponent(callerid.EffectiveCallerIDFromContext(ctx)),
+		InTransaction: vc.InTransaction(),
+	})
+}
+
 func (vc *vcursorImpl) GetVSchema() *vindexes.VSchema {
 	return vc.vschema
 }
@@ -1265,3 +1320,8 @@ func (vc *vcursorImpl) FindRoutedShard(keyspace, shard string) (keyspaceName str
 func (vc *vcursorImpl) IsViewsEnabled() bool {
 	return enableViews
 }
+
+// IsInformationSchemaEmulated implements the VSchema interface.
+func (vc *vcursorImpl) IsInformationSchemaEmulated() bool {
+	return emulateInformationSchema && enableSchemaChangeSignal
+}
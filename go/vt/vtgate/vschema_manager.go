@@ -27,6 +27,7 @@ import (
 
 	"vitess.io/vitess/go/vt/log"
 	"vitess.io/vitess/go/vt/topo"
+	vtschema "vitess.io/vitess/go/vt/vtgate/schema"
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
 
 	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
@@ -50,6 +51,7 @@ type VSchemaManager struct {
 type SchemaInfo interface {
 	Tables(ks string) map[string][]vindexes.Column
 	Views(ks string) map[string]sqlparser.SelectStatement
+	TableDetails(ks string) map[string]vtschema.TableDetails
 }
 
 // GetCurrentSrvVschema returns a copy of the latest SrvVschema from the
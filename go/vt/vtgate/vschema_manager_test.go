@@ -13,6 +13,7 @@ import (
 	"vitess.io/vitess/go/vt/sqlparser"
 
 	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+	vtschema "vitess.io/vitess/go/vt/vtgate/schema"
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
 )
 
@@ -256,6 +257,7 @@ func makeTestSrvVSchema(ks string, sharded bool, tbls map[string]*vschemapb.Tabl
 
 type fakeSchema struct {
 	t map[string][]vindexes.Column
+	d map[string]vtschema.TableDetails
 }
 
 func (f *fakeSchema) Tables(string) map[string][]vindexes.Column {
@@ -266,4 +268,8 @@ func (f *fakeSchema) Views(_ string) map[string]sqlparser.SelectStatement {
 	return nil
 }
 
+func (f *fakeSchema) TableDetails(string) map[string]vtschema.TableDetails {
+	return f.d
+}
+
 var _ SchemaInfo = (*fakeSchema)(nil)
@@ -108,6 +108,9 @@ type vstream struct {
 
 	// the shard map tracking the copy completion, keyed by streamId. streamId is of the form <keyspace>.<shard>
 	copyCompletedShard map[string]struct{}
+	// copySlots are the per query scatter parallelism slots of the shards
+	// being copied, nil if the limit doesn't bound them.
+	copySlots chan struct{}
 
 	vsm *vstreamManager
 
@@ -248,6 +251,13 @@ func (vs *vstream) stream(ctx context.Context) error {
 
 	// Make a copy first, because the ShardGtids list can change once streaming starts.
 	copylist := append(([]*binlogdatapb.ShardGtid)(nil), vs.vgtid.ShardGtids...)
+	copying := 0
+	for _, sgtid := range copylist {
+		if copiesTables(sgtid) {
+			copying++
+		}
+	}
+	vs.copySlots = newQuerySlots(copying)
 	for _, sgtid := range copylist {
 		vs.startOneStream(ctx, sgtid)
 	}
@@ -318,7 +328,22 @@ func (vs *vstream) startOneStream(ctx context.Context, sgtid *binlogdatapb.Shard
 	vs.wg.Add(1)
 	go func() {
 		defer vs.wg.Done()
-		err := vs.streamFromTablet(ctx, sgtid)
+		release := func() {}
+		var err error
+		if copiesTables(sgtid) {
+			// The copy of the tables of the shard takes scatter parallelism
+			// slots until the shard is copied.
+			target := &querypb.Target{Keyspace: sgtid.Keyspace, Shard: sgtid.Shard, TabletType: vs.tabletType}
+			var releaseSlots func()
+			releaseSlots, err = acquireParallelismSlots(ctx, vs.copySlots, target)
+			if err == nil {
+				release = sync.OnceFunc(releaseSlots)
+				defer release()
+			}
+		}
+		if err == nil {
+			err = vs.streamFromTablet(ctx, sgtid, release)
+		}
 
 		// Set the error on exit. First one wins.
 		if err != nil {
@@ -331,6 +356,12 @@ func (vs *vstream) startOneStream(ctx context.Context, sgtid *binlogdatapb.Shard
 	}()
 }
 
+// copiesTables returns whether the stream of a shard starts by copying the
+// tables, rather than from a position of the binlogs.
+func copiesTables(sgtid *binlogdatapb.ShardGtid) bool {
+	return sgtid.Gtid == "" || len(sgtid.TablePKs) > 0
+}
+
 // MaxSkew is the threshold for a skew to be detected. Since MySQL timestamps are in seconds we account for
 // two round-offs: one for the actual event and another while accounting for the clock skew
 const MaxSkew = int64(2)
@@ -436,7 +467,8 @@ func (vs *vstream) getCells() []string {
 }
 
 // streamFromTablet streams from one shard. If transactions come in separate chunks, they are grouped and sent.
-func (vs *vstream) streamFromTablet(ctx context.Context, sgtid *binlogdatapb.ShardGtid) error {
+// copied is called once the tables of the shard are copied.
+func (vs *vstream) streamFromTablet(ctx context.Context, sgtid *binlogdatapb.ShardGtid, copied func()) error {
 	// journalDone is assigned a channel when a journal event is encountered.
 	// It will be closed when all journal events converge.
 	var journalDone chan struct{}
@@ -560,6 +592,7 @@ func (vs *vstream) streamFromTablet(ctx context.Context, sgtid *binlogdatapb.Sha
 					eventss = nil
 					sendevents = nil
 				case binlogdatapb.VEventType_COPY_COMPLETED:
+					copied()
 					sendevents = append(sendevents, event)
 					if fullyCopied, doneEvent := vs.isCopyFullyCompleted(ctx, sgtid, event); fullyCopied {
 						sendevents = append(sendevents, doneEvent)
@@ -72,6 +72,17 @@ var (
 	transactionMode  = "MULTI"
 	normalizeQueries = true
 	streamBufferSize = 32 * 1024
+	// streamMaxBufferedBytes bounds the result bytes buffered by all streams for slow clients,
+	// and streamMaxBufferedBytesPerStream the ones of each stream
+	streamMaxBufferedBytes          int64
+	streamMaxBufferedBytesPerStream int64
+
+	// scatter parallelism limits, they can be changed at runtime, see scatter_parallelism.go
+	scatterParallelismPerQuery  int
+	scatterParallelismPerTablet int
+
+	// enableTransactionPipelining pipelines the DMLs of multi-statement queries in transactions
+	enableTransactionPipelining bool
 
 	terseErrors bool
 
@@ -85,6 +96,11 @@ var (
 	maxPayloadSize  int
 	warnPayloadSize int
 
+	// sort spill flags, sortSpiller is nil unless a directory is set
+	sortSpillDir          string
+	sortSpillMaxDiskBytes int64 = 10 * 1024 * 1024 * 1024
+	sortSpiller           *engine.SortSpiller
+
 	noScatter          bool
 	enableShardRouting bool
 
@@ -118,6 +134,9 @@ var (
 	// vtgate views flags
 	enableViews bool
 
+	// emulateInformationSchema answers information_schema selects from the schema tracker
+	emulateInformationSchema bool
+
 	// queryLogToFile controls whether query logs are sent to a file
 	queryLogToFile string
 	// queryLogBufferSize controls how many query logs will be buffered before dropping them if logging is not fast enough
@@ -149,10 +168,17 @@ func registerFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&normalizeQueries, "normalize_queries", normalizeQueries, "Rewrite queries with bind vars. Turn this off if the app itself sends normalized queries with bind vars.")
 	fs.BoolVar(&terseErrors, "vtgate-config-terse-errors", terseErrors, "prevent bind vars from escaping in returned errors")
 	fs.IntVar(&streamBufferSize, "stream_buffer_size", streamBufferSize, "the number of bytes sent from vtgate for each stream call. It's recommended to keep this value in sync with vttablet's query-server-config-stream-buffer-size.")
+	fs.Int64Var(&streamMaxBufferedBytes, "stream_max_buffered_bytes", streamMaxBufferedBytes, "the ceiling on the result bytes all streaming queries may buffer together for their clients, see stream_max_buffered_bytes_per_stream. A stream that would exceed it stops reading from vttablet until the streams drain, but a stream buffering nothing is always admitted. 0 means unlimited.")
+	fs.Int64Var(&streamMaxBufferedBytesPerStream, "stream_max_buffered_bytes_per_stream", streamMaxBufferedBytesPerStream, "the maximum number of result bytes each streaming query reads ahead from vttablet while its client consumes the previous results. A stream that would exceed it stops reading from vttablet until its own client catches up, without blocking the other streams. 0 disables the buffering: vttablet is read as fast as the client consumes the results.")
+	fs.BoolVar(&enableTransactionPipelining, "enable_transaction_pipelining", enableTransactionPipelining, "Send the consecutive DMLs of a multi-statement query that run in a transaction to vttablet in a single round trip.")
+	fs.IntVar(&scatterParallelismPerQuery, "scatter_max_parallelism_per_query", scatterParallelismPerQuery, "the maximum number of shards a single query sends its shard actions to at the same time. 0 means unlimited. Can be changed at runtime through /debug/env.")
+	fs.IntVar(&scatterParallelismPerTablet, "scatter_max_parallelism_per_tablet", scatterParallelismPerTablet, "the maximum number of scatter shard actions, of all queries, that run at the same time against a single keyspace/shard/tablet type. 0 means unlimited. Can be changed at runtime through /debug/env.")
 	fs.Int64Var(&queryPlanCacheSize, "gate_query_cache_size", queryPlanCacheSize, "gate server query cache size, maximum number of queries to be cached. vtgate analyzes every incoming query and generate a query plan, these plans are being cached in a cache. This config controls the expected amount of unique entries in the cache.")
 	fs.Int64Var(&queryPlanCacheMemory, "gate_query_cache_memory", queryPlanCacheMemory, "gate server query cache size in bytes, maximum amount of memory to be cached. vtgate analyzes every incoming query and generate a query plan, these plans are being cached in a lru cache. This config controls the capacity of the lru cache.")
 	fs.BoolVar(&queryPlanCacheLFU, "gate_query_cache_lfu", cache.DefaultConfig.LFU, "gate server cache algorithm. when set to true, a new cache algorithm based on a TinyLFU admission policy will be used to improve cache behavior and prevent pollution from sparse queries")
 	fs.IntVar(&maxMemoryRows, "max_memory_rows", maxMemoryRows, "Maximum number of rows that will be held in memory for intermediate results as well as the final result.")
+	fs.StringVar(&sortSpillDir, "sort_spill_dir", sortSpillDir, "the directory where in-memory sorts that exceed max_memory_rows spill sorted runs of rows to temporary files, instead of failing. Empty disables spilling.")
+	fs.Int64Var(&sortSpillMaxDiskBytes, "sort_spill_max_disk_bytes", sortSpillMaxDiskBytes, "the maximum number of bytes all spilled sorts may hold on disk at the same time. A sort that would exceed it fails.")
 	fs.IntVar(&warnMemoryRows, "warn_memory_rows", warnMemoryRows, "Warning threshold for in-memory results. A row count higher than this amount will cause the VtGateWarnings.ResultsExceeded counter to be incremented.")
 	fs.StringVar(&defaultDDLStrategy, "ddl_strategy", defaultDDLStrategy, "Set default strategy for DDL statements. Override with @@ddl_strategy session variable")
 	fs.StringVar(&dbDDLPlugin, "dbddl_plugin", dbDDLPlugin, "controls how to handle CREATE/DROP DATABASE. use it if you are using your own database provisioning service")
@@ -176,6 +202,7 @@ func registerFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&queryLogBufferSize, "querylog-buffer-size", queryLogBufferSize, "Maximum number of buffered query logs before throttling log output")
 	fs.DurationVar(&messageStreamGracePeriod, "message_stream_grace_period", messageStreamGracePeriod, "the amount of time to give for a vttablet to resume if it ends a message stream, usually because of a reparent.")
 	fs.BoolVar(&enableViews, "enable-views", enableViews, "Enable views support in vtgate.")
+	fs.BoolVar(&emulateInformationSchema, "emulate_information_schema", emulateInformationSchema, "(Experimental) Answer the selects of a single information_schema TABLES, COLUMNS, STATISTICS or KEY_COLUMN_USAGE table from the schema tracker, instead of passing them through to a tablet. Selects of columns or with constructs the tracker can't answer are still passed through. Requires --schema_change_signal.")
 	fs.StringVar(&defaultReadWriteSplittingPolicy, "read_write_splitting_policy", defaultReadWriteSplittingPolicy, "Enable read write splitting.")
 	fs.StringVar(&defaultReadAfterWriteConsistencyName, "read_after_write_consistency", defaultReadAfterWriteConsistencyName, "Enable read write splitting.")
 	fs.Float64Var(&defaultReadAfterWriteTimeout, "read_after_write_timeout", defaultReadAfterWriteTimeout, "The default timeout for read after write.")
@@ -267,6 +294,9 @@ func Init(
 	if rpcVTGate != nil {
 		log.Fatalf("VTGate already initialized")
 	}
+	SetScatterMaxParallelismPerQuery(scatterParallelismPerQuery)
+	SetScatterMaxParallelismPerTablet(scatterParallelismPerTablet)
+	sortSpiller = engine.NewSortSpiller(sortSpillDir, sortSpillMaxDiskBytes)
 
 	// Build objects from low to high level.
 	// Start with the gateway. If we can't reach the topology service,
@@ -308,6 +338,9 @@ func Init(
 	var st *vtschema.Tracker
 	if enableSchemaChangeSignal {
 		st = vtschema.NewTracker(serv, cell, gw.hc.Subscribe(), schemaChangeUser, enableViews)
+		if emulateInformationSchema {
+			st.EnableTableDetails()
+		}
 		addKeyspaceToTracker(ctx, srvResolver, st, gw)
 		si = st
 	}
@@ -368,7 +401,7 @@ func Init(
 
 	_ = stats.NewRates("QPSByOperation", stats.CounterForDimension(rpcVTGate.timings, "Operation"), 15, 1*time.Minute)
 	_ = stats.NewRates("QPSByKeyspace", stats.CounterForDimension(rpcVTGate.timings, "Keyspace"), 15, 1*time.Minute)
-	_ = stats.NewRates("QPSByDbType", stats.CounterForDimension(rpcVTGate.timings, "DbType"), 15*60/5, 5*time.Second)
+	qpsByDbType = stats.NewRates("QPSByDbType", stats.CounterForDimension(rpcVTGate.timings, "DbType"), 15*60/5, 5*time.Second)
 
 	_ = stats.NewRates("ErrorsByOperation", stats.CounterForDimension(errorCounts, "Operation"), 15, 1*time.Minute)
 	_ = stats.NewRates("ErrorsByKeyspace", stats.CounterForDimension(errorCounts, "Keyspace"), 15, 1*time.Minute)
@@ -398,6 +431,7 @@ func Init(
 	}
 
 	initAPI(gw.hc)
+	initLoadSignals(gw)
 	return rpcVTGate
 }
 
@@ -517,6 +551,30 @@ func (vtg *VTGate) Execute(ctx context.Context, session *vtgatepb.Session, sql s
 	return session, nil, err
 }
 
+// ExecutePipeline executes the longest prefix of statements that can be
+// pipelined in a single round trip to vttablet, see Executor.ExecutePipeline.
+func (vtg *VTGate) ExecutePipeline(ctx context.Context, session *vtgatepb.Session, statements []string) ([]*sqltypes.Result, error) {
+	// In this context, we don't care if we can't fully parse destination
+	destKeyspace, destTabletType, _, _ := vtg.executor.ParseDestinationTarget(session.TargetString)
+	statsKey := []string{"ExecutePipeline", destKeyspace, topoproto.TabletTypeLString(destTabletType)}
+	defer vtg.timings.Record(statsKey, time.Now())
+
+	safeSession := NewSafeSession(session)
+	results, err := vtg.executor.ExecutePipeline(ctx, safeSession, statements)
+	for _, qr := range results {
+		vtg.rowsAffected.Add(statsKey, int64(qr.RowsAffected))
+	}
+	if err == nil {
+		return results, nil
+	}
+
+	query := map[string]any{
+		"Sql":     statements[len(results)],
+		"Session": session,
+	}
+	return results, recordAndAnnotateError(err, statsKey, query, vtg.logExecute)
+}
+
 // ExecuteBatch executes a batch of queries. This is a V3 function.
 func (vtg *VTGate) ExecuteBatch(ctx context.Context, session *vtgatepb.Session, sqlList []string, bindVariablesList []map[string]*querypb.BindVariable) (*vtgatepb.Session, []sqltypes.QueryResponse, error) {
 	// In this context, we don't care if we can't fully parse destination
@@ -0,0 +1,259 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// connectionInfo is what the processlist shows about a MySQL connection.
+// It is protected by the mutex of the vtgateHandler.
+type connectionInfo struct {
+	db            string
+	query         string
+	since         time.Time
+	inTransaction bool
+}
+
+// startCommand records the query a connection is running.
+func (vh *vtgateHandler) startCommand(c *mysql.Conn, query string, session *vtgatepb.Session) {
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+	if info := vh.connections[c]; info != nil {
+		info.db = session.TargetString
+		info.query = query
+		info.since = time.Now()
+	}
+}
+
+// endCommand records that a connection is idle.
+func (vh *vtgateHandler) endCommand(c *mysql.Conn, session *vtgatepb.Session) {
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+	if info := vh.connections[c]; info != nil {
+		info.db = session.TargetString
+		info.query = ""
+		info.since = time.Now()
+		info.inTransaction = session.InTransaction
+	}
+}
+
+// processlist returns the rows of wescale_schema.processlist, sorted by
+// connection ID.
+func (vh *vtgateHandler) processlist() []sqltypes.Row {
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+	now := time.Now()
+	rows := make([]sqltypes.Row, 0, len(vh.connections))
+	for c, info := range vh.connections {
+		command, state, query := "Sleep", "", sqltypes.NULL
+		if info.query != "" {
+			command = "Query"
+			query = sqltypes.NewVarChar(sqlparser.TruncateForUI(info.query))
+		}
+		if info.inTransaction {
+			state = "in transaction"
+		}
+		rows = append(rows, sqltypes.Row{
+			sqltypes.NewInt64(int64(c.ConnectionID)),
+			sqltypes.NewVarChar(c.User),
+			sqltypes.NewVarChar(c.RemoteAddr().String()),
+			sqltypes.NewVarChar(info.db),
+			sqltypes.NewVarChar(command),
+			sqltypes.NewInt64(int64(now.Sub(info.since) / time.Second)),
+			sqltypes.NewVarChar(state),
+			query,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		id1, _ := rows[i][0].ToInt64()
+		id2, _ := rows[j][0].ToInt64()
+		return id1 < id2
+	})
+	return rows
+}
+
+// virtualTable returns the rows of a table of wescale_schema or
+// information_schema.
+func (e *Executor) virtualTable(ctx context.Context, keyspace, name string) (*sqltypes.Result, error) {
+	fields, ok := engine.VirtualTableFields(keyspace, name)
+	if !ok {
+		return nil, vterrors.VT05005(name, keyspace)
+	}
+	result := &sqltypes.Result{Fields: fields}
+	if strings.EqualFold(keyspace, engine.InformationSchema) {
+		rows, err := e.informationSchemaTable(name)
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = rows
+		return result, nil
+	}
+	switch strings.ToLower(name) {
+	case "processlist":
+		if vtgateHandle != nil {
+			result.Rows = vtgateHandle.processlist()
+		}
+	case "statement_summary":
+		result.Rows = e.statementSummary()
+	case "pool_stats":
+		rows, err := e.tabletsCommonQuery(ctx, "PoolStats")
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = rows
+	case "rule_stats":
+		rows, err := e.tabletsCommonQuery(ctx, "RuleStats")
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = rows
+	default:
+		return nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "bug: unexpected %s table: %s", engine.WescaleSchema, name)
+	}
+	return result, nil
+}
+
+// statementSummary returns the rows of wescale_schema.statement_summary,
+// one per cached plan. The timers are in microseconds.
+func (e *Executor) statementSummary() []sqltypes.Row {
+	var rows []sqltypes.Row
+	e.plans.ForEach(func(value any) bool {
+		plan := value.(*engine.Plan)
+		count, execTime, shardQueries, rowsAffected, rowsReturned, errors := plan.Stats()
+		var avg time.Duration
+		if count != 0 {
+			avg = execTime / time.Duration(count)
+		}
+		rows = append(rows, sqltypes.Row{
+			sqltypes.NewVarChar(sqlparser.TruncateForUI(plan.Original)),
+			sqltypes.NewVarChar(plan.Type.String()),
+			sqltypes.NewVarChar(strings.Join(plan.TablesUsed, ",")),
+			sqltypes.NewInt64(int64(count)),
+			sqltypes.NewInt64(execTime.Microseconds()),
+			sqltypes.NewInt64(avg.Microseconds()),
+			sqltypes.NewInt64(int64(shardQueries)),
+			sqltypes.NewInt64(int64(rowsAffected)),
+			sqltypes.NewInt64(int64(rowsReturned)),
+			sqltypes.NewInt64(int64(errors)),
+		})
+		return true
+	})
+	return rows
+}
+
+// tabletsCommonQuery runs a CommonQuery function on every serving tablet,
+// and returns all their rows.
+func (e *Executor) tabletsCommonQuery(ctx context.Context, queryFunctionName string) ([]sqltypes.Row, error) {
+	var rows []sqltypes.Row
+	for _, tabletStatusList := range e.scatterConn.GetHealthCheckCacheStatus() {
+		for _, tabletStatus := range tabletStatusList.TabletsStats {
+			if !tabletStatus.Serving || tabletStatus.Conn == nil {
+				continue
+			}
+			qr, err := tabletStatus.Conn.CommonQuery(ctx, queryFunctionName, nil)
+			if err != nil {
+				return nil, vterrors.Wrapf(err, "%s on tablet %s", queryFunctionName, formatTabletAlias(tabletStatus.Tablet.Alias))
+			}
+			if qr != nil {
+				rows = append(rows, qr.Rows...)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// filterStatsFields are the fields of SHOW FILTER_STATS.
+var filterStatsFields = sqltypes.MakeTestFields(
+	"source|name|priority|status|action|tablets|match_count|affected_count|last_match_time",
+	"varchar|varchar|int64|varchar|varchar|int64|int64|int64|datetime")
+
+// showFilterStats returns the rows of SHOW FILTER_STATS: the rows of
+// wescale_schema.rule_stats of all the tablets summed up by rule, the last
+// match time being the latest one, sorted by source and name. The LIKE
+// pattern filters the rules by name, while the other conditions need a
+// select from wescale_schema.rule_stats.
+func (e *Executor) showFilterStats(ctx context.Context, filter *sqlparser.ShowFilter) (*sqltypes.Result, error) {
+	if filter != nil && filter.Filter != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "SHOW FILTER_STATS only filters with LIKE, select from %s.rule_stats for WHERE", engine.WescaleSchema)
+	}
+	rows, err := e.tabletsCommonQuery(ctx, "RuleStats")
+	if err != nil {
+		return nil, err
+	}
+	type ruleKey struct{ source, name string }
+	type filterStats struct {
+		row               sqltypes.Row
+		tablets           int64
+		matches, affected int64
+		lastMatch         sqltypes.Value
+	}
+	var nameRegexp *regexp.Regexp
+	if filter != nil && filter.Like != "" {
+		nameRegexp = sqlparser.LikeToRegexp(filter.Like)
+	}
+	byRule := make(map[ruleKey]*filterStats)
+	var keys []ruleKey
+	for _, row := range rows {
+		// The columns are the ones of wescale_schema.rule_stats.
+		if len(row) < 10 {
+			continue
+		}
+		key := ruleKey{source: row[1].ToString(), name: row[2].ToString()}
+		if nameRegexp != nil && !nameRegexp.MatchString(key.name) {
+			continue
+		}
+		stats, ok := byRule[key]
+		if !ok {
+			stats = &filterStats{row: row, lastMatch: sqltypes.NULL}
+			byRule[key] = stats
+			keys = append(keys, key)
+		}
+		matches, _ := row[7].ToInt64()
+		affected, _ := row[8].ToInt64()
+		stats.tablets++
+		stats.matches += matches
+		stats.affected += affected
+		if !row[9].IsNull() && (stats.lastMatch.IsNull() || row[9].ToString() > stats.lastMatch.ToString()) {
+			stats.lastMatch = row[9]
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].source != keys[j].source {
+			return keys[i].source < keys[j].source
+		}
+		return keys[i].name < keys[j].name
+	})
+	result := &sqltypes.Result{Fields: filterStatsFields}
+	for _, key := range keys {
+		stats := byRule[key]
+		result.Rows = append(result.Rows, sqltypes.Row{
+			sqltypes.NewVarChar(key.source),
+			sqltypes.NewVarChar(key.name),
+			stats.row[4],
+			stats.row[5],
+			stats.row[6],
+			sqltypes.NewInt64(stats.tablets),
+			sqltypes.NewInt64(stats.matches),
+			sqltypes.NewInt64(stats.affected),
+			stats.lastMatch,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestWescaleSchemaProcesslist(t *testing.T) {
+	createSandbox(KsTestUnsharded)
+	hcVTGateTest.Reset()
+	hcVTGateTest.AddTestTablet("aa", "1.1.1.1", 1001, KsTestUnsharded, "0", topodatapb.TabletType_PRIMARY, true, 1, nil)
+
+	c1, err := mysqlConnect(&mysql.ConnParams{})
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := mysqlConnect(&mysql.ConnParams{})
+	require.NoError(t, err)
+	defer c2.Close()
+
+	query := fmt.Sprintf("select id, command, info from wescale_schema.processlist where id in (%d, %d) order by id desc", c1.ConnectionID, c2.ConnectionID)
+	qr, err := c1.ExecuteFetch(query, 10, true /* wantfields */)
+	require.NoError(t, err)
+	assert.Equal(t, "id", qr.Fields[0].Name)
+	assert.Equal(t, sqltypes.Int64, qr.Fields[0].Type)
+	assert.Equal(t, fmt.Sprintf("[[INT64(%d) VARCHAR(\"Sleep\") NULL] [INT64(%d) VARCHAR(\"Query\") VARCHAR(%q)]]", c2.ConnectionID, c1.ConnectionID, query), fmt.Sprintf("%v", qr.Rows))
+}
+
+func TestWescaleSchemaStatementSummary(t *testing.T) {
+	executor, _, _, _ := createExecutorEnv()
+
+	for i := 0; i < 2; i++ {
+		_, err := executorExec(executor, "select id from music_user_map where id = 1", nil)
+		require.NoError(t, err)
+		executor.plans.Wait()
+	}
+	qr, err := executorExec(executor, "select s.digest_text as digest, count_star + 1 from wescale_schema.statement_summary as s where digest_text like '%music_user_map%' order by digest limit 1", nil)
+	require.NoError(t, err)
+	require.Len(t, qr.Rows, 1)
+	assert.Equal(t, "digest", qr.Fields[0].Name)
+	assert.Contains(t, qr.Rows[0][0].ToString(), "music_user_map")
+	assert.Equal(t, "3", qr.Rows[0][1].ToString())
+
+	qr, err = executorExec(executor, "select * from wescale_schema.pool_stats", nil)
+	require.NoError(t, err)
+	assert.Len(t, qr.Fields, 11)
+	assert.Empty(t, qr.Rows)
+}
+
+func TestShowFilterStats(t *testing.T) {
+	executor, sbc1, sbc2, _ := createExecutorEnv()
+	ruleStats := func(alias string, matches, affected int64, lastMatch string) *sqltypes.Result {
+		fields := sqltypes.MakeTestFields(
+			"tablet_alias|source|name|description|priority|status|action|match_count|affected_count|last_match_time",
+			"varchar|varchar|varchar|varchar|int64|varchar|varchar|int64|int64|datetime")
+		return sqltypes.MakeTestResult(fields,
+			fmt.Sprintf("%s|custom_rule|emergency||95|ACTIVE|FAIL|%d|%d|%s", alias, matches, affected, lastMatch),
+			fmt.Sprintf("%s|custom_rule|dead||10|ACTIVE|FAIL|0|0|null", alias),
+		)
+	}
+	sbc1.CommonQueryResults = map[string]*sqltypes.Result{"RuleStats": ruleStats("aa-1", 3, 2, "2026-10-14 12:30:00")}
+	sbc2.CommonQueryResults = map[string]*sqltypes.Result{"RuleStats": ruleStats("aa-2", 4, 4, "2026-10-14 12:45:00")}
+	defer func() { sbc1.CommonQueryResults, sbc2.CommonQueryResults = nil, nil }()
+
+	qr, err := executorExec(executor, "show filter_stats", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "source", qr.Fields[0].Name)
+	assert.Equal(t, sqltypes.Datetime, qr.Fields[8].Type)
+	assert.Equal(t, `[[VARCHAR("custom_rule") VARCHAR("dead") INT64(10) VARCHAR("ACTIVE") VARCHAR("FAIL") INT64(2) INT64(0) INT64(0) NULL] `+
+		`[VARCHAR("custom_rule") VARCHAR("emergency") INT64(95) VARCHAR("ACTIVE") VARCHAR("FAIL") INT64(2) INT64(7) INT64(6) DATETIME("2026-10-14 12:45:00")]]`,
+		fmt.Sprintf("%v", qr.Rows))
+
+	qr, err = executorExec(executor, "show filter_stats like 'emerg%'", nil)
+	require.NoError(t, err)
+	require.Len(t, qr.Rows, 1)
+	assert.Equal(t, "emergency", qr.Rows[0][1].ToString())
+
+	_, err = executorExec(executor, "show filter_stats where match_count = 0", nil)
+	assert.ErrorContains(t, err, "SHOW FILTER_STATS only filters with LIKE")
+}
+
+func TestWescaleSchemaErrors(t *testing.T) {
+	executor, _, _, _ := createExecutorEnv()
+
+	tcases := []struct {
+		query string
+		err   string
+	}{{
+		query: "select * from wescale_schema.nope",
+		err:   "table 'nope' does not exist in keyspace 'wescale_schema'",
+	}, {
+		query: "select nope from wescale_schema.processlist",
+		err:   "column nope not found in wescale_schema.processlist",
+	}, {
+		query: "select command from wescale_schema.processlist group by command",
+		err:   "unsupported",
+	}, {
+		query: "select id from wescale_schema.processlist order by id + 1",
+		err:   "unsupported",
+	}}
+	for _, tcase := range tcases {
+		t.Run(tcase.query, func(t *testing.T) {
+			_, err := executorExec(executor, tcase.query, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tcase.err)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package workload captures the queries a vtgate serves, and replays them
+// against another cluster to compare how it serves them.
+//
+// A capture is a file of Query records, one JSON object per line, in the order
+// the queries ended. The queries of a session are replayed in order on a
+// connection of their own, so the state of the sessions, like their database,
+// their variables and their transactions, is replayed too.
+package workload
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"vitess.io/vitess/go/vt/vtgate/logstats"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// Query is a captured query.
+type Query struct {
+	Start time.Time `json:"start"`
+	// Latency is how long vtgate took to serve the query, in nanoseconds.
+	Latency  time.Duration `json:"latency"`
+	Session  string        `json:"session"`
+	User     string        `json:"user,omitempty"`
+	Database string        `json:"database,omitempty"`
+	StmtType string        `json:"stmt_type"`
+	SQL      string        `json:"sql"`
+	// BindVars are the bind variables of a prepared statement, which the
+	// placeholders of SQL are bound to.
+	BindVars     map[string]*querypb.BindVariable `json:"bind_vars,omitempty"`
+	RowsAffected uint64                           `json:"rows_affected"`
+	RowsReturned uint64                           `json:"rows_returned"`
+	Error        string                           `json:"error,omitempty"`
+}
+
+// NewQuery returns the captured query of the log record of a query.
+func NewQuery(stats *logstats.LogStats) *Query {
+	_, user := stats.RemoteAddrUsername()
+	if user == "" {
+		user = stats.ImmediateCaller()
+	}
+	return &Query{
+		Start:        stats.StartTime,
+		Latency:      stats.TotalTime(),
+		Session:      stats.SessionUUID,
+		User:         user,
+		Database:     stats.ActiveKeyspace,
+		StmtType:     stats.StmtType,
+		SQL:          stats.SQL,
+		BindVars:     stats.BindVariables,
+		RowsAffected: stats.RowsAffected,
+		RowsReturned: stats.RowsReturned,
+		Error:        stats.ErrorStr(),
+	}
+}
+
+// Capture writes the queries of the log records of ch, a subscription to the
+// query logger of vtgate, to w until ctx is done, and returns how many it
+// wrote. The statements which are only prepared are skipped, since they are
+// captured when they are executed. flush, if not nil, is called after each
+// query.
+func Capture(ctx context.Context, ch <-chan any, w io.Writer, flush func()) (int, error) {
+	encoder := json.NewEncoder(w)
+	captured := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return captured, nil
+		case message := <-ch:
+			stats, ok := message.(*logstats.LogStats)
+			if !ok || stats.Method == "Prepare" {
+				continue
+			}
+			if err := encoder.Encode(NewQuery(stats)); err != nil {
+				return captured, err
+			}
+			captured++
+			if flush != nil {
+				flush()
+			}
+		}
+	}
+}
+
+// ReadQueries reads the queries of a capture.
+func ReadQueries(r io.Reader) ([]*Query, error) {
+	var queries []*Query
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var query Query
+		if err := json.Unmarshal(scanner.Bytes(), &query); err != nil {
+			return nil, fmt.Errorf("invalid query at line %d: %v", line, err)
+		}
+		queries = append(queries, &query)
+	}
+	return queries, scanner.Err()
+}
+
+// ReadFiles reads the queries of the captures of files, like the captures of
+// the vtgates of a cluster, and returns them in the order they started.
+func ReadFiles(files []string) ([]*Query, error) {
+	var queries []*Query
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		fileQueries, err := ReadQueries(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		queries = append(queries, fileQueries...)
+	}
+	sort.SliceStable(queries, func(i, j int) bool { return queries[i].Start.Before(queries[j].Start) })
+	return queries, nil
+}
@@ -0,0 +1,251 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package workload
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// maxMismatches is how many mismatches a report keeps as examples.
+const maxMismatches = 100
+
+// readOnlyStmtTypes are the statement types a read-only replay runs: the
+// reads, and the statements which keep the state of the sessions.
+var readOnlyStmtTypes = map[string]bool{
+	"SELECT":             true,
+	"SHOW":               true,
+	"EXPLAIN":            true,
+	"USE":                true,
+	"SET":                true,
+	"BEGIN":              true,
+	"COMMIT":             true,
+	"ROLLBACK":           true,
+	"SAVEPOINT":          true,
+	"SAVEPOINT_ROLLBACK": true,
+	"RELEASE":            true,
+	"COMMENT_ONLY":       true,
+}
+
+// Conn is a connection the queries of a session are replayed on, like a
+// *mysql.Conn.
+type Conn interface {
+	ExecuteFetch(query string, maxrows int, wantfields bool) (*sqltypes.Result, error)
+	Close()
+}
+
+// Replayer replays captured queries.
+type Replayer struct {
+	// Connect opens the connection of a session, in the database of its first
+	// query.
+	Connect func(ctx context.Context, database string) (Conn, error)
+	// Speed is how many times faster than captured the queries are replayed:
+	// 1 replays them at the pace they were captured at, 2 twice as fast. 0
+	// replays the queries of each session one after the other.
+	Speed float64
+	// ReadOnly replays only the statements of readOnlyStmtTypes.
+	ReadOnly bool
+	// MaxRows is the maximum number of rows a query may return.
+	MaxRows int
+}
+
+// Report compares how the queries were served when captured and replayed.
+type Report struct {
+	Queries  int `json:"queries"`
+	Sessions int `json:"sessions"`
+	// Skipped are the queries a read-only replay didn't run.
+	Skipped  int `json:"skipped"`
+	Replayed int `json:"replayed"`
+	// ErrorMismatches are the queries which failed either when captured or
+	// when replayed, but not both.
+	ErrorMismatches int `json:"error_mismatches"`
+	// RowMismatches are the queries which succeeded both times, but affected
+	// or returned a different number of rows.
+	RowMismatches int `json:"row_mismatches"`
+	// Duration is how long the replay took.
+	Duration        time.Duration  `json:"duration"`
+	CapturedLatency LatencySummary `json:"captured_latency"`
+	ReplayedLatency LatencySummary `json:"replayed_latency"`
+	// Mismatches are up to maxMismatches examples of the mismatches.
+	Mismatches []Mismatch `json:"mismatches"`
+
+	capturedLatencies []time.Duration
+	replayedLatencies []time.Duration
+}
+
+// LatencySummary are percentiles of the latencies of the queries, in
+// nanoseconds.
+type LatencySummary struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// Mismatch is a query which was served differently when replayed.
+type Mismatch struct {
+	Session              string `json:"session"`
+	SQL                  string `json:"sql"`
+	CapturedError        string `json:"captured_error,omitempty"`
+	ReplayedError        string `json:"replayed_error,omitempty"`
+	CapturedRowsAffected uint64 `json:"captured_rows_affected"`
+	ReplayedRowsAffected uint64 `json:"replayed_rows_affected"`
+	CapturedRowsReturned uint64 `json:"captured_rows_returned"`
+	ReplayedRowsReturned uint64 `json:"replayed_rows_returned"`
+}
+
+// replayed is how a query was served when replayed.
+type replayed struct {
+	latency      time.Duration
+	rowsAffected uint64
+	rowsReturned uint64
+	err          string
+}
+
+// Replay replays the queries, in the order they started, and reports how they
+// were served.
+func (r *Replayer) Replay(ctx context.Context, queries []*Query) *Report {
+	report := &Report{Queries: len(queries), Mismatches: []Mismatch{}}
+	var sessionIDs []string
+	sessions := make(map[string][]*Query)
+	for _, query := range queries {
+		if r.ReadOnly && !readOnlyStmtTypes[query.StmtType] {
+			report.Skipped++
+			continue
+		}
+		if _, ok := sessions[query.Session]; !ok {
+			sessionIDs = append(sessionIDs, query.Session)
+		}
+		sessions[query.Session] = append(sessions[query.Session], query)
+	}
+	report.Sessions = len(sessionIDs)
+	if len(sessionIDs) == 0 {
+		return report.summarize()
+	}
+
+	origin := sessions[sessionIDs[0]][0].Start
+	start := time.Now()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, id := range sessionIDs {
+		wg.Add(1)
+		go func(sessionQueries []*Query) {
+			defer wg.Done()
+			r.replaySession(ctx, sessionQueries, start, origin, func(query *Query, result *replayed) {
+				mu.Lock()
+				defer mu.Unlock()
+				report.add(query, result)
+			})
+		}(sessions[id])
+	}
+	wg.Wait()
+	report.Duration = time.Since(start)
+	return report.summarize()
+}
+
+// replaySession replays the queries of a session on a connection of its own.
+// The query which started at origin is replayed at start.
+func (r *Replayer) replaySession(ctx context.Context, queries []*Query, start, origin time.Time, done func(*Query, *replayed)) {
+	conn, err := r.Connect(ctx, queries[0].Database)
+	if err != nil {
+		for _, query := range queries {
+			done(query, &replayed{err: err.Error()})
+		}
+		return
+	}
+	defer conn.Close()
+
+	for _, query := range queries {
+		if r.Speed > 0 {
+			at := start.Add(time.Duration(float64(query.Start.Sub(origin)) / r.Speed))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(at)):
+			}
+		}
+		if ctx.Err() != nil {
+			done(query, &replayed{err: ctx.Err().Error()})
+			continue
+		}
+		result := &replayed{}
+		sql, err := replaySQL(query)
+		if err == nil {
+			queryStart := time.Now()
+			var qr *sqltypes.Result
+			qr, err = conn.ExecuteFetch(sql, r.MaxRows, false)
+			result.latency = time.Since(queryStart)
+			if qr != nil {
+				result.rowsAffected = qr.RowsAffected
+				result.rowsReturned = uint64(len(qr.Rows))
+			}
+		}
+		if err != nil {
+			result.err = err.Error()
+		}
+		done(query, result)
+	}
+}
+
+// replaySQL returns the SQL a query is replayed with, with its bind variables
+// bound.
+func replaySQL(query *Query) (string, error) {
+	if len(query.BindVars) == 0 {
+		return query.SQL, nil
+	}
+	stmt, err := sqlparser.Parse(query.SQL)
+	if err != nil {
+		return "", err
+	}
+	return sqlparser.NewParsedQuery(stmt).GenerateQuery(query.BindVars, nil)
+}
+
+func (report *Report) add(query *Query, result *replayed) {
+	report.Replayed++
+	report.capturedLatencies = append(report.capturedLatencies, query.Latency)
+	report.replayedLatencies = append(report.replayedLatencies, result.latency)
+	switch {
+	case (query.Error == "") != (result.err == ""):
+		report.ErrorMismatches++
+	case query.Error == "" && (query.RowsAffected != result.rowsAffected || query.RowsReturned != result.rowsReturned):
+		report.RowMismatches++
+	default:
+		return
+	}
+	if len(report.Mismatches) < maxMismatches {
+		report.Mismatches = append(report.Mismatches, Mismatch{
+			Session:              query.Session,
+			SQL:                  query.SQL,
+			CapturedError:        query.Error,
+			ReplayedError:        result.err,
+			CapturedRowsAffected: query.RowsAffected,
+			ReplayedRowsAffected: result.rowsAffected,
+			CapturedRowsReturned: query.RowsReturned,
+			ReplayedRowsReturned: result.rowsReturned,
+		})
+	}
+}
+
+func (report *Report) summarize() *Report {
+	report.CapturedLatency = summarizeLatencies(report.capturedLatencies)
+	report.ReplayedLatency = summarizeLatencies(report.replayedLatencies)
+	return report
+}
+
+func summarizeLatencies(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p int) time.Duration {
+		return latencies[(len(latencies)-1)*p/100]
+	}
+	return LatencySummary{P50: percentile(50), P90: percentile(90), P99: percentile(99), Max: latencies[len(latencies)-1]}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package workload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/logstats"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestCapture(t *testing.T) {
+	ch := make(chan any, 10)
+	start := time.Date(2024, 1, 10, 13, 30, 0, 0, time.UTC)
+	stats := logstats.NewLogStats(context.Background(), "Execute", "select * from t where id = ?", "s1", map[string]*querypb.BindVariable{"v1": sqltypes.Int64BindVariable(1)})
+	stats.StartTime, stats.EndTime = start, start.Add(2*time.Millisecond)
+	stats.StmtType, stats.ActiveKeyspace, stats.RowsReturned = "SELECT", "ks", 1
+	ch <- stats
+	ch <- logstats.NewLogStats(context.Background(), "Prepare", "select * from t where id = ?", "s1", nil)
+	failed := logstats.NewLogStats(context.Background(), "Execute", "insert into t values (1)", "s1", nil)
+	failed.StartTime, failed.EndTime = start.Add(time.Millisecond), start.Add(3*time.Millisecond)
+	failed.StmtType, failed.Error = "INSERT", errors.New("duplicate entry")
+	ch <- failed
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf bytes.Buffer
+	flushed := 0
+	captured, err := Capture(ctx, ch, &buf, func() {
+		if flushed++; flushed == 2 {
+			cancel()
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, captured)
+
+	queries, err := ReadQueries(&buf)
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+	assert.Equal(t, &Query{
+		Start:        start,
+		Latency:      2 * time.Millisecond,
+		Session:      "s1",
+		Database:     "ks",
+		StmtType:     "SELECT",
+		SQL:          "select * from t where id = ?",
+		BindVars:     map[string]*querypb.BindVariable{"v1": sqltypes.Int64BindVariable(1)},
+		RowsReturned: 1,
+	}, queries[0])
+	assert.Equal(t, "duplicate entry", queries[1].Error)
+}
+
+func TestReadQueriesError(t *testing.T) {
+	_, err := ReadQueries(strings.NewReader("{\"sql\": \"select 1\"}\n\nnot json\n"))
+	assert.EqualError(t, err, "invalid query at line 3: invalid character 'o' in literal null (expecting 'u')")
+}
+
+// fakeConn serves the queries with the results of a map, or fails them.
+type fakeConn struct {
+	mu       *sync.Mutex
+	database string
+	results  map[string]*sqltypes.Result
+	executed *[]string
+}
+
+func (c *fakeConn) ExecuteFetch(query string, maxrows int, wantfields bool) (*sqltypes.Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.executed = append(*c.executed, c.database+": "+query)
+	if qr, ok := c.results[query]; ok {
+		return qr, nil
+	}
+	return nil, errors.New("unknown query")
+}
+
+func (c *fakeConn) Close() {}
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2024, 1, 10, 13, 30, 0, 0, time.UTC)
+	queries := []*Query{
+		{Start: start, Session: "s1", Database: "ks", StmtType: "BEGIN", SQL: "begin", Latency: time.Millisecond},
+		{Start: start.Add(time.Millisecond), Session: "s2", Database: "ks2", StmtType: "SELECT", SQL: "select * from t where id = ?", BindVars: map[string]*querypb.BindVariable{"v1": sqltypes.Int64BindVariable(1)}, RowsReturned: 1, Latency: 2 * time.Millisecond},
+		{Start: start.Add(2 * time.Millisecond), Session: "s1", StmtType: "UPDATE", SQL: "update t set c = 1", RowsAffected: 2, Latency: 3 * time.Millisecond},
+		{Start: start.Add(3 * time.Millisecond), Session: "s1", StmtType: "SELECT", SQL: "select 1 from dual", Error: "table not found", Latency: 4 * time.Millisecond},
+		{Start: start.Add(4 * time.Millisecond), Session: "s1", StmtType: "COMMIT", SQL: "commit", Latency: 5 * time.Millisecond},
+	}
+	results := map[string]*sqltypes.Result{
+		"begin":                          {},
+		"commit":                         {},
+		"select * from t where id = 1":   {Rows: [][]sqltypes.Value{{sqltypes.NewInt64(1)}}},
+		"update t set c = 1":             {RowsAffected: 1},
+		"select 1 from dual":             {Rows: [][]sqltypes.Value{{sqltypes.NewInt64(1)}}},
+		"select * from t where id = :v1": {},
+	}
+	var mu sync.Mutex
+	var executed []string
+	replayer := &Replayer{
+		Connect: func(ctx context.Context, database string) (Conn, error) {
+			return &fakeConn{mu: &mu, database: database, results: results, executed: &executed}, nil
+		},
+		Speed:   1,
+		MaxRows: 100,
+	}
+	report := replayer.Replay(context.Background(), queries)
+	assert.ElementsMatch(t, []string{
+		"ks: begin",
+		"ks2: select * from t where id = 1",
+		"ks: update t set c = 1",
+		"ks: select 1 from dual",
+		"ks: commit",
+	}, executed)
+	assert.Equal(t, 5, report.Queries)
+	assert.Equal(t, 2, report.Sessions)
+	assert.Equal(t, 5, report.Replayed)
+	assert.Equal(t, 1, report.ErrorMismatches)
+	assert.Equal(t, 1, report.RowMismatches)
+	assert.Equal(t, LatencySummary{P50: 3 * time.Millisecond, P90: 4 * time.Millisecond, P99: 4 * time.Millisecond, Max: 5 * time.Millisecond}, report.CapturedLatency)
+	require.Len(t, report.Mismatches, 2)
+
+	executed = nil
+	replayer.ReadOnly, replayer.Speed = true, 0
+	report = replayer.Replay(context.Background(), queries)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 4, report.Replayed)
+	assert.NotContains(t, executed, "ks: update t set c = 1")
+
+	replayer.Connect = func(ctx context.Context, database string) (Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+	report = replayer.Replay(context.Background(), queries)
+	assert.Equal(t, 3, report.ErrorMismatches)
+}
@@ -0,0 +1,194 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/schema"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// A workload class groups the sessions of the clients sending some connection
+// attributes, like program_name=mysqldump or a custom app=airflow, so they can
+// be told apart without SQL comments. The class of a session sets the
+// defaults of its routing, and it is sent to the tablets as the subcomponent
+// of the effective caller, which the WorkloadClass condition of the rules and
+// --transaction_limit_by_subcomponent match.
+//
+// The classes are read from the --workload_class_config JSON file:
+//
+//	{"classes": [{
+//		"name": "etl",
+//		"attributes": {"app": "airflow"},
+//		"read_write_splitting_policy": "random",
+//		"read_write_splitting_ratio": 100,
+//		"idle_timeout": "1h"
+//	}]}
+//
+// A session is of the first class whose attributes its client all sent.
+
+// mysqlSubcomponent is the subcomponent of the sessions without a class.
+const mysqlSubcomponent = "VTGate MySQL Connector"
+
+var (
+	workloadClassConfigFile string
+	workloadClasses         []*workloadClass
+
+	// workloadClassSessions counts the sessions of each workload class.
+	workloadClassSessions = stats.NewCountersWithSingleLabel("WorkloadClassSessions", "Sessions of each workload class", "Class")
+)
+
+// workloadClass is a class of the --workload_class_config file.
+type workloadClass struct {
+	Name string `json:"name"`
+	// Attributes are the connection attributes the clients of the class send.
+	Attributes map[string]string `json:"attributes"`
+
+	// The routing of the sessions of the class. Unset fields keep the
+	// defaults of the flags.
+	ReadWriteSplittingPolicy  string `json:"read_write_splitting_policy,omitempty"`
+	ReadWriteSplittingRatio   *int   `json:"read_write_splitting_ratio,omitempty"`
+	ReadAfterWriteConsistency string `json:"read_after_write_consistency,omitempty"`
+
+	// IdleTimeout overrides --idle_session_timeout for the sessions of the
+	// class, e.g. "1h", or "0s" to never close them.
+	IdleTimeout string `json:"idle_timeout,omitempty"`
+	idleTimeout time.Duration
+}
+
+func registerWorkloadClassFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&workloadClassConfigFile, "workload_class_config", workloadClassConfigFile, "JSON file of the workload classes of the sessions, recognized by the connection attributes of their clients. The class of a session sets the defaults of its routing, and is matched by the WorkloadClass condition of the rules.")
+}
+
+func init() {
+	servenv.OnParseFor("vtgate", registerWorkloadClassFlags)
+	servenv.OnParseFor("vtcombo", registerWorkloadClassFlags)
+	servenv.OnInit(initWorkloadClasses)
+}
+
+func initWorkloadClasses() {
+	if workloadClassConfigFile == "" {
+		return
+	}
+	data, err := os.ReadFile(workloadClassConfigFile)
+	if err != nil {
+		log.Exitf("Failed to read --workload_class_config: %v", err)
+	}
+	classes, err := parseWorkloadClasses(data)
+	if err != nil {
+		log.Exitf("Invalid --workload_class_config %s: %v", workloadClassConfigFile, err)
+	}
+	workloadClasses = classes
+}
+
+// parseWorkloadClasses reads and checks the workload classes of a
+// --workload_class_config file.
+func parseWorkloadClasses(data []byte) ([]*workloadClass, error) {
+	var config struct {
+		Classes []*workloadClass `json:"classes"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%v", err)
+	}
+
+	names := make(map[string]bool, len(config.Classes))
+	for i, class := range config.Classes {
+		if class.Name == "" {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "workload class #%d has no name", i+1)
+		}
+		if names[class.Name] {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "workload class %s is defined twice", class.Name)
+		}
+		names[class.Name] = true
+		if len(class.Attributes) == 0 {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "workload class %s has no attributes", class.Name)
+		}
+		if class.ReadWriteSplittingPolicy != "" {
+			if _, err := schema.ParseReadWriteSplittingPolicySetting(class.ReadWriteSplittingPolicy); err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "workload class %s: %v", class.Name, err)
+			}
+		}
+		if class.ReadWriteSplittingRatio != nil {
+			if err := schema.CheckReadWriteSplittingRateRange(int32(*class.ReadWriteSplittingRatio)); err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "workload class %s: %v", class.Name, err)
+			}
+		}
+		if class.ReadAfterWriteConsistency != "" {
+			if err := ValidateReadAfterWriteConsistency(class.ReadAfterWriteConsistency); err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "workload class %s: %v", class.Name, err)
+			}
+		}
+		if class.IdleTimeout != "" {
+			idleTimeout, err := time.ParseDuration(class.IdleTimeout)
+			if err != nil || idleTimeout < 0 {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "workload class %s: invalid idle_timeout %q", class.Name, class.IdleTimeout)
+			}
+			class.idleTimeout = idleTimeout
+		}
+	}
+	return config.Classes, nil
+}
+
+// classifyWorkload returns the class of the sessions of a client sending
+// attributes, or nil.
+func classifyWorkload(attributes map[string]string) *workloadClass {
+	if len(attributes) == 0 {
+		return nil
+	}
+	for _, class := range workloadClasses {
+		if class.matches(attributes) {
+			return class
+		}
+	}
+	return nil
+}
+
+func (class *workloadClass) matches(attributes map[string]string) bool {
+	for key, value := range class.Attributes {
+		if v, ok := attributes[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// apply sets the routing of the class on a new session.
+func (class *workloadClass) apply(session *vtgatepb.Session) {
+	if class.ReadWriteSplittingPolicy != "" {
+		session.ReadWriteSplittingPolicy = class.ReadWriteSplittingPolicy
+	}
+	if class.ReadWriteSplittingRatio != nil {
+		session.ReadWriteSplittingRatio = int32(*class.ReadWriteSplittingRatio)
+		session.ResolverOptions.ReadWriteSplittingRatio = int32(*class.ReadWriteSplittingRatio)
+	}
+	if class.ReadAfterWriteConsistency != "" {
+		session.ReadAfterWrite.ReadAfterWriteConsistency = ConvertReadAfterWriteConsistency(class.ReadAfterWriteConsistency)
+	}
+}
+
+// workloadSubcomponent returns the subcomponent of the effective caller of the
+// queries of a client connection: its workload class, if it has one.
+func workloadSubcomponent(c *mysql.Conn) string {
+	if class := classifyWorkload(c.Attributes); class != nil {
+		return class.Name
+	}
+	return mysqlSubcomponent
+}
@@ -0,0 +1,76 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package vtgate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+)
+
+func TestParseWorkloadClasses(t *testing.T) {
+	classes, err := parseWorkloadClasses([]byte(`{"classes": [
+		{"name": "etl", "attributes": {"app": "airflow"}, "read_write_splitting_policy": "random", "read_write_splitting_ratio": 100, "read_after_write_consistency": "session"},
+		{"name": "dump", "attributes": {"program_name": "mysqldump"}}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, classes, 2)
+	assert.Equal(t, "etl", classes[0].Name)
+	assert.Equal(t, 100, *classes[0].ReadWriteSplittingRatio)
+	assert.Nil(t, classes[1].ReadWriteSplittingRatio)
+
+	for _, tcase := range []struct {
+		config, err string
+	}{
+		{`{"classes": [{"attributes": {"app": "x"}}]}`, "workload class #1 has no name"},
+		{`{"classes": [{"name": "a", "attributes": {"app": "x"}}, {"name": "a", "attributes": {"app": "y"}}]}`, "workload class a is defined twice"},
+		{`{"classes": [{"name": "a"}]}`, "workload class a has no attributes"},
+		{`{"classes": [{"name": "a", "attributes": {"app": "x"}, "read_write_splitting_policy": "nope"}]}`, "workload class a: Unknown ReadWriteSplittingPolicy: 'nope'"},
+		{`{"classes": [{"name": "a", "attributes": {"app": "x"}, "read_write_splitting_ratio": 101}]}`, "workload class a: read write splitting ratio out of range"},
+		{`{"classes": [{"name": "a", "attributes": {"app": "x"}, "read_after_write_consistency": "nope"}]}`, "workload class a: read_after_write_consistency must be one of [EVENTUAL,SESSION,INSTANCE,GLOBAL]"},
+		{`{"classes": [{"name": "a", "attributes": {"app": "x"}, "idle_timeout": "-1s"}]}`, `workload class a: invalid idle_timeout "-1s"`},
+		{`{"classes": [{"name": "a", "attributes": {"app": "x"}, "policy": "random"}]}`, `json: unknown field "policy"`},
+	} {
+		_, err := parseWorkloadClasses([]byte(tcase.config))
+		assert.EqualError(t, err, tcase.err, tcase.config)
+	}
+}
+
+func TestWorkloadClassSessions(t *testing.T) {
+	defer func(classes []*workloadClass) { workloadClasses = classes }(workloadClasses)
+	var err error
+	workloadClasses, err = parseWorkloadClasses([]byte(`{"classes": [
+		{"name": "etl", "attributes": {"app": "airflow", "team": "data"}, "read_write_splitting_policy": "random", "read_write_splitting_ratio": 100, "read_after_write_consistency": "global"},
+		{"name": "airflow", "attributes": {"app": "airflow"}}
+	]}`))
+	require.NoError(t, err)
+
+	vh := newVtgateHandler(nil)
+	// A session is of the first class whose attributes all match.
+	etl := &mysql.Conn{Attributes: map[string]string{"app": "airflow", "team": "data", "_pid": "1"}}
+	session := vh.session(etl)
+	assert.Equal(t, "etl", workloadSubcomponent(etl))
+	assert.Equal(t, "random", session.ReadWriteSplittingPolicy)
+	assert.EqualValues(t, 100, session.ReadWriteSplittingRatio)
+	assert.EqualValues(t, 100, session.ResolverOptions.ReadWriteSplittingRatio)
+	assert.Equal(t, vtgatepb.ReadAfterWriteConsistency_GLOBAL, session.ReadAfterWrite.ReadAfterWriteConsistency)
+
+	airflow := &mysql.Conn{Attributes: map[string]string{"app": "airflow", "team": "web"}}
+	session = vh.session(airflow)
+	assert.Equal(t, "airflow", workloadSubcomponent(airflow))
+	assert.Equal(t, defaultReadWriteSplittingPolicy, session.ReadWriteSplittingPolicy)
+
+	// The other sessions keep the defaults of the flags.
+	other := &mysql.Conn{}
+	session = vh.session(other)
+	assert.Equal(t, mysqlSubcomponent, workloadSubcomponent(other))
+	assert.Equal(t, newSession().ReadAfterWrite, session.ReadAfterWrite)
+}
@@ -0,0 +1,213 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package binlogserver lets a tablet act as a binlog server: external MySQL
+// replicas and change data capture tools connect to it with the MySQL
+// protocol and replicate from the MySQL of the tablet with COM_BINLOG_DUMP_GTID
+// or COM_BINLOG_DUMP, without being given the address of that MySQL.
+//
+// Each client connection is relayed to its own replication connection to the
+// MySQL of the tablet, made with the --db_repl_* credentials. The statements a
+// replica runs before dumping, such as setting @master_binlog_checksum or
+// @master_heartbeat_period, are run on that connection, so they apply to the
+// dump. The clients are served asynchronously: semi-sync is not negotiated.
+package binlogserver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/dbconfigs"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+var (
+	binlogServerPort           = -1
+	binlogServerBindAddress    string
+	binlogServerAuthStaticFile string
+	// The server ID of the dump connections is the ID of the client connection
+	// plus this offset. MySQL keeps one dump per server ID, so it must not be
+	// the server ID of another replica of the MySQL.
+	binlogServerIDOffset uint32 = 1000000000
+
+	// binlogServerDumps counts the dumps that were started, by command.
+	binlogServerDumps = stats.NewCountersWithSingleLabel("BinlogServerDumps", "Binlog dumps served to the clients of the binlog server", "Command")
+	// binlogServerActiveDumps is the number of dumps being served.
+	binlogServerActiveDumps = stats.NewGauge("BinlogServerActiveDumps", "Binlog dumps being served to the clients of the binlog server")
+)
+
+func registerFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&binlogServerPort, "binlog_server_port", binlogServerPort, "If set, serve the binlogs of the MySQL of the tablet to MySQL replicas on this port.")
+	fs.StringVar(&binlogServerBindAddress, "binlog_server_bind_address", binlogServerBindAddress, "Binds on this address when serving binlogs. If empty, binds on all addresses.")
+	fs.StringVar(&binlogServerAuthStaticFile, "binlog_server_auth_static_file", binlogServerAuthStaticFile, "JSON File to read the users of the binlog server from, in the format of --mysql_auth_server_static_file.")
+	fs.Uint32Var(&binlogServerIDOffset, "binlog_server_id_offset", binlogServerIDOffset, "The server ID of the replication connections of the binlog server is the ID of the client connection plus this offset.")
+}
+
+func init() {
+	servenv.OnParseFor("vttablet", registerFlags)
+}
+
+// Init starts the binlog server if --binlog_server_port is set. The binlogs
+// are read from MySQL with the replication credentials of dbcfgs.
+func Init(dbcfgs *dbconfigs.DBConfigs) {
+	if binlogServerPort < 0 {
+		return
+	}
+	if binlogServerAuthStaticFile == "" {
+		log.Exitf("--binlog_server_auth_static_file is required with --binlog_server_port")
+	}
+	authServer := mysql.NewAuthServerStatic(binlogServerAuthStaticFile, "", 0)
+	connector := dbcfgs.ReplConnector()
+	h := newHandler(func(ctx context.Context) (*mysql.Conn, error) {
+		return connector.Connect(ctx)
+	})
+
+	address := fmt.Sprintf("%s:%d", binlogServerBindAddress, binlogServerPort)
+	listener, err := mysql.NewListener("tcp", address, authServer, h, 0, 0, false, false)
+	if err != nil {
+		log.Exitf("binlog server: cannot listen on %v: %v", address, err)
+	}
+	servenv.OnRun(func() {
+		log.Infof("binlog server listening on %v", address)
+		go listener.Accept()
+	})
+	servenv.OnTermSync(listener.Close)
+}
+
+// semiSyncSetting matches the statements of the replicas enabling semi-sync,
+// which the binlog server doesn't do.
+var semiSyncSetting = regexp.MustCompile(`(?i)^\s*set\s+@rpl_semi_sync_(slave|replica)\s*=`)
+
+// handler relays the connections of the binlog server to MySQL.
+type handler struct {
+	mysql.UnimplementedHandler
+	// connect opens a replication connection to MySQL.
+	connect func(ctx context.Context) (*mysql.Conn, error)
+}
+
+var _ mysql.Handler = (*handler)(nil)
+
+func newHandler(connect func(ctx context.Context) (*mysql.Conn, error)) *handler {
+	return &handler{connect: connect}
+}
+
+// upstream returns the connection to MySQL of a client connection, opened by
+// its first command.
+func (h *handler) upstream(c *mysql.Conn) (*mysql.Conn, error) {
+	if conn, ok := c.ClientData.(*mysql.Conn); ok {
+		return conn, nil
+	}
+	conn, err := h.connect(context.Background())
+	if err != nil {
+		return nil, vterrors.Wrapf(err, "binlog server: cannot connect to MySQL")
+	}
+	c.ClientData = conn
+	return conn, nil
+}
+
+func (h *handler) ConnectionClosed(c *mysql.Conn) {
+	if conn, ok := c.ClientData.(*mysql.Conn); ok {
+		conn.Close()
+		c.ClientData = nil
+	}
+}
+
+// ComQuery runs the statements of the clients on their connection to MySQL.
+func (h *handler) ComQuery(c *mysql.Conn, query string, callback func(*sqltypes.Result) error) error {
+	if semiSyncSetting.MatchString(query) {
+		return callback(&sqltypes.Result{})
+	}
+	conn, err := h.upstream(c)
+	if err != nil {
+		return err
+	}
+	qr, err := conn.ExecuteFetch(query, 10000, true)
+	if err != nil {
+		return err
+	}
+	return callback(qr)
+}
+
+func (h *handler) ComPrepare(c *mysql.Conn, query string, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error) {
+	return nil, vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "binlog server: prepared statements are not supported")
+}
+
+func (h *handler) ComStmtExecute(c *mysql.Conn, prepare *mysql.PrepareData, callback func(*sqltypes.Result) error) error {
+	return vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "binlog server: prepared statements are not supported")
+}
+
+// ComRegisterReplica accepts the replicas without registering them to MySQL,
+// which only knows the binlog server.
+func (h *handler) ComRegisterReplica(c *mysql.Conn, replicaHost string, replicaPort uint16, replicaUser string, replicaPassword string) error {
+	return nil
+}
+
+func (h *handler) ComBinlogDump(c *mysql.Conn, logFile string, binlogPos uint32) error {
+	conn, err := h.upstream(c)
+	if err != nil {
+		return err
+	}
+	if err := conn.WriteComBinlogDump(h.serverID(c), logFile, binlogPos, 0); err != nil {
+		return err
+	}
+	binlogServerDumps.Add("BinlogDump", 1)
+	return h.relay(c, conn)
+}
+
+func (h *handler) ComBinlogDumpGTID(c *mysql.Conn, logFile string, logPos uint64, gtidSet mysql.GTIDSet) error {
+	conn, err := h.upstream(c)
+	if err != nil {
+		return err
+	}
+	sidBlock := mysql.Mysql56GTIDSet{}.SIDBlock()
+	if gtidSet != nil {
+		set, ok := gtidSet.(mysql.Mysql56GTIDSet)
+		if !ok {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "binlog server: unsupported GTID set %v", gtidSet)
+		}
+		sidBlock = set.SIDBlock()
+	}
+	if err := conn.WriteComBinlogDumpGTID(h.serverID(c), logFile, logPos, 0, sidBlock); err != nil {
+		return err
+	}
+	binlogServerDumps.Add("BinlogDumpGTID", 1)
+	return h.relay(c, conn)
+}
+
+// relay sends the binlog events of a dump to the client until one of the
+// connections fails. The errors of MySQL, such as purged binlogs, are sent to
+// the client.
+func (h *handler) relay(c, conn *mysql.Conn) error {
+	binlogServerActiveDumps.Add(1)
+	defer binlogServerActiveDumps.Add(-1)
+	for {
+		ev, err := conn.ReadBinlogEvent()
+		if err != nil {
+			return err
+		}
+		if err := c.WriteBinlogEvent(ev, false); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *handler) WarningCount(c *mysql.Conn) uint16 {
+	return 0
+}
+
+func (h *handler) serverID(c *mysql.Conn) uint32 {
+	return binlogServerIDOffset + c.ConnectionID
+}
@@ -0,0 +1,127 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package binlogserver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// fakeSource is a MySQL sending two binlog events to its replicas, and then
+// failing as if the binlogs were purged.
+type fakeSource struct {
+	mysql.UnimplementedHandler
+
+	mu       sync.Mutex
+	queries  []string
+	serverID uint32
+	gtidSet  mysql.GTIDSet
+}
+
+func (s *fakeSource) ComQuery(c *mysql.Conn, query string, callback func(*sqltypes.Result) error) error {
+	s.mu.Lock()
+	s.queries = append(s.queries, query)
+	s.mu.Unlock()
+	return callback(&sqltypes.Result{})
+}
+
+func (s *fakeSource) ComPrepare(*mysql.Conn, string, map[string]*querypb.BindVariable) ([]*querypb.Field, error) {
+	return nil, nil
+}
+
+func (s *fakeSource) ComStmtExecute(*mysql.Conn, *mysql.PrepareData, func(*sqltypes.Result) error) error {
+	return nil
+}
+
+func (s *fakeSource) ComRegisterReplica(*mysql.Conn, string, uint16, string, string) error {
+	return nil
+}
+
+func (s *fakeSource) ComBinlogDump(*mysql.Conn, string, uint32) error {
+	return nil
+}
+
+func (s *fakeSource) ComBinlogDumpGTID(c *mysql.Conn, logFile string, logPos uint64, gtidSet mysql.GTIDSet) error {
+	s.mu.Lock()
+	s.gtidSet = gtidSet
+	s.mu.Unlock()
+	for _, ev := range fakeEvents() {
+		if err := c.WriteBinlogEvent(ev, false); err != nil {
+			return err
+		}
+	}
+	return mysql.NewSQLError(mysql.ERMasterFatalReadingBinlog, mysql.SSUnknownSQLState, "binlogs purged")
+}
+
+func (s *fakeSource) WarningCount(*mysql.Conn) uint16 {
+	return 0
+}
+
+func fakeEvents() []mysql.BinlogEvent {
+	f := mysql.NewMySQL56BinlogFormat()
+	stream := mysql.NewFakeBinlogStream()
+	return []mysql.BinlogEvent{
+		mysql.NewRotateEvent(f, stream, 4, "binlog.000002"),
+		mysql.NewFormatDescriptionEvent(f, stream),
+	}
+}
+
+func listen(t *testing.T, handler mysql.Handler) *mysql.ConnParams {
+	listener, err := mysql.NewListener("tcp", "127.0.0.1:0", mysql.NewAuthServerNone(), handler, 0, 0, false, false)
+	require.NoError(t, err)
+	go listener.Accept()
+	t.Cleanup(listener.Close)
+	return &mysql.ConnParams{
+		Host:  "127.0.0.1",
+		Port:  listener.Addr().(*net.TCPAddr).Port,
+		Uname: "user",
+	}
+}
+
+func TestBinlogServer(t *testing.T) {
+	source := &fakeSource{}
+	sourceParams := listen(t, source)
+	serverParams := listen(t, newHandler(func(ctx context.Context) (*mysql.Conn, error) {
+		return mysql.Connect(ctx, sourceParams)
+	}))
+
+	ctx := context.Background()
+	replica, err := mysql.Connect(ctx, serverParams)
+	require.NoError(t, err)
+	defer replica.Close()
+
+	// The replica stays asynchronous.
+	for _, query := range []string{"SET @master_binlog_checksum = 'NONE'", "SET @rpl_semi_sync_slave = 1"} {
+		_, err := replica.ExecuteFetch(query, 1, false)
+		require.NoError(t, err)
+	}
+
+	gtidSet, err := mysql.ParseMysql56GTIDSet("16b1039f-22b6-11ed-b765-0a43f95f28a3:1-243")
+	require.NoError(t, err)
+	require.NoError(t, replica.WriteComBinlogDumpGTID(2, "", 4, 0, gtidSet.SIDBlock()))
+	for _, want := range fakeEvents() {
+		ev, err := replica.ReadBinlogEvent()
+		require.NoError(t, err)
+		assert.Equal(t, want.Bytes(), ev.Bytes())
+	}
+	_, err = replica.ReadBinlogEvent()
+	assert.Equal(t, mysql.ERMasterFatalReadingBinlog, mysql.NewSQLErrorFromError(err).(*mysql.SQLError).Number(), err)
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	assert.Equal(t, []string{"SET @master_binlog_checksum = 'NONE'"}, source.queries)
+	assert.True(t, gtidSet.Equal(source.gtidSet), source.gtidSet)
+}
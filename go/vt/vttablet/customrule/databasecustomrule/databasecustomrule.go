@@ -20,23 +20,35 @@ import (
 
 	"github.com/spf13/pflag"
 
+	"vitess.io/vitess/go/event"
 	"vitess.io/vitess/go/vt/log"
 	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/vt/vttablet/customrule/events"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/connpool"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
 )
 
 var (
-	databaseCustomRuleEnable         = true
-	databaseCustomRuleDbName         = sidecardb.SidecarDBName
-	databaseCustomRuleTableName      = "wescale_plugin"
-	databaseCustomRuleReloadInterval = 60 * time.Second
+	databaseCustomRuleEnable          = true
+	databaseCustomRuleDbName          = sidecardb.SidecarDBName
+	databaseCustomRuleTableName       = "wescale_plugin"
+	databaseCustomRuleUserGroupTable  = "wescale_user_group"
+	databaseCustomRuleWasmPluginTable = "wescale_wasm_plugin"
+	databaseCustomRuleReloadInterval  = 60 * time.Second
 )
 
 func registerFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&databaseCustomRuleEnable, "database_custom_rule_enable", databaseCustomRuleEnable, "enable database custom rule")
 	fs.StringVar(&databaseCustomRuleDbName, "database_custom_rule_db_name", databaseCustomRuleDbName, "sidecar db name for customrules file. default is mysql")
 	fs.StringVar(&databaseCustomRuleTableName, "database_custom_rule_table_name", databaseCustomRuleTableName, "table name for customrules file. default is wescale_plugin")
+	fs.StringVar(&databaseCustomRuleUserGroupTable, "database_custom_rule_user_group_table_name", databaseCustomRuleUserGroupTable, "table name for the members of the user groups the custom rules match. default is wescale_user_group")
+	fs.StringVar(&databaseCustomRuleWasmPluginTable, "database_custom_rule_wasm_plugin_table_name", databaseCustomRuleWasmPluginTable, "table name for the registry of the WASM plugins the custom rules reference. default is wescale_wasm_plugin")
 	fs.DurationVar(&databaseCustomRuleReloadInterval, "database_custom_rule_reload_interval", databaseCustomRuleReloadInterval, "reload interval for customrules file. default is 60s")
 }
 
@@ -118,10 +130,50 @@ func queryResultToRule(row sqltypes.RowNamedValues) (*rules.Rule, error) {
 
 	ruleInfo["Query"] = row.AsString("query_regex", "")
 	ruleInfo["QueryTemplate"] = row.AsString("query_template", "")
+	ruleInfo["QueryDigest"] = row.AsString("query_digest", "")
 	ruleInfo["RequestIP"] = row.AsString("request_ip_regex", "")
 	ruleInfo["User"] = row.AsString("user_regex", "")
+	if cidrsData := row.AsString("request_cidrs", ""); cidrsData != "" {
+		cidrs, err := unmarshalArray(cidrsData)
+		if err != nil {
+			log.Errorf("Failed to unmarshal request_cidrs: %v", err)
+			return nil, err
+		}
+		ruleInfo["RequestCIDRs"] = cidrs
+	}
+	if groupsData := row.AsString("user_groups", ""); groupsData != "" {
+		groups, err := unmarshalArray(groupsData)
+		if err != nil {
+			log.Errorf("Failed to unmarshal user_groups: %v", err)
+			return nil, err
+		}
+		ruleInfo["UserGroups"] = groups
+	}
+	if inTransaction := row["in_transaction"]; !inTransaction.IsNull() {
+		ruleInfo["InTransaction"] = row.AsInt64("in_transaction", 0) != 0
+	}
+	// An empty workload class condition would only match the sessions
+	// without a workload class.
+	if workloadClass := row.AsString("workload_class_regex", ""); workloadClass != "" {
+		ruleInfo["WorkloadClass"] = workloadClass
+	}
 	ruleInfo["LeadingComment"] = row.AsString("leading_comment_regex", "")
 	ruleInfo["TrailingComment"] = row.AsString("trailing_comment_regex", "")
+	if schedule := row.AsString("schedule", ""); schedule != "" {
+		ruleInfo["Schedule"] = schedule
+	}
+	if expiresAt, err := rowExpiresAt(row); err != nil {
+		log.Errorf("Failed to parse expires_at: %v", err)
+		return nil, err
+	} else if !expiresAt.IsZero() {
+		ruleInfo["ExpiresAt"] = expiresAt.Format(time.RFC3339)
+	}
+	if outcomeConds := row.AsString("outcome_conds", ""); outcomeConds != "" {
+		ruleInfo["OutcomeConds"] = outcomeConds
+	}
+	if accessConds := row.AsString("access_conds", ""); accessConds != "" {
+		ruleInfo["AccessConds"] = accessConds
+	}
 
 	// parse BindVarConds
 	bindVarCondsData := row.AsString("bind_var_conds", "")
@@ -146,7 +198,9 @@ func queryResultToRule(row sqltypes.RowNamedValues) (*rules.Rule, error) {
 	return rule, nil
 }
 
-func (cr *databaseCustomRule) applyRules(qr *sqltypes.Result) error {
+// applyRules applies the rules of a query result, with the members of the
+// user groups by group.
+func (cr *databaseCustomRule) applyRules(qr *sqltypes.Result, groups map[string][]string) error {
 	qrs := rules.New()
 	for _, row := range qr.Named().Rows {
 		if cr.stopped.Load() {
@@ -159,10 +213,15 @@ func (cr *databaseCustomRule) applyRules(qr *sqltypes.Result) error {
 		}
 		qrs.Add(rule)
 	}
+	// The rules are applied again when the members of their groups change.
+	qrs.SetUserGroups(groups)
 
 	if !reflect.DeepEqual(cr.qrs, qrs) {
-		cr.qrs = qrs.Copy()
-		cr.controller.SetQueryRules(databaseCustomRuleSource, qrs)
+		// The rules are applied again on the next reload if they are rejected.
+		if err := cr.controller.SetQueryRules(databaseCustomRuleSource, qrs.Copy()); err != nil {
+			return err
+		}
+		cr.qrs = qrs
 		log.Infof("Custom rule version %v fetched from topo and applied to vttablet")
 	}
 
@@ -181,10 +240,43 @@ func (cr *databaseCustomRule) reloadRulesFromDatabase() error {
 	if err != nil {
 		return fmt.Errorf("databaseCustomRule failed to get custom rules: %v", err)
 	}
+	// Fetch the members of the user groups the rules match.
+	groupsResult, err := conn.ExecOnce(context.Background(), cr.getUserGroupsSQL(), 100000, true)
+	if err != nil {
+		return fmt.Errorf("databaseCustomRule failed to get user groups: %v", err)
+	}
 	// iterate over the rows and applyRules the rules
-	if err := cr.applyRules(qr); err != nil {
+	if err := cr.applyRules(qr, queryResultToUserGroups(groupsResult)); err != nil {
 		return fmt.Errorf("databaseCustomRule failed to applyRules custom rules: %v", err)
 	}
+	// The plugins are reloaded on every reload, to follow the upgrades and
+	// the rollbacks of the plugins the rules reference without a version.
+	if err := cr.controller.ReloadWasmPlugins(context.Background(), &pluginSource{conn: conn}); err != nil {
+		log.Errorf("databaseCustomRule failed to reload the WASM plugins: %v", err)
+	}
+	// The expired rules already stopped matching, the primary deletes them
+	// for all the tablets of the shard.
+	target := cr.controller.CurrentTarget()
+	if target.GetTabletType() != topodatapb.TabletType_PRIMARY {
+		return nil
+	}
+	for _, expired := range expiredRules(qr, time.Now()) {
+		deleted, err := conn.ExecOnce(context.Background(), cr.getDeleteExpiredSQL(expired), 1, false)
+		if err != nil {
+			return fmt.Errorf("databaseCustomRule failed to delete expired custom rule %s: %v", expired.Name, err)
+		}
+		// The rule was changed since it was read, like to expire later.
+		if deleted.RowsAffected == 0 {
+			continue
+		}
+		log.Infof("Custom rule %s expired at %v and was deleted", expired.Name, expired.ExpiresAt)
+		event.Dispatch(&events.RuleExpired{
+			Keyspace:  target.Keyspace,
+			Shard:     target.Shard,
+			Name:      expired.Name,
+			ExpiresAt: expired.ExpiresAt,
+		})
+	}
 
 	return nil
 }
@@ -193,9 +285,145 @@ func (cr *databaseCustomRule) getReloadSQL() string {
 	return fmt.Sprintf("SELECT * FROM %s.%s", databaseCustomRuleDbName, databaseCustomRuleTableName)
 }
 
+// expiredRule is a rule of the database which expired.
+type expiredRule struct {
+	Name      string
+	ExpiresAt time.Time
+}
+
+// expiredRules returns the rules of a query result which expired at now.
+func expiredRules(qr *sqltypes.Result, now time.Time) []expiredRule {
+	var expired []expiredRule
+	for _, row := range qr.Named().Rows {
+		expiresAt, err := rowExpiresAt(row)
+		if err != nil || expiresAt.IsZero() || now.Before(expiresAt) {
+			continue
+		}
+		expired = append(expired, expiredRule{Name: row.AsString("name", ""), ExpiresAt: expiresAt})
+	}
+	return expired
+}
+
+// rowExpiresAt returns the time the rule of a row expires at, the zero time
+// if it never expires.
+func rowExpiresAt(row sqltypes.RowNamedValues) (time.Time, error) {
+	expiresAt := row.AsString("expires_at", "")
+	if expiresAt == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(rules.ExpiresAtLayout, expiresAt, time.UTC)
+}
+
+// getDeleteExpiredSQL returns the SQL statement to delete an expired rule,
+// unless it was changed since it was read.
+func (cr *databaseCustomRule) getDeleteExpiredSQL(expired expiredRule) string {
+	tableSchemaName := fmt.Sprintf("`%s`.`%s`", databaseCustomRuleDbName, databaseCustomRuleTableName)
+	parsed := sqlparser.BuildParsedQuery("DELETE FROM "+tableSchemaName+" WHERE `name` = %a AND `expires_at` = %a", ":name", ":expires_at")
+	bound, _ := parsed.GenerateQuery(map[string]*querypb.BindVariable{
+		"name":       sqltypes.StringBindVariable(expired.Name),
+		"expires_at": sqltypes.StringBindVariable(expired.ExpiresAt.UTC().Format(rules.ExpiresAtLayout)),
+	}, nil)
+	return bound
+}
+
+func (cr *databaseCustomRule) getUserGroupsSQL() string {
+	return fmt.Sprintf("SELECT group_name, user FROM %s.%s", databaseCustomRuleDbName, databaseCustomRuleUserGroupTable)
+}
+
+// queryResultToUserGroups returns the members of the user groups of a query
+// result, by group.
+func queryResultToUserGroups(qr *sqltypes.Result) map[string][]string {
+	groups := make(map[string][]string)
+	for _, row := range qr.Named().Rows {
+		group := row.AsString("group_name", "")
+		groups[group] = append(groups[group], row.AsString("user", ""))
+	}
+	return groups
+}
+
+// pluginSource reads the registry of the WASM plugins of the database.
+type pluginSource struct {
+	conn *connpool.DBConn
+}
+
+// Resolve implements wasm.Source.
+func (ps *pluginSource) Resolve(ctx context.Context, refs []string) (map[string]wasm.Version, error) {
+	var names []string
+	for _, ref := range refs {
+		name, _, err := adminapi.ParsePluginReference(ref)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	qr, err := ps.conn.ExecOnce(ctx, getPluginVersionsSQL(names), 100000, true)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePluginReferences(refs, qr), nil
+}
+
+// Binary implements wasm.Source.
+func (ps *pluginSource) Binary(ctx context.Context, version wasm.Version) ([]byte, error) {
+	qr, err := ps.conn.ExecOnce(ctx, getPluginBinarySQL(version), 1, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Rows) == 0 {
+		return nil, fmt.Errorf("plugin %s not found", version.Ref())
+	}
+	return qr.Rows[0][0].ToBytes()
+}
+
+// getPluginVersionsSQL returns the SQL statement to read the versions of the
+// plugins of names, without their binaries.
+func getPluginVersionsSQL(names []string) string {
+	tableSchemaName := fmt.Sprintf("`%s`.`%s`", databaseCustomRuleDbName, databaseCustomRuleWasmPluginTable)
+	parsed := sqlparser.BuildParsedQuery("SELECT `name`, `version`, `checksum`, `is_current` FROM "+tableSchemaName+" WHERE `name` IN %a", "::names")
+	bindVar, _ := sqltypes.BuildBindVariable(names)
+	bound, _ := parsed.GenerateQuery(map[string]*querypb.BindVariable{"names": bindVar}, nil)
+	return bound
+}
+
+// getPluginBinarySQL returns the SQL statement to read the binary of a
+// version of a plugin.
+func getPluginBinarySQL(version wasm.Version) string {
+	tableSchemaName := fmt.Sprintf("`%s`.`%s`", databaseCustomRuleDbName, databaseCustomRuleWasmPluginTable)
+	parsed := sqlparser.BuildParsedQuery("SELECT `wasm_binary` FROM "+tableSchemaName+" WHERE `name` = %a AND `version` = %a", ":name", ":version")
+	bound, _ := parsed.GenerateQuery(map[string]*querypb.BindVariable{
+		"name":    sqltypes.StringBindVariable(version.Name),
+		"version": sqltypes.StringBindVariable(version.Version),
+	}, nil)
+	return bound
+}
+
+// resolvePluginReferences returns the versions the references to the plugins
+// resolve to in a query result: name@version to that version, and name to the
+// current version of the plugin.
+func resolvePluginReferences(refs []string, qr *sqltypes.Result) map[string]wasm.Version {
+	versions := make(map[string]wasm.Version)
+	current := make(map[string]wasm.Version)
+	for _, row := range qr.Named().Rows {
+		version := wasm.Version{Name: row.AsString("name", ""), Version: row.AsString("version", ""), Checksum: row.AsString("checksum", "")}
+		versions[version.Ref()] = version
+		if row.AsInt64("is_current", 0) != 0 {
+			current[version.Name] = version
+		}
+	}
+	resolved := make(map[string]wasm.Version, len(refs))
+	for _, ref := range refs {
+		if version, ok := versions[ref]; ok {
+			resolved[ref] = version
+		} else if version, ok := current[ref]; ok {
+			resolved[ref] = version
+		}
+	}
+	return resolved
+}
+
 func (cr *databaseCustomRule) getInsertSQLTemplate() string {
 	tableSchemaName := fmt.Sprintf("`%s`.`%s`", databaseCustomRuleDbName, databaseCustomRuleTableName)
-	return "INSERT INTO " + tableSchemaName + " (`name`, `description`, `priority`, `status`, `plans`, `fully_qualified_table_names`, `query_regex`, `query_template`, `request_ip_regex`, `user_regex`, `leading_comment_regex`, `trailing_comment_regex`, `bind_var_conds`, `action`, `action_args`) VALUES (%a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a)"
+	return "INSERT INTO " + tableSchemaName + " (`name`, `description`, `priority`, `status`, `plans`, `fully_qualified_table_names`, `query_regex`, `query_template`, `request_ip_regex`, `user_regex`, `workload_class_regex`, `leading_comment_regex`, `trailing_comment_regex`, `bind_var_conds`, `action`, `action_args`, `schedule`, `outcome_conds`, `request_cidrs`, `user_groups`, `in_transaction`, `query_digest`, `expires_at`, `access_conds`) VALUES (%a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a, %a)"
 }
 
 // GenerateInsertStatement returns the SQL statement to insert the rule into the database.
@@ -212,11 +440,20 @@ func (cr *databaseCustomRule) GenerateInsertStatement(qr *rules.Rule) (string, e
 		":query_template",
 		":request_ip_regex",
 		":user_regex",
+		":workload_class_regex",
 		":leading_comment_regex",
 		":trailing_comment_regex",
 		":bind_var_conds",
 		":action",
 		":action_args",
+		":schedule",
+		":outcome_conds",
+		":request_cidrs",
+		":user_groups",
+		":in_transaction",
+		":query_digest",
+		":expires_at",
+		":access_conds",
 	)
 	bindVars, err := qr.ToBindVariable()
 	if err != nil {
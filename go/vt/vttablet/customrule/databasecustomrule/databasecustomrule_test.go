@@ -7,11 +7,16 @@ package databasecustomrule
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
 	"vitess.io/vitess/go/vt/topo/memorytopo"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
 	"vitess.io/vitess/go/vt/vttablet/tabletservermock"
 )
 
@@ -56,7 +61,7 @@ func TestDatabaseCustomRuleApplyRules(t *testing.T) {
 	cr, _ := newDatabaseCustomRule(controller)
 
 	qr := &sqltypes.Result{}
-	err := cr.applyRules(qr)
+	err := cr.applyRules(qr, nil)
 
 	if err != nil {
 		t.Errorf("Expected no error, but got: %v", err)
@@ -72,7 +77,7 @@ func TestApplyRulesWithEmptyResult(t *testing.T) {
 	cr, _ := newDatabaseCustomRule(controller)
 	qr := NewMockResult()
 
-	err := cr.applyRules(qr)
+	err := cr.applyRules(qr, nil)
 
 	assert.NoError(t, err)
 }
@@ -83,7 +88,66 @@ func TestApplyRulesWithStoppedRule(t *testing.T) {
 	cr.stop()
 	qr := NewMockResult()
 
-	err := cr.applyRules(qr)
+	err := cr.applyRules(qr, nil)
 
 	assert.NoError(t, err)
 }
+
+func TestApplyRulesWithUserGroups(t *testing.T) {
+	controller := NewMockController()
+	cr, _ := newDatabaseCustomRule(controller)
+	qr := sqltypes.MakeTestResult(sqltypes.MakeTestFields("name|priority|status|request_ip_regex|user_regex|action|user_groups", "varchar|int32|varchar|varchar|varchar|varchar|text"),
+		`analytics|1000|ACTIVE|.*|.*|FAIL|["analytics"]`)
+	groups := queryResultToUserGroups(sqltypes.MakeTestResult(sqltypes.MakeTestFields("group_name|user", "varchar|varchar"),
+		"analytics|etl1", "analytics|etl2", "admins|root"))
+	assert.Equal(t, map[string][]string{"analytics": {"etl1", "etl2"}, "admins": {"root"}}, groups)
+
+	require.NoError(t, cr.applyRules(qr, groups))
+	action := func(user string) rules.Action {
+		act, _, _ := controller.GetQueryRules(databaseCustomRuleSource).GetAction("", user, "", false, nil, sqlparser.MarginComments{})
+		return act
+	}
+	assert.Equal(t, rules.QRFail, action("etl2"))
+	assert.Equal(t, rules.QRContinue, action("root"))
+
+	// A change of the members applies the rules again.
+	require.NoError(t, cr.applyRules(qr, map[string][]string{"analytics": {"root"}}))
+	assert.Equal(t, rules.QRContinue, action("etl2"))
+	assert.Equal(t, rules.QRFail, action("root"))
+}
+
+func TestExpiredRules(t *testing.T) {
+	controller := NewMockController()
+	cr, _ := newDatabaseCustomRule(controller)
+	qr := sqltypes.MakeTestResult(sqltypes.MakeTestFields("name|priority|status|request_ip_regex|user_regex|action|expires_at", "varchar|int32|varchar|varchar|varchar|varchar|datetime"),
+		"expired|1000|ACTIVE|.*|.*|FAIL|2026-10-14 12:00:00",
+		"pending|1000|ACTIVE|.*|.*|FAIL|2026-10-14 13:00:00",
+		"forever|1000|ACTIVE|.*|.*|FAIL|null")
+	now := time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC)
+	expired := expiredRules(qr, now)
+	assert.Equal(t, []expiredRule{{Name: "expired", ExpiresAt: time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)}}, expired)
+	assert.Equal(t, "DELETE FROM `mysql`.`wescale_plugin` WHERE `name` = 'expired' AND `expires_at` = '2026-10-14 12:00:00'", cr.getDeleteExpiredSQL(expired[0]))
+
+	rule, err := queryResultToRule(qr.Named().Rows[1])
+	require.NoError(t, err)
+	assert.True(t, rule.ExpiresAt().Equal(time.Date(2026, 10, 14, 13, 0, 0, 0, time.UTC)))
+	assert.False(t, rule.Expired(now))
+	rule, err = queryResultToRule(qr.Named().Rows[2])
+	require.NoError(t, err)
+	assert.True(t, rule.ExpiresAt().IsZero())
+}
+
+func TestResolvePluginReferences(t *testing.T) {
+	qr := sqltypes.MakeTestResult(sqltypes.MakeTestFields("name|version|checksum|is_current", "varchar|varchar|varchar|int8"),
+		"tenant|1.0.0|aaaa|0",
+		"tenant|1.1.0|bbbb|1",
+		"audit|2|cccc|0")
+	versions := resolvePluginReferences([]string{"tenant", "tenant@1.0.0", "audit", "audit@3"}, qr)
+	assert.Equal(t, map[string]wasm.Version{
+		"tenant":       {Name: "tenant", Version: "1.1.0", Checksum: "bbbb"},
+		"tenant@1.0.0": {Name: "tenant", Version: "1.0.0", Checksum: "aaaa"},
+	}, versions)
+
+	assert.Equal(t, "SELECT `name`, `version`, `checksum`, `is_current` FROM `mysql`.`wescale_wasm_plugin` WHERE `name` IN ('tenant', 'audit')", getPluginVersionsSQL([]string{"tenant", "audit"}))
+	assert.Equal(t, "SELECT `wasm_binary` FROM `mysql`.`wescale_wasm_plugin` WHERE `name` = 'tenant' AND `version` = '1.0.0'", getPluginBinarySQL(versions["tenant@1.0.0"]))
+}
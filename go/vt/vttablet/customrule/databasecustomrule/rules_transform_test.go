@@ -26,6 +26,7 @@ func expectedRule() *rules.Rule {
 
 	qr.SetIPCond(".*")
 	qr.SetUserCond(".*")
+	qr.SetWorkloadClassCond(".*")
 	qr.SetQueryCond(".*")
 	qr.SetLeadingCommentCond(".*")
 	qr.SetTrailingCommentCond(".*")
@@ -49,11 +50,11 @@ func expectedRule() *rules.Rule {
 }
 
 func expectedJSONString() string {
-	return `{"Description":"ruleDescription","Name":"ruleName","Priority":1000,"Status":"ACTIVE","RequestIP":".*","User":".*","Query":".*","QueryTemplate":"select * from t1 where a = :a and b = :b","LeadingComment":".*","TrailingComment":".*","Plans":["Insert","Select"],"FullyQualifiedTableNames":["db1.table1","*.*","*.table","db3.*"],"BindVarConds":[{"Name":"b","OnAbsent":false,"OnMismatch":true,"Operator":"==","Value":"b"},{"Name":"a","OnAbsent":true,"OnMismatch":false,"Operator":"==","Value":"a"}],"Action":"FAIL","ActionArgs":""}`
+	return `{"Description":"ruleDescription","Name":"ruleName","Priority":1000,"Status":"ACTIVE","RequestIP":".*","User":".*","WorkloadClass":".*","Query":".*","QueryTemplate":"select * from t1 where a = :a and b = :b","LeadingComment":".*","TrailingComment":".*","Plans":["Insert","Select"],"FullyQualifiedTableNames":["db1.table1","*.*","*.table","db3.*"],"BindVarConds":[{"Name":"b","OnAbsent":false,"OnMismatch":true,"Operator":"==","Value":"b"},{"Name":"a","OnAbsent":true,"OnMismatch":false,"Operator":"==","Value":"a"}],"Action":"FAIL","ActionArgs":""}`
 }
 
 func expectedSQLString() string {
-	return "INSERT INTO `mysql`.`wescale_plugin` (`name`, `description`, `priority`, `status`, `plans`, `fully_qualified_table_names`, `query_regex`, `query_template`, `request_ip_regex`, `user_regex`, `leading_comment_regex`, `trailing_comment_regex`, `bind_var_conds`, `action`, `action_args`) VALUES ('ruleName', 'ruleDescription', 1000, 'ACTIVE', '[\\\"Insert\\\",\\\"Select\\\"]', '[\\\"db1.table1\\\",\\\"*.*\\\",\\\"*.table\\\",\\\"db3.*\\\"]', '.*', 'select * from t1 where a = :a and b = :b', '.*', '.*', '.*', '.*', '[{\\\"Name\\\":\\\"b\\\",\\\"OnAbsent\\\":false,\\\"OnMismatch\\\":true,\\\"Operator\\\":\\\"==\\\",\\\"Value\\\":\\\"b\\\"},{\\\"Name\\\":\\\"a\\\",\\\"OnAbsent\\\":true,\\\"OnMismatch\\\":false,\\\"Operator\\\":\\\"==\\\",\\\"Value\\\":\\\"a\\\"}]', 'FAIL', '')"
+	return "INSERT INTO `mysql`.`wescale_plugin` (`name`, `description`, `priority`, `status`, `plans`, `fully_qualified_table_names`, `query_regex`, `query_template`, `request_ip_regex`, `user_regex`, `workload_class_regex`, `leading_comment_regex`, `trailing_comment_regex`, `bind_var_conds`, `action`, `action_args`, `schedule`, `outcome_conds`, `request_cidrs`, `user_groups`, `in_transaction`, `query_digest`, `expires_at`, `access_conds`) VALUES ('ruleName', 'ruleDescription', 1000, 'ACTIVE', '[\\\"Insert\\\",\\\"Select\\\"]', '[\\\"db1.table1\\\",\\\"*.*\\\",\\\"*.table\\\",\\\"db3.*\\\"]', '.*', 'select * from t1 where a = :a and b = :b', '.*', '.*', '.*', '.*', '.*', '[{\\\"Name\\\":\\\"b\\\",\\\"OnAbsent\\\":false,\\\"OnMismatch\\\":true,\\\"Operator\\\":\\\"==\\\",\\\"Value\\\":\\\"b\\\"},{\\\"Name\\\":\\\"a\\\",\\\"OnAbsent\\\":true,\\\"OnMismatch\\\":false,\\\"Operator\\\":\\\"==\\\",\\\"Value\\\":\\\"a\\\"}]', 'FAIL', '', '', '', '', '', null, '', null, '')"
 }
 
 func TestRule2Json(t *testing.T) {
@@ -114,6 +115,9 @@ func TestRule2SQL(t *testing.T) {
 		}, {
 			Name: "user_regex",
 			Type: sqltypes.VarChar,
+		}, {
+			Name: "workload_class_regex",
+			Type: sqltypes.VarChar,
 		}, {
 			Name: "leading_comment_regex",
 			Type: sqltypes.Text,
@@ -129,6 +133,9 @@ func TestRule2SQL(t *testing.T) {
 		}, {
 			Name: "action_args",
 			Type: sqltypes.Text,
+		}, {
+			Name: "schedule",
+			Type: sqltypes.Text,
 		}}
 	queryResult := &sqltypes.Result{
 		Fields: tableFields,
@@ -146,15 +153,18 @@ func TestRule2SQL(t *testing.T) {
 			sqltypes.MakeTrusted(sqltypes.Text, []byte("select * from t1 where a = :a and b = :b")), // query_template
 			sqltypes.NewVarChar(".*"),                                                               // request_ip_regex
 			sqltypes.NewVarChar(".*"),                                                               // user_regex
+			sqltypes.NewVarChar(".*"),                                                               // workload_class_regex
 			sqltypes.MakeTrusted(sqltypes.Text, []byte(".*")),                                       // leading_comment_regex
 			sqltypes.MakeTrusted(sqltypes.Text, []byte(".*")),                                       // trailing_comment_regex
 			sqltypes.MakeTrusted(sqltypes.Text, []byte(`[{"Name":"b","OnAbsent":false,"OnMismatch":true,"Operator":"","Value":null},{"Name":"a","OnAbsent":true,"OnMismatch":false,"Operator":"","Value":null}]`)), // bind_var_conds
-			sqltypes.NewVarChar("FAIL"),                     // action
-			sqltypes.MakeTrusted(sqltypes.Text, []byte("")), // action_args
+			sqltypes.NewVarChar("FAIL"),                                                   // action
+			sqltypes.MakeTrusted(sqltypes.Text, []byte("")),                               // action_args
+			sqltypes.MakeTrusted(sqltypes.Text, []byte(`{"cron": "* 9-17 * * mon-fri"}`)), // schedule
 		}},
 	}
 	rule, err := queryResultToRule(queryResult.Named().Rows[0])
 	assert.NoError(t, err)
+	assert.Equal(t, `{"cron": "* 9-17 * * mon-fri"}`, rule.GetSchedule())
 	fmt.Println(rule)
 	//todo filter: support bind_var_conds
 	//assert.Equal(t, expectedRule(), rule)
@@ -0,0 +1,22 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package events defines the structures used for events relating to the
+// custom rules of the tablets.
+package events
+
+import (
+	"time"
+)
+
+// RuleExpired is an event that describes the expiration of a custom rule.
+// It is triggered when the primary tablet of a shard deletes the rule, once
+// the time it expires at passed.
+type RuleExpired struct {
+	Keyspace  string
+	Shard     string
+	Name      string
+	ExpiresAt time.Time
+}
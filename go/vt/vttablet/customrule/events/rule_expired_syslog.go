@@ -0,0 +1,22 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package events
+
+import (
+	"fmt"
+	"log/syslog"
+	"time"
+
+	"vitess.io/vitess/go/event/syslogger"
+)
+
+// Syslog writes the event to syslog.
+func (re *RuleExpired) Syslog() (syslog.Priority, string) {
+	return syslog.LOG_INFO, fmt.Sprintf("%s/%s [rule] %s expired at %s",
+		re.Keyspace, re.Shard, re.Name, re.ExpiresAt.UTC().Format(time.RFC3339))
+}
+
+var _ syslogger.Syslogger = (*RuleExpired)(nil) // compile-time interface check
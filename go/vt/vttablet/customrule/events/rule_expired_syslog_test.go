@@ -0,0 +1,26 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package events
+
+import (
+	"log/syslog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleExpiredSyslog(t *testing.T) {
+	re := &RuleExpired{
+		Keyspace:  "keyspace-123",
+		Shard:     "shard-123",
+		Name:      "emergency",
+		ExpiresAt: time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC),
+	}
+	gotSev, gotMsg := re.Syslog()
+	assert.Equal(t, syslog.LOG_INFO, gotSev)
+	assert.Equal(t, "keyspace-123/shard-123 [rule] emergency expired at 2026-10-14T12:30:00Z", gotMsg)
+}
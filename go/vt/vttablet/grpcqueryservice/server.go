@@ -51,7 +51,7 @@ var _ queryservicepb.QueryServer = (*query)(nil)
 // ExecuteInternal is part of the queryservice.QueryServer interface
 func (q *query) ExecuteInternal(ctx context.Context, request *querypb.ExecuteRequest) (response *querypb.ExecuteResponse, err error) {
 	defer q.server.HandlePanic(&err)
-	ctx = callerid.NewContext(callinfo.GRPCCallInfo(ctx),
+	ctx = callerid.NewContext(sqltypes.WithRowBuffers(callinfo.GRPCCallInfo(ctx)),
 		request.EffectiveCallerId,
 		request.ImmediateCallerId,
 	)
@@ -67,7 +67,7 @@ func (q *query) ExecuteInternal(ctx context.Context, request *querypb.ExecuteReq
 // Execute is part of the queryservice.QueryServer interface
 func (q *query) Execute(ctx context.Context, request *querypb.ExecuteRequest) (response *querypb.ExecuteResponse, err error) {
 	defer q.server.HandlePanic(&err)
-	ctx = callerid.NewContext(callinfo.GRPCCallInfo(ctx),
+	ctx = callerid.NewContext(sqltypes.WithRowBuffers(callinfo.GRPCCallInfo(ctx)),
 		request.EffectiveCallerId,
 		request.ImmediateCallerId,
 	)
@@ -83,7 +83,7 @@ func (q *query) Execute(ctx context.Context, request *querypb.ExecuteRequest) (r
 // StreamExecute is part of the queryservice.QueryServer interface
 func (q *query) StreamExecute(request *querypb.StreamExecuteRequest, stream queryservicepb.Query_StreamExecuteServer) (err error) {
 	defer q.server.HandlePanic(&err)
-	ctx := callerid.NewContext(callinfo.GRPCCallInfo(stream.Context()),
+	ctx := callerid.NewContext(sqltypes.WithRowBuffers(callinfo.GRPCCallInfo(stream.Context())),
 		request.EffectiveCallerId,
 		request.ImmediateCallerId,
 	)
@@ -259,7 +259,7 @@ func (q *query) ReadTransaction(ctx context.Context, request *querypb.ReadTransa
 // BeginExecute is part of the queryservice.QueryServer interface
 func (q *query) BeginExecute(ctx context.Context, request *querypb.BeginExecuteRequest) (response *querypb.BeginExecuteResponse, err error) {
 	defer q.server.HandlePanic(&err)
-	ctx = callerid.NewContext(callinfo.GRPCCallInfo(ctx),
+	ctx = callerid.NewContext(sqltypes.WithRowBuffers(callinfo.GRPCCallInfo(ctx)),
 		request.EffectiveCallerId,
 		request.ImmediateCallerId,
 	)
@@ -286,7 +286,7 @@ func (q *query) BeginExecute(ctx context.Context, request *querypb.BeginExecuteR
 // BeginStreamExecute is part of the queryservice.QueryServer interface
 func (q *query) BeginStreamExecute(request *querypb.BeginStreamExecuteRequest, stream queryservicepb.Query_BeginStreamExecuteServer) (err error) {
 	defer q.server.HandlePanic(&err)
-	ctx := callerid.NewContext(callinfo.GRPCCallInfo(stream.Context()),
+	ctx := callerid.NewContext(sqltypes.WithRowBuffers(callinfo.GRPCCallInfo(stream.Context())),
 		request.EffectiveCallerId,
 		request.ImmediateCallerId,
 	)
@@ -389,7 +389,7 @@ func (q *query) VStreamResults(request *binlogdatapb.VStreamResultsRequest, stre
 // ReserveExecute implements the QueryServer interface
 func (q *query) ReserveExecute(ctx context.Context, request *querypb.ReserveExecuteRequest) (response *querypb.ReserveExecuteResponse, err error) {
 	defer q.server.HandlePanic(&err)
-	ctx = callerid.NewContext(callinfo.GRPCCallInfo(ctx),
+	ctx = callerid.NewContext(sqltypes.WithRowBuffers(callinfo.GRPCCallInfo(ctx)),
 		request.EffectiveCallerId,
 		request.ImmediateCallerId,
 	)
@@ -415,7 +415,7 @@ func (q *query) ReserveExecute(ctx context.Context, request *querypb.ReserveExec
 // ReserveStreamExecute is part of the queryservice.QueryServer interface
 func (q *query) ReserveStreamExecute(request *querypb.ReserveStreamExecuteRequest, stream queryservicepb.Query_ReserveStreamExecuteServer) (err error) {
 	defer q.server.HandlePanic(&err)
-	ctx := callerid.NewContext(callinfo.GRPCCallInfo(stream.Context()),
+	ctx := callerid.NewContext(sqltypes.WithRowBuffers(callinfo.GRPCCallInfo(stream.Context())),
 		request.EffectiveCallerId,
 		request.ImmediateCallerId,
 	)
@@ -439,7 +439,7 @@ func (q *query) ReserveStreamExecute(request *querypb.ReserveStreamExecuteReques
 // ReserveBeginExecute implements the QueryServer interface
 func (q *query) ReserveBeginExecute(ctx context.Context, request *querypb.ReserveBeginExecuteRequest) (response *querypb.ReserveBeginExecuteResponse, err error) {
 	defer q.server.HandlePanic(&err)
-	ctx = callerid.NewContext(callinfo.GRPCCallInfo(ctx),
+	ctx = callerid.NewContext(sqltypes.WithRowBuffers(callinfo.GRPCCallInfo(ctx)),
 		request.EffectiveCallerId,
 		request.ImmediateCallerId,
 	)
@@ -469,7 +469,7 @@ func (q *query) ReserveBeginExecute(ctx context.Context, request *querypb.Reserv
 // ReserveBeginStreamExecute is part of the queryservice.QueryServer interface
 func (q *query) ReserveBeginStreamExecute(request *querypb.ReserveBeginStreamExecuteRequest, stream queryservicepb.Query_ReserveBeginStreamExecuteServer) (err error) {
 	defer q.server.HandlePanic(&err)
-	ctx := callerid.NewContext(callinfo.GRPCCallInfo(stream.Context()),
+	ctx := callerid.NewContext(sqltypes.WithRowBuffers(callinfo.GRPCCallInfo(stream.Context())),
 		request.EffectiveCallerId,
 		request.ImmediateCallerId,
 	)
@@ -188,14 +188,26 @@ func NewJobController(tableName string, tabletTypeFunc func() topodatapb.TabletT
 func (jc *JobController) HandleRequest(command, sql, jobUUID, tableSchema, runningTimePeriodStart, runningTimePeriodEnd, runningTimePeriodTimeZone, throttleDuration, throttleRatio string, timeGapInMs, usrBatchSize int64, postponeLaunch bool, failPolicy string, showDetails bool) (*sqltypes.Result, error) {
 	switch command {
 	case SubmitJob:
+		if cronExpr, cronTimeZone := getDMLJobCron(sql); cronExpr != "" {
+			return jc.SubmitSchedule(sql, cronExpr, cronTimeZone, tableSchema, runningTimePeriodStart, runningTimePeriodEnd, runningTimePeriodTimeZone, timeGapInMs, usrBatchSize, postponeLaunch, failPolicy, throttleDuration, throttleRatio)
+		}
 		return jc.SubmitJob(sql, tableSchema, runningTimePeriodStart, runningTimePeriodEnd, runningTimePeriodTimeZone, timeGapInMs, usrBatchSize, postponeLaunch, failPolicy, throttleDuration, throttleRatio)
 	case PauseJob:
+		if jc.isDMLJobSchedule(jobUUID) {
+			return jc.PauseSchedule(jobUUID)
+		}
 		return jc.PauseJob(jobUUID)
 	case ResumeJob:
+		if jc.isDMLJobSchedule(jobUUID) {
+			return jc.ResumeSchedule(jobUUID)
+		}
 		return jc.ResumeJob(jobUUID)
 	case LaunchJob:
 		return jc.LaunchJob(jobUUID)
 	case CancelJob:
+		if jc.isDMLJobSchedule(jobUUID) {
+			return jc.CancelSchedule(jobUUID)
+		}
 		return jc.CancelJob(jobUUID)
 	case ThrottleJob:
 		return jc.ThrottleJob(jobUUID, throttleDuration, throttleRatio)
@@ -215,6 +227,9 @@ func (jc *JobController) ShowJob(uuid string, showDetails bool) (*sqltypes.Resul
 	if uuid == "*" {
 		return jc.ShowAllDMLJobs()
 	}
+	if uuid == sqlparser.ShowDMLJobSchedules || jc.isDMLJobSchedule(uuid) {
+		return jc.ShowDMLJobSchedules(uuid)
+	}
 	return jc.ShowSingleDMLJob(uuid, showDetails)
 }
 
@@ -415,6 +430,9 @@ func (jc *JobController) jobManager() {
 		case <-jc.managerNotifyChan:
 		}
 
+		// submitting the jobs of the schedules acquires jc.tableMutex, so do it before locking
+		jc.runDueSchedules(jc.ctx)
+
 		jc.workingTablesMutex.Lock()
 		jc.tableMutex.Lock()
 
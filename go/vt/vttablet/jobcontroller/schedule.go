@@ -0,0 +1,335 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package jobcontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"vitess.io/vitess/go/cron"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/schema"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// A DML job schedule submits a DML job every time its cron expression matches,
+// e.g. to delete the expired rows of a table every night:
+//
+//	delete /*vt+ dml_split=true dml_cron='0_3_*_*_*' dml_cron_time_zone='UTC+08:00:00' */ from logs where created < now() - interval 7 day
+//
+// The other directives of the DML, like the batch size, the fail policy, the throttle and the running time period,
+// apply to every job of the schedule. A run is skipped if the job of the last run is not finished yet,
+// and the runs missed while there is no primary are caught up once.
+//
+// The schedules are persisted in mysql.non_transactional_dml_job_schedules, so they survive failovers:
+// the job controller of the new primary runs them. The next_run_time and last_run_time of a schedule are in UTC.
+// SHOW DML_JOB SCHEDULES shows the schedules, and ALTER DML_JOB '<schedule_uuid>' PAUSE, RESUME or CANCEL
+// pauses, resumes or deletes a schedule.
+
+// possible status of DML job schedules
+const (
+	ScheduleActiveStatus = "active"
+	SchedulePausedStatus = "paused"
+)
+
+const scheduleTimeFormat = time.DateTime
+
+// getDMLJobCron returns the cron expression and its time zone of a submitted DML, if it runs on a schedule.
+func getDMLJobCron(sql string) (cronExpr, cronTimeZone string) {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return "", ""
+	}
+	cronExpr, cronTimeZone = sqlparser.GetDMLJobCron(stmt)
+	return stripApostrophe(cronExpr), stripApostrophe(cronTimeZone)
+}
+
+// getCronLocation returns the location of a time zone like 'UTC+08:00:00', or of the system time zone if it's empty.
+func getCronLocation(cronTimeZone string) (timeZone string, location *time.Location, err error) {
+	if cronTimeZone == "" {
+		_, timeZoneOffset := time.Now().Zone()
+		cronTimeZone = getTimeZoneStr(timeZoneOffset)
+	}
+	timeZoneOffset, err := getTimeZoneOffset(cronTimeZone)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid cron time zone %s, it should be like 'UTC[\\+\\-]\\d{2}:\\d{2}:\\d{2}'", cronTimeZone)
+	}
+	return cronTimeZone, time.FixedZone(cronTimeZone, timeZoneOffset), nil
+}
+
+// nextRunTime returns the next time after now a schedule runs, in UTC.
+func nextRunTime(cronExpr, cronTimeZone string, now time.Time) (string, error) {
+	schedule, err := cron.Parse(cronExpr)
+	if err != nil {
+		return "", err
+	}
+	_, location, err := getCronLocation(cronTimeZone)
+	if err != nil {
+		return "", err
+	}
+	next := schedule.Next(now.In(location))
+	if next.IsZero() {
+		return "", fmt.Errorf("cron expression %s matches no time in the next %d years", cronExpr, cron.SearchYears)
+	}
+	return next.UTC().Format(scheduleTimeFormat), nil
+}
+
+func (jc *JobController) SubmitSchedule(sql, cronExpr, cronTimeZone, tableSchema, runningTimePeriodStart, runningTimePeriodEnd, runningTimePeriodTimeZone string, batchIntervalInMs, userBatchSize int64, postponeLaunch bool, failPolicy, throttleDuration, throttleRatio string) (*sqltypes.Result, error) {
+	if postponeLaunch {
+		return &sqltypes.Result{}, errors.New("the jobs of a schedule can't postpone launch")
+	}
+	cronTimeZone, _, err := getCronLocation(cronTimeZone)
+	if err != nil {
+		return &sqltypes.Result{}, err
+	}
+	nextRunTimeStr, err := nextRunTime(cronExpr, cronTimeZone, time.Now())
+	if err != nil {
+		return &sqltypes.Result{}, err
+	}
+
+	// Check the parameters of the jobs now rather than at their first run.
+	sql = sqlparser.StripComments(sql)
+	tableName, _, _, err := parseDML(sql)
+	if err != nil {
+		return &sqltypes.Result{}, err
+	}
+	if failPolicy == "" {
+		failPolicy = defaultFailPolicy
+	} else if failPolicy != failPolicyAbort && failPolicy != failPolicySkip && failPolicy != failPolicyPause {
+		return &sqltypes.Result{}, errors.New("failPolicy must be one of 'abort', 'skip' or 'pause'")
+	}
+	if !isTimePeriodValid(stripApostrophe(runningTimePeriodStart), stripApostrophe(runningTimePeriodEnd), stripApostrophe(runningTimePeriodTimeZone)) {
+		return &sqltypes.Result{}, errors.New("check the format, the start and end should be like 'hh:mm:ss' and time zone should be like 'UTC[\\+\\-]\\d{2}:\\d{2}:\\d{2}'")
+	}
+	if throttleDuration != "" || throttleRatio != "" {
+		duration, ratio := setDefaultValForThrottleParam(throttleDuration, throttleRatio)
+		if _, _, err := jc.validateThrottleParams(duration, sqlparser.NewDecimalLiteral(ratio)); err != nil {
+			return &sqltypes.Result{}, err
+		}
+	}
+
+	scheduleUUID, err := schema.CreateUUIDWithDelimiter("-")
+	if err != nil {
+		return &sqltypes.Result{}, err
+	}
+	submitQuery, err := sqlparser.ParseAndBind(sqlDMLJobScheduleSubmit,
+		sqltypes.StringBindVariable(scheduleUUID),
+		sqltypes.StringBindVariable(cronExpr),
+		sqltypes.StringBindVariable(cronTimeZone),
+		sqltypes.StringBindVariable(ScheduleActiveStatus),
+		sqltypes.StringBindVariable(sql),
+		sqltypes.StringBindVariable(tableSchema),
+		sqltypes.StringBindVariable(tableName),
+		sqltypes.Int64BindVariable(batchIntervalInMs),
+		sqltypes.Int64BindVariable(userBatchSize),
+		sqltypes.StringBindVariable(failPolicy),
+		sqltypes.StringBindVariable(throttleDuration),
+		sqltypes.StringBindVariable(throttleRatio),
+		sqltypes.StringBindVariable(runningTimePeriodStart),
+		sqltypes.StringBindVariable(runningTimePeriodEnd),
+		sqltypes.StringBindVariable(runningTimePeriodTimeZone),
+		sqltypes.StringBindVariable(nextRunTimeStr))
+	if err != nil {
+		return &sqltypes.Result{}, err
+	}
+	if _, err = jc.execQuery(jc.ctx, "", submitQuery); err != nil {
+		return &sqltypes.Result{}, err
+	}
+
+	return &sqltypes.Result{
+		Fields:       buildVarCharFields("schedule_uuid", "cron_expression", "cron_time_zone", "next_run_time", "fail_policy"),
+		Rows:         []sqltypes.Row{buildVarCharRow(scheduleUUID, cronExpr, cronTimeZone, nextRunTimeStr, failPolicy)},
+		RowsAffected: 1,
+	}, nil
+}
+
+// getDMLJobSchedule returns the schedule of the uuid, or nil if the uuid is not a schedule.
+func (jc *JobController) getDMLJobSchedule(ctx context.Context, uuid string) (sqltypes.RowNamedValues, error) {
+	query, err := sqlparser.ParseAndBind(sqlDMLJobScheduleGetInfo, sqltypes.StringBindVariable(uuid))
+	if err != nil {
+		return nil, err
+	}
+	qr, err := jc.execQuery(ctx, "", query)
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Named().Rows) != 1 {
+		return nil, nil
+	}
+	return qr.Named().Rows[0], nil
+}
+
+// isDMLJobSchedule checks whether the uuid of an ALTER DML_JOB is a schedule rather than a job.
+func (jc *JobController) isDMLJobSchedule(uuid string) bool {
+	row, err := jc.getDMLJobSchedule(jc.ctx, uuid)
+	return err == nil && row != nil
+}
+
+func (jc *JobController) updateScheduleStatus(ctx context.Context, uuid, status, nextRunTime string) (*sqltypes.Result, error) {
+	query, err := sqlparser.ParseAndBind(sqlDMLJobScheduleUpdateStatus,
+		sqltypes.StringBindVariable(status),
+		sqltypes.StringBindVariable(nextRunTime),
+		sqltypes.StringBindVariable(uuid))
+	if err != nil {
+		return &sqltypes.Result{}, err
+	}
+	return jc.execQuery(ctx, "", query)
+}
+
+func (jc *JobController) updateScheduleMessage(ctx context.Context, uuid, message string) error {
+	query, err := sqlparser.ParseAndBind(sqlDMLJobScheduleUpdateMessage,
+		sqltypes.StringBindVariable(message),
+		sqltypes.StringBindVariable(uuid))
+	if err != nil {
+		return err
+	}
+	_, err = jc.execQuery(ctx, "", query)
+	return err
+}
+
+// PauseSchedule stops submitting the jobs of a schedule. The jobs already submitted are not paused.
+func (jc *JobController) PauseSchedule(uuid string) (*sqltypes.Result, error) {
+	var emptyResult = &sqltypes.Result{}
+	row, err := jc.getDMLJobSchedule(jc.ctx, uuid)
+	if err != nil || row == nil {
+		return emptyResult, err
+	}
+	if row.AsString("status", "") != ScheduleActiveStatus {
+		emptyResult.Info = " The schedule status is not active and can't be paused"
+		return emptyResult, nil
+	}
+	return jc.updateScheduleStatus(jc.ctx, uuid, SchedulePausedStatus, row.AsString("next_run_time", ""))
+}
+
+// ResumeSchedule resumes a paused schedule from now on, so the runs missed while it was paused are skipped.
+func (jc *JobController) ResumeSchedule(uuid string) (*sqltypes.Result, error) {
+	var emptyResult = &sqltypes.Result{}
+	row, err := jc.getDMLJobSchedule(jc.ctx, uuid)
+	if err != nil || row == nil {
+		return emptyResult, err
+	}
+	if row.AsString("status", "") != SchedulePausedStatus {
+		emptyResult.Info = " The schedule status is not paused and don't need resume"
+		return emptyResult, nil
+	}
+	nextRunTimeStr, err := nextRunTime(row.AsString("cron_expression", ""), row.AsString("cron_time_zone", ""), time.Now())
+	if err != nil {
+		return emptyResult, err
+	}
+	return jc.updateScheduleStatus(jc.ctx, uuid, ScheduleActiveStatus, nextRunTimeStr)
+}
+
+// CancelSchedule deletes a schedule. The jobs already submitted are not canceled.
+func (jc *JobController) CancelSchedule(uuid string) (*sqltypes.Result, error) {
+	query, err := sqlparser.ParseAndBind(sqlDMLJobScheduleDelete, sqltypes.StringBindVariable(uuid))
+	if err != nil {
+		return &sqltypes.Result{}, err
+	}
+	return jc.execQuery(jc.ctx, "", query)
+}
+
+// ShowDMLJobSchedules shows all schedules, or the schedule of the uuid, with the status of their last jobs.
+func (jc *JobController) ShowDMLJobSchedules(uuid string) (*sqltypes.Result, error) {
+	query := sqlDMLJobScheduleGetAll
+	if uuid != sqlparser.ShowDMLJobSchedules {
+		var err error
+		query, err = sqlparser.ParseAndBind(sqlDMLJobScheduleGetInfo, sqltypes.StringBindVariable(uuid))
+		if err != nil {
+			return &sqltypes.Result{}, err
+		}
+	}
+	qr, err := jc.execQuery(jc.ctx, "", query)
+	if err != nil {
+		return &sqltypes.Result{}, err
+	}
+	for i, row := range qr.Named().Rows {
+		lastJobStatus := ""
+		if lastJobUUID := row.AsString("last_job_uuid", ""); lastJobUUID != "" {
+			// the job may be deleted by table GC
+			lastJobStatus, _ = jc.getStrJobInfo(jc.ctx, lastJobUUID, "status")
+		}
+		qr.Rows[i] = append(qr.Rows[i], sqltypes.NewVarChar(lastJobStatus))
+	}
+	qr.Fields = append(qr.Fields, buildVarCharFields("last_job_status")...)
+	return qr, nil
+}
+
+// runDueSchedules submits the jobs of the active schedules whose next run time has come.
+// The caller should not hold jc.tableMutex, since submitting a job acquires it.
+func (jc *JobController) runDueSchedules(ctx context.Context) {
+	now := time.Now()
+	query, err := sqlparser.ParseAndBind(sqlDMLJobScheduleGetDue, sqltypes.StringBindVariable(now.UTC().Format(scheduleTimeFormat)))
+	if err != nil {
+		return
+	}
+	qr, err := jc.execQuery(ctx, "", query)
+	if err != nil {
+		log.Errorf("JobController: failed to get the due DML job schedules: %v", err)
+		return
+	}
+	for _, row := range qr.Named().Rows {
+		if err := jc.runSchedule(ctx, row, now); err != nil {
+			log.Errorf("JobController: failed to run DML job schedule %s: %v", row.AsString("schedule_uuid", ""), err)
+		}
+	}
+}
+
+func (jc *JobController) runSchedule(ctx context.Context, row sqltypes.RowNamedValues, now time.Time) error {
+	uuid := row.AsString("schedule_uuid", "")
+	runTime := row.AsString("next_run_time", "")
+
+	// claim the run, computing the next run from now so the missed runs are caught up once
+	nextRunTimeStr, err := nextRunTime(row.AsString("cron_expression", ""), row.AsString("cron_time_zone", ""), now)
+	if err != nil {
+		_, _ = jc.updateScheduleStatus(ctx, uuid, SchedulePausedStatus, runTime)
+		return jc.updateScheduleMessage(ctx, uuid, err.Error())
+	}
+	query, err := sqlparser.ParseAndBind(sqlDMLJobScheduleClaimRun,
+		sqltypes.StringBindVariable(nextRunTimeStr),
+		sqltypes.StringBindVariable(now.UTC().Format(scheduleTimeFormat)),
+		sqltypes.StringBindVariable(uuid),
+		sqltypes.StringBindVariable(runTime))
+	if err != nil {
+		return err
+	}
+	qr, err := jc.execQuery(ctx, "", query)
+	if err != nil {
+		return err
+	}
+	if qr.RowsAffected != 1 {
+		// the schedule is paused, canceled or run by someone else
+		return nil
+	}
+
+	// the runs of a schedule don't overlap
+	if lastJobUUID := row.AsString("last_job_uuid", ""); lastJobUUID != "" {
+		if status, err := jc.getStrJobInfo(ctx, lastJobUUID, "status"); err == nil &&
+			status != CompletedStatus && status != FailedStatus && status != CanceledStatus {
+			return jc.updateScheduleMessage(ctx, uuid, fmt.Sprintf("skipped the run at %s: the last job %s is %s", runTime, lastJobUUID, status))
+		}
+	}
+
+	batchInterval, _ := row.ToInt64("batch_interval_in_ms")
+	batchSize, _ := row.ToInt64("batch_size")
+	submitRst, err := jc.SubmitJob(row.AsString("dml_sql", ""), row.AsString("table_schema", ""),
+		row.AsString("running_time_period_start", ""), row.AsString("running_time_period_end", ""), row.AsString("running_time_period_time_zone", ""),
+		batchInterval, batchSize, false, row.AsString("fail_policy", ""), row.AsString("throttle_duration", ""), row.AsString("throttle_ratio", ""))
+	if err != nil {
+		return jc.updateScheduleMessage(ctx, uuid, fmt.Sprintf("failed to submit the job of the run at %s: %v", runTime, err))
+	}
+	jobUUID := submitRst.Named().Rows[0].AsString("job_uuid", "")
+	query, err = sqlparser.ParseAndBind(sqlDMLJobScheduleUpdateLastJob,
+		sqltypes.StringBindVariable(jobUUID),
+		sqltypes.StringBindVariable(uuid))
+	if err != nil {
+		return err
+	}
+	_, err = jc.execQuery(ctx, "", query)
+	return err
+}
@@ -0,0 +1,39 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package jobcontroller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextRunTime(t *testing.T) {
+	now := time.Date(2024, 1, 10, 20, 30, 0, 0, time.UTC)
+	next, err := nextRunTime("0_3_*_*_*", "UTC+08:00:00", now)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-11 19:00:00", next)
+
+	next, err = nextRunTime("0_3_*_*_*", "UTC", now)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-11 03:00:00", next)
+
+	_, err = nextRunTime("0_3_*_*_*", "Asia/Shanghai", now)
+	assert.Error(t, err)
+	_, err = nextRunTime("0 0 30 2 *", "UTC", now)
+	assert.EqualError(t, err, "cron expression 0 0 30 2 * matches no time in the next 5 years")
+}
+
+func TestGetDMLJobCron(t *testing.T) {
+	cronExpr, cronTimeZone := getDMLJobCron("delete /*vt+ dml_split=true dml_cron='0_3_*_*_*' dml_cron_time_zone='UTC+08:00:00' */ from t where c < 10")
+	assert.Equal(t, "0_3_*_*_*", cronExpr)
+	assert.Equal(t, "UTC+08:00:00", cronTimeZone)
+
+	cronExpr, _ = getDMLJobCron("delete /*vt+ dml_split=true */ from t where c < 10")
+	assert.Equal(t, "", cronExpr)
+}
@@ -122,8 +122,66 @@ const (
 
 	sqlTemplateGenAffectedRows = `SELECT SUM(actually_affected_rows) AS affected_rows FROM %s WHERE batch_status='completed';`
 
+	sqlTemplateGenBatchProgress = `SELECT COUNT(*) AS total_batches, COALESCE(SUM(batch_status IN ('completed','skip')), 0) AS finished_batches FROM %s`
+
 	sqlTemplateShowBatchTable = `SELECT * FROM %s order by CAST(SUBSTRING_INDEX(batch_id, '-', 1) AS SIGNED),id`
 
+	sqlDMLJobScheduleSubmit = `insert into mysql.non_transactional_dml_job_schedules (
+                                      schedule_uuid,
+                                      cron_expression,
+                                      cron_time_zone,
+                                      status,
+                                      dml_sql,
+                                      table_schema,
+                                      table_name,
+                                      batch_interval_in_ms,
+                                      batch_size,
+                                      fail_policy,
+                                      throttle_duration,
+                                      throttle_ratio,
+                                      running_time_period_start,
+                                      running_time_period_end,
+                                      running_time_period_time_zone,
+                                      next_run_time) values(%a,%a,%a,%a,%a,%a,%a,%a,%a,%a,%a,%a,%a,%a,%a,%a)`
+
+	sqlDMLJobScheduleGetAll = `select * from mysql.non_transactional_dml_job_schedules order by id`
+
+	sqlDMLJobScheduleGetInfo = `select * from mysql.non_transactional_dml_job_schedules 
+                                where
+                                	schedule_uuid = %a`
+
+	sqlDMLJobScheduleGetDue = `select * from mysql.non_transactional_dml_job_schedules 
+                                where
+                                	status = 'active' and next_run_time <= %a
+                                order by id`
+
+	sqlDMLJobScheduleUpdateStatus = `update mysql.non_transactional_dml_job_schedules set 
+                                    status = %a,
+                                    next_run_time = %a
+                                where 
+                                    schedule_uuid = %a`
+
+	// The run is claimed only if no one else has claimed it, so a run is not submitted twice.
+	sqlDMLJobScheduleClaimRun = `update mysql.non_transactional_dml_job_schedules set 
+                                    next_run_time = %a,
+                                    last_run_time = %a
+                                where 
+                                    schedule_uuid = %a and next_run_time = %a`
+
+	sqlDMLJobScheduleUpdateLastJob = `update mysql.non_transactional_dml_job_schedules set 
+                                    last_job_uuid = %a,
+                                    run_count = run_count + 1,
+                                    message = NULL
+                                where 
+                                    schedule_uuid = %a`
+
+	sqlDMLJobScheduleUpdateMessage = `update mysql.non_transactional_dml_job_schedules set 
+                                    message = %a 
+                                where 
+                                    schedule_uuid = %a`
+
+	sqlDMLJobScheduleDelete = `delete from mysql.non_transactional_dml_job_schedules where schedule_uuid = %a`
+
 	sqlGetJobTableColNames = `
 		SELECT COLUMN_NAME 
 		FROM INFORMATION_SCHEMA.COLUMNS 
@@ -128,9 +128,7 @@ func (jc *JobController) validateThrottleParams(expireString string, ratioLitera
 }
 
 func setDefaultValForThrottleParam(throttleDuration, throttleRatio string) (string, string) {
-	if throttleDuration[0] == '\'' && throttleDuration[len(throttleDuration)-1] == '\'' {
-		throttleDuration = throttleDuration[1 : len(throttleDuration)-1]
-	}
+	throttleDuration = stripApostrophe(throttleDuration)
 	if throttleRatio == "" {
 		throttleRatio = "1"
 	}
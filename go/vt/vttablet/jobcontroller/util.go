@@ -661,31 +661,10 @@ func (jc *JobController) ShowAllDMLJobs() (*sqltypes.Result, error) {
 		if err != nil {
 			return &sqltypes.Result{}, err
 		}
-		batchTableName := genBatchTableName(uuid)
-
-		// add affected_rows value to current row
-		affectedRows, err := jc.genJobAffectedRows(batchInfoTableSchema, batchTableName, uuid)
-		if err != nil {
-			// perhaps the error is just because there is no any rows or no batches in batch table
-			qr.Rows[i] = append(qr.Rows[i], sqltypes.NewInt64(0))
-			log.Infof(err.Error())
-		} else {
-			qr.Rows[i] = append(qr.Rows[i], sqltypes.NewInt64(affectedRows))
-		}
-
-		// add dealing_batch_id value to current row
-		dealingBatchID, err := jc.getBatchIDToExec(jc.ctx, batchInfoTableSchema, batchTableName)
-		if err != nil {
-			// perhaps the error is just because there is no any rows in batch table
-			qr.Rows[i] = append(qr.Rows[i], sqltypes.NewVarChar(""))
-			log.Infof(err.Error())
-		} else {
-			qr.Rows[i] = append(qr.Rows[i], sqltypes.NewVarChar(dealingBatchID))
-		}
-
+		qr.Rows[i] = jc.appendJobProgress(qr.Rows[i], batchInfoTableSchema, genBatchTableName(uuid), uuid)
 	}
 
-	qr.Fields = append(qr.Fields, buildVarCharFields("affected_rows", "dealing_batch_id")...)
+	qr.Fields = append(qr.Fields, jobProgressFields()...)
 	return qr, nil
 }
 
@@ -713,26 +692,78 @@ func (jc *JobController) ShowSingleDMLJob(uuid string, showDetails bool) (qr *sq
 		return &sqltypes.Result{}, fmt.Errorf("the len of query result of select dml job is not 1 but %d", len(qr.Rows))
 	}
 
+	qr.Rows[0] = jc.appendJobProgress(qr.Rows[0], batchInfoTableSchema, batchTableName, uuid)
+	qr.Fields = append(qr.Fields, jobProgressFields()...)
+	return qr, nil
+
+}
+
+func jobProgressFields() []*querypb.Field {
+	return buildVarCharFields("affected_rows", "dealing_batch_id", "total_batches", "finished_batches", "progress")
+}
+
+// appendJobProgress adds the progress of a job to its row in the job table:
+// the rows affected by the completed batches, the batch to execute now,
+// and how many batches are finished, i.e. completed or skipped, among all batches.
+func (jc *JobController) appendJobProgress(row sqltypes.Row, batchInfoTableSchema, batchTableName, uuid string) sqltypes.Row {
 	// add affected rows
 	affectedRows, err := jc.genJobAffectedRows(batchInfoTableSchema, batchTableName, uuid)
 	if err != nil {
 		// perhaps the error is just because there is no any rows or no batches in batch table
-		qr.Rows[0] = append(qr.Rows[0], sqltypes.NewInt64(0))
+		row = append(row, sqltypes.NewInt64(0))
 		log.Infof(err.Error())
 	} else {
-		qr.Rows[0] = append(qr.Rows[0], sqltypes.NewInt64(affectedRows))
+		row = append(row, sqltypes.NewInt64(affectedRows))
 	}
 	// add dealing batch id
 	dealingBatchID, err := jc.getBatchIDToExec(jc.ctx, batchInfoTableSchema, batchTableName)
 	if err != nil {
 		// perhaps the error is just because there is no any rows in batch table
-		qr.Rows[0] = append(qr.Rows[0], sqltypes.NewVarChar(""))
+		row = append(row, sqltypes.NewVarChar(""))
 		log.Infof(err.Error())
 	} else {
-		qr.Rows[0] = append(qr.Rows[0], sqltypes.NewVarChar(dealingBatchID))
+		row = append(row, sqltypes.NewVarChar(dealingBatchID))
+	}
+	// add batch progress
+	totalBatches, finishedBatches, err := jc.genJobBatchProgress(batchInfoTableSchema, batchTableName, uuid)
+	if err != nil {
+		// perhaps the error is just because the batch table is not created yet or dropped by table GC
+		log.Infof(err.Error())
 	}
+	return append(row, sqltypes.NewInt64(totalBatches), sqltypes.NewInt64(finishedBatches), sqltypes.NewVarChar(formatJobProgress(totalBatches, finishedBatches)))
+}
 
-	qr.Fields = append(qr.Fields, buildVarCharFields("affected_rows", "dealing_batch_id")...)
-	return qr, nil
+func (jc *JobController) genJobBatchProgress(batchInfoTableSchema, batchTableName, uuid string) (totalBatches, finishedBatches int64, err error) {
+	jobStatus, err := jc.getStrJobInfo(jc.ctx, uuid, "status")
+	if err != nil {
+		return 0, 0, err
+	}
+	// if job is in "submitted" status, the batch table is not created yet
+	if jobStatus == SubmittedStatus {
+		return 0, 0, nil
+	}
 
+	qr, err := jc.execQuery(jc.ctx, batchInfoTableSchema, fmt.Sprintf(sqlTemplateGenBatchProgress, batchTableName))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(qr.Rows) != 1 {
+		return 0, 0, fmt.Errorf("the len of query result of sqlTemplateGenBatchProgress is not 1 but %d", len(qr.Rows))
+	}
+	row := qr.Named().Rows[0]
+	if totalBatches, err = row.ToInt64("total_batches"); err != nil {
+		return 0, 0, err
+	}
+	// the sum is a decimal
+	finished, err := row["finished_batches"].ToFloat64()
+	return totalBatches, int64(finished), err
+}
+
+// formatJobProgress formats the percentage of the finished batches, e.g. 42.50%.
+// Since a batch may be split into two when it affects too many rows, the total grows as the job runs.
+func formatJobProgress(totalBatches, finishedBatches int64) string {
+	if totalBatches == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f%%", float64(finishedBatches)*100/float64(totalBatches))
 }
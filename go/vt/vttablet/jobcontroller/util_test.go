@@ -243,3 +243,10 @@ func TestGetTimeZoneOffset(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatJobProgress(t *testing.T) {
+	assert.Equal(t, "", formatJobProgress(0, 0))
+	assert.Equal(t, "0.00%", formatJobProgress(3, 0))
+	assert.Equal(t, "42.50%", formatJobProgress(200, 85))
+	assert.Equal(t, "100.00%", formatJobProgress(7, 7))
+}
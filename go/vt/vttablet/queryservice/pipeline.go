@@ -0,0 +1,117 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package queryservice
+
+import (
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// A pipelined Execute runs several statements of a transaction in a single
+// round trip. The statements are sent in the PipelinedStatements bind
+// variable, and the tablet executes them in order until one of them fails.
+// The reply is a result with one row per executed statement, see
+// EncodePipelinedResults. Only statements that return no rows, such as DMLs,
+// can be pipelined.
+
+// PipelinedStatements is the bind variable that carries the statements of a
+// pipelined Execute. '#' cannot be used in bind variables of queries, so it
+// cannot collide with a bind variable of the user, and vtgate removes it from
+// the bind variables its clients send.
+const PipelinedStatements = "#pipelinedStatements"
+
+var pipelinedResultFields = []*querypb.Field{
+	{Name: "rows_affected", Type: sqltypes.Uint64},
+	{Name: "insert_id", Type: sqltypes.Uint64},
+	{Name: "info", Type: sqltypes.VarChar},
+	{Name: "error_code", Type: sqltypes.Int64},
+	{Name: "error", Type: sqltypes.VarChar},
+}
+
+// PipelinedBindVars returns the bind variables of a pipelined Execute of statements.
+func PipelinedBindVars(statements []string) map[string]*querypb.BindVariable {
+	bv := &querypb.BindVariable{Type: querypb.Type_TUPLE, Values: make([]*querypb.Value, 0, len(statements))}
+	for _, statement := range statements {
+		bv.Values = append(bv.Values, &querypb.Value{Type: querypb.Type_VARBINARY, Value: []byte(statement)})
+	}
+	return map[string]*querypb.BindVariable{PipelinedStatements: bv}
+}
+
+// GetPipelinedStatements returns the statements of a pipelined Execute, or
+// false if bindVars are not the ones of a pipelined Execute.
+func GetPipelinedStatements(bindVars map[string]*querypb.BindVariable) ([]string, bool) {
+	bv, ok := bindVars[PipelinedStatements]
+	if !ok || bv.Type != querypb.Type_TUPLE {
+		return nil, false
+	}
+	statements := make([]string, 0, len(bv.Values))
+	for _, v := range bv.Values {
+		statements = append(statements, string(v.Value))
+	}
+	return statements, true
+}
+
+// EncodePipelinedResults returns the reply of a pipelined Execute: results
+// are the results of the statements that succeeded, and err is the error of
+// the statement that failed, if any.
+func EncodePipelinedResults(results []*sqltypes.Result, err error) *sqltypes.Result {
+	qr := &sqltypes.Result{Fields: pipelinedResultFields}
+	for _, result := range results {
+		qr.Rows = append(qr.Rows, []sqltypes.Value{
+			sqltypes.NewUint64(result.RowsAffected),
+			sqltypes.NewUint64(result.InsertID),
+			sqltypes.NewVarChar(result.Info),
+			sqltypes.NULL,
+			sqltypes.NULL,
+		})
+	}
+	if err != nil {
+		qr.Rows = append(qr.Rows, []sqltypes.Value{
+			sqltypes.NULL,
+			sqltypes.NULL,
+			sqltypes.NULL,
+			sqltypes.NewInt64(int64(vterrors.Code(err))),
+			sqltypes.NewVarChar(err.Error()),
+		})
+	}
+	return qr
+}
+
+// DecodePipelinedResults decodes the reply of a pipelined Execute. It returns
+// the results of the statements that succeeded, and the error of the
+// statement that failed, if any.
+func DecodePipelinedResults(qr *sqltypes.Result) ([]*sqltypes.Result, error) {
+	if len(qr.Fields) != len(pipelinedResultFields) {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "[BUG] unexpected pipelined result with %d fields", len(qr.Fields))
+	}
+	results := make([]*sqltypes.Result, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		if !row[3].IsNull() {
+			code, err := row[3].ToInt64()
+			if err != nil {
+				return results, vterrors.Wrap(err, "decoding pipelined result")
+			}
+			return results, vterrors.New(vtrpcpb.Code(code), row[4].ToString())
+		}
+		rowsAffected, err := row[0].ToUint64()
+		if err != nil {
+			return results, vterrors.Wrap(err, "decoding pipelined result")
+		}
+		insertID, err := row[1].ToUint64()
+		if err != nil {
+			return results, vterrors.Wrap(err, "decoding pipelined result")
+		}
+		results = append(results, &sqltypes.Result{
+			RowsAffected: rowsAffected,
+			InsertID:     insertID,
+			Info:         row[2].ToString(),
+		})
+	}
+	return results, nil
+}
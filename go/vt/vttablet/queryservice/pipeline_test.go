@@ -0,0 +1,48 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package queryservice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func TestPipelinedStatements(t *testing.T) {
+	statements := []string{"insert into t values (1)", "update t set a = 1"}
+	got, ok := GetPipelinedStatements(PipelinedBindVars(statements))
+	require.True(t, ok)
+	assert.Equal(t, statements, got)
+
+	_, ok = GetPipelinedStatements(map[string]*querypb.BindVariable{"a": sqltypes.Int64BindVariable(1)})
+	assert.False(t, ok)
+}
+
+func TestPipelinedResults(t *testing.T) {
+	results := []*sqltypes.Result{
+		{RowsAffected: 1, InsertID: 10},
+		{RowsAffected: 2, Info: "Rows matched: 2  Changed: 2  Warnings: 0"},
+	}
+	got, err := DecodePipelinedResults(EncodePipelinedResults(results, nil))
+	require.NoError(t, err)
+	assert.Equal(t, results, got)
+
+	failure := vterrors.New(vtrpcpb.Code_ALREADY_EXISTS, "Duplicate entry '1' for key 'PRIMARY' (errno 1062) (sqlstate 23000)")
+	got, err = DecodePipelinedResults(EncodePipelinedResults(results[:1], failure))
+	assert.Equal(t, results[:1], got)
+	assert.Equal(t, vtrpcpb.Code_ALREADY_EXISTS, vterrors.Code(err))
+	assert.EqualError(t, err, failure.Error())
+
+	_, err = DecodePipelinedResults(&sqltypes.Result{})
+	assert.ErrorContains(t, err, "unexpected pipelined result")
+}
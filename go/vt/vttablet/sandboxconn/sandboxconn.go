@@ -105,6 +105,9 @@ type SandboxConn struct {
 	// ReadTransactionResults is used for returning results for ReadTransaction.
 	ReadTransactionResults []*querypb.TransactionMetadata
 
+	// CommonQueryResults are the results of CommonQuery, by function name.
+	CommonQueryResults map[string]*sqltypes.Result
+
 	MessageIDs []*querypb.Value
 
 	// vstream expectations.
@@ -634,7 +637,7 @@ func (sbc *SandboxConn) ShowDMLJob(ctx context.Context, uuid string, showDetails
 }
 
 func (sbc *SandboxConn) CommonQuery(ctx context.Context, queryFunctionName string, queryFunctionArgs map[string]any) (*sqltypes.Result, error) {
-	return nil, nil
+	return sbc.CommonQueryResults[queryFunctionName], nil
 }
 
 // Close does not change ExecCount
@@ -6,12 +6,49 @@ Licensed under the Apache v2(found in the LICENSE file in the root directory).
 package tabletserver
 
 import (
+	"errors"
+
 	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
 )
 
+// The actions of the rules a query matches run as a pipeline:
+//
+//   - They are ordered by the priority of their rule, the smaller first, and
+//     by the name of their rule for the same priority.
+//   - Their BeforeExecution run in that order, until one returns a result,
+//     which answers the query, or an error, which fails it: the actions after
+//     it don't run. An action may also return ErrSkipRemainingActions to let
+//     the query run without the actions after it, like STOP.
+//   - The AfterExecution of the actions whose BeforeExecution ran, the one
+//     which stopped the pipeline included, run in the reverse order, each on
+//     the reply and the error returned by the previous one, which it may
+//     replace or transform, see ResultTransform.
+//   - Last, the ResultRewriters of the actions not skipped rewrite the reply,
+//     in the order of the pipeline, even the ones after an action which
+//     answered the query.
+//
+// The streamed queries only run the ResultRewriters, up to the first STOP
+// action.
+//
+// The actions of the DRY_RUN rules take their place in the pipeline, but only
+// record what they would do to the queries, see DryRunner.
+//
+// The actions of the rules with post execution conditions run once the query
+// ran, in their AfterExecution, and only if its outcome matches them, see
+// rules.OutcomeConds.
+//
+// The rules with access conditions only match the queries which MySQL
+// accesses like they tell, by the EXPLAIN of the plan of the query, see
+// rules.AccessConds.
+
+// DefaultPriority is the priority of the rules which don't set one.
 const DefaultPriority = 1000
 
+// ErrSkipRemainingActions is returned by the BeforeExecution of an action to
+// skip the actions after it in the pipeline. It doesn't fail the query.
+var ErrSkipRemainingActions = errors.New("skip the remaining actions")
+
 type ActionInterface interface {
 	BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error)
 
@@ -22,6 +59,36 @@ type ActionInterface interface {
 	GetRule() *rules.Rule
 }
 
+// ResultRewriter is implemented by the actions which rewrite the results of
+// the queries, like DATA_MASKING. It applies to the final result of a query,
+// whichever action answered it, and to each result of a streamed query: the
+// first one carries the fields, the next ones only rows. The results may be
+// shared, so they must be copied, not modified, like ResultTransform does.
+type ResultRewriter interface {
+	RewriteResult(qre *QueryExecutor, result *sqltypes.Result) (*sqltypes.Result, error)
+}
+
+// ResultEnder is implemented by the ResultRewriters which are told when the
+// results of a query end, like PLUGIN. EndResult is called once, after the
+// last result it rewrote: with nil for Execute, and with the error of a
+// streamed query, even if it failed before its first result. It returns the
+// rows to append, if any, and the error of the query.
+type ResultEnder interface {
+	EndResult(qre *QueryExecutor, err error) (*sqltypes.Result, error)
+}
+
+// DryRunner is implemented by the actions which can tell what they would do to
+// a query of a DRY_RUN rule, like FAIL or CONCURRENCY_CONTROL, without doing
+// it. DryRun returns the effect the action would have, dryRunNone, dryRunFail
+// or dryRunQueue, with its reason. done, if not nil, is called once the query
+// is done. The actions which aren't DryRunners are recorded as always applying.
+type DryRunner interface {
+	DryRun(qre *QueryExecutor) (effect, reason string, done func())
+}
+
+// ActionExecutionResponse is the reply and the error of a query after the
+// AfterExecution of an action. The reply is the one the action was given, or
+// the one it replaced it with, like a ResultTransform of it.
 type ActionExecutionResponse struct {
 	Reply *sqltypes.Result
 	Err   error
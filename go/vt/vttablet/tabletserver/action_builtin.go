@@ -2,14 +2,42 @@ package tabletserver
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"golang.org/x/exp/slices"
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/mysql"
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/trace"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/callinfo"
+	"vitess.io/vitess/go/vt/logutil"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
 	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/sqlparser"
 	"vitess.io/vitess/go/vt/vterrors"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/ccl"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/connpool"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/throttle"
 )
 
 type ContinueAction struct {
@@ -38,15 +66,25 @@ func (p *ContinueAction) GetRule() *rules.Rule {
 	return p.Rule
 }
 
+// FailAction fails the queries of a rule. Its params can set the MySQL error
+// number and SQLSTATE the clients get, and the message, whose ${rule},
+// ${description} and ${digest} stand for the name and the description of the
+// rule and the digest of the query, like
+//
+//	{"errno": 1142, "sqlstate": "42000", "message": "blocked by firewall rule ${rule}"}
 type FailAction struct {
 	Rule *rules.Rule
 
 	// Action is the action to take if the rule matches
 	Action rules.Action
+
+	Errno    int    `json:"errno"`
+	SQLState string `json:"sqlstate"`
+	Message  string `json:"message"`
 }
 
 func (p *FailAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
-	return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "disallowed due to rule: %s", p.Rule.Description)
+	return nil, ruleError(vtrpcpb.Code_INVALID_ARGUMENT, p.Rule, qre, p.Errno, p.SQLState, p.Message)
 }
 
 func (p *FailAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
@@ -57,22 +95,105 @@ func (p *FailAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result,
 }
 
 func (p *FailAction) SetParams(stringParams string) error {
+	if stringParams == "" {
+		return nil
+	}
+	c := &FailAction{}
+	if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+		return err
+	}
+	if err := validateRuleError(stringParams, c.Errno, &c.SQLState); err != nil {
+		return err
+	}
+	p.Errno, p.SQLState, p.Message = c.Errno, c.SQLState, c.Message
+	return nil
+}
+
+// sqlStateRegexp matches the SQLSTATE values.
+var sqlStateRegexp = regexp.MustCompile(`^[0-9A-Z]{5}$`)
+
+// validateRuleError validates the MySQL error number and SQLSTATE of the
+// params of a rule which fails the queries. The SQLSTATE defaults to HY000
+// when the error number is set.
+func validateRuleError(stringParams string, errno int, sqlState *string) error {
+	if errno < 0 || errno > math.MaxUint16 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid errno %d", stringParams, errno)
+	}
+	if *sqlState != "" && errno == 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the sqlstate needs an errno", stringParams)
+	}
+	if *sqlState == "" && errno != 0 {
+		*sqlState = mysql.SSUnknownSQLState
+	}
+	if *sqlState != "" && !sqlStateRegexp.MatchString(*sqlState) {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid sqlstate %q", stringParams, *sqlState)
+	}
 	return nil
 }
 
+// ruleError returns the error a rule fails a query with: the message of the
+// rule, by default "disallowed due to rule: ${description}", with its
+// placeholders replaced. With an errno, the message carries the MySQL error
+// number and SQLSTATE in the format vtgate extracts them from, see
+// mysql.NewSQLErrorFromError, so that the clients get them.
+func ruleError(code vtrpcpb.Code, rule *rules.Rule, qre *QueryExecutor, errno int, sqlState, message string) error {
+	if message == "" {
+		message = "disallowed due to rule: ${description}"
+	}
+	digest := ""
+	if qre.plan != nil {
+		digest = qre.plan.QueryTemplateID
+	}
+	message = strings.NewReplacer("${rule}", rule.Name, "${description}", rule.Description, "${digest}", digest).Replace(message)
+	if errno == 0 {
+		return vterrors.Errorf(code, "%s", message)
+	}
+	return vterrors.Errorf(code, "%s (errno %d) (sqlstate %s)", message, errno, sqlState)
+}
+
 func (p *FailAction) GetRule() *rules.Rule {
 	return p.Rule
 }
 
+func (p *FailAction) DryRun(qre *QueryExecutor) (string, string, func()) {
+	_, err := p.BeforeExecution(qre)
+	return dryRunFail, err.Error(), nil
+}
+
+// FailRetryAction fails the queries of a rule with an error the clients can
+// retry. Its params can pick the code of the error, FAILED_PRECONDITION by
+// default, and suggest a delay to retry after, like
+//
+//	{"code": "RESOURCE_EXHAUSTED", "retry_after": "2s"}
+//
+// vtgate retries the FAILED_PRECONDITION and UNAVAILABLE errors on the other
+// tablets, so these codes are for "retry elsewhere", and the others, like
+// RESOURCE_EXHAUSTED, for "retry later". The delay is in the message of the
+// error, see vterrors.RetryAfter, and in the Retry-After header of the
+// responses of the query API of vtgate.
 type FailRetryAction struct {
 	Rule *rules.Rule
 
 	// Action is the action to take if the rule matches
 	Action rules.Action
+
+	Code       string `json:"code"`
+	RetryAfter string `json:"retry_after"`
+
+	code       vtrpcpb.Code
+	retryAfter time.Duration
 }
 
 func (p *FailRetryAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
-	return nil, vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "disallowed due to rule: %s", p.Rule.Description)
+	code := p.code
+	if code == vtrpcpb.Code_OK {
+		code = vtrpcpb.Code_FAILED_PRECONDITION
+	}
+	err := ruleError(code, p.Rule, qre, 0, "", "")
+	if p.retryAfter > 0 {
+		err = vterrors.Errorf(code, "%s%s", err.Error(), vterrors.RetryAfterSuffix(p.retryAfter))
+	}
+	return nil, err
 }
 
 func (p *FailRetryAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
@@ -83,6 +204,29 @@ func (p *FailRetryAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Res
 }
 
 func (p *FailRetryAction) SetParams(stringParams string) error {
+	if stringParams == "" {
+		return nil
+	}
+	c := &FailRetryAction{}
+	if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+		return err
+	}
+	code, retryAfter := vtrpcpb.Code_FAILED_PRECONDITION, time.Duration(0)
+	if c.Code != "" {
+		value, ok := vtrpcpb.Code_value[c.Code]
+		if !ok || vtrpcpb.Code(value) == vtrpcpb.Code_OK {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid code %q", stringParams, c.Code)
+		}
+		code = vtrpcpb.Code(value)
+	}
+	if c.RetryAfter != "" {
+		d, err := time.ParseDuration(c.RetryAfter)
+		if err != nil || d <= 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid retry_after %q", stringParams, c.RetryAfter)
+		}
+		retryAfter = d
+	}
+	p.Code, p.RetryAfter, p.code, p.retryAfter = c.Code, c.RetryAfter, code, retryAfter
 	return nil
 }
 
@@ -90,36 +234,250 @@ func (p *FailRetryAction) GetRule() *rules.Rule {
 	return p.Rule
 }
 
+func (p *FailRetryAction) DryRun(qre *QueryExecutor) (string, string, func()) {
+	_, err := p.BeforeExecution(qre)
+	return dryRunFail, err.Error(), nil
+}
+
+// The results of the queries of a CONCURRENCY_CONTROL rule, in the
+// ConcurrencyControlQueries stats.
+const (
+	// cclAdmitted queries got a slot right away.
+	cclAdmitted = "admitted"
+	// cclQueued queries got a slot after they waited for it.
+	cclQueued = "queued"
+	// cclRejected queries found their queue full.
+	cclRejected = "rejected"
+	// cclCancelled queries were done, like timed out, while they waited.
+	cclCancelled = "cancelled"
+	// cclWaitExceeded queries waited longer than the max_queue_wait_ms of
+	// their rule.
+	cclWaitExceeded = "wait_exceeded"
+)
+
+// The keys the queries of a CONCURRENCY_CONTROL rule can be grouped by.
+const (
+	cclGroupByUser     = "user"
+	cclGroupByClientIP = "client_ip"
+	cclGroupByBindVar  = "bind_var"
+)
+
+// The priority lanes of a CONCURRENCY_CONTROL rule, whose waiting queries are
+// admitted in this order. The queries are in the normal lane by default.
+var cclLanes = []string{"high", "normal", "low"}
+
+const cclNormalLane = 1
+
+// What the queries of a CONCURRENCY_CONTROL rule can be put in lanes by.
+const (
+	cclLaneByUser    = "user"
+	cclLaneByComment = "comment"
+)
+
+// cclLaneCommentRegexp finds the lane a query asks for in its comments, like
+// /* lane=high */.
+var cclLaneCommentRegexp = regexp.MustCompile(`\blane=(\w+)`)
+
+// ConcurrencyControlAction limits the concurrency of the queries of a
+// template, queueing the ones above MaxConcurrency and rejecting the ones
+// above MaxQueueSize. With GroupBy, the queries of each user, client IP or
+// value of the BindVar bind variable have their own queue, with the same
+// limits: a tenant can't take the slots of the others. With FairBy, the
+// waiting queries of each user or client IP are admitted in turn instead, in
+// the same queue. With LaneBy, the waiting queries are admitted by priority
+// lane, high then normal then low: Lanes maps the users, or the values of the
+// lane key of the query comments, to the lanes. With MaxQueueWaitMs, the
+// queries which wait for longer are rejected, whatever the timeout of the
+// query. With Pool, the queries of all the rules of the pool wait in the
+// queue of the pool, see concurrency_pool.go.
+//
+// In the adaptive mode, the concurrency starts at MaxConcurrency and adapts to
+// the p99 latency of the queries of the rule, or to the threads running in
+// MySQL, see adaptiveConcurrencyLimit.
 type ConcurrencyControlAction struct {
 	Rule *rules.Rule
 
 	// Action is the action to take if the rule matches
 	Action rules.Action
 
-	MaxQueueSize   int `json:"max_queue_size"`
-	MaxConcurrency int `json:"max_concurrency"`
+	MaxQueueSize   int                        `json:"max_queue_size"`
+	MaxConcurrency int                        `json:"max_concurrency"`
+	GroupBy        string                     `json:"group_by"`
+	BindVar        string                     `json:"bind_var"`
+	FairBy         string                     `json:"fair_by"`
+	Pool           string                     `json:"pool"`
+	LaneBy         string                     `json:"lane_by"`
+	Lanes          map[string][]string        `json:"lanes"`
+	MaxQueueWaitMs int                        `json:"max_queue_wait_ms"`
+	Adaptive       *adaptiveConcurrencyConfig `json:"-"`
+
+	// limit is the adaptive limit of the rule, and start the time the query
+	// left the queue at.
+	limit *adaptiveConcurrencyLimit
+	start time.Time
+	// done releases the slot of the query. It is kept by the action, not in
+	// the context of the query, which the other CONCURRENCY_CONTROL rules of
+	// the query share.
+	done ccl.DoneFunc
+}
+
+// cclQueuePrefix prefixes the keys of the queues of a rule, so that the rules
+// of a template don't share their queues, and the queues of a rule can be
+// resized together.
+func cclQueuePrefix(ruleName string) string {
+	return fmt.Sprintf("rule:%q/", ruleName)
+}
+
+// queueKey returns the key of the queue of a query.
+func (p *ConcurrencyControlAction) queueKey(qre *QueryExecutor) string {
+	if p.Pool != "" {
+		return cclPoolQueuePrefix(p.Pool)
+	}
+	if p.GroupBy == "" {
+		return cclQueuePrefix(p.Rule.Name) + qre.plan.QueryTemplateID
+	}
+	return fmt.Sprintf("%s%s/%s=%s", cclQueuePrefix(p.Rule.Name), qre.plan.QueryTemplateID, p.GroupBy, p.keyOf(qre, p.GroupBy))
+}
+
+// keyOf returns the value of a query for a key to group by. The queries
+// without the bind variable, or with a tuple, have the same value.
+func (p *ConcurrencyControlAction) keyOf(qre *QueryExecutor, by string) string {
+	switch by {
+	case cclGroupByUser:
+		if ci, ok := callinfo.FromContext(qre.ctx); ok {
+			return ci.Username()
+		}
+	case cclGroupByClientIP:
+		if ci, ok := callinfo.FromContext(qre.ctx); ok {
+			return ci.RemoteAddr()
+		}
+	case cclGroupByBindVar:
+		if bv, ok := qre.bindVars[p.BindVar]; ok {
+			return string(bv.Value)
+		}
+	}
+	return ""
+}
+
+// lane returns the priority lane of a query: the lane its user, or the lane
+// key of its comments, is mapped to. A comment can name a lane too. The other
+// queries are in the normal lane.
+func (p *ConcurrencyControlAction) lane(qre *QueryExecutor) int {
+	value := ""
+	switch p.LaneBy {
+	case cclLaneByUser:
+		value = p.keyOf(qre, cclGroupByUser)
+	case cclLaneByComment:
+		if m := cclLaneCommentRegexp.FindStringSubmatch(qre.marginComments.Leading + qre.marginComments.Trailing); m != nil {
+			value = m[1]
+		}
+	}
+	for i, lane := range cclLanes {
+		if slices.Contains(p.Lanes[lane], value) {
+			return i
+		}
+	}
+	if i := slices.Index(cclLanes, value); i >= 0 && p.LaneBy == cclLaneByComment {
+		return i
+	}
+	return cclNormalLane
+}
+
+// limits returns the limits of the queues of the rule: the ones of its pool,
+// or its concurrency in the adaptive mode.
+func (p *ConcurrencyControlAction) limits(qe *QueryEngine) (maxQueueSize, maxConcurrency int) {
+	if p.Pool != "" {
+		if pool, ok := qe.concurrencyPools.get(p.Pool); ok {
+			return pool.MaxQueueSize, pool.MaxConcurrency
+		}
+	}
+	if p.Adaptive == nil {
+		return p.MaxQueueSize, p.MaxConcurrency
+	}
+	p.limit = qe.adaptiveConcurrency.get(p.Rule.Name, *p.Adaptive, time.Now())
+	return p.MaxQueueSize, p.limit.current()
+}
+
+// resizeQueues applies the limits of the rule to its queues, or to the queue
+// of its pool, now, keeping the queries waiting in them, and returns the
+// number of queues resized.
+func (p *ConcurrencyControlAction) resizeQueues(qe *QueryEngine) int {
+	maxQueueSize, maxConcurrency := p.limits(qe)
+	prefix := cclQueuePrefix(p.Rule.Name)
+	if p.Pool != "" {
+		prefix = cclPoolQueuePrefix(p.Pool)
+	}
+	if p.Rule.Status == rules.DryRun {
+		prefix = dryRunQueuePrefix + prefix
+	}
+	return qe.concurrencyController.ResizeQueues(prefix, maxQueueSize, maxConcurrency)
 }
 
 func (p *ConcurrencyControlAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
-	q := qre.tsv.qe.concurrencyController.GetOrCreateQueue(qre.plan.QueryTemplateID, p.MaxQueueSize, p.MaxConcurrency)
-	doneFunc, waited, err := q.Wait(qre.ctx, qre.plan.TableNames())
+	maxQueueSize, maxConcurrency := p.limits(qre.tsv.qe)
+	q := qre.tsv.qe.concurrencyController.GetOrCreateQueue(p.queueKey(qre), maxQueueSize, maxConcurrency)
+	var doneFunc ccl.DoneFunc
+	var waited bool
+	var err error
+	start := time.Now()
+	stats := qre.tsv.stats
+	ctx := qre.ctx
+	if p.MaxQueueWaitMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(qre.ctx, time.Duration(p.MaxQueueWaitMs)*time.Millisecond)
+		defer cancel()
+	}
+	stats.ConcurrencyControlWaiting.Add(p.Rule.Name, 1)
+	switch {
+	case p.LaneBy != "":
+		doneFunc, waited, err = q.WaitLane(ctx, qre.plan.TableNames(), p.lane(qre), p.keyOf(qre, p.FairBy))
+	case p.FairBy != "":
+		doneFunc, waited, err = q.WaitFair(ctx, qre.plan.TableNames(), p.keyOf(qre, p.FairBy))
+	default:
+		doneFunc, waited, err = q.Wait(ctx, qre.plan.TableNames())
+	}
+	stats.ConcurrencyControlWaiting.Add(p.Rule.Name, -1)
 
+	result := cclAdmitted
+	switch {
+	case err != nil && waited && ctx.Err() != nil && qre.ctx.Err() == nil:
+		// The query waited for longer than max_queue_wait_ms, not for longer
+		// than its own timeout.
+		result = cclWaitExceeded
+		err = vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "concurrency control protection: queue wait exceeded (%dms)", p.MaxQueueWaitMs)
+	case err != nil && waited:
+		result = cclCancelled
+	case err != nil:
+		result = cclRejected
+	case waited:
+		result = cclQueued
+	}
+	stats.ConcurrencyControlQueries.Add([]string{p.Rule.Name, result}, 1)
 	if waited {
-		qre.tsv.stats.WaitTimings.Record("ccl", time.Now())
+		stats.WaitTimings.Record("ccl", start)
+		stats.ConcurrencyControlWaitTimings.Record(p.Rule.Name, start)
+		qre.ruleAffected(p.Rule)
 	}
 	if err != nil {
 		return nil, err
 	}
-	qre.ctx = context.WithValue(qre.ctx, "cclDoneFunc", doneFunc)
+	stats.ConcurrencyControlInFlight.Add(p.Rule.Name, 1)
+	p.done, p.start = doneFunc, time.Now()
 
 	return nil, nil
 }
 
 func (p *ConcurrencyControlAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
-	v := qre.ctx.Value("cclDoneFunc")
-	if v != nil {
-		doneFunc := v.(ccl.DoneFunc)
-		doneFunc()
+	if p.done != nil {
+		p.done()
+		p.done = nil
+		qre.tsv.stats.ConcurrencyControlInFlight.Add(p.Rule.Name, -1)
+		if p.limit != nil {
+			now := time.Now()
+			if limit, changed := p.limit.record(now, now.Sub(p.start), qre.tsv.hs.threadsRunning); changed {
+				qre.tsv.stats.ConcurrencyLimits.Set(p.Rule.Name, int64(limit))
+			}
+		}
 	}
 
 	return &ActionExecutionResponse{
@@ -141,12 +499,2560 @@ func (p *ConcurrencyControlAction) SetParams(stringParams string) error {
 		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "MaxQueueSize: %d, MaxConcurrency: %d, param value is invalid: "+
 			"make sure MaxQueueSize == 0 || (MaxConcurrency > 0 && MaxConcurrency <= MaxQueueSize)", c.MaxQueueSize, c.MaxQueueSize)
 	}
+	switch c.GroupBy {
+	case "", cclGroupByUser, cclGroupByClientIP:
+		if c.BindVar != "" {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: bind_var is only expected with group_by %s", stringParams, cclGroupByBindVar)
+		}
+	case cclGroupByBindVar:
+		if c.BindVar == "" {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the bind_var to group by is missing", stringParams)
+		}
+	default:
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid group_by %q, expected %s, %s or %s", stringParams, c.GroupBy, cclGroupByUser, cclGroupByClientIP, cclGroupByBindVar)
+	}
+	switch c.FairBy {
+	case "", cclGroupByUser, cclGroupByClientIP:
+	default:
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid fair_by %q, expected %s or %s", stringParams, c.FairBy, cclGroupByUser, cclGroupByClientIP)
+	}
+	if c.Pool != "" && c.GroupBy != "" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the queries of a pool can't be grouped by %s", stringParams, c.GroupBy)
+	}
+	if err := validateCclLanes(stringParams, c.LaneBy, c.Lanes); err != nil {
+		return err
+	}
+	if c.MaxQueueWaitMs < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid max_queue_wait_ms %d", stringParams, c.MaxQueueWaitMs)
+	}
+	if c.FairBy != "" && c.FairBy == c.GroupBy {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the queries grouped by %s can't be admitted fairly by it too", stringParams, c.FairBy)
+	}
+
+	adaptive, err := parseAdaptiveConcurrency(stringParams, c.MaxQueueSize, c.MaxConcurrency)
+	if err != nil {
+		return err
+	}
+	if adaptive != nil && c.Pool != "" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the concurrency of a pool can't be adaptive", stringParams)
+	}
 
 	p.MaxQueueSize = c.MaxQueueSize
 	p.MaxConcurrency = c.MaxConcurrency
+	p.GroupBy, p.BindVar = c.GroupBy, c.BindVar
+	p.FairBy = c.FairBy
+	p.Pool = c.Pool
+	p.LaneBy, p.Lanes = c.LaneBy, c.Lanes
+	p.MaxQueueWaitMs = c.MaxQueueWaitMs
+	p.Adaptive = adaptive
+	return nil
+}
+
+// validateCclLanes validates the priority lanes of the params of a
+// CONCURRENCY_CONTROL rule, like
+//
+//	{"max_queue_size": 100, "max_concurrency": 4, "lane_by": "user", "lanes": {"high": ["admin"], "low": ["etl"]}}
+func validateCclLanes(stringParams, laneBy string, lanes map[string][]string) error {
+	switch laneBy {
+	case "":
+		if len(lanes) > 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the lanes need a lane_by", stringParams)
+		}
+		return nil
+	case cclLaneByUser:
+		if len(lanes) == 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the lanes of the users are missing", stringParams)
+		}
+	case cclLaneByComment:
+	default:
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid lane_by %q, expected %s or %s", stringParams, laneBy, cclLaneByUser, cclLaneByComment)
+	}
+	seen := make(map[string]string)
+	for lane, values := range lanes {
+		if !slices.Contains(cclLanes, lane) {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid lane %q, expected %s", stringParams, lane, strings.Join(cclLanes, ", "))
+		}
+		for _, value := range values {
+			if other, ok := seen[value]; ok && other != lane {
+				return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: %q is in both lanes %s and %s", stringParams, value, other, lane)
+			}
+			seen[value] = lane
+		}
+	}
 	return nil
 }
 
+// parseAdaptiveConcurrency parses the adaptive mode of the params of a
+// CONCURRENCY_CONTROL rule, like
+//
+//	{"max_queue_size": 200, "max_concurrency": 64, "adaptive": {"target_latency": "50ms", "min_concurrency": 4}}
+//
+// It returns nil if the rule has none.
+func parseAdaptiveConcurrency(stringParams string, maxQueueSize, maxConcurrency int) (*adaptiveConcurrencyConfig, error) {
+	c := &struct {
+		Adaptive *struct {
+			TargetLatency     string  `json:"target_latency"`
+			MaxThreadsRunning int64   `json:"max_threads_running"`
+			MinConcurrency    int     `json:"min_concurrency"`
+			Window            string  `json:"window"`
+			Backoff           float64 `json:"backoff"`
+		} `json:"adaptive"`
+	}{}
+	if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+		return nil, err
+	}
+	a := c.Adaptive
+	if a == nil {
+		return nil, nil
+	}
+	if maxQueueSize == 0 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the adaptive mode needs a max_queue_size", stringParams)
+	}
+	config := &adaptiveConcurrencyConfig{
+		MaxThreadsRunning: a.MaxThreadsRunning,
+		MinConcurrency:    a.MinConcurrency,
+		MaxConcurrency:    maxConcurrency,
+		Window:            defaultAdaptiveConcurrencyWindow,
+		Backoff:           a.Backoff,
+	}
+	if a.TargetLatency != "" {
+		latency, err := time.ParseDuration(a.TargetLatency)
+		if err != nil || latency <= 0 {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid target_latency %q", stringParams, a.TargetLatency)
+		}
+		config.TargetLatency = latency
+	}
+	if config.MaxThreadsRunning < 0 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid max_threads_running %d", stringParams, a.MaxThreadsRunning)
+	}
+	if config.TargetLatency == 0 && config.MaxThreadsRunning == 0 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the adaptive mode needs a target_latency or a max_threads_running", stringParams)
+	}
+	if config.MinConcurrency == 0 {
+		config.MinConcurrency = 1
+	}
+	if config.MinConcurrency < 0 || config.MinConcurrency > maxConcurrency {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid min_concurrency %d, expected [1, %d]", stringParams, a.MinConcurrency, maxConcurrency)
+	}
+	if a.Window != "" {
+		window, err := time.ParseDuration(a.Window)
+		if err != nil || window <= 0 {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid window %q", stringParams, a.Window)
+		}
+		config.Window = window
+	}
+	if config.Backoff == 0 {
+		config.Backoff = defaultAdaptiveConcurrencyBackoff
+	}
+	if config.Backoff < 0 || config.Backoff >= 1 {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid backoff %v, expected (0, 1)", stringParams, a.Backoff)
+	}
+	return config, nil
+}
+
 func (p *ConcurrencyControlAction) GetRule() *rules.Rule {
 	return p.Rule
 }
+
+// DryRun counts the query in a queue of its own, so that the dry runs don't
+// take the places of the queries of an active rule of the same template.
+func (p *ConcurrencyControlAction) DryRun(qre *QueryExecutor) (string, string, func()) {
+	maxQueueSize, maxConcurrency := p.limits(qre.tsv.qe)
+	q := qre.tsv.qe.concurrencyController.GetOrCreateQueue(dryRunQueuePrefix+p.queueKey(qre), maxQueueSize, maxConcurrency)
+	done, wouldWait, wouldErr := q.Observe()
+	switch {
+	case wouldErr != nil:
+		return dryRunFail, wouldErr.Error(), done
+	case wouldWait:
+		return dryRunQueue, fmt.Sprintf("the concurrency of %d is reached", p.MaxConcurrency), done
+	}
+	return dryRunNone, "", done
+}
+
+// ResourceGroupAction puts the queries of a rule in a resource group. The
+// query executor admits the queries into their group, so the action itself
+// does nothing.
+type ResourceGroupAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Group string `json:"group"`
+}
+
+func (p *ResourceGroupAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	return nil, nil
+}
+
+func (p *ResourceGroupAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *ResourceGroupAction) SetParams(stringParams string) error {
+	c := &ResourceGroupAction{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if c.Group == "" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the resource group is missing", stringParams)
+	}
+	p.Group = c.Group
+	return nil
+}
+
+func (p *ResourceGroupAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// ThrottleAction checks the throttler of the tablet before the queries of a
+// rule, and fails them while the check of its app is throttled, by the
+// replication lag or by a custom metric of the tablet.
+type ThrottleAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	// App is the app name of the checks, the name of the rule by default.
+	App string `json:"app"`
+	// Check is shard to check the shard metric, or self to check the metric of
+	// the tablet. By default the primary checks the shard and the others self.
+	Check       string `json:"check"`
+	LowPriority bool   `json:"low_priority"`
+}
+
+func (p *ThrottleAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	appName := p.App
+	if appName == "" {
+		appName = p.Rule.Name
+	}
+	checkType, storeName := throttle.ThrottleCheckSelf, "mysql/self"
+	if p.Check == "shard" || (p.Check == "" && qre.tabletType == topodatapb.TabletType_PRIMARY) {
+		checkType, storeName = throttle.ThrottleCheckPrimaryWrite, "mysql/shard"
+	}
+	checkResult := qre.tsv.lagThrottler.CheckByType(qre.ctx, appName, "", &throttle.CheckFlags{LowPriority: p.LowPriority}, checkType)
+	if checkResult.StatusCode == http.StatusOK {
+		return nil, nil
+	}
+	if checkResult.MetricName != "" {
+		storeName = checkResult.MetricName
+	}
+	return nil, vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "throttled by rule %s: app %s: %s: %s is %v, threshold %v", p.Rule.Name, appName, checkResult.Message, storeName, checkResult.Value, checkResult.Threshold)
+}
+
+func (p *ThrottleAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *ThrottleAction) SetParams(stringParams string) error {
+	c := &ThrottleAction{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if c.Check != "" && c.Check != "shard" && c.Check != "self" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: check must be shard or self", stringParams)
+	}
+	p.App, p.Check, p.LowPriority = c.App, c.Check, c.LowPriority
+	return nil
+}
+
+func (p *ThrottleAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// SleepAction delays the queries of a rule before executing them, to inject
+// latency and test how the applications handle their timeouts. The delay is
+// the duration plus a random jitter below the jitter.
+type SleepAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Duration time.Duration
+	Jitter   time.Duration
+}
+
+func (p *SleepAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	delay := p.Duration
+	if p.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+	if delay <= 0 {
+		return nil, nil
+	}
+	start := time.Now()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-qre.ctx.Done():
+		return nil, vterrors.Errorf(vtrpcpb.Code_DEADLINE_EXCEEDED, "%v while delayed by rule %s", qre.ctx.Err(), p.Rule.Name)
+	}
+	qre.tsv.stats.WaitTimings.Record("sleep", start)
+	qre.ruleAffected(p.Rule)
+	return nil, nil
+}
+
+func (p *SleepAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *SleepAction) SetParams(stringParams string) error {
+	c := &struct {
+		Duration string `json:"duration"`
+		Jitter   string `json:"jitter"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if c.Duration == "" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the duration is missing", stringParams)
+	}
+	duration, err := time.ParseDuration(c.Duration)
+	if err != nil || duration < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid duration %q", stringParams, c.Duration)
+	}
+	var jitter time.Duration
+	if c.Jitter != "" {
+		if jitter, err = time.ParseDuration(c.Jitter); err != nil || jitter < 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid jitter %q", stringParams, c.Jitter)
+		}
+	}
+	p.Duration, p.Jitter = duration, jitter
+	return nil
+}
+
+func (p *SleepAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// RewriteAction rewrites the queries of a rule before executing them: it
+// replaces the matches of the pattern with the replacement, in which $1 or
+// ${name} stand for the groups of the match, like regexp.ReplaceAllString.
+// The rewritten query is planned again, and executed instead of the original
+// one. It must be of the same type, and the rules aren't matched against it
+// again.
+type RewriteAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+func (p *RewriteAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	query := p.Pattern.ReplaceAllString(qre.query, p.Replacement)
+	if query == qre.query {
+		return nil, nil
+	}
+	return nil, qre.replan(query, p.Rule.Name)
+}
+
+func (p *RewriteAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *RewriteAction) SetParams(stringParams string) error {
+	c := &struct {
+		Pattern     string `json:"pattern"`
+		Replacement string `json:"replacement"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if c.Pattern == "" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the pattern is missing", stringParams)
+	}
+	pattern, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: %v", stringParams, err)
+	}
+	p.Pattern, p.Replacement = pattern, c.Replacement
+	return nil
+}
+
+func (p *RewriteAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// RedirectAction redirects the queries of a rule from a table to another one,
+// e.g. to cut the traffic over to a table moved to another database. The
+// tables are db.table, or table for the one of the database of the query; the
+// table keeps its database if only the name of the target table is given.
+// Only the SELECT, INSERT, UPDATE and DELETE queries are redirected. The
+// tables can reference the captures of the rule, like archive_${suffix}.
+type RedirectAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	From sqlparser.TableName
+	To   sqlparser.TableName
+
+	// from and to are the tables of the params which reference captures,
+	// parsed for each query once expanded.
+	from, to string
+}
+
+func (p *RedirectAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	stmt, err := sqlparser.Parse(qre.query)
+	if err != nil {
+		return nil, err
+	}
+	switch stmt.(type) {
+	case *sqlparser.Select, *sqlparser.Union, *sqlparser.Insert, *sqlparser.Update, *sqlparser.Delete:
+	default:
+		return nil, nil
+	}
+	if p, err = p.expand(qre.marginComments); err != nil {
+		return nil, err
+	}
+	redirected := false
+	renamed := p.To.Name.String() != p.From.Name.String()
+	_ = sqlparser.SafeRewrite(stmt, nil, func(cursor *sqlparser.Cursor) bool {
+		table, ok := cursor.Node().(sqlparser.TableName)
+		if !ok || !p.matches(table, qre.database) {
+			return true
+		}
+		redirected = true
+		switch parent := cursor.Parent().(type) {
+		case *sqlparser.ColName, sqlparser.TableNames:
+			// The references to the table, by the columns or the targets of a
+			// DELETE, stay valid if unqualified, and refer to its alias if it
+			// was renamed.
+			if table.Qualifier.IsEmpty() {
+				return true
+			}
+			if renamed {
+				cursor.Replace(sqlparser.TableName{Name: p.From.Name})
+				return true
+			}
+		case *sqlparser.AliasedTableExpr:
+			if renamed && parent.As.IsEmpty() {
+				parent.As = p.From.Name
+			}
+		}
+		cursor.Replace(p.redirect(table))
+		return true
+	})
+	if !redirected {
+		return nil, nil
+	}
+	return nil, qre.replan(sqlparser.String(stmt), p.Rule.Name)
+}
+
+// expand returns the action with the tables of the params which reference
+// captures expanded by the captures of a query.
+func (p *RedirectAction) expand(marginComments sqlparser.MarginComments) (*RedirectAction, error) {
+	if p.from == "" && p.to == "" {
+		return p, nil
+	}
+	captures := p.Rule.Captures(marginComments)
+	expanded := *p
+	for _, table := range []struct {
+		name, value string
+		table       *sqlparser.TableName
+	}{{"from", p.from, &expanded.From}, {"to", p.to, &expanded.To}} {
+		if table.value == "" {
+			continue
+		}
+		value := rules.ExpandCaptures(table.value, captures)
+		database, name, err := sqlparser.ParseTable(value)
+		if err != nil || name == "" {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "rule %s expands its %s table %q into the invalid table %q", p.Rule.Name, table.name, table.value, value)
+		}
+		*table.table = sqlparser.TableName{Name: sqlparser.NewIdentifierCS(name), Qualifier: sqlparser.NewIdentifierCS(database)}
+	}
+	return &expanded, nil
+}
+
+// matches returns whether a table of a query of a database is the one the
+// queries are redirected from.
+func (p *RedirectAction) matches(table sqlparser.TableName, database string) bool {
+	if table.Name.String() != p.From.Name.String() {
+		return false
+	}
+	qualifier := table.Qualifier.String()
+	if qualifier == "" {
+		qualifier = database
+	}
+	return p.From.Qualifier.IsEmpty() || p.From.Qualifier.String() == qualifier
+}
+
+// redirect returns the table a table of a query is redirected to.
+func (p *RedirectAction) redirect(table sqlparser.TableName) sqlparser.TableName {
+	if p.To.Qualifier.IsEmpty() {
+		return sqlparser.TableName{Name: p.To.Name, Qualifier: table.Qualifier}
+	}
+	return p.To
+}
+
+func (p *RedirectAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *RedirectAction) SetParams(stringParams string) error {
+	c := &struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	parseTable := func(name, value string) (sqlparser.TableName, error) {
+		if value == "" {
+			return sqlparser.TableName{}, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the %s table is missing", stringParams, name)
+		}
+		database, table, err := sqlparser.ParseTable(value)
+		if err != nil {
+			return sqlparser.TableName{}, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid %s table %q", stringParams, name, value)
+		}
+		return sqlparser.TableName{Name: sqlparser.NewIdentifierCS(table), Qualifier: sqlparser.NewIdentifierCS(database)}, nil
+	}
+	// The tables which reference captures are parsed once expanded.
+	p.from, p.to = "", ""
+	var tables [2]sqlparser.TableName
+	for i, table := range []struct {
+		name, value string
+		template    *string
+	}{{"from", c.From, &p.from}, {"to", c.To, &p.to}} {
+		if table.value != "" && rules.HasCaptureRefs(table.value) {
+			*table.template = table.value
+			continue
+		}
+		parsed, err := parseTable(table.name, table.value)
+		if err != nil {
+			return err
+		}
+		tables[i] = parsed
+	}
+	p.From, p.To = tables[0], tables[1]
+	return nil
+}
+
+func (p *RedirectAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// defaultResultCacheSize is the memory of the results cached by a rule, if
+// its max_size isn't set.
+const defaultResultCacheSize = 16 * 1024 * 1024
+
+// CacheResultAction caches the results of the SELECT queries of a rule for a
+// TTL, and serves the same queries, with the same bind variables, from the
+// cache. The results are only cached outside of the transactions and of the
+// reads after writes, and the writes don't invalidate them: the TTL bounds
+// how stale they are.
+type CacheResultAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	TTL time.Duration
+	// MaxSize is the memory of the results the rule caches, in bytes.
+	MaxSize int64
+
+	// key is the key of the result of the query, if it is cacheable.
+	key string
+	hit bool
+}
+
+func (p *CacheResultAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	if qre.plan.PlanID != planbuilder.PlanSelect || qre.connID != 0 || qre.options.GetReadAfterWriteGtid() != "" {
+		return nil, nil
+	}
+	setting := ""
+	if qre.setting != nil {
+		setting = qre.setting.GetQuery()
+	}
+	p.key = resultCacheKey(qre.database, setting, qre.query, qre.bindVars)
+	v, ok := qre.tsv.qe.resultCaches.get(p.Rule.Name, p.MaxSize).Get(p.key)
+	if !ok || time.Now().After(v.(*cachedResult).expires) {
+		qre.tsv.stats.ResultCacheMisses.Add(p.Rule.Name, 1)
+		return nil, nil
+	}
+	// The cached results are only served to the users allowed to read them.
+	if err := qre.checkPermissions(); err != nil {
+		return nil, err
+	}
+	qre.tsv.stats.ResultCacheHits.Add(p.Rule.Name, 1)
+	p.hit = true
+	return v.(*cachedResult).result.Copy(), nil
+}
+
+func (p *CacheResultAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.key != "" && !p.hit && err == nil && reply != nil {
+		qre.tsv.qe.resultCaches.get(p.Rule.Name, p.MaxSize).Set(p.key, &cachedResult{result: reply.Copy(), expires: time.Now().Add(p.TTL)})
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *CacheResultAction) SetParams(stringParams string) error {
+	c := &struct {
+		TTL     string `json:"ttl"`
+		MaxSize int64  `json:"max_size"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil || ttl <= 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid ttl %q", stringParams, c.TTL)
+	}
+	if c.MaxSize < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid max_size %d", stringParams, c.MaxSize)
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = defaultResultCacheSize
+	}
+	p.TTL, p.MaxSize = ttl, c.MaxSize
+	return nil
+}
+
+func (p *CacheResultAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// RateLimitAction limits the rate of the queries of a rule with a token
+// bucket. The queries over the rate are rejected, or wait for a token in the
+// wait mode, as long as their deadline allows. With a key, like ${tenant},
+// the queries of each expanded key have a bucket of their own.
+type RateLimitAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	QPS   float64
+	Burst int
+	Wait  bool
+	Key   string
+}
+
+// bucket returns the name of the bucket of a query: the name of the rule, and
+// its expanded key if any.
+func (p *RateLimitAction) bucket(qre *QueryExecutor) string {
+	if p.Key == "" {
+		return p.Rule.Name
+	}
+	return p.Rule.Name + "/" + rules.ExpandCaptures(p.Key, p.Rule.Captures(qre.marginComments))
+}
+
+func (p *RateLimitAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	limiter := qre.tsv.qe.rateLimiters.get(p.Rule.Name, p.bucket(qre), p.QPS, p.Burst)
+	if !p.Wait {
+		if !limiter.Allow() {
+			qre.tsv.stats.RateLimitRejections.Add(p.Rule.Name, 1)
+			return nil, vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "rule %s is over its rate of %v queries per second", p.Rule.Name, p.QPS)
+		}
+		return nil, nil
+	}
+	start := time.Now()
+	// Wait fails at once if the query would wait past its deadline.
+	if err := limiter.Wait(qre.ctx); err != nil {
+		qre.tsv.stats.RateLimitRejections.Add(p.Rule.Name, 1)
+		return nil, vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "rule %s is over its rate of %v queries per second: %v", p.Rule.Name, p.QPS, err)
+	}
+	qre.tsv.stats.WaitTimings.Record("ratelimit", start)
+	return nil, nil
+}
+
+func (p *RateLimitAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *RateLimitAction) SetParams(stringParams string) error {
+	c := &struct {
+		QPS   float64 `json:"qps"`
+		Burst int     `json:"burst"`
+		Mode  string  `json:"mode"`
+		Key   string  `json:"key"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if c.QPS <= 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid qps %v", stringParams, c.QPS)
+	}
+	if c.Burst < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid burst %d", stringParams, c.Burst)
+	}
+	// Like the resource groups, the bucket holds a second of queries by
+	// default.
+	if c.Burst == 0 {
+		c.Burst = int(math.Max(1, math.Ceil(c.QPS)))
+	}
+	switch c.Mode {
+	case "", "reject":
+		p.Wait = false
+	case "wait":
+		p.Wait = true
+	default:
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid mode %q, expected reject or wait", stringParams, c.Mode)
+	}
+	p.QPS, p.Burst, p.Key = c.QPS, c.Burst, c.Key
+	return nil
+}
+
+func (p *RateLimitAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+func (p *RateLimitAction) DryRun(qre *QueryExecutor) (string, string, func()) {
+	limiter := qre.tsv.qe.rateLimiters.get(p.Rule.Name, p.bucket(qre), p.QPS, p.Burst)
+	if !p.Wait {
+		if !limiter.Allow() {
+			return dryRunFail, fmt.Sprintf("rule %s is over its rate of %v queries per second", p.Rule.Name, p.QPS), nil
+		}
+		return dryRunNone, "", nil
+	}
+	// Like the queries which wait, the query takes its token in advance.
+	if delay := limiter.Reserve().Delay(); delay > 0 {
+		return dryRunQueue, fmt.Sprintf("rule %s is over its rate of %v queries per second, for %v", p.Rule.Name, p.QPS, delay), nil
+	}
+	return dryRunNone, "", nil
+}
+
+// AuditAction records the matched queries, with their bind variables, their
+// callers and their timing, in a file or by posting them to a URL. The
+// records are written asynchronously: they are dropped if the sink is behind.
+type AuditAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	File      string
+	URL       string
+	QueueSize int
+
+	start time.Time
+}
+
+// auditRecord is a line of an audit sink.
+type auditRecord struct {
+	Time            time.Time      `json:"time"`
+	Rule            string         `json:"rule"`
+	Database        string         `json:"database,omitempty"`
+	SQL             string         `json:"sql"`
+	BindVars        map[string]any `json:"bind_vars,omitempty"`
+	EffectiveCaller string         `json:"effective_caller,omitempty"`
+	ImmediateCaller string         `json:"immediate_caller,omitempty"`
+	RemoteAddr      string         `json:"remote_addr,omitempty"`
+	Duration        string         `json:"duration"`
+	RowsAffected    uint64         `json:"rows_affected,omitempty"`
+	RowsReturned    int            `json:"rows_returned,omitempty"`
+	Error           string         `json:"error,omitempty"`
+}
+
+func (p *AuditAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	p.start = qre.startTime()
+	return nil, nil
+}
+
+func (p *AuditAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	record := &auditRecord{
+		Time:            p.start,
+		Rule:            p.Rule.Name,
+		Database:        qre.database,
+		SQL:             qre.query,
+		BindVars:        auditBindVars(qre.bindVars),
+		EffectiveCaller: callerid.GetPrincipal(callerid.EffectiveCallerIDFromContext(qre.ctx)),
+		ImmediateCaller: callerid.GetUsername(callerid.ImmediateCallerIDFromContext(qre.ctx)),
+		Duration:        time.Since(p.start).String(),
+	}
+	if ci, ok := callinfo.FromContext(qre.ctx); ok {
+		record.RemoteAddr = ci.RemoteAddr()
+	}
+	if reply != nil {
+		record.RowsAffected, record.RowsReturned = reply.RowsAffected, len(reply.Rows)
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	line, marshalErr := json.Marshal(record)
+	if marshalErr != nil || !qre.tsv.qe.auditLogs.get(p.File, p.URL, p.QueueSize).send(line) {
+		qre.tsv.stats.AuditRecordsDropped.Add(p.Rule.Name, 1)
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+// auditBindVars returns the values of the bind variables, as strings, or
+// lists of strings for the tuples.
+func auditBindVars(bindVars map[string]*querypb.BindVariable) map[string]any {
+	if len(bindVars) == 0 {
+		return nil
+	}
+	values := make(map[string]any, len(bindVars))
+	for name, bv := range bindVars {
+		if bv.Type != querypb.Type_TUPLE {
+			values[name] = string(bv.Value)
+			continue
+		}
+		tuple := make([]string, 0, len(bv.Values))
+		for _, v := range bv.Values {
+			tuple = append(tuple, string(v.Value))
+		}
+		values[name] = tuple
+	}
+	return values
+}
+
+func (p *AuditAction) SetParams(stringParams string) error {
+	c := &struct {
+		File      string `json:"file"`
+		URL       string `json:"url"`
+		QueueSize int    `json:"queue_size"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if (c.File == "") == (c.URL == "") {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: exactly one of file and url is expected", stringParams)
+	}
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid url %q", stringParams, c.URL)
+		}
+	}
+	if c.QueueSize < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid queue_size %d", stringParams, c.QueueSize)
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultAuditQueueSize
+	}
+	p.File, p.URL, p.QueueSize = c.File, c.URL, c.QueueSize
+	return nil
+}
+
+func (p *AuditAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// TimeoutOverrideAction replaces the query timeout of the tablet with its own
+// for the matched queries, 0 being none. Unless KillOnTimeout is set, the
+// timeout only bounds the time the queries wait before they are sent to
+// MySQL, where they run to completion.
+type TimeoutOverrideAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Timeout       time.Duration
+	KillOnTimeout bool
+
+	cancel context.CancelFunc
+}
+
+func (p *TimeoutOverrideAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	qre.ctx, p.cancel = withTimeoutOverride(qre.ctx, p.Timeout)
+	if !p.KillOnTimeout {
+		qre.ctx = connpool.WithoutKillOnTimeout(qre.ctx)
+	}
+	return nil, nil
+}
+
+func (p *TimeoutOverrideAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *TimeoutOverrideAction) SetParams(stringParams string) error {
+	c := &struct {
+		Timeout       string `json:"timeout"`
+		KillOnTimeout *bool  `json:"kill_on_timeout"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil || timeout < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid timeout %q", stringParams, c.Timeout)
+	}
+	p.Timeout = timeout
+	p.KillOnTimeout = c.KillOnTimeout == nil || *c.KillOnTimeout
+	return nil
+}
+
+func (p *TimeoutOverrideAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+const (
+	// defaultSampleFileSize is the size of a diagnostics file before it is
+	// rotated.
+	defaultSampleFileSize = 100 * 1024 * 1024
+	// defaultSampleFileBackups is the number of rotated diagnostics files
+	// kept.
+	defaultSampleFileBackups = 3
+)
+
+// SampleAction records a percentage of the matched queries, with their plan,
+// their bind variables and their latency, in a rotated diagnostics file. Like
+// the audit records, the samples are dropped if the file is behind.
+type SampleAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Percentage float64
+	File       string
+	MaxSize    int64
+	MaxBackups int
+
+	sampled bool
+	start   time.Time
+}
+
+// sampleRecord is a line of a diagnostics file.
+type sampleRecord struct {
+	Time         time.Time      `json:"time"`
+	Rule         string         `json:"rule"`
+	Database     string         `json:"database,omitempty"`
+	SQL          string         `json:"sql"`
+	Plan         string         `json:"plan"`
+	Tables       []string       `json:"tables,omitempty"`
+	BindVars     map[string]any `json:"bind_vars,omitempty"`
+	Duration     string         `json:"duration"`
+	RowsAffected uint64         `json:"rows_affected,omitempty"`
+	RowsReturned int            `json:"rows_returned,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+func (p *SampleAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	p.sampled = rand.Float64()*100 < p.Percentage
+	p.start = qre.startTime()
+	return nil, nil
+}
+
+func (p *SampleAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.sampled {
+		record := &sampleRecord{
+			Time:     p.start,
+			Rule:     p.Rule.Name,
+			Database: qre.database,
+			SQL:      qre.query,
+			Plan:     qre.plan.PlanID.String(),
+			Tables:   qre.plan.TableNames(),
+			BindVars: auditBindVars(qre.bindVars),
+			Duration: time.Since(p.start).String(),
+		}
+		if reply != nil {
+			record.RowsAffected, record.RowsReturned = reply.RowsAffected, len(reply.Rows)
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		line, marshalErr := json.Marshal(record)
+		if marshalErr != nil || !qre.tsv.qe.auditLogs.getRotatingFile(p.File, p.MaxSize, p.MaxBackups, defaultAuditQueueSize).send(line) {
+			qre.tsv.stats.SampleRecordsDropped.Add(p.Rule.Name, 1)
+		}
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *SampleAction) SetParams(stringParams string) error {
+	c := &struct {
+		Percentage float64 `json:"percentage"`
+		File       string  `json:"file"`
+		MaxSize    int64   `json:"max_size"`
+		MaxBackups *int    `json:"max_backups"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if c.Percentage <= 0 || c.Percentage > 100 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid percentage %v, expected (0, 100]", stringParams, c.Percentage)
+	}
+	if c.File == "" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the file is missing", stringParams)
+	}
+	if c.MaxSize < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid max_size %d", stringParams, c.MaxSize)
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = defaultSampleFileSize
+	}
+	maxBackups := defaultSampleFileBackups
+	if c.MaxBackups != nil {
+		if *c.MaxBackups < 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid max_backups %d", stringParams, *c.MaxBackups)
+		}
+		maxBackups = *c.MaxBackups
+	}
+	p.Percentage, p.File, p.MaxSize, p.MaxBackups = c.Percentage, c.File, c.MaxSize, maxBackups
+	return nil
+}
+
+func (p *SampleAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// defaultMirrorConcurrency is the number of connections of a mirror.
+const defaultMirrorConcurrency = 2
+
+// MirrorAction replays a percentage of the matched queries, once they
+// succeeded, on a shadow MySQL server, like a server of a newer version. The
+// queries are replayed asynchronously and their results discarded, and the
+// queries of the transactions aren't replayed. The shadow server is meant to
+// hold a copy of the data: the queries run in the database of the rule if set,
+// but the tables qualified with their database still refer to it.
+type MirrorAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Percentage  float64
+	Params      mysql.ConnParams
+	Database    string
+	Concurrency int
+
+	sampled bool
+}
+
+func (p *MirrorAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	p.sampled = rand.Float64()*100 < p.Percentage
+	return nil, nil
+}
+
+func (p *MirrorAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.sampled && err == nil && qre.connID == 0 {
+		switch qre.plan.PlanID {
+		case planbuilder.PlanSelect, planbuilder.PlanInsert, planbuilder.PlanUpdate, planbuilder.PlanDelete, planbuilder.PlanUpdateLimit, planbuilder.PlanDeleteLimit:
+			m := qre.tsv.qe.mirrors.get(p.Rule.Name, p.Params, p.Database, p.Concurrency)
+			if !m.send(qre.database, qre.query, qre.bindVars) {
+				qre.tsv.stats.MirroredQueries.Add([]string{p.Rule.Name, mirrorResultDropped}, 1)
+			}
+		}
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *MirrorAction) SetParams(stringParams string) error {
+	c := &struct {
+		Percentage  float64 `json:"percentage"`
+		Target      string  `json:"target"`
+		Socket      string  `json:"socket"`
+		User        string  `json:"user"`
+		Password    string  `json:"password"`
+		Database    string  `json:"database"`
+		Concurrency int     `json:"concurrency"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if c.Percentage <= 0 || c.Percentage > 100 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid percentage %v, expected (0, 100]", stringParams, c.Percentage)
+	}
+	params := mysql.ConnParams{UnixSocket: c.Socket, Uname: c.User, Pass: c.Password}
+	switch {
+	case (c.Target == "") == (c.Socket == ""):
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: exactly one of target and socket is expected", stringParams)
+	case c.Target != "":
+		host, port, err := net.SplitHostPort(c.Target)
+		if err == nil {
+			params.Host = host
+			params.Port, err = strconv.Atoi(port)
+		}
+		if err != nil {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid target %q, expected host:port", stringParams, c.Target)
+		}
+	}
+	if c.Concurrency < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid concurrency %d", stringParams, c.Concurrency)
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = defaultMirrorConcurrency
+	}
+	p.Percentage, p.Params, p.Database, p.Concurrency = c.Percentage, params, c.Database, c.Concurrency
+	return nil
+}
+
+func (p *MirrorAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// DegradeAction makes the matched queries fail soft: instead of executing
+// them, it returns an empty result, or the static result of its params, with
+// a warning.
+type DegradeAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Result  *sqltypes.Result
+	Warning string
+}
+
+func (p *DegradeAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	result := p.Result.Copy()
+	result.Warnings = []*querypb.QueryWarning{{Code: mysql.ERUnknownError, Message: p.Warning}}
+	return result, nil
+}
+
+func (p *DegradeAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *DegradeAction) SetParams(stringParams string) error {
+	c := &struct {
+		Fields []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"fields"`
+		Rows    [][]*string `json:"rows"`
+		Warning string      `json:"warning"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	result := &sqltypes.Result{}
+	for _, field := range c.Fields {
+		typ := querypb.Type_VARCHAR
+		if field.Type != "" {
+			v, ok := querypb.Type_value[strings.ToUpper(field.Type)]
+			if !ok {
+				return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid type %q of field %s", stringParams, field.Type, field.Name)
+			}
+			typ = querypb.Type(v)
+		}
+		result.Fields = append(result.Fields, &querypb.Field{Name: field.Name, Type: typ})
+	}
+	for i, row := range c.Rows {
+		if len(row) != len(result.Fields) {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: row %d has %d values, expected %d", stringParams, i, len(row), len(result.Fields))
+		}
+		values := make([]sqltypes.Value, len(row))
+		for j, value := range row {
+			if value == nil {
+				continue
+			}
+			v, err := sqltypes.NewValue(result.Fields[j].Type, []byte(*value))
+			if err != nil {
+				return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid value %q of field %s: %v", stringParams, *value, result.Fields[j].Name, err)
+			}
+			values[j] = v
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if c.Warning == "" {
+		c.Warning = fmt.Sprintf("the query was degraded by rule %s", p.Rule.Name)
+	}
+	p.Result, p.Warning = result, c.Warning
+	return nil
+}
+
+func (p *DegradeAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// readOnlyGuardStatements are the classes of statements a READ_ONLY_GUARD rule
+// may reject.
+var readOnlyGuardStatements = map[string]sqlparser.StatementType{
+	"INSERT":  sqlparser.StmtInsert,
+	"REPLACE": sqlparser.StmtReplace,
+	"UPDATE":  sqlparser.StmtUpdate,
+	"DELETE":  sqlparser.StmtDelete,
+	"DDL":     sqlparser.StmtDDL,
+}
+
+// ReadOnlyGuardAction freezes the writes to the matched tables, by rejecting
+// the matched statements of its classes, all but the DDLs by default, while
+// still letting the other ones, like the SELECTs, through.
+type ReadOnlyGuardAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Statements map[sqlparser.StatementType]bool
+}
+
+func (p *ReadOnlyGuardAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	if stmtType := sqlparser.Preview(qre.query); p.Statements[stmtType] {
+		return nil, vterrors.Errorf(vtrpcpb.Code_PERMISSION_DENIED, "%s is rejected: rule %s freezes the writes to %s", stmtType, p.Rule.Name, strings.Join(qre.plan.TableNames(), ", "))
+	}
+	return nil, nil
+}
+
+func (p *ReadOnlyGuardAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *ReadOnlyGuardAction) SetParams(stringParams string) error {
+	c := &struct {
+		Statements []string `json:"statements"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if len(c.Statements) == 0 {
+		c.Statements = []string{"INSERT", "REPLACE", "UPDATE", "DELETE"}
+	}
+	statements := make(map[sqlparser.StatementType]bool, len(c.Statements))
+	for _, statement := range c.Statements {
+		stmtType, ok := readOnlyGuardStatements[strings.ToUpper(statement)]
+		if !ok {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid statement %q, expected INSERT, REPLACE, UPDATE, DELETE or DDL", stringParams, statement)
+		}
+		statements[stmtType] = true
+	}
+	p.Statements = statements
+	return nil
+}
+
+func (p *ReadOnlyGuardAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+func (p *ReadOnlyGuardAction) DryRun(qre *QueryExecutor) (string, string, func()) {
+	if _, err := p.BeforeExecution(qre); err != nil {
+		return dryRunFail, err.Error(), nil
+	}
+	return dryRunNone, "", nil
+}
+
+const (
+	// defaultWebhookQPS is the number of notifications a WEBHOOK_NOTIFY rule
+	// posts per second at most by default.
+	defaultWebhookQPS = 1
+	// defaultWebhookRetries is the number of times a notification is retried
+	// by default.
+	defaultWebhookRetries = 3
+)
+
+// WebhookNotifyAction posts a notification to a webhook when the rule matches
+// a query, like a rule catching a forbidden pattern. The notifications are
+// delivered asynchronously, retried, and the ones over the rate of the rule
+// are dropped.
+type WebhookNotifyAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	URL     string
+	QPS     float64
+	Retries int
+}
+
+// webhookPayload is the JSON a webhook is notified with.
+type webhookPayload struct {
+	Rule        string    `json:"rule"`
+	Description string    `json:"description,omitempty"`
+	QueryDigest string    `json:"query_digest"`
+	Query       string    `json:"query,omitempty"`
+	Database    string    `json:"database,omitempty"`
+	User        string    `json:"user,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+func (p *WebhookNotifyAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	limiter := qre.tsv.qe.rateLimiters.get(p.Rule.Name, "webhook:"+p.Rule.Name, p.QPS, int(math.Max(1, math.Ceil(p.QPS))))
+	if !limiter.Allow() {
+		qre.tsv.stats.WebhookNotifications.Add([]string{p.Rule.Name, webhookResultRateLimited}, 1)
+		return nil, nil
+	}
+	payload := &webhookPayload{
+		Rule:        p.Rule.Name,
+		Description: p.Rule.Description,
+		QueryDigest: qre.plan.QueryTemplateID,
+		Database:    qre.database,
+		User:        callerid.GetPrincipal(callerid.EffectiveCallerIDFromContext(qre.ctx)),
+		Time:        time.Now(),
+	}
+	// The query is redacted, since the webhooks are rarely meant to see the
+	// data.
+	if query, err := sqlparser.RedactSQLQuery(qre.query); err == nil {
+		payload.Query = query
+	}
+	if payload.User == "" {
+		payload.User = callerid.GetUsername(callerid.ImmediateCallerIDFromContext(qre.ctx))
+	}
+	data, err := json.Marshal(payload)
+	if err != nil || !qre.tsv.qe.webhooks.notify(p.URL, p.Rule.Name, p.Retries, data) {
+		qre.tsv.stats.WebhookNotifications.Add([]string{p.Rule.Name, webhookResultDropped}, 1)
+	}
+	return nil, nil
+}
+
+func (p *WebhookNotifyAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *WebhookNotifyAction) SetParams(stringParams string) error {
+	c := &struct {
+		URL     string  `json:"url"`
+		QPS     float64 `json:"qps"`
+		Retries *int    `json:"retries"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid url %q", stringParams, c.URL)
+	}
+	if c.QPS < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid qps %v", stringParams, c.QPS)
+	}
+	if c.QPS == 0 {
+		c.QPS = defaultWebhookQPS
+	}
+	retries := defaultWebhookRetries
+	if c.Retries != nil {
+		if *c.Retries < 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid retries %d", stringParams, *c.Retries)
+		}
+		retries = *c.Retries
+	}
+	p.URL, p.QPS, p.Retries = c.URL, c.QPS, retries
+	return nil
+}
+
+func (p *WebhookNotifyAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// queryTagKeyRegexp matches the keys of the extra tags of a QUERY_TAG rule.
+var queryTagKeyRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// QueryTagAction appends a comment like
+// /* rule=foo caller=bar trace_id=... */ to the queries the rule matches
+// before they are sent to MySQL, so the entries of the slow log and
+// performance_schema can be tracked back to the rule and the caller. The
+// values are query-escaped, so that none can close the comment.
+type QueryTagAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	// Tags are the extra key=value pairs of the comment, sorted by key.
+	Tags []string
+}
+
+func (p *QueryTagAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	caller := callerid.GetPrincipal(callerid.EffectiveCallerIDFromContext(qre.ctx))
+	if caller == "" {
+		caller = callerid.GetUsername(callerid.ImmediateCallerIDFromContext(qre.ctx))
+	}
+	var buf strings.Builder
+	buf.WriteString(" /* rule=")
+	buf.WriteString(url.QueryEscape(p.Rule.Name))
+	if caller != "" {
+		buf.WriteString(" caller=")
+		buf.WriteString(url.QueryEscape(caller))
+	}
+	if traceID := trace.TraceID(qre.ctx); traceID != "" {
+		buf.WriteString(" trace_id=")
+		buf.WriteString(url.QueryEscape(traceID))
+	}
+	for _, tag := range p.Tags {
+		buf.WriteString(" ")
+		buf.WriteString(tag)
+	}
+	buf.WriteString(" */")
+	qre.marginComments.Trailing += buf.String()
+	return nil, nil
+}
+
+func (p *QueryTagAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *QueryTagAction) SetParams(stringParams string) error {
+	c := &struct {
+		Tags map[string]string `json:"tags"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	tags := make([]string, 0, len(c.Tags))
+	for key, value := range c.Tags {
+		if !queryTagKeyRegexp.MatchString(key) {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid tag %q", stringParams, key)
+		}
+		if key == "rule" || key == "caller" || key == "trace_id" {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: tag %s is reserved", stringParams, key)
+		}
+		tags = append(tags, key+"="+url.QueryEscape(value))
+	}
+	sort.Strings(tags)
+	p.Tags = tags
+	return nil
+}
+
+func (p *QueryTagAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+const (
+	// defaultCircuitBreakerErrorRate is the percentage of the queries which
+	// have to fail to open a circuit by default.
+	defaultCircuitBreakerErrorRate = 50
+	// defaultCircuitBreakerMinRequests is the number of queries of a window
+	// below which a circuit stays closed by default.
+	defaultCircuitBreakerMinRequests = 20
+	// defaultCircuitBreakerWindow is the window in which the failures are
+	// counted by default.
+	defaultCircuitBreakerWindow = 10 * time.Second
+	// defaultCircuitBreakerCoolDown is the time an open circuit rejects the
+	// queries by default, before it probes again.
+	defaultCircuitBreakerCoolDown = 30 * time.Second
+)
+
+// CircuitBreakerAction rejects the queries of a rule for a cool-down once too
+// many of them fail, or are too slow, instead of a FAIL rule added by hand
+// during the incident. After the cool-down a few probe queries run again: the
+// circuit closes if they succeed, and opens again otherwise.
+//
+// The errors of the queries themselves, like the syntax errors and the
+// duplicate keys, are not failures. With post execution conditions on its
+// rule, the failures are the queries whose outcome matches them instead.
+type CircuitBreakerAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Config circuitBreakerConfig
+
+	// breaker is the circuit the query was allowed to run by.
+	breaker *circuitBreaker
+	start   time.Time
+	// observed is set if the post execution conditions of the rule judged
+	// the query, failed if its outcome matched them.
+	observed, failed bool
+}
+
+func (p *CircuitBreakerAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	breaker := qre.tsv.qe.circuitBreakers.get(p.Rule.Name, p.Config)
+	if !breaker.allow(time.Now()) {
+		qre.tsv.stats.CircuitBreakerEvents.Add([]string{p.Rule.Name, circuitBreakerEventRejected}, 1)
+		return nil, vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "rule %s is open: too many of its queries failed recently", p.Rule.Name)
+	}
+	p.breaker, p.start = breaker, time.Now()
+	return nil, nil
+}
+
+func (p *CircuitBreakerAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.breaker != nil {
+		now := time.Now()
+		failed := p.Config.Latency > 0 && now.Sub(p.start) > p.Config.Latency
+		if err != nil {
+			switch vterrors.Code(err) {
+			case vtrpcpb.Code_INVALID_ARGUMENT, vtrpcpb.Code_ALREADY_EXISTS:
+			default:
+				failed = true
+			}
+		}
+		if p.observed {
+			failed = p.failed
+		}
+		if event := p.breaker.record(now, failed); event != "" {
+			qre.tsv.stats.CircuitBreakerEvents.Add([]string{p.Rule.Name, event}, 1)
+		}
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *CircuitBreakerAction) ObserveOutcome(qre *QueryExecutor, matched bool) {
+	p.observed, p.failed = true, matched
+}
+
+func (p *CircuitBreakerAction) SetParams(stringParams string) error {
+	c := &struct {
+		ErrorRate        float64 `json:"error_rate"`
+		Latency          string  `json:"latency"`
+		MinRequests      int     `json:"min_requests"`
+		Window           string  `json:"window"`
+		CoolDown         string  `json:"cool_down"`
+		HalfOpenRequests int     `json:"half_open_requests"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	config := circuitBreakerConfig{
+		ErrorRate:        c.ErrorRate,
+		MinRequests:      c.MinRequests,
+		Window:           defaultCircuitBreakerWindow,
+		CoolDown:         defaultCircuitBreakerCoolDown,
+		HalfOpenRequests: c.HalfOpenRequests,
+	}
+	if config.ErrorRate < 0 || config.ErrorRate > 100 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid error_rate %v", stringParams, c.ErrorRate)
+	}
+	if config.ErrorRate == 0 {
+		config.ErrorRate = defaultCircuitBreakerErrorRate
+	}
+	if config.MinRequests < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid min_requests %d", stringParams, c.MinRequests)
+	}
+	if config.MinRequests == 0 {
+		config.MinRequests = defaultCircuitBreakerMinRequests
+	}
+	if config.HalfOpenRequests < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid half_open_requests %d", stringParams, c.HalfOpenRequests)
+	}
+	if config.HalfOpenRequests == 0 {
+		config.HalfOpenRequests = 1
+	}
+	for _, duration := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"latency", c.Latency, &config.Latency},
+		{"window", c.Window, &config.Window},
+		{"cool_down", c.CoolDown, &config.CoolDown},
+	} {
+		if duration.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(duration.value)
+		if err != nil || d <= 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid %s %q", stringParams, duration.name, duration.value)
+		}
+		*duration.dst = d
+	}
+	p.Config = config
+	return nil
+}
+
+func (p *CircuitBreakerAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// PriorityAction puts the queries of a rule in a priority class, whose weight
+// sets its share of the execution slots of the tablet under load. See
+// priority_scheduler.go.
+type PriorityAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Class  string
+	Weight int
+
+	release func()
+}
+
+func (p *PriorityAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	start := time.Now()
+	queued, release, err := qre.tsv.qe.priorityScheduler.acquire(qre.ctx, p.Class, p.Weight)
+	if queued {
+		qre.tsv.stats.WaitTimings.Record("Priority", start)
+		qre.tsv.stats.PriorityQueuedQueries.Add(p.Class, 1)
+		qre.ruleAffected(p.Rule)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.release = release
+	return nil, nil
+}
+
+func (p *PriorityAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.release != nil {
+		p.release()
+		p.release = nil
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *PriorityAction) SetParams(stringParams string) error {
+	c := &struct {
+		Class  string `json:"class"`
+		Weight int    `json:"weight"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if c.Class == "" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the priority class is missing", stringParams)
+	}
+	if c.Weight < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid weight %d", stringParams, c.Weight)
+	}
+	if c.Weight == 0 {
+		c.Weight = 1
+	}
+	p.Class, p.Weight = c.Class, c.Weight
+	return nil
+}
+
+func (p *PriorityAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+const (
+	dataMaskRedact  = "redact"
+	dataMaskPartial = "partial"
+	dataMaskHash    = "hash"
+
+	// dataMaskRedacted replaces the values of the redacted columns.
+	dataMaskRedacted = "****"
+	// defaultDataMaskKeepLast is the number of characters the partial masks
+	// keep by default, like the last 4 digits of a phone number.
+	defaultDataMaskKeepLast = 4
+)
+
+// dataMask is how a DATA_MASKING rule masks a column.
+type dataMask struct {
+	Name string `json:"name"`
+	// Mode is redact, which replaces the values by ****, partial, which
+	// replaces all but the last KeepLast characters by *, or hash, which
+	// replaces them by the hex SHA-256 of the salt and the value.
+	Mode     string `json:"mode"`
+	KeepLast *int   `json:"keep_last"`
+	Salt     string `json:"salt"`
+}
+
+// DataMaskingAction masks some columns of the results of the queries of a
+// rule, the streamed ones included, unless the user is exempt. The columns are
+// matched by name or by the name of the column of the table they are read
+// from, case-insensitively, so that an alias doesn't unmask them; they are
+// then of type VARCHAR, and their NULLs stay NULL.
+//
+// Masking fails closed: the fields which are not read from a column of the
+// tables of the query, like concat(phone), are resolved through the select
+// expressions of the query. The ones derived from a masked column are redacted
+// whatever the mode of the column, since e.g. a partial mask of reverse(phone)
+// would show its first characters, and the query fails if the fields can't be
+// told apart, e.g. for the derived tables and the unions reading a masked
+// column. The views are read as tables: the rules should match them too.
+type DataMaskingAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Columns     []dataMask
+	ExemptUsers []string
+
+	// masks are the masks of the columns of the result, by position, once its
+	// fields are known.
+	masks []*dataMask
+}
+
+func (p *DataMaskingAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	return nil, nil
+}
+
+func (p *DataMaskingAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+// RewriteResult is part of the ResultRewriter interface.
+func (p *DataMaskingAction) RewriteResult(qre *QueryExecutor, result *sqltypes.Result) (*sqltypes.Result, error) {
+	if p.exempt(qre) {
+		return result, nil
+	}
+	if result.Fields != nil {
+		masks, err := p.fieldMasks(qre, result.Fields)
+		if err != nil {
+			return nil, err
+		}
+		p.masks = masks
+	}
+	if len(result.Rows) > 0 && p.masks == nil {
+		return nil, p.unknownFieldsError()
+	}
+	masked := false
+	for _, mask := range p.masks {
+		masked = masked || mask != nil
+	}
+	if !masked {
+		return result, nil
+	}
+
+	t := NewResultTransform(result)
+	for i, mask := range p.masks {
+		if mask == nil {
+			continue
+		}
+		if result.Fields != nil {
+			field := proto.Clone(result.Fields[i]).(*querypb.Field)
+			field.Type = sqltypes.VarChar
+			t.SetField(i, field)
+		}
+		t.MapValues(i, func(value sqltypes.Value) sqltypes.Value {
+			if value.IsNull() {
+				return value
+			}
+			return sqltypes.NewVarChar(mask.mask(value.ToString()))
+		})
+	}
+	return t.Result(), nil
+}
+
+// derivedDataMask masks the fields derived from a masked column.
+var derivedDataMask = &dataMask{Mode: dataMaskRedact}
+
+// fieldMasks returns the masks of the fields of a result, by position.
+func (p *DataMaskingAction) fieldMasks(qre *QueryExecutor, fields []*querypb.Field) ([]*dataMask, error) {
+	masks := make([]*dataMask, len(fields))
+	var unmasked []int
+	for i, field := range fields {
+		if field.Name == "" && field.OrgName == "" {
+			return nil, p.unknownFieldsError()
+		}
+		if masks[i] = p.columnMask(field.Name); masks[i] == nil {
+			masks[i] = p.columnMask(field.OrgName)
+		}
+		if masks[i] == nil {
+			unmasked = append(unmasked, i)
+		}
+	}
+	if len(unmasked) == 0 {
+		return masks, nil
+	}
+
+	stmt, err := sqlparser.Parse(qre.query)
+	if err != nil {
+		return nil, p.derivedFieldError(fields[unmasked[0]])
+	}
+	if !p.readsMaskedColumn(stmt) {
+		return masks, nil
+	}
+	// The fields read from a column of a table are what they are named, but
+	// not the ones read from the derived tables, which may rename a masked
+	// column.
+	derivedTables := make(map[string]bool)
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.AliasedTableExpr:
+			if _, ok := node.Expr.(*sqlparser.DerivedTable); ok {
+				derivedTables[node.As.String()] = true
+			}
+		case *sqlparser.CommonTableExpr:
+			derivedTables[node.ID.String()] = true
+		}
+		return true, nil
+	}, stmt)
+	sel, _ := stmt.(*sqlparser.Select)
+	resolvable := sel != nil && sel.With == nil && len(sel.SelectExprs) == len(fields) && readsOnlyTables(sel.From)
+	for _, i := range unmasked {
+		field := fields[i]
+		if field.OrgName != "" && qre.plan.readsTable(field.OrgTable) && !derivedTables[field.OrgTable] {
+			continue
+		}
+		if !resolvable {
+			return nil, p.derivedFieldError(field)
+		}
+		expr, ok := sel.SelectExprs[i].(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, p.derivedFieldError(field)
+		}
+		if p.readsMaskedColumn(expr.Expr) {
+			masks[i] = derivedDataMask
+		}
+	}
+	return masks, nil
+}
+
+// columnMask returns the mask of a column, nil if it is not masked.
+func (p *DataMaskingAction) columnMask(name string) *dataMask {
+	if name == "" {
+		return nil
+	}
+	for i := range p.Columns {
+		if strings.EqualFold(name, p.Columns[i].Name) {
+			return &p.Columns[i]
+		}
+	}
+	return nil
+}
+
+// readsMaskedColumn returns whether node reads one of the masked columns.
+func (p *DataMaskingAction) readsMaskedColumn(node sqlparser.SQLNode) bool {
+	reads := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if col, ok := node.(*sqlparser.ColName); ok && p.columnMask(col.Name.String()) != nil {
+			reads = true
+		}
+		return !reads, nil
+	}, node)
+	return reads
+}
+
+// readsOnlyTables returns whether the FROM clause of a select only reads
+// tables, and not derived tables, whose columns hide the ones they are read
+// from.
+func readsOnlyTables(from sqlparser.TableExprs) bool {
+	for _, expr := range from {
+		switch expr := expr.(type) {
+		case *sqlparser.AliasedTableExpr:
+			if _, ok := expr.Expr.(sqlparser.TableName); !ok {
+				return false
+			}
+		case *sqlparser.JoinTableExpr:
+			if !readsOnlyTables(sqlparser.TableExprs{expr.LeftExpr, expr.RightExpr}) {
+				return false
+			}
+		case *sqlparser.ParenTableExpr:
+			if !readsOnlyTables(expr.Exprs) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// unknownFieldsError fails the queries whose columns can't be told, rather
+// than return them unmasked.
+func (p *DataMaskingAction) unknownFieldsError() error {
+	return vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "rule %s can't mask a result without the names of its fields", p.Rule.Name)
+}
+
+// derivedFieldError fails the queries with a field which may be derived from
+// a masked column, rather than return it unmasked.
+func (p *DataMaskingAction) derivedFieldError(field *querypb.Field) error {
+	return vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "rule %s can't tell whether the field %s of the result is derived from a masked column", p.Rule.Name, field.Name)
+}
+
+// exempt returns whether the user of the query sees the columns unmasked. The
+// user is the one the rules are matched with, see matchActions.
+func (p *DataMaskingAction) exempt(qre *QueryExecutor) bool {
+	ci, ok := callinfo.FromContext(qre.ctx)
+	if !ok {
+		return false
+	}
+	user := ci.Username()
+	for _, exemptUser := range p.ExemptUsers {
+		if user == exemptUser {
+			return true
+		}
+	}
+	return false
+}
+
+// mask returns the masked value of a column.
+func (m *dataMask) mask(value string) string {
+	switch m.Mode {
+	case dataMaskPartial:
+		keep := defaultDataMaskKeepLast
+		if m.KeepLast != nil {
+			keep = *m.KeepLast
+		}
+		hidden := utf8.RuneCountInString(value) - keep
+		if hidden <= 0 {
+			// The values too short to hide anything are hidden whole.
+			return strings.Repeat("*", utf8.RuneCountInString(value))
+		}
+		var buf strings.Builder
+		for i := range value {
+			if hidden > 0 {
+				buf.WriteByte('*')
+				hidden--
+				continue
+			}
+			buf.WriteString(value[i:])
+			break
+		}
+		return buf.String()
+	case dataMaskHash:
+		sum := sha256.Sum256([]byte(m.Salt + value))
+		return hex.EncodeToString(sum[:])
+	default:
+		return dataMaskRedacted
+	}
+}
+
+func (p *DataMaskingAction) SetParams(stringParams string) error {
+	c := &struct {
+		Columns     []dataMask `json:"columns"`
+		ExemptUsers []string   `json:"exempt_users"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if len(c.Columns) == 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the columns are missing", stringParams)
+	}
+	for i := range c.Columns {
+		column := &c.Columns[i]
+		if column.Name == "" {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: a column has no name", stringParams)
+		}
+		column.Mode = strings.ToLower(column.Mode)
+		switch column.Mode {
+		case "":
+			column.Mode = dataMaskRedact
+		case dataMaskRedact, dataMaskPartial, dataMaskHash:
+		default:
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid mode %q of column %s, expected redact, partial or hash", stringParams, column.Mode, column.Name)
+		}
+		if column.KeepLast != nil && *column.KeepLast < 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid keep_last %d of column %s", stringParams, *column.KeepLast, column.Name)
+		}
+	}
+	p.Columns, p.ExemptUsers = c.Columns, c.ExemptUsers
+	return nil
+}
+
+func (p *DataMaskingAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+const (
+	// sqlInjectionObserve only logs and counts the suspicious queries, to tune
+	// the threshold of a rule before enforcing it.
+	sqlInjectionObserve = "observe"
+	// sqlInjectionWarn also adds a warning to their results.
+	sqlInjectionWarn = "warn"
+	// sqlInjectionBlock rejects them.
+	sqlInjectionBlock = "block"
+
+	// defaultSQLInjectionThreshold is the score from which a query is
+	// suspicious by default.
+	defaultSQLInjectionThreshold = 50
+)
+
+var sqlInjectionLogger = logutil.NewThrottledLogger("SQLInjection", 10*time.Second)
+
+// SQLInjectionDetectAction scores the queries of a rule for the patterns of
+// the SQL injections, like tautologies, stacked statements and comment tricks,
+// see sql_injection.go, and logs, warns about or blocks the ones whose score
+// reaches the threshold of the rule, depending on its mode.
+type SQLInjectionDetectAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Mode      string
+	Threshold int
+
+	// warning is the warning of a suspicious query in the warn mode.
+	warning string
+}
+
+func (p *SQLInjectionDetectAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	score, signals := scoreSQLInjection(qre.query, qre.bindVars)
+	if score < p.Threshold {
+		return nil, nil
+	}
+	qre.tsv.stats.SQLInjectionDetections.Add([]string{p.Rule.Name, p.Mode}, 1)
+	// The query is redacted, since the data of a real injection would end up
+	// in the logs.
+	query, err := sqlparser.RedactSQLQuery(qre.query)
+	if err != nil {
+		query = qre.plan.QueryTemplateID
+	}
+	sqlInjectionLogger.Warningf("Rule %s scored a query of %s %d for SQL injection (%s), mode %s: %s", p.Rule.Name,
+		callerid.GetUsername(callerid.ImmediateCallerIDFromContext(qre.ctx)), score, strings.Join(signals, ", "), p.Mode, query)
+	switch p.Mode {
+	case sqlInjectionWarn:
+		p.warning = fmt.Sprintf("rule %s scored the query %d for SQL injection: %s", p.Rule.Name, score, strings.Join(signals, ", "))
+	case sqlInjectionBlock:
+		return nil, vterrors.Errorf(vtrpcpb.Code_PERMISSION_DENIED, "rule %s blocked the query, which looks like an SQL injection: %s", p.Rule.Name, strings.Join(signals, ", "))
+	}
+	return nil, nil
+}
+
+func (p *SQLInjectionDetectAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.warning != "" && reply != nil {
+		// The reply may be shared, like the ones of the cache.
+		reply = reply.ShallowCopy()
+		reply.Warnings = append(append([]*querypb.QueryWarning(nil), reply.Warnings...), &querypb.QueryWarning{Code: mysql.ERUnknownError, Message: p.warning})
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *SQLInjectionDetectAction) SetParams(stringParams string) error {
+	c := &struct {
+		Mode      string `json:"mode"`
+		Threshold int    `json:"threshold"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	mode := strings.ToLower(c.Mode)
+	switch mode {
+	case "":
+		mode = sqlInjectionObserve
+	case sqlInjectionObserve, sqlInjectionWarn, sqlInjectionBlock:
+	default:
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid mode %q, expected observe, warn or block", stringParams, c.Mode)
+	}
+	if c.Threshold < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid threshold %d", stringParams, c.Threshold)
+	}
+	if c.Threshold == 0 {
+		c.Threshold = defaultSQLInjectionThreshold
+	}
+	p.Mode, p.Threshold = mode, c.Threshold
+	return nil
+}
+
+func (p *SQLInjectionDetectAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// AutoLimitAction caps the rows of the SELECTs of a rule, to protect the
+// tablet from the accidental dumps of whole tables: the SELECTs without a
+// LIMIT, or with a LIMIT over MaxRows, are rewritten with a LIMIT of MaxRows,
+// and their results carry a warning. The SELECTs without a table, and the
+// aggregations without a GROUP BY, return a single row, so they are left
+// alone.
+type AutoLimitAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	MaxRows int
+
+	// warning is the warning of a query it limited.
+	warning string
+}
+
+func (p *AutoLimitAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	stmt, err := sqlparser.Parse(qre.query)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := stmt.(sqlparser.SelectStatement)
+	if !ok {
+		return nil, nil
+	}
+	if sel, ok := sel.(*sqlparser.Select); ok {
+		if readsNoTable(sel) || (len(sel.GroupBy) == 0 && sqlparser.ContainsAggregation(sel.SelectExprs)) {
+			return nil, nil
+		}
+	}
+	limit := sel.GetLimit()
+	if limit == nil {
+		limit = &sqlparser.Limit{}
+	} else if value, ok := constantValue(limit.Rowcount, qre.bindVars); ok {
+		if rowcount, err := strconv.ParseUint(value, 10, 64); err == nil && rowcount <= uint64(p.MaxRows) {
+			return nil, nil
+		}
+	}
+	limit.Rowcount = sqlparser.NewIntLiteral(strconv.Itoa(p.MaxRows))
+	sel.SetLimit(limit)
+	if err := qre.replan(sqlparser.String(sel), p.Rule.Name); err != nil {
+		return nil, err
+	}
+	p.warning = fmt.Sprintf("rule %s limited the query to %d rows", p.Rule.Name, p.MaxRows)
+	return nil, nil
+}
+
+// readsNoTable returns whether a SELECT reads no table, like select 1 or
+// select 1 from dual.
+func readsNoTable(sel *sqlparser.Select) bool {
+	if len(sel.From) == 0 {
+		return true
+	}
+	if len(sel.From) > 1 {
+		return false
+	}
+	table, ok := sel.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return false
+	}
+	name, ok := table.Expr.(sqlparser.TableName)
+	return ok && name.Qualifier.IsEmpty() && name.Name.String() == "dual"
+}
+
+func (p *AutoLimitAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.warning != "" && reply != nil {
+		// The reply may be shared, like the ones of the cache.
+		reply = reply.ShallowCopy()
+		reply.Warnings = append(append([]*querypb.QueryWarning(nil), reply.Warnings...), &querypb.QueryWarning{Code: mysql.ERUnknownError, Message: p.warning})
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *AutoLimitAction) SetParams(stringParams string) error {
+	c := &struct {
+		MaxRows int `json:"max_rows"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if c.MaxRows <= 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid max_rows %d", stringParams, c.MaxRows)
+	}
+	p.MaxRows = c.MaxRows
+	return nil
+}
+
+func (p *AutoLimitAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// KillAction kills the queries of a rule which run longer than After, like the
+// scans of a hot table which hold its locks. Only the MySQL queries are killed,
+// and their connection, and the transaction in it, carry on, unless
+// KillConnection is set. The deadline applies whatever the timeout of the
+// query, even one which doesn't kill the queries, and to the queries already
+// running when the rule is loaded or changed, see killRunningQueries.
+type KillAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	After          time.Duration
+	KillConnection bool
+
+	deadline *connpool.KillDeadline
+}
+
+func (p *KillAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	p.deadline = &connpool.KillDeadline{
+		At:         time.Now().Add(p.After),
+		Connection: p.KillConnection,
+		Reason:     fmt.Sprintf("rule %s", p.Rule.Name),
+	}
+	qre.ctx = connpool.WithKillDeadline(qre.ctx, p.deadline)
+	return nil, nil
+}
+
+func (p *KillAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.deadline != nil && p.deadline.Killed() {
+		qre.tsv.stats.KilledQueries.Add(p.Rule.Name, 1)
+		if err != nil {
+			err = vterrors.Errorf(vtrpcpb.Code_DEADLINE_EXCEEDED, "rule %s killed the query after %v: %v", p.Rule.Name, p.After, err)
+		}
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *KillAction) SetParams(stringParams string) error {
+	c := &struct {
+		After          string `json:"after"`
+		KillConnection bool   `json:"kill_connection"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	after, err := time.ParseDuration(c.After)
+	if err != nil || after <= 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid after %q", stringParams, c.After)
+	}
+	p.After, p.KillConnection = after, c.KillConnection
+	return nil
+}
+
+func (p *KillAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// killMatch is what the KILL rules match a running query on, taken from its
+// executor by killRunningQueries while the query is in its list, since the
+// executor releases its bind variables once the query is removed.
+type killMatch struct {
+	query          string
+	planID         planbuilder.PlanType
+	tableNames     []string
+	remoteAddr     string
+	username       string
+	workloadClass  string
+	namespace      string
+	inTransaction  bool
+	bindVars       map[string]*querypb.BindVariable
+	marginComments sqlparser.MarginComments
+	access         func() *rules.AccessProfile
+	// kills are the KILL actions which gave the query its deadline before it
+	// executed.
+	kills []*KillAction
+}
+
+// killMatch returns what the KILL rules loaded while the query runs match it
+// on, nil if it has no plan.
+func (qre *QueryExecutor) killMatch() *killMatch {
+	if qre.plan == nil {
+		return nil
+	}
+	m := &killMatch{
+		query:          qre.query,
+		planID:         qre.plan.PlanID,
+		tableNames:     qre.plan.TableNames(),
+		workloadClass:  qre.workloadClass(),
+		namespace:      qre.tsv.qe.resourceGroups.ruleNamespace(qre.database),
+		inTransaction:  qre.inTransaction(),
+		marginComments: qre.marginComments,
+		access:         qre.plan.access.explainedProfile,
+	}
+	if ci, ok := callinfo.FromContext(qre.ctx); ok {
+		m.remoteAddr, m.username = ci.RemoteAddr(), ci.Username()
+	}
+	// The bind variables go back to their pool once the query is removed.
+	if len(qre.bindVars) != 0 {
+		m.bindVars = make(map[string]*querypb.BindVariable, len(qre.bindVars))
+		for name, bv := range qre.bindVars {
+			m.bindVars[name] = bv
+		}
+	}
+	for _, action := range qre.calledActionList {
+		if kill, ok := action.(*KillAction); ok {
+			m.kills = append(m.kills, kill)
+		}
+	}
+	return m
+}
+
+// killsLike returns whether the query was given the deadline of kill before
+// it executed.
+func (m *killMatch) killsLike(kill *KillAction) bool {
+	for _, armed := range m.kills {
+		if armed.Rule.Name == kill.Rule.Name && armed.After == kill.After && armed.KillConnection == kill.KillConnection {
+			return true
+		}
+	}
+	return false
+}
+
+// killRunningQueries applies the KILL rules to the queries already running
+// when the rules are loaded or changed, which BeforeExecution didn't give their
+// deadline: the queries matching a rule are killed once they have run for its
+// After, or right away if they already have.
+func (tsv *TabletServer) killRunningQueries() {
+	for _, ql := range []*QueryList{tsv.statelessql, tsv.statefulql, tsv.olapql} {
+		for _, mq := range ql.matchedQueries() {
+			qd, m := mq.qd, mq.match
+			qrs := tsv.qe.queryRuleSources.FilterByPlan(m.query, m.planID, m.tableNames...)
+			actions := GetActionList(qrs, m.remoteAddr, m.username, m.workloadClass, m.namespace, m.inTransaction, m.bindVars, m.marginComments, m.access)
+			for _, action := range actions {
+				kill, ok := action.(*KillAction)
+				if !ok || m.killsLike(kill) {
+					continue
+				}
+				name := kill.Rule.Name
+				ql.killAfter(qd, name, kill.After, kill.KillConnection, func() {
+					tsv.stats.KilledQueries.Add(name, 1)
+				})
+			}
+		}
+	}
+}
+
+// The kinds of the transient MySQL errors a RETRY_WITH_BACKOFF rule retries.
+const (
+	retryErrorDeadlock        = "deadlock"
+	retryErrorLockWaitTimeout = "lock_wait_timeout"
+	retryErrorConnection      = "connection"
+)
+
+// retryableErrorKind returns the kind of a transient MySQL error, or "" if the
+// error isn't one.
+func retryableErrorKind(err error) string {
+	var sqlErr *mysql.SQLError
+	if !errors.As(err, &sqlErr) {
+		return ""
+	}
+	switch sqlErr.Number() {
+	case mysql.ERLockDeadlock:
+		return retryErrorDeadlock
+	case mysql.ERLockWaitTimeout:
+		return retryErrorLockWaitTimeout
+	case mysql.CRServerGone, mysql.CRServerLost, mysql.CRConnectionError, mysql.CRConnHostError:
+		return retryErrorConnection
+	}
+	return ""
+}
+
+const (
+	// defaultRetryAttempts is the number of times a statement is retried by
+	// default.
+	defaultRetryAttempts = 3
+	// defaultRetryBackoff is the wait before the first retry by default.
+	defaultRetryBackoff = 10 * time.Millisecond
+	// defaultRetryMaxBackoff is the longest wait between two retries by
+	// default.
+	defaultRetryMaxBackoff = time.Second
+)
+
+// RetryWithBackoffAction retries the statements of a rule which fail with a
+// transient MySQL error, up to Attempts times, waiting Backoff before the
+// first retry and twice as long before each next one, up to MaxBackoff. The
+// client only sees the error of the last attempt.
+//
+// Only the statements which a retry can't apply twice are retried: the
+// connection errors only for the reads, since a write may have been applied
+// before its connection broke, and only the lock wait timeouts in a
+// transaction, since MySQL rolls the whole transaction back on the other
+// errors.
+type RetryWithBackoffAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Errors are the kinds of the errors retried.
+	Errors []string
+}
+
+func (p *RetryWithBackoffAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	return nil, nil
+}
+
+func (p *RetryWithBackoffAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	backoff := p.Backoff
+	for attempt := 0; attempt < p.Attempts; attempt++ {
+		kind := p.retryableErrorKind(qre, err)
+		if kind == "" {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-qre.ctx.Done():
+			timer.Stop()
+			return &ActionExecutionResponse{Reply: reply, Err: err}
+		case <-timer.C:
+		}
+		qre.tsv.stats.QueryRetries.Add([]string{p.Rule.Name, kind}, 1)
+		reply, err = qre.execPlan()
+		if backoff *= 2; backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+// retryableErrorKind returns the kind of the error of a statement if the rule
+// retries it, or "".
+func (p *RetryWithBackoffAction) retryableErrorKind(qre *QueryExecutor, err error) string {
+	kind := retryableErrorKind(err)
+	if kind == "" || !slices.Contains(p.Errors, kind) {
+		return ""
+	}
+	if qre.connID != 0 && kind != retryErrorLockWaitTimeout {
+		return ""
+	}
+	if kind == retryErrorConnection {
+		switch qre.plan.PlanID {
+		case planbuilder.PlanSelect, planbuilder.PlanSelectImpossible, planbuilder.PlanShow, planbuilder.PlanOtherRead:
+		default:
+			return ""
+		}
+	}
+	return kind
+}
+
+func (p *RetryWithBackoffAction) SetParams(stringParams string) error {
+	c := &struct {
+		Attempts   *int     `json:"attempts"`
+		Backoff    string   `json:"backoff"`
+		MaxBackoff string   `json:"max_backoff"`
+		Errors     []string `json:"errors"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	p.Attempts = defaultRetryAttempts
+	if c.Attempts != nil {
+		if *c.Attempts <= 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid attempts %d", stringParams, *c.Attempts)
+		}
+		p.Attempts = *c.Attempts
+	}
+	p.Backoff = defaultRetryBackoff
+	if c.Backoff != "" {
+		backoff, err := time.ParseDuration(c.Backoff)
+		if err != nil || backoff < 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid backoff %q", stringParams, c.Backoff)
+		}
+		p.Backoff = backoff
+	}
+	p.MaxBackoff = defaultRetryMaxBackoff
+	if c.MaxBackoff != "" {
+		maxBackoff, err := time.ParseDuration(c.MaxBackoff)
+		if err != nil || maxBackoff < p.Backoff {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid max_backoff %q", stringParams, c.MaxBackoff)
+		}
+		p.MaxBackoff = maxBackoff
+	} else if p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = p.Backoff
+	}
+	p.Errors = []string{retryErrorDeadlock, retryErrorLockWaitTimeout, retryErrorConnection}
+	if c.Errors != nil {
+		for _, kind := range c.Errors {
+			switch kind {
+			case retryErrorDeadlock, retryErrorLockWaitTimeout, retryErrorConnection:
+			default:
+				return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid error %q", stringParams, kind)
+			}
+		}
+		p.Errors = c.Errors
+	}
+	return nil
+}
+
+func (p *RetryWithBackoffAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// StopAction lets the queries of a rule run without the actions of the rules
+// after it in the pipeline, like a rule of a higher priority which exempts the
+// queries of an administrator from the throttling rules.
+type StopAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+}
+
+func (p *StopAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	return nil, ErrSkipRemainingActions
+}
+
+func (p *StopAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *StopAction) SetParams(stringParams string) error {
+	return nil
+}
+
+func (p *StopAction) GetRule() *rules.Rule {
+	return p.Rule
+}
+
+// replan replaces the query and the plan of the executor with the ones of a
+// query which a rule rewrote.
+func (qre *QueryExecutor) replan(query, ruleName string) error {
+	if from, to := sqlparser.Preview(qre.query), sqlparser.Preview(query); to != from {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "rule %s rewrote the %s query into a %s query: %q", ruleName, from, to, query)
+	}
+	plan, err := qre.tsv.qe.GetPlan(qre.ctx, qre.logStats, qre.database, query, skipQueryPlanCache(qre.options))
+	if err != nil {
+		return vterrors.Wrapf(err, "rule %s rewrote the query into %q", ruleName, query)
+	}
+	qre.query, qre.plan = query, plan
+	return nil
+}
@@ -2,14 +2,34 @@ package tabletserver
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/mysql/fakesqldb"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/test/utils"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/callinfo"
+	"vitess.io/vitess/go/vt/callinfo/fakecallinfo"
+	querypb "vitess.io/vitess/go/vt/proto/query"
 	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
 	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
 )
 
@@ -36,6 +56,26 @@ func TestFailAction(t *testing.T) {
 	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(qre, nil, nil))
 	assert.NoError(t, action.SetParams(""))
 	assert.NotNil(t, action.GetRule())
+
+	// The params set the MySQL error of the clients, and the message.
+	require.NoError(t, action.SetParams(`{"errno": 1142, "sqlstate": "42000", "message": "blocked by firewall rule ${rule} (${digest})"}`))
+	qre = &QueryExecutor{plan: &TabletPlan{QueryTemplateID: "abc"}}
+	_, err = action.BeforeExecution(qre)
+	assert.EqualError(t, err, "blocked by firewall rule test_rule (abc) (errno 1142) (sqlstate 42000)")
+	assert.Equal(t, vtrpcpb.Code_INVALID_ARGUMENT, vterrors.Code(err))
+	sqlErr := mysql.NewSQLErrorFromError(err).(*mysql.SQLError)
+	assert.Equal(t, 1142, sqlErr.Number())
+	assert.Equal(t, "42000", sqlErr.SQLState())
+	require.NoError(t, action.SetParams(`{"errno": 3100}`))
+	_, err = action.BeforeExecution(qre)
+	assert.EqualError(t, err, "disallowed due to rule: ruleDescription (errno 3100) (sqlstate HY000)")
+	require.NoError(t, action.SetParams(`{"message": "${description} of ${rule}"}`))
+	_, err = action.BeforeExecution(qre)
+	assert.EqualError(t, err, "ruleDescription of test_rule")
+
+	assert.EqualError(t, action.SetParams(`{"errno": 70000}`), `stringParams: {"errno": 70000} is invalid: invalid errno 70000`)
+	assert.EqualError(t, action.SetParams(`{"sqlstate": "42000"}`), `stringParams: {"sqlstate": "42000"} is invalid: the sqlstate needs an errno`)
+	assert.EqualError(t, action.SetParams(`{"errno": 1142, "sqlstate": "42"}`), `stringParams: {"errno": 1142, "sqlstate": "42"} is invalid: invalid sqlstate "42"`)
 }
 
 func TestFailRetryAction(t *testing.T) {
@@ -55,6 +95,27 @@ func TestFailRetryAction(t *testing.T) {
 	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(qre, nil, nil))
 	assert.NoError(t, action.SetParams(""))
 	assert.NotNil(t, action.GetRule())
+	_, hasRetryAfter := vterrors.RetryAfter(err)
+	assert.False(t, hasRetryAfter)
+
+	// The params pick the code and suggest a delay.
+	require.NoError(t, action.SetParams(`{"code": "RESOURCE_EXHAUSTED", "retry_after": "2s"}`))
+	_, err = action.BeforeExecution(qre)
+	assert.EqualError(t, err, "disallowed due to rule: ruleDescription (retry after 2s)")
+	assert.Equal(t, vtrpcpb.Code_RESOURCE_EXHAUSTED, vterrors.Code(err))
+	retryAfter, ok := vterrors.RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, retryAfter)
+
+	require.NoError(t, action.SetParams(`{"code": "UNAVAILABLE"}`))
+	_, err = action.BeforeExecution(qre)
+	assert.EqualError(t, err, "disallowed due to rule: ruleDescription")
+	assert.Equal(t, vtrpcpb.Code_UNAVAILABLE, vterrors.Code(err))
+
+	assert.EqualError(t, action.SetParams(`{"code": "OK"}`), `stringParams: {"code": "OK"} is invalid: invalid code "OK"`)
+	assert.EqualError(t, action.SetParams(`{"code": "BUSY"}`), `stringParams: {"code": "BUSY"} is invalid: invalid code "BUSY"`)
+	assert.EqualError(t, action.SetParams(`{"retry_after": "-1s"}`), `stringParams: {"retry_after": "-1s"} is invalid: invalid retry_after "-1s"`)
+	assert.EqualError(t, action.SetParams(`{"retry_after": "soon"}`), `stringParams: {"retry_after": "soon"} is invalid: invalid retry_after "soon"`)
 }
 
 func TestConcurrencyControlAction(t *testing.T) {
@@ -107,6 +168,127 @@ func TestConcurrencyControlAction(t *testing.T) {
 	assert.NoError(t, err2)
 
 	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(qre, nil, nil))
+
+	// The queries which timed out in the queue are counted apart from the
+	// ones which found it full.
+	counts := tsv.stats.ConcurrencyControlQueries.Counts()
+	assert.EqualValues(t, 2, counts["test_rule.admitted"])
+	assert.EqualValues(t, 2, counts["test_rule.cancelled"])
+	assert.EqualValues(t, 1, counts["test_rule.rejected"])
+}
+
+func TestConcurrencyControlActionGroupBy(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "group_by_rule", rules.QRConcurrencyControl)
+	newAction := func(params string) *ConcurrencyControlAction {
+		action := &ConcurrencyControlAction{Rule: qr, Action: rules.QRConcurrencyControl}
+		require.NoError(t, action.SetParams(params))
+		return action
+	}
+	byTenant := `{"max_queue_size": 1, "max_concurrency": 1, "group_by": "bind_var", "bind_var": "tenant"}`
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	newQre := func(tenant int64) *QueryExecutor {
+		qre := newTestQueryExecutor(ctx, tsv, "select * from t1 where tenant = :tenant", 0)
+		qre.bindVars["tenant"] = sqltypes.Int64BindVariable(tenant)
+		return qre
+	}
+
+	// Each tenant has a queue of its own.
+	first, firstQre := newAction(byTenant), newQre(1)
+	_, err := first.BeforeExecution(firstQre)
+	require.NoError(t, err)
+	other, otherQre := newAction(byTenant), newQre(2)
+	_, err = other.BeforeExecution(otherQre)
+	require.NoError(t, err)
+	_, err = newAction(byTenant).BeforeExecution(newQre(1))
+	assert.EqualError(t, err, "concurrency control protection: too many queued transactions (1 >= 1)")
+	assert.EqualValues(t, 2, tsv.stats.ConcurrencyControlInFlight.Counts()["group_by_rule"])
+	first.AfterExecution(firstQre, nil, nil)
+	other.AfterExecution(otherQre, nil, nil)
+	assert.Zero(t, tsv.qe.concurrencyController.Pending(first.queueKey(firstQre)))
+
+	// The queries admitted fairly share the queue of their group.
+	fair := `{"max_queue_size": 1, "max_concurrency": 1, "group_by": "bind_var", "bind_var": "tenant", "fair_by": "user"}`
+	second, secondQre := newAction(fair), newQre(1)
+	_, err = second.BeforeExecution(secondQre)
+	require.NoError(t, err)
+	_, err = newAction(fair).BeforeExecution(newQre(1))
+	assert.EqualError(t, err, "concurrency control protection: too many queued transactions (1 >= 1)")
+	second.AfterExecution(secondQre, nil, nil)
+
+	counts := tsv.stats.ConcurrencyControlQueries.Counts()
+	assert.EqualValues(t, 3, counts["group_by_rule.admitted"])
+	assert.EqualValues(t, 2, counts["group_by_rule.rejected"])
+	assert.Zero(t, tsv.stats.ConcurrencyControlInFlight.Counts()["group_by_rule"])
+	assert.Zero(t, tsv.stats.ConcurrencyControlWaiting.Counts()["group_by_rule"])
+
+	// The users and the client IPs come from the call info.
+	action := newAction(byTenant)
+	qre := newTestQueryExecutor(callinfo.NewContext(ctx, &fakecallinfo.FakeCallInfo{Remote: "10.0.0.1", User: "app"}), tsv, "select * from t1", 0)
+	action.GroupBy, action.BindVar = cclGroupByUser, ""
+	assert.Equal(t, `rule:"group_by_rule"/`+qre.plan.QueryTemplateID+"/user=app", action.queueKey(qre))
+	action.GroupBy = cclGroupByClientIP
+	assert.Equal(t, `rule:"group_by_rule"/`+qre.plan.QueryTemplateID+"/client_ip=10.0.0.1", action.queueKey(qre))
+	action.GroupBy = ""
+	assert.Equal(t, `rule:"group_by_rule"/`+qre.plan.QueryTemplateID, action.queueKey(qre))
+}
+
+// TestConcurrencyControlActionResize raises the max_concurrency of a rule while
+// a query waits in its queue, which gets its slot as soon as the rule is set.
+func TestConcurrencyControlActionResize(t *testing.T) {
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	tsv.RegisterQueryRuleSource("resize_test")
+	defer tsv.UnRegisterQueryRuleSource("resize_test")
+
+	setRule := func(params string) *rules.Rule {
+		qr := rules.NewActiveQueryRule("ruleDescription", "resize_rule", rules.QRConcurrencyControl)
+		qr.SetActionArgs(params)
+		qrs := rules.New()
+		qrs.Add(qr)
+		require.NoError(t, tsv.SetQueryRules("resize_test", qrs))
+		return qr
+	}
+	newAction := func(qr *rules.Rule) *ConcurrencyControlAction {
+		action, err := CreateActionInstance(rules.QRConcurrencyControl, qr)
+		require.NoError(t, err)
+		return action.(*ConcurrencyControlAction)
+	}
+	qr := setRule(`{"max_queue_size": 3, "max_concurrency": 1}`)
+
+	first, firstQre := newAction(qr), newTestQueryExecutor(ctx, tsv, "select * from t1", 0)
+	_, err := first.BeforeExecution(firstQre)
+	require.NoError(t, err)
+	second, secondQre := newAction(qr), newTestQueryExecutor(ctx, tsv, "select * from t1", 0)
+	admitted := make(chan error)
+	go func() {
+		_, err := second.BeforeExecution(secondQre)
+		admitted <- err
+	}()
+	key := first.queueKey(firstQre)
+	for tsv.qe.concurrencyController.Pending(key) < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	setRule(`{"max_queue_size": 3, "max_concurrency": 2}`)
+	select {
+	case err := <-admitted:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the waiting query was not admitted by the resize")
+	}
+	assert.Equal(t, 2, tsv.qe.concurrencyController.Pending(key))
+	first.AfterExecution(firstQre, nil, nil)
+	second.AfterExecution(secondQre, nil, nil)
+	assert.Zero(t, tsv.qe.concurrencyController.Pending(key))
+	assert.EqualValues(t, 1, tsv.stats.ConcurrencyControlQueries.Counts()["resize_rule.queued"])
 }
 
 func TestConcurrencyControlActionSetParams(t *testing.T) {
@@ -151,4 +333,1576 @@ func TestConcurrencyControlActionSetParams(t *testing.T) {
 	assert.NoError(t, action.SetParams(params))
 	assert.Equal(t, 0, action.MaxQueueSize)
 	assert.Equal(t, -1, action.MaxConcurrency)
+
+	// group_by
+	assert.NoError(t, action.SetParams(`{"max_queue_size": 2, "max_concurrency": 1, "group_by": "client_ip"}`))
+	assert.Equal(t, cclGroupByClientIP, action.GroupBy)
+	assert.EqualError(t, action.SetParams(`{"group_by": "tenant"}`), `stringParams: {"group_by": "tenant"} is invalid: invalid group_by "tenant", expected user, client_ip or bind_var`)
+	assert.EqualError(t, action.SetParams(`{"group_by": "bind_var"}`), `stringParams: {"group_by": "bind_var"} is invalid: the bind_var to group by is missing`)
+	assert.EqualError(t, action.SetParams(`{"group_by": "user", "bind_var": "tenant"}`), `stringParams: {"group_by": "user", "bind_var": "tenant"} is invalid: bind_var is only expected with group_by bind_var`)
+
+	// fair_by
+	assert.NoError(t, action.SetParams(`{"max_queue_size": 2, "max_concurrency": 1, "group_by": "client_ip", "fair_by": "user"}`))
+	assert.Equal(t, cclGroupByUser, action.FairBy)
+	assert.EqualError(t, action.SetParams(`{"fair_by": "bind_var"}`), `stringParams: {"fair_by": "bind_var"} is invalid: invalid fair_by "bind_var", expected user or client_ip`)
+	assert.EqualError(t, action.SetParams(`{"group_by": "user", "fair_by": "user"}`), `stringParams: {"group_by": "user", "fair_by": "user"} is invalid: the queries grouped by user can't be admitted fairly by it too`)
+
+	// lanes
+	assert.NoError(t, action.SetParams(`{"max_queue_size": 2, "max_concurrency": 1, "lane_by": "user", "lanes": {"high": ["admin"], "low": ["etl"]}}`))
+	assert.Equal(t, cclLaneByUser, action.LaneBy)
+	assert.Equal(t, map[string][]string{"high": {"admin"}, "low": {"etl"}}, action.Lanes)
+	assert.EqualError(t, action.SetParams(`{"lanes": {"high": ["admin"]}}`), `stringParams: {"lanes": {"high": ["admin"]}} is invalid: the lanes need a lane_by`)
+	assert.EqualError(t, action.SetParams(`{"lane_by": "user"}`), `stringParams: {"lane_by": "user"} is invalid: the lanes of the users are missing`)
+	assert.EqualError(t, action.SetParams(`{"lane_by": "client_ip"}`), `stringParams: {"lane_by": "client_ip"} is invalid: invalid lane_by "client_ip", expected user or comment`)
+	assert.EqualError(t, action.SetParams(`{"lane_by": "comment", "lanes": {"urgent": ["p0"]}}`), `stringParams: {"lane_by": "comment", "lanes": {"urgent": ["p0"]}} is invalid: invalid lane "urgent", expected high, normal, low`)
+	assert.ErrorContains(t, action.SetParams(`{"lane_by": "user", "lanes": {"high": ["admin"], "low": ["admin"]}}`), `"admin" is in both lanes`)
+
+	// pool
+	assert.NoError(t, action.SetParams(`{"max_queue_size": 2, "max_concurrency": 1, "pool": "reporting"}`))
+	assert.Equal(t, "reporting", action.Pool)
+	assert.EqualError(t, action.SetParams(`{"pool": "reporting", "group_by": "user"}`), `stringParams: {"pool": "reporting", "group_by": "user"} is invalid: the queries of a pool can't be grouped by user`)
+	assert.EqualError(t, action.SetParams(`{"max_queue_size": 2, "max_concurrency": 1, "pool": "reporting", "adaptive": {"target_latency": "1s"}}`),
+		`stringParams: {"max_queue_size": 2, "max_concurrency": 1, "pool": "reporting", "adaptive": {"target_latency": "1s"}} is invalid: the concurrency of a pool can't be adaptive`)
+
+	// max_queue_wait_ms
+	assert.NoError(t, action.SetParams(`{"max_queue_size": 2, "max_concurrency": 1, "max_queue_wait_ms": 100}`))
+	assert.Equal(t, 100, action.MaxQueueWaitMs)
+	assert.EqualError(t, action.SetParams(`{"max_queue_wait_ms": -1}`), `stringParams: {"max_queue_wait_ms": -1} is invalid: invalid max_queue_wait_ms -1`)
+}
+
+// TestConcurrencyControlActionLanes queues a low priority query before a high
+// priority one, which is admitted first.
+func TestConcurrencyControlActionLanes(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "lanes_rule", rules.QRConcurrencyControl)
+	newAction := func() *ConcurrencyControlAction {
+		action := &ConcurrencyControlAction{Rule: qr, Action: rules.QRConcurrencyControl}
+		require.NoError(t, action.SetParams(`{"max_queue_size": 3, "max_concurrency": 1, "lane_by": "comment", "lanes": {"high": ["p0"]}}`))
+		return action
+	}
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	newQre := func(comment string) *QueryExecutor {
+		qre := newTestQueryExecutor(ctx, tsv, "select * from t1", 0)
+		qre.marginComments.Leading = comment
+		return qre
+	}
+
+	// The comments map the queries to the lanes, or name them.
+	action := newAction()
+	assert.Equal(t, 0, action.lane(newQre("/* lane=p0 */ ")))
+	assert.Equal(t, 0, action.lane(newQre("/* app=web, lane=high */ ")))
+	assert.Equal(t, 2, action.lane(newQre("/* lane=low */ ")))
+	assert.Equal(t, cclNormalLane, action.lane(newQre("/* lane=p1 */ ")))
+	assert.Equal(t, cclNormalLane, action.lane(newQre("")))
+
+	first, firstQre := newAction(), newQre("")
+	_, err := first.BeforeExecution(firstQre)
+	require.NoError(t, err)
+	admitted := make(chan string)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wait := func(comment string, pending int) {
+		action, qre := newAction(), newQre(comment)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := action.BeforeExecution(qre)
+			assert.NoError(t, err)
+			admitted <- comment
+			<-admitted
+			action.AfterExecution(qre, nil, nil)
+		}()
+		key := first.queueKey(firstQre)
+		assert.Eventually(t, func() bool { return tsv.qe.concurrencyController.Pending(key) == pending }, 10*time.Second, time.Millisecond)
+	}
+	wait("/* lane=low */ ", 2)
+	wait("/* lane=p0 */ ", 3)
+
+	first.AfterExecution(firstQre, nil, nil)
+	for _, expected := range []string{"/* lane=p0 */ ", "/* lane=low */ "} {
+		assert.Equal(t, expected, <-admitted)
+		admitted <- ""
+	}
+}
+
+// TestConcurrencyControlActionMaxQueueWait rejects the query which waits for
+// longer than max_queue_wait_ms, while its own timeout is far longer.
+func TestConcurrencyControlActionMaxQueueWait(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "queue_wait_rule", rules.QRConcurrencyControl)
+	newAction := func() *ConcurrencyControlAction {
+		action := &ConcurrencyControlAction{Rule: qr, Action: rules.QRConcurrencyControl}
+		require.NoError(t, action.SetParams(`{"max_queue_size": 2, "max_concurrency": 1, "max_queue_wait_ms": 50}`))
+		return action
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	first, firstQre := newAction(), newTestQueryExecutor(ctx, tsv, "select * from t1", 0)
+	_, err := first.BeforeExecution(firstQre)
+	require.NoError(t, err)
+	start := time.Now()
+	_, err = newAction().BeforeExecution(newTestQueryExecutor(ctx, tsv, "select * from t1", 0))
+	assert.EqualError(t, err, "concurrency control protection: queue wait exceeded (50ms)")
+	assert.Equal(t, vtrpcpb.Code_RESOURCE_EXHAUSTED, vterrors.Code(err))
+	assert.Less(t, time.Since(start), 10*time.Second)
+	first.AfterExecution(firstQre, nil, nil)
+
+	// The queries which get a slot in time are not limited.
+	_, err = first.BeforeExecution(firstQre)
+	require.NoError(t, err)
+	first.AfterExecution(firstQre, nil, nil)
+
+	counts := tsv.stats.ConcurrencyControlQueries.Counts()
+	assert.EqualValues(t, 2, counts["queue_wait_rule.admitted"])
+	assert.EqualValues(t, 1, counts["queue_wait_rule.wait_exceeded"])
+	assert.Zero(t, counts["queue_wait_rule.cancelled"])
+}
+
+func TestThrottleAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRThrottle)
+	action := &ThrottleAction{Rule: qr, Action: rules.QRThrottle}
+	assert.NoError(t, action.SetParams(`{"app": "etl", "check": "self", "low_priority": true}`))
+	assert.Equal(t, &ThrottleAction{Rule: qr, Action: rules.QRThrottle, App: "etl", Check: "self", LowPriority: true}, action)
+	assert.EqualError(t, action.SetParams(`{"check": "cluster"}`), `stringParams: {"check": "cluster"} is invalid: check must be shard or self`)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	qre := newTestQueryExecutor(ctx, tsv, "select * from t1 where a = :a and b = :b", 0)
+
+	// The checks of a disabled throttler are OK.
+	assert.NoError(t, action.SetParams(""))
+	_, err := action.BeforeExecution(qre)
+	assert.NoError(t, err)
+	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(qre, nil, nil))
+}
+
+func TestSleepAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRSleep)
+	action := &SleepAction{Rule: qr, Action: rules.QRSleep}
+	assert.NoError(t, action.SetParams(`{"duration": "20ms", "jitter": "10ms"}`))
+	assert.Equal(t, &SleepAction{Rule: qr, Action: rules.QRSleep, Duration: 20 * time.Millisecond, Jitter: 10 * time.Millisecond}, action)
+	assert.EqualError(t, action.SetParams(""), `stringParams:  is invalid: the duration is missing`)
+	assert.EqualError(t, action.SetParams(`{"duration": "-1s"}`), `stringParams: {"duration": "-1s"} is invalid: invalid duration "-1s"`)
+	assert.EqualError(t, action.SetParams(`{"duration": "1s", "jitter": "some"}`), `stringParams: {"duration": "1s", "jitter": "some"} is invalid: invalid jitter "some"`)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	qre := newTestQueryExecutor(ctx, tsv, "select * from t1 where a = :a and b = :b", 0)
+
+	start := time.Now()
+	_, err := action.BeforeExecution(qre)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(qre, nil, nil))
+
+	// The queries which time out while delayed fail.
+	assert.NoError(t, action.SetParams(`{"duration": "1h"}`))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	qre = newTestQueryExecutor(timeoutCtx, tsv, "select * from t1 where a = :a and b = :b", 0)
+	_, err = action.BeforeExecution(qre)
+	assert.EqualError(t, err, "context deadline exceeded while delayed by rule test_rule")
+	assert.Equal(t, vtrpcpb.Code_DEADLINE_EXCEEDED, vterrors.Code(err))
+}
+
+func TestRewriteAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRRewrite)
+	action := &RewriteAction{Rule: qr, Action: rules.QRRewrite}
+	assert.EqualError(t, action.SetParams(`{"replacement": "x"}`), `stringParams: {"replacement": "x"} is invalid: the pattern is missing`)
+	assert.ErrorContains(t, action.SetParams(`{"pattern": "(", "replacement": "x"}`), "error parsing regexp")
+	assert.NoError(t, action.SetParams(`{"pattern": "(?i)^select \\* from test_table where (.*)$", "replacement": "select pk, name from test_table where tenant_id = 42 and ($1)"}`))
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	db.SetNeverFail(true)
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// The rewritten query is executed instead of the original one.
+	qre := newTestQueryExecutor(ctx, tsv, "select * from test_table where pk = 1", 0)
+	_, err := action.BeforeExecution(qre)
+	assert.NoError(t, err)
+	assert.Equal(t, "select pk, name from test_table where tenant_id = 42 and (pk = 1)", qre.query)
+	assert.Equal(t, qre.query, qre.plan.Original)
+	db.ResetQueryLog()
+	_, err = qre.Execute()
+	assert.NoError(t, err)
+	assert.Contains(t, db.QueryLog(), "select pk, `name` from test_table where tenant_id = 42 and pk = 1")
+	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(qre, nil, nil))
+
+	// The queries which don't match are left alone.
+	qre = newTestQueryExecutor(ctx, tsv, "select pk from test_table", 0)
+	plan := qre.plan
+	_, err = action.BeforeExecution(qre)
+	assert.NoError(t, err)
+	assert.Equal(t, plan, qre.plan)
+
+	// A query can't be rewritten into another type of query.
+	assert.NoError(t, action.SetParams(`{"pattern": "^select .*", "replacement": "delete from test_table"}`))
+	qre = newTestQueryExecutor(ctx, tsv, "select * from test_table where pk = 1", 0)
+	_, err = action.BeforeExecution(qre)
+	assert.EqualError(t, err, `rule test_rule rewrote the SELECT query into a DELETE query: "delete from test_table"`)
+}
+
+func TestRedirectAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRRedirect)
+	action := &RedirectAction{Rule: qr, Action: rules.QRRedirect}
+	assert.EqualError(t, action.SetParams(`{"from": "db1.t1"}`), `stringParams: {"from": "db1.t1"} is invalid: the to table is missing`)
+	assert.EqualError(t, action.SetParams(`{"from": "db1.t1.c1", "to": "t1"}`), `stringParams: {"from": "db1.t1.c1", "to": "t1"} is invalid: invalid from table "db1.t1.c1"`)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	for _, tcase := range []struct {
+		params   string
+		database string
+		query    string
+		want     string
+	}{{
+		params:   `{"from": "db1.test_table", "to": "db2.test_table"}`,
+		database: "db1",
+		query:    "select test_table.pk, db1.test_table.name from test_table where pk = 1",
+		want:     "select test_table.pk, db2.test_table.`name` from db2.test_table where pk = 1",
+	}, {
+		// The queries of the other databases aren't redirected.
+		params:   `{"from": "db1.test_table", "to": "db2.test_table"}`,
+		database: "db3",
+		query:    "select pk from test_table where pk = 1",
+	}, {
+		// A renamed table keeps its name as its alias.
+		params:   `{"from": "test_table", "to": "db2.test_table_v2"}`,
+		database: "db1",
+		query:    "select db1.test_table.pk from db1.test_table join test_table as t on test_table.pk = t.pk",
+		want:     "select test_table.pk from db2.test_table_v2 as test_table join db2.test_table_v2 as t on test_table.pk = t.pk",
+	}, {
+		params:   `{"from": "test_table", "to": "test_table_v2"}`,
+		database: "db1",
+		query:    "update test_table set name = 'a' where pk in (select pk from db1.test_table)",
+		want:     "update test_table_v2 as test_table set `name` = 'a' where pk in (select pk from db1.test_table_v2 as test_table)",
+	}, {
+		params:   `{"from": "test_table", "to": "db2.test_table"}`,
+		database: "db1",
+		query:    "insert into test_table(pk, name) values (1, 'a')",
+		want:     "insert into db2.test_table(pk, `name`) values (1, 'a')",
+	}} {
+		t.Run(tcase.query, func(t *testing.T) {
+			assert.NoError(t, action.SetParams(tcase.params))
+			qre := newTestQueryExecutor(ctx, tsv, tcase.query, 0)
+			qre.database = tcase.database
+			_, err := action.BeforeExecution(qre)
+			assert.NoError(t, err)
+			want := tcase.want
+			if want == "" {
+				want = tcase.query
+			}
+			assert.Equal(t, want, qre.query)
+			assert.Equal(t, qre.query, qre.plan.Original)
+		})
+	}
+	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(nil, nil, nil))
+
+	// The tables can reference the captures of the rule, of its query and
+	// comments.
+	qr = rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRRedirect)
+	assert.NoError(t, qr.SetQueryCond(`select .* from test_table_(?P<suffix>\w+)`))
+	assert.NoError(t, qr.SetTrailingCommentCond(`.*db=(?P<db>\w*).*`))
+	qrs := rules.New()
+	qrs.Add(qr)
+	query := "select pk from test_table_2023"
+	filtered := qrs.FilterByPlan(query, planbuilder.PlanSelect, "db1.test_table_2023").Find("test_rule")
+	action = &RedirectAction{Rule: filtered, Action: rules.QRRedirect}
+	assert.NoError(t, action.SetParams(`{"from": "test_table_${suffix}", "to": "${db}.archive_${suffix}"}`))
+	qre := newTestQueryExecutor(ctx, tsv, query, 0)
+	qre.database = "db1"
+	qre.marginComments.Trailing = " /* db=db2 */"
+	_, err := action.BeforeExecution(qre)
+	assert.NoError(t, err)
+	assert.Equal(t, "select pk from db2.archive_2023 as test_table_2023", qre.query)
+	assert.Equal(t, "test_table_${suffix}", action.from)
+
+	qre = newTestQueryExecutor(ctx, tsv, query, 0)
+	qre.database = "db1"
+	qre.marginComments.Trailing = " /* db= */"
+	_, err = action.BeforeExecution(qre)
+	assert.EqualError(t, err, `rule test_rule expands its to table "${db}.archive_${suffix}" into the invalid table ".archive_2023"`)
+	assert.Equal(t, vtrpcpb.Code_INVALID_ARGUMENT, vterrors.Code(err))
+}
+
+func TestCacheResultAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRCacheResult)
+	action := &CacheResultAction{Rule: qr, Action: rules.QRCacheResult}
+	assert.EqualError(t, action.SetParams(`{"max_size": 1024}`), `stringParams: {"max_size": 1024} is invalid: invalid ttl ""`)
+	assert.EqualError(t, action.SetParams(`{"ttl": "-1s"}`), `stringParams: {"ttl": "-1s"} is invalid: invalid ttl "-1s"`)
+	assert.EqualError(t, action.SetParams(`{"ttl": "1s", "max_size": -1}`), `stringParams: {"ttl": "1s", "max_size": -1} is invalid: invalid max_size -1`)
+	assert.NoError(t, action.SetParams(`{"ttl": "1s"}`))
+	assert.Equal(t, time.Second, action.TTL)
+	assert.EqualValues(t, defaultResultCacheSize, action.MaxSize)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	query := "select * from test_table where pk = :pk"
+	run := func(params string, connID int64, pk int64, reply *sqltypes.Result) *sqltypes.Result {
+		action := &CacheResultAction{Rule: qr, Action: rules.QRCacheResult}
+		assert.NoError(t, action.SetParams(params))
+		qre := newTestQueryExecutor(ctx, tsv, query, connID)
+		qre.bindVars["pk"] = sqltypes.Int64BindVariable(pk)
+		cached, err := action.BeforeExecution(qre)
+		assert.NoError(t, err)
+		if cached == nil {
+			action.AfterExecution(qre, reply, nil)
+		}
+		return cached
+	}
+	result := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "pk", Type: sqltypes.Int64}},
+		Rows:   [][]sqltypes.Value{{sqltypes.NewInt64(1)}},
+	}
+	hits, misses := tsv.stats.ResultCacheHits.Counts()["test_rule"], tsv.stats.ResultCacheMisses.Counts()["test_rule"]
+	assert.Nil(t, run(`{"ttl": "1m"}`, 0, 1, result))
+	// The result is cached until it expires, for the same bind variables.
+	cached := run(`{"ttl": "1m"}`, 0, 1, nil)
+	assert.Equal(t, result, cached)
+	cached.Rows[0][0] = sqltypes.NewInt64(2)
+	assert.Equal(t, result, run(`{"ttl": "1m"}`, 0, 1, nil))
+	assert.Nil(t, run(`{"ttl": "1m"}`, 0, 2, nil))
+	assert.EqualValues(t, hits+2, tsv.stats.ResultCacheHits.Counts()["test_rule"])
+	assert.EqualValues(t, misses+2, tsv.stats.ResultCacheMisses.Counts()["test_rule"])
+
+	// The queries of the transactions aren't cached.
+	assert.Nil(t, run(`{"ttl": "1m"}`, 1, 3, result))
+	assert.Nil(t, run(`{"ttl": "1m"}`, 0, 3, result))
+
+	assert.Nil(t, run(`{"ttl": "1ms"}`, 0, 4, result))
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, run(`{"ttl": "1ms"}`, 0, 4, nil))
+}
+
+func TestRateLimitAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRRateLimit)
+	action := &RateLimitAction{Rule: qr, Action: rules.QRRateLimit}
+	assert.EqualError(t, action.SetParams(`{"burst": 1}`), `stringParams: {"burst": 1} is invalid: invalid qps 0`)
+	assert.EqualError(t, action.SetParams(`{"qps": 10, "burst": -1}`), `stringParams: {"qps": 10, "burst": -1} is invalid: invalid burst -1`)
+	assert.EqualError(t, action.SetParams(`{"qps": 10, "mode": "drop"}`), `stringParams: {"qps": 10, "mode": "drop"} is invalid: invalid mode "drop", expected reject or wait`)
+	assert.NoError(t, action.SetParams(`{"qps": 2.5}`))
+	assert.Equal(t, &RateLimitAction{Rule: qr, Action: rules.QRRateLimit, QPS: 2.5, Burst: 3}, action)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// The queries beyond the burst are rejected.
+	assert.NoError(t, action.SetParams(`{"qps": 1, "burst": 2}`))
+	rejections := tsv.stats.RateLimitRejections.Counts()["test_rule"]
+	qre := newTestQueryExecutor(ctx, tsv, "select * from t1 where a = :a and b = :b", 0)
+	for i := 0; i < 2; i++ {
+		_, err := action.BeforeExecution(qre)
+		assert.NoError(t, err)
+	}
+	_, err := action.BeforeExecution(qre)
+	assert.EqualError(t, err, "rule test_rule is over its rate of 1 queries per second")
+	assert.Equal(t, vtrpcpb.Code_RESOURCE_EXHAUSTED, vterrors.Code(err))
+	assert.EqualValues(t, rejections+1, tsv.stats.RateLimitRejections.Counts()["test_rule"])
+
+	// In the wait mode, the queries wait for a token, unless their deadline
+	// is too close.
+	assert.NoError(t, action.SetParams(`{"qps": 50, "burst": 1, "mode": "wait"}`))
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := action.BeforeExecution(qre)
+		assert.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	qre = newTestQueryExecutor(timeoutCtx, tsv, "select * from t1 where a = :a and b = :b", 0)
+	_, err = action.BeforeExecution(qre)
+	assert.ErrorContains(t, err, "rule test_rule is over its rate of 50 queries per second")
+	assert.EqualValues(t, rejections+2, tsv.stats.RateLimitRejections.Counts()["test_rule"])
+	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(qre, nil, nil))
+
+	// With a key, the queries of each key have a bucket of their own.
+	qr = rules.NewActiveQueryRule("ruleDescription", "tenant_rule", rules.QRRateLimit)
+	assert.NoError(t, qr.SetLeadingCommentCond(`.*tenant=(?P<tenant>\w+).*`))
+	action = &RateLimitAction{Rule: qr, Action: rules.QRRateLimit}
+	assert.NoError(t, action.SetParams(`{"qps": 1, "burst": 1, "key": "${tenant}"}`))
+	run := func(tenant string) error {
+		qre := newTestQueryExecutor(ctx, tsv, "select * from t1 where a = :a and b = :b", 0)
+		qre.marginComments.Leading = "/* tenant=" + tenant + " */ "
+		_, err := action.BeforeExecution(qre)
+		return err
+	}
+	assert.NoError(t, run("a"))
+	assert.NoError(t, run("b"))
+	assert.EqualError(t, run("a"), "rule tenant_rule is over its rate of 1 queries per second")
+	assert.EqualError(t, run("b"), "rule tenant_rule is over its rate of 1 queries per second")
+	assert.NoError(t, run("c"))
+
+	// The buckets of a rule are dropped once it is no longer loaded, the
+	// ones of the loaded rules are kept.
+	rulesName := "rateLimitRules"
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	qr.SetActionArgs(`{"qps": 1, "burst": 1, "key": "${tenant}"}`)
+	qrs := rules.New()
+	qrs.Add(qr)
+	require.NoError(t, tsv.SetQueryRules(rulesName, qrs))
+	assert.EqualError(t, run("a"), "rule tenant_rule is over its rate of 1 queries per second")
+	require.NoError(t, tsv.SetQueryRules(rulesName, rules.New()))
+	_, ok := tsv.qe.rateLimiters.limiters.Load("test_rule")
+	assert.False(t, ok)
+	assert.NoError(t, run("a"))
+}
+
+func TestAuditAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRAudit)
+	action := &AuditAction{Rule: qr, Action: rules.QRAudit}
+	assert.EqualError(t, action.SetParams(``), `stringParams:  is invalid: exactly one of file and url is expected`)
+	assert.EqualError(t, action.SetParams(`{"file": "a.log", "url": "http://audit"}`), `stringParams: {"file": "a.log", "url": "http://audit"} is invalid: exactly one of file and url is expected`)
+	assert.EqualError(t, action.SetParams(`{"url": "ftp://audit"}`), `stringParams: {"url": "ftp://audit"} is invalid: invalid url "ftp://audit"`)
+	assert.EqualError(t, action.SetParams(`{"file": "a.log", "queue_size": -1}`), `stringParams: {"file": "a.log", "queue_size": -1} is invalid: invalid queue_size -1`)
+	assert.NoError(t, action.SetParams(`{"file": "a.log"}`))
+	assert.Equal(t, defaultAuditQueueSize, action.QueueSize)
+
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(context.Background(), noFlags, db)
+	defer tsv.StopService()
+	ctx := callerid.NewContext(context.Background(), callerid.NewEffectiveCallerID("alice", "", ""), callerid.NewImmediateCallerID("app"))
+	audit := func(params string, reply *sqltypes.Result, err error) {
+		action := &AuditAction{Rule: qr, Action: rules.QRAudit}
+		require.NoError(t, action.SetParams(params))
+		qre := newTestQueryExecutor(ctx, tsv, "select * from test_table where pk in ::pks and name = :name", 0)
+		qre.bindVars["pks"] = sqltypes.TestBindVariable([]any{1, 2})
+		qre.bindVars["name"] = sqltypes.StringBindVariable("bob")
+		_, beforeErr := action.BeforeExecution(qre)
+		require.NoError(t, beforeErr)
+		resp := action.AfterExecution(qre, reply, err)
+		assert.Equal(t, &ActionExecutionResponse{Reply: reply, Err: err}, resp)
+	}
+
+	file := path.Join(t.TempDir(), "audit.log")
+	params := fmt.Sprintf(`{"file": %q}`, file)
+	audit(params, &sqltypes.Result{Rows: [][]sqltypes.Value{{sqltypes.NewInt64(1)}}}, nil)
+	audit(params, nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "bad query"))
+	// Closing the sinks flushes them.
+	tsv.qe.auditLogs.close()
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var records []*auditRecord
+	for _, line := range lines {
+		record := &auditRecord{}
+		require.NoError(t, json.Unmarshal([]byte(line), record))
+		assert.NotEmpty(t, record.Duration)
+		record.Time, record.Duration = time.Time{}, ""
+		records = append(records, record)
+	}
+	want := &auditRecord{
+		Rule:            "test_rule",
+		SQL:             "select * from test_table where pk in ::pks and name = :name",
+		BindVars:        map[string]any{"pks": []any{"1", "2"}, "name": "bob"},
+		EffectiveCaller: "alice",
+		ImmediateCaller: "app",
+	}
+	wantRows, wantErr := *want, *want
+	wantRows.RowsReturned = 1
+	wantErr.Error = "bad query"
+	assert.Equal(t, []*auditRecord{&wantRows, &wantErr}, records)
+
+	// The records are posted to the URLs, and dropped while the sink is
+	// behind.
+	posted := make(chan string, 10)
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		body, _ := io.ReadAll(r.Body)
+		posted <- string(body)
+	}))
+	defer server.Close()
+	dropped := tsv.stats.AuditRecordsDropped.Counts()["test_rule"]
+	params = fmt.Sprintf(`{"url": %q, "queue_size": 1}`, server.URL)
+	for i := 0; i < 3; i++ {
+		audit(params, nil, nil)
+	}
+	assert.Greater(t, tsv.stats.AuditRecordsDropped.Counts()["test_rule"], dropped)
+	close(unblock)
+	body := <-posted
+	assert.Contains(t, body, `"sql":"select * from test_table where pk in ::pks and name = :name"`)
+	assert.True(t, strings.HasSuffix(body, "}\n"))
+}
+
+func TestTimeoutOverrideAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRTimeoutOverride)
+	action := &TimeoutOverrideAction{Rule: qr, Action: rules.QRTimeoutOverride}
+	assert.EqualError(t, action.SetParams(`{"kill_on_timeout": false}`), `stringParams: {"kill_on_timeout": false} is invalid: invalid timeout ""`)
+	assert.EqualError(t, action.SetParams(`{"timeout": "-1s"}`), `stringParams: {"timeout": "-1s"} is invalid: invalid timeout "-1s"`)
+	assert.NoError(t, action.SetParams(`{"timeout": "1m"}`))
+	assert.Equal(t, time.Minute, action.Timeout)
+	assert.True(t, action.KillOnTimeout)
+
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(context.Background(), noFlags, db)
+	defer tsv.StopService()
+
+	type key struct{}
+	ctx, cancel := withTimeout(context.WithValue(context.Background(), key{}, "value"), 10*time.Millisecond, nil)
+	defer cancel()
+	for _, tcase := range []struct {
+		params string
+		done   bool
+	}{
+		// A longer timeout outlives the one of the tablet.
+		{params: `{"timeout": "1m"}`},
+		{params: `{"timeout": "0s", "kill_on_timeout": false}`},
+		{params: `{"timeout": "1ms"}`, done: true},
+	} {
+		t.Run(tcase.params, func(t *testing.T) {
+			action := &TimeoutOverrideAction{Rule: qr, Action: rules.QRTimeoutOverride}
+			require.NoError(t, action.SetParams(tcase.params))
+			qre := newTestQueryExecutor(ctx, tsv, "select * from test_table where pk = 1", 0)
+			_, err := action.BeforeExecution(qre)
+			require.NoError(t, err)
+			assert.Equal(t, "value", qre.ctx.Value(key{}))
+			time.Sleep(20 * time.Millisecond)
+			assert.Equal(t, tcase.done, qre.ctx.Err() != nil)
+			action.AfterExecution(qre, nil, nil)
+			assert.Error(t, qre.ctx.Err())
+		})
+	}
+}
+
+func TestSampleAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRSample)
+	action := &SampleAction{Rule: qr, Action: rules.QRSample}
+	assert.EqualError(t, action.SetParams(`{"file": "a.log"}`), `stringParams: {"file": "a.log"} is invalid: invalid percentage 0, expected (0, 100]`)
+	assert.EqualError(t, action.SetParams(`{"percentage": 1}`), `stringParams: {"percentage": 1} is invalid: the file is missing`)
+	assert.EqualError(t, action.SetParams(`{"percentage": 1, "file": "a.log", "max_backups": -1}`), `stringParams: {"percentage": 1, "file": "a.log", "max_backups": -1} is invalid: invalid max_backups -1`)
+	assert.NoError(t, action.SetParams(`{"percentage": 1, "file": "a.log"}`))
+	assert.EqualValues(t, defaultSampleFileSize, action.MaxSize)
+	assert.Equal(t, defaultSampleFileBackups, action.MaxBackups)
+	assert.NoError(t, action.SetParams(`{"percentage": 1, "file": "a.log", "max_backups": 0}`))
+	assert.Equal(t, 0, action.MaxBackups)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	file := path.Join(t.TempDir(), "samples.log")
+	sample := func(percentage float64) {
+		action := &SampleAction{Rule: qr, Action: rules.QRSample}
+		require.NoError(t, action.SetParams(fmt.Sprintf(`{"percentage": %v, "file": %q}`, percentage, file)))
+		qre := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table where pk = :pk", 0)
+		qre.database = "db1"
+		qre.bindVars["pk"] = sqltypes.Int64BindVariable(1)
+		_, err := action.BeforeExecution(qre)
+		require.NoError(t, err)
+		action.AfterExecution(qre, &sqltypes.Result{Rows: [][]sqltypes.Value{{sqltypes.NewInt64(1)}}}, nil)
+	}
+	for i := 0; i < 10; i++ {
+		sample(1e-9)
+	}
+	sample(100)
+	tsv.qe.auditLogs.close()
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	record := &sampleRecord{}
+	require.NoError(t, json.Unmarshal(data, record))
+	assert.NotEmpty(t, record.Duration)
+	record.Time, record.Duration = time.Time{}, ""
+	assert.Equal(t, &sampleRecord{
+		Rule:         "test_rule",
+		Database:     "db1",
+		SQL:          "select * from test_table where pk = :pk",
+		Plan:         "Select",
+		Tables:       []string{"db1.test_table"},
+		BindVars:     map[string]any{"pk": "1"},
+		RowsReturned: 1,
+	}, record)
+}
+
+func TestMirrorAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRMirror)
+	action := &MirrorAction{Rule: qr, Action: rules.QRMirror}
+	assert.EqualError(t, action.SetParams(`{"target": "mysql:3306"}`), `stringParams: {"target": "mysql:3306"} is invalid: invalid percentage 0, expected (0, 100]`)
+	assert.EqualError(t, action.SetParams(`{"percentage": 10}`), `stringParams: {"percentage": 10} is invalid: exactly one of target and socket is expected`)
+	assert.EqualError(t, action.SetParams(`{"percentage": 10, "target": "mysql"}`), `stringParams: {"percentage": 10, "target": "mysql"} is invalid: invalid target "mysql", expected host:port`)
+	assert.NoError(t, action.SetParams(`{"percentage": 10, "target": "mysql:3306", "user": "shadow"}`))
+	assert.Equal(t, mysql.ConnParams{Host: "mysql", Port: 3306, Uname: "shadow"}, action.Params)
+	assert.Equal(t, defaultMirrorConcurrency, action.Concurrency)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	shadow := fakesqldb.New(t)
+	defer shadow.Close()
+	shadow.AddQuery("use db2", &sqltypes.Result{})
+	mirrored := "select * from test_table where pk = 1"
+	shadow.AddQuery(mirrored, &sqltypes.Result{})
+	shadowParams, err := shadow.ConnParams().MysqlParams()
+	require.NoError(t, err)
+	params := fmt.Sprintf(`{"percentage": 100, "socket": %q, "user": %q, "password": %q, "database": "db2", "concurrency": 1}`, shadowParams.UnixSocket, shadowParams.Uname, shadowParams.Pass)
+
+	mirror := func(connID int64, pk int64, err error) {
+		action := &MirrorAction{Rule: qr, Action: rules.QRMirror}
+		require.NoError(t, action.SetParams(params))
+		qre := newTestQueryExecutor(ctx, tsv, "select * from test_table where pk = :pk", connID)
+		qre.database = "db1"
+		qre.bindVars["pk"] = sqltypes.Int64BindVariable(pk)
+		_, beforeErr := action.BeforeExecution(qre)
+		require.NoError(t, beforeErr)
+		action.AfterExecution(qre, &sqltypes.Result{}, err)
+	}
+	ok := tsv.stats.MirroredQueries.Counts()["test_rule.ok"]
+	mirror(0, 1, nil)
+	// The failed queries and the ones of the transactions aren't mirrored.
+	mirror(0, 1, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "bad query"))
+	mirror(1, 1, nil)
+	mirror(0, 1, nil)
+	assert.Eventually(t, func() bool {
+		return tsv.stats.MirroredQueries.Counts()["test_rule.ok"] == ok+2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, shadow.GetQueryCalledNum(mirrored))
+	assert.Equal(t, 1, shadow.GetQueryCalledNum("use db2"))
+
+	// The mirror of a rule is stopped, and its connections to the shadow
+	// server closed, once the rule changes its shadow server or is no longer
+	// loaded.
+	rulesName := "mirrorRules"
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	setRules := func(params string) {
+		qrs := rules.New()
+		if params != "" {
+			qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRMirror)
+			qr.SetActionArgs(params)
+			qrs.Add(qr)
+		}
+		require.NoError(t, tsv.SetQueryRules(rulesName, qrs))
+	}
+	setRules(params)
+	assert.Len(t, tsv.qe.mirrors.mirrors, 1)
+	setRules(strings.Replace(params, `"db2"`, `"db3"`, 1))
+	assert.Empty(t, tsv.qe.mirrors.mirrors)
+	assert.NoError(t, shadow.WaitForClose(5*time.Second))
+	mirror(0, 1, nil)
+	assert.Len(t, tsv.qe.mirrors.mirrors, 1)
+	setRules("")
+	assert.Empty(t, tsv.qe.mirrors.mirrors)
+	assert.NoError(t, shadow.WaitForClose(5*time.Second))
+}
+
+func TestDegradeAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRDegrade)
+	action := &DegradeAction{Rule: qr, Action: rules.QRDegrade}
+	assert.EqualError(t, action.SetParams(`{"fields": [{"name": "id", "type": "INTEGER"}]}`), `stringParams: {"fields": [{"name": "id", "type": "INTEGER"}]} is invalid: invalid type "INTEGER" of field id`)
+	assert.EqualError(t, action.SetParams(`{"fields": [{"name": "id"}], "rows": [["1", "2"]]}`), `stringParams: {"fields": [{"name": "id"}], "rows": [["1", "2"]]} is invalid: row 0 has 2 values, expected 1`)
+	assert.EqualError(t, action.SetParams(`{"fields": [{"name": "id", "type": "int64"}], "rows": [["a"]]}`), `stringParams: {"fields": [{"name": "id", "type": "int64"}], "rows": [["a"]]} is invalid: invalid value "a" of field id: strconv.ParseInt: parsing "a": invalid syntax`)
+
+	// The queries get an empty result by default.
+	assert.NoError(t, action.SetParams(``))
+	result, err := action.BeforeExecution(&QueryExecutor{})
+	assert.NoError(t, err)
+	utils.MustMatch(t, &sqltypes.Result{
+		Warnings: []*querypb.QueryWarning{{Code: mysql.ERUnknownError, Message: "the query was degraded by rule test_rule"}},
+	}, result)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	qr.AddTableCond("db1.test_table")
+	qr.SetActionArgs(`{"fields": [{"name": "pk", "type": "INT64"}, {"name": "name"}], "rows": [["1", "a"], ["2", null]], "warning": "degraded"}`)
+	qrs := rules.New()
+	qrs.Add(qr)
+	rulesName := "degradeRules"
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	qre := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table", 0)
+	result, err = qre.Execute()
+	require.NoError(t, err)
+	utils.MustMatch(t, &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "pk", Type: sqltypes.Int64}, {Name: "name", Type: sqltypes.VarChar}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.NewInt64(1), sqltypes.NewVarChar("a")},
+			{sqltypes.NewInt64(2), sqltypes.NULL},
+		},
+		Warnings: []*querypb.QueryWarning{{Code: mysql.ERUnknownError, Message: "degraded"}},
+	}, result)
+}
+
+func TestReadOnlyGuardAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRReadOnlyGuard)
+	action := &ReadOnlyGuardAction{Rule: qr, Action: rules.QRReadOnlyGuard}
+	assert.EqualError(t, action.SetParams(`{"statements": ["TRUNCATE"]}`), `stringParams: {"statements": ["TRUNCATE"]} is invalid: invalid statement "TRUNCATE", expected INSERT, REPLACE, UPDATE, DELETE or DDL`)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	for _, tcase := range []struct {
+		params string
+		query  string
+		err    string
+	}{
+		{query: "select * from test_table where pk = 1"},
+		{query: "insert into test_table(pk) values (1)", err: "INSERT is rejected: rule test_rule freezes the writes to db1.test_table"},
+		{query: "replace into test_table(pk) values (1)", err: "REPLACE is rejected: rule test_rule freezes the writes to db1.test_table"},
+		{query: "update test_table set name = 'a' where pk = 1", err: "UPDATE is rejected: rule test_rule freezes the writes to db1.test_table"},
+		{query: "delete from test_table where pk = 1", err: "DELETE is rejected: rule test_rule freezes the writes to db1.test_table"},
+		{query: "alter table test_table add column c int"},
+		{params: `{"statements": ["delete", "ddl"]}`, query: "update test_table set name = 'a' where pk = 1"},
+		{params: `{"statements": ["delete", "ddl"]}`, query: "alter table test_table add column c int", err: "DDL is rejected: rule test_rule freezes the writes to db1.test_table"},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			require.NoError(t, action.SetParams(tcase.params))
+			qre := newTestQueryExecutorByDbName(ctx, tsv, "db1", tcase.query, 0)
+			_, err := action.BeforeExecution(qre)
+			if tcase.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tcase.err)
+			assert.Equal(t, vtrpcpb.Code_PERMISSION_DENIED, vterrors.Code(err))
+		})
+	}
+}
+
+func TestWebhookNotifyAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("no full scans", "test_rule", rules.QRWebhookNotify)
+	action := &WebhookNotifyAction{Rule: qr, Action: rules.QRWebhookNotify}
+	assert.EqualError(t, action.SetParams(`{"qps": 1}`), `stringParams: {"qps": 1} is invalid: invalid url ""`)
+	assert.EqualError(t, action.SetParams(`{"url": "http://hook", "retries": -1}`), `stringParams: {"url": "http://hook", "retries": -1} is invalid: invalid retries -1`)
+	assert.NoError(t, action.SetParams(`{"url": "http://hook"}`))
+	assert.Equal(t, &WebhookNotifyAction{Rule: qr, Action: rules.QRWebhookNotify, URL: "http://hook", QPS: defaultWebhookQPS, Retries: defaultWebhookRetries}, action)
+
+	defer func(delay time.Duration) { webhookRetryDelay = delay }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// The webhook fails once, then gets the notification.
+	var attempts int
+	payloads := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		payloads <- body
+	}))
+	defer server.Close()
+
+	require.NoError(t, action.SetParams(fmt.Sprintf(`{"url": %q, "qps": 1}`, server.URL)))
+	callerCtx := callerid.NewContext(ctx, callerid.NewEffectiveCallerID("alice", "", ""), nil)
+	qre := newTestQueryExecutorByDbName(callerCtx, tsv, "db1", "select * from test_table where name = 'bob'", 0)
+	qre.database = "db1"
+	// The notifications beyond the rate are dropped.
+	for i := 0; i < 2; i++ {
+		result, err := action.BeforeExecution(qre)
+		assert.NoError(t, err)
+		assert.Nil(t, result)
+	}
+	payload := &webhookPayload{}
+	require.NoError(t, json.Unmarshal(<-payloads, payload))
+	assert.WithinDuration(t, time.Now(), payload.Time, time.Minute)
+	payload.Time = time.Time{}
+	assert.Equal(t, &webhookPayload{
+		Rule:        "test_rule",
+		Description: "no full scans",
+		QueryDigest: qre.plan.QueryTemplateID,
+		Query:       "select * from test_table where `name` = :name",
+		Database:    "db1",
+		User:        "alice",
+	}, payload)
+	assert.Eventually(t, func() bool {
+		return tsv.stats.WebhookNotifications.Counts()["test_rule.sent"] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 1, tsv.stats.WebhookNotifications.Counts()["test_rule.rate_limited"])
+	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(qre, nil, nil))
+}
+
+func TestQueryTagAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRQueryTag)
+	action := &QueryTagAction{Rule: qr, Action: rules.QRQueryTag}
+	assert.EqualError(t, action.SetParams(`{"tags": {"a b": "c"}}`), `stringParams: {"tags": {"a b": "c"}} is invalid: invalid tag "a b"`)
+	assert.EqualError(t, action.SetParams(`{"tags": {"rule": "c"}}`), `stringParams: {"tags": {"rule": "c"}} is invalid: tag rule is reserved`)
+	require.NoError(t, action.SetParams(`{"tags": {"team": "pay ments", "app": "*/ drop"}}`))
+	assert.Equal(t, []string{"app=%2A%2F+drop", "team=pay+ments"}, action.Tags)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	qr.AddTableCond("db1.test_table")
+	qr.SetActionArgs(`{"tags": {"team": "payments"}}`)
+	qrs := rules.New()
+	qrs.Add(qr)
+	rulesName := "queryTagRules"
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	tagged := "select * from test_table limit 100001 /* rule=test_rule caller=alice team=payments */"
+	db.AddQuery(tagged, &sqltypes.Result{})
+	callerCtx := callerid.NewContext(ctx, callerid.NewEffectiveCallerID("alice", "", ""), nil)
+	qre := newTestQueryExecutorByDbName(callerCtx, tsv, "db1", "select * from test_table", 0)
+	_, err := qre.Execute()
+	require.NoError(t, err)
+	assert.Equal(t, 1, db.GetQueryCalledNum(tagged))
+}
+
+func TestCircuitBreakerAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRCircuitBreaker)
+	action := &CircuitBreakerAction{Rule: qr, Action: rules.QRCircuitBreaker}
+	assert.EqualError(t, action.SetParams(`{"error_rate": 101}`), `stringParams: {"error_rate": 101} is invalid: invalid error_rate 101`)
+	assert.EqualError(t, action.SetParams(`{"cool_down": "soon"}`), `stringParams: {"cool_down": "soon"} is invalid: invalid cool_down "soon"`)
+	require.NoError(t, action.SetParams(""))
+	assert.Equal(t, circuitBreakerConfig{
+		ErrorRate:        defaultCircuitBreakerErrorRate,
+		MinRequests:      defaultCircuitBreakerMinRequests,
+		Window:           defaultCircuitBreakerWindow,
+		CoolDown:         defaultCircuitBreakerCoolDown,
+		HalfOpenRequests: 1,
+	}, action.Config)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	params := `{"error_rate": 25, "min_requests": 2, "latency": "1h"}`
+	run := func(err error) error {
+		action := &CircuitBreakerAction{Rule: qr, Action: rules.QRCircuitBreaker}
+		require.NoError(t, action.SetParams(params))
+		qre := newTestQueryExecutor(ctx, tsv, "select * from test_table", 0)
+		if _, beforeErr := action.BeforeExecution(qre); beforeErr != nil {
+			return action.AfterExecution(qre, nil, beforeErr).Err
+		}
+		return action.AfterExecution(qre, nil, err).Err
+	}
+	// The errors of the queries themselves don't open the circuit.
+	assert.Error(t, run(vterrors.Errorf(vtrpcpb.Code_ALREADY_EXISTS, "duplicate entry")))
+	assert.Error(t, run(vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "syntax error")))
+	assert.NoError(t, run(nil))
+	assert.Error(t, run(vterrors.Errorf(vtrpcpb.Code_UNAVAILABLE, "too many connections")))
+	assert.EqualValues(t, 1, tsv.stats.CircuitBreakerEvents.Counts()["test_rule.opened"])
+
+	err := run(nil)
+	assert.EqualError(t, err, "rule test_rule is open: too many of its queries failed recently")
+	assert.Equal(t, vtrpcpb.Code_RESOURCE_EXHAUSTED, vterrors.Code(err))
+	assert.EqualValues(t, 1, tsv.stats.CircuitBreakerEvents.Counts()["test_rule.rejected"])
+	// The rejections are not failures either.
+	assert.EqualValues(t, 1, tsv.stats.CircuitBreakerEvents.Counts()["test_rule.opened"])
+}
+
+func TestPriorityAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRPriority)
+	action := &PriorityAction{Rule: qr, Action: rules.QRPriority}
+	assert.EqualError(t, action.SetParams(`{"weight": 2}`), `stringParams: {"weight": 2} is invalid: the priority class is missing`)
+	assert.EqualError(t, action.SetParams(`{"class": "batch", "weight": -1}`), `stringParams: {"class": "batch", "weight": -1} is invalid: invalid weight -1`)
+	require.NoError(t, action.SetParams(`{"class": "batch"}`))
+	assert.Equal(t, &PriorityAction{Rule: qr, Action: rules.QRPriority, Class: "batch", Weight: 1}, action)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	tsv.qe.priorityScheduler = newPriorityScheduler(1)
+
+	// The query holds its slot until it's done.
+	qre := newTestQueryExecutor(ctx, tsv, "select * from test_table", 0)
+	result, err := action.BeforeExecution(qre)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	other := &PriorityAction{Rule: qr, Action: rules.QRPriority, Class: "batch", Weight: 1}
+	_, err = other.BeforeExecution(newTestQueryExecutor(timeoutCtx, tsv, "select * from test_table", 0))
+	assert.EqualError(t, err, "timed out waiting for an execution slot of priority class batch: context deadline exceeded")
+	assert.Equal(t, vtrpcpb.Code_RESOURCE_EXHAUSTED, vterrors.Code(err))
+	assert.EqualValues(t, 1, tsv.stats.PriorityQueuedQueries.Counts()["batch"])
+	// The query which never got a slot gives none back.
+	assert.Equal(t, err, other.AfterExecution(qre, nil, err).Err)
+	assert.Equal(t, 1, tsv.qe.priorityScheduler.used)
+
+	assert.Equal(t, &ActionExecutionResponse{}, action.AfterExecution(qre, nil, nil))
+	_, err = other.BeforeExecution(newTestQueryExecutor(ctx, tsv, "select * from test_table", 0))
+	assert.NoError(t, err)
+	other.AfterExecution(qre, nil, nil)
+	assert.Zero(t, tsv.qe.priorityScheduler.used)
+}
+
+func TestDataMaskingAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRDataMasking)
+	action := &DataMaskingAction{Rule: qr, Action: rules.QRDataMasking}
+	assert.EqualError(t, action.SetParams(`{}`), `stringParams: {} is invalid: the columns are missing`)
+	assert.EqualError(t, action.SetParams(`{"columns": [{"name": "phone", "mode": "blur"}]}`), `stringParams: {"columns": [{"name": "phone", "mode": "blur"}]} is invalid: invalid mode "blur" of column phone, expected redact, partial or hash`)
+	assert.EqualError(t, action.SetParams(`{"columns": [{"name": "phone", "mode": "partial", "keep_last": -1}]}`), `stringParams: {"columns": [{"name": "phone", "mode": "partial", "keep_last": -1}]} is invalid: invalid keep_last -1 of column phone`)
+	require.NoError(t, action.SetParams(`{"columns": [{"name": "phone", "mode": "partial"}, {"name": "email", "mode": "hash", "salt": "s"}, {"name": "ssn"}], "exempt_users": ["admin"]}`))
+
+	sum := sha256.Sum256([]byte("sa@b.c"))
+	hash := hex.EncodeToString(sum[:])
+	for _, tcase := range []struct {
+		mask  dataMask
+		value string
+		want  string
+	}{
+		{dataMask{Mode: dataMaskPartial}, "13812345678", "*******5678"},
+		{dataMask{Mode: dataMaskPartial}, "电话号码12", "**号码12"},
+		{dataMask{Mode: dataMaskPartial}, "123", "***"},
+		{dataMask{Mode: dataMaskPartial, KeepLast: new(int)}, "123", "***"},
+		{dataMask{Mode: dataMaskHash, Salt: "s"}, "a@b.c", hash},
+		{dataMask{Mode: dataMaskRedact}, "123-45-6789", dataMaskRedacted},
+	} {
+		assert.Equal(t, tcase.want, tcase.mask.mask(tcase.value), tcase.value)
+	}
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	fields := []*querypb.Field{
+		{Name: "id", OrgName: "id", OrgTable: "test_table", Type: sqltypes.Int64},
+		{Name: "p", OrgName: "phone", OrgTable: "test_table", Type: sqltypes.VarChar},
+		{Name: "SSN", OrgName: "ssn", OrgTable: "test_table", Type: sqltypes.Int64},
+	}
+	result := &sqltypes.Result{
+		Fields: fields,
+		Rows: [][]sqltypes.Value{
+			{sqltypes.NewInt64(1), sqltypes.NewVarChar("13812345678"), sqltypes.NewInt64(123456789)},
+			{sqltypes.NewInt64(2), sqltypes.NULL, sqltypes.NULL},
+		},
+	}
+	masked := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", OrgName: "id", OrgTable: "test_table", Type: sqltypes.Int64},
+			{Name: "p", OrgName: "phone", OrgTable: "test_table", Type: sqltypes.VarChar},
+			{Name: "SSN", OrgName: "ssn", OrgTable: "test_table", Type: sqltypes.VarChar},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.NewInt64(1), sqltypes.NewVarChar("*******5678"), sqltypes.NewVarChar(dataMaskRedacted)},
+			{sqltypes.NewInt64(2), sqltypes.NULL, sqltypes.NULL},
+		},
+	}
+	qre := newTestQueryExecutor(ctx, tsv, "select * from test_table", 0)
+	got, err := action.RewriteResult(qre, result)
+	require.NoError(t, err)
+	utils.MustMatch(t, masked, got)
+	// The result is not modified, since it may be shared.
+	assert.Equal(t, sqltypes.Int64, fields[2].Type)
+	assert.Equal(t, "13812345678", result.Rows[0][1].ToString())
+
+	// The next results of a stream only carry rows.
+	got, err = action.RewriteResult(qre, &sqltypes.Result{Rows: result.Rows[:1]})
+	require.NoError(t, err)
+	utils.MustMatch(t, &sqltypes.Result{Rows: masked.Rows[:1]}, got)
+
+	// The exempt users see the columns, the users being the ones the rules
+	// match.
+	adminCtx := callinfo.NewContext(ctx, &fakecallinfo.FakeCallInfo{User: "admin"})
+	got, err = action.RewriteResult(newTestQueryExecutor(adminCtx, tsv, "select * from test_table", 0), result)
+	require.NoError(t, err)
+	assert.Same(t, result, got)
+	immediateCtx := callerid.NewContext(ctx, nil, callerid.NewImmediateCallerID("admin"))
+	got, err = action.RewriteResult(newTestQueryExecutor(immediateCtx, tsv, "select * from test_table", 0), result)
+	require.NoError(t, err)
+	utils.MustMatch(t, masked, got)
+
+	// The fields derived from a masked column are redacted, and the query
+	// fails if they can't be told apart.
+	derived := []*querypb.Field{
+		{Name: "id", OrgName: "id", OrgTable: "test_table", Type: sqltypes.Int64},
+		{Name: "concat(phone)", Type: sqltypes.VarChar},
+		{Name: "n", Type: sqltypes.Int64},
+	}
+	derivedRows := [][]sqltypes.Value{{sqltypes.NewInt64(1), sqltypes.NewVarChar("13812345678"), sqltypes.NewInt64(3)}}
+	for _, tcase := range []struct {
+		query string
+		want  string
+		err   string
+	}{
+		{query: "select id, concat(phone), length(id) as n from test_table", want: dataMaskRedacted},
+		{query: "select id, lower(t.phone), count(*) as n from test_table as t", want: dataMaskRedacted},
+		{query: "select id, substr(phone, 1), n from test_table join test_table as t2", want: dataMaskRedacted},
+		{query: "select id, concat(name), count(*) as n from test_table", want: "13812345678"},
+		{query: "select id, x, n from (select id, phone as x, 1 as n from test_table) as d", err: "rule test_rule can't tell whether the field id of the result is derived from a masked column"},
+		{query: "select id, phone, 1 from test_table union select 1, 2, 3 from dual", err: "rule test_rule can't tell whether the field id of the result is derived from a masked column"},
+		{query: "with c as (select phone from test_table) select id, phone, 1 from c", err: "rule test_rule can't tell whether the field id of the result is derived from a masked column"},
+	} {
+		got, err := action.RewriteResult(newTestQueryExecutor(ctx, tsv, tcase.query, 0), &sqltypes.Result{Fields: derived, Rows: derivedRows})
+		if tcase.err != "" {
+			assert.EqualError(t, err, tcase.err, tcase.query)
+			assert.Equal(t, vtrpcpb.Code_FAILED_PRECONDITION, vterrors.Code(err))
+			continue
+		}
+		require.NoError(t, err, tcase.query)
+		assert.Equal(t, tcase.want, got.Rows[0][1].ToString(), tcase.query)
+		assert.Equal(t, "3", got.Rows[0][2].ToString(), tcase.query)
+	}
+	// A derived table renaming a masked column doesn't unmask it.
+	renamed := []*querypb.Field{{Name: "x", OrgName: "x", OrgTable: "d", Type: sqltypes.VarChar}}
+	_, err = action.RewriteResult(newTestQueryExecutor(ctx, tsv, "select x from (select phone as x from test_table) as d", 0), &sqltypes.Result{Fields: renamed})
+	assert.EqualError(t, err, "rule test_rule can't tell whether the field x of the result is derived from a masked column")
+
+	// The columns which can't be told fail the query.
+	fresh := &DataMaskingAction{Rule: qr, Action: rules.QRDataMasking, Columns: action.Columns}
+	_, err = fresh.RewriteResult(qre, &sqltypes.Result{Rows: result.Rows})
+	assert.EqualError(t, err, "rule test_rule can't mask a result without the names of its fields")
+	assert.Equal(t, vtrpcpb.Code_FAILED_PRECONDITION, vterrors.Code(err))
+
+	// The results are masked even when answered from the cache, and when
+	// streamed.
+	qr.SetActionArgs(`{"columns": [{"name": "phone", "mode": "partial"}, {"name": "ssn"}]}`)
+	cacheRule := rules.NewActiveQueryRule("ruleDescription", "cache_rule", rules.QRCacheResult)
+	cacheRule.SetActionArgs(`{"ttl": "1m"}`)
+	qrs := rules.New()
+	qrs.Add(qr)
+	qrs.Add(cacheRule)
+	rulesName := "dataMaskingRules"
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	query := "select id, phone as p, ssn from test_table"
+	db.AddQuery(query+" limit 100001", result)
+	for i := 0; i < 2; i++ {
+		got, err = newTestQueryExecutor(ctx, tsv, query, 0).Execute()
+		require.NoError(t, err)
+		utils.MustMatch(t, masked, got)
+	}
+	assert.EqualValues(t, 1, tsv.stats.ResultCacheHits.Counts()["cache_rule"])
+
+	db.AddQuery(query, result)
+	var streamed []*sqltypes.Result
+	err = newTestQueryExecutorStreaming(ctx, tsv, query, 0).Stream(func(result *sqltypes.Result) error {
+		streamed = append(streamed, result)
+		return nil
+	})
+	require.NoError(t, err)
+	var rows [][]sqltypes.Value
+	for _, result := range streamed {
+		rows = append(rows, result.Rows...)
+	}
+	utils.MustMatch(t, masked.Rows, rows)
+	assert.Equal(t, sqltypes.VarChar, streamed[0].Fields[2].Type)
+	// The client gets the fields it asked for.
+	assert.Empty(t, streamed[0].Fields[1].OrgName)
+}
+
+func TestSQLInjectionDetectAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRSQLInjectionDetect)
+	action := &SQLInjectionDetectAction{Rule: qr, Action: rules.QRSQLInjectionDetect}
+	assert.EqualError(t, action.SetParams(`{"mode": "enforce"}`), `stringParams: {"mode": "enforce"} is invalid: invalid mode "enforce", expected observe, warn or block`)
+	assert.EqualError(t, action.SetParams(`{"threshold": -1}`), `stringParams: {"threshold": -1} is invalid: invalid threshold -1`)
+	require.NoError(t, action.SetParams(""))
+	assert.Equal(t, &SQLInjectionDetectAction{Rule: qr, Action: rules.QRSQLInjectionDetect, Mode: sqlInjectionObserve, Threshold: defaultSQLInjectionThreshold}, action)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	const suspicious = "select * from test_table where name = 'x' or 1 = 1 -- '"
+	for _, tcase := range []struct {
+		params  string
+		query   string
+		err     string
+		warning string
+	}{
+		{params: `{"mode": "block"}`, query: "select * from test_table where name = 'x' or 1 = 1"},
+		{params: `{"mode": "observe"}`, query: suspicious},
+		{params: `{"mode": "warn"}`, query: suspicious, warning: "rule test_rule scored the query 60 for SQL injection: line_comment, tautology"},
+		{params: `{"mode": "block"}`, query: suspicious, err: "rule test_rule blocked the query, which looks like an SQL injection: line_comment, tautology"},
+		{params: `{"mode": "block", "threshold": 100}`, query: suspicious},
+	} {
+		t.Run(tcase.params, func(t *testing.T) {
+			action := &SQLInjectionDetectAction{Rule: qr, Action: rules.QRSQLInjectionDetect}
+			require.NoError(t, action.SetParams(tcase.params))
+			qre := newTestQueryExecutor(ctx, tsv, "select * from test_table", 0)
+			qre.query = tcase.query
+			result, err := action.BeforeExecution(qre)
+			assert.Nil(t, result)
+			if tcase.err != "" {
+				assert.EqualError(t, err, tcase.err)
+				assert.Equal(t, vtrpcpb.Code_PERMISSION_DENIED, vterrors.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			reply := &sqltypes.Result{}
+			resp := action.AfterExecution(qre, reply, nil)
+			if tcase.warning == "" {
+				assert.Same(t, reply, resp.Reply)
+				return
+			}
+			utils.MustMatch(t, &sqltypes.Result{
+				Warnings: []*querypb.QueryWarning{{Code: mysql.ERUnknownError, Message: tcase.warning}},
+			}, resp.Reply)
+			assert.Empty(t, reply.Warnings)
+		})
+	}
+	assert.EqualValues(t, 1, tsv.stats.SQLInjectionDetections.Counts()["test_rule.observe"])
+	assert.EqualValues(t, 1, tsv.stats.SQLInjectionDetections.Counts()["test_rule.warn"])
+	assert.EqualValues(t, 1, tsv.stats.SQLInjectionDetections.Counts()["test_rule.block"])
+}
+
+func TestAutoLimitAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRAutoLimit)
+	action := &AutoLimitAction{Rule: qr, Action: rules.QRAutoLimit}
+	assert.EqualError(t, action.SetParams(`{}`), `stringParams: {} is invalid: invalid max_rows 0`)
+	require.NoError(t, action.SetParams(`{"max_rows": 10}`))
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	for _, tcase := range []struct {
+		query    string
+		bindVars map[string]*querypb.BindVariable
+		want     string
+	}{
+		{query: "select * from test_table", want: "select * from test_table limit 10"},
+		{query: "select * from test_table limit 5, 100", want: "select * from test_table limit 5, 10"},
+		{query: "select * from test_table limit 10"},
+		{query: "select * from test_table limit :vtg1", bindVars: map[string]*querypb.BindVariable{"vtg1": sqltypes.Int64BindVariable(5)}},
+		{query: "select * from test_table limit :vtg1", bindVars: map[string]*querypb.BindVariable{"vtg1": sqltypes.Int64BindVariable(50)}, want: "select * from test_table limit 10"},
+		{query: "select pk from test_table union select pk from test_table", want: "select pk from test_table union select pk from test_table limit 10"},
+		{query: "select count(*) from test_table"},
+		{query: "select name, count(*) from test_table group by name", want: "select `name`, count(*) from test_table group by `name` limit 10"},
+		{query: "select 1 from dual"},
+		{query: "update test_table set name = 'a'"},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			action := &AutoLimitAction{Rule: qr, Action: rules.QRAutoLimit, MaxRows: 10}
+			qre := newTestQueryExecutor(ctx, tsv, tcase.query, 0)
+			if tcase.bindVars != nil {
+				qre.bindVars = tcase.bindVars
+			}
+			result, err := action.BeforeExecution(qre)
+			require.NoError(t, err)
+			assert.Nil(t, result)
+			reply := &sqltypes.Result{}
+			resp := action.AfterExecution(qre, reply, nil)
+			if tcase.want == "" {
+				assert.Equal(t, tcase.query, qre.query)
+				assert.Same(t, reply, resp.Reply)
+				return
+			}
+			assert.Equal(t, tcase.want, qre.query)
+			utils.MustMatch(t, &sqltypes.Result{
+				Warnings: []*querypb.QueryWarning{{Code: mysql.ERUnknownError, Message: "rule test_rule limited the query to 10 rows"}},
+			}, resp.Reply)
+		})
+	}
+
+	qr.AddTableCond("db1.test_table")
+	qr.SetActionArgs(`{"max_rows": 10}`)
+	qrs := rules.New()
+	qrs.Add(qr)
+	rulesName := "autoLimitRules"
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	db.AddQuery("select * from test_table limit 10", &sqltypes.Result{})
+	result, err := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table", 0).Execute()
+	require.NoError(t, err)
+	utils.MustMatch(t, &sqltypes.Result{
+		Warnings: []*querypb.QueryWarning{{Code: mysql.ERUnknownError, Message: "rule test_rule limited the query to 10 rows"}},
+	}, result)
+}
+
+func TestKillAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRKill)
+	action := &KillAction{Rule: qr, Action: rules.QRKill}
+	assert.EqualError(t, action.SetParams(`{}`), `stringParams: {} is invalid: invalid after ""`)
+	assert.EqualError(t, action.SetParams(`{"after": "0s"}`), `stringParams: {"after": "0s"} is invalid: invalid after "0s"`)
+	require.NoError(t, action.SetParams(`{"after": "10s", "kill_connection": true}`))
+	assert.Equal(t, 10*time.Second, action.After)
+	assert.True(t, action.KillConnection)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	qr.AddTableCond("db1.test_table")
+	qr.SetActionArgs(`{"after": "10ms", "kill_connection": true}`)
+	qrs := rules.New()
+	qrs.Add(qr)
+	rulesName := "killRules"
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	query := "select * from test_table limit 100001"
+	db.AddQuery(query, &sqltypes.Result{})
+	db.SetBeforeFunc(query, func() {
+		time.Sleep(200 * time.Millisecond)
+	})
+	db.AddQueryPattern(`kill \d+`, &sqltypes.Result{})
+
+	// The slow query of the rule is killed, with its connection.
+	_, err := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table", 0).Execute()
+	require.Error(t, err)
+	assert.Equal(t, vtrpcpb.Code_DEADLINE_EXCEEDED, vterrors.Code(err))
+	assert.Contains(t, err.Error(), "rule test_rule killed the query after 10ms")
+	assert.EqualValues(t, 1, tsv.stats.KilledQueries.Counts()["test_rule"])
+
+	// The queries of the rule running shorter than its deadline aren't.
+	qr.SetActionArgs(`{"after": "10s"}`)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+	tsv.qe.ClearQueryPlanCache()
+	_, err = newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table", 0).Execute()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, tsv.stats.KilledQueries.Counts()["test_rule"])
+
+	// The queries running when the rule is loaded are killed too.
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	qr.SetActionArgs(`{"after": "50ms", "kill_connection": true}`)
+	db.SetBeforeFunc(query, func() {
+		time.Sleep(200 * time.Millisecond)
+	})
+	running := make(chan error)
+	go func() {
+		_, err := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table", 0).Execute()
+		running <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return len(tsv.statelessql.matchedQueries()) != 0
+	}, time.Second, time.Millisecond)
+	require.NoError(t, tsv.SetQueryRules(rulesName, qrs))
+	err = <-running
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "due to rule test_rule")
+	assert.EqualValues(t, 2, tsv.stats.KilledQueries.Counts()["test_rule"])
+}
+
+func TestSetQueryRulesRejectsInvalidActionArgs(t *testing.T) {
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	rulesName := "invalidRules"
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+
+	valid := rules.NewActiveQueryRule("ruleDescription", "valid_rule", rules.QRFail)
+	qrs := rules.New()
+	qrs.Add(valid)
+	require.NoError(t, tsv.SetQueryRules(rulesName, qrs))
+
+	invalid := rules.NewActiveQueryRule("ruleDescription", "invalid_rule", rules.QRKill)
+	invalid.SetActionArgs(`{"after": "0s"}`)
+	qrs.Add(invalid)
+	err := tsv.SetQueryRules(rulesName, qrs)
+	assert.ErrorContains(t, err, `invalid action args of rule invalid_rule: stringParams: {"after": "0s"} is invalid: after must be > 0s, got "0s"`)
+
+	// The rules loaded before stay, compiled, and the rules passed in are
+	// left as they are.
+	loaded, err := tsv.qe.queryRuleSources.Get(rulesName)
+	require.NoError(t, err)
+	require.NotNil(t, loaded.Find("valid_rule"))
+	assert.Nil(t, loaded.Find("invalid_rule"))
+	assert.IsType(t, &FailAction{}, loaded.Find("valid_rule").CompiledAction())
+	assert.Nil(t, valid.CompiledAction())
+}
+
+func TestRetryWithBackoffAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRRetryWithBackoff)
+	action := &RetryWithBackoffAction{Rule: qr, Action: rules.QRRetryWithBackoff}
+	assert.EqualError(t, action.SetParams(`{"attempts": 0}`), `stringParams: {"attempts": 0} is invalid: invalid attempts 0`)
+	assert.EqualError(t, action.SetParams(`{"backoff": "1s", "max_backoff": "10ms"}`), `stringParams: {"backoff": "1s", "max_backoff": "10ms"} is invalid: invalid max_backoff "10ms"`)
+	assert.EqualError(t, action.SetParams(`{"errors": ["timeout"]}`), `stringParams: {"errors": ["timeout"]} is invalid: invalid error "timeout"`)
+	require.NoError(t, action.SetParams(""))
+	assert.Equal(t, 3, action.Attempts)
+	assert.Equal(t, 10*time.Millisecond, action.Backoff)
+	assert.Equal(t, time.Second, action.MaxBackoff)
+	assert.Equal(t, []string{"deadlock", "lock_wait_timeout", "connection"}, action.Errors)
+	require.NoError(t, action.SetParams(`{"attempts": 2, "backoff": "1ms", "errors": ["deadlock", "connection"]}`))
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	deadlock := mysql.NewSQLError(mysql.ERLockDeadlock, mysql.SSLockDeadlock, "Deadlock found when trying to get lock")
+	connectionLost := mysql.NewSQLError(mysql.CRServerLost, mysql.SSUnknownSQLState, "Lost connection to MySQL server during query")
+	lockWaitTimeout := mysql.NewSQLError(mysql.ERLockWaitTimeout, mysql.SSUnknownSQLState, "Lock wait timeout exceeded")
+	selectQuery := "select * from test_table limit 100001"
+	updateQuery := "update test_table set name = 'a' limit 100001"
+	db.AddQuery(selectQuery, &sqltypes.Result{})
+	db.AddQuery(updateQuery, &sqltypes.Result{RowsAffected: 1})
+
+	for _, tcase := range []struct {
+		name    string
+		query   string
+		err     error
+		retried bool
+	}{
+		{name: "deadlock", query: "select * from test_table", err: deadlock, retried: true},
+		{name: "connection error of a read", query: "select * from test_table", err: connectionLost, retried: true},
+		{name: "connection error of a write", query: "update test_table set name = 'a'", err: connectionLost},
+		{name: "error not retried by the rule", query: "select * from test_table", err: lockWaitTimeout},
+		{name: "error of an action", query: "select * from test_table", err: vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "rejected")},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			db.ResetQueryLog()
+			qre := newTestQueryExecutor(ctx, tsv, tcase.query, 0)
+			resp := action.AfterExecution(qre, nil, tcase.err)
+			if !tcase.retried {
+				assert.Equal(t, tcase.err, resp.Err)
+				assert.Empty(t, db.QueryLog())
+				return
+			}
+			assert.NoError(t, resp.Err)
+			assert.NotNil(t, resp.Reply)
+		})
+	}
+	assert.EqualValues(t, 1, tsv.stats.QueryRetries.Counts()["test_rule.deadlock"])
+	assert.EqualValues(t, 1, tsv.stats.QueryRetries.Counts()["test_rule.connection"])
+
+	// The error of the last attempt is returned.
+	db.AddRejectedQuery(selectQuery, deadlock)
+	calls := db.GetQueryCalledNum(selectQuery)
+	qre := newTestQueryExecutor(ctx, tsv, "select * from test_table", 0)
+	resp := action.AfterExecution(qre, nil, deadlock)
+	var sqlErr *mysql.SQLError
+	require.ErrorAs(t, resp.Err, &sqlErr)
+	assert.Equal(t, mysql.ERLockDeadlock, sqlErr.Number())
+	assert.Equal(t, calls+2, db.GetQueryCalledNum(selectQuery))
+	assert.EqualValues(t, 3, tsv.stats.QueryRetries.Counts()["test_rule.deadlock"])
+}
+
+func TestStopAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRStop)
+	action := &StopAction{Rule: qr, Action: rules.QRStop}
+	_, err := action.BeforeExecution(&QueryExecutor{})
+	assert.Equal(t, ErrSkipRemainingActions, err)
+	assert.NoError(t, action.SetParams(""))
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// The queries of the stop rule skip the fail rule of a lower priority,
+	// and the others still fail.
+	stop := rules.NewActiveQueryRule("ruleDescription", "stop_rule", rules.QRStop)
+	stop.AddTableCond("db1.test_table")
+	stop.AddBindVarCond("pk", false, false, rules.QREqual, int64(1))
+	stop.SetPriority(1)
+	fail := rules.NewActiveQueryRule("ruleDescription", "fail_rule", rules.QRFail)
+	fail.AddTableCond("db1.test_table")
+	fail.SetPriority(2)
+	qrs := rules.New()
+	qrs.Add(fail)
+	qrs.Add(stop)
+	rulesName := "stopRules"
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	db.AddQuery("select * from test_table where pk = 1 limit 100001", &sqltypes.Result{})
+	db.AddQuery("select * from test_table where pk = 2 limit 100001", &sqltypes.Result{})
+	qre := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table where pk = :pk", 0)
+	qre.bindVars = map[string]*querypb.BindVariable{"pk": sqltypes.Int64BindVariable(1)}
+	_, err = qre.Execute()
+	require.NoError(t, err)
+	qre = newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table where pk = :pk", 0)
+	qre.bindVars = map[string]*querypb.BindVariable{"pk": sqltypes.Int64BindVariable(2)}
+	_, err = qre.Execute()
+	assert.ErrorContains(t, err, "disallowed due to rule")
+}
+
+func TestDryRunAction(t *testing.T) {
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// A dry run fail rule records the queries it would fail, but lets them
+	// run.
+	qr := rules.NewActiveQueryRule("ruleDescription", "dry_run_fail_rule", rules.QRFail)
+	qr.AddTableCond("db1.test_table")
+	qr.SetStatus(rules.DryRun)
+	qrs := rules.New()
+	qrs.Add(qr)
+	rulesName := "dryRunRules"
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	want := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "pk", Type: sqltypes.Int64}},
+		Rows:   [][]sqltypes.Value{{sqltypes.NewInt64(1)}},
+	}
+	db.AddQuery("select * from test_table limit 100001", want)
+	qre := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table", 0)
+	got, err := qre.Execute()
+	require.NoError(t, err)
+	assert.Equal(t, want.Rows, got.Rows)
+	assert.EqualValues(t, 1, tsv.stats.DryRunQueries.Counts()["dry_run_fail_rule.fail"])
+
+	// The wrapped actions don't rewrite the results.
+	_, ok := ActionInterface(&dryRunAction{action: &DataMaskingAction{}}).(ResultRewriter)
+	assert.False(t, ok)
+
+	// The dry run of a concurrency control rule counts the queries in a queue
+	// of its own.
+	cclRule := rules.NewActiveQueryRule("ruleDescription", "dry_run_ccl_rule", rules.QRConcurrencyControl)
+	ccl := &ConcurrencyControlAction{Rule: cclRule, Action: rules.QRConcurrencyControl}
+	require.NoError(t, ccl.SetParams(`{"max_queue_size": 2, "max_concurrency": 1}`))
+	effect, _, done1 := ccl.DryRun(qre)
+	assert.Equal(t, dryRunNone, effect)
+	effect, _, done2 := ccl.DryRun(qre)
+	assert.Equal(t, dryRunQueue, effect)
+	effect, reason, done3 := ccl.DryRun(qre)
+	assert.Equal(t, dryRunFail, effect)
+	assert.Contains(t, reason, "too many queued")
+	done3()
+	done2()
+	done1()
+	effect, _, done1 = ccl.DryRun(qre)
+	assert.Equal(t, dryRunNone, effect)
+	done1()
+
+	// The rate limit of a dry run uses the limiter of the rule.
+	rateRule := rules.NewActiveQueryRule("ruleDescription", "dry_run_rate_rule", rules.QRRateLimit)
+	rate := &RateLimitAction{Rule: rateRule, Action: rules.QRRateLimit}
+	require.NoError(t, rate.SetParams(`{"qps": 0.001, "burst": 1}`))
+	effect, _, _ = rate.DryRun(qre)
+	assert.Equal(t, dryRunNone, effect)
+	effect, _, _ = rate.DryRun(qre)
+	assert.Equal(t, dryRunFail, effect)
+}
+
+func TestPostExecutionAction(t *testing.T) {
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// A fail rule with post execution conditions fails the queries which
+	// returned too many rows, once they ran.
+	qr := rules.NewActiveQueryRule("too many rows", "min_rows_rule", rules.QRFail)
+	qr.AddTableCond("db1.test_table")
+	require.NoError(t, qr.SetOutcomeConds(`{"min_rows": 2}`))
+	qrs := rules.New()
+	qrs.Add(qr)
+	rulesName := "postExecutionRules"
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	fields := []*querypb.Field{{Name: "pk", Type: sqltypes.Int64}}
+	one := &sqltypes.Result{Fields: fields, Rows: [][]sqltypes.Value{{sqltypes.NewInt64(1)}}}
+	db.AddQuery("select * from test_table where pk = 1 limit 100001", one)
+	qre := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table where pk = 1", 0)
+	got, err := qre.Execute()
+	require.NoError(t, err)
+	assert.True(t, one.Equal(got))
+	assert.Zero(t, tsv.stats.OutcomeMatches.Counts()["min_rows_rule"])
+
+	two := &sqltypes.Result{Fields: fields, Rows: [][]sqltypes.Value{{sqltypes.NewInt64(1)}, {sqltypes.NewInt64(2)}}}
+	db.AddQuery("select * from test_table where pk < 3 limit 100001", two)
+	qre = newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table where pk < 3", 0)
+	_, err = qre.Execute()
+	assert.EqualError(t, err, "disallowed due to rule: too many rows")
+	assert.EqualValues(t, 1, tsv.stats.OutcomeMatches.Counts()["min_rows_rule"])
+
+	// A circuit breaker counts the queries whose outcome matched as failures,
+	// but still rejects the queries before they run once it opened.
+	breakerRule := rules.NewActiveQueryRule("lock waits", "lock_wait_breaker", rules.QRCircuitBreaker)
+	require.NoError(t, breakerRule.SetOutcomeConds(`{"error_codes": [1205]}`))
+	newBreaker := func() ActionInterface {
+		action, err := CreateActionInstance(rules.QRCircuitBreaker, breakerRule)
+		require.NoError(t, err)
+		require.NoError(t, action.SetParams(`{"error_rate": 60, "min_requests": 2}`))
+		return &postExecutionAction{action: action, conds: breakerRule.OutcomeConds()}
+	}
+	run := func(queryErr error) error {
+		action := newBreaker()
+		if _, err := action.BeforeExecution(qre); err != nil {
+			return err
+		}
+		action.AfterExecution(qre, nil, queryErr)
+		return nil
+	}
+	// The errors the conditions don't match aren't failures, even the ones
+	// the breaker counts on its own.
+	require.NoError(t, run(vterrors.Errorf(vtrpcpb.Code_UNAVAILABLE, "unavailable")))
+	require.NoError(t, run(mysql.NewSQLError(mysql.ERLockWaitTimeout, mysql.SSUnknownSQLState, "Lock wait timeout exceeded")))
+	require.NoError(t, run(vterrors.Errorf(vtrpcpb.Code_DEADLINE_EXCEEDED, "Lock wait timeout exceeded; try restarting transaction (errno 1205) (sqlstate HY000)")))
+	assert.ErrorContains(t, run(nil), "rule lock_wait_breaker is open")
+	assert.EqualValues(t, 2, tsv.stats.OutcomeMatches.Counts()["lock_wait_breaker"])
 }
@@ -0,0 +1,85 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"fmt"
+	"time"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+// The effects an action of a DRY_RUN rule would have on a query.
+const (
+	// dryRunNone is no effect: the query would run as if the rule didn't
+	// match it.
+	dryRunNone = "none"
+	// dryRunFail is the query failing.
+	dryRunFail = "fail"
+	// dryRunQueue is the query waiting before it runs.
+	dryRunQueue = "queue"
+	// dryRunApply is the effect of the actions which aren't DryRunners: they
+	// always apply.
+	dryRunApply = "apply"
+)
+
+// dryRunQueuePrefix prefixes the keys of the concurrency control queues of the
+// dry runs.
+const dryRunQueuePrefix = "dry_run:"
+
+var dryRunLogger = logutil.NewThrottledLogger("DryRun", 10*time.Second)
+
+// dryRunAction runs an action of a DRY_RUN rule without affecting the queries:
+// it records what the action would do in the DryRunQueries stats and, but for
+// the queries it wouldn't affect, in the logs.
+type dryRunAction struct {
+	action ActionInterface
+
+	done func()
+}
+
+func (p *dryRunAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	rule := p.action.GetRule()
+	effect, reason := dryRunApply, ""
+	if dryRunner, ok := p.action.(DryRunner); ok {
+		effect, reason, p.done = dryRunner.DryRun(qre)
+	}
+	qre.tsv.stats.DryRunQueries.Add([]string{rule.Name, effect}, 1)
+	if effect == dryRunNone {
+		return nil, nil
+	}
+	what := fmt.Sprintf("would %s the query: %s", effect, reason)
+	if effect == dryRunApply {
+		what = fmt.Sprintf("would apply %s to the query", rule.GetActionType())
+	}
+	query, err := sqlparser.RedactSQLQuery(qre.query)
+	if err != nil {
+		query = qre.plan.QueryTemplateID
+	}
+	dryRunLogger.Infof("Dry run of rule %s %s: %s", rule.Name, what, query)
+	return nil, nil
+}
+
+func (p *dryRunAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	if p.done != nil {
+		p.done()
+	}
+	return &ActionExecutionResponse{
+		Reply: reply,
+		Err:   err,
+	}
+}
+
+func (p *dryRunAction) SetParams(stringParams string) error {
+	return p.action.SetParams(stringParams)
+}
+
+func (p *dryRunAction) GetRule() *rules.Rule {
+	return p.action.GetRule()
+}
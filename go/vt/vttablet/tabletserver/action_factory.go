@@ -2,69 +2,204 @@ package tabletserver
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
 
 	"vitess.io/vitess/go/vt/log"
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
 )
 
 // GetActionList runs the input against the rules engine and returns the action list to be performed.
+// If namespace is set, the rules qualified by another database than namespace are skipped.
+// The rules which match are resolved by the conflict policy of qrs. access
+// returns the access profile of the query, for the rules with access
+// conditions.
 func GetActionList(
 	qrs *rules.Rules,
 	ip,
-	user string,
+	user,
+	workloadClass,
+	namespace string,
+	inTransaction bool,
 	bindVars map[string]*querypb.BindVariable,
 	marginComments sqlparser.MarginComments,
+	access func() *rules.AccessProfile,
 ) (action []ActionInterface) {
-	var actionList = make([]ActionInterface, 0)
+	var matched []*rules.Rule
 	qrs.ForEachRule(func(qr *rules.Rule) {
 		if qr.Status == rules.InActive {
 			log.Errorf("rule %s is inactive", qr.Name)
 			return
 		}
-		act := qr.FilterByExecutionInfo(ip, user, bindVars, marginComments)
-		if act == rules.QRContinue {
-			return
+		if namespace != "" {
+			if ns := qr.Namespace(); ns != "" && ns != namespace {
+				return
+			}
+		}
+		if qr.MatchesExecutionInfo(ip, user, workloadClass, inTransaction, bindVars, marginComments) && qr.MatchesAccess(access) {
+			matched = append(matched, qr)
 		}
-		p, err := CreateActionInstance(act, qr)
+	})
+	// The actions are created in the pipeline order of their rules, see
+	// Rule.RunsBefore, whatever the order of the rules in their sources.
+	var actionList = make([]ActionInterface, 0)
+	for _, qr := range qrs.ConflictPolicy().Resolve(rules.SortForPipeline(matched)) {
+		p, err := CreateActionInstance(qr.Act(), qr)
 		if err != nil {
-			return
+			continue
+		}
+		if qr.Status == rules.DryRun {
+			p = &dryRunAction{action: p}
+		}
+		if conds := qr.OutcomeConds(); conds != nil {
+			p = &postExecutionAction{action: p, conds: conds}
 		}
 		actionList = append(actionList, p)
-	})
-	sortAction(actionList)
+	}
 	return actionList
 }
 
+// sortAction orders the actions of a query in the pipeline order of their
+// rules, see Rule.RunsBefore, whatever the order of the rules in their
+// sources.
 func sortAction(actionList []ActionInterface) {
 	sort.SliceStable(actionList, func(i, j int) bool {
-		return actionList[i].GetRule().Priority < actionList[j].GetRule().Priority
+		return actionList[i].GetRule().RunsBefore(actionList[j].GetRule())
 	})
 }
 
+// CreateActionInstance returns the action of a rule for a query it matches,
+// with its params. The rules loaded by SetQueryRules hold their action with
+// its params already parsed, which the query gets a copy of.
 func CreateActionInstance(action rules.Action, rule *rules.Rule) (ActionInterface, error) {
-	var actInst ActionInterface
+	if compiled, ok := rule.CompiledAction().(ActionInterface); ok && rule.Act() == action {
+		return copyAction(compiled, rule), nil
+	}
+	actInst := newActionInstance(action, rule)
+	if actInst == nil {
+		log.Errorf("unknown action: %v", action)
+		return nil, fmt.Errorf("unknown action: %v", action)
+	}
+	if err := setActionParams(actInst, action, rule); err != nil {
+		return nil, err
+	}
+	return actInst, nil
+}
+
+// compileRules builds the action of each rule of qrs, with its params
+// validated and parsed, and sets it on the rule. It fails on the first rule
+// whose params are invalid. The actions run outside of the pipeline, like
+// BUFFER, have nothing to build.
+func compileRules(qrs *rules.Rules) error {
 	var err error
+	qrs.ForEachRule(func(qr *rules.Rule) {
+		if err != nil || qr.Status == rules.InActive {
+			return
+		}
+		actInst := newActionInstance(qr.Act(), qr)
+		if actInst == nil {
+			return
+		}
+		if err = setActionParams(actInst, qr.Act(), qr); err != nil {
+			err = vterrors.Wrapf(err, "invalid action args of rule %s", qr.Name)
+			return
+		}
+		qr.SetCompiledAction(actInst)
+	})
+	return err
+}
+
+// copyAction returns a copy of the action built when its rule was loaded, for
+// rule, the copy of the rule which a query matched. The params of an action
+// are only read once they are set, its other fields are the state of a single
+// query, which a compiled action never runs.
+func copyAction(compiled ActionInterface, rule *rules.Rule) ActionInterface {
+	v := reflect.New(reflect.TypeOf(compiled).Elem())
+	v.Elem().Set(reflect.ValueOf(compiled).Elem())
+	v.Elem().FieldByName("Rule").Set(reflect.ValueOf(rule))
+	return v.Interface().(ActionInterface)
+}
+
+// setActionParams validates the args of rule, and sets them as the params of
+// its action.
+func setActionParams(actInst ActionInterface, action rules.Action, rule *rules.Rule) error {
+	// The schema of the action tells the mistakes in its params, like the
+	// unknown ones or the references to the captures the rule doesn't
+	// have, before the action parses them.
+	if err := rules.ValidateActionArgs(action, rule.GetActionArgs()); err != nil {
+		return err
+	}
+	if err := rule.ValidateCaptureRefs(); err != nil {
+		return err
+	}
+	return actInst.SetParams(rule.GetActionArgs())
+}
+
+// newActionInstance returns a new instance of an action, without its params,
+// nil if the action isn't run by the pipeline.
+func newActionInstance(action rules.Action, rule *rules.Rule) ActionInterface {
 	switch action {
 	case rules.QRContinue:
-		actInst, err = &ContinueAction{Rule: rule, Action: action}, nil
+		return &ContinueAction{Rule: rule, Action: action}
 	case rules.QRFail:
-		actInst, err = &FailAction{Rule: rule, Action: action}, nil
+		return &FailAction{Rule: rule, Action: action}
 	case rules.QRFailRetry:
-		actInst, err = &FailRetryAction{Rule: rule, Action: action}, nil
+		return &FailRetryAction{Rule: rule, Action: action}
 	case rules.QRConcurrencyControl:
-		actInst, err = &ConcurrencyControlAction{Rule: rule, Action: action}, nil
-	default:
-		log.Errorf("unknown action: %v", action)
-		actInst, err = nil, fmt.Errorf("unknown action: %v", action)
-	}
-
-	if actInst != nil {
-		err = actInst.SetParams(rule.GetActionArgs())
+		return &ConcurrencyControlAction{Rule: rule, Action: action}
+	case rules.QRResourceGroup:
+		return &ResourceGroupAction{Rule: rule, Action: action}
+	case rules.QRThrottle:
+		return &ThrottleAction{Rule: rule, Action: action}
+	case rules.QRSleep:
+		return &SleepAction{Rule: rule, Action: action}
+	case rules.QRRewrite:
+		return &RewriteAction{Rule: rule, Action: action}
+	case rules.QRRedirect:
+		return &RedirectAction{Rule: rule, Action: action}
+	case rules.QRCacheResult:
+		return &CacheResultAction{Rule: rule, Action: action}
+	case rules.QRRateLimit:
+		return &RateLimitAction{Rule: rule, Action: action}
+	case rules.QRAudit:
+		return &AuditAction{Rule: rule, Action: action}
+	case rules.QRTimeoutOverride:
+		return &TimeoutOverrideAction{Rule: rule, Action: action}
+	case rules.QRSample:
+		return &SampleAction{Rule: rule, Action: action}
+	case rules.QRMirror:
+		return &MirrorAction{Rule: rule, Action: action}
+	case rules.QRDegrade:
+		return &DegradeAction{Rule: rule, Action: action}
+	case rules.QRReadOnlyGuard:
+		return &ReadOnlyGuardAction{Rule: rule, Action: action}
+	case rules.QRWebhookNotify:
+		return &WebhookNotifyAction{Rule: rule, Action: action}
+	case rules.QRQueryTag:
+		return &QueryTagAction{Rule: rule, Action: action}
+	case rules.QRCircuitBreaker:
+		return &CircuitBreakerAction{Rule: rule, Action: action}
+	case rules.QRPriority:
+		return &PriorityAction{Rule: rule, Action: action}
+	case rules.QRDataMasking:
+		return &DataMaskingAction{Rule: rule, Action: action}
+	case rules.QRSQLInjectionDetect:
+		return &SQLInjectionDetectAction{Rule: rule, Action: action}
+	case rules.QRAutoLimit:
+		return &AutoLimitAction{Rule: rule, Action: action}
+	case rules.QRKill:
+		return &KillAction{Rule: rule, Action: action}
+	case rules.QRPlugin:
+		return &PluginAction{Rule: rule, Action: action}
+	case rules.QRRetryWithBackoff:
+		return &RetryWithBackoffAction{Rule: rule, Action: action}
+	case rules.QRStop:
+		return &StopAction{Rule: rule, Action: action}
 	}
-	return actInst, err
+	return nil
 }
 
 func CreateContinueAction() ActionInterface {
@@ -5,12 +5,13 @@ import (
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
 )
 
 func TestGetActionList_NoRules(t *testing.T) {
 	qrs := &rules.Rules{}
-	actionList := GetActionList(qrs, "", "", nil, sqlparser.MarginComments{})
+	actionList := GetActionList(qrs, "", "", "", "", false, nil, sqlparser.MarginComments{}, nil)
 	assert.NotNil(t, actionList)
 	assert.Equal(t, 0, len(actionList))
 }
@@ -19,7 +20,7 @@ func TestGetActionList_MatchingRule(t *testing.T) {
 	rule := rules.NewActiveQueryRule("test_rule", "test_rule", rules.QRFail)
 	qrs := rules.New()
 	qrs.Add(rule)
-	actionList := GetActionList(qrs, "", "", nil, sqlparser.MarginComments{})
+	actionList := GetActionList(qrs, "", "", "", "", false, nil, sqlparser.MarginComments{}, nil)
 	assert.Equal(t, 1, len(actionList))
 	assert.NotNil(t, actionList)
 	assert.IsType(t, &FailAction{}, actionList[0])
@@ -30,10 +31,53 @@ func TestGetActionList_NonMatchingRule(t *testing.T) {
 	rule.SetIPCond("1.1.1.1")
 	qrs := rules.New()
 	qrs.Add(rule)
-	actionList := GetActionList(qrs, "", "", nil, sqlparser.MarginComments{})
+	actionList := GetActionList(qrs, "", "", "", "", false, nil, sqlparser.MarginComments{}, nil)
 	assert.Equal(t, 0, len(actionList))
 }
 
+func TestGetActionList_Namespace(t *testing.T) {
+	qrs := rules.New()
+	qrs.Add(rules.NewActiveQueryRule("global", "global", rules.QRFail))
+	qrs.Add(rules.NewActiveQueryRule("tenant a", "tenant_a.rule", rules.QRFail))
+	qrs.Add(rules.NewActiveQueryRule("tenant b", "tenant_b.rule", rules.QRFail))
+	assert.Len(t, GetActionList(qrs, "", "", "", "", false, nil, sqlparser.MarginComments{}, nil), 3)
+	actionList := GetActionList(qrs, "", "", "", "tenant_a", false, nil, sqlparser.MarginComments{}, nil)
+	assert.Len(t, actionList, 2)
+	for _, action := range actionList {
+		assert.NotEqual(t, "tenant_b.rule", action.GetRule().Name)
+	}
+}
+
+func TestGetActionList_ConflictPolicy(t *testing.T) {
+	qrs := rules.New()
+	allow := rules.NewActiveQueryRule("allow", "allow", rules.QRContinue)
+	allow.SetPriority(10)
+	qrs.Add(allow)
+	dryRun := rules.NewActiveQueryRule("dry_run", "dry_run", rules.QRFail)
+	dryRun.SetPriority(20)
+	dryRun.SetStatus(rules.DryRun)
+	qrs.Add(dryRun)
+	deny := rules.NewActiveQueryRule("deny", "deny", rules.QRFail)
+	deny.SetPriority(30)
+	qrs.Add(deny)
+
+	names := func(actionList []ActionInterface) []string {
+		var names []string
+		for _, a := range actionList {
+			names = append(names, a.GetRule().Name)
+		}
+		return names
+	}
+	// The CONTINUE rules have actions too, which do nothing but count their
+	// matches.
+	assert.Equal(t, []string{"allow", "dry_run", "deny"}, names(GetActionList(qrs, "", "", "", "", false, nil, sqlparser.MarginComments{}, nil)))
+	qrs.SetConflictPolicy(rules.ConflictFirstMatch)
+	assert.Equal(t, []string{"allow"}, names(GetActionList(qrs, "", "", "", "", false, nil, sqlparser.MarginComments{}, nil)))
+	qrs.SetConflictPolicy(rules.ConflictStrictestWins)
+	allow.SetPriority(40)
+	assert.Equal(t, []string{"dry_run", "deny"}, names(GetActionList(qrs, "", "", "", "", false, nil, sqlparser.MarginComments{}, nil)))
+}
+
 func TestCreateActionInstance(t *testing.T) {
 
 	cclRule := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRConcurrencyControl)
@@ -106,6 +150,65 @@ func TestCreateActionInstance(t *testing.T) {
 	}
 }
 
+func TestCreateActionInstanceValidatesParams(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRConcurrencyControl)
+	qr.SetActionArgs(`{"max_queue_size": 10, "max_concurency": 2}`)
+	_, err := CreateActionInstance(rules.QRConcurrencyControl, qr)
+	assert.ErrorContains(t, err, "unknown param max_concurency, expected max_queue_size, max_concurrency")
+
+	// The actions still check what their schema doesn't tell.
+	qr.SetActionArgs(`{"max_queue_size": 10, "max_concurrency": 2, "lane_by": "user", "lanes": {"high": ["a"], "low": ["a"]}}`)
+	_, err = CreateActionInstance(rules.QRConcurrencyControl, qr)
+	assert.ErrorContains(t, err, `"a" is in both lanes`)
+
+	qr.SetActionArgs(`{"max_queue_size": 10, "max_concurrency": 2}`)
+	_, err = CreateActionInstance(rules.QRConcurrencyControl, qr)
+	assert.NoError(t, err)
+
+	// The params which take captures only reference the ones of the rule.
+	qr = rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRRedirect)
+	assert.NoError(t, qr.SetQueryCond(`select .* from orders_(?P<suffix>\d+).*`))
+	qr.SetActionArgs(`{"from": "orders_${suffix}", "to": "archive_${year}"}`)
+	_, err = CreateActionInstance(rules.QRRedirect, qr)
+	assert.ErrorContains(t, err, "the param to references ${year}, which isn't a named group of the query or comment regexps of the rule")
+	qr.SetActionArgs(`{"from": "orders_${suffix}", "to": "archive_${suffix}"}`)
+	_, err = CreateActionInstance(rules.QRRedirect, qr)
+	assert.NoError(t, err)
+}
+
+func TestCompileRules(t *testing.T) {
+	redirect := rules.NewActiveQueryRule("ruleDescription", "redirect_rule", rules.QRRedirect)
+	assert.NoError(t, redirect.SetQueryCond(`select .* from orders_(?P<suffix>\d+).*`))
+	redirect.SetActionArgs(`{"from": "orders_${suffix}", "to": "archive_${suffix}"}`)
+	buffer := rules.NewActiveQueryRule("ruleDescription", "buffer_rule", rules.QRBuffer)
+	qrs := rules.New()
+	qrs.Add(redirect)
+	qrs.Add(buffer)
+	assert.NoError(t, compileRules(qrs))
+	compiled, ok := redirect.CompiledAction().(*RedirectAction)
+	assert.True(t, ok)
+	assert.Nil(t, buffer.CompiledAction())
+
+	// The queries get a copy of the compiled action, with the copy of the
+	// rule they matched.
+	filtered := qrs.FilterByPlan("select * from orders_2024", planbuilder.PlanSelect)
+	matched := filtered.Find("redirect_rule")
+	action, err := CreateActionInstance(rules.QRRedirect, matched)
+	assert.NoError(t, err)
+	assert.NotSame(t, compiled, action)
+	assert.Same(t, matched, action.GetRule())
+	assert.Equal(t, compiled.From, action.(*RedirectAction).From)
+	assert.Equal(t, compiled.To, action.(*RedirectAction).To)
+
+	// Changing the args of a rule drops its compiled action.
+	redirect.SetActionArgs(`{"from": "orders_${suffix}", "to": "archive"}`)
+	assert.Nil(t, redirect.CompiledAction())
+
+	// The rules with invalid args are rejected.
+	redirect.SetActionArgs(`{"from": "orders_${suffix}", "to": "archive_${year}"}`)
+	assert.ErrorContains(t, compileRules(qrs), "invalid action args of rule redirect_rule: stringParams:")
+}
+
 func TestCreateContinueAction(t *testing.T) {
 	tests := []struct {
 		name string
@@ -142,4 +245,15 @@ func Test_sortAction(t *testing.T) {
 	assert.Equal(t, a3, actionList[0])
 	assert.Equal(t, a2, actionList[1])
 	assert.Equal(t, a1, actionList[2])
+
+	// The actions of the same priority are ordered by the names of their rules.
+	b1 := &FailAction{Rule: rules.NewActiveQueryRule("ruleDescription", "b_rule", rules.QRFail), Action: rules.QRFail}
+	b2 := &FailAction{Rule: rules.NewActiveQueryRule("ruleDescription", "a_rule", rules.QRFail), Action: rules.QRFail}
+	b3 := &FailAction{Rule: rules.NewActiveQueryRule("ruleDescription", "c_rule", rules.QRFail), Action: rules.QRFail}
+	b3.GetRule().SetPriority(1)
+
+	actionList = []ActionInterface{b1, b2, b3}
+	sortAction(actionList)
+
+	assert.Equal(t, []ActionInterface{b2, b1, b3}, actionList)
 }
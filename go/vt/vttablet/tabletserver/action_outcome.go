@@ -0,0 +1,108 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"errors"
+	"time"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+// OutcomeObserver is implemented by the actions which act on the queries
+// before they run, but judge them by their outcome, like CIRCUIT_BREAKER. With
+// post execution conditions, such an action runs in place, and its rule's
+// conditions replace its own judgment: ObserveOutcome tells it, before its
+// AfterExecution, whether the outcome of the query matched them.
+type OutcomeObserver interface {
+	ObserveOutcome(qre *QueryExecutor, matched bool)
+}
+
+// postExecutionAction defers an action of a rule with post execution
+// conditions until the query ran. If the outcome of the query matches them,
+// the BeforeExecution of the action runs in the AfterExecution, and an error
+// or a result it returns replaces the outcome of the query: a FAIL rule fails
+// the queries which returned too many rows. Then its AfterExecution runs, like
+// the AUDIT or the WEBHOOK_NOTIFY ones.
+//
+// The actions which change the queries before they run, like REWRITE or
+// CONCURRENCY_CONTROL, and the ones which rewrite the results, like
+// DATA_MASKING, have no effect there.
+type postExecutionAction struct {
+	action ActionInterface
+	conds  *rules.OutcomeConds
+
+	start time.Time
+}
+
+func (p *postExecutionAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	p.start = time.Now()
+	if _, ok := p.action.(OutcomeObserver); ok {
+		return p.action.BeforeExecution(qre)
+	}
+	return nil, nil
+}
+
+func (p *postExecutionAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	matched := p.conds.Matches(time.Since(p.start), outcomeRows(reply), outcomeErrorCode(err))
+	if matched {
+		qre.tsv.stats.OutcomeMatches.Add(p.action.GetRule().Name, 1)
+	}
+	if observer, ok := p.action.(OutcomeObserver); ok {
+		observer.ObserveOutcome(qre, matched)
+		return p.action.AfterExecution(qre, reply, err)
+	}
+	if !matched {
+		return &ActionExecutionResponse{
+			Reply: reply,
+			Err:   err,
+		}
+	}
+	qr, beforeErr := p.action.BeforeExecution(qre)
+	if beforeErr == ErrSkipRemainingActions {
+		qr, beforeErr = nil, nil
+	}
+	if qr != nil || beforeErr != nil {
+		reply, err = qr, beforeErr
+	}
+	return p.action.AfterExecution(qre, reply, err)
+}
+
+func (p *postExecutionAction) SetParams(stringParams string) error {
+	return p.action.SetParams(stringParams)
+}
+
+func (p *postExecutionAction) GetRule() *rules.Rule {
+	return p.action.GetRule()
+}
+
+// outcomeRows returns the number of rows a query returned or affected.
+func outcomeRows(reply *sqltypes.Result) uint64 {
+	if reply == nil {
+		return 0
+	}
+	rows := uint64(len(reply.Rows))
+	if reply.RowsAffected > rows {
+		rows = reply.RowsAffected
+	}
+	return rows
+}
+
+// outcomeErrorCode returns the MySQL error code a query failed with, or 0.
+func outcomeErrorCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var sqlErr *mysql.SQLError
+	if !errors.As(err, &sqlErr) {
+		if sqlErr, _ = mysql.NewSQLErrorFromError(err).(*mysql.SQLError); sqlErr == nil {
+			return 0
+		}
+	}
+	return sqlErr.Number()
+}
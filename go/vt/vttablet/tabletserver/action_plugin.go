@@ -0,0 +1,355 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/callinfo"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/adminapi"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// PluginAction calls the hooks of a WASM plugin at the hook points of the
+// queries of a rule: before_execution before the query runs, and
+// after_execution or on_error once it succeeded or failed, see
+// wasm.TabletHooks. Its params reference the plugin as name@version, or as
+// name for its current version, and can lower the limits of its calls, like
+//
+//	{"plugin": "tenant@1.2.0", "fuel": 100000, "timeout": "10ms", "on_limit": "continue"}
+//
+// The plugin is looked up when the query starts, so a plugin reloaded
+// meanwhile only applies to the next queries. A query whose SQL or bind
+// variables the plugin changed in before_execution runs with them: its plan
+// is built again, like for the REWRITE actions, and the rules aren't matched
+// against it again.
+//
+// The result hooks transform the results, the streamed ones included, see
+// RewriteResult and EndResult. They run in one instance of the plugin for the
+// whole query.
+type PluginAction struct {
+	Rule *rules.Rule
+
+	// Action is the action to take if the rule matches
+	Action rules.Action
+
+	Plugin string
+	// Limits lower the limits of the calls of the plugin.
+	Limits wasm.Limits
+	// OnLimit is what a query whose call hit a limit does, fail or continue,
+	// --wasm_plugin_on_limit if not set.
+	OnLimit string
+
+	// plugin is the plugin the query runs.
+	plugin wasm.Plugin
+	// stream holds the instance the result hooks of the query run in.
+	stream *wasm.Stream
+	// fields are the fields of the results the plugin sends, once known.
+	fields []*querypb.Field
+	// fieldsChanged is set if result_fields changed the fields.
+	fieldsChanged bool
+	// rowsAffected and insertID are the ones of the last result, for
+	// result_end.
+	rowsAffected, insertID uint64
+	// failed is set once a result hook failed the query.
+	failed bool
+}
+
+// load returns the plugin the query runs, looking it up the first time.
+func (p *PluginAction) load(qre *QueryExecutor) (wasm.Plugin, error) {
+	if p.plugin == nil {
+		plugin, ok := qre.tsv.qe.wasmPlugins.Get(p.Plugin)
+		if !ok {
+			return nil, vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "plugin %s of rule %s is not loaded", p.Plugin, p.Rule.Name)
+		}
+		p.plugin = plugin
+	}
+	return p.plugin, nil
+}
+
+func (p *PluginAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	plugin, err := p.load(qre)
+	if err != nil {
+		return nil, err
+	}
+	if !plugin.Implements(wasm.HookBeforeExecution) {
+		return nil, nil
+	}
+	call := p.call(qre, wasm.HookBeforeExecution)
+	resp, err := plugin.Call(qre.ctx, call)
+	if err != nil {
+		if p.skipOnLimit(qre, err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	switch resp.Decision {
+	case wasm.DecisionReject:
+		return nil, resp.Error.Err(plugin.Ref())
+	case wasm.DecisionReplace:
+		result, err := resp.Result.SQLResult()
+		if err != nil {
+			return nil, p.invalidResult(err)
+		}
+		return result, nil
+	}
+	qre.bindVars = call.BindVars
+	if call.Query != qre.query {
+		return nil, qre.replan(call.Query, p.Rule.Name)
+	}
+	return nil, nil
+}
+
+func (p *PluginAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	hook := wasm.HookAfterExecution
+	if err != nil {
+		hook = wasm.HookOnError
+	}
+	if p.plugin == nil || !p.plugin.Implements(hook) {
+		return &ActionExecutionResponse{Reply: reply, Err: err}
+	}
+	call := p.call(qre, hook)
+	call.Result, call.Err = reply, err
+	resp, callErr := p.plugin.Call(qre.ctx, call)
+	if callErr != nil {
+		if p.skipOnLimit(qre, callErr) {
+			return &ActionExecutionResponse{Reply: reply, Err: err}
+		}
+		return &ActionExecutionResponse{Err: callErr}
+	}
+	switch {
+	case resp.Decision == wasm.DecisionReject, resp.Decision == wasm.DecisionReplace && hook == wasm.HookOnError:
+		return &ActionExecutionResponse{Err: resp.Error.Err(p.plugin.Ref())}
+	case resp.Decision == wasm.DecisionReplace:
+		result, resultErr := resp.Result.SQLResult()
+		if resultErr != nil {
+			return &ActionExecutionResponse{Err: p.invalidResult(resultErr)}
+		}
+		return &ActionExecutionResponse{Reply: result}
+	}
+	return &ActionExecutionResponse{Reply: reply, Err: err}
+}
+
+// RewriteResult is part of the ResultRewriter interface. result_fields gets
+// the fields of the result, and returns the fields to send, and result_rows
+// gets each chunk of rows, and returns the rows to send, which must match
+// the fields sent. The result hooks fail the query when they hit a limit,
+// whatever on_limit, since the rows sent would not match the fields sent, or
+// be left unmasked.
+func (p *PluginAction) RewriteResult(qre *QueryExecutor, result *sqltypes.Result) (*sqltypes.Result, error) {
+	plugin, err := p.load(qre)
+	if err != nil {
+		return nil, err
+	}
+	p.rowsAffected, p.insertID = result.RowsAffected, result.InsertID
+	if result.Fields != nil {
+		p.fields, p.fieldsChanged = result.Fields, false
+		if plugin.Implements(wasm.HookResultFields) {
+			call := p.call(qre, wasm.HookResultFields)
+			call.Fields = result.Fields
+			resp, err := p.callResult(qre, call)
+			if err != nil {
+				return nil, err
+			}
+			if resp.Decision == wasm.DecisionReplace {
+				if p.fields, err = wasm.QueryFields(resp.Result.Fields); err != nil {
+					return nil, p.fail(p.invalidResult(err))
+				}
+				p.fieldsChanged = true
+			}
+		}
+	}
+	rows, rowsChanged := result.Rows, false
+	if len(rows) > 0 && plugin.Implements(wasm.HookResultRows) {
+		call := p.call(qre, wasm.HookResultRows)
+		call.Rows = rows
+		resp, err := p.callResult(qre, call)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Decision == wasm.DecisionReplace {
+			if err := wasm.TypeRows(resp.Rows, p.fields); err != nil {
+				return nil, p.fail(p.invalidResult(err))
+			}
+			rows, rowsChanged = resp.Rows, true
+		}
+	}
+	if !p.fieldsChanged && !rowsChanged {
+		return result, nil
+	}
+	if !rowsChanged {
+		for i, row := range rows {
+			if len(row) != len(p.fields) {
+				return nil, p.fail(p.invalidResult(fmt.Errorf("row %d has %d values for %d fields", i, len(row), len(p.fields))))
+			}
+		}
+	}
+	rewritten := result.ShallowCopy()
+	rewritten.StatusFlags = result.StatusFlags
+	if result.Fields != nil {
+		rewritten.Fields = p.fields
+	}
+	rewritten.Rows = rows
+	// The results which count their rows in their rows affected keep
+	// counting them.
+	if result.RowsAffected == uint64(len(result.Rows)) {
+		rewritten.RowsAffected = uint64(len(rows))
+	}
+	return rewritten, nil
+}
+
+// EndResult is part of the ResultEnder interface. result_end gets the rows
+// affected, the insert ID and the error of the query, and returns the rows to
+// append, or fails the query. It frees the instance the result hooks ran in.
+func (p *PluginAction) EndResult(qre *QueryExecutor, err error) (*sqltypes.Result, error) {
+	defer p.stream.Close()
+	if p.failed {
+		return nil, err
+	}
+	plugin, loadErr := p.load(qre)
+	if loadErr != nil {
+		if err == nil {
+			err = loadErr
+		}
+		return nil, err
+	}
+	if !plugin.Implements(wasm.HookResultEnd) {
+		return nil, err
+	}
+	call := p.call(qre, wasm.HookResultEnd)
+	call.Result, call.Err = &sqltypes.Result{RowsAffected: p.rowsAffected, InsertID: p.insertID}, err
+	resp, callErr := p.callResult(qre, call)
+	if callErr != nil {
+		return nil, callErr
+	}
+	if resp.Decision != wasm.DecisionReplace {
+		return nil, err
+	}
+	rows, rowsErr := resp.Result.SQLRows(p.fields)
+	if rowsErr != nil {
+		return nil, p.invalidResult(rowsErr)
+	}
+	return &sqltypes.Result{Rows: rows}, err
+}
+
+// callResult calls a result hook, in the instance of the stream of the query.
+// A call which fails, or rejects the query, fails it.
+func (p *PluginAction) callResult(qre *QueryExecutor, call *wasm.Call) (*wasm.Response, error) {
+	if p.stream == nil {
+		p.stream = &wasm.Stream{}
+	}
+	call.Stream = p.stream
+	resp, err := p.plugin.Call(qre.ctx, call)
+	if err != nil {
+		return nil, p.fail(err)
+	}
+	if resp.Decision == wasm.DecisionReject {
+		return nil, p.fail(resp.Error.Err(p.plugin.Ref()))
+	}
+	return resp, nil
+}
+
+// fail records that a result hook failed the query with err, so result_end
+// isn't called, and frees the instance they ran in.
+func (p *PluginAction) fail(err error) error {
+	p.failed = true
+	p.stream.Close()
+	return err
+}
+
+func (p *PluginAction) invalidResult(err error) error {
+	return vterrors.Errorf(vtrpcpb.Code_INTERNAL, "plugin %s returned an invalid result: %v", p.plugin.Ref(), err)
+}
+
+// call returns the call of a hook for a query.
+func (p *PluginAction) call(qre *QueryExecutor, hook wasm.Hook) *wasm.Call {
+	call := &wasm.Call{
+		Hook:          hook,
+		Rule:          p.Rule.Name,
+		Query:         qre.query,
+		BindVars:      qre.bindVars,
+		WorkloadClass: qre.workloadClass(),
+		Keyspace:      qre.tsv.sm.target.Keyspace,
+		Shard:         qre.tsv.sm.target.Shard,
+		TabletType:    topoproto.TabletTypeLString(qre.tsv.sm.target.TabletType),
+		Limits:        p.Limits,
+	}
+	if ci, ok := callinfo.FromContext(qre.ctx); ok {
+		call.User, call.IP = ci.Username(), ci.RemoteAddr()
+	}
+	if qre.plan != nil {
+		call.Plan, call.Tables = qre.plan.PlanID.String(), qre.plan.TableNames()
+	}
+	return call
+}
+
+// skipOnLimit returns whether the query skips the plugin whose call failed
+// with err, because it hit a limit and the rule continues on limit.
+func (p *PluginAction) skipOnLimit(qre *QueryExecutor, err error) bool {
+	var limitErr *wasm.LimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	onLimit := p.OnLimit
+	if onLimit == "" {
+		onLimit = qre.tsv.config.WasmPlugins.OnLimit
+	}
+	return onLimit == "continue"
+}
+
+func (p *PluginAction) SetParams(stringParams string) error {
+	c := &struct {
+		Plugin         string `json:"plugin"`
+		Fuel           int64  `json:"fuel"`
+		MaxMemoryPages int64  `json:"max_memory_pages"`
+		Timeout        string `json:"timeout"`
+		OnLimit        string `json:"on_limit"`
+	}{}
+	if stringParams != "" {
+		if err := json.Unmarshal([]byte(stringParams), c); err != nil {
+			return err
+		}
+	}
+	if _, _, err := adminapi.ParsePluginReference(c.Plugin); err != nil {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: %v", stringParams, err)
+	}
+	if c.Fuel < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: fuel must be >= 0", stringParams)
+	}
+	if c.MaxMemoryPages < 0 || c.MaxMemoryPages > 65536 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: max_memory_pages must be in [0, 65536]", stringParams)
+	}
+	var timeout time.Duration
+	if c.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(c.Timeout); err != nil || timeout < 0 {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: invalid timeout %q", stringParams, c.Timeout)
+		}
+	}
+	switch c.OnLimit {
+	case "", "fail", "continue":
+	default:
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: on_limit must be fail or continue", stringParams)
+	}
+	p.Plugin = c.Plugin
+	p.Limits = wasm.Limits{Fuel: c.Fuel, MemoryPages: uint32(c.MaxMemoryPages), Timeout: timeout}
+	p.OnLimit = c.OnLimit
+	return nil
+}
+
+func (p *PluginAction) GetRule() *rules.Rule {
+	return p.Rule
+}
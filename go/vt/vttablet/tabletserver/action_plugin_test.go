@@ -0,0 +1,418 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/callinfo"
+	"vitess.io/vitess/go/vt/callinfo/fakecallinfo"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm/wasmtest"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// fakePlugin answers the calls of its hooks with the responses of hooks, and
+// records them.
+type fakePlugin struct {
+	ref   string
+	hooks map[wasm.Hook]*wasm.Response
+	calls []*wasm.Call
+}
+
+func (p *fakePlugin) Ref() string {
+	return p.ref
+}
+
+func (p *fakePlugin) Implements(hook wasm.Hook) bool {
+	_, ok := p.hooks[hook]
+	return ok
+}
+
+func (p *fakePlugin) Call(_ context.Context, call *wasm.Call) (*wasm.Response, error) {
+	p.calls = append(p.calls, call)
+	return p.hooks[call.Hook], nil
+}
+
+func TestPluginAction(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRPlugin)
+	action := &PluginAction{Rule: qr, Action: rules.QRPlugin}
+	assert.EqualError(t, action.SetParams(`{}`), `stringParams: {} is invalid: invalid plugin name "": must be letters, digits, _ and -`)
+	assert.EqualError(t, action.SetParams(`{"plugin": "tenant@"}`), `stringParams: {"plugin": "tenant@"} is invalid: invalid plugin version "": must be letters, digits, _, -, + and .`)
+	require.NoError(t, action.SetParams(`{"plugin": "tenant@1.0"}`))
+	assert.Equal(t, "tenant@1.0", action.Plugin)
+
+	ctx := callinfo.NewContext(context.Background(), &fakecallinfo.FakeCallInfo{Remote: "10.0.0.1", User: "app"})
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	run := func(plugin *fakePlugin, reply *sqltypes.Result, err error) (*sqltypes.Result, error, *ActionExecutionResponse) {
+		tsv.qe.wasmPlugins.Set(map[string]wasm.Plugin{"tenant@1.0": plugin})
+		action := &PluginAction{Rule: qr, Action: rules.QRPlugin, Plugin: "tenant@1.0"}
+		qre := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table where pk = :pk", 0)
+		qre.bindVars["pk"] = sqltypes.Int64BindVariable(1)
+		result, beforeErr := action.BeforeExecution(qre)
+		if result != nil || beforeErr != nil {
+			return result, beforeErr, nil
+		}
+		return nil, nil, action.AfterExecution(qre, reply, err)
+	}
+
+	// The plugin sees the query, and lets it run.
+	plugin := &fakePlugin{ref: "tenant@1.0", hooks: map[wasm.Hook]*wasm.Response{
+		wasm.HookBeforeExecution: {Decision: wasm.DecisionContinue},
+		wasm.HookAfterExecution:  {Decision: wasm.DecisionContinue},
+	}}
+	reply := &sqltypes.Result{RowsAffected: 1}
+	_, _, resp := run(plugin, reply, nil)
+	assert.Same(t, reply, resp.Reply)
+	require.Len(t, plugin.calls, 2)
+	call := plugin.calls[0]
+	assert.Equal(t, wasm.HookBeforeExecution, call.Hook)
+	assert.Equal(t, "test_rule", call.Rule)
+	assert.Equal(t, "select * from test_table where pk = :pk", call.Query)
+	assert.Equal(t, sqltypes.Int64BindVariable(1), call.BindVars["pk"])
+	assert.Equal(t, "app", call.User)
+	assert.Equal(t, "10.0.0.1", call.IP)
+	assert.Equal(t, "Select", call.Plan)
+	assert.Equal(t, []string{"db1.test_table"}, call.Tables)
+	assert.Equal(t, wasm.HookAfterExecution, plugin.calls[1].Hook)
+	assert.Same(t, reply, plugin.calls[1].Result)
+
+	// The plugin rejects the query.
+	plugin = &fakePlugin{ref: "tenant@1.0", hooks: map[wasm.Hook]*wasm.Response{
+		wasm.HookBeforeExecution: {Decision: wasm.DecisionReject, Error: &wasm.Error{Code: "PERMISSION_DENIED", Message: "no tenant"}},
+	}}
+	_, err, _ := run(plugin, nil, nil)
+	assert.EqualError(t, err, "no tenant (plugin tenant@1.0)")
+	assert.Equal(t, vtrpcpb.Code_PERMISSION_DENIED, vterrors.Code(err))
+
+	// The plugin answers the query.
+	one := "1"
+	plugin = &fakePlugin{ref: "tenant@1.0", hooks: map[wasm.Hook]*wasm.Response{
+		wasm.HookBeforeExecution: {Decision: wasm.DecisionReplace, Result: &wasm.Result{Fields: []wasm.Field{{Name: "pk", Type: "INT64"}}, Rows: [][]*string{{&one}}}},
+	}}
+	result, err, _ := run(plugin, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, sqltypes.MakeTestResult(sqltypes.MakeTestFields("pk", "int64"), "1").Rows, result.Rows)
+
+	// The plugin replaces the result, and the error.
+	plugin = &fakePlugin{ref: "tenant@1.0", hooks: map[wasm.Hook]*wasm.Response{
+		wasm.HookAfterExecution: {Decision: wasm.DecisionReplace, Result: &wasm.Result{Fields: []wasm.Field{{Name: "pk", Type: "INT64"}}}},
+		wasm.HookOnError:        {Decision: wasm.DecisionReplace, Error: &wasm.Error{Message: "failed"}},
+	}}
+	_, _, resp = run(plugin, reply, nil)
+	require.NoError(t, resp.Err)
+	assert.Equal(t, "pk", resp.Reply.Fields[0].Name)
+	_, _, resp = run(plugin, nil, vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "table test_table not found"))
+	assert.EqualError(t, resp.Err, "failed (plugin tenant@1.0)")
+	assert.Nil(t, resp.Reply)
+	assert.Equal(t, wasm.HookOnError, plugin.calls[1].Hook)
+	assert.EqualError(t, plugin.calls[1].Err, "table test_table not found")
+
+	// The queries of a plugin which isn't loaded fail.
+	tsv.qe.wasmPlugins.Set(nil)
+	action = &PluginAction{Rule: qr, Action: rules.QRPlugin, Plugin: "tenant@1.0"}
+	_, err = action.BeforeExecution(newTestQueryExecutor(ctx, tsv, "select * from test_table", 0))
+	assert.EqualError(t, err, "plugin tenant@1.0 of rule test_rule is not loaded")
+	assert.Equal(t, vtrpcpb.Code_FAILED_PRECONDITION, vterrors.Code(err))
+
+	// The hooks are called by the queries of the rule.
+	plugin = &fakePlugin{ref: "tenant@1.0", hooks: map[wasm.Hook]*wasm.Response{
+		wasm.HookBeforeExecution: {Decision: wasm.DecisionReject, Error: &wasm.Error{Message: "no tenant"}},
+	}}
+	tsv.qe.wasmPlugins.Set(map[string]wasm.Plugin{"tenant": plugin})
+	qr.AddTableCond("db1.test_table")
+	qr.SetActionArgs(`{"plugin": "tenant"}`)
+	qrs := rules.New()
+	qrs.Add(qr)
+	rulesName := "pluginRules"
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.SetQueryRules(rulesName, qrs))
+	_, err = newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table", 0).Execute()
+	assert.EqualError(t, err, "no tenant (plugin tenant@1.0)")
+	require.Len(t, plugin.calls, 1)
+}
+
+func TestPluginActionLimits(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRPlugin)
+	action := &PluginAction{Rule: qr, Action: rules.QRPlugin}
+	require.NoError(t, action.SetParams(`{"plugin": "spin@1", "fuel": 1000, "max_memory_pages": 16, "timeout": "1s", "on_limit": "continue"}`))
+	assert.Equal(t, wasm.Limits{Fuel: 1000, MemoryPages: 16, Timeout: time.Second}, action.Limits)
+	assert.Equal(t, "continue", action.OnLimit)
+	assert.EqualError(t, action.SetParams(`{"plugin": "spin@1", "timeout": "soon"}`), `stringParams: {"plugin": "spin@1", "timeout": "soon"} is invalid: invalid timeout "soon"`)
+	assert.EqualError(t, action.SetParams(`{"plugin": "spin@1", "on_limit": "retry"}`), `stringParams: {"plugin": "spin@1", "on_limit": "retry"} is invalid: on_limit must be fail or continue`)
+
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// before_execution never returns.
+	plugin := wasmtest.NewPlugin()
+	plugin.Hook(string(wasm.HookBeforeExecution), wasmtest.Loop(wasmtest.Br(0)), wasmtest.I64Const(0))
+	module, err := tsv.qe.wasmRuntime.Compile(ctx, "spin@1", plugin.Build())
+	require.NoError(t, err)
+	tsv.qe.wasmPlugins.Set(map[string]wasm.Plugin{"spin@1": module})
+
+	// The queries whose call hit a limit fail, or skip the plugin.
+	for _, tcase := range []struct {
+		params  string
+		onLimit string
+		err     string
+	}{{
+		params: `{"plugin": "spin@1", "fuel": 1000}`,
+		err:    "wasm plugin spin@1 exceeded its fuel limit in before_execution",
+	}, {
+		params: `{"plugin": "spin@1", "fuel": 1000, "on_limit": "continue"}`,
+	}, {
+		params:  `{"plugin": "spin@1", "fuel": 1000}`,
+		onLimit: "continue",
+	}, {
+		params:  `{"plugin": "spin@1", "fuel": 1000, "on_limit": "fail"}`,
+		onLimit: "continue",
+		err:     "wasm plugin spin@1 exceeded its fuel limit in before_execution",
+	}} {
+		tsv.config.WasmPlugins.OnLimit = tcase.onLimit
+		action := &PluginAction{Rule: qr, Action: rules.QRPlugin}
+		require.NoError(t, action.SetParams(tcase.params))
+		result, err := action.BeforeExecution(newTestQueryExecutor(ctx, tsv, "select * from test_table", 0))
+		assert.Nil(t, result, tcase.params)
+		if tcase.err == "" {
+			assert.NoError(t, err, tcase.params)
+			continue
+		}
+		assert.EqualError(t, err, tcase.err, tcase.params)
+		assert.Equal(t, vtrpcpb.Code_RESOURCE_EXHAUSTED, vterrors.Code(err))
+	}
+}
+
+func TestPluginActionRewrite(t *testing.T) {
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// rewrite returns a plugin whose before_execution sets the query and a
+	// bind variable.
+	rewrite := func(ref, query string) wasm.Plugin {
+		plugin := wasmtest.New()
+		setQuery := plugin.Import(wasm.HostModule, "set_query", []wasmtest.ValType{wasmtest.I32, wasmtest.I32}, []wasmtest.ValType{wasmtest.I32})
+		setBindVar := plugin.Import(wasm.HostModule, "set_bind_var", []wasmtest.ValType{wasmtest.I32, wasmtest.I32, wasmtest.I32, wasmtest.I32}, []wasmtest.ValType{wasmtest.I32})
+		plugin.Plugin()
+		str := func(s string) []byte {
+			return append(wasmtest.I32Const(int32(plugin.Data([]byte(s)))), wasmtest.I32Const(int32(len(s)))...)
+		}
+		plugin.Hook(string(wasm.HookBeforeExecution),
+			str(query), wasmtest.Call(setQuery), wasmtest.Drop,
+			str("tenant"), str(`{"type": "VARCHAR", "value": "t1"}`), wasmtest.Call(setBindVar), wasmtest.Drop,
+			wasmtest.Packed(plugin.Data([]byte(`{"action": "continue"}`)), 22))
+		module, err := tsv.qe.wasmRuntime.Compile(ctx, ref, plugin.Build())
+		require.NoError(t, err)
+		return module
+	}
+	tsv.qe.wasmPlugins.Set(map[string]wasm.Plugin{
+		"rewrite@1": rewrite("rewrite@1", "select name from test_table"),
+		"delete@1":  rewrite("delete@1", "delete from test_table"),
+	})
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRPlugin)
+
+	// The query runs with the SQL and the bind variables the plugin set, and
+	// the plan of its SQL.
+	action := &PluginAction{Rule: qr, Action: rules.QRPlugin}
+	require.NoError(t, action.SetParams(`{"plugin": "rewrite@1"}`))
+	qre := newTestQueryExecutor(ctx, tsv, "select * from test_table", 0)
+	_, err := action.BeforeExecution(qre)
+	require.NoError(t, err)
+	assert.Equal(t, "select name from test_table", qre.query)
+	assert.Equal(t, "select `name` from test_table limit :#maxLimit", qre.plan.FullQuery.Query)
+	assert.Equal(t, sqltypes.StringBindVariable("t1"), qre.bindVars["tenant"])
+
+	// The plugin can't change the type of the statement.
+	action = &PluginAction{Rule: qr, Action: rules.QRPlugin}
+	require.NoError(t, action.SetParams(`{"plugin": "delete@1"}`))
+	qre = newTestQueryExecutor(ctx, tsv, "select * from test_table", 0)
+	_, err = action.BeforeExecution(qre)
+	assert.EqualError(t, err, `rule test_rule rewrote the SELECT query into a DELETE query: "delete from test_table"`)
+	assert.Equal(t, "select * from test_table", qre.query)
+}
+
+// pluginSource is a registry of one version of each plugin.
+type pluginSource map[string][]byte
+
+func (s pluginSource) Resolve(_ context.Context, refs []string) (map[string]wasm.Version, error) {
+	versions := map[string]wasm.Version{}
+	for _, ref := range refs {
+		if binary, ok := s[ref]; ok {
+			sum := sha256.Sum256(binary)
+			versions[ref] = wasm.Version{Name: ref, Version: "1", Checksum: hex.EncodeToString(sum[:])}
+		}
+	}
+	return versions, nil
+}
+
+func (s pluginSource) Binary(_ context.Context, version wasm.Version) ([]byte, error) {
+	return s[version.Name], nil
+}
+
+func TestReloadWasmPlugins(t *testing.T) {
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	rulesName := "testReloadWasmPlugins"
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	qrs := rules.New()
+	for _, name := range []string{"tenant", "audit"} {
+		qr := rules.NewActiveQueryRule("ruleDescription", name+"_rule", rules.QRPlugin)
+		qr.SetActionArgs(`{"plugin": "` + name + `"}`)
+		qrs.Add(qr)
+	}
+	require.NoError(t, tsv.SetQueryRules(rulesName, qrs))
+	assert.Equal(t, []string{"audit", "tenant"}, tsv.qe.pluginReferences())
+
+	plugin := wasmtest.NewPlugin()
+	plugin.Respond(string(wasm.HookBeforeExecution), `{"action": "continue"}`)
+	err := tsv.ReloadWasmPlugins(ctx, pluginSource{"tenant": plugin.Build()})
+	assert.EqualError(t, err, "plugin audit is not in the registry")
+	loaded, ok := tsv.qe.wasmPlugins.Get("tenant")
+	require.True(t, ok)
+	assert.Equal(t, "tenant@1", loaded.Ref())
+	_, ok = tsv.qe.wasmPlugins.Get("audit")
+	assert.False(t, ok)
+}
+
+func TestPluginActionResultHooks(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "test_rule", rules.QRPlugin)
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	fields := sqltypes.MakeTestFields("id|phone", "int64|varchar")
+	newAction := func(plugin *fakePlugin) (*PluginAction, *QueryExecutor) {
+		tsv.qe.wasmPlugins.Set(map[string]wasm.Plugin{"mask@1": plugin})
+		return &PluginAction{Rule: qr, Action: rules.QRPlugin, Plugin: "mask@1"}, newTestQueryExecutor(ctx, tsv, "select id, phone from test_table", 0)
+	}
+
+	// The plugin masks the rows, and appends one.
+	total, end := "total", "0"
+	plugin := &fakePlugin{ref: "mask@1", hooks: map[wasm.Hook]*wasm.Response{
+		wasm.HookResultFields: {Decision: wasm.DecisionContinue},
+		wasm.HookResultRows:   {Decision: wasm.DecisionReplace, Rows: []sqltypes.Row{{sqltypes.NewVarBinary("1"), sqltypes.NewVarBinary("****")}}},
+		wasm.HookResultEnd:    {Decision: wasm.DecisionReplace, Result: &wasm.Result{Rows: [][]*string{{&end, &total}}}},
+	}}
+	action, qre := newAction(plugin)
+	result := sqltypes.MakeTestResult(fields, "1|555-1234")
+	result.RowsAffected = 1
+	got, err := action.RewriteResult(qre, result)
+	require.NoError(t, err)
+	assert.Equal(t, sqltypes.MakeTestResult(fields, "1|****").Rows, got.Rows)
+	assert.Equal(t, fields, got.Fields)
+	assert.Equal(t, "555-1234", result.Rows[0][1].ToString())
+	appended, err := action.EndResult(qre, nil)
+	require.NoError(t, err)
+	assert.Equal(t, sqltypes.MakeTestResult(fields, "0|total").Rows, appended.Rows)
+	require.Len(t, plugin.calls, 3)
+	assert.Equal(t, fields, plugin.calls[0].Fields)
+	assert.Equal(t, result.Rows, plugin.calls[1].Rows)
+	assert.EqualValues(t, 1, plugin.calls[2].Result.RowsAffected)
+	// The result hooks of the query run in one instance.
+	assert.NotNil(t, plugin.calls[0].Stream)
+	assert.Same(t, plugin.calls[0].Stream, plugin.calls[2].Stream)
+
+	// The rows must match the fields the plugin sends.
+	plugin = &fakePlugin{ref: "mask@1", hooks: map[wasm.Hook]*wasm.Response{
+		wasm.HookResultFields: {Decision: wasm.DecisionReplace, Result: &wasm.Result{Fields: []wasm.Field{{Name: "id", Type: "INT64"}}}},
+		wasm.HookResultEnd:    {Decision: wasm.DecisionContinue},
+	}}
+	action, qre = newAction(plugin)
+	_, err = action.RewriteResult(qre, result)
+	assert.EqualError(t, err, "plugin mask@1 returned an invalid result: row 0 has 2 values for 1 fields")
+	assert.Equal(t, vtrpcpb.Code_INTERNAL, vterrors.Code(err))
+	// result_end isn't called once a result hook failed.
+	_, err = action.EndResult(qre, err)
+	assert.Error(t, err)
+	assert.Len(t, plugin.calls, 1)
+
+	// The plugin rejects the rows, and result_end gets the error of a query.
+	plugin = &fakePlugin{ref: "mask@1", hooks: map[wasm.Hook]*wasm.Response{
+		wasm.HookResultRows: {Decision: wasm.DecisionReject, Error: &wasm.Error{Message: "too many rows"}},
+		wasm.HookResultEnd:  {Decision: wasm.DecisionContinue},
+	}}
+	action, qre = newAction(plugin)
+	_, err = action.RewriteResult(qre, result)
+	assert.EqualError(t, err, "too many rows (plugin mask@1)")
+	action, qre = newAction(plugin)
+	_, err = action.EndResult(qre, vterrors.Errorf(vtrpcpb.Code_ABORTED, "stream aborted"))
+	assert.EqualError(t, err, "stream aborted")
+	assert.EqualError(t, plugin.calls[1].Err, "stream aborted")
+}
+
+func TestPluginActionTransformsResults(t *testing.T) {
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// result_rows masks the phones, and result_end appends a row.
+	plugin := wasmtest.NewPlugin()
+	masked := wasm.EncodeRows([]sqltypes.Row{{sqltypes.NewInt64(1), sqltypes.NewVarChar("****")}})
+	plugin.Hook(string(wasm.HookResultRows), wasmtest.Packed(plugin.Data(masked), uint32(len(masked))))
+	plugin.Respond(string(wasm.HookResultEnd), `{"action": "replace", "result": {"rows": [["0", null]]}}`)
+	module, err := tsv.qe.wasmRuntime.Compile(ctx, "mask@1", plugin.Build())
+	require.NoError(t, err)
+	defer module.Close(ctx)
+	tsv.qe.wasmPlugins.Set(map[string]wasm.Plugin{"mask@1": module})
+
+	qr := rules.NewActiveQueryRule("ruleDescription", "mask_rule", rules.QRPlugin)
+	qr.SetActionArgs(`{"plugin": "mask@1"}`)
+	qrs := rules.New()
+	qrs.Add(qr)
+	rulesName := "pluginResultRules"
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.SetQueryRules(rulesName, qrs))
+
+	query := "select id, phone from test_table"
+	result := sqltypes.MakeTestResult(sqltypes.MakeTestFields("id|phone", "int64|varchar"), "1|555-1234")
+	want := sqltypes.MakeTestResult(result.Fields, "1|****", "0|null")
+	db.AddQuery(query+" limit 100001", result)
+	got, err := newTestQueryExecutor(ctx, tsv, query, 0).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, want.Rows, got.Rows)
+
+	db.AddQuery(query, result)
+	var rows []sqltypes.Row
+	err = newTestQueryExecutorStreaming(ctx, tsv, query, 0).Stream(func(result *sqltypes.Result) error {
+		rows = append(rows, result.Rows...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, want.Rows, rows)
+	assert.EqualValues(t, 2, tsv.stats.QueryRuleAffected.Counts()["mask_rule"])
+}
@@ -0,0 +1,168 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+)
+
+// actionStateCheckpointer periodically saves the runtime state of the
+// actions to a file: the circuits of the CIRCUIT_BREAKER rules, the token
+// buckets of the RATE_LIMIT rules and the limits of the adaptive
+// CONCURRENCY_CONTROL rules. When the query engine opens, the state of the
+// last checkpoint is restored, so that a restarted tablet keeps its open
+// circuits open, its empty buckets empty and its lowered limits low instead
+// of letting a herd of queries through. The queries running or queued are
+// not saved: they don't survive the restart.
+//
+// The state is the tablet's own, and the replicas can't write to the sidecar
+// tables, so it is kept in a local file, like the plan cache snapshot.
+type actionStateCheckpointer struct {
+	qe       *QueryEngine
+	path     string
+	interval time.Duration
+
+	checkpoints *stats.Counter
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// actionStateCheckpoint is the state of the actions, by rule.
+type actionStateCheckpoint struct {
+	CircuitBreakers     map[string]circuitBreakerState      `json:",omitempty"`
+	RateLimiters        map[string]rateLimiterState         `json:",omitempty"`
+	AdaptiveConcurrency map[string]adaptiveConcurrencyState `json:",omitempty"`
+}
+
+func newActionStateCheckpointer(env tabletenv.Env, qe *QueryEngine) *actionStateCheckpointer {
+	config := env.Config()
+	return &actionStateCheckpointer{
+		qe:          qe,
+		path:        config.ActionStateFile,
+		interval:    config.ActionStateIntervalSeconds.Get(),
+		checkpoints: env.Exporter().NewCounter("ActionStateCheckpoints", "Number of checkpoints of the runtime state of the actions saved"),
+	}
+}
+
+func (asc *actionStateCheckpointer) enabled() bool {
+	return asc.path != ""
+}
+
+// Open restores the state of the last checkpoint, then starts saving
+// checkpoints in the background.
+func (asc *actionStateCheckpointer) Open() {
+	if !asc.enabled() {
+		return
+	}
+	asc.mu.Lock()
+	defer asc.mu.Unlock()
+	if asc.cancel != nil {
+		return
+	}
+	if err := asc.restore(time.Now()); err != nil && !os.IsNotExist(err) {
+		log.Warningf("Failed to restore the action state from %s: %v", asc.path, err)
+	}
+	ctx, cancel := context.WithCancel(tabletenv.LocalContext())
+	asc.cancel = cancel
+	asc.wg.Add(1)
+	go func() {
+		defer asc.wg.Done()
+		asc.run(ctx)
+	}()
+}
+
+// Close stops the checkpoints, and saves a last one. It must be called
+// before the query engine drops the state.
+func (asc *actionStateCheckpointer) Close() {
+	asc.mu.Lock()
+	defer asc.mu.Unlock()
+	if asc.cancel == nil {
+		return
+	}
+	asc.cancel()
+	asc.wg.Wait()
+	asc.cancel = nil
+	if err := asc.save(time.Now()); err != nil {
+		log.Warningf("Failed to save the action state to %s: %v", asc.path, err)
+	}
+}
+
+func (asc *actionStateCheckpointer) run(ctx context.Context) {
+	if asc.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(asc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := asc.save(now); err != nil {
+				log.Warningf("Failed to save the action state to %s: %v", asc.path, err)
+			}
+		}
+	}
+}
+
+// save writes a checkpoint of the state of the actions. The file is replaced
+// atomically, so that a crash while saving doesn't lose the last checkpoint.
+func (asc *actionStateCheckpointer) save(now time.Time) error {
+	data, err := json.Marshal(actionStateCheckpoint{
+		CircuitBreakers:     asc.qe.circuitBreakers.states(),
+		RateLimiters:        asc.qe.rateLimiters.states(now),
+		AdaptiveConcurrency: asc.qe.adaptiveConcurrency.states(),
+	})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(asc.path), filepath.Base(asc.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), asc.path); err != nil {
+		return err
+	}
+	asc.checkpoints.Add(1)
+	return nil
+}
+
+// restore reads the last checkpoint. The state of a rule whose thresholds
+// changed starts over when its action runs again, like while the tablet runs.
+func (asc *actionStateCheckpointer) restore(now time.Time) error {
+	data, err := os.ReadFile(asc.path)
+	if err != nil {
+		return err
+	}
+	var checkpoint actionStateCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return err
+	}
+	asc.qe.circuitBreakers.restore(checkpoint.CircuitBreakers)
+	asc.qe.rateLimiters.restore(checkpoint.RateLimiters)
+	asc.qe.adaptiveConcurrency.restore(checkpoint.AdaptiveConcurrency, now)
+	log.Infof("Restored the state of %d circuits, %d token buckets and %d adaptive limits from %s", len(checkpoint.CircuitBreakers), len(checkpoint.RateLimiters), len(checkpoint.AdaptiveConcurrency), asc.path)
+	return nil
+}
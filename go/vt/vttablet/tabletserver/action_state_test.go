@@ -0,0 +1,70 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+)
+
+func newActionStateTestQueryEngine(path string) *QueryEngine {
+	config := tabletenv.NewDefaultConfig()
+	config.ActionStateFile = path
+	env := tabletenv.NewEnv(config, "ActionStateTest")
+	qe := &QueryEngine{
+		circuitBreakers:     newCircuitBreakers(),
+		rateLimiters:        newRateLimiters(),
+		adaptiveConcurrency: newAdaptiveConcurrencyLimits(),
+	}
+	qe.actionStates = newActionStateCheckpointer(env, qe)
+	return qe
+}
+
+func TestActionStateCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actions.json")
+	now := time.Now()
+
+	breakerConfig := circuitBreakerConfig{ErrorRate: 50, MinRequests: 1, Window: 10 * time.Second, CoolDown: time.Minute, HalfOpenRequests: 1}
+	adaptiveConfig := adaptiveConcurrencyConfig{TargetLatency: time.Millisecond, MinConcurrency: 1, MaxConcurrency: 10, Window: time.Second, Backoff: 0.5}
+	qe := newActionStateTestQueryEngine(path)
+	qe.actionStates.Open()
+	// The circuit opens, the bucket is drained and the limit halves.
+	cb := qe.circuitBreakers.get("breaker", breakerConfig)
+	require.True(t, cb.allow(now))
+	require.Equal(t, circuitBreakerEventOpened, cb.record(now, true))
+	limiter := qe.rateLimiters.get("limiter", "limiter", 1, 5)
+	require.True(t, limiter.AllowN(time.Now(), 5))
+	limit := qe.adaptiveConcurrency.get("adaptive", adaptiveConfig, now)
+	limit.record(now.Add(time.Second), time.Second, nil)
+	require.Equal(t, 5, limit.current())
+	qe.actionStates.Close()
+	_, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// The restarted engine keeps them, as long as their thresholds match.
+	qe = newActionStateTestQueryEngine(path)
+	qe.actionStates.Open()
+	defer qe.actionStates.Close()
+	assert.False(t, qe.circuitBreakers.get("breaker", breakerConfig).allow(now.Add(59*time.Second)))
+	assert.False(t, qe.rateLimiters.get("limiter", "limiter", 1, 5).AllowN(time.Now(), 2))
+	assert.Equal(t, 5, qe.adaptiveConcurrency.get("adaptive", adaptiveConfig, now).current())
+	adaptiveConfig.MaxConcurrency = 20
+	assert.Equal(t, 20, qe.adaptiveConcurrency.get("adaptive", adaptiveConfig, now).current())
+
+	// A bad checkpoint restores nothing.
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	qe = newActionStateTestQueryEngine(path)
+	qe.actionStates.Open()
+	defer qe.actionStates.Close()
+	assert.True(t, qe.circuitBreakers.get("breaker", breakerConfig).allow(now))
+}
@@ -0,0 +1,165 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAdaptiveConcurrencyWindow  = time.Second
+	defaultAdaptiveConcurrencyBackoff = 0.9
+	// maxAdaptiveConcurrencySamples bounds the latencies kept in a window,
+	// the ones after it don't count.
+	maxAdaptiveConcurrencySamples = 1000
+)
+
+// adaptiveConcurrencyConfig are the thresholds of the adaptive mode of a
+// CONCURRENCY_CONTROL rule.
+type adaptiveConcurrencyConfig struct {
+	// TargetLatency, if set, is the p99 latency of the queries of a window
+	// above which the limit decreases.
+	TargetLatency time.Duration
+	// MaxThreadsRunning, if set, is the number of threads running in MySQL
+	// above which the limit decreases.
+	MaxThreadsRunning int64
+	// MinConcurrency and MaxConcurrency bound the limit, which starts at
+	// MaxConcurrency.
+	MinConcurrency int
+	MaxConcurrency int
+	Window         time.Duration
+	// Backoff is the factor the limit is multiplied by when it decreases.
+	Backoff float64
+}
+
+// adaptiveConcurrencyLimits are the limits of the adaptive CONCURRENCY_CONTROL
+// rules, by rule. The queues of a rule share its limit.
+type adaptiveConcurrencyLimits struct {
+	mu     sync.Mutex
+	limits map[string]*adaptiveConcurrencyLimit
+}
+
+func newAdaptiveConcurrencyLimits() *adaptiveConcurrencyLimits {
+	return &adaptiveConcurrencyLimits{limits: make(map[string]*adaptiveConcurrencyLimit)}
+}
+
+// get returns the limit of a rule, which starts over when its thresholds
+// change.
+func (limits *adaptiveConcurrencyLimits) get(ruleName string, config adaptiveConcurrencyConfig, now time.Time) *adaptiveConcurrencyLimit {
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+	l, ok := limits.limits[ruleName]
+	if !ok || l.config != config {
+		l = &adaptiveConcurrencyLimit{config: config, limit: config.MaxConcurrency, windowStart: now}
+		limits.limits[ruleName] = l
+	}
+	return l
+}
+
+// retain drops the limits of the rules which are not in ruleNames.
+func (limits *adaptiveConcurrencyLimits) retain(ruleNames map[string]bool) {
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+	for ruleName := range limits.limits {
+		if !ruleNames[ruleName] {
+			delete(limits.limits, ruleName)
+		}
+	}
+}
+
+// clear drops all the limits.
+func (limits *adaptiveConcurrencyLimits) clear() {
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+	limits.limits = make(map[string]*adaptiveConcurrencyLimit)
+}
+
+// adaptiveConcurrencyState is the checkpointed state of a limit.
+type adaptiveConcurrencyState struct {
+	Config adaptiveConcurrencyConfig
+	Limit  int
+}
+
+// states returns the state of the limits, by rule.
+func (limits *adaptiveConcurrencyLimits) states() map[string]adaptiveConcurrencyState {
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+	states := make(map[string]adaptiveConcurrencyState, len(limits.limits))
+	for ruleName, l := range limits.limits {
+		states[ruleName] = adaptiveConcurrencyState{Config: l.config, Limit: l.current()}
+	}
+	return states
+}
+
+// restore sets the limits, which get keeps as long as the thresholds of their
+// rule don't change. Their windows start over.
+func (limits *adaptiveConcurrencyLimits) restore(states map[string]adaptiveConcurrencyState, now time.Time) {
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+	for ruleName, state := range states {
+		limit := min(max(state.Limit, state.Config.MinConcurrency), state.Config.MaxConcurrency)
+		limits.limits[ruleName] = &adaptiveConcurrencyLimit{config: state.Config, limit: limit, windowStart: now}
+	}
+}
+
+// adaptiveConcurrencyLimit adjusts the concurrency of a rule with an AIMD
+// algorithm: at the end of each window, the limit is multiplied by the backoff
+// if the p99 latency of the window or the threads running in MySQL are above
+// their threshold, and increases by one otherwise.
+type adaptiveConcurrencyLimit struct {
+	config adaptiveConcurrencyConfig
+
+	mu          sync.Mutex
+	limit       int
+	windowStart time.Time
+	latencies   []time.Duration
+}
+
+// current returns the concurrency limit.
+func (l *adaptiveConcurrencyLimit) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// record counts the latency of a query, and returns the limit and whether it
+// changed. threadsRunning is only called at the end of a window.
+func (l *adaptiveConcurrencyLimit) record(now time.Time, latency time.Duration, threadsRunning func() int64) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.latencies) < maxAdaptiveConcurrencySamples {
+		l.latencies = append(l.latencies, latency)
+	}
+	if now.Sub(l.windowStart) < l.config.Window {
+		return l.limit, false
+	}
+	overloaded := l.config.TargetLatency > 0 && p99Latency(l.latencies) > l.config.TargetLatency
+	if !overloaded && l.config.MaxThreadsRunning > 0 {
+		overloaded = threadsRunning() > l.config.MaxThreadsRunning
+	}
+	l.windowStart, l.latencies = now, l.latencies[:0]
+
+	limit := l.limit
+	if overloaded {
+		limit = max(int(float64(limit)*l.config.Backoff), l.config.MinConcurrency)
+	} else if limit < l.config.MaxConcurrency {
+		limit++
+	}
+	changed := limit != l.limit
+	l.limit = limit
+	return limit, changed
+}
+
+// p99Latency returns the 99th percentile of latencies, which it sorts.
+func p99Latency(latencies []time.Duration) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[(len(latencies)*99+99)/100-1]
+}
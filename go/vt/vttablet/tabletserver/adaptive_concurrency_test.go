@@ -0,0 +1,115 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+func TestAdaptiveConcurrencyLimit(t *testing.T) {
+	config := adaptiveConcurrencyConfig{TargetLatency: 100 * time.Millisecond, MinConcurrency: 2, MaxConcurrency: 10, Window: time.Second, Backoff: 0.5}
+	now := time.Now()
+	limits := newAdaptiveConcurrencyLimits()
+	l := limits.get("test_rule", config, now)
+	assert.Equal(t, 10, l.current())
+	noThreads := func() int64 { return 0 }
+
+	// The limit is kept within a window, and halves after a slow one: one
+	// slow query out of fifty is above the p99.
+	for i := 0; i < 49; i++ {
+		limit, changed := l.record(now, time.Millisecond, noThreads)
+		assert.Equal(t, 10, limit)
+		assert.False(t, changed)
+	}
+	limit, changed := l.record(now.Add(time.Second), time.Second, noThreads)
+	assert.Equal(t, 5, limit)
+	assert.True(t, changed)
+
+	// It doesn't go below the minimum.
+	now = now.Add(time.Second)
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		l.record(now, time.Second, noThreads)
+	}
+	assert.Equal(t, 2, l.current())
+
+	// It increases by one after each window below the target, up to the
+	// maximum.
+	for i := 3; i <= 12; i++ {
+		now = now.Add(time.Second)
+		l.record(now, time.Millisecond, noThreads)
+		assert.Equal(t, min(i, 10), l.current())
+	}
+
+	// The same rule with other thresholds starts over.
+	assert.Same(t, l, limits.get("test_rule", config, now))
+	config.MaxThreadsRunning = 20
+	l = limits.get("test_rule", config, now)
+	assert.Equal(t, 10, l.current())
+
+	// Too many threads running in MySQL decrease the limit too.
+	limit, _ = l.record(now.Add(time.Second), time.Millisecond, func() int64 { return 21 })
+	assert.Equal(t, 5, limit)
+}
+
+func TestP99Latency(t *testing.T) {
+	assert.Zero(t, p99Latency(nil))
+	assert.Equal(t, time.Second, p99Latency([]time.Duration{time.Second}))
+	latencies := make([]time.Duration, 0, 200)
+	for i := 200; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 198*time.Millisecond, p99Latency(latencies))
+}
+
+func TestConcurrencyControlActionAdaptive(t *testing.T) {
+	qr := rules.NewActiveQueryRule("ruleDescription", "adaptive_rule", rules.QRConcurrencyControl)
+	action := &ConcurrencyControlAction{Rule: qr, Action: rules.QRConcurrencyControl}
+	require.NoError(t, action.SetParams(`{"max_queue_size": 20, "max_concurrency": 8, "adaptive": {"max_threads_running": 16}}`))
+	assert.Equal(t, &adaptiveConcurrencyConfig{
+		MaxThreadsRunning: 16,
+		MinConcurrency:    1,
+		MaxConcurrency:    8,
+		Window:            defaultAdaptiveConcurrencyWindow,
+		Backoff:           defaultAdaptiveConcurrencyBackoff,
+	}, action.Adaptive)
+
+	for params, expected := range map[string]string{
+		`{"max_queue_size": 0, "max_concurrency": 0, "adaptive": {"target_latency": "1s"}}`:                       "the adaptive mode needs a max_queue_size",
+		`{"max_queue_size": 2, "max_concurrency": 1, "adaptive": {}}`:                                             "the adaptive mode needs a target_latency or a max_threads_running",
+		`{"max_queue_size": 2, "max_concurrency": 1, "adaptive": {"target_latency": "fast"}}`:                     `invalid target_latency "fast"`,
+		`{"max_queue_size": 2, "max_concurrency": 1, "adaptive": {"max_threads_running": -1}}`:                    "invalid max_threads_running -1",
+		`{"max_queue_size": 2, "max_concurrency": 1, "adaptive": {"target_latency": "1s", "min_concurrency": 2}}`: "invalid min_concurrency 2, expected [1, 1]",
+		`{"max_queue_size": 2, "max_concurrency": 1, "adaptive": {"target_latency": "1s", "window": "0s"}}`:       `invalid window "0s"`,
+		`{"max_queue_size": 2, "max_concurrency": 1, "adaptive": {"target_latency": "1s", "backoff": 1}}`:         "invalid backoff 1, expected (0, 1)",
+	} {
+		assert.ErrorContains(t, action.SetParams(params), expected, params)
+	}
+
+	// The queries slower than the target decrease the limit of the queues of
+	// the rule.
+	require.NoError(t, action.SetParams(`{"max_queue_size": 20, "max_concurrency": 8, "adaptive": {"target_latency": "1ns", "window": "1ns"}}`))
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	qre := newTestQueryExecutor(ctx, tsv, "select * from t1", 0)
+	_, err := action.BeforeExecution(qre)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	action.AfterExecution(qre, nil, nil)
+	assert.EqualValues(t, 7, tsv.stats.ConcurrencyLimits.Counts()["adaptive_rule"])
+	_, maxConcurrency := action.limits(tsv.qe)
+	assert.Equal(t, 7, maxConcurrency)
+}
@@ -0,0 +1,254 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/vt/logutil"
+)
+
+const (
+	// defaultAuditQueueSize is the number of records an audit sink buffers
+	// before it drops the new ones.
+	defaultAuditQueueSize = 10000
+	// auditBatchSize is the maximum number of records written at once.
+	auditBatchSize = 500
+	// auditHTTPTimeout bounds the time to post a batch of records.
+	auditHTTPTimeout = 10 * time.Second
+)
+
+var auditErrorLogger = logutil.NewThrottledLogger("AuditLog", 10*time.Second)
+
+// auditLogs are the sinks of the AUDIT and SAMPLE rules, by file or URL.
+// The records are written by one goroutine per sink, as lines of JSON, so
+// that a slow sink never blocks the queries: the records which don't fit in
+// its queue are dropped.
+type auditLogs struct {
+	mu   sync.Mutex
+	logs map[string]*auditLog
+}
+
+type auditLog struct {
+	records chan []byte
+	write   func(batch []byte) error
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newAuditLogs() *auditLogs {
+	return &auditLogs{logs: make(map[string]*auditLog)}
+}
+
+// get returns the sink writing to a file, or posting to a URL. Its queue
+// size is the one of the first rule using it.
+func (al *auditLogs) get(file, url string, queueSize int) *auditLog {
+	if url != "" {
+		client := &http.Client{Timeout: auditHTTPTimeout}
+		return al.getOrCreate(auditLogKey(file, url), queueSize, func(batch []byte) error { return postAuditRecords(client, url, batch) })
+	}
+	return al.getOrCreate(auditLogKey(file, url), queueSize, func(batch []byte) error { return appendAuditRecords(file, batch) })
+}
+
+// getRotatingFile returns the sink writing to a file which is rotated once
+// larger than maxSize bytes, keeping maxBackups of the previous files.
+func (al *auditLogs) getRotatingFile(file string, maxSize int64, maxBackups, queueSize int) *auditLog {
+	rf := &rotatingFile{path: file, maxSize: maxSize, maxBackups: maxBackups, size: -1}
+	return al.getOrCreate(auditLogKey(file, ""), queueSize, rf.write)
+}
+
+// auditLogKey returns the key of the sink writing to a file, or posting to a
+// URL if set.
+func auditLogKey(file, url string) string {
+	if url != "" {
+		return "url:" + url
+	}
+	return "file:" + file
+}
+
+func (al *auditLogs) getOrCreate(key string, queueSize int, write func(batch []byte) error) *auditLog {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if sink, ok := al.logs[key]; ok {
+		return sink
+	}
+	sink := &auditLog{
+		records: make(chan []byte, queueSize),
+		write:   write,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	al.logs[key] = sink
+	go sink.run()
+	return sink
+}
+
+// retain flushes the queued records and stops the sinks which are not in
+// keys, the sinks of the rules loaded by their auditLogKey.
+func (al *auditLogs) retain(keys map[string]bool) {
+	var stopped []*auditLog
+	al.mu.Lock()
+	for key, sink := range al.logs {
+		if !keys[key] {
+			stopped = append(stopped, sink)
+			delete(al.logs, key)
+		}
+	}
+	al.mu.Unlock()
+	for _, sink := range stopped {
+		sink.close()
+	}
+}
+
+// close flushes the queued records and stops all the sinks.
+func (al *auditLogs) close() {
+	al.mu.Lock()
+	logs := al.logs
+	al.logs = make(map[string]*auditLog)
+	al.mu.Unlock()
+	for _, sink := range logs {
+		sink.close()
+	}
+}
+
+func (sink *auditLog) close() {
+	close(sink.stop)
+	<-sink.done
+}
+
+// send queues a record, and returns false if the queue is full.
+func (sink *auditLog) send(record []byte) bool {
+	select {
+	case sink.records <- record:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sink *auditLog) run() {
+	defer close(sink.done)
+	var batch bytes.Buffer
+	for {
+		select {
+		case record := <-sink.records:
+			sink.flush(&batch, record)
+		case <-sink.stop:
+			for {
+				select {
+				case record := <-sink.records:
+					sink.flush(&batch, record)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes a record, with the ones queued behind it.
+func (sink *auditLog) flush(batch *bytes.Buffer, record []byte) {
+	batch.Reset()
+	batch.Write(record)
+	batch.WriteByte('\n')
+drain:
+	for n := 1; n < auditBatchSize; n++ {
+		select {
+		case record := <-sink.records:
+			batch.Write(record)
+			batch.WriteByte('\n')
+		default:
+			break drain
+		}
+	}
+	if err := sink.write(batch.Bytes()); err != nil {
+		auditErrorLogger.Warningf("Failed to write the audit records: %v", err)
+	}
+}
+
+func appendAuditRecords(file string, batch []byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(batch); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotatingFile is a file renamed to <path>.1, <path>.2, and so on up to
+// <path>.<maxBackups>, once larger than maxSize. It is only written by the
+// goroutine of its sink.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	// size is the size of the file, or -1 until it is known.
+	size int64
+}
+
+func (rf *rotatingFile) write(batch []byte) error {
+	if rf.size < 0 {
+		rf.size = 0
+		if info, err := os.Stat(rf.path); err == nil {
+			rf.size = info.Size()
+		}
+	}
+	if rf.size > 0 && rf.size+int64(len(batch)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return err
+		}
+	}
+	if err := appendAuditRecords(rf.path, batch); err != nil {
+		return err
+	}
+	rf.size += int64(len(batch))
+	return nil
+}
+
+func (rf *rotatingFile) rotate() error {
+	for i := rf.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	var err error
+	if rf.maxBackups > 0 {
+		err = os.Rename(rf.path, rf.path+".1")
+	} else {
+		err = os.Remove(rf.path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	rf.size = 0
+	return nil
+}
+
+func postAuditRecords(client *http.Client, url string, batch []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
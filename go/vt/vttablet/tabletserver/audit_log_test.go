@@ -0,0 +1,40 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	file := path.Join(t.TempDir(), "samples.log")
+	require.NoError(t, os.WriteFile(file, []byte("0000\n"), 0600))
+	rf := &rotatingFile{path: file, maxSize: 10, maxBackups: 2, size: -1}
+	for _, batch := range []string{"1111\n", "2222\n", "3333\n", "4444\n333\n"} {
+		require.NoError(t, rf.write([]byte(batch)))
+	}
+	for name, want := range map[string]string{
+		file:        "4444\n333\n",
+		file + ".1": "2222\n3333\n",
+		file + ".2": "0000\n1111\n",
+	} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data), name)
+	}
+
+	// Without backups, the file is truncated.
+	rf = &rotatingFile{path: file, maxSize: 10, size: -1}
+	require.NoError(t, rf.write([]byte("5555\n")))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "5555\n", string(data))
+}
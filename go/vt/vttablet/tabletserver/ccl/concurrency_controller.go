@@ -22,13 +22,15 @@ limitations under the License.
 package ccl
 
 import (
-	"container/list"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/pflag"
+	"golang.org/x/exp/slices"
 
 	"vitess.io/vitess/go/vt/servenv"
 
@@ -71,6 +73,12 @@ func init() {
 //     limited to avoid that queued transactions can consume the full capacity
 //     of vttablet. This is important if the capaciy is finite. For example, the
 //     number of RPCs in flight could be limited by the RPC subsystem.
+//
+// No lock is shared between queues: queues are found in a sync.Map, the size
+// of the global Queue is a striped counter, and every Queue is admitted with
+// atomic operations and waited on with a channel. Only the transactions which
+// wait fairly or in a priority lane, see WaitFair and WaitLane, take the lock
+// of their Queue.
 type ConcurrencyController struct {
 	*sync2.ConsolidatorCache
 
@@ -102,9 +110,10 @@ type ConcurrencyController struct {
 	logQueueExceededDryRun       *logutil.ThrottledLogger
 	logGlobalQueueExceededDryRun *logutil.ThrottledLogger
 
-	mu                sync.Mutex
-	queues            map[string]*Queue
-	currentGlobalSize int
+	// queues maps the keys to their *Queue.
+	queues sync.Map
+	// globalSize counts the transactions queued or in flight in all the queues.
+	globalSize *sync2.StripedCounter
 }
 
 // New returns a ConcurrencyController object.
@@ -140,7 +149,7 @@ func New(exporter *servenv.Exporter) *ConcurrencyController {
 		logWaitsDryRun:               logutil.NewThrottledLogger("ConcurrencyController Waits DryRun", 5*time.Second),
 		logQueueExceededDryRun:       logutil.NewThrottledLogger("ConcurrencyController QueueExceeded DryRun", 5*time.Second),
 		logGlobalQueueExceededDryRun: logutil.NewThrottledLogger("ConcurrencyController GlobalQueueExceeded DryRun", 5*time.Second),
-		queues:                       make(map[string]*Queue),
+		globalSize:                   sync2.NewStripedCounter(),
 	}
 }
 
@@ -149,18 +158,55 @@ type DoneFunc func()
 
 // GetOrCreateQueue creates a new Queue for the given key if it does not exist.
 func (txs *ConcurrencyController) GetOrCreateQueue(key string, maxQueueSize, maxConcurrency int) *Queue {
-	txs.mu.Lock()
-	defer txs.mu.Unlock()
+	for {
+		v, ok := txs.queues.Load(key)
+		if !ok {
+			v, _ = txs.queues.LoadOrStore(key, newQueue(key, txs, maxQueueSize, maxConcurrency))
+		}
+		q := v.(*Queue)
+		if q.size.Load() < 0 {
+			// The last transaction of the Queue is gone, and it is being removed.
+			txs.queues.CompareAndDelete(key, q)
+			continue
+		}
+		if q.maxQueueSize.Load() != int64(maxQueueSize) || q.maxConcurrency.Load() != int64(maxConcurrency) {
+			q.resizeQueue(maxQueueSize, maxConcurrency)
+		}
+		return q
+	}
+}
 
-	_, ok := txs.queues[key]
+// ResizeQueues changes the limits of the queues whose key has the given
+// prefix, in place: the transactions waiting in them keep their place, and
+// the new limits apply now instead of when the next transaction arrives. It
+// returns the number of queues resized.
+func (txs *ConcurrencyController) ResizeQueues(prefix string, maxQueueSize, maxConcurrency int) int {
+	resized := 0
+	txs.queues.Range(func(key, v any) bool {
+		q := v.(*Queue)
+		if !strings.HasPrefix(key.(string), prefix) || q.size.Load() < 0 {
+			return true
+		}
+		if q.maxQueueSize.Load() != int64(maxQueueSize) || q.maxConcurrency.Load() != int64(maxConcurrency) {
+			q.resizeQueue(maxQueueSize, maxConcurrency)
+			resized++
+		}
+		return true
+	})
+	return resized
+}
+
+// getQueue returns the Queue of the given key, nil if there is none.
+func (txs *ConcurrencyController) getQueue(key string) *Queue {
+	v, ok := txs.queues.Load(key)
 	if !ok {
-		txs.queues[key] = newQueue(key, txs, maxQueueSize, maxConcurrency)
+		return nil
 	}
-	q := txs.queues[key]
-	if q.maxQueueSize != maxQueueSize || q.maxConcurrency != maxConcurrency {
-		q.resizeQueue(maxQueueSize, maxConcurrency)
+	q := v.(*Queue)
+	if q.size.Load() < 0 {
+		return nil
 	}
-	return txs.queues[key]
+	return q
 }
 
 // Wait blocks if another transaction for the same range is already in flight.
@@ -170,182 +216,278 @@ func (txs *ConcurrencyController) GetOrCreateQueue(key string, maxQueueSize, max
 // "waited" is true if Wait() had to wait for other transactions.
 // "err" is not nil if a) the context is done or b) a Queue limit was reached.
 func (q *Queue) Wait(ctx context.Context, tables []string) (done DoneFunc, waited bool, err error) {
-	q.txs.mu.Lock()
-	defer q.txs.mu.Unlock()
-
-	waited, err = q.lockLocked(ctx, q.key, tables)
-	if err != nil {
-		if waited {
-			// Waiting failed early e.g. due a canceled context and we did NOT get the
-			// slot. Call "done" now because we don'txs return it to the caller.
-			q.unlockLocked(q.key, false /* returnSlot */)
-		}
-		return nil, waited, err
-	}
-	return func() { q.unlock(q.key) }, waited, nil
+	return q.wait(ctx, tables, false, 0, "")
 }
 
-// lockLocked queues this transaction. It will unblock immediately if this
-// transaction is the first in the Queue or when it acquired a slot.
-// The method has the suffix "Locked" to clarify that "txs.mu" must be locked.
-func (q *Queue) lockLocked(ctx context.Context, key string, tables []string) (bool, error) {
-	txs := q.txs
+// WaitFair is like Wait, but the waiting transactions of the different
+// callers are admitted in turn, one per caller, instead of in arrival order:
+// a caller with many transactions doesn't starve the others. The transactions
+// of a caller are admitted in arrival order. The fair transactions compete
+// with the ones which Wait for the released slots.
+func (q *Queue) WaitFair(ctx context.Context, tables []string, caller string) (done DoneFunc, waited bool, err error) {
+	return q.wait(ctx, tables, true, 0, caller)
+}
 
-	if txs.currentGlobalSize >= txs.maxGlobalQueueSize {
-		if txs.dryRun {
-			txs.globalQueueExceededDryRun.Add(1)
-			txs.logGlobalQueueExceededDryRun.Warningf("Would have rejected BeginExecute RPC because there are too many queued transactions (%d >= %d)", txs.currentGlobalSize, txs.maxGlobalQueueSize)
-		} else {
-			txs.globalQueueExceeded.Add(1)
-			return false, vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED,
-				"concurrency control protection: too many global queued transactions (%d >= %d)", txs.currentGlobalSize, txs.maxGlobalQueueSize)
-		}
-	}
+// WaitLane is like WaitFair, but the transaction waits in a priority lane:
+// the released slots go to the transactions of lane 0 first, then to the ones
+// of lane 1, and so on. The callers of a lane are admitted in turn, and a
+// transaction without a caller waits in arrival order within its lane.
+func (q *Queue) WaitLane(ctx context.Context, tables []string, lane int, caller string) (done DoneFunc, waited bool, err error) {
+	return q.wait(ctx, tables, true, lane, caller)
+}
 
-	if q.size >= q.maxQueueSize {
-		if txs.dryRun {
-			for _, table := range tables {
-				txs.queueExceededDryRun.Add(table, 1)
-			}
-			txs.logQueueExceededDryRun.Warningf("Would have rejected BeginExecute RPC because there are too many queued transactions (%d >= %d)", q.size, q.maxQueueSize)
-		} else {
-			for _, table := range tables {
-				txs.queueExceeded.Add(table, 1)
-			}
-			return false, vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED,
-				"concurrency control protection: too many queued transactions (%d >= %d)", q.size, q.maxQueueSize)
-		}
+func (q *Queue) wait(ctx context.Context, tables []string, fair bool, lane int, caller string) (done DoneFunc, waited bool, err error) {
+	txs := q.txs
+	if err := txs.checkGlobalQueueSize(); err != nil {
+		return nil, false, err
 	}
-
-	txs.currentGlobalSize++
-	q.size++
-	q.count++
-	if q.size > q.max {
-		q.max = q.size
+	for {
+		entered, err := q.enter(tables)
+		if err != nil {
+			return nil, false, err
+		}
+		if entered {
+			break
+		}
+		// The Queue was removed after our caller got it.
+		q = txs.GetOrCreateQueue(q.key, int(q.maxQueueSize.Load()), int(q.maxConcurrency.Load()))
 	}
+	txs.globalSize.Add(1)
 	// Publish the number of waits at /debug/hotrows.
-	txs.Record(key)
+	txs.Record(q.key)
 
 	if txs.dryRun {
 		for _, table := range tables {
 			txs.waitsDryRun.Add(table, 1)
 		}
-		txs.logWaitsDryRun.Warningf("Would have queued BeginExecute RPC for row (range): '%v' because another transaction to the same range is already in progress.", key)
-		return false, nil
+		txs.logWaitsDryRun.Warningf("Would have queued BeginExecute RPC for row (range): '%v' because another transaction to the same range is already in progress.", q.key)
+		// Dry-run does not acquire a slot.
+		return func() { q.leave(false) }, false, nil
 	}
-
-	var ch chan struct{}
-	if q.onTheFlySize < q.maxConcurrency {
-		q.onTheFlySize++
-		return false, nil
+	if fair {
+		return q.waitFair(ctx, tables, lane, caller)
 	}
 
-	ch = make(chan struct{})
-	q.waitingRequest.PushBack(ch)
-
-	// Unlock before the wait and relock before returning because our caller
-	// Wait() holds the lock and assumes it still has it.
-	txs.mu.Unlock()
-	defer txs.mu.Lock()
+	select {
+	case <-q.slots:
+		return func() { q.leave(true) }, false, nil
+	default:
+	}
 
-	// Blocking wait for the next available slot.
+	// Blocking wait for the next available slot. Goroutines blocked on a
+	// channel receive are served in the order they arrived.
 	for _, table := range tables {
 		txs.waits.Add(table, 1)
 	}
-
+	q.waiting.Add(1)
 	select {
-	case ch <- struct{}{}:
-		return true, nil
+	case <-q.slots:
+		q.waiting.Add(-1)
+		return func() { q.leave(true) }, true, nil
 	case <-ctx.Done():
-		close(ch)
-		return true, ctx.Err()
+		q.waiting.Add(-1)
+		// Waiting failed early e.g. due a canceled context and we did NOT get
+		// a slot.
+		q.leave(false)
+		return nil, true, ctx.Err()
 	}
+}
 
+// waitFair waits for a slot in the turn of the caller in its lane.
+func (q *Queue) waitFair(ctx context.Context, tables []string, lane int, caller string) (done DoneFunc, waited bool, err error) {
+	q.fair.mu.Lock()
+	if q.fair.size.Load() == 0 {
+		select {
+		case <-q.slots:
+			q.fair.mu.Unlock()
+			return func() { q.leave(true) }, false, nil
+		default:
+		}
+	}
+	for _, table := range tables {
+		q.txs.waits.Add(table, 1)
+	}
+	q.waiting.Add(1)
+	turn := q.fair.push(lane, caller)
+	// A slot may have been released since it was checked.
+	q.fair.dispatchLocked(q.slots)
+	q.fair.mu.Unlock()
+
+	select {
+	case <-turn:
+		q.waiting.Add(-1)
+		return func() { q.leave(true) }, true, nil
+	case <-ctx.Done():
+		q.waiting.Add(-1)
+		q.fair.mu.Lock()
+		removed := q.fair.remove(lane, caller, turn)
+		q.fair.mu.Unlock()
+		if !removed {
+			// The slot was handed over meanwhile.
+			<-turn
+			q.releaseSlot()
+		}
+		q.leave(false)
+		return nil, true, ctx.Err()
+	}
 }
 
-func (q *Queue) unlock(key string) {
-	q.txs.mu.Lock()
-	defer q.txs.mu.Unlock()
+// Observe counts a transaction in the Queue like Wait, but without making it
+// wait or rejecting it: it returns whether the transaction would have waited
+// for a slot, and the error it would have been rejected with. It doesn't count
+// in the global Queue. "done" must be called once the transaction is done.
+func (q *Queue) Observe() (done DoneFunc, wouldWait bool, wouldErr error) {
+	for {
+		size := q.size.Load()
+		if size < 0 {
+			// The Queue was removed after our caller got it.
+			q = q.txs.GetOrCreateQueue(q.key, int(q.maxQueueSize.Load()), int(q.maxConcurrency.Load()))
+			continue
+		}
+		if !q.size.CompareAndSwap(size, size+1) {
+			continue
+		}
+		if maxQueueSize := q.maxQueueSize.Load(); size >= maxQueueSize {
+			wouldErr = vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED,
+				"concurrency control protection: too many queued transactions (%d >= %d)", size, maxQueueSize)
+		}
+		// The observed transactions never wait, so they are all in flight.
+		return q.exit, size >= q.maxConcurrency.Load(), wouldErr
+	}
+}
 
-	q.unlockLocked(key, true)
+// checkGlobalQueueSize returns an error if the global Queue is full. Adding
+// a transaction to the global Queue is not atomic with the check: the limit
+// may be exceeded by as many transactions as there are arriving at the same
+// time.
+func (txs *ConcurrencyController) checkGlobalQueueSize() error {
+	globalSize := txs.globalSize.Get()
+	if globalSize < int64(txs.maxGlobalQueueSize) {
+		return nil
+	}
+	if txs.dryRun {
+		txs.globalQueueExceededDryRun.Add(1)
+		txs.logGlobalQueueExceededDryRun.Warningf("Would have rejected BeginExecute RPC because there are too many queued transactions (%d >= %d)", globalSize, txs.maxGlobalQueueSize)
+		return nil
+	}
+	txs.globalQueueExceeded.Add(1)
+	return vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED,
+		"concurrency control protection: too many global queued transactions (%d >= %d)", globalSize, txs.maxGlobalQueueSize)
 }
 
-func (q *Queue) unlockLocked(key string, returnSlot bool) {
+// enter adds this transaction to the Queue. It returns false if the Queue
+// was removed, in which case the transaction must enter the new Queue for
+// the same key.
+func (q *Queue) enter(tables []string) (bool, error) {
 	txs := q.txs
-	q.size--
-	txs.currentGlobalSize--
-
-	if q.size == 0 {
-		// This is the last transaction in flight.
-		q.onTheFlySize--
-		delete(txs.queues, key)
-
-		if q.max > 1 {
-			logMsg := fmt.Sprintf("%v simultaneous transactions (%v in total) would have been queued.", q.max, q.count)
-			if txs.dryRun {
-				txs.logDryRun.Infof(logMsg)
-			} else {
-				txs.log.Infof(logMsg)
+	for {
+		size := q.size.Load()
+		if size < 0 {
+			return false, nil
+		}
+		maxQueueSize := q.maxQueueSize.Load()
+		exceeded := size >= maxQueueSize
+		if exceeded && !txs.dryRun {
+			for _, table := range tables {
+				txs.queueExceeded.Add(table, 1)
 			}
+			return false, vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED,
+				"concurrency control protection: too many queued transactions (%d >= %d)", size, maxQueueSize)
 		}
-
-		// Return early because the Queue "q" for this "key" will not be used any
-		// more.
-		// We intentionally skip returning the last slot and closing the
-		// "availableSlots" channel because it is not required by Go.
-		return
+		if !q.size.CompareAndSwap(size, size+1) {
+			continue
+		}
+		if exceeded {
+			for _, table := range tables {
+				txs.queueExceededDryRun.Add(table, 1)
+			}
+			txs.logQueueExceededDryRun.Warningf("Would have rejected BeginExecute RPC because there are too many queued transactions (%d >= %d)", size, maxQueueSize)
+		}
+		q.count.Add(1)
+		for {
+			peak := q.max.Load()
+			if size+1 <= peak || q.max.CompareAndSwap(peak, size+1) {
+				break
+			}
+		}
+		return true, nil
 	}
+}
 
-	// Give up slot by removing ourselves from the channel.
-	// Wakes up the next queued transaction.
+// leave removes this transaction from the Queue, and gives its slot to the
+// next waiting transaction if it had one. The last transaction to leave
+// removes the Queue.
+func (q *Queue) leave(returnSlot bool) {
+	txs := q.txs
+	if returnSlot {
+		q.releaseSlot()
+	}
+	txs.globalSize.Add(-1)
+	q.exit()
+}
 
-	if txs.dryRun {
-		// Dry-run did not acquire a slot in the first place.
+// exit removes a transaction from the size of the Queue. The last transaction
+// to exit removes the Queue.
+func (q *Queue) exit() {
+	txs := q.txs
+	if q.size.Add(-1) != 0 || !q.size.CompareAndSwap(0, -1) {
 		return
 	}
 
-	if !returnSlot {
-		// We did not acquire a slot in the first place e.g. due to a canceled context.
-		return
+	// This was the last transaction in flight.
+	txs.queues.CompareAndDelete(q.key, q)
+	if peak, count := q.max.Load(), q.count.Load(); peak > 1 {
+		logMsg := fmt.Sprintf("%v simultaneous transactions (%v in total) would have been queued.", peak, count)
+		if txs.dryRun {
+			txs.logDryRun.Infof(logMsg)
+		} else {
+			txs.log.Infof(logMsg)
+		}
 	}
+}
 
-	if q.onTheFlySize > q.maxConcurrency {
-		// Due to resizing, we may have more than maxConcurrency transactions in flight.
-		q.onTheFlySize--
-		return
+// releaseSlot gives a slot back, which wakes up the first waiting
+// transaction, if any. A slot is dropped instead if the Queue was resized
+// below the number of transactions in flight.
+func (q *Queue) releaseSlot() {
+	if !q.payDebt() {
+		q.slots <- struct{}{}
+		q.dispatch()
 	}
+}
 
-	hasReleasedOne := false
-	for q.waitingRequest.Len() > 0 {
-		front := q.waitingRequest.Front()
-		q.waitingRequest.Remove(front)
-		ch := front.Value.(chan struct{})
-		// this should never block
-		_, ok := <-ch
-		if ok {
-			hasReleasedOne = true
-			break
-		}
-		// !ok means ch is closed due to timeout, and the ch will not be removed from the list by the requester
-		// because the doneFunc returned to it is nil, so here we should remove closed ch, and find the next valid ch to remove.
+// dispatch hands the free slots over to the fair waiting transactions.
+func (q *Queue) dispatch() {
+	if q.fair.size.Load() == 0 {
+		return
 	}
+	q.fair.mu.Lock()
+	defer q.fair.mu.Unlock()
+	q.fair.dispatchLocked(q.slots)
+}
 
-	if !hasReleasedOne {
-		q.onTheFlySize--
+// payDebt drops a slot owed since the Queue was resized, and returns false
+// if no slot is owed.
+func (q *Queue) payDebt() bool {
+	for {
+		debt := q.debt.Load()
+		if debt == 0 {
+			return false
+		}
+		if q.debt.CompareAndSwap(debt, debt-1) {
+			return true
+		}
 	}
 }
 
 // Pending returns the number of queued transactions (including the ones which
 // are currently in flight.)
 func (txs *ConcurrencyController) Pending(key string) int {
-	txs.mu.Lock()
-	defer txs.mu.Unlock()
-
-	q, ok := txs.queues[key]
-	if !ok {
+	q := txs.getQueue(key)
+	if q == nil {
 		return 0
 	}
-	return q.size
+	return int(max(q.size.Load(), 0))
 }
 
 // ServeHTTP lists the most recent, cached queries and their count.
@@ -379,75 +521,207 @@ func (txs *ConcurrencyController) ServeHTTP(response http.ResponseWriter, reques
 	}
 }
 
+// maxSlots is the capacity of the slots channel of a Queue. A channel of
+// empty structs doesn't allocate a buffer, so the capacity is free, and
+// releasing a slot never blocks.
+const maxSlots = 1 << 30
+
 // Queue represents the local Queue for a particular row (range).
 //
 // Note that we don't use a dedicated Queue structure for all waiting
 // transactions. Instead, we leverage that Go routines waiting for a channel
-// are woken up in the order they are queued up. The "availableSlots" field is
-// said channel which has n free slots (for the number of concurrent
-// transactions which can access the tx pool). All queued transactions are
-// competing for these slots and try to add themselves to the channel.
+// are woken up in the order they are queued up. The "slots" field is said
+// channel, which holds a token per free slot (for the number of concurrent
+// transactions which can access the tx pool). A transaction takes a token to
+// run, and gives it back once done, which hands it over to the transaction
+// that waits the longest.
 type Queue struct {
-	// NOTE: The following fields are guarded by ConcurrencyController.mu.
 	key string
+
 	// maxQueueSize is the maximum number of transactions which can be queued, including the ones that are in flight.
-	maxQueueSize int
+	maxQueueSize atomic.Int64
 	// maxConcurrency is the maximum number of transactions which can be executed concurrently.
-	maxConcurrency int
+	maxConcurrency atomic.Int64
 
 	// size counts how many transactions are currently queued/in flight (includes
-	// the transactions which are not waiting.)
-	size int
+	// the transactions which are not waiting.) It is -1 once the last
+	// transaction left, and the Queue must not be used anymore.
+	size atomic.Int64
 	// count is the same as "size", but never gets decremented.
-	count int
+	count atomic.Int64
 	// max is the max of "size", i.e. the maximum number of transactions which
 	// were simultaneously queued
-	max int
+	max atomic.Int64
+	// waiting is the number of transactions which wait for a slot.
+	waiting atomic.Int64
+
+	slots chan struct{}
+	// debt is the number of slots to drop when they are released instead of
+	// giving them back, because the Queue was resized below the number of
+	// transactions in flight.
+	debt atomic.Int64
+	// resizeMu serializes the resizes of the Queue.
+	resizeMu sync.Mutex
+	// fair holds the transactions waiting fairly.
+	fair fairWaiters
 
-	// onTheFlySize is the number of transactions which are currently in flight,
-	// it may be greater than maxConcurrency due to queue resizing.
-	onTheFlySize int
+	txs *ConcurrencyController
+}
 
-	// waitingRequest is a list of channels representing transactions which are currently queued.
-	waitingRequest list.List
+// fairWaiters are the transactions waiting fairly for a slot, by lane then by
+// caller. The slots go to the first lane with waiting transactions, and to
+// its callers in turn.
+type fairWaiters struct {
+	mu sync.Mutex
+	// lanes are the waiting transactions of each lane, the first lane first.
+	lanes []fairLane
+	// size is the number of waiting transactions, read without the lock.
+	size atomic.Int64
+}
 
-	txs *ConcurrencyController
+// fairLane are the transactions of a lane waiting for a slot, by caller.
+type fairLane struct {
+	// callers are the callers with waiting transactions, in the order of
+	// their turns, and next is the caller whose turn is next.
+	callers []string
+	next    int
+	// turns are the channels the slots are handed over to, by caller, in
+	// arrival order.
+	turns map[string][]chan struct{}
+}
+
+// push adds a waiting transaction of a caller to a lane, and returns the
+// channel its slot will be handed over to.
+func (fw *fairWaiters) push(lane int, caller string) chan struct{} {
+	for len(fw.lanes) <= lane {
+		fw.lanes = append(fw.lanes, fairLane{turns: make(map[string][]chan struct{})})
+	}
+	l := &fw.lanes[lane]
+	turns, ok := l.turns[caller]
+	if !ok {
+		l.callers = append(l.callers, caller)
+	}
+	turn := make(chan struct{}, 1)
+	l.turns[caller] = append(turns, turn)
+	fw.size.Add(1)
+	return turn
+}
+
+// dispatchLocked hands the free slots over to the waiting transactions, the
+// first lane first, one caller after the other.
+func (fw *fairWaiters) dispatchLocked(slots chan struct{}) {
+	for {
+		l := fw.firstLane()
+		if l == nil {
+			return
+		}
+		select {
+		case <-slots:
+		default:
+			return
+		}
+		caller := l.callers[l.next]
+		turns := l.turns[caller]
+		turns[0] <- struct{}{}
+		fw.size.Add(-1)
+		if len(turns) == 1 {
+			l.removeCaller(l.next)
+		} else {
+			l.turns[caller] = turns[1:]
+			l.next++
+		}
+		if l.next >= len(l.callers) {
+			l.next = 0
+		}
+	}
+}
+
+// firstLane returns the first lane with waiting transactions, nil if there
+// is none.
+func (fw *fairWaiters) firstLane() *fairLane {
+	for i := range fw.lanes {
+		if len(fw.lanes[i].callers) > 0 {
+			return &fw.lanes[i]
+		}
+	}
+	return nil
+}
+
+// remove removes a waiting transaction of a caller from a lane, and returns
+// false if its slot was already handed over.
+func (fw *fairWaiters) remove(lane int, caller string, turn chan struct{}) bool {
+	l := &fw.lanes[lane]
+	turns := l.turns[caller]
+	i := slices.Index(turns, turn)
+	if i < 0 {
+		return false
+	}
+	fw.size.Add(-1)
+	if len(turns) > 1 {
+		l.turns[caller] = slices.Delete(turns, i, i+1)
+		return true
+	}
+	j := slices.Index(l.callers, caller)
+	l.removeCaller(j)
+	if j < l.next {
+		l.next--
+	}
+	if l.next >= len(l.callers) {
+		l.next = 0
+	}
+	return true
+}
+
+// removeCaller removes the i-th caller, which has no waiting transaction
+// anymore.
+func (l *fairLane) removeCaller(i int) {
+	delete(l.turns, l.callers[i])
+	l.callers = slices.Delete(l.callers, i, i+1)
 }
 
 func newQueue(key string, txs *ConcurrencyController, maxQueueSize, maxConcurrency int) *Queue {
-	return &Queue{
-		key:            key,
-		maxQueueSize:   maxQueueSize,
-		maxConcurrency: maxConcurrency,
-		size:           0,
-		count:          0,
-		max:            0,
-		txs:            txs,
+	maxConcurrency = min(maxConcurrency, maxSlots)
+	q := &Queue{
+		key:   key,
+		slots: make(chan struct{}, maxSlots),
+		txs:   txs,
 	}
+	q.maxQueueSize.Store(int64(maxQueueSize))
+	q.maxConcurrency.Store(int64(maxConcurrency))
+	for i := 0; i < maxConcurrency; i++ {
+		q.slots <- struct{}{}
+	}
+	return q
+}
+
+// inFlight returns the number of transactions which are currently in flight,
+// it may be greater than maxConcurrency due to queue resizing.
+func (q *Queue) inFlight() int {
+	return int(q.maxConcurrency.Load() + q.debt.Load() - int64(len(q.slots)))
 }
 
 func (q *Queue) resizeQueue(newMaxQueueSize, newMaxConcurrency int) {
-	// lock to make sure there are no resource requesting and releasing during resizing progress.
-	q.txs.mu.Lock()
-	defer q.txs.mu.Unlock()
-
-	q.maxQueueSize = newMaxQueueSize
-
-	if newMaxConcurrency > q.maxConcurrency {
-		delta := newMaxConcurrency - q.maxConcurrency
-		for delta > 0 && q.waitingRequest.Len() > 0 {
-			front := q.waitingRequest.Front()
-			q.waitingRequest.Remove(front)
-			ch := front.Value.(chan struct{})
-			_, ok := <-ch
-			if ok {
-				delta--
-				q.onTheFlySize++
-			}
+	newMaxConcurrency = min(newMaxConcurrency, maxSlots)
+	q.resizeMu.Lock()
+	defer q.resizeMu.Unlock()
+
+	q.maxQueueSize.Store(int64(newMaxQueueSize))
+	delta := int64(newMaxConcurrency) - q.maxConcurrency.Swap(int64(newMaxConcurrency))
+	// New slots first cancel the slots owed by a previous shrink, then wake
+	// up waiting transactions.
+	for ; delta > 0; delta-- {
+		if !q.payDebt() {
+			q.slots <- struct{}{}
+		}
+	}
+	q.dispatch()
+	// Removed slots are taken from the free ones. When there are not enough,
+	// the transactions in flight drop their slot when they are done.
+	for ; delta < 0; delta++ {
+		select {
+		case <-q.slots:
+		default:
+			q.debt.Add(1)
 		}
 	}
-	// if newMaxConcurrency <= maxConcurrency, just set q.MaxConcurrency to new value,
-	// which will lead q.onTheFlySize greater than q.MaxConcurrency,
-	// we don't need to do anything more.
-	q.maxConcurrency = newMaxConcurrency
 }
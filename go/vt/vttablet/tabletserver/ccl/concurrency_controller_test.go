@@ -27,6 +27,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -166,7 +167,7 @@ func TestConcurrencyController(t *testing.T) {
 	// tx2 must have been unblocked.
 	wg.Wait()
 
-	if txs.queues["t1 where1"] != nil {
+	if txs.getQueue("t1 where1") != nil {
 		t.Error("Queue object was not deleted after last transaction")
 	}
 
@@ -240,7 +241,7 @@ func TestConcurrencyController_ConcurrentTransactions(t *testing.T) {
 	// Finish tx1 to delete the Queue object.
 	done1()
 
-	if txs.queues["t1 where1"] != nil {
+	if txs.getQueue("t1 where1") != nil {
 		t.Error("Queue object was not deleted after last transaction")
 	}
 
@@ -385,7 +386,7 @@ func TestConcurrencyControllerCancel(t *testing.T) {
 	// Finish tx2 (the last transaction) which will delete the Queue object.
 	done2()
 
-	if txs.queues["t1 where1"] != nil {
+	if txs.getQueue("t1 where1") != nil {
 		t.Error("Queue object was not deleted after last transaction")
 	}
 
@@ -452,7 +453,7 @@ func TestConcurrencyControllerDryRun(t *testing.T) {
 	done2()
 	done3()
 
-	if txs.queues["t1 where1"] != nil {
+	if txs.getQueue("t1 where1") != nil {
 		t.Error("Queue object was not deleted after last transaction")
 	}
 
@@ -528,6 +529,109 @@ func BenchmarkConcurrencyController_NoHotRow(b *testing.B) {
 	}
 }
 
+// BenchmarkConcurrencyControllerParallel runs transactions on many row
+// ranges at the same time, with a few of them queued on a hot one.
+func BenchmarkConcurrencyControllerParallel(b *testing.B) {
+	txs := NewConcurrentControllerForTest(1000000, false)
+	var next atomic.Int64
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		key := fmt.Sprintf("t1 where%d", next.Add(1))
+		for i := 0; pb.Next(); i++ {
+			k := key
+			if i%10 == 0 {
+				k = "t1 hot"
+			}
+			q := txs.GetOrCreateQueue(k, 1000, 4)
+			done, _, err := q.Wait(context.Background(), []string{"t1"})
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			done()
+		}
+	})
+}
+
+// TestConcurrencyControllerGetOrCreateQueueResize changes the limits of a
+// Queue which has a transaction in flight.
+func TestConcurrencyControllerGetOrCreateQueueResize(t *testing.T) {
+	txs := NewConcurrentControllerForTest(10, false)
+	q := txs.GetOrCreateQueue("t1 where1", 2, 1)
+	done1 := startATransactionShouldNotWait(t, q, 1, []string{"t1"})
+
+	q2 := txs.GetOrCreateQueue("t1 where1", 3, 2)
+	assert.Same(t, q, q2)
+	assert.EqualValues(t, 3, q.maxQueueSize.Load())
+	done2 := startATransactionShouldNotWait(t, q, 2, []string{"t1"})
+	assert.Equal(t, 2, q.inFlight())
+
+	done1()
+	done2()
+	assert.Nil(t, txs.getQueue("t1 where1"))
+	assert.Equal(t, 0, txs.Pending("t1 where1"))
+	// A Queue that was removed is replaced by a new one.
+	done3 := startATransactionShouldNotWait(t, q, 3, []string{"t1"})
+	assert.Equal(t, 1, txs.Pending("t1 where1"))
+	assert.NotSame(t, q, txs.getQueue("t1 where1"))
+	done3()
+	assert.Nil(t, txs.getQueue("t1 where1"))
+}
+
+// TestConcurrencyControllerResizeQueues grows the queues of a prefix while a
+// transaction waits in one of them, which gets its slot right away.
+func TestConcurrencyControllerResizeQueues(t *testing.T) {
+	txs := NewConcurrentControllerForTest(10, false)
+	q := txs.GetOrCreateQueue("rule1/t1", 3, 1)
+	other := txs.GetOrCreateQueue("rule2/t1", 3, 1)
+	done1 := startATransactionShouldNotWait(t, q, 1, []string{"t1"})
+	done2 := startATransactionShouldNotWait(t, other, 2, []string{"t1"})
+
+	txGetResource := make(chan int)
+	var done3 DoneFunc
+	startATransactionShouldWait(t, q, 3, txGetResource, nil, 0, &done3)
+
+	assert.Equal(t, 1, txs.ResizeQueues("rule1/", 4, 2))
+	assert.Equal(t, 3, <-txGetResource)
+	assert.EqualValues(t, 4, q.maxQueueSize.Load())
+	assert.Equal(t, 2, q.inFlight())
+	assert.EqualValues(t, 1, other.maxConcurrency.Load())
+	// The queues which already have the limits are left alone.
+	assert.Zero(t, txs.ResizeQueues("rule1/", 4, 2))
+
+	done1()
+	done2()
+	done3()
+	assert.Nil(t, txs.getQueue("rule1/t1"))
+	assert.Zero(t, txs.ResizeQueues("rule1/", 3, 1))
+}
+
+func TestConcurrencyControllerObserve(t *testing.T) {
+	txs := NewConcurrentControllerForTest(1, false)
+	q := txs.GetOrCreateQueue("t1 where1", 2, 1)
+
+	// The observed transactions never wait, but tell when they would have.
+	done1, wouldWait, wouldErr := q.Observe()
+	assert.False(t, wouldWait)
+	assert.NoError(t, wouldErr)
+	done2, wouldWait, wouldErr := q.Observe()
+	assert.True(t, wouldWait)
+	assert.NoError(t, wouldErr)
+	done3, wouldWait, wouldErr := q.Observe()
+	assert.True(t, wouldWait)
+	assert.ErrorContains(t, wouldErr, "too many queued transactions (2 >= 2)")
+	assert.Equal(t, 3, txs.Pending("t1 where1"))
+	// They don't count in the global Queue, nor take its slots.
+	assert.EqualValues(t, 0, txs.globalSize.Get())
+	assert.Equal(t, 0, q.inFlight())
+
+	done1()
+	done2()
+	done3()
+	assert.Nil(t, txs.getQueue("t1 where1"))
+}
+
 func TestConcurrencyController_DenyAll_global(t *testing.T) {
 	txs := NewConcurrentControllerForTest(0, false)
 	q := txs.GetOrCreateQueue("t1 where1", 1, 1)
@@ -591,7 +695,7 @@ func TestConcurrencyController_DenyAll_concurrency(t *testing.T) {
 // TestConcurrencyControllerWaitingRequest runs 3 pending transactions.
 // tx1 and tx2 are allowed to run concurrently while tx3 are queued.
 // tx3 will get canceled.
-// this is to test q.waitingRequest work correctly.
+// this is to test q.waiting work correctly.
 func TestConcurrencyControllerWaitingRequest(t *testing.T) {
 	txs := NewConcurrentControllerForTest(4, false)
 	resetVariables(txs)
@@ -635,7 +739,7 @@ func TestConcurrencyControllerWaitingRequest(t *testing.T) {
 	}
 
 	// tx3 is waiting.
-	assert.Equal(t, 1, q.waitingRequest.Len())
+	assert.Eventually(t, func() bool { return q.waiting.Load() == 1 }, time.Second, time.Millisecond)
 
 	// Cancel tx3.
 	cancel3()
@@ -643,21 +747,20 @@ func TestConcurrencyControllerWaitingRequest(t *testing.T) {
 		t.Errorf("tx3 should have been unblocked after the cancel: %v", got)
 	}
 
-	// onTheFlySize should be 2 because currently tx1 and tx2 are running.
-	assert.Equal(t, 2, q.onTheFlySize)
-	// Though tx3 has been canceled, its ch (which is already closed) still remains in the list.
-	assert.Equal(t, 1, q.waitingRequest.Len())
+	// inFlight should be 2 because currently tx1 and tx2 are running.
+	assert.Equal(t, 2, q.inFlight())
+	// tx3 stopped waiting as soon as it was canceled.
+	assert.EqualValues(t, 0, q.waiting.Load())
 
 	// Finish tx1.
 	done1()
-	// onTheFlySize should be 1 because currently only tx2 is running.
-	assert.Equal(t, 1, q.onTheFlySize)
-	// the ch remains by tx3 should be 1 removed.
-	assert.Equal(t, 0, q.waitingRequest.Len())
+	// inFlight should be 1 because currently only tx2 is running.
+	assert.Equal(t, 1, q.inFlight())
+	assert.EqualValues(t, 0, q.waiting.Load())
 
 	// Finish tx2 (the last transaction) which will delete the Queue object.
 	done2()
-	if txs.queues["t1 where1"] != nil {
+	if txs.getQueue("t1 where1") != nil {
 		t.Error("Queue object was not deleted after last transaction")
 	}
 }
@@ -721,8 +824,8 @@ func TestConcurrencyControllerResizeQueue(t *testing.T) {
 		t.Errorf("tx3 should have been unblocked after the resize: %v", got)
 	}
 
-	assert.Equal(t, 2, q.onTheFlySize)
-	assert.Equal(t, 0, q.waitingRequest.Len())
+	assert.Equal(t, 2, q.inFlight())
+	assert.EqualValues(t, 0, q.waiting.Load())
 
 	// tx4 should not wait.
 	done4 := startATransactionShouldNotWait(t, q, 4, []string{"t1"})
@@ -747,9 +850,9 @@ func TestConcurrencyControllerResizeQueue(t *testing.T) {
 		t.Errorf("tx5 should have been unblocked after tx1 and tx3 finish: %v", got)
 	}
 
-	assert.Equal(t, 2, q.onTheFlySize)
+	assert.Equal(t, 2, q.inFlight())
 	// now only tx6 is waiting.
-	assert.Equal(t, 1, q.waitingRequest.Len())
+	assert.EqualValues(t, 1, q.waiting.Load())
 
 	// we finish tx4, and tx6 will unblock.
 	txReleased = 3
@@ -758,8 +861,8 @@ func TestConcurrencyControllerResizeQueue(t *testing.T) {
 		t.Errorf("tx6 should have been unblocked after tx4 finish: %v", got)
 	}
 
-	assert.Equal(t, 2, q.onTheFlySize)
-	assert.Equal(t, 0, q.waitingRequest.Len())
+	assert.Equal(t, 2, q.inFlight())
+	assert.EqualValues(t, 0, q.waiting.Load())
 
 	// tx7 should wait.
 	var done7 DoneFunc
@@ -777,9 +880,9 @@ func TestConcurrencyControllerResizeQueue(t *testing.T) {
 	if got := <-txGetResource; got != 7 {
 		t.Errorf("tx7 should have been unblocked after the resize: %v", got)
 	}
-	assert.Equal(t, 3, q.onTheFlySize)
+	assert.Equal(t, 3, q.inFlight())
 	// tx8 is still waiting.
-	assert.Equal(t, 1, q.waitingRequest.Len())
+	assert.EqualValues(t, 1, q.waiting.Load())
 
 	// clear txReleased and recount
 	txReleased = 1
@@ -790,8 +893,8 @@ func TestConcurrencyControllerResizeQueue(t *testing.T) {
 		t.Errorf("tx8 should have been unblocked after tx5 finish: %v", got)
 	}
 	// tx6, tx7, tx8 are on the fly.
-	assert.Equal(t, 3, q.onTheFlySize)
-	assert.Equal(t, 0, q.waitingRequest.Len())
+	assert.Equal(t, 3, q.inFlight())
+	assert.EqualValues(t, 0, q.waiting.Load())
 
 	// ---- 4. change MaxQueueSize. ----
 	q.resizeQueue(3, 3)
@@ -811,12 +914,98 @@ func TestConcurrencyControllerResizeQueue(t *testing.T) {
 	if got := <-txGetResource; got != 9 {
 		t.Errorf("tx9 should have been unblocked after tx6 finish: %v", got)
 	}
-	assert.Equal(t, 3, q.onTheFlySize)
-	assert.Equal(t, 0, q.waitingRequest.Len())
+	assert.Equal(t, 3, q.inFlight())
+	assert.EqualValues(t, 0, q.waiting.Load())
 	done7()
 	done8()
 	done9()
-	assert.Equal(t, 0, q.onTheFlySize)
-	assert.Equal(t, 0, q.waitingRequest.Len())
-	assert.Nil(t, txs.queues["t1"])
+	assert.Equal(t, 0, q.inFlight())
+	assert.EqualValues(t, 0, q.waiting.Load())
+	assert.Nil(t, txs.getQueue("t1"))
+}
+
+func TestConcurrencyControllerWaitFair(t *testing.T) {
+	txs := NewConcurrentControllerForTest(100, false)
+	q := txs.GetOrCreateQueue("t1 where1", 10, 1)
+	done, waited, err := q.WaitFair(context.Background(), []string{"t1"}, "noisy")
+	assert.NoError(t, err)
+	assert.False(t, waited)
+
+	// The noisy caller queues three transactions before the quiet one, and
+	// a fourth one, whose context is cancelled.
+	admitted := make(chan string)
+	wait := func(ctx context.Context, caller string, i int) {
+		go func() {
+			done, waited, err := q.WaitFair(ctx, []string{"t1"}, caller)
+			if err != nil {
+				admitted <- err.Error()
+				return
+			}
+			assert.True(t, waited)
+			admitted <- fmt.Sprintf("%s%d", caller, i)
+			<-admitted
+			done()
+		}()
+		assert.Eventually(t, func() bool { return q.waiting.Load() == int64(i) }, time.Second, time.Millisecond)
+	}
+	for i := 1; i <= 3; i++ {
+		wait(context.Background(), "noisy", i)
+	}
+	wait(context.Background(), "quiet", 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	wait(ctx, "noisy", 5)
+	cancel()
+	assert.Equal(t, "context canceled", <-admitted)
+
+	// The callers are admitted in turn.
+	done()
+	for _, expected := range []string{"noisy1", "quiet4", "noisy2", "noisy3"} {
+		assert.Equal(t, expected, <-admitted)
+		admitted <- ""
+	}
+	assert.Eventually(t, func() bool { return txs.getQueue("t1 where1") == nil }, time.Second, time.Millisecond)
+	assert.Zero(t, q.fair.size.Load())
+}
+
+func TestConcurrencyControllerWaitLane(t *testing.T) {
+	txs := NewConcurrentControllerForTest(100, false)
+	q := txs.GetOrCreateQueue("t1 where1", 10, 1)
+	done, waited, err := q.WaitLane(context.Background(), []string{"t1"}, 1, "")
+	assert.NoError(t, err)
+	assert.False(t, waited)
+
+	// The low priority transactions queue before the high priority ones, a
+	// high priority one cancels its wait.
+	admitted := make(chan string)
+	wait := func(ctx context.Context, lane int, name string, i int) {
+		go func() {
+			done, waited, err := q.WaitLane(ctx, []string{"t1"}, lane, "")
+			if err != nil {
+				admitted <- err.Error()
+				return
+			}
+			assert.True(t, waited)
+			admitted <- name
+			<-admitted
+			done()
+		}()
+		assert.Eventually(t, func() bool { return q.waiting.Load() == int64(i) }, time.Second, time.Millisecond)
+	}
+	wait(context.Background(), 2, "low1", 1)
+	wait(context.Background(), 2, "low2", 2)
+	wait(context.Background(), 1, "normal", 3)
+	wait(context.Background(), 0, "high", 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	wait(ctx, 0, "cancelled", 5)
+	cancel()
+	assert.Equal(t, "context canceled", <-admitted)
+
+	// The lanes are admitted in order, each one in arrival order.
+	done()
+	for _, expected := range []string{"high", "normal", "low1", "low2"} {
+		assert.Equal(t, expected, <-admitted)
+		admitted <- ""
+	}
+	assert.Eventually(t, func() bool { return txs.getQueue("t1 where1") == nil }, time.Second, time.Millisecond)
+	assert.Zero(t, q.fair.size.Load())
 }
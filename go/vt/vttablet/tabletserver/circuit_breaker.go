@@ -0,0 +1,198 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	circuitBreakerEventOpened   = "opened"
+	circuitBreakerEventClosed   = "closed"
+	circuitBreakerEventRejected = "rejected"
+)
+
+type circuitState int
+
+const (
+	// circuitClosed lets the queries through, and counts their failures.
+	circuitClosed circuitState = iota
+	// circuitOpen rejects the queries until the cool-down is over.
+	circuitOpen
+	// circuitHalfOpen lets a few probe queries through: the circuit closes
+	// once they all succeed, and opens again as soon as one fails.
+	circuitHalfOpen
+)
+
+// circuitBreakerConfig are the thresholds of a CIRCUIT_BREAKER rule.
+type circuitBreakerConfig struct {
+	// ErrorRate is the percentage of the queries of a window which have to
+	// fail to open the circuit.
+	ErrorRate float64
+	// Latency, if set, counts the queries slower than it as failures.
+	Latency time.Duration
+	// MinRequests is the number of queries of a window below which the
+	// circuit stays closed.
+	MinRequests int
+	Window      time.Duration
+	CoolDown    time.Duration
+	// HalfOpenRequests is the number of probe queries of a half-open circuit.
+	HalfOpenRequests int
+}
+
+// circuitBreakers are the circuits of the CIRCUIT_BREAKER rules, by rule. The
+// queries matched by a rule share its circuit, whatever their plan.
+type circuitBreakers struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{breakers: make(map[string]*circuitBreaker)}
+}
+
+// get returns the circuit of a rule, which starts closed again when its
+// thresholds change.
+func (cbs *circuitBreakers) get(ruleName string, config circuitBreakerConfig) *circuitBreaker {
+	cbs.mu.Lock()
+	defer cbs.mu.Unlock()
+	cb, ok := cbs.breakers[ruleName]
+	if !ok || cb.config != config {
+		cb = &circuitBreaker{config: config}
+		cbs.breakers[ruleName] = cb
+	}
+	return cb
+}
+
+// retain drops the circuits of the rules which are not in ruleNames.
+func (cbs *circuitBreakers) retain(ruleNames map[string]bool) {
+	cbs.mu.Lock()
+	defer cbs.mu.Unlock()
+	for ruleName := range cbs.breakers {
+		if !ruleNames[ruleName] {
+			delete(cbs.breakers, ruleName)
+		}
+	}
+}
+
+// clear drops all the circuits.
+func (cbs *circuitBreakers) clear() {
+	cbs.mu.Lock()
+	defer cbs.mu.Unlock()
+	cbs.breakers = make(map[string]*circuitBreaker)
+}
+
+// circuitBreakerState is the checkpointed state of a circuit.
+type circuitBreakerState struct {
+	Config      circuitBreakerConfig
+	State       circuitState
+	WindowStart time.Time
+	Requests    int
+	Failures    int
+	Since       time.Time
+}
+
+// states returns the state of the circuits, by rule.
+func (cbs *circuitBreakers) states() map[string]circuitBreakerState {
+	cbs.mu.Lock()
+	defer cbs.mu.Unlock()
+	states := make(map[string]circuitBreakerState, len(cbs.breakers))
+	for ruleName, cb := range cbs.breakers {
+		cb.mu.Lock()
+		states[ruleName] = circuitBreakerState{Config: cb.config, State: cb.state, WindowStart: cb.windowStart, Requests: cb.requests, Failures: cb.failures, Since: cb.since}
+		cb.mu.Unlock()
+	}
+	return states
+}
+
+// restore sets the state of the circuits, which get keeps as long as the
+// thresholds of their rule don't change. The probes of a half-open circuit
+// start over, since the ones in flight were lost.
+func (cbs *circuitBreakers) restore(states map[string]circuitBreakerState) {
+	cbs.mu.Lock()
+	defer cbs.mu.Unlock()
+	for ruleName, state := range states {
+		cbs.breakers[ruleName] = &circuitBreaker{config: state.Config, state: state.State, windowStart: state.WindowStart, requests: state.Requests, failures: state.Failures, since: state.Since}
+	}
+}
+
+// circuitBreaker counts the queries and the failures of a rule in fixed
+// windows, and opens when too many of them fail.
+type circuitBreaker struct {
+	config circuitBreakerConfig
+
+	mu          sync.Mutex
+	state       circuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	// since is when the circuit opened, or became half-open.
+	since     time.Time
+	probes    int
+	successes int
+}
+
+// allow returns whether a query may run.
+func (cb *circuitBreaker) allow(now time.Time) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case circuitOpen:
+		if now.Sub(cb.since) < cb.config.CoolDown {
+			return false
+		}
+		cb.state, cb.since, cb.probes, cb.successes = circuitHalfOpen, now, 0, 0
+	case circuitHalfOpen:
+		// The probes which never report, like the ones cancelled by another
+		// action, don't keep the circuit half-open forever.
+		if cb.probes >= cb.config.HalfOpenRequests && now.Sub(cb.since) >= cb.config.CoolDown {
+			cb.since, cb.probes, cb.successes = now, 0, 0
+		}
+	default:
+		return true
+	}
+	if cb.probes >= cb.config.HalfOpenRequests {
+		return false
+	}
+	cb.probes++
+	return true
+}
+
+// record counts the outcome of a query allowed to run, and returns
+// circuitBreakerEventOpened or circuitBreakerEventClosed if it changed the
+// state of the circuit, or "".
+func (cb *circuitBreaker) record(now time.Time, failed bool) string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case circuitOpen:
+		// The queries which started before the circuit opened.
+		return ""
+	case circuitHalfOpen:
+		if failed {
+			cb.state, cb.since = circuitOpen, now
+			return circuitBreakerEventOpened
+		}
+		if cb.successes++; cb.successes < cb.config.HalfOpenRequests {
+			return ""
+		}
+		cb.state, cb.windowStart, cb.requests, cb.failures = circuitClosed, now, 0, 0
+		return circuitBreakerEventClosed
+	}
+	if now.Sub(cb.windowStart) >= cb.config.Window {
+		cb.windowStart, cb.requests, cb.failures = now, 0, 0
+	}
+	cb.requests++
+	if failed {
+		cb.failures++
+	}
+	if cb.requests >= cb.config.MinRequests && float64(cb.failures)*100 >= cb.config.ErrorRate*float64(cb.requests) {
+		cb.state, cb.since = circuitOpen, now
+		return circuitBreakerEventOpened
+	}
+	return ""
+}
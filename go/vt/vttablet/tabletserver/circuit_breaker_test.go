@@ -0,0 +1,67 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	config := circuitBreakerConfig{ErrorRate: 50, MinRequests: 4, Window: 10 * time.Second, CoolDown: 30 * time.Second, HalfOpenRequests: 2}
+	cb := newCircuitBreakers().get("test_rule", config)
+	now := time.Now()
+
+	// The circuit stays closed below the minimum of queries, and below the
+	// error rate.
+	for _, failed := range []bool{true, true, true} {
+		assert.True(t, cb.allow(now))
+		assert.Empty(t, cb.record(now, failed))
+	}
+	// The failures of a window are forgotten in the next one.
+	now = now.Add(10 * time.Second)
+	for _, failed := range []bool{false, false, true} {
+		assert.True(t, cb.allow(now))
+		assert.Empty(t, cb.record(now, failed))
+	}
+	assert.True(t, cb.allow(now))
+	assert.Equal(t, circuitBreakerEventOpened, cb.record(now, true))
+	assert.False(t, cb.allow(now.Add(29*time.Second)))
+
+	// After the cool-down, a failed probe opens the circuit again.
+	now = now.Add(30 * time.Second)
+	assert.True(t, cb.allow(now))
+	assert.True(t, cb.allow(now))
+	assert.False(t, cb.allow(now))
+	assert.Equal(t, circuitBreakerEventOpened, cb.record(now, true))
+	assert.Empty(t, cb.record(now, false))
+	assert.False(t, cb.allow(now))
+
+	// And the successful probes close it.
+	now = now.Add(30 * time.Second)
+	assert.True(t, cb.allow(now))
+	assert.True(t, cb.allow(now))
+	assert.Empty(t, cb.record(now, false))
+	assert.Equal(t, circuitBreakerEventClosed, cb.record(now, false))
+	assert.True(t, cb.allow(now))
+
+	// The probes which never report are replaced after a cool-down.
+	cb.state, cb.since = circuitOpen, now
+	now = now.Add(30 * time.Second)
+	assert.True(t, cb.allow(now))
+	assert.True(t, cb.allow(now))
+	assert.False(t, cb.allow(now.Add(29*time.Second)))
+	assert.True(t, cb.allow(now.Add(30*time.Second)))
+
+	// The circuit of a rule starts over when its thresholds change.
+	circuitBreakers := newCircuitBreakers()
+	assert.Same(t, circuitBreakers.get("test_rule", config), circuitBreakers.get("test_rule", config))
+	cb = circuitBreakers.get("test_rule", config)
+	config.ErrorRate = 90
+	assert.NotSame(t, cb, circuitBreakers.get("test_rule", config))
+}
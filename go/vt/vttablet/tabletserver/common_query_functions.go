@@ -9,12 +9,15 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"vitess.io/vitess/go/mysql/collations"
 	"vitess.io/vitess/go/sqltypes"
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
 	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/connpool"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
 )
 
 // CommonQuery is a universal RPC interface.
@@ -29,6 +32,10 @@ func (tsv *TabletServer) CommonQuery(_ context.Context, queryFunctionName string
 	switch queryFunctionName {
 	case "TabletsPlans":
 		return tsv.qe.TabletsPlans(tsv.alias)
+	case "PoolStats":
+		return tsv.PoolStats()
+	case "RuleStats":
+		return tsv.RuleStats()
 	default:
 		return nil, fmt.Errorf("query function %s not found", queryFunctionName)
 	}
@@ -97,3 +104,75 @@ func (qe *QueryEngine) TabletsPlans(alias *topodatapb.TabletAlias) (*sqltypes.Re
 		Rows:   rows,
 	}, nil
 }
+
+// PoolStats returns the usage of the connection pools, with the rows of
+// wescale_schema.pool_stats. The wait times are in microseconds.
+func (tsv *TabletServer) PoolStats() (*sqltypes.Result, error) {
+	formattedAlias := fmt.Sprintf("%v-%v", tsv.alias.Cell, tsv.alias.Uid)
+	pools := []*connpool.Pool{
+		tsv.qe.conns,
+		tsv.qe.streamConns,
+		tsv.qe.withoutDBConns,
+		tsv.qe.streamWithoutDBConns,
+		tsv.te.txPool.scp.conns,
+	}
+	rows := make([][]sqltypes.Value, 0, len(pools))
+	for _, pool := range pools {
+		rows = append(rows, []sqltypes.Value{
+			sqltypes.NewVarChar(formattedAlias),
+			sqltypes.NewVarChar(pool.Name()),
+			sqltypes.NewInt64(pool.Capacity()),
+			sqltypes.NewInt64(pool.Available()),
+			sqltypes.NewInt64(pool.Active()),
+			sqltypes.NewInt64(pool.InUse()),
+			sqltypes.NewInt64(pool.MaxCap()),
+			sqltypes.NewInt64(pool.WaitCount()),
+			sqltypes.NewInt64(pool.WaitTime().Microseconds()),
+			sqltypes.NewInt64(pool.IdleClosed()),
+			sqltypes.NewInt64(pool.Exhausted()),
+		})
+	}
+	return &sqltypes.Result{
+		Fields: sqltypes.MakeTestFields(
+			"tablet_alias|pool|capacity|available|active|in_use|max_capacity|wait_count|wait_time|idle_closed|exhausted",
+			"varchar|varchar|int64|int64|int64|int64|int64|int64|int64|int64|int64"),
+		Rows: rows,
+	}, nil
+}
+
+// RuleStats returns the query rules with the number of queries they matched
+// and affected, and the UTC time they last matched one, NULL if they never
+// did, with the rows of wescale_schema.rule_stats.
+func (tsv *TabletServer) RuleStats() (*sqltypes.Result, error) {
+	formattedAlias := fmt.Sprintf("%v-%v", tsv.alias.Cell, tsv.alias.Uid)
+	matches := tsv.stats.QueryRuleMatches.Counts()
+	affected := tsv.stats.QueryRuleAffected.Counts()
+	lastMatches := tsv.stats.QueryRuleLastMatch.Counts()
+	rows := [][]sqltypes.Value{}
+	tsv.qe.queryRuleSources.ForEachSource(func(ruleSource string, qrs *rules.Rules) {
+		qrs.ForEachRule(func(qr *rules.Rule) {
+			lastMatch := sqltypes.NULL
+			if unix, ok := lastMatches[qr.Name]; ok {
+				lastMatch = sqltypes.MakeTrusted(sqltypes.Datetime, []byte(time.Unix(unix, 0).UTC().Format(sqltypes.TimestampFormat)))
+			}
+			rows = append(rows, []sqltypes.Value{
+				sqltypes.NewVarChar(formattedAlias),
+				sqltypes.NewVarChar(ruleSource),
+				sqltypes.NewVarChar(qr.Name),
+				sqltypes.NewVarChar(qr.Description),
+				sqltypes.NewInt64(int64(qr.Priority)),
+				sqltypes.NewVarChar(qr.Status),
+				sqltypes.NewVarChar(qr.GetActionType()),
+				sqltypes.NewInt64(matches[qr.Name]),
+				sqltypes.NewInt64(affected[qr.Name]),
+				lastMatch,
+			})
+		})
+	})
+	return &sqltypes.Result{
+		Fields: sqltypes.MakeTestFields(
+			"tablet_alias|source|name|description|priority|status|action|match_count|affected_count|last_match_time",
+			"varchar|varchar|varchar|varchar|int64|varchar|varchar|int64|int64|datetime"),
+		Rows: rows,
+	}, nil
+}
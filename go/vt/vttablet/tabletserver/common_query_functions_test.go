@@ -0,0 +1,82 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+func TestCommonQueryPoolStats(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	ctx := context.Background()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	qr, err := tsv.CommonQuery(ctx, "PoolStats", nil)
+	require.NoError(t, err)
+	require.Len(t, qr.Fields, 11)
+	var pools []string
+	for _, row := range qr.Rows {
+		assert.Equal(t, "-0", row[0].ToString())
+		pools = append(pools, row[1].ToString())
+		assert.Equal(t, sqltypes.Int64, row[2].Type())
+	}
+	assert.Equal(t, []string{"ConnPool", "StreamConnPool", "ConnWithoutDBPool", "StreamWithoutDBConnPool", "TransactionPool"}, pools)
+}
+
+func TestCommonQueryRuleStats(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	query := "select * from test_table where name = 1 limit 1000"
+	db.AddQuery(query, &sqltypes.Result{Fields: getTestTableFields()})
+	db.AddQuery("select * from test_table where 1 != 1", &sqltypes.Result{Fields: getTestTableFields()})
+
+	ctx := context.Background()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	rulesName := "rule_stats_rules"
+	qrs := rules.New()
+	qrs.Add(rules.NewActiveQueryRule("deny all", "rule_stats_deny", rules.QRFail))
+	matchNothing := rules.NewActiveQueryRule("deny nothing", "rule_stats_nothing", rules.QRFail)
+	matchNothing.SetUserCond("nobody")
+	qrs.Add(matchNothing)
+	qrs.Add(rules.NewActiveQueryRule("let all through", "rule_stats_continue", rules.QRContinue))
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	_, err := newTestQueryExecutor(ctx, tsv, query, 0).Execute()
+	require.Error(t, err)
+
+	qr, err := tsv.CommonQuery(ctx, "RuleStats", nil)
+	require.NoError(t, err)
+	require.Len(t, qr.Fields, 10)
+	assert.Equal(t, sqltypes.Datetime, qr.Fields[9].Type)
+	matches := make(map[string]int64)
+	affected := make(map[string]int64)
+	lastMatches := make(map[string]bool)
+	for _, row := range qr.Rows {
+		if row[1].ToString() != rulesName {
+			continue
+		}
+		matches[row[2].ToString()], _ = row[7].ToInt64()
+		affected[row[2].ToString()], _ = row[8].ToInt64()
+		lastMatches[row[2].ToString()] = !row[9].IsNull()
+	}
+	// The CONTINUE rule matched the query without affecting it.
+	assert.Equal(t, map[string]int64{"rule_stats_deny": 1, "rule_stats_nothing": 0, "rule_stats_continue": 1}, matches)
+	assert.Equal(t, map[string]int64{"rule_stats_deny": 1, "rule_stats_nothing": 0, "rule_stats_continue": 0}, affected)
+	assert.Equal(t, map[string]bool{"rule_stats_deny": true, "rule_stats_nothing": false, "rule_stats_continue": true}, lastMatches)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"fmt"
+	"sync"
+
+	"vitess.io/vitess/go/vt/log"
+)
+
+// A concurrency pool is a concurrency budget of the tablet, which the
+// CONCURRENCY_CONTROL rules with the same pool param share: their queries wait
+// in one queue, whatever their rule and template, like
+//
+//	{"pool": "reporting", "max_queue_size": 40, "max_concurrency": 4}
+//
+// The limits of a pool are the ones of the first of its rules in the pipeline
+// order, see Rule.RunsBefore; the limits of the other rules are ignored.
+
+// cclPoolQueuePrefix returns the key of the queue of a pool.
+func cclPoolQueuePrefix(pool string) string {
+	return fmt.Sprintf("pool:%q", pool)
+}
+
+// concurrencyPoolLimits are the limits of a pool, set by a rule.
+type concurrencyPoolLimits struct {
+	MaxQueueSize   int
+	MaxConcurrency int
+	Rule           string
+}
+
+// concurrencyPools are the limits of the pools of the CONCURRENCY_CONTROL
+// rules of the tablet, by pool.
+type concurrencyPools struct {
+	mu     sync.Mutex
+	limits map[string]concurrencyPoolLimits
+}
+
+func newConcurrencyPools() *concurrencyPools {
+	return &concurrencyPools{limits: make(map[string]concurrencyPoolLimits)}
+}
+
+// get returns the limits of a pool, false if no rule has it.
+func (pools *concurrencyPools) get(pool string) (concurrencyPoolLimits, bool) {
+	pools.mu.Lock()
+	defer pools.mu.Unlock()
+	limits, ok := pools.limits[pool]
+	return limits, ok
+}
+
+// set replaces the limits of the pools with the ones of the actions of the
+// rules, which are in the pipeline order.
+func (pools *concurrencyPools) set(actions []*ConcurrencyControlAction) {
+	limits := make(map[string]concurrencyPoolLimits)
+	for _, p := range actions {
+		if p.Pool == "" {
+			continue
+		}
+		first, ok := limits[p.Pool]
+		if !ok {
+			limits[p.Pool] = concurrencyPoolLimits{MaxQueueSize: p.MaxQueueSize, MaxConcurrency: p.MaxConcurrency, Rule: p.Rule.Name}
+			continue
+		}
+		if first.MaxQueueSize != p.MaxQueueSize || first.MaxConcurrency != p.MaxConcurrency {
+			log.Warningf("the limits of rule %s are ignored: the limits of pool %s are the ones of rule %s", p.Rule.Name, p.Pool, first.Rule)
+		}
+	}
+	pools.mu.Lock()
+	defer pools.mu.Unlock()
+	pools.limits = limits
+}
@@ -0,0 +1,96 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+func TestConcurrencyPools(t *testing.T) {
+	action := func(name, pool string, maxQueueSize, maxConcurrency int) *ConcurrencyControlAction {
+		return &ConcurrencyControlAction{Rule: rules.NewActiveQueryRule("", name, rules.QRConcurrencyControl), Pool: pool, MaxQueueSize: maxQueueSize, MaxConcurrency: maxConcurrency}
+	}
+	pools := newConcurrencyPools()
+	pools.set([]*ConcurrencyControlAction{
+		action("a", "reporting", 10, 2),
+		action("b", "", 5, 1),
+		action("c", "reporting", 20, 4),
+		action("d", "etl", 5, 1),
+	})
+	// The first rule of a pool sets its limits.
+	limits, ok := pools.get("reporting")
+	require.True(t, ok)
+	assert.Equal(t, concurrencyPoolLimits{MaxQueueSize: 10, MaxConcurrency: 2, Rule: "a"}, limits)
+	limits, ok = pools.get("etl")
+	require.True(t, ok)
+	assert.Equal(t, 1, limits.MaxConcurrency)
+	_, ok = pools.get("")
+	assert.False(t, ok)
+
+	pools.set(nil)
+	_, ok = pools.get("reporting")
+	assert.False(t, ok)
+}
+
+// TestConcurrencyControlActionPool takes the only slot of a pool with the
+// query of a rule, which makes the query of another rule of the pool wait.
+func TestConcurrencyControlActionPool(t *testing.T) {
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	tsv.RegisterQueryRuleSource("pool_test")
+	defer tsv.UnRegisterQueryRuleSource("pool_test")
+
+	first := rules.NewActiveQueryRule("", "pool_rule_1", rules.QRConcurrencyControl)
+	first.SetPriority(1)
+	first.SetActionArgs(`{"pool": "pool_test", "max_queue_size": 2, "max_concurrency": 1}`)
+	second := rules.NewActiveQueryRule("", "pool_rule_2", rules.QRConcurrencyControl)
+	second.SetPriority(2)
+	second.SetActionArgs(`{"pool": "pool_test", "max_queue_size": 10, "max_concurrency": 5}`)
+	qrs := rules.New()
+	qrs.Add(second)
+	qrs.Add(first)
+	require.NoError(t, tsv.SetQueryRules("pool_test", qrs))
+
+	newAction := func(qr *rules.Rule) *ConcurrencyControlAction {
+		action, err := CreateActionInstance(rules.QRConcurrencyControl, qr)
+		require.NoError(t, err)
+		return action.(*ConcurrencyControlAction)
+	}
+	firstAction, firstQre := newAction(first), newTestQueryExecutor(ctx, tsv, "select * from t1", 0)
+	_, err := firstAction.BeforeExecution(firstQre)
+	require.NoError(t, err)
+
+	// The query of the other rule, and of another template, waits for the
+	// slot of the pool.
+	secondAction, secondQre := newAction(second), newTestQueryExecutor(ctx, tsv, "select * from t2", 0)
+	assert.Equal(t, firstAction.queueKey(firstQre), secondAction.queueKey(secondQre))
+	admitted := make(chan error)
+	go func() {
+		_, err := secondAction.BeforeExecution(secondQre)
+		admitted <- err
+	}()
+	key := cclPoolQueuePrefix("pool_test")
+	assert.Eventually(t, func() bool { return tsv.qe.concurrencyController.Pending(key) == 2 }, 10*time.Second, time.Millisecond)
+	// The pool is full.
+	_, err = newAction(second).BeforeExecution(newTestQueryExecutor(ctx, tsv, "select * from t2", 0))
+	assert.EqualError(t, err, "concurrency control protection: too many queued transactions (2 >= 2)")
+
+	firstAction.AfterExecution(firstQre, nil, nil)
+	require.NoError(t, <-admitted)
+	secondAction.AfterExecution(secondQre, nil, nil)
+	assert.Zero(t, tsv.qe.concurrencyController.Pending(key))
+	assert.EqualValues(t, 1, tsv.stats.ConcurrencyControlQueries.Counts()["pool_rule_2.queued"])
+}
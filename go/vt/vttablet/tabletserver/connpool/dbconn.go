@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"vitess.io/vitess/go/pools"
@@ -171,7 +172,11 @@ func (dbc *DBConn) execOnce(ctx context.Context, query string, maxrows int, want
 	defer dbc.stats.MySQLTimings.Record("Exec", time.Now())
 
 	done, wg := dbc.setDeadline(ctx)
-	qr, err := dbc.conn.ExecuteFetch(query, maxrows, wantfields)
+	dbc.conn.RecordRowBuffers(sqltypes.WantRowBuffers(ctx))
+	qr, warnings, err := dbc.conn.ExecuteFetchWithWarningCount(query, maxrows, wantfields)
+	if err == nil && warnings > 0 {
+		dbc.fetchWarnings(qr)
+	}
 
 	if done != nil {
 		close(done)
@@ -183,6 +188,29 @@ func (dbc *DBConn) execOnce(ctx context.Context, query string, maxrows int, want
 	return qr, err
 }
 
+// maxFetchedWarnings is the most warnings of a query returned to vtgate.
+const maxFetchedWarnings = 64
+
+// fetchWarnings adds to the last result of the connection the warnings MySQL
+// raised for it, once it read all the results of the query.
+func (dbc *DBConn) fetchWarnings(qr *sqltypes.Result) {
+	if qr.IsMoreResultsExists() {
+		return
+	}
+	warnings, err := dbc.conn.ExecuteFetch(fmt.Sprintf("show warnings limit %d", maxFetchedWarnings), maxFetchedWarnings, false)
+	if err != nil {
+		log.Warningf("Failed to read the warnings of a query: %v", err)
+		return
+	}
+	for _, row := range warnings.Rows {
+		if len(row) < 3 {
+			continue
+		}
+		code, _ := row[1].ToUint64()
+		qr.Warnings = append(qr.Warnings, &querypb.QueryWarning{Level: row[0].ToString(), Code: uint32(code), Message: row[2].ToString()})
+	}
+}
+
 // ExecOnce executes the specified query, but does not retry on connection errors.
 func (dbc *DBConn) ExecOnce(ctx context.Context, query string, maxrows int, wantfields bool) (*sqltypes.Result, error) {
 	return dbc.execOnce(ctx, query, maxrows, wantfields)
@@ -197,10 +225,14 @@ func (dbc *DBConn) FetchNext(ctx context.Context, maxrows int, wantfields bool)
 		return nil, fmt.Errorf("%v before reading next result set", ctx.Err())
 	default:
 	}
-	res, _, _, err := dbc.conn.ReadQueryResult(maxrows, wantfields)
+	dbc.conn.RecordRowBuffers(sqltypes.WantRowBuffers(ctx))
+	res, _, warnings, err := dbc.conn.ReadQueryResult(maxrows, wantfields)
 	if err != nil {
 		return nil, err
 	}
+	if warnings > 0 {
+		dbc.fetchWarnings(res)
+	}
 	return res, err
 
 }
@@ -266,7 +298,13 @@ func (dbc *DBConn) streamOnce(ctx context.Context, query string, callback func(*
 	defer dbc.current.Set("")
 
 	done, wg := dbc.setDeadline(ctx)
-	err := dbc.conn.ExecuteStreamFetch(query, callback, alloc, streamBufferSize)
+	dbc.conn.RecordRowBuffers(sqltypes.WantRowBuffers(ctx))
+	var err error
+	if dbc.pool != nil && dbc.pool.env != nil && dbc.pool.env.Config() != nil && dbc.pool.env.Config().StreamBufferSizeAdaptive {
+		err = dbc.conn.ExecuteStreamFetchAdaptive(query, callback, alloc, streamBufferSize)
+	} else {
+		err = dbc.conn.ExecuteStreamFetch(query, callback, alloc, streamBufferSize)
+	}
 
 	if done != nil {
 		close(done)
@@ -431,6 +469,28 @@ func (dbc *DBConn) Kill(reason string, elapsed time.Duration) error {
 	return nil
 }
 
+// KillQuery kills the currently executing query, but not the connection,
+// which stays usable: the query fails with a MySQL error.
+func (dbc *DBConn) KillQuery(reason string, elapsed time.Duration) error {
+	dbc.stats.KillCounters.Add("Queries", 1)
+	log.Infof("Due to %s, elapsed time: %v, killing the query of connection ID %v %s", reason, elapsed, dbc.conn.ID(), dbc.CurrentForLogging())
+
+	killConn, err := dbc.dbaPool.Get(context.TODO())
+	if err != nil {
+		log.Warningf("Failed to get conn from dba pool: %v", err)
+		return err
+	}
+	defer killConn.Recycle()
+	sql := fmt.Sprintf("kill query %d", dbc.conn.ID())
+	_, err = killConn.ExecuteFetch(sql, 10000, false)
+	if err != nil {
+		log.Errorf("Could not kill the query of connection ID %v %s: %v", dbc.conn.ID(),
+			dbc.CurrentForLogging(), err)
+		return err
+	}
+	return nil
+}
+
 // Current returns the currently executing query.
 func (dbc *DBConn) Current() string {
 	return dbc.current.Get()
@@ -471,12 +531,55 @@ func (dbc *DBConn) reconnect(ctx context.Context) error {
 	return nil
 }
 
+// noKillOnTimeoutKey marks the contexts whose deadline doesn't kill the
+// queries.
+type noKillOnTimeoutKey struct{}
+
+// WithoutKillOnTimeout returns a context whose deadline only bounds the time
+// the queries wait before they are sent to MySQL: once started, they run to
+// completion.
+func WithoutKillOnTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noKillOnTimeoutKey{}, true)
+}
+
+// KillDeadline is a time past which the queries of a context are killed,
+// independently of the deadline of the context.
+type KillDeadline struct {
+	At time.Time
+	// Connection also kills the connection of the queries, which ends their
+	// transaction. Otherwise only the queries are killed.
+	Connection bool
+	// Reason is logged with the kills.
+	Reason string
+
+	killed atomic.Bool
+}
+
+// Killed returns whether a query was killed past the deadline.
+func (kd *KillDeadline) Killed() bool {
+	return kd.killed.Load()
+}
+
+type killDeadlineKey struct{}
+
+// WithKillDeadline returns a context whose queries are killed once they run
+// past a deadline, even if the context doesn't kill them on timeout.
+func WithKillDeadline(ctx context.Context, kd *KillDeadline) context.Context {
+	return context.WithValue(ctx, killDeadlineKey{}, kd)
+}
+
 // setDeadline starts a goroutine that will kill the currently executing query
-// if the deadline is exceeded. It returns a channel and a waitgroup. After the
-// query is done executing, the caller is required to close the done channel
-// and wait for the waitgroup to make sure that the necessary cleanup is done.
+// if the deadline, or the kill deadline, is exceeded. It returns a channel and
+// a waitgroup. After the query is done executing, the caller is required to
+// close the done channel and wait for the waitgroup to make sure that the
+// necessary cleanup is done.
 func (dbc *DBConn) setDeadline(ctx context.Context) (chan bool, *sync.WaitGroup) {
-	if ctx.Done() == nil {
+	ctxDone := ctx.Done()
+	if ctx.Value(noKillOnTimeoutKey{}) != nil {
+		ctxDone = nil
+	}
+	kd, _ := ctx.Value(killDeadlineKey{}).(*KillDeadline)
+	if ctxDone == nil && kd == nil {
 		return nil, nil
 	}
 	done := make(chan bool)
@@ -485,9 +588,22 @@ func (dbc *DBConn) setDeadline(ctx context.Context) (chan bool, *sync.WaitGroup)
 	go func() {
 		defer wg.Done()
 		startTime := time.Now()
+		var killAt <-chan time.Time
+		if kd != nil {
+			tmr := time.NewTimer(time.Until(kd.At))
+			defer tmr.Stop()
+			killAt = tmr.C
+		}
 		select {
-		case <-ctx.Done():
+		case <-ctxDone:
 			dbc.Kill(ctx.Err().Error(), time.Since(startTime))
+		case <-killAt:
+			kd.killed.Store(true)
+			if kd.Connection {
+				dbc.Kill(kd.Reason, time.Since(startTime))
+			} else {
+				dbc.KillQuery(kd.Reason, time.Since(startTime))
+			}
 		case <-done:
 			return
 		}
@@ -121,6 +121,39 @@ func TestDBConnExec(t *testing.T) {
 	compareTimingCounts(t, "PoolTest.Exec", 1, startCounts, mysqlTimings.Counts())
 }
 
+func TestDBConnExecWarnings(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+
+	sql := "insert into test_table values (1, 'truncated')"
+	db.AddQuery(sql, &sqltypes.Result{RowsAffected: 1})
+	db.AddQuery("show warnings limit 64", sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields("Level|Code|Message", "varchar|uint32|varchar"),
+		"Warning|1265|Data truncated for column 'name' at row 1",
+		"Note|1051|Unknown table 'test.t'",
+	))
+	connPool := newPool()
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+	dbConn, err := NewDBConn(context.Background(), connPool, db.ConnParams())
+	require.NoError(t, err)
+	defer dbConn.Close()
+
+	// Without warnings, SHOW WARNINGS isn't run.
+	result, err := dbConn.Exec(context.Background(), sql, 1, false)
+	require.NoError(t, err)
+	assert.Empty(t, result.Warnings)
+	assert.Zero(t, db.GetQueryCalledNum("show warnings limit 64"))
+
+	db.SetWarningCount(2)
+	result, err = dbConn.Exec(context.Background(), sql, 1, false)
+	require.NoError(t, err)
+	assert.Equal(t, []*querypb.QueryWarning{
+		{Level: "Warning", Code: 1265, Message: "Data truncated for column 'name' at row 1"},
+		{Level: "Note", Code: 1051, Message: "Unknown table 'test.t'"},
+	}, result.Warnings)
+}
+
 func TestDBConnExecLost(t *testing.T) {
 	db := fakesqldb.New(t)
 	defer db.Close()
@@ -323,6 +356,77 @@ func TestDBConnClose(t *testing.T) {
 	assert.True(t, time.Since(start) < 100*time.Millisecond, "%v %v", time.Since(start), 100*time.Millisecond)
 }
 
+func TestDBConnWithoutKillOnTimeout(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	connPool := newPool()
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+	dbConn, err := NewDBConn(context.Background(), connPool, db.ConnParams())
+	require.NoError(t, err)
+	defer dbConn.Close()
+
+	query := "sleep"
+	db.AddQuery(query, &sqltypes.Result{})
+	db.SetBeforeFunc(query, func() {
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	// The query outlives its deadline.
+	kills := connPool.env.Stats().KillCounters.Counts()["Queries"]
+	ctx, cancel := context.WithTimeout(WithoutKillOnTimeout(context.Background()), 10*time.Millisecond)
+	defer cancel()
+	_, err = dbConn.Exec(ctx, query, 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, kills, connPool.env.Stats().KillCounters.Counts()["Queries"])
+
+	// But it isn't started past it.
+	_, err = dbConn.Exec(ctx, query, 1, false)
+	assert.ErrorContains(t, err, "context deadline exceeded before execution started")
+}
+
+func TestDBConnKillDeadline(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	connPool := newPool()
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+	dbConn, err := NewDBConn(context.Background(), connPool, db.ConnParams())
+	require.NoError(t, err)
+	defer dbConn.Close()
+
+	query := "sleep"
+	db.AddQuery(query, &sqltypes.Result{})
+	db.SetBeforeFunc(query, func() {
+		time.Sleep(100 * time.Millisecond)
+	})
+	killQuery := fmt.Sprintf("kill query %d", dbConn.ID())
+	db.AddQuery(killQuery, &sqltypes.Result{})
+
+	// A query running past the kill deadline is killed, even without a
+	// context deadline, and its connection stays open.
+	kd := &KillDeadline{At: time.Now().Add(10 * time.Millisecond), Reason: "test kill"}
+	_, err = dbConn.Exec(WithKillDeadline(context.Background(), kd), query, 1, false)
+	assert.NoError(t, err)
+	assert.True(t, kd.Killed())
+	assert.Equal(t, 1, db.GetQueryCalledNum(killQuery))
+	assert.False(t, dbConn.IsClosed())
+
+	// The queries finished before the kill deadline aren't killed.
+	kd = &KillDeadline{At: time.Now().Add(time.Minute), Reason: "test kill"}
+	_, err = dbConn.Exec(WithKillDeadline(context.Background(), kd), query, 1, false)
+	assert.NoError(t, err)
+	assert.False(t, kd.Killed())
+
+	// The kill deadline doesn't depend on the kill on timeout of the context.
+	kd = &KillDeadline{At: time.Now().Add(10 * time.Millisecond), Connection: true, Reason: "test kill"}
+	db.AddQuery(fmt.Sprintf("kill %d", dbConn.ID()), &sqltypes.Result{})
+	ctx := WithKillDeadline(WithoutKillOnTimeout(context.Background()), kd)
+	_, err = dbConn.Exec(ctx, query, 1, false)
+	assert.ErrorContains(t, err, "errno 2013")
+	assert.True(t, kd.Killed())
+}
+
 func TestDBNoPoolConnKill(t *testing.T) {
 	db := fakesqldb.New(t)
 	connPool := newPool()
@@ -429,6 +533,65 @@ func TestDBConnStream(t *testing.T) {
 	}
 }
 
+func TestDBConnRowBuffers(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	sql := "select * from test_table limit 1000"
+	expectedResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Type: sqltypes.VarChar},
+			{Type: sqltypes.VarChar},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.NewVarChar("123"), sqltypes.NewVarChar("abc")},
+		},
+	}
+	db.AddQuery(sql, expectedResult)
+	connPool := newPool()
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+	dbConn, err := NewDBConn(context.Background(), connPool, db.ConnParams())
+	require.NoError(t, err)
+	defer dbConn.Close()
+
+	// sharesRow returns true if the proto3 row of the result is its values.
+	sharesRow := func(qr *sqltypes.Result) bool {
+		row := sqltypes.ResultToProto3(qr).Rows[0]
+		assert.Equal(t, "123abc", string(row.Values))
+		return &row.Values[0] == &qr.Rows[0][0].Raw()[0]
+	}
+	stream := func(ctx context.Context) *sqltypes.Result {
+		var result *sqltypes.Result
+		err := dbConn.Stream(ctx, sql, func(r *sqltypes.Result) error {
+			if len(r.Rows) > 0 {
+				result = r
+			}
+			return nil
+		}, func() *sqltypes.Result {
+			return &sqltypes.Result{}
+		}, 10, querypb.ExecuteOptions_ALL)
+		require.NoError(t, err)
+		return result
+	}
+
+	// The results record no buffers unless they are converted to proto3.
+	result, err := dbConn.Exec(context.Background(), sql, 1, true)
+	require.NoError(t, err)
+	assert.Equal(t, expectedResult, result)
+	assert.False(t, sharesRow(result))
+	result = stream(context.Background())
+	assert.Equal(t, &sqltypes.Result{Rows: expectedResult.Rows}, result)
+	assert.False(t, sharesRow(result))
+
+	ctx := sqltypes.WithRowBuffers(context.Background())
+	result, err = dbConn.Exec(ctx, sql, 1, true)
+	require.NoError(t, err)
+	assert.True(t, expectedResult.Equal(result))
+	assert.True(t, sharesRow(result))
+	result = stream(ctx)
+	assert.True(t, sharesRow(result))
+}
+
 func TestDBConnStreamKill(t *testing.T) {
 	db := fakesqldb.New(t)
 	defer db.Close()
@@ -290,6 +290,11 @@ func (cp *Pool) StatsJSON() string {
 	return fmt.Sprintf(`%s, "WaiterQueueFull": %v}`, res[:closingBraceIndex], cp.waiterQueueFull.Get())
 }
 
+// Name returns the name of the pool, under which its stats are published.
+func (cp *Pool) Name() string {
+	return cp.name
+}
+
 // Capacity returns the pool capacity.
 func (cp *Pool) Capacity() int64 {
 	p := cp.pool()
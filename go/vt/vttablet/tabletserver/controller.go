@@ -26,6 +26,7 @@ import (
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
 	"vitess.io/vitess/go/vt/vttablet/vexec"
 
 	"time"
@@ -79,6 +80,9 @@ type Controller interface {
 	// SetQueryRules sets the query rules for this QueryService
 	SetQueryRules(ruleSource string, qrs *rules.Rules) error
 
+	// ReloadWasmPlugins loads the WASM plugins the query rules reference
+	ReloadWasmPlugins(ctx context.Context, source wasm.Source) error
+
 	// QueryService returns the QueryService object used by this Controller
 	QueryService() queryservice.QueryService
 
@@ -93,6 +97,9 @@ type Controller interface {
 
 	// TopoServer returns the topo server.
 	TopoServer() *topo.Server
+
+	// CurrentTarget returns the current target of the query service.
+	CurrentTarget() *querypb.Target
 }
 
 // Ensure TabletServer satisfies Controller interface.
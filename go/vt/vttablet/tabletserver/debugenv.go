@@ -122,6 +122,10 @@ func debugEnvHandler(tsv *TabletServer, w http.ResponseWriter, r *http.Request)
 			setIntVal(tsv.SetMaxResultSize)
 		case "WarnResultSize":
 			setIntVal(tsv.SetWarnResultSize)
+		case "StreamMaxBufferedBytes":
+			setInt64Val(tsv.SetStreamMaxBufferedBytes)
+		case "StreamMaxBufferedBytesPerStream":
+			setInt64Val(tsv.SetStreamMaxBufferedBytesPerStream)
 		case "RowStreamerMaxInnoDBTrxHistLen":
 			setInt64Val(func(val int64) { tsv.Config().RowStreamer.MaxInnoDBTrxHistLen = val })
 		case "RowStreamerMaxMySQLReplLagSecs":
@@ -145,6 +149,8 @@ func debugEnvHandler(tsv *TabletServer, w http.ResponseWriter, r *http.Request)
 	vars = addVar(vars, "QueryCacheCapacity", tsv.QueryPlanCacheCap)
 	vars = addVar(vars, "MaxResultSize", tsv.MaxResultSize)
 	vars = addVar(vars, "WarnResultSize", tsv.WarnResultSize)
+	vars = addVar(vars, "StreamMaxBufferedBytes", tsv.StreamMaxBufferedBytes)
+	vars = addVar(vars, "StreamMaxBufferedBytesPerStream", tsv.StreamMaxBufferedBytesPerStream)
 	vars = addVar(vars, "RowStreamerMaxInnoDBTrxHistLen", func() int64 { return tsv.Config().RowStreamer.MaxInnoDBTrxHistLen })
 	vars = addVar(vars, "RowStreamerMaxMySQLReplLagSecs", func() int64 { return tsv.Config().RowStreamer.MaxMySQLReplLagSecs })
 	vars = addVar(vars, "UnhealthyThreshold", tsv.Config().Healthcheck.UnhealthyThresholdSeconds.Get)
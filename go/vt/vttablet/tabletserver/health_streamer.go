@@ -272,6 +272,14 @@ func (hs *healthStreamer) ChangeState(tabletType topodatapb.TabletType, terTimes
 	})
 }
 
+// threadsRunning returns the number of threads running in MySQL at the last
+// broadcast of the health of the tablet.
+func (hs *healthStreamer) threadsRunning() int64 {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.state.GetRealtimeStats().GetMysqlThreadStats().GetRunning()
+}
+
 func (hs *healthStreamer) broadCastToClients(shr *querypb.StreamHealthResponse) {
 	for ch := range hs.clients {
 		select {
@@ -37,6 +37,7 @@ var (
 			<th>Duration</th>
 			<th>Start</th>
 			<th>ConnectionID</th>
+			<th>BufferedBytes</th>
 			<th>Terminate</th>
 		</tr>
         </thead>
@@ -49,6 +50,7 @@ var (
 			<td>{{.Duration}}</td>
 			<td>{{.Start}}</td>
 			<td>{{.ConnID}}</td>
+			<td>{{.BufferedBytes}}</td>
 			<td><a href='terminate?connID={{.ConnID}}'>Terminate</a></td>
 		</tr>
 	`))
@@ -0,0 +1,223 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+const (
+	// mirrorQueueSize is the number of queries a mirror buffers before it
+	// drops the new ones.
+	mirrorQueueSize = 1000
+	// mirrorMaxRows is the maximum number of rows the mirrored queries may
+	// return.
+	mirrorMaxRows = 10000
+)
+
+const (
+	mirrorResultOK          = "ok"
+	mirrorResultError       = "error"
+	mirrorResultUnavailable = "unavailable"
+	mirrorResultDropped     = "dropped"
+)
+
+var mirrorLogger = logutil.NewThrottledLogger("Mirror", 10*time.Second)
+
+// mirrors are the shadow MySQL servers the MIRROR rules replay their queries
+// on, by rule. The queries are replayed asynchronously by the goroutines of the
+// mirror, and dropped if they don't fit in its queue, so that a slow or
+// unavailable shadow server never slows down the queries. Their results are
+// discarded.
+type mirrors struct {
+	stats *tabletenv.Stats
+
+	mu      sync.Mutex
+	mirrors map[string]*mirror
+}
+
+type mirror struct {
+	rule        string
+	params      mysql.ConnParams
+	database    string
+	concurrency int
+	queue       chan *mirroredQuery
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// mirroredQuery is a query to replay, in its database.
+type mirroredQuery struct {
+	database string
+	sql      string
+	bindVars map[string]*querypb.BindVariable
+}
+
+func newMirrors(stats *tabletenv.Stats) *mirrors {
+	return &mirrors{stats: stats, mirrors: make(map[string]*mirror)}
+}
+
+// get returns the mirror of a rule, which replays the queries on the server
+// of params, in database if set, else in their own database, with
+// concurrency connections. The mirror is replaced if the rule changed.
+func (ms *mirrors) get(rule string, params mysql.ConnParams, database string, concurrency int) *mirror {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if m, ok := ms.mirrors[rule]; ok {
+		if m.configured(params, database, concurrency) {
+			return m
+		}
+		m.stop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &mirror{
+		rule:        rule,
+		params:      params,
+		database:    database,
+		concurrency: concurrency,
+		queue:       make(chan *mirroredQuery, mirrorQueueSize),
+		cancel:      cancel,
+	}
+	for i := 0; i < concurrency; i++ {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.run(ctx, ms.stats)
+		}()
+	}
+	ms.mirrors[rule] = m
+	return m
+}
+
+// retain stops the mirrors of the rules which are not in actions, the MIRROR
+// rules loaded by rule, or whose shadow server changed, and drops their queued
+// queries.
+func (ms *mirrors) retain(actions map[string]*MirrorAction) {
+	var stopped []*mirror
+	ms.mu.Lock()
+	for rule, m := range ms.mirrors {
+		if p, ok := actions[rule]; !ok || !m.configured(p.Params, p.Database, p.Concurrency) {
+			stopped = append(stopped, m)
+			delete(ms.mirrors, rule)
+		}
+	}
+	ms.mu.Unlock()
+	for _, m := range stopped {
+		m.stop()
+	}
+}
+
+// close stops all the mirrors, and drops their queued queries.
+func (ms *mirrors) close() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for rule, m := range ms.mirrors {
+		m.stop()
+		delete(ms.mirrors, rule)
+	}
+}
+
+func (m *mirror) configured(params mysql.ConnParams, database string, concurrency int) bool {
+	return m.params == params && m.database == database && m.concurrency == concurrency
+}
+
+func (m *mirror) stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// send queues a query, and returns false if the queue is full.
+func (m *mirror) send(database, sql string, bindVars map[string]*querypb.BindVariable) bool {
+	query := &mirroredQuery{database: database, sql: sql}
+	if m.database != "" {
+		query.database = m.database
+	}
+	if len(bindVars) > 0 {
+		query.bindVars = make(map[string]*querypb.BindVariable, len(bindVars))
+		for name, bv := range bindVars {
+			query.bindVars[name] = bv
+		}
+	}
+	select {
+	case m.queue <- query:
+		return true
+	default:
+		return false
+	}
+}
+
+// run replays the queued queries on a connection of its own until ctx is
+// done.
+func (m *mirror) run(ctx context.Context, stats *tabletenv.Stats) {
+	var conn *mysql.Conn
+	database := ""
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for {
+		var query *mirroredQuery
+		select {
+		case <-ctx.Done():
+			return
+		case query = <-m.queue:
+		}
+		if conn == nil {
+			var err error
+			params := m.params
+			if conn, err = mysql.Connect(ctx, &params); err != nil {
+				mirrorLogger.Warningf("Rule %s cannot connect to its mirror: %v", m.rule, err)
+				stats.MirroredQueries.Add([]string{m.rule, mirrorResultUnavailable}, 1)
+				continue
+			}
+			database = ""
+		}
+		err := m.replay(conn, query, &database)
+		switch {
+		case err == nil:
+			stats.MirroredQueries.Add([]string{m.rule, mirrorResultOK}, 1)
+		case mysql.IsConnErr(err):
+			mirrorLogger.Warningf("Rule %s lost the connection to its mirror: %v", m.rule, err)
+			stats.MirroredQueries.Add([]string{m.rule, mirrorResultUnavailable}, 1)
+			conn.Close()
+			conn = nil
+		default:
+			stats.MirroredQueries.Add([]string{m.rule, mirrorResultError}, 1)
+		}
+	}
+}
+
+// replay executes a query on a connection whose database is *database.
+func (m *mirror) replay(conn *mysql.Conn, query *mirroredQuery, database *string) error {
+	if query.database != "" && query.database != *database {
+		if _, err := conn.ExecuteFetch("use "+sqlparser.String(sqlparser.NewIdentifierCS(query.database)), 0, false); err != nil {
+			return err
+		}
+		*database = query.database
+	}
+	sql := query.sql
+	if len(query.bindVars) > 0 {
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			return err
+		}
+		if sql, err = sqlparser.NewParsedQuery(stmt).GenerateQuery(query.bindVars, nil); err != nil {
+			return err
+		}
+	}
+	_, err := conn.ExecuteFetch(sql, mirrorMaxRows, false)
+	return err
+}
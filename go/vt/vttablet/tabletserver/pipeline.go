@@ -0,0 +1,41 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/queryservice"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// executePipeline executes the statements of a pipelined Execute in order,
+// and stops at the first one that fails. Every statement goes through the
+// regular execute path, so plans, ACLs and rules apply to each of them.
+// The results and the error are encoded in the returned result, see
+// queryservice.EncodePipelinedResults.
+func (tsv *TabletServer) executePipeline(ctx context.Context, target *querypb.Target, statements []string, transactionID, reservedID int64, options *querypb.ExecuteOptions) (*sqltypes.Result, error) {
+	if transactionID == 0 {
+		return nil, vterrors.New(vtrpcpb.Code_INVALID_ARGUMENT, "pipelined statements must be executed in a transaction")
+	}
+	results := make([]*sqltypes.Result, 0, len(statements))
+	for _, sql := range statements {
+		tsv.stats.PipelinedStatements.Add(1)
+		qr, err := tsv.execute(ctx, target, sql, nil, transactionID, reservedID, nil, options)
+		if err == nil && len(qr.Fields) != 0 {
+			err = vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "pipelined statement returned rows: %s", sql)
+		}
+		if err != nil {
+			return queryservice.EncodePipelinedResults(results, err), nil
+		}
+		results = append(results, qr)
+	}
+	return queryservice.EncodePipelinedResults(results, nil), nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/queryservice"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func TestExecutePipeline(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	db.AddQuery("insert into test_table(pk) values (1)", &sqltypes.Result{RowsAffected: 1, InsertID: 1})
+	db.AddQuery("update test_table set `name` = 2 where pk = 1 limit 100001", &sqltypes.Result{RowsAffected: 1})
+	db.AddRejectedQuery("delete from test_table where pk = 2 limit 100001", vterrors.New(vtrpcpb.Code_ALREADY_EXISTS, "rejected"))
+	target := querypb.Target{TabletType: topodatapb.TabletType_PRIMARY}
+
+	statements := []string{
+		"insert into test_table(pk) values (1)",
+		"update test_table set `name` = 2 where pk = 1",
+	}
+	_, err := tsv.Execute(ctx, &target, "", queryservice.PipelinedBindVars(statements), 0, 0, nil)
+	require.ErrorContains(t, err, "pipelined statements must be executed in a transaction")
+
+	state, err := tsv.Begin(ctx, &target, nil)
+	require.NoError(t, err)
+	defer tsv.Rollback(ctx, &target, state.TransactionID)
+
+	pipelined := tsv.stats.PipelinedStatements.Get()
+	qr, err := tsv.Execute(ctx, &target, "", queryservice.PipelinedBindVars(statements), state.TransactionID, 0, nil)
+	require.NoError(t, err)
+	results, err := queryservice.DecodePipelinedResults(qr)
+	require.NoError(t, err)
+	assert.Equal(t, []*sqltypes.Result{{RowsAffected: 1, InsertID: 1}, {RowsAffected: 1}}, results)
+	assert.EqualValues(t, 2, tsv.stats.PipelinedStatements.Get()-pipelined)
+
+	// the statements after the one that failed are not executed.
+	statements = []string{
+		"update test_table set `name` = 2 where pk = 1",
+		"delete from test_table where pk = 2",
+		"insert into test_table(pk) values (1)",
+	}
+	qr, err = tsv.Execute(ctx, &target, "", queryservice.PipelinedBindVars(statements), state.TransactionID, 0, nil)
+	require.NoError(t, err)
+	results, err = queryservice.DecodePipelinedResults(qr)
+	require.ErrorContains(t, err, "rejected")
+	assert.Equal(t, []*sqltypes.Result{{RowsAffected: 1}}, results)
+	assert.EqualValues(t, 4, tsv.stats.PipelinedStatements.Get()-pipelined)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"strings"
+	"sync"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/log"
+	p "vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// planAccess is the access profile of a plan, which the first of its queries
+// a rule with access conditions matches reads from the MySQL EXPLAIN of the
+// query, with its bind variables. The queries of the plan then share it,
+// whatever their bind variables. The queries which fail to be explained, like
+// when the tablet is out of connections, leave it for the next ones.
+type planAccess struct {
+	mu        sync.Mutex
+	explained bool
+	profile   *rules.AccessProfile
+}
+
+// accessProfile returns the access profile of the plan of the query, or nil if
+// MySQL can't explain it.
+func (qre *QueryExecutor) accessProfile() *rules.AccessProfile {
+	access := &qre.plan.access
+	access.mu.Lock()
+	defer access.mu.Unlock()
+	if !access.explained {
+		profile, err := qre.explainAccess()
+		if err != nil {
+			log.Warningf("Failed to explain the access of query %s: %v", qre.query, err)
+			return nil
+		}
+		access.explained, access.profile = true, profile
+	}
+	return access.profile
+}
+
+// explainedAccessProfile returns the access profile of the plan of the query
+// if it was explained already, without explaining it.
+func (qre *QueryExecutor) explainedAccessProfile() *rules.AccessProfile {
+	return qre.plan.access.explainedProfile()
+}
+
+// explainedProfile returns the access profile if it was explained already.
+func (access *planAccess) explainedProfile() *rules.AccessProfile {
+	access.mu.Lock()
+	defer access.mu.Unlock()
+	return access.profile
+}
+
+// explainAccess reads the access profile of the query from its EXPLAIN, nil
+// for the plans MySQL doesn't explain.
+func (qre *QueryExecutor) explainAccess() (*rules.AccessProfile, error) {
+	switch qre.plan.PlanID {
+	case p.PlanSelect, p.PlanSelectStream, p.PlanInsert, p.PlanUpdate, p.PlanUpdateLimit, p.PlanDelete, p.PlanDeleteLimit:
+	default:
+		return nil, nil
+	}
+	if qre.plan.FullQuery == nil {
+		return nil, nil
+	}
+	bindVars := make(map[string]*querypb.BindVariable, len(qre.bindVars)+1)
+	for name, bv := range qre.bindVars {
+		bindVars[name] = bv
+	}
+	// The limit of the queries is only bound once their actions let them run.
+	if _, ok := bindVars["#maxLimit"]; !ok {
+		bindVars["#maxLimit"] = sqltypes.Int64BindVariable(qre.getSelectLimit() + 1)
+	}
+	query, err := qre.plan.FullQuery.GenerateQuery(bindVars, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := qre.getConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Recycle()
+	qr, err := conn.Exec(qre.ctx, "explain "+query, int(qre.tsv.qe.maxResultSize.Get()), true)
+	if err != nil {
+		return nil, err
+	}
+	return explainedAccess(qr), nil
+}
+
+// explainedAccess returns the access profile of the rows of an EXPLAIN, one
+// by table of the query.
+func explainedAccess(qr *sqltypes.Result) *rules.AccessProfile {
+	profile := &rules.AccessProfile{}
+	for _, row := range qr.Named().Rows {
+		// The rows without a table, like the ones of the impossible WHEREs,
+		// and the ones of the derived tables, like <derived2>, read none of
+		// the tables of the query.
+		table := row.AsString("table", "")
+		if table == "" || strings.HasPrefix(table, "<") {
+			continue
+		}
+		switch row.AsString("type", "") {
+		case "ALL":
+			profile.FullScan = true
+			if row.AsString("possible_keys", "") == "" {
+				profile.NoIndex = true
+			}
+		case "index":
+			// A full scan of an index reads all its entries.
+			profile.FullScan = true
+		}
+		if rows := row.AsUint64("rows", 0); rows > profile.EstimatedRows {
+			profile.EstimatedRows = rows
+		}
+	}
+	return profile
+}
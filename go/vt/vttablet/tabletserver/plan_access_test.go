@@ -0,0 +1,107 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+var explainFields = sqltypes.MakeTestFields(
+	"id|select_type|table|partitions|type|possible_keys|key|key_len|ref|rows|filtered|Extra",
+	"int64|varchar|varchar|varchar|varchar|varchar|varchar|varchar|varchar|uint64|float64|varchar",
+)
+
+func TestExplainedAccess(t *testing.T) {
+	for _, tcase := range []struct {
+		rows []string
+		want rules.AccessProfile
+	}{{
+		rows: []string{"1|SIMPLE|t1|null|const|PRIMARY|PRIMARY|8|const|1|100|null"},
+		want: rules.AccessProfile{EstimatedRows: 1},
+	}, {
+		// A table scanned while an index could be used has an index.
+		rows: []string{"1|SIMPLE|t1|null|ALL|idx_name|null|null|null|5000|10|Using where"},
+		want: rules.AccessProfile{FullScan: true, EstimatedRows: 5000},
+	}, {
+		rows: []string{
+			"1|PRIMARY|t1|null|ref|idx_a|idx_a|8|const|20|100|null",
+			"1|PRIMARY|t2|null|ALL|null|null|null|null|100000|10|Using where; Using join buffer (hash join)",
+		},
+		want: rules.AccessProfile{FullScan: true, NoIndex: true, EstimatedRows: 100000},
+	}, {
+		rows: []string{"1|SIMPLE|t1|null|index|null|idx_a|8|null|300|100|Using index"},
+		want: rules.AccessProfile{FullScan: true, EstimatedRows: 300},
+	}, {
+		// The derived tables aren't tables of the query.
+		rows: []string{
+			"1|PRIMARY|<derived2>|null|ALL|null|null|null|null|1000|100|null",
+			"2|DERIVED|t1|null|range|PRIMARY|PRIMARY|8|null|10|100|Using where",
+		},
+		want: rules.AccessProfile{EstimatedRows: 10},
+	}, {
+		rows: []string{"1|SIMPLE|null|null|null|null|null|null|null|null|null|Impossible WHERE"},
+	}} {
+		got := explainedAccess(sqltypes.MakeTestResult(explainFields, tcase.rows...))
+		assert.Equal(t, &tcase.want, got, tcase.rows)
+	}
+}
+
+func TestAccessConds(t *testing.T) {
+	ctx := context.Background()
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// A fail rule with access conditions fails the queries which scan the
+	// table.
+	qr := rules.NewActiveQueryRule("full scans", "full_scan_rule", rules.QRFail)
+	qr.AddTableCond("db1.test_table")
+	require.NoError(t, qr.SetAccessConds(`{"full_scan": true}`))
+	qrs := rules.New()
+	qrs.Add(qr)
+	rulesName := "accessRules"
+	tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	tsv.qe.queryRuleSources.RegisterSource(rulesName)
+	defer tsv.qe.queryRuleSources.UnRegisterSource(rulesName)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, qrs))
+
+	one := &sqltypes.Result{Fields: explainFields[:1], Rows: [][]sqltypes.Value{{sqltypes.NewInt64(1)}}}
+	db.AddQuery("select * from test_table where pk = 1 limit 100001", one)
+	db.AddQuery("explain select * from test_table where pk = 1 limit 100001", sqltypes.MakeTestResult(explainFields, "1|SIMPLE|test_table|null|const|PRIMARY|PRIMARY|8|const|1|100|null"))
+	db.AddQuery("select * from test_table where `name` = 'a' limit 100001", one)
+	db.AddQuery("explain select * from test_table where `name` = 'a' limit 100001", sqltypes.MakeTestResult(explainFields, "1|SIMPLE|test_table|null|ALL|null|null|null|null|5000|10|Using where"))
+	for i := 0; i < 2; i++ {
+		qre := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table where pk = 1", 0)
+		got, err := qre.Execute()
+		require.NoError(t, err)
+		assert.True(t, one.Equal(got))
+
+		qre = newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table where name = 'a'", 0)
+		_, err = qre.Execute()
+		assert.EqualError(t, err, "disallowed due to rule: full scans")
+	}
+	// The queries of a plan are explained once.
+	assert.Equal(t, 1, db.GetQueryCalledNum("explain select * from test_table where pk = 1 limit 100001"))
+	assert.Equal(t, 1, db.GetQueryCalledNum("explain select * from test_table where `name` = 'a' limit 100001"))
+
+	// The queries which can't be explained don't match, and are explained
+	// again.
+	db.AddQuery("select * from test_table where pk = 2 limit 100001", one)
+	db.AddRejectedQuery("explain select * from test_table where pk = 2 limit 100001", assert.AnError)
+	qre := newTestQueryExecutorByDbName(ctx, tsv, "db1", "select * from test_table where pk = 2", 0)
+	_, err := qre.Execute()
+	require.NoError(t, err)
+	assert.Nil(t, qre.plan.access.profile)
+	assert.False(t, qre.plan.access.explained)
+}
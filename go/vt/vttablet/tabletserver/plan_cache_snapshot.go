@@ -0,0 +1,243 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// planCacheSnapshotter periodically saves the queries of the most executed
+// plans of the plan cache to a file. When the query engine opens, the
+// queries of the last snapshot are planned again in the background, so that
+// a restarted tablet starts with the plans it used the most. Only queries
+// are saved: plans are always built against the current schema and rules.
+// The queries are saved normalized, with their literals replaced by bind
+// variables the way vtgate normalizes them, so the snapshot holds no data of
+// the queries.
+type planCacheSnapshotter struct {
+	qe       *QueryEngine
+	path     string
+	interval time.Duration
+	size     int
+
+	snapshots   *stats.Counter
+	warmedPlans *stats.Counter
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// planCacheSnapshotEntry is a query of a plan cache snapshot.
+type planCacheSnapshotEntry struct {
+	DBName string
+	SQL    string
+}
+
+func newPlanCacheSnapshotter(env tabletenv.Env, qe *QueryEngine) *planCacheSnapshotter {
+	config := env.Config()
+	return &planCacheSnapshotter{
+		qe:          qe,
+		path:        config.PlanCacheSnapshotFile,
+		interval:    config.PlanCacheSnapshotIntervalSeconds.Get(),
+		size:        config.PlanCacheSnapshotSize,
+		snapshots:   env.Exporter().NewCounter("PlanCacheSnapshots", "Number of plan cache snapshots saved"),
+		warmedPlans: env.Exporter().NewCounter("PlanCacheWarmedPlans", "Number of plans built from the plan cache snapshot when the query engine opened"),
+	}
+}
+
+func (pcs *planCacheSnapshotter) enabled() bool {
+	return pcs.path != "" && pcs.size > 0
+}
+
+// Open pre-warms the plan cache from the last snapshot, then starts saving
+// snapshots. Both happen in the background.
+func (pcs *planCacheSnapshotter) Open() {
+	if !pcs.enabled() {
+		return
+	}
+	pcs.mu.Lock()
+	defer pcs.mu.Unlock()
+	if pcs.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(tabletenv.LocalContext())
+	pcs.cancel = cancel
+	pcs.wg.Add(1)
+	go func() {
+		defer pcs.wg.Done()
+		pcs.warmUp(ctx)
+		pcs.run(ctx)
+	}()
+}
+
+// Close stops the snapshots, and saves a last one.
+func (pcs *planCacheSnapshotter) Close() {
+	pcs.mu.Lock()
+	defer pcs.mu.Unlock()
+	if pcs.cancel == nil {
+		return
+	}
+	pcs.cancel()
+	pcs.wg.Wait()
+	pcs.cancel = nil
+	if err := pcs.save(); err != nil {
+		log.Warningf("Failed to save the plan cache snapshot to %s: %v", pcs.path, err)
+	}
+}
+
+func (pcs *planCacheSnapshotter) run(ctx context.Context) {
+	if pcs.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(pcs.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := pcs.save(); err != nil {
+			log.Warningf("Failed to save the plan cache snapshot to %s: %v", pcs.path, err)
+		}
+	}
+}
+
+// warmUp plans the queries of the last snapshot, the most executed first.
+func (pcs *planCacheSnapshotter) warmUp(ctx context.Context) {
+	entries, err := pcs.load()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warningf("Failed to load the plan cache snapshot from %s: %v", pcs.path, err)
+		}
+		return
+	}
+	start := time.Now()
+	warmed := 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		logStats := tabletenv.NewLogStats(ctx, "PlanCacheWarmUp")
+		// Queries that don't plan anymore, because the schema changed for
+		// instance, are left to fail when they're executed.
+		if _, err := pcs.qe.GetPlan(ctx, logStats, entry.DBName, entry.SQL, false); err == nil {
+			warmed++
+		}
+	}
+	pcs.warmedPlans.Add(int64(warmed))
+	log.Infof("Warmed up %d plans out of %d from the plan cache snapshot in %v", warmed, len(entries), time.Since(start))
+}
+
+// entries returns the queries of the most executed plans of the cache.
+func (pcs *planCacheSnapshotter) entries() []planCacheSnapshotEntry {
+	var plans []*TabletPlan
+	pcs.qe.plans.ForEach(func(value any) bool {
+		if plan, ok := value.(*TabletPlan); ok {
+			plans = append(plans, plan)
+		}
+		return true
+	})
+	sort.SliceStable(plans, func(i, j int) bool {
+		qi, _, _, _, _, _ := plans[i].Stats()
+		qj, _, _, _, _, _ := plans[j].Stats()
+		return qi > qj
+	})
+	if len(plans) > pcs.size {
+		plans = plans[:pcs.size]
+	}
+	entries := make([]planCacheSnapshotEntry, 0, len(plans))
+	seen := make(map[planCacheSnapshotEntry]bool, len(plans))
+	for _, plan := range plans {
+		sql, err := normalizeSnapshotQuery(plan.Original)
+		if err != nil {
+			// A query that doesn't parse can't be stripped of its literals.
+			continue
+		}
+		entry := planCacheSnapshotEntry{DBName: plan.dbName, SQL: sql}
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// normalizeSnapshotQuery replaces the literals of sql with bind variables,
+// the way the normalizer of vtgate does, so that the normalized queries
+// vtgate sends find the plans warmed up from the snapshot.
+func normalizeSnapshotQuery(sql string) (string, error) {
+	stmt, reservedVars, err := sqlparser.Parse2(sql)
+	if err != nil {
+		return "", err
+	}
+	bindVars := make(map[string]*querypb.BindVariable)
+	if err := sqlparser.Normalize(stmt, sqlparser.NewReservedVars("vtg", reservedVars), bindVars); err != nil {
+		return "", err
+	}
+	return sqlparser.String(stmt), nil
+}
+
+// save writes a snapshot of the plan cache. The file is replaced
+// atomically, so that a crash while saving doesn't lose the last snapshot,
+// and is only readable by the tablet.
+func (pcs *planCacheSnapshotter) save() error {
+	entries := pcs.entries()
+	if len(entries) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(pcs.path), filepath.Base(pcs.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), pcs.path); err != nil {
+		return err
+	}
+	pcs.snapshots.Add(1)
+	return nil
+}
+
+func (pcs *planCacheSnapshotter) load() ([]planCacheSnapshotEntry, error) {
+	data, err := os.ReadFile(pcs.path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []planCacheSnapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
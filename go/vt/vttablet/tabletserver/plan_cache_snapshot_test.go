@@ -0,0 +1,121 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql/fakesqldb"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema/schematest"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+)
+
+func newSnapshotTestQueryEngine(db *fakesqldb.DB, path string) *QueryEngine {
+	config := tabletenv.NewDefaultConfig()
+	config.DB = newDBConfigs(db)
+	config.PlanCacheSnapshotFile = path
+	config.PlanCacheSnapshotSize = 2
+	env := tabletenv.NewEnv(config, "TabletServerTest")
+	se := schema.NewEngine(env)
+	qe := NewQueryEngine(env, se)
+	se.InitDBConfig(config.DB.DbaWithDB())
+	return qe
+}
+
+func TestPlanCacheSnapshot(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	schematest.AddDefaultQueries(db)
+	addSchemaEngineQueries(db)
+	path := filepath.Join(t.TempDir(), "plans.json")
+
+	qe := newSnapshotTestQueryEngine(db, path)
+	qe.se.Open()
+	require.NoError(t, qe.Open())
+	ctx := context.Background()
+	queries := []string{
+		"select * from test_table_01",
+		"select * from test_table_02",
+		"select * from test_table_03",
+	}
+	for i, query := range queries {
+		plan, err := qe.GetPlan(ctx, tabletenv.NewLogStats(ctx, "GetPlan"), "vttest", query, false)
+		require.NoError(t, err)
+		plan.AddStats(uint64(i+1), 0, 0, 0, 0, 0)
+	}
+	qe.Close()
+	qe.se.Close()
+
+	// only the two most executed plans are saved.
+	entries, err := qe.planCacheSnapshotter.load()
+	require.NoError(t, err)
+	assert.Equal(t, []planCacheSnapshotEntry{
+		{DBName: "vttest", SQL: queries[2]},
+		{DBName: "vttest", SQL: queries[1]},
+	}, entries)
+
+	qe = newSnapshotTestQueryEngine(db, path)
+	qe.se.Open()
+	require.NoError(t, qe.Open())
+	defer qe.Close()
+	warmed := qe.planCacheSnapshotter.warmedPlans.Get()
+	require.Eventually(t, func() bool {
+		return qe.getQuery(queries[1]) != nil && qe.getQuery(queries[2]) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, qe.getQuery(queries[0]))
+	assert.Equal(t, "vttest", qe.getQuery(queries[2]).dbName)
+	require.Eventually(t, func() bool {
+		return qe.planCacheSnapshotter.warmedPlans.Get()-warmed == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPlanCacheSnapshotNormalized(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	schematest.AddDefaultQueries(db)
+	addSchemaEngineQueries(db)
+	path := filepath.Join(t.TempDir(), "plans.json")
+
+	qe := newSnapshotTestQueryEngine(db, path)
+	qe.planCacheSnapshotter.size = 10
+	qe.se.Open()
+	require.NoError(t, qe.Open())
+	ctx := context.Background()
+	queries := []string{
+		"select * from test_table_01 where name = 'alice@example.com'",
+		"select * from test_table_01 where name = 'bob@example.com'",
+		"select * from test_table_02 where pk = 42 and name = :name",
+	}
+	for _, query := range queries {
+		_, err := qe.GetPlan(ctx, tabletenv.NewLogStats(ctx, "GetPlan"), "vttest", query, false)
+		require.NoError(t, err)
+	}
+	qe.Close()
+	qe.se.Close()
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	for _, literal := range []string{"alice", "bob", "42"} {
+		assert.NotContains(t, string(data), literal)
+	}
+	entries, err := qe.planCacheSnapshotter.load()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []planCacheSnapshotEntry{
+		{DBName: "vttest", SQL: "select * from test_table_01 where `name` = :name"},
+		{DBName: "vttest", SQL: "select * from test_table_02 where pk = :pk and `name` = :name"},
+	}, entries)
+}
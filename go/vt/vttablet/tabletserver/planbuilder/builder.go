@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/vt/vtgate/evalengine"
 	"vitess.io/vitess/go/vt/vtgate/semantics"
 
@@ -50,10 +51,12 @@ func analyzeSelect(sel *sqlparser.Select, tables map[string]*schema.Table) (plan
 		}
 	}
 
-	// Check if it's a NEXT VALUE statement.
+	// Check if it's a NEXT VALUE statement. The values are allocated from the
+	// table if it is a sequence table, else from the sequence of
+	// mysql.wescale_sequences with its name.
 	if nextVal, ok := sel.SelectExprs[0].(*sqlparser.Nextval); ok {
-		if plan.Table == nil || plan.Table.Type != schema.Sequence {
-			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%s is not a sequence", sqlparser.ToString(sel.From))
+		if plan.Table != nil && plan.Table.Type != schema.Sequence {
+			plan.Table = nil
 		}
 		plan.PlanID = PlanNextval
 		v, err := evalengine.Translate(nextVal.Expr, semantics.EmptySemTable())
@@ -68,9 +71,72 @@ func analyzeSelect(sel *sqlparser.Select, tables map[string]*schema.Table) (plan
 		plan.PlanID = PlanSelectLockFunc
 		plan.NeedsReservedConn = true
 	}
+	if plan.PlanID == PlanSelect {
+		plan.PointLookup = analyzePointLookup(sel, plan.Table)
+	}
 	return plan, nil
 }
 
+// analyzePointLookup returns a PointLookup if sel is of the form
+// `select col, ... from t where pk = :v`, where pk is the only primary key
+// column of t and is integral. It returns nil for anything else.
+func analyzePointLookup(sel *sqlparser.Select, table *schema.Table) *PointLookup {
+	if table == nil || len(table.PKColumns) != 1 || len(sel.From) != 1 || sel.Where == nil {
+		return nil
+	}
+	if sel.Distinct || sel.SQLCalcFoundRows || sel.Cache != nil || sel.With != nil || sel.GroupBy != nil ||
+		sel.Having != nil || sel.Windows != nil || sel.OrderBy != nil || sel.Limit != nil ||
+		sel.Lock != sqlparser.NoLock || sel.Into != nil {
+		return nil
+	}
+	if _, ok := sel.From[0].(*sqlparser.AliasedTableExpr); !ok {
+		return nil
+	}
+	pkField := table.GetPKColumn(0)
+	if !sqltypes.IsIntegral(pkField.Type) {
+		return nil
+	}
+	comp, ok := sel.Where.Expr.(*sqlparser.ComparisonExpr)
+	if !ok || comp.Operator != sqlparser.EqualOp {
+		return nil
+	}
+	col, ok := comp.Left.(*sqlparser.ColName)
+	if !ok || !col.Name.EqualString(pkField.Name) {
+		return nil
+	}
+	arg, ok := comp.Right.(sqlparser.Argument)
+	if !ok {
+		return nil
+	}
+	for _, expr := range sel.SelectExprs {
+		switch expr := expr.(type) {
+		case *sqlparser.StarExpr:
+		case *sqlparser.AliasedExpr:
+			if _, ok := expr.Expr.(*sqlparser.ColName); !ok {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+
+	batch := &sqlparser.Select{
+		StraightJoinHint: sel.StraightJoinHint,
+		From:             sqlparser.CloneTableExprs(sel.From),
+		Comments:         sel.Comments,
+		SelectExprs:      append(sqlparser.CloneSelectExprs(sel.SelectExprs), &sqlparser.AliasedExpr{Expr: sqlparser.CloneRefOfColName(col)}),
+		Where: sqlparser.NewWhere(sqlparser.WhereClause, &sqlparser.ComparisonExpr{
+			Operator: sqlparser.InOp,
+			Left:     sqlparser.CloneRefOfColName(col),
+			Right:    sqlparser.NewListArg(PointLookupValues),
+		}),
+	}
+	return &PointLookup{
+		BindVar:    string(arg),
+		BatchQuery: sqlparser.NewParsedQuery(batch),
+	}
+}
+
 // analyzeUpdate code is almost identical to analyzeDelete.
 func analyzeUpdate(upd *sqlparser.Update, tables map[string]*schema.Table) (plan *Plan, err error) {
 	plan = &Plan{
@@ -73,5 +73,21 @@ func (cached *Plan) CachedSize(alloc bool) int64 {
 	if cc, ok := cached.FullStmt.(cachedObject); ok {
 		size += cc.CachedSize(true)
 	}
+	// field PointLookup *vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder.PointLookup
+	size += cached.PointLookup.CachedSize(true)
+	return size
+}
+func (cached *PointLookup) CachedSize(alloc bool) int64 {
+	if cached == nil {
+		return int64(0)
+	}
+	size := int64(0)
+	if alloc {
+		size += int64(24)
+	}
+	// field BindVar string
+	size += hack.RuntimeAllocSize(int64(len(cached.BindVar)))
+	// field BatchQuery *vitess.io/vitess/go/vt/sqlparser.ParsedQuery
+	size += cached.BatchQuery.CachedSize(true)
 	return size
 }
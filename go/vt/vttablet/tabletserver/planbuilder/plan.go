@@ -186,8 +186,25 @@ type Plan struct {
 
 	// NeedsReservedConn indicates at a reserved connection is needed to execute this plan
 	NeedsReservedConn bool
+
+	// PointLookup is set for selects that fetch a single row by an integral
+	// primary key. Such selects can be batched with concurrent lookups on the
+	// same table.
+	PointLookup *PointLookup
+}
+
+// PointLookup describes how a point select can be merged into a batch.
+type PointLookup struct {
+	// BindVar is the name of the bind variable holding the primary key value.
+	BindVar string
+	// BatchQuery selects the original select expressions followed by the
+	// primary key column, for all the keys in the PointLookupValues list.
+	BatchQuery *sqlparser.ParsedQuery
 }
 
+// PointLookupValues is the list bind variable used by PointLookup.BatchQuery.
+const PointLookupValues = "#pointLookupValues"
+
 // TableName returns the table name for the plan.
 func (plan *Plan) TableName() string {
 	for _, permission := range plan.Permissions {
@@ -0,0 +1,208 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// pointLookupBatcher coalesces concurrent point selects by primary key on the
+// same table into a single `pk in (...)` query, and hands every caller the rows
+// that match its own key.
+//
+// The first query of a batch becomes its leader: it waits for the batch window
+// (or until the batch is full), then executes the merged query on behalf of
+// everybody. Batching is best effort: if the merged query fails, every caller
+// falls back to executing its own query.
+type pointLookupBatcher struct {
+	window       time.Duration
+	maxBatchSize int
+
+	mu sync.Mutex
+	// batches holds the batches that are still accepting keys,
+	// indexed by connection setting and merged query.
+	batches map[string]*pointLookupBatch
+
+	batchCount   *stats.Counter
+	batchedCount *stats.Counter
+}
+
+type pointLookupBatch struct {
+	values []*querypb.Value
+	seen   map[string]bool
+	// full is closed when the batch reached maxBatchSize.
+	full chan struct{}
+	// done is closed once rows or err are set.
+	done chan struct{}
+
+	fields []*querypb.Field
+	rows   map[string][]sqltypes.Row
+	err    error
+}
+
+func newPointLookupBatcher(env tabletenv.Env) *pointLookupBatcher {
+	config := env.Config()
+	return &pointLookupBatcher{
+		window:       config.PointLookupBatchWindowSeconds.Get(),
+		maxBatchSize: config.PointLookupBatchMaxSize,
+		batches:      make(map[string]*pointLookupBatch),
+		batchCount:   env.Exporter().NewCounter("PointLookupBatches", "Number of merged point lookup queries sent to MySQL"),
+		batchedCount: env.Exporter().NewCounter("PointLookupBatchedQueries", "Number of point lookups served by a merged query"),
+	}
+}
+
+func (plb *pointLookupBatcher) enabled() bool {
+	return plb.window > 0 && plb.maxBatchSize > 1
+}
+
+// Lookup executes the point lookup of qre as part of a batch. It returns
+// ok=false if the query could not be served by a batch, in which case the
+// caller must execute it by itself.
+func (plb *pointLookupBatcher) Lookup(qre *QueryExecutor) (qr *sqltypes.Result, ok bool) {
+	pl := qre.plan.PointLookup
+	key, value, ok := pointLookupKey(qre.bindVars[pl.BindVar])
+	if !ok {
+		return nil, false
+	}
+	// Only lookups that run on identically set up connections can share a
+	// batch, so the connection setting is part of the batch key.
+	batchQuery := pl.BatchQuery.Query
+	if qre.setting != nil {
+		batchQuery = qre.setting.GetQuery() + ";" + batchQuery
+	}
+
+	plb.mu.Lock()
+	b, joined := plb.batches[batchQuery]
+	if !joined {
+		b = &pointLookupBatch{
+			seen: make(map[string]bool),
+			full: make(chan struct{}),
+			done: make(chan struct{}),
+		}
+		plb.batches[batchQuery] = b
+	}
+	if !b.seen[key] {
+		b.seen[key] = true
+		b.values = append(b.values, value)
+		if len(b.values) >= plb.maxBatchSize {
+			delete(plb.batches, batchQuery)
+			close(b.full)
+		}
+	}
+	plb.mu.Unlock()
+
+	startTime := time.Now()
+	if joined {
+		select {
+		case <-b.done:
+		case <-qre.ctx.Done():
+			return nil, false
+		}
+	} else {
+		plb.lead(qre, batchQuery, b)
+	}
+	qre.tsv.stats.WaitTimings.Record("PointLookupBatch", startTime)
+
+	if b.err != nil {
+		return nil, false
+	}
+	plb.batchedCount.Add(1)
+	return &sqltypes.Result{Fields: b.fields, Rows: b.rows[key]}, true
+}
+
+// lead waits for the batch to fill up, then executes it.
+func (plb *pointLookupBatcher) lead(qre *QueryExecutor, batchQuery string, b *pointLookupBatch) {
+	defer close(b.done)
+
+	timer := time.NewTimer(plb.window)
+	select {
+	case <-timer.C:
+	case <-b.full:
+	case <-qre.ctx.Done():
+	}
+	timer.Stop()
+
+	plb.mu.Lock()
+	if plb.batches[batchQuery] == b {
+		delete(plb.batches, batchQuery)
+	}
+	plb.mu.Unlock()
+
+	plb.batchCount.Add(1)
+	qr, err := qre.execPointLookupBatch(b.values)
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.split(qr)
+}
+
+// split distributes the rows of the merged query by primary key. The
+// primary key is the last column of every row and is stripped from the
+// rows handed out to callers.
+func (b *pointLookupBatch) split(qr *sqltypes.Result) {
+	pkIndex := len(qr.Fields) - 1
+	b.fields = qr.Fields[:pkIndex]
+	b.rows = make(map[string][]sqltypes.Row, len(b.values))
+	for _, row := range qr.Rows {
+		key := row[pkIndex].ToString()
+		b.rows[key] = append(b.rows[key], row[:pkIndex])
+	}
+}
+
+// execPointLookupBatch executes the merged query of the plan for the given
+// primary key values.
+func (qre *QueryExecutor) execPointLookupBatch(values []*querypb.Value) (*sqltypes.Result, error) {
+	bindVars := map[string]*querypb.BindVariable{
+		planbuilder.PointLookupValues: {Type: querypb.Type_TUPLE, Values: values},
+	}
+	sql, _, err := qre.generateFinalSQL(qre.plan.PointLookup.BatchQuery, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := qre.getConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Recycle()
+	return qre.execDBConn(conn, sql, true)
+}
+
+// pointLookupKey normalizes an integral bind variable, so that the key
+// matches the primary key values returned by MySQL.
+func pointLookupKey(bv *querypb.BindVariable) (string, *querypb.Value, bool) {
+	if bv == nil || !sqltypes.IsIntegral(bv.Type) {
+		return "", nil, false
+	}
+	v, err := sqltypes.BindVariableToValue(bv)
+	if err != nil {
+		return "", nil, false
+	}
+	var key string
+	if sqltypes.IsSigned(v.Type()) {
+		n, err := v.ToInt64()
+		if err != nil {
+			return "", nil, false
+		}
+		key = strconv.FormatInt(n, 10)
+	} else {
+		n, err := v.ToUint64()
+		if err != nil {
+			return "", nil, false
+		}
+		key = strconv.FormatUint(n, 10)
+	}
+	return key, &querypb.Value{Type: bv.Type, Value: []byte(key)}, true
+}
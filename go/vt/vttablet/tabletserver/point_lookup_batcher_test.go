@@ -0,0 +1,173 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestPointLookupPlan(t *testing.T) {
+	tables := map[string]*schema.Table{
+		"t": {
+			Name: sqlparser.NewIdentifierCS("t"),
+			Fields: []*querypb.Field{
+				{Name: "id", Type: sqltypes.Int64},
+				{Name: "name", Type: sqltypes.VarChar},
+			},
+			PKColumns: []int{0},
+		},
+		"s": {
+			Name: sqlparser.NewIdentifierCS("s"),
+			Fields: []*querypb.Field{
+				{Name: "name", Type: sqltypes.VarChar},
+			},
+			PKColumns: []int{0},
+		},
+	}
+	testcases := []struct {
+		query string
+		batch string
+	}{{
+		query: "select * from t where id = :id",
+		batch: "select *, id from t where id in ::#pointLookupValues",
+	}, {
+		query: "select x.name from t as x where x.id = :v1",
+		batch: "select x.`name`, x.id from t as x where x.id in ::#pointLookupValues",
+	}, {
+		query: "select * from t where id = 1",
+	}, {
+		query: "select * from t where name = :name",
+	}, {
+		query: "select count(*) from t where id = :id",
+	}, {
+		query: "select * from t where id = :id for update",
+	}, {
+		query: "select * from t where id = :id limit 1",
+	}, {
+		query: "select * from s where name = :name",
+	}, {
+		query: "select * from t join s where id = :id",
+	}}
+	for _, tcase := range testcases {
+		t.Run(tcase.query, func(t *testing.T) {
+			statement, err := sqlparser.Parse(tcase.query)
+			require.NoError(t, err)
+			plan, err := planbuilder.Build(statement, tables, "", false)
+			require.NoError(t, err)
+			if tcase.batch == "" {
+				require.Nil(t, plan.PointLookup)
+				return
+			}
+			require.NotNil(t, plan.PointLookup)
+			require.Equal(t, tcase.batch, plan.PointLookup.BatchQuery.Query)
+		})
+	}
+}
+
+func TestPointLookupBatcher(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	ctx := context.Background()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	// a full batch is executed right away, the window only bounds the wait.
+	tsv.qe.pointLookupBatcher.window = 10 * time.Second
+	tsv.qe.pointLookupBatcher.maxBatchSize = 2
+
+	fields := getTestTableFields()
+	db.AddQueryPattern(`select \*, pk from test_table where pk in \((1, 2|2, 1)\)`, &sqltypes.Result{
+		Fields: append(fields, fields[0]),
+		Rows: [][]sqltypes.Value{
+			{sqltypes.NewInt32(1), sqltypes.NewInt32(10), sqltypes.NewInt32(100), sqltypes.NewInt32(1)},
+			{sqltypes.NewInt32(2), sqltypes.NewInt32(20), sqltypes.NewInt32(200), sqltypes.NewInt32(2)},
+		},
+	})
+
+	batches := tsv.qe.pointLookupBatcher.batchCount.Get()
+	batched := tsv.qe.pointLookupBatcher.batchedCount.Get()
+	query := "select * from test_table where pk = :pk"
+	results := make([]*sqltypes.Result, 2)
+	var wg sync.WaitGroup
+	for i := range results {
+		qre := newTestQueryExecutor(ctx, tsv, query, 0)
+		require.NotNil(t, qre.plan.PointLookup)
+		qre.bindVars["pk"] = sqltypes.Int64BindVariable(int64(i + 1))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			qr, err := qre.Execute()
+			assert.NoError(t, err)
+			results[i] = qr
+		}(i)
+	}
+	wg.Wait()
+
+	for i, qr := range results {
+		require.NotNil(t, qr)
+		assert.Equal(t, fields, qr.Fields)
+		require.Len(t, qr.Rows, 1)
+		assert.Equal(t, []sqltypes.Value{sqltypes.NewInt32(int32(i + 1)), sqltypes.NewInt32(int32(10 * (i + 1))), sqltypes.NewInt32(int32(100 * (i + 1)))}, qr.Rows[0])
+	}
+	assert.EqualValues(t, 1, tsv.qe.pointLookupBatcher.batchCount.Get()-batches)
+	assert.EqualValues(t, 2, tsv.qe.pointLookupBatcher.batchedCount.Get()-batched)
+}
+
+func TestPointLookupBatcherFallback(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	ctx := context.Background()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	tsv.qe.pointLookupBatcher.window = time.Millisecond
+	tsv.qe.pointLookupBatcher.maxBatchSize = 2
+
+	// the merged query is not known to fakesqldb, so the lookup must fall
+	// back to its own query.
+	want := &sqltypes.Result{
+		Fields: getTestTableFields(),
+		Rows:   [][]sqltypes.Value{{sqltypes.NewInt32(3), sqltypes.NewInt32(30), sqltypes.NewInt32(300)}},
+	}
+	db.AddQuery("select * from test_table where pk = 3 limit 100001", want)
+
+	batched := tsv.qe.pointLookupBatcher.batchedCount.Get()
+	qre := newTestQueryExecutor(ctx, tsv, "select * from test_table where pk = :pk", 0)
+	qre.bindVars["pk"] = sqltypes.Int64BindVariable(3)
+	qr, err := qre.Execute()
+	require.NoError(t, err)
+	assert.Equal(t, want.Rows, qr.Rows)
+	assert.EqualValues(t, batched, tsv.qe.pointLookupBatcher.batchedCount.Get())
+}
+
+func TestPointLookupKey(t *testing.T) {
+	key, value, ok := pointLookupKey(sqltypes.Int64BindVariable(-5))
+	assert.True(t, ok)
+	assert.Equal(t, "-5", key)
+	assert.Equal(t, &querypb.Value{Type: querypb.Type_INT64, Value: []byte("-5")}, value)
+
+	key, _, ok = pointLookupKey(&querypb.BindVariable{Type: querypb.Type_UINT64, Value: []byte("007")})
+	assert.True(t, ok)
+	assert.Equal(t, "7", key)
+
+	_, _, ok = pointLookupKey(sqltypes.StringBindVariable("1"))
+	assert.False(t, ok)
+	_, _, ok = pointLookupKey(nil)
+	assert.False(t, ok)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// The queries of the PRIORITY rules compete for the execution slots of the
+// tablet, --queryserver-config-priority-slots, the size of the query pool by
+// default. While the slots are free they run right away. Under load they
+// queue per priority class, and the freed slots go to the waiting classes in
+// proportion to their weights, with stride scheduling: a class of weight 10
+// gets 10 slots for each one of a class of weight 1, so that the OLTP queries
+// overtake the batch ones instead of queuing behind them. A class can't save
+// up slots while it has no queries waiting.
+//
+// The queries which match no PRIORITY rule don't take slots.
+
+// priorityScheduler hands out the execution slots to the priority classes.
+type priorityScheduler struct {
+	mu      sync.Mutex
+	slots   int
+	used    int
+	waiting int
+	classes map[string]*priorityClass
+	// pass is the pass of the class last given a slot, the virtual time of
+	// the scheduler.
+	pass float64
+	// seq numbers the waiters, so that the classes of the same pass are served
+	// first come, first served.
+	seq uint64
+}
+
+// priorityClass is the queue of a priority class. Its pass grows by the
+// inverse of its weight for each slot it gets, and the waiting class of the
+// smallest pass gets the next slot.
+type priorityClass struct {
+	weight  int
+	pass    float64
+	waiters *list.List
+}
+
+// priorityWaiter is a query waiting for a slot. ready is closed when it gets
+// one.
+type priorityWaiter struct {
+	seq   uint64
+	ready chan struct{}
+}
+
+func newPriorityScheduler(slots int) *priorityScheduler {
+	return &priorityScheduler{slots: slots, classes: make(map[string]*priorityClass)}
+}
+
+// acquire waits for a slot for a query of a class, as long as the context
+// allows. It returns whether the query had to queue, and the function which
+// gives the slot back.
+func (ps *priorityScheduler) acquire(ctx context.Context, className string, weight int) (queued bool, release func(), err error) {
+	ps.mu.Lock()
+	class, ok := ps.classes[className]
+	if !ok {
+		class = &priorityClass{waiters: list.New()}
+		ps.classes[className] = class
+	}
+	class.weight = weight
+	if ps.used < ps.slots && ps.waiting == 0 {
+		ps.used++
+		ps.mu.Unlock()
+		return false, ps.release, nil
+	}
+	if class.waiters.Len() == 0 && class.pass < ps.pass {
+		class.pass = ps.pass
+	}
+	ps.seq++
+	waiter := &priorityWaiter{seq: ps.seq, ready: make(chan struct{})}
+	elem := class.waiters.PushBack(waiter)
+	ps.waiting++
+	ps.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return true, ps.release, nil
+	case <-ctx.Done():
+	}
+	ps.mu.Lock()
+	select {
+	case <-waiter.ready:
+		// The slot came with the cancellation: it goes to the next one.
+		ps.mu.Unlock()
+		ps.release()
+	default:
+		class.waiters.Remove(elem)
+		ps.waiting--
+		ps.mu.Unlock()
+	}
+	return true, nil, vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "timed out waiting for an execution slot of priority class %s: %v", className, ctx.Err())
+}
+
+// release gives a slot back, to the next waiting query if any.
+func (ps *priorityScheduler) release() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	var next *priorityClass
+	for _, class := range ps.classes {
+		if class.waiters.Len() == 0 {
+			continue
+		}
+		if next == nil || class.pass < next.pass ||
+			(class.pass == next.pass && class.waiters.Front().Value.(*priorityWaiter).seq < next.waiters.Front().Value.(*priorityWaiter).seq) {
+			next = class
+		}
+	}
+	if next == nil {
+		ps.used--
+		return
+	}
+	waiter := next.waiters.Remove(next.waiters.Front()).(*priorityWaiter)
+	ps.waiting--
+	ps.pass = next.pass
+	next.pass += 1 / float64(next.weight)
+	close(waiter.ready)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityScheduler(t *testing.T) {
+	ps := newPriorityScheduler(1)
+	ctx := context.Background()
+	queued, release, err := ps.acquire(ctx, "oltp", 2)
+	require.NoError(t, err)
+	assert.False(t, queued)
+
+	// Queue 4 queries of each class while the slot is taken.
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(className string, weight, waiting int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			queued, release, err := ps.acquire(ctx, className, weight)
+			assert.NoError(t, err)
+			assert.True(t, queued)
+			mu.Lock()
+			order = append(order, className)
+			mu.Unlock()
+			release()
+		}()
+		// Let each query queue before the next one.
+		assert.Eventually(t, func() bool {
+			ps.mu.Lock()
+			defer ps.mu.Unlock()
+			class := ps.classes[className]
+			return class != nil && class.waiters.Len() == waiting
+		}, 5*time.Second, time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		enqueue("batch", 1, i+1)
+		enqueue("oltp", 2, i+1)
+	}
+	ps.mu.Lock()
+	assert.Equal(t, 8, ps.waiting)
+	ps.mu.Unlock()
+
+	release()
+	wg.Wait()
+	// The oltp class gets 2 slots for each one of the batch class, and the
+	// batch class the rest.
+	assert.Equal(t, []string{"batch", "oltp", "oltp", "batch", "oltp", "oltp", "batch", "batch"}, order)
+	assert.Zero(t, ps.used)
+
+	// A query gives up once its context is done, and its slot goes to the next
+	// query when it comes with the cancellation.
+	_, release, err = ps.acquire(ctx, "oltp", 2)
+	require.NoError(t, err)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	queued, _, err = ps.acquire(timeoutCtx, "batch", 1)
+	assert.True(t, queued)
+	assert.EqualError(t, err, "timed out waiting for an execution slot of priority class batch: context deadline exceeded")
+	assert.Zero(t, ps.waiting)
+	release()
+	assert.Zero(t, ps.used)
+}
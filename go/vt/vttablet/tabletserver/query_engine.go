@@ -24,11 +24,10 @@ package tabletserver
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -58,6 +57,7 @@ import (
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/txserializer"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
 )
 
 // _______________________________________________
@@ -77,6 +77,11 @@ type TabletPlan struct {
 	RowsAffected uint64
 	RowsReturned uint64
 	ErrorCount   uint64
+
+	// dbName is the database the plan was built for.
+	dbName string
+	// access is the access profile of the plan, see planAccess.
+	access planAccess
 }
 
 // AddStats updates the stats for the current TabletPlan.
@@ -101,6 +106,22 @@ func (ep *TabletPlan) Stats() (queryCount uint64, duration, mysqlTime time.Durat
 }
 
 // buildAuthorized builds 'Authorized', which is the runtime part for 'Permissions'.
+// readsTable returns whether the query of the plan reads the table name.
+func (ep *TabletPlan) readsTable(name string) bool {
+	if name == "" {
+		return false
+	}
+	if ep.Table != nil && ep.Table.Name.String() == name {
+		return true
+	}
+	for _, table := range ep.AllTables {
+		if table.Name.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (ep *TabletPlan) buildAuthorized() {
 	ep.Authorized = make([][]*tableacl.ACLResult, len(ep.Permissions))
 	for i, perm := range ep.Permissions {
@@ -159,6 +180,11 @@ type QueryEngine struct {
 	// Services
 	consolidator       *sync2.Consolidator
 	streamConsolidator *StreamConsolidator
+	pointLookupBatcher *pointLookupBatcher
+	// planCacheSnapshotter saves and pre-warms the hottest plans.
+	planCacheSnapshotter *planCacheSnapshotter
+	// actionStates checkpoints and restores the runtime state of the actions.
+	actionStates *actionStateCheckpointer
 	// txSerializer protects vttablet from applications which try to concurrently
 	// UPDATE (or DELETE) a "hot" row (or range of rows).
 	// Such queries would be serialized by MySQL anyway. This serializer prevents
@@ -166,11 +192,44 @@ type QueryEngine struct {
 	// For implementation details, please see BeginExecute() in tabletserver.go.
 	txSerializer          *txserializer.TxSerializer
 	concurrencyController *ccl.ConcurrencyController
+	// resourceGroups limits the queries of the tenants sharing the tablet.
+	resourceGroups *resourceGroups
+	// resultCaches holds the results cached by the CACHE_RESULT rules.
+	resultCaches *resultCaches
+	// rateLimiters holds the token buckets of the RATE_LIMIT and WEBHOOK_NOTIFY
+	// rules.
+	rateLimiters *rateLimiters
+	// auditLogs holds the sinks of the AUDIT and SAMPLE rules.
+	auditLogs *auditLogs
+	// mirrors holds the shadow servers of the MIRROR rules.
+	mirrors *mirrors
+	// webhooks delivers the notifications of the WEBHOOK_NOTIFY rules.
+	webhooks *webhooks
+	// circuitBreakers holds the circuits of the CIRCUIT_BREAKER rules.
+	circuitBreakers *circuitBreakers
+	// adaptiveConcurrency holds the limits of the adaptive
+	// CONCURRENCY_CONTROL rules.
+	adaptiveConcurrency *adaptiveConcurrencyLimits
+	// wasmPlugins holds the WASM plugins of the PLUGIN rules.
+	wasmPlugins *wasm.Registry
+	// wasmRuntime compiles the WASM plugins, and bounds their calls.
+	wasmRuntime *wasm.Runtime
+	// wasmLoader loads the WASM plugins of the PLUGIN rules into wasmPlugins.
+	wasmLoader *wasm.Loader
+	// concurrencyPools holds the limits of the pools of the
+	// CONCURRENCY_CONTROL rules, which follow the rules, not the engine.
+	concurrencyPools *concurrencyPools
+	// priorityScheduler hands out the execution slots to the PRIORITY rules.
+	priorityScheduler *priorityScheduler
 
 	// Vars
 	maxResultSize    sync2.AtomicInt64
 	warnResultSize   sync2.AtomicInt64
 	streamBufferSize sync2.AtomicInt64
+	// streamBudget bounds the result bytes buffered by all in-flight streams,
+	// and streamBufferCapacity the ones of each stream.
+	streamBudget         *sync2.ByteBudget
+	streamBufferCapacity sync2.AtomicInt64
 	// tableaclExemptCount count the number of accesses allowed
 	// based on membership in the superuser ACL
 	tableaclExemptCount  sync2.AtomicInt64
@@ -199,6 +258,7 @@ func NewQueryEngine(env tabletenv.Env, se *schema.Engine) *QueryEngine {
 		MaxEntries:     int64(config.QueryCacheSize),
 		MaxMemoryUsage: config.QueryCacheMemory,
 		LFU:            config.QueryCacheLFU,
+		Sharded:        true,
 	}
 
 	qe := &QueryEngine{
@@ -234,8 +294,41 @@ func NewQueryEngine(env tabletenv.Env, se *schema.Engine) *QueryEngine {
 	} else {
 		log.Info("Stream consolidator is not enabled.")
 	}
+	qe.pointLookupBatcher = newPointLookupBatcher(env)
+	qe.planCacheSnapshotter = newPlanCacheSnapshotter(env, qe)
 	qe.txSerializer = txserializer.New(env)
 	qe.concurrencyController = ccl.New(env.Exporter())
+	qe.resourceGroups = newResourceGroups(env, qe.concurrencyController)
+	qe.resultCaches = newResultCaches()
+	qe.rateLimiters = newRateLimiters()
+	qe.auditLogs = newAuditLogs()
+	qe.mirrors = newMirrors(env.Stats())
+	qe.webhooks = newWebhooks(env.Stats())
+	qe.circuitBreakers = newCircuitBreakers()
+	qe.adaptiveConcurrency = newAdaptiveConcurrencyLimits()
+	qe.wasmPlugins = wasm.NewRegistry()
+	qe.wasmRuntime = wasm.NewRuntime(wasm.Config{
+		Limits: wasm.Limits{
+			Fuel:        config.WasmPlugins.Fuel,
+			MemoryPages: uint32(config.WasmPlugins.MaxMemoryPages),
+			Timeout:     config.WasmPlugins.TimeoutSeconds.Get(),
+		},
+		MaxMetrics: config.WasmPlugins.MaxMetrics,
+	}, env.Exporter())
+	qe.wasmLoader = wasm.NewLoader(qe.wasmRuntime, qe.wasmPlugins, env.Exporter())
+	qe.concurrencyPools = newConcurrencyPools()
+	qe.actionStates = newActionStateCheckpointer(env, qe)
+	// TabletConfig.Verify rejects the invalid policies at startup.
+	if policy, err := rules.ParseConflictPolicy(config.RuleConflictPolicy); err == nil {
+		qe.queryRuleSources.SetConflictPolicy(policy)
+	} else {
+		log.Errorf("Cannot set the rule conflict policy, the %s policy is used: %v", rules.ConflictPipeline, err)
+	}
+	prioritySlots := config.PrioritySlots
+	if prioritySlots <= 0 {
+		prioritySlots = config.OltpReadPool.Size
+	}
+	qe.priorityScheduler = newPriorityScheduler(prioritySlots)
 
 	qe.strictTableACL = config.StrictTableACL
 	qe.enableTableACLDryRun = config.EnableTableACLDryRun
@@ -256,6 +349,8 @@ func NewQueryEngine(env tabletenv.Env, se *schema.Engine) *QueryEngine {
 	qe.maxResultSize = sync2.NewAtomicInt64(int64(config.Oltp.MaxRows))
 	qe.warnResultSize = sync2.NewAtomicInt64(int64(config.Oltp.WarnRows))
 	qe.streamBufferSize = sync2.NewAtomicInt64(int64(config.StreamBufferSize))
+	qe.streamBudget = sync2.NewByteBudget(config.StreamMaxBufferedBytes)
+	qe.streamBufferCapacity = sync2.NewAtomicInt64(config.StreamMaxBufferedBytesPerStream)
 
 	planbuilder.PassthroughDMLs = config.PassthroughDML
 
@@ -264,6 +359,10 @@ func NewQueryEngine(env tabletenv.Env, se *schema.Engine) *QueryEngine {
 	env.Exporter().NewGaugeFunc("MaxResultSize", "Query engine max result size", qe.maxResultSize.Get)
 	env.Exporter().NewGaugeFunc("WarnResultSize", "Query engine warn result size", qe.warnResultSize.Get)
 	env.Exporter().NewGaugeFunc("StreamBufferSize", "Query engine stream buffer size", qe.streamBufferSize.Get)
+	env.Exporter().NewGaugeFunc("StreamMaxBufferedBytes", "Query engine stream max buffered bytes", qe.streamBudget.Capacity)
+	env.Exporter().NewGaugeFunc("StreamMaxBufferedBytesPerStream", "Query engine stream max buffered bytes per stream", qe.streamBufferCapacity.Get)
+	env.Exporter().NewGaugeFunc("StreamBufferedBytes", "Result bytes currently buffered by streaming queries", qe.streamBudget.InUse)
+	env.Exporter().NewGaugeFunc("StreamBackpressureWaiters", "Number of streams currently blocked on the stream buffer budget", qe.streamBudget.Waiters)
 	env.Exporter().NewCounterFunc("TableACLExemptCount", "Query engine table ACL exempt count", qe.tableaclExemptCount.Get)
 
 	env.Exporter().NewGaugeFunc("QueryCacheLength", "Query engine query cache length", func() int64 {
@@ -279,6 +378,7 @@ func NewQueryEngine(env tabletenv.Env, se *schema.Engine) *QueryEngine {
 	qe.queryErrorCounts = env.Exporter().NewCountersWithMultiLabels("QueryErrorCounts", "query error counts", []string{"Table", "Plan"})
 
 	env.Exporter().HandleFunc("/debug/ccl", qe.concurrencyController.ServeHTTP)
+	env.Exporter().HandleFunc("/debug/resource_groups", qe.resourceGroups.ServeHTTP)
 	env.Exporter().HandleFunc("/debug/hotrows", qe.txSerializer.ServeHTTP)
 	env.Exporter().HandleFunc("/debug/tablet_plans", qe.handleHTTPQueryPlans)
 	env.Exporter().HandleFunc("/debug/tablet_plans_json", qe.handleHTTPTabletPlansJSON)
@@ -297,6 +397,10 @@ func (qe *QueryEngine) Open() error {
 	}
 	log.Info("Query Engine: opening")
 
+	if err := qe.resourceGroups.Open(); err != nil {
+		return err
+	}
+
 	qe.conns.Open(qe.env.Config().DB.AppWithDB(), qe.env.Config().DB.DbaWithDB(), qe.env.Config().DB.AppDebugWithDB())
 
 	conn, err := qe.conns.Get(tabletenv.LocalContext(), nil)
@@ -321,6 +425,8 @@ func (qe *QueryEngine) Open() error {
 
 	qe.se.RegisterNotifier("qe", qe.schemaChanged)
 	qe.isOpen = true
+	qe.planCacheSnapshotter.Open()
+	qe.actionStates.Open()
 	return nil
 }
 
@@ -332,8 +438,17 @@ func (qe *QueryEngine) Close() {
 		return
 	}
 	// Close in reverse order of Open.
+	qe.actionStates.Close()
+	qe.planCacheSnapshotter.Close()
 	qe.se.UnregisterNotifier("qe")
 	qe.plans.Clear()
+	qe.resultCaches.clear()
+	qe.rateLimiters.clear()
+	qe.auditLogs.close()
+	qe.mirrors.close()
+	qe.webhooks.close()
+	qe.circuitBreakers.clear()
+	qe.adaptiveConcurrency.clear()
 	qe.tables = make(map[string]*schema.Table)
 	qe.streamWithoutDBConns.Close()
 	qe.withoutDBConns.Close()
@@ -369,7 +484,7 @@ func (qe *QueryEngine) GetPlan(ctx context.Context, logStats *tabletenv.LogStats
 	if err != nil {
 		return nil, err
 	}
-	plan := &TabletPlan{Plan: splan, Original: sql, QueryTemplateID: GenerateSQLHash(sql)}
+	plan := &TabletPlan{Plan: splan, Original: sql, QueryTemplateID: GenerateSQLHash(sql), dbName: dbName}
 	plan.Rules = qe.queryRuleSources.FilterByPlan(sql, plan.PlanID, plan.TableNames()...)
 	plan.buildAuthorized()
 	if plan.PlanID == planbuilder.PlanDDL || plan.PlanID == planbuilder.PlanSet {
@@ -444,6 +559,81 @@ func (qe *QueryEngine) ClearQueryPlanCache() {
 	qe.plans.Clear()
 }
 
+// releaseRemovedRules drops what the actions of the rules no longer loaded by
+// any source hold, like their token buckets, once the rules are set: the
+// renamed rules start over under their new name. The mirrors and the audit
+// sinks which the changed rules no longer use are stopped as well.
+func (qe *QueryEngine) releaseRemovedRules() {
+	ruleNames := make(map[string]bool)
+	mirrors := make(map[string]*MirrorAction)
+	auditLogs := make(map[string]bool)
+	qe.queryRuleSources.ForEachSource(func(_ string, qrs *rules.Rules) {
+		qrs.ForEachRule(func(qr *rules.Rule) {
+			ruleNames[qr.Name] = true
+			switch action := qr.CompiledAction().(type) {
+			case *MirrorAction:
+				mirrors[qr.Name] = action
+			case *AuditAction:
+				auditLogs[auditLogKey(action.File, action.URL)] = true
+			case *SampleAction:
+				auditLogs[auditLogKey(action.File, "")] = true
+			}
+		})
+	})
+	qe.rateLimiters.retain(ruleNames)
+	qe.resultCaches.retain(ruleNames)
+	qe.circuitBreakers.retain(ruleNames)
+	qe.adaptiveConcurrency.retain(ruleNames)
+	qe.mirrors.retain(mirrors)
+	qe.auditLogs.retain(auditLogs)
+}
+
+// pluginReferences returns the references the PLUGIN rules of all the
+// sources make to the WASM plugins, sorted.
+func (qe *QueryEngine) pluginReferences() []string {
+	refs := make(map[string]bool)
+	qe.queryRuleSources.ForEachSource(func(_ string, qrs *rules.Rules) {
+		qrs.ForEachRule(func(qr *rules.Rule) {
+			if action, ok := qr.CompiledAction().(*PluginAction); ok {
+				refs[action.Plugin] = true
+			}
+		})
+	})
+	sorted := make([]string, 0, len(refs))
+	for ref := range refs {
+		sorted = append(sorted, ref)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// resizeConcurrencyControlQueues applies the limits of the CONCURRENCY_CONTROL
+// rules of all the sources to their queues and their pools as soon as the
+// rules are set, instead of when their next query arrives: the queries
+// waiting in them keep their place.
+func (qe *QueryEngine) resizeConcurrencyControlQueues() {
+	var actions []*ConcurrencyControlAction
+	qe.queryRuleSources.ForEachSource(func(_ string, qrs *rules.Rules) {
+		qrs.ForEachRule(func(qr *rules.Rule) {
+			if qr.Status == rules.InActive || qr.GetActionType() != rules.QRConcurrencyControl.ToString() {
+				return
+			}
+			action, err := CreateActionInstance(rules.QRConcurrencyControl, qr)
+			if err != nil {
+				return
+			}
+			actions = append(actions, action.(*ConcurrencyControlAction))
+		})
+	})
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].Rule.RunsBefore(actions[j].Rule) })
+	qe.concurrencyPools.set(actions)
+	for _, action := range actions {
+		if resized := action.resizeQueues(qe); resized > 0 {
+			log.Infof("resized %d concurrency control queues of rule %s", resized, action.Rule.Name)
+		}
+	}
+}
+
 // IsMySQLReachable returns an error if it cannot connect to MySQL.
 // This can be called before opening the QueryEngine.
 func (qe *QueryEngine) IsMySQLReachable() error {
@@ -729,9 +919,7 @@ func (qe *QueryEngine) InUse() int64 {
 	return qe.conns.InUse() + qe.streamConns.InUse() + qe.streamWithoutDBConns.InUse() + qe.withoutDBConns.InUse()
 }
 
+// GenerateSQLHash returns the digest of a query, see rules.Digest.
 func GenerateSQLHash(sqlTemplate string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(sqlTemplate))
-	fullHash := hex.EncodeToString(hasher.Sum(nil))
-	return fullHash[:8]
+	return rules.Digest(sqlTemplate)
 }
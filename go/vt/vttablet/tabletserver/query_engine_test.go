@@ -51,6 +51,7 @@ import (
 	"vitess.io/vitess/go/vt/dbconfigs"
 	"vitess.io/vitess/go/vt/tableacl"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema/schematest"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
@@ -680,3 +681,85 @@ func TestXXHash(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryEngineRuleConflictPolicy(t *testing.T) {
+	for name, want := range map[string]rules.ConflictPolicy{
+		"first_match": rules.ConflictFirstMatch,
+		"nope":        rules.ConflictPipeline,
+	} {
+		config := tabletenv.NewDefaultConfig()
+		config.RuleConflictPolicy = name
+		env := tabletenv.NewEnv(config, "TabletServerTest")
+		qe := NewQueryEngine(env, schema.NewEngine(env))
+		assert.Equal(t, want, qe.queryRuleSources.FilterByPlan("select 1", planbuilder.PlanSelect).ConflictPolicy(), name)
+	}
+}
+
+func TestQueryEngineReleaseRemovedRules(t *testing.T) {
+	env := tabletenv.NewEnv(tabletenv.NewDefaultConfig(), "TabletServerTest")
+	qe := NewQueryEngine(env, schema.NewEngine(env))
+	dir := t.TempDir()
+	setRules := func(args map[string]string) {
+		qrs := rules.New()
+		for name, arg := range args {
+			action := map[string]rules.Action{
+				"audit":   rules.QRAudit,
+				"sample":  rules.QRSample,
+				"cache":   rules.QRCacheResult,
+				"circuit": rules.QRCircuitBreaker,
+			}[strings.Split(name, "_")[0]]
+			qr := rules.NewActiveQueryRule("ruleDescription", name, action)
+			qr.SetActionArgs(arg)
+			qrs.Add(qr)
+		}
+		require.NoError(t, compileRules(qrs))
+		require.NoError(t, qe.queryRuleSources.SetRules("releaseRules", qrs))
+		qe.releaseRemovedRules()
+	}
+	qe.queryRuleSources.RegisterSource("releaseRules")
+	audit := fmt.Sprintf(`{"file": %q}`, path.Join(dir, "audit.log"))
+	sample := fmt.Sprintf(`{"percentage": 10, "file": %q}`, path.Join(dir, "samples.log"))
+	setRules(map[string]string{
+		"audit_rule":   audit,
+		"sample_rule":  sample,
+		"cache_rule":   `{"ttl": "1m"}`,
+		"circuit_rule": `{"error_rate": 50}`,
+	})
+	auditLog := qe.auditLogs.get(path.Join(dir, "audit.log"), "", defaultAuditQueueSize)
+	qe.auditLogs.getRotatingFile(path.Join(dir, "samples.log"), defaultSampleFileSize, 1, defaultAuditQueueSize)
+	qe.resultCaches.get("cache_rule", defaultResultCacheSize)
+	qe.circuitBreakers.get("circuit_rule", circuitBreakerConfig{})
+	qe.adaptiveConcurrency.get("circuit_rule", adaptiveConcurrencyConfig{}, time.Now())
+	setRules(map[string]string{
+		"audit_rule":   audit,
+		"sample_rule":  sample,
+		"cache_rule":   `{"ttl": "1m"}`,
+		"circuit_rule": `{"error_rate": 50}`,
+	})
+	assert.Len(t, qe.auditLogs.logs, 2)
+	_, ok := qe.resultCaches.caches.Load("cache_rule")
+	assert.True(t, ok)
+	assert.Len(t, qe.circuitBreakers.breakers, 1)
+	assert.Len(t, qe.adaptiveConcurrency.limits, 1)
+
+	// The sink a rule no longer writes to is flushed and stopped, the ones of
+	// the removed rules as well.
+	require.True(t, auditLog.send([]byte("record")))
+	setRules(map[string]string{
+		"audit_rule":  fmt.Sprintf(`{"file": %q}`, path.Join(dir, "audit2.log")),
+		"sample_rule": sample,
+	})
+	assert.Len(t, qe.auditLogs.logs, 1)
+	assert.Contains(t, qe.auditLogs.logs, auditLogKey(path.Join(dir, "samples.log"), ""))
+	data, err := os.ReadFile(path.Join(dir, "audit.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "record\n", string(data))
+	<-auditLog.done
+	_, ok = qe.resultCaches.caches.Load("cache_rule")
+	assert.False(t, ok)
+	assert.Empty(t, qe.circuitBreakers.breakers)
+	assert.Empty(t, qe.adaptiveConcurrency.limits)
+
+	setRules(nil)
+	assert.Empty(t, qe.auditLogs.logs)
+}
@@ -25,6 +25,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -38,6 +39,7 @@ import (
 	"vitess.io/vitess/go/mysql/collations"
 	"vitess.io/vitess/go/pools"
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/sync2"
 	"vitess.io/vitess/go/trace"
 	"vitess.io/vitess/go/vt/callerid"
 	"vitess.io/vitess/go/vt/callinfo"
@@ -59,24 +61,34 @@ import (
 
 // QueryExecutor is used for executing a query request.
 type QueryExecutor struct {
-	query             string
-	marginComments    sqlparser.MarginComments
-	bindVars          map[string]*querypb.BindVariable
-	connID            int64
-	options           *querypb.ExecuteOptions
-	plan              *TabletPlan
-	ctx               context.Context
-	logStats          *tabletenv.LogStats
-	tsv               *TabletServer
-	tabletType        topodatapb.TabletType
+	query          string
+	marginComments sqlparser.MarginComments
+	bindVars       map[string]*querypb.BindVariable
+	connID         int64
+	options        *querypb.ExecuteOptions
+	plan           *TabletPlan
+	ctx            context.Context
+	logStats       *tabletenv.LogStats
+	tsv            *TabletServer
+	tabletType     topodatapb.TabletType
+	// database is the database of the query, the keyspace of its target.
+	database          string
 	setting           *pools.Setting
 	matchedActionList []ActionInterface
 	calledActionList  []ActionInterface
+	// resourceGroup is the resource group the query was admitted into, if any.
+	resourceGroup *resourceGroup
+	// affectedRules are the names of the rules which affected the query, see
+	// ruleAffected.
+	affectedRules []string
 }
 
 const (
 	streamRowsSize         = 256
 	maxQueryBufferDuration = 10 * time.Second
+	// maxPooledBindVars is the size above which bind variable maps are
+	// not returned to the pool: a cleared map keeps its buckets.
+	maxPooledBindVars = 64
 )
 
 var (
@@ -85,6 +97,12 @@ var (
 			Rows: make([][]sqltypes.Value, 0, streamRowsSize),
 		}
 	}}
+	queryExecutorPool = sync.Pool{New: func() any {
+		return &QueryExecutor{}
+	}}
+	bindVarsPool = sync.Pool{New: func() any {
+		return make(map[string]*querypb.BindVariable)
+	}}
 	sequenceFields = []*querypb.Field{
 		{
 			Name: "nextval",
@@ -108,6 +126,40 @@ func allocStreamResult() *sqltypes.Result {
 	return streamResultPool.Get().(*sqltypes.Result)
 }
 
+// allocQueryExecutor returns a QueryExecutor from the pool. It must not be
+// referenced anymore once given back with returnQueryExecutor.
+func allocQueryExecutor() *QueryExecutor {
+	return queryExecutorPool.Get().(*QueryExecutor)
+}
+
+func returnQueryExecutor(qre *QueryExecutor) {
+	called := qre.calledActionList
+	clear(called)
+	*qre = QueryExecutor{}
+	qre.calledActionList = called[:0]
+	queryExecutorPool.Put(qre)
+}
+
+// allocBindVars returns an empty bind variable map from the pool.
+func allocBindVars() map[string]*querypb.BindVariable {
+	return bindVarsPool.Get().(map[string]*querypb.BindVariable)
+}
+
+func returnBindVars(bindVars map[string]*querypb.BindVariable) {
+	if len(bindVars) > maxPooledBindVars {
+		return
+	}
+	clear(bindVars)
+	bindVarsPool.Put(bindVars)
+}
+
+// shouldBatchPointLookup returns true if the query can be merged with
+// concurrent point lookups on the same table.
+func (qre *QueryExecutor) shouldBatchPointLookup() bool {
+	return qre.plan.PointLookup != nil && qre.tsv.qe.pointLookupBatcher.enabled() &&
+		(qre.setting == nil || !qre.setting.GetWithoutDBName()) && qre.options.GetReadAfterWriteGtid() == ""
+}
+
 func (qre *QueryExecutor) shouldConsolidate() bool {
 	co := qre.options.GetConsolidator()
 	switch co {
@@ -155,17 +207,43 @@ func (qre *QueryExecutor) Execute() (reply *sqltypes.Result, err error) {
 		return qre.getFilterInfo()
 	}
 
+	done, err := qre.enterResourceGroup()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	defer func() {
+		if err == nil && reply != nil {
+			if err = qre.checkResourceGroupResult(reply); err != nil {
+				reply = nil
+			}
+		}
+	}()
+
+	if qre.isFastPathRead() {
+		return qre.execFastPathRead()
+	}
+
 	qr, err := qre.runActionListBeforeExecution()
 
 	defer func() {
 		reply, err = qre.runActionListAfterExecution(reply, err)
+		// The results are rewritten even when an action answered the query
+		// before the rewriting ones ran, like from a cache.
+		if err == nil && reply != nil {
+			reply, err = qre.rewriteResult(qre.matchedActionList, reply, true)
+		}
 	}()
 
 	if qr != nil || err != nil {
 		return qr, err
 	}
+	return qre.execPlan()
+}
 
-	if err = qre.checkPermissions(); err != nil {
+// execPlan executes the plan of the query, once its actions let it run.
+func (qre *QueryExecutor) execPlan() (*sqltypes.Result, error) {
+	if err := qre.checkPermissions(); err != nil {
 		return nil, err
 	}
 
@@ -174,9 +252,8 @@ func (qre *QueryExecutor) Execute() (reply *sqltypes.Result, err error) {
 	}
 
 	if qre.connID != 0 {
-		var conn *StatefulConnection
 		// Need upfront connection for DMLs and transactions
-		conn, err = qre.tsv.te.txPool.GetAndLock(qre.connID, "for query")
+		conn, err := qre.tsv.te.txPool.GetAndLock(qre.connID, "for query")
 		if err != nil {
 			return nil, err
 		}
@@ -191,19 +268,7 @@ func (qre *QueryExecutor) Execute() (reply *sqltypes.Result, err error) {
 
 	switch qre.plan.PlanID {
 	case p.PlanSelect, p.PlanSelectImpossible, p.PlanShow:
-		maxrows := qre.getSelectLimit()
-		qre.bindVars["#maxLimit"] = sqltypes.Int64BindVariable(maxrows + 1)
-		if qre.bindVars[sqltypes.BvReplaceSchemaName] != nil {
-			qre.bindVars[sqltypes.BvSchemaName] = sqltypes.StringBindVariable(qre.tsv.config.DB.DBName)
-		}
-		qr, err := qre.execSelect()
-		if err != nil {
-			return nil, err
-		}
-		if err := qre.verifyRowCount(int64(len(qr.Rows)), maxrows); err != nil {
-			return nil, err
-		}
-		return qr, nil
+		return qre.execSelectWithLimit()
 	case p.PlanOtherRead, p.PlanOtherAdmin, p.PlanFlush, p.PlanSavepoint, p.PlanRelease, p.PlanSRollback:
 		return qre.execOther()
 	case p.PlanInsert, p.PlanUpdate, p.PlanDelete, p.PlanInsertMessage, p.PlanDDL, p.PlanLoad:
@@ -432,7 +497,7 @@ func execWithDDLView(ctx context.Context, conn *StatefulConnection, sql string)
 }
 
 // Stream performs a streaming query execution.
-func (qre *QueryExecutor) Stream(callback StreamCallback) error {
+func (qre *QueryExecutor) Stream(callback StreamCallback) (err error) {
 	qre.logStats.PlanType = qre.plan.PlanID.String()
 
 	defer func(start time.Time) {
@@ -444,6 +509,16 @@ func (qre *QueryExecutor) Stream(callback StreamCallback) error {
 		return err
 	}
 
+	done, err := qre.enterResourceGroup()
+	if err != nil {
+		return err
+	}
+	defer done()
+	callback, end := qre.streamResultRewriters(callback)
+	defer func() {
+		err = end(err)
+	}()
+
 	switch qre.plan.PlanID {
 	case p.PlanSelectStream:
 		if qre.bindVars[sqltypes.BvReplaceSchemaName] != nil {
@@ -556,7 +631,62 @@ func (qre *QueryExecutor) MessageStream(callback StreamCallback) error {
 	return nil
 }
 
+// workloadClass returns the workload class of the session of the query, which
+// vtgate sends as the subcomponent of the effective caller.
+func (qre *QueryExecutor) workloadClass() string {
+	return callerid.GetSubcomponent(callerid.EffectiveCallerIDFromContext(qre.ctx))
+}
+
+// inTransaction returns whether the query runs in an explicit transaction,
+// rather than in autocommit or on a reserved connection.
+func (qre *QueryExecutor) inTransaction() bool {
+	return qre.logStats != nil && qre.logStats.TransactionID != 0
+}
+
+// startTime returns the time the query was received at.
+func (qre *QueryExecutor) startTime() time.Time {
+	if qre.logStats == nil {
+		return time.Now()
+	}
+	return qre.logStats.StartTime
+}
+
 func (qre *QueryExecutor) initDatabaseProxyFilter() {
+	pluginList := qre.matchActions()
+	for _, a := range pluginList {
+		qre.ruleMatched(a.GetRule())
+	}
+	qre.matchedActionList = pluginList
+}
+
+// ruleMatched records that a rule matched the query.
+func (qre *QueryExecutor) ruleMatched(rule *rules.Rule) {
+	qre.tsv.stats.QueryRuleMatches.Add(rule.Name, 1)
+	qre.tsv.stats.QueryRuleLastMatch.Set(rule.Name, time.Now().Unix())
+}
+
+// ruleAffected records that a rule affected the query, blocking, answering,
+// queueing, delaying or rewriting it, once per query.
+func (qre *QueryExecutor) ruleAffected(rule *rules.Rule) {
+	for _, name := range qre.affectedRules {
+		if name == rule.Name {
+			return
+		}
+	}
+	qre.affectedRules = append(qre.affectedRules, rule.Name)
+	if qre.tsv != nil {
+		qre.tsv.stats.QueryRuleAffected.Add(rule.Name, 1)
+	}
+}
+
+// matchActions returns the actions of the rules the query matches.
+func (qre *QueryExecutor) matchActions() []ActionInterface {
+	return qre.matchActionsOf(qre.plan.Rules, qre.accessProfile)
+}
+
+// matchActionsOf returns the actions of the rules of qrs the query matches,
+// given its access profile.
+func (qre *QueryExecutor) matchActionsOf(qrs *rules.Rules, access func() *rules.AccessProfile) []ActionInterface {
 	remoteAddr := ""
 	username := ""
 	ci, ok := callinfo.FromContext(qre.ctx)
@@ -565,20 +695,130 @@ func (qre *QueryExecutor) initDatabaseProxyFilter() {
 		username = ci.Username()
 	}
 
-	pluginList := GetActionList(qre.plan.Rules, remoteAddr, username, qre.bindVars, qre.marginComments)
-	qre.matchedActionList = pluginList
+	namespace := qre.tsv.qe.resourceGroups.ruleNamespace(qre.database)
+	return GetActionList(qrs, remoteAddr, username, qre.workloadClass(), namespace, qre.inTransaction(), qre.bindVars, qre.marginComments, access)
+}
+
+// rewriteResult rewrites a result with the ResultRewriters of a list of
+// actions. The last result of a query, like the one of Execute, is ended by
+// each ResultEnder once it rewrote it.
+func (qre *QueryExecutor) rewriteResult(actions []ActionInterface, result *sqltypes.Result, last bool) (*sqltypes.Result, error) {
+	for _, a := range actions {
+		if rewriter, ok := a.(ResultRewriter); ok {
+			rewritten, err := rewriter.RewriteResult(qre, result)
+			if ender, ok := a.(ResultEnder); ok && last && err == nil {
+				var appended *sqltypes.Result
+				appended, err = ender.EndResult(qre, nil)
+				rewritten = appendRows(rewritten, appended)
+			}
+			if err != nil {
+				qre.ruleAffected(a.GetRule())
+				return nil, err
+			}
+			if rewritten != result {
+				qre.ruleAffected(a.GetRule())
+			}
+			result = rewritten
+		}
+	}
+	return result, nil
+}
+
+// appendRows returns a result with the rows of appended after its own.
+func appendRows(result, appended *sqltypes.Result) *sqltypes.Result {
+	if appended == nil || len(appended.Rows) == 0 {
+		return result
+	}
+	out := result.ShallowCopy()
+	out.StatusFlags = result.StatusFlags
+	out.Rows = append(slices.Clip(result.Rows), appended.Rows...)
+	// The results which count their rows in their rows affected keep
+	// counting them.
+	if result.RowsAffected == uint64(len(result.Rows)) {
+		out.RowsAffected = uint64(len(out.Rows))
+	}
+	return out
+}
+
+// streamResultRewriters wraps the callback of a streamed query with the
+// ResultRewriters of the rules it matches, the only actions which apply to
+// the streams. end is called with the error of the query once it is done,
+// and returns the error of the query: it ends the results of the
+// ResultEnders, sending the rows they append through the rewriters after
+// them.
+func (qre *QueryExecutor) streamResultRewriters(callback StreamCallback) (wrapped StreamCallback, end func(err error) error) {
+	var rewriters []ActionInterface
+	for _, a := range qre.matchActions() {
+		if _, ok := a.(*StopAction); ok {
+			break
+		}
+		if _, ok := a.(ResultRewriter); ok {
+			qre.ruleMatched(a.GetRule())
+			rewriters = append(rewriters, a)
+		}
+	}
+	if len(rewriters) == 0 {
+		return callback, func(err error) error { return err }
+	}
+	// The rewriters see all the fields, like in Execute, and the client the
+	// ones it asked for.
+	includedFields := sqltypes.IncludeFieldsOrDefault(qre.options)
+	if includedFields != querypb.ExecuteOptions_ALL {
+		options := &querypb.ExecuteOptions{}
+		if qre.options != nil {
+			options = proto.Clone(qre.options).(*querypb.ExecuteOptions)
+		}
+		options.IncludedFields = querypb.ExecuteOptions_ALL
+		qre.options = options
+	}
+	send := func(rewriters []ActionInterface, result *sqltypes.Result) error {
+		result, err := qre.rewriteResult(rewriters, result, false)
+		if err != nil {
+			return err
+		}
+		return callback(result.StripMetadata(includedFields))
+	}
+	end = func(err error) error {
+		for i, a := range rewriters {
+			ender, ok := a.(ResultEnder)
+			if !ok {
+				continue
+			}
+			appended, endErr := ender.EndResult(qre, err)
+			if endErr != err || (appended != nil && len(appended.Rows) > 0) {
+				qre.ruleAffected(a.GetRule())
+			}
+			if err = endErr; err == nil && appended != nil && len(appended.Rows) > 0 {
+				err = send(rewriters[i+1:], appended)
+			}
+		}
+		return err
+	}
+	return func(result *sqltypes.Result) error {
+		return send(rewriters, result)
+	}, end
 }
 
-// runActionListBeforeExecution runs the action list and returns the first error it encounters.
+// runActionListBeforeExecution runs the action list and returns the first error it encounters,
+// or the first result, which is the result of the query.
 func (qre *QueryExecutor) runActionListBeforeExecution() (*sqltypes.Result, error) {
 	if len(qre.matchedActionList) == 0 {
 		return nil, nil
 	}
-	for _, a := range qre.matchedActionList {
+	for i, a := range qre.matchedActionList {
+		query := qre.query
 		qr, err := a.BeforeExecution(qre)
 		qre.calledActionList = append(qre.calledActionList, a)
+		if qre.query != query || qr != nil || (err != nil && err != ErrSkipRemainingActions) {
+			qre.ruleAffected(a.GetRule())
+		}
+		if err == ErrSkipRemainingActions {
+			// The skipped actions don't rewrite the result either.
+			qre.matchedActionList = qre.matchedActionList[:i+1]
+			return nil, nil
+		}
 		if qr != nil || err != nil {
-			return nil, err
+			return qr, err
 		}
 	}
 	return nil, nil
@@ -594,6 +834,9 @@ func (qre *QueryExecutor) runActionListAfterExecution(reply *sqltypes.Result, er
 	for i := len(qre.calledActionList) - 1; i >= 0; i-- {
 		a := qre.matchedActionList[i]
 		resp := a.AfterExecution(qre, newReply, newErr)
+		if resp.Reply != newReply || resp.Err != newErr {
+			qre.ruleAffected(a.GetRule())
+		}
 		newReply, newErr = resp.Reply, resp.Err
 	}
 	return newReply, newErr
@@ -619,12 +862,24 @@ func (qre *QueryExecutor) checkPermissions() error {
 	bufferingTimeoutCtx, cancel := context.WithTimeout(qre.ctx, maxQueryBufferDuration)
 	defer cancel()
 
-	action, ruleCancelCtx, desc := qre.plan.Rules.GetAction(remoteAddr, username, qre.bindVars, qre.marginComments)
+	action, rule := qre.plan.Rules.GetActionRule(remoteAddr, username, qre.workloadClass(), qre.inTransaction(), qre.bindVars, qre.marginComments)
+	var ruleCancelCtx context.Context
+	desc := ""
+	if rule != nil {
+		ruleCancelCtx, desc = rule.GetCancelCtx(), rule.Description
+	}
 	switch action {
-	case rules.QRFail:
+	case rules.QRFail, rules.QRFailRetry:
+		// The queries fail like in the action pipeline, with the error the
+		// params of the rule set.
+		if p, err := CreateActionInstance(action, rule); err == nil {
+			_, err = p.BeforeExecution(qre)
+			return err
+		}
+		if action == rules.QRFailRetry {
+			return vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "disallowed due to rule: %s", desc)
+		}
 		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "disallowed due to rule: %s", desc)
-	case rules.QRFailRetry:
-		return vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "disallowed due to rule: %s", desc)
 	case rules.QRBuffer:
 		if ruleCancelCtx != nil {
 			// We buffer up to some timeout. The timeout is determined by ctx.Done().
@@ -802,71 +1057,42 @@ func (qre *QueryExecutor) execNextval() (*sqltypes.Result, error) {
 		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid increment for sequence %s: %s", tableName, v.String())
 	}
 
-	t := qre.plan.Table
-	t.SequenceInfo.Lock()
-	defer t.SequenceInfo.Unlock()
-	if t.SequenceInfo.NextVal == 0 || t.SequenceInfo.NextVal+inc > t.SequenceInfo.LastVal {
-		_, err := qre.execAsTransaction(func(conn *StatefulConnection) (*sqltypes.Result, error) {
-			query := fmt.Sprintf("select next_id, cache from %s where id = 0 for update", tableName)
-			qr, err := qre.execStatefulConn(conn, query, false)
-			if err != nil {
-				return nil, err
-			}
-			if len(qr.Rows) != 1 {
-				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unexpected rows from reading sequence %s (possible mis-route): %d", tableName, len(qr.Rows))
-			}
-			nextID, err := evalengine.ToInt64(qr.Rows[0][0])
-			if err != nil {
-				return nil, vterrors.Wrapf(err, "error loading sequence %s", tableName)
-			}
-			// If LastVal does not match next ID, then either:
-			// VTTablet just started, and we're initializing the cache, or
-			// Someone reset the id underneath us.
-			if t.SequenceInfo.LastVal != nextID {
-				if nextID < t.SequenceInfo.LastVal {
-					log.Warningf("Sequence next ID value %v is below the currently cached max %v, updating it to max", nextID, t.SequenceInfo.LastVal)
-					nextID = t.SequenceInfo.LastVal
-				}
-				t.SequenceInfo.NextVal = nextID
-				t.SequenceInfo.LastVal = nextID
-			}
-			cache, err := evalengine.ToInt64(qr.Rows[0][1])
-			if err != nil {
-				return nil, vterrors.Wrapf(err, "error loading sequence %s", tableName)
-			}
-			if cache < 1 {
-				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid cache value for sequence %s: %d", tableName, cache)
-			}
-			newLast := nextID + cache
-			for newLast < t.SequenceInfo.NextVal+inc {
-				newLast += cache
-			}
-			query = fmt.Sprintf("update %s set next_id = %d where id = 0", tableName, newLast)
-			conn.TxProperties().RecordQuery(query)
-			_, err = qre.execStatefulConn(conn, query, false)
-			if err != nil {
-				return nil, err
-			}
-			t.SequenceInfo.LastVal = newLast
-			return nil, nil
+	if qre.plan.Table == nil {
+		return qre.execSequenceNextval(tableName, inc)
+	}
+	return qre.nextSequenceValues(qre.plan.Table.SequenceInfo, tableName, inc,
+		fmt.Sprintf("select next_id, cache from %s where id = 0 for update", tableName),
+		func(newLast int64) (string, error) {
+			return fmt.Sprintf("update %s set next_id = %d where id = 0", tableName, newLast), nil
 		})
-		if err != nil {
-			return nil, err
-		}
+}
+
+// execSelectWithLimit executes a select, making sure it does not return more
+// rows than the select limit.
+func (qre *QueryExecutor) execSelectWithLimit() (*sqltypes.Result, error) {
+	maxrows := qre.getSelectLimit()
+	qre.bindVars["#maxLimit"] = sqltypes.Int64BindVariable(maxrows + 1)
+	if qre.bindVars[sqltypes.BvReplaceSchemaName] != nil {
+		qre.bindVars[sqltypes.BvSchemaName] = sqltypes.StringBindVariable(qre.tsv.config.DB.DBName)
 	}
-	ret := t.SequenceInfo.NextVal
-	t.SequenceInfo.NextVal += inc
-	return &sqltypes.Result{
-		Fields: sequenceFields,
-		Rows: [][]sqltypes.Value{{
-			sqltypes.NewInt64(ret),
-		}},
-	}, nil
+	qr, err := qre.execSelect()
+	if err != nil {
+		return nil, err
+	}
+	if err := qre.verifyRowCount(int64(len(qr.Rows)), maxrows); err != nil {
+		return nil, err
+	}
+	return qr, nil
 }
 
 // execSelect sends a query to mysql only if another identical query is not running. Otherwise, it waits and
 // reuses the result. If the plan is missing field info, it sends the query to mysql requesting full info.
 func (qre *QueryExecutor) execSelect() (*sqltypes.Result, error) {
+	if qre.shouldBatchPointLookup() {
+		if qr, ok := qre.tsv.qe.pointLookupBatcher.Lookup(qre); ok {
+			return qr, nil
+		}
+	}
 	sql, sqlWithoutComments, err := qre.generateFinalSQL(qre.plan.FullQuery, qre.bindVars)
 	if err != nil {
 		return nil, err
@@ -1362,6 +1588,7 @@ func (qre *QueryExecutor) execDBConn(conn *connpool.DBConn, sql string, wantfiel
 	defer qre.logStats.AddRewrittenSQL(sql, time.Now())
 
 	qd := NewQueryDetail(qre.logStats.Ctx, conn)
+	qd.qre = qre
 	qre.tsv.statelessql.Add(qd)
 	defer qre.tsv.statelessql.Remove(qd)
 
@@ -1375,6 +1602,7 @@ func (qre *QueryExecutor) execStatefulConn(conn *StatefulConnection, sql string,
 	defer qre.logStats.AddRewrittenSQL(sql, time.Now())
 
 	qd := NewQueryDetail(qre.logStats.Ctx, conn)
+	qd.qre = qre
 	qre.tsv.statefulql.Add(qd)
 	defer qre.tsv.statefulql.Remove(qd)
 
@@ -1384,28 +1612,83 @@ func (qre *QueryExecutor) execStatefulConn(conn *StatefulConnection, sql string,
 func (qre *QueryExecutor) execStreamSQL(conn *connpool.DBConn, isTransaction bool, sql string, callback func(*sqltypes.Result) error) error {
 	span, ctx := trace.NewSpan(qre.ctx, "QueryExecutor.execStreamSQL")
 	trace.AnnotateSQL(span, sqlparser.Preview(sql))
+	// Add query detail object into QueryExecutor TableServer list w.r.t if it is a transactional or not. Previously we were adding it
+	// to olapql list regardless but that resulted in problems, where long-running stream queries which can be stateful (or transactional)
+	// weren't getting cleaned up during unserveCommon>handleShutdownGracePeriod in state_manager.go.
+	// This change will ensure that long-running streaming stateful queries get gracefully shutdown during ServingTypeChange
+	// once their grace period is over.
+	qd := NewQueryDetail(qre.logStats.Ctx, conn)
+	qd.qre = qre
+	qd.stream = sync2.NewStreamBuffer(qre.tsv.qe.streamBufferCapacity.Get(), qre.tsv.qe.streamBudget, func(result *sqltypes.Result, size int64) error {
+		defer qre.releaseGroupMemory(size)
+		return callback(result)
+	})
+
 	callBackClosingSpan := func(result *sqltypes.Result) error {
 		defer span.Finish()
-		return callback(result)
+		return qre.sendWithBackpressure(ctx, qd.stream, result)
 	}
 
 	start := time.Now()
 	defer qre.logStats.AddRewrittenSQL(sql, start)
 
-	// Add query detail object into QueryExecutor TableServer list w.r.t if it is a transactional or not. Previously we were adding it
-	// to olapql list regardless but that resulted in problems, where long-running stream queries which can be stateful (or transactional)
-	// weren't getting cleaned up during unserveCommon>handleShutdownGracePeriod in state_manager.go.
-	// This change will ensure that long-running streaming stateful queries get gracefully shutdown during ServingTypeChange
-	// once their grace period is over.
-	qd := NewQueryDetail(qre.logStats.Ctx, conn)
+	var err error
 	if isTransaction {
 		qre.tsv.statefulql.Add(qd)
 		defer qre.tsv.statefulql.Remove(qd)
-		return conn.StreamOnce(ctx, sql, callBackClosingSpan, allocStreamResult, int(qre.tsv.qe.streamBufferSize.Get()), sqltypes.IncludeFieldsOrDefault(qre.options))
+		err = conn.StreamOnce(ctx, sql, callBackClosingSpan, allocStreamResult, int(qre.tsv.qe.streamBufferSize.Get()), sqltypes.IncludeFieldsOrDefault(qre.options))
+	} else {
+		qre.tsv.olapql.Add(qd)
+		defer qre.tsv.olapql.Remove(qd)
+		err = conn.Stream(ctx, sql, callBackClosingSpan, allocStreamResult, int(qre.tsv.qe.streamBufferSize.Get()), sqltypes.IncludeFieldsOrDefault(qre.options))
+	}
+	// The results read before an error are still handed to the client.
+	if closeErr := qd.stream.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sendWithBackpressure buffers the result in the stream of the query, so the
+// MySQL reader goes on while the client consumes the previous results. The
+// result is charged against the buffer of the stream, the query engine's stream
+// budget, and the memory budget of the resource group of the query, until the
+// client has consumed it. When a budget is exhausted the MySQL reader blocks
+// here, which bounds the memory held on behalf of slow clients, a slow client
+// only blocking its own stream once the other streams drained their buffers.
+func (qre *QueryExecutor) sendWithBackpressure(ctx context.Context, stream *sync2.StreamBuffer[*sqltypes.Result], result *sqltypes.Result) error {
+	size := result.CachedSize(true)
+	if group := qre.resourceGroup; group != nil && group.MaxMemoryBytes > 0 {
+		start := time.Now()
+		waited, err := group.memory.Acquire(ctx, size)
+		if waited {
+			qre.tsv.stats.WaitTimings.Record("ResourceGroupBackpressure", start)
+		}
+		if err != nil {
+			return vterrors.Wrapf(err, "waiting for the memory budget of resource group %s", group.Name)
+		}
+	}
+	start := time.Now()
+	waited, err := stream.Send(ctx, result, size)
+	if waited {
+		qre.tsv.stats.WaitTimings.Record("StreamBackpressure", start)
+	}
+	if err != nil {
+		qre.releaseGroupMemory(size)
+		if err == ctx.Err() {
+			return vterrors.Wrap(err, "waiting for stream buffer budget")
+		}
+		return err
+	}
+	return nil
+}
+
+// releaseGroupMemory gives back the size of a result consumed by the client to
+// the memory budget of the resource group of the query.
+func (qre *QueryExecutor) releaseGroupMemory(size int64) {
+	if group := qre.resourceGroup; group != nil && group.MaxMemoryBytes > 0 {
+		group.memory.Release(size)
 	}
-	qre.tsv.olapql.Add(qd)
-	defer qre.tsv.olapql.Remove(qd)
-	return conn.Stream(ctx, sql, callBackClosingSpan, allocStreamResult, int(qre.tsv.qe.streamBufferSize.Get()), sqltypes.IncludeFieldsOrDefault(qre.options))
 }
 
 func (qre *QueryExecutor) recordUserQuery(queryType string, duration int64) {
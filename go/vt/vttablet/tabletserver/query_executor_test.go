@@ -23,11 +23,13 @@ package tabletserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"strings"
 	"testing"
+	"time"
 	"vitess.io/vitess/go/vt/sidecardb"
 
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/tx"
@@ -1199,6 +1201,103 @@ func TestInitDatabaseProxyFilter(t *testing.T) {
 
 	assert.Equal(t, 1, len(qre.matchedActionList))
 	assert.Equal(t, "test_rule", qre.matchedActionList[0].GetRule().Name)
+
+	// The permission checks fail the queries with the error of the params.
+	alterRule.SetActionArgs(`{"errno": 1142, "message": "blocked by ${rule}"}`)
+	require.NoError(t, tsv.qe.queryRuleSources.SetRules(rulesName, rules))
+	tsv.qe.ClearQueryPlanCache()
+	qre = newTestQueryExecutor(ctx, tsv, query, 0)
+	assert.EqualError(t, qre.checkPermissions(), "blocked by test_rule (errno 1142) (sqlstate HY000)")
+}
+
+// recordingAction records the calls of its actions in calls, and answers or
+// fails the queries in BeforeExecution with its reply and err.
+type recordingAction struct {
+	ContinueAction
+
+	calls *[]string
+	reply *sqltypes.Result
+	err   error
+}
+
+func (p *recordingAction) BeforeExecution(qre *QueryExecutor) (*sqltypes.Result, error) {
+	*p.calls = append(*p.calls, "before "+p.Rule.Name)
+	return p.reply, p.err
+}
+
+func (p *recordingAction) AfterExecution(qre *QueryExecutor, reply *sqltypes.Result, err error) *ActionExecutionResponse {
+	*p.calls = append(*p.calls, "after "+p.Rule.Name)
+	return &ActionExecutionResponse{Reply: reply, Err: err}
+}
+
+func TestActionPipeline(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	ctx := context.Background()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	failed := errors.New("failed")
+	answer := &sqltypes.Result{RowsAffected: 1}
+	for _, tcase := range []struct {
+		name string
+		// b is the result and the error of the second action.
+		bReply  *sqltypes.Result
+		bErr    error
+		want    []string
+		wantErr error
+		// wantMatched is the number of actions left in the pipeline.
+		wantMatched int
+	}{
+		{
+			name:        "all the actions run",
+			want:        []string{"before a", "before b", "before c", "after c", "after b", "after a"},
+			wantMatched: 3,
+		},
+		{
+			name:        "an error stops the pipeline",
+			bErr:        failed,
+			want:        []string{"before a", "before b", "after b", "after a"},
+			wantErr:     failed,
+			wantMatched: 3,
+		},
+		{
+			name:        "a result stops the pipeline",
+			bReply:      answer,
+			want:        []string{"before a", "before b", "after b", "after a"},
+			wantMatched: 3,
+		},
+		{
+			name:        "an action skips the rest",
+			bErr:        ErrSkipRemainingActions,
+			want:        []string{"before a", "before b", "after b", "after a"},
+			wantMatched: 2,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var calls []string
+			action := func(name string, priority int) *recordingAction {
+				rule := rules.NewActiveQueryRule("ruleDescription", name, rules.QRContinue)
+				rule.SetPriority(priority)
+				return &recordingAction{ContinueAction: ContinueAction{Rule: rule}, calls: &calls}
+			}
+			a, b, c := action("a", 1), action("b", 2), action("c", 2)
+			b.reply, b.err = tcase.bReply, tcase.bErr
+			actions := []ActionInterface{c, b, a}
+			sortAction(actions)
+
+			qre := newTestQueryExecutor(ctx, tsv, "select * from test_table", 0)
+			qre.matchedActionList = actions
+			reply, err := qre.runActionListBeforeExecution()
+			assert.Equal(t, tcase.wantErr, err)
+			assert.Equal(t, tcase.bReply, reply)
+			reply, err = qre.runActionListAfterExecution(reply, err)
+			assert.Equal(t, tcase.wantErr, err)
+			assert.Equal(t, tcase.bReply, reply)
+			assert.Equal(t, tcase.want, calls)
+			assert.Len(t, qre.matchedActionList, tcase.wantMatched)
+		})
+	}
 }
 
 func TestReplaceSchemaName(t *testing.T) {
@@ -1259,6 +1358,94 @@ func TestReplaceSchemaName(t *testing.T) {
 	}
 }
 
+func TestQueryExecutorStreamBuffer(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	query := "select * from test_table"
+	want := &sqltypes.Result{Fields: getTestTableFields()}
+	for i := 0; i < 10; i++ {
+		want.Rows = append(want.Rows, []sqltypes.Value{sqltypes.NewInt32(int32(i)), sqltypes.NewInt32(1), sqltypes.NewInt32(2)})
+	}
+	db.AddQuery(query, want)
+
+	ctx := context.Background()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	// Every row is a result, and the stream buffers them all.
+	tsv.qe.streamBufferSize.Set(1)
+	tsv.SetStreamMaxBufferedBytesPerStream(1 << 20)
+
+	consume := make(chan struct{})
+	var rows int
+	qre := newTestQueryExecutorStreaming(ctx, tsv, query, 0)
+	done := make(chan error)
+	go func() {
+		done <- qre.Stream(func(result *sqltypes.Result) error {
+			if len(result.Rows) > 0 {
+				<-consume
+			}
+			rows += len(result.Rows)
+			return nil
+		})
+	}()
+
+	// MySQL is read while the client is stuck on the first row.
+	bufferedBytes := func() int64 {
+		buffered := make(map[string]int64)
+		tsv.olapql.AddBufferedBytes(buffered)
+		var total int64
+		for _, n := range buffered {
+			total += n
+		}
+		return total
+	}
+	assert.Eventually(t, func() bool {
+		return bufferedBytes() > 0 && bufferedBytes() == tsv.qe.streamBudget.InUse()
+	}, 5*time.Second, time.Millisecond)
+	close(consume)
+	require.NoError(t, <-done)
+	assert.Equal(t, 10, rows)
+	assert.EqualValues(t, 0, tsv.qe.streamBudget.InUse())
+	assert.EqualValues(t, 0, bufferedBytes())
+}
+
+func TestQueryExecutorPoolReuse(t *testing.T) {
+	bindVars := allocBindVars()
+	bindVars["a"] = sqltypes.Int64BindVariable(1)
+	qre := allocQueryExecutor()
+	qre.query = "select * from test_table where a = :a"
+	qre.bindVars = bindVars
+	qre.plan = &TabletPlan{Plan: &planbuilder.Plan{PlanID: planbuilder.PlanSelect}}
+	qre.matchedActionList = []ActionInterface{&ContinueAction{}, &FailAction{}}
+	qre.calledActionList = append(qre.calledActionList, qre.matchedActionList...)
+	called := qre.calledActionList
+	qre.affectedRules = []string{"rule"}
+	returnBindVars(bindVars)
+	returnQueryExecutor(qre)
+
+	// The executor put back in the pool keeps nothing of the query but the
+	// storage of its called actions, which no longer references them.
+	assert.Equal(t, QueryExecutor{calledActionList: called[:0]}, *qre)
+	for _, action := range called[:cap(called)] {
+		assert.Nil(t, action)
+	}
+	assert.Empty(t, bindVars)
+
+	// Whether or not the pool hands them back, the executor and the bind
+	// variables returned next start empty.
+	reused := allocQueryExecutor()
+	defer returnQueryExecutor(reused)
+	assert.Empty(t, reused.query)
+	assert.Nil(t, reused.bindVars)
+	assert.Nil(t, reused.plan)
+	assert.Nil(t, reused.matchedActionList)
+	assert.Empty(t, reused.calledActionList)
+	assert.Nil(t, reused.affectedRules)
+	reusedBindVars := allocBindVars()
+	defer returnBindVars(reusedBindVars)
+	assert.Empty(t, reusedBindVars)
+}
+
 func TestQueryExecutorShouldConsolidate(t *testing.T) {
 	testcases := []struct {
 		consolidates  []bool
@@ -20,10 +20,13 @@ import (
 	"context"
 	"html/template"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
+	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/streamlog"
+	"vitess.io/vitess/go/sync2"
 	"vitess.io/vitess/go/vt/callinfo"
 	"vitess.io/vitess/go/vt/sqlparser"
 )
@@ -34,6 +37,19 @@ type QueryDetail struct {
 	conn   killable
 	connID int64
 	start  time.Time
+
+	// stream buffers the results of a streaming query for the client.
+	stream *sync2.StreamBuffer[*sqltypes.Result]
+	// qre is the executor running the query, nil for the queries not run by
+	// one. The KILL rules loaded while the query runs match it on what
+	// killMatch reads from qre under the mutex of the list: the executor
+	// doesn't change or release any of it before the query is removed.
+	qre *QueryExecutor
+	// kills are the timers killing the query past a deadline, by name, and
+	// removed is set once the query is removed from its list, both guarded
+	// by the mutex of the list.
+	kills   map[string]*time.Timer
+	removed bool
 }
 
 type killable interface {
@@ -42,11 +58,26 @@ type killable interface {
 	Kill(message string, elapsed time.Duration) error
 }
 
+// queryKillable is a killable connection whose query can be killed without
+// the connection.
+type queryKillable interface {
+	KillQuery(message string, elapsed time.Duration) error
+}
+
 // NewQueryDetail creates a new QueryDetail
 func NewQueryDetail(ctx context.Context, conn killable) *QueryDetail {
 	return &QueryDetail{ctx: ctx, conn: conn, connID: conn.ID(), start: time.Now()}
 }
 
+// bufferedBytes returns the size of the stream results buffered for the
+// client and not yet consumed.
+func (qd *QueryDetail) bufferedBytes() int64 {
+	if qd.stream == nil {
+		return 0
+	}
+	return qd.stream.Buffered()
+}
+
 // QueryList holds a thread safe list of QueryDetails
 type QueryList struct {
 	name string
@@ -82,6 +113,11 @@ func (ql *QueryList) Add(qd *QueryDetail) {
 func (ql *QueryList) Remove(qd *QueryDetail) {
 	ql.mu.Lock()
 	defer ql.mu.Unlock()
+	for _, timer := range qd.kills {
+		timer.Stop()
+	}
+	qd.kills = nil
+	qd.removed = true
 	qds, exists := ql.queryDetails[qd.connID]
 	if !exists {
 		return
@@ -124,6 +160,84 @@ func (ql *QueryList) TerminateAll() {
 	}
 }
 
+// matchedQuery is a query of a list with what the KILL rules match it on.
+type matchedQuery struct {
+	qd    *QueryDetail
+	match *killMatch
+}
+
+// matchedQueries returns the queries of the list run by an executor which has
+// a plan, with what the KILL rules match them on.
+func (ql *QueryList) matchedQueries() []matchedQuery {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+	var matched []matchedQuery
+	for _, qds := range ql.queryDetails {
+		for _, qd := range qds {
+			if qd.qre == nil {
+				continue
+			}
+			if m := qd.qre.killMatch(); m != nil {
+				matched = append(matched, matchedQuery{qd: qd, match: m})
+			}
+		}
+	}
+	return matched
+}
+
+// killAfter kills the query of qd once it has run for after, with its
+// connection if connection is set, unless it is removed from the list by then.
+// A query has one such deadline by name, the last one set. killed is called
+// once the query is killed.
+func (ql *QueryList) killAfter(qd *QueryDetail, name string, after time.Duration, connection bool, killed func()) {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+	if qd.removed {
+		return
+	}
+	if timer := qd.kills[name]; timer != nil {
+		timer.Stop()
+	}
+	if qd.kills == nil {
+		qd.kills = make(map[string]*time.Timer)
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(qd.start.Add(after)), func() {
+		ql.mu.Lock()
+		if qd.kills[name] != timer {
+			ql.mu.Unlock()
+			return
+		}
+		delete(qd.kills, name)
+		ql.mu.Unlock()
+
+		// The kill is a round trip to MySQL, which mustn't hold the list.
+		reason := "rule " + name
+		if conn, ok := qd.conn.(queryKillable); ok && !connection {
+			_ = conn.KillQuery(reason, time.Since(qd.start))
+		} else {
+			_ = qd.conn.Kill(reason, time.Since(qd.start))
+		}
+		killed()
+	})
+	qd.kills[name] = timer
+}
+
+// AddBufferedBytes adds the bytes buffered by the streaming queries of the
+// list to buffered, by list name and connection ID.
+func (ql *QueryList) AddBufferedBytes(buffered map[string]int64) {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+	for connID, qds := range ql.queryDetails {
+		for _, qd := range qds {
+			if qd.stream == nil {
+				continue
+			}
+			buffered[ql.name+"."+strconv.FormatInt(connID, 10)] += qd.bufferedBytes()
+		}
+	}
+}
+
 // QueryDetailzRow is used for rendering QueryDetail in a template
 type QueryDetailzRow struct {
 	Type              string
@@ -133,6 +247,7 @@ type QueryDetailzRow struct {
 	Duration          time.Duration
 	ConnID            int64
 	State             string
+	BufferedBytes     int64
 	ShowTerminateLink bool
 }
 
@@ -152,12 +267,13 @@ func (ql *QueryList) AppendQueryzRows(rows []QueryDetailzRow) []QueryDetailzRow
 				query, _ = sqlparser.RedactSQLQuery(query)
 			}
 			row := QueryDetailzRow{
-				Type:        ql.name,
-				Query:       query,
-				ContextHTML: callinfo.HTMLFromContext(qd.ctx),
-				Start:       qd.start,
-				Duration:    time.Since(qd.start),
-				ConnID:      qd.connID,
+				Type:          ql.name,
+				Query:         query,
+				ContextHTML:   callinfo.HTMLFromContext(qd.ctx),
+				Start:         qd.start,
+				Duration:      time.Since(qd.start),
+				ConnID:        qd.connID,
+				BufferedBytes: qd.bufferedBytes(),
 			}
 			rows = append(rows, row)
 		}
@@ -90,3 +90,43 @@ func TestQueryListChangeConnIDInMiddle(t *testing.T) {
 	require.Equal(t, qd1, ql.queryDetails[1][0])
 	require.NotEqual(t, qd2, ql.queryDetails[1][0])
 }
+
+// blockingConn is a connection whose Kill waits for unblock.
+type blockingConn struct {
+	testConn
+	killing chan struct{}
+	unblock chan struct{}
+}
+
+func (bc *blockingConn) Kill(string, time.Duration) error {
+	close(bc.killing)
+	<-bc.unblock
+	bc.killed = true
+	return nil
+}
+
+func TestQueryListKillAfter(t *testing.T) {
+	ql := NewQueryList("test")
+	conn := &blockingConn{testConn: testConn{id: 1}, killing: make(chan struct{}), unblock: make(chan struct{})}
+	qd := NewQueryDetail(context.Background(), conn)
+	ql.Add(qd)
+
+	killed := make(chan struct{})
+	ql.killAfter(qd, "rule", 0, true, func() { close(killed) })
+	<-conn.killing
+	// The list isn't held while the connection is killed.
+	ql.Add(NewQueryDetail(context.Background(), &testConn{id: 2}))
+	close(conn.unblock)
+	<-killed
+	require.True(t, conn.IsKilled())
+
+	// The queries removed from the list aren't killed.
+	removed := &testConn{id: 3}
+	qd = NewQueryDetail(context.Background(), removed)
+	ql.Add(qd)
+	ql.killAfter(qd, "rule", time.Millisecond, true, func() {})
+	ql.Remove(qd)
+	ql.killAfter(qd, "rule", 0, true, func() {})
+	time.Sleep(10 * time.Millisecond)
+	require.False(t, removed.IsKilled())
+}
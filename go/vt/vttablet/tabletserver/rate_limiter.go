@@ -0,0 +1,197 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// maxRateLimiters is the number of buckets past which the buckets of the
+// queries of the least recent keys are evicted.
+const maxRateLimiters = 10000
+
+// rateLimiters are the token buckets of the RATE_LIMIT rules, and of the
+// notifications of the WEBHOOK_NOTIFY rules, by rule. The queries matched by a
+// rule share its bucket, whatever their plan, or the bucket of their key when
+// the rule has one.
+//
+// Since the keys come from the queries, the buckets are evicted once there are
+// more than max: the full ones first, which a new bucket is the same as, then
+// the least recently used ones, down to three quarters of max.
+type rateLimiters struct {
+	limiters sync.Map
+	max      int
+
+	// mu serializes the creation and the eviction of the buckets, count is
+	// their number.
+	mu    sync.Mutex
+	count int
+}
+
+// rateLimiter is a bucket, with the name of its rule and the time it was last
+// used at.
+type rateLimiter struct {
+	*rate.Limiter
+	rule string
+	used atomic.Int64
+}
+
+func newRateLimiters() *rateLimiters {
+	return &rateLimiters{max: maxRateLimiters}
+}
+
+// get returns the bucket of a rule by name, which refills at qps tokens per
+// second and holds up to burst tokens.
+func (rl *rateLimiters) get(ruleName, name string, qps float64, burst int) *rate.Limiter {
+	now := time.Now()
+	v, ok := rl.limiters.Load(name)
+	if !ok {
+		v = rl.add(ruleName, name, rate.NewLimiter(rate.Limit(qps), burst), now)
+	}
+	limiter := v.(*rateLimiter)
+	limiter.used.Store(now.UnixNano())
+	if limiter.Limit() != rate.Limit(qps) {
+		limiter.SetLimit(rate.Limit(qps))
+	}
+	if limiter.Burst() != burst {
+		limiter.SetBurst(burst)
+	}
+	return limiter.Limiter
+}
+
+// add adds the bucket of a rule by name unless there is one, evicting buckets
+// if there are more than max, and returns the bucket of the name.
+func (rl *rateLimiters) add(ruleName, name string, limiter *rate.Limiter, now time.Time) any {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	l := &rateLimiter{Limiter: limiter, rule: ruleName}
+	l.used.Store(now.UnixNano())
+	v, loaded := rl.limiters.LoadOrStore(name, l)
+	if !loaded {
+		rl.count++
+		if rl.count > rl.max {
+			rl.evict(name, now)
+		}
+	}
+	return v
+}
+
+// retain drops the buckets of the rules which aren't in ruleNames, once the
+// rules are loaded.
+func (rl *rateLimiters) retain(ruleNames map[string]bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.limiters.Range(func(key, value any) bool {
+		if !ruleNames[value.(*rateLimiter).rule] {
+			rl.limiters.Delete(key)
+			rl.count--
+		}
+		return true
+	})
+}
+
+// evict drops the full buckets, then the least recently used ones, until
+// there are no more than three quarters of max, but the bucket of keep, just
+// added. It is called with mu held.
+func (rl *rateLimiters) evict(keep string, now time.Time) {
+	type bucket struct {
+		name string
+		used int64
+	}
+	var buckets []bucket
+	rl.limiters.Range(func(key, value any) bool {
+		limiter := value.(*rateLimiter)
+		if key == keep {
+			return true
+		}
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			rl.limiters.Delete(key)
+			rl.count--
+			return true
+		}
+		buckets = append(buckets, bucket{name: key.(string), used: limiter.used.Load()})
+		return true
+	})
+	target := rl.max * 3 / 4
+	if rl.count <= target {
+		return
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].used < buckets[j].used })
+	for _, b := range buckets[:rl.count-target] {
+		rl.limiters.Delete(b.name)
+	}
+	rl.count = target
+}
+
+// len returns the number of buckets.
+func (rl *rateLimiters) len() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.count
+}
+
+// clear drops all the buckets.
+func (rl *rateLimiters) clear() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.limiters.Range(func(key, _ any) bool {
+		rl.limiters.Delete(key)
+		return true
+	})
+	rl.count = 0
+}
+
+// rateLimiterState is the checkpointed state of a bucket: its tokens at a
+// time.
+type rateLimiterState struct {
+	Rule   string `json:",omitempty"`
+	QPS    float64
+	Burst  int
+	Tokens float64
+	At     time.Time
+}
+
+// states returns the state of the buckets, by name.
+func (rl *rateLimiters) states(now time.Time) map[string]rateLimiterState {
+	states := make(map[string]rateLimiterState)
+	rl.limiters.Range(func(key, value any) bool {
+		limiter := value.(*rateLimiter)
+		// The unlimited buckets have nothing to restore, and JSON no
+		// infinity.
+		if limiter.Limit() != rate.Inf {
+			states[key.(string)] = rateLimiterState{Rule: limiter.rule, QPS: float64(limiter.Limit()), Burst: limiter.Burst(), Tokens: limiter.TokensAt(now), At: now}
+		}
+		return true
+	})
+	return states
+}
+
+// restore sets the buckets, which refill from the time of their state on.
+func (rl *rateLimiters) restore(states map[string]rateLimiterState) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	for name, state := range states {
+		limiter := &rateLimiter{Limiter: rate.NewLimiter(rate.Limit(state.QPS), state.Burst), rule: state.Rule}
+		// A new bucket is full.
+		if taken := state.Burst - int(math.Max(state.Tokens, 0)); taken > 0 {
+			limiter.AllowN(state.At, taken)
+		}
+		limiter.used.Store(now.UnixNano())
+		if _, loaded := rl.limiters.Swap(name, limiter); !loaded {
+			rl.count++
+		}
+	}
+	if rl.count > rl.max {
+		rl.evict("", now)
+	}
+}
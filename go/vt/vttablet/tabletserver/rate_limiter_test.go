@@ -0,0 +1,88 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitersEviction(t *testing.T) {
+	rl := newRateLimiters()
+	rl.max = 8
+
+	// The drained buckets are kept over the full ones, which a new bucket is
+	// the same as.
+	for i := 0; i < 4; i++ {
+		require.True(t, rl.get("rule", fmt.Sprintf("drained/%d", i), 0.001, 1).Allow())
+	}
+	for i := 0; i < 4; i++ {
+		rl.get("rule", fmt.Sprintf("full/%d", i), 0.001, 1)
+	}
+	assert.Equal(t, 8, rl.len())
+	rl.get("rule", "full/4", 0.001, 1)
+	assert.Equal(t, 5, rl.len())
+	for i := 0; i < 4; i++ {
+		assert.False(t, rl.get("rule", fmt.Sprintf("drained/%d", i), 0.001, 1).Allow(), i)
+		time.Sleep(time.Millisecond)
+	}
+
+	// Past max, the least recently used buckets are evicted down to three
+	// quarters of max, even drained.
+	for i := 4; i < 8; i++ {
+		require.True(t, rl.get("rule", fmt.Sprintf("drained/%d", i), 0.001, 1).Allow())
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 6, rl.len())
+	for i := 2; i < 8; i++ {
+		_, ok := rl.limiters.Load(fmt.Sprintf("drained/%d", i))
+		assert.True(t, ok, i)
+	}
+	assert.True(t, rl.get("rule", "drained/0", 0.001, 1).Allow())
+
+	rl.clear()
+	assert.Zero(t, rl.len())
+}
+
+func TestRateLimitersRestore(t *testing.T) {
+	rl := newRateLimiters()
+	rl.max = 4
+	now := time.Now()
+	states := make(map[string]rateLimiterState)
+	for i := 0; i < 6; i++ {
+		states[fmt.Sprintf("key/%d", i)] = rateLimiterState{QPS: 0.001, Burst: 2, Tokens: 0, At: now}
+	}
+	rl.restore(states)
+	assert.Equal(t, 3, rl.len())
+
+	rl.restore(map[string]rateLimiterState{"key/0": {QPS: 0.001, Burst: 2, Tokens: 0, At: now}})
+	assert.LessOrEqual(t, rl.len(), 4)
+	assert.False(t, rl.get("rule", "key/0", 0.001, 2).Allow())
+}
+
+func TestRateLimitersRetain(t *testing.T) {
+	rl := newRateLimiters()
+	rl.get("kept", "kept", 1, 1)
+	rl.get("kept", "kept/a", 1, 1)
+	rl.get("removed", "removed/a", 1, 1)
+	rl.get("removed", "webhook:removed", 1, 1)
+	rl.retain(map[string]bool{"kept": true})
+	assert.Equal(t, 2, rl.len())
+	_, ok := rl.limiters.Load("kept/a")
+	assert.True(t, ok)
+	_, ok = rl.limiters.Load("removed/a")
+	assert.False(t, ok)
+
+	// The restored buckets keep their rule.
+	restored := newRateLimiters()
+	restored.restore(rl.states(time.Now()))
+	restored.retain(map[string]bool{})
+	assert.Zero(t, restored.len())
+}
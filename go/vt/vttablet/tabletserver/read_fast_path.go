@@ -0,0 +1,62 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+
+	"vitess.io/vitess/go/pools"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// The read fast path serves the dominant OLTP pattern: a single autocommit
+// select that runs outside of any transaction or reserved connection.
+// When enabled with --queryserver-enable-read-fast-path:
+//   - autocommit requests without session settings reuse a cached connection
+//     setting per keyspace instead of building one for every request.
+//   - selects that match no filter skip the action machinery, the transaction
+//     and reserved connection checks, and go straight to execSelect.
+
+type autocommitSettingKey struct {
+	keyspace string
+	skipUse  bool
+}
+
+// autocommitConnSetting returns the connection setting of a request that has
+// no session settings. The setting only depends on the keyspace and on the
+// IsSkipUse option, so it is built once and shared: pools.Setting is never
+// modified after it was built.
+func (tsv *TabletServer) autocommitConnSetting(keyspace string, options *querypb.ExecuteOptions) *pools.Setting {
+	key := autocommitSettingKey{keyspace: keyspace, skipUse: options.GetIsSkipUse()}
+	if setting, ok := tsv.autocommitSettings.Load(key); ok {
+		return setting.(*pools.Setting)
+	}
+	// buildConnSettingForUserKeyspace cannot fail without session settings.
+	setting, _ := tsv.buildConnSettingForUserKeyspace(context.Background(), nil, keyspace, options)
+	actual, _ := tsv.autocommitSettings.LoadOrStore(key, setting)
+	return actual.(*pools.Setting)
+}
+
+// isFastPathRead returns true if the query can be executed by execFastPathRead.
+// It must be called after initDatabaseProxyFilter.
+func (qre *QueryExecutor) isFastPathRead() bool {
+	return qre.tsv.config.EnableReadFastPath &&
+		qre.connID == 0 &&
+		qre.plan.PlanID == planbuilder.PlanSelect &&
+		len(qre.matchedActionList) == 0
+}
+
+// execFastPathRead executes an autocommit select that matched no filter.
+func (qre *QueryExecutor) execFastPathRead() (*sqltypes.Result, error) {
+	qre.tsv.stats.FastPathReads.Add(1)
+	if err := qre.checkPermissions(); err != nil {
+		return nil, err
+	}
+	return qre.execSelectWithLimit()
+}
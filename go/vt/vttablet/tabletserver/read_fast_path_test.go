@@ -0,0 +1,67 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestAutocommitConnSetting(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	s1 := tsv.autocommitConnSetting("ks", nil)
+	assert.Equal(t, "use `ks`", s1.GetQuery())
+	assert.False(t, s1.GetWithoutDBName())
+	assert.Same(t, s1, tsv.autocommitConnSetting("ks", &querypb.ExecuteOptions{}))
+
+	s2 := tsv.autocommitConnSetting("ks", &querypb.ExecuteOptions{IsSkipUse: true})
+	assert.NotSame(t, s1, s2)
+	assert.Equal(t, "", s2.GetQuery())
+
+	s3 := tsv.autocommitConnSetting("", nil)
+	assert.True(t, s3.GetWithoutDBName())
+}
+
+func TestReadFastPath(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	tsv.config.EnableReadFastPath = true
+
+	want := &sqltypes.Result{
+		Fields: getTestTableFields(),
+		Rows:   [][]sqltypes.Value{{sqltypes.NewInt32(1), sqltypes.NewInt32(2), sqltypes.NewInt32(3)}},
+	}
+	db.AddQuery("select * from test_table where pk = 1 limit 100001", want)
+	target := querypb.Target{TabletType: topodatapb.TabletType_PRIMARY}
+
+	fastPathReads := tsv.stats.FastPathReads.Get()
+	qr, err := tsv.Execute(ctx, &target, "select * from test_table where pk = 1", nil, 0, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, want.Rows, qr.Rows)
+	assert.EqualValues(t, 1, tsv.stats.FastPathReads.Get()-fastPathReads)
+
+	// selects in a transaction don't take the fast path.
+	state, err := tsv.Begin(ctx, &target, nil)
+	require.NoError(t, err)
+	_, err = tsv.Execute(ctx, &target, "select * from test_table where pk = 1", nil, state.TransactionID, 0, nil)
+	require.NoError(t, err)
+	_, err = tsv.Rollback(ctx, &target, state.TransactionID)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, tsv.stats.FastPathReads.Get()-fastPathReads)
+}
@@ -0,0 +1,415 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"vitess.io/vitess/go/acl"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/sync2"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/ccl"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// A resource group shares the capacity of the tablet between the queries of
+// some tenants, so that they can't starve each other. The queries of a group
+// are limited in:
+//   - concurrency: the queries in flight, the next ones being queued by the
+//     concurrency controller, like the ones of the CONCURRENCY_CONTROL action;
+//   - rate: the queries over the queries per second of the group fail;
+//   - memory: the results the tablet holds for the group. The streams wait for
+//     their clients to consume their results, and the queries whose result
+//     doesn't fit fail.
+//
+// The groups are read from the --queryserver-config-resource-group-file JSON
+// file when the query engine opens:
+//
+//	{"groups": [{
+//		"name": "tenant_a",
+//		"users": ["app_a"],
+//		"workload_classes": ["etl"],
+//		"max_concurrency": 8,
+//		"max_queue_size": 64,
+//		"max_qps": 500,
+//		"max_memory_bytes": 67108864
+//	}]}
+//
+// A query is of the group of the first RESOURCE_GROUP rule it matches, whose
+// action args are like {"group": "tenant_a"}, else of the group of its user,
+// else of the group of its workload class, else of the group of its database.
+// The other queries are not limited.
+//
+// In the database isolation mode, each database is a tenant, so that a tablet
+// can serve many small tenant databases fairly: the queries of the databases
+// which are in no group are in a group of their own, named after the database,
+// with the limits of the database_isolation object of the file:
+//
+//	{"database_isolation": {"max_concurrency": 4, "max_queue_size": 32, "max_qps": 200},
+//	 "groups": [{"name": "big_tenant", "databases": ["big_tenant"], "max_concurrency": 16}]}
+//
+// Each database then gets its slice of the connection pools and of the rate
+// and memory of the tablet, the resource group metrics are labelled by the
+// databases, and the rules qualified by a database, like big_tenant.block_scans,
+// are in the namespace of the database: they only match its queries.
+
+// resourceGroupQueuePrefix prefixes the keys of the concurrency controller
+// queues of the groups, to tell them from the queues of the rules.
+const resourceGroupQueuePrefix = "resource_group:"
+
+// resourceGroup is a group of the resource group file.
+type resourceGroup struct {
+	Name            string   `json:"name"`
+	Users           []string `json:"users,omitempty"`
+	WorkloadClasses []string `json:"workload_classes,omitempty"`
+	Databases       []string `json:"databases,omitempty"`
+
+	// The limits of the group. 0 means no limit.
+	MaxConcurrency int     `json:"max_concurrency,omitempty"`
+	MaxQueueSize   int     `json:"max_queue_size,omitempty"`
+	MaxQPS         float64 `json:"max_qps,omitempty"`
+	MaxMemoryBytes int64   `json:"max_memory_bytes,omitempty"`
+
+	limiter *rate.Limiter
+	memory  *sync2.ByteBudget
+}
+
+// resourceGroupSet are the groups of a resource group file.
+type resourceGroupSet struct {
+	groups          []*resourceGroup
+	byName          map[string]*resourceGroup
+	byUser          map[string]*resourceGroup
+	byWorkloadClass map[string]*resourceGroup
+	byDatabase      map[string]*resourceGroup
+
+	// isolation has the limits of the groups of the databases in the database
+	// isolation mode, if it is on.
+	isolation *resourceGroup
+	// isolated are the groups of the databases, created on their first query.
+	isolated sync.Map
+}
+
+// resourceGroups admits the queries into their resource group.
+type resourceGroups struct {
+	path string
+	ccl  *ccl.ConcurrencyController
+	set  atomic.Pointer[resourceGroupSet]
+
+	queries    *stats.CountersWithSingleLabel
+	rejections *stats.CountersWithMultiLabels
+	log        *logutil.ThrottledLogger
+}
+
+func newResourceGroups(env tabletenv.Env, controller *ccl.ConcurrencyController) *resourceGroups {
+	rgs := &resourceGroups{
+		path:       env.Config().ResourceGroupFile,
+		ccl:        controller,
+		queries:    env.Exporter().NewCountersWithSingleLabel("ResourceGroupQueries", "Number of queries admitted into each resource group", "Group"),
+		rejections: env.Exporter().NewCountersWithMultiLabels("ResourceGroupRejections", "Number of queries rejected by each limit of each resource group", []string{"Group", "Limit"}),
+		log:        logutil.NewThrottledLogger("ResourceGroups", 5*time.Second),
+	}
+	rgs.set.Store(&resourceGroupSet{})
+	env.Exporter().NewGaugesFuncWithMultiLabels("ResourceGroupMemoryBytes", "Result bytes held for each resource group", []string{"Group"}, func() map[string]int64 {
+		usage := make(map[string]int64)
+		for _, group := range rgs.set.Load().all() {
+			usage[group.Name] = group.memory.InUse()
+		}
+		return usage
+	})
+	return rgs
+}
+
+// Open reads the resource group file.
+func (rgs *resourceGroups) Open() error {
+	if rgs.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(rgs.path)
+	if err != nil {
+		return vterrors.Wrapf(err, "failed to read the resource group file %s", rgs.path)
+	}
+	set, err := parseResourceGroups(data)
+	if err != nil {
+		return vterrors.Wrapf(err, "invalid resource group file %s", rgs.path)
+	}
+	rgs.set.Store(set)
+	log.Infof("Loaded %d resource groups from %s", len(set.groups), rgs.path)
+	return nil
+}
+
+// parseResourceGroups reads and checks the groups of a resource group file.
+func parseResourceGroups(data []byte) (*resourceGroupSet, error) {
+	var config struct {
+		DatabaseIsolation *resourceGroup   `json:"database_isolation"`
+		Groups            []*resourceGroup `json:"groups"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%v", err)
+	}
+
+	set := &resourceGroupSet{
+		groups:          config.Groups,
+		byName:          make(map[string]*resourceGroup, len(config.Groups)),
+		byUser:          make(map[string]*resourceGroup),
+		byWorkloadClass: make(map[string]*resourceGroup),
+		byDatabase:      make(map[string]*resourceGroup),
+		isolation:       config.DatabaseIsolation,
+	}
+	if isolation := set.isolation; isolation != nil {
+		if isolation.Name != "" || len(isolation.Users) > 0 || len(isolation.WorkloadClasses) > 0 || len(isolation.Databases) > 0 {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "database_isolation only has the limits of the groups of the databases")
+		}
+		if err := checkResourceGroupLimits("database_isolation", isolation); err != nil {
+			return nil, err
+		}
+	}
+	for i, group := range config.Groups {
+		if group.Name == "" {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "resource group #%d has no name", i+1)
+		}
+		if set.byName[group.Name] != nil {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "resource group %s is defined twice", group.Name)
+		}
+		set.byName[group.Name] = group
+		if err := checkResourceGroupLimits("resource group "+group.Name, group); err != nil {
+			return nil, err
+		}
+		for _, user := range group.Users {
+			if other := set.byUser[user]; other != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "user %s is in resource groups %s and %s", user, other.Name, group.Name)
+			}
+			set.byUser[user] = group
+		}
+		for _, class := range group.WorkloadClasses {
+			if other := set.byWorkloadClass[class]; other != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "workload class %s is in resource groups %s and %s", class, other.Name, group.Name)
+			}
+			set.byWorkloadClass[class] = group
+		}
+		for _, database := range group.Databases {
+			if other := set.byDatabase[database]; other != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "database %s is in resource groups %s and %s", database, other.Name, group.Name)
+			}
+			set.byDatabase[database] = group
+		}
+		group.init()
+	}
+	return set, nil
+}
+
+// checkResourceGroupLimits checks the limits of a group.
+func checkResourceGroupLimits(name string, group *resourceGroup) error {
+	if group.MaxConcurrency < 0 || group.MaxQueueSize < 0 || group.MaxQPS < 0 || group.MaxMemoryBytes < 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%s has a negative limit", name)
+	}
+	if group.MaxQueueSize > 0 && group.MaxQueueSize < group.MaxConcurrency {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%s: max_queue_size %d is less than max_concurrency %d", name, group.MaxQueueSize, group.MaxConcurrency)
+	}
+	return nil
+}
+
+// init creates the rate limiter and the memory budget of a group.
+func (group *resourceGroup) init() {
+	if group.MaxQPS > 0 {
+		group.limiter = rate.NewLimiter(rate.Limit(group.MaxQPS), int(math.Max(1, math.Ceil(group.MaxQPS))))
+	}
+	group.memory = sync2.NewByteBudget(group.MaxMemoryBytes)
+}
+
+// databaseGroup returns the group of a database: the group which has it, else
+// its own group in the database isolation mode.
+func (set *resourceGroupSet) databaseGroup(database string) *resourceGroup {
+	if group := set.byDatabase[database]; group != nil {
+		return group
+	}
+	if set.isolation == nil || database == "" {
+		return nil
+	}
+	if group, ok := set.isolated.Load(database); ok {
+		return group.(*resourceGroup)
+	}
+	group := &resourceGroup{
+		Name:           database,
+		Databases:      []string{database},
+		MaxConcurrency: set.isolation.MaxConcurrency,
+		MaxQueueSize:   set.isolation.MaxQueueSize,
+		MaxQPS:         set.isolation.MaxQPS,
+		MaxMemoryBytes: set.isolation.MaxMemoryBytes,
+	}
+	group.init()
+	actual, _ := set.isolated.LoadOrStore(database, group)
+	return actual.(*resourceGroup)
+}
+
+// all returns the groups of the file, and the groups of the databases created
+// so far.
+func (set *resourceGroupSet) all() []*resourceGroup {
+	groups := append([]*resourceGroup(nil), set.groups...)
+	set.isolated.Range(func(_, group any) bool {
+		groups = append(groups, group.(*resourceGroup))
+		return true
+	})
+	return groups
+}
+
+// ruleNamespace returns the namespace of the rules which match the queries of
+// a database: the database in the database isolation mode, else none.
+func (rgs *resourceGroups) ruleNamespace(database string) string {
+	if rgs.set.Load().isolation == nil {
+		return ""
+	}
+	return database
+}
+
+// group returns the group of a query: the group of its rule if it matched a
+// RESOURCE_GROUP rule, else the group of its user, of its workload class or
+// of its database.
+func (rgs *resourceGroups) group(rule, user, workloadClass, database string) *resourceGroup {
+	set := rgs.set.Load()
+	if rule != "" {
+		if group := set.byName[rule]; group != nil {
+			return group
+		}
+		rgs.log.Warningf("resource group %s of a RESOURCE_GROUP rule is not defined", rule)
+	}
+	if group := set.byUser[user]; group != nil {
+		return group
+	}
+	if group := set.byWorkloadClass[workloadClass]; group != nil {
+		return group
+	}
+	return set.databaseGroup(database)
+}
+
+// enter admits a query into its group. It waits for a slot if the group is at
+// its concurrency, and fails if the group is over its rate or its queue is
+// full. done must be called once the query is done.
+func (rgs *resourceGroups) enter(ctx context.Context, group *resourceGroup, tables []string) (done func(), waited bool, err error) {
+	if group.limiter != nil && !group.limiter.Allow() {
+		rgs.rejections.Add([]string{group.Name, "qps"}, 1)
+		return nil, false, vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "resource group %s is over its rate of %v queries per second", group.Name, group.MaxQPS)
+	}
+	done = func() {}
+	if group.MaxConcurrency > 0 {
+		maxQueueSize := group.MaxQueueSize
+		if maxQueueSize == 0 {
+			maxQueueSize = math.MaxInt32
+		}
+		q := rgs.ccl.GetOrCreateQueue(resourceGroupQueuePrefix+group.Name, maxQueueSize, group.MaxConcurrency)
+		var cclDone ccl.DoneFunc
+		cclDone, waited, err = q.Wait(ctx, tables)
+		if err != nil {
+			rgs.rejections.Add([]string{group.Name, "concurrency"}, 1)
+			return nil, waited, vterrors.Wrapf(err, "resource group %s", group.Name)
+		}
+		done = cclDone
+	}
+	rgs.queries.Add(group.Name, 1)
+	return done, waited, nil
+}
+
+// checkResult fails if a result doesn't fit in what is left of the memory
+// budget of its group.
+func (rgs *resourceGroups) checkResult(group *resourceGroup, result *sqltypes.Result) error {
+	if group.MaxMemoryBytes == 0 {
+		return nil
+	}
+	size := result.CachedSize(true)
+	if !group.memory.TryAcquire(size) {
+		rgs.rejections.Add([]string{group.Name, "memory"}, 1)
+		return vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "resource group %s: the result of %d bytes is over its memory budget (%d of %d bytes in use)", group.Name, size, group.memory.InUse(), group.MaxMemoryBytes)
+	}
+	group.memory.Release(size)
+	return nil
+}
+
+// enterResourceGroup admits the query into its resource group, if it has one.
+// done must be called once the query is done.
+func (qre *QueryExecutor) enterResourceGroup() (done func(), err error) {
+	rule := ""
+	for _, action := range qre.matchedActionList {
+		if action, ok := action.(*ResourceGroupAction); ok {
+			rule = action.Group
+			break
+		}
+	}
+	user := callerid.GetUsername(callerid.ImmediateCallerIDFromContext(qre.ctx))
+	group := qre.tsv.qe.resourceGroups.group(rule, user, qre.workloadClass(), qre.database)
+	if group == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+	done, waited, err := qre.tsv.qe.resourceGroups.enter(qre.ctx, group, qre.plan.TableNames())
+	if waited {
+		qre.tsv.stats.WaitTimings.Record("ResourceGroup", start)
+	}
+	if err != nil {
+		return nil, err
+	}
+	qre.resourceGroup = group
+	return done, nil
+}
+
+// checkResourceGroupResult fails if the result of the query doesn't fit in
+// the memory budget of its resource group.
+func (qre *QueryExecutor) checkResourceGroupResult(result *sqltypes.Result) error {
+	if qre.resourceGroup == nil {
+		return nil
+	}
+	return qre.tsv.qe.resourceGroups.checkResult(qre.resourceGroup, result)
+}
+
+// resourceGroupStatus is the status of a group served at
+// /debug/resource_groups.
+type resourceGroupStatus struct {
+	*resourceGroup
+	Pending     int   `json:"pending"`
+	MemoryBytes int64 `json:"memory_bytes"`
+}
+
+func (rgs *resourceGroups) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.DEBUGGING); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	groups := rgs.set.Load().all()
+	status := make([]resourceGroupStatus, 0, len(groups))
+	for _, group := range groups {
+		status = append(status, resourceGroupStatus{
+			resourceGroup: group,
+			Pending:       rgs.ccl.Pending(resourceGroupQueuePrefix + group.Name),
+			MemoryBytes:   group.memory.InUse(),
+		})
+	}
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	b, err := json.MarshalIndent(status, "", " ")
+	if err != nil {
+		response.Write([]byte(err.Error()))
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	json.HTMLEscape(buf, b)
+	response.Write(buf.Bytes())
+}
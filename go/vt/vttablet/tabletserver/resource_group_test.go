@@ -0,0 +1,212 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/ccl"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func TestParseResourceGroups(t *testing.T) {
+	set, err := parseResourceGroups([]byte(`{"groups": [
+		{"name": "tenant_a", "users": ["app_a"], "workload_classes": ["etl"], "max_concurrency": 2, "max_queue_size": 4, "max_qps": 100, "max_memory_bytes": 1024},
+		{"name": "tenant_b", "users": ["app_b"]}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, set.groups, 2)
+	assert.Same(t, set.groups[0], set.byUser["app_a"])
+	assert.Same(t, set.groups[0], set.byWorkloadClass["etl"])
+	assert.Same(t, set.groups[1], set.byName["tenant_b"])
+	assert.NotNil(t, set.groups[0].limiter)
+	assert.Nil(t, set.groups[1].limiter)
+
+	for _, tcase := range []struct {
+		config, err string
+	}{
+		{`{"groups": [{"users": ["a"]}]}`, "resource group #1 has no name"},
+		{`{"groups": [{"name": "a"}, {"name": "a"}]}`, "resource group a is defined twice"},
+		{`{"groups": [{"name": "a", "max_qps": -1}]}`, "resource group a has a negative limit"},
+		{`{"groups": [{"name": "a", "max_concurrency": 4, "max_queue_size": 2}]}`, "resource group a: max_queue_size 2 is less than max_concurrency 4"},
+		{`{"groups": [{"name": "a", "users": ["u"]}, {"name": "b", "users": ["u"]}]}`, "user u is in resource groups a and b"},
+		{`{"groups": [{"name": "a", "workload_classes": ["etl"]}, {"name": "b", "workload_classes": ["etl"]}]}`, "workload class etl is in resource groups a and b"},
+		{`{"groups": [{"name": "a", "databases": ["db"]}, {"name": "b", "databases": ["db"]}]}`, "database db is in resource groups a and b"},
+		{`{"groups": [{"name": "a", "max_cpu": 1}]}`, `json: unknown field "max_cpu"`},
+		{`{"database_isolation": {"name": "a"}}`, "database_isolation only has the limits of the groups of the databases"},
+		{`{"database_isolation": {"max_concurrency": 4, "max_queue_size": 2}}`, "database_isolation: max_queue_size 2 is less than max_concurrency 4"},
+	} {
+		_, err := parseResourceGroups([]byte(tcase.config))
+		assert.EqualError(t, err, tcase.err, tcase.config)
+	}
+}
+
+func newTestResourceGroups(t *testing.T, config string) *resourceGroups {
+	env := tabletenv.NewEnv(tabletenv.NewDefaultConfig(), t.Name())
+	rgs := newResourceGroups(env, ccl.New(env.Exporter()))
+	set, err := parseResourceGroups([]byte(config))
+	require.NoError(t, err)
+	rgs.set.Store(set)
+	return rgs
+}
+
+func TestResourceGroupsGroup(t *testing.T) {
+	rgs := newTestResourceGroups(t, `{"groups": [
+		{"name": "by_user", "users": ["app"]},
+		{"name": "by_class", "workload_classes": ["etl"]},
+		{"name": "by_rule"}
+	]}`)
+	// A rule comes first, then the user, then the workload class.
+	assert.Equal(t, "by_rule", rgs.group("by_rule", "app", "etl", "").Name)
+	assert.Equal(t, "by_user", rgs.group("", "app", "etl", "").Name)
+	assert.Equal(t, "by_class", rgs.group("", "other", "etl", "").Name)
+	assert.Equal(t, "by_user", rgs.group("undefined", "app", "", "").Name)
+	assert.Nil(t, rgs.group("", "other", "", ""))
+}
+
+func TestResourceGroupsDatabaseIsolation(t *testing.T) {
+	rgs := newTestResourceGroups(t, `{"groups": [{"name": "big", "databases": ["big_db"], "max_concurrency": 16}]}`)
+	assert.Equal(t, "big", rgs.group("", "", "", "big_db").Name)
+	// Without the database isolation mode, the other databases are not
+	// limited, and the rules have no namespace.
+	assert.Nil(t, rgs.group("", "", "", "small_db"))
+	assert.Empty(t, rgs.ruleNamespace("small_db"))
+
+	rgs = newTestResourceGroups(t, `{
+		"database_isolation": {"max_concurrency": 2, "max_qps": 10},
+		"groups": [{"name": "big", "databases": ["big_db"], "max_concurrency": 16}, {"name": "etl", "workload_classes": ["etl"]}]
+	}`)
+	assert.Equal(t, "big", rgs.group("", "", "", "big_db").Name)
+	assert.Equal(t, "etl", rgs.group("", "", "etl", "small_db").Name)
+	// Each database is in a group of its own, created on its first query.
+	small := rgs.group("", "", "", "small_db")
+	require.NotNil(t, small)
+	assert.Equal(t, "small_db", small.Name)
+	assert.Equal(t, 2, small.MaxConcurrency)
+	assert.NotNil(t, small.limiter)
+	assert.Same(t, small, rgs.group("", "", "", "small_db"))
+	other := rgs.group("", "", "", "other_db")
+	assert.NotSame(t, small, other)
+	assert.Nil(t, rgs.group("", "", "", ""))
+	assert.Len(t, rgs.set.Load().all(), 4)
+	assert.Equal(t, "small_db", rgs.ruleNamespace("small_db"))
+
+	// The databases don't share their limits.
+	done, _, err := rgs.enter(context.Background(), small, nil)
+	require.NoError(t, err)
+	defer done()
+	done, _, err = rgs.enter(context.Background(), other, nil)
+	require.NoError(t, err)
+	defer done()
+	assert.EqualValues(t, map[string]int64{"small_db": 1, "other_db": 1}, rgs.queries.Counts())
+}
+
+func TestResourceGroupsEnter(t *testing.T) {
+	rgs := newTestResourceGroups(t, `{"groups": [
+		{"name": "queued", "max_concurrency": 1, "max_queue_size": 2},
+		{"name": "rated", "max_qps": 1},
+		{"name": "memory", "max_memory_bytes": 1}
+	]}`)
+	ctx := context.Background()
+
+	queued := rgs.group("queued", "", "", "")
+	done, waited, err := rgs.enter(ctx, queued, nil)
+	require.NoError(t, err)
+	assert.False(t, waited)
+	// The second query waits for the first one.
+	entered := make(chan bool)
+	go func() {
+		done, waited, err := rgs.enter(ctx, queued, nil)
+		assert.NoError(t, err)
+		done()
+		entered <- waited
+	}()
+	for rgs.ccl.Pending(resourceGroupQueuePrefix+"queued") < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// The third one doesn't fit in the queue.
+	_, _, err = rgs.enter(ctx, queued, nil)
+	assert.Equal(t, vtrpcpb.Code_RESOURCE_EXHAUSTED, vterrors.Code(err))
+	assert.ErrorContains(t, err, "resource group queued")
+	done()
+	assert.True(t, <-entered)
+
+	rated := rgs.group("rated", "", "", "")
+	done, _, err = rgs.enter(ctx, rated, nil)
+	require.NoError(t, err)
+	done()
+	_, _, err = rgs.enter(ctx, rated, nil)
+	assert.EqualError(t, err, "resource group rated is over its rate of 1 queries per second")
+
+	memory := rgs.group("memory", "", "", "")
+	result := &sqltypes.Result{Rows: [][]sqltypes.Value{{sqltypes.NewInt64(1)}}}
+	// A result is only rejected if the budget is already used by others.
+	assert.NoError(t, rgs.checkResult(memory, result))
+	require.True(t, memory.memory.TryAcquire(1))
+	err = rgs.checkResult(memory, result)
+	assert.Equal(t, vtrpcpb.Code_RESOURCE_EXHAUSTED, vterrors.Code(err))
+	memory.memory.Release(1)
+
+	assert.EqualValues(t, map[string]int64{"queued.concurrency": 1, "rated.qps": 1, "memory.memory": 1}, rgs.rejections.Counts())
+	assert.EqualValues(t, map[string]int64{"queued": 2, "rated": 1}, rgs.queries.Counts())
+}
+
+func TestQueryExecutorResourceGroup(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+	set, err := parseResourceGroups([]byte(`{"groups": [
+		{"name": "tenant_a", "users": ["app_a"], "max_qps": 1},
+		{"name": "tenant_b", "databases": ["tenant_b"]}
+	]}`))
+	require.NoError(t, err)
+	tsv.qe.resourceGroups.set.Store(set)
+
+	db.AddQuery("select * from test_table where pk = 1 limit 100001", &sqltypes.Result{Fields: getTestTableFields()})
+	target := querypb.Target{TabletType: topodatapb.TabletType_PRIMARY}
+	appCtx := callerid.NewContext(ctx, nil, &querypb.VTGateCallerID{Username: "app_a"})
+	_, err = tsv.Execute(appCtx, &target, "select * from test_table where pk = 1", nil, 0, 0, nil)
+	require.NoError(t, err)
+	_, err = tsv.Execute(appCtx, &target, "select * from test_table where pk = 1", nil, 0, 0, nil)
+	assert.ErrorContains(t, err, "resource group tenant_a is over its rate of 1 queries per second")
+	// The queries of the other users are not limited.
+	_, err = tsv.Execute(ctx, &target, "select * from test_table where pk = 1", nil, 0, 0, nil)
+	require.NoError(t, err)
+
+	// A RESOURCE_GROUP rule puts its queries in its group.
+	action := &ResourceGroupAction{Rule: rules.NewActiveQueryRule("tenant b", "tenant_b", rules.QRResourceGroup), Action: rules.QRResourceGroup}
+	require.NoError(t, action.SetParams(`{"group": "tenant_b"}`))
+	qre := newTestQueryExecutor(appCtx, tsv, "select * from test_table where pk = 1", 0)
+	qre.matchedActionList = []ActionInterface{action}
+	done, err := qre.enterResourceGroup()
+	require.NoError(t, err)
+	done()
+	assert.Equal(t, "tenant_b", qre.resourceGroup.Name)
+
+	// The queries of a database are in its group.
+	qre = newTestQueryExecutor(ctx, tsv, "select * from test_table where pk = 1", 0)
+	qre.database = "tenant_b"
+	done, err = qre.enterResourceGroup()
+	require.NoError(t, err)
+	done()
+	assert.Equal(t, "tenant_b", qre.resourceGroup.Name)
+
+	assert.EqualError(t, action.SetParams(`{}`), "stringParams: {} is invalid: the resource group is missing")
+}
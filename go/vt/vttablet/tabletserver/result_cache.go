@@ -0,0 +1,103 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/cache"
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// resultCaches are the caches of the results of the CACHE_RESULT rules, by
+// rule. The results are only evicted once expired or to make room: the
+// writes to the tables don't invalidate them.
+type resultCaches struct {
+	caches sync.Map
+}
+
+type cachedResult struct {
+	result  *sqltypes.Result
+	expires time.Time
+}
+
+func newResultCaches() *resultCaches {
+	return &resultCaches{}
+}
+
+// get returns the cache of a rule, which holds up to maxSize bytes of
+// results.
+func (rc *resultCaches) get(ruleName string, maxSize int64) *cache.LRUCache {
+	v, ok := rc.caches.Load(ruleName)
+	if !ok {
+		v, _ = rc.caches.LoadOrStore(ruleName, cache.NewLRUCache(maxSize, func(v any) int64 {
+			return v.(*cachedResult).result.CachedSize(true)
+		}))
+	}
+	c := v.(*cache.LRUCache)
+	if c.MaxCapacity() != maxSize {
+		c.SetCapacity(maxSize)
+	}
+	return c
+}
+
+// retain drops the results cached by the rules which are not in ruleNames.
+func (rc *resultCaches) retain(ruleNames map[string]bool) {
+	rc.caches.Range(func(key, _ any) bool {
+		if !ruleNames[key.(string)] {
+			rc.caches.Delete(key)
+		}
+		return true
+	})
+}
+
+// clear drops all the cached results.
+func (rc *resultCaches) clear() {
+	rc.caches.Range(func(key, _ any) bool {
+		rc.caches.Delete(key)
+		return true
+	})
+}
+
+// resultCacheKey returns the key of the result of a query, which is the same
+// for the same query with the same bind variables in the same database and
+// with the same settings.
+func resultCacheKey(database string, setting string, query string, bindVars map[string]*querypb.BindVariable) string {
+	var key strings.Builder
+	key.WriteString(database)
+	key.WriteByte(0)
+	key.WriteString(setting)
+	key.WriteByte(0)
+	key.WriteString(query)
+	names := make([]string, 0, len(bindVars))
+	for name := range bindVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeValue := func(typ querypb.Type, value []byte) {
+		key.WriteByte(0)
+		key.WriteString(strconv.Itoa(int(typ)))
+		key.WriteByte(':')
+		key.WriteString(strconv.Itoa(len(value)))
+		key.WriteByte(':')
+		key.Write(value)
+	}
+	for _, name := range names {
+		bv := bindVars[name]
+		key.WriteByte(0)
+		key.WriteString(name)
+		writeValue(bv.Type, bv.Value)
+		for _, value := range bv.Values {
+			writeValue(value.Type, value.Value)
+		}
+	}
+	return key.String()
+}
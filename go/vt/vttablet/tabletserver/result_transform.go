@@ -0,0 +1,123 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// ResultTransform rewrites a result for the AfterExecution or the
+// RewriteResult of an action: it adds columns, filters rows and rewrites
+// values, without modifying the result, which may be shared, e.g. by the
+// result cache. It copies the fields and the rows of the result on the first
+// change, and keeps the result itself if nothing changes.
+//
+// Like the results of a stream after the first one, the result may have no
+// fields: the columns are then only added to its rows.
+type ResultTransform struct {
+	in, out *sqltypes.Result
+}
+
+// NewResultTransform returns a transform of a result.
+func NewResultTransform(result *sqltypes.Result) *ResultTransform {
+	return &ResultTransform{in: result}
+}
+
+// Result returns the transformed result, which is the original one if nothing
+// changed.
+func (t *ResultTransform) Result() *sqltypes.Result {
+	if t.out == nil {
+		return t.in
+	}
+	return t.out
+}
+
+// Fields returns the fields of the transformed result.
+func (t *ResultTransform) Fields() []*querypb.Field {
+	return t.Result().Fields
+}
+
+// Rows returns the rows of the transformed result. They must not be modified.
+func (t *ResultTransform) Rows() [][]sqltypes.Value {
+	return t.Result().Rows
+}
+
+// SetField replaces the field of a column, if the result has fields.
+func (t *ResultTransform) SetField(column int, field *querypb.Field) {
+	if fields := t.Result().Fields; fields == nil || fields[column] == field {
+		return
+	}
+	t.copyOnWrite()
+	t.out.Fields[column] = field
+}
+
+// AddColumn appends a column to the result, whose value in each row is the one
+// value returns for the row.
+func (t *ResultTransform) AddColumn(field *querypb.Field, value func(row []sqltypes.Value) sqltypes.Value) {
+	t.copyOnWrite()
+	if t.out.Fields != nil {
+		t.out.Fields = append(t.out.Fields, field)
+	}
+	for i, row := range t.out.Rows {
+		t.out.Rows[i] = append(row, value(row))
+	}
+}
+
+// FilterRows drops the rows keep returns false for.
+func (t *ResultTransform) FilterRows(keep func(row []sqltypes.Value) bool) {
+	kept, dropped := make([]bool, len(t.Result().Rows)), false
+	for i, row := range t.Result().Rows {
+		kept[i] = keep(row)
+		dropped = dropped || !kept[i]
+	}
+	if !dropped {
+		return
+	}
+	t.copyOnWrite()
+	rows := t.out.Rows[:0]
+	for i, row := range t.out.Rows {
+		if kept[i] {
+			rows = append(rows, row)
+		}
+	}
+	// The results which count their rows in their rows affected keep
+	// counting them.
+	if t.out.RowsAffected == uint64(len(t.out.Rows)) {
+		t.out.RowsAffected = uint64(len(rows))
+	}
+	t.out.Rows = rows
+}
+
+// MapValues replaces the values of a column by the ones f returns for them.
+func (t *ResultTransform) MapValues(column int, f func(value sqltypes.Value) sqltypes.Value) {
+	t.copyOnWrite()
+	for _, row := range t.out.Rows {
+		if column < len(row) {
+			row[column] = f(row[column])
+		}
+	}
+}
+
+// copyOnWrite copies the result, its fields and its rows, but not their
+// values, before the first change.
+func (t *ResultTransform) copyOnWrite() {
+	if t.out != nil {
+		return
+	}
+	t.out = t.in.ShallowCopy()
+	t.out.StatusFlags = t.in.StatusFlags
+	if t.in.Fields != nil {
+		t.out.Fields = append(make([]*querypb.Field, 0, len(t.in.Fields)+1), t.in.Fields...)
+	}
+	if t.in.Rows != nil {
+		t.out.Rows = make([][]sqltypes.Value, len(t.in.Rows))
+		for i, row := range t.in.Rows {
+			t.out.Rows[i] = append(make([]sqltypes.Value, 0, len(row)+1), row...)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestResultTransform(t *testing.T) {
+	result := sqltypes.MakeTestResult(sqltypes.MakeTestFields("id|name", "int64|varchar"), "1|a", "2|b", "3|c")
+	result.RowsAffected = 3
+	original := result.Copy()
+
+	// Nothing is copied until something changes.
+	transform := NewResultTransform(result)
+	transform.FilterRows(func(row []sqltypes.Value) bool { return true })
+	transform.SetField(0, result.Fields[0])
+	assert.Same(t, result, transform.Result())
+
+	transform.FilterRows(func(row []sqltypes.Value) bool { return row[0].ToString() != "2" })
+	transform.MapValues(1, func(value sqltypes.Value) sqltypes.Value {
+		return sqltypes.NewVarChar(value.ToString() + value.ToString())
+	})
+	transform.AddColumn(&querypb.Field{Name: "tag", Type: sqltypes.VarChar}, func(row []sqltypes.Value) sqltypes.Value {
+		return sqltypes.NewVarChar("row " + row[0].ToString())
+	})
+	transform.SetField(0, &querypb.Field{Name: "key", Type: sqltypes.Int64})
+	want := sqltypes.MakeTestResult(sqltypes.MakeTestFields("key|name|tag", "int64|varchar|varchar"), "1|aa|row 1", "3|cc|row 3")
+	want.RowsAffected = 2
+	assert.True(t, want.Equal(transform.Result()), transform.Result())
+	assert.True(t, original.Equal(result), result)
+
+	// The next results of a stream have no fields: only their rows get the
+	// column.
+	next := &sqltypes.Result{Rows: [][]sqltypes.Value{{sqltypes.NewInt64(4), sqltypes.NewVarChar("d")}}}
+	transform = NewResultTransform(next)
+	transform.SetField(0, &querypb.Field{Name: "key", Type: sqltypes.Int64})
+	transform.AddColumn(&querypb.Field{Name: "tag", Type: sqltypes.VarChar}, func(row []sqltypes.Value) sqltypes.Value { return sqltypes.NULL })
+	assert.Nil(t, transform.Fields())
+	assert.Equal(t, [][]sqltypes.Value{{sqltypes.NewInt64(4), sqltypes.NewVarChar("d"), sqltypes.NULL}}, transform.Rows())
+	assert.Len(t, next.Rows[0], 2)
+}
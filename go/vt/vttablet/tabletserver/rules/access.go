@@ -0,0 +1,97 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AccessConds are the conditions of a rule on how MySQL accesses the tables
+// of the queries, like
+//
+//	{"full_scan": true}
+//	{"no_index": true}
+//	{"min_estimated_rows": 100000}
+//
+// A query which matches the other conditions of the rule only matches them if
+// MySQL scans one of its tables in full, if one of its tables is scanned
+// without any index MySQL could use instead, and if MySQL estimates it reads
+// at least min_estimated_rows rows of one of its tables, for the ones set. The
+// tablets read the access of the queries from their EXPLAIN, see
+// AccessProfile, once per plan: the queries of a plan match the same, whatever
+// their bind variables.
+type AccessConds struct {
+	spec             string
+	fullScan         bool
+	noIndex          bool
+	minEstimatedRows uint64
+}
+
+// ParseAccessConds parses the JSON spec of the access conditions.
+func ParseAccessConds(spec string) (*AccessConds, error) {
+	c := &struct {
+		FullScan         bool  `json:"full_scan"`
+		NoIndex          bool  `json:"no_index"`
+		MinEstimatedRows int64 `json:"min_estimated_rows"`
+	}{}
+	dec := json.NewDecoder(strings.NewReader(spec))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("invalid access conditions %s: %v", spec, err)
+	}
+	if c.MinEstimatedRows < 0 {
+		return nil, fmt.Errorf("invalid min_estimated_rows %d of access conditions %s", c.MinEstimatedRows, spec)
+	}
+	ac := &AccessConds{spec: spec, fullScan: c.FullScan, noIndex: c.NoIndex, minEstimatedRows: uint64(c.MinEstimatedRows)}
+	if !ac.fullScan && !ac.noIndex && ac.minEstimatedRows == 0 {
+		return nil, fmt.Errorf("invalid access conditions %s: no condition is set", spec)
+	}
+	return ac, nil
+}
+
+// Matches returns whether the access profile of a query matches the
+// conditions. The queries without a profile, which MySQL can't explain, don't
+// match them.
+func (ac *AccessConds) Matches(profile *AccessProfile) bool {
+	if profile == nil {
+		return false
+	}
+	return (!ac.fullScan || profile.FullScan) &&
+		(!ac.noIndex || profile.NoIndex) &&
+		profile.EstimatedRows >= ac.minEstimatedRows
+}
+
+// String returns the spec of the conditions.
+func (ac *AccessConds) String() string {
+	return ac.spec
+}
+
+// AccessProfile is how MySQL accesses the tables of a query, which the
+// tablets read from its EXPLAIN.
+type AccessProfile struct {
+	// FullScan is set if MySQL reads all the rows of one of the tables, or
+	// all the entries of one of its indexes.
+	FullScan bool
+	// NoIndex is set if one of the tables is fully scanned without any
+	// index MySQL could use instead.
+	NoIndex bool
+	// EstimatedRows are the most rows MySQL estimates it reads from one of
+	// the tables.
+	EstimatedRows uint64
+}
+
+// MatchesAccess returns whether the access conditions of the rule, if any,
+// match the access profile of a query, which profile returns on demand: the
+// queries of the rules without access conditions aren't explained. A nil
+// profile matches no access conditions.
+func (qr *Rule) MatchesAccess(profile func() *AccessProfile) bool {
+	if qr.accessConds == nil {
+		return true
+	}
+	return profile != nil && qr.accessConds.Matches(profile())
+}
@@ -0,0 +1,85 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestParseAccessCondsErrors(t *testing.T) {
+	testCases := map[string]string{
+		`{}`:                          "invalid access conditions {}: no condition is set",
+		`{"full_scan": false}`:        "invalid access conditions {\"full_scan\": false}: no condition is set",
+		`{"full_scan": true, "x": 1}`: "invalid access conditions {\"full_scan\": true, \"x\": 1}: json: unknown field \"x\"",
+		`{"min_estimated_rows": -1}`:  "invalid min_estimated_rows -1 of access conditions {\"min_estimated_rows\": -1}",
+		`{"no_index": "yes"}`:         "invalid access conditions {\"no_index\": \"yes\"}: json: cannot unmarshal string into Go struct field .no_index of type bool",
+	}
+	for spec, expected := range testCases {
+		_, err := ParseAccessConds(spec)
+		assert.EqualError(t, err, expected, spec)
+	}
+}
+
+func TestAccessCondsMatches(t *testing.T) {
+	fullScans, err := ParseAccessConds(`{"full_scan": true}`)
+	require.NoError(t, err)
+	assert.True(t, fullScans.Matches(&AccessProfile{FullScan: true, EstimatedRows: 10}))
+	assert.False(t, fullScans.Matches(&AccessProfile{EstimatedRows: 1000000}))
+	// The queries which can't be explained don't match.
+	assert.False(t, fullScans.Matches(nil))
+
+	// The conditions add up.
+	bigScans, err := ParseAccessConds(`{"no_index": true, "min_estimated_rows": 100000}`)
+	require.NoError(t, err)
+	assert.True(t, bigScans.Matches(&AccessProfile{FullScan: true, NoIndex: true, EstimatedRows: 100000}))
+	assert.False(t, bigScans.Matches(&AccessProfile{FullScan: true, NoIndex: true, EstimatedRows: 99999}))
+	assert.False(t, bigScans.Matches(&AccessProfile{FullScan: true, EstimatedRows: 1000000}))
+}
+
+func TestRuleAccessConds(t *testing.T) {
+	qr := NewActiveQueryRule("rule", "name", QRFail)
+	explained := 0
+	profile := func() *AccessProfile {
+		explained++
+		return &AccessProfile{FullScan: true}
+	}
+	// The queries of the rules without access conditions aren't explained.
+	assert.True(t, qr.MatchesAccess(profile))
+	assert.Zero(t, explained)
+
+	require.NoError(t, qr.SetAccessConds(`{"full_scan": true}`))
+	assert.Equal(t, `{"full_scan": true}`, qr.GetAccessConds())
+	assert.True(t, qr.MatchesAccess(profile))
+	assert.Equal(t, 1, explained)
+	assert.False(t, qr.MatchesAccess(nil))
+	// Without the EXPLAIN of the query, the rule doesn't match.
+	qrs := New()
+	qrs.Add(qr)
+	act, _, _ := qrs.GetAction("", "", "", false, nil, sqlparser.MarginComments{})
+	assert.Equal(t, QRContinue, act)
+
+	// The conditions are kept by their spec.
+	data, err := qr.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"AccessConds":"{\"full_scan\": true}"`)
+	qrs = New()
+	require.NoError(t, qrs.UnmarshalJSON([]byte("["+string(data)+"]")))
+	assert.Equal(t, qr.GetAccessConds(), qrs.Find("name").GetAccessConds())
+	assert.True(t, qr.Equal(qrs.Find("name")))
+	assert.True(t, qr.Equal(qr.Copy()))
+	bindVars, err := qr.ToBindVariable()
+	require.NoError(t, err)
+	assert.Equal(t, `{"full_scan": true}`, string(bindVars["access_conds"].Value))
+
+	require.NoError(t, qr.SetAccessConds(""))
+	assert.True(t, qr.MatchesAccess(nil))
+	assert.False(t, qr.Equal(qrs.Find("name")))
+}
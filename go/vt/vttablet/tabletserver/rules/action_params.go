@@ -0,0 +1,457 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// The action args of a rule are the params of its action, a JSON object like
+//
+//	{"max_queue_size": 10, "max_concurrency": 2}
+//
+// Each action declares the params it takes in an ActionSchema, see
+// actionSchemas. ValidateActionArgs checks the action args of a rule against
+// the schema of its action, the types and the ranges of the params and the
+// constraints between them, so that the mistakes, like a misspelt param, are
+// told before the action parses them; ActionSchemas describes the params of
+// the actions.
+
+// ActionParamType is the type of an action param.
+type ActionParamType string
+
+const (
+	ParamString  ActionParamType = "string"
+	ParamInteger ActionParamType = "integer"
+	ParamNumber  ActionParamType = "number"
+	ParamBoolean ActionParamType = "boolean"
+	// ParamDuration is a string like 2s or 100ms, see time.ParseDuration.
+	ParamDuration ActionParamType = "duration"
+	// ParamList is a JSON array of Items.
+	ParamList ActionParamType = "list"
+	// ParamMap is a JSON object of Items, by key.
+	ParamMap ActionParamType = "map"
+	// ParamObject is a JSON object of Params.
+	ParamObject ActionParamType = "object"
+)
+
+// ActionParam is a param of an action, or the type of the items of a list or
+// a map param. The JSON nulls and the empty strings stand for the params which
+// aren't set.
+type ActionParam struct {
+	Name        string          `json:"name,omitempty"`
+	Type        ActionParamType `json:"type"`
+	Description string          `json:"description,omitempty"`
+	Required    bool            `json:"required,omitempty"`
+	// Default describes the value of the param when it isn't set.
+	Default string `json:"default,omitempty"`
+	// Min and Max bound the numbers, and the durations in seconds. They are
+	// inclusive, unless ExclusiveMin or ExclusiveMax is set.
+	Min          *float64 `json:"min,omitempty"`
+	ExclusiveMin bool     `json:"exclusive_min,omitempty"`
+	Max          *float64 `json:"max,omitempty"`
+	ExclusiveMax bool     `json:"exclusive_max,omitempty"`
+	// Enum are the values of a string, compared case-insensitively if
+	// FoldCase is set.
+	Enum     []string `json:"enum,omitempty"`
+	FoldCase bool     `json:"fold_case,omitempty"`
+	// Keys are the keys of a map, if they are limited.
+	Keys []string `json:"keys,omitempty"`
+	// Captures is set for the strings in which ${name} stands for a capture
+	// of the rule, see Rule.Captures.
+	Captures bool `json:"captures,omitempty"`
+	// Items is the type of the items of a list, or of the values of a map.
+	Items *ActionParam `json:"items,omitempty"`
+	// Params and Constraints are the ones of an object.
+	Params      []ActionParam            `json:"params,omitempty"`
+	Constraints []ActionParamsConstraint `json:"constraints,omitempty"`
+}
+
+// ActionParamsConstraint is a constraint between the params of an action, or
+// of an object param.
+type ActionParamsConstraint struct {
+	// Description tells the constraint, like "bind_var needs group_by
+	// bind_var". It is the error of the params which break it.
+	Description string `json:"description"`
+
+	holds func(params map[string]any) bool
+}
+
+// ActionSchema describes an action and its params.
+type ActionSchema struct {
+	Action      Action                   `json:"action"`
+	Description string                   `json:"description"`
+	Params      []ActionParam            `json:"params,omitempty"`
+	Constraints []ActionParamsConstraint `json:"constraints,omitempty"`
+}
+
+// Schema returns the schema of the params of an action, false if it declares
+// none.
+func (act Action) Schema() (*ActionSchema, bool) {
+	schema, ok := actionSchemas[act]
+	return schema, ok
+}
+
+// ActionSchemas returns the schemas of the actions, in the order of the
+// actions.
+func ActionSchemas() []*ActionSchema {
+	schemas := make([]*ActionSchema, 0, len(actionSchemas))
+	for _, schema := range actionSchemas {
+		schemas = append(schemas, schema)
+	}
+	slices.SortFunc(schemas, func(a, b *ActionSchema) bool { return a.Action < b.Action })
+	return schemas
+}
+
+// ValidateActionArgs validates the action args of an action against its
+// schema. The args of the actions without a schema are left to the actions.
+func ValidateActionArgs(act Action, actionArgs string) error {
+	schema, ok := act.Schema()
+	if !ok {
+		return nil
+	}
+	return schema.Validate(actionArgs)
+}
+
+// Validate validates action args against the schema. The empty args are the
+// ones without any param.
+func (schema *ActionSchema) Validate(actionArgs string) error {
+	params := map[string]any{}
+	if strings.TrimSpace(actionArgs) != "" {
+		dec := json.NewDecoder(strings.NewReader(actionArgs))
+		dec.UseNumber()
+		if err := dec.Decode(&params); err != nil {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: %s takes a JSON object of params: %v", actionArgs, schema.Action.ToString(), err)
+		}
+	}
+	if reason := validateParams("", schema.Params, schema.Constraints, params); reason != "" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: %s", actionArgs, reason)
+	}
+	return nil
+}
+
+// validateParams returns why the params of an object, at a path like
+// "adaptive.", break their schema, "" if they don't.
+func validateParams(path string, schema []ActionParam, constraints []ActionParamsConstraint, params map[string]any) string {
+	for _, name := range sortedKeys(params) {
+		if !slices.ContainsFunc(schema, func(p ActionParam) bool { return p.Name == name }) {
+			names := make([]string, 0, len(schema))
+			for _, p := range schema {
+				names = append(names, p.Name)
+			}
+			if len(names) == 0 {
+				return fmt.Sprintf("unknown param %s%s, expected no param", path, name)
+			}
+			return fmt.Sprintf("unknown param %s%s, expected %s", path, name, orList(names))
+		}
+	}
+	for i := range schema {
+		p := &schema[i]
+		value, ok := params[p.Name]
+		if !ok || value == nil || value == "" {
+			if p.Required {
+				return fmt.Sprintf("the param %s%s is required", path, p.Name)
+			}
+			continue
+		}
+		if reason := p.validate(path+p.Name, value); reason != "" {
+			return reason
+		}
+	}
+	for _, c := range constraints {
+		if !c.holds(params) {
+			if path != "" {
+				return fmt.Sprintf("%s: %s", strings.TrimSuffix(path, "."), c.Description)
+			}
+			return c.Description
+		}
+	}
+	return ""
+}
+
+// validate returns why a value at a path breaks the param, "" if it doesn't.
+func (p *ActionParam) validate(path string, value any) string {
+	switch p.Type {
+	case ParamString:
+		s, ok := value.(string)
+		if !ok {
+			return wrongType(path, "a string", value)
+		}
+		if len(p.Enum) > 0 && !p.inEnum(s) {
+			return fmt.Sprintf("%s must be %s, got %q", path, orList(p.Enum), s)
+		}
+	case ParamInteger:
+		n, ok := value.(json.Number)
+		if !ok {
+			return wrongType(path, "an integer", value)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return wrongType(path, "an integer", value)
+		}
+		return p.checkBounds(path, float64(i), n.String())
+	case ParamNumber:
+		n, ok := value.(json.Number)
+		if !ok {
+			return wrongType(path, "a number", value)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return wrongType(path, "a number", value)
+		}
+		return p.checkBounds(path, f, n.String())
+	case ParamBoolean:
+		if _, ok := value.(bool); !ok {
+			return wrongType(path, "true or false", value)
+		}
+	case ParamDuration:
+		s, ok := value.(string)
+		if !ok {
+			return wrongType(path, "a duration, like 2s", value)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Sprintf("%s must be a duration, like 2s, got %q", path, s)
+		}
+		return p.checkBounds(path, d.Seconds(), fmt.Sprintf("%q", s))
+	case ParamList:
+		list, ok := value.([]any)
+		if !ok {
+			return wrongType(path, "a list", value)
+		}
+		for i, item := range list {
+			if item == nil || p.Items == nil {
+				continue
+			}
+			if reason := p.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); reason != "" {
+				return reason
+			}
+		}
+	case ParamMap:
+		m, ok := value.(map[string]any)
+		if !ok {
+			return wrongType(path, "an object", value)
+		}
+		for _, key := range sortedKeys(m) {
+			if len(p.Keys) > 0 && !slices.Contains(p.Keys, key) {
+				return fmt.Sprintf("invalid key %q of %s, expected %s", key, path, orList(p.Keys))
+			}
+			if m[key] == nil || p.Items == nil {
+				continue
+			}
+			if reason := p.Items.validate(path+"."+key, m[key]); reason != "" {
+				return reason
+			}
+		}
+	case ParamObject:
+		m, ok := value.(map[string]any)
+		if !ok {
+			return wrongType(path, "an object", value)
+		}
+		return validateParams(path+".", p.Params, p.Constraints, m)
+	}
+	return ""
+}
+
+func (p *ActionParam) inEnum(s string) bool {
+	for _, v := range p.Enum {
+		if v == s || (p.FoldCase && strings.EqualFold(v, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBounds returns why a number, or the seconds of a duration, at a path
+// is out of the bounds of the param, "" if it isn't. got is the value as
+// given.
+func (p *ActionParam) checkBounds(path string, f float64, got string) string {
+	if p.Min != nil && (f < *p.Min || (p.ExclusiveMin && f == *p.Min)) {
+		return fmt.Sprintf("%s must be %s, got %s", path, p.Range(), got)
+	}
+	if p.Max != nil && (f > *p.Max || (p.ExclusiveMax && f == *p.Max)) {
+		return fmt.Sprintf("%s must be %s, got %s", path, p.Range(), got)
+	}
+	return ""
+}
+
+// Range describes the bounds of a param, like ">= 0" or "in (0, 100]", ""
+// if it has none.
+func (p *ActionParam) Range() string {
+	bound := func(f float64) string {
+		if p.Type == ParamDuration {
+			return time.Duration(f * float64(time.Second)).String()
+		}
+		return fmt.Sprint(f)
+	}
+	switch {
+	case p.Min != nil && p.Max != nil:
+		left, right := "[", "]"
+		if p.ExclusiveMin {
+			left = "("
+		}
+		if p.ExclusiveMax {
+			right = ")"
+		}
+		return fmt.Sprintf("in %s%s, %s%s", left, bound(*p.Min), bound(*p.Max), right)
+	case p.Min != nil && p.ExclusiveMin:
+		return "> " + bound(*p.Min)
+	case p.Min != nil:
+		return ">= " + bound(*p.Min)
+	case p.Max != nil && p.ExclusiveMax:
+		return "< " + bound(*p.Max)
+	case p.Max != nil:
+		return "<= " + bound(*p.Max)
+	}
+	return ""
+}
+
+func wrongType(path, expected string, value any) string {
+	got, _ := json.Marshal(value)
+	return fmt.Sprintf("%s must be %s, got %s", path, expected, bytes.TrimSpace(got))
+}
+
+// orList returns the values like "a, b or c".
+func orList(values []string) string {
+	if len(values) <= 1 {
+		return strings.Join(values, "")
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// isSet returns whether a param is set, to a value other than null, false,
+// 0 or "", which the actions take for the params which aren't set.
+func isSet(params map[string]any, name string) bool {
+	switch v := params[name].(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case bool:
+		return v
+	case json.Number:
+		f, err := v.Float64()
+		return err != nil || f != 0
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+// paramNumber returns the value of a number or duration param, in seconds
+// for the durations, false if it isn't set or isn't one.
+func paramNumber(params map[string]any, name string) (float64, bool) {
+	switch v := params[name].(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		d, err := time.ParseDuration(v)
+		return d.Seconds(), err == nil
+	}
+	return 0, false
+}
+
+// bound returns a pointer to a bound of a param.
+func bound(f float64) *float64 {
+	return &f
+}
+
+// paramNeeds is the constraint of a param which needs another one, set to
+// one of the values if any.
+func paramNeeds(param, needed string, values ...string) ActionParamsConstraint {
+	description := fmt.Sprintf("%s needs %s", param, needed)
+	if len(values) > 0 {
+		description += " " + orList(values)
+	}
+	return ActionParamsConstraint{
+		Description: description,
+		holds: func(params map[string]any) bool {
+			if !isSet(params, param) {
+				return true
+			}
+			if !isSet(params, needed) {
+				return false
+			}
+			s, _ := params[needed].(string)
+			return len(values) == 0 || slices.Contains(values, s)
+		},
+	}
+}
+
+// paramsExclusive is the constraint of two params which can't be both set.
+func paramsExclusive(a, b string) ActionParamsConstraint {
+	return ActionParamsConstraint{
+		Description: fmt.Sprintf("%s and %s can't be both set", a, b),
+		holds: func(params map[string]any) bool {
+			return !isSet(params, a) || !isSet(params, b)
+		},
+	}
+}
+
+// paramsExactlyOne is the constraint of two params one of which must be set.
+func paramsExactlyOne(a, b string) ActionParamsConstraint {
+	return ActionParamsConstraint{
+		Description: fmt.Sprintf("exactly one of %s and %s is expected", a, b),
+		holds: func(params map[string]any) bool {
+			return isSet(params, a) != isSet(params, b)
+		},
+	}
+}
+
+// paramsAnyOf is the constraint of params at least one of which must be set.
+func paramsAnyOf(names ...string) ActionParamsConstraint {
+	return ActionParamsConstraint{
+		Description: fmt.Sprintf("%s is expected", orList(names)),
+		holds: func(params map[string]any) bool {
+			return slices.ContainsFunc(names, func(name string) bool { return isSet(params, name) })
+		},
+	}
+}
+
+// paramNotAbove is the constraint of a number or duration param which can't
+// be above another one, when both are set.
+func paramNotAbove(param, other string) ActionParamsConstraint {
+	return ActionParamsConstraint{
+		Description: fmt.Sprintf("%s can't be above %s", param, other),
+		holds: func(params map[string]any) bool {
+			a, okA := paramNumber(params, param)
+			b, okB := paramNumber(params, other)
+			return !okA || !okB || a <= b
+		},
+	}
+}
+
+// paramsDiffer is the constraint of two string params which can't be set to
+// the same value.
+func paramsDiffer(a, b string) ActionParamsConstraint {
+	return ActionParamsConstraint{
+		Description: fmt.Sprintf("%s and %s can't be the same", a, b),
+		holds: func(params map[string]any) bool {
+			return !isSet(params, a) || params[a] != params[b]
+		},
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateActionArgs(t *testing.T) {
+	testcases := []struct {
+		action Action
+		args   string
+		err    string
+	}{
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "group_by": "bind_var", "bind_var": "id"}`},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "group_by": ""}`},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "lane_by": "user", "lanes": {"high": ["admin"], "low": null}}`},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "adaptive": {"target_latency": "50ms"}}`},
+		{action: QRFail, args: ""},
+		{action: QRFail, args: `{"errno": 1142, "sqlstate": "42000"}`},
+		{action: QRReadOnlyGuard, args: `{"statements": ["insert", "DDL"]}`},
+		{action: QRRetryWithBackoff, args: `{"backoff": "100ms", "max_backoff": "1s"}`},
+		{action: QRDataMasking, args: `{"columns": [{"name": "phone", "mode": "PARTIAL", "keep_last": 4}]}`},
+		{action: QRBuffer, args: `{"anything": 1}`},
+
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurency": 2}`,
+			err: "unknown param max_concurency, expected max_queue_size, max_concurrency, group_by, bind_var, fair_by, pool, lane_by, lanes, max_queue_wait_ms or adaptive"},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": "10"}`,
+			err: `max_queue_size must be an integer, got "10"`},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 1.5}`,
+			err: "max_queue_size must be an integer, got 1.5"},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": -1}`,
+			err: "max_queue_size must be >= 0, got -1"},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 20}`,
+			err: "max_concurrency must be in [1, max_queue_size] when max_queue_size is set"},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "group_by": "table"}`,
+			err: `group_by must be user, client_ip or bind_var, got "table"`},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "bind_var": "id"}`,
+			err: "bind_var needs group_by bind_var"},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "pool": "etl", "group_by": "user"}`,
+			err: "pool and group_by can't be both set"},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "lanes": {"urgent": ["admin"]}, "lane_by": "user"}`,
+			err: `invalid key "urgent" of lanes, expected high, normal or low`},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "lane_by": "user", "lanes": {"high": "admin"}}`,
+			err: `lanes.high must be a list, got "admin"`},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "adaptive": {"window": "1s"}}`,
+			err: "adaptive: target_latency or max_threads_running is expected"},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "adaptive": {"target_latency": "0s"}}`,
+			err: `adaptive.target_latency must be > 0s, got "0s"`},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "adaptive": {"target_latency": "50ms", "backoff": 1}}`,
+			err: "adaptive.backoff must be in [0, 1), got 1"},
+		{action: QRConcurrencyControl, args: `{"max_queue_size": 10, "max_concurrency": 2, "adaptive": {"target": "50ms"}}`,
+			err: "unknown param adaptive.target, expected target_latency, max_threads_running, min_concurrency, window or backoff"},
+		{action: QRConcurrencyControl, args: `[10, 2]`,
+			err: "CONCURRENCY_CONTROL takes a JSON object of params"},
+		{action: QRFail, args: `{"sqlstate": "42000"}`,
+			err: "sqlstate needs errno"},
+		{action: QRFail, args: `{"errno": 70000}`,
+			err: "errno must be in [0, 65535], got 70000"},
+		{action: QRFailRetry, args: `{"code": "BUSY"}`,
+			err: `code must be CANCELED, UNKNOWN, INVALID_ARGUMENT, DEADLINE_EXCEEDED, NOT_FOUND, ALREADY_EXISTS, PERMISSION_DENIED, RESOURCE_EXHAUSTED, FAILED_PRECONDITION, ABORTED, OUT_OF_RANGE, UNIMPLEMENTED, INTERNAL, UNAVAILABLE, DATA_LOSS, UNAUTHENTICATED, CLUSTER_EVENT or READ_ONLY, got "BUSY"`},
+		{action: QRSleep, args: `{"duration": "soon"}`,
+			err: `duration must be a duration, like 2s, got "soon"`},
+		{action: QRSleep, args: `{"jitter": "1s"}`,
+			err: "the param duration is required"},
+		{action: QRKill, args: `{"after": 5}`,
+			err: "after must be a duration, like 2s, got 5"},
+		{action: QRKill, args: `{"after": "5s", "kill_connection": "yes"}`,
+			err: `kill_connection must be true or false, got "yes"`},
+		{action: QRSample, args: `{"percentage": 0, "file": "/tmp/samples"}`,
+			err: "percentage must be in (0, 100], got 0"},
+		{action: QRAudit, args: `{"file": "/tmp/audit", "url": "http://audit"}`,
+			err: "exactly one of file and url is expected"},
+		{action: QRReadOnlyGuard, args: `{"statements": ["INSERT", "SELECT"]}`,
+			err: `statements[1] must be INSERT, REPLACE, UPDATE, DELETE or DDL, got "SELECT"`},
+		{action: QRRetryWithBackoff, args: `{"backoff": "2s", "max_backoff": "1s"}`,
+			err: "backoff can't be above max_backoff"},
+		{action: QRDataMasking, args: `{"columns": [{"mode": "redact"}]}`,
+			err: "the param columns[0].name is required"},
+		{action: QRStop, args: `{"now": true}`,
+			err: "unknown param now, expected no param"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.action.ToString()+" "+tc.args, func(t *testing.T) {
+			err := ValidateActionArgs(tc.action, tc.args)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, "stringParams: "+tc.args+" is invalid: "+tc.err)
+		})
+	}
+}
+
+func TestActionSchemas(t *testing.T) {
+	schemas := ActionSchemas()
+	require.NotEmpty(t, schemas)
+	for i, schema := range schemas {
+		if i > 0 {
+			assert.Less(t, schemas[i-1].Action, schema.Action)
+		}
+		for _, p := range schema.Params {
+			assert.NotEmpty(t, p.Description, "%s %s", schema.Action.ToString(), p.Name)
+		}
+	}
+	_, ok := QRBuffer.Schema()
+	assert.False(t, ok)
+
+	schema, ok := QRCacheResult.Schema()
+	require.True(t, ok)
+	data, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"action": "CACHE_RESULT", "description": "Caches the results of the SELECT queries.", "params": [
+		{"name": "ttl", "type": "duration", "description": "The time the results are served from the cache.", "required": true, "min": 0, "exclusive_min": true},
+		{"name": "max_size", "type": "integer", "description": "The memory of the cached results, in bytes.", "default": "16777216", "min": 0}]}`, string(data))
+	assert.Equal(t, "> 0s", schema.Params[0].Range())
+
+	schema, _ = QRSample.Schema()
+	assert.Equal(t, "in (0, 100]", schema.Params[0].Range())
+	assert.Equal(t, "", schema.Params[1].Range())
+}
+
+func TestRuleValidateActionArgs(t *testing.T) {
+	qr := NewActiveQueryRule("", "r1", QRAutoLimit)
+	qr.SetActionArgs(`{"max_rows": 0}`)
+	assert.EqualError(t, qr.ValidateActionArgs(), `stringParams: {"max_rows": 0} is invalid: max_rows must be >= 1, got 0`)
+	qr.SetActionArgs(`{"max_rows": 1000}`)
+	assert.NoError(t, qr.ValidateActionArgs())
+}
@@ -0,0 +1,340 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"sort"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// actionSchemas are the schemas of the params of the actions the tablets
+// implement, see the actions of the tablet server, which parse the params.
+var actionSchemas = map[Action]*ActionSchema{
+	QRContinue: {
+		Action:      QRContinue,
+		Description: "Does nothing to the queries.",
+	},
+	QRFail: {
+		Action:      QRFail,
+		Description: "Fails the queries.",
+		Params: []ActionParam{
+			{Name: "errno", Type: ParamInteger, Min: bound(0), Max: bound(65535), Description: "The MySQL error number the clients get."},
+			{Name: "sqlstate", Type: ParamString, Default: "HY000", Description: "The SQLSTATE the clients get, 5 characters like 42000."},
+			{Name: "message", Type: ParamString, Default: "disallowed due to rule: ${description}", Description: "The message of the error, in which ${rule}, ${description} and ${digest} stand for the name and the description of the rule and the digest of the query."},
+		},
+		Constraints: []ActionParamsConstraint{
+			paramNeeds("sqlstate", "errno"),
+		},
+	},
+	QRFailRetry: {
+		Action:      QRFailRetry,
+		Description: "Fails the queries with an error the clients can retry.",
+		Params: []ActionParam{
+			{Name: "code", Type: ParamString, Enum: vtrpcErrorCodes(), Default: "FAILED_PRECONDITION", Description: "The code of the error: vtgate retries FAILED_PRECONDITION and UNAVAILABLE on the other tablets, the others, like RESOURCE_EXHAUSTED, are to be retried later by the clients."},
+			{Name: "retry_after", Type: ParamDuration, Min: bound(0), ExclusiveMin: true, Description: "The delay the error suggests to retry after."},
+		},
+	},
+	QRConcurrencyControl: {
+		Action:      QRConcurrencyControl,
+		Description: "Limits the concurrency of the queries, by template by default: the queries over it wait in a queue.",
+		Params: []ActionParam{
+			{Name: "max_queue_size", Type: ParamInteger, Min: bound(0), Description: "The number of queries running or waiting, over which the queries are rejected; 0 for no limit."},
+			{Name: "max_concurrency", Type: ParamInteger, Min: bound(0), Description: "The number of queries running at once."},
+			{Name: "group_by", Type: ParamString, Enum: []string{"user", "client_ip", "bind_var"}, Description: "What the queries of a template are grouped in queues by."},
+			{Name: "bind_var", Type: ParamString, Description: "The bind variable the queries are grouped by."},
+			{Name: "fair_by", Type: ParamString, Enum: []string{"user", "client_ip"}, Description: "What the waiting queries are admitted in turn by."},
+			{Name: "pool", Type: ParamString, Description: "The pool whose queue the queries of the rule share with the other rules of the pool."},
+			{Name: "lane_by", Type: ParamString, Enum: []string{"user", "comment"}, Description: "What the waiting queries are put in priority lanes by."},
+			{Name: "lanes", Type: ParamMap, Keys: []string{"high", "normal", "low"}, Items: &ActionParam{Type: ParamList, Items: &ActionParam{Type: ParamString}}, Description: "The users of the lanes."},
+			{Name: "max_queue_wait_ms", Type: ParamInteger, Min: bound(0), Description: "The time the queries wait in the queue at most, in milliseconds; 0 for no limit."},
+			{Name: "adaptive", Type: ParamObject, Description: "Adapts the concurrency to the latency of the queries or to the threads running in MySQL.",
+				Params: []ActionParam{
+					{Name: "target_latency", Type: ParamDuration, Min: bound(0), ExclusiveMin: true, Description: "The latency over which the concurrency decreases."},
+					{Name: "max_threads_running", Type: ParamInteger, Min: bound(0), Description: "The threads running in MySQL over which the concurrency decreases."},
+					{Name: "min_concurrency", Type: ParamInteger, Min: bound(0), Default: "1", Description: "The concurrency the adaptive mode doesn't go below."},
+					{Name: "window", Type: ParamDuration, Min: bound(0), ExclusiveMin: true, Default: "1s", Description: "The window of the latencies."},
+					{Name: "backoff", Type: ParamNumber, Min: bound(0), Max: bound(1), ExclusiveMax: true, Default: "0.9", Description: "The factor the concurrency is decreased by."},
+				},
+				Constraints: []ActionParamsConstraint{
+					paramsAnyOf("target_latency", "max_threads_running"),
+				},
+			},
+		},
+		Constraints: []ActionParamsConstraint{
+			{
+				Description: "max_concurrency must be in [1, max_queue_size] when max_queue_size is set",
+				holds: func(params map[string]any) bool {
+					maxQueueSize, _ := paramNumber(params, "max_queue_size")
+					maxConcurrency, _ := paramNumber(params, "max_concurrency")
+					return maxQueueSize == 0 || (maxConcurrency >= 1 && maxConcurrency <= maxQueueSize)
+				},
+			},
+			paramNeeds("bind_var", "group_by", "bind_var"),
+			{
+				Description: "group_by bind_var needs bind_var",
+				holds: func(params map[string]any) bool {
+					return params["group_by"] != "bind_var" || isSet(params, "bind_var")
+				},
+			},
+			paramsDiffer("fair_by", "group_by"),
+			paramsExclusive("pool", "group_by"),
+			paramsExclusive("pool", "adaptive"),
+			paramNeeds("lanes", "lane_by"),
+			{
+				Description: "lane_by user needs lanes",
+				holds: func(params map[string]any) bool {
+					return params["lane_by"] != "user" || isSet(params, "lanes")
+				},
+			},
+			paramNeeds("adaptive", "max_queue_size"),
+		},
+	},
+	QRResourceGroup: {
+		Action:      QRResourceGroup,
+		Description: "Puts the queries in a resource group.",
+		Params: []ActionParam{
+			{Name: "group", Type: ParamString, Required: true, Description: "The resource group."},
+		},
+	},
+	QRThrottle: {
+		Action:      QRThrottle,
+		Description: "Fails the queries while the throttler of the tablet throttles the checks of an app.",
+		Params: []ActionParam{
+			{Name: "app", Type: ParamString, Default: "the name of the rule", Description: "The app name of the checks."},
+			{Name: "check", Type: ParamString, Enum: []string{"shard", "self"}, Default: "shard on the primary, self on the others", Description: "Whether to check the metric of the shard or of the tablet."},
+			{Name: "low_priority", Type: ParamBoolean, Description: "Whether the checks are of a low priority."},
+		},
+	},
+	QRSleep: {
+		Action:      QRSleep,
+		Description: "Delays the queries, to inject latency.",
+		Params: []ActionParam{
+			{Name: "duration", Type: ParamDuration, Required: true, Min: bound(0), Description: "The delay."},
+			{Name: "jitter", Type: ParamDuration, Min: bound(0), Description: "The upper bound of a random delay added to the delay."},
+		},
+	},
+	QRRewrite: {
+		Action:      QRRewrite,
+		Description: "Rewrites the queries with a regexp.",
+		Params: []ActionParam{
+			{Name: "pattern", Type: ParamString, Required: true, Description: "The regexp of the parts of the queries to replace."},
+			{Name: "replacement", Type: ParamString, Description: "The replacement of the matches, in which $1 or ${name} stand for their groups."},
+		},
+	},
+	QRRedirect: {
+		Action:      QRRedirect,
+		Description: "Redirects the queries from a table to another one.",
+		Params: []ActionParam{
+			{Name: "from", Type: ParamString, Required: true, Captures: true, Description: "The table, db.table or table, the queries are redirected from, in which ${name} stands for a capture of the rule."},
+			{Name: "to", Type: ParamString, Required: true, Captures: true, Description: "The table, db.table or table, the queries are redirected to, in which ${name} stands for a capture of the rule, like archive_${suffix}."},
+		},
+	},
+	QRCacheResult: {
+		Action:      QRCacheResult,
+		Description: "Caches the results of the SELECT queries.",
+		Params: []ActionParam{
+			{Name: "ttl", Type: ParamDuration, Required: true, Min: bound(0), ExclusiveMin: true, Description: "The time the results are served from the cache."},
+			{Name: "max_size", Type: ParamInteger, Min: bound(0), Default: "16777216", Description: "The memory of the cached results, in bytes."},
+		},
+	},
+	QRRateLimit: {
+		Action:      QRRateLimit,
+		Description: "Limits the rate of the queries with a token bucket.",
+		Params: []ActionParam{
+			{Name: "qps", Type: ParamNumber, Required: true, Min: bound(0), ExclusiveMin: true, Description: "The queries per second."},
+			{Name: "burst", Type: ParamInteger, Min: bound(0), Default: "the qps, rounded up", Description: "The size of the bucket."},
+			{Name: "mode", Type: ParamString, Enum: []string{"reject", "wait"}, Default: "reject", Description: "Whether the queries over the rate are rejected or wait for a token."},
+			{Name: "key", Type: ParamString, Captures: true, Description: "The key of the bucket of the queries, in which ${name} stands for a capture of the rule, like ${tenant}: the queries of each key have a bucket of their own."},
+		},
+	},
+	QRAudit: {
+		Action:      QRAudit,
+		Description: "Records the queries in a file or by posting them to a URL.",
+		Params: []ActionParam{
+			{Name: "file", Type: ParamString, Description: "The file of the records."},
+			{Name: "url", Type: ParamString, Description: "The http or https URL the records are posted to."},
+			{Name: "queue_size", Type: ParamInteger, Min: bound(0), Default: "10000", Description: "The records waiting to be written, over which they are dropped."},
+		},
+		Constraints: []ActionParamsConstraint{
+			paramsExactlyOne("file", "url"),
+		},
+	},
+	QRTimeoutOverride: {
+		Action:      QRTimeoutOverride,
+		Description: "Replaces the query timeout of the tablet.",
+		Params: []ActionParam{
+			{Name: "timeout", Type: ParamDuration, Required: true, Min: bound(0), Description: "The timeout of the queries, 0s for none."},
+			{Name: "kill_on_timeout", Type: ParamBoolean, Default: "true", Description: "Whether the queries are killed in MySQL on timeout."},
+		},
+	},
+	QRSample: {
+		Action:      QRSample,
+		Description: "Records a percentage of the queries, with their plan, in a rotated diagnostics file.",
+		Params: []ActionParam{
+			{Name: "percentage", Type: ParamNumber, Required: true, Min: bound(0), ExclusiveMin: true, Max: bound(100), Description: "The percentage of the queries recorded."},
+			{Name: "file", Type: ParamString, Required: true, Description: "The diagnostics file."},
+			{Name: "max_size", Type: ParamInteger, Min: bound(0), Default: "104857600", Description: "The size of the file before it is rotated, in bytes."},
+			{Name: "max_backups", Type: ParamInteger, Min: bound(0), Default: "3", Description: "The number of rotated files kept."},
+		},
+	},
+	QRMirror: {
+		Action:      QRMirror,
+		Description: "Replays a percentage of the queries on a shadow MySQL server.",
+		Params: []ActionParam{
+			{Name: "percentage", Type: ParamNumber, Required: true, Min: bound(0), ExclusiveMin: true, Max: bound(100), Description: "The percentage of the queries replayed."},
+			{Name: "target", Type: ParamString, Description: "The host:port of the shadow server."},
+			{Name: "socket", Type: ParamString, Description: "The unix socket of the shadow server."},
+			{Name: "user", Type: ParamString, Description: "The user of the shadow server."},
+			{Name: "password", Type: ParamString, Description: "The password of the user."},
+			{Name: "database", Type: ParamString, Description: "The database the queries run in."},
+			{Name: "concurrency", Type: ParamInteger, Min: bound(0), Default: "2", Description: "The number of connections to the shadow server."},
+		},
+		Constraints: []ActionParamsConstraint{
+			paramsExactlyOne("target", "socket"),
+		},
+	},
+	QRDegrade: {
+		Action:      QRDegrade,
+		Description: "Answers the queries with an empty or a static result, and a warning, instead of executing them.",
+		Params: []ActionParam{
+			{Name: "fields", Type: ParamList, Description: "The fields of the result.",
+				Items: &ActionParam{Type: ParamObject, Params: []ActionParam{
+					{Name: "name", Type: ParamString, Description: "The name of the field."},
+					{Name: "type", Type: ParamString, Default: "VARCHAR", Description: "The type of the field, like INT64."},
+				}},
+			},
+			{Name: "rows", Type: ParamList, Items: &ActionParam{Type: ParamList, Items: &ActionParam{Type: ParamString}}, Description: "The rows of the result, lists of values as strings, or null."},
+			{Name: "warning", Type: ParamString, Default: "the query was degraded by rule <name>", Description: "The warning of the result."},
+		},
+	},
+	QRReadOnlyGuard: {
+		Action:      QRReadOnlyGuard,
+		Description: "Rejects the writes to the matched tables.",
+		Params: []ActionParam{
+			{Name: "statements", Type: ParamList, Items: &ActionParam{Type: ParamString, Enum: []string{"INSERT", "REPLACE", "UPDATE", "DELETE", "DDL"}, FoldCase: true}, Default: "INSERT, REPLACE, UPDATE and DELETE", Description: "The statements rejected."},
+		},
+	},
+	QRWebhookNotify: {
+		Action:      QRWebhookNotify,
+		Description: "Posts a notification to a webhook for the queries.",
+		Params: []ActionParam{
+			{Name: "url", Type: ParamString, Required: true, Description: "The http or https URL of the webhook."},
+			{Name: "qps", Type: ParamNumber, Min: bound(0), Default: "1", Description: "The notifications per second, over which they are dropped."},
+			{Name: "retries", Type: ParamInteger, Min: bound(0), Default: "3", Description: "The number of times a notification is retried."},
+		},
+	},
+	QRQueryTag: {
+		Action:      QRQueryTag,
+		Description: "Appends a comment with the rule, the caller and the trace of the queries to them.",
+		Params: []ActionParam{
+			{Name: "tags", Type: ParamMap, Items: &ActionParam{Type: ParamString}, Description: "The extra key=value pairs of the comment."},
+		},
+	},
+	QRCircuitBreaker: {
+		Action:      QRCircuitBreaker,
+		Description: "Rejects the queries for a cool-down once too many of them fail, or are too slow.",
+		Params: []ActionParam{
+			{Name: "error_rate", Type: ParamNumber, Min: bound(0), Max: bound(100), Default: "50", Description: "The percentage of the queries which fail, from which the circuit opens."},
+			{Name: "latency", Type: ParamDuration, Min: bound(0), ExclusiveMin: true, Description: "The latency over which the queries fail."},
+			{Name: "min_requests", Type: ParamInteger, Min: bound(0), Default: "20", Description: "The number of queries of a window below which the circuit stays closed."},
+			{Name: "window", Type: ParamDuration, Min: bound(0), ExclusiveMin: true, Default: "10s", Description: "The window in which the failures are counted."},
+			{Name: "cool_down", Type: ParamDuration, Min: bound(0), ExclusiveMin: true, Default: "30s", Description: "The time an open circuit rejects the queries."},
+			{Name: "half_open_requests", Type: ParamInteger, Min: bound(0), Default: "1", Description: "The number of probe queries after the cool-down."},
+		},
+	},
+	QRPriority: {
+		Action:      QRPriority,
+		Description: "Puts the queries in a priority class, whose weight sets its share of the execution slots under load.",
+		Params: []ActionParam{
+			{Name: "class", Type: ParamString, Required: true, Description: "The priority class."},
+			{Name: "weight", Type: ParamInteger, Min: bound(0), Default: "1", Description: "The weight of the class."},
+		},
+	},
+	QRDataMasking: {
+		Action:      QRDataMasking,
+		Description: "Masks columns of the results.",
+		Params: []ActionParam{
+			{Name: "columns", Type: ParamList, Required: true, Description: "The masked columns.",
+				Items: &ActionParam{Type: ParamObject, Params: []ActionParam{
+					{Name: "name", Type: ParamString, Required: true, Description: "The name of the column."},
+					{Name: "mode", Type: ParamString, Enum: []string{"redact", "partial", "hash"}, FoldCase: true, Default: "redact", Description: "Whether the values are replaced by ****, all but their last characters by *, or by their hex SHA-256."},
+					{Name: "keep_last", Type: ParamInteger, Min: bound(0), Default: "4", Description: "The number of characters the partial mode keeps."},
+					{Name: "salt", Type: ParamString, Description: "The salt of the hashes."},
+				}},
+			},
+			{Name: "exempt_users", Type: ParamList, Items: &ActionParam{Type: ParamString}, Description: "The users who see the columns unmasked."},
+		},
+	},
+	QRSQLInjectionDetect: {
+		Action:      QRSQLInjectionDetect,
+		Description: "Scores the queries for the patterns of the SQL injections, and logs, warns about or blocks the suspicious ones.",
+		Params: []ActionParam{
+			{Name: "mode", Type: ParamString, Enum: []string{"observe", "warn", "block"}, FoldCase: true, Default: "observe", Description: "What is done to the suspicious queries."},
+			{Name: "threshold", Type: ParamInteger, Min: bound(0), Default: "50", Description: "The score from which a query is suspicious."},
+		},
+	},
+	QRAutoLimit: {
+		Action:      QRAutoLimit,
+		Description: "Caps the rows of the SELECT queries.",
+		Params: []ActionParam{
+			{Name: "max_rows", Type: ParamInteger, Required: true, Min: bound(1), Description: "The rows returned at most."},
+		},
+	},
+	QRKill: {
+		Action:      QRKill,
+		Description: "Kills the queries which run too long.",
+		Params: []ActionParam{
+			{Name: "after", Type: ParamDuration, Required: true, Min: bound(0), ExclusiveMin: true, Description: "The time after which the queries are killed."},
+			{Name: "kill_connection", Type: ParamBoolean, Description: "Whether the connection of the queries is killed too."},
+		},
+	},
+	QRPlugin: {
+		Action:      QRPlugin,
+		Description: "Calls the hooks of a WASM plugin before and after the queries.",
+		Params: []ActionParam{
+			{Name: "plugin", Type: ParamString, Required: true, Description: "The plugin, as name@version, or as name for its current version."},
+			{Name: "fuel", Type: ParamInteger, Min: bound(0), Description: "Lowers the fuel of the calls, the number of function calls and loop iterations they run at most, set by --wasm_plugin_fuel."},
+			{Name: "max_memory_pages", Type: ParamInteger, Min: bound(0), Max: bound(65536), Description: "Lowers the number of 64 KiB pages the memory of the plugin grows to, set by --wasm_plugin_max_memory_pages."},
+			{Name: "timeout", Type: ParamDuration, Min: bound(0), Description: "Lowers the wall-clock time of the calls, set by --wasm_plugin_timeout."},
+			{Name: "on_limit", Type: ParamString, Enum: []string{"fail", "continue"}, Default: "--wasm_plugin_on_limit of the tablet", Description: "Whether a query whose call hits a limit fails with RESOURCE_EXHAUSTED, or skips the plugin."},
+		},
+	},
+	QRRetryWithBackoff: {
+		Action:      QRRetryWithBackoff,
+		Description: "Retries the statements which fail with a transient MySQL error.",
+		Params: []ActionParam{
+			{Name: "attempts", Type: ParamInteger, Min: bound(1), Default: "3", Description: "The number of retries."},
+			{Name: "backoff", Type: ParamDuration, Min: bound(0), Default: "10ms", Description: "The wait before the first retry, doubled before each next one."},
+			{Name: "max_backoff", Type: ParamDuration, Min: bound(0), Default: "1s", Description: "The longest wait between two retries."},
+			{Name: "errors", Type: ParamList, Items: &ActionParam{Type: ParamString, Enum: []string{"deadlock", "lock_wait_timeout", "connection"}}, Default: "all", Description: "The kinds of the errors retried."},
+		},
+		Constraints: []ActionParamsConstraint{
+			paramNotAbove("backoff", "max_backoff"),
+		},
+	},
+	QRStop: {
+		Action:      QRStop,
+		Description: "Lets the queries run without the actions of the rules after the rule.",
+	},
+}
+
+// vtrpcErrorCodes returns the names of the vtrpc codes of the errors, in the
+// order of the codes.
+func vtrpcErrorCodes() []string {
+	codes := make([]int, 0, len(vtrpcpb.Code_name))
+	for code := range vtrpcpb.Code_name {
+		if code != int32(vtrpcpb.Code_OK) {
+			codes = append(codes, int(code))
+		}
+	}
+	sort.Ints(codes)
+	names := make([]string, 0, len(codes))
+	for _, code := range codes {
+		names = append(names, vtrpcpb.Code_name[int32(code)])
+	}
+	return names
+}
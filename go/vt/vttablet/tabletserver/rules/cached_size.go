@@ -125,7 +125,7 @@ func (cached *namedRegexp) CachedSize(alloc bool) int64 {
 	}
 	size := int64(0)
 	if alloc {
-		size += int64(24)
+		size += int64(32)
 	}
 	// field name string
 	size += hack.RuntimeAllocSize(int64(len(cached.name)))
@@ -0,0 +1,131 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// The named groups of the query and comment regexps of a rule, like the
+// suffix of
+//
+//	select .* from orders_(?P<suffix>\d+).*
+//
+// are its captures: ${suffix} stands for what the group matched in the params
+// of the action which take captures, see ActionParam.Captures, so that one
+// rule covers a family of queries. The captures of the query regexp are the
+// ones of the normalized query the plan of the query is built for, those of
+// the comment regexps the ones of the comments of each query. The groups which
+// matched nothing capture "", and the negated regexps, see newNamedRegexp,
+// capture nothing.
+
+// captureRef matches the references to the captures, like ${suffix}.
+var captureRef = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// captures adds the named groups of the regexp which match s to captures.
+func (nr namedRegexp) captures(s string, captures map[string]string) {
+	if nr.Regexp == nil || nr.negated {
+		return
+	}
+	match := nr.FindStringSubmatch(s)
+	for i, name := range nr.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if match == nil {
+			captures[name] = ""
+		} else {
+			captures[name] = match[i]
+		}
+	}
+}
+
+// Captures returns the captures of the rule for a query with marginComments,
+// by name. The rule is one FilterByPlan returned, which has the captures of
+// the query.
+func (qr *Rule) Captures(marginComments sqlparser.MarginComments) map[string]string {
+	captures := make(map[string]string, len(qr.captures))
+	for name, value := range qr.captures {
+		captures[name] = value
+	}
+	qr.leadingComment.captures(marginComments.Leading, captures)
+	qr.trailingComment.captures(marginComments.Trailing, captures)
+	return captures
+}
+
+// CaptureNames returns the names of the captures of the rule, sorted.
+func (qr *Rule) CaptureNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, nr := range []namedRegexp{qr.query, qr.leadingComment, qr.trailingComment} {
+		if nr.Regexp != nil && !nr.negated {
+			for _, name := range nr.SubexpNames() {
+				add(name)
+			}
+		}
+	}
+	for name := range qr.captures {
+		add(name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpandCaptures replaces the references to the captures in s, like
+// ${suffix}, by their values. The references to the names which aren't
+// captures are kept.
+func ExpandCaptures(s string, captures map[string]string) string {
+	return captureRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if value, ok := captures[ref[2:len(ref)-1]]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// HasCaptureRefs returns whether s references captures.
+func HasCaptureRefs(s string) bool {
+	return captureRef.MatchString(s)
+}
+
+// ValidateCaptureRefs checks that the params of the action args which take
+// captures only reference the captures of the rule.
+func (qr *Rule) ValidateCaptureRefs() error {
+	schema, ok := qr.act.Schema()
+	if !ok || qr.actionArgs == "" {
+		return nil
+	}
+	var params map[string]any
+	if err := json.Unmarshal([]byte(qr.actionArgs), &params); err != nil {
+		return nil
+	}
+	names := qr.CaptureNames()
+	for _, p := range schema.Params {
+		value, ok := params[p.Name].(string)
+		if !p.Captures || !ok {
+			continue
+		}
+		for _, ref := range captureRef.FindAllStringSubmatch(value, -1) {
+			if i := sort.SearchStrings(names, ref[1]); i == len(names) || names[i] != ref[1] {
+				return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "stringParams: %s is invalid: the param %s references ${%s}, which isn't a named group of the query or comment regexps of the rule", qr.actionArgs, p.Name, ref[1])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+)
+
+func TestCaptures(t *testing.T) {
+	qr := NewActiveQueryRule("", "archive", QRRedirect)
+	require.NoError(t, qr.SetQueryCond(`select .* from orders_(?P<suffix>\d+)(?P<archived>_old)?.*`))
+	require.NoError(t, qr.SetLeadingCommentCond(`.*tenant=(?P<tenant>\w+).*`))
+	assert.Equal(t, []string{"archived", "suffix", "tenant"}, qr.CaptureNames())
+	qrs := New()
+	qrs.Add(qr)
+
+	filtered := qrs.FilterByPlan("select * from orders_2023 where id = :id", planbuilder.PlanSelect, "db.orders_2023").Find("archive")
+	require.NotNil(t, filtered)
+	assert.Equal(t, []string{"archived", "suffix", "tenant"}, filtered.CaptureNames())
+	// The groups which match nothing capture "".
+	assert.Equal(t, map[string]string{"suffix": "2023", "archived": "", "tenant": "acme"},
+		filtered.Captures(sqlparser.MarginComments{Leading: "/* tenant=acme */ "}))
+	assert.Equal(t, map[string]string{"suffix": "2023", "archived": "", "tenant": ""}, filtered.Captures(sqlparser.MarginComments{}))
+	// The captures of a plan are its own.
+	other := qrs.FilterByPlan("select * from orders_2022_old", planbuilder.PlanSelect, "db.orders_2022_old").Find("archive")
+	assert.Equal(t, map[string]string{"suffix": "2022", "archived": "_old", "tenant": ""}, other.Captures(sqlparser.MarginComments{}))
+	assert.Equal(t, "2023", filtered.Captures(sqlparser.MarginComments{})["suffix"])
+
+	captures := map[string]string{"suffix": "2023", "tenant": ""}
+	assert.Equal(t, "archive_2023", ExpandCaptures("archive_${suffix}", captures))
+	assert.Equal(t, "t_", ExpandCaptures("t_${tenant}", captures))
+	assert.Equal(t, "t_${other}", ExpandCaptures("t_${other}", captures))
+	assert.True(t, HasCaptureRefs("archive_${suffix}"))
+	assert.False(t, HasCaptureRefs("archive_$suffix"))
+}
+
+func TestValidateCaptureRefs(t *testing.T) {
+	qr := NewActiveQueryRule("", "archive", QRRedirect)
+	require.NoError(t, qr.SetQueryCond(`select .* from orders_(?P<suffix>\d+).*`))
+	qr.SetActionArgs(`{"from": "orders_${suffix}", "to": "archive_${suffix}"}`)
+	assert.NoError(t, qr.ValidateActionArgs())
+
+	qr.SetActionArgs(`{"from": "orders_${suffix}", "to": "archive_${year}"}`)
+	assert.EqualError(t, qr.ValidateActionArgs(), `stringParams: {"from": "orders_${suffix}", "to": "archive_${year}"} is invalid: the param to references ${year}, which isn't a named group of the query or comment regexps of the rule`)
+
+	// The params which don't take captures are kept as they are.
+	limit := NewActiveQueryRule("", "limit", QRRateLimit)
+	limit.SetActionArgs(`{"qps": 10, "key": "${tenant}", "mode": "${mode}"}`)
+	assert.EqualError(t, limit.ValidateCaptureRefs(), `stringParams: {"qps": 10, "key": "${tenant}", "mode": "${mode}"} is invalid: the param key references ${tenant}, which isn't a named group of the query or comment regexps of the rule`)
+	require.NoError(t, limit.SetTrailingCommentCond(`.*tenant=(?P<tenant>\w+).*`))
+	assert.NoError(t, limit.ValidateCaptureRefs())
+}
@@ -0,0 +1,136 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"sort"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// ConflictPolicy tells which of the rules a query matches apply to it when
+// their actions conflict, like a CONTINUE rule which lets the query through
+// and a FAIL rule which rejects it. The rules a query matches are always
+// evaluated in the order of the action pipeline, see Rule.RunsBefore, so
+// that the priority of the rules decides which one comes first.
+type ConflictPolicy string
+
+const (
+	// ConflictPipeline runs the actions of all the rules a query matches, in
+	// the order of the pipeline, up to the first STOP rule. A CONTINUE rule
+	// doesn't keep the rules after it from rejecting the query. It is the
+	// default policy.
+	ConflictPipeline ConflictPolicy = "pipeline"
+	// ConflictFirstMatch decides the query by the first deciding rule it
+	// matches, a CONTINUE, FAIL or FAIL_RETRY one: the rules after it are
+	// skipped, so that a CONTINUE rule of a smaller priority lets the query
+	// through whatever the rules after it.
+	ConflictFirstMatch ConflictPolicy = "first_match"
+	// ConflictStrictestWins rejects the query by the strictest of the
+	// rejecting rules it matches, FAIL before FAIL_RETRY, whatever their
+	// priority: the CONTINUE and STOP rules don't let the query through, and
+	// only the other rules before the strictest one, like the AUDIT ones,
+	// still run. When no rejecting rule matches, it is ConflictPipeline.
+	ConflictStrictestWins ConflictPolicy = "strictest_wins"
+)
+
+// ParseConflictPolicy returns the conflict policy of a name, ConflictPipeline
+// if it is empty.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(name); policy {
+	case "":
+		return ConflictPipeline, nil
+	case ConflictPipeline, ConflictFirstMatch, ConflictStrictestWins:
+		return policy, nil
+	}
+	return "", vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid conflict policy %q, want %s, %s or %s", name, ConflictPipeline, ConflictFirstMatch, ConflictStrictestWins)
+}
+
+// Resolve returns the rules of matched which apply to a query under the
+// policy. The rules of matched are the ones the query matches, in the order
+// of the pipeline.
+func (p ConflictPolicy) Resolve(matched []*Rule) []*Rule {
+	switch p {
+	case ConflictFirstMatch:
+		for i, qr := range matched {
+			if qr.deciding() {
+				return matched[:i+1]
+			}
+		}
+	case ConflictStrictestWins:
+		var strictest *Rule
+		for _, qr := range matched {
+			if qr.deciding() && strictness(qr.act) > 0 && (strictest == nil || strictness(qr.act) > strictness(strictest.act)) {
+				strictest = qr
+			}
+		}
+		if strictest == nil {
+			return matched
+		}
+		var resolved []*Rule
+		for _, qr := range matched {
+			if qr == strictest {
+				return append(resolved, qr)
+			}
+			if !qr.deciding() && qr.act != QRStop {
+				resolved = append(resolved, qr)
+			}
+		}
+	}
+	return matched
+}
+
+// SortForPipeline sorts rules in the order of the action pipeline, see
+// Rule.RunsBefore, and returns them.
+func SortForPipeline(rules []*Rule) []*Rule {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].RunsBefore(rules[j])
+	})
+	return rules
+}
+
+// deciding returns whether the rule decides whether the query runs, a
+// CONTINUE, FAIL or FAIL_RETRY rule out of dry run and without post execution
+// conditions.
+func (qr *Rule) deciding() bool {
+	if qr.Status == DryRun || qr.outcomeConds != nil {
+		return false
+	}
+	return qr.act == QRContinue || strictness(qr.act) > 0
+}
+
+// strictness ranks the actions which reject the queries, 0 for the other
+// ones.
+func strictness(act Action) int {
+	switch act {
+	case QRFail:
+		return 2
+	case QRFailRetry:
+		return 1
+	}
+	return 0
+}
+
+// ConflictPolicy returns the conflict policy of the rules.
+func (qrs *Rules) ConflictPolicy() ConflictPolicy {
+	if qrs.conflictPolicy == "" {
+		return ConflictPipeline
+	}
+	return qrs.conflictPolicy
+}
+
+// SetConflictPolicy sets the conflict policy of the rules.
+func (qrs *Rules) SetConflictPolicy(policy ConflictPolicy) {
+	qrs.conflictPolicy = policy
+}
+
+// SetConflictPolicy sets the conflict policy of the Rules FilterByPlan
+// returns. The plans built before keep the policy they were built with.
+func (qri *Map) SetConflictPolicy(policy ConflictPolicy) {
+	qri.conflictPolicy.Store(&policy)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	for name, want := range map[string]ConflictPolicy{
+		"":               ConflictPipeline,
+		"pipeline":       ConflictPipeline,
+		"first_match":    ConflictFirstMatch,
+		"strictest_wins": ConflictStrictestWins,
+	} {
+		policy, err := ParseConflictPolicy(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, policy, name)
+
+		// the tablet config accepts the same names at startup.
+		config := tabletenv.NewDefaultConfig()
+		config.RuleConflictPolicy = name
+		assert.NoError(t, config.Verify(), name)
+	}
+	_, err := ParseConflictPolicy("last_match")
+	assert.ErrorContains(t, err, `invalid conflict policy "last_match"`)
+}
+
+func TestConflictPolicyResolve(t *testing.T) {
+	newRule := func(name string, priority int, act Action) *Rule {
+		qr := NewActiveQueryRule("", name, act)
+		qr.SetPriority(priority)
+		return qr
+	}
+	allow := newRule("allow", 10, QRContinue)
+	audit := newRule("audit", 5, QRAudit)
+	stop := newRule("stop", 20, QRStop)
+	retry := newRule("retry", 30, QRFailRetry)
+	deny := newRule("deny", 40, QRFail)
+	dryRunDeny := newRule("dry_run_deny", 1, QRFail)
+	dryRunDeny.SetStatus(DryRun)
+
+	names := func(rules []*Rule) []string {
+		var names []string
+		for _, qr := range rules {
+			names = append(names, qr.Name)
+		}
+		return names
+	}
+	for _, tcase := range []struct {
+		policy  ConflictPolicy
+		matched []*Rule
+		want    []string
+	}{{
+		policy:  ConflictPipeline,
+		matched: []*Rule{audit, allow, stop, retry, deny},
+		want:    []string{"audit", "allow", "stop", "retry", "deny"},
+	}, {
+		policy:  ConflictFirstMatch,
+		matched: []*Rule{dryRunDeny, audit, allow, stop, retry, deny},
+		want:    []string{"dry_run_deny", "audit", "allow"},
+	}, {
+		policy:  ConflictFirstMatch,
+		matched: []*Rule{audit, retry, deny},
+		want:    []string{"audit", "retry"},
+	}, {
+		policy:  ConflictFirstMatch,
+		matched: []*Rule{audit, stop},
+		want:    []string{"audit", "stop"},
+	}, {
+		policy:  ConflictStrictestWins,
+		matched: []*Rule{dryRunDeny, audit, allow, stop, retry, deny},
+		want:    []string{"dry_run_deny", "audit", "deny"},
+	}, {
+		policy:  ConflictStrictestWins,
+		matched: []*Rule{allow, retry},
+		want:    []string{"retry"},
+	}, {
+		policy:  ConflictStrictestWins,
+		matched: []*Rule{dryRunDeny, audit, allow, stop},
+		want:    []string{"dry_run_deny", "audit", "allow", "stop"},
+	}} {
+		assert.Equal(t, tcase.want, names(tcase.policy.Resolve(tcase.matched)), "%s %v", tcase.policy, names(tcase.matched))
+	}
+}
+
+func TestGetActionRuleConflictPolicy(t *testing.T) {
+	qrs := New()
+	lowDeny := NewActiveQueryRule("", "low_deny", QRFailRetry)
+	lowDeny.SetPriority(30)
+	qrs.Add(lowDeny)
+	deny := NewActiveQueryRule("", "deny", QRFail)
+	deny.SetPriority(20)
+	qrs.Add(deny)
+	allow := NewActiveQueryRule("", "allow", QRContinue)
+	allow.SetPriority(10)
+	require.NoError(t, allow.SetUserCond("admin"))
+	qrs.Add(allow)
+
+	for _, tcase := range []struct {
+		policy ConflictPolicy
+		user   string
+		want   Action
+		rule   string
+	}{
+		{policy: ConflictPipeline, user: "admin", want: QRFail, rule: "deny"},
+		{policy: ConflictFirstMatch, user: "admin", want: QRContinue},
+		{policy: ConflictFirstMatch, user: "app", want: QRFail, rule: "deny"},
+		{policy: ConflictStrictestWins, user: "admin", want: QRFail, rule: "deny"},
+	} {
+		m := NewMap()
+		m.RegisterSource("test")
+		require.NoError(t, m.SetRules("test", qrs))
+		m.SetConflictPolicy(tcase.policy)
+		plan := m.FilterByPlan("select * from t", planbuilder.PlanSelect, "t")
+		assert.Equal(t, tcase.policy, plan.ConflictPolicy())
+		assert.Equal(t, tcase.policy, plan.Copy().ConflictPolicy())
+		action, rule := plan.GetActionRule("", tcase.user, "", false, nil, sqlparser.MarginComments{})
+		assert.Equal(t, tcase.want, action, "%s %s", tcase.policy, tcase.user)
+		if tcase.rule == "" {
+			assert.Nil(t, rule, "%s %s", tcase.policy, tcase.user)
+		} else if assert.NotNil(t, rule, "%s %s", tcase.policy, tcase.user) {
+			assert.Equal(t, tcase.rule, rule.Name, "%s %s", tcase.policy, tcase.user)
+		}
+	}
+	assert.Equal(t, ConflictPipeline, New().ConflictPolicy())
+}
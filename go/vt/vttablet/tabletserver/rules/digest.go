@@ -0,0 +1,52 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// digestLength is the number of hex digits of a digest.
+const digestLength = 8
+
+// Digest returns the digest of a query, as the tablets get it from vtgate,
+// normalized and without its margin comments. It is the digest the actions
+// report, like in the ${digest} of the messages of FAIL and in the webhook
+// notifications.
+func Digest(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])[:digestLength]
+}
+
+// SetQueryDigestCond makes the rule match the queries of a digest, see
+// Digest, which targets one statement without having to write a regexp of
+// it.
+func (qr *Rule) SetQueryDigestCond(digest string) error {
+	if digest != "" {
+		digest = strings.ToLower(digest)
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != digestLength {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid query digest %q, want %d hex digits", digest, digestLength)
+		}
+	}
+	qr.queryDigest = digest
+	qr.invalidate()
+	return nil
+}
+
+// queryDigest returns the digest of the query of in, computing it once for
+// all the rules.
+func (in *evalInput) queryDigest() string {
+	if in.digest == "" {
+		in.digest = Digest(in.query)
+	}
+	return in.digest
+}
@@ -0,0 +1,49 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+)
+
+func TestQueryDigestCond(t *testing.T) {
+	const query = "select * from t where id = :id"
+	assert.Equal(t, "e94bc0ce", Digest(query))
+
+	qrs := New()
+	qr := NewActiveQueryRule("", "one_select", QRFail)
+	require.NoError(t, qr.SetQueryDigestCond("E94BC0CE"))
+	qrs.Add(qr)
+	other := NewActiveQueryRule("", "other_select", QRFail)
+	require.NoError(t, other.SetQueryDigestCond(Digest("select * from t")))
+	qrs.Add(other)
+
+	var names []string
+	qrs.FilterByPlan(query, planbuilder.PlanSelect, "db.t").ForEachRule(func(qr *Rule) {
+		names = append(names, qr.Name)
+	})
+	assert.Equal(t, []string{"one_select"}, names)
+	assert.Nil(t, qr.FilterByPlan("select * from t where id = :vtg1", planbuilder.PlanSelect, []string{"db.t"}))
+	assert.True(t, qrs.Copy().Equal(qrs))
+
+	for _, digest := range []string{"e94bc0c", "e94bc0cez", "e94bc0ce00"} {
+		assert.ErrorContains(t, qr.SetQueryDigestCond(digest), "want 8 hex digits", digest)
+	}
+
+	qr, err := BuildQueryRule(map[string]any{"Name": "one_select", "QueryDigest": "e94bc0ce"})
+	require.NoError(t, err)
+	assert.NotNil(t, qr.FilterByPlan(query, planbuilder.PlanSelect, []string{"db.t"}))
+	data, err := qr.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"QueryDigest":"e94bc0ce"`)
+	_, err = BuildQueryRule(map[string]any{"Name": "one_select", "QueryDigest": "select"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"time"
+)
+
+// ExpiresAtLayout is the layout of the expires_at column of the rules, a UTC
+// datetime.
+const ExpiresAtLayout = "2006-01-02 15:04:05"
+
+// SetExpiresAt sets the time the rule expires at, when it stops matching the
+// queries, like the emergency rules of an incident which mustn't outlive it.
+// A zero time never expires.
+func (qr *Rule) SetExpiresAt(expiresAt time.Time) {
+	qr.expiresAt = expiresAt
+}
+
+// ExpiresAt returns the time the rule expires at, the zero time if it never
+// expires.
+func (qr *Rule) ExpiresAt() time.Time {
+	return qr.expiresAt
+}
+
+// Expired returns whether the rule expired at t.
+func (qr *Rule) Expired(t time.Time) bool {
+	return !qr.expiresAt.IsZero() && !t.Before(qr.expiresAt)
+}
+
+// parseExpiresAt parses the RFC 3339 time a rule expires at, the zero time if
+// it is empty.
+func parseExpiresAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
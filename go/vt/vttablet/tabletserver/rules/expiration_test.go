@@ -0,0 +1,59 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestRuleExpiration(t *testing.T) {
+	qr := NewActiveQueryRule("", "emergency", QRFail)
+	assert.False(t, qr.Expired(time.Now()))
+	assert.Equal(t, QRFail, qr.GetAction("", "", "", false, nil, sqlparser.MarginComments{}))
+
+	qr.SetExpiresAt(time.Now().Add(time.Hour))
+	assert.Equal(t, QRFail, qr.GetAction("", "", "", false, nil, sqlparser.MarginComments{}))
+	assert.True(t, qr.Expired(qr.ExpiresAt()))
+
+	qr.SetExpiresAt(time.Now().Add(-time.Second))
+	assert.True(t, qr.Expired(time.Now()))
+	assert.Equal(t, QRContinue, qr.GetAction("", "", "", false, nil, sqlparser.MarginComments{}))
+	assert.False(t, qr.MatchesExecutionInfo("", "", "", false, nil, sqlparser.MarginComments{}))
+}
+
+func TestBuildQueryRuleExpiresAt(t *testing.T) {
+	qr, err := BuildQueryRule(map[string]any{"Name": "emergency", "ExpiresAt": "2026-10-14T20:30:00+08:00"})
+	require.NoError(t, err)
+	assert.True(t, qr.ExpiresAt().Equal(time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC)))
+
+	data, err := qr.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"ExpiresAt":"2026-10-14T12:30:00Z"`)
+	bindVars, err := qr.ToBindVariable()
+	require.NoError(t, err)
+	assert.Equal(t, sqltypes.StringBindVariable("2026-10-14 12:30:00"), bindVars["expires_at"])
+
+	assert.True(t, qr.Copy().Equal(qr))
+	other := qr.Copy()
+	other.SetExpiresAt(time.Time{})
+	assert.False(t, other.Equal(qr))
+	bindVars, err = other.ToBindVariable()
+	require.NoError(t, err)
+	assert.Equal(t, sqltypes.NullBindVariable, bindVars["expires_at"])
+
+	qr, err = BuildQueryRule(map[string]any{"Name": "forever", "ExpiresAt": ""})
+	require.NoError(t, err)
+	assert.True(t, qr.ExpiresAt().IsZero())
+	_, err = BuildQueryRule(map[string]any{"Name": "emergency", "ExpiresAt": "tomorrow"})
+	assert.ErrorContains(t, err, "could not set ExpiresAt")
+}
@@ -0,0 +1,86 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// ExplainSession is the session of a query which Explain matches against the
+// rules.
+type ExplainSession struct {
+	Database      string
+	IP            string
+	User          string
+	WorkloadClass string
+	InTransaction bool
+	BindVars      map[string]*querypb.BindVariable
+}
+
+// Explanation is what Explain found out about a query.
+type Explanation struct {
+	Plan   planbuilder.PlanType
+	Tables []string
+	// Digest is the digest of the normalized query, which the query_digest
+	// of the rules match.
+	Digest string
+	// Rules are the rules the query matches, in the order the tablets apply
+	// their actions, resolved by the conflict policy of the rules.
+	Rules []*Rule
+}
+
+// Explain matches a query against the rules like a tablet would, without
+// executing it. The query is normalized like vtgate does with the default
+// --normalize_queries, its literals bound as bind variables. Its plan is
+// built without the schema of the tables, so the plans which depend on it,
+// like the ones of the selects of sequences, may differ. The access
+// conditions of the rules, see AccessConds, aren't evaluated without MySQL:
+// the rules which have them are taken to match.
+func (qrs *Rules) Explain(sql string, session *ExplainSession) (*Explanation, error) {
+	query, comments := sqlparser.SplitMarginComments(sql)
+	stmt, reserved, err := sqlparser.Parse2(query)
+	if err != nil {
+		return nil, err
+	}
+	bindVars := make(map[string]*querypb.BindVariable, len(session.BindVars))
+	for name, bv := range session.BindVars {
+		bindVars[name] = bv
+	}
+	if sqlparser.CanNormalize(stmt) {
+		if err := sqlparser.Normalize(stmt, sqlparser.NewReservedVars("vtg", reserved), bindVars); err != nil {
+			return nil, err
+		}
+		query = sqlparser.String(stmt)
+	}
+	plan, err := planbuilder.Build(stmt, map[string]*schema.Table{}, session.Database, false)
+	if err != nil {
+		return nil, err
+	}
+	explanation := &Explanation{Plan: plan.PlanID, Tables: plan.TableNames(), Digest: Digest(query)}
+	var matched []*Rule
+	qrs.FilterByPlan(query, plan.PlanID, plan.TableNames()...).ForEachRule(func(qr *Rule) {
+		if qr.Status == InActive {
+			return
+		}
+		if qr.MatchesExecutionInfo(session.IP, session.User, session.WorkloadClass, session.InTransaction, bindVars, comments) {
+			matched = append(matched, qr)
+		}
+	})
+	policy := qrs.ConflictPolicy()
+	for _, qr := range policy.Resolve(SortForPipeline(matched)) {
+		// The CONTINUE rules do nothing, they only show under first_match,
+		// which lets the queries through by them.
+		if qr.Act() == QRContinue && policy != ConflictFirstMatch {
+			continue
+		}
+		explanation.Rules = append(explanation.Rules, qr)
+	}
+	return explanation, nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestExplain(t *testing.T) {
+	noDeletes := NewActiveQueryRule("", "no_deletes", QRFail)
+	noDeletes.SetPriority(20)
+	noDeletes.AddPlanCond(planbuilder.PlanDelete)
+	bigIDs := NewActiveQueryRule("", "big_ids", QRFail)
+	bigIDs.SetPriority(30)
+	require.NoError(t, bigIDs.AddBindVarCond("id", false, true, QRGreaterThan, int64(100)))
+	adminOnly := NewActiveQueryRule("", "admin_only", QRFail)
+	adminOnly.SetPriority(10)
+	require.NoError(t, adminOnly.SetUserCond("admin"))
+	require.NoError(t, adminOnly.SetIPCond(`10\..*`))
+	auditTables := NewActiveQueryRule("", "audit_tables", QRAudit)
+	auditTables.SetPriority(5)
+	auditTables.SetStatus(DryRun)
+	auditTables.AddTableCond("db.t")
+	allowAll := NewActiveQueryRule("", "allow_all", QRContinue)
+	allowAll.SetPriority(1)
+	inactive := NewActiveQueryRule("", "inactive", QRFail)
+	inactive.SetStatus(InActive)
+	qrs := New()
+	qrs.Add(bigIDs)
+	qrs.Add(noDeletes)
+	qrs.Add(adminOnly)
+	qrs.Add(auditTables)
+	qrs.Add(allowAll)
+	qrs.Add(inactive)
+
+	names := func(explanation *Explanation) []string {
+		var names []string
+		for _, qr := range explanation.Rules {
+			names = append(names, qr.Name)
+		}
+		return names
+	}
+	for _, tcase := range []struct {
+		sql     string
+		session ExplainSession
+		plan    planbuilder.PlanType
+		tables  []string
+		matches []string
+	}{{
+		sql:     "select * from t",
+		plan:    planbuilder.PlanSelect,
+		tables:  []string{"db.t"},
+		matches: []string{"audit_tables"},
+	}, {
+		// The literals are bound like vtgate does.
+		sql:     "delete from t where id = 1000",
+		plan:    planbuilder.PlanDelete,
+		tables:  []string{"db.t"},
+		matches: []string{"audit_tables", "no_deletes", "big_ids"},
+	}, {
+		sql:     "delete from u where id = :id",
+		session: ExplainSession{BindVars: map[string]*querypb.BindVariable{"id": sqltypes.Int64BindVariable(1)}},
+		plan:    planbuilder.PlanDelete,
+		tables:  []string{"db.u"},
+		matches: []string{"no_deletes"},
+	}, {
+		sql:     "select * from u",
+		session: ExplainSession{User: "admin", IP: "10.0.0.1"},
+		plan:    planbuilder.PlanSelect,
+		tables:  []string{"db.u"},
+		matches: []string{"admin_only"},
+	}, {
+		sql:     "select * from u",
+		session: ExplainSession{User: "admin", IP: "192.168.0.1"},
+		plan:    planbuilder.PlanSelect,
+		tables:  []string{"db.u"},
+	}} {
+		tcase.session.Database = "db"
+		explanation, err := qrs.Explain(tcase.sql, &tcase.session)
+		require.NoError(t, err, tcase.sql)
+		assert.Equal(t, tcase.plan, explanation.Plan, tcase.sql)
+		assert.Equal(t, tcase.tables, explanation.Tables, tcase.sql)
+		assert.Equal(t, tcase.matches, names(explanation), tcase.sql)
+	}
+
+	// The digest is the one of the normalized query, without its comments.
+	explanation, err := qrs.Explain("/* app */ select * from t where id = 42", &ExplainSession{Database: "db"})
+	require.NoError(t, err)
+	other, err := qrs.Explain("select * from t where id = 7", &ExplainSession{Database: "db"})
+	require.NoError(t, err)
+	assert.Equal(t, other.Digest, explanation.Digest)
+
+	qrs.SetConflictPolicy(ConflictFirstMatch)
+	explanation, err = qrs.Explain("delete from t where id = 1000", &ExplainSession{Database: "db"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"allow_all"}, names(explanation))
+
+	_, err = qrs.Explain("selec * from t", &ExplainSession{})
+	assert.ErrorContains(t, err, "syntax error")
+}
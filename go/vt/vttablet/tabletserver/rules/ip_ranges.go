@@ -0,0 +1,91 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"net/netip"
+	"strings"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// ipRanges is the compiled form of the CIDR conditions of a rule, see
+// AddCIDRCond. It holds for the client IPs which are in one of its ranges, or
+// in any range if it only has excluded ranges, and in none of its excluded
+// ranges. A client without a valid IP never matches.
+type ipRanges struct {
+	included, excluded []netip.Prefix
+}
+
+// parseCIDR parses a CIDR condition: a CIDR range like 10.0.0.0/8 or an IP,
+// excluded if it starts with !.
+func parseCIDR(cidr string) (prefix netip.Prefix, excluded bool, err error) {
+	s, excluded := strings.CutPrefix(strings.TrimSpace(cidr), "!")
+	if strings.Contains(s, "/") {
+		prefix, err = netip.ParsePrefix(s)
+	} else {
+		var addr netip.Addr
+		if addr, err = netip.ParseAddr(s); err == nil {
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+	}
+	if err != nil {
+		return netip.Prefix{}, false, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid CIDR %q, expected a range like 10.0.0.0/8 or an IP, or ! and one of them to exclude it", cidr)
+	}
+	// 10.1.2.3/8 is 10.0.0.0/8.
+	return prefix.Masked(), excluded, nil
+}
+
+func compileIPRanges(cidrs []string) *ipRanges {
+	r := &ipRanges{}
+	for _, cidr := range cidrs {
+		// The conditions are checked when they are added.
+		prefix, excluded, _ := parseCIDR(cidr)
+		if excluded {
+			r.excluded = append(r.excluded, prefix)
+		} else {
+			r.included = append(r.included, prefix)
+		}
+	}
+	return r
+}
+
+// match returns whether the IP of a client address, like 10.0.0.1:5678 or
+// 10.0.0.1, is in the ranges.
+func (r *ipRanges) match(addr string) bool {
+	ip, ok := clientIP(addr)
+	if !ok {
+		return false
+	}
+	for _, prefix := range r.excluded {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	if len(r.included) == 0 {
+		return true
+	}
+	for _, prefix := range r.included {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP of a client address, with or without a port.
+func clientIP(addr string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(addr); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
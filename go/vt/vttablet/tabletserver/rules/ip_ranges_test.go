@@ -0,0 +1,59 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestCIDRCond(t *testing.T) {
+	testcases := []struct {
+		cidrs   []string
+		matched []string
+		missed  []string
+	}{{
+		cidrs:   []string{"10.0.0.0/8", "192.168.1.7"},
+		matched: []string{"10.1.2.3:5678", "10.255.255.255", "192.168.1.7:3306", "[::ffff:10.0.0.1]:5678"},
+		missed:  []string{"11.0.0.1:5678", "192.168.1.8", "", "localhost:5678", "not an ip"},
+	}, {
+		// The clients outside of the application subnets.
+		cidrs:   []string{"!10.0.0.0/8", "!172.16.0.0/12"},
+		matched: []string{"8.8.8.8:5678", "172.32.0.1", "[2001:db8::1]:5678"},
+		missed:  []string{"10.0.0.1:5678", "172.20.1.1", ""},
+	}, {
+		// A subnet but one of its hosts. The host bits of a range are ignored.
+		cidrs:   []string{"10.1.2.3/16", "!10.1.0.1"},
+		matched: []string{"10.1.0.2:5678"},
+		missed:  []string{"10.1.0.1:5678", "10.2.0.1:5678"},
+	}, {
+		cidrs:   []string{"2001:db8::/32"},
+		matched: []string{"[2001:db8::1]:5678", "2001:db8:1::1"},
+		missed:  []string{"[2001:db9::1]:5678", "10.0.0.1:5678"},
+	}}
+	for _, tc := range testcases {
+		qr := NewActiveQueryRule("", "r1", QRFail)
+		for _, cidr := range tc.cidrs {
+			require.NoError(t, qr.AddCIDRCond(cidr))
+		}
+		for _, addr := range tc.matched {
+			assert.Equal(t, QRFail, qr.FilterByExecutionInfo(addr, "", "", false, nil, sqlparser.MarginComments{}), "%v %s", tc.cidrs, addr)
+		}
+		for _, addr := range tc.missed {
+			assert.Equal(t, QRContinue, qr.FilterByExecutionInfo(addr, "", "", false, nil, sqlparser.MarginComments{}), "%v %s", tc.cidrs, addr)
+		}
+	}
+
+	qr := NewActiveQueryRule("", "r1", QRFail)
+	for _, cidr := range []string{"", "!", "10.0.0.0/33", "10.0.0", "!!10.0.0.0/8", "10.0.0.0/8,10.1.0.0/16"} {
+		assert.ErrorContains(t, qr.AddCIDRCond(cidr), "invalid CIDR", cidr)
+	}
+	assert.Nil(t, qr.requestCIDRs)
+}
@@ -0,0 +1,282 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"regexp/syntax"
+	"strings"
+	"sync"
+)
+
+// Most query conditions in real rule sets are plain literals such as
+// `.*from t1.*` or `select .*`. Evaluating them one regexp at a time makes
+// FilterByPlan scale linearly with the number of rules, so Rules compiles the
+// literal part of all such conditions into a single Aho-Corasick automaton and
+// evaluates them in one pass over the query. Conditions that are not literals
+// keep using their regexp.
+
+// literalAnchor tells where a literal must be found in the query.
+type literalAnchor int
+
+const (
+	// anchorNone is for `.*lit.*`: lit can be anywhere in the query.
+	anchorNone literalAnchor = iota
+	// anchorStart is for `lit.*`: the query starts with lit.
+	anchorStart
+	// anchorEnd is for `.*lit`: the query ends with lit.
+	anchorEnd
+	// anchorBoth is for `lit`: the query is lit.
+	anchorBoth
+)
+
+// literalCond is a query condition that can be evaluated without its regexp.
+type literalCond struct {
+	literal string
+	anchor  literalAnchor
+}
+
+// parseLiteralCond returns the literal equivalent of a query condition
+// pattern, or false if the pattern needs a regexp to be evaluated.
+// The pattern is matched exactly, see makeExact.
+func parseLiteralCond(pattern string) (literalCond, bool) {
+	re, err := syntax.Parse(makeExact(pattern), syntax.Perl)
+	if err != nil {
+		return literalCond{}, false
+	}
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) < 3 {
+		return literalCond{}, false
+	}
+	subs := re.Sub
+	if subs[0].Op != syntax.OpBeginText || subs[len(subs)-1].Op != syntax.OpEndText {
+		return literalCond{}, false
+	}
+	subs = subs[1 : len(subs)-1]
+
+	anchor := anchorBoth
+	if len(subs) > 0 && isAnyStar(subs[0]) {
+		anchor = anchorEnd
+		subs = subs[1:]
+	}
+	if len(subs) > 0 && isAnyStar(subs[len(subs)-1]) {
+		if anchor == anchorEnd {
+			anchor = anchorNone
+		} else {
+			anchor = anchorStart
+		}
+		subs = subs[:len(subs)-1]
+	}
+	if len(subs) != 1 || subs[0].Op != syntax.OpLiteral || subs[0].Flags&syntax.FoldCase != 0 {
+		return literalCond{}, false
+	}
+	return literalCond{literal: string(subs[0].Rune), anchor: anchor}, true
+}
+
+func isAnyStar(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpStar && len(re.Sub) == 1 && re.Sub[0].Op == syntax.OpAnyCharNotNL
+}
+
+// queryMatcher evaluates the literal query conditions of a list of rules.
+type queryMatcher struct {
+	// rules and patterns are the rules and query patterns the matcher was
+	// built from, they are used to detect that the rules were modified.
+	rules    []*Rule
+	patterns []string
+
+	// conds[i] is the index of the literal condition of rules[i] in
+	// literals, or -1 if rules[i] has no literal query condition.
+	conds    []int
+	literals []literalCond
+	ac       *ahoCorasick
+}
+
+func newQueryMatcher(rules []*Rule) *queryMatcher {
+	m := &queryMatcher{
+		rules:    append([]*Rule(nil), rules...),
+		patterns: make([]string, len(rules)),
+		conds:    make([]int, len(rules)),
+	}
+	var literals []string
+	for i, qr := range rules {
+		m.patterns[i] = qr.query.name
+		m.conds[i] = -1
+		if qr.query.Regexp == nil {
+			continue
+		}
+		if cond, ok := parseLiteralCond(qr.query.pattern()); ok {
+			m.conds[i] = len(m.literals)
+			m.literals = append(m.literals, cond)
+			literals = append(literals, cond.literal)
+		}
+	}
+	m.ac = newAhoCorasick(literals)
+	return m
+}
+
+// valid returns false if rules is not the list the matcher was built from.
+func (m *queryMatcher) valid(rules []*Rule) bool {
+	if len(rules) != len(m.rules) {
+		return false
+	}
+	for i, qr := range rules {
+		if qr != m.rules[i] || qr.query.name != m.patterns[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// queryMatch is the result of evaluating the literal conditions of a
+// queryMatcher against a query. queryMatches are pooled, since FilterByPlan
+// runs for every query that misses the plan cache.
+type queryMatch struct {
+	m     *queryMatcher
+	query string
+	// useRegexps is set if the literal conditions must not be used.
+	useRegexps bool
+	found      []bool
+}
+
+var queryMatchPool = sync.Pool{New: func() any { return &queryMatch{} }}
+
+// match evaluates all literal conditions against query. The caller must
+// release the returned queryMatch once done with it.
+func (m *queryMatcher) match(query string) *queryMatch {
+	qm := queryMatchPool.Get().(*queryMatch)
+	qm.m, qm.query = m, query
+	// `.` does not match a new line, which the literal conditions
+	// don't account for: use the regexps for such queries.
+	qm.useRegexps = len(m.literals) == 0 || strings.IndexByte(query, '\n') >= 0
+	if qm.useRegexps {
+		return qm
+	}
+	if cap(qm.found) < len(m.literals) {
+		qm.found = make([]bool, len(m.literals))
+	} else {
+		qm.found = qm.found[:len(m.literals)]
+		clear(qm.found)
+	}
+	found := qm.found
+	m.ac.scan(query, func(id, end int) {
+		if found[id] {
+			return
+		}
+		cond := m.literals[id]
+		start := end - len(cond.literal)
+		switch cond.anchor {
+		case anchorStart:
+			found[id] = start == 0
+		case anchorEnd:
+			found[id] = end == len(query)
+		case anchorBoth:
+			found[id] = start == 0 && end == len(query)
+		default:
+			found[id] = true
+		}
+	})
+	return qm
+}
+
+// matches reports whether the query condition of rules[i] matches.
+func (qm *queryMatch) matches(i int) bool {
+	if !qm.useRegexps {
+		if id := qm.m.conds[i]; id >= 0 {
+			return qm.found[id] != qm.m.rules[i].query.negated
+		}
+	}
+	return qm.m.rules[i].query.match(qm.query)
+}
+
+// release returns qm to the pool.
+func (qm *queryMatch) release() {
+	qm.m, qm.query = nil, ""
+	queryMatchPool.Put(qm)
+}
+
+// ahoCorasick is a byte oriented Aho-Corasick automaton. Literals must not
+// be empty.
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+type acNode struct {
+	next map[byte]int32
+	fail int32
+	// outputs are the ids of the literals that end at this node,
+	// including the ones reachable through fail links.
+	outputs []int
+}
+
+func newAhoCorasick(literals []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{}}}
+	for id, literal := range literals {
+		cur := int32(0)
+		for i := 0; i < len(literal); i++ {
+			c := literal[i]
+			nxt, ok := ac.nodes[cur].next[c]
+			if !ok {
+				nxt = int32(len(ac.nodes))
+				ac.nodes = append(ac.nodes, acNode{})
+				if ac.nodes[cur].next == nil {
+					ac.nodes[cur].next = make(map[byte]int32)
+				}
+				ac.nodes[cur].next[c] = nxt
+			}
+			cur = nxt
+		}
+		ac.nodes[cur].outputs = append(ac.nodes[cur].outputs, id)
+	}
+
+	// Compute the fail links breadth first, so that the fail node of a
+	// node is always complete when the node is visited.
+	queue := make([]int32, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for c, child := range ac.nodes[cur].next {
+			fail := ac.nodes[cur].fail
+			for {
+				if nxt, ok := ac.nodes[fail].next[c]; ok {
+					ac.nodes[child].fail = nxt
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			failOutputs := ac.nodes[ac.nodes[child].fail].outputs
+			ac.nodes[child].outputs = append(ac.nodes[child].outputs, failOutputs...)
+			queue = append(queue, child)
+		}
+	}
+	return ac
+}
+
+// scan calls f for every occurrence of every literal in text, with end being
+// the offset right after the occurrence.
+func (ac *ahoCorasick) scan(text string, f func(id, end int)) {
+	cur := int32(0)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		for {
+			if nxt, ok := ac.nodes[cur].next[c]; ok {
+				cur = nxt
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = ac.nodes[cur].fail
+		}
+		for _, id := range ac.nodes[cur].outputs {
+			f(id, i+1)
+		}
+	}
+}
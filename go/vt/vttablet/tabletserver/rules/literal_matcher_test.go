@@ -0,0 +1,128 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+)
+
+func TestParseLiteralCond(t *testing.T) {
+	testcases := []struct {
+		pattern string
+		cond    literalCond
+		ok      bool
+	}{
+		{pattern: ".*from t1.*", cond: literalCond{literal: "from t1", anchor: anchorNone}, ok: true},
+		{pattern: "select .*", cond: literalCond{literal: "select ", anchor: anchorStart}, ok: true},
+		{pattern: ".*for update", cond: literalCond{literal: "for update", anchor: anchorEnd}, ok: true},
+		{pattern: "select 1", cond: literalCond{literal: "select 1", anchor: anchorBoth}, ok: true},
+		{pattern: `.*a\.b.*`, cond: literalCond{literal: "a.b", anchor: anchorNone}, ok: true},
+		{pattern: ".*a.b.*"},
+		{pattern: "(?i)select.*"},
+		{pattern: ".*(a|b).*"},
+		{pattern: ".*"},
+		{pattern: ""},
+		{pattern: "(?s).*a.*"},
+		{pattern: "["},
+	}
+	for _, tcase := range testcases {
+		t.Run(tcase.pattern, func(t *testing.T) {
+			cond, ok := parseLiteralCond(tcase.pattern)
+			assert.Equal(t, tcase.ok, ok)
+			assert.Equal(t, tcase.cond, cond)
+		})
+	}
+}
+
+func TestAhoCorasick(t *testing.T) {
+	literals := []string{"he", "she", "his", "hers", "e", "s"}
+	ac := newAhoCorasick(literals)
+	text := "ushers and his hens"
+
+	var got []string
+	ac.scan(text, func(id, end int) {
+		got = append(got, fmt.Sprintf("%s@%d", literals[id], end))
+	})
+
+	var want []string
+	for end := 1; end <= len(text); end++ {
+		for _, literal := range literals {
+			if strings.HasSuffix(text[:end], literal) {
+				want = append(want, fmt.Sprintf("%s@%d", literal, end))
+			}
+		}
+	}
+	assert.ElementsMatch(t, want, got)
+}
+
+func TestFilterByPlanLiteralConditions(t *testing.T) {
+	patterns := []string{
+		".*from t1.*",
+		"select .*",
+		".*for update",
+		"select * from t1",
+		".*t[0-9].*",
+		"update .*",
+		".*t1 where.*",
+	}
+	qrs := New()
+	for i, pattern := range patterns {
+		qr := NewActiveQueryRule("", fmt.Sprintf("r%d", i), QRFail)
+		require.NoError(t, qr.SetQueryCond(pattern))
+		qrs.Add(qr)
+	}
+
+	queries := []string{
+		"select * from t1",
+		"select * from t1 where a = 1 for update",
+		"update t2 set a = 1",
+		"select *\nfrom t1 for update",
+		"delete from t3",
+		"",
+	}
+	for _, query := range queries {
+		var want []string
+		for _, qr := range qrs.rules {
+			if reMatch(qr.query.Regexp, query) {
+				want = append(want, qr.Name)
+			}
+		}
+		var got []string
+		qrs.FilterByPlan(query, planbuilder.PlanSelect).ForEachRule(func(rule *Rule) {
+			got = append(got, rule.Name)
+		})
+		assert.Equal(t, want, got, query)
+	}
+
+	// modifying a rule must be reflected by the next FilterByPlan.
+	require.NoError(t, qrs.Find("r3").SetQueryCond("delete .*"))
+	require.NotNil(t, qrs.FilterByPlan("delete from t3", planbuilder.PlanDelete).Find("r3"))
+	qrs.Delete("r3")
+	require.Nil(t, qrs.FilterByPlan("delete from t3", planbuilder.PlanDelete).Find("r3"))
+}
+
+func BenchmarkFilterByPlan(b *testing.B) {
+	qrs := New()
+	for i := 0; i < 1000; i++ {
+		qr := NewActiveQueryRule("", fmt.Sprintf("r%d", i), QRFail)
+		_ = qr.SetQueryCond(fmt.Sprintf(".*from t%d where.*", rand.Intn(100000)))
+		qrs.Add(qr)
+	}
+	query := "select a, b, c from t12345678 where id = :id and name = :name"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		qrs.FilterByPlan(query, planbuilder.PlanSelect)
+	}
+}
@@ -19,7 +19,9 @@ package rules
 import (
 	"encoding/json"
 	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
 
 	"vitess.io/vitess/go/vt/log"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
@@ -27,36 +29,58 @@ import (
 
 // Map is the maintainer of Rules from multiple sources
 type Map struct {
-	// mutex to protect following queryRulesMap
+	// mutex to serialize the updates of queryRulesMap
 	mu sync.Mutex
-	// queryRulesMap maps the names of different query rule sources to the actual Rules structure
-	queryRulesMap map[string]*Rules
+	// queryRulesMap maps the names of different query rule sources to the actual Rules structure.
+	// The map is copied on write, so that the plans can be built without locking.
+	queryRulesMap atomic.Pointer[map[string]*Rules]
+	// conflictPolicy is the conflict policy of the Rules of the plans.
+	conflictPolicy atomic.Pointer[ConflictPolicy]
 }
 
 // NewMap returns an empty Map object.
 func NewMap() *Map {
-	qri := &Map{
-		queryRulesMap: map[string]*Rules{},
-	}
+	qri := &Map{}
+	qri.queryRulesMap.Store(&map[string]*Rules{})
 	return qri
 }
 
+func (qri *Map) load() map[string]*Rules {
+	return *qri.queryRulesMap.Load()
+}
+
+// update stores a copy of queryRulesMap modified by f. It must be called
+// with mu locked.
+func (qri *Map) update(f func(queryRulesMap map[string]*Rules)) {
+	current := qri.load()
+	next := make(map[string]*Rules, len(current)+1)
+	for ruleSource, rules := range current {
+		next[ruleSource] = rules
+	}
+	f(next)
+	qri.queryRulesMap.Store(&next)
+}
+
 // RegisterSource registers a query rule source name with Map.
 func (qri *Map) RegisterSource(ruleSource string) {
 	qri.mu.Lock()
 	defer qri.mu.Unlock()
-	if _, existed := qri.queryRulesMap[ruleSource]; existed {
+	if _, existed := qri.load()[ruleSource]; existed {
 		log.Errorf("Query rule source " + ruleSource + " has been registered")
 		panic("Query rule source " + ruleSource + " has been registered")
 	}
-	qri.queryRulesMap[ruleSource] = New()
+	qri.update(func(queryRulesMap map[string]*Rules) {
+		queryRulesMap[ruleSource] = New()
+	})
 }
 
 // UnRegisterSource removes a registered query rule source name.
 func (qri *Map) UnRegisterSource(ruleSource string) {
 	qri.mu.Lock()
 	defer qri.mu.Unlock()
-	delete(qri.queryRulesMap, ruleSource)
+	qri.update(func(queryRulesMap map[string]*Rules) {
+		delete(queryRulesMap, ruleSource)
+	})
 }
 
 // SetRules takes an external Rules structure and overwrite one of the
@@ -67,8 +91,11 @@ func (qri *Map) SetRules(ruleSource string, newRules *Rules) error {
 	}
 	qri.mu.Lock()
 	defer qri.mu.Unlock()
-	if _, ok := qri.queryRulesMap[ruleSource]; ok {
-		qri.queryRulesMap[ruleSource] = newRules.Copy()
+	if _, ok := qri.load()[ruleSource]; ok {
+		rules := newRules.Copy()
+		qri.update(func(queryRulesMap map[string]*Rules) {
+			queryRulesMap[ruleSource] = rules
+		})
 		return nil
 	}
 	return errors.New("Rule source identifier " + ruleSource + " is not valid")
@@ -76,21 +103,34 @@ func (qri *Map) SetRules(ruleSource string, newRules *Rules) error {
 
 // Get returns the corresponding Rules as designated by ruleSource parameter.
 func (qri *Map) Get(ruleSource string) (*Rules, error) {
-	qri.mu.Lock()
-	defer qri.mu.Unlock()
-	if ruleset, ok := qri.queryRulesMap[ruleSource]; ok {
+	if ruleset, ok := qri.load()[ruleSource]; ok {
 		return ruleset.Copy(), nil
 	}
 	return New(), errors.New("Rule source identifier " + ruleSource + " is not valid")
 }
 
+// ForEachSource calls f with the Rules of every query rule source, in the
+// order of the source names.
+func (qri *Map) ForEachSource(f func(ruleSource string, qrs *Rules)) {
+	queryRulesMap := qri.load()
+	ruleSources := make([]string, 0, len(queryRulesMap))
+	for ruleSource := range queryRulesMap {
+		ruleSources = append(ruleSources, ruleSource)
+	}
+	sort.Strings(ruleSources)
+	for _, ruleSource := range ruleSources {
+		f(ruleSource, queryRulesMap[ruleSource])
+	}
+}
+
 // FilterByPlan creates a new Rules by prefiltering on all query rules that are contained in internal
 // Rules structures, in other words, query rules from all predefined sources will be applied.
 func (qri *Map) FilterByPlan(query string, planType planbuilder.PlanType, tableNames ...string) (newqrs *Rules) {
-	qri.mu.Lock()
-	defer qri.mu.Unlock()
 	newqrs = New()
-	for _, rules := range qri.queryRulesMap {
+	if policy := qri.conflictPolicy.Load(); policy != nil {
+		newqrs.conflictPolicy = *policy
+	}
+	for _, rules := range qri.load() {
 		newqrs.Append(rules.FilterByPlan(query, planType, tableNames...))
 	}
 	return newqrs
@@ -98,7 +138,5 @@ func (qri *Map) FilterByPlan(query string, planType planbuilder.PlanType, tableN
 
 // MarshalJSON marshals to JSON.
 func (qri *Map) MarshalJSON() ([]byte, error) {
-	qri.mu.Lock()
-	defer qri.mu.Unlock()
-	return json.Marshal(qri.queryRulesMap)
+	return json.Marshal(qri.load())
 }
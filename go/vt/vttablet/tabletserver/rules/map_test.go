@@ -221,3 +221,38 @@ func TestMapJSON(t *testing.T) {
 		t.Errorf("MapJSON:\n%v, want\n%v", got, want)
 	}
 }
+
+func TestMapForEachSource(t *testing.T) {
+	setupRules()
+	qri := NewMap()
+	qri.RegisterSource(denyListQueryRules)
+	_ = qri.SetRules(denyListQueryRules, denyRules)
+	qri.RegisterSource(customQueryRules)
+	_ = qri.SetRules(customQueryRules, otherRules)
+
+	var got []string
+	qri.ForEachSource(func(ruleSource string, qrs *Rules) {
+		qrs.ForEachRule(func(qr *Rule) {
+			got = append(got, ruleSource+":"+qr.Name)
+		})
+	})
+	want := []string{"CUSTOM_QUERY_RULES:customrule_ban_bindvar", "DENYLIST_QUERY_RULES:denied_table"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ForEachSource: %v, want %v", got, want)
+	}
+}
+
+func BenchmarkMapFilterByPlanParallel(b *testing.B) {
+	setupRules()
+	qri := NewMap()
+	qri.RegisterSource(denyListQueryRules)
+	qri.RegisterSource(customQueryRules)
+	_ = qri.SetRules(denyListQueryRules, denyRules)
+	_ = qri.SetRules(customQueryRules, otherRules)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			qri.FilterByPlan("select * from bannedtable2", planbuilder.PlanSelect, "d1.bannedtable2")
+		}
+	})
+}
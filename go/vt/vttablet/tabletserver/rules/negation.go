@@ -0,0 +1,62 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Some conditions of a rule are negated. The regexp conditions of the form
+// (?!re), like (?!batch_svc) for the user, match the values re doesn't match.
+// Go regexps have no lookaheads, so no valid regexp starts with (?!, and the
+// stored regexps keep their meaning, the ones starting with ! included. The
+// user groups and table names starting with ! exclude their users and tables,
+// like the CIDR ranges do, see AddCIDRCond. So a rule on the tables
+//
+//	["db.orders"]
+//
+// with the user (?!batch_svc) and the leading comment (?!.*tag=replay.*)
+// matches the queries on db.orders but the ones of batch_svc and the ones
+// tagged replay, without a regexp matching everything else.
+
+// negatedCond splits a user group or table name condition in what it matches
+// and whether it is negated.
+func negatedCond(cond string) (string, bool) {
+	return strings.CutPrefix(cond, "!")
+}
+
+// negatedRegexp splits a regexp condition in its regexp and whether it is
+// negated, i.e. of the form (?!re).
+func negatedRegexp(pattern string) (string, bool) {
+	if s, ok := strings.CutPrefix(pattern, "(?!"); ok {
+		if s, ok := strings.CutSuffix(s, ")"); ok {
+			return s, true
+		}
+	}
+	return pattern, false
+}
+
+// newNamedRegexp compiles the regexp condition pattern, negated if it is of
+// the form (?!re).
+func newNamedRegexp(pattern string) (namedRegexp, error) {
+	s, negated := negatedRegexp(pattern)
+	re, err := regexp.Compile(makeExact(s))
+	return namedRegexp{name: pattern, negated: negated, Regexp: re}, err
+}
+
+// match returns whether the condition holds for s: a nil condition holds for
+// everything, and a negated one for what its regexp doesn't match.
+func (nr namedRegexp) match(s string) bool {
+	return nr.Regexp == nil || nr.MatchString(s) != nr.negated
+}
+
+// pattern returns the regexp of the condition, without the (?!) of the
+// negated ones.
+func (nr namedRegexp) pattern() string {
+	s, _ := negatedRegexp(nr.name)
+	return s
+}
@@ -0,0 +1,132 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+)
+
+func TestNegatedConds(t *testing.T) {
+	qr, err := BuildQueryRule(map[string]any{
+		"Name":                     "orders",
+		"FullyQualifiedTableNames": []any{"db.orders"},
+		"User":                     "(?!batch_svc)",
+		"LeadingComment":           "(?!.*tag=replay.*)",
+		"Action":                   "FAIL",
+	})
+	require.NoError(t, err)
+	data, err := json.Marshal(qr)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"User":"(?!batch_svc)"`)
+	assert.Contains(t, string(data), `"LeadingComment":"(?!.*tag=replay.*)"`)
+
+	filtered := qr.FilterByPlan("select * from orders", planbuilder.PlanSelect, []string{"db.orders"})
+	require.NotNil(t, filtered)
+	assert.Nil(t, qr.FilterByPlan("select * from items", planbuilder.PlanSelect, []string{"db.items"}))
+	for _, tcase := range []struct {
+		user    string
+		leading string
+		want    Action
+	}{
+		{user: "app", want: QRFail},
+		{user: "app", leading: "/* tag=report */ ", want: QRFail},
+		{user: "batch_svc", want: QRContinue},
+		{user: "app", leading: "/* tag=replay */ ", want: QRContinue},
+		// The regexps are still full matches.
+		{user: "batch_svc2", want: QRFail},
+	} {
+		got := filtered.FilterByExecutionInfo("", tcase.user, "", false, nil, sqlparser.MarginComments{Leading: tcase.leading})
+		assert.Equal(t, tcase.want, got, "%s %s", tcase.user, tcase.leading)
+	}
+
+	// The regexps starting with ! keep matching a literal !.
+	bang := NewActiveQueryRule("", "bang", QRFail)
+	require.NoError(t, bang.SetUserCond("!admin"))
+	assert.Equal(t, QRFail, bang.FilterByExecutionInfo("", "!admin", "", false, nil, sqlparser.MarginComments{}))
+	assert.Equal(t, QRContinue, bang.FilterByExecutionInfo("", "admin", "", false, nil, sqlparser.MarginComments{}))
+
+	assert.Error(t, bang.SetTrailingCommentCond("(?!()"))
+	// The other regexps starting with (?! are still invalid.
+	assert.Error(t, bang.SetTrailingCommentCond("(?!a)b"))
+}
+
+func TestNegatedQueryCond(t *testing.T) {
+	// The literal query conditions and the regexp ones are negated alike.
+	literal := NewActiveQueryRule("", "literal", QRFail)
+	require.NoError(t, literal.SetQueryCond("(?!select .*)"))
+	regex := NewActiveQueryRule("", "regex", QRFail)
+	require.NoError(t, regex.SetQueryCond(`(?!select .* from (?P<table>\w+))`))
+	qrs := New()
+	qrs.Add(literal)
+	qrs.Add(regex)
+
+	assert.Nil(t, qrs.FilterByPlan("select * from t", planbuilder.PlanSelect).Find("literal"))
+	assert.Nil(t, qrs.FilterByPlan("select * from t", planbuilder.PlanSelect).Find("regex"))
+	// . doesn't match a new line.
+	assert.NotNil(t, qrs.FilterByPlan("select *\nfrom t", planbuilder.PlanSelect).Find("literal"))
+	assert.NotNil(t, qrs.FilterByPlan("select *\nfrom t", planbuilder.PlanSelect).Find("regex"))
+	filtered := qrs.FilterByPlan("delete from t", planbuilder.PlanDelete)
+	assert.NotNil(t, filtered.Find("literal"))
+	assert.NotNil(t, filtered.Find("regex"))
+	assert.Nil(t, literal.FilterByPlan("select 1", planbuilder.PlanSelect, nil))
+	assert.NotNil(t, literal.FilterByPlan("update t set a = 1", planbuilder.PlanUpdate, nil))
+
+	// The negated regexps capture nothing.
+	assert.Empty(t, regex.CaptureNames())
+	assert.Empty(t, filtered.Find("regex").Captures(sqlparser.MarginComments{}))
+}
+
+func TestExcludedUserGroups(t *testing.T) {
+	qr := NewActiveQueryRule("", "groups", QRFail)
+	require.NoError(t, qr.AddUserGroupCond("!batch"))
+	assert.Error(t, qr.AddUserGroupCond("!"))
+	// Until the members are known, the condition holds for no user.
+	assert.Equal(t, QRContinue, qr.FilterByExecutionInfo("", "app", "", false, nil, sqlparser.MarginComments{}))
+
+	qrs := New()
+	qrs.Add(qr)
+	groups := map[string][]string{"batch": {"etl", "backup"}, "apps": {"app", "etl"}}
+	qrs.SetUserGroups(groups)
+	assert.Equal(t, QRFail, qr.FilterByExecutionInfo("", "app", "", false, nil, sqlparser.MarginComments{}))
+	assert.Equal(t, QRContinue, qr.FilterByExecutionInfo("", "etl", "", false, nil, sqlparser.MarginComments{}))
+
+	// With included groups, the members of the excluded ones don't match
+	// whatever their other groups.
+	require.NoError(t, qr.AddUserGroupCond("apps"))
+	qrs.SetUserGroups(groups)
+	for user, want := range map[string]Action{"app": QRFail, "etl": QRContinue, "backup": QRContinue, "other": QRContinue} {
+		assert.Equal(t, want, qr.FilterByExecutionInfo("", user, "", false, nil, sqlparser.MarginComments{}), user)
+		assert.Equal(t, want, qr.Copy().FilterByExecutionInfo("", user, "", false, nil, sqlparser.MarginComments{}), user)
+	}
+}
+
+func TestExcludedTables(t *testing.T) {
+	for _, tcase := range []struct {
+		patterns []string
+		tables   []string
+		want     bool
+	}{
+		{patterns: []string{"!db.audit"}, tables: []string{"db.orders"}, want: true},
+		{patterns: []string{"!db.audit"}, tables: []string{"db.orders", "db.audit"}, want: false},
+		{patterns: []string{"!db.audit"}, want: true},
+		{patterns: []string{"db.*", "!db.audit"}, tables: []string{"db.orders"}, want: true},
+		{patterns: []string{"db.*", "!db.audit"}, tables: []string{"db.audit"}, want: false},
+		{patterns: []string{"db.*", "!db.audit"}, tables: []string{"other.orders"}, want: false},
+		{patterns: []string{"!*.tmp_*", "db.orders"}, tables: []string{"db.tmp_1", "db.orders"}, want: false},
+		// The invalid patterns still fail the evaluation.
+		{patterns: []string{"!audit"}, tables: []string{"db.orders"}, want: false},
+	} {
+		got := fullyQualifiedTableNameRegexMatch(tcase.patterns, tcase.tables)
+		assert.Equal(t, tcase.want, got, "%v %v", tcase.patterns, tcase.tables)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// OutcomeConds are the post execution conditions of a rule, like
+//
+//	{"min_latency": "2s"}
+//	{"min_rows": 100000}
+//	{"error_codes": [1205, 1213]}
+//
+// A query which matches the other conditions of the rule only matches them
+// once it ran, if it took at least min_latency, returned or affected at least
+// min_rows rows, and failed with one of the MySQL error codes, for the ones
+// set. The action of the rule then fires after the query, see the tablet
+// server.
+type OutcomeConds struct {
+	spec       string
+	minLatency time.Duration
+	minRows    uint64
+	errorCodes []int
+}
+
+// ParseOutcomeConds parses the JSON spec of the post execution conditions.
+func ParseOutcomeConds(spec string) (*OutcomeConds, error) {
+	c := &struct {
+		MinLatency string `json:"min_latency"`
+		MinRows    int64  `json:"min_rows"`
+		ErrorCodes []int  `json:"error_codes"`
+	}{}
+	dec := json.NewDecoder(strings.NewReader(spec))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("invalid outcome conditions %s: %v", spec, err)
+	}
+	oc := &OutcomeConds{spec: spec, errorCodes: c.ErrorCodes}
+	if c.MinLatency != "" {
+		latency, err := time.ParseDuration(c.MinLatency)
+		if err != nil || latency <= 0 {
+			return nil, fmt.Errorf("invalid min_latency %q of outcome conditions %s", c.MinLatency, spec)
+		}
+		oc.minLatency = latency
+	}
+	if c.MinRows < 0 {
+		return nil, fmt.Errorf("invalid min_rows %d of outcome conditions %s", c.MinRows, spec)
+	}
+	oc.minRows = uint64(c.MinRows)
+	for _, code := range c.ErrorCodes {
+		if code <= 0 {
+			return nil, fmt.Errorf("invalid error code %d of outcome conditions %s", code, spec)
+		}
+	}
+	if oc.minLatency == 0 && oc.minRows == 0 && len(oc.errorCodes) == 0 {
+		return nil, fmt.Errorf("invalid outcome conditions %s: no condition is set", spec)
+	}
+	return oc, nil
+}
+
+// Matches returns whether the outcome of a query matches the conditions.
+// errorCode is the MySQL error code the query failed with, or 0.
+func (oc *OutcomeConds) Matches(latency time.Duration, rows uint64, errorCode int) bool {
+	if latency < oc.minLatency || rows < oc.minRows {
+		return false
+	}
+	return len(oc.errorCodes) == 0 || slices.Contains(oc.errorCodes, errorCode)
+}
+
+// String returns the spec of the conditions.
+func (oc *OutcomeConds) String() string {
+	return oc.spec
+}
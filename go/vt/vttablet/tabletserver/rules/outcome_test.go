@@ -0,0 +1,75 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestParseOutcomeCondsErrors(t *testing.T) {
+	testCases := map[string]string{
+		`{}`:                      "invalid outcome conditions {}: no condition is set",
+		`{"min_rows": 0}`:         "invalid outcome conditions {\"min_rows\": 0}: no condition is set",
+		`{"min_rows": 1, "x": 1}`: "invalid outcome conditions {\"min_rows\": 1, \"x\": 1}: json: unknown field \"x\"",
+		`{"min_rows": -1}`:        "invalid min_rows -1 of outcome conditions {\"min_rows\": -1}",
+		`{"min_latency": "2"}`:    "invalid min_latency \"2\" of outcome conditions {\"min_latency\": \"2\"}",
+		`{"min_latency": "-2s"}`:  "invalid min_latency \"-2s\" of outcome conditions {\"min_latency\": \"-2s\"}",
+		`{"error_codes": [0]}`:    "invalid error code 0 of outcome conditions {\"error_codes\": [0]}",
+		`{"error_codes": "1205"}`: "invalid outcome conditions {\"error_codes\": \"1205\"}: json: cannot unmarshal string into Go struct field .error_codes of type []int",
+	}
+	for spec, expected := range testCases {
+		_, err := ParseOutcomeConds(spec)
+		assert.EqualError(t, err, expected, spec)
+	}
+}
+
+func TestOutcomeCondsMatches(t *testing.T) {
+	slow, err := ParseOutcomeConds(`{"min_latency": "2s"}`)
+	require.NoError(t, err)
+	assert.True(t, slow.Matches(2*time.Second, 0, 0))
+	assert.True(t, slow.Matches(3*time.Second, 0, 1205))
+	assert.False(t, slow.Matches(time.Second, 1000, 0))
+
+	// The conditions add up, and the error codes match the failed queries
+	// only.
+	slowLocks, err := ParseOutcomeConds(`{"min_latency": "1s", "min_rows": 10, "error_codes": [1205, 1213]}`)
+	require.NoError(t, err)
+	assert.True(t, slowLocks.Matches(time.Second, 10, 1213))
+	assert.False(t, slowLocks.Matches(time.Second, 10, 0))
+	assert.False(t, slowLocks.Matches(time.Second, 9, 1205))
+	assert.False(t, slowLocks.Matches(time.Millisecond, 10, 1205))
+}
+
+func TestRuleOutcomeConds(t *testing.T) {
+	qr := NewActiveQueryRule("rule", "name", QRFail)
+	require.NoError(t, qr.SetOutcomeConds(`{"min_rows": 100000}`))
+	assert.Equal(t, `{"min_rows": 100000}`, qr.GetOutcomeConds())
+	// The rule only acts once the queries ran.
+	qrs := New()
+	qrs.Add(qr)
+	act, _, _ := qrs.GetAction("", "", "", false, nil, sqlparser.MarginComments{})
+	assert.Equal(t, QRContinue, act)
+
+	// The conditions are kept by their spec.
+	data, err := qr.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"OutcomeConds":"{\"min_rows\": 100000}"`)
+	qrs = New()
+	require.NoError(t, qrs.UnmarshalJSON([]byte("["+string(data)+"]")))
+	assert.Equal(t, qr.GetOutcomeConds(), qrs.Find("name").GetOutcomeConds())
+	assert.True(t, qr.Equal(qrs.Find("name")))
+	assert.True(t, qr.Equal(qr.Copy()))
+
+	require.NoError(t, qr.SetOutcomeConds(""))
+	assert.Nil(t, qr.OutcomeConds())
+	assert.False(t, qr.Equal(qrs.Find("name")))
+}
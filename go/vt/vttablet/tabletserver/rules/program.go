@@ -0,0 +1,331 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// Every rule compiles its conditions into a program: a flat list of
+// instructions that run evaluates in order, stopping at the first one that
+// does not hold. Compiling does once the work the conditions would do on
+// every evaluation, such as compiling the table name patterns, and orders
+// the instructions from the cheapest to the most expensive one. A rule
+// compiles its program on first use, and again after any of its conditions
+// changed.
+
+type opcode uint8
+
+const (
+	// opPlan holds if the plan is one of the plans of the rule.
+	opPlan opcode = iota
+	// opQueryTemplate holds if the query is the query template of the rule.
+	opQueryTemplate
+	// opQueryDigest holds if the digest of the query is the one of the rule.
+	opQueryDigest
+	// opQuery holds if the query condition matched. It is evaluated by
+	// the caller, see queryMatcher.
+	opQuery
+	// opTables holds if one of the tables matches the table patterns, or
+	// any of them if they are all excluded ones, and none of the tables
+	// matches the excluded patterns.
+	opTables
+	// opUser holds if regexps[arg] matches the user. The regexps of the
+	// negated conditions hold for what they don't match.
+	opUser
+	// opTransaction holds if the query runs in an explicit transaction, or
+	// doesn't, like the rule.
+	opTransaction
+	// opUserGroup holds if the user is a member of one of the user groups,
+	// or of any of them if they are all excluded ones, and of none of the
+	// excluded groups.
+	opUserGroup
+	// opWorkloadClass holds if regexps[arg] matches the workload class.
+	opWorkloadClass
+	// opIP holds if regexps[arg] matches the client IP.
+	opIP
+	// opCIDR holds if the client IP is in the CIDR ranges.
+	opCIDR
+	// opLeadingComment holds if regexps[arg] matches the leading comment.
+	opLeadingComment
+	// opTrailingComment holds if regexps[arg] matches the trailing comment.
+	opTrailingComment
+	// opBindVar holds if bindVarConds[arg] holds.
+	opBindVar
+)
+
+type instruction struct {
+	op  opcode
+	arg uint16
+}
+
+// program is the compiled form of the conditions of a rule. planCode is
+// evaluated when the plan of a query is built, and execCode when the query
+// is executed.
+type program struct {
+	planCode []instruction
+	execCode []instruction
+
+	plans         [planbuilder.NumPlans]bool
+	queryTemplate string
+	queryDigest   string
+	tables        []tablePattern
+	regexps       []namedRegexp
+	ipRanges      *ipRanges
+	groupUsers    map[string]bool
+	// anyGroupUser is set if all the user groups are excluded ones, see
+	// matchUserGroups.
+	anyGroupUser  bool
+	inTransaction bool
+	bindVarConds  []BindVarCond
+}
+
+// tablePattern is a compiled fully qualified table name condition, excluded
+// if it starts with !. An invalid condition has no regexps, and fails the
+// evaluation once reached.
+type tablePattern struct {
+	database, table *regexp.Regexp
+	excluded        bool
+}
+
+// evalInput is what the instructions of a program are evaluated against.
+type evalInput struct {
+	planType     planbuilder.PlanType
+	query        string
+	queryMatched bool
+	tableNames   []string
+	// digest is the digest of query, see queryDigest.
+	digest string
+
+	ip, user, workloadClass string
+	inTransaction           bool
+	bindVars                map[string]*querypb.BindVariable
+	marginComments          sqlparser.MarginComments
+}
+
+// program returns the program of qr, compiling it if needed.
+func (qr *Rule) program() *program {
+	if p := qr.prog.Load(); p != nil {
+		return p
+	}
+	p := compile(qr)
+	qr.prog.Store(p)
+	return p
+}
+
+// invalidate discards the program of qr after one of its conditions changed.
+func (qr *Rule) invalidate() {
+	qr.prog.Store(nil)
+}
+
+func compile(qr *Rule) *program {
+	p := &program{}
+
+	if qr.plans != nil {
+		for _, planType := range qr.plans {
+			if planType >= 0 && planType < planbuilder.NumPlans {
+				p.plans[planType] = true
+			}
+		}
+		p.planCode = append(p.planCode, instruction{op: opPlan})
+	}
+	if qr.queryTemplate != "" {
+		p.queryTemplate = qr.queryTemplate
+		p.planCode = append(p.planCode, instruction{op: opQueryTemplate})
+	}
+	if qr.queryDigest != "" {
+		p.queryDigest = qr.queryDigest
+		p.planCode = append(p.planCode, instruction{op: opQueryDigest})
+	}
+	if qr.query.Regexp != nil {
+		p.planCode = append(p.planCode, instruction{op: opQuery})
+	}
+	if qr.fullyQualifiedTableNames != nil {
+		p.tables = compileTablePatterns(qr.fullyQualifiedTableNames)
+		p.planCode = append(p.planCode, instruction{op: opTables})
+	}
+
+	if qr.inTransaction != nil {
+		p.inTransaction = *qr.inTransaction
+		p.execCode = append(p.execCode, instruction{op: opTransaction})
+	}
+	p.bindVarConds = qr.bindVarConds
+	// Bind variable conditions that don't use a regexp are cheaper than
+	// the regexp conditions, so they go first.
+	for i, bvc := range qr.bindVarConds {
+		if _, ok := bvc.value.(bvcre); !ok {
+			p.execCode = append(p.execCode, instruction{op: opBindVar, arg: uint16(i)})
+		}
+	}
+	// Matching an IP is cheaper than a regexp.
+	if qr.requestCIDRs != nil {
+		p.ipRanges = compileIPRanges(qr.requestCIDRs)
+		p.execCode = append(p.execCode, instruction{op: opCIDR})
+	}
+	if qr.userGroups != nil {
+		p.groupUsers = qr.groupUsers
+		p.anyGroupUser = true
+		for _, group := range qr.userGroups {
+			if _, excluded := negatedCond(group); !excluded {
+				p.anyGroupUser = false
+			}
+		}
+		p.execCode = append(p.execCode, instruction{op: opUserGroup})
+	}
+	for _, cond := range []struct {
+		op opcode
+		re namedRegexp
+	}{
+		{opUser, qr.user},
+		{opWorkloadClass, qr.workloadClass},
+		{opIP, qr.requestIP},
+		{opLeadingComment, qr.leadingComment},
+		{opTrailingComment, qr.trailingComment},
+	} {
+		if cond.re.Regexp != nil {
+			p.execCode = append(p.execCode, instruction{op: cond.op, arg: uint16(len(p.regexps))})
+			p.regexps = append(p.regexps, cond.re)
+		}
+	}
+	for i, bvc := range qr.bindVarConds {
+		if _, ok := bvc.value.(bvcre); ok {
+			p.execCode = append(p.execCode, instruction{op: opBindVar, arg: uint16(i)})
+		}
+	}
+	return p
+}
+
+// compileTablePatterns compiles the table name conditions, the excluded ones
+// first since they must all be evaluated.
+func compileTablePatterns(fullyQualifiedTableNames []string) []tablePattern {
+	patterns := make([]tablePattern, 0, len(fullyQualifiedTableNames))
+	for _, expected := range fullyQualifiedTableNames {
+		name, excluded := negatedCond(expected)
+		database, table, ok := splitTableName(name)
+		if !ok {
+			log.Errorf("expectedFullyQualifiedTableNames is not fully qualified table name, expected:%v", expected)
+			patterns = append(patterns, tablePattern{})
+			continue
+		}
+		databaseNameRegex, err1 := compileRegex(database)
+		tableNameRegex, err2 := compileRegex(table)
+		if err1 != nil || err2 != nil {
+			log.Errorf("err of compileRegex is not nil, err1:%v, err2:%v", err1, err2)
+			patterns = append(patterns, tablePattern{})
+			continue
+		}
+		patterns = append(patterns, tablePattern{database: databaseNameRegex, table: tableNameRegex, excluded: excluded})
+	}
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patterns[i].excluded && !patterns[j].excluded
+	})
+	return patterns
+}
+
+// splitTableName splits a fully qualified table name in its database and
+// table names.
+func splitTableName(name string) (string, string, bool) {
+	if strings.Count(name, ".") != 1 {
+		return "", "", false
+	}
+	database, table, _ := strings.Cut(name, ".")
+	return database, table, true
+}
+
+// run returns true if all the instructions of code hold for in.
+func (p *program) run(code []instruction, in *evalInput) bool {
+	for _, instr := range code {
+		var ok bool
+		switch instr.op {
+		case opPlan:
+			ok = in.planType >= 0 && in.planType < planbuilder.NumPlans && p.plans[in.planType]
+		case opQueryTemplate:
+			ok = queryTemplateMatch(p.queryTemplate, in.query)
+		case opQueryDigest:
+			ok = in.queryDigest() == p.queryDigest
+		case opQuery:
+			ok = in.queryMatched
+		case opTables:
+			ok = p.matchTables(in.tableNames)
+		case opUser:
+			ok = p.regexps[instr.arg].match(in.user)
+		case opTransaction:
+			ok = in.inTransaction == p.inTransaction
+		case opUserGroup:
+			ok = p.matchUserGroups(in.user)
+		case opWorkloadClass:
+			ok = p.regexps[instr.arg].match(in.workloadClass)
+		case opIP:
+			ok = p.regexps[instr.arg].match(in.ip)
+		case opCIDR:
+			ok = p.ipRanges.match(in.ip)
+		case opLeadingComment:
+			ok = p.regexps[instr.arg].match(in.marginComments.Leading)
+		case opTrailingComment:
+			ok = p.regexps[instr.arg].match(in.marginComments.Trailing)
+		case opBindVar:
+			ok = bvMatch(p.bindVarConds[instr.arg], in.bindVars)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchUserGroups returns true if the user is a member of one of the user
+// groups, or of any of them if they are all excluded ones, and of none of the
+// excluded groups. The users only match once the members of the groups are
+// set, see Rules.SetUserGroups.
+func (p *program) matchUserGroups(user string) bool {
+	if p.groupUsers == nil {
+		return false
+	}
+	member, ok := p.groupUsers[user]
+	return member || (!ok && p.anyGroupUser)
+}
+
+// matchTables returns true if one of tableNames matches one of the table
+// patterns, or if the patterns are all excluded ones, and none of tableNames
+// matches the excluded patterns. An invalid pattern or table name fails the
+// evaluation once reached.
+func (p *program) matchTables(tableNames []string) bool {
+	included := false
+	for _, pattern := range p.tables {
+		if pattern.database == nil {
+			return false
+		}
+		matched := false
+		for _, actual := range tableNames {
+			database, table, ok := splitTableName(actual)
+			if !ok {
+				log.Errorf("fullyQualifiedTableNames is not fully qualified table name, actual:%v", actual)
+				return false
+			}
+			if pattern.database.MatchString(database) && pattern.table.MatchString(table) {
+				matched = true
+				break
+			}
+		}
+		switch {
+		case pattern.excluded && matched:
+			return false
+		case !pattern.excluded && matched:
+			return true
+		case !pattern.excluded:
+			included = true
+		}
+	}
+	return !included && len(p.tables) > 0
+}
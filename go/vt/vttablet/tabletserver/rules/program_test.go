@@ -0,0 +1,92 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestCompile(t *testing.T) {
+	qr := NewActiveQueryRule("", "r1", QRFail)
+	require.NoError(t, qr.SetUserCond("u.*"))
+	require.NoError(t, qr.AddBindVarCond("a", false, false, QRMatch, "x.*"))
+	require.NoError(t, qr.AddBindVarCond("b", true, false, QRLessThan, int64(10)))
+	qr.AddPlanCond(planbuilder.PlanSelect)
+	qr.AddTableCond("d1.t*")
+	require.NoError(t, qr.SetQueryCond("select .*"))
+
+	p := qr.program()
+	assert.Equal(t, []instruction{{op: opPlan}, {op: opQuery}, {op: opTables}}, p.planCode)
+	// the regexp conditions run last.
+	assert.Equal(t, []instruction{{op: opBindVar, arg: 1}, {op: opUser, arg: 0}, {op: opBindVar, arg: 0}}, p.execCode)
+	assert.Same(t, p, qr.program())
+
+	// changing a condition compiles the program again.
+	require.NoError(t, qr.SetIPCond("127.0.0.1"))
+	p = qr.program()
+	assert.Equal(t, []instruction{{op: opBindVar, arg: 1}, {op: opUser, arg: 0}, {op: opIP, arg: 1}, {op: opBindVar, arg: 0}}, p.execCode)
+
+	assert.NotNil(t, qr.FilterByPlan("select * from t1", planbuilder.PlanSelect, []string{"d1.t1"}))
+	assert.Nil(t, qr.FilterByPlan("select * from t1", planbuilder.PlanInsert, []string{"d1.t1"}))
+	assert.Nil(t, qr.FilterByPlan("select * from t1", planbuilder.PlanSelect, []string{"d2.t1"}))
+
+	bindVars := map[string]*querypb.BindVariable{
+		"a": sqltypes.StringBindVariable("xyz"),
+	}
+	assert.Equal(t, QRFail, qr.FilterByExecutionInfo("127.0.0.1", "user", "", false, bindVars, sqlparser.MarginComments{}))
+	assert.Equal(t, QRContinue, qr.FilterByExecutionInfo("127.0.0.2", "user", "", false, bindVars, sqlparser.MarginComments{}))
+	bindVars["b"] = sqltypes.Int64BindVariable(10)
+	assert.Equal(t, QRContinue, qr.FilterByExecutionInfo("127.0.0.1", "user", "", false, bindVars, sqlparser.MarginComments{}))
+
+	// the workload class is matched like the user.
+	require.NoError(t, qr.SetWorkloadClassCond("(etl|batch)"))
+	delete(bindVars, "b")
+	assert.Equal(t, QRFail, qr.FilterByExecutionInfo("127.0.0.1", "user", "etl", false, bindVars, sqlparser.MarginComments{}))
+	assert.Equal(t, QRContinue, qr.FilterByExecutionInfo("127.0.0.1", "user", "etl2", false, bindVars, sqlparser.MarginComments{}))
+	assert.Equal(t, QRContinue, qr.FilterByExecutionInfo("127.0.0.1", "user", "", false, bindVars, sqlparser.MarginComments{}))
+
+	// a rule without conditions matches everything.
+	empty := NewActiveQueryRule("", "r2", QRFail)
+	assert.Empty(t, empty.program().planCode)
+	assert.Empty(t, empty.program().execCode)
+	assert.Equal(t, QRFail, empty.FilterByExecutionInfo("", "", "", false, nil, sqlparser.MarginComments{}))
+}
+
+// BenchmarkFilterByExecutionInfo evaluates the execution conditions of
+// rules that combine user, comment and bind variable conditions.
+func BenchmarkFilterByExecutionInfo(b *testing.B) {
+	var rules []*Rule
+	for i := 0; i < 1000; i++ {
+		qr := NewActiveQueryRule("", fmt.Sprintf("r%d", i), QRFail)
+		_ = qr.SetUserCond(fmt.Sprintf("user%d", i))
+		_ = qr.SetLeadingCommentCond(".*tag.*")
+		_ = qr.AddBindVarCond("id", false, false, QRGreaterEqual, int64(i))
+		_ = qr.AddBindVarCond("name", true, false, QRMatch, "n.*")
+		rules = append(rules, qr)
+	}
+	bindVars := map[string]*querypb.BindVariable{
+		"id":   sqltypes.Int64BindVariable(500),
+		"name": sqltypes.StringBindVariable("name"),
+	}
+	marginComments := sqlparser.MarginComments{Leading: "/* tag */ "}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, qr := range rules {
+			qr.FilterByExecutionInfo("127.0.0.1", "user500", "", false, bindVars, marginComments)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package proxysql converts the query rules of ProxySQL to wescale rules.
+//
+// ProxySQL rules can both match queries and do something with them, like
+// routing, caching or rewriting them. Only the rules that return an error are
+// converted, to FAIL rules: the other actions are done by vtgate, or not at
+// all, and are reported instead. Rule conditions that can't be converted skip
+// the whole rule, so that no converted rule matches more queries than the
+// original one.
+package proxysql
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+// Rule is a row of the mysql_query_rules table of ProxySQL, by column name.
+// NULL columns are missing.
+type Rule map[string]string
+
+// Issue is a column of a ProxySQL rule that has no wescale equivalent.
+type Issue struct {
+	RuleID string
+	Column string
+	Reason string
+	// Skipped is true if the rule was not converted because of the issue.
+	Skipped bool
+}
+
+func (issue Issue) String() string {
+	effect := "ignored"
+	if issue.Skipped {
+		effect = "rule skipped"
+	}
+	return fmt.Sprintf("rule_id %s: %s %s: %s", issue.RuleID, issue.Column, effect, issue.Reason)
+}
+
+// RuleName returns the name of the wescale rule converted from the ProxySQL
+// rule with the given rule_id.
+func RuleName(ruleID string) string {
+	return "proxysql_rule_" + ruleID
+}
+
+// ParseTSV reads the rules exported in the tab separated format of
+// `mysql --batch -e 'SELECT * FROM mysql_query_rules'`, with the column names
+// in the first line.
+func ParseTSV(r io.Reader) ([]Rule, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	var columns []string
+	var proxyRules []Rule
+	for line := 1; scanner.Scan(); line++ {
+		if scanner.Text() == "" {
+			continue
+		}
+		values := strings.Split(scanner.Text(), "\t")
+		if columns == nil {
+			columns = values
+			continue
+		}
+		if len(values) != len(columns) {
+			return nil, fmt.Errorf("line %d has %d values, want %d", line, len(values), len(columns))
+		}
+		rule := make(Rule)
+		for i, value := range values {
+			if value != "NULL" {
+				rule[strings.ToLower(columns[i])] = unescapeBatch(value)
+			}
+		}
+		proxyRules = append(proxyRules, rule)
+	}
+	return proxyRules, scanner.Err()
+}
+
+// unescapeBatch undoes the escaping of the values by mysql --batch.
+func unescapeBatch(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	return strings.NewReplacer(`\t`, "\t", `\n`, "\n", `\0`, "\x00", `\\`, `\`).Replace(value)
+}
+
+// skippedColumns are the rule conditions that can't be converted.
+var skippedColumns = map[string]string{
+	"digest":               "the digests of ProxySQL aren't the ones of wescale",
+	"negate_match_pattern": "query conditions can't be negated",
+	"proxy_interface":      "rules can't match the interface the client connected to",
+	"proxy_port":           "rules can't match the port the client connected to",
+}
+
+// ignoredColumns are the rule actions that can't be converted.
+var ignoredColumns = map[string]string{
+	"flagout":               "rules can't be chained",
+	"replace_pattern":       "queries are not rewritten",
+	"destination_hostgroup": "queries are routed by vtgate, see --read_write_splitting_policy",
+	"cache_ttl":             "query results are not cached",
+	"cache_empty_result":    "query results are not cached",
+	"cache_timeout":         "query results are not cached",
+	"reconnect":             "no equivalent",
+	"timeout":               "the timeout of a query is set by vtgate, see the QUERY_TIMEOUT_MS comment directive",
+	"retries":               "no equivalent",
+	"delay":                 "queries are not delayed, see the CONCURRENCY_CONTROL action",
+	"next_query_flagin":     "rules can't be chained",
+	"mirror_flagout":        "queries are not mirrored",
+	"mirror_hostgroup":      "queries are not mirrored",
+	"ok_msg":                "only errors can be returned instead of running the query",
+	"sticky_conn":           "no equivalent",
+	"multiplex":             "no equivalent",
+	"gtid_from_hostgroup":   "no equivalent",
+	"log":                   "no equivalent",
+	"attributes":            "no equivalent",
+}
+
+// Convert converts the ProxySQL rules to wescale rules, in the order of their
+// rule_id, which is used as their priority. The queries matched by a rule are
+// the ones with bind variables seen by vttablet, so a match_digest pattern
+// matching the '?' of ProxySQL digests doesn't match anything.
+func Convert(proxyRules []Rule) (*rules.Rules, []Issue) {
+	proxyRules = append([]Rule(nil), proxyRules...)
+	sort.SliceStable(proxyRules, func(i, j int) bool {
+		id1, _ := strconv.Atoi(proxyRules[i]["rule_id"])
+		id2, _ := strconv.Atoi(proxyRules[j]["rule_id"])
+		return id1 < id2
+	})
+
+	qrs := rules.New()
+	var issues []Issue
+	for _, proxyRule := range proxyRules {
+		rule, ruleIssues := convertRule(proxyRule)
+		issues = append(issues, ruleIssues...)
+		if rule != nil {
+			qrs.Add(rule)
+		}
+	}
+	return qrs, issues
+}
+
+func convertRule(row Rule) (*rules.Rule, []Issue) {
+	proxyRule := make(Rule, len(row))
+	for column, value := range row {
+		proxyRule[strings.ToLower(column)] = value
+	}
+	ruleID := proxyRule["rule_id"]
+	priority, err := strconv.Atoi(ruleID)
+	if err != nil {
+		return nil, []Issue{{RuleID: ruleID, Column: "rule_id", Reason: "not a number", Skipped: true}}
+	}
+
+	var issues []Issue
+	issue := func(column, reason string, skipped bool) {
+		issues = append(issues, Issue{RuleID: ruleID, Column: column, Reason: reason, Skipped: skipped})
+	}
+	for _, column := range sortedColumns(skippedColumns) {
+		if value, ok := proxyRule[column]; ok && value != "" && value != "0" {
+			issue(column, skippedColumns[column], true)
+		}
+	}
+	if flagIn := proxyRule["flagin"]; flagIn != "" && flagIn != "0" {
+		issue("flagin", "rules can't be chained", true)
+	}
+	matchDigest, matchPattern := proxyRule["match_digest"], proxyRule["match_pattern"]
+	if matchDigest != "" && matchPattern != "" {
+		issue("match_digest", "rules can't have both match_digest and match_pattern", true)
+	}
+	errorMsg, hasErrorMsg := proxyRule["error_msg"]
+	for _, column := range sortedColumns(ignoredColumns) {
+		if value := proxyRule[column]; value != "" {
+			issue(column, ignoredColumns[column], !hasErrorMsg)
+		}
+	}
+	if !hasErrorMsg && len(issues) == 0 {
+		issue("error_msg", "the rule does nothing", true)
+	}
+	for _, issue := range issues {
+		if issue.Skipped {
+			return nil, issues
+		}
+	}
+
+	rule := rules.NewActiveQueryRule(errorMsg, RuleName(ruleID), rules.QRFail)
+	rule.SetPriority(priority)
+	if proxyRule["active"] == "0" {
+		rule.SetStatus(rules.InActive)
+	}
+	if username := proxyRule["username"]; username != "" {
+		if err := rule.SetUserCond(regexp.QuoteMeta(username)); err != nil {
+			return nil, append(issues, Issue{RuleID: ruleID, Column: "username", Reason: err.Error(), Skipped: true})
+		}
+	}
+	if clientAddr := proxyRule["client_addr"]; clientAddr != "" {
+		// ProxySQL allows a trailing wildcard, like in 10.0.0.%.
+		pattern := regexp.QuoteMeta(strings.TrimSuffix(clientAddr, "%"))
+		if strings.HasSuffix(clientAddr, "%") {
+			pattern += ".*"
+		}
+		if err := rule.SetIPCond(pattern); err != nil {
+			return nil, append(issues, Issue{RuleID: ruleID, Column: "client_addr", Reason: err.Error(), Skipped: true})
+		}
+	}
+	if schemaName := proxyRule["schemaname"]; schemaName != "" {
+		// ProxySQL matches the default database of the connection, wescale
+		// the database of the tables of the query.
+		rule.AddTableCond(schemaName + ".*")
+	}
+	if pattern := matchDigest + matchPattern; pattern != "" {
+		column := "match_pattern"
+		if matchDigest != "" {
+			column = "match_digest"
+		}
+		// ProxySQL searches the query for the pattern, while wescale matches
+		// the whole query.
+		flags := "(?s)"
+		modifiers, ok := proxyRule["re_modifiers"]
+		if !ok || strings.Contains(strings.ToUpper(modifiers), "CASELESS") {
+			flags = "(?is)"
+		}
+		if err := rule.SetQueryCond(flags + ".*(?:" + pattern + ").*"); err != nil {
+			return nil, append(issues, Issue{RuleID: ruleID, Column: column, Reason: err.Error(), Skipped: true})
+		}
+	}
+	return rule, issues
+}
+
+func sortedColumns(columns map[string]string) []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
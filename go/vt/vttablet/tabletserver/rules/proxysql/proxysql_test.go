@@ -0,0 +1,87 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package proxysql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+func TestParseTSV(t *testing.T) {
+	export := "rule_id\tactive\tusername\tmatch_pattern\terror_msg\n" +
+		"1\t1\tNULL\t^SELECT\\t1\tno\\\\way\n" +
+		"\n" +
+		"2\t0\tapp\tNULL\tNULL\n"
+	proxyRules, err := ParseTSV(strings.NewReader(export))
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{"rule_id": "1", "active": "1", "match_pattern": "^SELECT\t1", "error_msg": `no\way`},
+		{"rule_id": "2", "active": "0", "username": "app"},
+	}, proxyRules)
+
+	_, err = ParseTSV(strings.NewReader("rule_id\tactive\n1\n"))
+	assert.EqualError(t, err, "line 2 has 1 values, want 2")
+}
+
+func TestConvert(t *testing.T) {
+	qrs, issues := Convert([]Rule{
+		{"rule_id": "20", "active": "1", "match_digest": "^DELETE FROM t", "re_modifiers": "", "error_msg": "no deletes", "destination_hostgroup": "1"},
+		{"rule_id": "10", "active": "0", "username": "app.user", "client_addr": "10.0.0.%", "schemaname": "db1", "match_pattern": "for update", "re_modifiers": "CASELESS", "error_msg": "no locks", "attributes": ""},
+		{"rule_id": "30", "active": "1", "match_pattern": "^SELECT", "destination_hostgroup": "2", "timeout": "1000"},
+		{"rule_id": "40", "active": "1", "flagIN": "1", "match_pattern": "x", "error_msg": "chained"},
+		{"rule_id": "50", "active": "1", "negate_match_pattern": "1", "match_pattern": "x", "error_msg": "negated"},
+		{"rule_id": "60", "active": "1", "match_pattern": "(", "error_msg": "bad regex"},
+		{"rule_id": "70", "active": "1", "apply": "1"},
+	})
+
+	var names []string
+	for _, rule := range qrs.CopyUnderlying() {
+		names = append(names, rule.Name)
+	}
+	assert.Equal(t, []string{"proxysql_rule_10", "proxysql_rule_20"}, names)
+
+	var reported []string
+	for _, issue := range issues {
+		reported = append(reported, issue.String())
+	}
+	assert.Equal(t, []string{
+		"rule_id 20: destination_hostgroup ignored: queries are routed by vtgate, see --read_write_splitting_policy",
+		"rule_id 30: destination_hostgroup rule skipped: queries are routed by vtgate, see --read_write_splitting_policy",
+		"rule_id 30: timeout rule skipped: the timeout of a query is set by vtgate, see the QUERY_TIMEOUT_MS comment directive",
+		"rule_id 40: flagin rule skipped: rules can't be chained",
+		"rule_id 50: negate_match_pattern rule skipped: query conditions can't be negated",
+		"rule_id 60: match_pattern rule skipped: error parsing regexp: missing closing ): `^(?is).*(?:().*$`",
+		"rule_id 70: error_msg rule skipped: the rule does nothing",
+	}, reported)
+
+	locks := qrs.Find("proxysql_rule_10")
+	assert.Equal(t, "no locks", locks.Description)
+	assert.Equal(t, 10, locks.Priority)
+	assert.Equal(t, rules.InActive, locks.Status)
+	locks.SetStatus(rules.Active)
+	matches := func(rule *rules.Rule, ip, user, query string, tables ...string) bool {
+		if rule.FilterByPlan(query, planbuilder.PlanSelect, tables) == nil {
+			return false
+		}
+		return rule.FilterByExecutionInfo(ip, user, "", false, nil, sqlparser.MarginComments{}) == rules.QRFail
+	}
+	assert.True(t, matches(locks, "10.0.0.3", "app.user", "select * from t FOR UPDATE", "db1.t"))
+	assert.False(t, matches(locks, "10.0.1.3", "app.user", "select * from t for update", "db1.t"))
+	assert.False(t, matches(locks, "10.0.0.3", "appXuser", "select * from t for update", "db1.t"))
+	assert.False(t, matches(locks, "10.0.0.3", "app.user", "select * from t for update", "db2.t"))
+
+	deletes := qrs.Find("proxysql_rule_20")
+	assert.Equal(t, rules.Active, deletes.Status)
+	assert.True(t, matches(deletes, "", "", "DELETE FROM t where id = 1"))
+	assert.False(t, matches(deletes, "", "", "delete from t where id = 1"))
+}
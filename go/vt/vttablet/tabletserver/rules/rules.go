@@ -30,6 +30,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"vitess.io/vitess/go/vt/log"
 
@@ -52,6 +54,14 @@ const (
 // Rules is used to store and execute rules for the tabletserver.
 type Rules struct {
 	rules []*Rule
+
+	// conflictPolicy tells which of the rules a query matches apply to it,
+	// see ConflictPolicy.
+	conflictPolicy ConflictPolicy
+
+	// matcher evaluates the literal query conditions of rules in one pass,
+	// it is built on first use by FilterByPlan.
+	matcher atomic.Pointer[queryMatcher]
 }
 
 func (qrs *Rules) ForEachRule(f func(rule *Rule)) {
@@ -82,6 +92,7 @@ func (qrs *Rules) Equal(other *Rules) bool {
 // A nil input produces a nil output.
 func (qrs *Rules) Copy() (newqrs *Rules) {
 	newqrs = New()
+	newqrs.conflictPolicy = qrs.conflictPolicy
 	if qrs.rules != nil {
 		newqrs.rules = make([]*Rule, 0, len(qrs.rules))
 		for _, qr := range qrs.rules {
@@ -128,9 +139,7 @@ func (qrs *Rules) Find(name string) (qr *Rule) {
 func (qrs *Rules) Delete(name string) (qr *Rule) {
 	for i, qr := range qrs.rules {
 		if qr.Name == name {
-			for j := i; j < len(qrs.rules)-i-1; j++ {
-				qrs.rules[j] = qrs.rules[j+1]
-			}
+			copy(qrs.rules[i:], qrs.rules[i+1:])
 			qrs.rules = qrs.rules[:len(qrs.rules)-1]
 			return qr
 		}
@@ -176,28 +185,79 @@ func (qrs *Rules) MarshalJSON() ([]byte, error) {
 // query, plans and fullyQualifiedTableNames predicates are empty.
 func (qrs *Rules) FilterByPlan(query string, planid planbuilder.PlanType, tableNames ...string) (newqrs *Rules) {
 	var newrules []*Rule
-	for _, qr := range qrs.rules {
-		if newrule := qr.FilterByPlan(query, planid, tableNames); newrule != nil {
+	queryMatch := qrs.queryMatcher().match(query)
+	defer queryMatch.release()
+	in := &evalInput{planType: planid, query: query, tableNames: tableNames}
+	for i, qr := range qrs.rules {
+		in.queryMatched = queryMatch.matches(i)
+		if newrule := qr.filterByPlan(in); newrule != nil {
 			newrules = append(newrules, newrule)
 		}
 	}
-	return &Rules{newrules}
+	return &Rules{rules: newrules}
+}
+
+// queryMatcher returns the matcher of the query conditions, building it
+// again if the rules changed since it was last built.
+func (qrs *Rules) queryMatcher() *queryMatcher {
+	if m := qrs.matcher.Load(); m != nil && m.valid(qrs.rules) {
+		return m
+	}
+	m := newQueryMatcher(qrs.rules)
+	qrs.matcher.Store(m)
+	return m
 }
 
 // GetAction runs the input against the rules engine and returns the action to be performed.
+// The rules are evaluated in the order of the action pipeline, up to the
+// first STOP rule which matches, and resolved by the conflict policy of the
+// rules. The DRY_RUN rules, and the rules with post execution conditions,
+// are skipped. The rules with access conditions don't match, without the
+// EXPLAIN of the query.
 // todo earayu: deprecate this function
 func (qrs *Rules) GetAction(
 	ip,
-	user string,
+	user,
+	workloadClass string,
+	inTransaction bool,
 	bindVars map[string]*querypb.BindVariable,
 	marginComments sqlparser.MarginComments,
 ) (action Action, cancelCtx context.Context, desc string) {
+	action, qr := qrs.GetActionRule(ip, user, workloadClass, inTransaction, bindVars, marginComments)
+	if qr == nil {
+		return QRContinue, nil, ""
+	}
+	return action, qr.cancelCtx, qr.Description
+}
+
+// GetActionRule is GetAction, but returns the rule of the action, nil if the
+// action is QRContinue.
+func (qrs *Rules) GetActionRule(
+	ip,
+	user,
+	workloadClass string,
+	inTransaction bool,
+	bindVars map[string]*querypb.BindVariable,
+	marginComments sqlparser.MarginComments,
+) (action Action, rule *Rule) {
+	var matched []*Rule
 	for _, qr := range qrs.rules {
-		if act := qr.GetAction(ip, user, bindVars, marginComments); act != QRContinue {
-			return act, qr.cancelCtx, qr.Description
+		if !qr.cancelled() && qr.MatchesExecutionInfo(ip, user, workloadClass, inTransaction, bindVars, marginComments) && qr.MatchesAccess(nil) {
+			matched = append(matched, qr)
+		}
+	}
+	for _, qr := range qrs.ConflictPolicy().Resolve(SortForPipeline(matched)) {
+		if qr.Status == DryRun || qr.outcomeConds != nil {
+			continue
+		}
+		if qr.act == QRStop {
+			break
+		}
+		if qr.act != QRContinue {
+			return qr.act, qr
 		}
 	}
-	return QRContinue, nil, ""
+	return QRContinue, nil
 }
 
 //-----------------------------------------------
@@ -230,21 +290,57 @@ type Rule struct {
 	query namedRegexp
 	// queryTemplate is the query template that will be used to match against the query
 	queryTemplate string
+	// queryDigest matches the digest of the query, see SetQueryDigestCond.
+	queryDigest string
+	// captures are the captures of the query regexp, which FilterByPlan
+	// sets, see Captures.
+	captures map[string]string
 
 	//===============Execution Specific Conditions================
 	// Regexp conditions. nil conditions are ignored (TRUE).
 	requestIP, user, leadingComment, trailingComment namedRegexp
+	// workloadClass matches the workload class of the session, which vtgate
+	// sends as the subcomponent of the effective caller.
+	workloadClass namedRegexp
+	// requestCIDRs match the client IP against CIDR ranges, see AddCIDRCond.
+	requestCIDRs []string
+	// userGroups match the user against the members of user groups, see
+	// AddUserGroupCond, and groupUsers are their members, see
+	// Rules.SetUserGroups.
+	userGroups []string
+	groupUsers map[string]bool
+	// inTransaction, if set, matches whether the query runs in an explicit
+	// transaction.
+	inTransaction *bool
 	// All BindVar conditions have to be fulfilled to make this true (AND)
 	bindVarConds []BindVarCond
+	// schedule, if set, limits the rule to the times it is active at.
+	schedule *Schedule
+	// expiresAt, if set, is the time the rule stops matching at, see
+	// SetExpiresAt.
+	expiresAt time.Time
+	// outcomeConds, if set, defer the action of the rule until the query ran
+	// and match its outcome.
+	outcomeConds *OutcomeConds
+	// accessConds, if set, match how MySQL accesses the tables of the query.
+	accessConds *AccessConds
 
 	// Action to be performed on trigger
 	act Action
 
 	actionArgs string
+	// action is the action built from act and actionArgs when the rule is
+	// loaded, see SetCompiledAction.
+	action any
+
+	// prog is the compiled form of the conditions, see program.
+	prog atomic.Pointer[program]
 }
 
 type namedRegexp struct {
 	name string
+	// negated is set if name is of the form (?!re), see newNamedRegexp.
+	negated bool
 	*regexp.Regexp
 }
 
@@ -295,13 +391,23 @@ func (qr *Rule) Equal(other *Rule) bool {
 		qr.Status == other.Status &&
 		qr.requestIP.Equal(other.requestIP) &&
 		qr.user.Equal(other.user) &&
+		qr.workloadClass.Equal(other.workloadClass) &&
+		reflect.DeepEqual(qr.requestCIDRs, other.requestCIDRs) &&
+		reflect.DeepEqual(qr.userGroups, other.userGroups) &&
+		reflect.DeepEqual(qr.groupUsers, other.groupUsers) &&
+		reflect.DeepEqual(qr.inTransaction, other.inTransaction) &&
 		qr.query.Equal(other.query) &&
 		qr.queryTemplate == other.queryTemplate &&
+		qr.queryDigest == other.queryDigest &&
 		qr.leadingComment.Equal(other.leadingComment) &&
 		qr.trailingComment.Equal(other.trailingComment) &&
 		reflect.DeepEqual(qr.plans, other.plans) &&
 		reflect.DeepEqual(qr.fullyQualifiedTableNames, other.fullyQualifiedTableNames) &&
 		reflect.DeepEqual(qr.bindVarConds, other.bindVarConds) &&
+		qr.GetSchedule() == other.GetSchedule() &&
+		qr.expiresAt.Equal(other.expiresAt) &&
+		qr.GetOutcomeConds() == other.GetOutcomeConds() &&
+		qr.GetAccessConds() == other.GetAccessConds() &&
 		qr.act == other.act &&
 		qr.actionArgs == other.actionArgs)
 }
@@ -315,13 +421,22 @@ func (qr *Rule) Copy() (newqr *Rule) {
 		Status:          qr.Status,
 		requestIP:       qr.requestIP,
 		user:            qr.user,
+		workloadClass:   qr.workloadClass,
 		query:           qr.query,
 		queryTemplate:   qr.queryTemplate,
+		queryDigest:     qr.queryDigest,
 		leadingComment:  qr.leadingComment,
 		trailingComment: qr.trailingComment,
+		inTransaction:   qr.inTransaction,
+		schedule:        qr.schedule,
+		expiresAt:       qr.expiresAt,
+		outcomeConds:    qr.outcomeConds,
+		accessConds:     qr.accessConds,
 		act:             qr.act,
 		actionArgs:      qr.actionArgs,
+		action:          qr.action,
 		cancelCtx:       qr.cancelCtx,
+		captures:        qr.captures,
 	}
 	if qr.plans != nil {
 		newqr.plans = make([]planbuilder.PlanType, len(qr.plans))
@@ -331,6 +446,20 @@ func (qr *Rule) Copy() (newqr *Rule) {
 		newqr.fullyQualifiedTableNames = make([]string, len(qr.fullyQualifiedTableNames))
 		copy(newqr.fullyQualifiedTableNames, qr.fullyQualifiedTableNames)
 	}
+	if qr.requestCIDRs != nil {
+		newqr.requestCIDRs = make([]string, len(qr.requestCIDRs))
+		copy(newqr.requestCIDRs, qr.requestCIDRs)
+	}
+	if qr.userGroups != nil {
+		newqr.userGroups = make([]string, len(qr.userGroups))
+		copy(newqr.userGroups, qr.userGroups)
+	}
+	if qr.groupUsers != nil {
+		newqr.groupUsers = make(map[string]bool, len(qr.groupUsers))
+		for user, member := range qr.groupUsers {
+			newqr.groupUsers[user] = member
+		}
+	}
 	if qr.bindVarConds != nil {
 		newqr.bindVarConds = make([]BindVarCond, len(qr.bindVarConds))
 		copy(newqr.bindVarConds, qr.bindVarConds)
@@ -348,13 +477,28 @@ func (qr *Rule) MarshalJSON() ([]byte, error) {
 	if qr.requestIP.Regexp != nil {
 		safeEncode(b, `,"RequestIP":`, qr.requestIP)
 	}
+	if qr.requestCIDRs != nil {
+		safeEncode(b, `,"RequestCIDRs":`, qr.requestCIDRs)
+	}
 	if qr.user.Regexp != nil {
 		safeEncode(b, `,"User":`, qr.user)
 	}
+	if qr.userGroups != nil {
+		safeEncode(b, `,"UserGroups":`, qr.userGroups)
+	}
+	if qr.inTransaction != nil {
+		safeEncode(b, `,"InTransaction":`, *qr.inTransaction)
+	}
+	if qr.workloadClass.Regexp != nil {
+		safeEncode(b, `,"WorkloadClass":`, qr.workloadClass)
+	}
 	if qr.query.Regexp != nil {
 		safeEncode(b, `,"Query":`, qr.query)
 	}
 	safeEncode(b, `,"QueryTemplate":`, qr.queryTemplate)
+	if qr.queryDigest != "" {
+		safeEncode(b, `,"QueryDigest":`, qr.queryDigest)
+	}
 	if qr.leadingComment.Regexp != nil {
 		safeEncode(b, `,"LeadingComment":`, qr.leadingComment)
 	}
@@ -370,6 +514,18 @@ func (qr *Rule) MarshalJSON() ([]byte, error) {
 	if qr.bindVarConds != nil {
 		safeEncode(b, `,"BindVarConds":`, qr.bindVarConds)
 	}
+	if qr.schedule != nil {
+		safeEncode(b, `,"Schedule":`, qr.schedule.String())
+	}
+	if !qr.expiresAt.IsZero() {
+		safeEncode(b, `,"ExpiresAt":`, qr.expiresAt.UTC().Format(time.RFC3339))
+	}
+	if qr.outcomeConds != nil {
+		safeEncode(b, `,"OutcomeConds":`, qr.outcomeConds.String())
+	}
+	if qr.accessConds != nil {
+		safeEncode(b, `,"AccessConds":`, qr.accessConds.String())
+	}
 	if qr.act != QRContinue {
 		safeEncode(b, `,"Action":`, qr.act)
 	}
@@ -387,12 +543,17 @@ func (qr *Rule) ToBindVariable() (map[string]*querypb.BindVariable, error) {
 		"status":                 sqltypes.StringBindVariable(qr.Status),
 		"query_regex":            sqltypes.StringBindVariable(qr.query.String()),
 		"query_template":         sqltypes.StringBindVariable(qr.queryTemplate),
+		"query_digest":           sqltypes.StringBindVariable(qr.queryDigest),
 		"request_ip_regex":       sqltypes.StringBindVariable(qr.requestIP.String()),
 		"user_regex":             sqltypes.StringBindVariable(qr.user.String()),
+		"workload_class_regex":   sqltypes.StringBindVariable(qr.workloadClass.String()),
 		"leading_comment_regex":  sqltypes.StringBindVariable(qr.leadingComment.String()),
 		"trailing_comment_regex": sqltypes.StringBindVariable(qr.trailingComment.String()),
 		"action":                 sqltypes.StringBindVariable(qr.act.String()),
 		"action_args":            sqltypes.StringBindVariable(qr.actionArgs),
+		"schedule":               sqltypes.StringBindVariable(qr.GetSchedule()),
+		"outcome_conds":          sqltypes.StringBindVariable(qr.GetOutcomeConds()),
+		"access_conds":           sqltypes.StringBindVariable(qr.GetAccessConds()),
 	}
 	if qr.plans != nil {
 		planStrings, err := json.Marshal(qr.plans)
@@ -415,6 +576,36 @@ func (qr *Rule) ToBindVariable() (map[string]*querypb.BindVariable, error) {
 	} else {
 		bindVars["fully_qualified_table_names"] = sqltypes.StringBindVariable("")
 	}
+	if qr.requestCIDRs != nil {
+		cidrs, err := json.Marshal(qr.requestCIDRs)
+		if err != nil {
+			log.Errorf("Failed to marshal request_cidrs: %v", err)
+			return nil, err
+		}
+		bindVars["request_cidrs"] = sqltypes.StringBindVariable(string(cidrs))
+	} else {
+		bindVars["request_cidrs"] = sqltypes.StringBindVariable("")
+	}
+	if qr.userGroups != nil {
+		groups, err := json.Marshal(qr.userGroups)
+		if err != nil {
+			log.Errorf("Failed to marshal user_groups: %v", err)
+			return nil, err
+		}
+		bindVars["user_groups"] = sqltypes.StringBindVariable(string(groups))
+	} else {
+		bindVars["user_groups"] = sqltypes.StringBindVariable("")
+	}
+	if qr.inTransaction != nil {
+		bindVars["in_transaction"] = sqltypes.BoolBindVariable(*qr.inTransaction)
+	} else {
+		bindVars["in_transaction"] = sqltypes.NullBindVariable
+	}
+	if !qr.expiresAt.IsZero() {
+		bindVars["expires_at"] = sqltypes.StringBindVariable(qr.expiresAt.UTC().Format(ExpiresAtLayout))
+	} else {
+		bindVars["expires_at"] = sqltypes.NullBindVariable
+	}
 	if qr.bindVarConds != nil {
 		bindVarConds, err := json.Marshal(qr.bindVarConds)
 		if err != nil {
@@ -428,6 +619,16 @@ func (qr *Rule) ToBindVariable() (map[string]*querypb.BindVariable, error) {
 	return bindVars, nil
 }
 
+// RunsBefore returns whether the action of the rule runs before the one of
+// another rule in the action pipeline of a query: the rules of the smaller
+// priorities run first, and the ones of the same priority by name.
+func (qr *Rule) RunsBefore(other *Rule) bool {
+	if qr.Priority != other.Priority {
+		return qr.Priority < other.Priority
+	}
+	return qr.Name < other.Name
+}
+
 // SetPriority sets the priority of the rule.
 func (qr *Rule) SetPriority(priority int) {
 	qr.Priority = priority
@@ -441,66 +642,172 @@ func (qr *Rule) SetStatus(status string) {
 // SetQueryTemplate sets the query template of the rule.
 func (qr *Rule) SetQueryTemplate(queryTemplate string) {
 	qr.queryTemplate = queryTemplate
+	qr.invalidate()
 }
 
 // SetAction sets the action of the rule.
 func (qr *Rule) SetAction(act Action) {
 	qr.act = act
+	qr.action = nil
 }
 
 // SetActionArgs sets the action arguments of the rule.
 func (qr *Rule) SetActionArgs(actionArgs string) {
 	qr.actionArgs = actionArgs
+	qr.action = nil
+}
+
+// CompiledAction returns the action set by SetCompiledAction, nil if there is
+// none or the action or its args changed since.
+func (qr *Rule) CompiledAction() any {
+	return qr.action
+}
+
+// SetCompiledAction sets the action built from the action and the args of the
+// rule, with its params validated and parsed, when the rule is loaded. The
+// copies of the rule share it, so the queries it matches don't parse the
+// params again.
+func (qr *Rule) SetCompiledAction(action any) {
+	qr.action = action
 }
 
 // SetIPCond adds a regular expression condition for the client IP.
 // It has to be a full match (not substring).
+// A pattern of the form (?!re) negates the condition re.
 func (qr *Rule) SetIPCond(pattern string) (err error) {
-	qr.requestIP.name = pattern
-	qr.requestIP.Regexp, err = regexp.Compile(makeExact(pattern))
+	qr.invalidate()
+	qr.requestIP, err = newNamedRegexp(pattern)
 	return err
 }
 
+// AddCIDRCond adds to the CIDR ranges the client IP is matched against, like
+// 10.0.0.0/8 or a single IP. A range starting with ! excludes its IPs instead.
+// The condition holds for the IPs of one of the ranges, or of any range if
+// they are all excluded ones, and of none of the excluded ranges, so that
+// ["!10.0.0.0/8"] matches the clients outside of 10.0.0.0/8.
+func (qr *Rule) AddCIDRCond(cidr string) error {
+	if _, _, err := parseCIDR(cidr); err != nil {
+		return err
+	}
+	qr.requestCIDRs = append(qr.requestCIDRs, cidr)
+	qr.invalidate()
+	return nil
+}
+
 // SetUserCond adds a regular expression condition for the user name
 // used by the client.
+// A pattern of the form (?!re) negates the condition re.
 func (qr *Rule) SetUserCond(pattern string) (err error) {
-	qr.user.name = pattern
-	qr.user.Regexp, err = regexp.Compile(makeExact(pattern))
+	qr.invalidate()
+	qr.user, err = newNamedRegexp(pattern)
 	return
 }
 
+// AddUserGroupCond adds to the user groups the user is matched against. A
+// group starting with ! excludes its members instead. The condition holds for
+// the members of one of the groups, or of any group if they are all excluded
+// ones, and of none of the excluded groups, which the rule only knows once
+// Rules.SetUserGroups set them: until then it holds for no user, and the
+// groups without members have none to match or exclude.
+func (qr *Rule) AddUserGroupCond(group string) error {
+	if name, _ := negatedCond(group); name == "" {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "empty user group")
+	}
+	qr.userGroups = append(qr.userGroups, group)
+	qr.invalidate()
+	return nil
+}
+
+// SetInTransactionCond adds a condition on whether the query runs in an
+// explicit transaction: if inTransaction is false, the rule only matches the
+// queries which don't, like the autocommit ones.
+func (qr *Rule) SetInTransactionCond(inTransaction bool) {
+	qr.inTransaction = &inTransaction
+	qr.invalidate()
+}
+
+// SetWorkloadClassCond adds a regular expression condition for the
+// workload class of the session.
+// A pattern of the form (?!re) negates the condition re.
+func (qr *Rule) SetWorkloadClassCond(pattern string) (err error) {
+	qr.invalidate()
+	qr.workloadClass, err = newNamedRegexp(pattern)
+	return
+}
+
+// SetSchedule sets the activation schedule of the rule, see Schedule. An empty
+// spec removes it.
+func (qr *Rule) SetSchedule(spec string) (err error) {
+	if spec == "" {
+		qr.schedule = nil
+		return nil
+	}
+	qr.schedule, err = ParseSchedule(spec)
+	return err
+}
+
+// SetOutcomeConds sets the post execution conditions of the rule, see
+// OutcomeConds. An empty spec removes them.
+func (qr *Rule) SetOutcomeConds(spec string) (err error) {
+	if spec == "" {
+		qr.outcomeConds = nil
+		return nil
+	}
+	qr.outcomeConds, err = ParseOutcomeConds(spec)
+	return err
+}
+
+// SetAccessConds sets the access conditions of the rule, see AccessConds. An
+// empty spec removes them.
+func (qr *Rule) SetAccessConds(spec string) (err error) {
+	if spec == "" {
+		qr.accessConds = nil
+		return nil
+	}
+	qr.accessConds, err = ParseAccessConds(spec)
+	return err
+}
+
 // AddPlanCond adds to the list of plans that can be matched for
 // the rule to fire.
 // This function acts as an OR: Any plan id match is considered a match.
 func (qr *Rule) AddPlanCond(planType planbuilder.PlanType) {
 	qr.plans = append(qr.plans, planType)
+	qr.invalidate()
 }
 
 // AddTableCond adds to the list of fullyQualifiedTableNames that can be matched for
 // the rule to fire.
 // This function acts as an OR: Any tableName match is considered a match.
+// A tableName starting with ! excludes its tables instead: the queries on one
+// of them don't match, and if all the tableNames are excluded ones the
+// queries on the other tables do.
 func (qr *Rule) AddTableCond(tableName string) {
 	qr.fullyQualifiedTableNames = append(qr.fullyQualifiedTableNames, tableName)
+	qr.invalidate()
 }
 
 // SetQueryCond adds a regular expression condition for the query.
+// A pattern of the form (?!re) negates the condition re.
 func (qr *Rule) SetQueryCond(pattern string) (err error) {
-	qr.query.name = pattern
-	qr.query.Regexp, err = regexp.Compile(makeExact(pattern))
+	qr.invalidate()
+	qr.query, err = newNamedRegexp(pattern)
 	return
 }
 
 // SetLeadingCommentCond adds a regular expression condition for a leading query comment.
+// A pattern of the form (?!re) negates the condition re.
 func (qr *Rule) SetLeadingCommentCond(pattern string) (err error) {
-	qr.leadingComment.name = pattern
-	qr.leadingComment.Regexp, err = regexp.Compile(makeExact(pattern))
+	qr.invalidate()
+	qr.leadingComment, err = newNamedRegexp(pattern)
 	return
 }
 
 // SetTrailingCommentCond adds a regular expression condition for a trailing query comment.
+// A pattern of the form (?!re) negates the condition re.
 func (qr *Rule) SetTrailingCommentCond(pattern string) (err error) {
-	qr.trailingComment.name = pattern
-	qr.trailingComment.Regexp, err = regexp.Compile(makeExact(pattern))
+	qr.invalidate()
+	qr.trailingComment, err = newNamedRegexp(pattern)
 	return
 }
 
@@ -530,6 +837,7 @@ func (qr *Rule) AddBindVarCond(name string, onAbsent, onMismatch bool, op Operat
 	var converted bvcValue
 	if op == QRNoOp {
 		qr.bindVarConds = append(qr.bindVarConds, BindVarCond{name, onAbsent, onMismatch, op, nil})
+		qr.invalidate()
 		return nil
 	}
 	switch v := value.(type) {
@@ -561,6 +869,7 @@ func (qr *Rule) AddBindVarCond(name string, onAbsent, onMismatch bool, op Operat
 		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "type %T not allowed as condition operand (%v)", value, value)
 	}
 	qr.bindVarConds = append(qr.bindVarConds, BindVarCond{name, onAbsent, onMismatch, op, converted})
+	qr.invalidate()
 	return nil
 
 Error:
@@ -572,22 +881,23 @@ Error:
 // than the plan and query. If the plan and query don't match the Rule,
 // then it returns nil.
 func (qr *Rule) FilterByPlan(query string, planType planbuilder.PlanType, tableNames []string) (newqr *Rule) {
+	return qr.filterByPlan(&evalInput{planType: planType, query: query, queryMatched: qr.query.match(query), tableNames: tableNames})
+}
+
+// filterByPlan is FilterByPlan with the query condition already evaluated.
+func (qr *Rule) filterByPlan(in *evalInput) (newqr *Rule) {
 	if qr.Status == InActive {
 		return nil
 	}
-	if !planMatch(qr.plans, planType) {
-		return nil
-	}
-	if !fullyQualifiedTableNameRegexMatch(qr.fullyQualifiedTableNames, tableNames) {
-		return nil
-	}
-	if !reMatch(qr.query.Regexp, query) {
-		return nil
-	}
-	if !queryTemplateMatch(qr.queryTemplate, query) {
+	p := qr.program()
+	if !p.run(p.planCode, in) {
 		return nil
 	}
 	newqr = qr.Copy()
+	if qr.query.Regexp != nil && !qr.query.negated && qr.query.NumSubexp() > 0 {
+		newqr.captures = make(map[string]string)
+		qr.query.captures(in.query, newqr.captures)
+	}
 	newqr.query = namedRegexp{}
 	// Note we explicitly don't remove the leading/trailing comments as they
 	// must be evaluated at execution time.
@@ -599,66 +909,80 @@ func (qr *Rule) FilterByPlan(query string, planType planbuilder.PlanType, tableN
 // GetAction returns the action for a single rule.
 func (qr *Rule) GetAction(
 	ip,
-	user string,
+	user,
+	workloadClass string,
+	inTransaction bool,
 	bindVars map[string]*querypb.BindVariable,
 	marginComments sqlparser.MarginComments,
 ) Action {
+	if qr.cancelled() || !qr.MatchesExecutionInfo(ip, user, workloadClass, inTransaction, bindVars, marginComments) {
+		return QRContinue
+	}
+	return qr.act
+}
+
+// cancelled returns whether the rule was dynamically cancelled.
+func (qr *Rule) cancelled() bool {
 	if qr.cancelCtx != nil {
 		select {
 		case <-qr.cancelCtx.Done():
 			// rule was cancelled. Nothing else to check
-			return QRContinue
+			return true
 		default:
 			// rule will be cancelled in the future. Until then, it applies!
 			// proceed to evaluate rules
 		}
 	}
-	if !reMatch(qr.user.Regexp, user) {
-		return QRContinue
-	}
-	if !reMatch(qr.requestIP.Regexp, ip) {
-		return QRContinue
-	}
-	if !reMatch(qr.leadingComment.Regexp, marginComments.Leading) {
-		return QRContinue
-	}
-	if !reMatch(qr.trailingComment.Regexp, marginComments.Trailing) {
-		return QRContinue
-	}
-	for _, bvcond := range qr.bindVarConds {
-		if !bvMatch(bvcond, bindVars) {
-			return QRContinue
-		}
+	return false
+}
+
+// Namespace returns the database which qualifies the name of the rule, like db
+// in db.rule, if any.
+func (qr *Rule) Namespace() string {
+	namespace, _, qualified := strings.Cut(qr.Name, ".")
+	if !qualified {
+		return ""
 	}
-	return qr.act
+	return namespace
 }
 
 func (qr *Rule) FilterByExecutionInfo(
 	ip,
-	user string,
+	user,
+	workloadClass string,
+	inTransaction bool,
 	bindVars map[string]*querypb.BindVariable,
 	marginComments sqlparser.MarginComments,
 ) Action {
-	if !reMatch(qr.user.Regexp, user) {
-		return QRContinue
-	}
-	if !reMatch(qr.requestIP.Regexp, ip) {
+	if !qr.MatchesExecutionInfo(ip, user, workloadClass, inTransaction, bindVars, marginComments) {
 		return QRContinue
 	}
-	if !reMatch(qr.leadingComment.Regexp, marginComments.Leading) {
-		return QRContinue
-	}
-	if !reMatch(qr.trailingComment.Regexp, marginComments.Trailing) {
-		return QRContinue
-	}
-	for _, bvcond := range qr.bindVarConds {
-		if !bvMatch(bvcond, bindVars) {
-			return QRContinue
-		}
-	}
 	return qr.act
 }
 
+// MatchesExecutionInfo returns whether the execution conditions of the rule
+// match, so that its action applies to the query, even a CONTINUE one.
+func (qr *Rule) MatchesExecutionInfo(
+	ip,
+	user,
+	workloadClass string,
+	inTransaction bool,
+	bindVars map[string]*querypb.BindVariable,
+	marginComments sqlparser.MarginComments,
+) bool {
+	if !qr.activeAt(time.Now()) {
+		return false
+	}
+	p := qr.program()
+	return p.run(p.execCode, &evalInput{ip: ip, user: user, workloadClass: workloadClass, inTransaction: inTransaction, bindVars: bindVars, marginComments: marginComments})
+}
+
+// activeAt returns whether the schedule of the rule, if any, is active at t,
+// and the rule didn't expire.
+func (qr *Rule) activeAt(t time.Time) bool {
+	return (qr.schedule == nil || qr.schedule.Active(t)) && !qr.Expired(t)
+}
+
 func reMatch(re *regexp.Regexp, val string) bool {
 	return re == nil || re.MatchString(val)
 }
@@ -667,18 +991,6 @@ func queryTemplateMatch(expect string, actual string) bool {
 	return expect == "" || expect == actual
 }
 
-func planMatch(plans []planbuilder.PlanType, plan planbuilder.PlanType) bool {
-	if plans == nil {
-		return true
-	}
-	for _, p := range plans {
-		if p == plan {
-			return true
-		}
-	}
-	return false
-}
-
 func compileRegex(pattern string) (*regexp.Regexp, error) {
 	regexPattern := strings.Replace(pattern, ".", "\\.", -1)
 	regexPattern = strings.Replace(regexPattern, "*", ".*", -1)
@@ -698,33 +1010,8 @@ func fullyQualifiedTableNameRegexMatch(expectedFullyQualifiedTableNames []string
 	if expectedFullyQualifiedTableNames == nil {
 		return true
 	}
-
-	for _, expected := range expectedFullyQualifiedTableNames {
-		expectedParts := strings.Split(expected, ".")
-		if len(expectedParts) != 2 {
-			log.Errorf("expectedFullyQualifiedTableNames is not fully qualified table name, expected:%v", expected)
-			return false
-		}
-		databaseNameRegex, err1 := compileRegex(expectedParts[0])
-		tableNameRegex, err2 := compileRegex(expectedParts[1])
-		if err1 != nil || err2 != nil {
-			log.Errorf("err of compileRegex is not nil, err1:%v, err2:%v", err1, err2)
-			return false
-		}
-		for _, actual := range fullyQualifiedTableNames {
-			actualParts := strings.Split(actual, ".")
-			if len(actualParts) != 2 {
-				log.Errorf("fullyQualifiedTableNames is not fully qualified table name, actual:%v", actual)
-				return false
-			}
-			databaseMatched := databaseNameRegex.MatchString(actualParts[0])
-			tableMatched := tableNameRegex.MatchString(actualParts[1])
-			if databaseMatched && tableMatched {
-				return true
-			}
-		}
-	}
-	return false
+	p := &program{tables: compileTablePatterns(expectedFullyQualifiedTableNames)}
+	return p.matchTables(fullyQualifiedTableNames)
 }
 
 func bvMatch(bvcond BindVarCond, bindVars map[string]*querypb.BindVariable) bool {
@@ -753,6 +1040,29 @@ const (
 	QRBuffer
 	QRConcurrencyControl
 	QRPlugin
+	QRResourceGroup
+	QRThrottle
+	QRSleep
+	QRRewrite
+	QRRedirect
+	QRCacheResult
+	QRRateLimit
+	QRAudit
+	QRTimeoutOverride
+	QRSample
+	QRMirror
+	QRDegrade
+	QRReadOnlyGuard
+	QRWebhookNotify
+	QRQueryTag
+	QRCircuitBreaker
+	QRPriority
+	QRDataMasking
+	QRSQLInjectionDetect
+	QRAutoLimit
+	QRKill
+	QRRetryWithBackoff
+	QRStop
 )
 
 func ParseStringToAction(s string) (Action, error) {
@@ -769,6 +1079,52 @@ func ParseStringToAction(s string) (Action, error) {
 		return QRConcurrencyControl, nil
 	case "PLUGIN":
 		return QRPlugin, nil
+	case "RESOURCE_GROUP":
+		return QRResourceGroup, nil
+	case "THROTTLE":
+		return QRThrottle, nil
+	case "SLEEP":
+		return QRSleep, nil
+	case "REWRITE":
+		return QRRewrite, nil
+	case "REDIRECT":
+		return QRRedirect, nil
+	case "CACHE_RESULT":
+		return QRCacheResult, nil
+	case "RATE_LIMIT":
+		return QRRateLimit, nil
+	case "AUDIT":
+		return QRAudit, nil
+	case "TIMEOUT_OVERRIDE":
+		return QRTimeoutOverride, nil
+	case "SAMPLE":
+		return QRSample, nil
+	case "MIRROR":
+		return QRMirror, nil
+	case "DEGRADE":
+		return QRDegrade, nil
+	case "READ_ONLY_GUARD":
+		return QRReadOnlyGuard, nil
+	case "WEBHOOK_NOTIFY":
+		return QRWebhookNotify, nil
+	case "QUERY_TAG":
+		return QRQueryTag, nil
+	case "CIRCUIT_BREAKER":
+		return QRCircuitBreaker, nil
+	case "PRIORITY":
+		return QRPriority, nil
+	case "DATA_MASKING":
+		return QRDataMasking, nil
+	case "SQL_INJECTION_DETECT":
+		return QRSQLInjectionDetect, nil
+	case "AUTO_LIMIT":
+		return QRAutoLimit, nil
+	case "KILL":
+		return QRKill, nil
+	case "RETRY_WITH_BACKOFF":
+		return QRRetryWithBackoff, nil
+	case "STOP":
+		return QRStop, nil
 	default:
 		return QRContinue, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid Action %s", s)
 	}
@@ -788,6 +1144,52 @@ func (act Action) ToString() string {
 		return "CONCURRENCY_CONTROL"
 	case QRPlugin:
 		return "PLUGIN"
+	case QRResourceGroup:
+		return "RESOURCE_GROUP"
+	case QRThrottle:
+		return "THROTTLE"
+	case QRSleep:
+		return "SLEEP"
+	case QRRewrite:
+		return "REWRITE"
+	case QRRedirect:
+		return "REDIRECT"
+	case QRCacheResult:
+		return "CACHE_RESULT"
+	case QRRateLimit:
+		return "RATE_LIMIT"
+	case QRAudit:
+		return "AUDIT"
+	case QRTimeoutOverride:
+		return "TIMEOUT_OVERRIDE"
+	case QRSample:
+		return "SAMPLE"
+	case QRMirror:
+		return "MIRROR"
+	case QRDegrade:
+		return "DEGRADE"
+	case QRReadOnlyGuard:
+		return "READ_ONLY_GUARD"
+	case QRWebhookNotify:
+		return "WEBHOOK_NOTIFY"
+	case QRQueryTag:
+		return "QUERY_TAG"
+	case QRCircuitBreaker:
+		return "CIRCUIT_BREAKER"
+	case QRPriority:
+		return "PRIORITY"
+	case QRDataMasking:
+		return "DATA_MASKING"
+	case QRSQLInjectionDetect:
+		return "SQL_INJECTION_DETECT"
+	case QRAutoLimit:
+		return "AUTO_LIMIT"
+	case QRKill:
+		return "KILL"
+	case QRRetryWithBackoff:
+		return "RETRY_WITH_BACKOFF"
+	case QRStop:
+		return "STOP"
 	default:
 		return "INVALID"
 	}
@@ -806,11 +1208,14 @@ func (act Action) MarshalJSON() ([]byte, error) {
 const (
 	Active   = "ACTIVE"
 	InActive = "INACTIVE"
+	// DryRun rules only record what their actions would do to the queries
+	// they match.
+	DryRun = "DRY_RUN"
 )
 
 func StatusIsValid(status string) bool {
 	switch status {
-	case Active, InActive:
+	case Active, InActive, DryRun:
 		return true
 	}
 	return false
@@ -1080,7 +1485,7 @@ func getint64(val *querypb.BindVariable) (iv int64, status int) {
 
 // TODO(sougou): this is inefficient. Optimize to use []byte.
 func getstring(val *querypb.BindVariable) (s string, status int) {
-	if sqltypes.IsIntegral(val.Type) || sqltypes.IsFloat(val.Type) || sqltypes.IsText(val.Type) || sqltypes.IsBinary(val.Type) {
+	if sqltypes.IsNumber(val.Type) || sqltypes.IsDate(val.Type) || sqltypes.IsText(val.Type) || sqltypes.IsBinary(val.Type) {
 		return string(val.Value), QROK
 	}
 	return "", QRMismatch
@@ -1104,11 +1509,12 @@ func BuildQueryRule(ruleInfo map[string]any) (qr *Rule, err error) {
 		var sv string
 		var iv int
 		var lv []any
+		var bv bool
 		var ok bool
 		switch k {
-		case "Name", "Description", "RequestIP", "User", "Query",
+		case "Name", "Description", "RequestIP", "User", "WorkloadClass", "Query",
 			"Action", "LeadingComment", "TrailingComment", "Status",
-			"QueryTemplate", "ActionArgs":
+			"QueryTemplate", "QueryDigest", "ActionArgs", "Schedule", "OutcomeConds", "AccessConds", "ExpiresAt":
 			sv, ok = v.(string)
 			if !ok {
 				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "want string for %s", k)
@@ -1126,7 +1532,12 @@ func BuildQueryRule(ruleInfo map[string]any) (qr *Rule, err error) {
 			if !ok {
 				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "want int for Priority")
 			}
-		case "Plans", "BindVarConds", "FullyQualifiedTableNames":
+		case "InTransaction":
+			bv, ok = v.(bool)
+			if !ok {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "want bool for InTransaction")
+			}
+		case "Plans", "BindVarConds", "FullyQualifiedTableNames", "RequestCIDRs", "UserGroups":
 			lv, ok = v.([]any)
 			if !ok {
 				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "want list for %s", k)
@@ -1151,18 +1562,49 @@ func BuildQueryRule(ruleInfo map[string]any) (qr *Rule, err error) {
 			if err != nil {
 				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not set IP condition: %v", sv)
 			}
+		case "RequestCIDRs":
+			for _, c := range lv {
+				cidr, ok := c.(string)
+				if !ok {
+					return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "want string for RequestCIDRs")
+				}
+				if err := qr.AddCIDRCond(cidr); err != nil {
+					return nil, err
+				}
+			}
+		case "InTransaction":
+			qr.SetInTransactionCond(bv)
+		case "UserGroups":
+			for _, g := range lv {
+				group, ok := g.(string)
+				if !ok {
+					return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "want string for UserGroups")
+				}
+				if err := qr.AddUserGroupCond(group); err != nil {
+					return nil, err
+				}
+			}
 		case "User":
 			err = qr.SetUserCond(sv)
 			if err != nil {
 				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not set User condition: %v", sv)
 			}
+		case "WorkloadClass":
+			err = qr.SetWorkloadClassCond(sv)
+			if err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not set WorkloadClass condition: %v", sv)
+			}
 		case "Query":
 			err = qr.SetQueryCond(sv)
 			if err != nil {
 				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not set Query condition: %v", sv)
 			}
 		case "QueryTemplate":
-			qr.queryTemplate = sv
+			qr.SetQueryTemplate(sv)
+		case "QueryDigest":
+			if err := qr.SetQueryDigestCond(sv); err != nil {
+				return nil, err
+			}
 		case "LeadingComment":
 			err = qr.SetLeadingCommentCond(sv)
 			if err != nil {
@@ -1215,6 +1657,27 @@ func BuildQueryRule(ruleInfo map[string]any) (qr *Rule, err error) {
 			qr.act = act
 		case "ActionArgs":
 			qr.actionArgs = sv
+		case "Schedule":
+			err = qr.SetSchedule(sv)
+			if err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not set Schedule: %v", err)
+			}
+		case "ExpiresAt":
+			expiresAt, err := parseExpiresAt(sv)
+			if err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not set ExpiresAt: %v", err)
+			}
+			qr.SetExpiresAt(expiresAt)
+		case "OutcomeConds":
+			err = qr.SetOutcomeConds(sv)
+			if err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not set OutcomeConds: %v", err)
+			}
+		case "AccessConds":
+			err = qr.SetAccessConds(sv)
+			if err != nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not set AccessConds: %v", err)
+			}
 		}
 	}
 	return qr, nil
@@ -1334,3 +1797,50 @@ func (qr *Rule) GetActionArgs() string {
 func (qr *Rule) GetActionType() string {
 	return qr.act.ToString()
 }
+
+// Act returns the action of the rule.
+func (qr *Rule) Act() Action {
+	return qr.act
+}
+
+// ValidateActionArgs validates the action args of the rule against the schema
+// of its action, see ActionSchema, and checks that its params which take
+// captures only reference the captures of the rule.
+func (qr *Rule) ValidateActionArgs() error {
+	if err := ValidateActionArgs(qr.act, qr.actionArgs); err != nil {
+		return err
+	}
+	return qr.ValidateCaptureRefs()
+}
+
+// GetSchedule returns the spec of the schedule of the rule, or "" if it has none.
+func (qr *Rule) GetSchedule() string {
+	if qr.schedule == nil {
+		return ""
+	}
+	return qr.schedule.String()
+}
+
+// GetOutcomeConds returns the spec of the post execution conditions of the
+// rule, or "" if it has none.
+func (qr *Rule) GetOutcomeConds() string {
+	if qr.outcomeConds == nil {
+		return ""
+	}
+	return qr.outcomeConds.String()
+}
+
+// OutcomeConds returns the post execution conditions of the rule, or nil if it
+// has none.
+func (qr *Rule) OutcomeConds() *OutcomeConds {
+	return qr.outcomeConds
+}
+
+// GetAccessConds returns the spec of the access conditions of the rule, or ""
+// if it has none.
+func (qr *Rule) GetAccessConds() string {
+	if qr.accessConds == nil {
+		return ""
+	}
+	return qr.accessConds.String()
+}
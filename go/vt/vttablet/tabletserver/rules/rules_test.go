@@ -427,6 +427,11 @@ var bvtestcases = []BindVarTestCase{
 	{BindVarCond{"a", true, true, QRLessEqual, bvcstring("b")}, sqltypes.StringBindVariable("b"), true},
 	{BindVarCond{"a", true, true, QRLessEqual, bvcstring("b")}, sqltypes.StringBindVariable("c"), false},
 
+	// The dates and the decimals of the params of the prepared statements.
+	{BindVarCond{"a", true, false, QRGreaterEqual, bvcstring("2024-01-01")}, sqltypes.ValueBindVariable(sqltypes.MakeTrusted(sqltypes.Datetime, []byte("2024-03-01 10:00:00"))), true},
+	{BindVarCond{"a", true, false, QRGreaterEqual, bvcstring("2024-01-01")}, sqltypes.ValueBindVariable(sqltypes.MakeTrusted(sqltypes.Date, []byte("2023-12-31"))), false},
+	{BindVarCond{"a", true, false, QREqual, bvcstring("1.50")}, sqltypes.ValueBindVariable(sqltypes.MakeTrusted(sqltypes.Decimal, []byte("1.50"))), true},
+
 	{BindVarCond{"a", true, true, QRMatch, makere("a.*")}, sqltypes.StringBindVariable("c"), false},
 	{BindVarCond{"a", true, true, QRMatch, makere("a.*")}, sqltypes.StringBindVariable("a"), true},
 	{BindVarCond{"a", true, true, QRMatch, makere("a.*")}, sqltypes.Int64BindVariable(1), false},
@@ -475,21 +480,21 @@ func TestAction(t *testing.T) {
 		Trailing: "other trailing comments",
 	}
 
-	action, cancelCtx, desc := qrs.GetAction("123", "user1", bv, mc)
+	action, cancelCtx, desc := qrs.GetAction("123", "user1", "", false, bv, mc)
 	assert.Equalf(t, action, QRFail, "expected fail, got %v", action)
 	assert.Equalf(t, desc, "rule 1", "want rule 1, got %s", desc)
 	assert.Nil(t, cancelCtx)
 
-	action, cancelCtx, desc = qrs.GetAction("1234", "user", bv, mc)
+	action, cancelCtx, desc = qrs.GetAction("1234", "user", "", false, bv, mc)
 	assert.Equalf(t, action, QRFailRetry, "want fail_retry, got: %s", action)
 	assert.Equalf(t, desc, "rule 2", "want rule 2, got %s", desc)
 	assert.Nil(t, cancelCtx)
 
-	action, _, _ = qrs.GetAction("1234", "user1", bv, mc)
+	action, _, _ = qrs.GetAction("1234", "user1", "", false, bv, mc)
 	assert.Equalf(t, action, QRContinue, "want continue, got %s", action)
 
 	bv["a"] = sqltypes.Uint64BindVariable(1)
-	action, _, desc = qrs.GetAction("1234", "user1", bv, mc)
+	action, _, desc = qrs.GetAction("1234", "user1", "", false, bv, mc)
 	assert.Equalf(t, action, QRFail, "want fail, got %s", action)
 	assert.Equalf(t, desc, "rule 3", "want rule 3, got %s", desc)
 
@@ -502,7 +507,7 @@ func TestAction(t *testing.T) {
 	newQrs := qrs.Copy()
 	newQrs.Add(qr4)
 
-	action, _, desc = newQrs.GetAction("1234", "user1", bv, mc)
+	action, _, desc = newQrs.GetAction("1234", "user1", "", false, bv, mc)
 	assert.Equalf(t, action, QRFail, "want fail, got %s", action)
 	assert.Equalf(t, desc, "rule 4", "want rule 4, got %s", desc)
 
@@ -511,14 +516,69 @@ func TestAction(t *testing.T) {
 
 	newQrs = qrs.Copy()
 	newQrs.Add(qr5)
-	action, _, desc = newQrs.GetAction("1234", "user1", bv, mc)
+	action, _, desc = newQrs.GetAction("1234", "user1", "", false, bv, mc)
 	assert.Equalf(t, action, QRFail, "want fail, got %s", action)
 	assert.Equalf(t, desc, "rule 5", "want rule 5, got %s", desc)
 }
 
+func TestActionOrder(t *testing.T) {
+	bv := make(map[string]*querypb.BindVariable)
+	mc := sqlparser.MarginComments{}
+
+	// The rules are evaluated by priority, then by name.
+	qr1 := NewActiveQueryRule("rule 1", "b", QRFail)
+	qr2 := NewActiveQueryRule("rule 2", "a", QRFailRetry)
+	qrs := New()
+	qrs.Add(qr1)
+	qrs.Add(qr2)
+	action, _, desc := qrs.GetAction("", "", "", false, bv, mc)
+	assert.Equal(t, QRFailRetry, action)
+	assert.Equal(t, "rule 2", desc)
+
+	qr1.SetPriority(-1)
+	action, _, desc = qrs.GetAction("", "", "", false, bv, mc)
+	assert.Equal(t, QRFail, action)
+	assert.Equal(t, "rule 1", desc)
+
+	// A STOP rule skips the rules after it.
+	stop := NewActiveQueryRule("stop", "stop", QRStop)
+	stop.SetPriority(-2)
+	qrs.Add(stop)
+	action, _, _ = qrs.GetAction("", "", "", false, bv, mc)
+	assert.Equal(t, QRContinue, action)
+
+	stop.SetPriority(0)
+	action, _, desc = qrs.GetAction("", "", "", false, bv, mc)
+	assert.Equal(t, QRFail, action)
+	assert.Equal(t, "rule 1", desc)
+
+	// The DRY_RUN rules don't take effect.
+	qr1.SetStatus(DryRun)
+	action, _, desc = qrs.GetAction("", "", "", false, bv, mc)
+	assert.Equal(t, QRFailRetry, action)
+	assert.Equal(t, "rule 2", desc)
+}
+
+func TestInTransactionCond(t *testing.T) {
+	qr := NewActiveQueryRule("", "r1", QRFail)
+	assert.Equal(t, QRFail, qr.FilterByExecutionInfo("", "", "", true, nil, sqlparser.MarginComments{}))
+	assert.Equal(t, QRFail, qr.FilterByExecutionInfo("", "", "", false, nil, sqlparser.MarginComments{}))
+
+	qr.SetInTransactionCond(true)
+	assert.Equal(t, QRFail, qr.FilterByExecutionInfo("", "", "", true, nil, sqlparser.MarginComments{}))
+	assert.Equal(t, QRContinue, qr.FilterByExecutionInfo("", "", "", false, nil, sqlparser.MarginComments{}))
+
+	// The autocommit queries.
+	qr.SetInTransactionCond(false)
+	assert.Equal(t, QRContinue, qr.FilterByExecutionInfo("", "", "", true, nil, sqlparser.MarginComments{}))
+	assert.Equal(t, QRFail, qr.FilterByExecutionInfo("", "", "", false, nil, sqlparser.MarginComments{}))
+	assert.True(t, qr.Equal(qr.Copy()))
+	assert.False(t, qr.Equal(NewActiveQueryRule("", "r1", QRFail)))
+}
+
 func TestImport(t *testing.T) {
 	var qrs = New()
-	jsondata := `[{"Description":"desc1","Name":"name1","Priority":0,"Status":"ACTIVE","RequestIP":"123.123.123","User":"user","Query":"query","QueryTemplate":"","Plans":["Select","Insert"],"FullyQualifiedTableNames":["d.a","d.b"],"BindVarConds":[{"Name":"bvname1","OnAbsent":true,"Operator":""},{"Name":"bvname2","OnAbsent":true,"OnMismatch":true,"Operator":"==","Value":123}],"Action":"FAIL_RETRY","ActionArgs":""},{"Description":"desc2","Name":"name2","Priority":0,"Status":"ACTIVE","QueryTemplate":"","Action":"FAIL","ActionArgs":""}]`
+	jsondata := `[{"Description":"desc1","Name":"name1","Priority":0,"Status":"ACTIVE","RequestIP":"123.123.123","RequestCIDRs":["10.0.0.0/8","!10.1.0.0/16"],"User":"user","UserGroups":["analytics"],"InTransaction":false,"WorkloadClass":"etl","Query":"query","QueryTemplate":"","Plans":["Select","Insert"],"FullyQualifiedTableNames":["d.a","d.b"],"BindVarConds":[{"Name":"bvname1","OnAbsent":true,"Operator":""},{"Name":"bvname2","OnAbsent":true,"OnMismatch":true,"Operator":"==","Value":123}],"Action":"FAIL_RETRY","ActionArgs":""},{"Description":"desc2","Name":"name2","Priority":0,"Status":"ACTIVE","QueryTemplate":"","Action":"FAIL","ActionArgs":""}]`
 	err := qrs.UnmarshalJSON([]byte(jsondata))
 	if err != nil {
 		t.Error(err)
@@ -616,7 +676,17 @@ var invalidjsons = []InvalidJSONCase{
 	{`[{"FullyQualifiedTableNames": "d.a" }]`, "want list for FullyQualifiedTableNames"},
 	{`[{"BindVarConds": 1 }]`, "want list for BindVarConds"},
 	{`[{"RequestIP": "[" }]`, "could not set IP condition: ["},
+	{`[{"RequestCIDRs": "10.0.0.0/8" }]`, "want list for RequestCIDRs"},
+	{`[{"RequestCIDRs": [10] }]`, "want string for RequestCIDRs"},
+	{`[{"RequestCIDRs": ["10.0.0.0/33"] }]`, `invalid CIDR "10.0.0.0/33", expected a range like 10.0.0.0/8 or an IP, or ! and one of them to exclude it`},
+	{`[{"UserGroups": [""] }]`, "empty user group"},
+	{`[{"UserGroups": [1] }]`, "want string for UserGroups"},
+	{`[{"InTransaction": "yes" }]`, "want bool for InTransaction"},
 	{`[{"User": "[" }]`, "could not set User condition: ["},
+	{`[{"WorkloadClass": "[" }]`, "could not set WorkloadClass condition: ["},
+	{`[{"Schedule": "{}" }]`, "could not set Schedule: invalid schedule {}: it has neither a cron expression nor windows"},
+	{`[{"OutcomeConds": "{}" }]`, "could not set OutcomeConds: invalid outcome conditions {}: no condition is set"},
+	{`[{"AccessConds": "{}" }]`, "could not set AccessConds: invalid access conditions {}: no condition is set"},
 	{`[{"Query": "[" }]`, "could not set Query condition: ["},
 	{`[{"Plans": [1] }]`, "want string for Plans"},
 	{`[{"Plans": ["invalid"] }]`, "invalid plan name: invalid"},
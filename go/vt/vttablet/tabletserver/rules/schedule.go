@@ -0,0 +1,138 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	"vitess.io/vitess/go/cron"
+)
+
+// Schedule is the activation schedule of a rule, like
+//
+//	{"cron": "* 9-17 * * mon-fri", "time_zone": "Asia/Shanghai"}
+//	{"windows": [{"start": "01:00", "end": "05:00", "days": ["sat", "sun"]}]}
+//
+// The rule only takes effect in the minutes its cron expression matches, or
+// in its daily windows, in its time zone, UTC by default. A window ending
+// before it starts, like 22:00 to 06:00, ends the next day, and its days are
+// the days it starts on, every day by default. The tablets evaluate the
+// schedules on every query, with their own clocks.
+type Schedule struct {
+	spec     string
+	cron     *cron.Schedule
+	windows  []scheduleWindow
+	location *time.Location
+}
+
+// scheduleWindow is a daily window of a schedule.
+type scheduleWindow struct {
+	// start and end are the minutes of the day the window starts and ends at.
+	start, end int
+	// days is the bitset of the days of the week the window starts on, all of
+	// them if 0.
+	days uint8
+}
+
+var scheduleDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseSchedule parses the JSON spec of a schedule.
+func ParseSchedule(spec string) (*Schedule, error) {
+	c := &struct {
+		Cron    string `json:"cron"`
+		Windows []struct {
+			Start string   `json:"start"`
+			End   string   `json:"end"`
+			Days  []string `json:"days"`
+		} `json:"windows"`
+		TimeZone string `json:"time_zone"`
+	}{}
+	dec := json.NewDecoder(strings.NewReader(spec))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("invalid schedule %s: %v", spec, err)
+	}
+	if c.Cron == "" && len(c.Windows) == 0 {
+		return nil, fmt.Errorf("invalid schedule %s: it has neither a cron expression nor windows", spec)
+	}
+	s := &Schedule{spec: spec, location: time.UTC}
+	var err error
+	if c.TimeZone != "" {
+		if s.location, err = time.LoadLocation(c.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %s of schedule %s: %v", c.TimeZone, spec, err)
+		}
+	}
+	if c.Cron != "" {
+		if s.cron, err = cron.Parse(c.Cron); err != nil {
+			return nil, fmt.Errorf("invalid schedule %s: %v", spec, err)
+		}
+	}
+	for _, w := range c.Windows {
+		window := scheduleWindow{}
+		if window.start, err = parseTimeOfDay(w.Start); err != nil {
+			return nil, fmt.Errorf("invalid start %q of a window of schedule %s, expected a time like 09:30", w.Start, spec)
+		}
+		if window.end, err = parseTimeOfDay(w.End); err != nil {
+			return nil, fmt.Errorf("invalid end %q of a window of schedule %s, expected a time like 09:30", w.End, spec)
+		}
+		if window.start == window.end {
+			return nil, fmt.Errorf("invalid window %s-%s of schedule %s: it is empty", w.Start, w.End, spec)
+		}
+		for _, day := range w.Days {
+			i := slices.Index(scheduleDays, strings.ToLower(day))
+			if i < 0 {
+				return nil, fmt.Errorf("invalid day %q of a window of schedule %s, expected one of %s", day, spec, strings.Join(scheduleDays, ", "))
+			}
+			window.days |= 1 << i
+		}
+		s.windows = append(s.windows, window)
+	}
+	return s, nil
+}
+
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Active returns whether the schedule is active at t.
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.location)
+	if s.cron != nil && s.cron.Matches(t) {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if minute >= w.start && minute < w.end && w.startsOn(today) {
+				return true
+			}
+			continue
+		}
+		if (minute >= w.start && w.startsOn(today)) || (minute < w.end && w.startsOn(yesterday)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w scheduleWindow) startsOn(day time.Weekday) bool {
+	return w.days == 0 || w.days&(1<<day) != 0
+}
+
+// String returns the spec of the schedule.
+func (s *Schedule) String() string {
+	return s.spec
+}
@@ -0,0 +1,90 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+	testCases := map[string]string{
+		`{}`:                            "invalid schedule {}: it has neither a cron expression nor windows",
+		`{"cron": "* *"}`:               "invalid schedule {\"cron\": \"* *\"}: cron expression * * must have 5 fields: minute, hour, day of month, month and day of week",
+		`{"cron": "* * * * *", "x": 1}`: "invalid schedule {\"cron\": \"* * * * *\", \"x\": 1}: json: unknown field \"x\"",
+		`{"cron": "* * * * *", "time_zone": "Nowhere/City"}`:                     "invalid time zone Nowhere/City of schedule {\"cron\": \"* * * * *\", \"time_zone\": \"Nowhere/City\"}: unknown time zone Nowhere/City",
+		`{"windows": [{"start": "9:61", "end": "10:00"}]}`:                       "invalid start \"9:61\" of a window of schedule {\"windows\": [{\"start\": \"9:61\", \"end\": \"10:00\"}]}, expected a time like 09:30",
+		`{"windows": [{"start": "10:00", "end": "10:00"}]}`:                      "invalid window 10:00-10:00 of schedule {\"windows\": [{\"start\": \"10:00\", \"end\": \"10:00\"}]}: it is empty",
+		`{"windows": [{"start": "10:00", "end": "11:00", "days": ["someday"]}]}`: "invalid day \"someday\" of a window of schedule {\"windows\": [{\"start\": \"10:00\", \"end\": \"11:00\", \"days\": [\"someday\"]}]}, expected one of sun, mon, tue, wed, thu, fri, sat",
+	}
+	for spec, expected := range testCases {
+		_, err := ParseSchedule(spec)
+		assert.EqualError(t, err, expected, spec)
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	// 2024-01-10 is a Wednesday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	// The business hours of Shanghai, 01:00 to 10:00 UTC.
+	business, err := ParseSchedule(`{"cron": "* 9-17 * * mon-fri", "time_zone": "Asia/Shanghai"}`)
+	require.NoError(t, err)
+	assert.True(t, business.Active(at(10, 1, 0)))
+	assert.True(t, business.Active(at(10, 9, 59)))
+	assert.False(t, business.Active(at(10, 10, 0)))
+	assert.False(t, business.Active(at(13, 2, 0)))
+
+	// A nightly window from Friday to Saturday.
+	nightly, err := ParseSchedule(`{"windows": [{"start": "22:00", "end": "06:00", "days": ["Fri"]}]}`)
+	require.NoError(t, err)
+	assert.True(t, nightly.Active(at(12, 22, 0)))
+	assert.True(t, nightly.Active(at(13, 5, 59)))
+	assert.False(t, nightly.Active(at(13, 6, 0)))
+	assert.False(t, nightly.Active(at(13, 22, 0)))
+	assert.False(t, nightly.Active(at(12, 5, 0)))
+
+	// The windows of every day, and the cron expression, add up.
+	both, err := ParseSchedule(`{"cron": "0 12 * * *", "windows": [{"start": "01:00", "end": "02:00"}, {"start": "03:00", "end": "04:00"}]}`)
+	require.NoError(t, err)
+	for _, active := range []time.Time{at(10, 1, 30), at(11, 3, 0), at(13, 12, 0)} {
+		assert.True(t, both.Active(active), active)
+	}
+	for _, inactive := range []time.Time{at(10, 2, 0), at(11, 4, 0), at(13, 12, 1)} {
+		assert.False(t, both.Active(inactive), inactive)
+	}
+}
+
+func TestRuleSchedule(t *testing.T) {
+	qr := NewActiveQueryRule("rule", "name", QRFail)
+	// Feb 31 never comes.
+	require.NoError(t, qr.SetSchedule(`{"cron": "0 0 31 2 *"}`))
+	assert.Equal(t, QRContinue, qr.FilterByExecutionInfo("", "", "", false, nil, sqlparser.MarginComments{}))
+	assert.Equal(t, QRContinue, qr.GetAction("", "", "", false, nil, sqlparser.MarginComments{}))
+
+	require.NoError(t, qr.SetSchedule(`{"cron": "* * * * *"}`))
+	assert.Equal(t, QRFail, qr.FilterByExecutionInfo("", "", "", false, nil, sqlparser.MarginComments{}))
+
+	// The schedule is kept by its spec.
+	data, err := qr.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Schedule":"{\"cron\": \"* * * * *\"}"`)
+	var qrs = New()
+	require.NoError(t, qrs.UnmarshalJSON([]byte("["+string(data)+"]")))
+	assert.Equal(t, qr.GetSchedule(), qrs.Find("name").GetSchedule())
+	assert.True(t, qr.Equal(qrs.Find("name")))
+	assert.True(t, qr.Equal(qr.Copy()))
+
+	require.NoError(t, qr.SetSchedule(""))
+	assert.Empty(t, qr.GetSchedule())
+}
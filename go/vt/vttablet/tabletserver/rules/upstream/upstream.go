@@ -0,0 +1,298 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package upstream reads and writes the query rules JSON of upstream Vitess.
+//
+// The rules of wescale are a superset of the upstream ones: they have a
+// priority, a status, a query template, action arguments and more actions,
+// and they match the tables of a given database. Rules that can't be
+// converted without matching more queries, or doing something else, are
+// skipped and reported; the other differences are reported as ignored.
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+// Issue is a part of a rule that doesn't map cleanly between the formats.
+type Issue struct {
+	Rule   string
+	Field  string
+	Reason string
+	// Skipped is true if the rule was not converted because of the issue.
+	Skipped bool
+}
+
+func (issue Issue) String() string {
+	effect := "ignored"
+	if issue.Skipped {
+		effect = "rule skipped"
+	}
+	return fmt.Sprintf("rule %s: %s %s: %s", issue.Rule, issue.Field, effect, issue.Reason)
+}
+
+// upstreamFields are the fields of the upstream rules.
+var upstreamFields = map[string]bool{
+	"Name": true, "Description": true, "RequestIP": true, "User": true, "Query": true,
+	"Plans": true, "TableNames": true, "BindVarConds": true, "Action": true,
+	"LeadingComment": true, "TrailingComment": true,
+}
+
+// regexpFields are the regexp conditions of the upstream rules. Upstream
+// doesn't negate the ones of the form (?!re), which it rejects as invalid.
+var regexpFields = []string{"RequestIP", "User", "Query", "LeadingComment", "TrailingComment"}
+
+// upstreamActions are the actions of the upstream rules.
+var upstreamActions = map[string]bool{"CONTINUE": true, "FAIL": true, "FAIL_RETRY": true}
+
+var (
+	// wescalePlans are the wescale names of the upstream plans named
+	// differently, and upstreamPlans the other way around.
+	wescalePlans  = map[string]string{"ShowTables": "Show"}
+	upstreamPlans = map[string]string{"Show": "ShowTables"}
+	// wescaleOnlyPlans are the plans upstream doesn't have.
+	wescaleOnlyPlans = map[string]bool{"AlterDMLJob": true}
+)
+
+// Import reads upstream rules. Their table names match the tables of every
+// database, and their position in the list is used as their priority, so they
+// are applied in the same order as upstream.
+func Import(data []byte) (*rules.Rules, []Issue, error) {
+	var ruleInfos []map[string]any
+	if err := decode(data, &ruleInfos); err != nil {
+		return nil, nil, err
+	}
+
+	qrs := rules.New()
+	var issues []Issue
+	for i, ruleInfo := range ruleInfos {
+		rule, ruleIssues := importRule(ruleInfo, i)
+		issues = append(issues, ruleIssues...)
+		if rule != nil {
+			qrs.Add(rule)
+		}
+	}
+	return qrs, issues, nil
+}
+
+func importRule(ruleInfo map[string]any, i int) (*rules.Rule, []Issue) {
+	name := ruleName(ruleInfo, i)
+	var issues []Issue
+	issue := func(field, reason string) {
+		issues = append(issues, Issue{Rule: name, Field: field, Reason: reason, Skipped: true})
+	}
+
+	converted := map[string]any{"Priority": i}
+	for _, field := range sortedFields(ruleInfo) {
+		value := ruleInfo[field]
+		switch {
+		case !upstreamFields[field]:
+			issue(field, "unknown field")
+		case field == "TableNames":
+			tableNames, ok := value.([]any)
+			if !ok {
+				issue(field, "want list")
+				continue
+			}
+			tables := make([]any, 0, len(tableNames))
+			for _, tableName := range tableNames {
+				table, ok := tableName.(string)
+				if !ok || strings.ContainsAny(table, ".*") {
+					issue(field, fmt.Sprintf("invalid table name %v", tableName))
+					continue
+				}
+				tables = append(tables, "*."+table)
+			}
+			converted["FullyQualifiedTableNames"] = tables
+		case field == "Plans":
+			plans, ok := value.([]any)
+			if !ok {
+				issue(field, "want list")
+				continue
+			}
+			renamed := make([]any, len(plans))
+			for j, plan := range plans {
+				renamed[j] = plan
+				if wescaleName, ok := wescalePlans[fmt.Sprint(plan)]; ok {
+					renamed[j] = wescaleName
+				}
+			}
+			converted[field] = renamed
+		default:
+			if pattern, ok := value.(string); ok && strings.HasPrefix(pattern, "(?!") && slices.Contains(regexpFields, field) {
+				issue(field, fmt.Sprintf("invalid regexp %s", pattern))
+				continue
+			}
+			converted[field] = value
+		}
+	}
+	if len(issues) > 0 {
+		return nil, issues
+	}
+	rule, err := rules.BuildQueryRule(converted)
+	if err != nil {
+		issue("rule", err.Error())
+		return nil, issues
+	}
+	return rule, nil
+}
+
+// Export writes upstream rules, in the order of their priority. The tables of
+// the given database are written as upstream table names, which match the
+// tables of the database the tablet serves.
+func Export(qrs *rules.Rules, database string) ([]byte, []Issue, error) {
+	qrsList := qrs.CopyUnderlying()
+	sort.SliceStable(qrsList, func(i, j int) bool {
+		return qrsList[i].Priority < qrsList[j].Priority
+	})
+
+	ruleInfos := make([]map[string]any, 0, len(qrsList))
+	var issues []Issue
+	for i, rule := range qrsList {
+		ruleInfo, ruleIssues, err := exportRule(rule, i, database)
+		if err != nil {
+			return nil, nil, err
+		}
+		issues = append(issues, ruleIssues...)
+		if ruleInfo != nil {
+			ruleInfos = append(ruleInfos, ruleInfo)
+		}
+	}
+	data, err := json.MarshalIndent(ruleInfos, "", "  ")
+	return data, issues, err
+}
+
+func exportRule(rule *rules.Rule, i int, database string) (map[string]any, []Issue, error) {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ruleInfo map[string]any
+	if err := decode(data, &ruleInfo); err != nil {
+		return nil, nil, err
+	}
+
+	name := ruleName(ruleInfo, i)
+	var issues []Issue
+	skipped := false
+	issue := func(field, reason string, skip bool) {
+		issues = append(issues, Issue{Rule: name, Field: field, Reason: reason, Skipped: skip})
+		skipped = skipped || skip
+	}
+
+	if rule.Status != rules.Active {
+		issue("Status", "upstream rules are always active", true)
+	}
+	if _, ok := ruleInfo["WorkloadClass"]; ok {
+		issue("WorkloadClass", "upstream rules don't match workload classes", true)
+	}
+	if _, ok := ruleInfo["RequestCIDRs"]; ok {
+		issue("RequestCIDRs", "upstream rules don't match CIDR ranges", true)
+	}
+	if _, ok := ruleInfo["UserGroups"]; ok {
+		issue("UserGroups", "upstream rules don't match user groups", true)
+	}
+	if _, ok := ruleInfo["InTransaction"]; ok {
+		issue("InTransaction", "upstream rules don't match the transactions", true)
+	}
+	if _, ok := ruleInfo["Schedule"]; ok {
+		issue("Schedule", "upstream rules have no schedules", true)
+	}
+	if _, ok := ruleInfo["ExpiresAt"]; ok {
+		issue("ExpiresAt", "upstream rules don't expire", true)
+	}
+	if _, ok := ruleInfo["OutcomeConds"]; ok {
+		issue("OutcomeConds", "upstream rules have no post execution conditions", true)
+	}
+	if _, ok := ruleInfo["AccessConds"]; ok {
+		issue("AccessConds", "upstream rules don't match the access of the queries", true)
+	}
+	for _, field := range regexpFields {
+		if pattern, ok := ruleInfo[field].(string); ok && strings.HasPrefix(pattern, "(?!") {
+			issue(field, "upstream rules don't negate the conditions", true)
+		}
+	}
+	if template := ruleInfo["QueryTemplate"]; template != nil && template != "" {
+		issue("QueryTemplate", "upstream rules don't match query templates", true)
+	}
+	if _, ok := ruleInfo["QueryDigest"]; ok {
+		issue("QueryDigest", "upstream rules don't match query digests", true)
+	}
+	// The action is only written by wescale if it isn't CONTINUE, while the
+	// default of upstream is FAIL.
+	action, ok := ruleInfo["Action"].(string)
+	if !ok {
+		action = rules.QRContinue.String()
+	}
+	if !upstreamActions[action] {
+		issue("Action", fmt.Sprintf("upstream rules have no %s action", action), true)
+	}
+	if args := ruleInfo["ActionArgs"]; args != nil && args != "" {
+		issue("ActionArgs", "upstream actions have no arguments", false)
+	}
+	if tableNames, ok := ruleInfo["FullyQualifiedTableNames"].([]any); ok {
+		tables := make([]any, 0, len(tableNames))
+		for _, tableName := range tableNames {
+			db, table, _ := strings.Cut(fmt.Sprint(tableName), ".")
+			if (db != "*" && db != database) || strings.Contains(table, "*") {
+				issue("FullyQualifiedTableNames", fmt.Sprintf("upstream rules can't match the tables %v", tableName), true)
+				continue
+			}
+			tables = append(tables, table)
+		}
+		ruleInfo["TableNames"] = tables
+	}
+	if plans, ok := ruleInfo["Plans"].([]any); ok {
+		for j, plan := range plans {
+			if wescaleOnlyPlans[fmt.Sprint(plan)] {
+				issue("Plans", fmt.Sprintf("upstream rules have no %v plan", plan), true)
+			}
+			if upstreamName, ok := upstreamPlans[fmt.Sprint(plan)]; ok {
+				plans[j] = upstreamName
+			}
+		}
+	}
+	if skipped {
+		return nil, issues, nil
+	}
+
+	for _, field := range []string{"Priority", "Status", "QueryTemplate", "ActionArgs", "FullyQualifiedTableNames"} {
+		delete(ruleInfo, field)
+	}
+	ruleInfo["Action"] = action
+	return ruleInfo, issues, nil
+}
+
+// decode decodes JSON keeping the numbers as they are written.
+func decode(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// ruleName returns the name of a rule in the issues, or its position in the
+// list if it has none.
+func ruleName(ruleInfo map[string]any, i int) string {
+	if name, ok := ruleInfo["Name"].(string); ok && name != "" {
+		return name
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+func sortedFields(ruleInfo map[string]any) []string {
+	fields := make([]string, 0, len(ruleInfo))
+	for field := range ruleInfo {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,170 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package upstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+func issueStrings(issues []Issue) []string {
+	var reported []string
+	for _, issue := range issues {
+		reported = append(reported, issue.String())
+	}
+	return reported
+}
+
+func TestImport(t *testing.T) {
+	qrs, issues, err := Import([]byte(`[
+		{"Name": "no_deletes", "Description": "no deletes", "Plans": ["Delete", "DeleteLimit"], "TableNames": ["orders"]},
+		{"Name": "tables", "Plans": ["ShowTables"], "Action": "FAIL_RETRY"},
+		{"Description": "unknown", "Query": "select 1", "Status": "ACTIVE"},
+		{"Name": "bad_plan", "Plans": ["NoSuchPlan"]},
+		{"Name": "bad_table", "TableNames": ["db.orders"]},
+		{"Name": "bang", "User": "!admin"},
+		{"Name": "lookahead", "User": "(?!admin)"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"rule #3: Status rule skipped: unknown field",
+		"rule bad_plan: rule rule skipped: invalid plan name: NoSuchPlan",
+		"rule bad_table: TableNames rule skipped: invalid table name db.orders",
+		"rule lookahead: User rule skipped: invalid regexp (?!admin)",
+	}, issueStrings(issues))
+
+	var names []string
+	for _, rule := range qrs.CopyUnderlying() {
+		names = append(names, rule.Name)
+	}
+	assert.Equal(t, []string{"no_deletes", "tables", "bang"}, names)
+
+	deletes := qrs.Find("no_deletes")
+	assert.Equal(t, 0, deletes.Priority)
+	assert.Equal(t, rules.Active, deletes.Status)
+	assert.NotNil(t, deletes.FilterByPlan("delete from orders", planbuilder.PlanDelete, []string{"db1.orders"}))
+	assert.Nil(t, deletes.FilterByPlan("delete from items", planbuilder.PlanDelete, []string{"db1.items"}))
+	assert.Nil(t, deletes.FilterByPlan("select * from orders", planbuilder.PlanSelect, []string{"db1.orders"}))
+	assert.Equal(t, rules.QRFail, deletes.FilterByExecutionInfo("", "", "", false, nil, sqlparser.MarginComments{}))
+
+	tables := qrs.Find("tables")
+	assert.Equal(t, 1, tables.Priority)
+	assert.NotNil(t, tables.FilterByPlan("show tables", planbuilder.PlanShow, nil))
+
+	// The regexps starting with ! match a literal !, like upstream.
+	bang := qrs.Find("bang")
+	assert.Equal(t, rules.QRFail, bang.FilterByExecutionInfo("", "!admin", "", false, nil, sqlparser.MarginComments{}))
+	assert.Equal(t, rules.QRContinue, bang.FilterByExecutionInfo("", "app", "", false, nil, sqlparser.MarginComments{}))
+
+	_, _, err = Import([]byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestExport(t *testing.T) {
+	qrs := rules.New()
+	add := func(name string, act rules.Action, priority int, setup func(rule *rules.Rule)) {
+		rule := rules.NewActiveQueryRule("desc "+name, name, act)
+		rule.SetPriority(priority)
+		if setup != nil {
+			setup(rule)
+		}
+		qrs.Add(rule)
+	}
+	add("second", rules.QRContinue, 20, func(rule *rules.Rule) {
+		rule.AddPlanCond(planbuilder.PlanShow)
+	})
+	add("first", rules.QRFail, 10, func(rule *rules.Rule) {
+		require.NoError(t, rule.SetUserCond("app"))
+		rule.AddTableCond("db1.orders")
+		rule.AddTableCond("*.items")
+		rule.SetActionArgs("unused")
+	})
+	add("inactive", rules.QRFail, 30, func(rule *rules.Rule) {
+		rule.SetStatus(rules.InActive)
+	})
+	add("buffer", rules.QRBuffer, 40, nil)
+	add("other_db", rules.QRFail, 50, func(rule *rules.Rule) {
+		rule.AddTableCond("db2.orders")
+	})
+	add("dml_job", rules.QRFail, 60, func(rule *rules.Rule) {
+		rule.AddPlanCond(planbuilder.PlanAlterDMLJob)
+	})
+	add("template", rules.QRFail, 70, func(rule *rules.Rule) {
+		rule.SetQueryTemplate("select * from t where id = :id")
+	})
+	add("digest", rules.QRFail, 75, func(rule *rules.Rule) {
+		require.NoError(t, rule.SetQueryDigestCond(rules.Digest("select * from t where id = :id")))
+	})
+	add("etl", rules.QRFail, 80, func(rule *rules.Rule) {
+		require.NoError(t, rule.SetWorkloadClassCond("etl"))
+	})
+	add("outside", rules.QRFail, 85, func(rule *rules.Rule) {
+		require.NoError(t, rule.AddCIDRCond("!10.0.0.0/8"))
+	})
+	add("analytics", rules.QRFail, 87, func(rule *rules.Rule) {
+		require.NoError(t, rule.AddUserGroupCond("analytics"))
+	})
+	add("in_tx", rules.QRFail, 88, func(rule *rules.Rule) {
+		rule.SetInTransactionCond(true)
+	})
+	add("nightly", rules.QRFail, 90, func(rule *rules.Rule) {
+		require.NoError(t, rule.SetSchedule(`{"windows": [{"start": "01:00", "end": "05:00"}]}`))
+	})
+	add("emergency", rules.QRFail, 95, func(rule *rules.Rule) {
+		rule.SetExpiresAt(time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC))
+	})
+	add("slow", rules.QRFail, 100, func(rule *rules.Rule) {
+		require.NoError(t, rule.SetOutcomeConds(`{"min_latency": "2s"}`))
+	})
+	add("scans", rules.QRFail, 105, func(rule *rules.Rule) {
+		require.NoError(t, rule.SetAccessConds(`{"full_scan": true}`))
+	})
+	add("not_batch", rules.QRFail, 110, func(rule *rules.Rule) {
+		require.NoError(t, rule.SetUserCond("(?!batch_svc)"))
+	})
+
+	data, issues, err := Export(qrs, "db1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"rule first: ActionArgs ignored: upstream actions have no arguments",
+		"rule inactive: Status rule skipped: upstream rules are always active",
+		"rule buffer: Action rule skipped: upstream rules have no BUFFER action",
+		"rule other_db: FullyQualifiedTableNames rule skipped: upstream rules can't match the tables db2.orders",
+		"rule dml_job: Plans rule skipped: upstream rules have no AlterDMLJob plan",
+		"rule template: QueryTemplate rule skipped: upstream rules don't match query templates",
+		"rule digest: QueryDigest rule skipped: upstream rules don't match query digests",
+		"rule etl: WorkloadClass rule skipped: upstream rules don't match workload classes",
+		"rule outside: RequestCIDRs rule skipped: upstream rules don't match CIDR ranges",
+		"rule analytics: UserGroups rule skipped: upstream rules don't match user groups",
+		"rule in_tx: InTransaction rule skipped: upstream rules don't match the transactions",
+		"rule nightly: Schedule rule skipped: upstream rules have no schedules",
+		"rule emergency: ExpiresAt rule skipped: upstream rules don't expire",
+		"rule slow: OutcomeConds rule skipped: upstream rules have no post execution conditions",
+		"rule scans: AccessConds rule skipped: upstream rules don't match the access of the queries",
+		"rule not_batch: User rule skipped: upstream rules don't negate the conditions",
+	}, issueStrings(issues))
+	assert.JSONEq(t, `[
+		{"Name": "first", "Description": "desc first", "User": "app", "TableNames": ["orders", "items"], "Action": "FAIL"},
+		{"Name": "second", "Description": "desc second", "Plans": ["ShowTables"], "Action": "CONTINUE"}
+	]`, string(data))
+
+	// The exported rules are read back the same.
+	imported, issues, err := Import(data)
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+	first := imported.Find("first")
+	rule := first.FilterByPlan("select * from orders", planbuilder.PlanSelect, []string{"db1.orders"})
+	require.NotNil(t, rule)
+	assert.Equal(t, rules.QRFail, rule.FilterByExecutionInfo("", "app", "", false, nil, sqlparser.MarginComments{}))
+	assert.NotNil(t, imported.Find("second").FilterByPlan("show tables", planbuilder.PlanShow, nil))
+}
@@ -0,0 +1,41 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+// SetUserGroups sets the members of the user groups, by group, that the user
+// group conditions of the rules match the users against, so that one rule
+// covers the users of a group instead of one rule per user. The rules of a
+// group that isn't in groups match no user.
+func (qrs *Rules) SetUserGroups(groups map[string][]string) {
+	for _, qr := range qrs.rules {
+		qr.setGroupUsers(groups)
+	}
+}
+
+func (qr *Rule) setGroupUsers(groups map[string][]string) {
+	if qr.userGroups == nil {
+		return
+	}
+	// The members of the excluded groups are false, whatever their other
+	// groups.
+	users := make(map[string]bool)
+	for _, group := range qr.userGroups {
+		if _, excluded := negatedCond(group); !excluded {
+			for _, user := range groups[group] {
+				users[user] = true
+			}
+		}
+	}
+	for _, group := range qr.userGroups {
+		if name, excluded := negatedCond(group); excluded {
+			for _, user := range groups[name] {
+				users[user] = false
+			}
+		}
+	}
+	qr.groupUsers = users
+	qr.invalidate()
+}
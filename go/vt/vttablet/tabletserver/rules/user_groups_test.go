@@ -0,0 +1,46 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestUserGroupCond(t *testing.T) {
+	qrs := New()
+	qr := NewActiveQueryRule("", "analytics", QRFail)
+	require.NoError(t, qr.AddUserGroupCond("analytics"))
+	require.NoError(t, qr.AddUserGroupCond("reporting"))
+	qrs.Add(qr)
+	qrs.Add(NewActiveQueryRule("", "other", QRContinue))
+	assert.Error(t, qr.AddUserGroupCond(""))
+
+	action := func(user string) Action {
+		act, _, _ := qrs.GetAction("", user, "", false, nil, sqlparser.MarginComments{})
+		return act
+	}
+	// The rule knows no member yet.
+	assert.Equal(t, QRContinue, action("etl1"))
+
+	qrs.SetUserGroups(map[string][]string{"analytics": {"etl1", "etl2"}, "reporting": {"bi"}, "admins": {"root"}})
+	for _, user := range []string{"etl1", "etl2", "bi"} {
+		assert.Equal(t, QRFail, action(user), user)
+	}
+	for _, user := range []string{"root", "etl", ""} {
+		assert.Equal(t, QRContinue, action(user), user)
+	}
+	assert.True(t, qrs.Copy().Equal(qrs))
+
+	// The members follow the groups.
+	qrs.SetUserGroups(map[string][]string{"analytics": {"etl3"}})
+	assert.Equal(t, QRContinue, action("etl1"))
+	assert.Equal(t, QRFail, action("etl3"))
+}
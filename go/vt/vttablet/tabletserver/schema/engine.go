@@ -77,6 +77,9 @@ type Engine struct {
 	reloadAtPos mysql.Position
 	notifierMu  sync.Mutex
 	notifiers   map[string]notifier
+	// sequences is the caches of the sequences of mysql.wescale_sequences,
+	// by the name of the sequence qualified by its database.
+	sequences map[string]*SequenceInfo
 
 	// SkipMetaCheck skips the metadata about the database and table information
 	SkipMetaCheck bool
@@ -332,6 +335,12 @@ func (se *Engine) MakeNonPrimary() {
 			t.SequenceInfo.Unlock()
 		}
 	}
+	for _, sequenceInfo := range se.sequences {
+		sequenceInfo.Lock()
+		sequenceInfo.NextVal = 0
+		sequenceInfo.LastVal = 0
+		sequenceInfo.Unlock()
+	}
 }
 
 // EnableHistorian forces tracking to be on or off.
@@ -695,6 +704,22 @@ func (se *Engine) GetTable(tableName sqlparser.IdentifierCS) *Table {
 	return se.tables[tableName.String()]
 }
 
+// GetSequenceInfo returns the cache of a sequence of mysql.wescale_sequences,
+// which is empty until the sequence is first used.
+func (se *Engine) GetSequenceInfo(name string) *SequenceInfo {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	if se.sequences == nil {
+		se.sequences = make(map[string]*SequenceInfo)
+	}
+	sequenceInfo, ok := se.sequences[name]
+	if !ok {
+		sequenceInfo = &SequenceInfo{}
+		se.sequences[name] = sequenceInfo
+	}
+	return sequenceInfo
+}
+
 // GetSchema returns the current schema. The Tables are a
 // shared data structure and must be treated as read-only.
 func (se *Engine) GetSchema() map[string]*Table {
@@ -0,0 +1,123 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"strings"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// Besides the sequence tables, the sequences are the rows of the
+// mysql.wescale_sequences sidecar table, by name, which a select next from a
+// table which isn't a sequence table allocates the values of. The primary
+// allocates them by blocks of cache values, which it commits to the table
+// before it serves them, and drops the blocks it cached when it stops being
+// the primary, so the values a sequence serves stay monotonic across the
+// failovers: the new primary allocates its first block after the last block
+// the former primary committed.
+
+const (
+	sqlSelectSequence = "select next_id, cache from mysql.wescale_sequences where name = %a for update"
+	sqlUpdateSequence = "update mysql.wescale_sequences set next_id = %a where name = %a"
+)
+
+// execSequenceNextval allocates the values of a sequence of
+// mysql.wescale_sequences, qualified by the database of the query if it isn't.
+func (qre *QueryExecutor) execSequenceNextval(tableName string, inc int64) (*sqltypes.Result, error) {
+	name := tableName
+	if !strings.Contains(name, ".") {
+		if qre.database == "" {
+			return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "no database selected for sequence %s", tableName)
+		}
+		name = qre.database + "." + name
+	}
+	selectQuery, err := sqlparser.ParseAndBind(sqlSelectSequence, sqltypes.StringBindVariable(name))
+	if err != nil {
+		return nil, err
+	}
+	return qre.nextSequenceValues(qre.tsv.se.GetSequenceInfo(name), name, inc, selectQuery, func(newLast int64) (string, error) {
+		return sqlparser.ParseAndBind(sqlUpdateSequence, sqltypes.Int64BindVariable(newLast), sqltypes.StringBindVariable(name))
+	})
+}
+
+// nextSequenceValues returns the next inc values of a sequence from its
+// cache, and allocates the cache again from the row of the sequence if it
+// doesn't hold them. The row is read, for update, by selectQuery, and updated
+// to the new end of the cache by the query updateQuery returns.
+func (qre *QueryExecutor) nextSequenceValues(sequenceInfo *schema.SequenceInfo, name string, inc int64, selectQuery string, updateQuery func(newLast int64) (string, error)) (*sqltypes.Result, error) {
+	sequenceInfo.Lock()
+	defer sequenceInfo.Unlock()
+	if sequenceInfo.NextVal == 0 || sequenceInfo.NextVal+inc > sequenceInfo.LastVal {
+		_, err := qre.execAsTransaction(func(conn *StatefulConnection) (*sqltypes.Result, error) {
+			qr, err := qre.execStatefulConn(conn, selectQuery, false)
+			if err != nil {
+				return nil, err
+			}
+			if len(qr.Rows) == 0 && qre.plan.Table == nil {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%s is not a sequence", name)
+			}
+			if len(qr.Rows) != 1 {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unexpected rows from reading sequence %s (possible mis-route): %d", name, len(qr.Rows))
+			}
+			nextID, err := evalengine.ToInt64(qr.Rows[0][0])
+			if err != nil {
+				return nil, vterrors.Wrapf(err, "error loading sequence %s", name)
+			}
+			// If LastVal does not match next ID, then either:
+			// VTTablet just started, and we're initializing the cache, or
+			// Someone reset the id underneath us.
+			if sequenceInfo.LastVal != nextID {
+				if nextID < sequenceInfo.LastVal {
+					log.Warningf("Sequence next ID value %v is below the currently cached max %v, updating it to max", nextID, sequenceInfo.LastVal)
+					nextID = sequenceInfo.LastVal
+				}
+				sequenceInfo.NextVal = nextID
+				sequenceInfo.LastVal = nextID
+			}
+			cache, err := evalengine.ToInt64(qr.Rows[0][1])
+			if err != nil {
+				return nil, vterrors.Wrapf(err, "error loading sequence %s", name)
+			}
+			if cache < 1 {
+				return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid cache value for sequence %s: %d", name, cache)
+			}
+			newLast := nextID + cache
+			for newLast < sequenceInfo.NextVal+inc {
+				newLast += cache
+			}
+			query, err := updateQuery(newLast)
+			if err != nil {
+				return nil, err
+			}
+			conn.TxProperties().RecordQuery(query)
+			_, err = qre.execStatefulConn(conn, query, false)
+			if err != nil {
+				return nil, err
+			}
+			sequenceInfo.LastVal = newLast
+			return nil, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	ret := sequenceInfo.NextVal
+	sequenceInfo.NextVal += inc
+	return &sqltypes.Result{
+		Fields: sequenceFields,
+		Rows: [][]sqltypes.Value{{
+			sqltypes.NewInt64(ret),
+		}},
+	}, nil
+}
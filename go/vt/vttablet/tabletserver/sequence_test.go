@@ -0,0 +1,69 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/planbuilder"
+)
+
+func TestQueryExecutorSequenceNextval(t *testing.T) {
+	db := setUpQueryExecutorTest(t)
+	defer db.Close()
+	sequenceRow := func(nextID, cache string) *sqltypes.Result {
+		return sqltypes.MakeTestResult(sqltypes.MakeTestFields("next_id|cache", "int64|int64"), nextID+"|"+cache)
+	}
+	selQuery := "select next_id, cache from mysql.wescale_sequences where name = 'ks.orders' for update"
+	db.AddQuery(selQuery, sequenceRow("1", "10"))
+	db.AddQuery("update mysql.wescale_sequences set next_id = 11 where name = 'ks.orders'", &sqltypes.Result{})
+	db.AddQuery("select next_id, cache from mysql.wescale_sequences where name = 'ks.missing' for update", sqltypes.MakeTestResult(sqltypes.MakeTestFields("next_id|cache", "int64|int64")))
+	ctx := context.Background()
+	tsv := newTestTabletServer(ctx, noFlags, db)
+	defer tsv.StopService()
+
+	next := func(sql, database string) (int64, error) {
+		qre := newTestQueryExecutor(ctx, tsv, sql, 0)
+		require.Equal(t, planbuilder.PlanNextval, qre.plan.PlanID)
+		qre.database = database
+		qr, err := qre.Execute()
+		if err != nil {
+			return 0, err
+		}
+		return qr.Rows[0][0].ToInt64()
+	}
+
+	got, err := next("select next value from orders", "ks")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, got)
+	// The next values are served from the cache.
+	db.DeleteQuery(selQuery)
+	got, err = next("select next 2 values from ks.orders", "")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, got)
+	got, err = next("select next value from orders", "ks")
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, got)
+
+	// The cache is dropped when the tablet stops being the primary, and the
+	// values are allocated again after the last committed block.
+	tsv.se.MakeNonPrimary()
+	db.AddQuery(selQuery, sequenceRow("11", "10"))
+	db.AddQuery("update mysql.wescale_sequences set next_id = 21 where name = 'ks.orders'", &sqltypes.Result{})
+	got, err = next("select next value from orders", "ks")
+	require.NoError(t, err)
+	assert.EqualValues(t, 11, got)
+
+	_, err = next("select next value from missing", "ks")
+	assert.ErrorContains(t, err, "ks.missing is not a sequence")
+	_, err = next("select next value from orders", "")
+	assert.ErrorContains(t, err, "no database selected for sequence orders")
+}
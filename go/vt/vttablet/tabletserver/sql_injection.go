@@ -0,0 +1,163 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"strconv"
+	"strings"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// The signals of the SQL injections, and their scores. The score of a query
+// is the sum of the scores of the signals it shows, each counted once.
+const (
+	// sqlInjectionStackedStatements is a statement after a semicolon, like
+	// 1; drop table t.
+	sqlInjectionStackedStatements = "stacked_statements"
+	// sqlInjectionTautology is an OR with an always true condition, like
+	// ' or '1'='1.
+	sqlInjectionTautology = "tautology"
+	// sqlInjectionLineComment is a -- or # comment, which drops the end of the
+	// statement, like admin' --.
+	sqlInjectionLineComment = "line_comment"
+	// sqlInjectionInlineComment is a /* */ comment between two tokens, which
+	// hides keywords from the filters, like un/**/ion.
+	sqlInjectionInlineComment = "inline_comment"
+	// sqlInjectionExecutableComment is a /*! */ comment that MySQL runs.
+	sqlInjectionExecutableComment = "executable_comment"
+	// sqlInjectionTimeDelay is a call to sleep or benchmark, the probes of the
+	// blind injections.
+	sqlInjectionTimeDelay = "time_delay"
+)
+
+var sqlInjectionScores = map[string]int{
+	sqlInjectionStackedStatements: 50,
+	sqlInjectionTautology:         40,
+	sqlInjectionLineComment:       20,
+	sqlInjectionInlineComment:     20,
+	sqlInjectionExecutableComment: 30,
+	sqlInjectionTimeDelay:         30,
+}
+
+// scoreSQLInjection scores a query, whose literals may be bind variables, for
+// the patterns of the SQL injections, and returns the signals it shows.
+func scoreSQLInjection(query string, bindVars map[string]*querypb.BindVariable) (score int, signals []string) {
+	add := func(signal string) {
+		for _, s := range signals {
+			if s == signal {
+				return
+			}
+		}
+		signals = append(signals, signal)
+		score += sqlInjectionScores[signal]
+	}
+
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	tokenizer.SkipSpecialComments = true
+	// The comments before the first token and after the last one are the
+	// margin comments, like the ones of vtgate.
+	seenToken, pendingComment, afterSemicolon := false, false, false
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 || typ == sqlparser.LEX_ERROR {
+			break
+		}
+		if typ == sqlparser.COMMENT {
+			switch {
+			case strings.HasPrefix(val, "/*!"):
+				add(sqlInjectionExecutableComment)
+			case strings.HasPrefix(val, "/*"):
+				pendingComment = seenToken
+			default:
+				if seenToken {
+					add(sqlInjectionLineComment)
+				}
+			}
+			continue
+		}
+		if typ == ';' {
+			afterSemicolon = true
+			continue
+		}
+		if afterSemicolon {
+			add(sqlInjectionStackedStatements)
+		}
+		if pendingComment {
+			add(sqlInjectionInlineComment)
+			pendingComment = false
+		}
+		seenToken = true
+	}
+
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return score, signals
+	}
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.OrExpr:
+			if isTautology(node.Left, bindVars) || isTautology(node.Right, bindVars) {
+				add(sqlInjectionTautology)
+			}
+		case *sqlparser.FuncExpr:
+			if node.Name.EqualString("sleep") || node.Name.EqualString("benchmark") {
+				add(sqlInjectionTimeDelay)
+			}
+		}
+		return true, nil
+	}, stmt)
+	return score, signals
+}
+
+// isTautology returns whether an expression is always true, like 1, true,
+// 1=1 or 'a'<>'b'.
+func isTautology(expr sqlparser.Expr, bindVars map[string]*querypb.BindVariable) bool {
+	switch expr := expr.(type) {
+	case sqlparser.BoolVal:
+		return bool(expr)
+	case *sqlparser.ComparisonExpr:
+		left, ok := constantValue(expr.Left, bindVars)
+		if !ok {
+			return false
+		}
+		right, ok := constantValue(expr.Right, bindVars)
+		if !ok {
+			return false
+		}
+		switch expr.Operator {
+		case sqlparser.EqualOp, sqlparser.NullSafeEqualOp:
+			return left == right
+		case sqlparser.NotEqualOp:
+			return left != right
+		}
+		return false
+	}
+	// A number is true unless 0.
+	value, ok := constantValue(expr, bindVars)
+	if !ok {
+		return false
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	return err == nil && number != 0
+}
+
+// constantValue returns the value of a literal, or of a bind variable.
+func constantValue(expr sqlparser.Expr, bindVars map[string]*querypb.BindVariable) (string, bool) {
+	switch expr := expr.(type) {
+	case *sqlparser.Literal:
+		return expr.Val, true
+	case sqlparser.Argument:
+		bv, ok := bindVars[strings.TrimPrefix(string(expr), ":")]
+		if !ok || bv.Value == nil {
+			return "", false
+		}
+		return string(bv.Value), true
+	}
+	return "", false
+}
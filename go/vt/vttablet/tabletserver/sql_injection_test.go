@@ -0,0 +1,60 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestScoreSQLInjection(t *testing.T) {
+	for _, tcase := range []struct {
+		query    string
+		bindVars map[string]*querypb.BindVariable
+		score    int
+		signals  []string
+	}{
+		{query: "select * from t where id = 1 or name = 'a'"},
+		{query: "/* vtgate:: keyspace_name:ks */ select * from t where id = 1 /* trailing */"},
+		{query: "select * from t where id = ';--'"},
+		{query: "select * from t where id = 1 or 1 = 1", score: 40, signals: []string{sqlInjectionTautology}},
+		{query: "select * from t where name = '' or 'a' = 'a'", score: 40, signals: []string{sqlInjectionTautology}},
+		{query: "select * from t where name = 'x' or 1", score: 40, signals: []string{sqlInjectionTautology}},
+		{query: "select * from t where name = 'x' or 'a' != 'b'", score: 40, signals: []string{sqlInjectionTautology}},
+		{query: "select * from t where name = 'x' or 0"},
+		{
+			// The literals normalized by vtgate are bind variables.
+			query:    "select * from t where id = :vtg1 or :vtg2 = :vtg3",
+			bindVars: map[string]*querypb.BindVariable{"vtg1": sqltypes.Int64BindVariable(1), "vtg2": sqltypes.Int64BindVariable(2), "vtg3": sqltypes.Int64BindVariable(2)},
+			score:    40,
+			signals:  []string{sqlInjectionTautology},
+		},
+		{
+			query:    "select * from t where id = :vtg1 or :vtg2 = :vtg3",
+			bindVars: map[string]*querypb.BindVariable{"vtg1": sqltypes.Int64BindVariable(1), "vtg2": sqltypes.Int64BindVariable(2), "vtg3": sqltypes.Int64BindVariable(3)},
+		},
+		{query: "select * from t where id = 1; drop table t", score: 50, signals: []string{sqlInjectionStackedStatements}},
+		{query: "select * from users where name = 'admin' -- ' and password = 'x'", score: 20, signals: []string{sqlInjectionLineComment}},
+		{query: "select * from users where name = 'admin' # ' and password = 'x'", score: 20, signals: []string{sqlInjectionLineComment}},
+		{query: "select id from t where id = 1 union/**/select password from users", score: 20, signals: []string{sqlInjectionInlineComment}},
+		{query: "select id from t where id = 1 /*!50000 union select password from users */", score: 30, signals: []string{sqlInjectionExecutableComment}},
+		{query: "select * from t where id = 1 and sleep(5)", score: 30, signals: []string{sqlInjectionTimeDelay}},
+		{
+			query:   "select * from t where id = 1 or 1=1 union/**/select benchmark(1000000, md5(1)) -- x",
+			score:   110,
+			signals: []string{sqlInjectionInlineComment, sqlInjectionLineComment, sqlInjectionTautology, sqlInjectionTimeDelay},
+		},
+	} {
+		score, signals := scoreSQLInjection(tcase.query, tcase.bindVars)
+		assert.Equal(t, tcase.score, score, tcase.query)
+		assert.Equal(t, tcase.signals, signals, tcase.query)
+	}
+}
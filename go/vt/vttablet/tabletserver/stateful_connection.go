@@ -216,6 +216,11 @@ func (sc *StatefulConnection) Kill(reason string, elapsed time.Duration) error {
 	return sc.dbConn.Kill(reason, elapsed)
 }
 
+// KillQuery kills the query executing on the connection, which stays usable.
+func (sc *StatefulConnection) KillQuery(reason string, elapsed time.Duration) error {
+	return sc.dbConn.KillQuery(reason, elapsed)
+}
+
 // TxProperties returns the transactional properties of the connection
 func (sc *StatefulConnection) TxProperties() *tx.Properties {
 	return sc.txProps
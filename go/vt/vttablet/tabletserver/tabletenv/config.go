@@ -73,6 +73,7 @@ var (
 	degradedThreshold            time.Duration
 	unhealthyThreshold           time.Duration
 	transitionGracePeriod        time.Duration
+	pointLookupBatchWindow       time.Duration
 	enableReplicationReporter    bool
 )
 
@@ -118,6 +119,9 @@ func registerTabletEnvFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&currentConfig.PassthroughDML, "queryserver-config-passthrough-dmls", defaultConfig.PassthroughDML, "query server pass through all dml statements without rewriting")
 
 	fs.IntVar(&currentConfig.StreamBufferSize, "queryserver-config-stream-buffer-size", defaultConfig.StreamBufferSize, "query server stream buffer size, the maximum number of bytes sent from vttablet for each stream call. It's recommended to keep this value in sync with vtgate's stream_buffer_size.")
+	fs.BoolVar(&currentConfig.StreamBufferSizeAdaptive, "queryserver-config-stream-buffer-size-adaptive", defaultConfig.StreamBufferSizeAdaptive, "query server adaptive stream buffer size: the number of bytes sent for each stream call moves between a quarter and four times queryserver-config-stream-buffer-size, growing while clients keep up with MySQL and shrinking when they lag behind.")
+	fs.Int64Var(&currentConfig.StreamMaxBufferedBytes, "queryserver-config-stream-max-buffered-bytes", defaultConfig.StreamMaxBufferedBytes, "query server stream max buffered bytes, the ceiling on the result bytes all streaming queries may buffer together for their clients, see queryserver-config-stream-max-buffered-bytes-per-stream. A stream that would exceed it stops reading from MySQL until the streams drain, but a stream buffering nothing is always admitted. 0 means unlimited.")
+	fs.Int64Var(&currentConfig.StreamMaxBufferedBytesPerStream, "queryserver-config-stream-max-buffered-bytes-per-stream", defaultConfig.StreamMaxBufferedBytesPerStream, "query server stream max buffered bytes per stream, the maximum number of result bytes each streaming query reads ahead from MySQL while its client consumes the previous results. A stream that would exceed it stops reading from MySQL until its own client catches up, without blocking the other streams. 0 disables the buffering: MySQL is read as fast as the client consumes the results.")
 	fs.IntVar(&currentConfig.QueryCacheSize, "queryserver-config-query-cache-size", defaultConfig.QueryCacheSize, "query server query cache size, maximum number of queries to be cached. vttablet analyzes every incoming query and generate a query plan, these plans are being cached in a lru cache. This config controls the capacity of the lru cache.")
 	fs.Int64Var(&currentConfig.QueryCacheMemory, "queryserver-config-query-cache-memory", defaultConfig.QueryCacheMemory, "query server query cache size in bytes, maximum amount of memory to be used for caching. vttablet analyzes every incoming query and generate a query plan, these plans are being cached in a lru cache. This config controls the capacity of the lru cache.")
 	fs.BoolVar(&currentConfig.QueryCacheLFU, "queryserver-config-query-cache-lfu", defaultConfig.QueryCacheLFU, "query server cache algorithm. when set to true, a new cache algorithm based on a TinyLFU admission policy will be used to improve cache behavior and prevent pollution from sparse queries")
@@ -172,6 +176,21 @@ func registerTabletEnvFlags(fs *pflag.FlagSet) {
 	flagutil.DualFormatBoolVar(fs, &enableConsolidatorReplicas, "enable_consolidator_replicas", false, "This option enables the query consolidator only on replicas.")
 	fs.Int64Var(&currentConfig.ConsolidatorStreamQuerySize, "consolidator-stream-query-size", defaultConfig.ConsolidatorStreamQuerySize, "Configure the stream consolidator query size in bytes. Setting to 0 disables the stream consolidator.")
 	fs.Int64Var(&currentConfig.ConsolidatorStreamTotalSize, "consolidator-stream-total-size", defaultConfig.ConsolidatorStreamTotalSize, "Configure the stream consolidator total size in bytes. Setting to 0 disables the stream consolidator.")
+	fs.DurationVar(&pointLookupBatchWindow, "queryserver-config-point-lookup-batch-window", 0, "If non-zero, concurrent point selects by an integral primary key on the same table that arrive within this window are merged into a single IN query. Setting to 0 disables point lookup batching.")
+	fs.StringVar(&currentConfig.PlanCacheSnapshotFile, "queryserver-config-plan-cache-snapshot-file", defaultConfig.PlanCacheSnapshotFile, "If set, the queries of the hottest plans of the query plan cache are periodically saved to this file, normalized so that they hold no literals, and planned again in the background when the tablet starts, so that it doesn't serve its first queries with a cold plan cache.")
+	SecondsVar(fs, &currentConfig.PlanCacheSnapshotIntervalSeconds, "queryserver-config-plan-cache-snapshot-interval", defaultConfig.PlanCacheSnapshotIntervalSeconds, "How often (in seconds) the hottest plans of the query plan cache are saved to queryserver-config-plan-cache-snapshot-file.")
+	fs.IntVar(&currentConfig.PlanCacheSnapshotSize, "queryserver-config-plan-cache-snapshot-size", defaultConfig.PlanCacheSnapshotSize, "The maximum number of plans saved to queryserver-config-plan-cache-snapshot-file, the most executed ones first.")
+	fs.StringVar(&currentConfig.ActionStateFile, "queryserver-config-action-state-file", defaultConfig.ActionStateFile, "If set, the runtime state of the actions of the rules, the circuits of the CIRCUIT_BREAKER rules, the token buckets of the RATE_LIMIT rules and the limits of the adaptive CONCURRENCY_CONTROL rules, is periodically saved to this file, and restored when the query engine opens, so that a restarted tablet doesn't let through all at once the queries its rules held back.")
+	SecondsVar(fs, &currentConfig.ActionStateIntervalSeconds, "queryserver-config-action-state-interval", defaultConfig.ActionStateIntervalSeconds, "How often (in seconds) the runtime state of the actions is saved to queryserver-config-action-state-file.")
+	fs.Int64Var(&currentConfig.WasmPlugins.Fuel, "wasm_plugin_fuel", defaultConfig.WasmPlugins.Fuel, "The fuel of a call of a WASM plugin: the number of function calls and loop iterations it runs at most. 0 for no limit.")
+	fs.IntVar(&currentConfig.WasmPlugins.MaxMemoryPages, "wasm_plugin_max_memory_pages", defaultConfig.WasmPlugins.MaxMemoryPages, "The number of 64 KiB pages the memory of a WASM plugin grows to at most. 0 for the 4 GiB of the WASM memories.")
+	SecondsVar(fs, &currentConfig.WasmPlugins.TimeoutSeconds, "wasm_plugin_timeout", defaultConfig.WasmPlugins.TimeoutSeconds, "The wall-clock time (in seconds) a call of a WASM plugin takes at most. 0 for no limit.")
+	fs.IntVar(&currentConfig.WasmPlugins.MaxMetrics, "wasm_plugin_max_metrics", defaultConfig.WasmPlugins.MaxMetrics, "The number of metric names a WASM plugin can create with the host functions. 0 for no limit.")
+	fs.StringVar(&currentConfig.WasmPlugins.OnLimit, "wasm_plugin_on_limit", defaultConfig.WasmPlugins.OnLimit, "What a query does when a WASM plugin it calls hits a limit: fail fails it with RESOURCE_EXHAUSTED, continue skips the plugin. The PLUGIN rules can override it with their on_limit param.")
+	fs.StringVar(&currentConfig.RuleConflictPolicy, "queryserver-config-rule-conflict-policy", defaultConfig.RuleConflictPolicy, "Which of the rules a query matches apply to it when their actions conflict: pipeline runs all of them in the order of their priorities up to a STOP rule, first_match decides the query by the first CONTINUE, FAIL or FAIL_RETRY rule it matches, and strictest_wins rejects the query by its strictest FAIL or FAIL_RETRY rule, whatever the CONTINUE and STOP rules of smaller priorities.")
+	fs.StringVar(&currentConfig.ResourceGroupFile, "queryserver-config-resource-group-file", defaultConfig.ResourceGroupFile, "If set, the JSON file of the resource groups which limit the concurrency, the rate and the result memory of the queries of their users, workload classes, databases or RESOURCE_GROUP rules, and of the database isolation mode, which puts each database in a group of its own. It is read when the query engine opens.")
+	fs.IntVar(&currentConfig.PrioritySlots, "queryserver-config-priority-slots", defaultConfig.PrioritySlots, "The number of queries of the PRIORITY rules which run at once, the others waiting for a slot by the weights of their priority classes. If 0, the size of the query pool.")
+	fs.IntVar(&currentConfig.PointLookupBatchMaxSize, "queryserver-config-point-lookup-batch-max-size", defaultConfig.PointLookupBatchMaxSize, "The maximum number of distinct primary keys merged into a single point lookup batch. A full batch is executed without waiting for the batch window.")
 	flagutil.DualFormatBoolVar(fs, &currentConfig.DeprecatedCacheResultFields, "enable_query_plan_field_caching", defaultConfig.DeprecatedCacheResultFields, "This option fetches & caches fields (columns) when storing query plans")
 	_ = fs.MarkDeprecated("enable_query_plan_field_caching", "it will be removed in a future release.")
 	_ = fs.MarkDeprecated("enable-query-plan-field-caching", "it will be removed in a future release.")
@@ -186,6 +205,7 @@ func registerTabletEnvFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&currentConfig.EnableTableGC, "queryserver_enable_tablegc", defaultConfig.EnableTableGC, "Enable TableGC.")
 	fs.BoolVar(&currentConfig.SanitizeLogMessages, "sanitize_log_messages", false, "Remove potentially sensitive information in tablet INFO, WARNING, and ERROR log messages such as query parameters.")
 	fs.BoolVar(&currentConfig.EnableSettingsPool, "queryserver-enable-settings-pool", false, "Enable pooling of connections with modified system settings")
+	fs.BoolVar(&currentConfig.EnableReadFastPath, "queryserver-enable-read-fast-path", false, "Enable the fast path for autocommit selects without session settings. Such selects skip the transaction and reserved connection handling and reuse a cached connection setting.")
 
 	fs.Int64Var(&currentConfig.RowStreamer.MaxInnoDBTrxHistLen, "vreplication_copy_phase_max_innodb_history_list_length", 1000000, "The maximum InnoDB transaction history that can exist on a vstreamer (source) before starting another round of copying rows. This helps to limit the impact on the source tablet.")
 	fs.Int64Var(&currentConfig.RowStreamer.MaxMySQLReplLagSecs, "vreplication_copy_phase_max_mysql_replication_lag", 43200, "The maximum MySQL replication lag (in seconds) that can exist on a vstreamer (source) before starting another round of copying rows. This helps to limit the impact on the source tablet.")
@@ -251,6 +271,7 @@ func Init() {
 	currentConfig.Healthcheck.DegradedThresholdSeconds.Set(degradedThreshold)
 	currentConfig.Healthcheck.UnhealthyThresholdSeconds.Set(unhealthyThreshold)
 	currentConfig.GracePeriods.TransitionSeconds.Set(transitionGracePeriod)
+	currentConfig.PointLookupBatchWindowSeconds.Set(pointLookupBatchWindow)
 
 	switch streamlog.GetQueryLogFormat() {
 	case streamlog.QueryLogFormatText:
@@ -283,6 +304,7 @@ type TabletConfig struct {
 	Olap             OlapConfig             `json:"olap,omitempty"`
 	Oltp             OltpConfig             `json:"oltp,omitempty"`
 	HotRowProtection HotRowProtectionConfig `json:"hotRowProtection,omitempty"`
+	WasmPlugins      WasmPluginConfig       `json:"wasmPlugins,omitempty"`
 
 	Healthcheck  HealthcheckConfig  `json:"healthcheck,omitempty"`
 	GracePeriods GracePeriodsConfig `json:"gracePeriods,omitempty"`
@@ -293,11 +315,24 @@ type TabletConfig struct {
 	Consolidator                            string  `json:"consolidator,omitempty"`
 	PassthroughDML                          bool    `json:"passthroughDML,omitempty"`
 	StreamBufferSize                        int     `json:"streamBufferSize,omitempty"`
+	StreamBufferSizeAdaptive                bool    `json:"streamBufferSizeAdaptive,omitempty"`
+	StreamMaxBufferedBytes                  int64   `json:"streamMaxBufferedBytes,omitempty"`
+	StreamMaxBufferedBytesPerStream         int64   `json:"streamMaxBufferedBytesPerStream,omitempty"`
 	ConsolidatorStreamTotalSize             int64   `json:"consolidatorStreamTotalSize,omitempty"`
 	ConsolidatorStreamQuerySize             int64   `json:"consolidatorStreamQuerySize,omitempty"`
+	PointLookupBatchWindowSeconds           Seconds `json:"pointLookupBatchWindowSeconds,omitempty"`
+	PointLookupBatchMaxSize                 int     `json:"pointLookupBatchMaxSize,omitempty"`
 	QueryCacheSize                          int     `json:"queryCacheSize,omitempty"`
 	QueryCacheMemory                        int64   `json:"queryCacheMemory,omitempty"`
 	QueryCacheLFU                           bool    `json:"queryCacheLFU,omitempty"`
+	PlanCacheSnapshotFile                   string  `json:"planCacheSnapshotFile,omitempty"`
+	PlanCacheSnapshotIntervalSeconds        Seconds `json:"planCacheSnapshotIntervalSeconds,omitempty"`
+	PlanCacheSnapshotSize                   int     `json:"planCacheSnapshotSize,omitempty"`
+	ActionStateFile                         string  `json:"actionStateFile,omitempty"`
+	ActionStateIntervalSeconds              Seconds `json:"actionStateIntervalSeconds,omitempty"`
+	RuleConflictPolicy                      string  `json:"ruleConflictPolicy,omitempty"`
+	ResourceGroupFile                       string  `json:"resourceGroupFile,omitempty"`
+	PrioritySlots                           int     `json:"prioritySlots,omitempty"`
 	SchemaReloadIntervalSeconds             Seconds `json:"schemaReloadIntervalSeconds,omitempty"`
 	SignalSchemaChangeReloadIntervalSeconds Seconds `json:"signalSchemaChangeReloadIntervalSeconds,omitempty"`
 	WatchReplication                        bool    `json:"watchReplication,omitempty"`
@@ -329,6 +364,7 @@ type TabletConfig struct {
 
 	EnableOnlineDDL    bool `json:"-"`
 	EnableSettingsPool bool `json:"-"`
+	EnableReadFastPath bool `json:"-"`
 
 	RowStreamer RowStreamerConfig `json:"rowStreamer,omitempty"`
 
@@ -368,6 +404,16 @@ type HotRowProtectionConfig struct {
 	MaxConcurrency     int    `json:"maxConcurrency,omitempty"`
 }
 
+// WasmPluginConfig contains the limits of the calls of the WASM plugins.
+type WasmPluginConfig struct {
+	Fuel           int64   `json:"fuel,omitempty"`
+	MaxMemoryPages int     `json:"maxMemoryPages,omitempty"`
+	TimeoutSeconds Seconds `json:"timeoutSeconds,omitempty"`
+	// OnLimit can be fail or continue. Default is fail.
+	OnLimit    string `json:"onLimit,omitempty"`
+	MaxMetrics int    `json:"maxMetrics,omitempty"`
+}
+
 // HealthcheckConfig contains the config for healthcheck.
 type HealthcheckConfig struct {
 	IntervalSeconds           Seconds `json:"intervalSeconds,omitempty"`
@@ -470,6 +516,23 @@ func (c *TabletConfig) Verify() error {
 	if v := c.HotRowProtection.MaxConcurrency; v <= 0 {
 		return fmt.Errorf("-hot_row_protection_concurrent_transactions must be > 0 (specified value: %v)", v)
 	}
+	// The names are the ones of rules.ConflictPolicy, which can't be imported here.
+	switch v := c.RuleConflictPolicy; v {
+	case "", "pipeline", "first_match", "strictest_wins":
+	default:
+		return fmt.Errorf("-queryserver-config-rule-conflict-policy must be pipeline, first_match or strictest_wins (specified value: %q)", v)
+	}
+	if v := c.WasmPlugins.MaxMemoryPages; v < 0 || v > 65536 {
+		return fmt.Errorf("-wasm_plugin_max_memory_pages must be in [0, 65536] (specified value: %v)", v)
+	}
+	switch v := c.WasmPlugins.OnLimit; v {
+	case "", "fail", "continue":
+	default:
+		return fmt.Errorf("-wasm_plugin_on_limit must be fail or continue (specified value: %q)", v)
+	}
+	if v := c.WasmPlugins.MaxMetrics; v < 0 {
+		return fmt.Errorf("-wasm_plugin_max_metrics must be >= 0 (specified value: %v)", v)
+	}
 	return nil
 }
 
@@ -550,9 +613,21 @@ var defaultConfig = TabletConfig{
 		// of them ready in MySQL and profit from a pipelining effect.
 		MaxConcurrency: 5,
 	},
-	Consolidator:                Disable,
-	ConsolidatorStreamTotalSize: 128 * 1024 * 1024,
-	ConsolidatorStreamQuerySize: 2 * 1024 * 1024,
+	WasmPlugins: WasmPluginConfig{
+		Fuel:           10000000,
+		MaxMemoryPages: 256,
+		TimeoutSeconds: 0.05,
+		OnLimit:        "fail",
+		MaxMetrics:     100,
+	},
+	Consolidator:                     Disable,
+	ConsolidatorStreamTotalSize:      128 * 1024 * 1024,
+	ConsolidatorStreamQuerySize:      2 * 1024 * 1024,
+	PointLookupBatchMaxSize:          100,
+	PlanCacheSnapshotIntervalSeconds: 60,
+	PlanCacheSnapshotSize:            1000,
+	ActionStateIntervalSeconds:       10,
+	RuleConflictPolicy:               "pipeline",
 	// The value for StreamBufferSize was chosen after trying out a few of
 	// them. Too small buffers force too many packets to be sent. Too big
 	// buffers force the clients to read them in multiple chunks and make
@@ -93,6 +93,7 @@ rowStreamer:
   maxInnoDBTrxHistLen: 1000
   maxMySQLReplLagSecs: 400
 txPool: {}
+wasmPlugins: {}
 `
 	assert.Equal(t, wantBytes, string(gotBytes))
 
@@ -275,3 +276,31 @@ func TestFlags(t *testing.T) {
 	want.SanitizeLogMessages = true
 	assert.Equal(t, want, currentConfig)
 }
+
+func TestVerifyRuleConflictPolicy(t *testing.T) {
+	config := NewDefaultConfig()
+	for _, policy := range []string{"", "pipeline", "first_match", "strictest_wins"} {
+		config.RuleConflictPolicy = policy
+		assert.NoError(t, config.Verify(), policy)
+	}
+
+	config.RuleConflictPolicy = "last_match"
+	assert.EqualError(t, config.Verify(), `-queryserver-config-rule-conflict-policy must be pipeline, first_match or strictest_wins (specified value: "last_match")`)
+}
+
+func TestVerifyWasmPlugins(t *testing.T) {
+	config := NewDefaultConfig()
+	for _, onLimit := range []string{"", "fail", "continue"} {
+		config.WasmPlugins.OnLimit = onLimit
+		assert.NoError(t, config.Verify(), onLimit)
+	}
+
+	config.WasmPlugins.OnLimit = "retry"
+	assert.EqualError(t, config.Verify(), `-wasm_plugin_on_limit must be fail or continue (specified value: "retry")`)
+	config.WasmPlugins.OnLimit = "fail"
+	config.WasmPlugins.MaxMemoryPages = 65537
+	assert.EqualError(t, config.Verify(), "-wasm_plugin_max_memory_pages must be in [0, 65536] (specified value: 65537)")
+	config.WasmPlugins.MaxMemoryPages = 0
+	config.WasmPlugins.MaxMetrics = -1
+	assert.EqualError(t, config.Verify(), "-wasm_plugin_max_metrics must be >= 0 (specified value: -1)")
+}
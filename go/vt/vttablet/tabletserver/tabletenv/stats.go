@@ -47,6 +47,34 @@ type Stats struct {
 	UserActiveReservedCount *stats.CountersWithSingleLabel // Per CallerID active reserved connection counts
 	UserReservedCount       *stats.CountersWithSingleLabel // Per CallerID reserved connection counts
 	UserReservedTimesNs     *stats.CountersWithSingleLabel // Per CallerID reserved connection duration
+
+	FastPathReads       *stats.Counter // Number of selects served by the read fast path
+	PipelinedStatements *stats.Counter // Number of statements executed by pipelined Executes
+
+	QueryRuleMatches       *stats.CountersWithSingleLabel // Per query rule match counts
+	QueryRuleAffected      *stats.CountersWithSingleLabel // Per query rule queries blocked, queued, delayed or rewritten
+	QueryRuleLastMatch     *stats.GaugesWithSingleLabel   // Per query rule Unix time of the last query matched
+	ResultCacheHits        *stats.CountersWithSingleLabel // Per query rule result cache hits
+	ResultCacheMisses      *stats.CountersWithSingleLabel // Per query rule result cache misses
+	RateLimitRejections    *stats.CountersWithSingleLabel // Per query rule rate limit rejections
+	AuditRecordsDropped    *stats.CountersWithSingleLabel // Per query rule audit records dropped
+	SampleRecordsDropped   *stats.CountersWithSingleLabel // Per query rule sampled query records dropped
+	KilledQueries          *stats.CountersWithSingleLabel // Per query rule queries killed
+	OutcomeMatches         *stats.CountersWithSingleLabel // Per query rule queries whose outcome matched the post execution conditions
+	MirroredQueries        *stats.CountersWithMultiLabels // Per query rule mirrored queries, by result
+	WebhookNotifications   *stats.CountersWithMultiLabels // Per query rule webhook notifications, by result
+	CircuitBreakerEvents   *stats.CountersWithMultiLabels // Per query rule circuit breaker events
+	SQLInjectionDetections *stats.CountersWithMultiLabels // Per query rule suspicious queries, by mode
+	QueryRetries           *stats.CountersWithMultiLabels // Per query rule retries, by error
+	DryRunQueries          *stats.CountersWithMultiLabels // Per dry run query rule matched queries, by effect
+
+	PriorityQueuedQueries *stats.CountersWithSingleLabel // Per priority class queries which waited for an execution slot
+
+	ConcurrencyLimits             *stats.GaugesWithSingleLabel   // Per adaptive concurrency control query rule concurrency limits
+	ConcurrencyControlQueries     *stats.CountersWithMultiLabels // Per concurrency control query rule queries, by result
+	ConcurrencyControlWaiting     *stats.GaugesWithSingleLabel   // Per concurrency control query rule queries waiting for a slot
+	ConcurrencyControlInFlight    *stats.GaugesWithSingleLabel   // Per concurrency control query rule queries holding a slot
+	ConcurrencyControlWaitTimings *servenv.TimingsWrapper        // Per concurrency control query rule wait times of the queued queries
 }
 
 // NewStats instantiates a new set of stats scoped by exporter.
@@ -94,6 +122,34 @@ func NewStats(exporter *servenv.Exporter) *Stats {
 		UserActiveReservedCount: exporter.NewCountersWithSingleLabel("UserActiveReservedCount", "active reserved connection for each CallerID", "CallerID"),
 		UserReservedCount:       exporter.NewCountersWithSingleLabel("UserReservedCount", "reserved connection received for each CallerID", "CallerID"),
 		UserReservedTimesNs:     exporter.NewCountersWithSingleLabel("UserReservedTimesNs", "Total reserved connection latency for each CallerID", "CallerID"),
+
+		FastPathReads:       exporter.NewCounter("FastPathReads", "Number of selects served by the read fast path"),
+		PipelinedStatements: exporter.NewCounter("PipelinedStatements", "Number of statements executed by pipelined Executes"),
+
+		QueryRuleMatches:       exporter.NewCountersWithSingleLabel("QueryRuleMatches", "Number of queries matched by each query rule", "Rule"),
+		QueryRuleAffected:      exporter.NewCountersWithSingleLabel("QueryRuleAffected", "Number of queries each query rule blocked, queued, delayed or rewrote", "Rule"),
+		QueryRuleLastMatch:     exporter.NewGaugesWithSingleLabel("QueryRuleLastMatch", "Unix time in seconds of the last query matched by each query rule", "Rule"),
+		ResultCacheHits:        exporter.NewCountersWithSingleLabel("ResultCacheHits", "Number of queries served from the result cache of each query rule", "Rule"),
+		ResultCacheMisses:      exporter.NewCountersWithSingleLabel("ResultCacheMisses", "Number of queries missing from the result cache of each query rule", "Rule"),
+		RateLimitRejections:    exporter.NewCountersWithSingleLabel("RateLimitRejections", "Number of queries rejected by the rate limit of each query rule", "Rule"),
+		AuditRecordsDropped:    exporter.NewCountersWithSingleLabel("AuditRecordsDropped", "Number of audit records of each query rule dropped because their sink was behind", "Rule"),
+		SampleRecordsDropped:   exporter.NewCountersWithSingleLabel("SampleRecordsDropped", "Number of sampled queries of each query rule dropped because their diagnostics file was behind", "Rule"),
+		KilledQueries:          exporter.NewCountersWithSingleLabel("KilledQueries", "Number of queries of each query rule killed because they ran too long", "Rule"),
+		OutcomeMatches:         exporter.NewCountersWithSingleLabel("OutcomeMatches", "Number of queries of each query rule whose latency, rows or error matched its post execution conditions", "Rule"),
+		MirroredQueries:        exporter.NewCountersWithMultiLabels("MirroredQueries", "Number of queries of each query rule replayed on its mirror, by result: ok, error, unavailable or dropped", []string{"Rule", "Result"}),
+		WebhookNotifications:   exporter.NewCountersWithMultiLabels("WebhookNotifications", "Number of webhook notifications of each query rule, by result: sent, failed, dropped or rate_limited", []string{"Rule", "Result"}),
+		CircuitBreakerEvents:   exporter.NewCountersWithMultiLabels("CircuitBreakerEvents", "Number of times the circuit of each query rule opened, closed, or rejected a query", []string{"Rule", "Event"}),
+		SQLInjectionDetections: exporter.NewCountersWithMultiLabels("SQLInjectionDetections", "Number of queries of each query rule scored as SQL injections, by mode: observe, warn or block", []string{"Rule", "Mode"}),
+		DryRunQueries:          exporter.NewCountersWithMultiLabels("DryRunQueries", "Number of queries matched by each DRY_RUN query rule, by the effect its action would have: none, fail, queue or apply", []string{"Rule", "Effect"}),
+		QueryRetries:           exporter.NewCountersWithMultiLabels("QueryRetries", "Number of retries of the statements of each query rule, by error: deadlock, lock_wait_timeout or connection", []string{"Rule", "Error"}),
+
+		PriorityQueuedQueries: exporter.NewCountersWithSingleLabel("PriorityQueuedQueries", "Number of queries of each priority class which waited for an execution slot", "Class"),
+
+		ConcurrencyLimits:             exporter.NewGaugesWithSingleLabel("ConcurrencyLimits", "Current concurrency limit of each adaptive concurrency control query rule", "Rule"),
+		ConcurrencyControlQueries:     exporter.NewCountersWithMultiLabels("ConcurrencyControlQueries", "Number of queries of each concurrency control query rule, by result: admitted, queued, rejected, cancelled or wait_exceeded", []string{"Rule", "Result"}),
+		ConcurrencyControlWaiting:     exporter.NewGaugesWithSingleLabel("ConcurrencyControlWaiting", "Number of queries of each concurrency control query rule waiting for a slot", "Rule"),
+		ConcurrencyControlInFlight:    exporter.NewGaugesWithSingleLabel("ConcurrencyControlInFlight", "Number of queries of each concurrency control query rule holding a slot", "Rule"),
+		ConcurrencyControlWaitTimings: exporter.NewTimings("ConcurrencyControlWaits", "Wait times of the queued queries of each concurrency control query rule", "Rule"),
 	}
 	stats.QPSRates = exporter.NewRates("QPS", stats.QueryTimings, 15*60/5, 5*time.Second)
 	return stats
@@ -75,6 +75,7 @@ import (
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/txserializer"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/txthrottler"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/vstreamer"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
 	"vitess.io/vitess/go/vt/vttablet/vexec"
 
 	binlogdatapb "vitess.io/vitess/go/vt/proto/binlogdata"
@@ -138,6 +139,10 @@ type TabletServer struct {
 
 	// This field is only stored for testing
 	checkMysqlGaugeFunc *stats.GaugeFunc
+
+	// autocommitSettings caches the connection settings of requests
+	// without session settings, see autocommitConnSetting.
+	autocommitSettings sync.Map
 }
 
 var _ queryservice.QueryService = (*TabletServer)(nil)
@@ -233,6 +238,12 @@ func NewTabletServer(name string, config *tabletenv.TabletConfig, topoServer *to
 		return map[string]int64{tsv.sm.IsServingString(): 1}
 	})
 	tsv.exporter.NewGaugeDurationFunc("QueryTimeout", "Tablet server query timeout", tsv.QueryTimeout.Get)
+	tsv.exporter.NewGaugesFuncWithMultiLabels("StreamBufferedBytesByStream", "Result bytes currently buffered by each streaming query", []string{"Type", "ConnID"}, func() map[string]int64 {
+		buffered := make(map[string]int64)
+		tsv.statefulql.AddBufferedBytes(buffered)
+		tsv.olapql.AddBufferedBytes(buffered)
+		return buffered
+	})
 
 	tsv.registerHealthzHealthHandler()
 	tsv.registerDebugHealthHandler()
@@ -328,16 +339,33 @@ func (tsv *TabletServer) UnRegisterQueryRuleSource(ruleSource string) {
 	tsv.qe.queryRuleSources.UnRegisterSource(ruleSource)
 }
 
-// SetQueryRules sets the query rules for a registered ruleSource.
+// SetQueryRules sets the query rules for a registered ruleSource. The rules
+// are rejected if the args of one of their actions are invalid.
 func (tsv *TabletServer) SetQueryRules(ruleSource string, qrs *rules.Rules) error {
+	if qrs != nil {
+		qrs = qrs.Copy()
+		if err := compileRules(qrs); err != nil {
+			return err
+		}
+	}
 	err := tsv.qe.queryRuleSources.SetRules(ruleSource, qrs)
 	if err != nil {
 		return err
 	}
 	tsv.qe.ClearQueryPlanCache()
+	tsv.qe.resizeConcurrencyControlQueues()
+	tsv.qe.releaseRemovedRules()
+	tsv.killRunningQueries()
 	return nil
 }
 
+// ReloadWasmPlugins loads the versions of the WASM plugins the PLUGIN rules
+// reference from source, and swaps them in at once. The queries running keep
+// the versions they got.
+func (tsv *TabletServer) ReloadWasmPlugins(ctx context.Context, source wasm.Source) error {
+	return tsv.qe.wasmLoader.Reload(ctx, tsv.qe.pluginReferences(), source)
+}
+
 func (tsv *TabletServer) initACL(env tabletenv.Env, tableACLMode string, tableACLConfigFile string, enforceTableACLConfig bool, reloadACLConfigFileInterval time.Duration) {
 	// tabletacl.Init loads ACL from file if *tableACLConfig is not empty
 	err := tableacl.Init(
@@ -457,6 +485,11 @@ func (tsv *TabletServer) QueryService() queryservice.QueryService {
 	return tsv
 }
 
+// CurrentTarget returns the current target of TabletServer.
+func (tsv *TabletServer) CurrentTarget() *querypb.Target {
+	return tsv.sm.Target()
+}
+
 // OnlineDDLExecutor returns the onlineddl.Executor part of TabletServer.
 func (tsv *TabletServer) OnlineDDLExecutor() vexec.Executor {
 	return tsv.onlineDDLExecutor
@@ -741,6 +774,9 @@ func (tsv *TabletServer) Execute(ctx context.Context, target *querypb.Target, sq
 	if transactionID != 0 && reservedID != 0 && transactionID != reservedID {
 		return nil, vterrors.New(vtrpcpb.Code_INTERNAL, "[BUG] transactionID and reserveID must match if both are non-zero")
 	}
+	if statements, ok := queryservice.GetPipelinedStatements(bindVariables); ok {
+		return tsv.executePipeline(ctx, target, statements, transactionID, reservedID, options)
+	}
 
 	return tsv.execute(ctx, target, sql, bindVariables, transactionID, reservedID, nil, options)
 }
@@ -763,7 +799,10 @@ func (tsv *TabletServer) execute(ctx context.Context, target *querypb.Target, sq
 		target, options, allowOnShutdown,
 		func(ctx context.Context, logStats *tabletenv.LogStats) error {
 			if bindVariables == nil {
-				bindVariables = make(map[string]*querypb.BindVariable)
+				// Nothing keeps a reference to the bind variables once the
+				// query is executed.
+				bindVariables = allocBindVars()
+				defer returnBindVars(bindVariables)
 			}
 			query, comments := sqlparser.SplitMarginComments(sql)
 			plan, err := tsv.qe.GetPlan(ctx, logStats, target.Keyspace, query, skipQueryPlanCache(options))
@@ -781,23 +820,29 @@ func (tsv *TabletServer) execute(ctx context.Context, target *querypb.Target, sq
 			logStats.ReservedID = reservedID
 			logStats.TransactionID = transactionID
 
-			connSetting, err := tsv.buildConnSettingForUserKeyspace(ctx, settings, target.Keyspace, options)
-			if err != nil {
-				return err
-			}
-			qre := &QueryExecutor{
-				query:          query,
-				marginComments: comments,
-				bindVars:       bindVariables,
-				connID:         connID,
-				options:        options,
-				plan:           plan,
-				ctx:            ctx,
-				logStats:       logStats,
-				tsv:            tsv,
-				tabletType:     target.GetTabletType(),
-				setting:        connSetting,
+			var connSetting *pools.Setting
+			if connID == 0 && len(settings) == 0 && tsv.config.EnableReadFastPath {
+				connSetting = tsv.autocommitConnSetting(target.Keyspace, options)
+			} else {
+				connSetting, err = tsv.buildConnSettingForUserKeyspace(ctx, settings, target.Keyspace, options)
+				if err != nil {
+					return err
+				}
 			}
+			qre := allocQueryExecutor()
+			defer returnQueryExecutor(qre)
+			qre.query = query
+			qre.marginComments = comments
+			qre.bindVars = bindVariables
+			qre.connID = connID
+			qre.options = options
+			qre.plan = plan
+			qre.ctx = ctx
+			qre.logStats = logStats
+			qre.tsv = tsv
+			qre.tabletType = target.GetTabletType()
+			qre.database = target.GetKeyspace()
+			qre.setting = connSetting
 			result, err = qre.Execute()
 			if err != nil {
 				return err
@@ -932,6 +977,7 @@ func (tsv *TabletServer) streamExecute(ctx context.Context, target *querypb.Targ
 				ctx:            ctx,
 				logStats:       logStats,
 				tsv:            tsv,
+				database:       target.GetKeyspace(),
 				setting:        connSetting,
 			}
 			return qre.Stream(callback)
@@ -2088,6 +2134,26 @@ func (tsv *TabletServer) MaxResultSize() int {
 	return int(tsv.qe.maxResultSize.Get())
 }
 
+// SetStreamMaxBufferedBytes changes the stream buffer budget to the specified value.
+func (tsv *TabletServer) SetStreamMaxBufferedBytes(val int64) {
+	tsv.qe.streamBudget.SetCapacity(val)
+}
+
+// StreamMaxBufferedBytes returns the stream buffer budget.
+func (tsv *TabletServer) StreamMaxBufferedBytes() int64 {
+	return tsv.qe.streamBudget.Capacity()
+}
+
+// SetStreamMaxBufferedBytesPerStream changes the buffer of each stream to the specified value.
+func (tsv *TabletServer) SetStreamMaxBufferedBytesPerStream(val int64) {
+	tsv.qe.streamBufferCapacity.Set(val)
+}
+
+// StreamMaxBufferedBytesPerStream returns the buffer of each stream.
+func (tsv *TabletServer) StreamMaxBufferedBytesPerStream() int64 {
+	return tsv.qe.streamBufferCapacity.Get()
+}
+
 // SetWarnResultSize changes the warn result size to the specified value.
 func (tsv *TabletServer) SetWarnResultSize(val int) {
 	tsv.qe.warnResultSize.Set(int64(val))
@@ -2171,7 +2237,41 @@ func withTimeout(ctx context.Context, timeout time.Duration, options *querypb.Ex
 	if timeout == 0 || options.GetWorkload() == querypb.ExecuteOptions_DBA || tabletenv.IsLocalContext(ctx) {
 		return ctx, func() {}
 	}
-	return context.WithTimeout(ctx, timeout)
+	// The context without the timeout is kept for the rules overriding it.
+	return context.WithTimeout(context.WithValue(ctx, untimedContextKey{}, ctx), timeout)
+}
+
+// untimedContextKey is the key of the context of a request before
+// withTimeout.
+type untimedContextKey struct{}
+
+// timeoutOverrideContext is the context of a query whose timeout was
+// overridden: it takes its deadline from its own context, and its values from
+// the context it overrides.
+type timeoutOverrideContext struct {
+	context.Context
+	values context.Context
+}
+
+func (ctx *timeoutOverrideContext) Value(key any) any {
+	return ctx.values.Value(key)
+}
+
+// withTimeoutOverride replaces the timeout of the context of a request, set
+// by withTimeout, with another one, 0 being none.
+func withTimeoutOverride(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	untimed, ok := ctx.Value(untimedContextKey{}).(context.Context)
+	if !ok {
+		untimed = ctx
+	}
+	var deadlineCtx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		deadlineCtx, cancel = context.WithTimeout(untimed, timeout)
+	} else {
+		deadlineCtx, cancel = context.WithCancel(untimed)
+	}
+	return &timeoutOverrideContext{Context: deadlineCtx, values: ctx}, cancel
 }
 
 // skipQueryPlanCache returns true if the query plan should be cached
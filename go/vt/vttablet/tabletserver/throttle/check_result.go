@@ -19,6 +19,8 @@ type CheckResult struct {
 	Threshold  float64 `json:"Threshold"`
 	Error      error   `json:"-"`
 	Message    string  `json:"Message"`
+	// MetricName is the custom metric which failed the check, if any
+	MetricName string `json:"MetricName,omitempty"`
 }
 
 // NewCheckResult returns a CheckResult
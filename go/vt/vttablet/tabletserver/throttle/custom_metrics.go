@@ -0,0 +1,379 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package throttle
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/patrickmn/go-cache"
+
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/throttle/base"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/throttle/mysql"
+)
+
+// The custom metrics are metrics of the tablet the throttler checks besides
+// the replication lag, or the --throttle_metrics_query metric. They are read
+// from the --throttle_custom_metrics_config JSON file:
+//
+//	{"metrics": [
+//		{"name": "history_list", "type": "query", "query": "show global status like 'Innodb_history_list_length'", "threshold": 100000},
+//		{"name": "load", "type": "http", "url": "http://localhost:9100/metrics", "metric": "node_load1", "threshold": 8},
+//		{"name": "cpu", "type": "node_cpu", "url": "http://localhost:9100/metrics", "threshold": 0.8, "app_thresholds": {"online-ddl": 0.5, "dml-job": 0.6}}
+//	]}
+//
+// The metrics are of one of the types:
+//   - query: the value of a select or show global query on the MySQL server
+//     of the tablet, like --throttle_metrics_query;
+//   - http: the body of an HTTP endpoint, which is a number, or the sample of
+//     metric with labels in it if it serves Prometheus metrics;
+//   - node_cpu: the busy ratio of the CPUs, from 0 to 1, between two scrapes
+//     of the node_cpu_seconds_total metric of a Prometheus node exporter.
+//
+// A check of an app is throttled if a custom metric is over its threshold for
+// the app: the threshold of app_thresholds for the app name, or for one of the
+// parts of the name separated by ':', like dml-job for dml-job:<uuid>, else
+// threshold. The metrics are collected by each tablet for itself, so they are
+// checked by the checks of the tablet, and are named custom/<name> in the
+// status of the throttler.
+
+const (
+	customStoreType = "custom"
+
+	customMetricTypeQuery   = "query"
+	customMetricTypeHTTP    = "http"
+	customMetricTypeNodeCPU = "node_cpu"
+
+	nodeCPUMetric = "node_cpu_seconds_total"
+)
+
+var throttleCustomMetricsConfig string
+
+// customMetric is a metric of the --throttle_custom_metrics_config file.
+type customMetric struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Query  string            `json:"query,omitempty"`
+	URL    string            `json:"url,omitempty"`
+	Metric string            `json:"metric,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Threshold     float64            `json:"threshold"`
+	AppThresholds map[string]float64 `json:"app_thresholds,omitempty"`
+
+	// readInProgress avoids reading the metric twice at the same time.
+	readInProgress int64
+
+	// The CPU seconds of the last scrape of a node_cpu metric.
+	mu                 sync.Mutex
+	scraped            bool
+	idleSeconds, total float64
+}
+
+// customMetricResult is the value of a custom metric, or the error reading it.
+type customMetricResult struct {
+	Value float64
+	Err   error
+}
+
+// Get implements MetricResult
+func (result *customMetricResult) Get() (float64, error) {
+	return result.Value, result.Err
+}
+
+// loadCustomMetrics reads the --throttle_custom_metrics_config file.
+func (throttler *Throttler) loadCustomMetrics() error {
+	if throttleCustomMetricsConfig == "" {
+		return nil
+	}
+	data, err := os.ReadFile(throttleCustomMetricsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to read --throttle_custom_metrics_config: %w", err)
+	}
+	metrics, err := parseCustomMetrics(data)
+	if err != nil {
+		return fmt.Errorf("invalid --throttle_custom_metrics_config %s: %w", throttleCustomMetricsConfig, err)
+	}
+	throttler.customMetrics.Store(&metrics)
+	log.Infof("Throttler: loaded %d custom metrics from %s", len(metrics), throttleCustomMetricsConfig)
+	return nil
+}
+
+// parseCustomMetrics reads and checks the metrics of a
+// --throttle_custom_metrics_config file.
+func parseCustomMetrics(data []byte) ([]*customMetric, error) {
+	var config struct {
+		Metrics []*customMetric `json:"metrics"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(config.Metrics))
+	for i, metric := range config.Metrics {
+		if metric.Name == "" || strings.Contains(metric.Name, "/") {
+			return nil, fmt.Errorf("custom metric #%d has no name, or a name with a /", i+1)
+		}
+		if names[metric.Name] {
+			return nil, fmt.Errorf("custom metric %s is defined twice", metric.Name)
+		}
+		names[metric.Name] = true
+		switch metric.Type {
+		case customMetricTypeQuery:
+			if t := mysql.GetMetricsQueryType(metric.Query); t != mysql.MetricsQueryTypeSelect && t != mysql.MetricsQueryTypeShowGlobal {
+				return nil, fmt.Errorf("custom metric %s: the query must be a select or a show global query", metric.Name)
+			}
+		case customMetricTypeHTTP, customMetricTypeNodeCPU:
+			if metric.URL == "" {
+				return nil, fmt.Errorf("custom metric %s has no url", metric.Name)
+			}
+		default:
+			return nil, fmt.Errorf("custom metric %s: type must be one of %s, %s or %s", metric.Name, customMetricTypeQuery, customMetricTypeHTTP, customMetricTypeNodeCPU)
+		}
+		if metric.Threshold <= 0 {
+			return nil, fmt.Errorf("custom metric %s has no threshold", metric.Name)
+		}
+	}
+	return config.Metrics, nil
+}
+
+// getCustomMetrics returns the custom metrics, in the order of the file.
+func (throttler *Throttler) getCustomMetrics() []*customMetric {
+	if metrics := throttler.customMetrics.Load(); metrics != nil {
+		return *metrics
+	}
+	return nil
+}
+
+// threshold returns the threshold of the metric for an app.
+func (metric *customMetric) threshold(appName string) float64 {
+	if threshold, ok := metric.AppThresholds[appName]; ok {
+		return threshold
+	}
+	for _, singleAppName := range strings.Split(appName, ":") {
+		if threshold, ok := metric.AppThresholds[singleAppName]; ok {
+			return threshold
+		}
+	}
+	return metric.Threshold
+}
+
+// getCustomMetric returns the last value of a custom metric, and its threshold
+// for an app.
+func (throttler *Throttler) getCustomMetric(metricName, appName string) (base.MetricResult, float64) {
+	for _, metric := range throttler.getCustomMetrics() {
+		if metric.Name == metricName {
+			return throttler.getNamedMetric(customStoreType + "/" + metricName), metric.threshold(appName)
+		}
+	}
+	return base.NoSuchMetric, 0
+}
+
+// checkCustomMetrics checks the custom metrics for an app. It returns the
+// first check which is not OK, or nil. The metrics which are not collected yet
+// are not checked.
+func (throttler *Throttler) checkCustomMetrics(ctx context.Context, appName string, remoteAddr string, flags *CheckFlags) *CheckResult {
+	metrics := throttler.getCustomMetrics()
+	if len(metrics) == 0 {
+		return nil
+	}
+	// The threshold overrides of the checks are for the main metric.
+	customFlags := *flags
+	customFlags.OverrideThreshold = 0
+	for _, metric := range metrics {
+		checkResult := throttler.check.Check(ctx, appName, customStoreType, metric.Name, remoteAddr, &customFlags)
+		if checkResult.StatusCode != http.StatusOK && checkResult.StatusCode != http.StatusNotFound {
+			checkResult.MetricName = customStoreType + "/" + metric.Name
+			return checkResult
+		}
+	}
+	return nil
+}
+
+// collectCustomMetrics reads the custom metrics in the background.
+func (throttler *Throttler) collectCustomMetrics(ctx context.Context) {
+	for _, metric := range throttler.getCustomMetrics() {
+		metric := metric
+		go func() {
+			if !atomic.CompareAndSwapInt64(&metric.readInProgress, 0, 1) {
+				return
+			}
+			defer atomic.StoreInt64(&metric.readInProgress, 0)
+
+			result := &customMetricResult{}
+			result.Value, result.Err = throttler.readCustomMetric(ctx, metric)
+			if result.Err == errNoCPUSampleYet {
+				return
+			}
+			throttler.aggregatedMetrics.Set(customStoreType+"/"+metric.Name, result, cache.DefaultExpiration)
+		}()
+	}
+}
+
+var errNoCPUSampleYet = fmt.Errorf("the first CPU sample is not collected yet")
+
+func (throttler *Throttler) readCustomMetric(ctx context.Context, metric *customMetric) (float64, error) {
+	switch metric.Type {
+	case customMetricTypeQuery:
+		return throttler.readMySQLMetric(ctx, metric.Query)
+	case customMetricTypeHTTP:
+		body, err := throttler.readCustomMetricURL(ctx, metric.URL)
+		if err != nil {
+			return 0, err
+		}
+		if metric.Metric == "" {
+			return strconv.ParseFloat(strings.TrimSpace(string(body)), 64)
+		}
+		var value float64
+		found := false
+		err = scanPrometheusSamples(body, metric.Metric, func(labels map[string]string, sample float64) {
+			if !found && labelsMatch(labels, metric.Labels) {
+				value, found = sample, true
+			}
+		})
+		if err == nil && !found {
+			err = fmt.Errorf("no %s sample in %s", metric.Metric, metric.URL)
+		}
+		return value, err
+	case customMetricTypeNodeCPU:
+		body, err := throttler.readCustomMetricURL(ctx, metric.URL)
+		if err != nil {
+			return 0, err
+		}
+		idleSeconds, total := 0.0, 0.0
+		err = scanPrometheusSamples(body, nodeCPUMetric, func(labels map[string]string, sample float64) {
+			total += sample
+			if labels["mode"] == "idle" {
+				idleSeconds += sample
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+		return metric.cpuBusyRatio(idleSeconds, total)
+	}
+	return 0, fmt.Errorf("unknown type %s of custom metric %s", metric.Type, metric.Name)
+}
+
+// cpuBusyRatio returns the busy ratio of the CPUs since the last scrape.
+func (metric *customMetric) cpuBusyRatio(idleSeconds, total float64) (float64, error) {
+	metric.mu.Lock()
+	defer metric.mu.Unlock()
+	scraped, lastIdleSeconds, lastTotal := metric.scraped, metric.idleSeconds, metric.total
+	metric.scraped, metric.idleSeconds, metric.total = true, idleSeconds, total
+	if !scraped || total <= lastTotal {
+		// The first scrape, or the node exporter restarted.
+		return 0, errNoCPUSampleYet
+	}
+	return 1 - (idleSeconds-lastIdleSeconds)/(total-lastTotal), nil
+}
+
+func (throttler *Throttler) readCustomMetricURL(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := throttler.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status code %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// scanPrometheusSamples calls f with the labels and the value of every sample
+// of a metric in the Prometheus text format.
+func scanPrometheusSamples(body []byte, metricName string, f func(labels map[string]string, value float64)) error {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, metricName) || len(line) == len(metricName) {
+			continue
+		}
+		rest := line[len(metricName):]
+		labels := map[string]string{}
+		switch rest[0] {
+		case '{':
+			end := strings.LastIndexByte(rest, '}')
+			if end < 0 {
+				return fmt.Errorf("invalid sample: %s", line)
+			}
+			for _, pair := range splitPrometheusLabels(rest[1:end]) {
+				key, value, ok := strings.Cut(pair, "=")
+				if !ok {
+					return fmt.Errorf("invalid sample: %s", line)
+				}
+				if unquoted, err := strconv.Unquote(strings.TrimSpace(value)); err == nil {
+					value = unquoted
+				}
+				labels[strings.TrimSpace(key)] = value
+			}
+			rest = rest[end+1:]
+		case ' ', '\t':
+		default:
+			// Another metric with this prefix.
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return fmt.Errorf("invalid sample: %s", line)
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid sample: %s", line)
+		}
+		f(labels, value)
+	}
+	return scanner.Err()
+}
+
+// splitPrometheusLabels splits the labels of a sample on the commas which are
+// not in their quoted values.
+func splitPrometheusLabels(labels string) (pairs []string) {
+	quoted, escaped, start := false, false, 0
+	for i, c := range labels {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			pairs = append(pairs, labels[start:i])
+			start = i + 1
+		}
+	}
+	if strings.TrimSpace(labels[start:]) != "" {
+		pairs = append(pairs, labels[start:])
+	}
+	return pairs
+}
+
+func labelsMatch(labels, want map[string]string) bool {
+	for key, value := range want {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
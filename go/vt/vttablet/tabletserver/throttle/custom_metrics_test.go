@@ -0,0 +1,161 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+)
+
+const testNodeExporterMetrics = `# HELP node_cpu_seconds_total Seconds the CPUs spent in each mode.
+# TYPE node_cpu_seconds_total counter
+node_cpu_seconds_total{cpu="0",mode="idle"} %v
+node_cpu_seconds_total{cpu="0",mode="user"} %v
+node_cpu_seconds_total_other 1000
+node_load1 3.5
+http_requests_total{path="/a,b",code="200"} 7
+http_requests_total{path="/c",code="500"} 2
+`
+
+func TestParseCustomMetrics(t *testing.T) {
+	metrics, err := parseCustomMetrics([]byte(`{"metrics": [
+		{"name": "history", "type": "query", "query": "show global status like 'Innodb_history_list_length'", "threshold": 100000},
+		{"name": "cpu", "type": "node_cpu", "url": "http://localhost:9100/metrics", "threshold": 0.8, "app_thresholds": {"dml-job": 0.5}}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, 0.8, metrics[1].threshold("online-ddl:uuid"))
+	assert.Equal(t, 0.5, metrics[1].threshold("dml-job:uuid"))
+	assert.Equal(t, 0.5, metrics[1].threshold("dml-job"))
+
+	for _, tcase := range []struct {
+		config, err string
+	}{
+		{`{"metrics": [{"type": "http", "url": "u", "threshold": 1}]}`, "custom metric #1 has no name, or a name with a /"},
+		{`{"metrics": [{"name": "a", "type": "http", "url": "u", "threshold": 1}, {"name": "a", "type": "http", "url": "u", "threshold": 1}]}`, "custom metric a is defined twice"},
+		{`{"metrics": [{"name": "a", "type": "query", "query": "delete from t", "threshold": 1}]}`, "custom metric a: the query must be a select or a show global query"},
+		{`{"metrics": [{"name": "a", "type": "http", "threshold": 1}]}`, "custom metric a has no url"},
+		{`{"metrics": [{"name": "a", "type": "disk", "threshold": 1}]}`, "custom metric a: type must be one of query, http or node_cpu"},
+		{`{"metrics": [{"name": "a", "type": "http", "url": "u"}]}`, "custom metric a has no threshold"},
+		{`{"metrics": [{"name": "a", "type": "http", "url": "u", "threshold": 1, "interval": 1}]}`, `json: unknown field "interval"`},
+	} {
+		_, err := parseCustomMetrics([]byte(tcase.config))
+		assert.EqualError(t, err, tcase.err, tcase.config)
+	}
+}
+
+func TestScanPrometheusSamples(t *testing.T) {
+	body := []byte(fmt.Sprintf(testNodeExporterMetrics, 10, 5))
+	var samples []map[string]string
+	var values []float64
+	err := scanPrometheusSamples(body, "http_requests_total", func(labels map[string]string, value float64) {
+		samples = append(samples, labels)
+		values = append(values, value)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"path": "/a,b", "code": "200"}, {"path": "/c", "code": "500"}}, samples)
+	assert.Equal(t, []float64{7, 2}, values)
+	assert.True(t, labelsMatch(samples[1], map[string]string{"code": "500"}))
+	assert.False(t, labelsMatch(samples[0], map[string]string{"code": "500"}))
+
+	assert.Error(t, scanPrometheusSamples([]byte("node_load1 high\n"), "node_load1", func(map[string]string, float64) {}))
+}
+
+func newTestThrottler(t *testing.T, config string) *Throttler {
+	throttler := NewThrottler(tabletenv.NewEnv(tabletenv.NewDefaultConfig(), t.Name()), nil, nil, "cell", nil, func() topodatapb.TabletType {
+		return topodatapb.TabletType_PRIMARY
+	})
+	metrics, err := parseCustomMetrics([]byte(config))
+	require.NoError(t, err)
+	throttler.customMetrics.Store(&metrics)
+	return throttler
+}
+
+func TestReadCustomMetrics(t *testing.T) {
+	idle, user := 10.0, 5.0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" {
+			fmt.Fprintln(w, "42")
+			return
+		}
+		fmt.Fprintf(w, testNodeExporterMetrics, idle, user)
+	}))
+	defer server.Close()
+	throttler := newTestThrottler(t, `{"metrics": [
+		{"name": "plain", "type": "http", "url": "`+server.URL+`/plain", "threshold": 1},
+		{"name": "load", "type": "http", "url": "`+server.URL+`/metrics", "metric": "node_load1", "threshold": 1},
+		{"name": "errors", "type": "http", "url": "`+server.URL+`/metrics", "metric": "http_requests_total", "labels": {"code": "500"}, "threshold": 1},
+		{"name": "missing", "type": "http", "url": "`+server.URL+`/metrics", "metric": "node_load5", "threshold": 1},
+		{"name": "cpu", "type": "node_cpu", "url": "`+server.URL+`/metrics", "threshold": 1}
+	]}`)
+	ctx := context.Background()
+	read := func(name string) (float64, error) {
+		for _, metric := range throttler.getCustomMetrics() {
+			if metric.Name == name {
+				return throttler.readCustomMetric(ctx, metric)
+			}
+		}
+		return 0, fmt.Errorf("no metric %s", name)
+	}
+
+	for name, want := range map[string]float64{"plain": 42, "load": 3.5, "errors": 2} {
+		value, err := read(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, value, name)
+	}
+	_, err := read("missing")
+	assert.EqualError(t, err, "no node_load5 sample in "+server.URL+"/metrics")
+
+	// The CPU busy ratio is known from the second scrape.
+	_, err = read("cpu")
+	assert.Equal(t, errNoCPUSampleYet, err)
+	idle, user = 11, 8
+	value, err := read("cpu")
+	require.NoError(t, err)
+	assert.Equal(t, 0.75, value)
+}
+
+func TestCheckCustomMetrics(t *testing.T) {
+	throttler := newTestThrottler(t, `{"metrics": [
+		{"name": "history", "type": "query", "query": "select 1", "threshold": 100, "app_thresholds": {"dml-job": 10}},
+		{"name": "cpu", "type": "node_cpu", "url": "http://localhost:9100/metrics", "threshold": 0.9}
+	]}`)
+	ctx := context.Background()
+	throttler.aggregatedMetrics.Set("custom/history", &customMetricResult{Value: 50}, cache.DefaultExpiration)
+
+	checkResult := throttler.check.Check(ctx, "online-ddl:uuid", customStoreType, "history", "", StandardCheckFlags)
+	assert.Equal(t, http.StatusOK, checkResult.StatusCode)
+	assert.Equal(t, 100.0, checkResult.Threshold)
+	checkResult = throttler.check.Check(ctx, "dml-job:uuid", customStoreType, "history", "", StandardCheckFlags)
+	assert.Equal(t, http.StatusTooManyRequests, checkResult.StatusCode)
+	assert.Equal(t, 10.0, checkResult.Threshold)
+	checkResult = throttler.check.Check(ctx, "dml-job:uuid", customStoreType, "undefined", "", StandardCheckFlags)
+	assert.Equal(t, http.StatusNotFound, checkResult.StatusCode)
+
+	// The cpu metric is not collected yet, so only history is checked, with
+	// the threshold of the app rather than the override of the check.
+	assert.Nil(t, throttler.checkCustomMetrics(ctx, "online-ddl:uuid", "", StandardCheckFlags))
+	checkResult = throttler.checkCustomMetrics(ctx, "dml-job:uuid", "", &CheckFlags{OverrideThreshold: 1000})
+	require.NotNil(t, checkResult)
+	assert.Equal(t, http.StatusTooManyRequests, checkResult.StatusCode)
+	assert.Equal(t, "custom/history", checkResult.MetricName)
+
+	throttler.aggregatedMetrics.Set("custom/cpu", &customMetricResult{Err: fmt.Errorf("connection refused")}, cache.DefaultExpiration)
+	checkResult = throttler.checkCustomMetrics(ctx, "online-ddl:uuid", "", StandardCheckFlags)
+	require.NotNil(t, checkResult)
+	assert.Equal(t, http.StatusInternalServerError, checkResult.StatusCode)
+	assert.Equal(t, "custom/cpu", checkResult.MetricName)
+}
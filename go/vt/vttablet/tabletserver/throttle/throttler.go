@@ -46,6 +46,7 @@ const (
 	mysqlDormantCollectInterval = 5 * time.Second
 	mysqlRefreshInterval        = 10 * time.Second
 	mysqlAggregateInterval      = 125 * time.Millisecond
+	customCollectInterval       = time.Second
 
 	aggregatedMetricsExpiration   = 5 * time.Second
 	throttledAppsSnapshotInterval = 5 * time.Second
@@ -84,6 +85,7 @@ func registerThrottlerFlags(fs *pflag.FlagSet) {
 	fs.Float64Var(&throttleMetricThreshold, "throttle_metrics_threshold", throttleMetricThreshold, "Override default throttle threshold, respective to -throttle_metrics_query")
 	fs.BoolVar(&throttlerCheckAsCheckSelf, "throttle_check_as_check_self", throttlerCheckAsCheckSelf, "Should throttler/check return a throttler/check-self result (changes throttler behavior for writes)")
 	fs.BoolVar(&throttlerConfigViaTopo, "throttler-config-via-topo", throttlerConfigViaTopo, "When 'true', read config from topo service and ignore throttle_threshold, throttle_metrics_threshold, throttle_metrics_query, throttle_check_as_check_self")
+	fs.StringVar(&throttleCustomMetricsConfig, "throttle_custom_metrics_config", throttleCustomMetricsConfig, "JSON file with the custom metrics, from SQL probes, HTTP endpoints or the CPU of a node exporter, the throttler checks besides the replication lag, each with a threshold per app")
 }
 
 var (
@@ -136,6 +138,7 @@ type Throttler struct {
 
 	metricsQuery     atomic.Value
 	MetricsThreshold sync2.AtomicFloat64
+	customMetrics    atomic.Pointer[[]*customMetric]
 
 	mysqlClusterThresholds *cache.Cache
 	aggregatedMetrics      *cache.Cache
@@ -401,6 +404,10 @@ func (throttler *Throttler) Open() error {
 		// already open
 		return nil
 	}
+	if err := throttler.loadCustomMetrics(); err != nil {
+		// The throttler still checks its other metrics.
+		log.Errorf("Throttler.Open(): %v", err)
+	}
 	ctx := context.Background()
 	throttler.pool.Open(throttler.env.Config().DB.AppWithDB(), throttler.env.Config().DB.DbaWithDB(), throttler.env.Config().DB.AppDebugWithDB())
 	atomic.StoreInt64(&throttler.isOpen, 1)
@@ -483,39 +490,41 @@ func (throttler *Throttler) readSelfMySQLThrottleMetric(ctx context.Context, pro
 		Value:       0,
 		Err:         nil,
 	}
+	metric.Value, metric.Err = throttler.readMySQLMetric(ctx, probe.MetricQuery)
+	return metric
+}
+
+// readMySQLMetric reads the value of a metrics query from this very tablet's backend mysql.
+func (throttler *Throttler) readMySQLMetric(ctx context.Context, metricsQuery string) (value float64, err error) {
 	conn, err := throttler.pool.Get(ctx, nil)
 	if err != nil {
-		metric.Err = err
-		return metric
+		return 0, err
 	}
 	defer conn.Recycle()
 
-	tm, err := conn.Exec(ctx, probe.MetricQuery, 1, true)
+	tm, err := conn.Exec(ctx, metricsQuery, 1, true)
 	if err != nil {
-		metric.Err = err
-		return metric
+		return 0, err
 	}
 	row := tm.Named().Row()
 	if row == nil {
-		metric.Err = fmt.Errorf("no results for readSelfMySQLThrottleMetric")
-		return metric
+		return 0, fmt.Errorf("no results for readSelfMySQLThrottleMetric")
 	}
 
-	metricsQueryType := mysql.GetMetricsQueryType(throttler.GetMetricsQuery())
+	metricsQueryType := mysql.GetMetricsQueryType(metricsQuery)
 	switch metricsQueryType {
 	case mysql.MetricsQueryTypeSelect:
 		// We expect a single row, single column result.
 		// The "for" iteration below is just a way to get first result without knowning column name
 		for k := range row {
-			metric.Value, metric.Err = row.ToFloat64(k)
+			value, err = row.ToFloat64(k)
 		}
 	case mysql.MetricsQueryTypeShowGlobal:
-		metric.Value, metric.Err = strconv.ParseFloat(row["Value"].ToString(), 64)
+		value, err = strconv.ParseFloat(row["Value"].ToString(), 64)
 	default:
-		metric.Err = fmt.Errorf("Unsupported metrics query type for query: %s", throttler.GetMetricsQuery())
+		err = fmt.Errorf("Unsupported metrics query type for query: %s", metricsQuery)
 	}
-
-	return metric
+	return value, err
 }
 
 // throttledAppsSnapshot returns a snapshot (a copy) of current throttled apps
@@ -554,6 +563,7 @@ func (throttler *Throttler) Operate(ctx context.Context) {
 	mysqlRefreshTicker := addTicker(mysqlRefreshInterval)
 	mysqlAggregateTicker := addTicker(mysqlAggregateInterval)
 	throttledAppsTicker := addTicker(throttledAppsSnapshotInterval)
+	customCollectTicker := addTicker(customCollectInterval)
 
 	go func() {
 		defer log.Infof("Throttler: Operate terminated, tickers stopped")
@@ -646,6 +656,12 @@ func (throttler *Throttler) Operate(ctx context.Context) {
 						go throttler.expireThrottledApps()
 					}
 				}
+			case <-customCollectTicker.C:
+				{
+					if atomic.LoadInt64(&throttler.isOpen) > 0 {
+						throttler.collectCustomMetrics(ctx)
+					}
+				}
 			case throttlerConfig := <-throttler.throttlerConfigChan:
 				throttler.applyThrottlerConfig(ctx, throttlerConfig)
 			}
@@ -1006,11 +1022,21 @@ func (throttler *Throttler) checkSelf(ctx context.Context, appName string, remot
 	return throttler.checkStore(ctx, appName, selfStoreName, remoteAddr, flags)
 }
 
-// CheckByType runs a check by requested check type
+// CheckByType runs a check by requested check type, and then checks the custom metrics of this tablet
 func (throttler *Throttler) CheckByType(ctx context.Context, appName string, remoteAddr string, flags *CheckFlags, checkType ThrottleCheckType) (checkResult *CheckResult) {
 	if throttler.IsEnabled() && !flags.SkipRequestHeartbeats {
 		go throttler.heartbeatWriter.RequestHeartbeats()
 	}
+	checkResult = throttler.checkByType(ctx, appName, remoteAddr, flags, checkType)
+	if checkResult.StatusCode == http.StatusOK && throttler.IsEnabled() {
+		if customCheckResult := throttler.checkCustomMetrics(ctx, appName, remoteAddr, flags); customCheckResult != nil {
+			return customCheckResult
+		}
+	}
+	return checkResult
+}
+
+func (throttler *Throttler) checkByType(ctx context.Context, appName string, remoteAddr string, flags *CheckFlags, checkType ThrottleCheckType) (checkResult *CheckResult) {
 	switch checkType {
 	case ThrottleCheckSelf:
 		return throttler.checkSelf(ctx, appName, remoteAddr, flags)
@@ -0,0 +1,408 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package wasm runs the WASM plugins the rules of the tablets call at the
+// hook points of the lifecycle of the queries, see
+// doc/design/20261014_WasmHookPoints.md.
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// ABIVersion is the version of the ABI between the host and the plugins. A
+// plugin declares the version it implements by exporting
+// wescale_abi_version_<version>. Within a version, only optional hooks and
+// fields are added.
+const ABIVersion = 1
+
+const (
+	// abiVersionExportPrefix starts the export declaring the ABI version.
+	abiVersionExportPrefix = "wescale_abi_version_"
+	// allocExport is the export the host allocates the memory of the inputs
+	// of the plugin with, as alloc(size i32) i32.
+	allocExport = "wescale_alloc"
+)
+
+// ABIVersionExport returns the export which declares an ABI version.
+func ABIVersionExport(version int) string {
+	return abiVersionExportPrefix + strconv.Itoa(version)
+}
+
+// Hook is a hook point of the lifecycle of a query. A plugin implements a hook
+// by exporting wescale_<hook>(ptr i32, len i32) i64, which gets the JSON
+// input of the call in its memory, and returns the pointer and the length of
+// its JSON response, packed as ptr<<32 | len. result_rows gets and returns
+// rows in binary instead, see EncodeRows.
+type Hook string
+
+const (
+	// HookOnConnect is called by vtgate when a connection is opened.
+	HookOnConnect Hook = "on_connect"
+	// HookOnParse is called by vtgate once a query is parsed.
+	HookOnParse Hook = "on_parse"
+	// HookBeforeRoute is called by vtgate before a query is routed.
+	HookBeforeRoute Hook = "before_route"
+	// HookBeforeExecution is called by the tablets before a query is
+	// executed, by the PLUGIN actions.
+	HookBeforeExecution Hook = "before_execution"
+	// HookAfterExecution is called by the tablets once a query succeeded.
+	HookAfterExecution Hook = "after_execution"
+	// HookOnError is called by the tablets once a query failed.
+	HookOnError Hook = "on_error"
+	// HookResultFields is called by the tablets with the fields of the
+	// result of a query, and returns the fields sent to the client.
+	HookResultFields Hook = "result_fields"
+	// HookResultRows is called by the tablets with each chunk of the rows of
+	// a result, once for Execute, and returns the rows sent to the client.
+	HookResultRows Hook = "result_rows"
+	// HookResultEnd is called by the tablets after the last chunk, and
+	// returns the rows to append.
+	HookResultEnd Hook = "result_end"
+)
+
+// Hooks are the hook points, in the order of the lifecycle of a query.
+var Hooks = []Hook{HookOnConnect, HookOnParse, HookBeforeRoute, HookBeforeExecution, HookAfterExecution, HookOnError, HookResultFields, HookResultRows, HookResultEnd}
+
+// TabletHooks are the hook points the tablets call.
+var TabletHooks = []Hook{HookBeforeExecution, HookAfterExecution, HookOnError, HookResultFields, HookResultRows, HookResultEnd}
+
+// ResultHooks are the hooks which transform the results.
+var ResultHooks = []Hook{HookResultFields, HookResultRows, HookResultEnd}
+
+// Export returns the export of the plugins implementing the hook.
+func (hook Hook) Export() string {
+	return "wescale_" + string(hook)
+}
+
+// Decision is what a plugin decides to do with a query.
+type Decision string
+
+const (
+	// DecisionContinue lets the query carry on unchanged.
+	DecisionContinue Decision = "continue"
+	// DecisionReject fails the query with the error of the response.
+	DecisionReject Decision = "reject"
+	// DecisionReplace answers the query with the result of the response,
+	// or, on error, replaces its error with the one of the response.
+	DecisionReplace Decision = "replace"
+)
+
+// Plugin is a loaded plugin.
+type Plugin interface {
+	// Ref returns the name and the version of the plugin, as name@version.
+	Ref() string
+	// Implements returns whether the plugin exports a hook.
+	Implements(hook Hook) bool
+	// Call calls a hook of the plugin for a query.
+	Call(ctx context.Context, call *Call) (*Response, error)
+}
+
+// Call is the input of a hook: the query it is called for.
+type Call struct {
+	Hook Hook
+	// Rule is the rule which called the plugin.
+	Rule          string
+	Query         string
+	BindVars      map[string]*querypb.BindVariable
+	User          string
+	IP            string
+	WorkloadClass string
+	Plan          string
+	Tables        []string
+	// Keyspace, Shard and TabletType are the target of the query. The tablet
+	// type is lower case, like primary.
+	Keyspace   string
+	Shard      string
+	TabletType string
+	// Result is the result of the query, for after_execution, and its rows
+	// affected and insert ID for result_end.
+	Result *sqltypes.Result
+	// Err is the error of the query, for on_error and result_end.
+	Err error
+	// Fields are the fields of the result, for result_fields.
+	Fields []*querypb.Field
+	// Rows are the rows of a chunk, for result_rows.
+	Rows []sqltypes.Row
+	// Stream, if set, runs the calls in the same instance of the plugin.
+	Stream *Stream
+	// Limits lower the limits of the runtime for the call.
+	Limits Limits
+	// Trace, if set, gets the calls of the host functions the plugin makes.
+	Trace func(HostCall)
+}
+
+// Input returns the input of a call: JSON, or the rows for result_rows.
+func (call *Call) Input() ([]byte, error) {
+	if call.Hook == HookResultRows {
+		return EncodeRows(call.Rows), nil
+	}
+	input := struct {
+		ABIVersion    int                `json:"abi_version"`
+		Hook          Hook               `json:"hook"`
+		Rule          string             `json:"rule,omitempty"`
+		Query         string             `json:"query"`
+		BindVars      map[string]BindVar `json:"bind_vars,omitempty"`
+		User          string             `json:"user"`
+		IP            string             `json:"ip"`
+		WorkloadClass string             `json:"workload_class"`
+		Plan          string             `json:"plan,omitempty"`
+		Tables        []string           `json:"tables,omitempty"`
+		Fields        []Field            `json:"fields,omitempty"`
+		Result        *Result            `json:"result,omitempty"`
+		Error         *Error             `json:"error,omitempty"`
+	}{
+		ABIVersion:    ABIVersion,
+		Hook:          call.Hook,
+		Rule:          call.Rule,
+		Query:         call.Query,
+		BindVars:      NewBindVars(call.BindVars),
+		User:          call.User,
+		IP:            call.IP,
+		WorkloadClass: call.WorkloadClass,
+		Plan:          call.Plan,
+		Tables:        call.Tables,
+	}
+	if call.Fields != nil {
+		input.Fields = NewFields(call.Fields)
+	}
+	if call.Result != nil {
+		// The rows are left out: a plugin reading them implements the hooks
+		// of the results.
+		input.Result = &Result{Fields: NewFields(call.Result.Fields), RowsAffected: call.Result.RowsAffected, InsertID: call.Result.InsertID}
+	}
+	if call.Err != nil {
+		input.Error = NewError(call.Err)
+	}
+	return json.Marshal(&input)
+}
+
+// BindVar is a bind variable, as the plugins see it, like
+// {"type": "INT64", "value": "1"}.
+type BindVar struct {
+	Type   string    `json:"type"`
+	Value  string    `json:"value,omitempty"`
+	Values []BindVar `json:"values,omitempty"`
+}
+
+// NewBindVars returns the bind variables of a query, as the plugins see them.
+func NewBindVars(bindVars map[string]*querypb.BindVariable) map[string]BindVar {
+	if len(bindVars) == 0 {
+		return nil
+	}
+	bvs := make(map[string]BindVar, len(bindVars))
+	for name, bv := range bindVars {
+		bvs[name] = NewBindVar(bv)
+	}
+	return bvs
+}
+
+// NewBindVar returns a bind variable, as the plugins see it.
+func NewBindVar(bv *querypb.BindVariable) BindVar {
+	b := BindVar{Type: bv.Type.String(), Value: string(bv.Value)}
+	for _, v := range bv.Values {
+		b.Values = append(b.Values, BindVar{Type: v.Type.String(), Value: string(v.Value)})
+	}
+	return b
+}
+
+// BindVariable returns the bind variable a plugin set.
+func (bv *BindVar) BindVariable() (*querypb.BindVariable, error) {
+	typ, ok := querypb.Type_value[bv.Type]
+	if !ok {
+		return nil, fmt.Errorf("invalid type %q", bv.Type)
+	}
+	b := &querypb.BindVariable{Type: querypb.Type(typ), Value: []byte(bv.Value)}
+	for _, v := range bv.Values {
+		typ, ok := querypb.Type_value[v.Type]
+		if !ok {
+			return nil, fmt.Errorf("invalid type %q", v.Type)
+		}
+		b.Values = append(b.Values, &querypb.Value{Type: querypb.Type(typ), Value: []byte(v.Value)})
+	}
+	return b, nil
+}
+
+// Response is the JSON response of a plugin to a call, like
+//
+//	{"action": "reject", "error": {"code": "PERMISSION_DENIED", "message": "no tenant"}}
+type Response struct {
+	Decision Decision `json:"action"`
+	Error    *Error   `json:"error,omitempty"`
+	Result   *Result  `json:"result,omitempty"`
+	// Rows are the rows result_rows returned with replace, see DecodeRows.
+	Rows []sqltypes.Row `json:"-"`
+}
+
+// ParseResponse parses the response of a plugin to a call of a hook. A
+// decision the host doesn't know is taken as continue, so that the plugins
+// of the later versions of the ABI degrade.
+func ParseResponse(hook Hook, data []byte) (*Response, error) {
+	if hook == HookResultRows {
+		rows, keep, err := DecodeRows(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response: %v", err)
+		}
+		if keep {
+			return &Response{Decision: DecisionContinue}, nil
+		}
+		return &Response{Decision: DecisionReplace, Rows: rows}, nil
+	}
+	resp := &Response{}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	switch resp.Decision {
+	case DecisionContinue:
+	case DecisionReject:
+		if resp.Error == nil {
+			return nil, fmt.Errorf("invalid response: reject without an error")
+		}
+	case DecisionReplace:
+		switch {
+		case hook == HookOnError && resp.Error == nil:
+			return nil, fmt.Errorf("invalid response: replace without an error")
+		case hook != HookOnError && resp.Result == nil:
+			return nil, fmt.Errorf("invalid response: replace without a result")
+		}
+	default:
+		resp.Decision = DecisionContinue
+	}
+	return resp, nil
+}
+
+// Error is an error, as the plugins see it and return it. Code is the name of
+// a vtrpc code, INVALID_ARGUMENT by default, and Errno and SQLState the
+// MySQL error number and SQLSTATE the clients get, if Errno is set.
+type Error struct {
+	Code     string `json:"code,omitempty"`
+	Errno    int    `json:"errno,omitempty"`
+	SQLState string `json:"sqlstate,omitempty"`
+	Message  string `json:"message"`
+}
+
+// NewError returns an error, as the plugins see it.
+func NewError(err error) *Error {
+	e := &Error{Code: vterrors.Code(err).String(), Message: err.Error()}
+	if sqlErr, ok := mysql.NewSQLErrorFromError(err).(*mysql.SQLError); ok && sqlErr.Num != mysql.ERUnknownError {
+		e.Errno, e.SQLState = sqlErr.Num, sqlErr.State
+	}
+	return e
+}
+
+// Err returns the error a plugin returned, telling the plugin.
+func (e *Error) Err(plugin string) error {
+	code := vtrpcpb.Code_INVALID_ARGUMENT
+	if e.Code != "" {
+		if c, ok := vtrpcpb.Code_value[e.Code]; ok {
+			code = vtrpcpb.Code(c)
+		}
+	}
+	if e.Errno == 0 {
+		return vterrors.Errorf(code, "%s (plugin %s)", e.Message, plugin)
+	}
+	sqlState := e.SQLState
+	if sqlState == "" {
+		sqlState = mysql.SSUnknownSQLState
+	}
+	return vterrors.Errorf(code, "%s (plugin %s) (errno %d) (sqlstate %s)", e.Message, plugin, e.Errno, sqlState)
+}
+
+// Field is a field of a result, as the plugins see it and return it. Column
+// is the name of the column of the table it is read from.
+type Field struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Table   string `json:"table,omitempty"`
+	Column  string `json:"column,omitempty"`
+	Charset uint32 `json:"charset,omitempty"`
+	Flags   uint32 `json:"flags,omitempty"`
+}
+
+// NewFields returns the fields of a result, as the plugins see them.
+func NewFields(fields []*querypb.Field) []Field {
+	fs := make([]Field, 0, len(fields))
+	for _, field := range fields {
+		fs = append(fs, Field{
+			Name:    field.Name,
+			Type:    field.Type.String(),
+			Table:   field.Table,
+			Column:  field.OrgName,
+			Charset: field.Charset,
+			Flags:   field.Flags,
+		})
+	}
+	return fs
+}
+
+// QueryFields returns the fields a plugin returned.
+func QueryFields(fs []Field) ([]*querypb.Field, error) {
+	fields := make([]*querypb.Field, 0, len(fs))
+	for _, f := range fs {
+		typ, ok := querypb.Type_value[f.Type]
+		if !ok {
+			return nil, fmt.Errorf("invalid type %q of field %s", f.Type, f.Name)
+		}
+		fields = append(fields, &querypb.Field{
+			Name:    f.Name,
+			Type:    querypb.Type(typ),
+			Table:   f.Table,
+			OrgName: f.Column,
+			Charset: f.Charset,
+			Flags:   f.Flags,
+		})
+	}
+	return fields, nil
+}
+
+// Result is a result, as the plugins see it and return it. The values of the
+// rows are strings, nil for NULL.
+type Result struct {
+	Fields       []Field     `json:"fields"`
+	Rows         [][]*string `json:"rows,omitempty"`
+	RowsAffected uint64      `json:"rows_affected,omitempty"`
+	InsertID     uint64      `json:"insert_id,omitempty"`
+}
+
+// SQLResult returns the result a plugin returned.
+func (r *Result) SQLResult() (*sqltypes.Result, error) {
+	fields, err := QueryFields(r.Fields)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.SQLRows(fields)
+	if err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{Fields: fields, Rows: rows, RowsAffected: r.RowsAffected, InsertID: r.InsertID}, nil
+}
+
+// SQLRows returns the rows a plugin returned, typed like fields.
+func (r *Result) SQLRows(fields []*querypb.Field) ([]sqltypes.Row, error) {
+	var rows []sqltypes.Row
+	for i, row := range r.Rows {
+		if len(row) != len(fields) {
+			return nil, fmt.Errorf("row %d has %d values for %d fields", i, len(row), len(fields))
+		}
+		values := make([]sqltypes.Value, len(row))
+		for j, v := range row {
+			if v != nil {
+				values[j] = sqltypes.MakeTrusted(fields[j].Type, []byte(*v))
+			}
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
@@ -0,0 +1,165 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func TestHooks(t *testing.T) {
+	assert.Equal(t, "wescale_abi_version_1", ABIVersionExport(ABIVersion))
+	assert.Equal(t, "wescale_before_execution", HookBeforeExecution.Export())
+	for _, hook := range TabletHooks {
+		assert.Contains(t, Hooks, hook)
+	}
+}
+
+func TestCallInput(t *testing.T) {
+	call := &Call{
+		Hook:     HookAfterExecution,
+		Rule:     "tenant_rule",
+		Query:    "select * from t where id in ::ids",
+		BindVars: map[string]*querypb.BindVariable{"ids": sqltypes.TestBindVariable([]any{1, "a"})},
+		User:     "app",
+		IP:       "10.0.0.1",
+		Plan:     "Select",
+		Tables:   []string{"t"},
+		Result:   sqltypes.MakeTestResult(sqltypes.MakeTestFields("id", "int64"), "1", "2"),
+	}
+	input, err := call.Input()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"abi_version": 1,
+		"hook": "after_execution",
+		"rule": "tenant_rule",
+		"query": "select * from t where id in ::ids",
+		"bind_vars": {"ids": {"type": "TUPLE", "values": [{"type": "INT64", "value": "1"}, {"type": "VARCHAR", "value": "a"}]}},
+		"user": "app",
+		"ip": "10.0.0.1",
+		"workload_class": "",
+		"plan": "Select",
+		"tables": ["t"],
+		"result": {"fields": [{"name": "id", "type": "INT64"}]}
+	}`, string(input))
+
+	call = &Call{Hook: HookOnError, Query: "select 1", Err: vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "table t not found (errno 1146) (sqlstate 42S02)")}
+	input, err = call.Input()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"abi_version": 1,
+		"hook": "on_error",
+		"query": "select 1",
+		"user": "",
+		"ip": "",
+		"workload_class": "",
+		"error": {"code": "NOT_FOUND", "errno": 1146, "sqlstate": "42S02", "message": "table t not found (errno 1146) (sqlstate 42S02)"}
+	}`, string(input))
+}
+
+func TestBindVar(t *testing.T) {
+	bvs := NewBindVars(map[string]*querypb.BindVariable{"id": sqltypes.Int64BindVariable(1)})
+	bv := bvs["id"]
+	b, err := bv.BindVariable()
+	require.NoError(t, err)
+	assert.Equal(t, sqltypes.Int64BindVariable(1), b)
+
+	_, err = (&BindVar{Type: "INT65"}).BindVariable()
+	assert.EqualError(t, err, `invalid type "INT65"`)
+}
+
+func TestParseResponse(t *testing.T) {
+	for _, tcase := range []struct {
+		hook Hook
+		data string
+		want *Response
+		err  string
+	}{{
+		hook: HookBeforeExecution,
+		data: `{"action": "continue"}`,
+		want: &Response{Decision: DecisionContinue},
+	}, {
+		// The decisions of a later ABI are taken as continue.
+		hook: HookBeforeExecution,
+		data: `{"action": "defer"}`,
+		want: &Response{Decision: DecisionContinue},
+	}, {
+		hook: HookBeforeExecution,
+		data: `{"action": "reject", "error": {"message": "denied"}}`,
+		want: &Response{Decision: DecisionReject, Error: &Error{Message: "denied"}},
+	}, {
+		hook: HookBeforeExecution,
+		data: `{"action": "reject"}`,
+		err:  "invalid response: reject without an error",
+	}, {
+		hook: HookBeforeExecution,
+		data: `{"action": "replace", "error": {"message": "denied"}}`,
+		err:  "invalid response: replace without a result",
+	}, {
+		hook: HookOnError,
+		data: `{"action": "replace", "result": {"fields": []}}`,
+		err:  "invalid response: replace without an error",
+	}, {
+		hook: HookBeforeExecution,
+		data: `{"action": `,
+		err:  "invalid response: unexpected end of JSON input",
+	}} {
+		resp, err := ParseResponse(tcase.hook, []byte(tcase.data))
+		if tcase.err != "" {
+			assert.EqualError(t, err, tcase.err, tcase.data)
+			continue
+		}
+		require.NoError(t, err, tcase.data)
+		assert.Equal(t, tcase.want, resp, tcase.data)
+	}
+}
+
+func TestErrorErr(t *testing.T) {
+	err := (&Error{Message: "no tenant"}).Err("tenant@1")
+	assert.EqualError(t, err, "no tenant (plugin tenant@1)")
+	assert.Equal(t, vtrpcpb.Code_INVALID_ARGUMENT, vterrors.Code(err))
+
+	err = (&Error{Code: "PERMISSION_DENIED", Errno: 1142, SQLState: "42000", Message: "denied"}).Err("tenant@1")
+	assert.Equal(t, vtrpcpb.Code_PERMISSION_DENIED, vterrors.Code(err))
+	var sqlErr *mysql.SQLError
+	require.True(t, errors.As(mysql.NewSQLErrorFromError(err), &sqlErr))
+	assert.Equal(t, 1142, sqlErr.Num)
+	assert.Equal(t, "42000", sqlErr.State)
+
+	err = (&Error{Code: "NOPE", Errno: 1105, Message: "denied"}).Err("tenant@1")
+	assert.EqualError(t, err, "denied (plugin tenant@1) (errno 1105) (sqlstate HY000)")
+	assert.Equal(t, vtrpcpb.Code_INVALID_ARGUMENT, vterrors.Code(err))
+}
+
+func TestResultSQLResult(t *testing.T) {
+	one := "1"
+	result, err := (&Result{
+		Fields:       []Field{{Name: "id", Type: "INT64"}, {Name: "name", Type: "VARCHAR"}},
+		Rows:         [][]*string{{&one, nil}},
+		RowsAffected: 1,
+	}).SQLResult()
+	require.NoError(t, err)
+	want := sqltypes.MakeTestResult(sqltypes.MakeTestFields("id|name", "int64|varchar"), "1|null")
+	want.RowsAffected = 1
+	assert.Equal(t, want.Fields, result.Fields)
+	assert.Equal(t, want.Rows, result.Rows)
+	assert.EqualValues(t, 1, result.RowsAffected)
+
+	_, err = (&Result{Fields: []Field{{Name: "id", Type: "INT65"}}}).SQLResult()
+	assert.EqualError(t, err, `invalid type "INT65" of field id`)
+	_, err = (&Result{Fields: []Field{{Name: "id", Type: "INT64"}}, Rows: [][]*string{{&one, &one}}}).SQLResult()
+	assert.EqualError(t, err, "row 0 has 2 values for 1 fields")
+}
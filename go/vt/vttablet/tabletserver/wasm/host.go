@@ -0,0 +1,406 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// HostModule is the module of the host functions of the ABI, which the
+// plugins import functions from. A string or a JSON value is passed as
+// (ptr i32, len i32); a function returning a value writes it in memory
+// allocated with wescale_alloc, and returns it packed as ptr<<32 | len. The
+// functions return the errors below, as i32 or i64.
+const HostModule = "wescale_v1"
+
+// The errors of the host functions.
+const (
+	// ErrNotFound is returned for a bind variable the query doesn't have.
+	ErrNotFound = -1
+	// ErrNotAllowed is returned by a function called from a hook it isn't
+	// allowed in.
+	ErrNotAllowed = -2
+	// ErrInvalid is returned for invalid arguments, and for the metrics a
+	// plugin can't create.
+	ErrInvalid = -3
+)
+
+var (
+	// queryHooks are the hooks called for a query, all but on_connect.
+	queryHooks = []Hook{HookOnParse, HookBeforeRoute, HookBeforeExecution, HookAfterExecution, HookOnError, HookResultFields, HookResultRows, HookResultEnd}
+	// rewriteHooks are the hooks which can change the query.
+	rewriteHooks = []Hook{HookOnParse, HookBeforeExecution}
+	// routeHooks are the hooks which can change the tablet type of the query.
+	routeHooks = []Hook{HookBeforeRoute}
+)
+
+// The log levels of the plugins.
+const (
+	logInfo = iota
+	logWarning
+	logError
+)
+
+type hostCallKey struct{}
+
+// hostCall is the call of a hook the host functions serve.
+type hostCall struct {
+	module *Module
+	call   *Call
+}
+
+// withHostCall returns the context of a call of a hook, for the host
+// functions.
+func withHostCall(ctx context.Context, m *Module, call *Call) context.Context {
+	return context.WithValue(ctx, hostCallKey{}, &hostCall{module: m, call: call})
+}
+
+// hostCallFrom returns the call of a hook a host function is called in, or
+// nil if the function isn't allowed in the hook; nil hooks allow all hooks.
+func hostCallFrom(ctx context.Context, hooks []Hook) *hostCall {
+	hc, _ := ctx.Value(hostCallKey{}).(*hostCall)
+	if hc == nil || (hooks != nil && !slices.Contains(hooks, hc.call.Hook)) {
+		return nil
+	}
+	return hc
+}
+
+// HostCall is a call of a host function by a plugin, which Call.Trace gets.
+type HostCall struct {
+	Func string `json:"func"`
+	// Args are the arguments of the call, the strings read from the memory
+	// of the plugin.
+	Args []any `json:"args,omitempty"`
+	// Result is the string the function returned, or its error, 0 for the
+	// functions returning no value.
+	Result any `json:"result"`
+}
+
+// String returns the call, like set_query("select 2") = 0.
+func (c HostCall) String() string {
+	format := func(v any) string {
+		if s, ok := v.(string); ok {
+			return strconv.Quote(s)
+		}
+		return fmt.Sprint(v)
+	}
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = format(arg)
+	}
+	return fmt.Sprintf("%s(%s) = %s", c.Func, strings.Join(args, ", "), format(c.Result))
+}
+
+// str is a string argument of a host function, in the memory of the plugin.
+type str struct {
+	ptr, length uint32
+}
+
+// traceFrom returns the call of a hook a host function is called in, if it
+// traces the host functions.
+func traceFrom(ctx context.Context) *hostCall {
+	hc, _ := ctx.Value(hostCallKey{}).(*hostCall)
+	if hc == nil || hc.call.Trace == nil {
+		return nil
+	}
+	return hc
+}
+
+// trace gives a call of a host function to the trace of the call of the
+// hook, reading its string arguments and its packed result from the memory
+// of the plugin. It is deferred by the host functions, once ret is set.
+func trace[T int32 | int64](hc *hostCall, mod api.Module, fn string, ret *T, args ...any) {
+	for i, arg := range args {
+		if s, ok := arg.(str); ok {
+			args[i] = nil
+			if v, ok := read(mod, s.ptr, s.length); ok {
+				args[i] = v
+			}
+		}
+	}
+	result := any(int64(*ret))
+	if packed, ok := any(*ret).(int64); ok && packed >= 0 {
+		result, _ = read(mod, uint32(packed>>32), uint32(packed))
+	}
+	hc.call.Trace(HostCall{Func: fn, Args: args, Result: result})
+}
+
+// instantiateHost instantiates the host module in a wazero runtime.
+func (rt *Runtime) instantiateHost(ctx context.Context, r wazero.Runtime) error {
+	b := r.NewHostModuleBuilder(HostModule)
+	b.NewFunctionBuilder().WithFunc(getQuery).Export("get_query")
+	b.NewFunctionBuilder().WithFunc(setQuery).Export("set_query")
+	b.NewFunctionBuilder().WithFunc(getBindVar).Export("get_bind_var")
+	b.NewFunctionBuilder().WithFunc(setBindVar).Export("set_bind_var")
+	b.NewFunctionBuilder().WithFunc(listBindVars).Export("list_bind_vars")
+	b.NewFunctionBuilder().WithFunc(getUser).Export("get_user")
+	b.NewFunctionBuilder().WithFunc(getTarget).Export("get_target")
+	b.NewFunctionBuilder().WithFunc(setTabletType).Export("set_tablet_type")
+	b.NewFunctionBuilder().WithFunc(logMessage).Export("log")
+	b.NewFunctionBuilder().WithFunc(rt.counterAdd).Export("counter_add")
+	b.NewFunctionBuilder().WithFunc(rt.gaugeSet).Export("gauge_set")
+	b.NewFunctionBuilder().WithFunc(rt.histogramObserve).Export("histogram_observe")
+	_, err := b.Instantiate(ctx)
+	return err
+}
+
+// read reads a string from the memory of a plugin.
+func read(mod api.Module, ptr, length uint32) (string, bool) {
+	b, ok := mod.Memory().Read(ptr, length)
+	return string(b), ok
+}
+
+// result writes the result of a function in memory allocated by the plugin,
+// and returns it packed. A plugin whose allocation fails traps.
+func result(ctx context.Context, mod api.Module, data []byte) int64 {
+	results, err := mod.ExportedFunction(allocExport).Call(ctx, uint64(len(data)))
+	if err != nil {
+		panic(err)
+	}
+	ptr := uint32(results[0])
+	if !mod.Memory().Write(ptr, data) {
+		panic(fmt.Errorf("%s returned %d, out of its memory", allocExport, ptr))
+	}
+	return int64(ptr)<<32 | int64(len(data))
+}
+
+// jsonResult writes a JSON result, see result.
+func jsonResult(ctx context.Context, mod api.Module, v any) int64 {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return result(ctx, mod, data)
+}
+
+// getQuery returns the SQL of the query.
+func getQuery(ctx context.Context, mod api.Module) (ret int64) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "get_query", &ret)
+	}
+	hc := hostCallFrom(ctx, queryHooks)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	return result(ctx, mod, []byte(hc.call.Query))
+}
+
+// setQuery replaces the SQL of the query.
+func setQuery(ctx context.Context, mod api.Module, ptr, length uint32) (ret int32) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "set_query", &ret, str{ptr, length})
+	}
+	hc := hostCallFrom(ctx, rewriteHooks)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	query, ok := read(mod, ptr, length)
+	if !ok || query == "" {
+		return ErrInvalid
+	}
+	hc.call.Query = query
+	return 0
+}
+
+// getBindVar returns a bind variable, as a JSON BindVar.
+func getBindVar(ctx context.Context, mod api.Module, namePtr, nameLen uint32) (ret int64) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "get_bind_var", &ret, str{namePtr, nameLen})
+	}
+	hc := hostCallFrom(ctx, queryHooks)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	name, ok := read(mod, namePtr, nameLen)
+	if !ok {
+		return ErrInvalid
+	}
+	bv, ok := hc.call.BindVars[name]
+	if !ok {
+		return ErrNotFound
+	}
+	return jsonResult(ctx, mod, NewBindVar(bv))
+}
+
+// setBindVar sets or adds a bind variable, given as a JSON BindVar.
+func setBindVar(ctx context.Context, mod api.Module, namePtr, nameLen, ptr, length uint32) (ret int32) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "set_bind_var", &ret, str{namePtr, nameLen}, str{ptr, length})
+	}
+	hc := hostCallFrom(ctx, rewriteHooks)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	name, ok := read(mod, namePtr, nameLen)
+	if !ok || name == "" {
+		return ErrInvalid
+	}
+	value, ok := mod.Memory().Read(ptr, length)
+	if !ok {
+		return ErrInvalid
+	}
+	var b BindVar
+	if err := json.Unmarshal(value, &b); err != nil {
+		return ErrInvalid
+	}
+	bv, err := b.BindVariable()
+	if err != nil {
+		return ErrInvalid
+	}
+	if hc.call.BindVars == nil {
+		hc.call.BindVars = map[string]*querypb.BindVariable{}
+	}
+	hc.call.BindVars[name] = bv
+	return 0
+}
+
+// listBindVars returns the sorted names of the bind variables, as a JSON
+// array.
+func listBindVars(ctx context.Context, mod api.Module) (ret int64) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "list_bind_vars", &ret)
+	}
+	hc := hostCallFrom(ctx, queryHooks)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	names := make([]string, 0, len(hc.call.BindVars))
+	for name := range hc.call.BindVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return jsonResult(ctx, mod, names)
+}
+
+// getUser returns the user, as {"user": "", "ip": "", "workload_class": ""}.
+func getUser(ctx context.Context, mod api.Module) (ret int64) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "get_user", &ret)
+	}
+	hc := hostCallFrom(ctx, nil)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	return jsonResult(ctx, mod, map[string]string{"user": hc.call.User, "ip": hc.call.IP, "workload_class": hc.call.WorkloadClass})
+}
+
+// getTarget returns the target of the query, as
+// {"keyspace": "", "shard": "", "tablet_type": ""}.
+func getTarget(ctx context.Context, mod api.Module) (ret int64) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "get_target", &ret)
+	}
+	hc := hostCallFrom(ctx, queryHooks)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	return jsonResult(ctx, mod, map[string]string{"keyspace": hc.call.Keyspace, "shard": hc.call.Shard, "tablet_type": hc.call.TabletType})
+}
+
+// setTabletType forces the tablet type of the query, primary or replica.
+func setTabletType(ctx context.Context, mod api.Module, ptr, length uint32) (ret int32) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "set_tablet_type", &ret, str{ptr, length})
+	}
+	hc := hostCallFrom(ctx, routeHooks)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	tabletType, ok := read(mod, ptr, length)
+	if !ok || (tabletType != "primary" && tabletType != "replica") {
+		return ErrInvalid
+	}
+	hc.call.TabletType = tabletType
+	return 0
+}
+
+// logMessage logs a message of the plugin at a level, rate limited per
+// plugin.
+func logMessage(ctx context.Context, mod api.Module, level, ptr, length uint32) (ret int32) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "log", &ret, level, str{ptr, length})
+	}
+	hc := hostCallFrom(ctx, nil)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	msg, ok := read(mod, ptr, length)
+	if !ok {
+		return ErrInvalid
+	}
+	logger := hc.module.logger
+	switch level {
+	case logInfo:
+		logger.Infof("%s: %s", hc.call.Hook, msg)
+	case logWarning:
+		logger.Warningf("%s: %s", hc.call.Hook, msg)
+	case logError:
+		logger.Errorf("%s: %s", hc.call.Hook, msg)
+	default:
+		return ErrInvalid
+	}
+	return 0
+}
+
+// counterAdd adds a delta, >= 0, to a counter of the plugin.
+func (rt *Runtime) counterAdd(ctx context.Context, mod api.Module, namePtr, nameLen uint32, delta int64) (ret int32) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "counter_add", &ret, str{namePtr, nameLen}, delta)
+	}
+	hc := hostCallFrom(ctx, nil)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	name, ok := read(mod, namePtr, nameLen)
+	if !ok || name == "" || delta < 0 || !rt.metrics.counterAdd(hc.module.ref, name, delta) {
+		return ErrInvalid
+	}
+	return 0
+}
+
+// gaugeSet sets a gauge of the plugin.
+func (rt *Runtime) gaugeSet(ctx context.Context, mod api.Module, namePtr, nameLen uint32, value int64) (ret int32) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "gauge_set", &ret, str{namePtr, nameLen}, value)
+	}
+	hc := hostCallFrom(ctx, nil)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	name, ok := read(mod, namePtr, nameLen)
+	if !ok || name == "" || !rt.metrics.gaugeSet(hc.module.ref, name, value) {
+		return ErrInvalid
+	}
+	return 0
+}
+
+// histogramObserve adds an observation to a histogram of the plugin.
+func (rt *Runtime) histogramObserve(ctx context.Context, mod api.Module, namePtr, nameLen uint32, value float64) (ret int32) {
+	if tc := traceFrom(ctx); tc != nil {
+		defer trace(tc, mod, "histogram_observe", &ret, str{namePtr, nameLen}, value)
+	}
+	hc := hostCallFrom(ctx, nil)
+	if hc == nil {
+		return ErrNotAllowed
+	}
+	name, ok := read(mod, namePtr, nameLen)
+	if !ok || name == "" || math.IsNaN(value) || !rt.metrics.histogramObserve(hc.module.ref, name, value) {
+		return ErrInvalid
+	}
+	return 0
+}
@@ -0,0 +1,209 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm/wasmtest"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// hostPlugin is a plugin calling the host functions, which stores their
+// results in the slots of 8 bytes at the start of its memory.
+type hostPlugin struct {
+	*wasmtest.Module
+	funcs map[string]uint32
+}
+
+func newHostPlugin() *hostPlugin {
+	i32, i64, f64 := wasmtest.I32, wasmtest.I64, wasmtest.F64
+	p := &hostPlugin{Module: wasmtest.New(), funcs: map[string]uint32{}}
+	for _, fn := range []struct {
+		name            string
+		params, results []wasmtest.ValType
+	}{
+		{"get_query", nil, []wasmtest.ValType{i64}},
+		{"set_query", []wasmtest.ValType{i32, i32}, []wasmtest.ValType{i32}},
+		{"get_bind_var", []wasmtest.ValType{i32, i32}, []wasmtest.ValType{i64}},
+		{"set_bind_var", []wasmtest.ValType{i32, i32, i32, i32}, []wasmtest.ValType{i32}},
+		{"list_bind_vars", nil, []wasmtest.ValType{i64}},
+		{"get_user", nil, []wasmtest.ValType{i64}},
+		{"get_target", nil, []wasmtest.ValType{i64}},
+		{"set_tablet_type", []wasmtest.ValType{i32, i32}, []wasmtest.ValType{i32}},
+		{"log", []wasmtest.ValType{i32, i32, i32}, []wasmtest.ValType{i32}},
+		{"counter_add", []wasmtest.ValType{i32, i32, i64}, []wasmtest.ValType{i32}},
+		{"gauge_set", []wasmtest.ValType{i32, i32, i64}, []wasmtest.ValType{i32}},
+		{"histogram_observe", []wasmtest.ValType{i32, i32, f64}, []wasmtest.ValType{i32}},
+	} {
+		p.funcs[fn.name] = p.Import(HostModule, fn.name, fn.params, fn.results)
+	}
+	p.Plugin()
+	return p
+}
+
+// str pushes the pointer and the length of a string.
+func (p *hostPlugin) str(s string) []byte {
+	return append(wasmtest.I32Const(int32(p.Data([]byte(s)))), wasmtest.I32Const(int32(len(s)))...)
+}
+
+// continues pushes the response letting the query continue.
+func (p *hostPlugin) continues() []byte {
+	return wasmtest.Packed(p.Data([]byte(`{"action": "continue"}`)), 22)
+}
+
+// call calls a host function with args, and stores its result in a slot.
+func (p *hostPlugin) call(slot int32, name string, args ...[]byte) []byte {
+	var code []byte
+	for _, arg := range args {
+		code = append(code, arg...)
+	}
+	code = append(code, wasmtest.Call(p.funcs[name])...)
+	if name != "get_query" && name != "get_bind_var" && name != "list_bind_vars" && name != "get_user" && name != "get_target" {
+		code = append(code, wasmtest.I64ExtendS...)
+	}
+	for _, c := range [][]byte{wasmtest.LocalSet(4), wasmtest.I32Const(slot * 8), wasmtest.LocalGet(4), wasmtest.I64Store} {
+		code = append(code, c...)
+	}
+	return code
+}
+
+// results returns the results the plugin stored in its slots, the packed
+// ones as strings.
+func results(t *testing.T, m *Module, slots int) []any {
+	t.Helper()
+	inst := <-m.instances
+	defer m.put(inst)
+	memory := inst.module.Memory()
+	values := make([]any, slots)
+	for i := range values {
+		b, ok := memory.Read(uint32(i*8), 8)
+		require.True(t, ok)
+		v := int64(binary.LittleEndian.Uint64(b))
+		if v <= 0xFFFF {
+			values[i] = v
+			continue
+		}
+		b, ok = memory.Read(uint32(v>>32), uint32(v))
+		require.True(t, ok)
+		values[i] = string(b)
+	}
+	return values
+}
+
+func TestHostFunctions(t *testing.T) {
+	ctx := context.Background()
+	// The host functions get the call under a timeout too.
+	rt := NewRuntime(Config{Limits: Limits{Timeout: 10 * time.Second}, MaxMetrics: 2}, servenv.NewExporter("WasmHostTest", "Tablet"))
+	defer rt.Close(ctx)
+
+	p := newHostPlugin()
+	p.Hook(string(HookBeforeExecution),
+		p.call(0, "get_query"),
+		p.call(1, "set_query", p.str("select 2")),
+		p.call(2, "get_query"),
+		p.call(3, "get_bind_var", p.str("id")),
+		p.call(4, "set_bind_var", p.str("id"), p.str(`{"type": "INT64", "value": "7"}`)),
+		p.call(5, "get_bind_var", p.str("missing")),
+		p.call(6, "set_bind_var", p.str("id"), p.str(`{"type": "BIGINT"}`)),
+		p.call(7, "list_bind_vars"),
+		p.call(8, "get_user"),
+		p.call(9, "get_target"),
+		p.call(10, "set_tablet_type", p.str("primary")),
+		p.call(11, "log", wasmtest.I32Const(0), p.str("hello")),
+		p.call(12, "log", wasmtest.I32Const(7), p.str("hello")),
+		p.call(13, "counter_add", p.str("calls"), wasmtest.I64Const(2)),
+		p.call(14, "counter_add", p.str("calls"), wasmtest.I64Const(-1)),
+		p.call(15, "gauge_set", p.str("inflight"), wasmtest.I64Const(5)),
+		// The plugin can create 2 names only.
+		p.call(16, "histogram_observe", p.str("latency"), wasmtest.F64Const(0.5)),
+		p.continues())
+	p.Hook(string(HookBeforeRoute),
+		p.call(0, "set_tablet_type", p.str("primary")),
+		p.call(1, "set_tablet_type", p.str("rdonly")),
+		p.call(2, "set_query", p.str("select 2")),
+		p.continues())
+	m, err := rt.Compile(ctx, "tenant@1", p.Build())
+	require.NoError(t, err)
+
+	call := &Call{
+		Hook:          HookBeforeExecution,
+		Query:         "select 1",
+		BindVars:      map[string]*querypb.BindVariable{"id": sqltypes.Int64BindVariable(1)},
+		User:          "alice",
+		IP:            "10.0.0.1",
+		WorkloadClass: "oltp",
+		Keyspace:      "commerce",
+		Shard:         "0",
+		TabletType:    "replica",
+	}
+	var trace []string
+	call.Trace = func(c HostCall) { trace = append(trace, c.String()) }
+	_, err = m.Call(ctx, call)
+	require.NoError(t, err)
+	assert.Equal(t, []any{
+		"select 1", int64(0), "select 2",
+		`{"type":"INT64","value":"1"}`, int64(0), int64(ErrNotFound), int64(ErrInvalid),
+		`["id"]`,
+		`{"ip":"10.0.0.1","user":"alice","workload_class":"oltp"}`,
+		`{"keyspace":"commerce","shard":"0","tablet_type":"replica"}`,
+		int64(ErrNotAllowed),
+		int64(0), int64(ErrInvalid),
+		int64(0), int64(ErrInvalid), int64(0), int64(ErrInvalid),
+	}, results(t, m, 17))
+	// The changes are made to the call.
+	assert.Equal(t, "select 2", call.Query)
+	assert.Equal(t, sqltypes.Int64BindVariable(7), call.BindVars["id"])
+	assert.EqualValues(t, 2, rt.metrics.counters.Counts()["tenant@1.calls"])
+	assert.EqualValues(t, 5, rt.metrics.gauges.Counts()["tenant@1.inflight"])
+	assert.EqualValues(t, 1, rt.metrics.dropped.Counts()["tenant@1"])
+	assert.Empty(t, rt.metrics.histogramCounts())
+	// The trace gets the calls with their arguments and their results.
+	require.Len(t, trace, 17)
+	assert.Equal(t, []string{
+		`get_query() = "select 1"`,
+		`set_query("select 2") = 0`,
+		`get_query() = "select 2"`,
+		`get_bind_var("id") = "{\"type\":\"INT64\",\"value\":\"1\"}"`,
+		`set_bind_var("id", "{\"type\": \"INT64\", \"value\": \"7\"}") = 0`,
+		`get_bind_var("missing") = -1`,
+	}, trace[:6])
+	assert.Equal(t, `log(7, "hello") = -3`, trace[12])
+	assert.Equal(t, `counter_add("calls", -1) = -3`, trace[14])
+	assert.Equal(t, `histogram_observe("latency", 0.5) = -3`, trace[16])
+
+	trace = nil
+	call = &Call{Hook: HookBeforeRoute, Query: "select 1", TabletType: "replica", Trace: call.Trace}
+	_, err = m.Call(ctx, call)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`set_tablet_type("primary") = 0`, `set_tablet_type("rdonly") = -3`, `set_query("select 2") = -2`}, trace)
+	assert.Equal(t, []any{int64(0), int64(ErrInvalid), int64(ErrNotAllowed)}, results(t, m, 3))
+	assert.Equal(t, "primary", call.TabletType)
+	assert.Equal(t, "select 1", call.Query)
+}
+
+func TestPluginHistograms(t *testing.T) {
+	m := newPluginMetrics(0, servenv.NewExporter("WasmHistogramTest", "Tablet"))
+	for _, v := range []float64{0.5, 1, 3, 1e9} {
+		assert.True(t, m.histogramObserve("tenant@1.2", "latency", v))
+	}
+	counts := m.histogramCounts()
+	assert.EqualValues(t, 0, counts["tenant@1_2.latency.1e-01"])
+	assert.EqualValues(t, 2, counts["tenant@1_2.latency.1e+00"])
+	assert.EqualValues(t, 3, counts["tenant@1_2.latency.1e+01"])
+	assert.EqualValues(t, 3, counts["tenant@1_2.latency.1e+06"])
+	assert.EqualValues(t, 4, counts["tenant@1_2.latency.+Inf"])
+	assert.Len(t, counts, len(histogramBuckets)+1)
+}
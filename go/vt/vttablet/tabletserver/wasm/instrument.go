@@ -0,0 +1,557 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The plugins are metered by instrumenting their code when they are compiled,
+// so that the limits hold whatever the engine running them:
+//
+//   - each function and each iteration of a loop calls an injected function
+//     which takes a unit of fuel from the wescale_fuel global, and traps
+//     when it is used up;
+//   - memory.grow is replaced by an injected function which fails, and sets
+//     the wescale_limit_hit global, past the wescale_memory_limit global.
+//
+// The host sets the globals before each call, and reads them after it.
+const (
+	fuelExport        = "wescale_fuel"
+	memoryLimitExport = "wescale_memory_limit"
+	limitHitExport    = "wescale_limit_hit"
+)
+
+// The ids of the sections of a module.
+const (
+	sectionCustom   = 0
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionMemory   = 5
+	sectionGlobal   = 6
+	sectionExport   = 7
+	sectionCode     = 10
+)
+
+// sectionOrder is the rank of the sections, which a module has in this order.
+var sectionOrder = map[byte]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 13: 6, 6: 7, 7: 8, 8: 9, 9: 10, 12: 11, 10: 12, 11: 13}
+
+// The value types.
+const (
+	valI32       = 0x7F
+	valI64       = 0x7E
+	valF32       = 0x7D
+	valF64       = 0x7C
+	valV128      = 0x7B
+	valFuncref   = 0x70
+	valExternref = 0x6F
+)
+
+type section struct {
+	id      byte
+	payload []byte
+}
+
+// instrument returns the binary of a module, metered. The fuel and the
+// memory pages it starts with bound its initialization.
+func instrument(bin []byte, fuel int64, memoryPages uint32) ([]byte, error) {
+	if len(bin) < 8 || string(bin[:4]) != "\x00asm" || binary.LittleEndian.Uint32(bin[4:8]) != 1 {
+		return nil, fmt.Errorf("not a WASM module of version 1")
+	}
+	sections, err := parseSections(bin[8:])
+	if err != nil {
+		return nil, err
+	}
+	var importedFuncs, importedGlobals, types, funcs, globals, memories uint32
+	for _, s := range sections {
+		r := &reader{data: s.payload}
+		switch s.id {
+		case sectionType:
+			types = r.u32()
+		case sectionImport:
+			importedFuncs, importedGlobals, memories = r.imports()
+		case sectionFunction:
+			funcs = r.u32()
+		case sectionMemory:
+			n := r.u32()
+			for i := uint32(0); i < n && r.err == nil; i++ {
+				r.memoryLimits()
+			}
+			memories += n
+		case sectionGlobal:
+			globals = r.u32()
+		case sectionExport:
+			n := r.u32()
+			for i := uint32(0); i < n && r.err == nil; i++ {
+				if name := r.name(); name == fuelExport || name == memoryLimitExport || name == limitHitExport {
+					r.fail("the export %s is reserved", name)
+				}
+				r.byte()
+				r.u32()
+			}
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+	if memories > 1 {
+		return nil, fmt.Errorf("multiple memories are not supported")
+	}
+	hasMemory := memories == 1
+
+	// The injected types, functions and globals come after the ones of the
+	// module, so that its indexes don't change.
+	chargeType, growType := types, types+1
+	charge, grow := importedFuncs+funcs, importedFuncs+funcs+1
+	fuelGlobal, memoryLimitGlobal, limitHitGlobal := importedGlobals+globals, importedGlobals+globals+1, importedGlobals+globals+2
+
+	out := append([]byte(nil), bin[:8]...)
+	seen := map[byte]bool{}
+	for _, s := range sections {
+		seen[s.id] = true
+	}
+	for _, id := range []byte{sectionType, sectionFunction, sectionGlobal, sectionExport, sectionCode} {
+		if !seen[id] {
+			sections = insertSection(sections, section{id: id, payload: []byte{0x00}})
+		}
+	}
+	for _, s := range sections {
+		payload := s.payload
+		switch s.id {
+		case sectionCustom:
+			if name := (&reader{data: s.payload}).name(); strings.HasPrefix(name, ".debug_") {
+				// The offsets of the debug info don't hold anymore.
+				continue
+			}
+		case sectionType:
+			payload = appendItems(payload,
+				[]byte{0x60, 0x00, 0x00},
+				[]byte{0x60, 0x01, valI32, 0x01, valI32})
+		case sectionFunction:
+			items := [][]byte{binary.AppendUvarint(nil, uint64(chargeType))}
+			if hasMemory {
+				items = append(items, binary.AppendUvarint(nil, uint64(growType)))
+			}
+			payload = appendItems(payload, items...)
+		case sectionGlobal:
+			payload = appendItems(payload,
+				append(appendSleb(append([]byte{valI64, 0x01}, 0x42), fuel), 0x0B),
+				append(appendSleb(append([]byte{valI32, 0x01}, 0x41), int64(memoryPages)), 0x0B),
+				[]byte{valI32, 0x01, 0x41, 0x00, 0x0B})
+		case sectionExport:
+			payload = appendItems(payload,
+				exportItem(fuelExport, fuelGlobal),
+				exportItem(memoryLimitExport, memoryLimitGlobal),
+				exportItem(limitHitExport, limitHitGlobal))
+		case sectionCode:
+			if payload, err = instrumentCode(payload, funcs, charge, grow); err != nil {
+				return nil, err
+			}
+			items := [][]byte{appendBytes(nil, chargeBody(fuelGlobal))}
+			if hasMemory {
+				items = append(items, appendBytes(nil, growBody(memoryLimitGlobal, limitHitGlobal)))
+			}
+			payload = appendItems(payload, items...)
+		}
+		out = append(out, s.id)
+		out = appendBytes(out, payload)
+	}
+	return out, nil
+}
+
+// parseSections returns the sections of a module, after its header.
+func parseSections(data []byte) ([]section, error) {
+	var sections []section
+	r := &reader{data: data}
+	for r.err == nil && !r.done() {
+		id := r.byte()
+		payload := r.bytes(r.u32())
+		if _, ok := sectionOrder[id]; !ok && id != sectionCustom && r.err == nil {
+			r.fail("unknown section %d", id)
+		}
+		sections = append(sections, section{id: id, payload: payload})
+	}
+	return sections, r.err
+}
+
+// insertSection inserts a section where it goes in the order of the sections.
+func insertSection(sections []section, s section) []section {
+	i := len(sections)
+	for j, t := range sections {
+		if t.id != sectionCustom && sectionOrder[t.id] > sectionOrder[s.id] {
+			i = j
+			break
+		}
+	}
+	return append(sections[:i], append([]section{s}, sections[i:]...)...)
+}
+
+// appendItems appends items to the payload of a section, a vector.
+func appendItems(payload []byte, items ...[]byte) []byte {
+	r := &reader{data: payload}
+	n := r.u32()
+	out := binary.AppendUvarint(nil, uint64(n)+uint64(len(items)))
+	out = append(out, payload[r.pos:]...)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func exportItem(name string, global uint32) []byte {
+	b := appendBytes(nil, []byte(name))
+	b = append(b, 0x03)
+	return binary.AppendUvarint(b, uint64(global))
+}
+
+// chargeBody returns the body of the injected function which takes a unit of
+// fuel, and traps once it is used up.
+func chargeBody(fuel uint32) []byte {
+	b := []byte{0x00}                              // no locals
+	b = appendGlobal(b, 0x23, fuel)                // global.get fuel
+	b = append(b, 0x42, 0x01, 0x7D)                // i64.const 1, i64.sub
+	b = appendGlobal(b, 0x24, fuel)                // global.set fuel
+	b = appendGlobal(b, 0x23, fuel)                // global.get fuel
+	b = append(b, 0x42, 0x00, 0x53)                // i64.const 0, i64.lt_s
+	return append(b, 0x04, 0x40, 0x00, 0x0B, 0x0B) // if unreachable end, end
+}
+
+// growBody returns the body of the injected function which replaces
+// memory.grow(delta i32) i32: it fails, and sets the limit hit global, when
+// the memory would grow past the memory limit global.
+func growBody(memoryLimit, limitHit uint32) []byte {
+	b := []byte{0x00}                              // no locals
+	b = append(b, 0x3F, 0x00, 0xAD)                // i64(memory.size)
+	b = append(b, 0x20, 0x00, 0xAD, 0x7C)          // + i64(delta)
+	b = appendGlobal(b, 0x23, memoryLimit)         // global.get memory limit
+	b = append(b, 0xAD, 0x56, 0x04, 0x40)          // if > i64(memory limit)
+	b = append(b, 0x41, 0x01)                      // i32.const 1
+	b = appendGlobal(b, 0x24, limitHit)            // global.set limit hit
+	b = append(b, 0x41, 0x7F, 0x0F, 0x0B)          // return -1, end
+	return append(b, 0x20, 0x00, 0x40, 0x00, 0x0B) // memory.grow(delta), end
+}
+
+func appendGlobal(b []byte, op byte, global uint32) []byte {
+	return binary.AppendUvarint(append(b, op), uint64(global))
+}
+
+// instrumentCode instruments the bodies of the functions of a module.
+func instrumentCode(payload []byte, funcs, charge, grow uint32) ([]byte, error) {
+	r := &reader{data: payload}
+	n := r.u32()
+	if r.err == nil && n != funcs {
+		return nil, fmt.Errorf("%d function bodies for %d functions", n, funcs)
+	}
+	out := binary.AppendUvarint(nil, uint64(n))
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		body := r.bytes(r.u32())
+		if r.err != nil {
+			break
+		}
+		instrumented, err := instrumentBody(body, charge, grow)
+		if err != nil {
+			return nil, fmt.Errorf("function %d: %v", i, err)
+		}
+		out = appendBytes(out, instrumented)
+	}
+	return out, r.err
+}
+
+// instrumentBody charges fuel at the entry of a function and at each
+// iteration of its loops, and replaces its memory.grow.
+func instrumentBody(body []byte, charge, grow uint32) ([]byte, error) {
+	r := &reader{data: body}
+	locals := r.u32()
+	for i := uint32(0); i < locals && r.err == nil; i++ {
+		r.u32()
+		r.valType()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	out := append([]byte(nil), body[:r.pos]...)
+	out = appendCall(out, charge)
+	for r.err == nil && !r.done() {
+		start := r.pos
+		op := r.byte()
+		switch op {
+		case 0x03: // loop
+			r.blockType()
+			out = append(out, body[start:r.pos]...)
+			out = appendCall(out, charge)
+			continue
+		case 0x40: // memory.grow
+			if r.byte() != 0x00 && r.err == nil {
+				r.fail("memory.grow of a memory other than 0")
+			}
+			out = appendCall(out, grow)
+			continue
+		}
+		r.immediates(op)
+		out = append(out, body[start:r.pos]...)
+	}
+	return out, r.err
+}
+
+func appendCall(b []byte, fn uint32) []byte {
+	return binary.AppendUvarint(append(b, 0x10), uint64(fn))
+}
+
+func appendBytes(b, data []byte) []byte {
+	return append(binary.AppendUvarint(b, uint64(len(data))), data...)
+}
+
+func appendSleb(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// reader reads a module. Its first error sticks, and makes the reads return
+// zeros.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (r *reader) done() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.done() {
+		r.fail("unexpected end of the module")
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *reader) bytes(n uint32) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.data)-r.pos) < uint64(n) {
+		r.fail("unexpected end of the module")
+		return nil
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b
+}
+
+func (r *reader) u32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 || n > 5 || v > math.MaxUint32 {
+		r.fail("invalid integer at offset %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return uint32(v)
+}
+
+// skipLEB skips a signed or a 64 bits integer.
+func (r *reader) skipLEB() {
+	for i := 0; i < 10; i++ {
+		if r.byte()&0x80 == 0 {
+			return
+		}
+	}
+	r.fail("invalid integer at offset %d", r.pos)
+}
+
+func (r *reader) name() string {
+	return string(r.bytes(r.u32()))
+}
+
+func (r *reader) valType() {
+	switch t := r.byte(); t {
+	case valI32, valI64, valF32, valF64, valV128, valFuncref, valExternref:
+	default:
+		r.fail("unsupported value type 0x%x", t)
+	}
+}
+
+func (r *reader) blockType() {
+	if r.err != nil || r.done() {
+		r.byte()
+		return
+	}
+	switch r.data[r.pos] {
+	case 0x40, valI32, valI64, valF32, valF64, valV128, valFuncref, valExternref:
+		r.byte()
+	default:
+		r.skipLEB()
+	}
+}
+
+// memoryLimits reads the limits of a memory.
+func (r *reader) memoryLimits() {
+	flags := r.byte()
+	switch {
+	case flags&0x02 != 0:
+		r.fail("shared memories are not supported")
+	case flags&0x04 != 0:
+		r.fail("64 bits memories are not supported")
+	}
+	r.u32()
+	if flags&0x01 != 0 {
+		r.u32()
+	}
+}
+
+// imports reads the import section, and returns the number of the imported
+// functions, globals and memories.
+func (r *reader) imports() (funcs, globals, memories uint32) {
+	n := r.u32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		r.name()
+		r.name()
+		switch kind := r.byte(); kind {
+		case 0x00:
+			r.u32()
+			funcs++
+		case 0x01:
+			r.valType()
+			flags := r.byte()
+			r.u32()
+			if flags&0x01 != 0 {
+				r.u32()
+			}
+		case 0x02:
+			r.memoryLimits()
+			memories++
+		case 0x03:
+			r.valType()
+			r.byte()
+			globals++
+		default:
+			r.fail("unsupported import kind %d", kind)
+		}
+	}
+	return funcs, globals, memories
+}
+
+func (r *reader) memArg() {
+	if align := r.u32(); align&0x40 != 0 {
+		r.fail("multiple memories are not supported")
+	}
+	r.u32()
+}
+
+// immediates reads the immediates of an instruction.
+func (r *reader) immediates(op byte) {
+	switch {
+	case op == 0x02 || op == 0x04: // block, if
+		r.blockType()
+	case op == 0x0C || op == 0x0D: // br, br_if
+		r.u32()
+	case op == 0x0E: // br_table
+		n := r.u32()
+		for i := uint32(0); i <= n && r.err == nil; i++ {
+			r.u32()
+		}
+	case op == 0x10 || op == 0x12: // call, return_call
+		r.u32()
+	case op == 0x11 || op == 0x13: // call_indirect, return_call_indirect
+		r.u32()
+		r.u32()
+	case op == 0x1C: // select t
+		n := r.u32()
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			r.valType()
+		}
+	case op >= 0x20 && op <= 0x26: // local, global, table.get, table.set
+		r.u32()
+	case op >= 0x28 && op <= 0x3E: // loads, stores
+		r.memArg()
+	case op == 0x3F: // memory.size
+		r.byte()
+	case op == 0x41 || op == 0x42: // i32.const, i64.const
+		r.skipLEB()
+	case op == 0x43:
+		r.bytes(4)
+	case op == 0x44:
+		r.bytes(8)
+	case op == 0xD0: // ref.null
+		r.byte()
+	case op == 0xD2: // ref.func
+		r.u32()
+	case op == 0xFC:
+		r.miscImmediates(r.u32())
+	case op == 0xFD:
+		r.simdImmediates(r.u32())
+	case op == 0xFE:
+		r.fail("atomic instructions are not supported")
+	case op <= 0x01, op == 0x05, op == 0x0B, op == 0x0F, op == 0x1A, op == 0x1B,
+		op >= 0x45 && op <= 0xC4, op == 0xD1:
+	default:
+		r.fail("unsupported instruction 0x%x", op)
+	}
+}
+
+// miscImmediates reads the immediates of an instruction prefixed by 0xFC.
+func (r *reader) miscImmediates(op uint32) {
+	switch {
+	case op <= 7: // the saturating truncations
+	case op == 8: // memory.init
+		r.u32()
+		r.byte()
+	case op == 10: // memory.copy
+		r.byte()
+		r.byte()
+	case op == 11: // memory.fill
+		r.byte()
+	case op == 12 || op == 14: // table.init, table.copy
+		r.u32()
+		r.u32()
+	case op == 9 || op == 13 || (op >= 15 && op <= 17): // data.drop, elem.drop, table.grow, table.size, table.fill
+		r.u32()
+	default:
+		r.fail("unsupported instruction 0xfc %d", op)
+	}
+}
+
+// simdImmediates reads the immediates of an instruction prefixed by 0xFD.
+func (r *reader) simdImmediates(op uint32) {
+	switch {
+	case op <= 11 || op == 92 || op == 93: // loads, stores
+		r.memArg()
+	case op == 12 || op == 13: // v128.const, i8x16.shuffle
+		r.bytes(16)
+	case op >= 21 && op <= 34: // extract_lane, replace_lane
+		r.byte()
+	case op >= 84 && op <= 91: // load_lane, store_lane
+		r.memArg()
+		r.byte()
+	case op <= 275:
+	default:
+		r.fail("unsupported instruction 0xfd %d", op)
+	}
+}
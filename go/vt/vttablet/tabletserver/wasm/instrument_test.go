@@ -0,0 +1,79 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratelabs/wazero"
+
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm/wasmtest"
+)
+
+func TestInstrument(t *testing.T) {
+	ctx := context.Background()
+	r := wazero.NewRuntime(ctx)
+	defer r.Close(ctx)
+
+	// A module without memory, globals nor exports gets them.
+	m := wasmtest.New()
+	m.Func(nil, nil, nil)
+	bin := m.Build()
+	// The debug info is dropped.
+	debug := append([]byte{0x00}, binary.AppendUvarint(nil, uint64(len(".debug_info")+2))...)
+	debug = append(debug, byte(len(".debug_info")))
+	debug = append(debug, ".debug_info"...)
+	debug = append(debug, 0x00)
+	bin = append(bin, debug...)
+	instrumented, err := instrument(bin, 10, 1)
+	require.NoError(t, err)
+	assert.NotContains(t, string(instrumented), ".debug_info")
+	mod, err := r.Instantiate(ctx, instrumented)
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, mod.ExportedGlobal(fuelExport).Get())
+	assert.EqualValues(t, 1, mod.ExportedGlobal(memoryLimitExport).Get())
+	assert.EqualValues(t, 0, mod.ExportedGlobal(limitHitExport).Get())
+
+	// The fuel of the initialization is the one of the calls.
+	plugin := wasmtest.New()
+	plugin.Export("_initialize", plugin.Func(nil, nil, nil, spin[0]))
+	plugin.Plugin()
+	instrumented, err = instrument(plugin.Build(), 1000, 1)
+	require.NoError(t, err)
+	compiled, err := r.CompileModule(ctx, instrumented)
+	require.NoError(t, err)
+	_, err = r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	assert.ErrorContains(t, err, "unreachable")
+
+	reserved := wasmtest.New()
+	reserved.ExportGlobal(fuelExport, reserved.Global(wasmtest.I64, wasmtest.I64Const(0)))
+	atomic := wasmtest.New()
+	atomic.Memory(1)
+	atomic.Func(nil, nil, nil, wasmtest.I32Const(0), wasmtest.Op(0xFE, 0x10, 0x02, 0x00), wasmtest.Drop)
+	for _, tcase := range []struct {
+		binary []byte
+		err    string
+	}{{
+		binary: []byte("\x00asm"),
+		err:    "not a WASM module of version 1",
+	}, {
+		binary: append(m.Build(), 0x01, 0x10),
+		err:    "unexpected end of the module",
+	}, {
+		binary: reserved.Build(),
+		err:    "the export wescale_fuel is reserved",
+	}, {
+		binary: atomic.Build(),
+		err:    "function 0: atomic instructions are not supported",
+	}} {
+		_, err := instrument(tcase.binary, 10, 1)
+		assert.EqualError(t, err, tcase.err)
+	}
+}
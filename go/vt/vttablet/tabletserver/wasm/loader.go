@@ -0,0 +1,167 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/servenv"
+)
+
+// Version is a version of a plugin of the registry of the plugins.
+type Version struct {
+	Name    string
+	Version string
+	// Checksum is the SHA-256 of the binary, in hex.
+	Checksum string
+}
+
+// Ref returns the reference of the version, name@version.
+func (v Version) Ref() string {
+	return v.Name + "@" + v.Version
+}
+
+// Source reads the registry of the plugins.
+type Source interface {
+	// Resolve returns the versions the references resolve to, by reference,
+	// leaving out the references to no version.
+	Resolve(ctx context.Context, refs []string) (map[string]Version, error)
+	// Binary returns the binary of a version.
+	Binary(ctx context.Context, version Version) ([]byte, error)
+}
+
+// Loader loads the plugins the rules of a tablet reference into a registry,
+// and reloads them when the versions their references resolve to change.
+type Loader struct {
+	rt       *Runtime
+	registry *Registry
+	reloads  *stats.CountersWithMultiLabels
+
+	mu sync.Mutex
+	// modules are the loaded modules, by name@version. The versions are never
+	// overwritten in the registry, so a module stays valid.
+	modules map[string]*Module
+	// loaded are the checksums of the modules the references run.
+	loaded map[string]string
+	// retired are the modules the last reload stopped referencing. They are
+	// closed by the next one, once the queries which got them are done.
+	retired []*Module
+}
+
+// NewLoader returns a loader compiling the plugins with rt into registry.
+func NewLoader(rt *Runtime, registry *Registry, exporter *servenv.Exporter) *Loader {
+	l := &Loader{
+		rt:       rt,
+		registry: registry,
+		reloads:  exporter.NewCountersWithMultiLabels("WasmPluginReloads", "The loads of the versions of the WASM plugins, by result", []string{"Plugin", "Result"}),
+		modules:  map[string]*Module{},
+		loaded:   map[string]string{},
+	}
+	exporter.NewGaugesFuncWithMultiLabels("WasmPluginLoaded", "The checksums of the versions the references to the WASM plugins run", []string{"Plugin", "Checksum"}, l.loadedChecksums)
+	return l
+}
+
+// Reload loads the versions refs resolve to in source, and swaps them in the
+// registry at once. A version which can't be loaded isn't swapped in: its
+// references keep the version they had, if any, and the error is returned.
+func (l *Loader) Reload(ctx context.Context, refs []string, source Source) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var versions map[string]Version
+	if len(refs) > 0 {
+		var err error
+		if versions, err = source.Resolve(ctx, refs); err != nil {
+			return fmt.Errorf("cannot resolve the plugins %v: %v", refs, err)
+		}
+	}
+	var errs []error
+	plugins := make(map[string]Plugin, len(refs))
+	modules := make(map[string]*Module, len(refs))
+	loaded := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		var m *Module
+		version, ok := versions[ref]
+		err := fmt.Errorf("plugin %s is not in the registry", ref)
+		if ok {
+			if m = modules[version.Ref()]; m == nil {
+				m, err = l.load(ctx, version, source)
+			}
+		}
+		if m == nil {
+			errs = append(errs, err)
+			// A bad upgrade is no upgrade: the reference keeps its version.
+			old, _ := l.registry.Get(ref)
+			if m, _ = old.(*Module); m == nil {
+				continue
+			}
+			version.Checksum = l.loaded[ref]
+		}
+		plugins[ref], modules[m.ref], loaded[ref] = m, m, version.Checksum
+	}
+	l.registry.Set(plugins)
+
+	for _, m := range l.retired {
+		if modules[m.ref] != m {
+			_ = m.Close(ctx)
+		}
+	}
+	l.retired = nil
+	for ref, m := range l.modules {
+		if modules[ref] != m {
+			l.retired = append(l.retired, m)
+		}
+	}
+	l.modules, l.loaded = modules, loaded
+	return errors.Join(errs...)
+}
+
+// load returns the module of a version, compiling it if it isn't loaded.
+func (l *Loader) load(ctx context.Context, version Version, source Source) (*Module, error) {
+	if m := l.modules[version.Ref()]; m != nil {
+		return m, nil
+	}
+	for _, m := range l.retired {
+		if m.ref == version.Ref() {
+			return m, nil
+		}
+	}
+	binary, err := source.Binary(ctx, version)
+	if err != nil {
+		l.reloads.Add([]string{version.Ref(), "error"}, 1)
+		return nil, fmt.Errorf("cannot read plugin %s: %v", version.Ref(), err)
+	}
+	if sum := sha256.Sum256(binary); hex.EncodeToString(sum[:]) != version.Checksum {
+		l.reloads.Add([]string{version.Ref(), "error"}, 1)
+		return nil, fmt.Errorf("the binary of plugin %s doesn't have the checksum %s of the registry", version.Ref(), version.Checksum)
+	}
+	m, err := l.rt.Compile(ctx, version.Ref(), binary)
+	if err != nil {
+		l.reloads.Add([]string{version.Ref(), "error"}, 1)
+		return nil, err
+	}
+	l.reloads.Add([]string{version.Ref(), "loaded"}, 1)
+	log.Infof("Loaded WASM plugin %s, of checksum %s", version.Ref(), version.Checksum)
+	return m, nil
+}
+
+// loadedChecksums returns 1 for the checksum each reference runs.
+func (l *Loader) loadedChecksums() map[string]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	checksums := make(map[string]int64, len(l.loaded))
+	for ref, checksum := range l.loaded {
+		checksums[safeJoin(ref, checksum)] = 1
+	}
+	return checksums
+}
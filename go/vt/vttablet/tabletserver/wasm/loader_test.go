@@ -0,0 +1,142 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm/wasmtest"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// fakeSource is a registry of plugins in memory.
+type fakeSource struct {
+	versions map[string]Version
+	binaries map[string][]byte
+	// current is the current version of each plugin.
+	current map[string]string
+	// reads are the versions whose binary was read.
+	reads []string
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{versions: map[string]Version{}, binaries: map[string][]byte{}, current: map[string]string{}}
+}
+
+// add adds a version, which becomes current.
+func (s *fakeSource) add(name, version string, binary []byte) {
+	sum := sha256.Sum256(binary)
+	v := Version{Name: name, Version: version, Checksum: hex.EncodeToString(sum[:])}
+	s.versions[v.Ref()], s.binaries[v.Ref()], s.current[name] = v, binary, version
+}
+
+func (s *fakeSource) Resolve(_ context.Context, refs []string) (map[string]Version, error) {
+	versions := map[string]Version{}
+	for _, ref := range refs {
+		if v, ok := s.versions[ref]; ok {
+			versions[ref] = v
+		} else if v, ok := s.versions[ref+"@"+s.current[ref]]; ok {
+			versions[ref] = v
+		}
+	}
+	return versions, nil
+}
+
+func (s *fakeSource) Binary(_ context.Context, v Version) ([]byte, error) {
+	s.reads = append(s.reads, v.Ref())
+	return s.binaries[v.Ref()], nil
+}
+
+// rejecting returns a plugin rejecting the queries with msg.
+func rejecting(msg string) []byte {
+	plugin := wasmtest.NewPlugin()
+	plugin.Respond(string(HookBeforeExecution), `{"action": "reject", "error": {"message": "`+msg+`"}}`)
+	return plugin.Build()
+}
+
+func TestLoaderReload(t *testing.T) {
+	ctx := context.Background()
+	rt := newTestRuntime(t, Limits{})
+	registry := NewRegistry()
+	loader := NewLoader(rt, registry, servenv.NewExporter("WasmLoaderTest", "Tablet"))
+	source := newFakeSource()
+	source.add("tenant", "1", rejecting("v1"))
+
+	// message returns the message a plugin rejects the queries with.
+	message := func(plugin Plugin) string {
+		t.Helper()
+		resp, err := plugin.Call(ctx, &Call{Hook: HookBeforeExecution})
+		require.NoError(t, err)
+		return resp.Error.Message
+	}
+	get := func(ref string) Plugin {
+		t.Helper()
+		plugin, ok := registry.Get(ref)
+		require.True(t, ok, ref)
+		return plugin
+	}
+
+	// The references to the same version share its module.
+	require.NoError(t, loader.Reload(ctx, []string{"tenant", "tenant@1"}, source))
+	assert.Same(t, get("tenant"), get("tenant@1"))
+	assert.Equal(t, "v1", message(get("tenant")))
+	assert.Equal(t, []string{"tenant@1"}, source.reads)
+
+	// An upgrade is swapped in, and the queries which got the version before
+	// it keep running it.
+	running := get("tenant")
+	source.add("tenant", "2", rejecting("v2"))
+	require.NoError(t, loader.Reload(ctx, []string{"tenant"}, source))
+	assert.Equal(t, "v2", message(get("tenant")))
+	assert.Equal(t, "v1", message(running))
+	_, ok := registry.Get("tenant@1")
+	assert.False(t, ok)
+
+	// A rollback to the version the last reload replaced doesn't read it
+	// again.
+	source.current["tenant"] = "1"
+	source.reads = nil
+	require.NoError(t, loader.Reload(ctx, []string{"tenant"}, source))
+	assert.Equal(t, "v1", message(get("tenant")))
+	assert.Empty(t, source.reads)
+	source.current["tenant"] = "2"
+	require.NoError(t, loader.Reload(ctx, []string{"tenant"}, source))
+	assert.Empty(t, source.reads)
+
+	// A bad upgrade is no upgrade.
+	source.add("tenant", "3", []byte("\x00asm\x01\x00\x00\x00"))
+	err := loader.Reload(ctx, []string{"tenant"}, source)
+	assert.EqualError(t, err, "invalid plugin tenant@3: it doesn't export wescale_abi_version_1")
+	assert.Equal(t, "v2", message(get("tenant")))
+	source.add("tenant", "4", rejecting("v4"))
+	source.binaries["tenant@4"] = rejecting("tampered")
+	err = loader.Reload(ctx, []string{"tenant", "missing"}, source)
+	assert.ErrorContains(t, err, "the binary of plugin tenant@4 doesn't have the checksum")
+	assert.ErrorContains(t, err, "plugin missing is not in the registry")
+	assert.Equal(t, "v2", message(get("tenant")))
+	assert.EqualValues(t, 1, loader.reloads.Counts()["tenant@3.error"])
+	assert.EqualValues(t, 1, loader.reloads.Counts()["tenant@4.error"])
+	assert.Equal(t, map[string]int64{"tenant." + source.versions["tenant@2"].Checksum: 1}, loader.loadedChecksums())
+
+	// The versions no longer referenced are closed by the next reload.
+	running = get("tenant")
+	require.NoError(t, loader.Reload(ctx, nil, source))
+	assert.Equal(t, "v2", message(running))
+	require.NoError(t, loader.Reload(ctx, nil, source))
+	_, err = running.Call(ctx, &Call{Hook: HookBeforeExecution})
+	assert.EqualError(t, err, "wasm plugin tenant@2 was unloaded")
+	assert.Equal(t, vtrpcpb.Code_FAILED_PRECONDITION, vterrors.Code(err))
+	assert.Empty(t, loader.loadedChecksums())
+}
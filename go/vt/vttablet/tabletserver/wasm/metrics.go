@@ -0,0 +1,135 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/servenv"
+)
+
+// histogramBuckets are the upper bounds of the buckets of the histograms of
+// the plugins. The values above the last one are counted in the inf bucket.
+var histogramBuckets = []float64{0.001, 0.01, 0.1, 1, 10, 100, 1000, 10000, 100000, 1000000}
+
+// pluginMetrics are the metrics the plugins publish with the host functions,
+// labeled by plugin and name.
+type pluginMetrics struct {
+	// maxNames is the number of names a plugin can create, 0 for no limit.
+	maxNames int
+	counters *stats.CountersWithMultiLabels
+	gauges   *stats.GaugesWithMultiLabels
+	dropped  *stats.CountersWithSingleLabel
+
+	mu sync.Mutex
+	// names are the names of the metrics of each plugin.
+	names map[string]map[string]bool
+	// histograms are the counts of the buckets of the histograms, by plugin
+	// and name.
+	histograms map[[2]string][]int64
+}
+
+func newPluginMetrics(maxNames int, exporter *servenv.Exporter) *pluginMetrics {
+	m := &pluginMetrics{
+		maxNames:   maxNames,
+		counters:   exporter.NewCountersWithMultiLabels("WasmPluginCounters", "The counters of the WASM plugins", []string{"Plugin", "Name"}),
+		gauges:     exporter.NewGaugesWithMultiLabels("WasmPluginGauges", "The gauges of the WASM plugins", []string{"Plugin", "Name"}),
+		dropped:    exporter.NewCountersWithSingleLabel("WasmPluginMetricsDropped", "The updates of the metrics the WASM plugins couldn't create", "Plugin"),
+		names:      map[string]map[string]bool{},
+		histograms: map[[2]string][]int64{},
+	}
+	exporter.NewCountersFuncWithMultiLabels("WasmPluginHistograms", "The histograms of the WASM plugins, as the cumulative counts of their buckets", []string{"Plugin", "Name", "Le"}, m.histogramCounts)
+	return m
+}
+
+// name checks that a plugin can update the metric of a name, and counts the
+// drop if it can't.
+func (m *pluginMetrics) name(plugin, name string) bool {
+	names := m.names[plugin]
+	if names == nil {
+		names = map[string]bool{}
+		m.names[plugin] = names
+	}
+	if !names[name] {
+		if m.maxNames > 0 && len(names) >= m.maxNames {
+			m.dropped.Add(plugin, 1)
+			return false
+		}
+		names[name] = true
+	}
+	return true
+}
+
+func (m *pluginMetrics) counterAdd(plugin, name string, delta int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.name(plugin, name) {
+		return false
+	}
+	m.counters.Add([]string{plugin, name}, delta)
+	return true
+}
+
+func (m *pluginMetrics) gaugeSet(plugin, name string, value int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.name(plugin, name) {
+		return false
+	}
+	m.gauges.Set([]string{plugin, name}, value)
+	return true
+}
+
+func (m *pluginMetrics) histogramObserve(plugin, name string, value float64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.name(plugin, name) {
+		return false
+	}
+	key := [2]string{plugin, name}
+	counts := m.histograms[key]
+	if counts == nil {
+		counts = make([]int64, len(histogramBuckets)+1)
+		m.histograms[key] = counts
+	}
+	counts[sort.SearchFloat64s(histogramBuckets, value)]++
+	return true
+}
+
+// histogramCounts returns the cumulative counts of the buckets of the
+// histograms, keyed by plugin, name and upper bound, like the multi-label
+// counters.
+func (m *pluginMetrics) histogramCounts() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]int64, len(m.histograms)*(len(histogramBuckets)+1))
+	for key, buckets := range m.histograms {
+		var total int64
+		for i, count := range buckets {
+			total += count
+			le := math.Inf(1)
+			if i < len(histogramBuckets) {
+				le = histogramBuckets[i]
+			}
+			counts[safeJoin(key[0], key[1], strconv.FormatFloat(le, 'e', -1, 64))] = total
+		}
+	}
+	return counts
+}
+
+// safeJoin joins labels into the key of a multi-label metric, like the stats
+// package does.
+func safeJoin(labels ...string) string {
+	for i, label := range labels {
+		labels[i] = strings.ReplaceAll(label, ".", "_")
+	}
+	return strings.Join(labels, ".")
+}
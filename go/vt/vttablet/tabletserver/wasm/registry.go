@@ -0,0 +1,36 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"sync/atomic"
+)
+
+// Registry holds the plugins loaded by a tablet, by the references the rules
+// make to them, name or name@version. The plugins are an immutable map,
+// swapped at once when they are reloaded, so that a query which got a plugin
+// runs it from its first hook to its last.
+type Registry struct {
+	plugins atomic.Pointer[map[string]Plugin]
+}
+
+// NewRegistry returns a registry without any plugin.
+func NewRegistry() *Registry {
+	r := &Registry{}
+	r.plugins.Store(&map[string]Plugin{})
+	return r
+}
+
+// Get returns the plugin a reference is to, if it is loaded.
+func (r *Registry) Get(ref string) (Plugin, bool) {
+	plugin, ok := (*r.plugins.Load())[ref]
+	return plugin, ok
+}
+
+// Set replaces the plugins, by reference.
+func (r *Registry) Set(plugins map[string]Plugin) {
+	r.plugins.Store(&plugins)
+}
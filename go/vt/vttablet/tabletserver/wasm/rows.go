@@ -0,0 +1,120 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// keepRows is the number of rows result_rows returns to keep the rows of the
+// chunk as they are.
+const keepRows = -1
+
+// nullLength is the length of the NULL values.
+const nullLength = -1
+
+// EncodeRows encodes rows in the binary format of result_rows, rather than in
+// JSON, to avoid the cost of JSON on every value: the number of rows, then
+// for each row the number of its values, then each value as its length, -1
+// for NULL, and its bytes. The numbers are i32, in little endian.
+func EncodeRows(rows []sqltypes.Row) []byte {
+	size := 4
+	for _, row := range rows {
+		size += 4 + 4*len(row)
+		for _, v := range row {
+			size += v.Len()
+		}
+	}
+	data := make([]byte, 0, size)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(rows)))
+	for _, row := range rows {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(row)))
+		for _, v := range row {
+			length := int32(nullLength)
+			if !v.IsNull() {
+				length = int32(v.Len())
+			}
+			data = binary.LittleEndian.AppendUint32(data, uint32(length))
+			data = append(data, v.Raw()...)
+		}
+	}
+	return data
+}
+
+// DecodeRows decodes rows encoded by EncodeRows. keep is set for the number
+// of rows -1, which keeps the rows of the chunk. The values are VARBINARY
+// until TypeRows types them.
+func DecodeRows(data []byte) (rows []sqltypes.Row, keep bool, err error) {
+	next := func() (int32, error) {
+		if len(data) < 4 {
+			return 0, fmt.Errorf("the rows are truncated")
+		}
+		n := int32(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		return n, nil
+	}
+	count, err := next()
+	switch {
+	case err != nil:
+		return nil, false, err
+	case count == keepRows:
+		return nil, true, nil
+	case count < 0:
+		return nil, false, fmt.Errorf("invalid number of rows %d", count)
+	}
+	rows = make([]sqltypes.Row, 0, min(int(count), len(data)/4))
+	for i := int32(0); i < count; i++ {
+		n, err := next()
+		if err != nil {
+			return nil, false, err
+		}
+		if n < 0 || int(n) > len(data)/4 {
+			return nil, false, fmt.Errorf("invalid number of values %d in row %d", n, i)
+		}
+		row := make(sqltypes.Row, n)
+		for j := range row {
+			length, err := next()
+			if err != nil {
+				return nil, false, err
+			}
+			switch {
+			case length == nullLength:
+				row[j] = sqltypes.NULL
+			case length < 0 || int(length) > len(data):
+				return nil, false, fmt.Errorf("invalid length %d of value %d of row %d", length, j, i)
+			default:
+				row[j] = sqltypes.MakeTrusted(sqltypes.VarBinary, data[:length:length])
+				data = data[length:]
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(data) > 0 {
+		return nil, false, fmt.Errorf("%d bytes follow the rows", len(data))
+	}
+	return rows, false, nil
+}
+
+// TypeRows checks that rows a plugin returned have a value for each field,
+// and types their values like the fields.
+func TypeRows(rows []sqltypes.Row, fields []*querypb.Field) error {
+	for i, row := range rows {
+		if len(row) != len(fields) {
+			return fmt.Errorf("row %d has %d values for %d fields", i, len(row), len(fields))
+		}
+		for j, v := range row {
+			if !v.IsNull() {
+				row[j] = sqltypes.MakeTrusted(fields[j].Type, v.Raw())
+			}
+		}
+	}
+	return nil
+}
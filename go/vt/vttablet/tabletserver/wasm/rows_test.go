@@ -0,0 +1,97 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm/wasmtest"
+)
+
+func TestRows(t *testing.T) {
+	fields := sqltypes.MakeTestFields("id|name", "int64|varchar")
+	rows := sqltypes.MakeTestResult(fields, "1|a", "2|null", "3|").Rows
+	data := EncodeRows(rows)
+	assert.Equal(t, []byte{
+		3, 0, 0, 0,
+		2, 0, 0, 0, 1, 0, 0, 0, '1', 1, 0, 0, 0, 'a',
+		2, 0, 0, 0, 1, 0, 0, 0, '2', 0xFF, 0xFF, 0xFF, 0xFF,
+		2, 0, 0, 0, 1, 0, 0, 0, '3', 0, 0, 0, 0,
+	}, data)
+
+	decoded, keep, err := DecodeRows(data)
+	require.NoError(t, err)
+	assert.False(t, keep)
+	require.NoError(t, TypeRows(decoded, fields))
+	assert.Equal(t, rows, decoded)
+	assert.EqualError(t, TypeRows(decoded, fields[:1]), "row 0 has 2 values for 1 fields")
+
+	_, keep, err = DecodeRows([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	require.NoError(t, err)
+	assert.True(t, keep)
+	decoded, _, err = DecodeRows([]byte{0, 0, 0, 0})
+	require.NoError(t, err)
+	assert.Empty(t, decoded)
+
+	for _, tcase := range []struct {
+		data []byte
+		err  string
+	}{
+		{nil, "the rows are truncated"},
+		{data[:len(data)-1], "the rows are truncated"},
+		{append(data, 0), "1 bytes follow the rows"},
+		{[]byte{0xFE, 0xFF, 0xFF, 0xFF}, "invalid number of rows -2"},
+		{[]byte{1, 0, 0, 0, 9, 0, 0, 0}, "invalid number of values 9 in row 0"},
+		{[]byte{1, 0, 0, 0, 1, 0, 0, 0, 5, 0, 0, 0, 'a'}, "invalid length 5 of value 0 of row 0"},
+	} {
+		_, _, err := DecodeRows(tcase.data)
+		assert.EqualError(t, err, tcase.err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	rt := newTestRuntime(t, Limits{})
+
+	// result_rows returns first, the first time an instance is called, and
+	// then next.
+	first := EncodeRows([]sqltypes.Row{{sqltypes.NewVarBinary("first")}})
+	next := EncodeRows([]sqltypes.Row{{sqltypes.NewVarBinary("next")}})
+	plugin := wasmtest.NewPlugin()
+	calls := plugin.Global(wasmtest.I32, wasmtest.I32Const(0))
+	plugin.Hook(string(HookResultRows),
+		wasmtest.Packed(plugin.Data(next), uint32(len(next))), wasmtest.LocalSet(4),
+		wasmtest.GlobalGet(calls), wasmtest.I32Const(0), wasmtest.I32Eq,
+		wasmtest.If(wasmtest.Packed(plugin.Data(first), uint32(len(first))), wasmtest.LocalSet(4)),
+		wasmtest.GlobalGet(calls), wasmtest.I32Const(1), wasmtest.I32Add, wasmtest.GlobalSet(calls),
+		wasmtest.LocalGet(4))
+	m, err := rt.Compile(ctx, "count@1", plugin.Build())
+	require.NoError(t, err)
+
+	value := func(stream *Stream) string {
+		t.Helper()
+		resp, err := m.Call(ctx, &Call{Hook: HookResultRows, Rows: []sqltypes.Row{{sqltypes.NULL}}, Stream: stream})
+		require.NoError(t, err)
+		require.Equal(t, DecisionReplace, resp.Decision)
+		return resp.Rows[0][0].ToString()
+	}
+	// The calls of a stream run in the instance it holds, which the other
+	// calls don't get.
+	stream := &Stream{}
+	assert.Equal(t, "first", value(stream))
+	assert.Equal(t, "first", value(nil))
+	assert.Equal(t, "next", value(stream))
+	assert.Len(t, m.instances, 1)
+	stream.Close()
+	assert.Len(t, m.instances, 2)
+	stream.Close()
+	assert.Len(t, m.instances, 2)
+}
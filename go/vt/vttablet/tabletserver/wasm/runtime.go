@@ -0,0 +1,619 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+const (
+	// maxMemoryPages is the number of pages of the largest memory of a
+	// module, 4 GiB.
+	maxMemoryPages = 65536
+	// maxIdleInstances is the number of instances of a module kept for the
+	// next calls.
+	maxIdleInstances = 8
+	// logInterval is the interval between the logs of a plugin.
+	logInterval = time.Second
+)
+
+// allowedImports are the host modules the plugins can import functions from.
+var allowedImports = map[string]bool{
+	wasi_snapshot_preview1.ModuleName: true,
+	HostModule:                        true,
+}
+
+// Limits bound the calls of the plugins. A zero field is no limit.
+type Limits struct {
+	// Fuel is the number of function calls and loop iterations a call runs
+	// at most.
+	Fuel int64
+	// MemoryPages is the number of 64 KiB pages the memory of a plugin grows
+	// to at most.
+	MemoryPages uint32
+	// Timeout is the wall-clock time a call takes at most, including the
+	// time spent in the host functions.
+	Timeout time.Duration
+}
+
+// Lower returns the limits, lowered by the ones set in o.
+func (l Limits) Lower(o Limits) Limits {
+	if o.Fuel > 0 && (l.Fuel == 0 || o.Fuel < l.Fuel) {
+		l.Fuel = o.Fuel
+	}
+	if o.MemoryPages > 0 && (l.MemoryPages == 0 || o.MemoryPages < l.MemoryPages) {
+		l.MemoryPages = o.MemoryPages
+	}
+	if o.Timeout > 0 && (l.Timeout == 0 || o.Timeout < l.Timeout) {
+		l.Timeout = o.Timeout
+	}
+	return l
+}
+
+func (l Limits) fuel() int64 {
+	if l.Fuel <= 0 {
+		return math.MaxInt64
+	}
+	return l.Fuel
+}
+
+func (l Limits) memoryPages() uint32 {
+	if l.MemoryPages == 0 || l.MemoryPages > maxMemoryPages {
+		return maxMemoryPages
+	}
+	return l.MemoryPages
+}
+
+// Limit is a limit a call can hit.
+type Limit string
+
+const (
+	LimitFuel    Limit = "fuel"
+	LimitMemory  Limit = "memory"
+	LimitTimeout Limit = "timeout"
+)
+
+// LimitError is the error of a call stopped by a limit. Its code is
+// RESOURCE_EXHAUSTED.
+type LimitError struct {
+	Plugin string
+	Hook   Hook
+	Limit  Limit
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("wasm plugin %s exceeded its %s limit in %s", e.Plugin, e.Limit, e.Hook)
+}
+
+// ErrorCode implements vterrors.ErrorWithCode.
+func (e *LimitError) ErrorCode() vtrpcpb.Code {
+	return vtrpcpb.Code_RESOURCE_EXHAUSTED
+}
+
+// The kinds of the failures of the calls.
+const (
+	// FailureTrap is a plugin which trapped, like on an unreachable
+	// instruction or an out-of-bounds access.
+	FailureTrap = "trap"
+	// FailureInvalidResponse is a plugin which returned a response the host
+	// can't read.
+	FailureInvalidResponse = "invalid_response"
+	// FailureHostPanic is a host function, or the host, which panicked, or
+	// failed, serving a call.
+	FailureHostPanic = "host_panic"
+)
+
+// errInvalidResponse is the error of a plugin whose response is out of its
+// memory.
+var errInvalidResponse = errors.New("invalid response")
+
+// PluginError is the error of a call which failed. Its code is INTERNAL, and
+// its MySQL error ERWasmPluginFailed, so that the clients can tell a plugin
+// which failed from a query which failed.
+type PluginError struct {
+	Plugin string
+	Hook   Hook
+	// Kind is the kind of the failure, like FailureTrap.
+	Kind string
+	Err  error
+}
+
+func (e *PluginError) Error() string {
+	return fmt.Sprintf("wasm plugin %s failed in %s: %v (errno %d) (sqlstate %s)", e.Plugin, e.Hook, e.Err, mysql.ERWasmPluginFailed, mysql.SSUnknownSQLState)
+}
+
+// ErrorCode implements vterrors.ErrorWithCode.
+func (e *PluginError) ErrorCode() vtrpcpb.Code {
+	return vtrpcpb.Code_INTERNAL
+}
+
+// Config configures a runtime.
+type Config struct {
+	// Limits bound the calls of the plugins.
+	Limits Limits
+	// MaxMetrics is the number of metric names a plugin can create, 0 for no
+	// limit.
+	MaxMetrics int
+}
+
+// Runtime compiles the plugins of a tablet, and runs their calls within
+// limits.
+type Runtime struct {
+	limits    Limits
+	calls     *stats.CountersWithMultiLabels
+	errors    *stats.CountersWithMultiLabels
+	latency   *servenv.MultiTimingsWrapper
+	limitsHit *stats.CountersWithMultiLabels
+	metrics   *pluginMetrics
+
+	mu sync.Mutex
+	// runtime is created by the first compilation.
+	runtime wazero.Runtime
+}
+
+// NewRuntime returns a runtime configured by config.
+func NewRuntime(config Config, exporter *servenv.Exporter) *Runtime {
+	return &Runtime{
+		limits:    config.Limits,
+		calls:     exporter.NewCountersWithMultiLabels("WasmPluginCalls", "The calls of the WASM plugins", []string{"Plugin", "Hook"}),
+		errors:    exporter.NewCountersWithMultiLabels("WasmPluginErrors", "The calls of the WASM plugins which failed, by kind", []string{"Plugin", "Hook", "Kind"}),
+		latency:   exporter.NewMultiTimings("WasmPluginLatency", "The time of the calls of the WASM plugins", []string{"Plugin", "Hook"}),
+		limitsHit: exporter.NewCountersWithMultiLabels("WasmPluginLimitsHit", "The calls of the WASM plugins stopped by a limit", []string{"Plugin", "Limit"}),
+		metrics:   newPluginMetrics(config.MaxMetrics, exporter),
+	}
+}
+
+// Limits returns the limits of the calls.
+func (rt *Runtime) Limits() Limits {
+	return rt.limits
+}
+
+func (rt *Runtime) wazero(ctx context.Context) (wazero.Runtime, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.runtime != nil {
+		return rt.runtime, nil
+	}
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(rt.limits.memoryPages()).
+		WithCloseOnContextDone(true)
+	r := wazero.NewRuntimeWithConfig(ctx, config)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	if err := rt.instantiateHost(ctx, r); err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	rt.runtime = r
+	return r, nil
+}
+
+// Close closes the runtime, and the modules it compiled.
+func (rt *Runtime) Close(ctx context.Context) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.runtime == nil {
+		return nil
+	}
+	err := rt.runtime.Close(ctx)
+	rt.runtime = nil
+	return err
+}
+
+// Compile compiles the binary of a plugin, checks that it implements the ABI,
+// and instantiates it once to run its initialization.
+func (rt *Runtime) Compile(ctx context.Context, ref string, binary []byte) (*Module, error) {
+	r, err := rt.wazero(ctx)
+	if err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "cannot start the WASM runtime: %v", err)
+	}
+	instrumented, err := instrument(binary, rt.limits.fuel(), rt.limits.memoryPages())
+	if err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid plugin %s: %v", ref, err)
+	}
+	compiled, err := r.CompileModule(ctx, instrumented)
+	if err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid plugin %s: %v", ref, err)
+	}
+	m := &Module{
+		ref:       ref,
+		rt:        rt,
+		compiled:  compiled,
+		hooks:     map[Hook]bool{},
+		instances: make(chan *instance, maxIdleInstances),
+		logger:    logutil.NewThrottledLogger("wasm plugin "+ref, logInterval),
+	}
+	if err := m.check(); err != nil {
+		_ = compiled.Close(ctx)
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid plugin %s: %v", ref, err)
+	}
+	if rt.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rt.limits.Timeout)
+		defer cancel()
+	}
+	inst, err := m.instantiate(ctx)
+	if err != nil {
+		_ = compiled.Close(ctx)
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid plugin %s: %v", ref, firstLine(err))
+	}
+	m.put(inst)
+	return m, nil
+}
+
+// Module is a compiled plugin. Its calls run in instances of a pool, so that
+// the concurrent calls don't share a memory.
+type Module struct {
+	ref      string
+	rt       *Runtime
+	compiled wazero.CompiledModule
+	hooks    map[Hook]bool
+	// instances are the idle instances.
+	instances chan *instance
+	// logger logs the messages of the plugin.
+	logger *logutil.ThrottledLogger
+	// closed is set once the module is closed.
+	closed atomic.Bool
+}
+
+// check checks that the module implements the ABI the host serves, and
+// imports only what the host provides.
+func (m *Module) check() error {
+	exports := m.compiled.ExportedFunctions()
+	if _, ok := exports[ABIVersionExport(ABIVersion)]; !ok {
+		var versions []int
+		for name := range exports {
+			if v, err := strconv.Atoi(strings.TrimPrefix(name, abiVersionExportPrefix)); err == nil && strings.HasPrefix(name, abiVersionExportPrefix) {
+				versions = append(versions, v)
+			}
+		}
+		if len(versions) == 0 {
+			return fmt.Errorf("it doesn't export %s", ABIVersionExport(ABIVersion))
+		}
+		sort.Ints(versions)
+		return fmt.Errorf("it implements the ABI versions %v, the host serves version %d", versions, ABIVersion)
+	}
+	i32, i64 := api.ValueTypeI32, api.ValueTypeI64
+	if err := checkSignature(exports, allocExport, []api.ValueType{i32}, []api.ValueType{i32}); err != nil {
+		return err
+	}
+	for _, hook := range Hooks {
+		if _, ok := exports[hook.Export()]; !ok {
+			continue
+		}
+		if err := checkSignature(exports, hook.Export(), []api.ValueType{i32, i32}, []api.ValueType{i64}); err != nil {
+			return err
+		}
+		m.hooks[hook] = true
+	}
+	for _, fn := range m.compiled.ImportedFunctions() {
+		if module, name, _ := fn.Import(); !allowedImports[module] {
+			return fmt.Errorf("it imports %s.%s, which the host doesn't provide", module, name)
+		}
+	}
+	if len(m.compiled.ImportedMemories()) > 0 {
+		return fmt.Errorf("it imports a memory")
+	}
+	if len(m.hooks) == 0 {
+		return fmt.Errorf("it doesn't export any hook")
+	}
+	return nil
+}
+
+func checkSignature(exports map[string]api.FunctionDefinition, name string, params, results []api.ValueType) error {
+	fn, ok := exports[name]
+	if !ok {
+		return fmt.Errorf("it doesn't export %s", name)
+	}
+	if string(fn.ParamTypes()) != string(params) || string(fn.ResultTypes()) != string(results) {
+		return fmt.Errorf("%s is %s, not %s", name, signature(fn.ParamTypes(), fn.ResultTypes()), signature(params, results))
+	}
+	return nil
+}
+
+// signature returns the signature of a function, like (i32, i32) i64.
+func signature(params, results []api.ValueType) string {
+	names := func(types []api.ValueType) string {
+		var s []string
+		for _, t := range types {
+			s = append(s, api.ValueTypeName(t))
+		}
+		return strings.Join(s, ", ")
+	}
+	return strings.TrimSpace("(" + names(params) + ") " + names(results))
+}
+
+// Ref implements Plugin.
+func (m *Module) Ref() string {
+	return m.ref
+}
+
+// Implements implements Plugin.
+func (m *Module) Implements(hook Hook) bool {
+	return m.hooks[hook]
+}
+
+// Call implements Plugin. The limits of the runtime, lowered by the ones of
+// the call, bound it; a call stopped by a limit fails with a LimitError. The
+// changes the plugin makes with the host functions are made to call. The
+// calls of a stream run in the instance it holds. A call which fails, the
+// host panicking included, fails with a PluginError, and only fails the
+// queries of the plugin.
+func (m *Module) Call(ctx context.Context, call *Call) (resp *Response, err error) {
+	if !m.hooks[call.Hook] {
+		return &Response{Decision: DecisionContinue}, nil
+	}
+	if m.closed.Load() {
+		return nil, vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "wasm plugin %s was unloaded", m.ref)
+	}
+	labels := []string{m.ref, string(call.Hook)}
+	m.rt.calls.Add(labels, 1)
+	defer m.rt.latency.Record(labels, time.Now())
+	var inst *instance
+	defer func() {
+		if x := recover(); x != nil {
+			log.Errorf("The host panicked serving wasm plugin %s in %s: %v\n%s", m.ref, call.Hook, x, debug.Stack())
+			if inst != nil {
+				// The instance may be in the middle of the call.
+				call.Stream.drop(inst)
+				inst.close()
+			}
+			resp, err = nil, m.failed(call.Hook, FailureHostPanic, fmt.Errorf("%v", x))
+		}
+	}()
+	input, err := call.Input()
+	if err != nil {
+		return nil, m.failed(call.Hook, FailureHostPanic, err)
+	}
+	limits := m.rt.limits.Lower(call.Limits)
+	callCtx := withHostCall(ctx, m, call)
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(callCtx, limits.Timeout)
+		defer cancel()
+	}
+	inst = call.Stream.held(m)
+	if inst == nil {
+		if inst, err = m.get(callCtx); err != nil {
+			return nil, m.callErr(ctx, call.Hook, nil, err)
+		}
+	}
+	output, err := inst.call(callCtx, call.Hook, input, limits)
+	if err != nil {
+		// The memory of an instance which failed may be corrupt.
+		err = m.callErr(ctx, call.Hook, inst, err)
+		call.Stream.drop(inst)
+		inst.close()
+		return nil, err
+	}
+	if call.Stream != nil {
+		call.Stream.hold(m, inst)
+	} else {
+		m.put(inst)
+	}
+	inst = nil
+	if resp, err = ParseResponse(call.Hook, output); err != nil {
+		return nil, m.failed(call.Hook, FailureInvalidResponse, err)
+	}
+	return resp, nil
+}
+
+// callErr returns the error of a call which failed, telling the limit which
+// stopped it.
+func (m *Module) callErr(ctx context.Context, hook Hook, inst *instance, err error) error {
+	var exitErr *sys.ExitError
+	switch {
+	case ctx.Err() != nil:
+		// The query is done.
+		return vterrors.Errorf(vterrors.Code(ctx.Err()), "wasm plugin %s interrupted in %s: %v", m.ref, hook, ctx.Err())
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == sys.ExitCodeDeadlineExceeded:
+		return m.limitHit(hook, LimitTimeout)
+	case inst != nil && int64(inst.fuel.Get()) < 0:
+		return m.limitHit(hook, LimitFuel)
+	case inst != nil && inst.limitHit.Get() != 0:
+		return m.limitHit(hook, LimitMemory)
+	}
+	return m.failed(hook, failureKind(err), firstLine(err))
+}
+
+// failureKind returns the kind of the failure of a call which failed with
+// err. wazero recovers the panics of the host functions into errors, and
+// tells the bugs, like a nil dereference, from the deliberate panics.
+func failureKind(err error) string {
+	var runtimeErr runtime.Error
+	switch {
+	case errors.As(err, &runtimeErr):
+		return FailureHostPanic
+	case errors.Is(err, errInvalidResponse):
+		return FailureInvalidResponse
+	}
+	return FailureTrap
+}
+
+func (m *Module) limitHit(hook Hook, limit Limit) error {
+	m.rt.limitsHit.Add([]string{m.ref, string(limit)}, 1)
+	return &LimitError{Plugin: m.ref, Hook: hook, Limit: limit}
+}
+
+func (m *Module) failed(hook Hook, kind string, err error) error {
+	m.rt.errors.Add([]string{m.ref, string(hook), kind}, 1)
+	return &PluginError{Plugin: m.ref, Hook: hook, Kind: kind, Err: err}
+}
+
+// firstLine returns the first line of an error, without the stack trace of
+// the traps.
+func firstLine(err error) error {
+	if msg, _, ok := strings.Cut(err.Error(), "\n"); ok {
+		return errors.New(msg)
+	}
+	return err
+}
+
+func (m *Module) get(ctx context.Context) (*instance, error) {
+	select {
+	case inst := <-m.instances:
+		return inst, nil
+	default:
+		return m.instantiate(ctx)
+	}
+}
+
+func (m *Module) put(inst *instance) {
+	select {
+	case m.instances <- inst:
+	default:
+		inst.close()
+	}
+	if m.closed.Load() {
+		m.closeIdle()
+	}
+}
+
+// Close closes the module, and its idle instances. The calls running finish,
+// and close their instances.
+func (m *Module) Close(ctx context.Context) error {
+	if m.closed.Swap(true) {
+		return nil
+	}
+	m.closeIdle()
+	return m.compiled.Close(ctx)
+}
+
+func (m *Module) closeIdle() {
+	for {
+		select {
+		case inst := <-m.instances:
+			inst.close()
+		default:
+			return
+		}
+	}
+}
+
+// Stream holds an instance of a plugin for the calls of the result hooks of a
+// query, so that the plugin keeps its state between the chunks, like a
+// running count, in its memory. The instance goes back to the pool once the
+// stream is closed, and its next query finds the state left by this one: the
+// plugins reset it in result_fields.
+type Stream struct {
+	module *Module
+	inst   *instance
+}
+
+// held returns the instance of m the stream holds, if any.
+func (s *Stream) held(m *Module) *instance {
+	if s == nil || s.module != m {
+		return nil
+	}
+	return s.inst
+}
+
+// hold holds an instance of m, returning the one held before to its pool.
+func (s *Stream) hold(m *Module, inst *instance) {
+	if s == nil {
+		return
+	}
+	if s.inst != nil && s.inst != inst {
+		s.module.put(s.inst)
+	}
+	s.module, s.inst = m, inst
+}
+
+// drop stops holding inst, if the stream holds it.
+func (s *Stream) drop(inst *instance) {
+	if s != nil && s.inst == inst {
+		s.module, s.inst = nil, nil
+	}
+}
+
+// Close returns the instance the stream holds to its pool.
+func (s *Stream) Close() {
+	s.hold(nil, nil)
+}
+
+// instance is an instance of a module.
+type instance struct {
+	module                      api.Module
+	alloc                       api.Function
+	fuel, memoryLimit, limitHit api.MutableGlobal
+}
+
+func (m *Module) instantiate(ctx context.Context) (*instance, error) {
+	r, err := m.rt.wazero(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mod, err := r.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, err
+	}
+	inst := &instance{module: mod, alloc: mod.ExportedFunction(allocExport)}
+	inst.fuel, _ = mod.ExportedGlobal(fuelExport).(api.MutableGlobal)
+	inst.memoryLimit, _ = mod.ExportedGlobal(memoryLimitExport).(api.MutableGlobal)
+	inst.limitHit, _ = mod.ExportedGlobal(limitHitExport).(api.MutableGlobal)
+	if mod.Memory() == nil || inst.fuel == nil || inst.memoryLimit == nil || inst.limitHit == nil {
+		inst.close()
+		return nil, fmt.Errorf("it has no memory")
+	}
+	return inst, nil
+}
+
+// call calls a hook with its JSON input, and returns the JSON output.
+func (inst *instance) call(ctx context.Context, hook Hook, input []byte, limits Limits) ([]byte, error) {
+	inst.fuel.Set(uint64(limits.fuel()))
+	inst.memoryLimit.Set(uint64(limits.memoryPages()))
+	inst.limitHit.Set(0)
+	results, err := inst.alloc.Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(results[0])
+	memory := inst.module.Memory()
+	if !memory.Write(ptr, input) {
+		return nil, fmt.Errorf("%w: %s returned %d, out of its memory", errInvalidResponse, allocExport, ptr)
+	}
+	results, err = inst.module.ExportedFunction(hook.Export()).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	output, ok := memory.Read(uint32(results[0]>>32), uint32(results[0]))
+	if !ok {
+		return nil, fmt.Errorf("%w: the response at %d of %d bytes is out of its memory", errInvalidResponse, uint32(results[0]>>32), uint32(results[0]))
+	}
+	// The memory is reused by the next calls.
+	return append([]byte(nil), output...), nil
+}
+
+func (inst *instance) close() {
+	_ = inst.module.Close(context.Background())
+}
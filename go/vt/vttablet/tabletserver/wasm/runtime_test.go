@@ -0,0 +1,263 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm/wasmtest"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func newTestRuntime(t *testing.T, limits Limits) *Runtime {
+	rt := NewRuntime(Config{Limits: limits}, servenv.NewExporter("WasmRuntimeTest", "Tablet"))
+	t.Cleanup(func() {
+		_ = rt.Close(context.Background())
+	})
+	return rt
+}
+
+// spin is the code of a hook which never returns.
+var spin = [][]byte{wasmtest.Loop(wasmtest.Br(0)), wasmtest.I64Const(0)}
+
+// grow is the code of a hook which grows its memory by pages, and traps if
+// it can't, or responds.
+func grow(pages int32, respond []byte) [][]byte {
+	return [][]byte{
+		wasmtest.I32Const(pages), wasmtest.MemoryGrow, wasmtest.I32Const(-1), wasmtest.I32Eq, wasmtest.If(wasmtest.Unreachable),
+		respond,
+	}
+}
+
+func TestRuntimeCompile(t *testing.T) {
+	ctx := context.Background()
+	rt := newTestRuntime(t, Limits{})
+
+	plugin := wasmtest.NewPlugin()
+	plugin.Respond(string(HookBeforeExecution), `{"action": "continue"}`)
+	plugin.Respond(string(HookOnError), `{"action": "continue"}`)
+	m, err := rt.Compile(ctx, "tenant@1", plugin.Build())
+	require.NoError(t, err)
+	assert.Equal(t, "tenant@1", m.Ref())
+	assert.True(t, m.Implements(HookBeforeExecution))
+	assert.True(t, m.Implements(HookOnError))
+	assert.False(t, m.Implements(HookAfterExecution))
+
+	noABI := wasmtest.New()
+	noABI.Memory(1)
+	noABI.Export("wescale_alloc", noABI.Func([]wasmtest.ValType{wasmtest.I32}, []wasmtest.ValType{wasmtest.I32}, nil, wasmtest.I32Const(0)))
+	laterABI := wasmtest.New()
+	laterABI.Memory(1)
+	laterABI.Export("wescale_alloc", laterABI.Func([]wasmtest.ValType{wasmtest.I32}, []wasmtest.ValType{wasmtest.I32}, nil, wasmtest.I32Const(0)))
+	laterABI.Export("wescale_abi_version_2", laterABI.Func(nil, nil, nil))
+	badHook := wasmtest.NewPlugin()
+	badHook.Export("wescale_before_execution", badHook.Func(nil, nil, nil))
+	noHook := wasmtest.NewPlugin()
+	imports := wasmtest.New()
+	imports.Import("env", "now", nil, []wasmtest.ValType{wasmtest.I64})
+	imports.Plugin()
+
+	for _, tcase := range []struct {
+		binary []byte
+		err    string
+	}{{
+		binary: []byte("\x00asm\x02\x00\x00\x00"),
+		err:    "invalid plugin bad@1: not a WASM module of version 1",
+	}, {
+		binary: noABI.Build(),
+		err:    "invalid plugin bad@1: it doesn't export wescale_abi_version_1",
+	}, {
+		binary: laterABI.Build(),
+		err:    "invalid plugin bad@1: it implements the ABI versions [2], the host serves version 1",
+	}, {
+		binary: badHook.Build(),
+		err:    "invalid plugin bad@1: wescale_before_execution is (), not (i32, i32) i64",
+	}, {
+		binary: imports.Build(),
+		err:    "invalid plugin bad@1: it imports env.now, which the host doesn't provide",
+	}, {
+		binary: noHook.Build(),
+		err:    "invalid plugin bad@1: it doesn't export any hook",
+	}} {
+		_, err := rt.Compile(ctx, "bad@1", tcase.binary)
+		assert.EqualError(t, err, tcase.err)
+		assert.Equal(t, vtrpcpb.Code_INVALID_ARGUMENT, vterrors.Code(err))
+	}
+}
+
+func TestRuntimeCall(t *testing.T) {
+	ctx := context.Background()
+	rt := newTestRuntime(t, Limits{Fuel: 10000, MemoryPages: 16, Timeout: 10 * time.Second})
+	plugin := wasmtest.NewPlugin()
+	plugin.Respond(string(HookBeforeExecution), `{"action": "reject", "error": {"code": "PERMISSION_DENIED", "message": "no tenant"}}`)
+	plugin.Hook(string(HookOnError), wasmtest.Unreachable, wasmtest.I64Const(0))
+	m, err := rt.Compile(ctx, "tenant@1", plugin.Build())
+	require.NoError(t, err)
+
+	// The concurrent calls run in instances of their own.
+	var wg sync.WaitGroup
+	for i := 0; i < 2*maxIdleInstances; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := m.Call(ctx, &Call{Hook: HookBeforeExecution, Query: "select 1"})
+			if assert.NoError(t, err) {
+				assert.Equal(t, &Response{Decision: DecisionReject, Error: &Error{Code: "PERMISSION_DENIED", Message: "no tenant"}}, resp)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, len(m.instances), maxIdleInstances)
+
+	// The hooks the plugin doesn't implement let the queries continue.
+	resp, err := m.Call(ctx, &Call{Hook: HookAfterExecution})
+	require.NoError(t, err)
+	assert.Equal(t, DecisionContinue, resp.Decision)
+
+	// A trap fails the call, and the next calls get another instance.
+	_, err = m.Call(ctx, &Call{Hook: HookOnError, Err: errors.New("failed")})
+	assert.ErrorContains(t, err, "wasm plugin tenant@1 failed in on_error: wasm error: unreachable")
+	assert.Equal(t, vtrpcpb.Code_INTERNAL, vterrors.Code(err))
+	_, err = m.Call(ctx, &Call{Hook: HookBeforeExecution})
+	assert.NoError(t, err)
+
+	// A call of a query which is done is interrupted.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = m.Call(canceled, &Call{Hook: HookBeforeExecution})
+	assert.Equal(t, vtrpcpb.Code_CANCELED, vterrors.Code(err))
+}
+
+func TestRuntimeLimits(t *testing.T) {
+	ctx := context.Background()
+	rt := newTestRuntime(t, Limits{Fuel: 1000, MemoryPages: 16, Timeout: 10 * time.Second})
+	plugin := wasmtest.NewPlugin()
+	respond := wasmtest.Packed(plugin.Data([]byte(`{"action": "continue"}`)), 22)
+	// before_execution iterates 500 times.
+	plugin.Hook(string(HookBeforeExecution),
+		wasmtest.Loop(
+			wasmtest.LocalGet(2), wasmtest.I32Const(1), wasmtest.I32Add, wasmtest.LocalSet(2),
+			wasmtest.LocalGet(2), wasmtest.I32Const(500), wasmtest.I32LtU, wasmtest.BrIf(0),
+		),
+		respond)
+	plugin.Hook(string(HookAfterExecution), spin...)
+	plugin.Hook(string(HookOnError), grow(8, respond)...)
+	m, err := rt.Compile(ctx, "limited@1", plugin.Build())
+	require.NoError(t, err)
+
+	limitErr := func(err error, limit Limit) {
+		t.Helper()
+		var limitErr *LimitError
+		require.True(t, errors.As(err, &limitErr), "%v", err)
+		assert.Equal(t, limit, limitErr.Limit)
+		assert.Equal(t, vtrpcpb.Code_RESOURCE_EXHAUSTED, vterrors.Code(err))
+	}
+
+	// The fuel is given again to each call.
+	for i := 0; i < 3; i++ {
+		_, err = m.Call(ctx, &Call{Hook: HookBeforeExecution})
+		require.NoError(t, err)
+	}
+	// The calls can lower the fuel, not raise it.
+	_, err = m.Call(ctx, &Call{Hook: HookBeforeExecution, Limits: Limits{Fuel: 100}})
+	limitErr(err, LimitFuel)
+	_, err = m.Call(ctx, &Call{Hook: HookAfterExecution, Limits: Limits{Fuel: 1 << 40}})
+	limitErr(err, LimitFuel)
+	assert.EqualError(t, err, "wasm plugin limited@1 exceeded its fuel limit in after_execution")
+
+	// The memory grows up to the limit.
+	_, err = m.Call(ctx, &Call{Hook: HookOnError, Err: errors.New("failed")})
+	require.NoError(t, err)
+	_, err = m.Call(ctx, &Call{Hook: HookOnError, Err: errors.New("failed"), Limits: Limits{MemoryPages: 8}})
+	limitErr(err, LimitMemory)
+	_, err = m.Call(ctx, &Call{Hook: HookOnError, Err: errors.New("failed")})
+	require.NoError(t, err)
+	_, err = m.Call(ctx, &Call{Hook: HookOnError, Err: errors.New("failed")})
+	limitErr(err, LimitMemory)
+	counts := rt.limitsHit.Counts()
+	assert.EqualValues(t, 2, counts["limited@1.fuel"])
+	assert.EqualValues(t, 2, counts["limited@1.memory"])
+
+	// Without fuel limit, the wall clock stops the call.
+	rt = newTestRuntime(t, Limits{Timeout: time.Minute})
+	m, err = rt.Compile(ctx, "limited@1", plugin.Build())
+	require.NoError(t, err)
+	start := time.Now()
+	_, err = m.Call(ctx, &Call{Hook: HookAfterExecution, Limits: Limits{Timeout: 20 * time.Millisecond}})
+	limitErr(err, LimitTimeout)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.EqualValues(t, 1, rt.limitsHit.Counts()["limited@1.timeout"])
+}
+
+func TestRuntimeFailures(t *testing.T) {
+	ctx := context.Background()
+	rt := newTestRuntime(t, Limits{})
+	plugin := wasmtest.NewPlugin()
+	plugin.Respond(string(HookBeforeExecution), `{"action": "continue"}`)
+	plugin.Hook(string(HookOnError), wasmtest.Unreachable, wasmtest.I64Const(0))
+	plugin.Hook(string(HookAfterExecution), wasmtest.Packed(0xFFFF0000, 16))
+	plugin.Respond(string(HookResultEnd), `{"action": `)
+	m, err := rt.Compile(ctx, "crash@1", plugin.Build())
+	require.NoError(t, err)
+
+	failure := func(call *Call, kind, msg string) {
+		t.Helper()
+		_, err := m.Call(ctx, call)
+		var pluginErr *PluginError
+		require.True(t, errors.As(err, &pluginErr), "%v", err)
+		assert.Equal(t, kind, pluginErr.Kind)
+		assert.ErrorContains(t, err, msg)
+		// The clients can tell a plugin which failed from a query which
+		// failed.
+		assert.Equal(t, vtrpcpb.Code_INTERNAL, vterrors.Code(err))
+		sqlErr, ok := mysql.NewSQLErrorFromError(err).(*mysql.SQLError)
+		require.True(t, ok)
+		assert.Equal(t, mysql.ERWasmPluginFailed, sqlErr.Num)
+		// The other calls of the plugin are not affected.
+		_, err = m.Call(ctx, &Call{Hook: HookBeforeExecution})
+		require.NoError(t, err)
+	}
+	failure(&Call{Hook: HookOnError, Err: errors.New("failed")}, FailureTrap, "wasm plugin crash@1 failed in on_error: wasm error: unreachable")
+	failure(&Call{Hook: HookAfterExecution}, FailureInvalidResponse, "invalid response: the response at 4294901760 of 16 bytes is out of its memory")
+	failure(&Call{Hook: HookResultEnd}, FailureInvalidResponse, "invalid response: unexpected end of JSON input")
+	// The host panics building the input of a call.
+	failure(&Call{Hook: HookBeforeExecution, BindVars: map[string]*querypb.BindVariable{"id": nil}}, FailureHostPanic, "invalid memory address or nil pointer dereference")
+	assert.LessOrEqual(t, len(m.instances), maxIdleInstances)
+
+	errs := rt.errors.Counts()
+	assert.EqualValues(t, 1, errs["crash@1.on_error.trap"])
+	assert.EqualValues(t, 1, errs["crash@1.after_execution.invalid_response"])
+	assert.EqualValues(t, 1, errs["crash@1.result_end.invalid_response"])
+	assert.EqualValues(t, 1, errs["crash@1.before_execution.host_panic"])
+	assert.EqualValues(t, 5, rt.calls.Counts()["crash@1.before_execution"])
+	assert.EqualValues(t, 1, rt.calls.Counts()["crash@1.on_error"])
+	assert.EqualValues(t, 5, rt.latency.Counts()["WasmRuntimeTest.crash@1.before_execution"])
+
+	// wazero recovers the panics of the host functions into errors.
+	var runtimeErr error
+	func() {
+		defer func() {
+			runtimeErr = recover().(error)
+		}()
+		var m map[string]int
+		m["panic"] = 1
+	}()
+	assert.Equal(t, FailureHostPanic, failureKind(fmt.Errorf("%w (recovered by wazero)", runtimeErr)))
+	assert.Equal(t, FailureTrap, failureKind(errors.New("wasm error: unreachable")))
+}
@@ -0,0 +1,406 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+// Package wasmtest builds the WASM modules of the tests of the plugins,
+// without a WASM toolchain.
+package wasmtest
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// ValType is the type of a value.
+type ValType byte
+
+const (
+	I32 ValType = 0x7F
+	I64 ValType = 0x7E
+	F32 ValType = 0x7D
+	F64 ValType = 0x7C
+)
+
+const (
+	// dataStart is where the data of the modules starts in memory.
+	dataStart = 1024
+	// HeapStart is where the heap of the plugins starts in memory. The heap
+	// is reset at the end of each hook.
+	HeapStart = 32 * 1024
+)
+
+// Module is a WASM module being built. The functions are numbered in the
+// order they are added, the imported ones first: they must be imported
+// before any function is added.
+type Module struct {
+	types   []funcType
+	imports []importFunc
+	funcs   []function
+	globals []global
+	exports []export
+	data    []segment
+	dataEnd uint32
+	// memory is the number of pages of the memory, 0 for no memory.
+	memory uint32
+	// plugin is set for the modules implementing the ABI of the plugins.
+	plugin bool
+	// heap is the global of the top of the heap of a plugin.
+	heap uint32
+}
+
+type funcType struct {
+	params, results []ValType
+}
+
+type importFunc struct {
+	module, name string
+	typ          int
+}
+
+type function struct {
+	typ    int
+	locals []ValType
+	code   []byte
+}
+
+type global struct {
+	typ  ValType
+	init []byte
+}
+
+type export struct {
+	name string
+	kind byte
+	idx  uint32
+}
+
+type segment struct {
+	offset uint32
+	data   []byte
+}
+
+// New returns an empty module, without memory.
+func New() *Module {
+	return &Module{dataEnd: dataStart}
+}
+
+// NewPlugin returns a module implementing the ABI of the plugins, with a
+// memory of a page, wescale_alloc and wescale_abi_version_1, and no hook.
+func NewPlugin() *Module {
+	return New().Plugin()
+}
+
+// Plugin makes the module implement the ABI of the plugins, see NewPlugin.
+// The functions the plugin imports are imported before.
+func (m *Module) Plugin() *Module {
+	m.Memory(1)
+	m.plugin = true
+	m.heap = m.Global(I32, I32Const(HeapStart))
+	m.Export("wescale_alloc", m.Func([]ValType{I32}, []ValType{I32}, []ValType{I32},
+		GlobalGet(m.heap), LocalSet(1),
+		GlobalGet(m.heap), LocalGet(0), I32Add, GlobalSet(m.heap),
+		// Grows the memory up to the heap.
+		Block(Loop(
+			GlobalGet(m.heap), MemorySize, I32Const(16), I32Shl, I32LeU, BrIf(1),
+			I32Const(1), MemoryGrow, I32Const(-1), I32Eq, If(Unreachable), Br(0),
+		)),
+		LocalGet(1),
+	))
+	m.Export("wescale_abi_version_1", m.Func(nil, nil, nil))
+	return m
+}
+
+// Memory gives the module an exported memory of pages pages.
+func (m *Module) Memory(pages uint32) {
+	m.memory = pages
+}
+
+// Import imports a function, and returns its index.
+func (m *Module) Import(module, name string, params, results []ValType) uint32 {
+	if len(m.funcs) > 0 {
+		panic("wasmtest: import after a function")
+	}
+	m.imports = append(m.imports, importFunc{module: module, name: name, typ: m.typ(params, results)})
+	return uint32(len(m.imports) - 1)
+}
+
+// Func adds a function, with its locals after its params, and returns its
+// index. The code is the instructions of its body, without the final end.
+func (m *Module) Func(params, results, locals []ValType, code ...[]byte) uint32 {
+	m.funcs = append(m.funcs, function{typ: m.typ(params, results), locals: locals, code: concat(code)})
+	return uint32(len(m.imports) + len(m.funcs) - 1)
+}
+
+// Global adds a mutable global, initialized by the constant instruction init,
+// and returns its index.
+func (m *Module) Global(typ ValType, init []byte) uint32 {
+	m.globals = append(m.globals, global{typ: typ, init: init})
+	return uint32(len(m.globals) - 1)
+}
+
+// Export exports a function.
+func (m *Module) Export(name string, fn uint32) {
+	m.exports = append(m.exports, export{name: name, kind: 0x00, idx: fn})
+}
+
+// ExportGlobal exports a global.
+func (m *Module) ExportGlobal(name string, g uint32) {
+	m.exports = append(m.exports, export{name: name, kind: 0x03, idx: g})
+}
+
+// Data puts data in memory, and returns its offset.
+func (m *Module) Data(data []byte) uint32 {
+	offset := m.dataEnd
+	if m.memory == 0 || (m.plugin && offset+uint32(len(data)) > HeapStart) {
+		panic("wasmtest: no room for the data")
+	}
+	m.data = append(m.data, segment{offset: offset, data: data})
+	m.dataEnd = (offset + uint32(len(data)) + 7) &^ 7
+	return offset
+}
+
+// Hook exports the function of a hook of a plugin, wescale_<hook>(ptr i32,
+// len i32) i64. Its code leaves the packed pointer and length of the
+// response on the stack, and doesn't return otherwise. It has the locals 2
+// and 3, i32, and 4, i64.
+func (m *Module) Hook(hook string, code ...[]byte) uint32 {
+	fn := m.Func([]ValType{I32, I32}, []ValType{I64}, []ValType{I32, I32, I64},
+		concat(code), LocalSet(4), I32Const(HeapStart), GlobalSet(m.heap), LocalGet(4))
+	m.Export("wescale_"+hook, fn)
+	return fn
+}
+
+// Respond exports the function of a hook of a plugin which returns a
+// constant response.
+func (m *Module) Respond(hook string, response string) uint32 {
+	return m.Hook(hook, Packed(m.Data([]byte(response)), uint32(len(response))))
+}
+
+func (m *Module) typ(params, results []ValType) int {
+	for i, t := range m.types {
+		if string(valTypes(t.params)) == string(valTypes(params)) && string(valTypes(t.results)) == string(valTypes(results)) {
+			return i
+		}
+	}
+	m.types = append(m.types, funcType{params: params, results: results})
+	return len(m.types) - 1
+}
+
+// Build returns the binary of the module.
+func (m *Module) Build() []byte {
+	out := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	section := func(id byte, count int, items []byte) {
+		if count == 0 {
+			return
+		}
+		payload := binary.AppendUvarint(nil, uint64(count))
+		payload = append(payload, items...)
+		out = append(out, id)
+		out = binary.AppendUvarint(out, uint64(len(payload)))
+		out = append(out, payload...)
+	}
+
+	var items []byte
+	for _, t := range m.types {
+		items = append(items, 0x60)
+		items = appendVec(items, valTypes(t.params))
+		items = appendVec(items, valTypes(t.results))
+	}
+	section(1, len(m.types), items)
+
+	items = nil
+	for _, imp := range m.imports {
+		items = appendVec(items, []byte(imp.module))
+		items = appendVec(items, []byte(imp.name))
+		items = append(items, 0x00)
+		items = binary.AppendUvarint(items, uint64(imp.typ))
+	}
+	section(2, len(m.imports), items)
+
+	items = nil
+	for _, fn := range m.funcs {
+		items = binary.AppendUvarint(items, uint64(fn.typ))
+	}
+	section(3, len(m.funcs), items)
+
+	if m.memory > 0 {
+		section(5, 1, binary.AppendUvarint([]byte{0x00}, uint64(m.memory)))
+	}
+
+	items = nil
+	for _, g := range m.globals {
+		items = append(items, byte(g.typ), 0x01)
+		items = append(items, g.init...)
+		items = append(items, 0x0B)
+	}
+	section(6, len(m.globals), items)
+
+	exports := m.exports
+	if m.memory > 0 {
+		exports = append([]export{{name: "memory", kind: 0x02}}, exports...)
+	}
+	items = nil
+	for _, e := range exports {
+		items = appendVec(items, []byte(e.name))
+		items = append(items, e.kind)
+		items = binary.AppendUvarint(items, uint64(e.idx))
+	}
+	section(7, len(exports), items)
+
+	items = nil
+	for _, fn := range m.funcs {
+		var body []byte
+		body = binary.AppendUvarint(body, uint64(len(fn.locals)))
+		for _, l := range fn.locals {
+			body = append(body, 0x01, byte(l))
+		}
+		body = append(body, fn.code...)
+		body = append(body, 0x0B)
+		items = appendVec(items, body)
+	}
+	section(10, len(m.funcs), items)
+
+	items = nil
+	for _, s := range m.data {
+		items = append(items, 0x00)
+		items = append(items, I32Const(int32(s.offset))...)
+		items = append(items, 0x0B)
+		items = appendVec(items, s.data)
+	}
+	section(11, len(m.data), items)
+	return out
+}
+
+// The instructions.
+var (
+	Unreachable = op(0x00)
+	Drop        = op(0x1A)
+	MemoryGrow  = op(0x40, 0x00)
+	MemorySize  = op(0x3F, 0x00)
+	I32Eq       = op(0x46)
+	I32LtU      = op(0x49)
+	I32LeU      = op(0x4D)
+	I32Add      = op(0x6A)
+	I32Shl      = op(0x74)
+	I64ExtendU  = op(0xAD)
+	I64ExtendS  = op(0xAC)
+	I64Shl      = op(0x86)
+	I64Or       = op(0x84)
+	I64ShrU     = op(0x88)
+	I32WrapI64  = op(0xA7)
+	I32Load8U   = op(0x2D, 0x00, 0x00)
+	I32Store8   = op(0x3A, 0x00, 0x00)
+	I32Store    = op(0x36, 0x02, 0x00)
+	I64Store    = op(0x37, 0x03, 0x00)
+)
+
+// I32Const pushes an i32.
+func I32Const(v int32) []byte {
+	return appendSleb(op(0x41), int64(v))
+}
+
+// I64Const pushes an i64.
+func I64Const(v int64) []byte {
+	return appendSleb(op(0x42), v)
+}
+
+// F64Const pushes an f64.
+func F64Const(v float64) []byte {
+	return binary.LittleEndian.AppendUint64(op(0x44), math.Float64bits(v))
+}
+
+// Packed pushes a pointer and a length packed as ptr<<32 | len.
+func Packed(ptr, length uint32) []byte {
+	return I64Const(int64(ptr)<<32 | int64(length))
+}
+
+// Call calls a function.
+func Call(fn uint32) []byte {
+	return binary.AppendUvarint(op(0x10), uint64(fn))
+}
+
+// LocalGet pushes a local.
+func LocalGet(i uint32) []byte {
+	return binary.AppendUvarint(op(0x20), uint64(i))
+}
+
+// LocalSet pops a local.
+func LocalSet(i uint32) []byte {
+	return binary.AppendUvarint(op(0x21), uint64(i))
+}
+
+// GlobalGet pushes a global.
+func GlobalGet(i uint32) []byte {
+	return binary.AppendUvarint(op(0x23), uint64(i))
+}
+
+// GlobalSet pops a global.
+func GlobalSet(i uint32) []byte {
+	return binary.AppendUvarint(op(0x24), uint64(i))
+}
+
+// Loop is a loop without result around code.
+func Loop(code ...[]byte) []byte {
+	return append(append(op(0x03, 0x40), concat(code)...), 0x0B)
+}
+
+// Block is a block without result around code.
+func Block(code ...[]byte) []byte {
+	return append(append(op(0x02, 0x40), concat(code)...), 0x0B)
+}
+
+// If runs code if the i32 it pops isn't 0.
+func If(code ...[]byte) []byte {
+	return append(append(op(0x04, 0x40), concat(code)...), 0x0B)
+}
+
+// Br branches to the label at depth.
+func Br(depth uint32) []byte {
+	return binary.AppendUvarint(op(0x0C), uint64(depth))
+}
+
+// BrIf branches to the label at depth if the i32 it pops isn't 0.
+func BrIf(depth uint32) []byte {
+	return binary.AppendUvarint(op(0x0D), uint64(depth))
+}
+
+// Op is an instruction given by its bytes.
+func Op(b ...byte) []byte {
+	return op(b...)
+}
+
+func op(b ...byte) []byte {
+	return b
+}
+
+func concat(code [][]byte) []byte {
+	var out []byte
+	for _, c := range code {
+		out = append(out, c...)
+	}
+	return out
+}
+
+func valTypes(types []ValType) []byte {
+	b := make([]byte, len(types))
+	for i, t := range types {
+		b[i] = byte(t)
+	}
+	return b
+}
+
+func appendVec(b, items []byte) []byte {
+	return append(binary.AppendUvarint(b, uint64(len(items))), items...)
+}
+
+func appendSleb(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
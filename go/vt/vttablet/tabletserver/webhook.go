@@ -0,0 +1,161 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package tabletserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+)
+
+const (
+	// webhookQueueSize is the number of notifications a webhook buffers before
+	// it drops the new ones.
+	webhookQueueSize = 1000
+	// webhookTimeout bounds the time of a delivery attempt.
+	webhookTimeout = 5 * time.Second
+)
+
+// webhookRetryDelay is the delay before the first retry of a delivery, which
+// doubles at each retry.
+var webhookRetryDelay = 500 * time.Millisecond
+
+const (
+	webhookResultSent        = "sent"
+	webhookResultFailed      = "failed"
+	webhookResultDropped     = "dropped"
+	webhookResultRateLimited = "rate_limited"
+)
+
+var webhookLogger = logutil.NewThrottledLogger("Webhook", 10*time.Second)
+
+// webhooks are the URLs the WEBHOOK_NOTIFY rules post their notifications to.
+// The notifications are delivered, and retried, by one goroutine per URL, so
+// that a slow or unavailable webhook never blocks the queries: the
+// notifications which don't fit in its queue are dropped.
+type webhooks struct {
+	stats *tabletenv.Stats
+
+	mu       sync.Mutex
+	webhooks map[string]*webhook
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+type webhook struct {
+	url           string
+	client        *http.Client
+	notifications chan *webhookNotification
+}
+
+type webhookNotification struct {
+	rule    string
+	retries int
+	payload []byte
+}
+
+func newWebhooks(stats *tabletenv.Stats) *webhooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webhooks{stats: stats, webhooks: make(map[string]*webhook), ctx: ctx, cancel: cancel}
+}
+
+// notify queues a notification of a rule to a URL, which is retried up to
+// retries times, and returns false if the queue is full.
+func (whs *webhooks) notify(url, rule string, retries int, payload []byte) bool {
+	whs.mu.Lock()
+	wh, ok := whs.webhooks[url]
+	if !ok {
+		wh = &webhook{
+			url:           url,
+			client:        &http.Client{Timeout: webhookTimeout},
+			notifications: make(chan *webhookNotification, webhookQueueSize),
+		}
+		whs.webhooks[url] = wh
+		whs.wg.Add(1)
+		ctx := whs.ctx
+		go func() {
+			defer whs.wg.Done()
+			wh.run(ctx, whs.stats)
+		}()
+	}
+	whs.mu.Unlock()
+	select {
+	case wh.notifications <- &webhookNotification{rule: rule, retries: retries, payload: payload}:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops delivering the notifications, and drops the queued ones.
+func (whs *webhooks) close() {
+	whs.cancel()
+	whs.wg.Wait()
+	whs.mu.Lock()
+	defer whs.mu.Unlock()
+	whs.webhooks = make(map[string]*webhook)
+	whs.ctx, whs.cancel = context.WithCancel(context.Background())
+}
+
+func (wh *webhook) run(ctx context.Context, stats *tabletenv.Stats) {
+	for {
+		var notification *webhookNotification
+		select {
+		case <-ctx.Done():
+			return
+		case notification = <-wh.notifications:
+		}
+		result := webhookResultSent
+		if err := wh.deliver(ctx, notification); err != nil {
+			webhookLogger.Warningf("Failed to notify %s of a match of rule %s: %v", wh.url, notification.rule, err)
+			result = webhookResultFailed
+		}
+		stats.WebhookNotifications.Add([]string{notification.rule, result}, 1)
+	}
+}
+
+// deliver posts a notification, and retries it until it is delivered.
+func (wh *webhook) deliver(ctx context.Context, notification *webhookNotification) error {
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := wh.post(ctx, notification.payload)
+		if err == nil || attempt >= notification.retries {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+func (wh *webhook) post(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", wh.url, resp.Status)
+	}
+	return nil
+}
@@ -34,6 +34,7 @@ import (
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/schema"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver/tabletenv"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/wasm"
 	"vitess.io/vitess/go/vt/vttablet/vexec"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
@@ -201,6 +202,11 @@ func (tqsc *Controller) SetQueryRules(ruleSource string, qrs *rules.Rules) error
 	return nil
 }
 
+// ReloadWasmPlugins is part of the tabletserver.Controller interface
+func (tqsc *Controller) ReloadWasmPlugins(ctx context.Context, source wasm.Source) error {
+	return nil
+}
+
 // QueryService is part of the tabletserver.Controller interface
 func (tqsc *Controller) QueryService() queryservice.QueryService {
 	return nil
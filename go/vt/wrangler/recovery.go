@@ -0,0 +1,157 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wrangler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/grpcclient"
+	"vitess.io/vitess/go/vt/mysqlctl"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vttablet/tabletconn"
+
+	binlogdatapb "vitess.io/vitess/go/vt/proto/binlogdata"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// positionFinder walks the GTID events of a binlog stream and finds the
+// position which contains all the transactions committed before restoreTime.
+type positionFinder struct {
+	restoreTime int64
+	// lastPos is the position of the primary when the search started. The
+	// transactions committed before restoreTime are all contained in it.
+	lastPos mysql.Position
+	pos     mysql.Position
+}
+
+// advance consumes an event, and returns true once pos is found.
+func (f *positionFinder) advance(event *binlogdatapb.VEvent) (bool, error) {
+	if event.Gtid == "" {
+		return false, nil
+	}
+	if event.Timestamp >= f.restoreTime {
+		return true, nil
+	}
+	eventPos, err := mysql.DecodePosition(event.Gtid)
+	if err != nil {
+		return false, err
+	}
+	f.pos = eventPos
+	return eventPos.AtLeast(f.lastPos), nil
+}
+
+// FindPositionAtTime returns the replication position of the shard at
+// restoreTime, i.e. the position which contains all the transactions committed
+// before restoreTime. The binary logs of the primary are streamed from the
+// position of the latest full backup taken at or before restoreTime, so they
+// must not be purged yet.
+func (wr *Wrangler) FindPositionAtTime(ctx context.Context, keyspace, shard string, restoreTime time.Time) (mysql.Position, error) {
+	if restoreTime.After(time.Now()) {
+		return mysql.Position{}, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "restore time %v is in the future", restoreTime.UTC().Format(time.RFC3339))
+	}
+	backupPos, err := wr.findFullBackupPosition(ctx, keyspace, shard, restoreTime)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+
+	si, err := wr.ts.GetShard(ctx, keyspace, shard)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	if si.PrimaryAlias == nil {
+		return mysql.Position{}, vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "shard %v/%v has no primary", keyspace, shard)
+	}
+	primary, err := wr.ts.GetTablet(ctx, si.PrimaryAlias)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	primaryPos, err := wr.tmc.PrimaryPosition(ctx, primary.Tablet)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	finder := &positionFinder{restoreTime: restoreTime.Unix(), pos: backupPos}
+	if finder.lastPos, err = mysql.DecodePosition(primaryPos); err != nil {
+		return mysql.Position{}, err
+	}
+	if backupPos.AtLeast(finder.lastPos) {
+		return backupPos, nil
+	}
+
+	conn, err := tabletconn.GetDialer()(primary.Tablet, grpcclient.FailFast(false))
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("cannot connect to tablet %v: %v", topoproto.TabletAliasString(si.PrimaryAlias), err)
+	}
+	defer conn.Close(ctx)
+
+	req := &binlogdatapb.VStreamRequest{
+		Target: &querypb.Target{
+			Keyspace:   keyspace,
+			Shard:      shard,
+			TabletType: topodatapb.TabletType_PRIMARY,
+		},
+		Position: mysql.EncodePosition(backupPos),
+		Filter: &binlogdatapb.Filter{
+			Rules: []*binlogdatapb.Rule{{Match: "/.*"}},
+		},
+	}
+	err = conn.VStream(ctx, req, func(events []*binlogdatapb.VEvent) error {
+		for _, event := range events {
+			found, err := finder.advance(event)
+			if err != nil {
+				return err
+			}
+			if found {
+				return io.EOF
+			}
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return mysql.Position{}, vterrors.Wrapf(err, "failed to stream the binlogs of %v from %v", topoproto.TabletAliasString(si.PrimaryAlias), mysql.EncodePosition(backupPos))
+	}
+	return finder.pos, nil
+}
+
+// findFullBackupPosition returns the position of the latest full backup of the
+// shard taken at or before restoreTime.
+func (wr *Wrangler) findFullBackupPosition(ctx context.Context, keyspace, shard string, restoreTime time.Time) (mysql.Position, error) {
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	defer bs.Close()
+	bhs, err := bs.ListBackups(ctx, mysqlctl.GetBackupDir(keyspace, shard))
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	for i := len(bhs) - 1; i >= 0; i-- {
+		bm, err := mysqlctl.GetBackupManifest(ctx, bhs[i])
+		if err != nil {
+			wr.Logger().Warningf("Possibly incomplete backup %v on BackupStorage: can't read MANIFEST: %v", bhs[i].Name(), err)
+			continue
+		}
+		if bm.Incremental {
+			continue
+		}
+		backupTime, err := time.Parse(time.RFC3339, bm.BackupTime)
+		if err != nil {
+			wr.Logger().Warningf("Backup %v has an invalid backup time %v: %v", bhs[i].Name(), bm.BackupTime, err)
+			continue
+		}
+		if !backupTime.After(restoreTime) {
+			return bm.Position, nil
+		}
+	}
+	return mysql.Position{}, vterrors.Errorf(vtrpcpb.Code_NOT_FOUND, "no full backup of %v/%v taken at or before %v", keyspace, shard, restoreTime.UTC().Format(time.RFC3339))
+}
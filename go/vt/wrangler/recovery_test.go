@@ -0,0 +1,59 @@
+/*
+Copyright ApeCloud, Inc.
+Licensed under the Apache v2(found in the LICENSE file in the root directory).
+*/
+
+package wrangler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+
+	binlogdatapb "vitess.io/vitess/go/vt/proto/binlogdata"
+)
+
+func TestPositionFinder(t *testing.T) {
+	decode := func(pos string) mysql.Position {
+		p, err := mysql.DecodePosition(pos)
+		require.NoError(t, err)
+		return p
+	}
+	const uuid = "MySQL56/16b1039f-22b6-11ed-b765-0a43f95f28a3:"
+	events := []*binlogdatapb.VEvent{
+		{Type: binlogdatapb.VEventType_BEGIN, Timestamp: 100},
+		{Type: binlogdatapb.VEventType_GTID, Gtid: uuid + "1-11", Timestamp: 100},
+		{Type: binlogdatapb.VEventType_HEARTBEAT, Timestamp: 150},
+		{Type: binlogdatapb.VEventType_GTID, Gtid: uuid + "1-12", Timestamp: 200},
+		{Type: binlogdatapb.VEventType_GTID, Gtid: uuid + "1-13", Timestamp: 300},
+	}
+	find := func(restoreTime int64, lastPos string) (mysql.Position, bool) {
+		f := &positionFinder{restoreTime: restoreTime, lastPos: decode(lastPos), pos: decode(uuid + "1-10")}
+		for _, event := range events {
+			found, err := f.advance(event)
+			require.NoError(t, err)
+			if found {
+				return f.pos, true
+			}
+		}
+		return f.pos, false
+	}
+
+	// the transactions committed before the restore time
+	pos, found := find(200, uuid+"1-13")
+	assert.True(t, found)
+	assert.Equal(t, decode(uuid+"1-11"), pos)
+
+	// no transaction after the backup was committed before the restore time
+	pos, found = find(100, uuid+"1-13")
+	assert.True(t, found)
+	assert.Equal(t, decode(uuid+"1-10"), pos)
+
+	// the restore time is after the last transaction of the primary
+	pos, found = find(1000, uuid+"1-12")
+	assert.True(t, found)
+	assert.Equal(t, decode(uuid+"1-12"), pos)
+}